@@ -0,0 +1,44 @@
+package algorithms
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// Key derivation schemes for DeriveK
+const (
+	KDFHMACSHA256 = "hmac-sha256"
+)
+
+// KDFSchemes lists the schemes DeriveK accepts
+var KDFSchemes = []string{KDFHMACSHA256}
+
+// minMasterKeyLen is the shortest master key DeriveK accepts (128 bits)
+const minMasterKeyLen = 16
+
+// DeriveK derives the subscriber key K of a card from a master key and its ICCID.
+// hmac-sha256: the first keyLen bytes of HMAC-SHA256(master, ICCID), with the ICCID as
+// its ASCII digits (18-20 digits, without F padding). keyLen is 16 or 32 bytes.
+func DeriveK(scheme string, master []byte, iccid string, keyLen int) ([]byte, error) {
+	if keyLen != KeyLen128 && keyLen != KeyLen256 {
+		return nil, ErrInvalidKeyLength
+	}
+	if len(master) < minMasterKeyLen {
+		return nil, fmt.Errorf("master key too short: %d bytes, need at least %d", len(master), minMasterKeyLen)
+	}
+	iccid = strings.TrimRight(strings.ToUpper(iccid), "F")
+	if len(iccid) < 18 || len(iccid) > 20 || strings.Trim(iccid, "0123456789") != "" {
+		return nil, fmt.Errorf("invalid ICCID %q: must be 18-20 digits", iccid)
+	}
+
+	switch strings.ToLower(scheme) {
+	case KDFHMACSHA256:
+		mac := hmac.New(sha256.New, master)
+		mac.Write([]byte(iccid))
+		return mac.Sum(nil)[:keyLen], nil
+	default:
+		return nil, fmt.Errorf("unknown key derivation scheme %q (use: %s)", scheme, strings.Join(KDFSchemes, ", "))
+	}
+}
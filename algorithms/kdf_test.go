@@ -0,0 +1,75 @@
+package algorithms_test
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"sim_reader/algorithms"
+)
+
+func TestDeriveK_HMACSHA256(t *testing.T) {
+	master, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F")
+
+	tests := []struct {
+		name   string
+		iccid  string
+		keyLen int
+		want   string
+	}{
+		{"19 digits", "8988211000000000001", 16, "172989D8501439B9DFB90165693DB4B0"},
+		{"F padded", "8988211000000000001F", 16, "172989D8501439B9DFB90165693DB4B0"},
+		{"20 digits", "89882110000000000017", 16, "C0E4C1EF3D4176DC8F7150AB5A010B4B"},
+		{"256-bit", "89882110000000000017", 32, "C0E4C1EF3D4176DC8F7150AB5A010B4B131020A1A6CC9998BF79DE8786E97576"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k, err := algorithms.DeriveK("hmac-sha256", master, tc.iccid, tc.keyLen)
+			if err != nil {
+				t.Fatalf("DeriveK() error = %v", err)
+			}
+			if got := strings.ToUpper(hex.EncodeToString(k)); got != tc.want {
+				t.Errorf("DeriveK() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+
+	// 128-bit master key
+	short, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F")
+	k, err := algorithms.DeriveK("HMAC-SHA256", short, "8949000000000000001", 16)
+	if err != nil || strings.ToUpper(hex.EncodeToString(k)) != "87B9C59D943360C222E86B03C6C1ED04" {
+		t.Errorf("DeriveK() with a 128-bit master = %X, %v", k, err)
+	}
+
+	// OPc of the derived K (3GPP TS 35.208 test set 1 OP)
+	op, _ := hex.DecodeString("CDC202D5123E20F62B6D676AC72CB318")
+	k, _ = algorithms.DeriveK("hmac-sha256", master, "8988211000000000001", 16)
+	opc, err := algorithms.ComputeOPc(k, op)
+	if err != nil || strings.ToUpper(hex.EncodeToString(opc)) != "9B7D54F48C686095B2B274E096D8953D" {
+		t.Errorf("OPc of the derived K = %X, %v", opc, err)
+	}
+}
+
+func TestDeriveK_Invalid(t *testing.T) {
+	master := make([]byte, 32)
+	tests := []struct {
+		name   string
+		scheme string
+		master []byte
+		iccid  string
+		keyLen int
+	}{
+		{"unknown scheme", "pbkdf2", master, "8988211000000000001", 16},
+		{"short master", "hmac-sha256", master[:8], "8988211000000000001", 16},
+		{"key length", "hmac-sha256", master, "8988211000000000001", 24},
+		{"short ICCID", "hmac-sha256", master, "898821100000", 16},
+		{"ICCID not digits", "hmac-sha256", master, "89882110000000000A1", 16},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := algorithms.DeriveK(tc.scheme, tc.master, tc.iccid, tc.keyLen); err == nil {
+				t.Error("DeriveK() accepted invalid input")
+			}
+		})
+	}
+}
@@ -43,12 +43,30 @@ var (
 	milenageC5 = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x08}
 )
 
-// Milenage implements the 3GPP Milenage authentication algorithm
-type Milenage struct{}
+// Milenage implements the 3GPP Milenage authentication algorithm. The zero value is the
+// AlgorithmSet computing on the K and OPc of each Variables; NewMilenage binds an instance
+// to one subscriber for GenerateVector.
+type Milenage struct {
+	block cipher.Block // AES-128 keyed with K (nil for the zero value)
+	opc   [KeyLen128]byte
+}
 
-// NewMilenage creates a new Milenage instance
-func NewMilenage() *Milenage {
-	return &Milenage{}
+// NewMilenage returns a Milenage bound to the subscriber key K and OPc. The AES key
+// schedule is computed once; the instance is safe for concurrent use.
+func NewMilenage(k, opc []byte) (*Milenage, error) {
+	if len(k) != KeyLen128 {
+		return nil, ErrInvalidKeyLength
+	}
+	if len(opc) != KeyLen128 {
+		return nil, ErrInvalidTOPCLength
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	m := &Milenage{block: block}
+	copy(m.opc[:], opc)
+	return m, nil
 }
 
 // rotate performs cyclic rotation of 128-bit value by r bytes to the left
@@ -171,7 +171,7 @@ func TestMilenage_3GPP_TestSet1(t *testing.T) {
 }
 
 func TestMilenage_ValidationErrors(t *testing.T) {
-	milenage := algorithms.NewMilenage()
+	milenage := &algorithms.Milenage{}
 	v := &algorithms.Variables{}
 
 	// Test invalid K length
@@ -237,3 +237,28 @@ func TestVariables_ComputeKASME(t *testing.T) {
 
 	t.Logf("KASME: %x", kasme)
 }
+
+func TestVariables_ComputeKASMEWithMNCLength(t *testing.T) {
+	v := &algorithms.Variables{
+		CK:  make([]byte, 16),
+		IK:  make([]byte, 16),
+		SQN: make([]byte, 6),
+		AK:  make([]byte, 6),
+	}
+
+	two, _ := v.ComputeKASMEWithMNCLength(310, 10, 2)
+	three, _ := v.ComputeKASMEWithMNCLength(310, 10, 3)
+	inferred, _ := v.ComputeKASME(310, 10)
+	if hex.EncodeToString(two) != hex.EncodeToString(inferred) {
+		t.Errorf("MNC 10 with length 2 should match ComputeKASME(310, 10)")
+	}
+	if hex.EncodeToString(two) == hex.EncodeToString(three) {
+		t.Errorf("MNC 010 (3 digits) and 10 (2 digits) must give different KASME")
+	}
+
+	big, _ := v.ComputeKASMEWithMNCLength(310, 410, 0)
+	explicit, _ := v.ComputeKASMEWithMNCLength(310, 410, 3)
+	if hex.EncodeToString(big) != hex.EncodeToString(explicit) {
+		t.Errorf("MNC 410 should be 3 digits without an explicit length")
+	}
+}
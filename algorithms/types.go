@@ -210,7 +210,14 @@ func (v *Variables) ComputeSQNms() error {
 // KASME = KDF(CK||IK, FC || SN_ID || L0 || SQN⊕AK || L1)
 // where FC = 0x10, SN_ID = PLMN ID (3 bytes), L0 = 0x0003, L1 = 0x0006
 // Required inputs: CK, IK, SQN, AK (or AUTN)
+// The MNC has 3 digits if it is >= 100; use ComputeKASMEWithMNCLength for 3-digit MNCs below 100.
 func (v *Variables) ComputeKASME(mcc, mnc int) ([]byte, error) {
+	return v.ComputeKASMEWithMNCLength(mcc, mnc, 0)
+}
+
+// ComputeKASMEWithMNCLength is ComputeKASME with an explicit number of MNC digits
+// (2 or 3, 0 = from the value), e.g. MNC 010 with mncLength 3
+func (v *Variables) ComputeKASMEWithMNCLength(mcc, mnc, mncLength int) ([]byte, error) {
 	if len(v.CK) != KeyLen128 {
 		return nil, fmt.Errorf("CK must be 16 bytes, got %d", len(v.CK))
 	}
@@ -227,7 +234,7 @@ func (v *Variables) ComputeKASME(mcc, mnc int) ([]byte, error) {
 	fc := []byte{0x10}
 
 	// P0 = SN_ID (PLMN ID encoded in 3 bytes)
-	p0 := encodePLMNInt(mcc, mnc)
+	p0 := encodePLMNInt(mcc, mnc, mncLength)
 
 	// L0 = length of SN_ID = 0x0003
 	l0 := []byte{0x00, 0x03}
@@ -275,7 +282,8 @@ func (v *Variables) Reset() {
 }
 
 // encodePLMNInt encodes MCC and MNC into 3-byte PLMN ID format
-func encodePLMNInt(mcc, mnc int) []byte {
+// (mncLength 2 or 3 forces the number of MNC digits, 0 derives it from the value)
+func encodePLMNInt(mcc, mnc, mncLength int) []byte {
 	plmn := make([]byte, 3)
 
 	// MCC digit 1 (hundreds), digit 2 (tens), digit 3 (ones)
@@ -285,11 +293,15 @@ func encodePLMNInt(mcc, mnc int) []byte {
 
 	// MNC handling: 2-digit or 3-digit
 	var mncD1, mncD2, mncD3 byte
-	if mnc == 0 {
+	if mncLength == 3 {
+		mncD1 = byte((mnc / 100) % 10)
+		mncD2 = byte((mnc / 10) % 10)
+		mncD3 = byte(mnc % 10)
+	} else if mnc == 0 {
 		mncD1 = 0
 		mncD2 = 0
 		mncD3 = 0x0F // filler for 2-digit MNC
-	} else if mnc < 100 {
+	} else if mnc < 100 || mncLength == 2 {
 		// 2-digit MNC
 		mncD1 = byte(mnc / 10)
 		mncD2 = byte(mnc % 10)
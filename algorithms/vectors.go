@@ -0,0 +1,260 @@
+package algorithms
+
+// Bulk generation of Milenage authentication vectors (network side), e.g. to load-test a
+// core network with millions of precomputed vectors. A Milenage from NewMilenage keeps the
+// AES key schedule of K; GenerateVector only allocates the returned vector.
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrNoSubscriberKey is returned by GenerateVector on a Milenage not created by NewMilenage
+var ErrNoSubscriberKey = fmt.Errorf("Milenage has no subscriber key: create it with NewMilenage")
+
+// AuthVector is one authentication vector: AUTN = (SQN ⊕ AK) || AMF || MAC-A
+type AuthVector struct {
+	SQN  [SQNLen]byte
+	RAND [RandLen]byte
+	AUTN [AUTNLen]byte
+	XRES [8]byte
+	CK   [KeyLen128]byte
+	IK   [KeyLen128]byte
+	AK   [AKLen]byte
+}
+
+// milenageScratch holds the intermediate blocks of one vector
+type milenageScratch struct {
+	in, temp, tempOPc, out [KeyLen128]byte
+}
+
+var milenageScratchPool = sync.Pool{New: func() any { return new(milenageScratch) }}
+
+// GenerateVector computes the vector for SQN (6 bytes), AMF (2 bytes) and RAND (16 bytes).
+// It is safe for concurrent use.
+func (m *Milenage) GenerateVector(sqn, amf, rand []byte) (*AuthVector, error) {
+	av := new(AuthVector)
+	if err := m.GenerateVectorInto(av, sqn, amf, rand); err != nil {
+		return nil, err
+	}
+	return av, nil
+}
+
+// GenerateVectorInto is GenerateVector writing into av, without allocating
+func (m *Milenage) GenerateVectorInto(av *AuthVector, sqn, amf, rand []byte) error {
+	if m.block == nil {
+		return ErrNoSubscriberKey
+	}
+	if len(sqn) != SQNLen {
+		return ErrInvalidSQNLength
+	}
+	if len(amf) != AMFLen {
+		return ErrInvalidAMFLength
+	}
+	if len(rand) != RandLen {
+		return ErrInvalidRANDLength
+	}
+	s := milenageScratchPool.Get().(*milenageScratch)
+	defer milenageScratchPool.Put(s)
+	copy(av.SQN[:], sqn)
+	copy(av.RAND[:], rand)
+
+	// TEMP = AES_K(RAND XOR OPc)
+	for i := range s.in {
+		s.in[i] = rand[i] ^ m.opc[i]
+	}
+	m.block.Encrypt(s.temp[:], s.in[:])
+
+	// f1: OUT1 = AES_K(TEMP XOR rot(IN1 XOR OPc, r1) XOR c1) XOR OPc, IN1 = SQN || AMF || SQN || AMF
+	copy(s.out[0:6], sqn)
+	copy(s.out[6:8], amf)
+	copy(s.out[8:14], sqn)
+	copy(s.out[14:16], amf)
+	for i := range s.out {
+		s.out[i] ^= m.opc[i]
+	}
+	for i := range s.in {
+		s.in[i] = s.temp[i] ^ s.out[(i+milenageR1)%KeyLen128] ^ milenageC1[i]
+	}
+	m.block.Encrypt(s.out[:], s.in[:])
+	for i := 0; i < 8; i++ {
+		av.AUTN[8+i] = s.out[i] ^ m.opc[i] // MAC-A = OUT1[0..63]
+	}
+
+	// f2-f5: OUTn = AES_K(rot(TEMP XOR OPc, rn) XOR cn) XOR OPc
+	for i := range s.tempOPc {
+		s.tempOPc[i] = s.temp[i] ^ m.opc[i]
+	}
+	m.output(s, milenageR2, milenageC2)
+	copy(av.XRES[:], s.out[8:16])
+	copy(av.AK[:], s.out[:6])
+	m.output(s, milenageR3, milenageC3)
+	copy(av.CK[:], s.out[:])
+	m.output(s, milenageR4, milenageC4)
+	copy(av.IK[:], s.out[:])
+
+	for i := 0; i < SQNLen; i++ {
+		av.AUTN[i] = sqn[i] ^ av.AK[i]
+	}
+	copy(av.AUTN[6:8], amf)
+	return nil
+}
+
+// output computes OUTn of f2-f5 into s.out
+func (m *Milenage) output(s *milenageScratch, r int, c []byte) {
+	for i := range s.in {
+		s.in[i] = s.tempOPc[(i+r)%KeyLen128] ^ c[i]
+	}
+	m.block.Encrypt(s.out[:], s.in[:])
+	for i := range s.out {
+		s.out[i] ^= m.opc[i]
+	}
+}
+
+// VectorFormat is the output format of GenerateVectors
+type VectorFormat string
+
+// Output formats of GenerateVectors
+const (
+	VectorFormatCSV  VectorFormat = "csv"  // header line, then sqn,rand,autn,xres,ck,ik,ak
+	VectorFormatJSON VectorFormat = "json" // array of objects with the same fields
+)
+
+// VectorConfig is the subscriber and SQN sequence of GenerateVectors
+type VectorConfig struct {
+	K       []byte
+	OPc     []byte
+	AMF     []byte    // default 8000
+	SQN     uint64    // SQN of the first vector
+	SQNStep uint64    // SQN increment between vectors (default 1)
+	Rand    io.Reader // RAND source (default crypto/rand)
+}
+
+// maxSQN is the largest 48-bit SQN
+const maxSQN = 1<<48 - 1
+
+// vectorRandBatch is the number of RANDs read from the source at once
+const vectorRandBatch = 256
+
+// GenerateVectors writes n vectors to w in format, one at a time, so memory use does not
+// grow with n. Hex values are upper case.
+func GenerateVectors(cfg VectorConfig, n int, w io.Writer, format VectorFormat) error {
+	if format != VectorFormatCSV && format != VectorFormatJSON {
+		return fmt.Errorf("unknown vector format %q (csv, json)", format)
+	}
+	m, err := NewMilenage(cfg.K, cfg.OPc)
+	if err != nil {
+		return err
+	}
+	amf := cfg.AMF
+	if amf == nil {
+		amf = []byte{0x80, 0x00}
+	}
+	if len(amf) != AMFLen {
+		return ErrInvalidAMFLength
+	}
+	step := cfg.SQNStep
+	if step == 0 {
+		step = 1
+	}
+	if n > 0 && (cfg.SQN > maxSQN || uint64(n-1) > (maxSQN-cfg.SQN)/step) {
+		return fmt.Errorf("SQN %012X + %d x %d exceeds 48 bits", cfg.SQN, n-1, step)
+	}
+	source := cfg.Rand
+	if source == nil {
+		source = rand.Reader
+	}
+
+	bw := bufio.NewWriterSize(w, 64*1024)
+	if format == VectorFormatCSV {
+		bw.WriteString("sqn,rand,autn,xres,ck,ik,ak\n")
+	} else {
+		bw.WriteString("[")
+	}
+
+	var (
+		av    AuthVector
+		sqn   [SQNLen]byte
+		rands = make([]byte, vectorRandBatch*RandLen)
+		line  = make([]byte, 0, 256)
+	)
+	for i := 0; i < n; i++ {
+		if i%vectorRandBatch == 0 {
+			batch := min(n-i, vectorRandBatch)
+			if _, err := io.ReadFull(source, rands[:batch*RandLen]); err != nil {
+				return fmt.Errorf("RAND source: %w", err)
+			}
+		}
+		value := cfg.SQN + uint64(i)*step
+		for j := range sqn {
+			sqn[j] = byte(value >> (8 * (SQNLen - 1 - j)))
+		}
+		off := (i % vectorRandBatch) * RandLen
+		if err := m.GenerateVectorInto(&av, sqn[:], amf, rands[off:off+RandLen]); err != nil {
+			return err
+		}
+
+		line = line[:0]
+		if format == VectorFormatCSV {
+			line = appendVectorCSV(line, &av)
+		} else {
+			if i > 0 {
+				line = append(line, ',')
+			}
+			line = appendVectorJSON(line, &av)
+		}
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+
+	if format == VectorFormatJSON {
+		bw.WriteString("\n]\n")
+	}
+	return bw.Flush()
+}
+
+// appendVectorCSV appends one CSV line
+func appendVectorCSV(line []byte, av *AuthVector) []byte {
+	for i, field := range [][]byte{av.SQN[:], av.RAND[:], av.AUTN[:], av.XRES[:], av.CK[:], av.IK[:], av.AK[:]} {
+		if i > 0 {
+			line = append(line, ',')
+		}
+		line = appendHexUpper(line, field)
+	}
+	return append(line, '\n')
+}
+
+// appendVectorJSON appends one JSON object on its own line
+func appendVectorJSON(line []byte, av *AuthVector) []byte {
+	fields := [...]struct {
+		name  string
+		value []byte
+	}{
+		{"sqn", av.SQN[:]}, {"rand", av.RAND[:]}, {"autn", av.AUTN[:]}, {"xres", av.XRES[:]},
+		{"ck", av.CK[:]}, {"ik", av.IK[:]}, {"ak", av.AK[:]},
+	}
+	line = append(line, "\n  {"...)
+	for i, f := range fields {
+		if i > 0 {
+			line = append(line, ", "...)
+		}
+		line = append(line, '"')
+		line = append(line, f.name...)
+		line = append(line, `": "`...)
+		line = appendHexUpper(line, f.value)
+		line = append(line, '"')
+	}
+	return append(line, '}')
+}
+
+func appendHexUpper(dst, src []byte) []byte {
+	const digits = "0123456789ABCDEF"
+	for _, b := range src {
+		dst = append(dst, digits[b>>4], digits[b&0x0F])
+	}
+	return dst
+}
@@ -0,0 +1,168 @@
+package algorithms_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"sim_reader/algorithms"
+)
+
+func mustDecodeHex(t testing.TB, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// 3GPP TS 35.207 test set 1
+func testSet1Milenage(t testing.TB) *algorithms.Milenage {
+	t.Helper()
+	m, err := algorithms.NewMilenage(mustDecodeHex(t, "465b5ce8b199b49faa5f0a2ee238a6bc"), mustDecodeHex(t, "cd63cb71954a9f4e48a5994e37a02baf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMilenage_GenerateVector(t *testing.T) {
+	m := testSet1Milenage(t)
+	av, err := m.GenerateVector(mustDecodeHex(t, "ff9bb4d0b607"), mustDecodeHex(t, "b9b9"), mustDecodeHex(t, "23553cbe9637a89d218ae64dae47bf35"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"XRES", av.XRES[:], "a54211d5e3ba50bf"},
+		{"CK", av.CK[:], "b40ba9a3c58b2a05bbf0d987b21bf8cb"},
+		{"IK", av.IK[:], "f769bcd751044604127672711c6d3441"},
+		{"AK", av.AK[:], "aa689c648370"},
+		// (SQN XOR AK) || AMF || MAC-A
+		{"AUTN", av.AUTN[:], "55f328b43577b9b94a9ffac354dfafb3"},
+	} {
+		if hex.EncodeToString(c.got) != c.want {
+			t.Errorf("%s = %x, want %s", c.name, c.got, c.want)
+		}
+	}
+
+	if _, err := m.GenerateVector(make([]byte, 5), make([]byte, 2), make([]byte, 16)); err != algorithms.ErrInvalidSQNLength {
+		t.Errorf("short SQN: error = %v", err)
+	}
+	if _, err := (&algorithms.Milenage{}).GenerateVector(make([]byte, 6), make([]byte, 2), make([]byte, 16)); err != algorithms.ErrNoSubscriberKey {
+		t.Errorf("zero Milenage: error = %v", err)
+	}
+	if _, err := algorithms.NewMilenage(make([]byte, 16), make([]byte, 15)); err != algorithms.ErrInvalidTOPCLength {
+		t.Errorf("NewMilenage(short OPc) error = %v", err)
+	}
+}
+
+func TestMilenage_GenerateVectorConcurrent(t *testing.T) {
+	m := testSet1Milenage(t)
+	rands := make([][]byte, 64)
+	want := make([]*algorithms.AuthVector, len(rands))
+	for i := range rands {
+		rands[i] = bytes.Repeat([]byte{byte(i)}, 16)
+		want[i], _ = m.GenerateVector(make([]byte, 6), []byte{0x80, 0x00}, rands[i])
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 200; n++ {
+				i := n % len(rands)
+				av, err := m.GenerateVector(make([]byte, 6), []byte{0x80, 0x00}, rands[i])
+				if err != nil || *av != *want[i] {
+					t.Errorf("concurrent vector %d differs", i)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGenerateVectors(t *testing.T) {
+	cfg := algorithms.VectorConfig{
+		K:       mustDecodeHex(t, "465b5ce8b199b49faa5f0a2ee238a6bc"),
+		OPc:     mustDecodeHex(t, "cd63cb71954a9f4e48a5994e37a02baf"),
+		AMF:     mustDecodeHex(t, "b9b9"),
+		SQN:     0xff9bb4d0b607,
+		SQNStep: 32,
+		Rand:    bytes.NewReader(bytes.Repeat(mustDecodeHex(t, "23553cbe9637a89d218ae64dae47bf35"), 300)),
+	}
+
+	var out bytes.Buffer
+	if err := algorithms.GenerateVectors(cfg, 300, &out, algorithms.VectorFormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil || len(records) != 301 {
+		t.Fatalf("CSV: %d records, %v", len(records), err)
+	}
+	if strings.Join(records[0], ",") != "sqn,rand,autn,xres,ck,ik,ak" {
+		t.Errorf("header = %q", records[0])
+	}
+	if first := records[1]; first[0] != "FF9BB4D0B607" || first[2] != "55F328B43577B9B94A9FFAC354DFAFB3" {
+		t.Errorf("first vector = %q", first)
+	}
+	if records[2][0] != "FF9BB4D0B627" {
+		t.Errorf("second SQN = %s, want the first + 32", records[2][0])
+	}
+
+	cfg.Rand = bytes.NewReader(make([]byte, 3*16))
+	out.Reset()
+	if err := algorithms.GenerateVectors(cfg, 3, &out, algorithms.VectorFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var vectors []map[string]string
+	if err := json.Unmarshal(out.Bytes(), &vectors); err != nil || len(vectors) != 3 || len(vectors[2]["autn"]) != 32 {
+		t.Errorf("JSON = %v, %v", vectors, err)
+	}
+
+	if err := algorithms.GenerateVectors(cfg, 1, io.Discard, "xml"); err == nil {
+		t.Error("GenerateVectors accepted format xml")
+	}
+	cfg.SQN, cfg.SQNStep = 1<<48-2, 1
+	if err := algorithms.GenerateVectors(cfg, 3, io.Discard, algorithms.VectorFormatCSV); err == nil {
+		t.Error("GenerateVectors accepted an SQN beyond 48 bits")
+	}
+}
+
+func BenchmarkMilenage_GenerateVector(b *testing.B) {
+	m := testSet1Milenage(b)
+	sqn, amf, rand := make([]byte, 6), []byte{0x80, 0x00}, make([]byte, 16)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := m.GenerateVector(sqn, amf, rand); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkGenerateVectors reports the CSV streaming rate in vectors/s
+func BenchmarkGenerateVectors(b *testing.B) {
+	cfg := algorithms.VectorConfig{
+		K:   mustDecodeHex(b, "465b5ce8b199b49faa5f0a2ee238a6bc"),
+		OPc: mustDecodeHex(b, "cd63cb71954a9f4e48a5994e37a02baf"),
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	if err := algorithms.GenerateVectors(cfg, b.N, io.Discard, algorithms.VectorFormatCSV); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "vectors/s")
+}
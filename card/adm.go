@@ -0,0 +1,67 @@
+package card
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// ADMKeyFormat selects how an ADM key is placed in the VERIFY data field
+type ADMKeyFormat int
+
+const (
+	ADMKeyBinary   ADMKeyFormat = iota // key bytes, padded to Length
+	ADMKeyASCIIHex                     // key as uppercase hex ASCII (8-byte key -> 16 bytes)
+)
+
+// ADMVerifyProfile describes how a card family expects an ADM key to be verified
+type ADMVerifyProfile struct {
+	Name    string       // Short description for logs ("ISO 8 bytes FF-padded")
+	CLA     byte         // 0x00 (UICC) or 0xA0 (GSM class)
+	KeyRef  byte         // VERIFY P2 key reference
+	Length  int          // VERIFY data field length
+	Padding byte         // Pad byte up to Length
+	Format  ADMKeyFormat // Key encoding
+	Unlock  bool         // Card needs the VERIFY sent a second time after success ("unlock")
+}
+
+// ADMKeyRef returns the standard key reference of ADM level 1..4 (0A..0D)
+func ADMKeyRef(level int) byte {
+	return PIN_ADM1 + byte(level-1)
+}
+
+// String returns the profile name with its APDU parameters
+func (p ADMVerifyProfile) String() string {
+	return fmt.Sprintf("%s (CLA %02X, P2 %02X, Lc %02X)", p.Name, p.CLA, p.KeyRef, p.Length)
+}
+
+// Encode returns the VERIFY data field for key
+func (p ADMVerifyProfile) Encode(key []byte) ([]byte, error) {
+	data := key
+	if p.Format == ADMKeyASCIIHex {
+		data = []byte(strings.ToUpper(hex.EncodeToString(key)))
+	}
+	if len(data) > p.Length {
+		return nil, fmt.Errorf("key is %d bytes, %s expects at most %d", len(data), p.Name, p.Length)
+	}
+	out := bytes.Repeat([]byte{p.Padding}, p.Length)
+	copy(out, data)
+	return out, nil
+}
+
+// VerifyADMWithProfile sends VERIFY for key as described by p. For profiles with Unlock
+// the same command is sent again after a successful verification and its response returned.
+func (r *Reader) VerifyADMWithProfile(p ADMVerifyProfile, key []byte) (*APDUResponse, error) {
+	data, err := p.Encode(key)
+	if err != nil {
+		return nil, err
+	}
+	apdu := append([]byte{p.CLA, INS_VERIFY, 0x00, p.KeyRef, byte(len(data))}, data...)
+
+	resp, err := r.SendAPDU(apdu)
+	if err != nil || !resp.IsOK() || !p.Unlock {
+		return resp, err
+	}
+	return r.SendAPDU(apdu)
+}
@@ -0,0 +1,63 @@
+package card
+
+import (
+	"bytes"
+	"testing"
+)
+
+// ============ ADM PROFILE TESTS ============
+
+func TestADMVerifyProfile_Encode(t *testing.T) {
+	key := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+
+	tests := []struct {
+		name    string
+		profile ADMVerifyProfile
+		key     []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"8 bytes", ADMVerifyProfile{Length: 8, Padding: 0xFF}, key, key, false},
+		{"Short key padded", ADMVerifyProfile{Length: 8, Padding: 0xFF}, []byte("1234"),
+			[]byte{'1', '2', '3', '4', 0xFF, 0xFF, 0xFF, 0xFF}, false},
+		{"Zero padding", ADMVerifyProfile{Length: 6, Padding: 0x00}, []byte("1234"),
+			[]byte{'1', '2', '3', '4', 0x00, 0x00}, false},
+		{"ASCII hex", ADMVerifyProfile{Length: 16, Padding: 0xFF, Format: ADMKeyASCIIHex},
+			[]byte{0xF3, 0x8A, 0x3D, 0xEC, 0xF6, 0xC7, 0xD2, 0x39}, []byte("F38A3DECF6C7D239"), false},
+		{"Key too long", ADMVerifyProfile{Name: "test", Length: 8, Padding: 0xFF}, append(key, 0x09), nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.profile.Encode(tc.key)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Encode() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("Encode() = %X, want %X", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifyADMWithProfile_Unlock(t *testing.T) {
+	key := []byte("12345678")
+	for _, unlock := range []bool{false, true} {
+		m := NewMockCard([]byte{0x3B, 0x00})
+		m.Keys[PIN_ADM1] = key
+		r := NewReaderWithTransport("Mock", m.ATR, m)
+
+		p := ADMVerifyProfile{KeyRef: ADMKeyRef(1), Length: 8, Padding: 0xFF, Unlock: unlock}
+		resp, err := r.VerifyADMWithProfile(p, key)
+		if err != nil || !resp.IsOK() {
+			t.Fatalf("unlock=%v: VerifyADMWithProfile() = %v, %v", unlock, resp, err)
+		}
+		want := 1
+		if unlock {
+			want = 2
+		}
+		if len(m.Log) != want {
+			t.Errorf("unlock=%v: sent %d APDUs, want %d", unlock, len(m.Log), want)
+		}
+	}
+}
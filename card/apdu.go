@@ -14,9 +14,13 @@ const (
 	SW_AUTH_FAILED              = 0x6983 // Authentication method blocked
 	SW_REF_DATA_NOT_FOUND       = 0x6984 // Reference data not found
 	SW_CONDITIONS_NOT_SATISFIED = 0x6985 // Conditions of use not satisfied
+	SW_COMMAND_NOT_ALLOWED      = 0x6986 // Command not allowed (no current EF)
+	SW_FUNC_NOT_SUPPORTED       = 0x6A81 // Function not supported
 	SW_WRONG_P1P2               = 0x6A86 // Incorrect P1 P2
+	SW_DATA_NOT_FOUND           = 0x6A88 // Referenced data not found
 	SW_INS_NOT_SUPPORTED        = 0x6D00 // Instruction not supported
 	SW_CLA_NOT_SUPPORTED        = 0x6E00 // Class not supported
+	SW_CHANNEL_NOT_SUPPORTED    = 0x6881 // Logical channel not supported
 )
 
 // APDU instruction bytes
@@ -31,6 +35,9 @@ const (
 	INS_CHANGE_REFERENCE_DATA = 0x24 // Change PIN/ADM key
 	INS_STATUS                = 0xF2
 	INS_AUTHENTICATE          = 0x88
+	INS_GET_CHALLENGE         = 0x84
+	INS_MANAGE_CHANNEL        = 0x70
+	INS_INCREASE              = 0x32 // Cyclic EF, class 8X (TS 102.221 11.1.8)
 )
 
 // Authentication context types (P2 for AUTHENTICATE command)
@@ -51,6 +58,9 @@ type APDUResponse struct {
 	Data []byte
 	SW1  byte
 	SW2  byte
+
+	// cla and ins of the command that produced the response (for SWInfo)
+	cla, ins byte
 }
 
 // SW returns the status word as uint16
@@ -78,52 +88,43 @@ func (r *APDUResponse) Error() error {
 	if r.IsOK() || r.HasMoreData() {
 		return nil
 	}
-	return fmt.Errorf("APDU error: SW=%04X (%s)", r.SW(), SWToString(r.SW()))
+	return fmt.Errorf("APDU error: SW=%04X (%s)", r.SW(), r.SWString())
 }
 
-// SWToString converts status word to human-readable string
+// SWToString converts status word to human-readable string without command context.
+// Prefer APDUResponse.SWString or DecodeSW, which add context-specific hints.
 func SWToString(sw uint16) string {
-	switch sw {
-	case SW_OK:
-		return "Success"
-	case SW_FILE_NOT_FOUND:
-		return "File not found"
-	case SW_RECORD_NOT_FOUND:
-		return "Record not found"
-	case SW_WRONG_LENGTH:
-		return "Wrong length"
-	case SW_SECURITY_NOT_SATISFIED:
-		return "Security status not satisfied"
-	case SW_AUTH_FAILED:
-		return "Authentication method blocked"
-	case SW_REF_DATA_NOT_FOUND:
-		return "Reference data not found"
-	case SW_CONDITIONS_NOT_SATISFIED:
-		return "Conditions of use not satisfied"
-	case SW_WRONG_P1P2:
-		return "Incorrect P1 P2"
-	case SW_INS_NOT_SUPPORTED:
-		return "Instruction not supported"
-	case SW_CLA_NOT_SUPPORTED:
-		return "Class not supported"
-	default:
-		sw1 := byte(sw >> 8)
-		sw2 := byte(sw)
-		if sw1 == 0x61 {
-			return fmt.Sprintf("%d bytes available", sw2)
-		}
-		if sw1 == 0x6C {
-			return fmt.Sprintf("Retry with Le=%d", sw2)
-		}
-		if sw1 == 0x63 && (sw2&0xF0) == 0xC0 {
-			return fmt.Sprintf("PIN verification failed, %d attempts remaining", sw2&0x0F)
+	return DecodeSW(sw, 0, ContextAny).Text
+}
+
+// maxResponseChain bounds the GET RESPONSE exchanges collected for one command
+const maxResponseChain = 64
+
+// SendAPDU sends an APDU command and parses the response. Response chaining is handled
+// here for every caller: 61xx (and 9Fxx on GSM cards) is followed by GET RESPONSE until the
+// card has returned all its data, and 6Cxx re-sends the command once with the Le the card
+// asked for. Use SendAPDURaw to see the status words of the card unchanged.
+func (r *Reader) SendAPDU(apdu []byte) (*APDUResponse, error) {
+	resp, err := r.SendAPDURaw(apdu)
+	if err != nil {
+		return nil, err
+	}
+	if resp.NeedsRetry() {
+		if retry := withLe(apdu, resp.SW2); retry != nil {
+			if resp, err = r.SendAPDURaw(retry); err != nil {
+				return nil, err
+			}
 		}
-		return "Unknown error"
 	}
+	if resp.HasMoreData() || resp.SW1 == 0x9F {
+		return r.collectResponse(apdu, resp)
+	}
+	return resp, nil
 }
 
-// SendAPDU sends an APDU command and parses the response
-func (r *Reader) SendAPDU(apdu []byte) (*APDUResponse, error) {
+// SendAPDURaw sends one APDU and parses the response without GET RESPONSE or Le
+// correction (conformance tests and scripts that check the intermediate status words)
+func (r *Reader) SendAPDURaw(apdu []byte) (*APDUResponse, error) {
 	raw, err := r.Transmit(apdu)
 	if err != nil {
 		return nil, err
@@ -138,10 +139,81 @@ func (r *Reader) SendAPDU(apdu []byte) (*APDUResponse, error) {
 		SW1:  raw[len(raw)-2],
 		SW2:  raw[len(raw)-1],
 	}
+	if len(apdu) >= 2 {
+		resp.cla, resp.ins = apdu[0], apdu[1]
+	}
+	r.lastSW = resp.SW()
 
 	return resp, nil
 }
 
+// collectResponse issues GET RESPONSE while the card reports more data (61xx/9Fxx) and
+// returns the concatenated data with the final status word, attributed to apdu
+func (r *Reader) collectResponse(apdu []byte, resp *APDUResponse) (*APDUResponse, error) {
+	data := append([]byte(nil), resp.Data...)
+	get := []byte{getResponseCLA(apdu[0]), INS_GET_RESPONSE, 0x00, 0x00, 0x00}
+	for n := 0; resp.HasMoreData() || resp.SW1 == 0x9F; n++ {
+		if n == maxResponseChain {
+			return nil, fmt.Errorf("card still reports more data after %d GET RESPONSE commands", n)
+		}
+		get[4] = resp.SW2
+		next, err := r.SendAPDURaw(get)
+		if err != nil {
+			return nil, err
+		}
+		if next.NeedsRetry() {
+			get[4] = next.SW2
+			if next, err = r.SendAPDURaw(get); err != nil {
+				return nil, err
+			}
+		}
+		data = append(data, next.Data...)
+		resp = next
+	}
+	out := &APDUResponse{Data: data, SW1: resp.SW1, SW2: resp.SW2}
+	if len(apdu) >= 2 {
+		out.cla, out.ins = apdu[0], apdu[1]
+	}
+	return out, nil
+}
+
+// getResponseCLA returns the class of the GET RESPONSE for a command of class cla: A0 for
+// GSM commands, otherwise the interindustry class on the same logical channel
+func getResponseCLA(cla byte) byte {
+	switch {
+	case cla == 0xA0:
+		return 0xA0
+	case cla&0x40 != 0:
+		return 0x40 | cla&0x0F
+	}
+	return cla & 0x03
+}
+
+// withLe returns a copy of a short APDU with its Le set to le (appended for cases 1 and 3),
+// or nil when the APDU cannot be re-sent that way (extended or malformed)
+func withLe(apdu []byte, le byte) []byte {
+	switch {
+	case len(apdu) == 4:
+		return append(append([]byte(nil), apdu...), le)
+	case len(apdu) == 5:
+		out := append([]byte(nil), apdu...)
+		out[4] = le
+		return out
+	case len(apdu) < 5 || apdu[4] == 0x00:
+		return nil
+	}
+	lc := int(apdu[4])
+	switch len(apdu) {
+	case 5 + lc:
+		return append(append([]byte(nil), apdu...), le)
+	case 6 + lc:
+		out := append([]byte(nil), apdu...)
+		out[len(out)-1] = le
+		return out
+	}
+	return nil
+}
+
 // Select selects a file or application by ID
 func (r *Reader) Select(fileID []byte) (*APDUResponse, error) {
 	// SELECT command: CLA=00, INS=A4, P1=00, P2=04 for AID, P2=00 for file
@@ -154,8 +226,7 @@ func (r *Reader) Select(fileID []byte) (*APDUResponse, error) {
 		p2 = 0x04
 	} else if len(fileID) > 2 {
 		// AID selection
-		p1 = 0x04
-		p2 = 0x04
+		return r.selectAID(fileID)
 	}
 
 	tryOnce := func(p1, p2 byte, withLe bool) (*APDUResponse, error) {
@@ -170,15 +241,7 @@ func (r *Reader) Select(fileID []byte) (*APDUResponse, error) {
 			apdu = append(apdu, 0x00) // Le
 		}
 
-		resp, err := r.SendAPDU(apdu)
-		if err != nil {
-			return nil, err
-		}
-		// Handle GET RESPONSE if needed
-		if resp.HasMoreData() {
-			return r.GetResponse(resp.SW2)
-		}
-		return resp, nil
+		return r.SendAPDU(apdu)
 	}
 
 	resp, err := tryOnce(p1, p2, false)
@@ -214,6 +277,60 @@ func (r *Reader) Select(fileID []byte) (*APDUResponse, error) {
 	return resp, nil
 }
 
+// aidSelectP2 are the SELECT by AID response options in the order they are tried:
+// return FCP, no response data, return FCI
+var aidSelectP2 = []byte{0x04, 0x0C, 0x00}
+
+// selectAID selects an application by AID. Some cards answer 6A86 to P2=04 and only
+// accept other response options, so each option is tried in turn; the first one the card
+// accepts is tried first for every later AID selection of the session. With P2=0C the
+// response has no FCP: file attributes then come from the SELECT of each EF.
+func (r *Reader) selectAID(aid []byte) (*APDUResponse, error) {
+	candidates := aidSelectP2
+	if r.aidP2Known {
+		candidates = []byte{r.aidP2}
+		for _, p2 := range aidSelectP2 {
+			if p2 != r.aidP2 {
+				candidates = append(candidates, p2)
+			}
+		}
+	}
+
+	var resp *APDUResponse
+	for _, p2 := range candidates {
+		apdu := append([]byte{0x00, INS_SELECT, 0x04, p2, byte(len(aid))}, aid...)
+		var err error
+		if resp, err = r.SendAPDU(apdu); err != nil {
+			return nil, err
+		}
+		if resp.SW() == SW_WRONG_P1P2 {
+			continue
+		}
+		if !r.aidP2Known && (resp.IsOK() || resp.HasMoreData()) {
+			r.aidP2, r.aidP2Known = p2, true
+			if r.onAIDSelect != nil {
+				r.onAIDSelect(p2)
+			}
+		}
+		return resp, nil
+	}
+	return resp, nil
+}
+
+// AIDSelectP2 returns the SELECT by AID response option (P2) the card accepted,
+// and false until an application was selected
+func (r *Reader) AIDSelectP2() (byte, bool) {
+	return r.aidP2, r.aidP2Known
+}
+
+// WithAIDSelectHandler registers fn to be called with the SELECT by AID response option
+// (P2) once the card accepted one
+func WithAIDSelectHandler(fn func(p2 byte)) ConnectOption {
+	return func(r *Reader) {
+		r.onAIDSelect = fn
+	}
+}
+
 // SelectByPath selects a file by path from MF
 func (r *Reader) SelectByPath(path []byte) (*APDUResponse, error) {
 	apdu := make([]byte, 5+len(path))
@@ -224,16 +341,7 @@ func (r *Reader) SelectByPath(path []byte) (*APDUResponse, error) {
 	apdu[4] = byte(len(path))
 	copy(apdu[5:], path)
 
-	resp, err := r.SendAPDU(apdu)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.HasMoreData() {
-		return r.GetResponse(resp.SW2)
-	}
-
-	return resp, nil
+	return r.SendAPDU(apdu)
 }
 
 // SelectDF selects a DF by File ID (for cards that don't support AID selection)
@@ -253,16 +361,7 @@ func (r *Reader) SelectDF(fileID []byte) (*APDUResponse, error) {
 		fileID[1],  // File ID low byte
 	}
 
-	resp, err := r.SendAPDU(apdu)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.HasMoreData() {
-		return r.GetResponse(resp.SW2)
-	}
-
-	return resp, nil
+	return r.SendAPDU(apdu)
 }
 
 // GSM class commands (CLA=A0) for cards that use File ID selection
@@ -278,22 +377,8 @@ func (r *Reader) SelectGSM(fileID []byte) (*APDUResponse, error) {
 	apdu[4] = byte(len(fileID))
 	copy(apdu[5:], fileID)
 
-	resp, err := r.SendAPDU(apdu)
-	if err != nil {
-		return nil, err
-	}
-
-	// GSM cards return 9F XX where XX is number of bytes available
-	if resp.SW1 == 0x9F {
-		return r.GetResponseGSM(resp.SW2)
-	}
-
-	// Also handle 61 XX (standard "more data" response)
-	if resp.HasMoreData() {
-		return r.GetResponseGSM(resp.SW2)
-	}
-
-	return resp, nil
+	// GSM cards answer 9F XX: SendAPDU fetches the XX bytes with GET RESPONSE (CLA A0)
+	return r.SendAPDU(apdu)
 }
 
 // GetResponseGSM retrieves response data using GSM class (CLA=A0)
@@ -312,18 +397,7 @@ func (r *Reader) ReadRecordGSM(recordNum, length byte) (*APDUResponse, error) {
 		length,
 	}
 
-	resp, err := r.SendAPDU(apdu)
-	if err != nil {
-		return nil, err
-	}
-
-	// Handle retry with correct length
-	if resp.NeedsRetry() {
-		apdu[4] = resp.SW2
-		return r.SendAPDU(apdu)
-	}
-
-	return resp, nil
+	return r.SendAPDU(apdu)
 }
 
 // ReadBinaryGSM reads binary data using GSM class command (CLA=A0)
@@ -336,18 +410,7 @@ func (r *Reader) ReadBinaryGSM(offset uint16, length byte) (*APDUResponse, error
 		length,
 	}
 
-	resp, err := r.SendAPDU(apdu)
-	if err != nil {
-		return nil, err
-	}
-
-	// Handle retry with correct length
-	if resp.NeedsRetry() {
-		apdu[4] = resp.SW2
-		return r.SendAPDU(apdu)
-	}
-
-	return resp, nil
+	return r.SendAPDU(apdu)
 }
 
 // GetResponse retrieves response data from the card
@@ -356,6 +419,20 @@ func (r *Reader) GetResponse(length byte) (*APDUResponse, error) {
 	return r.SendAPDU(apdu)
 }
 
+// GetChallenge asks the card for length bytes of card-generated random data (ISO 7816-4 GET CHALLENGE)
+func (r *Reader) GetChallenge(length byte) ([]byte, error) {
+	apdu := []byte{0x00, INS_GET_CHALLENGE, 0x00, 0x00, length}
+	// Cards with a fixed challenge length answer 6Cxx, SendAPDU asks again
+	resp, err := r.SendAPDU(apdu)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.IsOK() {
+		return nil, fmt.Errorf("GET CHALLENGE failed: %s (SW=%04X)", resp.SWString(), resp.SW())
+	}
+	return resp.Data, nil
+}
+
 // ReadBinary reads binary data from the currently selected file
 func (r *Reader) ReadBinary(offset uint16, length byte) (*APDUResponse, error) {
 	apdu := []byte{
@@ -366,18 +443,7 @@ func (r *Reader) ReadBinary(offset uint16, length byte) (*APDUResponse, error) {
 		length,
 	}
 
-	resp, err := r.SendAPDU(apdu)
-	if err != nil {
-		return nil, err
-	}
-
-	// Handle retry with correct length
-	if resp.NeedsRetry() {
-		apdu[4] = resp.SW2
-		return r.SendAPDU(apdu)
-	}
-
-	return resp, nil
+	return r.SendAPDU(apdu)
 }
 
 // ReadBinaryExtended reads binary data using extended APDU format (ISO 7816-4)
@@ -394,17 +460,7 @@ func (r *Reader) ReadBinaryExtended(offset uint16, length uint16) (*APDUResponse
 		byte(length & 0xFF),
 	}
 
-	resp, err := r.SendAPDU(apdu)
-	if err != nil {
-		return nil, err
-	}
-
-	// Handle GET RESPONSE if needed
-	if resp.HasMoreData() {
-		return r.GetResponse(resp.SW2)
-	}
-
-	return resp, nil
+	return r.SendAPDU(apdu)
 }
 
 // Record mode constants for READ RECORD command (P2 lower 3 bits)
@@ -431,18 +487,7 @@ func (r *Reader) ReadRecordWithMode(recordNum, length, mode byte) (*APDUResponse
 		length,
 	}
 
-	resp, err := r.SendAPDU(apdu)
-	if err != nil {
-		return nil, err
-	}
-
-	// Handle retry with correct length
-	if resp.NeedsRetry() {
-		apdu[4] = resp.SW2
-		return r.SendAPDU(apdu)
-	}
-
-	return resp, nil
+	return r.SendAPDU(apdu)
 }
 
 // ReadNextRecord reads the next record from current position
@@ -491,15 +536,32 @@ func (r *Reader) VerifyPIN(pinType byte, pin []byte) (*APDUResponse, error) {
 	return resp, nil
 }
 
-// ReadAllBinary reads all binary data from currently selected file
+// ReadAllBinary reads all binary data from currently selected file.
+// The chunk size follows the card capabilities (see DetectCapabilities); extended
+// reads fall back to short APDUs if the card rejects them.
 func (r *Reader) ReadAllBinary(fileSize int) ([]byte, error) {
 	var data []byte
 	offset := uint16(0)
+	chunkSize, extended := r.readChunkSize()
 
 	for int(offset) < fileSize {
 		remaining := fileSize - int(offset)
-		readLen := byte(0xFF)
-		if remaining < 255 {
+		if extended {
+			readLen := chunkSize
+			if remaining < readLen {
+				readLen = remaining
+			}
+			resp, err := r.ReadBinaryExtended(offset, uint16(readLen))
+			if err == nil && resp.IsOK() && len(resp.Data) > 0 {
+				data = append(data, resp.Data...)
+				offset += uint16(len(resp.Data))
+				continue
+			}
+			extended, chunkSize = false, 255
+		}
+
+		readLen := byte(chunkSize)
+		if remaining < chunkSize {
 			readLen = byte(remaining)
 		}
 
@@ -508,7 +570,7 @@ func (r *Reader) ReadAllBinary(fileSize int) ([]byte, error) {
 			return data, err
 		}
 
-		if !resp.IsOK() && !resp.NeedsRetry() {
+		if !resp.IsOK() {
 			// End of file or error
 			break
 		}
@@ -610,6 +672,55 @@ func (r *Reader) UpdateRecord(recordNum byte, data []byte) (*APDUResponse, error
 	return r.SendAPDU(apdu)
 }
 
+// UpdateRecordWithMode writes a record using the specified addressing mode.
+// For cyclic files only RecordModePrevious is allowed: the oldest record is
+// overwritten and becomes record 1 (recordNum must be 0).
+func (r *Reader) UpdateRecordWithMode(recordNum, mode byte, data []byte) (*APDUResponse, error) {
+	if len(data) > 255 {
+		return nil, fmt.Errorf("data too long: %d bytes (max 255)", len(data))
+	}
+
+	apdu := make([]byte, 5+len(data))
+	apdu[0] = 0x00
+	apdu[1] = INS_UPDATE_RECORD
+	apdu[2] = recordNum
+	apdu[3] = mode // P2: addressing mode
+	apdu[4] = byte(len(data))
+	copy(apdu[5:], data)
+
+	return r.SendAPDU(apdu)
+}
+
+// AppendCyclicRecord writes data as the newest record of the selected cyclic EF. Cyclic
+// files are only written with UPDATE RECORD in PREVIOUS mode: the oldest record is
+// overwritten and becomes record 1, whatever the record pointer is (TS 102.221 11.1.6).
+// Absolute addressing would overwrite a record in place and break the order.
+func (r *Reader) AppendCyclicRecord(data []byte) (*APDUResponse, error) {
+	return r.UpdateRecordWithMode(0, RecordModePrevious, data)
+}
+
+// IncreaseFile adds amount (big-endian, at most the record length) to record 1 of the
+// selected cyclic EF, e.g. EF_ACM. The card stores the sum in the oldest record, which
+// becomes record 1 like with AppendCyclicRecord. The response data is the new record
+// followed by the amount added; SW 9850 means the maximum value was reached.
+func (r *Reader) IncreaseFile(amount []byte) (*APDUResponse, error) {
+	if len(amount) == 0 || len(amount) > 255 {
+		return nil, fmt.Errorf("invalid INCREASE amount length: %d bytes (1-255)", len(amount))
+	}
+
+	// CLA INS P1 P2 Lc Data Le
+	apdu := make([]byte, 6+len(amount))
+	apdu[0] = 0x80
+	apdu[1] = INS_INCREASE
+	apdu[2] = 0x00
+	apdu[3] = 0x00
+	apdu[4] = byte(len(amount))
+	copy(apdu[5:], amount)
+	apdu[5+len(amount)] = 0x00 // Le: new record value and amount added
+
+	return r.SendAPDU(apdu)
+}
+
 // UpdateRecordGSM writes a record using GSM class command (CLA=A0)
 func (r *Reader) UpdateRecordGSM(recordNum byte, data []byte) (*APDUResponse, error) {
 	if len(data) > 255 {
@@ -631,7 +742,7 @@ func (r *Reader) UpdateRecordGSM(recordNum byte, data []byte) (*APDUResponse, er
 // Automatically reduces chunk size if card returns SW=6700 (Wrong Length)
 func (r *Reader) WriteAllBinary(data []byte) error {
 	offset := uint16(0)
-	chunkSize := 255
+	chunkSize := r.writeChunkSize()
 	minChunkSize := 16 // Minimum chunk size to try
 
 	for int(offset) < len(data) {
@@ -661,7 +772,7 @@ func (r *Reader) WriteAllBinary(data []byte) error {
 		}
 
 		if !resp.IsOK() {
-			return fmt.Errorf("update binary at offset %d failed: %s", offset, SWToString(resp.SW()))
+			return fmt.Errorf("update binary at offset %d failed: %s", offset, resp.SWString())
 		}
 
 		offset += uint16(writeLen)
@@ -691,7 +802,7 @@ func (r *Reader) WriteAllBinaryWithChunkSize(data []byte, chunkSize int) error {
 		}
 
 		if !resp.IsOK() {
-			return fmt.Errorf("update binary at offset %d failed: %s", offset, SWToString(resp.SW()))
+			return fmt.Errorf("update binary at offset %d failed: %s", offset, resp.SWString())
 		}
 
 		offset += uint16(writeLen)
@@ -706,9 +817,12 @@ type AuthenticateResult struct {
 	RES     []byte // Response (SRES for 2G, RES for 3G/4G)
 	CK      []byte // Cipher Key (3G/4G only)
 	IK      []byte // Integrity Key (3G/4G only)
-	Kc      []byte // Cipher Key (2G only)
+	Kc      []byte // Cipher Key (2G, or 3G with GSM access)
 	AUTS    []byte // Resynchronization token (if sync failure)
 	SW      uint16 // Status word
+
+	// Response is the decoded response data, including unrecognized tags (nil without data)
+	Response *AuthResponse
 }
 
 // Authenticate sends AUTHENTICATE command to USIM/ISIM
@@ -755,14 +869,15 @@ func (r *Reader) AuthenticateWithData(rand, autn, nafId []byte, context byte) (*
 		authData = append(authData, nafId...)
 
 	case AUTH_CONTEXT_GBA:
-		// GBA Bootstrap context: length(RAND) || RAND || length(AUTN) || AUTN
+		// GBA bootstrapping mode: DD || length(RAND) || RAND || length(AUTN) || AUTN
 		if len(rand) != 16 {
 			return nil, fmt.Errorf("RAND must be 16 bytes for GBA context")
 		}
 		if len(autn) != 16 {
 			return nil, fmt.Errorf("AUTN must be 16 bytes for GBA context")
 		}
-		authData = make([]byte, 0, 34)
+		authData = make([]byte, 0, 35)
+		authData = append(authData, 0xDD)
 		authData = append(authData, byte(len(rand)))
 		authData = append(authData, rand...)
 		authData = append(authData, byte(len(autn)))
@@ -816,17 +931,6 @@ func (r *Reader) AuthenticateWithData(rand, autn, nafId []byte, context byte) (*
 
 	result.SW = resp.SW()
 
-	// Handle response
-	if resp.HasMoreData() {
-		// Get the actual response data
-		getResp, err := r.GetResponse(resp.SW2)
-		if err != nil {
-			return nil, fmt.Errorf("GET RESPONSE failed: %w", err)
-		}
-		resp = getResp
-		result.SW = resp.SW()
-	}
-
 	// Parse response based on status word
 	switch {
 	case resp.IsOK():
@@ -836,18 +940,6 @@ func (r *Reader) AuthenticateWithData(rand, autn, nafId []byte, context byte) (*
 			return result, fmt.Errorf("failed to parse auth response: %w", err)
 		}
 
-	case resp.SW1 == 0x9F:
-		// More data available (some cards)
-		getResp, err := r.GetResponse(resp.SW2)
-		if err != nil {
-			return nil, fmt.Errorf("GET RESPONSE failed: %w", err)
-		}
-		result.Success = true
-		result.SW = getResp.SW()
-		if err := parseAuthResponse(getResp.Data, context, result); err != nil {
-			return result, fmt.Errorf("failed to parse auth response: %w", err)
-		}
-
 	case result.SW == 0x6985:
 		// Conditions not satisfied (may need to select USIM ADF first)
 		return result, fmt.Errorf("authentication failed: conditions not satisfied (SW=6985)")
@@ -874,126 +966,33 @@ func (r *Reader) AuthenticateWithData(rand, autn, nafId []byte, context byte) (*
 		return result, fmt.Errorf("authentication failed: reference data not found (SW=6A88)")
 
 	default:
-		return result, fmt.Errorf("authentication failed: %s (SW=%04X)", SWToString(result.SW), result.SW)
+		return result, fmt.Errorf("authentication failed: %s (SW=%04X)", DecodeSW(result.SW, INS_AUTHENTICATE, ContextAuth), result.SW)
 	}
 
 	return result, nil
 }
 
-// parseAuthResponse parses the authentication response data
+// parseAuthResponse decodes the response data (see DecodeAuthResponse) into result
 func parseAuthResponse(data []byte, context byte, result *AuthenticateResult) error {
-	if len(data) == 0 {
-		return fmt.Errorf("empty response data")
-	}
-
-	if context == AUTH_CONTEXT_GSM {
-		// GSM response: SRES (4 bytes) || Kc (8 bytes)
-		if len(data) < 12 {
-			return fmt.Errorf("GSM response too short: %d bytes", len(data))
-		}
-		result.RES = data[:4]  // SRES
-		result.Kc = data[4:12] // Kc
-		return nil
+	decoded, err := DecodeAuthResponse(context, data)
+	result.Response = decoded
+	if err != nil {
+		return err
 	}
 
-	// 3G/4G response format: DB || length(RES) || RES || length(CK) || CK || length(IK) || IK
-	// or: DC || AUTS (sync failure)
-	// or simplified: tag || data
-
-	idx := 0
-	tag := data[idx]
-	idx++
-
-	switch tag {
-	case 0xDB:
-		// Successful authentication
-		// Format: DB || RES_len || RES || CK_len || CK || IK_len || IK
-		if idx >= len(data) {
-			return fmt.Errorf("response too short after tag DB")
-		}
-
-		// RES
-		resLen := int(data[idx])
-		idx++
-		if idx+resLen > len(data) {
-			return fmt.Errorf("RES length overflow")
-		}
-		result.RES = make([]byte, resLen)
-		copy(result.RES, data[idx:idx+resLen])
-		idx += resLen
-
-		// CK
-		if idx >= len(data) {
-			return fmt.Errorf("missing CK length")
-		}
-		ckLen := int(data[idx])
-		idx++
-		if idx+ckLen > len(data) {
-			return fmt.Errorf("CK length overflow")
-		}
-		result.CK = make([]byte, ckLen)
-		copy(result.CK, data[idx:idx+ckLen])
-		idx += ckLen
-
-		// IK
-		if idx >= len(data) {
-			return fmt.Errorf("missing IK length")
-		}
-		ikLen := int(data[idx])
-		idx++
-		if idx+ikLen > len(data) {
-			return fmt.Errorf("IK length overflow")
-		}
-		result.IK = make([]byte, ikLen)
-		copy(result.IK, data[idx:idx+ikLen])
-
-	case 0xDC:
-		// Synchronization failure - AUTS follows
+	switch decoded.Kind {
+	case AuthResponse3G, AuthResponseUntagged:
+		result.RES, result.CK, result.IK, result.Kc = decoded.Success.RES, decoded.Success.CK, decoded.Success.IK, decoded.Success.Kc
+	case AuthResponseSyncFailure:
 		result.Success = false
-		if idx >= len(data) {
-			return fmt.Errorf("missing AUTS length")
-		}
-		autsLen := int(data[idx])
-		idx++
-		if idx+autsLen > len(data) {
-			return fmt.Errorf("AUTS length overflow")
-		}
-		result.AUTS = make([]byte, autsLen)
-		copy(result.AUTS, data[idx:idx+autsLen])
-
-	default:
-		// Some cards may use simplified format without tags
-		// Try to parse as: RES_len || RES || CK_len || CK || IK_len || IK
-		idx = 0
-		resLen := int(data[idx])
-		idx++
-
-		if resLen > 0 && idx+resLen <= len(data) {
-			result.RES = make([]byte, resLen)
-			copy(result.RES, data[idx:idx+resLen])
-			idx += resLen
-
-			if idx < len(data) {
-				ckLen := int(data[idx])
-				idx++
-				if idx+ckLen <= len(data) {
-					result.CK = make([]byte, ckLen)
-					copy(result.CK, data[idx:idx+ckLen])
-					idx += ckLen
-
-					if idx < len(data) {
-						ikLen := int(data[idx])
-						idx++
-						if idx+ikLen <= len(data) {
-							result.IK = make([]byte, ikLen)
-							copy(result.IK, data[idx:idx+ikLen])
-						}
-					}
-				}
-			}
-		}
+		result.AUTS = decoded.SyncFailure.AUTS
+	case AuthResponseGBA:
+		result.RES = decoded.GBA.RES
+	case AuthResponseGSM:
+		result.RES, result.Kc = decoded.GSM.SRES, decoded.GSM.Kc
+	case AuthResponseUnknown:
+		return fmt.Errorf("unrecognized response data: %s", decoded.Unrecognized[0])
 	}
-
 	return nil
 }
 
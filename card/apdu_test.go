@@ -1,6 +1,7 @@
 package card
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
 )
@@ -143,6 +144,125 @@ func TestRecordModeConstants(t *testing.T) {
 	}
 }
 
+func TestReadRecordWithMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		cyclic bool
+		modes  []byte
+		want   []byte // first byte of each record read, 0 = record not found
+	}{
+		{"Linear next", false, []byte{RecordModeNext, RecordModeNext, RecordModeNext, RecordModeNext}, []byte{1, 2, 3, 0}},
+		{"Linear previous", false, []byte{RecordModePrevious, RecordModePrevious, RecordModePrevious, RecordModePrevious}, []byte{3, 2, 1, 0}},
+		{"Cyclic previous wraps", true, []byte{RecordModePrevious, RecordModePrevious, RecordModePrevious, RecordModePrevious}, []byte{3, 2, 1, 3}},
+		{"Cyclic next wraps", true, []byte{RecordModeNext, RecordModeNext, RecordModeNext, RecordModeNext}, []byte{1, 2, 3, 1}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMockCard([]byte{0x3B, 0x00})
+			if tc.cyclic {
+				m.MF().AddCyclicEF(0x2F10, []byte{1}, []byte{2}, []byte{3})
+			} else {
+				m.MF().AddRecordEF(0x2F10, []byte{1}, []byte{2}, []byte{3})
+			}
+			r := NewReaderWithTransport("Mock", m.ATR, m)
+			r.Select([]byte{0x2F, 0x10})
+
+			for i, mode := range tc.modes {
+				resp, err := r.ReadRecordWithMode(0, 1, mode)
+				if err != nil {
+					t.Fatalf("ReadRecordWithMode() error = %v", err)
+				}
+				got := byte(0)
+				if resp.IsOK() {
+					got = resp.Data[0]
+				}
+				if got != tc.want[i] {
+					t.Errorf("read %d = %d, want %d", i+1, got, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateRecordWithMode_Cyclic(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	ef := m.MF().AddCyclicEF(0x2F10, []byte{1}, []byte{2}, []byte{3})
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	r.Select([]byte{0x2F, 0x10})
+
+	resp, err := r.UpdateRecordWithMode(0, RecordModePrevious, []byte{4})
+	if err != nil || !resp.IsOK() {
+		t.Fatalf("UpdateRecordWithMode() = %v, %v", resp, err)
+	}
+	if !reflect.DeepEqual(ef.Records, [][]byte{{4}, {1}, {2}}) {
+		t.Errorf("records = %v, want [[4] [1] [2]]", ef.Records)
+	}
+}
+
+func TestAppendCyclicRecord_RotatingWindow(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	ef := m.MF().AddCyclicEF(0x2F10, []byte{3}, []byte{2}, []byte{1})
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	r.Select([]byte{0x2F, 0x10})
+
+	// The record pointer left by a read must not change where the record lands
+	if resp, err := r.ReadRecord(2, 1); err != nil || !resp.IsOK() {
+		t.Fatalf("ReadRecord(2) = %v, %v", resp, err)
+	}
+	for v := byte(4); v <= 8; v++ {
+		resp, err := r.AppendCyclicRecord([]byte{v})
+		if err != nil || !resp.IsOK() {
+			t.Fatalf("AppendCyclicRecord(%d) = %v, %v", v, resp, err)
+		}
+		if got := m.Log[len(m.Log)-1]; !bytes.Equal(got, []byte{0x00, INS_UPDATE_RECORD, 0x00, RecordModePrevious, 0x01, v}) {
+			t.Errorf("APDU = %X, want UPDATE RECORD PREVIOUS", got)
+		}
+	}
+	if !reflect.DeepEqual(ef.Records, [][]byte{{8}, {7}, {6}}) {
+		t.Errorf("records = %v, want the last three appended, newest first", ef.Records)
+	}
+	for rec := byte(1); rec <= 3; rec++ {
+		if resp, _ := r.ReadRecord(rec, 1); resp.Data[0] != 9-rec {
+			t.Errorf("record %d = %X, want %d", rec, resp.Data, 9-rec)
+		}
+	}
+}
+
+func TestIncreaseFile(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	ef := m.MF().AddCyclicEF(0x6F39, []byte{0x00, 0x00, 0xFE}, []byte{0x00, 0x00, 0x10})
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	r.Select([]byte{0x6F, 0x39})
+
+	resp, err := r.IncreaseFile([]byte{0x00, 0x00, 0x03})
+	if err != nil || !resp.IsOK() {
+		t.Fatalf("IncreaseFile() = %v, %v", resp, err)
+	}
+	if got := m.Log[len(m.Log)-1]; !bytes.Equal(got, []byte{0x80, INS_INCREASE, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00}) {
+		t.Errorf("APDU = %X, want 80 32 00 00 03 000003 00", got)
+	}
+	if !bytes.Equal(resp.Data, []byte{0x00, 0x01, 0x01, 0x00, 0x00, 0x03}) {
+		t.Errorf("response = %X, want the new value and the amount", resp.Data)
+	}
+	if !reflect.DeepEqual(ef.Records, [][]byte{{0x00, 0x01, 0x01}, {0x00, 0x00, 0xFE}}) {
+		t.Errorf("records = %X, want the sum as record 1", ef.Records)
+	}
+
+	// A shorter amount is added to the low-order bytes
+	if resp, err := r.IncreaseFile([]byte{0x01}); err != nil || !bytes.Equal(resp.Data[:3], []byte{0x00, 0x01, 0x02}) {
+		t.Errorf("IncreaseFile(01) = %v, %v", resp, err)
+	}
+
+	ef.Records[0] = []byte{0xFF, 0xFF, 0xFF}
+	if resp, _ := r.IncreaseFile([]byte{0x01}); resp.SW() != 0x9850 {
+		t.Errorf("overflow SW = %04X, want 9850", resp.SW())
+	}
+	if _, err := r.IncreaseFile(nil); err == nil {
+		t.Errorf("IncreaseFile(nil) accepted")
+	}
+}
+
 // ============ AUTH CONTEXT TESTS ============
 
 func TestAuthContextConstants(t *testing.T) {
@@ -189,6 +309,7 @@ func TestINSConstants(t *testing.T) {
 		{"INS_CHANGE_REFERENCE_DATA", INS_CHANGE_REFERENCE_DATA, 0x24},
 		{"INS_STATUS", INS_STATUS, 0xF2},
 		{"INS_AUTHENTICATE", INS_AUTHENTICATE, 0x88},
+		{"INS_GET_CHALLENGE", INS_GET_CHALLENGE, 0x84},
 	}
 
 	for _, tc := range tests {
@@ -200,6 +321,43 @@ func TestINSConstants(t *testing.T) {
 	}
 }
 
+// ============ GET CHALLENGE TESTS ============
+
+func TestGetChallenge(t *testing.T) {
+	tests := []struct {
+		name     string
+		override func(apdu []byte) []byte
+		wantLen  int
+		wantErr  bool
+	}{
+		{"Requested length", nil, 8, false},
+		{"Fixed length retry (6Cxx)", func(apdu []byte) []byte {
+			if apdu[1] == INS_GET_CHALLENGE && apdu[4] != 4 {
+				return []byte{0x6C, 0x04}
+			}
+			return nil
+		}, 4, false},
+		{"Not supported", func(apdu []byte) []byte {
+			return []byte{0x6D, 0x00}
+		}, 0, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMockCard([]byte{0x3B, 0x00})
+			m.Override = tc.override
+			r := NewReaderWithTransport("Mock", m.ATR, m)
+			got, err := r.GetChallenge(8)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("GetChallenge() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if len(got) != tc.wantLen {
+				t.Errorf("GetChallenge() returned %d bytes, want %d", len(got), tc.wantLen)
+			}
+		})
+	}
+}
+
 // ============ APDU PARSING TESTS ============
 
 func TestParseAPDUResponse(t *testing.T) {
@@ -285,3 +443,231 @@ func TestParsePINRetries(t *testing.T) {
 		}
 	}
 }
+
+// ============ RESPONSE CHAINING TESTS ============
+
+// newChainingReader returns a reader whose card answers through override
+func newChainingReader(override func(apdu []byte) []byte) (*MockCard, *Reader) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.Override = override
+	return m, NewReaderWithTransport("Mock", m.ATR, m)
+}
+
+func TestSendAPDU_GetResponseChain(t *testing.T) {
+	// 288 bytes: 61 00, then 256 bytes with 61 20, then 32 bytes with 90 00
+	payload := make([]byte, 288)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	m, reader := newChainingReader(func(apdu []byte) []byte {
+		switch {
+		case apdu[1] == 0xCA:
+			return []byte{0x61, 0x00}
+		case apdu[1] == INS_GET_RESPONSE && apdu[4] == 0x00:
+			return append(append([]byte(nil), payload[:256]...), 0x61, 0x20)
+		case apdu[1] == INS_GET_RESPONSE && apdu[4] == 0x20:
+			return append(append([]byte(nil), payload[256:]...), 0x90, 0x00)
+		}
+		return []byte{0x6D, 0x00}
+	})
+
+	resp, err := reader.SendAPDU([]byte{0x80, 0xCA, 0x00, 0xFE, 0x00})
+	if err != nil {
+		t.Fatalf("SendAPDU() error = %v", err)
+	}
+	if !resp.IsOK() || !reflect.DeepEqual(resp.Data, payload) {
+		t.Fatalf("SendAPDU() = %d bytes, SW %04X; want 288 bytes, 9000", len(resp.Data), resp.SW())
+	}
+	if resp.ins != 0xCA {
+		t.Errorf("response attributed to INS %02X, want CA", resp.ins)
+	}
+	// GET RESPONSE is sent in the interindustry class
+	want := [][]byte{
+		{0x80, 0xCA, 0x00, 0xFE, 0x00},
+		{0x00, 0xC0, 0x00, 0x00, 0x00},
+		{0x00, 0xC0, 0x00, 0x00, 0x20},
+	}
+	if !reflect.DeepEqual(m.Log, want) {
+		t.Errorf("exchanges = %X, want %X", m.Log, want)
+	}
+}
+
+func TestSendAPDU_WrongLe(t *testing.T) {
+	// 6Cxx on the first attempt: the command is re-sent with the Le the card asked for
+	m, reader := newChainingReader(func(apdu []byte) []byte {
+		if apdu[1] == INS_READ_BINARY {
+			if apdu[4] != 0x05 {
+				return []byte{0x6C, 0x05}
+			}
+			return []byte{1, 2, 3, 4, 5, 0x90, 0x00}
+		}
+		return nil
+	})
+	resp, err := reader.ReadBinary(0, 0)
+	if err != nil || !resp.IsOK() || len(resp.Data) != 5 {
+		t.Fatalf("ReadBinary() = %v, %v", resp, err)
+	}
+	if len(m.Log) != 2 || m.Log[1][4] != 0x05 {
+		t.Errorf("exchanges = %X", m.Log)
+	}
+
+	// A second 6Cxx is returned to the caller instead of looping
+	_, reader = newChainingReader(func(apdu []byte) []byte { return []byte{0x6C, 0x07} })
+	if resp, _ := reader.ReadBinary(0, 0); resp.SW() != 0x6C07 {
+		t.Errorf("ReadBinary() SW = %04X, want 6C07", resp.SW())
+	}
+}
+
+func TestSendAPDU_GSMAndRaw(t *testing.T) {
+	// GSM cards answer 9Fxx; GET RESPONSE keeps CLA A0 and gets 6Cxx once
+	m, reader := newChainingReader(func(apdu []byte) []byte {
+		switch {
+		case apdu[1] == INS_SELECT:
+			return []byte{0x9F, 0x0F}
+		case apdu[1] == INS_GET_RESPONSE && apdu[4] == 0x0F:
+			return []byte{0x6C, 0x02}
+		case apdu[1] == INS_GET_RESPONSE:
+			return []byte{0x3F, 0x00, 0x90, 0x00}
+		}
+		return nil
+	})
+	resp, err := reader.SelectGSM([]byte{0x3F, 0x00})
+	if err != nil || !resp.IsOK() || len(resp.Data) != 2 {
+		t.Fatalf("SelectGSM() = %v, %v", resp, err)
+	}
+	for _, apdu := range m.Log[1:] {
+		if apdu[0] != 0xA0 {
+			t.Errorf("GET RESPONSE sent with CLA %02X, want A0", apdu[0])
+		}
+	}
+
+	// SendAPDURaw leaves the card's status word alone
+	m.Log = nil
+	resp, err = reader.SendAPDURaw([]byte{0xA0, 0xA4, 0x00, 0x00, 0x02, 0x3F, 0x00})
+	if err != nil || resp.SW() != 0x9F0F || len(m.Log) != 1 {
+		t.Errorf("SendAPDURaw() = %v, %v after %d exchanges", resp, err, len(m.Log))
+	}
+
+	// A card that never stops asking for GET RESPONSE is cut off
+	_, reader = newChainingReader(func(apdu []byte) []byte { return []byte{0x00, 0x61, 0x01} })
+	if _, err := reader.SendAPDU([]byte{0x00, 0xCA, 0x00, 0xFE, 0x00}); err == nil {
+		t.Error("SendAPDU() should fail on an endless response chain")
+	}
+}
+
+func TestGetResponseCLA(t *testing.T) {
+	tests := []struct{ cla, want byte }{
+		{0x00, 0x00}, {0x03, 0x03}, {0x80, 0x00}, {0x84, 0x00}, {0xA0, 0xA0}, {0x45, 0x45}, {0x81, 0x01},
+	}
+	for _, tt := range tests {
+		if got := getResponseCLA(tt.cla); got != tt.want {
+			t.Errorf("getResponseCLA(%02X) = %02X, want %02X", tt.cla, got, tt.want)
+		}
+	}
+}
+
+func TestWithLe(t *testing.T) {
+	tests := []struct {
+		name string
+		apdu []byte
+		want []byte
+	}{
+		{"case 1", []byte{0x00, 0xF2, 0x00, 0x00}, []byte{0x00, 0xF2, 0x00, 0x00, 0x10}},
+		{"case 2", []byte{0x00, 0xB0, 0x00, 0x00, 0x00}, []byte{0x00, 0xB0, 0x00, 0x00, 0x10}},
+		{"case 3", []byte{0x00, 0xCB, 0x00, 0xFF, 0x01, 0x5C}, []byte{0x00, 0xCB, 0x00, 0xFF, 0x01, 0x5C, 0x10}},
+		{"case 4", []byte{0x00, 0xCB, 0x00, 0xFF, 0x01, 0x5C, 0x00}, []byte{0x00, 0xCB, 0x00, 0xFF, 0x01, 0x5C, 0x10}},
+		{"extended", []byte{0x00, 0xB0, 0x00, 0x00, 0x00, 0x01, 0x00}, nil},
+		{"malformed", []byte{0x00, 0xB0, 0x00, 0x00, 0x05, 0x01}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := append([]byte(nil), tt.apdu...)
+			if got := withLe(tt.apdu, 0x10); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withLe() = %X, want %X", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.apdu, orig) {
+				t.Error("withLe() modified its argument")
+			}
+		})
+	}
+}
+
+// ============ SELECT BY AID TESTS ============
+
+// aidSelectP2Log returns the P2 of every SELECT by AID the card received
+func aidSelectP2Log(m *MockCard) []byte {
+	var out []byte
+	for _, apdu := range m.Log {
+		if apdu[1] == INS_SELECT && apdu[2] == 0x04 {
+			out = append(out, apdu[3])
+		}
+	}
+	return out
+}
+
+func TestSelectAID_P2Fallback(t *testing.T) {
+	aid := []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02}
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(aid).AddEF(0x6F07, []byte{0x08, 0x09})
+	m.AIDSelectP2 = []byte{0x0C} // 6A86 for P2=04 and 00
+
+	var logged []byte
+	r := NewReaderWithTransport("Mock", m.ATR, m, WithAIDSelectHandler(func(p2 byte) {
+		logged = append(logged, p2)
+	}))
+
+	resp, err := r.Select(aid)
+	if err != nil || !resp.IsOK() || len(resp.Data) != 0 {
+		t.Fatalf("Select(AID) = %v, %v, want 9000 without FCP", resp, err)
+	}
+	if got := aidSelectP2Log(m); !reflect.DeepEqual(got, []byte{0x04, 0x0C}) {
+		t.Errorf("P2 tried = %X, want 04 then 0C", got)
+	}
+	if p2, ok := r.AIDSelectP2(); !ok || p2 != 0x0C {
+		t.Errorf("AIDSelectP2() = %02X, %v, want 0C", p2, ok)
+	}
+	if !reflect.DeepEqual(logged, []byte{0x0C}) {
+		t.Errorf("handler called with %X, want 0C once", logged)
+	}
+
+	// The EF under the application still returns its FCP
+	if resp, _ := r.Select([]byte{0x6F, 0x07}); !resp.IsOK() || len(resp.Data) == 0 {
+		t.Errorf("Select(EF) = %X %04X, want FCP", resp.Data, resp.SW())
+	}
+
+	// Later selections start with the accepted option
+	m.Log = nil
+	r.Select(aid)
+	if got := aidSelectP2Log(m); !reflect.DeepEqual(got, []byte{0x0C}) {
+		t.Errorf("P2 tried after the first selection = %X, want 0C", got)
+	}
+
+	// Other errors are returned as they are
+	m.Log = nil
+	if resp, _ := r.Select([]byte{0xA0, 0x00, 0x00, 0x01, 0x51}); resp.SW() != SW_FILE_NOT_FOUND {
+		t.Errorf("unknown AID = %04X, want 6A82", resp.SW())
+	}
+	if got := aidSelectP2Log(m); len(got) != 1 {
+		t.Errorf("P2 tried for an unknown AID = %X, want one", got)
+	}
+	if len(logged) != 1 {
+		t.Errorf("handler called %d times, want once", len(logged))
+	}
+}
+
+func TestSelectAID_StandardCard(t *testing.T) {
+	aid := []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02}
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(aid)
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+
+	if resp, _ := r.Select(aid); !resp.HasMoreData() && !resp.IsOK() {
+		t.Fatalf("Select(AID) = %04X", resp.SW())
+	}
+	if got := aidSelectP2Log(m); !reflect.DeepEqual(got, []byte{0x04}) {
+		t.Errorf("P2 tried = %X, want only 04", got)
+	}
+	if p2, ok := r.AIDSelectP2(); !ok || p2 != 0x04 {
+		t.Errorf("AIDSelectP2() = %02X, %v, want 04", p2, ok)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"strings"
 )
 
+// Default reader clock (ISO 7816-3 typical 3.5712 MHz gives 9600 bps with Fi=372, Di=1)
+const DefaultCardClockHz = 3571200
+
 // ATRInfo represents decoded Answer To Reset information
 type ATRInfo struct {
 	Raw          []byte
@@ -22,13 +25,80 @@ type ATRInfo struct {
 	Voltage      string // Voltage info from TB
 	ProgrammingP byte   // Programming voltage P
 	ProgrammingI byte   // Programming current I
+
+	// Derived values (ParseATR)
+	FMaxMHz        float64 // Maximum clock frequency from TA1 (MHz)
+	DefaultBaud    int     // Baud rate before PPS (Fi=372, Di=1 at DefaultCardClockHz)
+	BaudAtDefault  int     // Baud rate with TA1 Fi/Di at DefaultCardClockHz
+	MaxBaud        int     // Baud rate with TA1 Fi/Di at FMax
+	ExtraGuardTime int     // TC1 (N), 255 = minimum guard time
+	WaitingInteger int     // TC2 for T=0 (WI, default 10)
+	IFSC           int     // T=1 information field size for the card (default 32)
+	BWI            int     // T=1 block waiting time integer (default 4)
+	CWI            int     // T=1 character waiting time integer (default 13)
+
+	// TA2: specific mode
+	SpecificMode     bool // TA2 present: card is in specific mode, no PPS
+	SpecificProtocol int  // Protocol imposed by TA2
+	ModeChangeable   bool // TA2 b8=0: card can switch to negotiable mode (warm reset)
+	ImplicitParams   bool // TA2 b5=1: parameters are implicit (not from interface bytes)
+
+	// First TA/TB after T=15 (global interface bytes)
+	ClassIndicator byte     // TAi b6-b1 (0 = absent)
+	Classes        []string // Supported supply classes (A/B/C)
+	ClockStop      string   // Clock stop indicator (TAi b8-b7)
+
+	// Historical bytes
+	HistoricalCategory string          // Category indicator interpretation
+	HistoricalObjects  []ATRHistObject // COMPACT-TLV objects
+	StatusIndicator    []byte          // Card life cycle + SW1SW2 (if present)
+
+	// Checksum
+	TCKRequired bool // TCK must be present (protocol other than T=0 indicated)
+	TCKValid    bool // XOR T0..TCK == 0
+}
+
+// ATRHistObject is a COMPACT-TLV data object from the historical bytes
+type ATRHistObject struct {
+	Tag   byte
+	Name  string
+	Value []byte
 }
 
-// DecodeATR parses a raw ATR byte slice
+// fiTable maps TA1 high nibble to Fi and f(max) in MHz (ISO 7816-3 Table 7)
+var fiTable = map[byte]struct {
+	fi   int
+	fmax float64
+}{
+	0x0: {372, 4}, 0x1: {372, 5}, 0x2: {558, 6}, 0x3: {744, 8},
+	0x4: {1116, 12}, 0x5: {1488, 16}, 0x6: {1860, 20},
+	0x9: {512, 5}, 0xA: {768, 7.5}, 0xB: {1024, 10},
+	0xC: {1536, 15}, 0xD: {2048, 20},
+}
+
+// diTable maps TA1 low nibble to Di (ISO 7816-3 Table 8)
+var diTable = map[byte]int{
+	0x1: 1, 0x2: 2, 0x3: 4, 0x4: 8, 0x5: 16, 0x6: 32, 0x7: 64,
+	0x8: 12, 0x9: 20,
+}
+
+// DecodeATR parses a raw ATR byte slice.
+// Kept for compatibility; see ParseATR.
 func DecodeATR(atr []byte) (*ATRInfo, error) {
+	return ParseATR(atr)
+}
+
+// ParseATR fully decodes an ATR (ISO 7816-3 / ETSI TS 102 221):
+// TS/T0, interface bytes TA1..TDn with derived values (Fi/Di, f(max), baud rates,
+// specific/negotiable mode, class indicator, clock stop, T=0/T=1 parameters),
+// historical bytes (category and COMPACT-TLV objects) and TCK verification.
+func ParseATR(atr []byte) (*ATRInfo, error) {
 	if len(atr) < 2 {
 		return nil, fmt.Errorf("ATR too short")
 	}
+	if atr[0] != 0x3B && atr[0] != 0x3F {
+		return nil, fmt.Errorf("invalid TS byte %02X (expected 3B or 3F)", atr[0])
+	}
 
 	info := &ATRInfo{
 		Raw: atr,
@@ -45,11 +115,11 @@ func DecodeATR(atr []byte) (*ATRInfo, error) {
 	pn := 1
 	td := info.T0
 
-	for ptr < len(atr) {
+	for {
 		// TAi
 		if td&0x10 != 0 {
 			if ptr >= len(atr) {
-				break
+				return nil, fmt.Errorf("ATR truncated at TA%d", pn)
 			}
 			info.TA[pn] = atr[ptr]
 			ptr++
@@ -57,7 +127,7 @@ func DecodeATR(atr []byte) (*ATRInfo, error) {
 		// TBi
 		if td&0x20 != 0 {
 			if ptr >= len(atr) {
-				break
+				return nil, fmt.Errorf("ATR truncated at TB%d", pn)
 			}
 			info.TB[pn] = atr[ptr]
 			ptr++
@@ -65,39 +135,44 @@ func DecodeATR(atr []byte) (*ATRInfo, error) {
 		// TCi
 		if td&0x40 != 0 {
 			if ptr >= len(atr) {
-				break
+				return nil, fmt.Errorf("ATR truncated at TC%d", pn)
 			}
 			info.TC[pn] = atr[ptr]
 			ptr++
 		}
 		// TDi
-		if td&0x80 != 0 {
-			if ptr >= len(atr) {
-				break
-			}
-			td = atr[ptr]
-			info.TD[pn] = td
-			protocol := int(td & 0x0F)
-			info.Protocols = append(info.Protocols, protocol)
-			ptr++
-			pn++
-		} else {
+		if td&0x80 == 0 {
 			break
 		}
+		if ptr >= len(atr) {
+			return nil, fmt.Errorf("ATR truncated at TD%d", pn)
+		}
+		td = atr[ptr]
+		info.TD[pn] = td
+		protocol := int(td & 0x0F)
+		info.Protocols = append(info.Protocols, protocol)
+		if protocol != 0 {
+			info.TCKRequired = true
+		}
+		ptr++
+		pn++
 	}
 
 	// Historical bytes
-	if ptr+hbLen <= len(atr) {
-		info.HB = atr[ptr : ptr+hbLen]
-		ptr += hbLen
-	} else if ptr < len(atr) {
-		info.HB = atr[ptr:]
-		ptr = len(atr)
+	if ptr+hbLen > len(atr) {
+		return nil, fmt.Errorf("ATR truncated: %d historical bytes expected, %d available", hbLen, len(atr)-ptr)
 	}
+	info.HB = atr[ptr : ptr+hbLen]
+	ptr += hbLen
 
 	// TCK (Checksum)
 	if ptr < len(atr) {
 		info.TCK = &atr[ptr]
+		var x byte
+		for _, b := range atr[1 : ptr+1] {
+			x ^= b
+		}
+		info.TCKValid = x == 0
 	}
 
 	// Interpret parameters
@@ -106,20 +181,31 @@ func DecodeATR(atr []byte) (*ATRInfo, error) {
 	return info, nil
 }
 
+// protocolFor returns the protocol that qualifies interface bytes of group i (i >= 2).
+func (info *ATRInfo) protocolFor(i int) int {
+	if td, ok := info.TD[i-1]; ok {
+		return int(td & 0x0F)
+	}
+	return -1
+}
+
 func (info *ATRInfo) interpret() {
-	// TA1: Fi and Di
+	// TA1: Fi and Di (defaults Fi=372, Di=1, f(max)=5 MHz)
+	fi, fmax, di := 372, 5.0, 1
 	if val, ok := info.TA[1]; ok {
-		fiTable := map[byte]int{
-			0: 372, 1: 372, 2: 558, 3: 744, 4: 1116, 5: 1488, 6: 1860,
-			9: 512, 10: 768, 11: 1024, 12: 1536, 13: 2048,
+		if f, ok := fiTable[val>>4]; ok {
+			fi, fmax = f.fi, f.fmax
 		}
-		diTable := map[byte]int{
-			1: 1, 2: 2, 3: 4, 4: 8, 5: 16, 6: 32, 7: 64,
-			8: 12, 9: 20,
+		if d, ok := diTable[val&0x0F]; ok {
+			di = d
 		}
-		info.Fi = fiTable[val>>4]
-		info.Di = diTable[val&0x0F]
+		info.Fi = fi
+		info.Di = di
 	}
+	info.FMaxMHz = fmax
+	info.DefaultBaud = DefaultCardClockHz / 372
+	info.BaudAtDefault = DefaultCardClockHz * di / fi
+	info.MaxBaud = int(fmax*1e6) * di / fi
 
 	// TB1, TB2: Voltage
 	if val, ok := info.TB[1]; ok {
@@ -139,6 +225,187 @@ func (info *ATRInfo) interpret() {
 		// Default voltages for modern cards
 		info.Voltage = "1.8V, 3V, 5V (Class A/B/C)"
 	}
+
+	// TC1: extra guard time
+	if val, ok := info.TC[1]; ok {
+		info.ExtraGuardTime = int(val)
+	}
+
+	// TA2: specific mode
+	if val, ok := info.TA[2]; ok {
+		info.SpecificMode = true
+		info.SpecificProtocol = int(val & 0x0F)
+		info.ModeChangeable = val&0x80 == 0
+		info.ImplicitParams = val&0x10 != 0
+	}
+
+	// TC2: waiting integer for T=0
+	info.WaitingInteger = 10
+	if val, ok := info.TC[2]; ok && info.protocolFor(2) == 0 {
+		info.WaitingInteger = int(val)
+	}
+
+	// T=1 specific bytes (i >= 3) and global bytes after T=15
+	info.IFSC, info.BWI, info.CWI = 32, 4, 13
+	seenT1, seenT15 := false, false
+	for i := 3; i <= len(info.TD)+1; i++ {
+		switch info.protocolFor(i) {
+		case 1:
+			if seenT1 {
+				continue
+			}
+			seenT1 = true
+			if val, ok := info.TA[i]; ok {
+				info.IFSC = int(val)
+			}
+			if val, ok := info.TB[i]; ok {
+				info.BWI = int(val >> 4)
+				info.CWI = int(val & 0x0F)
+			}
+		case 15:
+			if seenT15 {
+				continue
+			}
+			seenT15 = true
+			if val, ok := info.TA[i]; ok {
+				info.ClassIndicator = val & 0x3F
+				info.ClockStop = clockStopString(val >> 6)
+				if val&0x01 != 0 {
+					info.Classes = append(info.Classes, "A (5V)")
+				}
+				if val&0x02 != 0 {
+					info.Classes = append(info.Classes, "B (3V)")
+				}
+				if val&0x04 != 0 {
+					info.Classes = append(info.Classes, "C (1.8V)")
+				}
+				if len(info.Classes) > 0 {
+					info.Voltage = strings.Join(info.Classes, ", ")
+				}
+			}
+		}
+	}
+
+	info.interpretHistorical()
+}
+
+func clockStopString(v byte) string {
+	switch v & 0x03 {
+	case 0:
+		return "Not supported"
+	case 1:
+		return "State L"
+	case 2:
+		return "State H"
+	default:
+		return "No preference"
+	}
+}
+
+// compactTLVNames maps COMPACT-TLV tags (ISO 7816-4 8.1.1.2) to names
+var compactTLVNames = map[byte]string{
+	0x1: "Country code",
+	0x2: "Issuer identification",
+	0x3: "Card service data",
+	0x4: "Initial access data",
+	0x5: "Card issuer's data",
+	0x6: "Pre-issuing data",
+	0x7: "Card capabilities",
+	0x8: "Status indicator",
+	0xF: "Application identifier",
+}
+
+func (info *ATRInfo) interpretHistorical() {
+	if len(info.HB) == 0 {
+		return
+	}
+
+	switch cat := info.HB[0]; {
+	case cat == 0x00:
+		info.HistoricalCategory = "COMPACT-TLV with status indicator (last 3 bytes)"
+		if len(info.HB) >= 4 {
+			info.HistoricalObjects = parseCompactTLV(info.HB[1 : len(info.HB)-3])
+			info.StatusIndicator = info.HB[len(info.HB)-3:]
+		}
+	case cat == 0x80:
+		info.HistoricalCategory = "COMPACT-TLV"
+		info.HistoricalObjects = parseCompactTLV(info.HB[1:])
+		for _, obj := range info.HistoricalObjects {
+			if obj.Tag == 0x8 {
+				info.StatusIndicator = obj.Value
+			}
+		}
+	case cat == 0x10:
+		info.HistoricalCategory = "DIR data reference"
+	case cat >= 0x81 && cat <= 0x8F:
+		info.HistoricalCategory = "RFU"
+	default:
+		info.HistoricalCategory = "Proprietary"
+	}
+}
+
+// parseCompactTLV parses COMPACT-TLV objects (tag in high nibble, length in low nibble).
+// Parsing stops at the first object that does not fit.
+func parseCompactTLV(data []byte) []ATRHistObject {
+	var objs []ATRHistObject
+	for i := 0; i < len(data); {
+		tag := data[i] >> 4
+		length := int(data[i] & 0x0F)
+		if i+1+length > len(data) {
+			break
+		}
+		name, ok := compactTLVNames[tag]
+		if !ok {
+			name = fmt.Sprintf("Tag %X", tag)
+		}
+		objs = append(objs, ATRHistObject{Tag: tag, Name: name, Value: data[i+1 : i+1+length]})
+		i += 1 + length
+	}
+	return objs
+}
+
+// PPSCapable reports whether the card advertises faster parameters than the default
+// and is in negotiable mode, i.e. a PPS exchange could speed up communication.
+func (info *ATRInfo) PPSCapable() bool {
+	ta1, ok := info.TA[1]
+	if !ok || ta1 == 0x11 {
+		return false
+	}
+	return !info.SpecificMode || info.ModeChangeable
+}
+
+// InterfaceBytes returns interface bytes in transmission order, e.g. "TA1=96 TD1=80 TD2=1F TA3=C7".
+func (info *ATRInfo) InterfaceBytes() string {
+	var parts []string
+	for i := 1; i <= len(info.TD)+1; i++ {
+		if v, ok := info.TA[i]; ok {
+			parts = append(parts, fmt.Sprintf("TA%d=%02X", i, v))
+		}
+		if v, ok := info.TB[i]; ok {
+			parts = append(parts, fmt.Sprintf("TB%d=%02X", i, v))
+		}
+		if v, ok := info.TC[i]; ok {
+			parts = append(parts, fmt.Sprintf("TC%d=%02X", i, v))
+		}
+		if v, ok := info.TD[i]; ok {
+			parts = append(parts, fmt.Sprintf("TD%d=%02X", i, v))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// TCKStatus returns a human-readable checksum status.
+func (info *ATRInfo) TCKStatus() string {
+	switch {
+	case info.TCK == nil && info.TCKRequired:
+		return "missing (required)"
+	case info.TCK == nil:
+		return "absent (T=0 only)"
+	case info.TCKValid:
+		return fmt.Sprintf("%02X (valid)", *info.TCK)
+	default:
+		return fmt.Sprintf("%02X (INVALID)", *info.TCK)
+	}
 }
 
 func (info *ATRInfo) ToString() string {
@@ -157,6 +424,7 @@ func (info *ATRInfo) ToString() string {
 
 	if info.Fi > 0 || info.Di > 0 {
 		sb.WriteString(fmt.Sprintf("  Transmission: Fi=%d, Di=%d (Baud rate factor: %d)\n", info.Fi, info.Di, info.Fi/info.Di))
+		sb.WriteString(fmt.Sprintf("  Max baud rate: %d bps (f(max)=%g MHz)\n", info.MaxBaud, info.FMaxMHz))
 	}
 
 	if info.Voltage != "" {
@@ -178,8 +446,8 @@ func (info *ATRInfo) ToString() string {
 		sb.WriteString("\n")
 	}
 
-	if info.TCK != nil {
-		sb.WriteString(fmt.Sprintf("  Checksum (TCK): %02X\n", *info.TCK))
+	if info.TCK != nil || info.TCKRequired {
+		sb.WriteString(fmt.Sprintf("  Checksum (TCK): %s\n", info.TCKStatus()))
 	}
 
 	return sb.String()
@@ -195,3 +463,59 @@ func (info *ATRInfo) Convention() string {
 		return "Unknown"
 	}
 }
+
+// ATRPattern is an ATR with wildcards, e.g. "3B 9F 96 80 1F .. 80 31 E0 73 FE 21 1B 63 3A 20 4E 83 00 90 00 ..":
+// hex digits, with X or . for any nibble (.. or XX for any byte). The pattern must cover the
+// whole ATR.
+type ATRPattern struct {
+	text  string
+	value []byte
+	mask  []byte
+}
+
+// ParseATRPattern parses an ATR pattern; spaces and colons are ignored
+func ParseATRPattern(s string) (*ATRPattern, error) {
+	digits := strings.NewReplacer(" ", "", ":", "").Replace(s)
+	if digits == "" || len(digits)%2 != 0 {
+		return nil, fmt.Errorf("ATR pattern %q: need an even number of hex digits or wildcards", s)
+	}
+	p := &ATRPattern{text: s, value: make([]byte, len(digits)/2), mask: make([]byte, len(digits)/2)}
+	for i := 0; i < len(digits); i++ {
+		var v, m byte
+		switch c := digits[i]; {
+		case c == 'X' || c == 'x' || c == '.':
+		case c >= '0' && c <= '9':
+			v, m = c-'0', 0x0F
+		case c >= 'A' && c <= 'F':
+			v, m = c-'A'+10, 0x0F
+		case c >= 'a' && c <= 'f':
+			v, m = c-'a'+10, 0x0F
+		default:
+			return nil, fmt.Errorf("ATR pattern %q: invalid character %q", s, c)
+		}
+		if i%2 == 0 {
+			v, m = v<<4, m<<4
+		}
+		p.value[i/2] |= v
+		p.mask[i/2] |= m
+	}
+	return p, nil
+}
+
+// Match reports whether atr matches the pattern
+func (p *ATRPattern) Match(atr []byte) bool {
+	if len(atr) != len(p.value) {
+		return false
+	}
+	for i, b := range atr {
+		if b&p.mask[i] != p.value[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the pattern as given
+func (p *ATRPattern) String() string {
+	return p.text
+}
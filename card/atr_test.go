@@ -0,0 +1,321 @@
+package card
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// ============ ATR PARSING TESTS ============
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+func TestParseATR_RealCards(t *testing.T) {
+	tests := []struct {
+		name        string
+		atr         string
+		protocols   []int
+		fi, di      int
+		maxBaud     int
+		classes     []string
+		clockStop   string
+		category    string
+		hbLen       int
+		tckRequired bool
+		tckValid    bool
+		pps         bool
+	}{
+		{
+			name:      "sysmoISIM-SJA5",
+			atr:       "3B9F96801F878031E073FE211B674A357530350265F8",
+			protocols: []int{0, 15},
+			fi:        512, di: 32, maxBaud: 312500,
+			classes:     []string{"A (5V)", "B (3V)", "C (1.8V)"},
+			clockStop:   "State H",
+			category:    "COMPACT-TLV",
+			hbLen:       15,
+			tckRequired: true, tckValid: true, pps: true,
+		},
+		{
+			name:      "sysmoISIM-SJA2",
+			atr:       "3B9F96801F878031E073FE211B674A4C753034054BA9",
+			protocols: []int{0, 15},
+			fi:        512, di: 32, maxBaud: 312500,
+			classes:     []string{"A (5V)", "B (3V)", "C (1.8V)"},
+			clockStop:   "State H",
+			category:    "COMPACT-TLV",
+			hbLen:       15,
+			tckRequired: true, tckValid: true, pps: true,
+		},
+		{
+			name:      "sysmoUSIM-SJS1",
+			atr:       "3B9F96801FC78031A073BE21136743200718000001A5",
+			protocols: []int{0, 15},
+			fi:        512, di: 32, maxBaud: 312500,
+			classes:     []string{"A (5V)", "B (3V)", "C (1.8V)"},
+			clockStop:   "No preference",
+			category:    "COMPACT-TLV",
+			hbLen:       15,
+			tckRequired: true, tckValid: true, pps: true,
+		},
+		{
+			name:      "G+D Mobile Security 5G",
+			atr:       "3B9F96801FC78031E073F6A157574A4D020B6110005B",
+			protocols: []int{0, 15},
+			fi:        512, di: 32, maxBaud: 312500,
+			classes:     []string{"A (5V)", "B (3V)", "C (1.8V)"},
+			clockStop:   "No preference",
+			category:    "COMPACT-TLV",
+			hbLen:       15,
+			tckRequired: true, tckValid: true, pps: true,
+		},
+		{
+			name:      "NovaCard (operator card)",
+			atr:       "3B9F96803FC7008031E073FE2113676FA5021B0000012A",
+			protocols: []int{0, 15},
+			fi:        512, di: 32, maxBaud: 312500,
+			classes:     []string{"A (5V)", "B (3V)", "C (1.8V)"},
+			clockStop:   "No preference",
+			category:    "COMPACT-TLV",
+			hbLen:       15,
+			tckRequired: true, tckValid: true, pps: true,
+		},
+		{
+			name:      "OX24 / RuSIM",
+			atr:       "3B959640F00F050A0F0A",
+			protocols: []int{0},
+			fi:        512, di: 32, maxBaud: 312500,
+			category: "Proprietary",
+			hbLen:    5,
+			pps:      true,
+		},
+		{
+			name:      "sysmoSIM-GR1 (Grcard)",
+			atr:       "3B991800118822334455667760",
+			protocols: []int{0},
+			fi:        372, di: 12, maxBaud: 161290,
+			category: "Proprietary",
+			hbLen:    9,
+			pps:      true,
+		},
+		{
+			name: "sysmoSIM-GR2 (Grcard)",
+			atr:  "3B7D9400005555530A7486930B247C4D5468",
+			fi:   512, di: 8, maxBaud: 78125,
+			category: "Proprietary",
+			hbLen:    13,
+			pps:      true,
+		},
+		{
+			name:      "Grcard v2 (no TCK captured)",
+			atr:       "3B9F95801FC78031A073B6A10067CF3211B252C679",
+			protocols: []int{0, 15},
+			fi:        512, di: 16, maxBaud: 156250,
+			classes:     []string{"A (5V)", "B (3V)", "C (1.8V)"},
+			clockStop:   "No preference",
+			category:    "COMPACT-TLV",
+			hbLen:       15,
+			tckRequired: true, tckValid: false, pps: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := ParseATR(mustHex(t, tc.atr))
+			if err != nil {
+				t.Fatalf("ParseATR() error = %v", err)
+			}
+			if !reflect.DeepEqual(info.Protocols, tc.protocols) {
+				t.Errorf("Protocols = %v, want %v", info.Protocols, tc.protocols)
+			}
+			if info.Fi != tc.fi || info.Di != tc.di {
+				t.Errorf("Fi/Di = %d/%d, want %d/%d", info.Fi, info.Di, tc.fi, tc.di)
+			}
+			if info.MaxBaud != tc.maxBaud {
+				t.Errorf("MaxBaud = %d, want %d", info.MaxBaud, tc.maxBaud)
+			}
+			if !reflect.DeepEqual(info.Classes, tc.classes) {
+				t.Errorf("Classes = %v, want %v", info.Classes, tc.classes)
+			}
+			if info.ClockStop != tc.clockStop {
+				t.Errorf("ClockStop = %q, want %q", info.ClockStop, tc.clockStop)
+			}
+			if info.HistoricalCategory != tc.category {
+				t.Errorf("HistoricalCategory = %q, want %q", info.HistoricalCategory, tc.category)
+			}
+			if len(info.HB) != tc.hbLen {
+				t.Errorf("len(HB) = %d, want %d", len(info.HB), tc.hbLen)
+			}
+			if info.TCKRequired != tc.tckRequired || info.TCKValid != tc.tckValid {
+				t.Errorf("TCK required/valid = %v/%v, want %v/%v", info.TCKRequired, info.TCKValid, tc.tckRequired, tc.tckValid)
+			}
+			if info.PPSCapable() != tc.pps {
+				t.Errorf("PPSCapable() = %v, want %v", info.PPSCapable(), tc.pps)
+			}
+			if info.DefaultBaud != 9600 {
+				t.Errorf("DefaultBaud = %d, want 9600", info.DefaultBaud)
+			}
+		})
+	}
+}
+
+func TestParseATR_HistoricalObjects(t *testing.T) {
+	info, err := ParseATR(mustHex(t, "3B9F96801F878031E073FE211B674A357530350265F8"))
+	if err != nil {
+		t.Fatalf("ParseATR() error = %v", err)
+	}
+
+	want := []ATRHistObject{
+		{Tag: 0x3, Name: "Card service data", Value: []byte{0xE0}},
+		{Tag: 0x7, Name: "Card capabilities", Value: []byte{0xFE, 0x21, 0x1B}},
+		{Tag: 0x6, Name: "Pre-issuing data", Value: []byte{0x4A, 0x35, 0x75, 0x30, 0x35, 0x02, 0x65}},
+	}
+	if !reflect.DeepEqual(info.HistoricalObjects, want) {
+		t.Errorf("HistoricalObjects = %+v, want %+v", info.HistoricalObjects, want)
+	}
+	if got := info.InterfaceBytes(); got != "TA1=96 TD1=80 TD2=1F TA3=87" {
+		t.Errorf("InterfaceBytes() = %q", got)
+	}
+}
+
+func TestParseATR_InterfaceParameters(t *testing.T) {
+	tests := []struct {
+		name  string
+		atr   string
+		check func(t *testing.T, info *ATRInfo)
+	}{
+		{
+			name: "T=0 waiting integer (TC2)",
+			atr:  "3B959640F00F050A0F0A",
+			check: func(t *testing.T, info *ATRInfo) {
+				if info.WaitingInteger != 0xF0 {
+					t.Errorf("WaitingInteger = %d, want 240", info.WaitingInteger)
+				}
+			},
+		},
+		{
+			name: "Specific mode (TA2) blocks PPS",
+			atr:  "3B9513918131FE4531C06477E31D",
+			check: func(t *testing.T, info *ATRInfo) {
+				if !info.SpecificMode || info.SpecificProtocol != 1 {
+					t.Errorf("SpecificMode = %v T=%d, want true T=1", info.SpecificMode, info.SpecificProtocol)
+				}
+				if info.ModeChangeable {
+					t.Errorf("ModeChangeable = true, want false")
+				}
+				if info.PPSCapable() {
+					t.Errorf("PPSCapable() = true in fixed specific mode")
+				}
+			},
+		},
+		{
+			name: "T=1 parameters and extra guard time",
+			atr:  "3BD518FF8191FE1FC38073C821100A",
+			check: func(t *testing.T, info *ATRInfo) {
+				if info.ExtraGuardTime != 255 {
+					t.Errorf("ExtraGuardTime = %d, want 255", info.ExtraGuardTime)
+				}
+				if info.IFSC != 0xFE || info.BWI != 4 || info.CWI != 13 {
+					t.Errorf("T=1 IFSC/BWI/CWI = %d/%d/%d, want 254/4/13", info.IFSC, info.BWI, info.CWI)
+				}
+			},
+		},
+		{
+			name: "Default parameters (no TA1)",
+			atr:  "3B00",
+			check: func(t *testing.T, info *ATRInfo) {
+				if info.MaxBaud != 13440 || info.BaudAtDefault != 9600 {
+					t.Errorf("MaxBaud/BaudAtDefault = %d/%d, want 13440/9600", info.MaxBaud, info.BaudAtDefault)
+				}
+				if info.PPSCapable() {
+					t.Errorf("PPSCapable() = true without TA1")
+				}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := ParseATR(mustHex(t, tc.atr))
+			if err != nil {
+				t.Fatalf("ParseATR() error = %v", err)
+			}
+			tc.check(t, info)
+		})
+	}
+}
+
+func TestParseATR_InvalidTCK(t *testing.T) {
+	// SJA5 ATR with corrupted TCK
+	info, err := ParseATR(mustHex(t, "3B9F96801F878031E073FE211B674A357530350265F9"))
+	if err != nil {
+		t.Fatalf("ParseATR() error = %v", err)
+	}
+	if info.TCKValid {
+		t.Errorf("TCKValid = true for corrupted checksum")
+	}
+	if got := info.TCKStatus(); got != "F9 (INVALID)" {
+		t.Errorf("TCKStatus() = %q", got)
+	}
+}
+
+func TestParseATR_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		atr  string
+	}{
+		{"Empty", ""},
+		{"Single byte", "3B"},
+		{"Bad TS", "3A00"},
+		{"Truncated interface bytes", "3B9F96"},
+		{"Truncated historical bytes", "3B9F96801F878031E073"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseATR(mustHex(t, tc.atr)); err == nil {
+				t.Errorf("ParseATR(%s) should return error", tc.atr)
+			}
+		})
+	}
+}
+
+// ============ ATR PATTERN TESTS ============
+
+func TestATRPattern(t *testing.T) {
+	atr := mustHex(t, "3B9F96801FC78031E073FE211B633A204E8300900031")
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"3B 9F 96 80 1F C7 80 31 E0 73 FE 21 1B 63 3A 20 4E 83 00 90 00 31", true},
+		{"3b:9f:96:80:1f:c7:80:31:e0:73:fe:21:1b:63:3a:20:4e:83:00:90:00:31", true},
+		{"3B 9F 96 80 1F .. 80 31 E0 73 FE 21 1B 63 3A 20 4E 83 00 90 00 ..", true},
+		{"3B 9F 9X 80 1F C7 80 31 E0 73 FE 21 1B 63 3A 20 4E 83 00 90 00 XX", true},
+		{"3B 9F 95 80 1F .. 80 31 E0 73 FE 21 1B 63 3A 20 4E 83 00 90 00 ..", false},
+		{"3B 9F 96 80 1F C7 80 31 E0 73", false}, // the pattern must cover the whole ATR
+	}
+
+	for _, tc := range tests {
+		p, err := ParseATRPattern(tc.pattern)
+		if err != nil {
+			t.Fatalf("ParseATRPattern(%q) error = %v", tc.pattern, err)
+		}
+		if got := p.Match(atr); got != tc.want {
+			t.Errorf("%q Match() = %v, want %v", tc.pattern, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "3B 9", "3B GG", "3B *"} {
+		if _, err := ParseATRPattern(bad); err == nil {
+			t.Errorf("ParseATRPattern(%q) should return error", bad)
+		}
+	}
+}
@@ -3,14 +3,16 @@ package card
 import (
 	"encoding/hex"
 	"fmt"
-	"regexp"
 	"strings"
+
+	"sim_reader/inputs"
 )
 
 // PIN types for VERIFY command
 const (
 	PIN_CHV1      = 0x01 // PIN1 (CHV1)
 	PIN_CHV2      = 0x02 // PIN2 (CHV2)
+	PIN_PIN2      = 0x81 // PIN2 (USIM local PIN, TS 102 221)
 	PIN_ADM1      = 0x0A // ADM1 (Administrative PIN 1)
 	PIN_ADM2      = 0x0B // ADM2 (Administrative PIN 2)
 	PIN_ADM3      = 0x0C // ADM3
@@ -23,41 +25,7 @@ const (
 // - Hex format (16 chars): "F38A3DECF6C7D239"
 // - Decimal format (8 digits): "77111606" -> ASCII bytes "77111606"
 func ParseADMKey(keyStr string) ([]byte, error) {
-	keyStr = strings.TrimSpace(keyStr)
-
-	// Check if it's a hex string (16 hex characters = 8 bytes)
-	if len(keyStr) == 16 && isHexString(keyStr) {
-		return hex.DecodeString(keyStr)
-	}
-
-	// Check if it's a decimal PIN (8 digits) - convert to ASCII
-	if len(keyStr) == 8 && isDecimalString(keyStr) {
-		return []byte(keyStr), nil
-	}
-
-	// Try to decode as hex anyway for other lengths
-	if isHexString(keyStr) && len(keyStr)%2 == 0 {
-		return hex.DecodeString(keyStr)
-	}
-
-	// Otherwise treat as ASCII
-	if len(keyStr) <= 8 {
-		return []byte(keyStr), nil
-	}
-
-	return nil, fmt.Errorf("invalid ADM key format: '%s' (expected 16 hex chars or 8 digit decimal)", keyStr)
-}
-
-// isHexString checks if string contains only hex characters
-func isHexString(s string) bool {
-	matched, _ := regexp.MatchString("^[0-9A-Fa-f]+$", s)
-	return matched
-}
-
-// isDecimalString checks if string contains only decimal digits
-func isDecimalString(s string) bool {
-	matched, _ := regexp.MatchString("^[0-9]+$", s)
-	return matched
+	return inputs.ADMKey("ADM key", keyStr)
 }
 
 // VerifyADM1 authenticates with ADM1 key
@@ -73,7 +41,7 @@ func (r *Reader) VerifyADM1(key []byte) error {
 			attempts := resp.SW2 & 0x0F
 			return fmt.Errorf("ADM1 verification failed: wrong key, %d attempts remaining", attempts)
 		}
-		return fmt.Errorf("ADM1 verification failed: %s (SW=%04X)", SWToString(sw), sw)
+		return fmt.Errorf("ADM1 verification failed: %s (SW=%04X)", resp.SWString(), sw)
 	}
 
 	return nil
@@ -92,7 +60,7 @@ func (r *Reader) VerifyADM2(key []byte) error {
 			attempts := resp.SW2 & 0x0F
 			return fmt.Errorf("ADM2 verification failed: wrong key, %d attempts remaining", attempts)
 		}
-		return fmt.Errorf("ADM2 verification failed: %s (SW=%04X)", SWToString(sw), sw)
+		return fmt.Errorf("ADM2 verification failed: %s (SW=%04X)", resp.SWString(), sw)
 	}
 
 	return nil
@@ -111,7 +79,7 @@ func (r *Reader) VerifyADM3(key []byte) error {
 			attempts := resp.SW2 & 0x0F
 			return fmt.Errorf("ADM3 verification failed: wrong key, %d attempts remaining", attempts)
 		}
-		return fmt.Errorf("ADM3 verification failed: %s (SW=%04X)", SWToString(sw), sw)
+		return fmt.Errorf("ADM3 verification failed: %s (SW=%04X)", resp.SWString(), sw)
 	}
 
 	return nil
@@ -130,26 +98,134 @@ func (r *Reader) VerifyADM4(key []byte) error {
 			attempts := resp.SW2 & 0x0F
 			return fmt.Errorf("ADM4 verification failed: wrong key, %d attempts remaining", attempts)
 		}
-		return fmt.Errorf("ADM4 verification failed: %s (SW=%04X)", SWToString(sw), sw)
+		return fmt.Errorf("ADM4 verification failed: %s (SW=%04X)", resp.SWString(), sw)
+	}
+
+	return nil
+}
+
+// PinError is a PIN verification rejected by the card (SW 63Cx or 6983), or refused
+// before sending because a wrong PIN would block it
+type PinError struct {
+	PIN       string // PIN1, PIN2
+	Remaining int    // attempts left (0 = blocked)
+	Refused   bool   // not sent: only one attempt was left
+}
+
+func (e *PinError) Error() string {
+	switch {
+	case e.Refused:
+		return fmt.Sprintf("%s has 1 attempt remaining, not verifying without force (a wrong PIN blocks it)", e.PIN)
+	case e.Remaining == 0:
+		return fmt.Sprintf("%s is blocked, unblock it with the PUK", e.PIN)
+	case e.Remaining == 1:
+		return fmt.Sprintf("wrong %s, 1 attempt remaining", e.PIN)
+	default:
+		return fmt.Sprintf("wrong %s, %d attempts remaining", e.PIN, e.Remaining)
 	}
+}
 
+// pinError decodes a rejected VERIFY response into a *PinError (nil for other status words)
+func pinError(name string, resp *APDUResponse) *PinError {
+	switch {
+	case resp.SW1 == 0x63 && (resp.SW2&0xF0) == 0xC0:
+		return &PinError{PIN: name, Remaining: int(resp.SW2 & 0x0F)}
+	case resp.SW() == SW_AUTH_FAILED:
+		return &PinError{PIN: name}
+	}
 	return nil
 }
 
-// VerifyPIN1 verifies PIN1 (CHV1)
+// VerifyPIN1 verifies PIN1 (CHV1). A wrong or blocked PIN returns a *PinError with the
+// remaining attempts. If the card reports a single attempt left the PIN is not sent,
+// since a wrong one would block the card; VerifyPIN1Force sends it anyway.
 func (r *Reader) VerifyPIN1(pin string) error {
+	return r.verifyPIN1(pin, false)
+}
+
+// VerifyPIN1Force verifies PIN1 even if only one attempt is left
+func (r *Reader) VerifyPIN1Force(pin string) error {
+	return r.verifyPIN1(pin, true)
+}
+
+func (r *Reader) verifyPIN1(pin string, force bool) error {
+	defer r.Measure("PIN1 verify")()
+	if !force {
+		if status := r.CheckADM(PIN_CHV1); status.Exists && !status.Blocked && status.Attempts == 1 {
+			return &PinError{PIN: "PIN1", Remaining: 1, Refused: true}
+		}
+	}
+
 	resp, err := r.VerifyPIN(PIN_CHV1, []byte(pin))
 	if err != nil {
 		return fmt.Errorf("PIN1 verification failed: %w", err)
 	}
 
 	if !resp.IsOK() {
-		sw := resp.SW()
-		if resp.SW1 == 0x63 && (resp.SW2&0xF0) == 0xC0 {
-			attempts := resp.SW2 & 0x0F
-			return fmt.Errorf("PIN1 verification failed: wrong PIN, %d attempts remaining", attempts)
+		if perr := pinError("PIN1", resp); perr != nil {
+			return perr
+		}
+		return fmt.Errorf("PIN1 verification failed: %s (SW=%04X)", resp.SWString(), resp.SW())
+	}
+
+	if r.pinCache {
+		r.cachedPIN1 = pin
+	}
+	return nil
+}
+
+// WithPINCache keeps the PIN1 accepted by VerifyPIN1 and verifies it again after every
+// Reconnect, so the security state survives a reset without the caller tracking the PIN
+func WithPINCache() ConnectOption {
+	return func(r *Reader) {
+		r.SetPINCache(true)
+	}
+}
+
+// SetPINCache enables or disables the PIN1 cache (see WithPINCache); disabling forgets the PIN
+func (r *Reader) SetPINCache(enabled bool) {
+	r.pinCache = enabled
+	if !enabled {
+		r.cachedPIN1 = ""
+	}
+}
+
+// reverifyPIN1 verifies the cached PIN1 after a reset. A rejected PIN is forgotten so a
+// changed PIN does not consume further attempts on the next reconnect.
+func (r *Reader) reverifyPIN1() error {
+	if r.cachedPIN1 == "" {
+		return nil
+	}
+	resp, err := r.VerifyPIN(PIN_CHV1, []byte(r.cachedPIN1))
+	if err != nil {
+		return fmt.Errorf("re-verify PIN1 after reconnect: %w", err)
+	}
+	if !resp.IsOK() {
+		r.cachedPIN1 = ""
+		if perr := pinError("PIN1", resp); perr != nil {
+			return fmt.Errorf("re-verify PIN1 after reconnect: %w", perr)
+		}
+		return fmt.Errorf("re-verify PIN1 after reconnect: %s (SW=%04X)", resp.SWString(), resp.SW())
+	}
+	return nil
+}
+
+// VerifyPIN2 verifies PIN2 (local PIN 81 of the selected ADF, falling back to CHV2 on
+// cards that do not know key reference 81). PIN2 protects EF_FDN, EF_ACM, EF_ACMmax, EF_PUCT.
+func (r *Reader) VerifyPIN2(pin string) error {
+	resp, err := r.VerifyPIN(PIN_PIN2, []byte(pin))
+	if err == nil && (resp.SW() == SW_DATA_NOT_FOUND || resp.SW() == SW_REF_DATA_NOT_FOUND) {
+		resp, err = r.VerifyPIN(PIN_CHV2, []byte(pin))
+	}
+	if err != nil {
+		return fmt.Errorf("PIN2 verification failed: %w", err)
+	}
+
+	if !resp.IsOK() {
+		if perr := pinError("PIN2", resp); perr != nil {
+			return perr
 		}
-		return fmt.Errorf("PIN1 verification failed: %s (SW=%04X)", SWToString(sw), sw)
+		return fmt.Errorf("PIN2 verification failed: %s (SW=%04X)", resp.SWString(), resp.SW())
 	}
 
 	return nil
@@ -287,7 +363,7 @@ func (r *Reader) ChangeADM(pinType byte, oldKey, newKey []byte) error {
 		if sw == 0x6983 {
 			return fmt.Errorf("change ADM failed: key is blocked")
 		}
-		return fmt.Errorf("change ADM failed: %s (SW=%04X)", SWToString(sw), sw)
+		return fmt.Errorf("change ADM failed: %s (SW=%04X)", resp.SWString(), sw)
 	}
 
 	return nil
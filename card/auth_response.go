@@ -0,0 +1,191 @@
+package card
+
+import (
+	"fmt"
+)
+
+// AuthResponseKind is the layout of the response data of AUTHENTICATE
+type AuthResponseKind string
+
+const (
+	AuthResponse3G          AuthResponseKind = "3g"           // DB: RES, CK, IK, optional Kc
+	AuthResponseSyncFailure AuthResponseKind = "sync_failure" // DC: AUTS
+	AuthResponseGBA         AuthResponseKind = "gba"          // DB: RES (GBA bootstrapping mode)
+	AuthResponseGBANAF      AuthResponseKind = "gba_naf"      // DB: Ks_ext_NAF (GBA NAF derivation mode)
+	AuthResponseGSM         AuthResponseKind = "gsm"          // SRES, Kc
+	AuthResponseUntagged    AuthResponseKind = "untagged"     // RES, CK, IK without the DB tag (older cards)
+	AuthResponseUnknown     AuthResponseKind = "unknown"      // unrecognized tag, see Unrecognized
+)
+
+// AuthResponse is the decoded response data of AUTHENTICATE (TS 31.102 7.1.2). One of
+// the typed fields is set according to Kind; data the decoder does not know is kept in
+// Unrecognized instead of being dropped.
+type AuthResponse struct {
+	Kind         AuthResponseKind
+	Success      *Auth3GSuccess    // AuthResponse3G, AuthResponseUntagged
+	SyncFailure  *AuthSyncFailure  // AuthResponseSyncFailure
+	GBA          *AuthGBABootstrap // AuthResponseGBA
+	GBANAF       *AuthGBANAF       // AuthResponseGBANAF
+	GSM          *AuthGSM          // AuthResponseGSM
+	Unrecognized []AuthUnrecognized
+}
+
+// Auth3GSuccess is a successful 3G/IMS security context. RES is 4-16 bytes (Milenage) or
+// up to 32 (TUAK); CK and IK are 16 or 32 bytes. Kc is present if the USIM supports
+// GSM access (UST service 27).
+type Auth3GSuccess struct {
+	RES, CK, IK, Kc []byte
+}
+
+// AuthSyncFailure is a synchronization failure; AUTS is 14, 22 or 38 bytes by MAC-S length
+type AuthSyncFailure struct {
+	AUTS []byte
+}
+
+// AuthGBABootstrap is a successful GBA bootstrapping: the card keeps Ks = CK||IK and only
+// returns RES
+type AuthGBABootstrap struct {
+	RES []byte
+}
+
+// AuthGBANAF is a GBA NAF derivation: the key derived for the NAF
+type AuthGBANAF struct {
+	KsExtNAF []byte
+}
+
+// AuthGSM is a GSM security context (2G triplet part)
+type AuthGSM struct {
+	SRES, Kc []byte
+}
+
+// AuthUnrecognized is response data the decoder could not assign to a field
+type AuthUnrecognized struct {
+	Offset int
+	Tag    byte // first byte at Offset
+	Data   []byte
+}
+
+// String returns a hex dump for logs and JSON output
+func (u AuthUnrecognized) String() string {
+	return fmt.Sprintf("tag %02X at offset %d: %X", u.Tag, u.Offset, u.Data)
+}
+
+// DecodeAuthResponse decodes the response data of AUTHENTICATE sent with the given context
+// (AUTH_CONTEXT_*). A length field pointing beyond the data is an error; bytes left after
+// the last field and unknown tags are returned in Unrecognized.
+func DecodeAuthResponse(context byte, data []byte) (*AuthResponse, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty response data")
+	}
+	resp := &AuthResponse{}
+	off := 0
+
+	if context == AUTH_CONTEXT_GSM {
+		// USIM: len SRES || SRES || len Kc || Kc; SIM: SRES || Kc
+		resp.Kind, resp.GSM = AuthResponseGSM, &AuthGSM{}
+		if len(data) >= 14 && data[0] == 4 && data[5] == 8 {
+			resp.GSM.SRES, _ = readAuthLV(data, &off, "SRES")
+			resp.GSM.Kc, _ = readAuthLV(data, &off, "Kc")
+		} else {
+			if len(data) < 12 {
+				return resp, fmt.Errorf("GSM response too short: %d bytes", len(data))
+			}
+			resp.GSM.SRES, resp.GSM.Kc = append([]byte(nil), data[:4]...), append([]byte(nil), data[4:12]...)
+			off = 12
+		}
+		resp.trailing(data, off)
+		return resp, nil
+	}
+
+	var err error
+	switch tag := data[0]; {
+	case tag == 0xDC:
+		off = 1
+		resp.Kind, resp.SyncFailure = AuthResponseSyncFailure, &AuthSyncFailure{}
+		if resp.SyncFailure.AUTS, err = readAuthLV(data, &off, "AUTS"); err != nil {
+			return resp, err
+		}
+
+	case tag == 0xDB && context == AUTH_CONTEXT_GBA:
+		off = 1
+		resp.Kind, resp.GBA = AuthResponseGBA, &AuthGBABootstrap{}
+		if resp.GBA.RES, err = readAuthLV(data, &off, "RES"); err != nil {
+			return resp, err
+		}
+
+	case tag == 0xDB && context == AUTH_CONTEXT_GBA_NAF:
+		off = 1
+		resp.Kind, resp.GBANAF = AuthResponseGBANAF, &AuthGBANAF{}
+		if resp.GBANAF.KsExtNAF, err = readAuthLV(data, &off, "Ks_ext_NAF"); err != nil {
+			return resp, err
+		}
+
+	case tag == 0xDB:
+		off = 1
+		resp.Kind = AuthResponse3G
+		if resp.Success, err = readAuth3G(data, &off); err != nil {
+			return resp, err
+		}
+		// Kc follows IK when the USIM supports GSM access
+		if off < len(data) && data[off] == 8 && off+9 <= len(data) {
+			resp.Success.Kc, _ = readAuthLV(data, &off, "Kc")
+		}
+
+	case context == AUTH_CONTEXT_3G:
+		// Some cards omit the DB tag: len RES || RES || len CK || CK || len IK || IK
+		if s, err := readAuth3G(data, &off); err == nil && isAuthKeyLength(len(s.CK)) && isAuthKeyLength(len(s.IK)) {
+			resp.Kind, resp.Success = AuthResponseUntagged, s
+			break
+		}
+		off = 0
+		resp.Kind = AuthResponseUnknown
+
+	default:
+		resp.Kind = AuthResponseUnknown
+	}
+
+	resp.trailing(data, off)
+	return resp, nil
+}
+
+// trailing records the data from off on as unrecognized
+func (resp *AuthResponse) trailing(data []byte, off int) {
+	if off < len(data) {
+		resp.Unrecognized = append(resp.Unrecognized, AuthUnrecognized{Offset: off, Tag: data[off], Data: append([]byte(nil), data[off:]...)})
+	}
+}
+
+// readAuth3G reads RES, CK and IK as length-value fields
+func readAuth3G(data []byte, off *int) (*Auth3GSuccess, error) {
+	s := &Auth3GSuccess{}
+	var err error
+	if s.RES, err = readAuthLV(data, off, "RES"); err != nil {
+		return s, err
+	}
+	if s.CK, err = readAuthLV(data, off, "CK"); err != nil {
+		return s, err
+	}
+	if s.IK, err = readAuthLV(data, off, "IK"); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// readAuthLV reads a one-byte length and the value that follows
+func readAuthLV(data []byte, off *int, name string) ([]byte, error) {
+	if *off >= len(data) {
+		return nil, fmt.Errorf("missing %s length at offset %d", name, *off)
+	}
+	n := int(data[*off])
+	if *off+1+n > len(data) {
+		return nil, fmt.Errorf("%s length %d at offset %d exceeds the %d bytes of response data", name, n, *off, len(data))
+	}
+	value := append([]byte(nil), data[*off+1:*off+1+n]...)
+	*off += 1 + n
+	return value, nil
+}
+
+// isAuthKeyLength reports a CK/IK length: 128 or 256 bits
+func isAuthKeyLength(n int) bool {
+	return n == 16 || n == 32
+}
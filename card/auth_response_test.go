@@ -0,0 +1,81 @@
+package card
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// ============ AUTHENTICATE RESPONSE TESTS ============
+
+func TestDecodeAuthResponse(t *testing.T) {
+	res := bytes.Repeat([]byte{0x11}, 8)
+	ck16, ik16 := bytes.Repeat([]byte{0x22}, 16), bytes.Repeat([]byte{0x33}, 16)
+	ck32, ik32 := bytes.Repeat([]byte{0x22}, 32), bytes.Repeat([]byte{0x33}, 32)
+	kc := bytes.Repeat([]byte{0x44}, 8)
+	auts := bytes.Repeat([]byte{0x55}, 14)
+	lv := func(b []byte) []byte { return append([]byte{byte(len(b))}, b...) }
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name         string
+		context      byte
+		data         []byte
+		kind         AuthResponseKind
+		res, ck, kc  []byte
+		auts         []byte
+		unrecognized string
+		wantErr      bool
+	}{
+		{"3G success", AUTH_CONTEXT_3G, join([]byte{0xDB}, lv(res), lv(ck16), lv(ik16)), AuthResponse3G, res, ck16, nil, nil, "", false},
+		{"3G success with Kc", AUTH_CONTEXT_3G, join([]byte{0xDB}, lv(res), lv(ck16), lv(ik16), lv(kc)), AuthResponse3G, res, ck16, kc, nil, "", false},
+		{"TUAK 256-bit CK/IK", AUTH_CONTEXT_3G, join([]byte{0xDB}, lv(res), lv(ck32), lv(ik32)), AuthResponse3G, res, ck32, nil, nil, "", false},
+		{"Sync failure", AUTH_CONTEXT_3G, join([]byte{0xDC}, lv(auts)), AuthResponseSyncFailure, nil, nil, nil, auts, "", false},
+		{"Sync failure 256-bit MAC-S", AUTH_CONTEXT_3G, join([]byte{0xDC}, lv(bytes.Repeat([]byte{0x55}, 38))), AuthResponseSyncFailure, nil, nil, nil, bytes.Repeat([]byte{0x55}, 38), "", false},
+		{"GBA bootstrapping", AUTH_CONTEXT_GBA, join([]byte{0xDB}, lv(res)), AuthResponseGBA, res, nil, nil, nil, "", false},
+		{"GBA sync failure", AUTH_CONTEXT_GBA, join([]byte{0xDC}, lv(auts)), AuthResponseSyncFailure, nil, nil, nil, auts, "", false},
+		{"Untagged 3G", AUTH_CONTEXT_3G, join(lv(res), lv(ck16), lv(ik16)), AuthResponseUntagged, res, ck16, nil, nil, "", false},
+		{"GSM with lengths", AUTH_CONTEXT_GSM, join(lv(res[:4]), lv(kc)), AuthResponseGSM, res[:4], nil, kc, nil, "", false},
+		{"GSM raw", AUTH_CONTEXT_GSM, join(res[:4], kc), AuthResponseGSM, res[:4], nil, kc, nil, "", false},
+		{"Trailing data", AUTH_CONTEXT_3G, join([]byte{0xDB}, lv(res), lv(ck16), lv(ik16), []byte{0xDE, 0x02, 0xAB, 0xCD}), AuthResponse3G, res, ck16, nil, nil, "tag DE at offset 44: DE02ABCD", false},
+		{"Unknown tag", AUTH_CONTEXT_GBA, []byte{0xDE, 0x01, 0x02}, AuthResponseUnknown, nil, nil, nil, nil, "tag DE at offset 0: DE0102", false},
+		{"RES overflow", AUTH_CONTEXT_3G, []byte{0xDB, 0x08, 0x11, 0x11}, AuthResponse3G, nil, nil, nil, nil, "", true},
+		{"Empty", AUTH_CONTEXT_3G, nil, "", nil, nil, nil, nil, "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := DecodeAuthResponse(tc.context, tc.data)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("DecodeAuthResponse() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Kind != tc.kind {
+				t.Fatalf("Kind = %q, want %q", got.Kind, tc.kind)
+			}
+			var res, ck, kc, auts []byte
+			switch got.Kind {
+			case AuthResponse3G, AuthResponseUntagged:
+				res, ck, kc = got.Success.RES, got.Success.CK, got.Success.Kc
+			case AuthResponseGBA:
+				res = got.GBA.RES
+			case AuthResponseGSM:
+				res, kc = got.GSM.SRES, got.GSM.Kc
+			case AuthResponseSyncFailure:
+				auts = got.SyncFailure.AUTS
+			}
+			if !bytes.Equal(res, tc.res) || !bytes.Equal(ck, tc.ck) || !bytes.Equal(kc, tc.kc) || !bytes.Equal(auts, tc.auts) {
+				t.Errorf("RES/CK/Kc/AUTS = %X/%X/%X/%X, want %X/%X/%X/%X", res, ck, kc, auts, tc.res, tc.ck, tc.kc, tc.auts)
+			}
+			var dumps []string
+			for _, u := range got.Unrecognized {
+				dumps = append(dumps, u.String())
+			}
+			if strings.Join(dumps, "; ") != tc.unrecognized {
+				t.Errorf("Unrecognized = %q, want %q", dumps, tc.unrecognized)
+			}
+		})
+	}
+}
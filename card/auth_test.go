@@ -0,0 +1,116 @@
+package card
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// ============ PIN VERIFICATION TESTS ============
+
+func TestVerifyPIN1_AttemptProgression(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.Keys[PIN_CHV1] = []byte("1234")
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+
+	verifies := func() int {
+		n := 0
+		for _, apdu := range m.Log {
+			if apdu[1] == INS_VERIFY && len(apdu) > 5 {
+				n++
+			}
+		}
+		return n
+	}
+
+	// 63C2: wrong PIN, two attempts left
+	err := r.VerifyPIN1("0000")
+	var perr *PinError
+	if !errors.As(err, &perr) || perr.Remaining != 2 || perr.Refused {
+		t.Fatalf("first wrong PIN: error = %v, want PinError{Remaining: 2}", err)
+	}
+	if !strings.Contains(err.Error(), "wrong PIN1, 2 attempts remaining") {
+		t.Errorf("message = %q", err.Error())
+	}
+
+	// 63C1: wrong PIN, one attempt left
+	err = r.VerifyPIN1("0000")
+	if !errors.As(err, &perr) || perr.Remaining != 1 || perr.Refused {
+		t.Fatalf("second wrong PIN: error = %v, want PinError{Remaining: 1}", err)
+	}
+
+	// Refused without force: the PIN is not sent
+	sent := verifies()
+	err = r.VerifyPIN1("1234")
+	if !errors.As(err, &perr) || !perr.Refused || perr.Remaining != 1 {
+		t.Fatalf("last attempt: error = %v, want a refused PinError", err)
+	}
+	if verifies() != sent {
+		t.Errorf("VERIFY with PIN data sent on the last attempt without force")
+	}
+
+	// Forced wrong PIN blocks the card, then 6983
+	err = r.VerifyPIN1Force("0000")
+	if !errors.As(err, &perr) || perr.Remaining != 0 {
+		t.Fatalf("forced wrong PIN: error = %v, want PinError{Remaining: 0}", err)
+	}
+	err = r.VerifyPIN1Force("1234")
+	if !errors.As(err, &perr) || perr.Remaining != 0 || !strings.Contains(err.Error(), "blocked") {
+		t.Fatalf("blocked PIN: error = %v, want blocked PinError", err)
+	}
+}
+
+func TestVerifyPIN1_CorrectPIN(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.Keys[PIN_CHV1] = []byte("1234")
+	m.Retries[PIN_CHV1] = 1
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+
+	if err := r.VerifyPIN1Force("1234"); err != nil {
+		t.Fatalf("VerifyPIN1Force() error = %v", err)
+	}
+	if !m.verified[PIN_CHV1] {
+		t.Errorf("PIN1 not verified on the card")
+	}
+}
+
+func TestVerifyPIN1_CacheAfterReconnect(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.Keys[PIN_CHV1] = []byte("1234")
+
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	if err := r.VerifyPIN1("1234"); err != nil {
+		t.Fatalf("VerifyPIN1() error = %v", err)
+	}
+	if _, err := r.Reconnect(false); err != nil {
+		t.Fatalf("Reconnect() error = %v", err)
+	}
+	if m.verified[PIN_CHV1] {
+		t.Fatalf("PIN1 re-verified without WithPINCache")
+	}
+
+	r = NewReaderWithTransport("Mock", m.ATR, m, WithPINCache())
+	if err := r.VerifyPIN1("1234"); err != nil {
+		t.Fatalf("VerifyPIN1() error = %v", err)
+	}
+	if _, err := r.Reconnect(false); err != nil {
+		t.Fatalf("Reconnect() error = %v", err)
+	}
+	if !m.verified[PIN_CHV1] {
+		t.Errorf("cached PIN1 not re-verified after Reconnect")
+	}
+
+	// A PIN changed behind the reader's back is rejected once and then forgotten
+	m.Keys[PIN_CHV1] = []byte("5678")
+	_, err := r.Reconnect(false)
+	var perr *PinError
+	if !errors.As(err, &perr) || perr.Remaining != 2 {
+		t.Fatalf("Reconnect() with a stale PIN: error = %v, want PinError{Remaining: 2}", err)
+	}
+	if _, err := r.Reconnect(false); err != nil {
+		t.Errorf("second Reconnect() error = %v, want the rejected PIN forgotten", err)
+	}
+	if m.tries[PIN_CHV1] != 2 {
+		t.Errorf("PIN1 tries = %d, want 2", m.tries[PIN_CHV1])
+	}
+}
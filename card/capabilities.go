@@ -0,0 +1,277 @@
+package card
+
+import (
+	"fmt"
+	"strings"
+)
+
+// File IDs used for capability detection
+const (
+	FID_EF_ATR  = 0x2F01 // EF.ATR/INFO (ISO 7816-4), extended length information
+	FID_EF_UMPC = 0x2F08 // EF_UMPC (ETSI TS 102 221), UICC maximum power consumption
+)
+
+// Short APDU limits (ISO 7816-4)
+const (
+	ShortMaxCommandData  = 255
+	ShortMaxResponseData = 256
+)
+
+// defaultGPBlockSize is the LOAD/STORE DATA block size used when the card advertises nothing
+const defaultGPBlockSize = 200
+
+// gpBlockOverhead is reserved in each GP block for the C-MAC and C-ENC padding
+const gpBlockOverhead = 16
+
+// CardCapabilities describes what the card advertises about logical channels and buffer sizes.
+// Values come from the card capabilities object in the ATR historical bytes (ISO 7816-4 tag 7),
+// EF.ATR/INFO extended length information (tag 7F66) and EF_UMPC (TS 102 221).
+type CardCapabilities struct {
+	LogicalChannels  int  // Logical channels including the basic channel (1 = basic only)
+	ChannelsByCard   bool // Logical channel numbers are assigned by the card (MANAGE CHANNEL open)
+	CommandChaining  bool // Command chaining supported
+	ExtendedLength   bool // Extended Lc/Le fields supported
+	ExtendedInfoInEF bool // Extended length information present in EF.ATR/INFO
+	MaxCommandData   int  // Maximum command data field (Lc) in bytes
+	MaxResponseData  int  // Maximum response data field (Le) in bytes
+
+	UMPC *UMPCInfo // EF_UMPC content (nil if absent)
+
+	Sources    []string // Where the values came from (ATR, EF.ATR, EF_UMPC)
+	Overridden bool     // Sizes were limited with SetMaxAPDUSize
+}
+
+// UMPCInfo is the decoded content of EF_UMPC (ETSI TS 102 221 13.5)
+type UMPCInfo struct {
+	MaxPowerMA    int  // UICC maximum power consumption (mA)
+	TimeReference int  // Operator defined time reference
+	Conditions    byte // Additional UICC environmental conditions
+	Raw           []byte
+}
+
+// DefaultCapabilities returns the conservative short-APDU profile assumed for any card
+func DefaultCapabilities() *CardCapabilities {
+	return &CardCapabilities{
+		LogicalChannels: 1,
+		MaxCommandData:  ShortMaxCommandData,
+		MaxResponseData: ShortMaxResponseData,
+	}
+}
+
+// ParseATRCapabilities derives capabilities from the card capabilities object (tag 7)
+// in the ATR historical bytes. Third software function byte (ISO 7816-4 Table 119):
+// b8 command chaining, b7 extended Lc/Le, b6 extended length info in EF.ATR/INFO,
+// b5-b4 logical channel assignment, b3-b1 maximum number of logical channels.
+func ParseATRCapabilities(info *ATRInfo) *CardCapabilities {
+	caps := DefaultCapabilities()
+	if info == nil {
+		return caps
+	}
+	for _, obj := range info.HistoricalObjects {
+		if obj.Tag != 0x7 || len(obj.Value) < 3 {
+			continue
+		}
+		b := obj.Value[2]
+		caps.CommandChaining = b&0x80 != 0
+		caps.ExtendedLength = b&0x40 != 0
+		caps.ExtendedInfoInEF = b&0x20 != 0
+		caps.ChannelsByCard = b&0x10 != 0
+		if b&0x18 != 0 {
+			caps.LogicalChannels = int(b&0x07) + 1
+		}
+		caps.Sources = append(caps.Sources, "ATR")
+	}
+	return caps
+}
+
+// ParseExtendedLengthInfo extracts the maximum command and response sizes from
+// EF.ATR/INFO content (tag 7F66 containing two INTEGER objects).
+func ParseExtendedLengthInfo(data []byte) (maxCmd, maxResp int, ok bool) {
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0x7F || data[i+1] != 0x66 {
+			continue
+		}
+		length := int(data[i+2])
+		body := data[i+3:]
+		if length > len(body) {
+			return 0, 0, false
+		}
+		body = body[:length]
+		var values []int
+		for j := 0; j+1 < len(body) && len(values) < 2; {
+			tag, l := body[j], int(body[j+1])
+			if j+2+l > len(body) {
+				break
+			}
+			if tag == 0x02 {
+				v := 0
+				for _, c := range body[j+2 : j+2+l] {
+					v = v<<8 | int(c)
+				}
+				values = append(values, v)
+			}
+			j += 2 + l
+		}
+		if len(values) == 2 {
+			return values[0], values[1], true
+		}
+		return 0, 0, false
+	}
+	return 0, 0, false
+}
+
+// ParseUMPC decodes EF_UMPC content
+func ParseUMPC(data []byte) *UMPCInfo {
+	if len(data) < 3 {
+		return nil
+	}
+	return &UMPCInfo{
+		MaxPowerMA:    int(data[0]),
+		TimeReference: int(data[1]),
+		Conditions:    data[2],
+		Raw:           data,
+	}
+}
+
+// DetectCapabilities reads the ATR, EF_UMPC and (when advertised) EF.ATR/INFO and stores
+// the result on the reader. Missing files are not an error: the short-APDU defaults remain.
+func (r *Reader) DetectCapabilities() *CardCapabilities {
+	atrInfo, _ := ParseATR(r.atr)
+	caps := ParseATRCapabilities(atrInfo)
+
+	if data := r.readMFFile(FID_EF_UMPC); data != nil {
+		if umpc := ParseUMPC(data); umpc != nil {
+			caps.UMPC = umpc
+			caps.Sources = append(caps.Sources, "EF_UMPC")
+		}
+	}
+
+	if caps.ExtendedLength && caps.ExtendedInfoInEF {
+		if data := r.readMFFile(FID_EF_ATR); data != nil {
+			if maxCmd, maxResp, ok := ParseExtendedLengthInfo(data); ok {
+				caps.MaxCommandData = maxCmd
+				caps.MaxResponseData = maxResp
+				caps.Sources = append(caps.Sources, "EF.ATR")
+			}
+		}
+	}
+
+	r.caps = caps
+	return r.Capabilities()
+}
+
+// readMFFile reads a transparent EF directly under the MF, returning nil on any failure
+func (r *Reader) readMFFile(fid uint16) []byte {
+	if resp, err := r.Select([]byte{0x3F, 0x00}); err != nil || !resp.IsOK() {
+		return nil
+	}
+	resp, err := r.Select([]byte{byte(fid >> 8), byte(fid)})
+	if err != nil || !resp.IsOK() {
+		return nil
+	}
+	size := fcpFileSize(resp.Data)
+	if size <= 0 || size > ShortMaxCommandData {
+		size = ShortMaxCommandData
+	}
+	rd, err := r.ReadBinary(0, byte(size))
+	if err != nil || !rd.IsOK() || len(rd.Data) == 0 {
+		return nil
+	}
+	return rd.Data
+}
+
+// fcpFileSize returns the file size (tag 80) from an FCP template, or 0
+func fcpFileSize(fcp []byte) int {
+	f, _ := ParseFCP(fcp)
+	return f.FileSize
+}
+
+// Capabilities returns the detected capabilities with any SetMaxAPDUSize limit applied.
+// Without detection the short-APDU defaults are returned.
+func (r *Reader) Capabilities() *CardCapabilities {
+	caps := DefaultCapabilities()
+	if r.caps != nil {
+		c := *r.caps
+		caps = &c
+	}
+	if r.maxAPDUSize > 0 {
+		if caps.MaxCommandData > r.maxAPDUSize {
+			caps.MaxCommandData = r.maxAPDUSize
+		}
+		if caps.MaxResponseData > r.maxAPDUSize {
+			caps.MaxResponseData = r.maxAPDUSize
+		}
+		if r.maxAPDUSize <= ShortMaxResponseData {
+			caps.ExtendedLength = false
+		}
+		caps.Overridden = true
+	}
+	return caps
+}
+
+// SetMaxAPDUSize limits command and response data sizes for cards that advertise
+// more than they deliver (0 removes the limit)
+func (r *Reader) SetMaxAPDUSize(n int) {
+	r.maxAPDUSize = n
+}
+
+// readChunkSize returns the READ BINARY chunk size and whether extended Le is used
+func (r *Reader) readChunkSize() (int, bool) {
+	caps := r.Capabilities()
+	if caps.ExtendedLength && caps.MaxResponseData > ShortMaxResponseData {
+		if caps.MaxResponseData > 65535 {
+			return 65535, true
+		}
+		return caps.MaxResponseData, true
+	}
+	if caps.MaxResponseData < 255 {
+		return caps.MaxResponseData, false
+	}
+	return 255, false
+}
+
+// writeChunkSize returns the UPDATE BINARY chunk size for short APDUs
+func (r *Reader) writeChunkSize() int {
+	if n := r.Capabilities().MaxCommandData; n > 0 && n < ShortMaxCommandData {
+		return n
+	}
+	return ShortMaxCommandData
+}
+
+// GPBlockSize returns the LOAD / STORE DATA block size to use for this card.
+// Without advertised sizes or an override the historical default of 200 bytes is kept.
+func (c *CardCapabilities) GPBlockSize() int {
+	if !hasSource(c.Sources, "EF.ATR") && !c.Overridden {
+		return defaultGPBlockSize
+	}
+	data := c.MaxCommandData
+	if data > ShortMaxCommandData {
+		data = ShortMaxCommandData // LOAD and STORE DATA are sent as short APDUs
+	}
+	if data-gpBlockOverhead < 16 {
+		return 16
+	}
+	return data - gpBlockOverhead
+}
+
+func hasSource(sources []string, s string) bool {
+	for _, src := range sources {
+		if src == s {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a one-line summary of the capabilities
+func (c *CardCapabilities) String() string {
+	var parts []string
+	parts = append(parts, fmt.Sprintf("%d logical channel(s)", c.LogicalChannels))
+	if c.ExtendedLength {
+		parts = append(parts, "extended length")
+	} else {
+		parts = append(parts, "short APDUs")
+	}
+	parts = append(parts, fmt.Sprintf("max command %d, max response %d", c.MaxCommandData, c.MaxResponseData))
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,186 @@
+package card
+
+import (
+	"bytes"
+	"testing"
+)
+
+// ============ CARD CAPABILITIES TESTS ============
+
+func TestParseATRCapabilities(t *testing.T) {
+	tests := []struct {
+		name      string
+		atr       []byte
+		channels  int
+		extended  bool
+		chaining  bool
+		inEF      bool
+		hasSource bool
+	}{
+		{"No historical bytes", []byte{0x3B, 0x00}, 1, false, false, false, false},
+		{"Full capabilities", []byte{0x3B, 0x05, 0x80, 0x73, 0x00, 0x00, 0xF3}, 4, true, true, true, true},
+		{"Channels by interface device", []byte{0x3B, 0x05, 0x80, 0x73, 0x00, 0x00, 0x0F}, 8, false, false, false, true},
+		{"No logical channels", []byte{0x3B, 0x05, 0x80, 0x73, 0x00, 0x00, 0x40}, 1, true, false, false, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := ParseATR(tc.atr)
+			if err != nil {
+				t.Fatalf("ParseATR() error = %v", err)
+			}
+			caps := ParseATRCapabilities(info)
+			if caps.LogicalChannels != tc.channels {
+				t.Errorf("LogicalChannels = %d, want %d", caps.LogicalChannels, tc.channels)
+			}
+			if caps.ExtendedLength != tc.extended || caps.CommandChaining != tc.chaining || caps.ExtendedInfoInEF != tc.inEF {
+				t.Errorf("flags = ext %v chain %v ef %v, want %v %v %v",
+					caps.ExtendedLength, caps.CommandChaining, caps.ExtendedInfoInEF, tc.extended, tc.chaining, tc.inEF)
+			}
+			if (len(caps.Sources) > 0) != tc.hasSource {
+				t.Errorf("Sources = %v", caps.Sources)
+			}
+			if caps.MaxCommandData != ShortMaxCommandData || caps.MaxResponseData != ShortMaxResponseData {
+				t.Errorf("sizes = %d/%d, want short APDU defaults", caps.MaxCommandData, caps.MaxResponseData)
+			}
+		})
+	}
+}
+
+func TestParseExtendedLengthInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		cmd, rsp int
+		ok       bool
+	}{
+		{"Two-byte integers", []byte{0x7F, 0x66, 0x08, 0x02, 0x02, 0x04, 0x00, 0x02, 0x02, 0x08, 0x00}, 1024, 2048, true},
+		{"Preceded by other data", []byte{0x47, 0x01, 0x00, 0x7F, 0x66, 0x06, 0x02, 0x01, 0xFF, 0x02, 0x01, 0xFF}, 255, 255, true},
+		{"Single integer", []byte{0x7F, 0x66, 0x03, 0x02, 0x01, 0xFF}, 0, 0, false},
+		{"Truncated", []byte{0x7F, 0x66, 0x08, 0x02}, 0, 0, false},
+		{"Absent", []byte{0xFF, 0xFF}, 0, 0, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, rsp, ok := ParseExtendedLengthInfo(tc.data)
+			if cmd != tc.cmd || rsp != tc.rsp || ok != tc.ok {
+				t.Errorf("ParseExtendedLengthInfo() = %d, %d, %v, want %d, %d, %v", cmd, rsp, ok, tc.cmd, tc.rsp, tc.ok)
+			}
+		})
+	}
+}
+
+func TestGPBlockSize(t *testing.T) {
+	tests := []struct {
+		name string
+		caps CardCapabilities
+		want int
+	}{
+		{"Defaults", *DefaultCapabilities(), 200},
+		{"ATR only", CardCapabilities{MaxCommandData: 255, Sources: []string{"ATR"}}, 200},
+		{"EF.ATR extended", CardCapabilities{MaxCommandData: 1024, Sources: []string{"ATR", "EF.ATR"}}, 239},
+		{"EF.ATR small buffer", CardCapabilities{MaxCommandData: 128, Sources: []string{"EF.ATR"}}, 112},
+		{"Override", CardCapabilities{MaxCommandData: 64, Overridden: true}, 48},
+		{"Override tiny", CardCapabilities{MaxCommandData: 8, Overridden: true}, 16},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.caps.GPBlockSize(); got != tc.want {
+				t.Errorf("GPBlockSize() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+// newCapsTestCard returns a card advertising extended length with 1024-byte buffers
+func newCapsTestCard() *MockCard {
+	m := NewMockCard([]byte{0x3B, 0x05, 0x80, 0x73, 0x00, 0x00, 0xF3})
+	m.MF().AddEF(FID_EF_ATR, []byte{0x7F, 0x66, 0x08, 0x02, 0x02, 0x04, 0x00, 0x02, 0x02, 0x04, 0x00})
+	m.MF().AddEF(FID_EF_UMPC, []byte{0x3C, 0x0A, 0x01})
+	m.MF().AddEF(0x2FE3, bytes.Repeat([]byte{0xA5}, 600))
+	return m
+}
+
+func TestDetectCapabilities(t *testing.T) {
+	m := newCapsTestCard()
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+
+	caps := r.DetectCapabilities()
+	if !caps.ExtendedLength || caps.MaxCommandData != 1024 || caps.MaxResponseData != 1024 {
+		t.Errorf("caps = %+v, want extended 1024/1024", caps)
+	}
+	if caps.UMPC == nil || caps.UMPC.MaxPowerMA != 60 || caps.UMPC.TimeReference != 10 {
+		t.Errorf("UMPC = %+v, want 60 mA / 10", caps.UMPC)
+	}
+	if got := caps.GPBlockSize(); got != 239 {
+		t.Errorf("GPBlockSize() = %d, want 239", got)
+	}
+
+	r.SetMaxAPDUSize(128)
+	caps = r.Capabilities()
+	if caps.ExtendedLength || caps.MaxResponseData != 128 || !caps.Overridden {
+		t.Errorf("overridden caps = %+v, want short 128", caps)
+	}
+}
+
+func TestReadAllBinary_Chunking(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxAPDU    int
+		wantReads  int
+		wantExtLen bool
+	}{
+		{"Extended as advertised", 0, 1, true},
+		{"Limited by override", 128, 5, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newCapsTestCard()
+			r := NewReaderWithTransport("Mock", m.ATR, m)
+			r.DetectCapabilities()
+			r.SetMaxAPDUSize(tc.maxAPDU)
+
+			r.Select([]byte{0x2F, 0xE3})
+			m.Log = nil
+			data, err := r.ReadAllBinary(600)
+			if err != nil || len(data) != 600 {
+				t.Fatalf("ReadAllBinary() = %d bytes, %v", len(data), err)
+			}
+
+			reads := 0
+			for _, apdu := range m.Log {
+				if apdu[1] != INS_READ_BINARY {
+					continue
+				}
+				reads++
+				if ext := len(apdu) == 7; ext != tc.wantExtLen {
+					t.Errorf("READ BINARY %X: extended = %v, want %v", apdu, ext, tc.wantExtLen)
+				}
+			}
+			if reads != tc.wantReads {
+				t.Errorf("READ BINARY count = %d, want %d", reads, tc.wantReads)
+			}
+		})
+	}
+}
+
+func TestReadAllBinary_ExtendedFallback(t *testing.T) {
+	m := newCapsTestCard()
+	m.Override = func(apdu []byte) []byte {
+		if apdu[1] == INS_READ_BINARY && len(apdu) == 7 {
+			return swBytes(SW_WRONG_LENGTH)
+		}
+		return nil
+	}
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	r.DetectCapabilities()
+
+	r.Select([]byte{0x2F, 0xE3})
+	data, err := r.ReadAllBinary(600)
+	if err != nil || !bytes.Equal(data, bytes.Repeat([]byte{0xA5}, 600)) {
+		t.Errorf("ReadAllBinary() = %d bytes, %v, want 600 bytes via short reads", len(data), err)
+	}
+}
@@ -0,0 +1,391 @@
+package card
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// CCID (USB Chip/Smart Card Interface Devices 1.1) bulk-out messages
+const (
+	ccidSetParameters = 0x61
+	ccidIccPowerOn    = 0x62
+	ccidIccPowerOff   = 0x63
+	ccidGetSlotStatus = 0x65
+	ccidXfrBlock      = 0x6F
+)
+
+// CCID bulk-in messages
+const (
+	ccidDataBlock  = 0x80
+	ccidSlotStatus = 0x81
+	ccidParameters = 0x82
+)
+
+// ccidHeaderLen is the size of the common header of every CCID message
+const ccidHeaderLen = 10
+
+// dwFeatures bits of the CCID class descriptor
+const (
+	CCIDFeatureAutoParamsATR   = 0x00000002 // parameters configured from the ATR by the reader
+	CCIDFeatureAutoVoltage     = 0x00000008
+	CCIDFeatureAutoNegotiation = 0x00000040 // proprietary parameter negotiation
+	CCIDFeatureAutoPPS         = 0x00000080
+	CCIDFeatureAutoIFSD        = 0x00000400 // reader sends S(IFS request) itself
+	CCIDFeatureTPDU            = 0x00010000
+	CCIDFeatureShortAPDU       = 0x00020000
+	CCIDFeatureExtendedAPDU    = 0x00040000
+	ccidExchangeLevelMask      = 0x00070000
+)
+
+// CCIDDescriptor holds the fields of the CCID class descriptor the driver uses
+type CCIDDescriptor struct {
+	MaxSlotIndex     byte
+	VoltageSupport   byte   // bit 0 5V, bit 1 3V, bit 2 1.8V
+	Protocols        uint32 // bit 0 T=0, bit 1 T=1
+	MaxIFSD          int
+	Features         uint32
+	MaxMessageLength int
+}
+
+// ParseCCIDDescriptor decodes a CCID class descriptor (type 21h, 54 bytes)
+func ParseCCIDDescriptor(d []byte) (CCIDDescriptor, error) {
+	if len(d) < 0x36 || d[1] != 0x21 {
+		return CCIDDescriptor{}, fmt.Errorf("not a CCID class descriptor (%d bytes)", len(d))
+	}
+	return CCIDDescriptor{
+		MaxSlotIndex:     d[4],
+		VoltageSupport:   d[5],
+		Protocols:        binary.LittleEndian.Uint32(d[6:]),
+		MaxIFSD:          int(binary.LittleEndian.Uint32(d[28:])),
+		Features:         binary.LittleEndian.Uint32(d[40:]),
+		MaxMessageLength: int(binary.LittleEndian.Uint32(d[44:])),
+	}, nil
+}
+
+// ExchangeLevel returns "TPDU", "short APDU", "extended APDU" or "character"
+func (d CCIDDescriptor) ExchangeLevel() string {
+	switch {
+	case d.Features&CCIDFeatureExtendedAPDU != 0:
+		return "extended APDU"
+	case d.Features&CCIDFeatureShortAPDU != 0:
+		return "short APDU"
+	case d.Features&CCIDFeatureTPDU != 0:
+		return "TPDU"
+	}
+	return "character"
+}
+
+// ccidPipe is the pair of bulk endpoints of a claimed CCID interface
+type ccidPipe interface {
+	WriteBulk(data []byte) error
+	ReadBulk(buf []byte) (int, error)
+	Close() error
+}
+
+// CCIDError is a failed CCID command (bmCommandStatus = 1)
+type CCIDError struct {
+	Command byte
+	Code    byte // bError
+}
+
+// ccidErrorNames names the bError values of CCID 1.1 Table 6.2-2
+var ccidErrorNames = map[byte]string{
+	0xFF: "command aborted",
+	0xFE: "ICC mute",
+	0xFD: "parity error",
+	0xFC: "overrun",
+	0xFB: "hardware error",
+	0xF8: "bad ATR TS",
+	0xF7: "bad ATR TCK",
+	0xF6: "protocol not supported",
+	0xF5: "class not supported",
+	0xF4: "procedure byte conflict",
+	0xF3: "deactivated protocol",
+	0xF2: "busy with auto sequence",
+	0xE0: "slot busy",
+	0x05: "slot does not exist",
+	0x00: "command not supported",
+}
+
+func (e *CCIDError) Error() string {
+	name, ok := ccidErrorNames[e.Code]
+	if !ok {
+		name = "unknown error"
+	}
+	return fmt.Sprintf("CCID command %02X failed: %s (bError %02X)", e.Command, name, e.Code)
+}
+
+// CCIDTransport drives a USB CCID reader directly, without PC/SC.
+//
+// T=0 cards get TPDUs (the case 4 Le is dropped and the card answers 61xx, as through
+// PC/SC). T=1 cards get I/R/S blocks with LRC, chaining and WTX on TPDU-level readers;
+// APDU-level readers receive the APDU unchanged.
+type CCIDTransport struct {
+	pipe ccidPipe
+	desc CCIDDescriptor
+	slot byte
+	seq  byte
+	bwi  byte // waiting time extension for the next XfrBlock (T=1 WTX)
+
+	atr      []byte
+	protocol int
+	t1       *t1Link
+
+	// powerOffDelay is the time the card stays unpowered during a cold reset
+	powerOffDelay time.Duration
+}
+
+// newCCIDTransport wraps a claimed CCID interface; call powerOn before Transmit
+func newCCIDTransport(pipe ccidPipe, desc CCIDDescriptor) *CCIDTransport {
+	if desc.MaxMessageLength < ccidHeaderLen+261 {
+		desc.MaxMessageLength = ccidHeaderLen + 261
+	}
+	return &CCIDTransport{pipe: pipe, desc: desc, powerOffDelay: 10 * time.Millisecond}
+}
+
+// ATR returns the ATR of the last power-on
+func (t *CCIDTransport) ATR() []byte {
+	return t.atr
+}
+
+// Protocol returns the protocol in use, 0 or 1
+func (t *CCIDTransport) Protocol() int {
+	return t.protocol
+}
+
+// Transmit sends an APDU and returns the response data with the status word
+func (t *CCIDTransport) Transmit(apdu []byte) ([]byte, error) {
+	if t.atr == nil {
+		return nil, fmt.Errorf("card is not powered")
+	}
+	if t.desc.Features&(CCIDFeatureShortAPDU|CCIDFeatureExtendedAPDU) != 0 {
+		return t.xfr(apdu)
+	}
+	if t.protocol == 1 {
+		return t.t1.transceive(apdu)
+	}
+	tpdu, err := t0TPDU(apdu)
+	if err != nil {
+		return nil, err
+	}
+	return t.xfr(tpdu)
+}
+
+// Reset re-activates the card. CCID has no separate warm reset: IccPowerOn on an
+// active card makes the reader reset it, a cold reset sends IccPowerOff first.
+func (t *CCIDTransport) Reset(cold bool) ([]byte, error) {
+	if cold {
+		if err := t.powerOff(); err != nil {
+			return nil, err
+		}
+		time.Sleep(t.powerOffDelay)
+	}
+	if err := t.powerOn(); err != nil {
+		return nil, err
+	}
+	return t.atr, nil
+}
+
+// Close powers the card off and releases the interface
+func (t *CCIDTransport) Close() error {
+	if t.atr != nil {
+		t.powerOff()
+	}
+	return t.pipe.Close()
+}
+
+// powerOn activates the card, reads its ATR and sets up the protocol
+func (t *CCIDTransport) powerOn() error {
+	t.atr = nil
+	resp, err := t.command(ccidIccPowerOn, [3]byte{t.powerSelect()}, nil)
+	if err != nil {
+		return fmt.Errorf("power on: %w", err)
+	}
+	if len(resp) < 2 {
+		return fmt.Errorf("power on: no ATR")
+	}
+	info, err := ParseATR(resp)
+	if err != nil {
+		return fmt.Errorf("power on: %w", err)
+	}
+	t.atr = resp
+	t.bwi = 0
+	t.protocol = 0
+	if len(info.Protocols) > 0 && info.Protocols[0] == 1 {
+		t.protocol = 1
+	}
+	if t.desc.Features&(CCIDFeatureAutoParamsATR|CCIDFeatureAutoNegotiation|CCIDFeatureAutoPPS) == 0 {
+		if err := t.setParameters(info); err != nil {
+			return err
+		}
+	}
+	if t.protocol == 1 {
+		t.t1 = newT1Link(t.xfr, info.IFSC)
+		t.t1.onWTX = func(m byte) { t.bwi = m }
+		if t.desc.Features&CCIDFeatureTPDU != 0 && t.desc.Features&CCIDFeatureAutoIFSD == 0 {
+			ifsd := t.desc.MaxIFSD
+			if ifsd <= 0 || ifsd > 254 {
+				ifsd = 254
+			}
+			if err := t.t1.negotiateIFSD(byte(ifsd)); err != nil {
+				return fmt.Errorf("IFSD negotiation: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// powerSelect picks bPowerSelect: automatic when supported, else 3V or 5V
+func (t *CCIDTransport) powerSelect() byte {
+	switch {
+	case t.desc.Features&CCIDFeatureAutoVoltage != 0:
+		return 0x00
+	case t.desc.VoltageSupport&0x02 != 0:
+		return 0x02
+	}
+	return 0x01
+}
+
+// powerOff deactivates the card
+func (t *CCIDTransport) powerOff() error {
+	t.atr = nil
+	if _, err := t.command(ccidIccPowerOff, [3]byte{}, nil); err != nil {
+		return fmt.Errorf("power off: %w", err)
+	}
+	return nil
+}
+
+// setParameters configures a reader that does not derive the link parameters from the
+// ATR. The default rate is kept unless the card is in specific mode (TA2).
+func (t *CCIDTransport) setParameters(info *ATRInfo) error {
+	fd := byte(0x11)
+	if ta1, ok := info.TA[1]; ok && info.SpecificMode {
+		fd = ta1
+	}
+	convention := byte(0x00)
+	if info.TS == 0x3F {
+		convention = 0x02
+	}
+	guard := info.TC[1]
+	var params []byte
+	if t.protocol == 1 {
+		params = []byte{fd, 0x10 | convention, guard, byte(info.BWI<<4) | byte(info.CWI&0x0F), 0x00, byte(info.IFSC), 0x00}
+	} else {
+		params = []byte{fd, convention, guard, byte(info.WaitingInteger), 0x00}
+	}
+	if _, err := t.command(ccidSetParameters, [3]byte{byte(t.protocol)}, params); err != nil {
+		return fmt.Errorf("set parameters: %w", err)
+	}
+	return nil
+}
+
+// xfr exchanges one XfrBlock: an APDU, a T=0 TPDU or a T=1 block
+func (t *CCIDTransport) xfr(data []byte) ([]byte, error) {
+	if ccidHeaderLen+len(data) > t.desc.MaxMessageLength {
+		return nil, fmt.Errorf("%d byte command exceeds the reader message size %d", len(data), t.desc.MaxMessageLength)
+	}
+	bwi := t.bwi
+	t.bwi = 0
+	return t.command(ccidXfrBlock, [3]byte{bwi}, data)
+}
+
+// command sends one CCID message and waits for its answer, skipping time extensions
+func (t *CCIDTransport) command(msgType byte, param [3]byte, data []byte) ([]byte, error) {
+	t.seq++
+	msg := make([]byte, ccidHeaderLen+len(data))
+	msg[0] = msgType
+	binary.LittleEndian.PutUint32(msg[1:], uint32(len(data)))
+	msg[5] = t.slot
+	msg[6] = t.seq
+	copy(msg[7:10], param[:])
+	copy(msg[ccidHeaderLen:], data)
+	if err := t.pipe.WriteBulk(msg); err != nil {
+		return nil, fmt.Errorf("USB write: %w", err)
+	}
+
+	for {
+		resp, err := t.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		if resp[5] != t.slot || resp[6] != t.seq {
+			continue // answer to an earlier, abandoned command
+		}
+		status, code := resp[7], resp[8]
+		switch status >> 6 {
+		case 0:
+		case 1:
+			return nil, &CCIDError{Command: msgType, Code: code}
+		case 2:
+			continue // time extension: the card asked for more time
+		default:
+			return nil, fmt.Errorf("CCID command %02X: invalid status %02X", msgType, status)
+		}
+		if status&0x03 == 0x02 && msgType != ccidIccPowerOff {
+			return nil, fmt.Errorf("no card in the reader")
+		}
+		want := byte(ccidDataBlock)
+		switch msgType {
+		case ccidIccPowerOff, ccidGetSlotStatus:
+			want = ccidSlotStatus
+		case ccidSetParameters:
+			want = ccidParameters
+		}
+		if resp[0] != want {
+			return nil, fmt.Errorf("CCID command %02X: unexpected answer %02X", msgType, resp[0])
+		}
+		return resp[ccidHeaderLen:], nil
+	}
+}
+
+// readMessage reads one complete bulk-in message, which may span several transfers
+func (t *CCIDTransport) readMessage() ([]byte, error) {
+	buf := make([]byte, t.desc.MaxMessageLength)
+	n, err := t.pipe.ReadBulk(buf)
+	if err != nil {
+		return nil, fmt.Errorf("USB read: %w", err)
+	}
+	msg := append([]byte(nil), buf[:n]...)
+	if len(msg) < ccidHeaderLen {
+		return nil, fmt.Errorf("short CCID message (%d bytes)", len(msg))
+	}
+	total := ccidHeaderLen + int(binary.LittleEndian.Uint32(msg[1:]))
+	if total > ccidHeaderLen+65536 {
+		return nil, fmt.Errorf("CCID message length %d out of range", total)
+	}
+	for len(msg) < total {
+		n, err := t.pipe.ReadBulk(buf)
+		if err != nil {
+			return nil, fmt.Errorf("USB read: %w", err)
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("truncated CCID message (%d of %d bytes)", len(msg), total)
+		}
+		msg = append(msg, buf[:n]...)
+	}
+	return msg[:total], nil
+}
+
+// t0TPDU converts a short APDU to a T=0 TPDU: case 1 gets P3 = 00, case 4 loses its
+// Le (the card answers 61xx and the caller issues GET RESPONSE)
+func t0TPDU(apdu []byte) ([]byte, error) {
+	switch {
+	case len(apdu) < 4:
+		return nil, fmt.Errorf("APDU too short (%d bytes)", len(apdu))
+	case len(apdu) == 4:
+		return append(append([]byte(nil), apdu...), 0x00), nil
+	case len(apdu) == 5:
+		return apdu, nil
+	case apdu[4] == 0x00:
+		return nil, fmt.Errorf("extended APDUs are not supported with T=0")
+	}
+	lc := int(apdu[4])
+	switch len(apdu) {
+	case 5 + lc:
+		return apdu, nil
+	case 6 + lc:
+		return apdu[:5+lc], nil
+	}
+	return nil, fmt.Errorf("APDU length %d does not match Lc %d", len(apdu), lc)
+}
@@ -0,0 +1,181 @@
+package card
+
+import "fmt"
+
+// T=1 block types (ISO 7816-3 11.3)
+const (
+	t1RBlock = 0x80
+	t1SBlock = 0xC0
+
+	t1More = 0x20 // I-block M bit: more data follows
+
+	t1SIFS = 0x01
+	t1SWTX = 0x03
+	t1SAck = 0x20 // S-block response bit
+)
+
+// t1MaxRetries is the number of times a block is repeated after an error
+const t1MaxRetries = 3
+
+// t1Link carries APDUs in T=1 blocks (NAD, PCB, LEN, INF, LRC) over a reader that
+// works at TPDU level
+type t1Link struct {
+	xfr  func(block []byte) ([]byte, error)
+	ifsc int
+	ns   byte // N(S) of the next I-block sent
+	nr   byte // N(S) expected in the next I-block received
+
+	// onWTX receives the multiplier of a waiting time extension for the next exchange
+	onWTX func(multiplier byte)
+}
+
+// newT1Link returns a link with the card IFSC from the ATR
+func newT1Link(xfr func([]byte) ([]byte, error), ifsc int) *t1Link {
+	if ifsc <= 0 || ifsc > 254 {
+		ifsc = 32
+	}
+	return &t1Link{xfr: xfr, ifsc: ifsc}
+}
+
+// t1Block builds a block with its LRC
+func t1Block(pcb byte, inf []byte) []byte {
+	b := make([]byte, 0, 4+len(inf))
+	b = append(b, 0x00, pcb, byte(len(inf)))
+	b = append(b, inf...)
+	return append(b, lrc(b))
+}
+
+func lrc(b []byte) byte {
+	var x byte
+	for _, v := range b {
+		x ^= v
+	}
+	return x
+}
+
+// parseT1Block checks the framing and LRC of a received block
+func parseT1Block(b []byte) (pcb byte, inf []byte, err error) {
+	if len(b) < 4 || int(b[2]) != len(b)-4 {
+		return 0, nil, fmt.Errorf("malformed T=1 block % X", b)
+	}
+	if lrc(b) != 0 {
+		return 0, nil, fmt.Errorf("T=1 block LRC error")
+	}
+	return b[1], b[3 : len(b)-1], nil
+}
+
+// negotiateIFSD tells the card the largest block the reader accepts
+func (l *t1Link) negotiateIFSD(ifsd byte) error {
+	for try := 0; ; try++ {
+		resp, err := l.xfr(t1Block(t1SBlock|t1SIFS, []byte{ifsd}))
+		if err != nil {
+			return err
+		}
+		pcb, inf, err := parseT1Block(resp)
+		if err == nil && pcb == t1SBlock|t1SAck|t1SIFS && len(inf) == 1 && inf[0] == ifsd {
+			return nil
+		}
+		if try == t1MaxRetries {
+			return fmt.Errorf("no S(IFS response) from the card")
+		}
+	}
+}
+
+// transceive sends apdu in chained I-blocks of at most IFSC bytes and collects the
+// (possibly chained) response
+func (l *t1Link) transceive(apdu []byte) ([]byte, error) {
+	for off := 0; ; {
+		end := off + l.ifsc
+		if end > len(apdu) {
+			end = len(apdu)
+		}
+		more := end < len(apdu)
+		pcb := l.ns << 6
+		if more {
+			pcb |= t1More
+		}
+		block := t1Block(pcb, apdu[off:end])
+
+		resp, err := l.exchange(block)
+		if err != nil {
+			return nil, err
+		}
+		rpcb, inf, _ := parseT1Block(resp)
+		if more {
+			// The card acknowledges a chained block with R(N(S)+1)
+			if rpcb&0xC0 != t1RBlock || (rpcb>>4)&1 == l.ns {
+				return nil, fmt.Errorf("T=1 chaining: unexpected block PCB %02X", rpcb)
+			}
+			l.ns ^= 1
+			off = end
+			continue
+		}
+		l.ns ^= 1
+		return l.receive(rpcb, inf)
+	}
+}
+
+// receive collects the response I-blocks, acknowledging each chained one
+func (l *t1Link) receive(pcb byte, inf []byte) ([]byte, error) {
+	var data []byte
+	for {
+		if pcb&0x80 != 0 {
+			return nil, fmt.Errorf("T=1: expected an I-block, got PCB %02X", pcb)
+		}
+		if (pcb>>6)&1 != l.nr {
+			return nil, fmt.Errorf("T=1: I-block out of sequence")
+		}
+		l.nr ^= 1
+		data = append(data, inf...)
+		if pcb&t1More == 0 {
+			return data, nil
+		}
+		resp, err := l.exchange(t1Block(t1RBlock|l.nr<<4, nil))
+		if err != nil {
+			return nil, err
+		}
+		pcb, inf, _ = parseT1Block(resp)
+	}
+}
+
+// exchange sends block and returns the card's answer, answering S(WTX) and S(IFS)
+// requests and repeating the block after a transmission error
+func (l *t1Link) exchange(block []byte) ([]byte, error) {
+	sent := block
+	for failures := 0; ; {
+		resp, err := l.xfr(sent)
+		if err != nil {
+			return nil, err
+		}
+		pcb, inf, perr := parseT1Block(resp)
+		switch {
+		case perr != nil:
+			// Ask for the block again with R(N(R)) and an EDC error
+			if failures++; failures > t1MaxRetries {
+				return nil, perr
+			}
+			sent = t1Block(t1RBlock|l.nr<<4|0x01, nil)
+		case pcb == t1SBlock|t1SWTX && len(inf) == 1:
+			if l.onWTX != nil {
+				l.onWTX(inf[0])
+			}
+			sent = t1Block(t1SBlock|t1SAck|t1SWTX, inf)
+		case pcb == t1SBlock|t1SIFS && len(inf) == 1:
+			l.ifsc = int(inf[0])
+			sent = t1Block(t1SBlock|t1SAck|t1SIFS, inf)
+		case pcb&0xC0 == t1RBlock && (pcb&0x0F != 0 || repeatRequest(block, pcb)):
+			// The card did not receive our block correctly
+			if failures++; failures > t1MaxRetries {
+				return nil, fmt.Errorf("T=1: card reported error %d", pcb&0x03)
+			}
+			sent = block
+		default:
+			return resp, nil
+		}
+	}
+}
+
+// repeatRequest reports whether R-block pcb asks for I-block block again (N(R) = N(S))
+func repeatRequest(block []byte, pcb byte) bool {
+	return block[1]&0x80 == 0 && (pcb>>4)&1 == (block[1]>>6)&1
+}
@@ -0,0 +1,302 @@
+package card
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// ============ CCID TRACE HELPERS ============
+
+// ccidTraceStep is one bulk-out message and the bulk-in messages the reader answered
+type ccidTraceStep struct {
+	out string
+	in  []string
+}
+
+// tracePipe replays a recorded USB trace and fails on any unexpected bulk-out message
+type tracePipe struct {
+	t       *testing.T
+	steps   []ccidTraceStep
+	pending [][]byte
+	chunk   int // split bulk-in messages into transfers of this size (0 = whole)
+	closed  bool
+}
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (p *tracePipe) WriteBulk(data []byte) error {
+	p.t.Helper()
+	if len(p.steps) == 0 {
+		p.t.Fatalf("unexpected bulk-out %X", data)
+	}
+	step := p.steps[0]
+	p.steps = p.steps[1:]
+	if want := unhex(step.out); !bytes.Equal(data, want) {
+		p.t.Fatalf("bulk-out = %X\nwant       %X", data, want)
+	}
+	for _, in := range step.in {
+		msg := unhex(in)
+		for p.chunk > 0 && len(msg) > p.chunk {
+			p.pending = append(p.pending, msg[:p.chunk])
+			msg = msg[p.chunk:]
+		}
+		p.pending = append(p.pending, msg)
+	}
+	return nil
+}
+
+func (p *tracePipe) ReadBulk(buf []byte) (int, error) {
+	if len(p.pending) == 0 {
+		return 0, fmt.Errorf("no bulk-in recorded")
+	}
+	n := copy(buf, p.pending[0])
+	p.pending = p.pending[1:]
+	return n, nil
+}
+
+func (p *tracePipe) Close() error {
+	p.closed = true
+	return nil
+}
+
+func (p *tracePipe) done() {
+	p.t.Helper()
+	if len(p.steps) != 0 || len(p.pending) != 0 {
+		p.t.Errorf("trace not fully replayed: %d steps, %d bulk-in left", len(p.steps), len(p.pending))
+	}
+}
+
+// ============ CCID DESCRIPTOR TESTS ============
+
+// acr39uDescriptors is the sysfs "descriptors" file of an ACS ACR39U: device,
+// configuration, CCID interface, class descriptor, bulk out/in and interrupt endpoints
+const acr39uDescriptors = "12010002000000102F0700B1000101020001" +
+	"0902" + "5D00" + "0101008032" +
+	"09040000030B000000" +
+	"3621" + "1001" + "00" + "07" + "03000000" + "A00F0000" + "A00F0000" + "00" + "80250000" + "00D00200" + "00" +
+	"FE000000" + "00000000" + "00000000" + "BA040200" + "0F010000" + "00" + "00" + "0000" + "00" + "01" +
+	"07050202400000" + "07058202400000" + "0705830308000A"
+
+func TestParseCCIDDevice(t *testing.T) {
+	dev, err := parseCCIDDevice(unhex(acr39uDescriptors))
+	if err != nil {
+		t.Fatalf("parseCCIDDevice() error = %v", err)
+	}
+	if dev.VendorID != 0x072F || dev.ProductID != 0xB100 || dev.Name != "ACS ACR39U" {
+		t.Errorf("device = %04X:%04X %q", dev.VendorID, dev.ProductID, dev.Name)
+	}
+	if dev.Interface != 0 || dev.EndpointIn != 0x82 || dev.EndpointOut != 0x02 {
+		t.Errorf("interface %d, endpoints in %02X out %02X", dev.Interface, dev.EndpointIn, dev.EndpointOut)
+	}
+	want := CCIDDescriptor{MaxSlotIndex: 0, VoltageSupport: 0x07, Protocols: 0x03, MaxIFSD: 254,
+		Features: 0x000204BA, MaxMessageLength: 271}
+	if dev.Descriptor != want {
+		t.Errorf("descriptor = %+v, want %+v", dev.Descriptor, want)
+	}
+	if got := dev.Descriptor.ExchangeLevel(); got != "short APDU" {
+		t.Errorf("ExchangeLevel() = %q", got)
+	}
+}
+
+func TestParseCCIDDevice_VendorClass(t *testing.T) {
+	// Vendor class interface with the class descriptor after the endpoints, on an
+	// unknown device; a mass storage interface comes first
+	raw := "1201100100000040341200AB000101020001" +
+		"0902" + "6D00" + "0201008032" +
+		"090400000208065000" + "07050102000200" + "07058102000200" +
+		"0904010002FF000000" + "07050302400000" + "07058402400000" +
+		"3621" + "1001" + "00" + "02" + "01000000" + "A00F0000" + "A00F0000" + "00" + "80250000" + "00D00200" + "00" +
+		"20000000" + "00000000" + "00000000" + "30000100" + "0F010000" + "00" + "00" + "0000" + "00" + "01"
+	dev, err := parseCCIDDevice(unhex(raw))
+	if err != nil {
+		t.Fatalf("parseCCIDDevice() error = %v", err)
+	}
+	if dev.Interface != 1 || dev.EndpointIn != 0x84 || dev.EndpointOut != 0x03 || dev.Name != "" {
+		t.Errorf("device = %+v", dev)
+	}
+	if dev.Descriptor.ExchangeLevel() != "TPDU" || dev.Descriptor.MaxIFSD != 32 {
+		t.Errorf("descriptor = %+v", dev.Descriptor)
+	}
+
+	// Without a CCID interface the device is skipped
+	if _, err := parseCCIDDevice(unhex(raw[:len(raw)-108])); err == nil {
+		t.Error("parseCCIDDevice() accepted a device without a CCID class descriptor")
+	}
+}
+
+// ============ T=0 TPDU TESTS ============
+
+func TestT0TPDU(t *testing.T) {
+	tests := []struct {
+		name string
+		apdu string
+		want string
+		err  bool
+	}{
+		{"case 1", "00700000", "0070000000", false},
+		{"case 2", "00B0000010", "00B0000010", false},
+		{"case 3", "00A40004023F00", "00A40004023F00", false},
+		{"case 4 drops Le", "00A40404023F0000", "00A40404023F00", false},
+		{"extended", "00B00000000100", "", true},
+		{"Lc mismatch", "00A40004023F", "", true},
+		{"too short", "00A4", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := t0TPDU(unhex(tt.apdu))
+			if (err != nil) != tt.err {
+				t.Fatalf("t0TPDU() error = %v", err)
+			}
+			if !tt.err && !bytes.Equal(got, unhex(tt.want)) {
+				t.Errorf("t0TPDU() = %X, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// ============ CCID TRANSPORT TESTS ============
+
+const ccidTestATR = "3B9F96801FC78031A073BE21136743200718000001A5"
+
+// scr3310Descriptor is a TPDU-level reader with automatic PPS and voltage selection
+var scr3310Descriptor = CCIDDescriptor{VoltageSupport: 0x07, Protocols: 0x03, MaxIFSD: 254,
+	Features: 0x000100BA, MaxMessageLength: 271}
+
+func TestCCIDTransport_T0(t *testing.T) {
+	pipe := &tracePipe{t: t, chunk: 16, steps: []ccidTraceStep{
+		// IccPowerOn, automatic voltage
+		{"62000000000001000000", []string{"80160000000001000000" + ccidTestATR}},
+		// SELECT MF: a time extension and a stale answer to an earlier command come first
+		{"6F07000000000200000000A40004023F00", []string{
+			"80000000000002800100",
+			"800200000000010000009000",
+			"800200000000020000006122",
+		}},
+		// INTERNAL AUTHENTICATE (case 4): Le is not sent with T=0
+		{"6F150000000003000000008800811000112233445566778899AABBCCDDEEFF", []string{"800200000000030000006110"}},
+		// Cold reset: IccPowerOff then IccPowerOn
+		{"63000000000004000000", []string{"81000000000004010000"}},
+		{"62000000000005000000", []string{"80160000000005000000" + ccidTestATR}},
+		// Warm reset: IccPowerOn on the active card
+		{"62000000000006000000", []string{"80160000000006000000" + ccidTestATR}},
+		// Close
+		{"63000000000007000000", []string{"81000000000007010000"}},
+	}}
+	tr := newCCIDTransport(pipe, scr3310Descriptor)
+	tr.powerOffDelay = 0
+	reader := NewReaderWithTransport("SCR3310", nil, tr)
+	if err := tr.powerOn(); err != nil {
+		t.Fatalf("powerOn() error = %v", err)
+	}
+	if fmt.Sprintf("%X", tr.ATR()) != ccidTestATR || tr.Protocol() != 0 {
+		t.Fatalf("ATR %X, T=%d", tr.ATR(), tr.Protocol())
+	}
+
+	resp, err := reader.SendAPDURaw(unhex("00A40004023F00"))
+	if err != nil || resp.SW() != 0x6122 {
+		t.Fatalf("SELECT = %v, %v", resp, err)
+	}
+	resp, err = reader.SendAPDURaw(unhex("0088008110" + "00112233445566778899AABBCCDDEEFF" + "00"))
+	if err != nil || resp.SW() != 0x6110 {
+		t.Fatalf("AUTHENTICATE = %v, %v", resp, err)
+	}
+	for _, cold := range []bool{true, false} {
+		if _, err := reader.Reconnect(cold); err != nil {
+			t.Fatalf("Reconnect(%v) error = %v", cold, err)
+		}
+	}
+	if reader.ATRHex() != ccidTestATR {
+		t.Errorf("ATR after reset = %s", reader.ATRHex())
+	}
+	if err := reader.Close(); err != nil || !pipe.closed {
+		t.Errorf("Close() = %v, pipe closed %v", err, pipe.closed)
+	}
+	pipe.done()
+}
+
+func TestCCIDTransport_Errors(t *testing.T) {
+	// No card: the reader reports ICC mute
+	pipe := &tracePipe{t: t, steps: []ccidTraceStep{
+		{"62000000000001000000", []string{"8000000000000142FE00"}},
+	}}
+	err := newCCIDTransport(pipe, scr3310Descriptor).powerOn()
+	if err == nil || !strings.Contains(err.Error(), "ICC mute") {
+		t.Errorf("powerOn() error = %v, want ICC mute", err)
+	}
+
+	tr := newCCIDTransport(&tracePipe{t: t}, scr3310Descriptor)
+	if _, err := tr.Transmit(unhex("00A40004023F00")); err == nil {
+		t.Error("Transmit() before power on should fail")
+	}
+
+	// Commands larger than the reader message size are refused before sending
+	tr.atr = unhex(ccidTestATR)
+	tr.desc.MaxMessageLength = 64
+	if _, err := tr.Transmit(append(unhex("00D6000040"), make([]byte, 64)...)); err == nil {
+		t.Error("Transmit() should refuse a command beyond dwMaxCCIDMessageLength")
+	}
+}
+
+func TestCCIDTransport_T1(t *testing.T) {
+	// TPDU reader without automatic parameters or IFSD: SetParameters and S(IFS) follow the
+	// power on. The card has IFSC 16, so the 21 byte APDU goes out in two chained I-blocks.
+	pipe := &tracePipe{t: t, steps: []ccidTraceStep{
+		{"62000000000001020000", []string{"800700000000010000003B808131104565"}},
+		{"6107000000000201000011100045001000", []string{"8207000000000200000111100045001000"}},
+		{"6F05000000000300000000C101FE3E", []string{"8005000000000300000000E101FE1E"}},
+		// I(0, more) acknowledged by R(1)
+		{"6F14000000000400000000201000A4000410A0000000871002FF33FF0187", []string{"8004000000000400000000900090"}},
+		// I(1) answered by S(WTX request x2), the response carries bBWI = 2
+		{"6F0900000000050000000040058900000100CD", []string{"8005000000000500000000C30102C0"}},
+		{"6F05000000000602000000E30102E0", []string{"80060000000006000000002002AABB33"}},
+		// The chained response is acknowledged with R(1)
+		{"6F04000000000700000000900090", []string{"800600000000070000000040029000D2"}},
+		// READ BINARY: the first answer has a bad LRC and is requested again
+		{"6F09000000000800000000000500B0000002B7", []string{"800600000000080000000000021234FF"}},
+		{"6F04000000000900000000810081", []string{"8008000000000900000000000412349000B2"}},
+	}}
+	tr := newCCIDTransport(pipe, CCIDDescriptor{VoltageSupport: 0x07, Protocols: 0x02, MaxIFSD: 254,
+		Features: 0x00010030, MaxMessageLength: 271})
+	if err := tr.powerOn(); err != nil {
+		t.Fatalf("powerOn() error = %v", err)
+	}
+	if tr.Protocol() != 1 {
+		t.Fatalf("Protocol() = %d, want 1", tr.Protocol())
+	}
+
+	resp, err := tr.Transmit(unhex("00A4000410A0000000871002FF33FF018900000100"))
+	if err != nil || fmt.Sprintf("%X", resp) != "AABB9000" {
+		t.Fatalf("Transmit() = %X, %v", resp, err)
+	}
+	resp, err = tr.Transmit(unhex("00B0000002"))
+	if err != nil || fmt.Sprintf("%X", resp) != "12349000" {
+		t.Fatalf("Transmit() after LRC error = %X, %v", resp, err)
+	}
+	pipe.done()
+}
+
+func TestCCIDTransport_APDULevel(t *testing.T) {
+	// Short APDU readers get the APDU unchanged, Le included, whatever the protocol
+	pipe := &tracePipe{t: t, steps: []ccidTraceStep{
+		{"62000000000001000000", []string{"80160000000001000000" + ccidTestATR}},
+		{"6F08000000000200000000A40004023F0000", []string{"800400000000020000008202" + "9000"}},
+	}}
+	tr := newCCIDTransport(pipe, CCIDDescriptor{Features: 0x000204BA, MaxMessageLength: 271})
+	if err := tr.powerOn(); err != nil {
+		t.Fatalf("powerOn() error = %v", err)
+	}
+	resp, err := tr.Transmit(unhex("00A40004023F0000"))
+	if err != nil || fmt.Sprintf("%X", resp) != "82029000" {
+		t.Fatalf("Transmit() = %X, %v", resp, err)
+	}
+	pipe.done()
+}
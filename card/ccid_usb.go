@@ -0,0 +1,150 @@
+package card
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// CCIDDevice is a USB smart card reader usable with the ccid backend
+type CCIDDevice struct {
+	Name        string
+	Path        string // usbfs device node, /dev/bus/usb/BBB/DDD
+	VendorID    uint16
+	ProductID   uint16
+	Interface   int
+	EndpointIn  byte
+	EndpointOut byte
+	Descriptor  CCIDDescriptor
+}
+
+// knownCCIDReaders names the readers in use here by USB vendor:product ID; any other
+// device with a CCID interface works too and is named after its USB strings
+var knownCCIDReaders = map[uint32]string{
+	0x072F90CC: "ACS ACR38U-CCID",
+	0x072FB100: "ACS ACR39U",
+	0x072F2200: "ACS ACR122U",
+	0x072F223B: "ACS ACR1252",
+	0x04E65116: "Identiv SCR3310 v2.0",
+	0x04E65410: "Identiv SCR35xx v2.0",
+	0x04E65810: "Identiv uTrust 2700 R",
+}
+
+// USB descriptor types
+const (
+	usbDescDevice    = 0x01
+	usbDescInterface = 0x04
+	usbDescEndpoint  = 0x05
+	usbDescCCID      = 0x21
+)
+
+// parseCCIDDevice finds the CCID interface in the descriptors of a device (device
+// descriptor followed by the active configuration, as in sysfs "descriptors").
+// Vendor-class (FFh) interfaces count when they carry a CCID class descriptor, which
+// some readers also place after their endpoints.
+func parseCCIDDevice(raw []byte) (CCIDDevice, error) {
+	if len(raw) < 18 || raw[1] != usbDescDevice {
+		return CCIDDevice{}, fmt.Errorf("no USB device descriptor")
+	}
+	dev := CCIDDevice{
+		VendorID:  binary.LittleEndian.Uint16(raw[8:]),
+		ProductID: binary.LittleEndian.Uint16(raw[10:]),
+	}
+
+	type iface struct {
+		number, class byte
+		in, out       byte
+		ccid          []byte
+	}
+	var ifaces []*iface
+	var cur *iface
+	for off := int(raw[0]); off+2 <= len(raw); {
+		n := int(raw[off])
+		if n < 2 || off+n > len(raw) {
+			return dev, fmt.Errorf("truncated USB descriptor at offset %d", off)
+		}
+		d := raw[off : off+n]
+		switch d[1] {
+		case usbDescInterface:
+			if n >= 9 && d[3] == 0 { // alternate setting 0 only
+				cur = &iface{number: d[2], class: d[5]}
+				ifaces = append(ifaces, cur)
+			} else {
+				cur = nil
+			}
+		case usbDescCCID:
+			if cur != nil && n == 0x36 {
+				cur.ccid = d
+			}
+		case usbDescEndpoint:
+			if cur != nil && n >= 7 && d[3]&0x03 == 0x02 { // bulk
+				if d[2]&0x80 != 0 {
+					cur.in = d[2]
+				} else {
+					cur.out = d[2]
+				}
+			}
+		}
+		off += n
+	}
+
+	for _, i := range ifaces {
+		if (i.class != 0x0B && i.class != 0xFF) || i.ccid == nil || i.in == 0 || i.out == 0 {
+			continue
+		}
+		desc, err := ParseCCIDDescriptor(i.ccid)
+		if err != nil {
+			return dev, err
+		}
+		dev.Interface = int(i.number)
+		dev.EndpointIn, dev.EndpointOut = i.in, i.out
+		dev.Descriptor = desc
+		dev.Name = knownCCIDReaders[uint32(dev.VendorID)<<16|uint32(dev.ProductID)]
+		return dev, nil
+	}
+	return dev, fmt.Errorf("no CCID interface")
+}
+
+// ListCCIDReaders returns the names of the USB CCID readers, in ConnectCCID index order
+func ListCCIDReaders() ([]string, error) {
+	devices, err := FindCCIDDevices()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(devices))
+	for i, d := range devices {
+		names[i] = d.Name
+	}
+	return names, nil
+}
+
+// ConnectCCID claims the USB CCID reader at readerIndex and powers on its card,
+// bypassing PC/SC (pcscd must not hold the reader)
+func ConnectCCID(readerIndex int, opts ...ConnectOption) (*Reader, error) {
+	devices, err := FindCCIDDevices()
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no USB CCID readers found")
+	}
+	if readerIndex < 0 || readerIndex >= len(devices) {
+		return nil, fmt.Errorf("reader index %d out of range (0-%d)", readerIndex, len(devices)-1)
+	}
+	dev := devices[readerIndex]
+
+	pipe, err := openCCIDPipe(dev)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reader '%s': %w", dev.Name, err)
+	}
+	t := newCCIDTransport(pipe, dev.Descriptor)
+	if err := t.powerOn(); err != nil {
+		pipe.Close()
+		return nil, fmt.Errorf("failed to connect to card in reader '%s': %w", dev.Name, err)
+	}
+	return NewReaderWithTransport(dev.Name, t.ATR(), t, opts...), nil
+}
+
+// SelfTestCCID runs the SelfTest diagnostic on the USB CCID reader at readerIndex
+func SelfTestCCID(readerIndex int) (*SelfTestReport, error) {
+	return runSelfTest(func() (*Reader, error) { return ConnectCCID(readerIndex) })
+}
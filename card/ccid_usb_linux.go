@@ -0,0 +1,152 @@
+//go:build linux
+
+package card
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const sysfsUSBDevices = "/sys/bus/usb/devices"
+
+// usbfsBulkTransfer is struct usbdevfs_bulktransfer of linux/usbdevice_fs.h
+type usbfsBulkTransfer struct {
+	ep      uint32
+	len     uint32
+	timeout uint32 // milliseconds
+	data    unsafe.Pointer
+}
+
+// usbfs ioctls (_IOWR('U', 2, ...), _IOR('U', 15, unsigned int), _IOR('U', 16, unsigned int))
+var (
+	usbdevfsBulk             = 3<<30 | unsafe.Sizeof(usbfsBulkTransfer{})<<16 | 'U'<<8 | 2
+	usbdevfsClaimInterface   = uintptr(2<<30 | 4<<16 | 'U'<<8 | 15)
+	usbdevfsReleaseInterface = uintptr(2<<30 | 4<<16 | 'U'<<8 | 16)
+)
+
+// usbfs transfer timeouts; a slow card keeps the read alive with time extension messages
+const (
+	usbfsWriteTimeoutMs = 5000
+	usbfsReadTimeoutMs  = 10000
+)
+
+// FindCCIDDevices lists the USB devices with a CCID interface from sysfs, in bus order
+func FindCCIDDevices() ([]CCIDDevice, error) {
+	entries, err := os.ReadDir(sysfsUSBDevices)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list USB devices: %w", err)
+	}
+	var devices []CCIDDevice
+	for _, e := range entries {
+		if strings.ContainsRune(e.Name(), ':') { // interfaces, not devices
+			continue
+		}
+		dir := filepath.Join(sysfsUSBDevices, e.Name())
+		raw, err := os.ReadFile(filepath.Join(dir, "descriptors"))
+		if err != nil {
+			continue
+		}
+		dev, err := parseCCIDDevice(raw)
+		if err != nil {
+			continue
+		}
+		bus, err1 := strconv.Atoi(sysfsString(dir, "busnum"))
+		num, err2 := strconv.Atoi(sysfsString(dir, "devnum"))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		dev.Path = fmt.Sprintf("/dev/bus/usb/%03d/%03d", bus, num)
+		if dev.Name == "" {
+			dev.Name = strings.TrimSpace(sysfsString(dir, "manufacturer") + " " + sysfsString(dir, "product"))
+		}
+		if dev.Name == "" {
+			dev.Name = fmt.Sprintf("CCID reader %04X:%04X", dev.VendorID, dev.ProductID)
+		}
+		dev.Name = fmt.Sprintf("%s [usb %03d:%03d]", dev.Name, bus, num)
+		devices = append(devices, dev)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Path < devices[j].Path })
+	return devices, nil
+}
+
+func sysfsString(dir, name string) string {
+	b, _ := os.ReadFile(filepath.Join(dir, name))
+	return strings.TrimSpace(string(b))
+}
+
+// usbfsPipe is a CCID interface claimed through the usbfs device node
+type usbfsPipe struct {
+	f     *os.File
+	iface uint32
+	in    byte
+	out   byte
+}
+
+// openCCIDPipe opens the device node and claims the CCID interface
+func openCCIDPipe(dev CCIDDevice) (ccidPipe, error) {
+	f, err := os.OpenFile(dev.Path, os.O_RDWR, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("%w (see docs/CCID.md for the udev rule)", err)
+		}
+		return nil, err
+	}
+	p := &usbfsPipe{f: f, iface: uint32(dev.Interface), in: dev.EndpointIn, out: dev.EndpointOut}
+	if err := p.ioctl(usbdevfsClaimInterface, unsafe.Pointer(&p.iface)); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EBUSY) {
+			return nil, fmt.Errorf("%w: interface %d is claimed (stop pcscd or unbind the kernel driver)", ErrReaderBusy, dev.Interface)
+		}
+		return nil, fmt.Errorf("failed to claim interface %d: %w", dev.Interface, err)
+	}
+	return p, nil
+}
+
+func (p *usbfsPipe) ioctl(req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, p.f.Fd(), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// bulk runs one bulk transfer and returns the number of bytes moved
+func (p *usbfsPipe) bulk(ep byte, buf []byte, timeoutMs uint32) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	xfer := usbfsBulkTransfer{ep: uint32(ep), len: uint32(len(buf)), timeout: timeoutMs, data: unsafe.Pointer(&buf[0])}
+	n, _, errno := syscall.Syscall(syscall.SYS_IOCTL, p.f.Fd(), usbdevfsBulk, uintptr(unsafe.Pointer(&xfer)))
+	runtime.KeepAlive(buf)
+	if errno != 0 {
+		if errno == syscall.ETIMEDOUT {
+			return 0, fmt.Errorf("USB transfer timed out")
+		}
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+func (p *usbfsPipe) WriteBulk(data []byte) error {
+	n, err := p.bulk(p.out, data, usbfsWriteTimeoutMs)
+	if err == nil && n != len(data) {
+		err = fmt.Errorf("short USB write (%d of %d bytes)", n, len(data))
+	}
+	return err
+}
+
+func (p *usbfsPipe) ReadBulk(buf []byte) (int, error) {
+	return p.bulk(p.in, buf, usbfsReadTimeoutMs)
+}
+
+func (p *usbfsPipe) Close() error {
+	p.ioctl(usbdevfsReleaseInterface, unsafe.Pointer(&p.iface))
+	return p.f.Close()
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package card
+
+import "fmt"
+
+// errCCIDUnsupported is returned where there is no usbfs to drive the reader through
+var errCCIDUnsupported = fmt.Errorf("the ccid backend is only available on Linux (use the pcsc backend)")
+
+// FindCCIDDevices lists the USB devices with a CCID interface
+func FindCCIDDevices() ([]CCIDDevice, error) {
+	return nil, errCCIDUnsupported
+}
+
+func openCCIDPipe(dev CCIDDevice) (ccidPipe, error) {
+	return nil, errCCIDUnsupported
+}
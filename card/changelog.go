@@ -0,0 +1,126 @@
+package card
+
+import "encoding/binary"
+
+// FileWrite is one successful UPDATE BINARY / UPDATE RECORD recorded by the change log
+type FileWrite struct {
+	AID     []byte // Application selected by AID (nil when the path starts at the MF)
+	Path    []byte // File IDs selected since the MF or the ADF, the written EF last
+	Command string // UPDATE BINARY or UPDATE RECORD
+	Record  byte   // Record number (UPDATE RECORD in absolute mode, 0 otherwise)
+	Offset  int    // Offset (UPDATE BINARY)
+	Before  []byte // Content at the same offset/record before the write (nil if not readable)
+	After   []byte // Written data
+}
+
+// FileID returns the ID of the written EF (0 if unknown)
+func (w FileWrite) FileID() uint16 {
+	if len(w.Path) < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(w.Path[len(w.Path)-2:])
+}
+
+// changeLog tracks the current selection and the file writes of a session
+type changeLog struct {
+	aid     []byte
+	path    []byte
+	entries []FileWrite
+}
+
+// SetChangeLog enables or disables the change log. While enabled, the content an
+// UPDATE BINARY / UPDATE RECORD (absolute mode) overwrites is read before the write
+// is sent and recorded with the new data once the card answers 9000.
+// Dry-run writes are not recorded (see DryRunLog).
+func (r *Reader) SetChangeLog(enabled bool) {
+	if enabled {
+		r.changes = &changeLog{}
+	} else {
+		r.changes = nil
+	}
+}
+
+// ChangeLog returns the file writes recorded since SetChangeLog
+func (r *Reader) ChangeLog() []FileWrite {
+	if r.changes == nil {
+		return nil
+	}
+	return r.changes.entries
+}
+
+// beforeWrite returns the current content apdu would overwrite and whether apdu is a file write
+func (r *Reader) beforeWrite(apdu []byte) ([]byte, bool) {
+	if len(apdu) < 4 || !isInterindustry(apdu[0]) {
+		return nil, false
+	}
+	if apdu[1] != INS_UPDATE_BINARY && apdu[1] != INS_UPDATE_RECORD {
+		return nil, false
+	}
+	return r.readCurrent(apdu, len(commandData(apdu))), true
+}
+
+// observe updates the tracked selection and records successful writes
+func (c *changeLog) observe(apdu, response, before []byte, write bool) {
+	if len(apdu) < 4 || len(response) < 2 || !isInterindustry(apdu[0]) {
+		return
+	}
+	if apdu[1] == INS_SELECT {
+		if selectSucceeded(response) {
+			c.selected(apdu[2], apduData(apdu))
+		}
+		return
+	}
+	if !write || response[len(response)-2] != 0x90 || response[len(response)-1] != 0x00 {
+		return
+	}
+	entry := FileWrite{
+		AID:    append([]byte(nil), c.aid...),
+		Path:   append([]byte(nil), c.path...),
+		Before: before,
+		After:  append([]byte(nil), commandData(apdu)...),
+	}
+	if apdu[1] == INS_UPDATE_BINARY {
+		entry.Command = "UPDATE BINARY"
+		if apdu[2]&0x80 == 0 {
+			entry.Offset = int(apdu[2])<<8 | int(apdu[3])
+		}
+	} else {
+		entry.Command = "UPDATE RECORD"
+		if apdu[3]&0x07 == 0x04 {
+			entry.Record = apdu[2]
+		}
+	}
+	c.entries = append(c.entries, entry)
+}
+
+// selected applies a successful SELECT to the tracked AID and path
+func (c *changeLog) selected(p1 byte, data []byte) {
+	switch {
+	case p1 == 0x04:
+		c.aid = append([]byte(nil), data...)
+		c.path = nil
+	case p1 == 0x08:
+		c.aid = nil
+		c.path = append([]byte{0x3F, 0x00}, data...)
+	case p1 == 0x09:
+		c.path = append(c.dfPath(), data...)
+	case len(data) == 2 && data[0] == 0x3F && data[1] == 0x00:
+		c.aid = nil
+		c.path = []byte{0x3F, 0x00}
+	case len(data) == 2:
+		c.path = append(c.dfPath(), data...)
+	}
+}
+
+// dfPath returns the tracked path without a trailing EF
+func (c *changeLog) dfPath() []byte {
+	n := len(c.path)
+	if n >= 2 {
+		switch c.path[n-2] {
+		case 0x3F, 0x7F, 0x5F:
+		default:
+			return append([]byte(nil), c.path[:n-2]...)
+		}
+	}
+	return append([]byte(nil), c.path...)
+}
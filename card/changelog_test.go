@@ -0,0 +1,66 @@
+package card
+
+import (
+	"bytes"
+	"testing"
+)
+
+// ============ CHANGE LOG TESTS ============
+
+func TestChangeLog_RecordsWrites(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	aid := []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02}
+	adf := m.AddADF(aid)
+	imsi := adf.AddEF(0x6F07, []byte{0x08, 0x09, 0x10, 0x10})
+	telecom := m.MF().AddDF(0x7F10)
+	telecom.AddRecordEF(0x6F3C, []byte{0x11, 0x11}, []byte{0x22, 0x22})
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	r.SetChangeLog(true)
+
+	r.Select(aid)
+	r.Select([]byte{0x6F, 0x07})
+	if resp, err := r.UpdateBinary(2, []byte{0xAA, 0xBB}); err != nil || !resp.IsOK() {
+		t.Fatalf("UpdateBinary() = %v, %v", resp, err)
+	}
+	r.Select([]byte{0x3F, 0x00})
+	r.Select([]byte{0x7F, 0x10})
+	r.Select([]byte{0x6F, 0x3C})
+	if resp, err := r.UpdateRecord(2, []byte{0xCC, 0xCC}); err != nil || !resp.IsOK() {
+		t.Fatalf("UpdateRecord() = %v, %v", resp, err)
+	}
+
+	if !bytes.Equal(imsi.Data, []byte{0x08, 0x09, 0xAA, 0xBB}) {
+		t.Fatalf("EF_IMSI = %X, write not sent", imsi.Data)
+	}
+	log := r.ChangeLog()
+	if len(log) != 2 {
+		t.Fatalf("ChangeLog() has %d entries, want 2", len(log))
+	}
+	w := log[0]
+	if !bytes.Equal(w.AID, aid) || w.FileID() != 0x6F07 || w.Offset != 2 ||
+		!bytes.Equal(w.Before, []byte{0x10, 0x10}) || !bytes.Equal(w.After, []byte{0xAA, 0xBB}) {
+		t.Errorf("entry 0 = %+v", w)
+	}
+	w = log[1]
+	if w.AID != nil || !bytes.Equal(w.Path, []byte{0x3F, 0x00, 0x7F, 0x10, 0x6F, 0x3C}) || w.Record != 2 ||
+		!bytes.Equal(w.Before, []byte{0x22, 0x22}) || !bytes.Equal(w.After, []byte{0xCC, 0xCC}) {
+		t.Errorf("entry 1 = %+v", w)
+	}
+}
+
+func TestChangeLog_SkipsFailedAndDryRunWrites(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddEF(0x2FE2, []byte{0x01, 0x02})
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	r.SetChangeLog(true)
+
+	// No file selected after reset: the mock answers 6986
+	r.UpdateBinary(0, []byte{0xAA})
+	r.SetDryRun(true)
+	r.Select([]byte{0x2F, 0xE2})
+	r.UpdateBinary(0, []byte{0xAA})
+
+	if log := r.ChangeLog(); len(log) != 0 {
+		t.Errorf("ChangeLog() = %+v, want no entries", log)
+	}
+}
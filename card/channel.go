@@ -0,0 +1,109 @@
+package card
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxLogicalChannel is the highest channel number that can be encoded in CLA (ISO 7816-4)
+const MaxLogicalChannel = 19
+
+// ErrChannelNotSupported is returned by OpenLogicalChannel when the card has no free
+// logical channel or does not implement MANAGE CHANNEL
+var ErrChannelNotSupported = errors.New("logical channels not supported")
+
+// ChannelCLA encodes a logical channel number into a class byte (ISO 7816-4 5.4.1,
+// ETSI TS 102 221 10.1.1). Channels 0-3 use b2-b1 of the first interindustry coding,
+// channels 4-19 use b4-b1 of the further interindustry coding (value = channel - 4)
+// with b6 for secure messaging. The proprietary class (b8 set, e.g. 80/84 for STATUS or GP)
+// is coded the same way; the GSM class A0 has no logical channels and is left unchanged.
+func ChannelCLA(cla, channel byte) byte {
+	if cla == 0xA0 || cla == 0xFF || channel > MaxLogicalChannel {
+		return cla
+	}
+	proprietary, chaining := cla&0x80, cla&0x10
+
+	// Secure messaging indication as b4-b3 of the first interindustry coding
+	var sm byte
+	if cla&0x40 == 0 {
+		sm = cla & 0x0C
+	} else if cla&0x20 != 0 {
+		sm = 0x08
+	}
+
+	if channel <= 3 {
+		return proprietary | chaining | sm | channel
+	}
+	out := proprietary | 0x40 | chaining | (channel - 4)
+	if sm != 0 {
+		out |= 0x20
+	}
+	return out
+}
+
+// CLAChannel returns the logical channel encoded in a class byte
+func CLAChannel(cla byte) byte {
+	if cla == 0xA0 || cla == 0xFF {
+		return 0
+	}
+	if cla&0x40 == 0 {
+		return cla & 0x03
+	}
+	return (cla & 0x0F) + 4
+}
+
+// OpenLogicalChannel opens a new logical channel with MANAGE CHANNEL (open, card assigns
+// the number) on the basic channel and returns its number. The reader stays on its
+// current channel; use UseChannel to direct subsequent APDUs to the new one.
+// Returns ErrChannelNotSupported for SW 6881 (or when the instruction/class is unknown).
+func (r *Reader) OpenLogicalChannel() (byte, error) {
+	prev := r.channel
+	r.channel = 0
+	resp, err := r.SendAPDU([]byte{0x00, INS_MANAGE_CHANNEL, 0x00, 0x00, 0x01})
+	r.channel = prev
+	if err != nil {
+		return 0, err
+	}
+	switch resp.SW() {
+	case SW_OK:
+	case SW_CHANNEL_NOT_SUPPORTED, SW_INS_NOT_SUPPORTED, SW_CLA_NOT_SUPPORTED, SW_FUNC_NOT_SUPPORTED:
+		return 0, ErrChannelNotSupported
+	default:
+		return 0, fmt.Errorf("MANAGE CHANNEL open failed: %s", resp.SWString())
+	}
+	if len(resp.Data) < 1 || resp.Data[0] == 0 || resp.Data[0] > MaxLogicalChannel {
+		return 0, fmt.Errorf("MANAGE CHANNEL open returned invalid channel %X", resp.Data)
+	}
+	return resp.Data[0], nil
+}
+
+// CloseLogicalChannel closes a logical channel with MANAGE CHANNEL (close) sent on the
+// basic channel. If the reader is currently using the channel it is switched back to 0.
+func (r *Reader) CloseLogicalChannel(channel byte) error {
+	if channel == 0 {
+		return fmt.Errorf("the basic channel cannot be closed")
+	}
+	prev := r.channel
+	r.channel = 0
+	resp, err := r.SendAPDU([]byte{0x00, INS_MANAGE_CHANNEL, 0x80, channel})
+	if prev != channel {
+		r.channel = prev
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("MANAGE CHANNEL close %d failed: %s", channel, resp.SWString())
+	}
+	return nil
+}
+
+// UseChannel directs subsequent APDUs to the given logical channel
+func (r *Reader) UseChannel(channel byte) {
+	r.channel = channel
+}
+
+// Channel returns the logical channel currently used for APDUs
+func (r *Reader) Channel() byte {
+	return r.channel
+}
@@ -0,0 +1,131 @@
+package card
+
+import (
+	"errors"
+	"testing"
+)
+
+// ============ LOGICAL CHANNEL TESTS ============
+
+func TestChannelCLA(t *testing.T) {
+	tests := []struct {
+		name    string
+		cla     byte
+		channel byte
+		want    byte
+	}{
+		{"Basic channel", 0x00, 0, 0x00},
+		{"Channel 1", 0x00, 1, 0x01},
+		{"Channel 3", 0x00, 3, 0x03},
+		{"Channel 4", 0x00, 4, 0x40},
+		{"Channel 19", 0x00, 19, 0x4F},
+		{"Proprietary channel 1", 0x80, 1, 0x81},
+		{"Proprietary channel 5", 0x80, 5, 0xC1},
+		{"GP secure messaging channel 2", 0x84, 2, 0x86},
+		{"GP secure messaging channel 4", 0x84, 4, 0xE0},
+		{"Chaining channel 2", 0x10, 2, 0x12},
+		{"Already on channel 1", 0x01, 2, 0x02},
+		{"GSM class unchanged", 0xA0, 1, 0xA0},
+		{"Out of range unchanged", 0x00, 20, 0x00},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ChannelCLA(tc.cla, tc.channel)
+			if got != tc.want {
+				t.Errorf("ChannelCLA(%02X, %d) = %02X, want %02X", tc.cla, tc.channel, got, tc.want)
+			}
+			if tc.cla != 0xA0 && tc.channel <= MaxLogicalChannel && CLAChannel(got) != tc.channel {
+				t.Errorf("CLAChannel(%02X) = %d, want %d", got, CLAChannel(got), tc.channel)
+			}
+		})
+	}
+}
+
+// newChannelTestCard returns a card with two ADFs holding a file with the same FID
+func newChannelTestCard(channels int) *MockCard {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.Channels = channels
+	m.AddADF([]byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02}).AddEF(0x6FAD, []byte{0x01})
+	m.AddADF([]byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x04}).AddEF(0x6FAD, []byte{0x02})
+	return m
+}
+
+func TestLogicalChannel(t *testing.T) {
+	m := newChannelTestCard(4)
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+
+	r.Select([]byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02})
+
+	ch, err := r.OpenLogicalChannel()
+	if err != nil || ch != 1 {
+		t.Fatalf("OpenLogicalChannel() = %d, %v, want 1", ch, err)
+	}
+	r.UseChannel(ch)
+	m.Log = nil
+	r.Select([]byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x04})
+	r.Select([]byte{0x6F, 0xAD})
+	resp, _ := r.ReadBinary(0, 1)
+	if resp == nil || !resp.IsOK() || resp.Data[0] != 0x02 {
+		t.Errorf("channel 1 read = %+v, want ISIM EF_AD", resp)
+	}
+	for _, apdu := range m.Log {
+		if apdu[0] != 0x01 {
+			t.Errorf("APDU %X sent on channel 1 has CLA %02X, want 01", apdu, apdu[0])
+		}
+	}
+
+	// The basic channel still has the first ADF selected
+	r.UseChannel(0)
+	r.Select([]byte{0x6F, 0xAD})
+	resp, _ = r.ReadBinary(0, 1)
+	if resp == nil || !resp.IsOK() || resp.Data[0] != 0x01 {
+		t.Errorf("channel 0 read = %+v, want USIM EF_AD", resp)
+	}
+
+	if err := r.CloseLogicalChannel(ch); err != nil {
+		t.Errorf("CloseLogicalChannel() error = %v", err)
+	}
+	r.UseChannel(ch)
+	if resp, _ := r.ReadBinary(0, 1); resp == nil || resp.SW() != SW_CHANNEL_NOT_SUPPORTED {
+		t.Errorf("read on closed channel = %+v, want 6881", resp)
+	}
+}
+
+func TestOpenLogicalChannel_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+		override []byte
+		wantErr  error
+	}{
+		{"No logical channels", 0, nil, ErrChannelNotSupported},
+		{"Instruction unknown", 4, []byte{0x6D, 0x00}, ErrChannelNotSupported},
+		{"Other failure", 4, []byte{0x69, 0x85}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newChannelTestCard(tc.channels)
+			if tc.override != nil {
+				m.Override = func(apdu []byte) []byte {
+					if apdu[1] == INS_MANAGE_CHANNEL {
+						return tc.override
+					}
+					return nil
+				}
+			}
+			r := NewReaderWithTransport("Mock", m.ATR, m)
+			_, err := r.OpenLogicalChannel()
+			if err == nil {
+				t.Fatalf("OpenLogicalChannel() should fail")
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("error = %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr == nil && errors.Is(err, ErrChannelNotSupported) {
+				t.Errorf("error = %v, want a MANAGE CHANNEL failure", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package card
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CurrentDF returns the current directory of the reader's channel as followed through
+// the successful SELECT commands sent so far: "3F00", "3F00/7F10", "3F00/7F10/5F3A",
+// "ADF:<AID>" or "ADF:<AID>/5F3B". It is empty when the directory is unknown (after a
+// reset, on a fresh logical channel, or after a selection the tracker cannot follow).
+//
+// File IDs are classified with the TS 102 221 numbering convention: 3F00 is the MF,
+// 7Fxx a DF under the MF, 5Fxx a DF one level below, 7FFF the current ADF and any
+// other FID an EF, which leaves the current directory unchanged.
+func (r *Reader) CurrentDF() string {
+	return r.dirs[r.channel]
+}
+
+// trackDirectory updates the current directory of the channel apdu was sent on
+func (r *Reader) trackDirectory(apdu, response []byte) {
+	if len(apdu) < 4 || len(response) < 2 || !isInterindustry(apdu[0]) {
+		return
+	}
+	channel := CLAChannel(apdu[0])
+	switch apdu[1] {
+	case INS_MANAGE_CHANNEL:
+		// Opened or closed: the channel starts without a known directory (P2 00 = card assigns)
+		if apdu[3] != 0 {
+			delete(r.dirs, apdu[3])
+		}
+		if len(response) == 3 && response[0] != 0 {
+			delete(r.dirs, response[0])
+		}
+	case INS_SELECT:
+		if !selectSucceeded(response) {
+			return
+		}
+		if r.dirs == nil {
+			r.dirs = map[byte]string{}
+		}
+		r.dirs[channel] = nextDirectory(r.dirs[channel], apdu[2], apduData(apdu))
+	}
+}
+
+// nextDirectory returns the directory after a successful SELECT with p1 and data
+func nextDirectory(current string, p1 byte, data []byte) string {
+	switch p1 {
+	case 0x04:
+		return fmt.Sprintf("ADF:%X", data)
+	case 0x08:
+		return walkDirectory("3F00", data)
+	case 0x09:
+		return walkDirectory(current, data)
+	case 0x03:
+		if i := strings.LastIndex(current, "/"); i > 0 {
+			return current[:i]
+		}
+		return ""
+	case 0x00, 0x01, 0x02:
+		if len(data) != 2 {
+			return ""
+		}
+		return walkDirectory(current, data)
+	}
+	return ""
+}
+
+// walkDirectory applies the FIDs of data (2 bytes each) to dir
+func walkDirectory(dir string, data []byte) string {
+	if len(data)%2 != 0 {
+		return ""
+	}
+	for i := 0; i < len(data); i += 2 {
+		fid := uint16(data[i])<<8 | uint16(data[i+1])
+		switch {
+		case fid == 0x3F00:
+			dir = "3F00"
+		case fid == 0x7FFF:
+			if !strings.HasPrefix(dir, "ADF:") {
+				return ""
+			}
+			dir, _, _ = strings.Cut(dir, "/")
+		case fid>>8 == 0x7F:
+			dir = fmt.Sprintf("3F00/%04X", fid)
+		case fid>>8 == 0x5F:
+			// Second level: below the ADF or the DF under the MF
+			parts := strings.Split(dir, "/")
+			switch {
+			case strings.HasPrefix(dir, "ADF:"):
+				dir = fmt.Sprintf("%s/%04X", parts[0], fid)
+			case len(parts) >= 2:
+				dir = fmt.Sprintf("%s/%s/%04X", parts[0], parts[1], fid)
+			default:
+				return ""
+			}
+		}
+		if dir == "" {
+			return ""
+		}
+	}
+	return dir
+}
@@ -0,0 +1,84 @@
+package card
+
+import "testing"
+
+// ============ CURRENT DIRECTORY TESTS ============
+
+func TestCurrentDF(t *testing.T) {
+	aid := []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02}
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.Channels = 4
+	telecom := m.MF().AddDF(0x7F10)
+	telecom.AddDF(0x5F3A).AddEF(0x4F30, []byte{0x01})
+	telecom.AddEF(0x6F3A, []byte{0x01})
+	adf := m.AddADF(aid)
+	adf.AddEF(0x6F07, []byte{0x01})
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+
+	steps := []struct {
+		name string
+		do   func() (*APDUResponse, error)
+		want string
+	}{
+		{"MF", func() (*APDUResponse, error) { return r.Select([]byte{0x3F, 0x00}) }, "3F00"},
+		{"DF_TELECOM", func() (*APDUResponse, error) { return r.Select([]byte{0x7F, 0x10}) }, "3F00/7F10"},
+		{"EF keeps DF", func() (*APDUResponse, error) { return r.Select([]byte{0x6F, 0x3A}) }, "3F00/7F10"},
+		{"second level", func() (*APDUResponse, error) { return r.Select([]byte{0x5F, 0x3A}) }, "3F00/7F10/5F3A"},
+		{"not found keeps DF", func() (*APDUResponse, error) { return r.Select([]byte{0x6F, 0x99}) }, "3F00/7F10/5F3A"},
+		{"ADF", func() (*APDUResponse, error) { return r.Select(aid) }, "ADF:A0000000871002"},
+		{"path", func() (*APDUResponse, error) { return r.SelectByPath([]byte{0x7F, 0x10, 0x6F, 0x3A}) }, "3F00/7F10"},
+	}
+	for _, s := range steps {
+		resp, err := s.do()
+		if err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if got := r.CurrentDF(); got != s.want {
+			t.Errorf("%s (SW %04X): CurrentDF() = %q, want %q", s.name, resp.SW(), got, s.want)
+		}
+	}
+
+	// A logical channel has its own current directory
+	ch, err := r.OpenLogicalChannel()
+	if err != nil {
+		t.Fatalf("OpenLogicalChannel: %v", err)
+	}
+	r.UseChannel(ch)
+	if got := r.CurrentDF(); got != "" {
+		t.Errorf("new channel CurrentDF() = %q, want unknown", got)
+	}
+	r.Select(aid)
+	r.UseChannel(0)
+	if got := r.CurrentDF(); got != "3F00/7F10" {
+		t.Errorf("basic channel CurrentDF() = %q after select on channel %d", got, ch)
+	}
+
+	if _, err := r.Reconnect(false); err != nil {
+		t.Fatalf("Reconnect: %v", err)
+	}
+	if got := r.CurrentDF(); got != "" {
+		t.Errorf("CurrentDF() after reset = %q, want unknown", got)
+	}
+}
+
+func TestNextDirectory(t *testing.T) {
+	tests := []struct {
+		current string
+		p1      byte
+		data    []byte
+		want    string
+	}{
+		{"ADF:A0", 0x00, []byte{0x5F, 0x3B}, "ADF:A0/5F3B"},
+		{"ADF:A0/5F3B", 0x00, []byte{0x7F, 0xFF}, "ADF:A0"},
+		{"3F00", 0x00, []byte{0x7F, 0xFF}, ""},
+		{"3F00/7F10/5F3A", 0x03, nil, "3F00/7F10"},
+		{"3F00", 0x00, []byte{0x5F, 0x3A}, ""},
+		{"3F00", 0x08, []byte{0x7F, 0x20, 0x5F, 0x40}, "3F00/7F20/5F40"},
+		{"3F00/7F10", 0x02, nil, ""},
+	}
+	for _, tc := range tests {
+		if got := nextDirectory(tc.current, tc.p1, tc.data); got != tc.want {
+			t.Errorf("nextDirectory(%q, %02X, %X) = %q, want %q", tc.current, tc.p1, tc.data, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package card
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDryRun is returned for state-changing GlobalPlatform commands while dry-run is active.
+// Unlike file writes they cannot be simulated (later commands depend on their effect).
+var ErrDryRun = errors.New("refused in dry-run mode")
+
+// DryRunEntry is one state-changing command intercepted in dry-run mode
+type DryRunEntry struct {
+	Command string // Command name (UPDATE BINARY, DELETE, ...)
+	APDU    []byte // Command APDU as it would have been sent
+	Data    []byte // Intended command data
+	Current []byte // Current content at the same offset/record (nil if not readable)
+	Refused bool   // GP command refused with ErrDryRun instead of being simulated
+}
+
+// isoWriteCommands are the interindustry (and GSM class A0) instructions that change card state.
+// The table is shared by dry-run (interception) and read-only mode (blocking).
+var isoWriteCommands = map[byte]string{
+	0x04:              "DEACTIVATE FILE",
+	0x0E:              "ERASE BINARY",
+	0x24:              "CHANGE REFERENCE DATA",
+	0x26:              "DISABLE VERIFICATION",
+	0x28:              "ENABLE VERIFICATION",
+	0x2C:              "RESET RETRY COUNTER",
+	0x32:              "INCREASE",
+	0x44:              "ACTIVATE FILE",
+	0xD0:              "WRITE BINARY",
+	0xD2:              "WRITE RECORD",
+	0xD4:              "RESIZE FILE",
+	0xDA:              "PUT DATA",
+	0xDB:              "PUT DATA",
+	INS_UPDATE_BINARY: "UPDATE BINARY",
+	INS_UPDATE_RECORD: "UPDATE RECORD",
+	0xE0:              "CREATE FILE",
+	0xE2:              "APPEND RECORD",
+	0xE4:              "DELETE FILE",
+	0xE6:              "TERMINATE DF",
+	0xE8:              "TERMINATE EF",
+	0xFE:              "TERMINATE CARD USAGE",
+}
+
+// gpWriteCommands are the GlobalPlatform (proprietary class) instructions that change card state
+var gpWriteCommands = map[byte]string{
+	0xD8: "PUT KEY",
+	0xE2: "STORE DATA",
+	0xE4: "DELETE",
+	0xE6: "INSTALL",
+	0xE8: "LOAD",
+	0xF0: "SET STATUS",
+}
+
+// SetDryRun enables or disables dry-run mode. While enabled, state-changing commands are
+// not sent: ISO writes are logged with the current file content and answered with 9000,
+// GlobalPlatform DELETE/INSTALL/LOAD/PUT KEY/STORE DATA/SET STATUS fail with ErrDryRun.
+// Reads, SELECT and VERIFY are sent normally.
+func (r *Reader) SetDryRun(enabled bool) {
+	r.dryRun = enabled
+	r.dryRunLog = nil
+}
+
+// DryRun reports whether dry-run mode is active
+func (r *Reader) DryRun() bool {
+	return r.dryRun
+}
+
+// DryRunLog returns the commands intercepted since SetDryRun
+func (r *Reader) DryRunLog() []DryRunEntry {
+	return r.dryRunLog
+}
+
+// classifyWrite returns the name of a state-changing command and whether it is a GP command
+func classifyWrite(apdu []byte) (name string, gp, ok bool) {
+	if len(apdu) < 4 {
+		return "", false, false
+	}
+	cla, ins := apdu[0], apdu[1]
+	if cla&0x80 != 0 && cla != 0xA0 {
+		name, ok = gpWriteCommands[ins]
+		return name, true, ok
+	}
+	name, ok = isoWriteCommands[ins]
+	return name, false, ok
+}
+
+// commandData returns the data field of a short or extended command APDU
+func commandData(apdu []byte) []byte {
+	if len(apdu) <= 5 {
+		return nil
+	}
+	if apdu[4] == 0 && len(apdu) >= 7 {
+		lc := int(apdu[5])<<8 | int(apdu[6])
+		if 7+lc <= len(apdu) {
+			return apdu[7 : 7+lc]
+		}
+		return apdu[7:]
+	}
+	lc := int(apdu[4])
+	if 5+lc <= len(apdu) {
+		return apdu[5 : 5+lc]
+	}
+	return apdu[5:]
+}
+
+// interceptWrite handles apdu in dry-run mode. It returns handled=false for commands
+// that do not change card state (these are sent as usual).
+func (r *Reader) interceptWrite(apdu []byte) (response []byte, handled bool, err error) {
+	name, gp, ok := classifyWrite(apdu)
+	if !ok {
+		return nil, false, nil
+	}
+	entry := DryRunEntry{
+		Command: name,
+		APDU:    append([]byte(nil), apdu...),
+		Data:    append([]byte(nil), commandData(apdu)...),
+	}
+	if gp {
+		entry.Refused = true
+		r.dryRunLog = append(r.dryRunLog, entry)
+		return nil, true, fmt.Errorf("%s: %w", name, ErrDryRun)
+	}
+	entry.Current = r.readCurrent(apdu, len(entry.Data))
+	r.dryRunLog = append(r.dryRunLog, entry)
+	return []byte{0x90, 0x00}, true, nil
+}
+
+// readCurrent reads what an UPDATE BINARY / UPDATE RECORD (absolute mode) would overwrite
+func (r *Reader) readCurrent(apdu []byte, length int) []byte {
+	if length == 0 || length > ShortMaxCommandData {
+		return nil
+	}
+	cla, ins, p1, p2 := apdu[0], apdu[1], apdu[2], apdu[3]
+	var read []byte
+	switch {
+	case ins == INS_UPDATE_BINARY && p1&0x80 == 0:
+		read = []byte{cla, INS_READ_BINARY, p1, p2, byte(length)}
+	case ins == INS_UPDATE_RECORD && p2&0x07 == 0x04:
+		read = []byte{cla, INS_READ_RECORD, p1, p2, byte(length)}
+	default:
+		return nil
+	}
+	raw, err := r.Transmit(read)
+	if err != nil || len(raw) < 2 || raw[len(raw)-2] != 0x90 || raw[len(raw)-1] != 0x00 {
+		return nil
+	}
+	return raw[:len(raw)-2]
+}
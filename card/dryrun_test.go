@@ -0,0 +1,100 @@
+package card
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// ============ DRY RUN TESTS ============
+
+func TestClassifyWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		apdu    []byte
+		command string
+		gp      bool
+		ok      bool
+	}{
+		{"UPDATE BINARY", []byte{0x00, 0xD6, 0x00, 0x00, 0x01, 0xAA}, "UPDATE BINARY", false, true},
+		{"GSM UPDATE RECORD", []byte{0xA0, 0xDC, 0x01, 0x04, 0x01, 0xAA}, "UPDATE RECORD", false, true},
+		{"Channel 1 CHANGE PIN", []byte{0x01, 0x24, 0x00, 0x0A, 0x10}, "CHANGE REFERENCE DATA", false, true},
+		{"GP DELETE", []byte{0x84, 0xE4, 0x00, 0x00, 0x04}, "DELETE", true, true},
+		{"GP STORE DATA", []byte{0x80, 0xE2, 0x80, 0x00, 0x01, 0x00}, "STORE DATA", true, true},
+		{"GP PUT KEY", []byte{0x84, 0xD8, 0x00, 0x81, 0x10}, "PUT KEY", true, true},
+		{"APPEND RECORD", []byte{0x00, 0xE2, 0x00, 0x00, 0x01, 0x00}, "APPEND RECORD", false, true},
+		{"READ BINARY", []byte{0x00, 0xB0, 0x00, 0x00, 0x10}, "", false, false},
+		{"SELECT", []byte{0x00, 0xA4, 0x00, 0x04, 0x02, 0x3F, 0x00}, "", false, false},
+		{"VERIFY", []byte{0x00, 0x20, 0x00, 0x0A, 0x08}, "", false, false},
+		{"GP GET STATUS", []byte{0x80, 0xF2, 0x40, 0x00, 0x02, 0x4F, 0x00}, "", true, false},
+		{"GP INITIALIZE UPDATE", []byte{0x80, 0x50, 0x00, 0x00, 0x08}, "", true, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			command, gp, ok := classifyWrite(tc.apdu)
+			if command != tc.command || gp != tc.gp || ok != tc.ok {
+				t.Errorf("classifyWrite(%X) = %q, %v, %v, want %q, %v, %v", tc.apdu, command, gp, ok, tc.command, tc.gp, tc.ok)
+			}
+		})
+	}
+}
+
+func TestDryRun_Writes(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	ef := m.MF().AddEF(0x2FE2, []byte{0x01, 0x02, 0x03, 0x04})
+	rec := m.MF().AddRecordEF(0x6F40, []byte{0x11, 0x11}, []byte{0x22, 0x22})
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	r.SetDryRun(true)
+
+	r.Select([]byte{0x2F, 0xE2})
+	if err := r.WriteAllBinary([]byte{0xAA, 0xBB}); err != nil {
+		t.Fatalf("WriteAllBinary() error = %v", err)
+	}
+	r.Select([]byte{0x6F, 0x40})
+	if resp, err := r.UpdateRecord(2, []byte{0xCC, 0xCC}); err != nil || !resp.IsOK() {
+		t.Fatalf("UpdateRecord() = %v, %v", resp, err)
+	}
+
+	if !bytes.Equal(ef.Data, []byte{0x01, 0x02, 0x03, 0x04}) || !bytes.Equal(rec.Records[1], []byte{0x22, 0x22}) {
+		t.Errorf("card content changed in dry-run: %X / %X", ef.Data, rec.Records)
+	}
+	for _, apdu := range m.Log {
+		if apdu[1] == INS_UPDATE_BINARY || apdu[1] == INS_UPDATE_RECORD {
+			t.Errorf("write %X reached the card", apdu)
+		}
+	}
+
+	log := r.DryRunLog()
+	if len(log) != 2 {
+		t.Fatalf("DryRunLog() has %d entries, want 2", len(log))
+	}
+	if log[0].Command != "UPDATE BINARY" || !bytes.Equal(log[0].Current, []byte{0x01, 0x02}) || !bytes.Equal(log[0].Data, []byte{0xAA, 0xBB}) {
+		t.Errorf("entry 0 = %+v", log[0])
+	}
+	if log[1].Command != "UPDATE RECORD" || !bytes.Equal(log[1].Current, []byte{0x22, 0x22}) || !bytes.Equal(log[1].Data, []byte{0xCC, 0xCC}) {
+		t.Errorf("entry 1 = %+v", log[1])
+	}
+}
+
+func TestDryRun_GPRefused(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	r.SetDryRun(true)
+
+	_, err := r.SendAPDU([]byte{0x80, 0xE4, 0x00, 0x00, 0x07, 0x4F, 0x05, 0xA0, 0x00, 0x00, 0x00, 0x01})
+	if !errors.Is(err, ErrDryRun) {
+		t.Errorf("GP DELETE error = %v, want ErrDryRun", err)
+	}
+	if len(m.Log) != 0 {
+		t.Errorf("GP DELETE reached the card: %X", m.Log)
+	}
+	if log := r.DryRunLog(); len(log) != 1 || !log[0].Refused || log[0].Command != "DELETE" {
+		t.Errorf("DryRunLog() = %+v, want one refused DELETE", log)
+	}
+
+	r.SetDryRun(false)
+	if len(r.DryRunLog()) != 0 {
+		t.Errorf("SetDryRun(false) should clear the log")
+	}
+}
@@ -0,0 +1,362 @@
+package card
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FCP is a decoded SELECT response: the FCP template '62' of ETSI TS 102 221 11.1.1.3
+// (ISO 7816-4 5.3.3). Fields of tags the response does not have keep their zero value;
+// security attributes are kept raw, their meaning depends on the card (see package sim).
+type FCP struct {
+	FileSize      int    // tag 80: EF size in bytes
+	TotalFileSize int    // tag 81: DF/ADF size incl. structural information
+	Descriptor    []byte // tag 82: file descriptor byte, data coding byte, record size, records
+	FileID        uint16 // tag 83
+	HasFileID     bool
+	DFName        []byte // tag 84: AID of an ADF
+	SFI           []byte // tag 88 as received: absent (nil), empty (no SFI) or the SFI in b8-b4
+	HasSFI        bool   // tag 88 present
+	LifeCycle     byte   // tag 8A
+	HasLifeCycle  bool
+
+	SecurityReferenced  []byte // tag 8B: EF_ARR file ID + record, or + SEID/record pairs
+	SecurityCompact     []byte // tag 8C: access mode byte + security conditions
+	SecurityExpanded    []byte // tag AB: access mode / security condition data objects
+	SecurityProprietary []byte // tag 86: card specific
+
+	Proprietary       []byte // tag A5: proprietary information (TLVs, may hold 8B/8C again)
+	PINStatusTemplate []byte // tag C6: PIN status template DO (DFs)
+
+	Raw []byte // the response as received
+}
+
+// File structures returned by FCP.Structure
+const (
+	FCPTransparent = "transparent"
+	FCPLinear      = "linear"
+	FCPCyclic      = "cyclic"
+	FCPBERTLV      = "BER-TLV"
+	FCPDF          = "DF"
+)
+
+// ParseFCP decodes the FCP template of a SELECT response. data is either the whole
+// template ('62' L ...) or its content, e.g. the value of a proprietary A5 object.
+// Lengths may use the long forms 81/82/83. On malformed data an error is returned
+// together with the fields decoded up to that point, so callers that only need one
+// field may use the result anyway.
+func ParseFCP(data []byte) (*FCP, error) {
+	f := &FCP{Raw: data}
+	if len(data) == 0 {
+		return f, fmt.Errorf("empty FCP")
+	}
+
+	body := data
+	var err error
+	if data[0] == 0x62 {
+		length, n := fcpLength(data, 1)
+		if n == 0 {
+			return f, fmt.Errorf("FCP template length missing")
+		}
+		body = data[1+n:]
+		// Some cards announce fewer bytes than they send: everything present is decoded
+		if length != len(body) {
+			err = fmt.Errorf("FCP template length %d, %d bytes present", length, len(body))
+		}
+	}
+
+	for i := 0; i < len(body); {
+		tag := body[i]
+		length, n := fcpLength(body, i+1)
+		start := i + 1 + n
+		if n == 0 || start+length > len(body) {
+			return f, fmt.Errorf("FCP tag %02X truncated at offset %d", tag, i)
+		}
+		f.set(tag, body[start:start+length])
+		i = start + length
+	}
+	return f, err
+}
+
+// set stores the value of one data object of the template
+func (f *FCP) set(tag byte, v []byte) {
+	switch tag {
+	case 0x80:
+		f.FileSize = beUint(v)
+	case 0x81:
+		f.TotalFileSize = beUint(v)
+	case 0x82:
+		f.Descriptor = v
+	case 0x83:
+		if len(v) == 2 {
+			f.FileID, f.HasFileID = uint16(v[0])<<8|uint16(v[1]), true
+		}
+	case 0x84:
+		f.DFName = v
+	case 0x88:
+		f.SFI, f.HasSFI = v, true
+	case 0x8A:
+		if len(v) == 1 {
+			f.LifeCycle, f.HasLifeCycle = v[0], true
+		}
+	case 0x8B:
+		f.SecurityReferenced = v
+	case 0x8C:
+		f.SecurityCompact = v
+	case 0xAB:
+		f.SecurityExpanded = v
+	case 0x86:
+		f.SecurityProprietary = v
+	case 0xA5:
+		f.Proprietary = v
+	case 0xC6:
+		f.PINStatusTemplate = v
+	}
+}
+
+// fcpLength decodes a BER length at data[offset]: the length and the number of length bytes
+// (0 if missing or not supported)
+func fcpLength(data []byte, offset int) (int, int) {
+	if offset >= len(data) {
+		return 0, 0
+	}
+	first := data[offset]
+	if first < 0x80 {
+		return int(first), 1
+	}
+	n := int(first & 0x7F)
+	if n == 0 || n > 3 || offset+n >= len(data) {
+		return 0, 0
+	}
+	return beUint(data[offset+1 : offset+1+n]), 1 + n
+}
+
+// beUint decodes a big-endian unsigned integer
+func beUint(v []byte) int {
+	n := 0
+	for _, b := range v {
+		n = n<<8 | int(b)
+	}
+	return n
+}
+
+// Size returns the file size: tag 80, or tag 81 for cards that only send that one
+func (f *FCP) Size() int {
+	if f.FileSize > 0 {
+		return f.FileSize
+	}
+	return f.TotalFileSize
+}
+
+// Structure returns transparent, linear, cyclic, BER-TLV or DF from the file descriptor
+// byte (TS 102 221 table 11.5), "" if there is none or it is not recognized
+func (f *FCP) Structure() string {
+	if len(f.Descriptor) == 0 {
+		return ""
+	}
+	fd := f.Descriptor[0]
+	switch {
+	case fd&0x3F == 0x39:
+		return FCPBERTLV
+	case fd&0xBF == 0x38:
+		return FCPDF
+	}
+	switch fd & 0x07 {
+	case 0x01:
+		return FCPTransparent
+	case 0x02:
+		return FCPLinear
+	case 0x06:
+		return FCPCyclic
+	}
+	return ""
+}
+
+// IsDF reports whether the FCP describes a DF or an ADF
+func (f *FCP) IsDF() bool {
+	return f.Structure() == FCPDF
+}
+
+// Shareable reports the shareable bit of the file descriptor byte
+func (f *FCP) Shareable() bool {
+	return len(f.Descriptor) > 0 && f.Descriptor[0]&0x40 != 0
+}
+
+// RecordSize returns the record length of a linear fixed or cyclic EF, 0 for other files.
+// Besides the 5-byte descriptor, the 3-byte form descriptor + record length of some
+// cards is accepted.
+func (f *FCP) RecordSize() int {
+	switch d := f.Descriptor; len(d) {
+	case 3:
+		return beUint(d[1:3])
+	case 4, 5:
+		return beUint(d[2:4])
+	}
+	return 0
+}
+
+// NumRecords returns the number of records of a linear fixed or cyclic EF, 0 for other files
+func (f *FCP) NumRecords() int {
+	if len(f.Descriptor) >= 5 {
+		return int(f.Descriptor[4])
+	}
+	return 0
+}
+
+// ShortFileID returns the SFI of an EF. Without tag 88 the SFI is the low 5 bits of the
+// file ID; an empty tag 88 means the EF has no SFI (TS 102 221 11.1.1.4.8).
+func (f *FCP) ShortFileID() (byte, bool) {
+	switch {
+	case !f.HasSFI:
+		if !f.HasFileID || f.IsDF() {
+			return 0, false
+		}
+		sfi := byte(f.FileID & 0x1F)
+		return sfi, sfi != 0
+	case len(f.SFI) == 0:
+		return 0, false
+	}
+	sfi := f.SFI[0] >> 3
+	return sfi, sfi != 0
+}
+
+// LifeCycleString decodes the life cycle status integer (ISO 7816-4 table 13)
+func (f *FCP) LifeCycleString() string {
+	if !f.HasLifeCycle {
+		return ""
+	}
+	switch b := f.LifeCycle; {
+	case b == 0x01:
+		return "creation"
+	case b == 0x03:
+		return "initialisation"
+	case b&0xFD == 0x05:
+		return "operational (activated)"
+	case b&0xFD == 0x04:
+		return "operational (deactivated)"
+	case b&0xFC == 0x0C:
+		return "terminated"
+	}
+	return fmt.Sprintf("%02X", f.LifeCycle)
+}
+
+// SecurityFormat names the security attributes of the FCP: referenced, compact, expanded,
+// proprietary or "" when there are none (also looked up inside A5)
+func (f *FCP) SecurityFormat() string {
+	switch {
+	case f.SecurityCompact != nil:
+		return "compact"
+	case f.SecurityReferenced != nil:
+		return "referenced"
+	case f.SecurityProprietary != nil:
+		return "proprietary"
+	case f.SecurityExpanded != nil:
+		return "expanded"
+	}
+	if p := f.ProprietaryFCP(); p != nil {
+		return p.SecurityFormat()
+	}
+	return ""
+}
+
+// ProprietaryFCP decodes the content of tag A5, which some cards use for their own
+// copy of the security attributes; nil without A5. Other tags inside A5 have their
+// proprietary meaning (80 there is the UICC characteristics byte, not a file size).
+func (f *FCP) ProprietaryFCP() *FCP {
+	if len(f.Proprietary) == 0 {
+		return nil
+	}
+	p, _ := ParseFCP(f.Proprietary)
+	return p
+}
+
+// PINStatus is one key reference of the PIN status template (tag C6)
+type PINStatus struct {
+	Reference byte // key reference: 01 PIN1, 0A ADM1, 81 PIN2, ...
+	Enabled   bool // PS_DO bit of the reference set
+}
+
+// PINs decodes the PIN status template: the PS_DO (90) bitmap, whose bits b8.. map to
+// the key references (83) in order
+func (f *FCP) PINs() []PINStatus {
+	var psDO []byte
+	var pins []PINStatus
+	for i := 0; i+1 < len(f.PINStatusTemplate); {
+		tag, length := f.PINStatusTemplate[i], int(f.PINStatusTemplate[i+1])
+		if i+2+length > len(f.PINStatusTemplate) {
+			break
+		}
+		v := f.PINStatusTemplate[i+2 : i+2+length]
+		switch {
+		case tag == 0x90:
+			psDO = v
+		case tag == 0x83 && length == 1:
+			n := len(pins)
+			enabled := n/8 < len(psDO) && psDO[n/8]&(0x80>>(n%8)) != 0
+			pins = append(pins, PINStatus{Reference: v[0], Enabled: enabled})
+		}
+		i += 2 + length
+	}
+	return pins
+}
+
+// String returns a readable dump of the FCP, one data object per line
+func (f *FCP) String() string {
+	var sb strings.Builder
+	line := func(name, format string, args ...any) {
+		fmt.Fprintf(&sb, "%-22s "+format+"\n", append([]any{name + ":"}, args...)...)
+	}
+	if len(f.Descriptor) > 0 {
+		desc := f.Structure()
+		if n := f.NumRecords(); n > 0 {
+			desc += fmt.Sprintf(", %d records of %d bytes", n, f.RecordSize())
+		}
+		if f.Shareable() {
+			desc += ", shareable"
+		}
+		line("File descriptor", "%X (%s)", f.Descriptor, desc)
+	}
+	if f.HasFileID {
+		line("File ID", "%04X", f.FileID)
+	}
+	if len(f.DFName) > 0 {
+		line("DF name", "%X", f.DFName)
+	}
+	if f.FileSize > 0 {
+		line("File size", "%d", f.FileSize)
+	}
+	if f.TotalFileSize > 0 {
+		line("Total file size", "%d", f.TotalFileSize)
+	}
+	if sfi, ok := f.ShortFileID(); ok && f.HasSFI {
+		line("SFI", "%02X", sfi)
+	} else if f.HasSFI {
+		line("SFI", "none")
+	}
+	if f.HasLifeCycle {
+		line("Life cycle", "%02X (%s)", f.LifeCycle, f.LifeCycleString())
+	}
+	if f.SecurityReferenced != nil {
+		line("Security (referenced)", "%X", f.SecurityReferenced)
+	}
+	if f.SecurityCompact != nil {
+		line("Security (compact)", "%X", f.SecurityCompact)
+	}
+	if f.SecurityExpanded != nil {
+		line("Security (expanded)", "%X", f.SecurityExpanded)
+	}
+	if f.SecurityProprietary != nil {
+		line("Security (proprietary)", "%X", f.SecurityProprietary)
+	}
+	if f.Proprietary != nil {
+		line("Proprietary", "%X", f.Proprietary)
+	}
+	for _, p := range f.PINs() {
+		state := "disabled"
+		if p.Enabled {
+			state = "enabled"
+		}
+		line("PIN", "%02X %s", p.Reference, state)
+	}
+	return sb.String()
+}
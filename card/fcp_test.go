@@ -0,0 +1,194 @@
+package card
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// ============ FCP TESTS ============
+
+// fcpBytes decodes a hex FCP with optional spaces
+func fcpBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+// fcpCorpus holds SELECT responses of real cards and the FCPs of the TS 48 reference
+// profile (esim/test_data_test.go), whose SAIP fileDescriptor encodes the FCP data objects
+// with the same tags.
+var fcpCorpus = []struct {
+	name       string
+	hex        string
+	fileID     uint16
+	structure  string
+	size       int
+	recordSize int
+	records    int
+	sfi        int // -1: no SFI
+	lifeCycle  string
+	security   string
+}{
+	{"Card EF_IMSI", "62 19 82 02 41 21 83 02 6F 07 A5 03 80 01 71 8A 01 05 8B 03 6F 06 02 80 02 00 09",
+		0x6F07, FCPTransparent, 9, 0, 0, 0x07, "operational (activated)", "referenced"},
+	{"Card EF_SMS linear fixed", "62 19 82 05 42 21 00 B0 0A 83 02 6F 3C 8A 01 05 8B 03 6F 06 04 80 02 06 E0 88 00",
+		0x6F3C, FCPLinear, 1760, 176, 10, -1, "operational (activated)", "referenced"},
+	{"Card compact security", "62 11 82 02 41 21 83 02 6F 07 8C 03 03 00 0A 80 02 00 09",
+		0x6F07, FCPTransparent, 9, 0, 0, 0x07, "", "compact"},
+	{"Card long template length", "62 81 0C 82 02 41 21 83 02 2F E2 80 02 00 0A",
+		0x2FE2, FCPTransparent, 10, 0, 0, 0x02, "", ""},
+	{"Card cyclic EF", "62 16 82 05 46 21 00 0E 05 83 02 6F 39 8A 01 04 8C 03 03 0A 01 80 01 46",
+		0x6F39, FCPCyclic, 70, 14, 5, 0x19, "operational (deactivated)", "compact"},
+	{"Profile EF with SFI 04", "62 1A 82 04 42 21 00 14 83 02 4F 19 8B 03 2F 06 07 80 01 C8 88 01 20 A5 03 C0 01 40",
+		0x4F19, FCPLinear, 200, 20, 0, 0x04, "", "referenced"},
+	{"Profile transparent EF without SFI", "62 17 82 02 41 21 83 02 4F 03 8B 03 2F 06 0A 80 01 64 88 00 A5 03 C0 01 40",
+		0x4F03, FCPTransparent, 100, 0, 0, -1, "", "referenced"},
+	{"Profile BER-TLV EF", "62 16 82 02 79 21 83 02 4F 02 8B 03 2F 06 0A 80 02 04 00 A5 03 C0 01 40",
+		0x4F02, FCPBERTLV, 1024, 0, 0, 0x02, "", "referenced"},
+	{"Profile DF", "62 13 82 02 78 21 83 02 5F 3E 8B 03 2F 06 01 C6 04 81 01 0A 0B",
+		0x5F3E, FCPDF, 0, 0, 0, -1, "", "referenced"},
+	{"Profile EF_DIR", "62 15 82 04 42 21 00 21 83 02 2F 00 8A 01 05 8B 03 2F 06 02 80 01 84",
+		0x2F00, FCPLinear, 132, 33, 0, -1, "operational (activated)", "referenced"},
+	{"Profile EF_ARR", "62 19 82 04 42 21 00 2E 83 02 2F 06 8A 01 05 8B 03 2F 06 02 80 02 02 B2 88 01 30",
+		0x2F06, FCPLinear, 690, 46, 0, 0x06, "operational (activated)", "referenced"},
+}
+
+func TestParseFCP_Corpus(t *testing.T) {
+	for _, tc := range fcpCorpus {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ParseFCP(fcpBytes(t, tc.hex))
+			if err != nil {
+				t.Fatalf("ParseFCP() error = %v", err)
+			}
+			if !f.HasFileID || f.FileID != tc.fileID {
+				t.Errorf("FileID = %04X (%v), want %04X", f.FileID, f.HasFileID, tc.fileID)
+			}
+			if got := f.Structure(); got != tc.structure {
+				t.Errorf("Structure() = %q, want %q", got, tc.structure)
+			}
+			if got := f.Size(); got != tc.size {
+				t.Errorf("Size() = %d, want %d", got, tc.size)
+			}
+			if got := f.RecordSize(); got != tc.recordSize {
+				t.Errorf("RecordSize() = %d, want %d", got, tc.recordSize)
+			}
+			if got := f.NumRecords(); got != tc.records {
+				t.Errorf("NumRecords() = %d, want %d", got, tc.records)
+			}
+			sfi, ok := f.ShortFileID()
+			if tc.sfi < 0 && ok || tc.sfi >= 0 && (!ok || int(sfi) != tc.sfi) {
+				t.Errorf("ShortFileID() = %02X, %v, want %d", sfi, ok, tc.sfi)
+			}
+			if got := f.LifeCycleString(); got != tc.lifeCycle {
+				t.Errorf("LifeCycleString() = %q, want %q", got, tc.lifeCycle)
+			}
+			if got := f.SecurityFormat(); got != tc.security {
+				t.Errorf("SecurityFormat() = %q, want %q", got, tc.security)
+			}
+		})
+	}
+}
+
+func TestParseFCP_ADF(t *testing.T) {
+	// ADF_USIM: DF name, PIN1 disabled, PIN2 enabled, ADM1 enabled
+	f, err := ParseFCP(fcpBytes(t, "62 2C 82 02 78 21 84 10 A0 00 00 00 87 10 02 FF 49 FF 05 89 04 0B 00 FF "+
+		"8A 01 05 8B 03 2F 06 02 C6 0C 90 01 60 83 01 01 83 01 81 83 01 0A"))
+	if err != nil {
+		t.Fatalf("ParseFCP() error = %v", err)
+	}
+	if !f.IsDF() || f.HasFileID {
+		t.Errorf("IsDF() = %v, HasFileID = %v", f.IsDF(), f.HasFileID)
+	}
+	if got := hex.EncodeToString(f.DFName); got != "a0000000871002ff49ff0589040b00ff" {
+		t.Errorf("DFName = %s", got)
+	}
+	if _, ok := f.ShortFileID(); ok {
+		t.Error("ShortFileID() reported an SFI for an ADF")
+	}
+	want := []PINStatus{{0x01, false}, {0x81, true}, {0x0A, true}}
+	pins := f.PINs()
+	if len(pins) != len(want) {
+		t.Fatalf("PINs() = %+v, want %+v", pins, want)
+	}
+	for i := range want {
+		if pins[i] != want[i] {
+			t.Errorf("PINs()[%d] = %+v, want %+v", i, pins[i], want[i])
+		}
+	}
+}
+
+func TestParseFCP_ProprietaryFCP(t *testing.T) {
+	f, err := ParseFCP(fcpBytes(t, "62 0E 82 02 41 21 83 02 6F 07 A5 04 8C 02 01 0A"))
+	if err != nil {
+		t.Fatalf("ParseFCP() error = %v", err)
+	}
+	p := f.ProprietaryFCP()
+	if p == nil || len(p.SecurityCompact) != 2 || p.SecurityCompact[1] != 0x0A {
+		t.Fatalf("ProprietaryFCP() = %+v", p)
+	}
+	if got := f.SecurityFormat(); got != "compact" {
+		t.Errorf("SecurityFormat() = %q, want compact from A5", got)
+	}
+	if (&FCP{}).ProprietaryFCP() != nil {
+		t.Error("ProprietaryFCP() without A5 should be nil")
+	}
+}
+
+func TestParseFCP_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		hex      string
+		wantSize int // fields decoded before the error
+	}{
+		{"Empty", "", 0},
+		{"Template length missing", "62", 0},
+		{"Truncated data object", "62 08 80 02 00 09 82 04 41", 9},
+		{"Card EF_IMSI, template length too short", "62 17 82 02 41 21 83 02 6F 07 A5 03 80 01 71 8A 01 05 8B 03 6F 06 02 80 02 00 09", 9},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ParseFCP(fcpBytes(t, tc.hex))
+			if err == nil {
+				t.Fatal("ParseFCP() expected error")
+			}
+			if f == nil || f.Size() != tc.wantSize {
+				t.Errorf("partial FCP = %+v, want size %d", f, tc.wantSize)
+			}
+		})
+	}
+}
+
+func TestParseFCP_ContentWithoutTemplate(t *testing.T) {
+	f, err := ParseFCP(fcpBytes(t, "82 02 41 21 83 02 6F 07 80 02 00 09"))
+	if err != nil {
+		t.Fatalf("ParseFCP() error = %v", err)
+	}
+	if f.FileID != 0x6F07 || f.Size() != 9 {
+		t.Errorf("FCP = %+v", f)
+	}
+}
+
+func TestFCPString(t *testing.T) {
+	f, _ := ParseFCP(fcpBytes(t, "62 19 82 05 42 21 00 B0 0A 83 02 6F 3C 8A 01 05 8B 03 6F 06 04 80 02 06 E0 88 00"))
+	got := f.String()
+	for _, want := range []string{
+		"File descriptor:", "linear, 10 records of 176 bytes, shareable",
+		"File ID:", "6F3C",
+		"File size:", "1760",
+		"SFI:", "none",
+		"Life cycle:", "05 (operational (activated))",
+		"Security (referenced):", "6F0604",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("String() missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "\n") != 6 {
+		t.Errorf("String() = %d lines, want one per data object:\n%s", strings.Count(got, "\n"), got)
+	}
+}
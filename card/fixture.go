@@ -0,0 +1,497 @@
+package card
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Fixture is a card image captured from a real card (read --dump --dump-format fixture)
+// that NewMockCardFromFixture turns back into a simulated card. It holds what each
+// successful read returned, keyed by the selection path, and the key each read needed.
+type Fixture struct {
+	ATR     string `json:"atr"`
+	Source  string `json:"source,omitempty"`
+	Created string `json:"created,omitempty"`
+	// SelectAIDP2 is the response option (hex P2) the card accepted for SELECT by AID
+	// after rejecting P2=04; the simulated card rejects every other option
+	SelectAIDP2 string        `json:"select_aid_p2,omitempty"`
+	Files       []FixtureFile `json:"files"`
+}
+
+// FixtureFile is one EF and what reading it returned
+type FixtureFile struct {
+	App      string   `json:"app,omitempty"`      // AID of the ADF the path starts from (hex), empty for the MF
+	Path     string   `json:"path"`               // FIDs from the MF (3F00/7F10/6FE5) or the ADF (7FFF/6F07)
+	Data     string   `json:"data,omitempty"`     // Transparent EF content (hex)
+	Records  []string `json:"records,omitempty"`  // Linear fixed EF records (hex), record 1 first
+	Requires string   `json:"requires,omitempty"` // Key that had to be verified to read (PIN1, ADM1...)
+	SW       string   `json:"sw,omitempty"`       // Status word of a read that never succeeded (e.g. 6982)
+}
+
+// SaveFixture writes a fixture as JSON
+func SaveFixture(path string, f *Fixture) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// LoadFixture reads a fixture saved with SaveFixture
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// keyRefNames names the VERIFY key references stored in FixtureFile.Requires
+var keyRefNames = map[byte]string{
+	PIN_CHV1:      "PIN1",
+	PIN_CHV2:      "PIN2",
+	PIN_PIN2:      "PIN2",
+	PIN_ADM1:      "ADM1",
+	PIN_ADM2:      "ADM2",
+	PIN_ADM3:      "ADM3",
+	PIN_ADM4:      "ADM4",
+	0x0E:          "ADM5",
+	PIN_UNIVERSAL: "Universal PIN",
+}
+
+// KeyRefName returns the name of a VERIFY key reference (ADM1 for 0A), or its hex value
+func KeyRefName(ref byte) string {
+	if name, ok := keyRefNames[ref]; ok {
+		return name
+	}
+	return fmt.Sprintf("%02X", ref)
+}
+
+// ParseKeyRef parses a key name returned by KeyRefName
+func ParseKeyRef(name string) (byte, error) {
+	for _, ref := range []byte{PIN_CHV1, PIN_PIN2, PIN_ADM1, PIN_ADM2, PIN_ADM3, PIN_ADM4, 0x0E, PIN_UNIVERSAL} {
+		if strings.EqualFold(keyRefNames[ref], name) {
+			return ref, nil
+		}
+	}
+	b, err := hex.DecodeString(name)
+	if err != nil || len(b) != 1 {
+		return 0, fmt.Errorf("unknown key reference %q", name)
+	}
+	return b[0], nil
+}
+
+// WithFixtureRecording records every SELECT and read so that Fixture can return a card image
+func WithFixtureRecording() ConnectOption {
+	return func(r *Reader) {
+		r.fixture = newFixtureRecorder()
+	}
+}
+
+// Fixture returns the card image recorded since the reader was opened with
+// WithFixtureRecording, or nil when recording is off
+func (r *Reader) Fixture() *Fixture {
+	if r.fixture == nil {
+		return nil
+	}
+	f := r.fixture.build(fmt.Sprintf("%X", r.atr))
+	if p2, ok := r.AIDSelectP2(); ok && p2 != 0x04 {
+		f.SelectAIDP2 = fmt.Sprintf("%02X", p2)
+	}
+	return f
+}
+
+// fixtureLocation is the current file of a logical channel
+type fixtureLocation struct {
+	app        string   // AID of the selected ADF (hex), empty under the MF
+	path       []uint16 // FIDs below the MF or ADF
+	fcp        []byte   // FCP of the current file, from the SELECT or its GET RESPONSE
+	fcpPending bool
+}
+
+// fixtureEF is an EF seen by the recorder
+type fixtureEF struct {
+	app      string
+	path     string
+	data     []byte
+	records  map[int][]byte
+	read     bool   // A read succeeded
+	deniedSW uint16 // Status word of a failed read
+	denied   bool   // A read failed with 6982 before one succeeded
+	requires byte
+}
+
+// fixtureRecorder tracks selections and security state per logical channel
+type fixtureRecorder struct {
+	channels map[byte]*fixtureLocation
+	verified map[byte]bool
+	files    map[string]*fixtureEF
+	order    []string
+}
+
+func newFixtureRecorder() *fixtureRecorder {
+	return &fixtureRecorder{
+		channels: map[byte]*fixtureLocation{},
+		verified: map[byte]bool{},
+		files:    map[string]*fixtureEF{},
+	}
+}
+
+// reset forgets the selections and verified keys (card reset)
+func (fr *fixtureRecorder) reset() {
+	fr.channels = map[byte]*fixtureLocation{}
+	fr.verified = map[byte]bool{}
+}
+
+// isFixtureDF reports whether a FID names a DF (3F MF, 7F first level, 5F second level)
+func isFixtureDF(fid uint16) bool {
+	hi := byte(fid >> 8)
+	return hi == 0x3F || hi == 0x7F || hi == 0x5F
+}
+
+// observe records one exchange; apdu carries the logical channel in its CLA
+func (fr *fixtureRecorder) observe(apdu, response []byte) {
+	if len(apdu) < 4 || len(response) < 2 || apdu[0]&0x80 != 0 {
+		return
+	}
+	ch := CLAChannel(apdu[0])
+	loc := fr.channels[ch]
+	if loc == nil {
+		loc = &fixtureLocation{}
+		fr.channels[ch] = loc
+	}
+	sw := uint16(response[len(response)-2])<<8 | uint16(response[len(response)-1])
+	data := response[:len(response)-2]
+
+	switch apdu[1] {
+	case INS_SELECT:
+		fr.observeSelect(loc, apdu, data, sw)
+	case INS_GET_RESPONSE:
+		if loc.fcpPending && sw == SW_OK {
+			loc.fcp = append([]byte(nil), data...)
+			if name := fcpDFName(data); loc.app != "" && len(loc.path) == 0 && len(name) > 0 {
+				loc.app = fmt.Sprintf("%X", name)
+			}
+		}
+		loc.fcpPending = false
+	case INS_VERIFY:
+		if len(apduData(apdu)) > 0 {
+			fr.verified[apdu[3]] = sw == SW_OK
+		}
+	case INS_READ_BINARY:
+		ef := fr.current(loc)
+		if ef == nil || apdu[2]&0x80 != 0 { // SFI reads select another file
+			return
+		}
+		if sw != SW_OK {
+			fr.deny(ef, sw)
+			return
+		}
+		offset := int(apdu[2])<<8 | int(apdu[3])
+		if end := offset + len(data); end > len(ef.data) {
+			ef.data = append(ef.data, make([]byte, end-len(ef.data))...)
+		}
+		copy(ef.data[offset:], data)
+		fr.granted(ef, loc)
+	case INS_READ_RECORD:
+		ef := fr.current(loc)
+		if ef == nil || apdu[3]&0x07 != RecordModeAbsolute || apdu[2] == 0 {
+			return
+		}
+		if sw != SW_OK {
+			fr.deny(ef, sw)
+			return
+		}
+		if ef.records == nil {
+			ef.records = map[int][]byte{}
+		}
+		ef.records[int(apdu[2])] = append([]byte(nil), data...)
+		fr.granted(ef, loc)
+	}
+}
+
+// observeSelect moves the channel location; relative FIDs follow the 7F/5F/6F/4F convention
+func (fr *fixtureRecorder) observeSelect(loc *fixtureLocation, apdu, data []byte, sw uint16) {
+	ok := sw == SW_OK || byte(sw>>8) == 0x61
+	if !ok {
+		return
+	}
+	target := apduData(apdu)
+	switch apdu[2] {
+	case 0x04: // by AID: the FCP DF name (84) holds the full AID of a partial selection
+		loc.app = fmt.Sprintf("%X", target)
+		if name := fcpDFName(data); len(name) > 0 {
+			loc.app = fmt.Sprintf("%X", name)
+		}
+		loc.path = nil
+	case 0x08: // by path from the MF
+		loc.app, loc.path = "", nil
+		for i := 0; i+1 < len(target); i += 2 {
+			if fid := uint16(target[i])<<8 | uint16(target[i+1]); fid != 0x3F00 || i > 0 {
+				loc.path = append(loc.path, fid)
+			}
+		}
+	case 0x00:
+		if len(target) != 2 {
+			return
+		}
+		fid := uint16(target[0])<<8 | uint16(target[1])
+		switch {
+		case fid == 0x3F00:
+			loc.app, loc.path = "", nil
+		case fid == 0x7FFF:
+			loc.path = nil
+		default:
+			// Re-selecting a DF on the path goes back to it; a new file replaces the current EF
+			for i, p := range loc.path {
+				if p == fid {
+					loc.path = loc.path[:i]
+					break
+				}
+			}
+			if n := len(loc.path); n > 0 && !isFixtureDF(loc.path[n-1]) {
+				loc.path = loc.path[:n-1]
+			}
+			loc.path = append(loc.path, fid)
+		}
+	default:
+		return
+	}
+	loc.fcp = append([]byte(nil), data...)
+	loc.fcpPending = byte(sw>>8) == 0x61
+}
+
+// current returns the recorded EF for the channel's current file (nil for a DF)
+func (fr *fixtureRecorder) current(loc *fixtureLocation) *fixtureEF {
+	if len(loc.path) == 0 || isFixtureDF(loc.path[len(loc.path)-1]) {
+		return nil
+	}
+	parts := []string{"3F00"}
+	if loc.app != "" {
+		parts = []string{"7FFF"}
+	}
+	for _, fid := range loc.path {
+		parts = append(parts, fmt.Sprintf("%04X", fid))
+	}
+	path := strings.Join(parts, "/")
+	key := loc.app + ":" + path
+	ef := fr.files[key]
+	if ef == nil {
+		ef = &fixtureEF{app: loc.app, path: path}
+		fr.files[key] = ef
+		fr.order = append(fr.order, key)
+	}
+	return ef
+}
+
+func (fr *fixtureRecorder) deny(ef *fixtureEF, sw uint16) {
+	if ef.read {
+		return
+	}
+	ef.deniedSW = sw
+	if sw == SW_SECURITY_NOT_SATISFIED {
+		ef.denied = true
+	}
+}
+
+// granted records a successful read and the key it needed: the read condition from the
+// compact security attributes when that key is verified, or, when the file was refused
+// before, the most privileged key verified now
+func (fr *fixtureRecorder) granted(ef *fixtureEF, loc *fixtureLocation) {
+	ef.read = true
+	if ef.requires != 0 {
+		return
+	}
+	if ref, ok := compactReadCondition(loc.fcp); ok && fr.verified[ref] {
+		ef.requires = ref
+		return
+	}
+	if !ef.denied {
+		return
+	}
+	for _, ref := range []byte{0x0E, PIN_ADM4, PIN_ADM3, PIN_ADM2, PIN_ADM1, PIN_PIN2, PIN_CHV2, PIN_UNIVERSAL, PIN_CHV1} {
+		if fr.verified[ref] {
+			ef.requires = ref
+			return
+		}
+	}
+}
+
+// fcpDFName returns the DF name (tag 84) of an FCP, nil for EFs
+func fcpDFName(fcp []byte) []byte {
+	f, _ := ParseFCP(fcp)
+	return f.DFName
+}
+
+// compactReadCondition returns the key reference of the READ condition in the compact
+// security attributes (tag 8C) of an FCP. Condition bytes follow the access mode byte in
+// the order b7..b1 (ISO 7816-4); READ is b1 for EFs.
+func compactReadCondition(fcp []byte) (byte, bool) {
+	f, _ := ParseFCP(fcp)
+	sa := f.SecurityCompact
+	if len(sa) < 2 || sa[0]&0x01 == 0 {
+		return 0, false
+	}
+	idx := 1
+	for bit := 6; bit >= 1; bit-- {
+		if sa[0]&(1<<bit) != 0 {
+			idx++
+		}
+	}
+	if idx >= len(sa) {
+		return 0, false
+	}
+	sc := sa[idx]
+	if sc == 0x00 || sc == 0xFF {
+		return 0, false
+	}
+	return sc, true
+}
+
+// build returns the recorded EFs in the order they were first selected
+func (fr *fixtureRecorder) build(atr string) *Fixture {
+	f := &Fixture{ATR: atr}
+	for _, key := range fr.order {
+		ef := fr.files[key]
+		if !ef.read && ef.deniedSW == 0 {
+			continue // Selected but never read
+		}
+		file := FixtureFile{App: ef.app, Path: ef.path}
+		switch {
+		case !ef.read:
+			file.SW = fmt.Sprintf("%04X", ef.deniedSW)
+		case ef.records != nil:
+			file.Records = fixtureRecords(ef.records)
+		default:
+			file.Data = fmt.Sprintf("%X", ef.data)
+		}
+		if ef.requires != 0 {
+			file.Requires = KeyRefName(ef.requires)
+		}
+		f.Files = append(f.Files, file)
+	}
+	return f
+}
+
+// fixtureRecords lists records 1..n; records that were not read are filled with FF
+func fixtureRecords(records map[int][]byte) []string {
+	nums := make([]int, 0, len(records))
+	for n := range records {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	size := len(records[nums[0]])
+	out := make([]string, nums[len(nums)-1])
+	for i := range out {
+		rec, ok := records[i+1]
+		if !ok {
+			rec = bytes.Repeat([]byte{0xFF}, size)
+		}
+		out[i] = fmt.Sprintf("%X", rec)
+	}
+	return out
+}
+
+// NewMockCardFromFixture builds a simulated card from a fixture. Files that needed a key
+// answer 6982 to READ until it is verified; set the key values in MockCard.Keys.
+// Files whose read failed answer the recorded status word.
+func NewMockCardFromFixture(f *Fixture) (*MockCard, error) {
+	atr, err := hex.DecodeString(f.ATR)
+	if err != nil {
+		return nil, fmt.Errorf("fixture ATR: %w", err)
+	}
+	m := NewMockCard(atr)
+	if f.SelectAIDP2 != "" {
+		p2, err := hex.DecodeString(f.SelectAIDP2)
+		if err != nil || len(p2) != 1 {
+			return nil, fmt.Errorf("fixture: invalid select_aid_p2 %q", f.SelectAIDP2)
+		}
+		m.AIDSelectP2 = p2
+	}
+	for _, file := range f.Files {
+		ef, err := m.addFixtureFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("fixture %s: %w", file.Path, err)
+		}
+		if file.Requires != "" {
+			if ef.ReadKey, err = ParseKeyRef(file.Requires); err != nil {
+				return nil, fmt.Errorf("fixture %s: %w", file.Path, err)
+			}
+		}
+		if file.SW != "" {
+			sw, err := hex.DecodeString(file.SW)
+			if err != nil || len(sw) != 2 {
+				return nil, fmt.Errorf("fixture %s: invalid SW %q", file.Path, file.SW)
+			}
+			ef.ReadSW = uint16(sw[0])<<8 | uint16(sw[1])
+		}
+	}
+	return m, nil
+}
+
+// addFixtureFile creates the DFs on the path of a fixture file and the EF itself
+func (m *MockCard) addFixtureFile(file FixtureFile) (*MockFile, error) {
+	parts := strings.Split(file.Path, "/")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("path needs a root and an EF")
+	}
+	fids := make([]uint16, len(parts))
+	for i, p := range parts {
+		b, err := hex.DecodeString(p)
+		if err != nil || len(b) != 2 {
+			return nil, fmt.Errorf("invalid FID %q", p)
+		}
+		fids[i] = uint16(b[0])<<8 | uint16(b[1])
+	}
+
+	dir := m.mf
+	if file.App != "" {
+		aid, err := hex.DecodeString(file.App)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AID %q", file.App)
+		}
+		dir = nil
+		for _, c := range m.mf.Children {
+			if bytes.Equal(c.AID, aid) {
+				dir = c
+			}
+		}
+		if dir == nil {
+			dir = m.AddADF(aid)
+		}
+	}
+	for _, fid := range fids[1 : len(fids)-1] {
+		next := dir.child(fid)
+		if next == nil {
+			next = dir.AddDF(fid)
+		}
+		dir = next
+	}
+
+	fid := fids[len(fids)-1]
+	if file.Records != nil {
+		records := make([][]byte, len(file.Records))
+		for i, r := range file.Records {
+			rec, err := hex.DecodeString(r)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %w", i+1, err)
+			}
+			records[i] = rec
+		}
+		return dir.AddRecordEF(fid, records...), nil
+	}
+	data, err := hex.DecodeString(file.Data)
+	if err != nil {
+		return nil, fmt.Errorf("data: %w", err)
+	}
+	return dir.AddEF(fid, data), nil
+}
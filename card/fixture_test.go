@@ -0,0 +1,164 @@
+package card
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// ============ FIXTURE TESTS ============
+
+var fixtureUSIM = []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02, 0xFF, 0x49}
+
+// newFixtureSourceCard returns a card with an ADM1-protected EF_IMSI (declared in the FCP),
+// an ADM1-protected EF_KEYS (refused without FCP security attributes), a PIN-less EF_DIR
+// and an EF that can never be read
+func newFixtureSourceCard() *MockCard {
+	m := NewMockCard([]byte{0x3B, 0x9F, 0x95})
+	m.Keys[PIN_ADM1] = []byte("12345678")
+	m.MF().AddRecordEF(0x2F00,
+		[]byte{0x61, 0x0E, 0x4F, 0x09, 0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02, 0xFF, 0x49, 0x50, 0x01, 0x55},
+		[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	m.MF().AddEF(0x2FE2, []byte{0x98, 0x10, 0x32, 0x54})
+	adf := m.AddADF(fixtureUSIM)
+	imsi := adf.AddEF(0x6F07, []byte{0x08, 0x09, 0x10, 0x10, 0x10, 0x32, 0x54, 0x76, 0x98})
+	imsi.Security = []byte{0x03, 0x0A, 0x0A} // UPDATE and READ: ADM1
+	imsi.ReadKey = PIN_ADM1
+	adf.AddDF(0x5FC0).AddEF(0x6F06, []byte{0x01, 0x02}).ReadKey = PIN_ADM1
+	adf.AddEF(0x6FFF, []byte{0x00}).ReadSW = SW_SECURITY_NOT_SATISFIED
+	return m
+}
+
+func TestFixtureRecording(t *testing.T) {
+	src := newFixtureSourceCard()
+	reader := NewReaderWithTransport("Mock", src.ATR, src, WithFixtureRecording())
+
+	reader.Select([]byte{0x3F, 0x00})
+	reader.Select([]byte{0x2F, 0x00})
+	reader.ReadRecord(1, 16)
+	reader.Select([]byte{0x2F, 0xE2})
+	reader.ReadBinary(0, 2)
+	reader.ReadBinary(2, 2)
+	reader.Select(fixtureUSIM[:7])
+	reader.Select([]byte{0x5F, 0xC0})
+	reader.Select([]byte{0x6F, 0x06})
+	if resp, _ := reader.ReadBinary(0, 2); resp.SW() != SW_SECURITY_NOT_SATISFIED {
+		t.Fatalf("EF_KEYS before ADM = %04X", resp.SW())
+	}
+	if resp, _ := reader.VerifyPIN(PIN_ADM1, []byte("12345678")); !resp.IsOK() {
+		t.Fatalf("VERIFY ADM1 = %04X", resp.SW())
+	}
+	reader.ReadBinary(0, 2)
+	reader.Select([]byte{0x7F, 0xFF})
+	reader.Select([]byte{0x6F, 0x07})
+	reader.ReadBinary(0, 9)
+	reader.Select([]byte{0x6F, 0xFF})
+	reader.ReadBinary(0, 1)
+
+	fixture := reader.Fixture()
+	want := []FixtureFile{
+		{Path: "3F00/2F00", Records: []string{"610E4F09A0000000871002FF49500155"}},
+		{Path: "3F00/2FE2", Data: "98103254"},
+		{App: "A0000000871002FF49", Path: "7FFF/5FC0/6F06", Data: "0102", Requires: "ADM1"},
+		{App: "A0000000871002FF49", Path: "7FFF/6F07", Data: "080910101032547698", Requires: "ADM1"},
+		{App: "A0000000871002FF49", Path: "7FFF/6FFF", SW: "6982"},
+	}
+	if fixture.ATR != "3B9F95" || len(fixture.Files) != len(want) {
+		t.Fatalf("Fixture() = %+v", fixture)
+	}
+	for i, w := range want {
+		got := fixture.Files[i]
+		if got.App != w.App || got.Path != w.Path || got.Data != w.Data || got.Requires != w.Requires || got.SW != w.SW ||
+			len(got.Records) != len(w.Records) || (len(w.Records) > 0 && got.Records[0] != w.Records[0]) {
+			t.Errorf("file %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	if reader := NewReaderWithTransport("Mock", src.ATR, src); reader.Fixture() != nil {
+		t.Error("Fixture() without WithFixtureRecording should be nil")
+	}
+}
+
+func TestNewMockCardFromFixture(t *testing.T) {
+	fixture := &Fixture{
+		ATR: "3B9F95",
+		Files: []FixtureFile{
+			{Path: "3F00/2F00", Records: []string{"610E4F09A0000000871002FF49500155"}},
+			{Path: "3F00/7F10/6FE5", Data: "8003414243"},
+			{App: "A0000000871002FF49", Path: "7FFF/6F07", Data: "080910101032547698", Requires: "ADM1"},
+			{App: "A0000000871002FF49", Path: "7FFF/6FFF", SW: "6A82"},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "card.json")
+	if err := SaveFixture(path, fixture); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFixture(path)
+	if err != nil {
+		t.Fatalf("LoadFixture() error = %v", err)
+	}
+	m, err := NewMockCardFromFixture(loaded)
+	if err != nil {
+		t.Fatalf("NewMockCardFromFixture() error = %v", err)
+	}
+	m.Keys[PIN_ADM1] = []byte("12345678")
+	reader := NewReaderWithTransport("Mock", m.ATR, m)
+
+	reader.SelectByPath([]byte{0x7F, 0x10, 0x6F, 0xE5})
+	if resp, _ := reader.ReadBinary(0, 5); !resp.IsOK() || resp.Data[2] != 'A' {
+		t.Errorf("DF_TELECOM/6FE5 = %X %04X", resp.Data, resp.SW())
+	}
+	reader.Select([]byte{0x3F, 0x00})
+	reader.Select([]byte{0x2F, 0x00})
+	if resp, _ := reader.ReadRecord(1, 16); !resp.IsOK() {
+		t.Errorf("EF_DIR record 1 = %04X", resp.SW())
+	}
+
+	reader.Select(fixtureUSIM[:7])
+	reader.Select([]byte{0x6F, 0x07})
+	if resp, _ := reader.ReadBinary(0, 9); resp.SW() != SW_SECURITY_NOT_SATISFIED {
+		t.Errorf("EF_IMSI before ADM = %04X, want 6982", resp.SW())
+	}
+	reader.VerifyPIN(PIN_ADM1, []byte("12345678"))
+	if resp, _ := reader.ReadBinary(0, 9); !resp.IsOK() || resp.Data[0] != 0x08 {
+		t.Errorf("EF_IMSI after ADM = %X %04X", resp.Data, resp.SW())
+	}
+	reader.Select([]byte{0x6F, 0xFF})
+	if resp, _ := reader.ReadBinary(0, 1); resp.SW() != 0x6A82 {
+		t.Errorf("refused EF = %04X, want recorded 6A82", resp.SW())
+	}
+
+	if _, err := NewMockCardFromFixture(&Fixture{ATR: "3B", Files: []FixtureFile{{Path: "6F07"}}}); err == nil {
+		t.Error("NewMockCardFromFixture() accepted a path without root")
+	}
+}
+
+func TestFixture_SelectAIDP2(t *testing.T) {
+	src := newFixtureSourceCard()
+	src.AIDSelectP2 = []byte{0x0C}
+	reader := NewReaderWithTransport("Mock", src.ATR, src, WithFixtureRecording())
+	reader.Select(fixtureUSIM[:7])
+	reader.Select([]byte{0x6F, 0x07})
+	reader.ReadBinary(0, 9)
+
+	fixture := reader.Fixture()
+	if fixture.SelectAIDP2 != "0C" {
+		t.Fatalf("SelectAIDP2 = %q, want 0C", fixture.SelectAIDP2)
+	}
+
+	// The replayed card rejects P2=04 like the original
+	m, err := NewMockCardFromFixture(fixture)
+	if err != nil {
+		t.Fatalf("NewMockCardFromFixture() error = %v", err)
+	}
+	replay := NewReaderWithTransport("Mock", m.ATR, m)
+	if resp, _ := replay.Select(fixtureUSIM[:7]); !resp.IsOK() {
+		t.Fatalf("Select(AID) on the replayed card = %04X", resp.SW())
+	}
+	if len(m.Log) != 2 || m.Log[0][3] != 0x04 || m.Log[1][3] != 0x0C {
+		t.Errorf("replayed SELECTs = %X, want P2=04 rejected, then 0C", m.Log)
+	}
+
+	if _, err := NewMockCardFromFixture(&Fixture{ATR: "3B", SelectAIDP2: "0C0C"}); err == nil {
+		t.Error("invalid select_aid_p2 accepted")
+	}
+}
@@ -0,0 +1,162 @@
+package card
+
+import (
+	"crypto/des"
+	"fmt"
+	"strings"
+)
+
+// GlobalPlatform key diversification.
+// Many issuers (and DMS files) deliver a master keyset; the keys actually stored on
+// the card are derived from it with the card's key diversification data (KDD), the
+// first 10 bytes of the INITIALIZE UPDATE response.
+
+type DivScheme string
+
+const (
+	DivNone   DivScheme = "none"    // static keys are used as is
+	DivVISA2  DivScheme = "visa2"   // VISA2: KDD[0:2] || KDD[4:8] (CSN part of CPLC)
+	DivEMVCPS DivScheme = "emv-cps" // EMV CPS 1.1: KDD[4:10]
+	DivAuto   DivScheme = "auto"    // try none, VISA2 and EMV CPS in that order
+)
+
+// divKDDLen is the length of the key diversification data in INITIALIZE UPDATE
+const divKDDLen = 10
+
+// Key type bytes of the diversification data
+const (
+	divKeyENC byte = 0x01
+	divKeyMAC byte = 0x02
+	divKeyDEK byte = 0x03
+)
+
+// ParseDivScheme parses a --gp-div value: none, visa2, emv-cps or auto (empty = auto)
+func ParseDivScheme(s string) (DivScheme, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "auto", "all":
+		return DivAuto, nil
+	case "none", "off":
+		return DivNone, nil
+	case "visa2", "visa":
+		return DivVISA2, nil
+	case "emv-cps", "emvcps", "emv", "cps":
+		return DivEMVCPS, nil
+	}
+	return "", fmt.Errorf("unknown key diversification %q (use visa2, emv-cps, none or auto)", s)
+}
+
+// candidates returns the schemes to try for s, undiversified keys first
+func (s DivScheme) candidates() []DivScheme {
+	switch s {
+	case DivAuto:
+		return []DivScheme{DivNone, DivVISA2, DivEMVCPS}
+	case "":
+		return []DivScheme{DivNone}
+	}
+	return []DivScheme{s}
+}
+
+// DiversifyKeys derives the card keys from a master keyset and the 10-byte key
+// diversification data returned by INITIALIZE UPDATE. Each key is the 3DES-ECB
+// encryption of 16 bytes of diversification data under the master key:
+//
+//	VISA2:   KDD[0:2] || KDD[4:8] || F0 || t || KDD[0:2] || KDD[4:8] || 0F || t
+//	EMV CPS: KDD[4:10] || F0 || t || KDD[4:10] || 0F || t
+//
+// with t = 01 (ENC), 02 (MAC), 03 (DEK). DivNone (and DivAuto) return a copy of
+// master. Keys that cannot be derived (KDD shorter than 10 bytes, master key not a
+// 16 or 24 byte 3DES key) are returned empty, so opening a channel with them fails.
+func DiversifyKeys(master GPKeySet, kdd []byte, scheme DivScheme) GPKeySet {
+	if scheme != DivVISA2 && scheme != DivEMVCPS {
+		return GPKeySet{
+			ENC: append([]byte(nil), master.ENC...),
+			MAC: append([]byte(nil), master.MAC...),
+			DEK: append([]byte(nil), master.DEK...),
+		}
+	}
+	if len(kdd) < divKDDLen {
+		return GPKeySet{}
+	}
+	out := GPKeySet{
+		ENC: diversifyKey(master.ENC, divData(kdd, scheme, divKeyENC)),
+		MAC: diversifyKey(master.MAC, divData(kdd, scheme, divKeyMAC)),
+	}
+	if len(master.DEK) > 0 {
+		out.DEK = diversifyKey(master.DEK, divData(kdd, scheme, divKeyDEK))
+	}
+	return out
+}
+
+// divData builds the 16-byte diversification data for one key type
+func divData(kdd []byte, scheme DivScheme, keyType byte) []byte {
+	var id []byte
+	if scheme == DivVISA2 {
+		id = append(append([]byte{}, kdd[0:2]...), kdd[4:8]...)
+	} else {
+		id = append([]byte{}, kdd[4:10]...)
+	}
+	data := make([]byte, 0, 16)
+	data = append(append(data, id...), 0xF0, keyType)
+	data = append(append(data, id...), 0x0F, keyType)
+	return data
+}
+
+// diversifyKey encrypts data (16 bytes) with 3DES-ECB under master; nil on error
+func diversifyKey(master, data []byte) []byte {
+	key, err := ExpandTo3DESKey(master)
+	if err != nil {
+		return nil
+	}
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return nil
+	}
+	out := make([]byte, len(data))
+	for i := 0; i < len(data); i += 8 {
+		block.Encrypt(out[i:i+8], data[i:i+8])
+	}
+	return out
+}
+
+// cardKeys returns the keys of static as stored on the card for one scheme
+func (static GPKeySet) cardKeys(initUpdateData []byte, scheme DivScheme) GPKeySet {
+	if scheme == DivNone || scheme == "" {
+		return static
+	}
+	var kdd []byte
+	if len(initUpdateData) >= divKDDLen {
+		kdd = initUpdateData[:divKDDLen]
+	}
+	return DiversifyKeys(static, kdd, scheme)
+}
+
+// matchDiversification tries the schemes selected by static.Div against one
+// INITIALIZE UPDATE response. verify checks the card cryptogram with candidate keys
+// (no APDU is sent). It returns the first scheme that verifies; otherwise the error
+// of the first candidate, which is the most relevant one.
+func matchDiversification(static GPKeySet, initUpdateData []byte, verify func(GPKeySet) error) (DivScheme, error) {
+	candidates := static.Div.candidates()
+	var firstErr error
+	for _, scheme := range candidates {
+		err := verify(static.cardKeys(initUpdateData, scheme))
+		if err == nil {
+			return scheme, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(candidates) > 1 {
+		return "", fmt.Errorf("%w (also tried key diversification visa2, emv-cps)", firstErr)
+	}
+	return "", firstErr
+}
+
+// checkSCP03Div rejects VISA2 / EMV CPS for SCP03: both derive 3DES keys, SCP03
+// keys are AES. DivAuto falls back to the undiversified keys.
+func checkSCP03Div(scheme DivScheme) error {
+	if scheme == DivVISA2 || scheme == DivEMVCPS {
+		return fmt.Errorf("key diversification %s is defined for 3DES keys only, card uses SCP03", scheme)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package card
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// ============ KEY DIVERSIFICATION TESTS ============
+
+var (
+	divTestMaster = mustDivHex("404142434445464748494A4B4C4D4E4F") // GP default test key
+	divTestKDD    = mustDivHex("00010203040506070809")
+)
+
+func mustDivHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestDiversifyKeys_Vectors(t *testing.T) {
+	// Master 404142...4F, KDD 00010203040506070809. Expected keys cross-checked with
+	// `openssl enc -des-ede -nopad` over the diversification data.
+	tests := []struct {
+		scheme        DivScheme
+		enc, mac, dek string
+	}{
+		{DivVISA2,
+			"8510FC973208218CA86888BCEC203635",
+			"1068B5FB6F06C78C7A4DFC343B21C78F",
+			"2DAEE809C71405FF259C3BE695A1F66E"},
+		{DivEMVCPS,
+			"0EF59FCBF8019B62E62AF6EA20B8BF25",
+			"3E383EB6F2762B88155F76BDFED05A02",
+			"64021E43C0C7D264A1C7C6D01E1C8761"},
+	}
+	master := GPKeySet{ENC: divTestMaster, MAC: divTestMaster, DEK: divTestMaster}
+	for _, tc := range tests {
+		t.Run(string(tc.scheme), func(t *testing.T) {
+			got := DiversifyKeys(master, divTestKDD, tc.scheme)
+			for name, pair := range map[string][2]string{
+				"ENC": {hex.EncodeToString(got.ENC), tc.enc},
+				"MAC": {hex.EncodeToString(got.MAC), tc.mac},
+				"DEK": {hex.EncodeToString(got.DEK), tc.dek},
+			} {
+				if !strings.EqualFold(pair[0], pair[1]) {
+					t.Errorf("%s = %s, want %s", name, strings.ToUpper(pair[0]), pair[1])
+				}
+			}
+		})
+	}
+}
+
+func TestDiversifyKeys_DerivationData(t *testing.T) {
+	tests := []struct {
+		scheme  DivScheme
+		keyType byte
+		want    string
+	}{
+		{DivVISA2, divKeyENC, "000104050607F0010001040506070F01"},
+		{DivVISA2, divKeyDEK, "000104050607F0030001040506070F03"},
+		{DivEMVCPS, divKeyMAC, "040506070809F0020405060708090F02"},
+	}
+	for _, tc := range tests {
+		got := divData(divTestKDD, tc.scheme, tc.keyType)
+		if want := mustDivHex(tc.want); !bytes.Equal(got, want) {
+			t.Errorf("divData(%s, %02X) = %X, want %X", tc.scheme, tc.keyType, got, want)
+		}
+	}
+}
+
+func TestDiversifyKeys_NoneAndInvalid(t *testing.T) {
+	master := GPKeySet{ENC: divTestMaster, MAC: divTestMaster}
+
+	none := DiversifyKeys(master, divTestKDD, DivNone)
+	if !bytes.Equal(none.ENC, divTestMaster) || !bytes.Equal(none.MAC, divTestMaster) || len(none.DEK) != 0 {
+		t.Errorf("DivNone changed keys: %+v", none)
+	}
+	none.ENC[0] ^= 0xFF
+	if divTestMaster[0] != 0x40 {
+		t.Error("DivNone result aliases the master key")
+	}
+
+	if got := DiversifyKeys(master, divTestKDD[:8], DivVISA2); len(got.ENC) != 0 || len(got.MAC) != 0 {
+		t.Errorf("short KDD: got %+v, want empty keys", got)
+	}
+	if got := DiversifyKeys(GPKeySet{ENC: make([]byte, 8), MAC: divTestMaster}, divTestKDD, DivEMVCPS); got.ENC != nil || len(got.MAC) != 16 {
+		t.Errorf("bad ENC length: got %+v, want empty ENC and derived MAC", got)
+	}
+}
+
+func TestParseDivScheme(t *testing.T) {
+	tests := map[string]DivScheme{
+		"":        DivAuto,
+		"auto":    DivAuto,
+		"none":    DivNone,
+		"VISA2":   DivVISA2,
+		"emv-cps": DivEMVCPS,
+		"emv":     DivEMVCPS,
+	}
+	for in, want := range tests {
+		got, err := ParseDivScheme(in)
+		if err != nil || got != want {
+			t.Errorf("ParseDivScheme(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseDivScheme("kdf3"); err == nil {
+		t.Error("ParseDivScheme(kdf3) should fail")
+	}
+}
+
+// divTestCard answers INITIALIZE UPDATE like an SCP02 card whose keys are the
+// VISA2-diversified default keys, and 9000 to everything else.
+type divTestCard struct {
+	inits int
+}
+
+func (c *divTestCard) Transmit(apdu []byte) ([]byte, error) {
+	if len(apdu) < 13 || apdu[1] != 0x50 {
+		return []byte{0x90, 0x00}, nil
+	}
+	c.inits++
+	hostChallenge := apdu[5:13]
+	keys := DiversifyKeys(GPKeySet{ENC: divTestMaster}, divTestKDD, DivVISA2)
+	enc, _ := ExpandTo3DESKey(keys.ENC)
+	seq := []byte{0x00, 0x2A}
+	cardChal := []byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}
+	senc, _ := scp02Derive(enc, []byte{0x01, 0x82}, seq)
+	crypt, _ := scp02CardCryptogram(senc, seq, hostChallenge, cardChal)
+
+	resp := append([]byte{}, divTestKDD...)
+	resp = append(resp, 0x20, 0x02)
+	resp = append(resp, seq...)
+	resp = append(resp, cardChal...)
+	resp = append(resp, crypt...)
+	return append(resp, 0x90, 0x00), nil
+}
+
+func (c *divTestCard) Reset(bool) ([]byte, error) { return nil, nil }
+func (c *divTestCard) Close() error               { return nil }
+
+func TestProbeSecureChannelDiv(t *testing.T) {
+	hc := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	master := GPKeySet{ENC: divTestMaster, MAC: divTestMaster, DEK: divTestMaster}
+
+	tests := []struct {
+		div     DivScheme
+		want    DivScheme
+		wantErr bool
+	}{
+		{DivAuto, DivVISA2, false},
+		{DivVISA2, DivVISA2, false},
+		{DivEMVCPS, "", true},
+		{DivNone, "", true},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.div), func(t *testing.T) {
+			tr := &divTestCard{}
+			r := NewReaderWithTransport("Mock", nil, tr)
+			keys := master
+			keys.Div = tc.div
+			got, err := ProbeSecureChannelDiv(r, keys, 0x20, hc)
+			if (err != nil) != tc.wantErr || got != tc.want {
+				t.Fatalf("ProbeSecureChannelDiv = %q, %v; want %q (error %v)", got, err, tc.want, tc.wantErr)
+			}
+			if tr.inits != 1 {
+				t.Errorf("INITIALIZE UPDATE sent %d times, want 1", tr.inits)
+			}
+		})
+	}
+}
+
+func TestOpenSecureChannelAuto_Diversified(t *testing.T) {
+	r := NewReaderWithTransport("Mock", nil, &divTestCard{})
+	master := GPKeySet{ENC: divTestMaster, MAC: divTestMaster, DEK: divTestMaster, Div: DivAuto}
+	sess, err := OpenSecureChannelAuto(r, master, 0x20, GPSecMAC, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	if err != nil {
+		t.Fatalf("OpenSecureChannelAuto: %v", err)
+	}
+	scp02, ok := sess.(*SCP02Session)
+	if !ok {
+		t.Fatalf("session type %T, want *SCP02Session", sess)
+	}
+	want, _ := ExpandTo3DESKey(DiversifyKeys(master, divTestKDD, DivVISA2).ENC)
+	if !bytes.Equal(scp02.Static.ENC, want) {
+		t.Errorf("session ENC = %X, want VISA2 key %X", scp02.Static.ENC, want)
+	}
+}
+
+// ============ INITIALIZE UPDATE DECODING TESTS ============
+
+func TestParseInitializeUpdate(t *testing.T) {
+	kdd := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	seq3 := []byte{0x00, 0x00, 0x2A}
+	chal := bytes.Repeat([]byte{0x11}, 8)
+	crypt := bytes.Repeat([]byte{0x22}, 8)
+
+	scp02 := append(append([]byte{}, kdd...), 0x20, 0x02, 0x00, 0x2A)
+	scp02 = append(scp02, chal[:6]...)
+	scp02 = append(scp02, crypt...)
+	info, err := ParseInitializeUpdate(scp02)
+	if err != nil {
+		t.Fatalf("SCP02: %v", err)
+	}
+	if info.KVN != 0x20 || info.Protocol() != "SCP02" || !bytes.Equal(info.SeqCounter, []byte{0x00, 0x2A}) ||
+		!bytes.Equal(info.CardChallenge, chal[:6]) || !bytes.Equal(info.CardCryptogram, crypt) || !bytes.Equal(info.KDD, kdd) {
+		t.Errorf("SCP02 decoded as %+v", info)
+	}
+	if info.HostChallengeLen() != 8 {
+		t.Errorf("SCP02 host challenge length = %d, want 8", info.HostChallengeLen())
+	}
+
+	scp03 := append(append([]byte{}, kdd...), 0x30, 0x03, 0x70)
+	scp03 = append(append(append(scp03, chal...), crypt...), seq3...)
+	info, err = ParseInitializeUpdate(scp03)
+	if err != nil {
+		t.Fatalf("SCP03: %v", err)
+	}
+	if info.KVN != 0x30 || info.Protocol() != "SCP03" || info.IParam != 0x70 || !bytes.Equal(info.SeqCounter, seq3) ||
+		!bytes.Equal(info.CardChallenge, chal) || !bytes.Equal(info.CardCryptogram, crypt) {
+		t.Errorf("SCP03 decoded as %+v", info)
+	}
+	if err := info.CheckKeys(GPKeySet{ENC: make([]byte, 24), MAC: make([]byte, 24)}); err == nil {
+		t.Error("SCP03 should refuse 24-byte keys")
+	}
+	if err := info.CheckKeys(GPKeySet{ENC: make([]byte, 16), MAC: make([]byte, 16), Div: DivAuto}); err != nil {
+		t.Errorf("SCP03 with AES-128 keys: %v", err)
+	}
+
+	// Unknown protocol: key information is still returned
+	scp01 := append(append([]byte{}, kdd...), 0x01, 0x01)
+	if info, err := ParseInitializeUpdate(scp01); err == nil || info == nil || info.KVN != 1 || info.SCP != 1 {
+		t.Errorf("SCP01 = %+v, %v; want key information and an error", info, err)
+	}
+	if _, err := ParseInitializeUpdate(kdd); err == nil {
+		t.Error("short response should fail")
+	}
+}
+
+func TestProbeSecureChannelDiv_ReportsCardInfo(t *testing.T) {
+	r := NewReaderWithTransport("Mock", nil, &divTestCard{})
+	keys := GPKeySet{ENC: divTestMaster, MAC: divTestMaster, Div: DivNone}
+	_, err := ProbeSecureChannelDiv(r, keys, 0x20, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	var perr *GPProbeError
+	if !errors.As(err, &perr) {
+		t.Fatalf("error %v is not a *GPProbeError", err)
+	}
+	if perr.Info.KVN != 0x20 || perr.Info.SCP != 0x02 || !bytes.Equal(perr.Info.KDD, divTestKDD) {
+		t.Errorf("reported %+v, want KVN 0x20 SCP02", perr.Info)
+	}
+	if !strings.Contains(err.Error(), "card cryptogram mismatch") {
+		t.Errorf("error = %v, want the cryptogram mismatch", err)
+	}
+
+	info, err := ProbeSecureChannelInfo(r, 0, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	if err != nil || info.KVN != 0x20 || info.Protocol() != "SCP02" {
+		t.Errorf("ProbeSecureChannelInfo = %+v, %v", info, err)
+	}
+}
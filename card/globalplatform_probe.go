@@ -0,0 +1,121 @@
+package card
+
+import (
+	"fmt"
+)
+
+// GPProbeResult is a decoded INITIALIZE UPDATE response (GP Card Spec E.5.1.6 for SCP02,
+// Amendment D 7.1.1.6 for SCP03). It tells which key set and protocol the card chose,
+// which is what a failed probe needs to be understood: a KVN the card does not have,
+// another SCP, or wrong keys (card cryptogram mismatch).
+type GPProbeResult struct {
+	KDD            []byte // key diversification data (10 bytes)
+	KVN            byte   // key version number of the key set used by the card
+	SCP            byte   // secure channel protocol: 0x02 or 0x03
+	IParam         byte   // SCP03 "i" parameter (not returned by SCP02 cards)
+	SeqCounter     []byte // 2 bytes (SCP02), 3 bytes or absent (SCP03)
+	CardChallenge  []byte // 6 bytes (SCP02), 8 or 16 bytes (SCP03)
+	CardCryptogram []byte // 8 bytes (SCP02), 8 or 16 bytes (SCP03)
+}
+
+// Protocol returns the protocol name (SCP02, SCP03)
+func (p *GPProbeResult) Protocol() string {
+	return fmt.Sprintf("SCP%02X", p.SCP)
+}
+
+// HostChallengeLen returns the host challenge length the card expects: 16 bytes for
+// SCP03 in S16 mode, 8 otherwise
+func (p *GPProbeResult) HostChallengeLen() int {
+	if p.SCP == 0x03 && len(p.CardChallenge) == 16 {
+		return 16
+	}
+	return 8
+}
+
+// CheckKeys reports whether the ENC and MAC keys can be used with the protocol of the
+// card: 3DES keys (16 or 24 bytes) for SCP02, AES-128 keys for SCP03
+func (p *GPProbeResult) CheckKeys(keys GPKeySet) error {
+	expand := ExpandTo3DESKey
+	if p.SCP == 0x03 {
+		if err := checkSCP03Div(keys.Div); err != nil {
+			return err
+		}
+		expand = expandAESKey
+	}
+	if _, err := expand(keys.ENC); err != nil {
+		return fmt.Errorf("ENC key: %w", err)
+	}
+	if _, err := expand(keys.MAC); err != nil {
+		return fmt.Errorf("MAC key: %w", err)
+	}
+	return nil
+}
+
+// ParseInitializeUpdate decodes an INITIALIZE UPDATE response. For a protocol other than
+// SCP02/SCP03 the key information is still returned along with the error.
+func ParseInitializeUpdate(data []byte) (*GPProbeResult, error) {
+	if len(data) < divKDDLen+2 {
+		return nil, fmt.Errorf("INITIALIZE UPDATE response too short: %d bytes", len(data))
+	}
+	p := &GPProbeResult{
+		KDD: append([]byte{}, data[:divKDDLen]...),
+		KVN: data[10],
+		SCP: data[11],
+	}
+	switch p.SCP {
+	case 0x02:
+		if len(data) < 28 {
+			return nil, fmt.Errorf("INITIALIZE UPDATE response too short: %d bytes", len(data))
+		}
+		p.SeqCounter = append([]byte{}, data[12:14]...)
+		p.CardChallenge = append([]byte{}, data[14:20]...)
+		p.CardCryptogram = append([]byte{}, data[20:28]...)
+	case 0x03:
+		iParam, cardChal, cardCrypt, err := parseInitUpdateSCP03(data)
+		if err != nil {
+			return nil, err
+		}
+		p.IParam, p.CardChallenge, p.CardCryptogram = iParam, cardChal, cardCrypt
+		if end := 13 + 2*len(cardChal); len(data) == end+3 {
+			p.SeqCounter = append([]byte{}, data[end:]...)
+		}
+	default:
+		return p, fmt.Errorf("unsupported secure channel protocol in INITIALIZE UPDATE: scp_id=0x%02X", p.SCP)
+	}
+	return p, nil
+}
+
+// ProbeSecureChannelInfo performs INITIALIZE UPDATE and decodes the response without
+// checking any key. With kvn 0 the card answers with its default key set, which reveals
+// the KVN and protocol to use.
+func ProbeSecureChannelInfo(r *Reader, kvn byte, hostChallenge []byte) (*GPProbeResult, error) {
+	if r == nil {
+		return nil, fmt.Errorf("nil reader")
+	}
+	resp, err := sendInitializeUpdate(r, kvn, hostChallenge)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("INITIALIZE UPDATE failed: no response")
+	}
+	if !resp.IsOK() {
+		return nil, fmt.Errorf("INITIALIZE UPDATE failed: %s (SW=%04X)", resp.SWString(), resp.SW())
+	}
+	return ParseInitializeUpdate(resp.Data)
+}
+
+// GPProbeError is a key probe that failed after the card answered INITIALIZE UPDATE:
+// Info holds what the card reported
+type GPProbeError struct {
+	Info *GPProbeResult
+	Err  error
+}
+
+func (e *GPProbeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *GPProbeError) Unwrap() error {
+	return e.Err
+}
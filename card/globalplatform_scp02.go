@@ -30,6 +30,11 @@ type GPKeySet struct {
 	ENC []byte // static ENC key (16 or 24 bytes)
 	MAC []byte // static MAC key (16 or 24 bytes)
 	DEK []byte // static DEK key (16 or 24 bytes) - optional for delete/list/load/install (needed for PUT KEY etc.)
+
+	// Div selects key diversification: when set (other than DivNone) ENC/MAC/DEK are
+	// master keys and the card keys are derived from them with the KDD returned by
+	// INITIALIZE UPDATE. Empty means no diversification.
+	Div DivScheme
 }
 
 // ExpandTo3DESKey converts 16-byte (2-key 3DES) keys to 24-byte K1||K2||K1.
@@ -200,8 +205,7 @@ func ProbeSCP02(r *Reader, static GPKeySet, kvn byte, hostChallenge8 []byte) err
 	if r == nil {
 		return fmt.Errorf("nil reader")
 	}
-	enc, err := ExpandTo3DESKey(static.ENC)
-	if err != nil {
+	if _, err := ExpandTo3DESKey(static.ENC); err != nil {
 		return fmt.Errorf("ENC key: %w", err)
 	}
 	// MAC/DEK are not required for cryptogram verification, but we validate sizes if provided.
@@ -227,14 +231,26 @@ func ProbeSCP02(r *Reader, static GPKeySet, kvn byte, hostChallenge8 []byte) err
 		return fmt.Errorf("INITIALIZE UPDATE failed: no response")
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("INITIALIZE UPDATE failed: %s (SW=%04X)", SWToString(resp.SW()), resp.SW())
+		return fmt.Errorf("INITIALIZE UPDATE failed: %s (SW=%04X)", resp.SWString(), resp.SW())
+	}
+	_, err = matchDiversification(static, resp.Data, func(keys GPKeySet) error {
+		return probeSCP02(keys, hostChallenge8, resp.Data)
+	})
+	return err
+}
+
+// probeSCP02 verifies the card cryptogram of an SCP02 INITIALIZE UPDATE response
+func probeSCP02(static GPKeySet, hostChallenge8 []byte, respData []byte) error {
+	enc, err := ExpandTo3DESKey(static.ENC)
+	if err != nil {
+		return fmt.Errorf("ENC key: %w", err)
 	}
-	if len(resp.Data) < 28 {
-		return fmt.Errorf("INITIALIZE UPDATE response too short: %d bytes", len(resp.Data))
+	if len(respData) < 28 {
+		return fmt.Errorf("INITIALIZE UPDATE response too short: %d bytes", len(respData))
 	}
-	seq := resp.Data[12:14]
-	cardChal := resp.Data[14:20]
-	cardCrypt := resp.Data[20:28]
+	seq := respData[12:14]
+	cardChal := respData[14:20]
+	cardCrypt := respData[20:28]
 
 	senc, err := scp02Derive(enc, []byte{0x01, 0x82}, seq)
 	if err != nil {
@@ -259,6 +275,7 @@ func OpenSecureChannelAuto(r *Reader, static GPKeySet, kvn byte, sec GPSecurityL
 	if len(hostChallenge) == 0 {
 		return nil, fmt.Errorf("host challenge is empty")
 	}
+	defer r.Measure("GP session")()
 
 	resp, err := sendInitializeUpdate(r, kvn, hostChallenge)
 	if err != nil {
@@ -268,7 +285,7 @@ func OpenSecureChannelAuto(r *Reader, static GPKeySet, kvn byte, sec GPSecurityL
 		return nil, fmt.Errorf("INITIALIZE UPDATE failed: no response")
 	}
 	if !resp.IsOK() {
-		return nil, fmt.Errorf("INITIALIZE UPDATE failed: %s (SW=%04X)", SWToString(resp.SW()), resp.SW())
+		return nil, fmt.Errorf("INITIALIZE UPDATE failed: %s (SW=%04X)", resp.SWString(), resp.SW())
 	}
 	if len(resp.Data) < 12 {
 		return nil, fmt.Errorf("INITIALIZE UPDATE response too short: %d bytes", len(resp.Data))
@@ -302,40 +319,66 @@ func OpenSecureChannelAuto(r *Reader, static GPKeySet, kvn byte, sec GPSecurityL
 // ProbeSecureChannelAuto checks whether provided KVN+keys match the card by verifying card cryptogram.
 // It auto-detects SCP02 vs SCP03 based on INITIALIZE UPDATE response.
 func ProbeSecureChannelAuto(r *Reader, static GPKeySet, kvn byte, hostChallenge []byte) error {
+	_, err := ProbeSecureChannelDiv(r, static, kvn, hostChallenge)
+	return err
+}
+
+// ProbeSecureChannelDiv is ProbeSecureChannelAuto that also reports which key
+// diversification matched. All schemes selected by static.Div are checked against the
+// same INITIALIZE UPDATE response, so DivAuto costs no extra APDUs.
+func ProbeSecureChannelDiv(r *Reader, static GPKeySet, kvn byte, hostChallenge []byte) (DivScheme, error) {
 	if r == nil {
-		return fmt.Errorf("nil reader")
+		return "", fmt.Errorf("nil reader")
 	}
 	if len(hostChallenge) == 0 {
-		return fmt.Errorf("host challenge is empty")
+		return "", fmt.Errorf("host challenge is empty")
 	}
 	resp, err := sendInitializeUpdate(r, kvn, hostChallenge)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if resp == nil {
-		return fmt.Errorf("INITIALIZE UPDATE failed: no response")
+		return "", fmt.Errorf("INITIALIZE UPDATE failed: no response")
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("INITIALIZE UPDATE failed: %s (SW=%04X)", SWToString(resp.SW()), resp.SW())
+		return "", fmt.Errorf("INITIALIZE UPDATE failed: %s (SW=%04X)", resp.SWString(), resp.SW())
 	}
 	if len(resp.Data) < 12 {
-		return fmt.Errorf("INITIALIZE UPDATE response too short: %d bytes", len(resp.Data))
+		return "", fmt.Errorf("INITIALIZE UPDATE response too short: %d bytes", len(resp.Data))
+	}
+	div, err := verifyInitUpdate(r, static, kvn, hostChallenge, resp)
+	if err != nil {
+		// Attach what the card reported: KVN and SCP tell a wrong --kvn from wrong keys
+		if info, _ := ParseInitializeUpdate(resp.Data); info != nil {
+			return "", &GPProbeError{Info: info, Err: err}
+		}
+		return "", err
 	}
+	return div, nil
+}
+
+// verifyInitUpdate checks the card cryptogram of an INITIALIZE UPDATE response with static
+func verifyInitUpdate(r *Reader, static GPKeySet, kvn byte, hostChallenge []byte, resp *APDUResponse) (DivScheme, error) {
 	scpID := resp.Data[11]
 	switch scpID {
 	case 0x02:
 		if len(hostChallenge) != 8 {
-			return fmt.Errorf("card reports SCP02 but host challenge is %d bytes (expected 8)", len(hostChallenge))
+			return "", fmt.Errorf("card reports SCP02 but host challenge is %d bytes (expected 8)", len(hostChallenge))
 		}
-		return ProbeSCP02(r, static, kvn, hostChallenge)
+		return matchDiversification(static, resp.Data, func(keys GPKeySet) error {
+			return probeSCP02(keys, hostChallenge, resp.Data)
+		})
 	case 0x03:
+		if err := checkSCP03Div(static.Div); err != nil {
+			return "", err
+		}
 		enc, err := expandAESKey(static.ENC)
 		if err != nil {
-			return fmt.Errorf("ENC key: %w", err)
+			return "", fmt.Errorf("ENC key: %w", err)
 		}
 		mac, err := expandAESKey(static.MAC)
 		if err != nil {
-			return fmt.Errorf("MAC key: %w", err)
+			return "", fmt.Errorf("MAC key: %w", err)
 		}
 		// If card returned S16 but we sent S8 host challenge, retry with S16.
 		if len(hostChallenge) == 8 {
@@ -344,13 +387,13 @@ func ProbeSecureChannelAuto(r *Reader, static GPKeySet, kvn byte, hostChallenge
 				copy(hc16[:8], hostChallenge)
 				resp2, err2 := sendInitializeUpdate(r, kvn, hc16)
 				if err2 == nil && resp2 != nil && resp2.IsOK() {
-					return probeSCP03(enc, mac, hc16, resp2.Data)
+					return DivNone, probeSCP03(enc, mac, hc16, resp2.Data)
 				}
 			}
 		}
-		return probeSCP03(enc, mac, hostChallenge, resp.Data)
+		return DivNone, probeSCP03(enc, mac, hostChallenge, resp.Data)
 	default:
-		return fmt.Errorf("unsupported secure channel protocol in INITIALIZE UPDATE: scp_id=0x%02X", scpID)
+		return "", fmt.Errorf("unsupported secure channel protocol in INITIALIZE UPDATE: scp_id=0x%02X", scpID)
 	}
 }
 
@@ -382,12 +425,6 @@ func sendInitializeUpdate(r *Reader, kvn byte, hostChallenge []byte) (*APDURespo
 			lastErr = err
 			continue
 		}
-		if resp.HasMoreData() {
-			resp2, err2 := r.GetResponse(resp.SW2)
-			if err2 == nil && resp2 != nil {
-				resp = resp2
-			}
-		}
 		// If INS is not supported, try next variant.
 		if resp.SW() == SW_INS_NOT_SUPPORTED || resp.SW() == SW_CLA_NOT_SUPPORTED {
 			last = resp
@@ -434,12 +471,23 @@ func OpenSCP02(r *Reader, static GPKeySet, kvn byte, sec GPSecurityLevel, hostCh
 		return nil, fmt.Errorf("INITIALIZE UPDATE failed: no response")
 	}
 	if !resp.IsOK() {
-		return nil, fmt.Errorf("INITIALIZE UPDATE failed: %s (SW=%04X)", SWToString(resp.SW()), resp.SW())
+		return nil, fmt.Errorf("INITIALIZE UPDATE failed: %s (SW=%04X)", resp.SWString(), resp.SW())
 	}
-	return openSCP02FromInitUpdate(r, GPKeySet{ENC: enc, MAC: mac, DEK: dek}, kvn, sec, hostChallenge8, resp.Data)
+	return openSCP02FromInitUpdate(r, GPKeySet{ENC: enc, MAC: mac, DEK: dek, Div: static.Div}, kvn, sec, hostChallenge8, resp.Data)
 }
 
 func openSCP02FromInitUpdate(r *Reader, static GPKeySet, kvn byte, sec GPSecurityLevel, hostChallenge8 []byte, initUpdateData []byte) (*SCP02Session, error) {
+	// Resolve key diversification locally (card cryptogram) before EXTERNAL AUTHENTICATE
+	if static.Div != "" && static.Div != DivNone {
+		scheme, err := matchDiversification(static, initUpdateData, func(keys GPKeySet) error {
+			return probeSCP02(keys, hostChallenge8, initUpdateData)
+		})
+		if err != nil {
+			return nil, err
+		}
+		static = static.cardKeys(initUpdateData, scheme)
+	}
+
 	enc, err := ExpandTo3DESKey(static.ENC)
 	if err != nil {
 		return nil, fmt.Errorf("ENC key: %w", err)
@@ -530,11 +578,8 @@ func openSCP02FromInitUpdate(r *Reader, static GPKeySet, kvn byte, sec GPSecurit
 	if err != nil {
 		return nil, err
 	}
-	if resp.HasMoreData() {
-		resp, _ = r.GetResponse(resp.SW2)
-	}
 	if !resp.IsOK() {
-		return nil, fmt.Errorf("EXTERNAL AUTHENTICATE failed: %s (SW=%04X)", SWToString(resp.SW()), resp.SW())
+		return nil, fmt.Errorf("EXTERNAL AUTHENTICATE failed: %s (SW=%04X)", resp.SWString(), resp.SW())
 	}
 
 	return sess, nil
@@ -677,12 +722,5 @@ func (s *SCP02Session) WrapAndSend(cla, ins, p1, p2 byte, data []byte, le *byte)
 		apdu = append(apdu, *le)
 	}
 
-	resp, err := s.Reader.SendAPDU(apdu)
-	if err != nil {
-		return nil, err
-	}
-	if resp.HasMoreData() {
-		resp, _ = s.Reader.GetResponse(resp.SW2)
-	}
-	return resp, nil
+	return s.Reader.SendAPDU(apdu)
 }
@@ -7,7 +7,7 @@ import (
 	"fmt"
 )
 
-// Minimal GlobalPlatform SCP03 (AES-CMAC, optional C-ENC not implemented here).
+// Minimal GlobalPlatform SCP03 (AES-CMAC, optional C-ENC).
 // This is enough for listing / deleting / loading applets on cards that report SCP03 in INITIALIZE UPDATE.
 
 // GPSession is a common interface implemented by SCP02Session and SCP03Session.
@@ -40,6 +40,11 @@ type SCP03Session struct {
 
 	// C-MAC chaining value (16 bytes)
 	macChaining []byte
+
+	// C-ENC state: enabled after EXTERNAL AUTHENTICATE when Sec includes C-ENC.
+	// The counter starts at 1 and is incremented for every wrapped command.
+	encEnabled bool
+	encCounter uint32
 }
 
 func expandAESKey(k []byte) ([]byte, error) {
@@ -226,6 +231,9 @@ func probeSCP03(staticEnc, staticMac []byte, hostChallenge []byte, respData []by
 }
 
 func OpenSCP03FromInitUpdate(r *Reader, kvn byte, sec GPSecurityLevel, static GPKeySet, hostChallenge8 []byte, initUpdateData []byte) (*SCP03Session, error) {
+	if err := checkSCP03Div(static.Div); err != nil {
+		return nil, err
+	}
 	encK, err := expandAESKey(static.ENC)
 	if err != nil {
 		return nil, fmt.Errorf("ENC key: %w", err)
@@ -299,21 +307,58 @@ func OpenSCP03FromInitUpdate(r *Reader, kvn byte, sec GPSecurityLevel, static GP
 	if err != nil {
 		return nil, err
 	}
-	if resp.HasMoreData() {
-		resp, _ = r.GetResponse(resp.SW2)
-	}
 	if !resp.IsOK() {
-		return nil, fmt.Errorf("EXTERNAL AUTHENTICATE failed: %s (SW=%04X)", SWToString(resp.SW()), resp.SW())
+		return nil, fmt.Errorf("EXTERNAL AUTHENTICATE failed: %s (SW=%04X)", resp.SWString(), resp.SW())
+	}
+
+	// C-ENC applies to commands following EXTERNAL AUTHENTICATE only.
+	if sec == GPSecMACENC {
+		sess.encEnabled = true
+		sess.encCounter = 1
 	}
 
 	return sess, nil
 }
 
+// scp03EncryptCommandData encrypts a command data field for SCP03 C-ENC:
+// ICV = AES-ECB(S-ENC, counter as 16-byte big-endian), then AES-CBC over ISO 7816-4 padded data.
+func scp03EncryptCommandData(senc []byte, counter uint32, data []byte) ([]byte, error) {
+	ctr := make([]byte, 16)
+	ctr[12] = byte(counter >> 24)
+	ctr[13] = byte(counter >> 16)
+	ctr[14] = byte(counter >> 8)
+	ctr[15] = byte(counter)
+	icv, err := aesECBEncryptBlock(senc, ctr)
+	if err != nil {
+		return nil, err
+	}
+	b, err := aes.NewCipher(senc)
+	if err != nil {
+		return nil, err
+	}
+	plain := pad80Block16(data)
+	out := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(b, icv).CryptBlocks(out, plain)
+	return out, nil
+}
+
 func (s *SCP03Session) WrapAndSend(cla, ins, p1, p2 byte, data []byte, le *byte) (*APDUResponse, error) {
 	// Only wrap GP proprietary commands (CLA with b8 set) – but in our call sites we always use 0x80.
-	// C-ENC is not implemented; we do C-MAC only (works for list/delete/load/install in most cases).
 	_ = cla
 
+	// C-ENC (mac+enc): encrypt the data field before computing C-MAC.
+	// Commands without data are not encrypted but still advance the counter.
+	if s.encEnabled {
+		if len(data) > 0 {
+			enc, err := scp03EncryptCommandData(s.SENC, s.encCounter, data)
+			if err != nil {
+				return nil, err
+			}
+			data = enc
+		}
+		s.encCounter++
+	}
+
 	// Build APDU (case 3/4)
 	apdu := make([]byte, 0, 5+len(data)+1)
 	apdu = append(apdu, 0x80, ins, p1, p2, byte(len(data)))
@@ -345,12 +390,5 @@ func (s *SCP03Session) WrapAndSend(cla, ins, p1, p2 byte, data []byte, le *byte)
 		tx = append(tx, *le)
 	}
 
-	resp, err := s.Reader.SendAPDU(tx)
-	if err != nil {
-		return nil, err
-	}
-	if resp.HasMoreData() {
-		return s.Reader.GetResponse(resp.SW2)
-	}
-	return resp, nil
+	return s.Reader.SendAPDU(tx)
 }
@@ -1,6 +1,9 @@
 package card
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"encoding/hex"
 	"testing"
 )
@@ -74,6 +77,51 @@ func TestSCP03_AESCMAC(t *testing.T) {
 	}
 }
 
+func TestSCP03_CommandEncryption(t *testing.T) {
+	senc, _ := hex.DecodeString("404142434445464748494A4B4C4D4E4F")
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantLen int
+	}{
+		{"1 byte", []byte{0x01}, 16},
+		{"15 bytes", make([]byte, 15), 16},
+		{"16 bytes", make([]byte, 16), 32},
+		{"DGI block", []byte{0x01, 0x01, 0x03, 0xAA, 0xBB, 0xCC}, 16},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			enc, err := scp03EncryptCommandData(senc, 1, tc.data)
+			if err != nil {
+				t.Fatalf("scp03EncryptCommandData() error = %v", err)
+			}
+			if len(enc) != tc.wantLen {
+				t.Errorf("scp03EncryptCommandData() length = %d, want %d", len(enc), tc.wantLen)
+			}
+
+			// Round trip: decrypt with the same ICV and check the padded plaintext
+			ctr := make([]byte, 16)
+			ctr[15] = 0x01
+			icv, _ := aesECBEncryptBlock(senc, ctr)
+			b, _ := aes.NewCipher(senc)
+			plain := make([]byte, len(enc))
+			cipher.NewCBCDecrypter(b, icv).CryptBlocks(plain, enc)
+			if !bytes.Equal(plain, pad80Block16(tc.data)) {
+				t.Errorf("decrypted = %X, want %X", plain, pad80Block16(tc.data))
+			}
+		})
+	}
+
+	// A different counter must yield a different ciphertext
+	a, _ := scp03EncryptCommandData(senc, 1, []byte{0x01})
+	b, _ := scp03EncryptCommandData(senc, 2, []byte{0x01})
+	if bytes.Equal(a, b) {
+		t.Errorf("ciphertext must depend on the encryption counter")
+	}
+}
+
 // ============ KEY DERIVATION TESTS ============
 
 func TestSCP02_DerivationConstant(t *testing.T) {
@@ -0,0 +1,14 @@
+package card
+
+import "fmt"
+
+// DeviceHolder is a process that has a device node open
+type DeviceHolder struct {
+	PID  int
+	Name string // command name
+	Path string // device node
+}
+
+func (h DeviceHolder) String() string {
+	return fmt.Sprintf("%s (pid %d) has %s open", h.Name, h.PID, h.Path)
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package card
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DeviceHolders lists the other processes that have one of the device nodes open, from
+// /proc/PID/fd. Processes whose descriptors cannot be read (other users, without
+// privileges) are not listed.
+func DeviceHolders(paths ...string) []DeviceHolder {
+	wanted := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		wanted[p] = true
+	}
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	self := os.Getpid()
+	var holders []DeviceHolder
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		dir := filepath.Join("/proc", proc.Name())
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil || !wanted[target] {
+				continue
+			}
+			comm, _ := os.ReadFile(filepath.Join(dir, "comm"))
+			holders = append(holders, DeviceHolder{PID: pid, Name: strings.TrimSpace(string(comm)), Path: target})
+			break
+		}
+	}
+	return holders
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package card
+
+// DeviceHolders is not available without /proc
+func DeviceHolders(paths ...string) []DeviceHolder {
+	return nil
+}
@@ -0,0 +1,168 @@
+package card
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Per-operation timing (--profile). Metrics collects the wall time and the APDU count of
+// named operations (connect, ADM verify, read USIM, GP session, ...). The Reader counts
+// every command it sends to the card into the operations running at that moment, so new
+// features are covered without counting on their own. A nil *Metrics records nothing: with
+// profiling off each hook costs a nil check.
+
+// Metrics collects the operations of one run
+type Metrics struct {
+	mu     sync.Mutex
+	start  time.Time
+	apdus  int
+	ops    map[string]*operation
+	active []*operation // running operations, outermost first
+}
+
+// operation is the running total of one named operation
+type operation struct {
+	name    string
+	calls   int
+	apdus   int
+	elapsed time.Duration
+	depth   int // nested calls of the same operation are timed once
+	started time.Time
+}
+
+// OperationMetric is the export form of one operation. Operations can nest; a nested
+// operation counts in the outer one as well (APDUs and time).
+type OperationMetric struct {
+	Name       string  `json:"name"`
+	Calls      int     `json:"calls"`
+	APDUs      int     `json:"apdus"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// MetricsReport is the breakdown of a run, operations sorted by time (longest first)
+type MetricsReport struct {
+	DurationMs float64           `json:"duration_ms"`
+	APDUs      int               `json:"apdus"`
+	Operations []OperationMetric `json:"operations"`
+}
+
+// NewMetrics returns an empty collection; its total time starts now
+func NewMetrics() *Metrics {
+	return &Metrics{start: time.Now(), ops: make(map[string]*operation)}
+}
+
+// stopNothing is what Start returns without a collection
+func stopNothing() {}
+
+// Start begins the operation name and returns the function that ends it:
+//
+//	defer metrics.Start("read USIM")()
+func (m *Metrics) Start(name string) func() {
+	if m == nil {
+		return stopNothing
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	op := m.ops[name]
+	if op == nil {
+		op = &operation{name: name}
+		m.ops[name] = op
+	}
+	op.calls++
+	op.depth++
+	if op.depth == 1 {
+		op.started = time.Now()
+		m.active = append(m.active, op)
+	}
+	return func() { m.stop(op) }
+}
+
+func (m *Metrics) stop(op *operation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if op.depth == 0 {
+		return
+	}
+	op.depth--
+	if op.depth > 0 {
+		return
+	}
+	op.elapsed += time.Since(op.started)
+	for i, a := range m.active {
+		if a == op {
+			m.active = append(m.active[:i], m.active[i+1:]...)
+			break
+		}
+	}
+}
+
+// countAPDU adds one command sent to the card to the run and to the running operations
+func (m *Metrics) countAPDU() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.apdus++
+	for _, op := range m.active {
+		op.apdus++
+	}
+}
+
+// Report returns the breakdown so far; running operations count with their time until now
+func (m *Metrics) Report() MetricsReport {
+	if m == nil {
+		return MetricsReport{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	r := MetricsReport{DurationMs: durationMs(now.Sub(m.start)), APDUs: m.apdus}
+	elapsed := make(map[string]time.Duration, len(m.ops))
+	for name, op := range m.ops {
+		d := op.elapsed
+		if op.depth > 0 {
+			d += now.Sub(op.started)
+		}
+		elapsed[name] = d
+		r.Operations = append(r.Operations, OperationMetric{Name: name, Calls: op.calls, APDUs: op.apdus, DurationMs: durationMs(d)})
+	}
+	sort.Slice(r.Operations, func(i, j int) bool {
+		a, b := r.Operations[i], r.Operations[j]
+		if elapsed[a.Name] != elapsed[b.Name] {
+			return elapsed[a.Name] > elapsed[b.Name]
+		}
+		return a.Name < b.Name
+	})
+	return r
+}
+
+// Operation returns the totals of the operation name (false if it never ran)
+func (r MetricsReport) Operation(name string) (OperationMetric, bool) {
+	for _, op := range r.Operations {
+		if op.Name == name {
+			return op, true
+		}
+	}
+	return OperationMetric{}, false
+}
+
+// WithMetrics counts the APDUs of the reader into m and lets the code using the reader
+// time its operations with Measure
+func WithMetrics(m *Metrics) ConnectOption {
+	return func(r *Reader) {
+		r.metrics = m
+	}
+}
+
+// Metrics returns the collection set with WithMetrics (nil if none)
+func (r *Reader) Metrics() *Metrics {
+	return r.metrics
+}
+
+// Measure begins the operation name in the reader's metrics and returns the function that
+// ends it; it does nothing without WithMetrics
+func (r *Reader) Measure(name string) func() {
+	if r == nil {
+		return stopNothing
+	}
+	return r.metrics.Start(name)
+}
@@ -0,0 +1,61 @@
+package card
+
+import (
+	"testing"
+)
+
+// ============ OPERATION METRICS TESTS ============
+
+func TestMetrics_CountsAPDUsPerOperation(t *testing.T) {
+	metrics := NewMetrics()
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.Override = func([]byte) []byte { return []byte{0x90, 0x00} }
+	r := NewReaderWithTransport("Mock", m.ATR, m, WithMetrics(metrics))
+
+	r.Select([]byte{0x3F, 0x00}) // outside any operation
+	stopRead := r.Measure("read USIM")
+	r.Select([]byte{0x3F, 0x00})
+	stopADM := r.Measure("ADM verify")
+	r.Select([]byte{0x3F, 0x00})
+	r.Measure("ADM verify")() // nested call of a running operation
+	stopADM()
+	stopRead()
+	r.Measure("read USIM")()
+
+	rep := metrics.Report()
+	if rep.APDUs != 3 {
+		t.Errorf("APDUs = %d, want 3", rep.APDUs)
+	}
+	if op, ok := rep.Operation("read USIM"); !ok || op.Calls != 2 || op.APDUs != 2 {
+		t.Errorf("read USIM = %+v, want 2 calls, 2 APDUs", op)
+	}
+	if op, ok := rep.Operation("ADM verify"); !ok || op.Calls != 2 || op.APDUs != 1 {
+		t.Errorf("ADM verify = %+v, want 2 calls, 1 APDU", op)
+	}
+	if len(rep.Operations) != 2 {
+		t.Errorf("Operations = %+v, want 2", rep.Operations)
+	}
+
+	// A stop function called twice changes nothing
+	stopRead()
+	if op, _ := metrics.Report().Operation("read USIM"); op.APDUs != 2 {
+		t.Errorf("read USIM after a second stop = %+v", op)
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	r.Measure("read USIM")()
+	r.Select([]byte{0x3F, 0x00})
+	if r.Metrics() != nil {
+		t.Error("Metrics() without WithMetrics is not nil")
+	}
+	var metrics *Metrics
+	metrics.Start("connect")()
+	if rep := metrics.Report(); rep.APDUs != 0 || len(rep.Operations) != 0 {
+		t.Errorf("Report() of nil metrics = %+v", rep)
+	}
+	var nilReader *Reader
+	nilReader.Measure("read USIM")()
+}
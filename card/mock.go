@@ -0,0 +1,662 @@
+package card
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+)
+
+// MockCard is a simulated UICC used as a Reader backend in tests.
+//
+// It models a small file system (MF, DFs, ADFs, transparent and linear fixed EFs)
+// and answers SELECT (by FID, AID or path), GET RESPONSE, READ/UPDATE BINARY,
+// READ/UPDATE RECORD, INCREASE, VERIFY, STATUS, GET CHALLENGE and MANAGE CHANNEL with
+// ISO 7816-4 / ETSI TS 102 221 semantics. Only the interindustry class 00 (with logical
+// channel bits) is accepted, and class 80 for INCREASE; other classes answer 6E00 like a
+// UICC without GSM support.
+// Each logical channel keeps its own current file.
+// Failures can be induced with FailSelect or FailTransmit, or by intercepting commands
+// with Override.
+type MockCard struct {
+	ATR []byte
+	// WarmATR is answered to a warm reset instead of ATR (nil = ATR)
+	WarmATR []byte
+	// Resets records every reset (true = cold)
+	Resets []bool
+
+	// Override, if set, is consulted first; returning a non-nil response skips the simulation
+	Override func(apdu []byte) []byte
+
+	// FailSelect maps a FID or AID (uppercase hex) to the SW returned by SELECT
+	FailSelect map[string]uint16
+
+	// FailTransmit is returned once by the next Transmit instead of a response, e.g.
+	// scard.ErrUnpoweredCard for a card the reader powered down
+	FailTransmit error
+
+	// AIDSelectP2 lists the response options (P2) SELECT by AID accepts; others answer 6A86 (nil = all)
+	AIDSelectP2 []byte
+
+	// Keys maps VERIFY key references (01 PIN1, 0A ADM1...) to their values (padded with FF)
+	Keys map[byte][]byte
+
+	// Retries sets the initial retry counter of a key reference (default 3)
+	Retries map[byte]int
+
+	// Log records every APDU received
+	Log [][]byte
+
+	// Channels is the number of logical channels including the basic one (0 or 1: MANAGE CHANNEL answers 6881)
+	Channels int
+
+	// SM is the card side of a secure messaging session: commands with the SM class bits
+	// are verified and decrypted with it and their responses protected (nil = no SM)
+	SM *SMSession
+
+	mf       *MockFile
+	current  *MockFile
+	verified map[byte]bool
+	tries    map[byte]int
+	pending  []byte
+	open     map[byte]*MockFile // current file of each open logical channel
+	recPtr   int                // current record of the selected EF (0 = not set)
+	secure   bool               // the command being processed arrived with secure messaging
+}
+
+// MockFile is a node of the simulated file system
+type MockFile struct {
+	FID      uint16
+	AID      []byte   // ADF only
+	Data     []byte   // transparent EF content
+	Records  [][]byte // linear fixed / cyclic EF records (all of the same length)
+	Cyclic   bool     // cyclic EF: record 1 is the most recent, UPDATE PREVIOUS rotates
+	Security []byte   // compact security attributes (tag 8C), omitted if nil
+	ARR      []byte   // security attributes referenced to EF_ARR (tag 8B), omitted if nil
+	ReadKey  byte     // key reference to verify before READ BINARY/RECORD (0 = always readable)
+	ReadSW   uint16   // status word answered to every READ instead of the content (0 = none)
+	ReadSM   bool     // READ needs secure messaging (6982 otherwise)
+	Children []*MockFile
+
+	isDF   bool
+	parent *MockFile
+}
+
+// NewMockCard creates a simulated card with an empty MF
+func NewMockCard(atr []byte) *MockCard {
+	mf := &MockFile{FID: 0x3F00, isDF: true}
+	return &MockCard{
+		ATR:        atr,
+		FailSelect: map[string]uint16{},
+		Keys:       map[byte][]byte{},
+		Retries:    map[byte]int{},
+		mf:         mf,
+		current:    mf,
+		verified:   map[byte]bool{},
+		tries:      map[byte]int{},
+		open:       map[byte]*MockFile{0: mf},
+	}
+}
+
+// MF returns the master file
+func (m *MockCard) MF() *MockFile {
+	return m.mf
+}
+
+// AddADF adds an application DF under the MF, selectable by (partial) AID
+func (m *MockCard) AddADF(aid []byte) *MockFile {
+	adf := &MockFile{FID: 0x7FFF, AID: aid, isDF: true, parent: m.mf}
+	m.mf.Children = append(m.mf.Children, adf)
+	return adf
+}
+
+// AddDF adds a dedicated file
+func (f *MockFile) AddDF(fid uint16) *MockFile {
+	df := &MockFile{FID: fid, isDF: true, parent: f}
+	f.Children = append(f.Children, df)
+	return df
+}
+
+// AddEF adds a transparent EF
+func (f *MockFile) AddEF(fid uint16, data []byte) *MockFile {
+	ef := &MockFile{FID: fid, Data: data, parent: f}
+	f.Children = append(f.Children, ef)
+	return ef
+}
+
+// AddRecordEF adds a linear fixed EF
+func (f *MockFile) AddRecordEF(fid uint16, records ...[]byte) *MockFile {
+	ef := &MockFile{FID: fid, Records: records, parent: f}
+	f.Children = append(f.Children, ef)
+	return ef
+}
+
+// AddCyclicEF adds a cyclic EF (records[0] is record 1, the most recent)
+func (f *MockFile) AddCyclicEF(fid uint16, records ...[]byte) *MockFile {
+	ef := &MockFile{FID: fid, Records: records, Cyclic: true, parent: f}
+	f.Children = append(f.Children, ef)
+	return ef
+}
+
+// Transmit implements Transport
+func (m *MockCard) Transmit(apdu []byte) ([]byte, error) {
+	if err := m.FailTransmit; err != nil {
+		m.FailTransmit = nil
+		return nil, err
+	}
+	m.Log = append(m.Log, append([]byte(nil), apdu...))
+	if len(apdu) < 4 {
+		return nil, fmt.Errorf("mock: APDU too short: %X", apdu)
+	}
+	if m.Override != nil {
+		if resp := m.Override(apdu); resp != nil {
+			return resp, nil
+		}
+	}
+	if m.SM != nil && isSMClass(apdu[0]) {
+		return m.transmitSecure(apdu)
+	}
+	return m.process(apdu), nil
+}
+
+// transmitSecure processes a command protected with secure messaging. A command that does
+// not verify is refused with 6988 (incorrect SM data objects), unprotected.
+func (m *MockCard) transmitSecure(apdu []byte) ([]byte, error) {
+	plain, err := m.SM.unwrapCommand(apdu)
+	if err != nil {
+		return swBytes(0x6988), nil
+	}
+	m.secure = true
+	resp := m.process(plain)
+	m.secure = false
+	return m.SM.wrapResponse(resp)
+}
+
+// process answers a plain command
+func (m *MockCard) process(apdu []byte) []byte {
+	cla := apdu[0]
+	if apdu[1] == INS_INCREASE && cla&0xF0 == 0x80 {
+		cla &^= 0x80 // TS 102.221 class 8X: channel bits as in class 0X
+	}
+	if (cla&0x40 == 0 && cla&^0x03 != 0x00) || (cla&0x40 != 0 && cla&0xF0 != 0x40) {
+		return swBytes(SW_CLA_NOT_SUPPORTED)
+	}
+	channel := CLAChannel(cla)
+	current, ok := m.open[channel]
+	if !ok {
+		return swBytes(SW_CHANNEL_NOT_SUPPORTED)
+	}
+	m.current = current
+	defer func() {
+		if _, ok := m.open[channel]; ok {
+			m.open[channel] = m.current
+		}
+	}()
+
+	ins := apdu[1]
+	if ins != INS_GET_RESPONSE {
+		m.pending = nil
+	}
+	switch ins {
+	case INS_MANAGE_CHANNEL:
+		return m.doManageChannel(apdu)
+	case INS_SELECT:
+		return m.doSelect(apdu)
+	case INS_GET_RESPONSE:
+		return m.doGetResponse(apdu)
+	case INS_READ_BINARY:
+		return m.doReadBinary(apdu)
+	case INS_UPDATE_BINARY:
+		return m.doUpdateBinary(apdu)
+	case INS_READ_RECORD:
+		return m.doReadRecord(apdu)
+	case INS_UPDATE_RECORD:
+		return m.doUpdateRecord(apdu)
+	case INS_INCREASE:
+		return m.doIncrease(apdu)
+	case INS_VERIFY:
+		return m.doVerify(apdu)
+	case INS_STATUS:
+		return swBytes(SW_OK)
+	case INS_GET_CHALLENGE:
+		n := apduLe(apdu)
+		if n < 0 {
+			return swBytes(SW_WRONG_LENGTH)
+		}
+		challenge := make([]byte, n)
+		rand.Read(challenge)
+		return append(challenge, 0x90, 0x00)
+	}
+	return swBytes(SW_INS_NOT_SUPPORTED)
+}
+
+// Reset implements Transport: selects the MF and clears verification state
+func (m *MockCard) Reset(cold bool) ([]byte, error) {
+	m.current = m.mf
+	m.open = map[byte]*MockFile{0: m.mf}
+	m.pending = nil
+	m.verified = map[byte]bool{}
+	m.Resets = append(m.Resets, cold)
+	if !cold && m.WarmATR != nil {
+		return m.WarmATR, nil
+	}
+	return m.ATR, nil
+}
+
+// doManageChannel opens (P1=00, card assigns the number) or closes (P1=80, P2=channel) a logical channel
+func (m *MockCard) doManageChannel(apdu []byte) []byte {
+	switch apdu[2] {
+	case 0x00:
+		if apdu[3] != 0x00 {
+			return swBytes(SW_WRONG_P1P2)
+		}
+		for ch := byte(1); int(ch) < m.Channels; ch++ {
+			if _, used := m.open[ch]; !used {
+				m.open[ch] = m.mf
+				return []byte{ch, 0x90, 0x00}
+			}
+		}
+		return swBytes(SW_CHANNEL_NOT_SUPPORTED)
+	case 0x80:
+		if _, used := m.open[apdu[3]]; !used || apdu[3] == 0 {
+			return swBytes(SW_CHANNEL_NOT_SUPPORTED)
+		}
+		delete(m.open, apdu[3])
+		return swBytes(SW_OK)
+	}
+	return swBytes(SW_WRONG_P1P2)
+}
+
+// Close implements Transport
+func (m *MockCard) Close() error {
+	return nil
+}
+
+func swBytes(sw uint16) []byte {
+	return []byte{byte(sw >> 8), byte(sw)}
+}
+
+// apduData returns the command data field (short APDUs only)
+func apduData(apdu []byte) []byte {
+	if len(apdu) <= 5 {
+		return nil
+	}
+	lc := int(apdu[4])
+	if 5+lc > len(apdu) {
+		return apdu[5:]
+	}
+	return apdu[5 : 5+lc]
+}
+
+// apduLe returns Le for case 2 commands (0 means 256, extended Le 0000 means 65536)
+func apduLe(apdu []byte) int {
+	if len(apdu) == 7 && apdu[4] == 0 {
+		if le := int(apdu[5])<<8 | int(apdu[6]); le != 0 {
+			return le
+		}
+		return 65536
+	}
+	if len(apdu) != 5 {
+		return -1
+	}
+	if apdu[4] == 0 {
+		return 256
+	}
+	return int(apdu[4])
+}
+
+func (m *MockCard) doSelect(apdu []byte) []byte {
+	p1, p2 := apdu[2], apdu[3]
+	data := apduData(apdu)
+	if sw, ok := m.FailSelect[fmt.Sprintf("%X", data)]; ok {
+		return swBytes(sw)
+	}
+
+	var target *MockFile
+	if p1 == 0x04 && m.AIDSelectP2 != nil && !bytes.Contains(m.AIDSelectP2, []byte{p2}) {
+		return swBytes(SW_WRONG_P1P2)
+	}
+
+	switch p1 {
+	case 0x04: // by AID
+		for _, c := range m.mf.Children {
+			if len(c.AID) > 0 && len(data) > 0 && bytes.HasPrefix(c.AID, data) {
+				target = c
+				break
+			}
+		}
+	case 0x08: // by path from MF
+		target = m.mf
+		for i := 0; i+1 < len(data) && target != nil; i += 2 {
+			fid := uint16(data[i])<<8 | uint16(data[i+1])
+			if i == 0 && fid == 0x3F00 {
+				continue
+			}
+			target = target.child(fid)
+		}
+	case 0x00: // by FID
+		if len(data) != 2 {
+			return swBytes(SW_WRONG_LENGTH)
+		}
+		target = m.findByFID(uint16(data[0])<<8 | uint16(data[1]))
+	default:
+		return swBytes(SW_WRONG_P1P2)
+	}
+
+	if target == nil {
+		return swBytes(SW_FILE_NOT_FOUND)
+	}
+	m.current = target
+	m.recPtr = 0
+
+	if p2&0x0C == 0x0C {
+		return swBytes(SW_OK)
+	}
+	fcp := target.fcp()
+	if len(apdu) == 5+len(data)+1 {
+		// Le present: return FCP directly
+		return append(fcp, 0x90, 0x00)
+	}
+	m.pending = fcp
+	return []byte{0x61, byte(len(fcp))}
+}
+
+// findByFID resolves a FID relative to the current file (ISO 7816-4 selection rules)
+func (m *MockCard) findByFID(fid uint16) *MockFile {
+	if fid == 0x3F00 {
+		return m.mf
+	}
+	df := m.current
+	if !df.isDF {
+		df = df.parent
+	}
+	if fid == 0x7FFF {
+		for d := df; d != nil; d = d.parent {
+			if len(d.AID) > 0 {
+				return d
+			}
+		}
+		return nil
+	}
+	if df.FID == fid && len(df.AID) == 0 {
+		return df
+	}
+	if c := df.child(fid); c != nil {
+		return c
+	}
+	if df.parent != nil {
+		if df.parent.FID == fid {
+			return df.parent
+		}
+		if c := df.parent.child(fid); c != nil && c.isDF {
+			return c
+		}
+	}
+	return nil
+}
+
+func (f *MockFile) child(fid uint16) *MockFile {
+	for _, c := range f.Children {
+		if c.FID == fid && len(c.AID) == 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+// fcp builds the FCP template (ETSI TS 102 221 11.1.1.3)
+func (f *MockFile) fcp() []byte {
+	var body []byte
+	switch {
+	case f.isDF:
+		body = append(body, 0x82, 0x02, 0x78, 0x21)
+		body = append(body, 0x83, 0x02, byte(f.FID>>8), byte(f.FID))
+		if len(f.AID) > 0 {
+			body = append(body, 0x84, byte(len(f.AID)))
+			body = append(body, f.AID...)
+		}
+	case f.Records != nil:
+		recLen := 0
+		if len(f.Records) > 0 {
+			recLen = len(f.Records[0])
+		}
+		descriptor := byte(0x42)
+		if f.Cyclic {
+			descriptor = 0x46
+		}
+		body = append(body, 0x82, 0x05, descriptor, 0x21, byte(recLen>>8), byte(recLen), byte(len(f.Records)))
+		body = append(body, 0x83, 0x02, byte(f.FID>>8), byte(f.FID))
+		size := recLen * len(f.Records)
+		body = append(body, 0x80, 0x02, byte(size>>8), byte(size))
+	default:
+		body = append(body, 0x82, 0x02, 0x41, 0x21)
+		body = append(body, 0x83, 0x02, byte(f.FID>>8), byte(f.FID))
+		body = append(body, 0x80, 0x02, byte(len(f.Data)>>8), byte(len(f.Data)))
+	}
+	if len(f.Security) > 0 {
+		body = append(body, 0x8C, byte(len(f.Security)))
+		body = append(body, f.Security...)
+	}
+	if len(f.ARR) > 0 {
+		body = append(body, 0x8B, byte(len(f.ARR)))
+		body = append(body, f.ARR...)
+	}
+	body = append(body, 0x8A, 0x01, 0x05) // Operational, activated
+	return append([]byte{0x62, byte(len(body))}, body...)
+}
+
+func (m *MockCard) doGetResponse(apdu []byte) []byte {
+	if m.pending == nil {
+		return swBytes(SW_CONDITIONS_NOT_SATISFIED)
+	}
+	le := apduLe(apdu)
+	data := m.pending
+	if le >= 0 && le < len(data) {
+		rest := data[le:]
+		m.pending = rest
+		return append(append([]byte(nil), data[:le]...), 0x61, byte(len(rest)))
+	}
+	m.pending = nil
+	return append(append([]byte(nil), data...), 0x90, 0x00)
+}
+
+func (m *MockCard) doReadBinary(apdu []byte) []byte {
+	ef := m.current
+	if ef.isDF || ef.Records != nil {
+		return swBytes(SW_COMMAND_NOT_ALLOWED)
+	}
+	if sw := m.readDenied(ef); sw != nil {
+		return sw
+	}
+	offset := int(apdu[2])<<8 | int(apdu[3])
+	if offset > len(ef.Data) {
+		return swBytes(SW_WRONG_P1P2)
+	}
+	le := apduLe(apdu)
+	remaining := len(ef.Data) - offset
+	if le < 0 || le > remaining {
+		return []byte{0x6C, byte(remaining)}
+	}
+	return append(append([]byte(nil), ef.Data[offset:offset+le]...), 0x90, 0x00)
+}
+
+func (m *MockCard) doUpdateBinary(apdu []byte) []byte {
+	ef := m.current
+	if ef.isDF || ef.Records != nil {
+		return swBytes(SW_COMMAND_NOT_ALLOWED)
+	}
+	offset := int(apdu[2])<<8 | int(apdu[3])
+	data := apduData(apdu)
+	if offset+len(data) > len(ef.Data) {
+		return swBytes(SW_WRONG_P1P2)
+	}
+	copy(ef.Data[offset:], data)
+	return swBytes(SW_OK)
+}
+
+// record resolves the record addressed by P1/P2 (absolute, current, next or previous mode).
+// Next/previous move the record pointer and wrap around in cyclic files.
+func (m *MockCard) record(apdu []byte) (*MockFile, int, []byte) {
+	ef := m.current
+	if ef.isDF || ef.Records == nil {
+		return nil, 0, swBytes(SW_COMMAND_NOT_ALLOWED)
+	}
+	n := len(ef.Records)
+	rec := int(apdu[2])
+	switch apdu[3] & 0x07 {
+	case 0x04: // absolute / current
+		if rec == 0 {
+			rec = m.recPtr
+		}
+	case 0x02: // next
+		switch {
+		case m.recPtr == 0:
+			rec = 1
+		case m.recPtr < n:
+			rec = m.recPtr + 1
+		case ef.Cyclic:
+			rec = 1
+		default:
+			return nil, 0, swBytes(SW_RECORD_NOT_FOUND)
+		}
+		m.recPtr = rec
+	case 0x03: // previous
+		switch {
+		case m.recPtr == 0:
+			rec = n
+		case m.recPtr > 1:
+			rec = m.recPtr - 1
+		case ef.Cyclic:
+			rec = n
+		default:
+			return nil, 0, swBytes(SW_RECORD_NOT_FOUND)
+		}
+		m.recPtr = rec
+	default:
+		return nil, 0, swBytes(SW_WRONG_P1P2)
+	}
+	if rec < 1 || rec > n {
+		return nil, 0, swBytes(SW_RECORD_NOT_FOUND)
+	}
+	return ef, rec - 1, nil
+}
+
+func (m *MockCard) doReadRecord(apdu []byte) []byte {
+	ef, idx, sw := m.record(apdu)
+	if sw != nil {
+		return sw
+	}
+	if sw := m.readDenied(ef); sw != nil {
+		return sw
+	}
+	data := ef.Records[idx]
+	if apduLe(apdu) != len(data) {
+		return []byte{0x6C, byte(len(data))}
+	}
+	return append(append([]byte(nil), data...), 0x90, 0x00)
+}
+
+// readDenied returns the status word refusing a READ of ef, or nil
+func (m *MockCard) readDenied(ef *MockFile) []byte {
+	if ef.ReadSW != 0 {
+		return swBytes(ef.ReadSW)
+	}
+	if ef.ReadSM && !m.secure {
+		return swBytes(SW_SECURITY_NOT_SATISFIED)
+	}
+	if ef.ReadKey != 0 && !m.verified[ef.ReadKey] {
+		return swBytes(SW_SECURITY_NOT_SATISFIED)
+	}
+	return nil
+}
+
+func (m *MockCard) doUpdateRecord(apdu []byte) []byte {
+	if ef := m.current; ef.Cyclic && apdu[3]&0x07 == 0x03 {
+		// Cyclic EF: the oldest record is overwritten and becomes record 1
+		data := apduData(apdu)
+		if len(ef.Records) == 0 || len(data) != len(ef.Records[0]) {
+			return swBytes(SW_WRONG_LENGTH)
+		}
+		copy(ef.Records[1:], ef.Records[:len(ef.Records)-1])
+		ef.Records[0] = append([]byte(nil), data...)
+		m.recPtr = 1
+		return swBytes(SW_OK)
+	}
+	ef, idx, sw := m.record(apdu)
+	if sw != nil {
+		return sw
+	}
+	data := apduData(apdu)
+	if len(data) != len(ef.Records[idx]) {
+		return swBytes(SW_WRONG_LENGTH)
+	}
+	copy(ef.Records[idx], data)
+	return swBytes(SW_OK)
+}
+
+// doIncrease adds the command data to record 1 of a cyclic EF and stores the sum in the
+// oldest record, which becomes record 1. The sum must fit the record (9850 otherwise).
+func (m *MockCard) doIncrease(apdu []byte) []byte {
+	ef := m.current
+	if !ef.Cyclic || len(ef.Records) == 0 {
+		return swBytes(SW_COMMAND_NOT_ALLOWED)
+	}
+	amount := apduData(apdu)
+	size := len(ef.Records[0])
+	if len(amount) == 0 || len(amount) > size {
+		return swBytes(SW_WRONG_LENGTH)
+	}
+	sum := make([]byte, size)
+	carry := 0
+	for i := size - 1; i >= 0; i-- {
+		v := int(ef.Records[0][i]) + carry
+		if j := i - (size - len(amount)); j >= 0 {
+			v += int(amount[j])
+		}
+		sum[i], carry = byte(v), v>>8
+	}
+	if carry != 0 {
+		return swBytes(0x9850)
+	}
+	copy(ef.Records[1:], ef.Records[:len(ef.Records)-1])
+	ef.Records[0] = sum
+	m.recPtr = 1
+	return append(append(sum, amount...), 0x90, 0x00)
+}
+
+func (m *MockCard) doVerify(apdu []byte) []byte {
+	ref := apdu[3]
+	key, ok := m.Keys[ref]
+	if !ok {
+		return swBytes(SW_DATA_NOT_FOUND)
+	}
+	if _, ok := m.tries[ref]; !ok {
+		m.tries[ref] = m.initialTries(ref)
+	}
+	if m.tries[ref] == 0 {
+		return swBytes(SW_AUTH_FAILED)
+	}
+	data := apduData(apdu)
+	if len(data) == 0 {
+		if m.verified[ref] {
+			return swBytes(SW_OK)
+		}
+		return []byte{0x63, 0xC0 | byte(m.tries[ref])}
+	}
+	padded := bytes.Repeat([]byte{0xFF}, max(8, len(key)))
+	copy(padded, key)
+	if !bytes.Equal(data, padded) {
+		m.tries[ref]--
+		m.verified[ref] = false
+		return []byte{0x63, 0xC0 | byte(m.tries[ref])}
+	}
+	m.tries[ref] = m.initialTries(ref)
+	m.verified[ref] = true
+	return swBytes(SW_OK)
+}
+
+func (m *MockCard) initialTries(ref byte) int {
+	if n, ok := m.Retries[ref]; ok {
+		return n
+	}
+	return 3
+}
@@ -0,0 +1,190 @@
+package card
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/ebfe/scard"
+)
+
+// LinkParams describes the current reader/card transmission parameters as reported by
+// the PC/SC driver (SCARD_ATTR_CURRENT_*). Fields are zero when the driver does not report them.
+type LinkParams struct {
+	Protocol    string // "T=0" / "T=1"
+	F           int    // Current clock rate conversion factor
+	D           int    // Current baud rate adjustment factor
+	ClockKHz    int    // Current clock (kHz)
+	MaxDataRate int    // Reader maximum data rate (bps)
+}
+
+// String returns a compact representation, e.g. "T=0 F=512 D=32 clk=4000kHz".
+func (p LinkParams) String() string {
+	s := p.Protocol
+	if s == "" {
+		s = "T=?"
+	}
+	if p.F > 0 && p.D > 0 {
+		s += fmt.Sprintf(" F=%d D=%d", p.F, p.D)
+	}
+	if p.ClockKHz > 0 {
+		s += fmt.Sprintf(" clk=%dkHz", p.ClockKHz)
+	}
+	if p.MaxDataRate > 0 {
+		s += fmt.Sprintf(" reader max=%d bps", p.MaxDataRate)
+	}
+	return s
+}
+
+// ExchangeRate is the result of a fixed APDU probe sequence.
+type ExchangeRate struct {
+	APDUs    int
+	Duration time.Duration
+}
+
+// PerSecond returns APDUs per second.
+func (e ExchangeRate) PerSecond() float64 {
+	if e.Duration <= 0 {
+		return 0
+	}
+	return float64(e.APDUs) / e.Duration.Seconds()
+}
+
+// FastResult reports the outcome of NegotiateFast.
+type FastResult struct {
+	Before     LinkParams
+	After      LinkParams
+	Negotiated bool   // Reconnect with explicit protocol succeeded and card responds
+	Note       string // Explanation when negotiation was skipped or reverted
+}
+
+// attribUint32 decodes a little-endian DWORD attribute (as returned by PC/SC drivers).
+func attribUint32(b []byte) int {
+	switch {
+	case len(b) >= 4:
+		return int(binary.LittleEndian.Uint32(b[:4]))
+	case len(b) == 2:
+		return int(binary.LittleEndian.Uint16(b))
+	case len(b) == 1:
+		return int(b[0])
+	default:
+		return 0
+	}
+}
+
+// LinkParams queries current transmission parameters from the PC/SC driver.
+// Missing attributes are left zero (many drivers do not implement them).
+func (r *Reader) LinkParams() LinkParams {
+	var p LinkParams
+	if r.card == nil {
+		return p
+	}
+	switch r.card.ActiveProtocol() {
+	case scard.ProtocolT0:
+		p.Protocol = "T=0"
+	case scard.ProtocolT1:
+		p.Protocol = "T=1"
+	}
+	if b, err := r.card.GetAttrib(scard.AttrCurrentF); err == nil {
+		p.F = attribUint32(b)
+	}
+	if b, err := r.card.GetAttrib(scard.AttrCurrentD); err == nil {
+		p.D = attribUint32(b)
+	}
+	if b, err := r.card.GetAttrib(scard.AttrCurrentClk); err == nil {
+		p.ClockKHz = attribUint32(b)
+	}
+	if b, err := r.card.GetAttrib(scard.AttrMaxDataRate); err == nil {
+		p.MaxDataRate = attribUint32(b)
+	}
+	return p
+}
+
+// MeasureExchangeRate runs a fixed read-only probe sequence rounds times
+// (SELECT MF, SELECT EF_ICCID, READ BINARY 10) and measures APDUs per second.
+func (r *Reader) MeasureExchangeRate(rounds int) (ExchangeRate, error) {
+	if rounds <= 0 {
+		rounds = 10
+	}
+	probe := [][]byte{
+		{0x00, INS_SELECT, 0x00, 0x0C, 0x02, 0x3F, 0x00},
+		{0x00, INS_SELECT, 0x00, 0x0C, 0x02, 0x2F, 0xE2},
+		{0x00, INS_READ_BINARY, 0x00, 0x00, 0x0A},
+	}
+
+	var res ExchangeRate
+	start := time.Now()
+	for i := 0; i < rounds; i++ {
+		for _, apdu := range probe {
+			if _, err := r.SendAPDU(apdu); err != nil {
+				return res, err
+			}
+			res.APDUs++
+		}
+	}
+	res.Duration = time.Since(start)
+	return res, nil
+}
+
+// NegotiateFast attempts to switch to the faster parameters advertised in TA1.
+//
+// PC/SC does not expose a portable PPS call; drivers perform PPS themselves when the
+// card is (re)connected with an explicit protocol. We therefore reconnect with the
+// active protocol requested explicitly, then verify the card still answers. If the
+// reader refuses or the card stops responding, we power-cycle back to default parameters.
+func (r *Reader) NegotiateFast() (*FastResult, error) {
+	if r.card == nil {
+		return nil, fmt.Errorf("no card connected")
+	}
+	res := &FastResult{Before: r.LinkParams()}
+
+	info, err := ParseATR(r.atr)
+	if err != nil {
+		return res, fmt.Errorf("cannot parse ATR: %w", err)
+	}
+	if !info.PPSCapable() {
+		res.Note = "card does not advertise faster parameters (no TA1 or specific mode)"
+		res.After = res.Before
+		return res, nil
+	}
+
+	proto := r.card.ActiveProtocol()
+	if proto != scard.ProtocolT0 && proto != scard.ProtocolT1 {
+		proto = scard.ProtocolT0
+	}
+
+	if err := r.card.Reconnect(r.shareMode.scardMode(), proto, scard.ResetCard); err != nil {
+		res.Note = fmt.Sprintf("reader refused reconnect with explicit protocol: %v", err)
+		r.restoreDefaultLink()
+		res.After = r.LinkParams()
+		return res, nil
+	}
+
+	// Card must still answer a trivial command (any status word is fine, GSM cards reply 6E00)
+	if _, err := r.SendAPDU([]byte{0x00, INS_SELECT, 0x00, 0x0C, 0x02, 0x3F, 0x00}); err != nil {
+		res.Note = "card did not respond after negotiation, reverted to default parameters"
+		r.restoreDefaultLink()
+		res.After = r.LinkParams()
+		return res, nil
+	}
+
+	if status, err := r.card.Status(); err == nil {
+		r.atr = status.Atr
+	}
+	res.Negotiated = true
+	res.After = r.LinkParams()
+	if res.After.F > 0 && res.After.F == 372 && res.After.D == 1 {
+		res.Note = fmt.Sprintf("reader kept default parameters (TA1=%02X not applied by driver)", info.TA[1])
+	}
+	return res, nil
+}
+
+// restoreDefaultLink power-cycles the card with automatic protocol selection.
+func (r *Reader) restoreDefaultLink() {
+	if err := r.card.Reconnect(r.shareMode.scardMode(), scard.ProtocolAny, scard.UnpowerCard); err != nil {
+		return
+	}
+	if status, err := r.card.Status(); err == nil {
+		r.atr = status.Atr
+	}
+}
@@ -0,0 +1,60 @@
+package card
+
+import (
+	"testing"
+	"time"
+)
+
+// ============ LINK PARAMETER TESTS ============
+
+func TestAttribUint32(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want int
+	}{
+		{"Empty", nil, 0},
+		{"1 byte", []byte{0x20}, 32},
+		{"2 bytes", []byte{0x00, 0x02}, 512},
+		{"DWORD", []byte{0xA0, 0x0F, 0x00, 0x00}, 4000},
+		{"DWORD with trailing", []byte{0x74, 0x01, 0x00, 0x00, 0xFF}, 372},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := attribUint32(tc.in); got != tc.want {
+				t.Errorf("attribUint32(%X) = %d, want %d", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLinkParams_String(t *testing.T) {
+	tests := []struct {
+		name string
+		p    LinkParams
+		want string
+	}{
+		{"Unknown", LinkParams{}, "T=?"},
+		{"Protocol only", LinkParams{Protocol: "T=0"}, "T=0"},
+		{"Full", LinkParams{Protocol: "T=0", F: 512, D: 32, ClockKHz: 4000, MaxDataRate: 344086},
+			"T=0 F=512 D=32 clk=4000kHz reader max=344086 bps"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.p.String(); got != tc.want {
+				t.Errorf("LinkParams.String() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExchangeRate_PerSecond(t *testing.T) {
+	if got := (ExchangeRate{APDUs: 60, Duration: 2 * time.Second}).PerSecond(); got != 30 {
+		t.Errorf("PerSecond() = %v, want 30", got)
+	}
+	if got := (ExchangeRate{APDUs: 10}).PerSecond(); got != 0 {
+		t.Errorf("PerSecond() with zero duration = %v, want 0", got)
+	}
+}
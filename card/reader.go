@@ -2,7 +2,9 @@
 package card
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ebfe/scard"
 )
@@ -13,6 +15,89 @@ type Reader struct {
 	card *scard.Card
 	name string
 	atr  []byte
+
+	// transport replaces the PC/SC card when set (simulated cards in tests)
+	transport Transport
+
+	// lastSW is the status word of the most recent SendAPDU exchange
+	lastSW uint16
+
+	// caps holds the detected card capabilities (nil until DetectCapabilities)
+	caps *CardCapabilities
+	// maxAPDUSize limits command/response data sizes (0 = as advertised)
+	maxAPDUSize int
+
+	// channel is the logical channel encoded into the CLA of every APDU (0 = basic channel)
+	channel byte
+
+	// dryRun intercepts state-changing commands (see SetDryRun)
+	dryRun    bool
+	dryRunLog []DryRunEntry
+
+	// readOnly blocks state-changing commands (see SetReadOnly)
+	readOnly bool
+
+	// pinCache keeps the accepted PIN1 for re-verification after Reconnect (see WithPINCache)
+	pinCache   bool
+	cachedPIN1 string
+
+	// resetPolicy selects the resets done without an explicit Reconnect (see WithResetPolicy)
+	resetPolicy ResetPolicy
+
+	// retry recovers from transport errors (see WithRetry)
+	retry       RetryPolicy
+	session     sessionState
+	recoveryLog []RecoveryEvent
+	onRecovery  func(RecoveryEvent)
+
+	// resume re-initializes a card the reader powered down (see WithSessionResume)
+	resume bool
+
+	// fixture records a card image for the mock backend (see WithFixtureRecording)
+	fixture *fixtureRecorder
+
+	// changes records file writes with their previous content (see SetChangeLog)
+	changes *changeLog
+
+	// trace receives every exchange passed to Transmit (see SetTrace)
+	trace func(APDUExchange)
+
+	// metrics counts the commands sent to the card into the running operations (see WithMetrics)
+	metrics *Metrics
+
+	// shareMode is the PC/SC access mode (see WithShareMode)
+	shareMode ShareMode
+
+	// secret names the key material being read: responses are kept out of the trace
+	// and the fixture (see WithSecret)
+	secret string
+
+	// sm protects the commands sent with SendSecure (see SetSecureMessaging)
+	sm *SMSession
+
+	// dirs is the current directory of each logical channel (see CurrentDF)
+	dirs map[byte]string
+
+	// aidP2 is the SELECT by AID response option the card accepted (see selectAID)
+	aidP2       byte
+	aidP2Known  bool
+	onAIDSelect func(p2 byte)
+}
+
+// Transport is a non-PC/SC card backend
+type Transport interface {
+	Transmit(apdu []byte) ([]byte, error)
+	Reset(cold bool) ([]byte, error)
+	Close() error
+}
+
+// NewReaderWithTransport creates a Reader that talks to the card through t instead of PC/SC
+func NewReaderWithTransport(name string, atr []byte, t Transport, opts ...ConnectOption) *Reader {
+	reader := &Reader{name: name, atr: atr, transport: t}
+	for _, opt := range opts {
+		opt(reader)
+	}
+	return reader
 }
 
 // ListReaders returns a list of available smart card readers
@@ -32,16 +117,16 @@ func ListReaders() ([]string, error) {
 }
 
 // Connect connects to a smart card reader by index
-func Connect(readerIndex int) (*Reader, error) {
+func Connect(readerIndex int, opts ...ConnectOption) (*Reader, error) {
 	ctx, err := scard.EstablishContext()
 	if err != nil {
-		return nil, fmt.Errorf("failed to establish PC/SC context: %w", err)
+		return nil, fmt.Errorf("failed to establish PC/SC context: %w", classifyConnectError(err))
 	}
 
 	readers, err := ctx.ListReaders()
 	if err != nil {
 		ctx.Release()
-		return nil, fmt.Errorf("failed to list readers: %w", err)
+		return nil, fmt.Errorf("failed to list readers: %w", classifyConnectError(err))
 	}
 
 	if len(readers) == 0 {
@@ -56,10 +141,15 @@ func Connect(readerIndex int) (*Reader, error) {
 
 	readerName := readers[readerIndex]
 
-	card, err := ctx.Connect(readerName, scard.ShareShared, scard.ProtocolAny)
+	reader := &Reader{ctx: ctx, name: readerName}
+	for _, opt := range opts {
+		opt(reader)
+	}
+
+	card, err := ctx.Connect(readerName, reader.shareMode.scardMode(), scard.ProtocolAny)
 	if err != nil {
 		ctx.Release()
-		return nil, fmt.Errorf("failed to connect to card in reader '%s': %w", readerName, err)
+		return nil, fmt.Errorf("failed to connect to card in reader '%s' (%s): %w", readerName, reader.shareMode, classifyConnectError(err))
 	}
 
 	status, err := card.Status()
@@ -69,12 +159,9 @@ func Connect(readerIndex int) (*Reader, error) {
 		return nil, fmt.Errorf("failed to get card status: %w", err)
 	}
 
-	return &Reader{
-		ctx:  ctx,
-		card: card,
-		name: readerName,
-		atr:  status.Atr,
-	}, nil
+	reader.card = card
+	reader.atr = status.Atr
+	return reader, nil
 }
 
 // ConnectFirst connects to the first available reader with a card
@@ -82,8 +169,70 @@ func ConnectFirst() (*Reader, error) {
 	return Connect(0)
 }
 
-// Transmit sends an APDU command to the card and returns the response
-func (r *Reader) Transmit(apdu []byte) ([]byte, error) {
+// Transmit sends an APDU command to the card and returns the response.
+// The CLA byte is adjusted for the current logical channel (see UseChannel).
+// Transport errors are handled by the retry policy when one is set (see WithRetry).
+func (r *Reader) Transmit(apdu []byte) (response []byte, err error) {
+	if r.trace != nil {
+		start := time.Now()
+		defer func() { r.traceExchange(apdu, response, err, start) }()
+	}
+	if r.dryRun {
+		if response, handled, err := r.interceptWrite(apdu); handled {
+			return response, err
+		}
+	}
+	var before []byte
+	var write bool
+	if r.changes != nil {
+		before, write = r.beforeWrite(apdu)
+	}
+	sent := apdu
+	if r.channel != 0 && len(apdu) > 0 {
+		sent = append([]byte(nil), apdu...)
+		sent[0] = ChannelCLA(sent[0], r.channel)
+	}
+	response, err = r.transmitRaw(sent)
+	if err != nil && r.resume && IsPowerLoss(err) {
+		if response, err = r.resumeTransmit(sent, err); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		if r.retry.Attempts > 0 && !errors.Is(err, ErrReadOnly) {
+			return r.recoverTransmit(apdu, err)
+		}
+		return nil, err
+	}
+	r.trackSession(apdu, response)
+	r.trackDirectory(sent, response)
+	if r.fixture != nil && !r.secretRead(sent) {
+		r.fixture.observe(sent, response)
+	}
+	if r.changes != nil {
+		r.changes.observe(apdu, response, before, write)
+	}
+	return response, nil
+}
+
+// transmitRaw sends apdu unchanged to the transport or PC/SC card
+func (r *Reader) transmitRaw(apdu []byte) ([]byte, error) {
+	if err := r.checkReadOnly(apdu); err != nil {
+		return nil, err
+	}
+	if r.metrics != nil {
+		r.metrics.countAPDU()
+	}
+	if r.transport != nil {
+		response, err := r.transport.Transmit(apdu)
+		if err != nil {
+			return nil, fmt.Errorf("transmit failed: %w", err)
+		}
+		return response, nil
+	}
+	if r.card == nil {
+		return nil, fmt.Errorf("no card connected")
+	}
 	response, err := r.card.Transmit(apdu)
 	if err != nil {
 		return nil, fmt.Errorf("transmit failed: %w", err)
@@ -93,6 +242,9 @@ func (r *Reader) Transmit(apdu []byte) ([]byte, error) {
 
 // Close closes the connection to the card and releases resources
 func (r *Reader) Close() error {
+	if r.transport != nil {
+		return r.transport.Close()
+	}
 	if r.card != nil {
 		r.card.Disconnect(scard.LeaveCard)
 	}
@@ -112,14 +264,43 @@ func (r *Reader) ATR() []byte {
 	return r.atr
 }
 
+// LastSW returns the status word of the most recent APDU sent with SendAPDU (0 if none)
+func (r *Reader) LastSW() uint16 {
+	return r.lastSW
+}
+
 // ATRHex returns the ATR as hex string
 func (r *Reader) ATRHex() string {
 	return fmt.Sprintf("%X", r.atr)
 }
 
-// Reconnect performs a card reset/reconnection
+// Reconnect performs a card reset/reconnection and returns the new ATR
 // If cold is true, performs a cold reset (power cycle)
-func (r *Reader) Reconnect(cold bool) error {
+// With WithPINCache the cached PIN1 is verified again after the reset
+func (r *Reader) Reconnect(cold bool) ([]byte, error) {
+	defer r.Measure("card reset")()
+	if err := r.reset(cold); err != nil {
+		return nil, err
+	}
+	// The reset clears the selection and security state
+	r.session = sessionState{}
+	r.dirs = nil
+	if r.fixture != nil {
+		r.fixture.reset()
+	}
+	return append([]byte(nil), r.atr...), r.reverifyPIN1()
+}
+
+// reset resets the card without touching the recorded session state
+func (r *Reader) reset(cold bool) error {
+	if r.transport != nil {
+		atr, err := r.transport.Reset(cold)
+		if err != nil {
+			return fmt.Errorf("reconnect failed: %w", err)
+		}
+		r.atr = atr
+		return nil
+	}
 	if r.card == nil {
 		return fmt.Errorf("no card connected")
 	}
@@ -131,7 +312,7 @@ func (r *Reader) Reconnect(cold bool) error {
 		initType = scard.ResetCard // Warm reset
 	}
 
-	err := r.card.Reconnect(scard.ShareShared, scard.ProtocolAny, initType)
+	err := r.card.Reconnect(r.shareMode.scardMode(), scard.ProtocolAny, initType)
 	if err != nil {
 		return fmt.Errorf("reconnect failed: %w", err)
 	}
@@ -0,0 +1,34 @@
+package card
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrReadOnly is returned for every state-changing command while read-only mode is active
+var ErrReadOnly = errors.New("blocked in read-only mode")
+
+// SetReadOnly enables or disables read-only mode. While enabled, no command classified
+// as state-changing (the dry-run tables: UPDATE BINARY/RECORD, CHANGE REFERENCE DATA,
+// RESET RETRY COUNTER, PUT DATA, GP PUT KEY/INSTALL/LOAD/DELETE/STORE DATA, ...) reaches
+// the card; it fails with ErrReadOnly. The check is made on every APDU handed to the
+// transport, including recovery replays, so no write path can bypass it.
+func (r *Reader) SetReadOnly(enabled bool) {
+	r.readOnly = enabled
+}
+
+// ReadOnly reports whether read-only mode is active
+func (r *Reader) ReadOnly() bool {
+	return r.readOnly
+}
+
+// checkReadOnly returns an ErrReadOnly error if apdu must not be sent in read-only mode
+func (r *Reader) checkReadOnly(apdu []byte) error {
+	if !r.readOnly {
+		return nil
+	}
+	if name, _, ok := classifyWrite(apdu); ok {
+		return fmt.Errorf("%s (INS %02X) refused: %w", name, apdu[1], ErrReadOnly)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package card
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// ============ READ-ONLY TESTS ============
+
+func TestReadOnly_BlocksEveryWriteCommand(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	r.SetReadOnly(true)
+
+	var apdus [][]byte
+	for ins := range isoWriteCommands {
+		apdus = append(apdus, []byte{0x00, ins, 0x00, 0x00, 0x01, 0xAA})
+		apdus = append(apdus, []byte{0xA0, ins, 0x00, 0x00, 0x01, 0xAA})
+		apdus = append(apdus, []byte{0x01, ins, 0x00, 0x00, 0x01, 0xAA}) // logical channel 1
+	}
+	for ins := range gpWriteCommands {
+		apdus = append(apdus, []byte{0x80, ins, 0x00, 0x00, 0x01, 0xAA})
+		apdus = append(apdus, []byte{0x84, ins, 0x00, 0x00, 0x01, 0xAA}) // secure messaging
+	}
+	for _, apdu := range apdus {
+		if _, err := r.Transmit(apdu); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Transmit(%X) error = %v, want ErrReadOnly", apdu, err)
+		}
+	}
+	if len(m.Log) != 0 {
+		t.Errorf("%d blocked APDUs reached the card, first %X", len(m.Log), m.Log[0])
+	}
+}
+
+func TestReadOnly_AllowsReads(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddEF(0x2FE2, []byte{0x01, 0x02})
+	r := NewReaderWithTransport("Mock", m.ATR, m, WithRetry(2, 0))
+	r.SetReadOnly(true)
+
+	if resp, err := r.Select([]byte{0x2F, 0xE2}); err != nil || !resp.IsOK() {
+		t.Fatalf("Select() = %v, %v", resp, err)
+	}
+	data, err := r.ReadAllBinary(2)
+	if err != nil || !bytes.Equal(data, []byte{0x01, 0x02}) {
+		t.Fatalf("ReadAllBinary() = %X, %v", data, err)
+	}
+
+	// A blocked write is not mistaken for a transport error (no recovery reset)
+	if _, err := r.UpdateBinary(0, []byte{0xAA}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("UpdateBinary() error = %v, want ErrReadOnly", err)
+	}
+	if len(r.RecoveryLog()) != 0 {
+		t.Errorf("RecoveryLog() = %v, want no recovery", r.RecoveryLog())
+	}
+	if err := r.WriteAllBinary([]byte{0xAA, 0xBB}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("WriteAllBinary() error = %v, want ErrReadOnly", err)
+	}
+}
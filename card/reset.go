@@ -0,0 +1,110 @@
+package card
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ResetPolicy selects the resets the reader performs on its own: when a session starts
+// (ApplyResetPolicy) and when recovering from transport errors (see WithRetry)
+type ResetPolicy int
+
+const (
+	ResetWarm ResetPolicy = iota // warm reset, cold reset at session start if the warm one fails
+	ResetCold                    // power cycle
+	ResetNone                    // never reset the card without an explicit Reconnect
+)
+
+// String returns the name used by the --reset flag
+func (p ResetPolicy) String() string {
+	switch p {
+	case ResetCold:
+		return "cold"
+	case ResetNone:
+		return "none"
+	default:
+		return "warm"
+	}
+}
+
+// ParseResetPolicy parses a reset policy name (warm, cold, none)
+func ParseResetPolicy(s string) (ResetPolicy, error) {
+	for _, p := range []ResetPolicy{ResetWarm, ResetCold, ResetNone} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return ResetWarm, fmt.Errorf("unknown reset policy %q (warm, cold, none)", s)
+}
+
+// WithResetPolicy sets the reset policy of the reader (default ResetWarm)
+func WithResetPolicy(p ResetPolicy) ConnectOption {
+	return func(r *Reader) {
+		r.resetPolicy = p
+	}
+}
+
+// SetResetPolicy sets the reset policy
+func (r *Reader) SetResetPolicy(p ResetPolicy) {
+	r.resetPolicy = p
+}
+
+// ResetPolicy returns the reset policy
+func (r *Reader) ResetPolicy() ResetPolicy {
+	return r.resetPolicy
+}
+
+// ApplyResetPolicy resets the card at the start of a session according to the policy.
+// With ResetNone the card is left as found.
+func (r *Reader) ApplyResetPolicy() error {
+	switch r.resetPolicy {
+	case ResetNone:
+		return nil
+	case ResetCold:
+		_, err := r.Reconnect(true)
+		return err
+	}
+	if _, err := r.Reconnect(false); err != nil {
+		// Warm reset failed, try cold reset
+		if _, err := r.Reconnect(true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ATRComparison holds the ATRs answered to a cold and to a warm reset
+type ATRComparison struct {
+	Cold []byte
+	Warm []byte
+}
+
+// Differ reports whether the two ATRs are different
+func (c ATRComparison) Differ() bool {
+	return !bytes.Equal(c.Cold, c.Warm)
+}
+
+// HistoricalBytesDiffer reports whether the historical bytes are different. A genuine card
+// may change its interface bytes on a warm reset (specific mode, TA2), rarely its identity.
+func (c ATRComparison) HistoricalBytesDiffer() bool {
+	cold, err1 := ParseATR(c.Cold)
+	warm, err2 := ParseATR(c.Warm)
+	if err1 != nil || err2 != nil {
+		return c.Differ()
+	}
+	return !bytes.Equal(cold.HB, warm.HB)
+}
+
+// CompareResetATRs performs a cold reset followed by a warm reset and returns both ATRs.
+// The card is left in the state after the warm reset.
+func (r *Reader) CompareResetATRs() (*ATRComparison, error) {
+	cold, err := r.Reconnect(true)
+	if err != nil {
+		return nil, fmt.Errorf("cold reset: %w", err)
+	}
+	warm, err := r.Reconnect(false)
+	if err != nil {
+		return nil, fmt.Errorf("warm reset: %w", err)
+	}
+	return &ATRComparison{Cold: cold, Warm: warm}, nil
+}
@@ -0,0 +1,77 @@
+package card
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// ============ RESET POLICY TESTS ============
+
+func TestParseResetPolicy(t *testing.T) {
+	for _, p := range []ResetPolicy{ResetWarm, ResetCold, ResetNone} {
+		if got, err := ParseResetPolicy(p.String()); err != nil || got != p {
+			t.Errorf("ParseResetPolicy(%q) = %v, %v", p.String(), got, err)
+		}
+	}
+	if _, err := ParseResetPolicy("hot"); err == nil {
+		t.Error("ParseResetPolicy(hot) accepted")
+	}
+}
+
+func TestApplyResetPolicy(t *testing.T) {
+	tests := []struct {
+		policy ResetPolicy
+		want   []bool
+	}{
+		{ResetWarm, []bool{false}},
+		{ResetCold, []bool{true}},
+		{ResetNone, nil},
+	}
+	for _, tc := range tests {
+		m := NewMockCard([]byte{0x3B, 0x00})
+		r := NewReaderWithTransport("Mock", m.ATR, m, WithResetPolicy(tc.policy))
+		if err := r.ApplyResetPolicy(); err != nil {
+			t.Errorf("%s: ApplyResetPolicy() error = %v", tc.policy, err)
+		}
+		if !reflect.DeepEqual(m.Resets, tc.want) {
+			t.Errorf("%s: resets = %v, want %v", tc.policy, m.Resets, tc.want)
+		}
+	}
+}
+
+func TestCompareResetATRs(t *testing.T) {
+	cold := []byte{0x3B, 0x02, 0x14, 0x50}
+	tests := []struct {
+		name       string
+		warm       []byte
+		differ     bool
+		historical bool
+	}{
+		{"identical", nil, false, false},
+		{"other historical bytes", []byte{0x3B, 0x02, 0x14, 0x51}, true, true},
+		{"interface bytes only", []byte{0x3B, 0x12, 0x96, 0x14, 0x50}, true, false}, // TA1 added
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMockCard(cold)
+			m.WarmATR = tc.warm
+			r := NewReaderWithTransport("Mock", m.ATR, m)
+
+			cmp, err := r.CompareResetATRs()
+			if err != nil {
+				t.Fatalf("CompareResetATRs() error = %v", err)
+			}
+			if !reflect.DeepEqual(m.Resets, []bool{true, false}) {
+				t.Errorf("resets = %v, want cold then warm", m.Resets)
+			}
+			if !bytes.Equal(cmp.Cold, cold) || !bytes.Equal(r.ATR(), cmp.Warm) {
+				t.Errorf("cold %X, warm %X, reader ATR %X", cmp.Cold, cmp.Warm, r.ATR())
+			}
+			if cmp.Differ() != tc.differ || cmp.HistoricalBytesDiffer() != tc.historical {
+				t.Errorf("Differ() = %v, HistoricalBytesDiffer() = %v, want %v, %v",
+					cmp.Differ(), cmp.HistoricalBytesDiffer(), tc.differ, tc.historical)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package card
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrWriteInterrupted is returned when the transport fails while a state-changing command is
+// in flight. The command may or may not have been executed by the card, so it is never retried.
+var ErrWriteInterrupted = errors.New("transport failed mid-write, manual verification required")
+
+// maxReplaySelects bounds the SELECT history replayed after a reset
+const maxReplaySelects = 16
+
+// ConnectOption configures a Reader when it is created
+type ConnectOption func(*Reader)
+
+// RetryPolicy controls transparent recovery from transport-level errors
+type RetryPolicy struct {
+	Attempts int           // Recovery attempts per failed command (0 = disabled)
+	Backoff  time.Duration // Wait before the first attempt, doubled for each further attempt
+}
+
+// RecoveryEvent is one transport error handled by the retry policy
+type RecoveryEvent struct {
+	Command   string // Command name (SELECT, READ BINARY, UPDATE BINARY...)
+	APDU      []byte // Command APDU that failed
+	Cause     error  // Transport error that triggered the recovery
+	Attempts  int    // Recovery attempts made (0 if the command was not retried)
+	Recovered bool   // Command was re-sent successfully
+	Cold      bool   // Recovery resets were cold resets (ResetCold policy)
+	PowerLoss bool   // The reader had powered the card down (see WithSessionResume)
+	Err       error  // Final error when not recovered
+}
+
+// String returns a one-line description for logs and warnings
+func (e RecoveryEvent) String() string {
+	switch {
+	case e.PowerLoss && e.Recovered:
+		return fmt.Sprintf("%s: card powered down by the reader (%v); re-initialized and sent again", e.Command, e.Cause)
+	case e.PowerLoss:
+		return fmt.Sprintf("%s: card powered down by the reader (%v); re-initialization failed: %v", e.Command, e.Cause, e.Err)
+	case e.Recovered:
+		reset := "warm"
+		if e.Cold {
+			reset = "cold"
+		}
+		return fmt.Sprintf("%s: %v; recovered after %s reset (attempt %d)", e.Command, e.Cause, reset, e.Attempts)
+	case e.Attempts == 0:
+		return fmt.Sprintf("%s: %v; not retried: %v", e.Command, e.Cause, e.Err)
+	default:
+		return fmt.Sprintf("%s: %v; recovery failed after %d attempt(s): %v", e.Command, e.Cause, e.Attempts, e.Err)
+	}
+}
+
+// sessionState is the card state restored after a recovery reset
+type sessionState struct {
+	selects  [][]byte        // successful SELECTs since the last selection from the MF or by AID
+	verifies map[byte][]byte // successful VERIFY commands by key reference
+	order    []byte          // key references in verification order
+}
+
+// idempotentCommands are the interindustry instructions that can be re-sent safely after a reset
+var idempotentCommands = map[byte]string{
+	INS_SELECT:      "SELECT",
+	INS_READ_BINARY: "READ BINARY",
+	0xB1:            "READ BINARY",
+	INS_READ_RECORD: "READ RECORD",
+	0xB3:            "READ RECORD",
+	0xCA:            "GET DATA",
+	0xCB:            "GET DATA",
+	INS_STATUS:      "STATUS",
+}
+
+// WithRetry enables transparent recovery from transport errors (e.g. SCARD_E_NOT_TRANSACTED).
+// A failed SELECT, READ BINARY/RECORD, GET DATA or STATUS is re-sent after a warm reset that
+// restores the selected application and file and the verified PIN/ADM references, up to attempts
+// times with exponential backoff. State-changing commands are never re-sent: they fail with
+// ErrWriteInterrupted. The reset follows the reset policy: a cold reset with ResetCold, no
+// recovery at all with ResetNone.
+func WithRetry(attempts int, backoff time.Duration) ConnectOption {
+	return func(r *Reader) {
+		r.SetRetryPolicy(RetryPolicy{Attempts: attempts, Backoff: backoff})
+	}
+}
+
+// WithRecoveryHandler registers fn to be called for every recovery event
+func WithRecoveryHandler(fn func(RecoveryEvent)) ConnectOption {
+	return func(r *Reader) {
+		r.onRecovery = fn
+	}
+}
+
+// SetRetryPolicy sets the retry policy (Attempts 0 disables recovery)
+func (r *Reader) SetRetryPolicy(p RetryPolicy) {
+	if p.Attempts < 0 {
+		p.Attempts = 0
+	}
+	r.retry = p
+	r.session = sessionState{}
+}
+
+// RetryPolicy returns the current retry policy
+func (r *Reader) RetryPolicy() RetryPolicy {
+	return r.retry
+}
+
+// RecoveryLog returns the recovery events since the retry policy was set
+func (r *Reader) RecoveryLog() []RecoveryEvent {
+	return r.recoveryLog
+}
+
+// commandName returns the name used in recovery events
+func commandName(apdu []byte) string {
+	if name, _, ok := classifyWrite(apdu); ok {
+		return name
+	}
+	if len(apdu) >= 2 {
+		if name, ok := idempotentCommands[apdu[1]]; ok && isInterindustry(apdu[0]) {
+			return name
+		}
+		if apdu[1] == INS_VERIFY {
+			return "VERIFY"
+		}
+		return fmt.Sprintf("INS %02X", apdu[1])
+	}
+	return "APDU"
+}
+
+// isInterindustry reports whether cla is an ISO class (any channel) or the GSM class A0
+func isInterindustry(cla byte) bool {
+	return cla&0x80 == 0 || cla == 0xA0
+}
+
+// isIdempotent reports whether apdu may be re-sent after a reset. Proprietary class
+// commands are excluded: a secure channel session does not survive the reset.
+func isIdempotent(apdu []byte) bool {
+	if len(apdu) < 4 || !isInterindustry(apdu[0]) {
+		return false
+	}
+	_, ok := idempotentCommands[apdu[1]]
+	return ok
+}
+
+// trackSession records the SELECTs and VERIFYs needed to restore the card state after a reset
+func (r *Reader) trackSession(apdu, response []byte) {
+	if (r.retry.Attempts == 0 && !r.resume) || r.channel != 0 || len(apdu) < 4 || len(response) < 2 || !isInterindustry(apdu[0]) {
+		return
+	}
+	sw1, sw2 := response[len(response)-2], response[len(response)-1]
+	switch apdu[1] {
+	case INS_SELECT:
+		if !selectSucceeded(response) {
+			return
+		}
+		cmd := append([]byte(nil), apdu...)
+		data := apduData(apdu)
+		p1 := apdu[2]
+		if p1 == 0x04 || p1 == 0x08 || (len(data) == 2 && data[0] == 0x3F && data[1] == 0x00) {
+			r.session.selects = [][]byte{cmd}
+			return
+		}
+		if len(r.session.selects) >= maxReplaySelects {
+			// Keep the anchor (MF or ADF) and drop the oldest relative selection
+			r.session.selects = append(r.session.selects[:1], r.session.selects[2:]...)
+		}
+		r.session.selects = append(r.session.selects, cmd)
+	case INS_VERIFY:
+		if sw1 != 0x90 || sw2 != 0x00 || len(apduData(apdu)) == 0 {
+			return
+		}
+		ref := apdu[3]
+		if r.session.verifies == nil {
+			r.session.verifies = map[byte][]byte{}
+		}
+		if _, ok := r.session.verifies[ref]; !ok {
+			r.session.order = append(r.session.order, ref)
+		}
+		r.session.verifies[ref] = append([]byte(nil), apdu...)
+	}
+}
+
+// recoverTransmit handles a transport error of apdu according to the retry policy
+func (r *Reader) recoverTransmit(apdu []byte, cause error) ([]byte, error) {
+	event := RecoveryEvent{Command: commandName(apdu), APDU: append([]byte(nil), apdu...), Cause: cause,
+		Cold: r.resetPolicy == ResetCold}
+
+	switch {
+	case !isIdempotent(apdu):
+		if _, _, write := classifyWrite(apdu); write {
+			event.Err = fmt.Errorf("%w (%s)", ErrWriteInterrupted, event.Command)
+		} else {
+			event.Err = errors.New("command is not safe to re-send")
+		}
+	case r.resetPolicy == ResetNone:
+		event.Err = errors.New("reset policy none: the card is never reset during the session")
+	case r.channel != 0:
+		// Logical channels are closed by the reset and cannot be reopened with the same number
+		event.Err = fmt.Errorf("logical channel %d does not survive a reset", r.channel)
+	default:
+		backoff := r.retry.Backoff
+		for attempt := 1; attempt <= r.retry.Attempts; attempt++ {
+			event.Attempts = attempt
+			if backoff > 0 {
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+			if err := r.restoreSession(); err != nil {
+				event.Err = err
+				if errors.Is(err, errCredentialRejected) {
+					break
+				}
+				continue
+			}
+			response, err := r.transmitRaw(apdu)
+			if err != nil {
+				event.Err = err
+				continue
+			}
+			event.Recovered, event.Err = true, nil
+			r.logRecovery(event)
+			r.trackSession(apdu, response)
+			r.trackDirectory(apdu, response)
+			return response, nil
+		}
+	}
+
+	r.logRecovery(event)
+	if errors.Is(event.Err, ErrWriteInterrupted) {
+		return nil, fmt.Errorf("%w: %w", event.Err, cause)
+	}
+	if event.Attempts > 0 {
+		return nil, fmt.Errorf("%w (recovery failed after %d attempt(s): %v)", cause, event.Attempts, event.Err)
+	}
+	return nil, cause
+}
+
+// errCredentialRejected stops recovery when a stored PIN/ADM is refused after the reset,
+// since retrying would consume the retry counter
+var errCredentialRejected = errors.New("stored credential rejected")
+
+// restoreSession resets the card (warm, or cold with ResetCold) and replays the recorded
+// SELECTs and VERIFYs
+func (r *Reader) restoreSession() error {
+	if err := r.reset(r.resetPolicy == ResetCold); err != nil {
+		return err
+	}
+	return r.replaySession()
+}
+
+// replaySession replays the recorded SELECTs and VERIFYs
+func (r *Reader) replaySession() error {
+	// The reset closes the logical channels; the basic channel follows the replay
+	r.dirs = nil
+	for _, cmd := range r.session.selects {
+		response, err := r.transmitRaw(cmd)
+		if err != nil {
+			return err
+		}
+		if !selectSucceeded(response) {
+			return fmt.Errorf("re-select %X failed: SW=%X", apduData(cmd), response)
+		}
+		r.trackDirectory(cmd, response)
+	}
+	for _, ref := range r.session.order {
+		response, err := r.transmitRaw(r.session.verifies[ref])
+		if err != nil {
+			return err
+		}
+		if len(response) < 2 || response[len(response)-2] != 0x90 || response[len(response)-1] != 0x00 {
+			return fmt.Errorf("%w: re-verify of key reference %02X: SW=%X", errCredentialRejected, ref, response)
+		}
+	}
+	return nil
+}
+
+// selectSucceeded reports whether a SELECT response carries a success status
+// (9000, 91xx, or 61xx / 9Fxx with response data pending)
+func selectSucceeded(response []byte) bool {
+	if len(response) < 2 {
+		return false
+	}
+	switch response[len(response)-2] {
+	case 0x90, 0x91, 0x61, 0x9F:
+		return true
+	}
+	return false
+}
+
+func (r *Reader) logRecovery(event RecoveryEvent) {
+	r.recoveryLog = append(r.recoveryLog, event)
+	if r.onRecovery != nil {
+		r.onRecovery(event)
+	}
+}
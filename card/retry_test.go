@@ -0,0 +1,194 @@
+package card
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ebfe/scard"
+)
+
+// ============ RETRY POLICY TESTS ============
+
+// droppingTransport fails the next failNext transmissions with SCARD_E_NOT_TRANSACTED
+type droppingTransport struct {
+	*MockCard
+	failNext int
+	resets   int
+}
+
+func (f *droppingTransport) Transmit(apdu []byte) ([]byte, error) {
+	if f.failNext > 0 {
+		f.failNext--
+		return nil, scard.ErrNotTransacted
+	}
+	return f.MockCard.Transmit(apdu)
+}
+
+func (f *droppingTransport) Reset(cold bool) ([]byte, error) {
+	f.resets++
+	return f.MockCard.Reset(cold)
+}
+
+var retryTestAID = []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02}
+
+// newRetryTestReader returns a reader with PIN1 verified and EF_IMSI of the USIM selected
+func newRetryTestReader(t *testing.T, opts ...ConnectOption) (*Reader, *droppingTransport) {
+	t.Helper()
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.Keys[0x01] = []byte("1234")
+	m.AddADF(retryTestAID).AddEF(0x6F07, []byte{0x08, 0x09, 0x10, 0x10})
+	f := &droppingTransport{MockCard: m}
+	r := NewReaderWithTransport("Mock", m.ATR, f, opts...)
+
+	if resp, err := r.Select(retryTestAID); err != nil || !resp.IsOK() {
+		t.Fatalf("Select(ADF) = %v, %v", resp, err)
+	}
+	if err := r.VerifyPIN1("1234"); err != nil {
+		t.Fatalf("VerifyPIN1() error = %v", err)
+	}
+	if resp, err := r.Select([]byte{0x6F, 0x07}); err != nil || !resp.IsOK() {
+		t.Fatalf("Select(EF) = %v, %v", resp, err)
+	}
+	return r, f
+}
+
+func TestRetry_ReadRecovered(t *testing.T) {
+	r, f := newRetryTestReader(t, WithRetry(3, 0))
+	f.failNext = 1
+
+	resp, err := r.ReadBinary(0, 4)
+	if err != nil || !resp.IsOK() {
+		t.Fatalf("ReadBinary() = %v, %v", resp, err)
+	}
+	if !bytes.Equal(resp.Data, []byte{0x08, 0x09, 0x10, 0x10}) {
+		t.Errorf("ReadBinary() data = %X", resp.Data)
+	}
+	if f.resets != 1 {
+		t.Errorf("resets = %d, want 1", f.resets)
+	}
+	if !f.verified[0x01] {
+		t.Errorf("PIN1 not re-verified after the reset")
+	}
+	log := r.RecoveryLog()
+	if len(log) != 1 || !log[0].Recovered || log[0].Command != "READ BINARY" || log[0].Attempts != 1 {
+		t.Errorf("RecoveryLog() = %+v", log)
+	}
+}
+
+func TestRetry_Exhausted(t *testing.T) {
+	r, f := newRetryTestReader(t, WithRetry(2, 0))
+	f.failNext = 100
+
+	_, err := r.ReadBinary(0, 4)
+	if !errors.Is(err, scard.ErrNotTransacted) {
+		t.Fatalf("ReadBinary() error = %v, want SCARD_E_NOT_TRANSACTED", err)
+	}
+	if f.resets != 2 {
+		t.Errorf("resets = %d, want 2", f.resets)
+	}
+	if log := r.RecoveryLog(); len(log) != 1 || log[0].Recovered || log[0].Attempts != 2 {
+		t.Errorf("RecoveryLog() = %+v", log)
+	}
+}
+
+func TestRetry_WriteNotRetried(t *testing.T) {
+	var events []RecoveryEvent
+	r, f := newRetryTestReader(t, WithRetry(3, 0), WithRecoveryHandler(func(e RecoveryEvent) {
+		events = append(events, e)
+	}))
+	f.failNext = 1
+	sent := len(f.Log)
+
+	_, err := r.UpdateBinary(0, []byte{0xAA})
+	if !errors.Is(err, ErrWriteInterrupted) || !errors.Is(err, scard.ErrNotTransacted) {
+		t.Fatalf("UpdateBinary() error = %v, want ErrWriteInterrupted", err)
+	}
+	if len(f.Log) != sent || f.resets != 0 {
+		t.Errorf("write was retried: %d APDUs, %d resets", len(f.Log)-sent, f.resets)
+	}
+	if len(events) != 1 || events[0].Command != "UPDATE BINARY" || events[0].Attempts != 0 {
+		t.Errorf("recovery events = %+v", events)
+	}
+}
+
+func TestRetry_CredentialRejected(t *testing.T) {
+	r, f := newRetryTestReader(t, WithRetry(3, 0))
+	f.Keys[0x01] = []byte("9999") // PIN changed behind the session's back
+	f.failNext = 1
+
+	if _, err := r.ReadBinary(0, 4); err == nil {
+		t.Fatal("ReadBinary() succeeded with a rejected PIN")
+	}
+	if f.resets != 1 {
+		t.Errorf("resets = %d, want 1 (no further attempts after a rejected PIN)", f.resets)
+	}
+	if f.tries[0x01] != 2 {
+		t.Errorf("PIN1 tries = %d, want 2", f.tries[0x01])
+	}
+}
+
+func TestRetry_Disabled(t *testing.T) {
+	r, f := newRetryTestReader(t)
+	f.failNext = 1
+
+	if _, err := r.ReadBinary(0, 4); !errors.Is(err, scard.ErrNotTransacted) {
+		t.Errorf("ReadBinary() error = %v, want SCARD_E_NOT_TRANSACTED", err)
+	}
+	if f.resets != 0 || len(r.RecoveryLog()) != 0 {
+		t.Errorf("recovery attempted without a retry policy")
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	tests := []struct {
+		name string
+		apdu []byte
+		want bool
+	}{
+		{"SELECT", []byte{0x00, 0xA4, 0x00, 0x04, 0x02, 0x6F, 0x07}, true},
+		{"GSM READ RECORD", []byte{0xA0, 0xB2, 0x01, 0x04, 0x1C}, true},
+		{"GET DATA", []byte{0x00, 0xCA, 0x00, 0x66, 0x00}, true},
+		{"UPDATE BINARY", []byte{0x00, 0xD6, 0x00, 0x00, 0x01, 0xAA}, false},
+		{"VERIFY", []byte{0x00, 0x20, 0x00, 0x01, 0x08}, false},
+		{"AUTHENTICATE", []byte{0x00, 0x88, 0x00, 0x81, 0x22}, false},
+		{"GP GET DATA", []byte{0x80, 0xCA, 0x00, 0x66, 0x00}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isIdempotent(tc.apdu); got != tc.want {
+				t.Errorf("isIdempotent(%X) = %v, want %v", tc.apdu, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetry_ResetPolicy(t *testing.T) {
+	// Cold policy: the recovery power cycles the card
+	r, f := newRetryTestReader(t, WithRetry(3, 0), WithResetPolicy(ResetCold))
+	f.failNext = 1
+	if _, err := r.ReadBinary(0, 4); err != nil {
+		t.Fatalf("ReadBinary() error = %v", err)
+	}
+	if len(f.Resets) != 1 || !f.Resets[0] {
+		t.Errorf("resets = %v, want one cold reset", f.Resets)
+	}
+	if log := r.RecoveryLog(); len(log) != 1 || !log[0].Cold || !strings.Contains(log[0].String(), "cold reset") {
+		t.Errorf("RecoveryLog() = %+v", log)
+	}
+
+	// None: the transport error is returned without touching the card
+	r, f = newRetryTestReader(t, WithRetry(3, 0), WithResetPolicy(ResetNone))
+	f.failNext = 1
+	if _, err := r.ReadBinary(0, 4); !errors.Is(err, scard.ErrNotTransacted) {
+		t.Errorf("ReadBinary() error = %v, want SCARD_E_NOT_TRANSACTED", err)
+	}
+	if f.resets != 0 {
+		t.Errorf("card reset %d times with reset policy none", f.resets)
+	}
+	if log := r.RecoveryLog(); len(log) != 1 || log[0].Attempts != 0 || log[0].Err == nil {
+		t.Errorf("RecoveryLog() = %+v", log)
+	}
+}
@@ -0,0 +1,253 @@
+package card
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Reader self-test parameters
+const (
+	selfTestCycles      = 10  // connect/disconnect cycles
+	selfTestRoundTrips  = 100 // timed SELECT MF / GET RESPONSE exchanges
+	selfTestStressReads = 200 // READ BINARY EF_ICCID repetitions
+	selfTestMaxErrors   = 5   // errors kept in the report
+)
+
+// Self-test verdicts
+const (
+	SelfTestHealthy  = "healthy"
+	SelfTestUnstable = "unstable"
+)
+
+// SelfTestReport is the result of a reader health check
+type SelfTestReport struct {
+	Reader string `json:"reader"`
+	ATR    string `json:"atr"`
+
+	// Connect/disconnect cycles
+	ConnectCycles   int      `json:"connect_cycles"`
+	ConnectFailures int      `json:"connect_failures"`
+	ATRMismatches   int      `json:"atr_mismatches"`
+	ATRVariants     []string `json:"atr_variants,omitempty"` // ATRs seen that differ from the first one
+
+	// Round-trip timing (SELECT MF and GET RESPONSE)
+	RoundTrips      int     `json:"round_trips"`
+	RoundTripErrors int     `json:"round_trip_errors"`
+	LatencyMinMs    float64 `json:"latency_min_ms"`
+	LatencyMedianMs float64 `json:"latency_median_ms"`
+	LatencyMaxMs    float64 `json:"latency_max_ms"`
+
+	// READ BINARY stress on EF_ICCID
+	StressReads      int    `json:"stress_reads"`
+	StressErrors     int    `json:"stress_errors"`
+	StressMismatches int    `json:"stress_mismatches"` // reads returning data different from the first read
+	StressSkipped    string `json:"stress_skipped,omitempty"`
+
+	Errors  []string `json:"errors,omitempty"` // first transmit/connect errors
+	Verdict string   `json:"verdict"`
+	Causes  []string `json:"suspected_causes,omitempty"`
+}
+
+// SelfTest checks the reader at readerIndex: connect/disconnect cycles with ATR comparison,
+// a latency profile of SELECT MF / GET RESPONSE round trips and a READ BINARY stress.
+// An error is returned only when the reader cannot be connected at all.
+func SelfTest(readerIndex int) (*SelfTestReport, error) {
+	return runSelfTest(func() (*Reader, error) { return Connect(readerIndex) })
+}
+
+// runSelfTest runs the self-test on readers obtained from connect
+func runSelfTest(connect func() (*Reader, error)) (*SelfTestReport, error) {
+	r, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	report := &SelfTestReport{Reader: r.Name(), ATR: r.ATRHex()}
+	r.Close()
+
+	for i := 0; i < selfTestCycles; i++ {
+		report.ConnectCycles++
+		c, err := connect()
+		if err != nil {
+			report.ConnectFailures++
+			report.addError(fmt.Sprintf("connect %d: %v", i+1, err))
+			continue
+		}
+		if atr := c.ATRHex(); atr != report.ATR {
+			report.ATRMismatches++
+			report.addATRVariant(atr)
+		}
+		c.Close()
+	}
+
+	r, err = connect()
+	if err != nil {
+		report.ConnectFailures++
+		report.addError(fmt.Sprintf("connect: %v", err))
+		report.evaluate(nil)
+		return report, nil
+	}
+	defer r.Close()
+
+	cla, latencies := report.measureRoundTrips(r)
+	report.stressRead(r, cla)
+	report.evaluate(latencies)
+	return report, nil
+}
+
+// measureRoundTrips times SELECT MF exchanges (and the GET RESPONSE they trigger)
+// and returns the CLA the card accepted (00, or A0 for GSM-only cards)
+func (t *SelfTestReport) measureRoundTrips(r *Reader) (byte, []time.Duration) {
+	cla, p2 := byte(0x00), byte(0x04)
+	var latencies []time.Duration
+	for t.RoundTrips < selfTestRoundTrips {
+		resp, elapsed, err := timedTransmit(r, []byte{cla, INS_SELECT, 0x00, p2, 0x02, 0x3F, 0x00})
+		t.RoundTrips++
+		if err != nil {
+			t.RoundTripErrors++
+			t.addError(fmt.Sprintf("SELECT MF: %v", err))
+			continue
+		}
+		latencies = append(latencies, elapsed)
+
+		sw1, sw2 := resp[len(resp)-2], resp[len(resp)-1]
+		switch {
+		case sw1 == 0x6E && cla == 0x00 && t.RoundTrips == 1:
+			cla, p2 = 0xA0, 0x00 // GSM-only card
+		case (sw1 == 0x61 || sw1 == 0x9F) && t.RoundTrips < selfTestRoundTrips:
+			resp, elapsed, err = timedTransmit(r, []byte{cla, INS_GET_RESPONSE, 0x00, 0x00, sw2})
+			t.RoundTrips++
+			if err != nil {
+				t.RoundTripErrors++
+				t.addError(fmt.Sprintf("GET RESPONSE: %v", err))
+				continue
+			}
+			latencies = append(latencies, elapsed)
+			if sw := swOf(resp); sw != SW_OK {
+				t.RoundTripErrors++
+				t.addError(fmt.Sprintf("GET RESPONSE: SW %04X", sw))
+			}
+		case sw1 != 0x90 && sw1 != 0x61 && sw1 != 0x9F:
+			t.RoundTripErrors++
+			t.addError(fmt.Sprintf("SELECT MF: SW %02X%02X", sw1, sw2))
+		}
+	}
+
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		t.LatencyMinMs = durationMs(latencies[0])
+		t.LatencyMedianMs = durationMs(latencies[len(latencies)/2])
+		t.LatencyMaxMs = durationMs(latencies[len(latencies)-1])
+	}
+	return cla, latencies
+}
+
+// stressRead reads EF_ICCID repeatedly and counts errors and changing data
+func (t *SelfTestReport) stressRead(r *Reader, cla byte) {
+	p2 := byte(0x0C)
+	if cla == 0xA0 {
+		p2 = 0x00
+	}
+	for _, fid := range [][]byte{{0x3F, 0x00}, {0x2F, 0xE2}} {
+		resp, _, err := timedTransmit(r, append([]byte{cla, INS_SELECT, 0x00, p2, 0x02}, fid...))
+		if err != nil {
+			t.StressSkipped = fmt.Sprintf("EF_ICCID not selectable: %v", err)
+			return
+		}
+		if sw1 := resp[len(resp)-2]; sw1 != 0x90 && sw1 != 0x61 && sw1 != 0x9F {
+			t.StressSkipped = fmt.Sprintf("EF_ICCID not selectable (SW %04X)", swOf(resp))
+			return
+		}
+	}
+
+	var first []byte
+	for i := 0; i < selfTestStressReads; i++ {
+		resp, _, err := timedTransmit(r, []byte{cla, INS_READ_BINARY, 0x00, 0x00, 0x0A})
+		t.StressReads++
+		if err != nil {
+			t.StressErrors++
+			t.addError(fmt.Sprintf("READ BINARY %d: %v", i+1, err))
+			continue
+		}
+		if sw := swOf(resp); sw != SW_OK {
+			t.StressErrors++
+			t.addError(fmt.Sprintf("READ BINARY %d: SW %04X", i+1, sw))
+			continue
+		}
+		data := resp[:len(resp)-2]
+		if first == nil {
+			first = data
+		} else if string(data) != string(first) {
+			t.StressMismatches++
+		}
+	}
+}
+
+// evaluate sets the verdict and the suspected causes from the collected metrics
+func (t *SelfTestReport) evaluate(latencies []time.Duration) {
+	t.Causes = nil
+	if t.ConnectFailures > 0 {
+		t.Causes = append(t.Causes, fmt.Sprintf(
+			"connect failures (%d of %d): reader drops off the USB bus or driver problem; check the cable and USB power",
+			t.ConnectFailures, t.ConnectCycles))
+	}
+	if t.ATRMismatches > 0 {
+		t.Causes = append(t.Causes, fmt.Sprintf(
+			"ATR changed between connects (%d of %d): poor card contact; reseat the card and clean the contacts",
+			t.ATRMismatches, t.ConnectCycles))
+	}
+	if errs := t.RoundTripErrors + t.StressErrors; errs > 0 {
+		t.Causes = append(t.Causes, fmt.Sprintf(
+			"sporadic transmit errors (%d of %d exchanges): EMI or marginal USB power; use a short cable, avoid unpowered hubs and keep away from chargers",
+			errs, t.RoundTrips+t.StressReads))
+	}
+	if t.StressMismatches > 0 {
+		t.Causes = append(t.Causes, fmt.Sprintf(
+			"READ BINARY returned different data %d times: corruption on the card link; suspect EMI or a faulty reader",
+			t.StressMismatches))
+	}
+	if len(latencies) > 0 && t.LatencyMaxMs > 50 && t.LatencyMaxMs > 10*t.LatencyMedianMs {
+		t.Causes = append(t.Causes, fmt.Sprintf(
+			"latency spikes (max %.1f ms, median %.1f ms): USB bus contention or reader retransmissions",
+			t.LatencyMaxMs, t.LatencyMedianMs))
+	}
+
+	t.Verdict = SelfTestHealthy
+	if len(t.Causes) > 0 {
+		t.Verdict = SelfTestUnstable
+	}
+}
+
+func (t *SelfTestReport) addError(msg string) {
+	if len(t.Errors) < selfTestMaxErrors {
+		t.Errors = append(t.Errors, msg)
+	}
+}
+
+func (t *SelfTestReport) addATRVariant(atr string) {
+	for _, v := range t.ATRVariants {
+		if v == atr {
+			return
+		}
+	}
+	t.ATRVariants = append(t.ATRVariants, atr)
+}
+
+// timedTransmit sends apdu and measures the round trip; responses without a status word are errors
+func timedTransmit(r *Reader, apdu []byte) ([]byte, time.Duration, error) {
+	start := time.Now()
+	resp, err := r.Transmit(apdu)
+	elapsed := time.Since(start)
+	if err == nil && len(resp) < 2 {
+		err = fmt.Errorf("short response %X", resp)
+	}
+	return resp, elapsed, err
+}
+
+func swOf(resp []byte) uint16 {
+	return uint16(resp[len(resp)-2])<<8 | uint16(resp[len(resp)-1])
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,114 @@
+package card
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============ READER SELF-TEST TESTS ============
+
+// flakyTransport fails every failEvery-th transmit (0 = never)
+type flakyTransport struct {
+	*MockCard
+	failEvery, count int
+}
+
+func (f *flakyTransport) Transmit(apdu []byte) ([]byte, error) {
+	f.count++
+	if f.failEvery > 0 && f.count%f.failEvery == 0 {
+		return nil, errors.New("SCARD_E_COMM_DATA_LOST")
+	}
+	return f.MockCard.Transmit(apdu)
+}
+
+func newSelfTestCard() *MockCard {
+	m := NewMockCard([]byte{0x3B, 0x9F, 0x96})
+	m.MF().AddEF(0x2FE2, []byte{0x98, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10, 0x32, 0x54, 0xF6})
+	return m
+}
+
+func TestSelfTest(t *testing.T) {
+	tests := []struct {
+		name        string
+		failEvery   int
+		atrs        []string // ATR per connect (cycled), empty = stable
+		failConnect int      // connect number that fails (0 = none)
+		verdict     string
+		cause       string
+	}{
+		{"Healthy reader", 0, nil, 0, SelfTestHealthy, ""},
+		{"Sporadic transmit errors", 37, nil, 0, SelfTestUnstable, "sporadic transmit errors"},
+		{"Unstable ATR", 0, []string{"3B9F96", "3B9F96", "3B1F96"}, 0, SelfTestUnstable, "ATR changed"},
+		{"Connect failure", 0, nil, 4, SelfTestUnstable, "connect failures"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newSelfTestCard()
+			tr := &flakyTransport{MockCard: m, failEvery: tc.failEvery}
+			connects := 0
+			report, err := runSelfTest(func() (*Reader, error) {
+				connects++
+				if connects == tc.failConnect {
+					return nil, errors.New("SCARD_E_NO_SMARTCARD")
+				}
+				atr := m.ATR
+				if len(tc.atrs) > 0 {
+					atr = mustHex(t, tc.atrs[(connects-1)%len(tc.atrs)])
+				}
+				return NewReaderWithTransport("Mock", atr, tr), nil
+			})
+			if err != nil {
+				t.Fatalf("runSelfTest() error = %v", err)
+			}
+			if report.Verdict != tc.verdict {
+				t.Errorf("Verdict = %s, want %s (causes %v)", report.Verdict, tc.verdict, report.Causes)
+			}
+			if tc.cause != "" && !strings.Contains(strings.Join(report.Causes, "\n"), tc.cause) {
+				t.Errorf("Causes = %v, want %q", report.Causes, tc.cause)
+			}
+			if report.ConnectCycles != selfTestCycles || report.RoundTrips != selfTestRoundTrips {
+				t.Errorf("cycles %d, round trips %d", report.ConnectCycles, report.RoundTrips)
+			}
+			if report.StressSkipped != "" || report.StressReads != selfTestStressReads {
+				t.Errorf("stress reads %d, skipped %q", report.StressReads, report.StressSkipped)
+			}
+		})
+	}
+}
+
+func TestSelfTest_ConnectError(t *testing.T) {
+	_, err := runSelfTest(func() (*Reader, error) { return nil, errors.New("no readers") })
+	if err == nil {
+		t.Error("runSelfTest() succeeded without a reader")
+	}
+}
+
+func TestSelfTestEvaluate(t *testing.T) {
+	ms := []time.Duration{time.Millisecond}
+	tests := []struct {
+		name    string
+		report  SelfTestReport
+		verdict string
+		cause   string
+	}{
+		{"Clean", SelfTestReport{LatencyMinMs: 4, LatencyMedianMs: 5, LatencyMaxMs: 9}, SelfTestHealthy, ""},
+		{"Slow but steady", SelfTestReport{LatencyMedianMs: 40, LatencyMaxMs: 60}, SelfTestHealthy, ""},
+		{"Latency spikes", SelfTestReport{LatencyMedianMs: 5, LatencyMaxMs: 250}, SelfTestUnstable, "latency spikes"},
+		{"Corrupted reads", SelfTestReport{StressMismatches: 2}, SelfTestUnstable, "different data"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.report.evaluate(ms)
+			if tc.report.Verdict != tc.verdict {
+				t.Errorf("Verdict = %s, want %s (causes %v)", tc.report.Verdict, tc.verdict, tc.report.Causes)
+			}
+			if tc.cause != "" && (len(tc.report.Causes) != 1 || !strings.Contains(tc.report.Causes[0], tc.cause)) {
+				t.Errorf("Causes = %v, want %q", tc.report.Causes, tc.cause)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package card
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ebfe/scard"
+)
+
+// Long interactive sessions (serve, library users keeping a reader between bursts). Some
+// readers power the card down after an idle period, and the next command fails with
+// SCARD_W_UNPOWERED_CARD or SCARD_W_RESET_CARD. A Session sends a STATUS when the reader
+// has been idle for the keep-alive interval, re-initializes a card that was powered down
+// anyway on the next command, and can release the reader between bursts.
+
+// ErrSessionClosed is returned by the methods of a closed Session
+var ErrSessionClosed = errors.New("card session closed")
+
+// keepAliveAPDU is STATUS without response data: it changes nothing on the card. Cards that
+// do not know the class answer 6E00, which keeps them powered as well.
+var keepAliveAPDU = []byte{0x80, INS_STATUS, 0x00, 0x0C, 0x00}
+
+// IsPowerLoss reports whether err means that the reader powered the card down or reset it
+// on its own (SCARD_W_UNPOWERED_CARD, SCARD_W_RESET_CARD). The command did not reach the card.
+func IsPowerLoss(err error) bool {
+	return errors.Is(err, scard.ErrUnpoweredCard) || errors.Is(err, scard.ErrResetCard)
+}
+
+// WithSessionResume re-initializes a card that the reader powered down or reset: a command
+// failing with IsPowerLoss is sent again after a reset that restores the selected application
+// and file and the verified PIN/ADM references, like WithRetry. The command never reached
+// the card, so state-changing commands are sent again too. The reset is done even with
+// ResetNone, since the card has lost its state already. Recovery events have PowerLoss set.
+func WithSessionResume() ConnectOption {
+	return func(r *Reader) {
+		r.resume = true
+	}
+}
+
+// resumeTransmit re-initializes the card after a power loss and sends apdu again
+func (r *Reader) resumeTransmit(apdu []byte, cause error) ([]byte, error) {
+	event := RecoveryEvent{Command: commandName(apdu), APDU: append([]byte(nil), apdu...), Cause: cause,
+		Attempts: 1, Cold: r.resetPolicy == ResetCold, PowerLoss: true}
+	var response []byte
+	var err error
+	if r.channel != 0 {
+		err = fmt.Errorf("logical channel %d does not survive a reset", r.channel)
+	} else if err = r.restoreSession(); err == nil {
+		response, err = r.transmitRaw(apdu)
+	}
+	if err != nil {
+		event.Err = err
+		r.logRecovery(event)
+		return nil, fmt.Errorf("%w (re-initialization failed: %v)", cause, err)
+	}
+	event.Recovered = true
+	r.logRecovery(event)
+	return response, nil
+}
+
+// SessionOptions configures NewSession
+type SessionOptions struct {
+	// KeepAlive sends a STATUS after this long without commands (0 = no keep-alive)
+	KeepAlive time.Duration
+	// Notice receives re-initializations after a power loss and keep-alive failures
+	Notice func(string)
+}
+
+// Session holds a reader over a long interactive session. Commands run through Do, one
+// at a time; the keep-alive STATUS is sent between them.
+type Session struct {
+	mu        sync.Mutex
+	reader    *Reader
+	keepAlive time.Duration
+	notice    func(string)
+	lastUse   time.Time
+	suspended bool
+	closed    bool
+
+	stop chan struct{} // closed by Close to end the keep-alive goroutine
+	done chan struct{} // closed when the keep-alive goroutine has ended
+}
+
+// NewSession takes over reader and enables WithSessionResume on it. Only SELECTs and
+// VERIFYs sent after NewSession are restored after a power loss: verify PIN/ADM through Do.
+func NewSession(reader *Reader, opts SessionOptions) *Session {
+	s := &Session{reader: reader, keepAlive: opts.KeepAlive, notice: opts.Notice, lastUse: time.Now()}
+	reader.resume = true
+	previous := reader.onRecovery
+	reader.onRecovery = func(e RecoveryEvent) {
+		if previous != nil {
+			previous(e)
+		}
+		if e.PowerLoss {
+			s.notify(e.String())
+		}
+	}
+	if s.keepAlive > 0 {
+		s.stop, s.done = make(chan struct{}), make(chan struct{})
+		go s.keepAliveLoop()
+	}
+	return s
+}
+
+// Do runs fn with the reader of the session, after resuming a suspended session
+func (s *Session) Do(fn func(*Reader) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSessionClosed
+	}
+	if s.suspended {
+		if err := s.resume(); err != nil {
+			return err
+		}
+	}
+	defer func() { s.lastUse = time.Now() }()
+	return fn(s.reader)
+}
+
+// Suspend releases the reader to other applications between bursts. The PC/SC context is
+// kept; Resume, or the next Do, connects again and restores the selected file and the
+// verified PIN/ADM.
+func (s *Session) Suspend() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSessionClosed
+	}
+	if s.suspended {
+		return nil
+	}
+	if err := s.reader.release(); err != nil {
+		return fmt.Errorf("suspend: %w", err)
+	}
+	s.suspended = true
+	return nil
+}
+
+// Resume connects a suspended session again. The card is reset (not with ResetNone) since
+// another application may have used it, then the session state is restored.
+func (s *Session) Resume() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSessionClosed
+	}
+	if !s.suspended {
+		return nil
+	}
+	return s.resume()
+}
+
+// Suspended reports whether the reader is released
+func (s *Session) Suspended() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.suspended
+}
+
+// Close stops the keep-alive and closes the reader
+func (s *Session) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+	return s.reader.Close()
+}
+
+// resume connects the reader again and restores the session state (mu held)
+func (s *Session) resume() error {
+	if err := s.reader.reacquire(); err != nil {
+		return fmt.Errorf("resume: %w", err)
+	}
+	restore := s.reader.restoreSession
+	if s.reader.resetPolicy == ResetNone {
+		restore = s.reader.replaySession
+	}
+	if err := restore(); err != nil {
+		return fmt.Errorf("resume: %w", err)
+	}
+	s.suspended = false
+	s.lastUse = time.Now()
+	return nil
+}
+
+// keepAliveLoop sends the keep-alive STATUS until Close
+func (s *Session) keepAliveLoop() {
+	defer close(s.done)
+	timer := time.NewTimer(s.keepAlive)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-timer.C:
+			timer.Reset(s.ping())
+		}
+	}
+}
+
+// ping sends the keep-alive STATUS if the reader has been idle for the keep-alive interval
+// and returns the time until the next check
+func (s *Session) ping() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.suspended {
+		return s.keepAlive
+	}
+	if idle := time.Since(s.lastUse); idle < s.keepAlive {
+		return s.keepAlive - idle
+	}
+	if _, err := s.reader.Transmit(keepAliveAPDU); err != nil {
+		s.notify(fmt.Sprintf("keep-alive STATUS failed: %v", err))
+	}
+	s.lastUse = time.Now()
+	return s.keepAlive
+}
+
+func (s *Session) notify(msg string) {
+	if s.notice != nil {
+		s.notice(msg)
+	}
+}
+
+// release disconnects the PC/SC card and keeps the context (see Session.Suspend)
+func (r *Reader) release() error {
+	if r.transport != nil || r.card == nil {
+		return nil
+	}
+	err := r.card.Disconnect(scard.LeaveCard)
+	r.card = nil
+	return err
+}
+
+// reacquire connects the card again after release
+func (r *Reader) reacquire() error {
+	if r.transport != nil || r.card != nil {
+		return nil
+	}
+	if r.ctx == nil {
+		return fmt.Errorf("no PC/SC context")
+	}
+	c, err := r.ctx.Connect(r.name, r.shareMode.scardMode(), scard.ProtocolAny)
+	if err != nil {
+		return fmt.Errorf("failed to connect to card in reader '%s': %w", r.name, classifyConnectError(err))
+	}
+	r.card = c
+	if status, err := c.Status(); err == nil {
+		r.atr = status.Atr
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package card
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ebfe/scard"
+)
+
+// ============ SESSION KEEP-ALIVE / RESUME TESTS ============
+
+// newSessionTestCard returns a card whose EF_IMSI in the USIM needs PIN1, and a session
+// with the ADF selected and PIN1 verified
+func newSessionTestCard(t *testing.T, opts SessionOptions) (*Session, *MockCard) {
+	t.Helper()
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.Keys[0x01] = []byte("1234")
+	m.AddADF(retryTestAID).AddEF(0x6F07, []byte{0x08, 0x09, 0x10, 0x10}).ReadKey = 0x01
+	s := NewSession(NewReaderWithTransport("Mock", m.ATR, m), opts)
+	t.Cleanup(func() { s.Close() })
+
+	err := s.Do(func(r *Reader) error {
+		if resp, err := r.Select(retryTestAID); err != nil || !resp.IsOK() {
+			t.Fatalf("Select(ADF) = %v, %v", resp, err)
+		}
+		return r.VerifyPIN1("1234")
+	})
+	if err != nil {
+		t.Fatalf("VerifyPIN1() error = %v", err)
+	}
+	return s, m
+}
+
+// readIMSI selects and reads EF_IMSI through the session
+func readIMSI(s *Session) ([]byte, error) {
+	var data []byte
+	err := s.Do(func(r *Reader) error {
+		if resp, err := r.Select([]byte{0x6F, 0x07}); err != nil || !resp.IsOK() {
+			return errors.Join(err, errors.New("select EF_IMSI failed"))
+		}
+		resp, err := r.ReadBinary(0, 4)
+		if err != nil {
+			return err
+		}
+		if !resp.IsOK() {
+			return resp.Error()
+		}
+		data = resp.Data
+		return nil
+	})
+	return data, err
+}
+
+func TestSession_PowerLossRecovered(t *testing.T) {
+	var notices []string
+	s, m := newSessionTestCard(t, SessionOptions{Notice: func(msg string) { notices = append(notices, msg) }})
+
+	// The reader powers the card down: its state is gone and the next command fails
+	m.Reset(true)
+	m.Resets = nil
+	m.FailTransmit = scard.ErrUnpoweredCard
+
+	data, err := readIMSI(s)
+	if err != nil || !bytes.Equal(data, []byte{0x08, 0x09, 0x10, 0x10}) {
+		t.Fatalf("read after power loss = %X, %v", data, err)
+	}
+	if len(m.Resets) != 1 {
+		t.Errorf("resets = %v, want 1", m.Resets)
+	}
+	if !m.verified[0x01] {
+		t.Errorf("PIN1 not re-verified after the power loss")
+	}
+	log := s.reader.RecoveryLog()
+	if len(log) != 1 || !log[0].PowerLoss || !log[0].Recovered || log[0].Command != "SELECT" {
+		t.Errorf("RecoveryLog() = %+v", log)
+	}
+	if len(notices) != 1 || !strings.Contains(notices[0], "powered down") {
+		t.Errorf("notices = %q", notices)
+	}
+}
+
+func TestSession_PowerLossRecoveredWithResetNone(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(retryTestAID)
+	r := NewReaderWithTransport("Mock", m.ATR, m, WithResetPolicy(ResetNone))
+	s := NewSession(r, SessionOptions{})
+	defer s.Close()
+
+	m.FailTransmit = scard.ErrResetCard
+	err := s.Do(func(r *Reader) error {
+		_, err := r.Select(retryTestAID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Select() after a reset by the reader: %v", err)
+	}
+	if len(m.Resets) != 1 {
+		t.Errorf("resets = %v, want 1 even with ResetNone", m.Resets)
+	}
+}
+
+func TestSession_PowerLossNotResumedWithoutSession(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	m.FailTransmit = scard.ErrUnpoweredCard
+	if _, err := r.Select(retryTestAID); !IsPowerLoss(err) {
+		t.Errorf("Select() error = %v, want the power loss", err)
+	}
+	if len(m.Resets) != 0 {
+		t.Errorf("resets = %v, want none", m.Resets)
+	}
+}
+
+func TestSession_SuspendResume(t *testing.T) {
+	s, m := newSessionTestCard(t, SessionOptions{})
+	if err := s.Suspend(); err != nil || !s.Suspended() {
+		t.Fatalf("Suspend() = %v, suspended %v", err, s.Suspended())
+	}
+	m.Reset(false) // another application used the card meanwhile
+	m.Resets = nil
+
+	// Do resumes the session on its own
+	data, err := readIMSI(s)
+	if err != nil || !bytes.Equal(data, []byte{0x08, 0x09, 0x10, 0x10}) {
+		t.Fatalf("read after Suspend() = %X, %v", data, err)
+	}
+	if s.Suspended() || len(m.Resets) != 1 {
+		t.Errorf("suspended %v, resets %v; want resumed after one reset", s.Suspended(), m.Resets)
+	}
+	if err := s.Resume(); err != nil {
+		t.Errorf("Resume() of an active session: %v", err)
+	}
+
+	s.Close()
+	if err := s.Do(func(*Reader) error { return nil }); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("Do() after Close() = %v, want ErrSessionClosed", err)
+	}
+	if err := s.Suspend(); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("Suspend() after Close() = %v, want ErrSessionClosed", err)
+	}
+}
+
+// keepAliveCounter counts the keep-alive commands; it is read while the keep-alive
+// goroutine transmits
+type keepAliveCounter struct {
+	*MockCard
+	sent atomic.Int32
+}
+
+func (c *keepAliveCounter) Transmit(apdu []byte) ([]byte, error) {
+	if bytes.Equal(apdu, keepAliveAPDU) {
+		c.sent.Add(1)
+	}
+	return c.MockCard.Transmit(apdu)
+}
+
+func TestSession_KeepAlive(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	c := &keepAliveCounter{MockCard: m}
+	notices := make(chan string, 1)
+	s := NewSession(NewReaderWithTransport("Mock", m.ATR, c), SessionOptions{KeepAlive: 5 * time.Millisecond,
+		Notice: func(msg string) {
+			select {
+			case notices <- msg:
+			default:
+			}
+		}})
+	defer s.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for c.sent.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if c.sent.Load() == 0 {
+		t.Fatal("no keep-alive STATUS sent")
+	}
+
+	s.Do(func(*Reader) error {
+		m.FailTransmit = scard.ErrRemovedCard
+		return nil
+	})
+	select {
+	case msg := <-notices:
+		if !strings.Contains(msg, "keep-alive") {
+			t.Errorf("notice = %q, want the keep-alive failure", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("no notice of the keep-alive failure")
+	}
+
+	s.Close()
+	n := c.sent.Load()
+	time.Sleep(20 * time.Millisecond)
+	if c.sent.Load() != n {
+		t.Errorf("keep-alive sent after Close()")
+	}
+}
@@ -0,0 +1,68 @@
+package card
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ebfe/scard"
+)
+
+// ShareMode is the PC/SC access mode of a connection
+type ShareMode int
+
+const (
+	ShareShared    ShareMode = iota // other applications may use the reader between commands
+	ShareExclusive                  // no other application can connect while the reader is open
+)
+
+// String returns the name of the mode
+func (m ShareMode) String() string {
+	if m == ShareExclusive {
+		return "exclusive"
+	}
+	return "shared"
+}
+
+// scardMode returns the PC/SC share mode
+func (m ShareMode) scardMode() scard.ShareMode {
+	if m == ShareExclusive {
+		return scard.ShareExclusive
+	}
+	return scard.ShareShared
+}
+
+// WithShareMode sets the PC/SC access mode (default ShareShared). Sessions that write to
+// the card should be exclusive so that no other application interleaves its commands.
+func WithShareMode(m ShareMode) ConnectOption {
+	return func(r *Reader) {
+		r.shareMode = m
+	}
+}
+
+// ShareMode returns the PC/SC access mode of the reader
+func (r *Reader) ShareMode() ShareMode {
+	return r.shareMode
+}
+
+// Connection error classes, wrapping the PC/SC or USB error (test with errors.Is)
+var (
+	ErrReaderBusy        = errors.New("reader in use by another application")
+	ErrReaderUnavailable = errors.New("reader unavailable")
+	ErrNoPCSCService     = errors.New("PC/SC service not running")
+	ErrNoCard            = errors.New("no card in the reader")
+)
+
+// classifyConnectError wraps PC/SC connection errors with their class
+func classifyConnectError(err error) error {
+	switch {
+	case errors.Is(err, scard.ErrSharingViolation):
+		return fmt.Errorf("%w (sharing violation): %w", ErrReaderBusy, err)
+	case errors.Is(err, scard.ErrReaderUnavailable), errors.Is(err, scard.ErrUnknownReader):
+		return fmt.Errorf("%w: %w", ErrReaderUnavailable, err)
+	case errors.Is(err, scard.ErrNoService), errors.Is(err, scard.ErrServiceStopped):
+		return fmt.Errorf("%w: %w", ErrNoPCSCService, err)
+	case errors.Is(err, scard.ErrNoSmartcard), errors.Is(err, scard.ErrRemovedCard):
+		return fmt.Errorf("%w: %w", ErrNoCard, err)
+	}
+	return err
+}
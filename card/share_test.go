@@ -0,0 +1,87 @@
+package card
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ebfe/scard"
+)
+
+// ============ SHARE MODE TESTS ============
+
+func TestClassifyConnectError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{scard.ErrSharingViolation, ErrReaderBusy},
+		{scard.ErrReaderUnavailable, ErrReaderUnavailable},
+		{scard.ErrUnknownReader, ErrReaderUnavailable},
+		{scard.ErrNoService, ErrNoPCSCService},
+		{scard.ErrNoSmartcard, ErrNoCard},
+		{scard.ErrRemovedCard, ErrNoCard},
+	}
+	for _, tt := range tests {
+		got := classifyConnectError(tt.err)
+		if !errors.Is(got, tt.want) || !errors.Is(got, tt.err) {
+			t.Errorf("classifyConnectError(%v) = %v, want %v wrapping it", tt.err, got, tt.want)
+		}
+	}
+	other := errors.New("other")
+	if got := classifyConnectError(other); got != other {
+		t.Errorf("classifyConnectError(other) = %v, want it unchanged", got)
+	}
+}
+
+func TestWithShareMode(t *testing.T) {
+	m := NewMockCard(nil)
+	if got := NewReaderWithTransport("Mock", nil, m).ShareMode(); got != ShareShared {
+		t.Errorf("default share mode = %s, want shared", got)
+	}
+	if got := NewReaderWithTransport("Mock", nil, m, WithShareMode(ShareExclusive)).ShareMode(); got != ShareExclusive {
+		t.Errorf("share mode = %s, want exclusive", got)
+	}
+}
+
+func TestDeviceHolders(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("device holders are read from /proc")
+	}
+	path := filepath.Join(t.TempDir(), "hidraw0")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cmd := exec.Command("sleep", "10")
+	cmd.ExtraFiles = []*os.File{f}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start sleep: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	// Our own descriptor is not reported, the child's is
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		holders := DeviceHolders(path)
+		if len(holders) == 1 && holders[0].PID == cmd.Process.Pid {
+			if holders[0].Name != "sleep" || holders[0].Path != path {
+				t.Errorf("holder = %+v", holders[0])
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("DeviceHolders() = %+v, want pid %d", holders, cmd.Process.Pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,557 @@
+package card
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ISO 7816-4 secure messaging (clause 10) for cards that protect single EFs with SM.
+// Commands are sent with the SM indication in CLA and their content as data objects:
+//
+//	81 plain value          (MAC-only mode)
+//	85 cryptogram           (odd INS: BER-TLV coded data, no padding indicator)
+//	87 01 || cryptogram     (padding-content indicator 01 = ISO 7816-4 padding)
+//	97 Le                   (expected length)
+//	99 SW1 SW2              (processing status, responses only)
+//	8E cryptographic checksum
+//
+// The checksum is computed over the send sequence counter (SSC, incremented before each
+// command and each response) followed by the padded header and the data objects, as in
+// ICAO 9303 part 11. The AES primitives are the ones of SCP03 (CMAC, ICV = E(K, counter)),
+// 3DES uses the retail MAC of SCP02 and a zero ICV.
+
+// SMAlgorithm is the block cipher of a secure messaging session
+type SMAlgorithm string
+
+const (
+	SMAES128 SMAlgorithm = "aes128" // AES-128 CBC, AES-CMAC truncated to 8 bytes
+	SM3DES   SMAlgorithm = "3des"   // 2-key 3DES CBC, ISO 9797-1 MAC algorithm 3
+)
+
+// ParseSMAlgorithm parses --sm-alg
+func ParseSMAlgorithm(s string) (SMAlgorithm, error) {
+	switch alg := SMAlgorithm(strings.ToLower(s)); alg {
+	case SMAES128, SM3DES:
+		return alg, nil
+	}
+	return "", fmt.Errorf("unknown secure messaging algorithm %q (use aes128 or 3des)", s)
+}
+
+// blockSize returns the cipher block size, which is also the SSC length
+func (a SMAlgorithm) blockSize() int {
+	if a == SM3DES {
+		return 8
+	}
+	return 16
+}
+
+// SMKeys are the static secure messaging keys of a card (from the card specification)
+type SMKeys struct {
+	Alg SMAlgorithm
+	MAC []byte // cryptographic checksum key (required)
+	ENC []byte // data encryption key (nil = MAC-only, data sent as plain DO 81)
+	SSC []byte // initial send sequence counter (nil = zero)
+}
+
+// ErrSMChecksum is returned when the checksum of a protected response does not verify
+var ErrSMChecksum = errors.New("secure messaging: response checksum mismatch")
+
+// SMSession is one side of a secure messaging session. The SSC advances with every
+// command and response; a session that lost synchronisation must be discarded.
+type SMSession struct {
+	alg  SMAlgorithm
+	kmac []byte
+	kenc []byte
+	ssc  []byte
+}
+
+// NewSMSession creates a session from the static keys
+func NewSMSession(keys SMKeys) (*SMSession, error) {
+	alg := keys.Alg
+	if alg == "" {
+		alg = SMAES128
+	}
+	if _, err := ParseSMAlgorithm(string(alg)); err != nil {
+		return nil, err
+	}
+	if len(keys.MAC) == 0 {
+		return nil, fmt.Errorf("secure messaging needs a MAC key")
+	}
+	s := &SMSession{alg: alg, ssc: make([]byte, alg.blockSize())}
+	check := expandAESKey
+	if alg == SM3DES {
+		check = func(k []byte) ([]byte, error) {
+			if len(k) != 16 {
+				return nil, fmt.Errorf("3DES key must be 16 bytes (2-key), got %d", len(k))
+			}
+			return append([]byte{}, k...), nil
+		}
+	}
+	var err error
+	if s.kmac, err = check(keys.MAC); err != nil {
+		return nil, fmt.Errorf("MAC key: %w", err)
+	}
+	if len(keys.ENC) > 0 {
+		if s.kenc, err = check(keys.ENC); err != nil {
+			return nil, fmt.Errorf("ENC key: %w", err)
+		}
+	}
+	if len(keys.SSC) > 0 {
+		if len(keys.SSC) != len(s.ssc) {
+			return nil, fmt.Errorf("SSC must be %d bytes for %s, got %d", len(s.ssc), alg, len(keys.SSC))
+		}
+		copy(s.ssc, keys.SSC)
+	}
+	return s, nil
+}
+
+// Algorithm returns the cipher of the session
+func (s *SMSession) Algorithm() SMAlgorithm {
+	return s.alg
+}
+
+// SSC returns the current send sequence counter
+func (s *SMSession) SSC() []byte {
+	return append([]byte{}, s.ssc...)
+}
+
+// Wrap protects a short command APDU: the data field goes into DO 87 (DO 85 for an odd
+// INS, DO 81 without encryption key), Le into DO 97, followed by the checksum DO 8E
+func (s *SMSession) Wrap(apdu []byte) ([]byte, error) {
+	if len(apdu) < 4 {
+		return nil, fmt.Errorf("secure messaging: APDU too short: %X", apdu)
+	}
+	data, le, hasLe, err := splitShortAPDU(apdu)
+	if err != nil {
+		return nil, err
+	}
+	s.incrementSSC()
+
+	header := []byte{smCLA(apdu[0]), apdu[1], apdu[2], apdu[3]}
+	var dos []byte
+	if len(data) > 0 {
+		dos, err = s.dataDO(apdu[1], data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hasLe {
+		dos = append(dos, 0x97, 0x01, le)
+	}
+	mac, err := s.checksum(append(iso7816Pad(header, s.alg.blockSize()), dos...))
+	if err != nil {
+		return nil, err
+	}
+	dos = append(dos, 0x8E, byte(len(mac)))
+	dos = append(dos, mac...)
+	if len(dos) > 255 {
+		return nil, fmt.Errorf("secure messaging: protected command too long (%d bytes)", len(dos))
+	}
+	out := append(header, byte(len(dos)))
+	out = append(out, dos...)
+	return append(out, 0x00), nil
+}
+
+// Unwrap verifies a protected response (data and SW) and returns the plain data followed
+// by the status word of DO 99. A response without data objects (the card refused the
+// command before SM processing, e.g. 6982 or 6988) is returned unchanged.
+func (s *SMSession) Unwrap(resp []byte) ([]byte, error) {
+	if len(resp) < 2 {
+		return nil, fmt.Errorf("secure messaging: response too short: %d bytes", len(resp))
+	}
+	body, sw := resp[:len(resp)-2], resp[len(resp)-2:]
+	s.incrementSSC()
+	if len(body) == 0 {
+		return append([]byte{}, resp...), nil
+	}
+	dos, err := parseSMObjects(body)
+	if err != nil {
+		return nil, err
+	}
+	mac, ok := dos.values[0x8E]
+	if !ok {
+		return nil, fmt.Errorf("secure messaging: response without checksum (DO 8E)")
+	}
+	want, err := s.checksum(body[:dos.macOffset])
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(mac, want) {
+		return nil, ErrSMChecksum
+	}
+	if status, ok := dos.values[0x99]; ok {
+		if len(status) != 2 {
+			return nil, fmt.Errorf("secure messaging: invalid processing status DO 99: %X", status)
+		}
+		sw = status
+	}
+	plain, err := s.plainData(dos)
+	if err != nil {
+		return nil, err
+	}
+	return append(plain, sw...), nil
+}
+
+// unwrapCommand is the card side of Wrap: it verifies a protected command and returns
+// the plain APDU (used by MockCard)
+func (s *SMSession) unwrapCommand(apdu []byte) ([]byte, error) {
+	s.incrementSSC()
+	if len(apdu) < 6 || int(apdu[4]) > len(apdu)-5 {
+		return nil, fmt.Errorf("secure messaging: malformed command %X", apdu)
+	}
+	body := apdu[5 : 5+int(apdu[4])]
+	dos, err := parseSMObjects(body)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte{}, apdu[:4]...)
+	want, err := s.checksum(append(iso7816Pad(header, s.alg.blockSize()), body[:dos.macOffset]...))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(dos.values[0x8E], want) {
+		return nil, ErrSMChecksum
+	}
+	data, err := s.plainData(dos)
+	if err != nil {
+		return nil, err
+	}
+	plain := []byte{plainCLA(apdu[0]), apdu[1], apdu[2], apdu[3]}
+	if len(data) > 0 {
+		plain = append(plain, byte(len(data)))
+		plain = append(plain, data...)
+	}
+	if le, ok := dos.values[0x97]; ok && len(le) == 1 {
+		plain = append(plain, le[0])
+	}
+	return plain, nil
+}
+
+// wrapResponse is the card side of Unwrap: data in DO 87, the status in DO 99 and the
+// checksum in DO 8E (used by MockCard)
+func (s *SMSession) wrapResponse(resp []byte) ([]byte, error) {
+	s.incrementSSC()
+	data, sw := resp[:len(resp)-2], resp[len(resp)-2:]
+	var dos []byte
+	if len(data) > 0 {
+		var err error
+		if dos, err = s.dataDO(0x00, data); err != nil {
+			return nil, err
+		}
+	}
+	dos = append(dos, 0x99, 0x02, sw[0], sw[1])
+	mac, err := s.checksum(dos)
+	if err != nil {
+		return nil, err
+	}
+	dos = append(dos, 0x8E, byte(len(mac)))
+	dos = append(dos, mac...)
+	return append(dos, 0x90, 0x00), nil
+}
+
+// dataDO encodes a data field as DO 87 / 85 (encrypted) or DO 81 (plain)
+func (s *SMSession) dataDO(ins byte, data []byte) ([]byte, error) {
+	if s.kenc == nil {
+		return smTLV(0x81, data), nil
+	}
+	cryptogram, err := s.encrypt(iso7816Pad(data, s.alg.blockSize()))
+	if err != nil {
+		return nil, err
+	}
+	if ins&0x01 != 0 {
+		return smTLV(0x85, cryptogram), nil
+	}
+	return smTLV(0x87, append([]byte{0x01}, cryptogram...)), nil
+}
+
+// plainData returns the plain content of DO 81, 85 or 87
+func (s *SMSession) plainData(dos smObjects) ([]byte, error) {
+	if plain, ok := dos.values[0x81]; ok {
+		return append([]byte{}, plain...), nil
+	}
+	cryptogram, ok := dos.values[0x85]
+	if v, has87 := dos.values[0x87]; has87 {
+		if len(v) < 1 || v[0] != 0x01 {
+			return nil, fmt.Errorf("secure messaging: unsupported padding-content indicator in DO 87: %X", v)
+		}
+		cryptogram, ok = v[1:], true
+	}
+	if !ok {
+		return nil, nil
+	}
+	if s.kenc == nil {
+		return nil, fmt.Errorf("secure messaging: encrypted data but no ENC key")
+	}
+	padded, err := s.decrypt(cryptogram)
+	if err != nil {
+		return nil, err
+	}
+	return iso7816Unpad(padded)
+}
+
+// checksum returns the 8-byte cryptographic checksum of SSC || msg
+func (s *SMSession) checksum(msg []byte) ([]byte, error) {
+	input := append(append([]byte{}, s.ssc...), msg...)
+	if s.alg == SM3DES {
+		return retailMAC(s.kmac, make([]byte, 8), input)
+	}
+	mac, err := aesCMAC(s.kmac, pad80Block16(input))
+	if err != nil {
+		return nil, err
+	}
+	return mac[:8], nil
+}
+
+// icv returns the CBC initial vector: E(K_ENC, SSC) for AES, zero for 3DES
+func (s *SMSession) icv() ([]byte, error) {
+	if s.alg == SM3DES {
+		return make([]byte, 8), nil
+	}
+	return aesECBEncryptBlock(s.kenc, s.ssc)
+}
+
+func (s *SMSession) encrypt(padded []byte) ([]byte, error) {
+	iv, err := s.icv()
+	if err != nil {
+		return nil, err
+	}
+	if s.alg == SM3DES {
+		key, err := ExpandTo3DESKey(s.kenc)
+		if err != nil {
+			return nil, err
+		}
+		return tripleDESCBCEncrypt(key, iv, padded)
+	}
+	block, err := aes.NewCipher(s.kenc)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+	return out, nil
+}
+
+func (s *SMSession) decrypt(cryptogram []byte) ([]byte, error) {
+	if len(cryptogram) == 0 || len(cryptogram)%s.alg.blockSize() != 0 {
+		return nil, fmt.Errorf("secure messaging: cryptogram length %d is not a multiple of the block size", len(cryptogram))
+	}
+	iv, err := s.icv()
+	if err != nil {
+		return nil, err
+	}
+	var block cipher.Block
+	if s.alg == SM3DES {
+		key, err := ExpandTo3DESKey(s.kenc)
+		if err != nil {
+			return nil, err
+		}
+		block, err = des.NewTripleDESCipher(key)
+		if err != nil {
+			return nil, err
+		}
+	} else if block, err = aes.NewCipher(s.kenc); err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(cryptogram))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, cryptogram)
+	return out, nil
+}
+
+// incrementSSC adds one to the send sequence counter (big-endian)
+func (s *SMSession) incrementSSC() {
+	for i := len(s.ssc) - 1; i >= 0; i-- {
+		s.ssc[i]++
+		if s.ssc[i] != 0 {
+			return
+		}
+	}
+}
+
+// smObjects holds the data objects of a protected message by tag; the checksum covers
+// the bytes before macOffset (where DO 8E starts)
+type smObjects struct {
+	values    map[byte][]byte
+	macOffset int
+}
+
+// parseSMObjects parses the data objects of a protected command or response. Tags are
+// one byte; lengths use the BER short form or 81/82.
+func parseSMObjects(body []byte) (smObjects, error) {
+	dos := smObjects{values: map[byte][]byte{}, macOffset: len(body)}
+	for i := 0; i < len(body); {
+		start := i
+		tag := body[i]
+		i++
+		if i >= len(body) {
+			return dos, fmt.Errorf("secure messaging: truncated DO %02X", tag)
+		}
+		length := int(body[i])
+		i++
+		switch length {
+		case 0x81:
+			if i >= len(body) {
+				return dos, fmt.Errorf("secure messaging: truncated length of DO %02X", tag)
+			}
+			length = int(body[i])
+			i++
+		case 0x82:
+			if i+1 >= len(body) {
+				return dos, fmt.Errorf("secure messaging: truncated length of DO %02X", tag)
+			}
+			length = int(body[i])<<8 | int(body[i+1])
+			i += 2
+		}
+		if i+length > len(body) {
+			return dos, fmt.Errorf("secure messaging: DO %02X longer than the message", tag)
+		}
+		dos.values[tag] = body[i : i+length]
+		if tag == 0x8E {
+			dos.macOffset = start
+		}
+		i += length
+	}
+	return dos, nil
+}
+
+// smTLV encodes one data object (BER length up to 65535 bytes)
+func smTLV(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n < 0x100:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, value...)
+}
+
+// splitShortAPDU returns the data field and Le of a short APDU (cases 1-4)
+func splitShortAPDU(apdu []byte) (data []byte, le byte, hasLe bool, err error) {
+	switch {
+	case len(apdu) == 4:
+		return nil, 0, false, nil
+	case len(apdu) == 5:
+		return nil, apdu[4], true, nil
+	case apdu[4] == 0:
+		return nil, 0, false, fmt.Errorf("secure messaging: extended APDUs are not supported")
+	case len(apdu) == 5+int(apdu[4]):
+		return apdu[5:], 0, false, nil
+	case len(apdu) == 6+int(apdu[4]):
+		return apdu[5 : len(apdu)-1], apdu[len(apdu)-1], true, nil
+	}
+	return nil, 0, false, fmt.Errorf("secure messaging: malformed APDU %X", apdu)
+}
+
+// smCLA sets the SM indication of a class byte: b4-b3 = 11 (header authenticated) in the
+// first interindustry coding, b6 in the further one
+func smCLA(cla byte) byte {
+	if cla&0x40 == 0 {
+		return cla | 0x0C
+	}
+	return cla | 0x20
+}
+
+// plainCLA clears the SM indication set by smCLA
+func plainCLA(cla byte) byte {
+	if cla&0x40 == 0 {
+		return cla &^ 0x0C
+	}
+	return cla &^ 0x20
+}
+
+// isSMClass reports whether a class byte carries the SM indication
+func isSMClass(cla byte) bool {
+	if cla&0x80 != 0 {
+		return false
+	}
+	if cla&0x40 == 0 {
+		return cla&0x0C != 0
+	}
+	return cla&0x20 != 0
+}
+
+// iso7816Unpad removes the 80 00.. padding
+func iso7816Unpad(in []byte) ([]byte, error) {
+	i := bytes.LastIndexByte(in, 0x80)
+	if i < 0 || len(bytes.Trim(in[i+1:], "\x00")) != 0 {
+		return nil, fmt.Errorf("secure messaging: invalid padding in decrypted data")
+	}
+	return in[:i], nil
+}
+
+// smReadChunk is the READ BINARY length under SM: the response (DO 87 with padding, DO 99
+// and DO 8E) must fit in 256 bytes
+const smReadChunk = 0xDF
+
+// SetSecureMessaging installs the session used by SendSecure (nil removes it)
+func (r *Reader) SetSecureMessaging(s *SMSession) {
+	r.sm = s
+}
+
+// SecureMessaging returns the secure messaging session, or nil
+func (r *Reader) SecureMessaging() *SMSession {
+	return r.sm
+}
+
+// SendSecure sends apdu protected with the secure messaging session and returns the
+// verified, decrypted response. The status word is the one of DO 99.
+func (r *Reader) SendSecure(apdu []byte) (*APDUResponse, error) {
+	if r.sm == nil {
+		return nil, fmt.Errorf("no secure messaging session")
+	}
+	cmd := append([]byte{}, apdu...)
+	if len(cmd) > 0 {
+		// The channel is part of the authenticated header
+		cmd[0] = ChannelCLA(cmd[0], r.channel)
+	}
+	wrapped, err := r.sm.Wrap(cmd)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.SendAPDU(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := r.sm.Unwrap(append(append([]byte{}, resp.Data...), resp.SW1, resp.SW2))
+	if err != nil {
+		return nil, err
+	}
+	n := len(plain) - 2
+	out := &APDUResponse{Data: plain[:n], SW1: plain[n], SW2: plain[n+1], cla: apdu[0], ins: apdu[1]}
+	r.lastSW = out.SW()
+	return out, nil
+}
+
+// ReadAllBinarySecure reads the selected transparent EF with secure messaging
+func (r *Reader) ReadAllBinarySecure(fileSize int) ([]byte, error) {
+	var data []byte
+	for len(data) < fileSize {
+		n := fileSize - len(data)
+		if n > smReadChunk {
+			n = smReadChunk
+		}
+		offset := len(data)
+		resp, err := r.SendSecure([]byte{0x00, INS_READ_BINARY, byte(offset >> 8), byte(offset), byte(n)})
+		if err != nil {
+			return data, err
+		}
+		if !resp.IsOK() {
+			if len(data) == 0 {
+				return nil, fmt.Errorf("READ BINARY with secure messaging failed: %s (SW=%04X)", resp.SWString(), resp.SW())
+			}
+			break
+		}
+		if len(resp.Data) == 0 {
+			break
+		}
+		data = append(data, resp.Data...)
+	}
+	return data, nil
+}
@@ -0,0 +1,174 @@
+package card
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// ============ SECURE MESSAGING TESTS ============
+
+// ICAO 9303 part 11, appendix D.4: SELECT EF.COM and READ BINARY with 3DES session keys
+func TestSMSession_ICAO3DES(t *testing.T) {
+	s, err := NewSMSession(SMKeys{
+		Alg: SM3DES,
+		ENC: mustHex(t, "979EC13B1CBFE9DCD01AB0FED307EAE5"),
+		MAC: mustHex(t, "F1CB1F1FB5ADF208806B89DC579DC1F8"),
+		SSC: mustHex(t, "887022120C06C226"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Case 3: data in DO 87
+	got, err := s.Wrap(mustHex(t, "00A4020C02011E"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustHex(t, "0CA4020C158709016375432908C044F68E08BF8B92D635FF24F800"); !bytes.Equal(got, want) {
+		t.Errorf("Wrap(SELECT) = %X, want %X", got, want)
+	}
+	plain, err := s.Unwrap(mustHex(t, "990290008E08FA855A5D4C50A8ED9000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain, []byte{0x90, 0x00}) {
+		t.Errorf("Unwrap(SELECT) = %X, want 9000", plain)
+	}
+
+	// Case 2: Le in DO 97, encrypted response data in DO 87
+	got, err = s.Wrap(mustHex(t, "00B0000004"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustHex(t, "0CB000000D9701048E08ED6705417E96BA5500"); !bytes.Equal(got, want) {
+		t.Errorf("Wrap(READ BINARY) = %X, want %X", got, want)
+	}
+	plain, err = s.Unwrap(mustHex(t, "8709019FF0EC34F9922651990290008E08AD55CC17140B2DED9000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustHex(t, "60145F019000"); !bytes.Equal(plain, want) {
+		t.Errorf("Unwrap(READ BINARY) = %X, want %X", plain, want)
+	}
+	if want := mustHex(t, "887022120C06C22A"); !bytes.Equal(s.SSC(), want) {
+		t.Errorf("SSC = %X, want %X", s.SSC(), want)
+	}
+}
+
+// AES-128 vectors computed independently with OpenSSL (AES-ECB/CBC, CMAC)
+func TestSMSession_AES128(t *testing.T) {
+	s, err := NewSMSession(SMKeys{
+		Alg: SMAES128,
+		MAC: mustHex(t, "000102030405060708090A0B0C0D0E0F"),
+		ENC: mustHex(t, "101112131415161718191A1B1C1D1E1F"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Case 2: DO 97 and DO 8E only
+	got, err := s.Wrap(mustHex(t, "00B0000008"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustHex(t, "0CB000000D9701088E084C758E7F62D3C41100"); !bytes.Equal(got, want) {
+		t.Errorf("Wrap(READ BINARY) = %X, want %X", got, want)
+	}
+	plain, err := s.Unwrap(mustHex(t, "8711019001200B3DE453B45A5111806C372434990290008E08D4B7A7DBFE18369F9000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustHex(t, "01020304050607089000"); !bytes.Equal(plain, want) {
+		t.Errorf("Unwrap = %X, want %X", plain, want)
+	}
+
+	// Odd INS: BER-TLV data in DO 85 without padding indicator
+	got, err = s.Wrap(mustHex(t, "00B10000045402001000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustHex(t, "0CB100001F8510081956B9B8ACD5D9DD8CA987E0ED7CB19701008E08E3C8E12B8774EA4B00"); !bytes.Equal(got, want) {
+		t.Errorf("Wrap(READ BINARY odd) = %X, want %X", got, want)
+	}
+}
+
+func TestSMSession_Errors(t *testing.T) {
+	keys := SMKeys{MAC: bytes.Repeat([]byte{0x11}, 16), ENC: bytes.Repeat([]byte{0x22}, 16)}
+	host, _ := NewSMSession(keys)
+	card, _ := NewSMSession(keys)
+
+	// Round trip through the card side
+	cmd, err := host.Wrap([]byte{0x00, 0xB0, 0x00, 0x00, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainCmd, err := card.unwrapCommand(cmd)
+	if err != nil || !bytes.Equal(plainCmd, []byte{0x00, 0xB0, 0x00, 0x00, 0x00}) {
+		t.Fatalf("unwrapCommand = %X, %v", plainCmd, err)
+	}
+	resp, _ := card.wrapResponse([]byte{0xAA, 0xBB, 0x90, 0x00})
+	tampered := append([]byte{}, resp...)
+	tampered[3] ^= 0x01
+	if _, err := host.Unwrap(tampered); !errors.Is(err, ErrSMChecksum) {
+		t.Errorf("Unwrap(tampered) err = %v, want ErrSMChecksum", err)
+	}
+
+	// An unprotected refusal is passed through
+	plain, err := host.Unwrap([]byte{0x69, 0x82})
+	if err != nil || !bytes.Equal(plain, []byte{0x69, 0x82}) {
+		t.Errorf("Unwrap(6982) = %X, %v", plain, err)
+	}
+
+	if _, err := NewSMSession(SMKeys{Alg: "des", MAC: keys.MAC}); err == nil {
+		t.Error("unknown algorithm accepted")
+	}
+	if _, err := NewSMSession(SMKeys{MAC: []byte{1, 2, 3}}); err == nil {
+		t.Error("short MAC key accepted")
+	}
+	if _, err := NewSMSession(SMKeys{Alg: SM3DES, MAC: keys.MAC, SSC: make([]byte, 16)}); err == nil {
+		t.Error("16-byte SSC accepted for 3DES")
+	}
+}
+
+func TestReader_ReadAllBinarySecure(t *testing.T) {
+	keys := SMKeys{Alg: SMAES128, MAC: bytes.Repeat([]byte{0x11}, 16), ENC: bytes.Repeat([]byte{0x22}, 16)}
+	m := NewMockCard(nil)
+	content := make([]byte, 300)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	m.MF().AddEF(0x6F02, content).ReadSM = true
+	m.SM, _ = NewSMSession(keys)
+	r := NewReaderWithTransport("Mock", nil, m)
+
+	if resp, err := r.Select([]byte{0x6F, 0x02}); err != nil || !resp.IsOK() {
+		t.Fatalf("SELECT: %v", err)
+	}
+	if _, err := r.ReadAllBinarySecure(len(content)); err == nil {
+		t.Error("ReadAllBinarySecure without a session succeeded")
+	}
+	if resp, _ := r.ReadBinary(0, 16); resp.SW() != SW_SECURITY_NOT_SATISFIED {
+		t.Errorf("plain READ BINARY SW = %04X, want 6982", resp.SW())
+	}
+
+	s, _ := NewSMSession(keys)
+	r.SetSecureMessaging(s)
+	data, err := r.ReadAllBinarySecure(len(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("ReadAllBinarySecure = %X, want %X", data, content)
+	}
+	if r.LastSW() != SW_OK {
+		t.Errorf("LastSW = %04X, want the SW of DO 99", r.LastSW())
+	}
+
+	// A session out of step with the card is refused with 6988
+	r.SetSecureMessaging(&SMSession{alg: SMAES128, kmac: s.kmac, kenc: s.kenc, ssc: make([]byte, 16)})
+	if _, err := r.ReadAllBinarySecure(16); err == nil || !strings.Contains(err.Error(), "6988") {
+		t.Errorf("desynchronised session err = %v, want 6988", err)
+	}
+}
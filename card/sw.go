@@ -0,0 +1,320 @@
+package card
+
+import (
+	"fmt"
+	"sync"
+)
+
+// CommandContext tells DecodeSW what kind of command produced a status word.
+// The same SW means different things after a file update, a PIN verification,
+// an AUTHENTICATE or a GlobalPlatform command.
+type CommandContext int
+
+const (
+	ContextAny      CommandContext = iota // Unknown / any command
+	ContextFile                           // File system commands (SELECT, READ, UPDATE, ...)
+	ContextSecurity                       // VERIFY, CHANGE/DISABLE/ENABLE/UNBLOCK PIN
+	ContextAuth                           // AUTHENTICATE / RUN GSM ALGORITHM
+	ContextGP                             // GlobalPlatform card management
+)
+
+// String returns the context name
+func (c CommandContext) String() string {
+	switch c {
+	case ContextFile:
+		return "file"
+	case ContextSecurity:
+		return "security"
+	case ContextAuth:
+		return "authenticate"
+	case ContextGP:
+		return "globalplatform"
+	default:
+		return "any"
+	}
+}
+
+// ContextFromCommand derives the command context from CLA and INS
+func ContextFromCommand(cla, ins byte) CommandContext {
+	if cla&0x80 != 0 && cla != 0xA0 {
+		switch ins {
+		case 0x50, 0x82, 0xD8, 0xE2, 0xE4, 0xE6, 0xE8, 0xF0, 0xF2, 0xCA:
+			return ContextGP
+		}
+	}
+	switch ins {
+	case INS_VERIFY, INS_CHANGE_REFERENCE_DATA, 0x26, 0x28, 0x2C:
+		return ContextSecurity
+	case INS_AUTHENTICATE, 0x89:
+		return ContextAuth
+	case INS_SELECT, INS_READ_BINARY, INS_READ_RECORD, INS_UPDATE_BINARY, INS_UPDATE_RECORD,
+		0xA2, 0x32, 0x04, 0x44, 0xE0, 0xE4, INS_STATUS:
+		return ContextFile
+	}
+	return ContextAny
+}
+
+// SWSeverity classifies a status word
+type SWSeverity int
+
+const (
+	SeverityOK      SWSeverity = iota // Normal processing
+	SeverityInfo                      // Normal processing with extra information (61xx, 9Fxx, 91xx)
+	SeverityWarning                   // Warning processing (62xx, 63xx)
+	SeverityError                     // Execution or checking error
+)
+
+// String returns the severity name
+func (s SWSeverity) String() string {
+	switch s {
+	case SeverityOK:
+		return "ok"
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// SWInfo is the interpretation of a status word
+type SWInfo struct {
+	SW       uint16
+	Severity SWSeverity
+	Text     string // Short meaning
+	Hint     string // What to do about it (may be empty)
+}
+
+// String returns the text followed by the hint, if any
+func (i SWInfo) String() string {
+	if i.Hint == "" {
+		return i.Text
+	}
+	return i.Text + " - " + i.Hint
+}
+
+// SWEntry is one row of a status word table. An entry matches when sw&Mask == SW&Mask,
+// INS is empty or contains the command INS, and Context is ContextAny or equal to the
+// command context. Tables are searched in order, so specific entries come first.
+type SWEntry struct {
+	SW       uint16
+	Mask     uint16 // 0 means FFFF (exact match)
+	INS      []byte
+	Context  CommandContext
+	Severity SWSeverity
+	Text     string
+	Hint     string
+}
+
+func (e *SWEntry) matches(sw uint16, ins byte, ctx CommandContext) bool {
+	mask := e.Mask
+	if mask == 0 {
+		mask = 0xFFFF
+	}
+	if sw&mask != e.SW&mask {
+		return false
+	}
+	if e.Context != ContextAny && e.Context != ctx {
+		return false
+	}
+	if len(e.INS) == 0 {
+		return true
+	}
+	for _, i := range e.INS {
+		if i == ins {
+			return true
+		}
+	}
+	return false
+}
+
+// writeINS are file commands that modify content (used for ADM hints)
+var writeINS = []byte{INS_UPDATE_BINARY, INS_UPDATE_RECORD, 0xD0, 0xD2, 0xE2, 0x32, 0x04, 0x44, 0xE0, 0xE4}
+
+// readINS are file commands that return content
+var readINS = []byte{INS_READ_BINARY, INS_READ_RECORD, 0xA2}
+
+// standardSW is the interpretation of ISO 7816-4, ETSI TS 102 221, GSM 11.11 and
+// GlobalPlatform status words
+var standardSW = []SWEntry{
+	{SW: SW_OK, Severity: SeverityOK, Text: "Success"},
+
+	// Warnings
+	{SW: 0x6200, Severity: SeverityWarning, Text: "No information given, non-volatile memory unchanged"},
+	{SW: 0x6281, Severity: SeverityWarning, Text: "Part of returned data may be corrupted"},
+	{SW: 0x6282, Severity: SeverityWarning, Text: "End of file/record reached before reading Le bytes"},
+	{SW: 0x6283, Severity: SeverityWarning, Text: "Selected file invalidated",
+		Hint: "the file is deactivated; it can be re-activated with ADM (ACTIVATE/REHABILITATE)"},
+	{SW: 0x6285, Severity: SeverityWarning, Text: "Selected file in termination state"},
+	{SW: 0x62F1, Severity: SeverityWarning, Text: "More data available"},
+	{SW: 0x62F2, Severity: SeverityWarning, Text: "More data available and proactive command pending"},
+	{SW: 0x62F3, Severity: SeverityInfo, Text: "Response data available"},
+	{SW: 0x63F1, Severity: SeverityWarning, Text: "More data expected"},
+	{SW: 0x63F2, Severity: SeverityWarning, Text: "More data expected and proactive command pending"},
+	{SW: 0x6300, Context: ContextAuth, Severity: SeverityWarning, Text: "Authentication failed",
+		Hint: "the card rejected the challenge; check Ki/OPc and the algorithm configured on the card"},
+	{SW: 0x6300, Severity: SeverityWarning, Text: "Verification failed"},
+	{SW: 0x6310, Context: ContextGP, Severity: SeverityWarning, Text: "More data available",
+		Hint: "repeat GET STATUS with P2 'next occurrence'"},
+
+	// Execution errors
+	{SW: 0x6400, Severity: SeverityError, Text: "Execution error, non-volatile memory unchanged"},
+	{SW: 0x6581, Context: ContextGP, Severity: SeverityError, Text: "Memory failure",
+		Hint: "LOAD/INSTALL ran out of memory or hit a write failure; check free space and the CAP file"},
+	{SW: 0x6581, Severity: SeverityError, Text: "Memory problem"},
+
+	// Checking errors
+	{SW: SW_WRONG_LENGTH, INS: readINS, Context: ContextFile, Severity: SeverityError, Text: "Wrong length",
+		Hint: "Le does not match the file or record size"},
+	{SW: SW_WRONG_LENGTH, Severity: SeverityError, Text: "Wrong length"},
+	{SW: 0x6800, Severity: SeverityError, Text: "Functions in CLA not supported"},
+	{SW: SW_CHANNEL_NOT_SUPPORTED, Severity: SeverityError, Text: "Logical channel not supported"},
+	{SW: 0x6882, Severity: SeverityError, Text: "Secure messaging not supported"},
+	{SW: 0x6981, Severity: SeverityError, Text: "Command incompatible with file structure",
+		Hint: "use READ/UPDATE RECORD for record files and READ/UPDATE BINARY for transparent files"},
+	{SW: SW_SECURITY_NOT_SATISFIED, INS: writeINS, Context: ContextFile, Severity: SeverityError, Text: "Security status not satisfied",
+		Hint: "file likely requires ADM, check --adm-check output"},
+	{SW: SW_SECURITY_NOT_SATISFIED, INS: readINS, Context: ContextFile, Severity: SeverityError, Text: "Security status not satisfied",
+		Hint: "file is protected; verify PIN1 (-p) or ADM (-a) first"},
+	{SW: SW_SECURITY_NOT_SATISFIED, Context: ContextAuth, Severity: SeverityError, Text: "Security status not satisfied",
+		Hint: "PIN1 must be verified before AUTHENTICATE on this card"},
+	{SW: SW_SECURITY_NOT_SATISFIED, Context: ContextGP, Severity: SeverityError, Text: "Security status not satisfied",
+		Hint: "secure channel not open or security level too low"},
+	{SW: SW_SECURITY_NOT_SATISFIED, Severity: SeverityError, Text: "Security status not satisfied"},
+	{SW: SW_AUTH_FAILED, Context: ContextSecurity, Severity: SeverityError, Text: "Authentication method blocked",
+		Hint: "the key is blocked; do not retry (unblock with PUK, ADM keys are usually unrecoverable)"},
+	{SW: SW_AUTH_FAILED, Severity: SeverityError, Text: "Authentication method blocked"},
+	{SW: SW_REF_DATA_NOT_FOUND, Severity: SeverityError, Text: "Reference data not found"},
+	{SW: SW_CONDITIONS_NOT_SATISFIED, Context: ContextGP, INS: []byte{0xE4}, Severity: SeverityError,
+		Text: "Conditions of use not satisfied", Hint: "object has dependencies; delete instances before the package or use related objects deletion"},
+	{SW: SW_CONDITIONS_NOT_SATISFIED, Severity: SeverityError, Text: "Conditions of use not satisfied"},
+	{SW: SW_COMMAND_NOT_ALLOWED, Severity: SeverityError, Text: "Command not allowed (no current EF)",
+		Hint: "select an EF before reading or writing"},
+	{SW: 0x6A80, Context: ContextGP, Severity: SeverityError, Text: "Incorrect parameters in data field",
+		Hint: "check AIDs, install parameters and the CAP file"},
+	{SW: 0x6A80, Severity: SeverityError, Text: "Incorrect parameters in data field"},
+	{SW: SW_FUNC_NOT_SUPPORTED, Severity: SeverityError, Text: "Function not supported"},
+	{SW: SW_FILE_NOT_FOUND, INS: []byte{INS_SELECT}, Context: ContextFile, Severity: SeverityError, Text: "File not found",
+		Hint: "file or application not present on this card"},
+	{SW: SW_FILE_NOT_FOUND, Context: ContextGP, Severity: SeverityError, Text: "Application not found",
+		Hint: "AID is not on the card"},
+	{SW: SW_FILE_NOT_FOUND, Severity: SeverityError, Text: "File not found"},
+	{SW: SW_RECORD_NOT_FOUND, Severity: SeverityError, Text: "Record not found"},
+	{SW: 0x6A84, Severity: SeverityError, Text: "Not enough memory space in the file"},
+	{SW: SW_WRONG_P1P2, Severity: SeverityError, Text: "Incorrect P1 P2"},
+	{SW: 0x6A87, Severity: SeverityError, Text: "Lc inconsistent with P1-P2"},
+	{SW: SW_DATA_NOT_FOUND, Context: ContextSecurity, Severity: SeverityError, Text: "Referenced data not found",
+		Hint: "key reference not defined on this card (ADM slot not used)"},
+	{SW: SW_DATA_NOT_FOUND, Context: ContextGP, Severity: SeverityError, Text: "Referenced data not found",
+		Hint: "key version/identifier or AID not found"},
+	{SW: SW_DATA_NOT_FOUND, Severity: SeverityError, Text: "Referenced data not found"},
+	{SW: 0x6B00, Severity: SeverityError, Text: "Wrong parameters (offset outside the EF)"},
+	{SW: SW_INS_NOT_SUPPORTED, Severity: SeverityError, Text: "Instruction not supported"},
+	{SW: SW_CLA_NOT_SUPPORTED, Severity: SeverityError, Text: "Class not supported"},
+	{SW: 0x6F00, Severity: SeverityError, Text: "Technical problem, no precise diagnosis"},
+
+	// ETSI TS 102 221 application errors
+	{SW: 0x9850, Severity: SeverityError, Text: "INCREASE cannot be performed, maximum value reached"},
+	{SW: 0x9862, Context: ContextAuth, Severity: SeverityError, Text: "Authentication error, incorrect MAC",
+		Hint: "AUTN rejected; check Ki/OPc, AMF and the SQN window"},
+	{SW: 0x9862, Severity: SeverityError, Text: "Authentication error, application specific"},
+	{SW: 0x9863, Severity: SeverityError, Text: "Security session or association expired"},
+	{SW: 0x9864, Context: ContextAuth, Severity: SeverityError, Text: "Authentication error, security context not supported",
+		Hint: "the application does not support this AUTHENTICATE context (P2)"},
+	{SW: 0x9864, Severity: SeverityError, Text: "Security context not supported"},
+	{SW: 0x9865, Severity: SeverityError, Text: "Key freshness failure"},
+	{SW: 0x9866, Severity: SeverityError, Text: "Authentication error, no memory space available"},
+	{SW: 0x9867, Severity: SeverityError, Text: "Authentication error, no memory space available in EF_MUK"},
+
+	// GSM 11.11
+	{SW: 0x9802, Severity: SeverityError, Text: "No CHV initialized"},
+	{SW: 0x9804, Severity: SeverityError, Text: "Access condition not fulfilled",
+		Hint: "verify CHV1/ADM before this command"},
+	{SW: 0x9808, Severity: SeverityError, Text: "In contradiction with CHV status"},
+	{SW: 0x9810, Severity: SeverityError, Text: "In contradiction with invalidation status"},
+	{SW: 0x9840, Severity: SeverityError, Text: "CHV blocked"},
+	{SW: 0x9300, Severity: SeverityError, Text: "SIM Application Toolkit busy"},
+	{SW: 0x9400, Severity: SeverityError, Text: "No EF selected"},
+	{SW: 0x9402, Severity: SeverityError, Text: "Out of range (invalid address)"},
+	{SW: 0x9404, Severity: SeverityError, Text: "File ID not found"},
+	{SW: 0x9408, Severity: SeverityError, Text: "File inconsistent with the command"},
+}
+
+var (
+	vendorSW     []SWEntry
+	vendorSWName string
+	vendorSWMu   sync.RWMutex
+)
+
+// SetVendorSWTable installs the status word table of the detected card vendor.
+// Vendor entries are searched before the standard table; nil removes the table.
+func SetVendorSWTable(vendor string, table []SWEntry) {
+	vendorSWMu.Lock()
+	defer vendorSWMu.Unlock()
+	vendorSWName = vendor
+	vendorSW = table
+}
+
+// VendorSWTable returns the name of the installed vendor table ("" if none)
+func VendorSWTable() string {
+	vendorSWMu.RLock()
+	defer vendorSWMu.RUnlock()
+	return vendorSWName
+}
+
+// DecodeSW interprets a status word for the command that produced it
+func DecodeSW(sw uint16, ins byte, context CommandContext) SWInfo {
+	vendorSWMu.RLock()
+	vendor := vendorSW
+	vendorSWMu.RUnlock()
+
+	for _, table := range [][]SWEntry{vendor, standardSW} {
+		for i := range table {
+			if e := &table[i]; e.matches(sw, ins, context) {
+				return SWInfo{SW: sw, Severity: e.Severity, Text: e.Text, Hint: e.Hint}
+			}
+		}
+	}
+
+	sw1, sw2 := byte(sw>>8), byte(sw)
+	info := SWInfo{SW: sw, Severity: SeverityError, Text: "Unknown error"}
+	switch {
+	case sw1 == 0x61:
+		info.Severity, info.Text = SeverityInfo, fmt.Sprintf("%d bytes available", sw2)
+	case sw1 == 0x9F:
+		info.Severity, info.Text = SeverityInfo, fmt.Sprintf("%d bytes available (GSM)", sw2)
+	case sw1 == 0x91:
+		info.Severity, info.Text = SeverityInfo, fmt.Sprintf("Proactive command pending, %d bytes", sw2)
+	case sw1 == 0x92 && sw2&0xF0 == 0x00:
+		info.Severity, info.Text = SeverityWarning, fmt.Sprintf("Command successful after %d internal retries", sw2&0x0F)
+	case sw1 == 0x6C:
+		info.Text = fmt.Sprintf("Retry with Le=%d", sw2)
+	case sw1 == 0x63 && sw2&0xF0 == 0xC0:
+		info.Severity = SeverityWarning
+		info.Text = fmt.Sprintf("PIN verification failed, %d attempts remaining", sw2&0x0F)
+		if sw2&0x0F <= 1 && context == ContextSecurity {
+			info.Hint = "one more wrong attempt blocks the key"
+		}
+	case sw1 == 0x63 && sw2&0xF0 == 0xF0:
+		info.Severity, info.Text = SeverityWarning, fmt.Sprintf("Proprietary warning %02X", sw2)
+	case sw1 == 0x6F:
+		info.Text = fmt.Sprintf("Technical problem, vendor diagnostic %02X", sw2)
+		info.Hint = "card internal error; retry after a reset or check the vendor documentation"
+	case sw1 == 0x62:
+		info.Severity, info.Text = SeverityWarning, "Warning, non-volatile memory unchanged"
+	case sw1 == 0x63:
+		info.Severity, info.Text = SeverityWarning, "Warning, non-volatile memory changed"
+	}
+	return info
+}
+
+// SWInfo interprets the response status word in the context of the command that produced it
+func (r *APDUResponse) SWInfo() SWInfo {
+	return DecodeSW(r.SW(), r.ins, ContextFromCommand(r.cla, r.ins))
+}
+
+// SWString returns the status word meaning (with hint) for the command that produced it
+func (r *APDUResponse) SWString() string {
+	return r.SWInfo().String()
+}
@@ -0,0 +1,115 @@
+package card
+
+import (
+	"strings"
+	"testing"
+)
+
+// ============ SW DECODING TESTS ============
+
+func TestDecodeSW(t *testing.T) {
+	tests := []struct {
+		name     string
+		sw       uint16
+		ins      byte
+		ctx      CommandContext
+		severity SWSeverity
+		text     string
+		hint     string
+	}{
+		{"Success", 0x9000, INS_READ_BINARY, ContextFile, SeverityOK, "Success", ""},
+		{"6982 after UPDATE", 0x6982, INS_UPDATE_BINARY, ContextFile, SeverityError, "Security status", "requires ADM"},
+		{"6982 after READ", 0x6982, INS_READ_RECORD, ContextFile, SeverityError, "Security status", "PIN1"},
+		{"6982 in GP", 0x6982, 0xE4, ContextGP, SeverityError, "Security status", "secure channel"},
+		{"6982 no context", 0x6982, 0, ContextAny, SeverityError, "Security status", ""},
+		{"9862 authenticate", 0x9862, INS_AUTHENTICATE, ContextAuth, SeverityError, "incorrect MAC", "AUTN"},
+		{"9862 elsewhere", 0x9862, 0, ContextAny, SeverityError, "application specific", ""},
+		{"9864 authenticate", 0x9864, INS_AUTHENTICATE, ContextAuth, SeverityError, "context not supported", "P2"},
+		{"9850", 0x9850, 0x32, ContextFile, SeverityError, "maximum value", ""},
+		{"6A88 verify", 0x6A88, INS_VERIFY, ContextSecurity, SeverityError, "Referenced data", "ADM slot"},
+		{"63C1 verify", 0x63C1, INS_VERIFY, ContextSecurity, SeverityWarning, "1 attempts", "blocks"},
+		{"63F5 proprietary", 0x63F5, 0, ContextAny, SeverityWarning, "Proprietary warning F5", ""},
+		{"6F42 vendor range", 0x6F42, 0, ContextAny, SeverityError, "vendor diagnostic 42", "reset"},
+		{"6110", 0x6110, 0, ContextAny, SeverityInfo, "16 bytes available", ""},
+		{"9F22 GSM", 0x9F22, 0, ContextAny, SeverityInfo, "34 bytes available", ""},
+		{"Unknown", 0x6A99, 0, ContextAny, SeverityError, "Unknown error", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			info := DecodeSW(tc.sw, tc.ins, tc.ctx)
+			if info.Severity != tc.severity || !strings.Contains(info.Text, tc.text) {
+				t.Errorf("DecodeSW(%04X) = %v %q, want %v containing %q", tc.sw, info.Severity, info.Text, tc.severity, tc.text)
+			}
+			if tc.hint == "" && info.Hint != "" && tc.ctx == ContextAny {
+				t.Errorf("DecodeSW(%04X) hint = %q, want none without context", tc.sw, info.Hint)
+			}
+			if tc.hint != "" && !strings.Contains(info.Hint, tc.hint) {
+				t.Errorf("DecodeSW(%04X) hint = %q, want %q", tc.sw, info.Hint, tc.hint)
+			}
+		})
+	}
+}
+
+func TestContextFromCommand(t *testing.T) {
+	tests := []struct {
+		cla, ins byte
+		want     CommandContext
+	}{
+		{0x00, INS_UPDATE_BINARY, ContextFile},
+		{0xA0, INS_SELECT, ContextFile},
+		{0x00, INS_VERIFY, ContextSecurity},
+		{0x00, INS_AUTHENTICATE, ContextAuth},
+		{0xA0, 0x88, ContextAuth},
+		{0x84, 0xE4, ContextGP},
+		{0x80, 0xE2, ContextGP},
+		{0x00, 0xE4, ContextFile},
+		{0x00, 0x70, ContextAny},
+	}
+	for _, tc := range tests {
+		if got := ContextFromCommand(tc.cla, tc.ins); got != tc.want {
+			t.Errorf("ContextFromCommand(%02X, %02X) = %v, want %v", tc.cla, tc.ins, got, tc.want)
+		}
+	}
+}
+
+func TestVendorSWTable(t *testing.T) {
+	SetVendorSWTable("Test", []SWEntry{
+		{SW: 0x6F20, Mask: 0xFFF0, Severity: SeverityError, Text: "Vendor file system error"},
+		{SW: 0x9000, Severity: SeverityOK, Text: "Vendor OK"},
+	})
+	defer SetVendorSWTable("", nil)
+
+	if VendorSWTable() != "Test" {
+		t.Errorf("VendorSWTable() = %q, want Test", VendorSWTable())
+	}
+	if got := DecodeSW(0x6F2A, 0, ContextAny).Text; got != "Vendor file system error" {
+		t.Errorf("vendor range: %q", got)
+	}
+	if got := DecodeSW(0x6F42, 0, ContextAny).Text; !strings.Contains(got, "vendor diagnostic") {
+		t.Errorf("outside vendor range: %q", got)
+	}
+	if got := DecodeSW(0x9000, 0, ContextAny).Text; got != "Vendor OK" {
+		t.Errorf("vendor entries take precedence: %q", got)
+	}
+}
+
+func TestAPDUResponse_SWString(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddEF(0x2FE2, []byte{0x01})
+	m.Override = func(apdu []byte) []byte {
+		if apdu[1] == INS_UPDATE_BINARY {
+			return swBytes(SW_SECURITY_NOT_SATISFIED)
+		}
+		return nil
+	}
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+	r.Select([]byte{0x2F, 0xE2})
+	resp, err := r.UpdateBinary(0, []byte{0x02})
+	if err != nil {
+		t.Fatalf("UpdateBinary() error = %v", err)
+	}
+	if got := resp.SWString(); !strings.Contains(got, "--adm-check") {
+		t.Errorf("SWString() = %q, want ADM hint", got)
+	}
+}
@@ -0,0 +1,57 @@
+package card
+
+import (
+	"fmt"
+	"time"
+)
+
+// APDUExchange is one command/response pair seen by Transmit
+type APDUExchange struct {
+	Command    string  `json:"command"`            // hex
+	Response   string  `json:"response,omitempty"` // hex, data and status word
+	Error      string  `json:"error,omitempty"`    // transport error (timeout, card removed, ...)
+	Secret     string  `json:"secret,omitempty"`   // key material read by the exchange, response reduced to the status word (see WithSecret)
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// SetTrace calls fn for every APDU passed to Transmit, after the card answered or the
+// transport failed. Pass nil to stop tracing. Recovery replays (see WithRetry) are part
+// of the traced exchange, not traced separately.
+func (r *Reader) SetTrace(fn func(APDUExchange)) {
+	r.trace = fn
+}
+
+// traceExchange reports one exchange to the trace function
+func (r *Reader) traceExchange(apdu, response []byte, err error, start time.Time) {
+	ex := APDUExchange{
+		Command:    fmt.Sprintf("%X", apdu),
+		Response:   fmt.Sprintf("%X", response),
+		DurationMs: durationMs(time.Since(start)),
+	}
+	if err != nil {
+		ex.Error = err.Error()
+	}
+	if r.secret != "" {
+		ex.Secret = r.secret
+		if len(response) >= 2 {
+			ex.Response = fmt.Sprintf("%X", response[len(response)-2:])
+		}
+	}
+	r.trace(ex)
+}
+
+// WithSecret runs fn, which reads the key material named by label (e.g. "Ki"), keeping
+// the data it reads out of what the reader records: the trace gets the commands and
+// status words marked with Secret, the fixture recorder does not see the reads.
+// The trace thus records that the key was accessed, never its value.
+func (r *Reader) WithSecret(label string, fn func() error) error {
+	prev := r.secret
+	r.secret = label
+	defer func() { r.secret = prev }()
+	return fn()
+}
+
+// secretRead reports whether apdu is a read whose data WithSecret keeps from the fixture
+func (r *Reader) secretRead(apdu []byte) bool {
+	return r.secret != "" && len(apdu) > 1 && (apdu[1] == INS_READ_BINARY || apdu[1] == INS_READ_RECORD)
+}
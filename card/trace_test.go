@@ -0,0 +1,79 @@
+package card
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// ============ APDU TRACE TESTS ============
+
+func TestSetTrace(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddEF(0x2FE2, []byte{0x01, 0x02})
+	r := NewReaderWithTransport("Mock", m.ATR, m)
+
+	var trace []APDUExchange
+	r.SetTrace(func(ex APDUExchange) { trace = append(trace, ex) })
+	if _, err := r.ReadBinary(0, 2); err != nil {
+		t.Fatalf("ReadBinary() error = %v", err)
+	}
+	r.SetReadOnly(true)
+	if _, err := r.UpdateBinary(0, []byte{0xAA}); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("UpdateBinary() error = %v, want ErrReadOnly", err)
+	}
+	r.SetTrace(nil)
+	r.ReadBinary(0, 2)
+
+	if len(trace) != 2 {
+		t.Fatalf("traced %d exchanges, want 2: %+v", len(trace), trace)
+	}
+	if trace[0].Command != "00B0000002" || trace[0].Response == "" || trace[0].Error != "" {
+		t.Errorf("trace[0] = %+v", trace[0])
+	}
+	if trace[1].Command != "00D6000001AA" || trace[1].Error == "" {
+		t.Errorf("trace[1] = %+v, want the refused write with its error", trace[1])
+	}
+}
+
+func TestWithSecret(t *testing.T) {
+	m := NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddEF(0x2FE2, []byte{0x01, 0x02})
+	m.MF().AddEF(0x6F01, []byte{0xAA, 0xBB, 0xCC, 0xDD})
+	r := NewReaderWithTransport("Mock", m.ATR, m, WithFixtureRecording())
+
+	var trace []APDUExchange
+	r.SetTrace(func(ex APDUExchange) { trace = append(trace, ex) })
+	r.Select([]byte{0x2F, 0xE2})
+	r.ReadBinary(0, 2)
+	before := len(trace)
+	err := r.WithSecret("Ki", func() error {
+		r.Select([]byte{0x6F, 0x01})
+		_, err := r.ReadBinary(0, 4)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithSecret() error = %v", err)
+	}
+	after := len(trace)
+	r.ReadBinary(0, 4) // still 6F01, traced again in full
+
+	if after == before || len(trace) != after+1 {
+		t.Fatalf("traced %d exchanges (secret %d..%d)", len(trace), before, after)
+	}
+	for _, ex := range trace[before:after] {
+		if ex.Secret != "Ki" || len(ex.Response) != 4 {
+			t.Errorf("secret exchange %+v, want the status word only", ex)
+		}
+	}
+	if last := trace[after]; last.Secret != "" || !strings.HasPrefix(last.Response, "AABBCCDD") {
+		t.Errorf("exchange after WithSecret = %+v, want the data again", last)
+	}
+
+	// Only the read outside WithSecret reached the fixture
+	for _, f := range r.Fixture().Files {
+		if f.Path == "3F00/2FE2" && f.Data != "0102" {
+			t.Errorf("fixture recorded %+v, want 2FE2 unchanged by the secret read", f)
+		}
+	}
+}
@@ -1,10 +1,17 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"sim_reader/algorithms"
 	"sim_reader/output"
 	"sim_reader/sim"
 )
@@ -20,9 +27,18 @@ var (
 	authAUTN   string
 	authAUTS   string
 	authAlgo   string
-	authMCC    int
-	authMNC    int
+	authMCC    string
+	authMNC    string
 	authNoCard bool
+	authCtx    string
+
+	// SQN inspection flags
+	showSQN     bool
+	allowResync bool
+
+	// Offline vector generation flags
+	authGenVectors int
+	authOut        string
 )
 
 var authCmd = &cobra.Command{
@@ -44,6 +60,9 @@ Examples:
   sim_reader auth -k F2464E3293019A7E51ABAA7B1262B7D8 \
     --opc B10B351A0CCD8BE31E0C9F088945A812 --mcc 250 --mnc 88
 
+  # 3-digit MNC (without --mcc/--mnc the card's IMSI and EF_AD are used)
+  sim_reader auth -k ... --opc ... --mcc 310 --mnc 010
+
   # Use specific SQN
   sim_reader auth -k ... --opc ... --sqn 000000000001 --no-card
 
@@ -53,8 +72,18 @@ Examples:
   # Process AUTS from dump to extract SQNms (resync)
   sim_reader auth -k ... --opc ... --rand 7D6AF2DF... --auts AABBCCDDEEFF... --no-card
 
+  # Show the card SQN array (sysmoISIM-SJA2/SJA5) or derive SQNms from AUTS
+  sim_reader auth -a 77111606 --show-sqn
+  sim_reader auth -k ... --opc ... --show-sqn --auth-allow-resync
+
   # TUAK algorithm
-  sim_reader auth -k ... --opc ... --algo tuak --no-card`,
+  sim_reader auth -k ... --opc ... --algo tuak --no-card
+
+  # GBA bootstrapping (card keeps Ks = CK||IK, e.g. for XCAP over GBA)
+  sim_reader auth -k ... --opc ... --auth-context gba
+
+  # 1000 Milenage vectors for core network load tests (no card, SQN counts up from --sqn)
+  sim_reader auth -k ... --opc ... --auth-gen-vectors 1000 --auth-out vectors.csv`,
 	Run: runAuth,
 }
 
@@ -77,17 +106,36 @@ func init() {
 		"AUTS from dump for SQN resync (28/44/76 hex chars)")
 	authCmd.Flags().StringVar(&authAlgo, "algo", "milenage",
 		"Algorithm: milenage or tuak")
-	authCmd.Flags().IntVar(&authMCC, "mcc", 0,
-		"Mobile Country Code (for KASME computation)")
-	authCmd.Flags().IntVar(&authMNC, "mnc", 0,
-		"Mobile Network Code (for KASME computation)")
+	authCmd.Flags().StringVar(&authMCC, "mcc", "",
+		"Mobile Country Code (for KASME computation; default: from the card IMSI)")
+	authCmd.Flags().StringVar(&authMNC, "mnc", "",
+		"Mobile Network Code, 2 or 3 digits as written (e.g. 010; default: from the card IMSI and EF_AD)")
 	authCmd.Flags().BoolVar(&authNoCard, "no-card", false,
 		"Compute auth vectors without sending to card")
+	authCmd.Flags().StringVar(&authCtx, "auth-context", "3g",
+		"AUTHENTICATE context: 3g or gba (GBA bootstrapping, needs the GBA service in EF_UST)")
+	authCmd.Flags().BoolVar(&showSQN, "show-sqn", false,
+		"Show the SQN stored on the card (SQN array from the vendor file if the driver supports it)")
+	authCmd.Flags().BoolVar(&allowResync, "auth-allow-resync", false,
+		"With --show-sqn: derive SQNms from an intentional sync failure (needs -k/--opc, perturbs the card SQN state)")
+	authCmd.Flags().IntVar(&authGenVectors, "auth-gen-vectors", 0,
+		"Generate N Milenage vectors without a card (random RAND, SQN from --sqn counting up)")
+	authCmd.Flags().StringVar(&authOut, "auth-out", "",
+		"Output file of --auth-gen-vectors, CSV or JSON by extension (default: CSV to stdout)")
 
 	rootCmd.AddCommand(authCmd)
 }
 
 func runAuth(cmd *cobra.Command, args []string) {
+	if showSQN {
+		runShowSQN()
+		return
+	}
+	if authGenVectors > 0 {
+		runGenVectors()
+		return
+	}
+
 	// Validate K is provided
 	if authK == "" {
 		printError("Subscriber key -k/--key is required")
@@ -109,18 +157,29 @@ func runAuth(cmd *cobra.Command, args []string) {
 	}
 	fmt.Println()
 
+	mcc, mnc, mncLength, err := parseAuthPLMN(authMCC, authMNC)
+	if err != nil {
+		printError(fmt.Sprintf("Auth config error: %v", err))
+		return
+	}
+
 	// Parse auth config
 	authCfg, err := sim.ParseAuthConfig(
 		authK, authOP, authOPc,
 		authSQN, authAMF, authRAND,
 		authAUTN, authAUTS,
 		authAlgo,
-		authMCC, authMNC,
+		mcc, mnc,
 	)
 	if err != nil {
 		printError(fmt.Sprintf("Auth config error: %v", err))
 		return
 	}
+	authCfg.MNCLength = mncLength
+	if authCfg.Context, err = sim.ParseAuthContext(authCtx); err != nil {
+		printError(fmt.Sprintf("Auth config error: %v", err))
+		return
+	}
 
 	// Run authentication without card if requested
 	if authNoCard {
@@ -140,6 +199,14 @@ func runAuth(cmd *cobra.Command, args []string) {
 	}
 	defer reader.Close()
 
+	// KASME serving network defaults to the home network of the card
+	if authMCC == "" && authMNC == "" {
+		if cardMCC, cardMNC, err := sim.ReadHomePLMN(reader); err == nil {
+			authCfg.MCC, authCfg.MNC, authCfg.MNCLength, _ = parseAuthPLMN(cardMCC, cardMNC)
+			printSuccess(fmt.Sprintf("KASME network from card: MCC %s, MNC %s", cardMCC, cardMNC))
+		}
+	}
+
 	result, err := sim.RunAuthentication(reader, authCfg)
 	if err != nil {
 		printError(fmt.Sprintf("Authentication error: %v", err))
@@ -158,3 +225,109 @@ func runAuth(cmd *cobra.Command, args []string) {
 	}
 }
 
+// runShowSQN prints the SQN state of the card. The keys are only needed for --auth-allow-resync.
+func runShowSQN() {
+	var authCfg *sim.AuthConfig
+	if authK != "" {
+		var err error
+		authCfg, err = sim.ParseAuthConfig(authK, authOP, authOPc, "", authAMF, "", "", "", authAlgo, 0, 0)
+		if err != nil {
+			printError(fmt.Sprintf("Auth config error: %v", err))
+			return
+		}
+	}
+
+	reader, err := connectAndPrepareReader()
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	defer reader.Close()
+
+	info, err := sim.ReadSQNInfo(reader, sim.FindDriver(reader), authCfg, allowResync)
+	if err != nil {
+		printError(fmt.Sprintf("SQN: %v", err))
+		return
+	}
+	if outputJSON {
+		data, _ := json.MarshalIndent(info, "", "  ")
+		printDocument(data)
+		return
+	}
+	output.PrintSQNInfo(info)
+}
+
+// parseAuthPLMN parses --mcc/--mnc keeping the number of MNC digits (010 is a 3-digit MNC).
+// Both empty means no network given (MCC 0).
+func parseAuthPLMN(mccStr, mncStr string) (mcc, mnc, mncLength int, err error) {
+	if mccStr == "" && mncStr == "" {
+		return 0, 0, 0, nil
+	}
+	if len(mccStr) != 3 {
+		return 0, 0, 0, fmt.Errorf("MCC must be 3 digits: %q", mccStr)
+	}
+	if len(mncStr) != 2 && len(mncStr) != 3 {
+		return 0, 0, 0, fmt.Errorf("MNC must be 2 or 3 digits: %q", mncStr)
+	}
+	if mcc, err = strconv.Atoi(mccStr); err != nil || mcc < 0 {
+		return 0, 0, 0, fmt.Errorf("invalid MCC: %q", mccStr)
+	}
+	if mnc, err = strconv.Atoi(mncStr); err != nil || mnc < 0 {
+		return 0, 0, 0, fmt.Errorf("invalid MNC: %q", mncStr)
+	}
+	return mcc, mnc, len(mncStr), nil
+}
+
+// runGenVectors streams --auth-gen-vectors vectors to --auth-out (stdout without it)
+func runGenVectors() {
+	if sim.AlgorithmType(strings.ToLower(authAlgo)) != sim.AlgorithmMilenage {
+		printError("--auth-gen-vectors supports --algo milenage only")
+		return
+	}
+	authCfg, err := sim.ParseAuthConfig(authK, authOP, authOPc, authSQN, authAMF, "", "", "", authAlgo, 0, 0)
+	if err != nil {
+		printError(fmt.Sprintf("Auth config error: %v", err))
+		return
+	}
+	opc := authCfg.OPc
+	if opc == nil {
+		if opc, err = algorithms.ComputeOPc(authCfg.K, authCfg.OP); err != nil {
+			printError(fmt.Sprintf("OPc: %v", err))
+			return
+		}
+	}
+	var sqn uint64
+	for _, b := range authCfg.SQN {
+		sqn = sqn<<8 | uint64(b)
+	}
+	cfg := algorithms.VectorConfig{K: authCfg.K, OPc: opc, AMF: authCfg.AMF, SQN: sqn}
+
+	format := algorithms.VectorFormatCSV
+	if strings.EqualFold(filepath.Ext(authOut), ".json") {
+		format = algorithms.VectorFormatJSON
+	}
+	if authOut == "" {
+		if err := algorithms.GenerateVectors(cfg, authGenVectors, os.Stdout, format); err != nil {
+			printError(fmt.Sprintf("Vector generation failed: %v", err))
+		}
+		return
+	}
+
+	f, err := os.OpenFile(authOut, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	start := time.Now()
+	err = algorithms.GenerateVectors(cfg, authGenVectors, f, format)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		printError(fmt.Sprintf("Vector generation failed: %v", err))
+		return
+	}
+	elapsed := time.Since(start)
+	printSuccess(fmt.Sprintf("%d vectors written to %s in %s (%.0f vectors/s)",
+		authGenVectors, authOut, elapsed.Round(time.Millisecond), float64(authGenVectors)/elapsed.Seconds()))
+}
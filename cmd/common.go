@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
-	"sim_reader/card"
 	"sim_reader/output"
+	"sim_reader/sim"
 )
 
 // requireADMKey checks if ADM key is provided and returns error if not
@@ -15,9 +18,42 @@ func requireADMKey() error {
 	return nil
 }
 
+// credentialFlags are the flags that give each credential level
+var credentialFlags = map[string]string{
+	sim.CredentialPIN1: "-p/--pin",
+	sim.CredentialPIN2: "--pin2",
+	sim.CredentialADM1: "-a/--adm",
+	sim.CredentialADM2: "--adm2",
+	sim.CredentialADM3: "--adm3",
+	sim.CredentialADM4: "--adm4",
+}
+
+// credentialFlagHint names the flags of the credentials an update was refused for
+// ("" unless err is a sim.AccessDeniedError with missing credentials)
+func credentialFlagHint(err error) string {
+	var denied *sim.AccessDeniedError
+	if !errors.As(err, &denied) || len(denied.Missing) == 0 {
+		return ""
+	}
+	flags := make([]string, 0, len(denied.Missing))
+	for _, c := range denied.Missing {
+		if f, ok := credentialFlags[c]; ok {
+			flags = append(flags, f)
+		}
+	}
+	if len(flags) == 0 {
+		return ""
+	}
+	sep := " or "
+	if strings.Contains(denied.Needs, "&") {
+		sep = " and "
+	}
+	return " (use " + strings.Join(flags, sep) + ")"
+}
+
 // listReaders prints the list of available smart card readers
 func listReaders() error {
-	readers, err := card.ListReaders()
+	readers, err := backendReaders()
 	if err != nil {
 		return fmt.Errorf("failed to list readers: %w", err)
 	}
@@ -25,8 +61,50 @@ func listReaders() error {
 	return nil
 }
 
-// printError prints an error message using the output package
+// JSON mode state: stdout is reserved for the JSON document, everything else goes to stderr
+var (
+	jsonStdout   *os.File // real stdout while JSON mode is active
+	jsonWarnings []string // warnings and errors reported while JSON mode is active
+)
+
+// beginJSONOutput redirects all further console output to stderr so that
+// stdout carries exactly one document (written by printDocument)
+func beginJSONOutput() {
+	if jsonStdout != nil {
+		return
+	}
+	jsonStdout = os.Stdout
+	jsonWarnings = nil
+	os.Stdout = os.Stderr
+}
+
+// endJSONOutput restores stdout after beginJSONOutput
+func endJSONOutput() {
+	if jsonStdout == nil {
+		return
+	}
+	os.Stdout = jsonStdout
+	jsonStdout = nil
+}
+
+// printDocument writes a JSON/YAML document to the real stdout
+func printDocument(data []byte) {
+	w := os.Stdout
+	if jsonStdout != nil {
+		w = jsonStdout
+	}
+	w.Write(data)
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		fmt.Fprintln(w)
+	}
+}
+
+// printError prints an error message using the output package.
+// In JSON mode the message goes to stderr and is recorded in jsonWarnings.
 func printError(msg string) {
+	if outputJSON {
+		jsonWarnings = append(jsonWarnings, msg)
+	}
 	output.PrintError(msg)
 }
 
@@ -37,10 +115,12 @@ func printSuccess(msg string) {
 	}
 }
 
-// printWarning prints a warning message using the output package
+// printWarning prints a warning message using the output package.
+// In JSON mode the message goes to stderr and is recorded in jsonWarnings.
 func printWarning(msg string) {
-	if !outputJSON {
-		output.PrintWarning(msg)
+	if outputJSON {
+		jsonWarnings = append(jsonWarnings, msg)
 	}
+	output.PrintWarning(msg)
 }
 
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"sim_reader/card"
+	"sim_reader/output"
+	"sim_reader/sim"
+)
+
+var (
+	// Card-to-card copy flags (write)
+	copyFromReader int
+	copyToReader   int
+	copyFromPIN1   string
+)
+
+// copyResult is the --json document of a card copy
+type copyResult struct {
+	Source    string             `json:"source_iccid"`
+	Report    *sim.ApplyReport   `json:"report"`
+	NotCopied []sim.SnapshotSkip `json:"not_copied"`
+	Diff      *sim.VerifyReport  `json:"diff,omitempty"`
+}
+
+// runCardCopy copies the copy-safe files of the card in --copy-from-reader to the card in
+// --copy-to-reader. The source is connected first, read-only and without ADM keys or PIN2
+// (those flags belong to the target); both connections stay open until the copy ends.
+func runCardCopy() {
+	if copyFromReader < 0 || copyToReader < 0 {
+		printError("--copy-from-reader and --copy-to-reader are both required")
+		return
+	}
+	if copyFromReader == copyToReader {
+		printError("--copy-from-reader and --copy-to-reader must be different readers")
+		return
+	}
+	source, err := connectCopyReader(copyFromReader, true)
+	if err != nil {
+		printError(fmt.Sprintf("Source: %v", err))
+		return
+	}
+	defer source.Close()
+
+	cp, err := sim.ReadCardCopy(source)
+	if err != nil {
+		printError(fmt.Sprintf("Failed to read the source card: %v", err))
+		return
+	}
+	config, err := sim.ExportCopyConfig(source)
+	if err != nil {
+		printError(fmt.Sprintf("Failed to read the source card: %v", err))
+		return
+	}
+	printSuccess(fmt.Sprintf("Read %d file(s) from ICCID %s", len(cp.Files), cp.ICCID))
+
+	target, err := connectCopyReader(copyToReader, false)
+	if err != nil {
+		printError(fmt.Sprintf("Target: %v", err))
+		return
+	}
+	defer target.Close()
+
+	report, notCopied, copyErr := sim.WriteCardCopy(target, cp, sim.StoredCredentials(pin1 != ""))
+	if report == nil {
+		printError(fmt.Sprintf("Copy failed: %v", copyErr))
+		return
+	}
+	result := copyResult{Source: cp.ICCID, Report: report, NotCopied: append(cp.NotCopied, notCopied...)}
+
+	// Summary diff: the source as a config, verified on the target
+	if !dryRun {
+		if result.Diff, err = sim.VerifyConfig(target, config); err != nil {
+			printWarning(fmt.Sprintf("Summary diff not available: %v", err))
+		}
+	}
+
+	if outputJSON {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		printDocument(data)
+	} else {
+		output.PrintApplyReport(report)
+		output.PrintNotCopied(result.NotCopied)
+		if result.Diff != nil {
+			output.PrintVerifyReport(result.Diff)
+		}
+	}
+	if copyErr != nil {
+		printError(fmt.Sprintf("Copy incomplete: %v", copyErr))
+	} else if result.Diff != nil && !result.Diff.OK() {
+		printWarning("Source and target still differ, see the summary above")
+	}
+}
+
+// connectCopyReader connects the reader at index. The target uses the credential flags;
+// the source gets --copy-from-pin1 and no ADM keys or PIN2, so the target credentials are
+// never presented to it, and is read-only.
+func connectCopyReader(index int, source bool) (*card.Reader, error) {
+	savedIndex, savedPIN1, savedPIN2 := readerIndex, pin1, pin2
+	savedADM := [4]string{admKey, admKey2, admKey3, admKey4}
+	savedExpect := [2]string{expectICCID, expectIMSI}
+	savedATRPattern := expectATRPattern
+	defer func() {
+		readerIndex, pin1, pin2 = savedIndex, savedPIN1, savedPIN2
+		admKey, admKey2, admKey3, admKey4 = savedADM[0], savedADM[1], savedADM[2], savedADM[3]
+		expectICCID, expectIMSI, expectATRPattern = savedExpect[0], savedExpect[1], savedATRPattern
+	}()
+
+	readerIndex = index
+	role := "Target"
+	if source {
+		role = "Source"
+		pin1, pin2 = copyFromPIN1, ""
+		admKey, admKey2, admKey3, admKey4 = "", "", "", ""
+		// --expect-* describe the target card
+		expectICCID, expectIMSI, expectATRPattern = "", "", nil
+	}
+	printSuccess(fmt.Sprintf("%s card (reader %d)", role, index))
+	reader, err := connectAndPrepareReader()
+	if err != nil {
+		return nil, err
+	}
+	if source {
+		reader.SetReadOnly(true)
+	}
+	return reader, nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ CARD COPY TESTS ============
+
+func TestWrite_CardCopy(t *testing.T) {
+	source, target := newTestCard(), newTestCard()
+	target.MF().Children[0].Data = []byte{0x98, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10, 0x32, 0x64, 0xF6}
+	targetUSIM := target.MF().Children[2]
+	targetUSIM.Children[0].Data = bytes.Repeat([]byte{0xFF}, 9)
+	target.Keys[0x01] = []byte{'1', '2', '3', '4', 0xFF, 0xFF, 0xFF, 0xFF}
+	for _, f := range targetUSIM.Children {
+		f.Security = []byte{0x30, 0x00, 0x00} // writable without ADM
+	}
+	cards := map[int]*card.MockCard{0: source, 1: target}
+
+	var connected []int
+	openReader = func(index int, _ ...card.ConnectOption) (*card.Reader, error) {
+		connected = append(connected, index)
+		m := cards[index]
+		return card.NewReaderWithTransport("Mock Reader", m.ATR, m), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		copyFromReader, copyToReader, pin1 = -1, -1, ""
+		outputJSON = false
+	}()
+
+	stdout, _ := runCapture(t, "write", "--copy-from-reader", "0", "--copy-to-reader", "1", "-p", "1234", "--json")
+	if len(connected) != 2 || connected[0] != 0 || connected[1] != 1 {
+		t.Fatalf("connected readers = %v, want source 0 then target 1", connected)
+	}
+	for _, apdu := range source.Log {
+		if apdu[1] == card.INS_VERIFY {
+			t.Errorf("VERIFY sent to the source: %X", apdu)
+		}
+	}
+
+	var result copyResult
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, stdout)
+	}
+	if result.Source != "8901234567890123456" || result.Report == nil || result.Report.Failed != 0 {
+		t.Fatalf("result = %+v", result)
+	}
+	if got := targetUSIM.Children[0].Data; !bytes.Equal(got, source.MF().Children[2].Children[0].Data) {
+		t.Errorf("target IMSI = %X", got)
+	}
+	if result.Diff == nil || result.Diff.Matched == 0 || result.Diff.Mismatched != 0 {
+		t.Errorf("summary diff = %+v", result.Diff)
+	}
+}
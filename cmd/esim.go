@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -35,6 +37,15 @@ var (
 
 	// esim export flags
 	esimExportOutput string
+	esimRenumber     bool
+
+	// esim export/reformat layout flags
+	esimReformatOutput string
+	esimCanonicalize   bool
+	esimIndent         string
+	esimLineEnding     string
+	esimHexCase        string
+	esimHexWrap        int
 )
 
 var esimCmd = &cobra.Command{
@@ -91,7 +102,7 @@ var esimBuildCmd = &cobra.Command{
 	Short: "Build eSIM profile from config",
 	Long: `Build eSIM profile from JSON configuration and template.
 
-The configuration file (JSON) contains profile parameters: ICCID, IMSI, Ki, OPc,
+The configuration file (JSON or YAML) contains profile parameters: ICCID, IMSI, Ki, OPc,
 ISIM settings, PIN/PUK codes, and optional applet configuration.
 
 Template can be either:
@@ -124,6 +135,56 @@ Examples:
 	Run:  runEsimCompile,
 }
 
+var esimSplitCmd = &cobra.Command{
+	Use:   "split <profile> <outdir>",
+	Short: "Split profile into one ASN.1 Value Notation file per element",
+	Long: `Split an eSIM profile (DER or ASN.1 text) into one Value Notation file per
+profile element (01_header.asn1, 02_mf.asn1, ...) plus manifest.json with the element
+order, valueN numbers and the DER of every element.
+
+Edit the element files, then rebuild the profile with "esim assemble". Elements whose
+file was not edited keep their original encoding byte for byte.
+
+Examples:
+  sim_reader esim split profile.der profile_split/
+  sim_reader esim split profile.asn1 profile_split/`,
+	Args: cobra.ExactArgs(2),
+	Run:  runEsimSplit,
+}
+
+var esimAssembleCmd = &cobra.Command{
+	Use:   "assemble <dir> <new_profile>",
+	Short: "Re-assemble a profile split with \"esim split\"",
+	Long: `Read manifest.json and the element files written by "esim split" and build the profile.
+Mandatory elements (header, mf, end) and the element order are checked.
+
+The output format follows the extension: .der writes DER, anything else ASN.1 Value Notation.
+
+Examples:
+  sim_reader esim assemble profile_split/ new_profile.der
+  sim_reader esim assemble profile_split/ new_profile.asn1`,
+	Args: cobra.ExactArgs(2),
+	Run:  runEsimAssemble,
+}
+
+var esimReformatCmd = &cobra.Command{
+	Use:   "reformat <profile.txt>",
+	Short: "Rewrite ASN.1 Value Notation text with a consistent layout",
+	Long: `Parse an ASN.1 Value Notation profile and write it back. By default the layout of
+the input is kept (line endings, indentation, hex case and wrapping), so a file written
+by the vendor tool comes back byte for byte and edits show up as small diffs.
+
+Layout flags override the detected layout; --canonicalize selects the reference layout
+(LF line endings, two spaces, upper case hex, no wrapping) before the other flags apply.
+
+Examples:
+  sim_reader esim reformat profile.txt -o profile.txt
+  sim_reader esim reformat profile.txt --canonicalize -o canonical.txt
+  sim_reader esim reformat profile.txt --line-ending crlf --hex-wrap 64`,
+	Args: cobra.ExactArgs(1),
+	Run:  runEsimReformat,
+}
+
 var esimExportCmd = &cobra.Command{
 	Use:   "export <profile.der>",
 	Short: "Export DER profile to ASN.1 Value Notation text",
@@ -154,7 +215,7 @@ func init() {
 
 	// esim build flags
 	esimBuildCmd.Flags().StringVarP(&esimConfig, "config", "c", "",
-		"JSON configuration file (required)")
+		"JSON or YAML configuration file (required)")
 	esimBuildCmd.Flags().StringVarP(&esimBuildTpl, "template", "t", "",
 		"Template profile file - DER (.der) or ASN.1 text (.txt, .asn1) (required)")
 	esimBuildCmd.Flags().StringVarP(&esimOutput, "output", "o", "profile.der",
@@ -175,6 +236,24 @@ func init() {
 	// esim export flags
 	esimExportCmd.Flags().StringVarP(&esimExportOutput, "output", "o", "",
 		"Output TXT file (prints to stdout if not specified)")
+	esimExportCmd.Flags().BoolVar(&esimRenumber, "renumber", false,
+		"Rewrite element header identification numbers sequentially")
+
+	// esim reformat flags
+	esimReformatCmd.Flags().StringVarP(&esimReformatOutput, "output", "o", "",
+		"Output TXT file (prints to stdout if not specified)")
+	for _, c := range []*cobra.Command{esimExportCmd, esimReformatCmd} {
+		c.Flags().BoolVar(&esimCanonicalize, "canonicalize", false,
+			"Reference layout: LF line endings, two-space indent, upper case hex, no wrapping")
+		c.Flags().StringVar(&esimIndent, "indent", "",
+			"Indentation per level: a number of spaces or \"tab\"")
+		c.Flags().StringVar(&esimLineEnding, "line-ending", "",
+			"Line endings: crlf or lf")
+		c.Flags().StringVar(&esimHexCase, "hex-case", "",
+			"Case of hex literals: upper or lower")
+		c.Flags().IntVar(&esimHexWrap, "hex-wrap", -1,
+			"Maximum hex digits per line, longer literals continue on the next lines (0: no wrap)")
+	}
 
 	// Register subcommands
 	esimCmd.AddCommand(esimDecodeCmd)
@@ -182,6 +261,9 @@ func init() {
 	esimCmd.AddCommand(esimBuildCmd)
 	esimCmd.AddCommand(esimCompileCmd)
 	esimCmd.AddCommand(esimExportCmd)
+	esimCmd.AddCommand(esimReformatCmd)
+	esimCmd.AddCommand(esimSplitCmd)
+	esimCmd.AddCommand(esimAssembleCmd)
 
 	// Register esim command to root
 	rootCmd.AddCommand(esimCmd)
@@ -234,7 +316,7 @@ func runEsimValidate(cmd *cobra.Command, args []string) {
 
 	if outputJSON {
 		data, _ := json.MarshalIndent(result, "", "  ")
-		fmt.Println(string(data))
+		printDocument(data)
 		return
 	}
 
@@ -357,7 +439,13 @@ func runEsimExport(cmd *cobra.Command, args []string) {
 	}
 
 	// Generate ASN.1 Value Notation text
-	text := esim.GenerateValueNotation(profile)
+	opts, err := esimGeneratorOptions(esim.GeneratorOptions{})
+	if err != nil {
+		output.PrintError(err.Error())
+		os.Exit(1)
+	}
+	opts.Renumber = esimRenumber
+	text := esim.GenerateValueNotationWithOptions(profile, opts)
 
 	if esimExportOutput == "" {
 		// Print to stdout
@@ -374,6 +462,121 @@ func runEsimExport(cmd *cobra.Command, args []string) {
 	}
 }
 
+func runEsimReformat(cmd *cobra.Command, args []string) {
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to read profile: %v", err))
+		os.Exit(1)
+	}
+	text := string(data)
+	profile, err := esim.ParseValueNotation(text)
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to parse ASN.1 Value Notation: %v", err))
+		os.Exit(1)
+	}
+
+	opts, err := esimGeneratorOptions(esim.DetectGeneratorOptions(text))
+	if err != nil {
+		output.PrintError(err.Error())
+		os.Exit(1)
+	}
+	formatted := esim.GenerateValueNotationWithOptions(profile, opts)
+
+	if esimReformatOutput == "" {
+		fmt.Print(formatted)
+		return
+	}
+	if err := os.WriteFile(esimReformatOutput, []byte(formatted), 0644); err != nil {
+		output.PrintError(fmt.Sprintf("Failed to save text file: %v", err))
+		os.Exit(1)
+	}
+	if formatted == text {
+		output.PrintSuccess(fmt.Sprintf("Reformatted to: %s (unchanged)", esimReformatOutput))
+		return
+	}
+	output.PrintSuccess(fmt.Sprintf("Reformatted to: %s", esimReformatOutput))
+}
+
+// esimGeneratorOptions applies --canonicalize and the layout flags to base (the layout
+// detected from the input, or the default)
+func esimGeneratorOptions(base esim.GeneratorOptions) (esim.GeneratorOptions, error) {
+	opts := base
+	if esimCanonicalize {
+		opts = esim.CanonicalGeneratorOptions()
+	}
+	switch strings.ToLower(esimIndent) {
+	case "":
+	case "tab":
+		opts.Indent = "\t"
+	default:
+		n, err := strconv.Atoi(esimIndent)
+		if err != nil || n < 1 || n > 8 {
+			return opts, fmt.Errorf("invalid --indent %q: expected 1-8 spaces or tab", esimIndent)
+		}
+		opts.Indent = strings.Repeat(" ", n)
+	}
+	switch strings.ToLower(esimLineEnding) {
+	case "":
+	case "crlf":
+		opts.LineEnding = "\r\n"
+	case "lf":
+		opts.LineEnding = "\n"
+	default:
+		return opts, fmt.Errorf("invalid --line-ending %q: expected crlf or lf", esimLineEnding)
+	}
+	switch strings.ToLower(esimHexCase) {
+	case "":
+	case "upper":
+		opts.LowerHex = false
+	case "lower":
+		opts.LowerHex = true
+	default:
+		return opts, fmt.Errorf("invalid --hex-case %q: expected upper or lower", esimHexCase)
+	}
+	if esimHexWrap >= 0 {
+		opts.HexWrap = esimHexWrap
+	}
+	return opts, nil
+}
+
+func runEsimSplit(cmd *cobra.Command, args []string) {
+	profile, err := esim.LoadTemplate(args[0])
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to load profile: %v", err))
+		os.Exit(1)
+	}
+
+	if err := esim.SplitProfile(profile, args[1]); err != nil {
+		output.PrintError(fmt.Sprintf("Failed to split profile: %v", err))
+		os.Exit(1)
+	}
+	output.PrintSuccess(fmt.Sprintf("Split %d elements into: %s", len(profile.Elements), args[1]))
+}
+
+func runEsimAssemble(cmd *cobra.Command, args []string) {
+	dir, outPath := args[0], args[1]
+
+	profile, err := esim.AssembleProfile(dir)
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to assemble profile: %v", err))
+		os.Exit(1)
+	}
+
+	if strings.EqualFold(filepath.Ext(outPath), ".der") {
+		err = esim.SaveProfile(profile, outPath)
+	} else {
+		err = esim.GenerateValueNotationFile(profile, outPath)
+	}
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to save profile: %v", err))
+		os.Exit(1)
+	}
+
+	output.PrintSuccess(fmt.Sprintf("Assembled profile saved to: %s", outPath))
+	output.PrintSuccess(fmt.Sprintf("ICCID: %s", profile.GetICCID()))
+	output.PrintSuccess(fmt.Sprintf("Elements: %d", len(profile.Elements)))
+}
+
 func printProfileSummary(p *esim.Profile, verbose bool) {
 	fmt.Println(p.Summary())
 
@@ -501,7 +704,7 @@ func printProfileJSON(p *esim.Profile) {
 	data["elements"] = elements
 
 	jsonData, _ := json.MarshalIndent(data, "", "  ")
-	fmt.Println(string(jsonData))
+	printDocument(jsonData)
 }
 
 func printValidationResult(r *esim.ValidationResult) {
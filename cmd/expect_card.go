@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/inputs"
+	"sim_reader/sim"
+)
+
+var (
+	// Expected card guard (--expect-iccid, --expect-imsi, --expect-atr): the session stops
+	// right after connecting when the inserted card is a different one
+	expectICCID string
+	expectIMSI  string
+	expectATR   string
+
+	// expectATRPattern is --expect-atr parsed in PersistentPreRunE
+	expectATRPattern *card.ATRPattern
+)
+
+// parseExpectFlags validates the expected card flags before anything is sent to the card
+func parseExpectFlags() error {
+	expectATRPattern = nil
+	if expectICCID != "" {
+		iccid, err := inputs.ICCID("--expect-iccid", expectICCID)
+		if errors.Is(err, inputs.ErrLuhn) {
+			// Compared, not written: a test card may carry an ICCID without a valid check digit
+			printWarning(err.Error())
+		} else if err != nil {
+			return err
+		}
+		expectICCID = iccid
+	}
+	if expectIMSI != "" {
+		imsi, err := inputs.IMSI("--expect-imsi", expectIMSI)
+		if err != nil {
+			return err
+		}
+		expectIMSI = imsi
+	}
+	if expectATR != "" {
+		p, err := card.ParseATRPattern(expectATR)
+		if err != nil {
+			return fmt.Errorf("--expect-atr: %w", err)
+		}
+		expectATRPattern = p
+	}
+	return nil
+}
+
+// checkExpectedCard compares the ATR and the ICCID of the connected card with --expect-atr
+// and --expect-iccid. It runs before any PIN or ADM key is presented, so a wrong card never
+// sees a verification attempt.
+func checkExpectedCard(reader *card.Reader) error {
+	if expectATRPattern != nil {
+		if !expectATRPattern.Match(reader.ATR()) {
+			return fmt.Errorf("wrong card: expected ATR %s, found %s", expectATRPattern, reader.ATRHex())
+		}
+		printSuccess(fmt.Sprintf("Expected card: ATR matches %s", expectATRPattern))
+	}
+	if expectICCID == "" {
+		return nil
+	}
+	iccid, err := sim.ReadICCIDQuick(reader)
+	if err == nil && iccid == "" {
+		err = fmt.Errorf("EF_ICCID is empty")
+	}
+	if err != nil {
+		return fmt.Errorf("cannot confirm --expect-iccid %s: ICCID not readable (%v)", expectICCID, err)
+	}
+	if !strings.EqualFold(iccid, expectICCID) {
+		return fmt.Errorf("wrong card: expected ICCID %s, found %s", expectICCID, iccid)
+	}
+	printSuccess(fmt.Sprintf("Expected card: ICCID %s", iccid))
+	return nil
+}
+
+// checkExpectedIMSI compares EF_IMSI with --expect-imsi. It is tried after PIN1 and, when
+// the IMSI was not readable yet, once more after the ADM keys (final); only then an
+// unreadable IMSI stops the session. Returns whether the IMSI has been confirmed.
+func checkExpectedIMSI(reader *card.Reader, final bool) (bool, error) {
+	if expectIMSI == "" {
+		return true, nil
+	}
+	sim.DetectApplicationAIDs(reader)
+	imsi, err := sim.ReadIMSIQuick(reader)
+	if err != nil {
+		if !final {
+			return false, nil
+		}
+		return false, fmt.Errorf("cannot confirm --expect-imsi %s: IMSI not readable (%v); give --pin or the ADM key that grants the read", expectIMSI, err)
+	}
+	if imsi != expectIMSI {
+		return false, fmt.Errorf("wrong card: expected IMSI %s, found %s", expectIMSI, imsi)
+	}
+	printSuccess(fmt.Sprintf("Expected card: IMSI %s", imsi))
+	return true, nil
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// ============ EXPECTED CARD TESTS ============
+
+// connectExpect connects the test card with the given --expect-* values and ADM key
+func connectExpect(t *testing.T, mock *card.MockCard, iccid, imsi, atr, adm string) error {
+	t.Helper()
+	openReader = func(int, ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock), nil
+	}
+	savedIndex := readerIndex
+	readerIndex, admKey = 0, adm
+	expectICCID, expectIMSI, expectATR = iccid, imsi, atr
+	t.Cleanup(func() {
+		openReader = card.Connect
+		readerIndex, admKey = savedIndex, ""
+		expectICCID, expectIMSI, expectATR, expectATRPattern = "", "", "", nil
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	})
+
+	if err := parseExpectFlags(); err != nil {
+		return err
+	}
+	reader, err := connectAndPrepareReader()
+	if reader != nil {
+		reader.Close()
+	}
+	return err
+}
+
+// sentVerify reports whether a VERIFY (PIN or ADM) reached the card
+func sentVerify(mock *card.MockCard) bool {
+	for _, apdu := range mock.Log {
+		if len(apdu) > 1 && apdu[1] == 0x20 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestExpectCard_Match(t *testing.T) {
+	mock := newTestCard()
+	iccid := sim.DecodeICCID(mock.MF().Children[0].Data)
+
+	err := connectExpect(t, mock, iccid, "001010000000001", "3B 9F 96 80 1F C7 80 31 E0 73 .. .. .. .. .. .. .. .. .. .. .. 5B", "")
+	if err != nil {
+		t.Fatalf("connect with the expected card: %v", err)
+	}
+}
+
+func TestExpectCard_WrongICCID(t *testing.T) {
+	mock := newTestCard()
+
+	err := connectExpect(t, mock, "8970000000000000001", "", "", "12345678")
+	if err == nil || !strings.Contains(err.Error(), "expected ICCID 8970000000000000001, found "+sim.DecodeICCID(mock.MF().Children[0].Data)) {
+		t.Fatalf("err = %v, want the expected and found ICCID", err)
+	}
+	if sentVerify(mock) {
+		t.Error("the ADM key was presented to the wrong card")
+	}
+}
+
+func TestExpectCard_WrongIMSI(t *testing.T) {
+	mock := newTestCard()
+
+	err := connectExpect(t, mock, "", "250880000000001", "", "")
+	if err == nil || !strings.Contains(err.Error(), "expected IMSI 250880000000001, found 001010000000001") {
+		t.Fatalf("err = %v, want the expected and found IMSI", err)
+	}
+}
+
+func TestExpectCard_WrongATR(t *testing.T) {
+	mock := newTestCard()
+
+	err := connectExpect(t, mock, "", "", "3B 9F 95 ..", "12345678")
+	if err == nil || !strings.Contains(err.Error(), "expected ATR 3B 9F 95 ..") {
+		t.Fatalf("err = %v, want the ATR mismatch", err)
+	}
+	if sentVerify(mock) {
+		t.Error("the ADM key was presented to the wrong card")
+	}
+}
+
+func TestParseExpectFlags(t *testing.T) {
+	defer func() { expectICCID, expectIMSI, expectATR, expectATRPattern = "", "", "", nil }()
+
+	for _, tc := range []struct {
+		iccid, imsi, atr string
+		wantErr          bool
+	}{
+		{"8949 0000 1234 5678 901", "", "", false},
+		{"89ABC", "", "", true},
+		{"", "12345", "", true},
+		{"", "", "3B 9G", true},
+		{"", "", "3B 9X ..", false},
+	} {
+		expectICCID, expectIMSI, expectATR = tc.iccid, tc.imsi, tc.atr
+		if err := parseExpectFlags(); (err != nil) != tc.wantErr {
+			t.Errorf("parseExpectFlags(%q, %q, %q) error = %v, wantErr %v", tc.iccid, tc.imsi, tc.atr, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"sim_reader/card"
+	"sim_reader/export"
+	"sim_reader/sim"
+)
+
+var (
+	// Core network subscriber export flags (read and write)
+	exportCoreFormat string
+	exportCoreFile   string
+	coreKi           string
+	coreOP           string
+	coreOPc          string
+	coreAMF          string
+	coreSQN          string
+)
+
+// addExportCoreFlags registers the --export-core flags on a command
+func addExportCoreFlags(c *cobra.Command) {
+	c.Flags().StringVar(&exportCoreFormat, "export-core", "",
+		"Append the subscriber record for the core network to --export-core-file: "+strings.Join(export.Formats, ", "))
+	c.Flags().StringVar(&exportCoreFile, "export-core-file", "",
+		"Subscriber export file (appended, so a batch of cards ends up in one file)")
+	c.Flags().StringVar(&coreKi, "core-ki", "",
+		"Ki for --export-core (default: ki from the config file)")
+	c.Flags().StringVar(&coreOP, "core-op", "",
+		"OP for --export-core (default: op from the config file)")
+	c.Flags().StringVar(&coreOPc, "core-opc", "",
+		"OPc for --export-core (default: opc from the config file)")
+	c.Flags().StringVar(&coreAMF, "core-amf", export.DefaultAMF,
+		"AMF for --export-core")
+	c.Flags().StringVar(&coreSQN, "core-sqn", export.DefaultSQN,
+		"Initial SQN for --export-core (12 hex chars)")
+}
+
+// checkExportCoreFlags validates the export flags before the card is touched
+func checkExportCoreFlags() error {
+	if exportCoreFormat == "" {
+		return nil
+	}
+	if !slices.Contains(export.Formats, exportCoreFormat) {
+		return fmt.Errorf("invalid --export-core %q: use %s", exportCoreFormat, strings.Join(export.Formats, ", "))
+	}
+	if exportCoreFile == "" {
+		return fmt.Errorf("--export-core requires --export-core-file")
+	}
+	return nil
+}
+
+// exportCoreSubscriber appends the subscriber record of the card to --export-core-file.
+// IMSI, ICCID and MSISDN are taken from the card; keys from the flags, then from config
+// (the write config, nil for read). expectIMSI is the IMSI that was written: a card that
+// does not hold it is not exported.
+func exportCoreSubscriber(usim *sim.USIMData, config *sim.SIMConfig, expectIMSI string) {
+	if exportCoreFormat == "" {
+		return
+	}
+	if usim == nil || usim.IMSI == "" {
+		printError("Core export: IMSI could not be read from the card")
+		return
+	}
+	if expectIMSI != "" && expectIMSI != usim.IMSI {
+		printError(fmt.Sprintf("Core export skipped: card IMSI %s does not match the written IMSI %s", usim.IMSI, expectIMSI))
+		return
+	}
+
+	s := &export.Subscriber{
+		ICCID:  usim.ICCID,
+		IMSI:   usim.IMSI,
+		MSISDN: usim.MSISDN,
+		MCC:    usim.MCC,
+		MNC:    usim.MNC,
+		K:      coreKi,
+		OP:     coreOP,
+		OPc:    coreOPc,
+		AMF:    coreAMF,
+		SQN:    coreSQN,
+	}
+	if config != nil && s.K == "" {
+		s.K = config.Ki
+	}
+	if config != nil && s.OP == "" && s.OPc == "" {
+		s.OP, s.OPc = config.OP, config.OPc
+	}
+
+	if err := export.AppendFile(exportCoreFile, exportCoreFormat, s); err != nil {
+		printError(fmt.Sprintf("Core export failed: %v", err))
+		return
+	}
+	printSuccess(fmt.Sprintf("Subscriber %s appended to %s (%s)", s.IMSI, exportCoreFile, exportCoreFormat))
+}
+
+// exportCoreAfterWrite reads the card back after writing and exports the subscriber, checking
+// the card IMSI against the config or --imsi. applied is the config that was written (with
+// the keys derived by k_derivation); nil loads the -f config file.
+func exportCoreAfterWrite(reader *card.Reader, applied *sim.SIMConfig) {
+	if exportCoreFormat == "" {
+		return
+	}
+	if dryRun {
+		printWarning("Dry run: core export skipped, nothing was written")
+		return
+	}
+
+	config := applied
+	expectIMSI := writeIMSI
+	if config != nil && expectIMSI == "" {
+		expectIMSI = config.IMSI
+	}
+	if config == nil && writeConfigFile != "" {
+		c, err := sim.LoadConfig(writeConfigFile)
+		if err != nil {
+			printError(fmt.Sprintf("Core export: %v", err))
+			return
+		}
+		config = c
+		if expectIMSI == "" {
+			expectIMSI = c.IMSI
+		}
+	}
+
+	usim, err := sim.ReadUSIM(reader)
+	if err != nil {
+		printError(fmt.Sprintf("Core export: USIM read failed: %v", err))
+		return
+	}
+	exportCoreSubscriber(usim, config, expectIMSI)
+}
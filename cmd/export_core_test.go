@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// ============ CORE EXPORT TESTS ============
+
+func TestReadExportCore_AppendsCSV(t *testing.T) {
+	mock := newTestCard()
+	openReader = func(int, ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		outputJSON = false
+		exportCoreFormat, exportCoreFile, coreKi, coreOPc = "", "", "", ""
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	}()
+
+	out := filepath.Join(t.TempDir(), "subs.csv")
+	args := []string{"read", "-r", "0", "--json", "--export-core", "csv", "--export-core-file", out,
+		"--core-ki", "465B5CE8B199B49FAA5F0A2EE238A6BC", "--core-opc", "cd63cb71954a9f4e48a5994e37a02baf"}
+	runCapture(t, args...)
+	runCapture(t, args...)
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("export file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "iccid,imsi") {
+		t.Fatalf("export = %q, want header and two records", data)
+	}
+	want := "8901234567890123456,001010000000001,,001,01,465B5CE8B199B49FAA5F0A2EE238A6BC,,CD63CB71954A9F4E48A5994E37A02BAF,8000,000000000000"
+	if lines[1] != want || lines[2] != want {
+		t.Errorf("record = %q, want %q", lines[1], want)
+	}
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"sim_reader/card"
+	"sim_reader/output"
+	"sim_reader/sim"
+)
+
+// factoryResetFile is the golden config of --factory-reset
+var factoryResetFile string
+
+// runFactoryReset resets the card to the golden config loaded from path. The reset is
+// previewed in dry-run mode with the ICCID of the card and only runs after typed
+// confirmation; the change summary shows the old and new content of every file written.
+func runFactoryReset(reader *card.Reader, golden *sim.SIMConfig, path string, in io.Reader, out io.Writer) {
+	iccid, err := sim.ReadICCIDQuick(reader)
+	if err != nil {
+		printError(fmt.Sprintf("Failed to read the ICCID: %v", err))
+		return
+	}
+	creds := sim.StoredCredentials(pin1 != "")
+
+	// Preview: the same reset with writes intercepted by the reader
+	printSuccess(fmt.Sprintf("Factory reset of ICCID %s to %s (dry run):", iccid, path))
+	simulated := reader.DryRun()
+	reader.SetDryRun(true)
+	preview, err := sim.FactoryReset(reader, golden, creds)
+	intercepted := reader.DryRunLog()
+	reader.SetDryRun(simulated)
+	if preview == nil {
+		printError(fmt.Sprintf("Factory reset not possible: %v", err))
+		return
+	}
+	printFactoryResetResult(preview)
+	output.PrintDryRunLog(intercepted)
+	if err != nil {
+		printError(fmt.Sprintf("Factory reset cannot be completed: %v", err))
+		return
+	}
+	if simulated {
+		printWarning("--dry-run is set: nothing written")
+		return
+	}
+
+	p := newWizardPrompter(in, out)
+	answer, err := p.ask(fmt.Sprintf("Type '%s' to reset the card with ICCID %s", wizardConfirmWord, iccid), "")
+	if err != nil || answer != wizardConfirmWord {
+		printWarning("Not confirmed, card left unchanged")
+		return
+	}
+
+	reader.SetChangeLog(true)
+	result, err := sim.FactoryReset(reader, golden, creds)
+	if result == nil {
+		printError(fmt.Sprintf("Factory reset failed: %v", err))
+		return
+	}
+	printFactoryResetResult(result)
+	printWriteChanges(reader, result.Apply, nil)
+	if err != nil {
+		printError(fmt.Sprintf("Factory reset incomplete: %v", err))
+		return
+	}
+	printSuccess(fmt.Sprintf("Card %s reset to %s", iccid, path))
+}
+
+// printFactoryResetResult prints the per-file outcome, the invalidated security contexts
+// and the files left alone
+func printFactoryResetResult(result *sim.FactoryResetResult) {
+	output.PrintApplyReport(result.Apply)
+	output.PrintKeyInvalidation(result.Keys)
+	output.PrintNotReset(result.Skipped)
+}
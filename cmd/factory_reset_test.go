@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// ============ FACTORY RESET TESTS ============
+
+func TestRunFactoryReset(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantIMSI string
+	}{
+		{"Confirmed", "yes\n", "001019999999999"},
+		{"Not confirmed", "no\n", "001010000000001"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := newTestCard()
+			reader := card.NewReaderWithTransport("Mock Reader", mock.ATR, mock)
+			sim.DetectApplicationAIDs(reader)
+			defer func() {
+				sim.DetectedUSIM_AID = nil
+				sim.DetectedISIM_AID = nil
+			}()
+
+			var out bytes.Buffer
+			golden := &sim.SIMConfig{IMSI: "001019999999999"}
+			runFactoryReset(reader, golden, "golden.json", strings.NewReader(tc.input), &out)
+
+			if !strings.Contains(out.String(), "Type 'yes' to reset the card with ICCID") {
+				t.Errorf("prompt = %q, want the ICCID confirmation", out.String())
+			}
+			data, err := sim.ReadUSIM(reader)
+			if err != nil {
+				t.Fatalf("ReadUSIM() error = %v", err)
+			}
+			if data.IMSI != tc.wantIMSI {
+				t.Errorf("IMSI = %q, want %q", data.IMSI, tc.wantIMSI)
+			}
+			if reader.DryRun() {
+				t.Errorf("reader left in dry-run mode")
+			}
+		})
+	}
+}
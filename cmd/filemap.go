@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+var (
+	// File map cache flags (read, test)
+	noCache      bool
+	refreshCache bool
+	cacheMaxAge  time.Duration
+)
+
+// addFileMapFlags registers the file map cache flags on a command
+func addFileMapFlags(c *cobra.Command) {
+	c.Flags().BoolVar(&noCache, "no-cache", false,
+		"Do not use or update the per-card file map cache (~/.cache/sim_reader/<iccid>.json)")
+	c.Flags().BoolVar(&refreshCache, "refresh-cache", false,
+		"Ignore the cached file map of the card and save a new one from this run")
+	c.Flags().DurationVar(&cacheMaxAge, "cache-max-age", sim.DefaultFileMapMaxAge,
+		"Discard a cached file map older than this (0 = never expires)")
+}
+
+// activateFileMap loads the cached file map of the card, or starts an empty one, and
+// makes EF selections use it. Returns nil with --no-cache or when the ICCID is unreadable.
+func activateFileMap(reader *card.Reader) *sim.FileMap {
+	if noCache {
+		return nil
+	}
+	iccid, err := sim.ReadICCIDQuick(reader)
+	if err != nil || iccid == "" {
+		return nil
+	}
+
+	var m *sim.FileMap
+	if !refreshCache {
+		m, err = sim.LoadFileMap(iccid, reader.ATRHex(), cacheMaxAge)
+		switch {
+		case err == nil:
+			if !outputJSON {
+				printSuccess(fmt.Sprintf("Using cached file map: %d file(s), updated %s", m.Files(), m.Updated))
+			}
+		case errors.Is(err, os.ErrNotExist):
+		case errors.Is(err, sim.ErrFileMapStale):
+			if !outputJSON {
+				printWarning(fmt.Sprintf("Cached file map discarded (%v), rebuilding", err))
+			}
+		default:
+			printWarning(fmt.Sprintf("Cached file map ignored: %v", err))
+		}
+	}
+	if m == nil {
+		m = sim.NewFileMap(iccid, reader.ATRHex())
+	}
+	sim.UseFileMap(m)
+	return m
+}
+
+// finishFileMap stops using m and, when save is set (analyze/export) or the map was
+// refreshed, writes what this run learned to the cache
+func finishFileMap(m *sim.FileMap, save bool) {
+	if m == nil {
+		return
+	}
+	sim.UseFileMap(nil)
+	if !refreshCache && !(save && m.Changed()) {
+		return
+	}
+	path, err := m.Save()
+	if err != nil {
+		printWarning(fmt.Sprintf("File map cache not saved: %v", err))
+		return
+	}
+	if !outputJSON {
+		printSuccess(fmt.Sprintf("File map saved to %s (%d file(s), %d selection(s) skipped)", path, m.Files(), m.Skipped()))
+	}
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"sim_reader/card"
+)
+
+// writeFixtureDump saves the APDU fixture recorded during the read (--dump NAME --dump-format
+// fixture) to NAME, or NAME.json when NAME has no extension
+func writeFixtureDump(reader *card.Reader) {
+	fixture := reader.Fixture()
+	if fixture == nil {
+		printError("Fixture dump: recording was not enabled for this reader")
+		return
+	}
+	fixture.Source = reader.Name()
+	fixture.Created = time.Now().Format(time.RFC3339)
+
+	path := dumpTestData
+	if filepath.Ext(path) == "" {
+		path += ".json"
+	}
+	if err := card.SaveFixture(path, fixture); err != nil {
+		printError(fmt.Sprintf("Fixture dump failed: %v", err))
+		return
+	}
+
+	protected := 0
+	for _, f := range fixture.Files {
+		if f.Requires != "" {
+			protected++
+		}
+	}
+	printSuccess(fmt.Sprintf("Fixture with %d file(s) (%d needing a key) written to %s", len(fixture.Files), protected, path))
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"sim_reader/card"
+	"sim_reader/output"
+	"sim_reader/sim"
+)
+
+var (
+	// Read-only diagnostics flags (read)
+	fuzzSelect bool
+	fuzzRate   int
+	stressLoop int
+)
+
+// interruptContext is cancelled on Ctrl-C / SIGTERM so long scans stop and save what they have
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// saveDiagnosticReport writes report as JSON to <prefix>-<time>.json and returns the path
+func saveDiagnosticReport(prefix string, report any) (string, error) {
+	path := fmt.Sprintf("%s-%s.json", prefix, time.Now().Format("20060102-150405"))
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// runFuzzSelect maps the FIDs of the MF, DF_TELECOM, DF_GSM and the applications
+func runFuzzSelect(reader *card.Reader) bool {
+	ctx, stop := interruptContext()
+	defer stop()
+
+	opts := sim.FuzzOptions{Rate: fuzzRate}
+	if !outputJSON {
+		printSuccess("Sending SELECT for FIDs 0000-FFFF in each directory (read-only, Ctrl-C stops and saves)...")
+		opts.Progress = func(target string, fid uint16) {
+			if fid%0x1000 == 0 {
+				fmt.Printf("  %s: %04X / FFFF\n", target, fid)
+			}
+		}
+	}
+	report, err := sim.FuzzSelect(ctx, reader, opts)
+	return finishDiagnostic("fuzz-select", report, err, func() { output.PrintFuzzSelectReport(report) }) &&
+		report.Error == ""
+}
+
+// runStressLoop repeats the standard read and reports the iterations that differ
+func runStressLoop(reader *card.Reader) bool {
+	ctx, stop := interruptContext()
+	defer stop()
+
+	if !outputJSON {
+		printSuccess(fmt.Sprintf("Repeating the USIM/ISIM read %d times (read-only, Ctrl-C stops and saves)...", stressLoop))
+	}
+	report, err := sim.StressLoop(ctx, reader, stressLoop, sim.StandardRead)
+	if report == nil {
+		printError(err.Error())
+		return false
+	}
+	return finishDiagnostic("stress-loop", report, err, func() { output.PrintStressReport(report) }) &&
+		len(report.Divergent) == 0
+}
+
+// finishDiagnostic saves and prints a (possibly partial) diagnostic report
+func finishDiagnostic(prefix string, report any, runErr error, print func()) bool {
+	path, saveErr := saveDiagnosticReport(prefix, report)
+	if outputJSON {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		printDocument(data)
+	} else {
+		print()
+	}
+	if runErr != nil {
+		printError(runErr.Error())
+	}
+	if saveErr != nil {
+		printError(fmt.Sprintf("Failed to save report: %v", saveErr))
+		return false
+	}
+	printSuccess(fmt.Sprintf("Report saved to %s", path))
+	return runErr == nil
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"crypto/rand"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
 
 	"sim_reader/card"
+	"sim_reader/inputs"
 	"sim_reader/output"
 	"sim_reader/sim"
 )
@@ -29,6 +31,11 @@ var (
 	gpDMSIMSI    string
 	gpDMSKeyset  string
 	gpAuto       bool
+	gpBlockSize  int
+	gpDiv        string
+
+	// GP probe flags
+	gpProbeVerbose bool
 
 	// GP delete flags
 	gpDeleteAIDs string
@@ -38,6 +45,13 @@ var (
 	gpPackageAID  string
 	gpAppletAID   string
 	gpInstanceAID string
+	gpTargetSDAID string
+	gpLoadHash    string
+	gpLoadFormat  string
+	gpDAPFile     string
+	gpDAPAID      string
+	gpPrivileges  string
+	gpInstallParams string
 
 	// GP verify flags
 	gpVerifyAID string
@@ -47,6 +61,17 @@ var (
 	gpAramRuleAID  string
 	gpAramCertHash string
 	gpAramPerm     string
+
+	// GP registry flags
+	gpExportRegistry string
+	gpApplyRegistry  string
+
+	// GP STORE DATA flags
+	gpStoreDataSpec   string
+	gpStoreDataFormat string
+
+	// GP life cycle flags
+	gpUnlockCard bool
 )
 
 var gpCmd = &cobra.Command{
@@ -87,13 +112,18 @@ var gpProbeCmd = &cobra.Command{
 	Long: `Probe GlobalPlatform keys: performs INITIALIZE UPDATE and verifies
 card cryptogram, but does NOT send EXTERNAL AUTH (safe, no counter decrement).
 
+On failure the KVN and protocol reported by the card are printed, telling a wrong
+--kvn from wrong keys; -v also prints the decoded INITIALIZE UPDATE response.
+
 Examples:
-  sim_reader gp probe --key-enc AABBCC... --key-mac DDEEFF... --kvn 0`,
+  sim_reader gp probe --key-enc AABBCC... --key-mac DDEEFF... --kvn 0
+  sim_reader gp probe --key-psk AABBCC... --kvn 32 -v`,
 	Run: runGPProbe,
 }
 
 var gpDeleteCmd = &cobra.Command{
 	Use:   "delete",
+	Annotations: writeAccess,
 	Short: "Delete applets/packages by AID",
 	Long: `Delete GlobalPlatform objects by AID. DANGEROUS - may brick card!
 
@@ -104,6 +134,7 @@ Examples:
 
 var gpLoadCmd = &cobra.Command{
 	Use:   "load",
+	Annotations: writeAccess,
 	Short: "Load and install CAP file",
 	Long: `Load CAP file and install applet. DANGEROUS - modifies card!
 
@@ -111,12 +142,19 @@ Examples:
   sim_reader gp load --cap /path/to/applet.cap \
     --package-aid A0000005591010FFFFFFFF8900 \
     --applet-aid A0000005591010FFFFFFFF89000100 \
+    --key-enc X --key-mac Y
+
+  # Load into a Supplementary Security Domain with an operator DAP signature
+  sim_reader gp load --cap applet.cap --package-aid ... --applet-aid ... \
+    --gp-target-sd-aid A000000151535041 \
+    --gp-dap-file sig.bin --gp-dap-aid A000000151535041 \
     --key-enc X --key-mac Y`,
 	Run: runGPLoad,
 }
 
 var gpAramCmd = &cobra.Command{
 	Use:   "aram",
+	Annotations: writeAccess,
 	Short: "Add ARA-M access rule",
 	Long: `Add ARA-M (Access Rule Application Manager) access rule via STORE DATA.
 Requires Secure Channel. Used for Android Secure Element access control.
@@ -127,6 +165,63 @@ Examples:
 	Run: runGPAram,
 }
 
+var gpRegistryCmd = &cobra.Command{
+	Use:   "registry",
+	Annotations: writeAccess,
+	Short: "Export or apply the applet registry and ARA-M rules",
+	Long: `Export the GlobalPlatform registry (load files, instances, privileges) and the
+ARA-M access rules of a card to a JSON file, or make another card match such a file.
+
+Apply compares the file with the card and prints the plan before running it:
+instances missing on the card are installed from load files already loaded (CAP
+files that are missing are listed), privileges are updated and missing ARA-M rules
+are stored. Nothing is deleted. With --dry-run only the plan is printed.
+
+Install parameters (C9) cannot be read from a card: they are exported from the
+--profile-store entry written by gp load and marked unknown otherwise.
+
+Examples:
+  sim_reader gp registry --gp-export-registry golden.json --key-enc X --key-mac Y
+  sim_reader gp registry --gp-apply-registry golden.json --key-enc X --key-mac Y --dry-run`,
+	Run: runGPRegistry,
+}
+
+var gpStoreDataCmd = &cobra.Command{
+	Use:   "store-data",
+	Annotations: writeAccess,
+	Short: "Personalize applet via STORE DATA",
+	Long: `Personalize an installed application: INSTALL [for personalization] followed by
+numbered STORE DATA blocks via Secure Channel. Works with --sec mac and mac+enc.
+
+Formats:
+  raw  payload split at block boundaries (no structure hint)
+  dgi  DGI stream (tag 2 bytes, length 1 or FF+2 bytes), whole DGIs packed per block
+  tlv  BER-TLV payload (structure hint only)
+
+Examples:
+  sim_reader gp store-data --data A0000005591010FFFFFFFF89000100:perso.bin \
+    --format dgi --key-enc X --key-mac Y --sec mac+enc`,
+	Run: runGPStoreData,
+}
+
+var gpLifeCycleCmd = &cobra.Command{
+	Use:   "lifecycle",
+	Annotations: writeAccess,
+	Short: "Show the card life cycle or unlock a CARD_LOCKED card",
+	Long: `Show the GlobalPlatform card life cycle of the ISD (OP_READY, INITIALIZED, SECURED,
+CARD_LOCKED, TERMINATED), read from the SELECT response or a plain GET STATUS.
+
+The other gp subcommands detect it too: on a CARD_LOCKED card they print a warning and
+refuse load, delete, store-data, aram and registry apply; on a TERMINATED card every
+operation is refused. --gp-unlock-card sends SET STATUS (80 F0 80 0F) in a Secure
+Channel opened with the ISD keys, taking a CARD_LOCKED card back to SECURED.
+
+Examples:
+  sim_reader gp lifecycle
+  sim_reader gp lifecycle --gp-unlock-card --key-enc X --key-mac Y`,
+	Run: runGPLifeCycle,
+}
+
 var gpVerifyCmd = &cobra.Command{
 	Use:   "verify",
 	Short: "Verify applet AID (SELECT and show SW)",
@@ -165,6 +260,14 @@ func init() {
 		"Keyset name in DMS: cm, psk40, psk41, a..h, auto")
 	gpCmd.PersistentFlags().BoolVar(&gpAuto, "auto", false,
 		"Auto-probe KVN+keyset (requires --dms)")
+	gpCmd.PersistentFlags().IntVar(&gpBlockSize, "gp-block-size", 0,
+		"LOAD/STORE DATA block size in bytes (default: derived from card capabilities, 200 if unknown)")
+	gpCmd.PersistentFlags().StringVar(&gpDiv, "gp-div", "auto",
+		"Key diversification of master keys: visa2, emv-cps, none or auto (try all)")
+
+	// Probe command flags
+	gpProbeCmd.Flags().BoolVarP(&gpProbeVerbose, "verbose", "v", false,
+		"Print the decoded INITIALIZE UPDATE response when the probe fails")
 
 	// Delete command flags
 	gpDeleteCmd.Flags().StringVar(&gpDeleteAIDs, "aids", "",
@@ -172,13 +275,27 @@ func init() {
 
 	// Load command flags
 	gpLoadCmd.Flags().StringVar(&gpLoadCAP, "cap", "",
-		"Path to CAP file (ZIP format)")
+		"Path to the applet: CAP file (ZIP), .ijc load file or expanded CAP directory")
+	gpLoadCmd.Flags().StringVar(&gpLoadFormat, "gp-load-format", "auto",
+		"Format of --cap: auto, cap, ijc, dir")
 	gpLoadCmd.Flags().StringVar(&gpPackageAID, "package-aid", "",
 		"Package (load file) AID (hex)")
 	gpLoadCmd.Flags().StringVar(&gpAppletAID, "applet-aid", "",
 		"Applet class AID (hex)")
 	gpLoadCmd.Flags().StringVar(&gpInstanceAID, "instance-aid", "",
 		"Instance AID (hex, defaults to applet-aid)")
+	gpLoadCmd.Flags().StringVar(&gpTargetSDAID, "gp-target-sd-aid", "",
+		"Security Domain that receives the load file (hex, defaults to --sd-aid; delegated management if different)")
+	gpLoadCmd.Flags().StringVar(&gpLoadHash, "gp-load-hash", "auto",
+		"Load File Data Block hash in INSTALL [for load]: auto, none, sha1, sha256")
+	gpLoadCmd.Flags().StringVar(&gpDAPFile, "gp-dap-file", "",
+		"DAP signature file (binary) sent as E2 DAP block before the load file")
+	gpLoadCmd.Flags().StringVar(&gpDAPAID, "gp-dap-aid", "",
+		"AID of the Security Domain verifying the DAP (hex, defaults to the target SD)")
+	gpLoadCmd.Flags().StringVar(&gpPrivileges, "gp-privileges", "",
+		"Privileges of the instance (hex, 1 or 3 bytes, default none)")
+	gpLoadCmd.Flags().StringVar(&gpInstallParams, "gp-install-params", "",
+		"Install parameters of the instance, sent as C9 (hex)")
 
 	// Verify command flags
 	gpVerifyCmd.Flags().StringVar(&gpVerifyAID, "aid", "",
@@ -194,8 +311,26 @@ func init() {
 	gpAramCmd.Flags().StringVar(&gpAramPerm, "perm", "0000000000000001",
 		"PERM-AR-DO value (hex, commonly 8 bytes)")
 
+	// Registry command flags
+	gpRegistryCmd.Flags().StringVar(&gpExportRegistry, "gp-export-registry", "",
+		"Write the registry and ARA-M rules of the card to a JSON file")
+	gpRegistryCmd.Flags().StringVar(&gpApplyRegistry, "gp-apply-registry", "",
+		"Install instances, privileges and ARA-M rules of a registry file missing on the card")
+	gpRegistryCmd.Flags().StringVar(&gpAramAID, "aram-aid", "A00000015141434C00",
+		"ARA-M applet AID (hex)")
+
 	// Add subcommands
-	gpCmd.AddCommand(gpListCmd, gpProbeCmd, gpDeleteCmd, gpLoadCmd, gpAramCmd, gpVerifyCmd)
+	// Store data flags
+	gpStoreDataCmd.Flags().StringVar(&gpStoreDataSpec, "data", "",
+		"Target and payload as <aid>:file.bin (required)")
+	gpStoreDataCmd.Flags().StringVar(&gpStoreDataFormat, "format", "raw",
+		"Payload format: raw, dgi, tlv")
+
+	// Life cycle command flags
+	gpLifeCycleCmd.Flags().BoolVar(&gpUnlockCard, "gp-unlock-card", false,
+		"Unlock a CARD_LOCKED card: SET STATUS to SECURED with the ISD keys")
+
+	gpCmd.AddCommand(gpListCmd, gpProbeCmd, gpDeleteCmd, gpLoadCmd, gpAramCmd, gpRegistryCmd, gpStoreDataCmd, gpLifeCycleCmd, gpVerifyCmd)
 	rootCmd.AddCommand(gpCmd)
 }
 
@@ -205,6 +340,9 @@ func buildGPConfig(reader *card.Reader) (*sim.GPConfig, error) {
 	var err error
 	var dmsRow map[string]string
 
+	// Flags not given come from the profile store (--profile-store)
+	applyGPProfile()
+
 	// Load from DMS file if provided
 	if gpDMSFile != "" {
 		db, e := sim.LoadDMSKeyDB(gpDMSFile)
@@ -249,30 +387,30 @@ func buildGPConfig(reader *card.Reader) (*sim.GPConfig, error) {
 
 	// PSK convenience (ENC=MAC)
 	if gpKeyPSK != "" {
-		psk, e := sim.ParseHexBytes(gpKeyPSK)
+		psk, e := inputs.HexKey("--key-psk", gpKeyPSK, 16, 24, 32)
 		if e != nil {
-			return nil, fmt.Errorf("invalid --key-psk: %w", e)
+			return nil, e
 		}
 		encKey, macKey = psk, psk
 	}
 
 	// Explicit keys override everything
 	if gpKeyENC != "" {
-		encKey, err = sim.ParseHexBytes(gpKeyENC)
+		encKey, err = inputs.HexKey("--key-enc", gpKeyENC, 16, 24, 32)
 		if err != nil {
-			return nil, fmt.Errorf("invalid --key-enc: %w", err)
+			return nil, err
 		}
 	}
 	if gpKeyMAC != "" {
-		macKey, err = sim.ParseHexBytes(gpKeyMAC)
+		macKey, err = inputs.HexKey("--key-mac", gpKeyMAC, 16, 24, 32)
 		if err != nil {
-			return nil, fmt.Errorf("invalid --key-mac: %w", err)
+			return nil, err
 		}
 	}
 	if gpKeyDEK != "" {
-		dekKey, err = sim.ParseHexBytes(gpKeyDEK)
+		dekKey, err = inputs.HexKey("--key-dek", gpKeyDEK, 16, 24, 32)
 		if err != nil {
-			return nil, fmt.Errorf("invalid --key-dek: %w", err)
+			return nil, err
 		}
 	}
 
@@ -281,9 +419,14 @@ func buildGPConfig(reader *card.Reader) (*sim.GPConfig, error) {
 		return nil, err
 	}
 
-	sdAID, err := sim.ParseAIDHex(gpSDAID)
+	sdAID, err := inputs.AID("--sd-aid", gpSDAID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid --sd-aid: %w", err)
+		return nil, err
+	}
+
+	div, err := card.ParseDivScheme(gpDiv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --gp-div: %w", err)
 	}
 
 	cfg := &sim.GPConfig{
@@ -293,9 +436,13 @@ func buildGPConfig(reader *card.Reader) (*sim.GPConfig, error) {
 			ENC: encKey,
 			MAC: macKey,
 			DEK: dekKey,
+			Div: div,
 		},
 		SDAID:     sdAID,
-		BlockSize: 200,
+		BlockSize: reader.Capabilities().GPBlockSize(),
+	}
+	if gpBlockSize > 0 {
+		cfg.BlockSize = gpBlockSize
 	}
 
 	// Auto-probe if requested
@@ -340,22 +487,36 @@ func buildGPConfig(reader *card.Reader) (*sim.GPConfig, error) {
 		for _, candSDAID := range sdCandidates {
 			_, _ = reader.Select(candSDAID)
 
+			// The default key set of the card gives the protocol and the KVN to try first
+			cardKVNs, hostChallengeLen := kvnList, 8
+			cardInfo, infoErr := gpCardInfo(reader)
+			if infoErr == nil {
+				printSuccess(fmt.Sprintf("GP auto: card reports KVN %d, %s (sd-aid=%X)", cardInfo.KVN, cardInfo.Protocol(), candSDAID))
+				cardKVNs = preferKVN(kvnList, int(cardInfo.KVN))
+				hostChallengeLen = cardInfo.HostChallengeLen()
+			}
+
 			for _, ks := range keysets {
 				enc, mac, dek, e := sim.GPKeysFromDMS(dmsRow, ks)
 				if e != nil {
 					continue
 				}
-				for _, kvn := range kvnList {
-					hostChallenge := make([]byte, 8)
+				// Skip keysets that cannot work with the protocol of the card
+				if cardInfo != nil && cardInfo.CheckKeys(card.GPKeySet{ENC: enc, MAC: mac, Div: div}) != nil {
+					continue
+				}
+				for _, kvn := range cardKVNs {
+					hostChallenge := make([]byte, hostChallengeLen)
 					if _, e := rand.Read(hostChallenge); e != nil {
 						return nil, fmt.Errorf("failed to generate host challenge: %w", e)
 					}
-					e = card.ProbeSecureChannelAuto(reader, card.GPKeySet{ENC: enc, MAC: mac, DEK: dek}, byte(kvn), hostChallenge)
+					matched, e := card.ProbeSecureChannelDiv(reader, card.GPKeySet{ENC: enc, MAC: mac, DEK: dek, Div: div}, byte(kvn), hostChallenge)
 					if e == nil {
 						cfg.KVN = byte(kvn)
 						cfg.SDAID = candSDAID
-						cfg.StaticKeys = card.GPKeySet{ENC: enc, MAC: mac, DEK: dek}
-						printSuccess(fmt.Sprintf("GP auto matched: keyset=%s kvn=%d sd-aid=%X", ks, kvn, candSDAID))
+						cfg.StaticKeys = card.GPKeySet{ENC: enc, MAC: mac, DEK: dek, Div: matched}
+						printSuccess(fmt.Sprintf("GP auto matched: keyset=%s kvn=%d sd-aid=%X div=%s", ks, kvn, candSDAID, matched))
+						recordGPProfile(cfg, ks, matched)
 						found = true
 						break
 					}
@@ -389,6 +550,9 @@ func runGPList(cmd *cobra.Command, args []string) {
 		return
 	}
 	defer reader.Close()
+	if !checkGPCardState(reader, "list", sim.GPOpRead) {
+		return
+	}
 
 	cfg, err := buildGPConfig(reader)
 	if err != nil {
@@ -402,6 +566,7 @@ func runGPList(cmd *cobra.Command, args []string) {
 		printError(fmt.Sprintf("GP list failed: %v", err))
 		return
 	}
+	recordGPProfile(cfg, gpKeysetName(), cfg.StaticKeys.Div)
 	output.PrintApplets(applets)
 }
 
@@ -412,6 +577,9 @@ func runGPProbe(cmd *cobra.Command, args []string) {
 		return
 	}
 	defer reader.Close()
+	if !checkGPCardState(reader, "probe", sim.GPOpRead) {
+		return
+	}
 
 	cfg, err := buildGPConfig(reader)
 	if err != nil {
@@ -430,14 +598,33 @@ func runGPProbe(cmd *cobra.Command, args []string) {
 		_, _ = reader.Select(cfg.SDAID)
 	}
 
-	if err := card.ProbeSecureChannelAuto(reader, cfg.StaticKeys, cfg.KVN, hostChallenge); err != nil {
+	matched, err := card.ProbeSecureChannelDiv(reader, cfg.StaticKeys, cfg.KVN, hostChallenge)
+	if err != nil {
 		printError(fmt.Sprintf("GP probe failed: %v", err))
+		explainGPProbeFailure(reader, cfg.KVN, cfg.StaticKeys, err)
+		return
+	}
+	recordGPProfile(cfg, gpKeysetName(), matched)
+	if matched != card.DivNone {
+		printSuccess(fmt.Sprintf("GP probe OK: keys/KVN match this card (key diversification: %s)", matched))
 		return
 	}
 	printSuccess("GP probe OK: keys/KVN match this card")
 }
 
+// refuseInDryRun reports a state-changing GP operation that was not run because of --dry-run.
+// GP commands cannot be simulated: each depends on the card state left by the previous one.
+func refuseInDryRun(op string, skipped []string) {
+	printWarning(fmt.Sprintf("Dry run: GP %s refused, nothing was sent to the card", op))
+	for _, c := range skipped {
+		fmt.Printf("  - skipped %s\n", c)
+	}
+}
+
 func runGPDelete(cmd *cobra.Command, args []string) {
+	if refuseReadOnly("GP delete") {
+		return
+	}
 	if gpDeleteAIDs == "" {
 		printError("--aids is required")
 		return
@@ -449,6 +636,9 @@ func runGPDelete(cmd *cobra.Command, args []string) {
 		return
 	}
 	defer reader.Close()
+	if !checkGPCardState(reader, "delete", sim.GPOpManage) {
+		return
+	}
 
 	cfg, err := buildGPConfig(reader)
 	if err != nil {
@@ -462,6 +652,15 @@ func runGPDelete(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	if dryRun {
+		var skipped []string
+		for _, aid := range aids {
+			skipped = append(skipped, fmt.Sprintf("DELETE %X", aid))
+		}
+		refuseInDryRun("delete", skipped)
+		return
+	}
+
 	printWarning("GlobalPlatform DELETE is dangerous and may brick the card.")
 	if err := sim.DeleteAIDs(reader, *cfg, aids); err != nil {
 		printError(fmt.Sprintf("GP delete failed: %v", err))
@@ -471,6 +670,9 @@ func runGPDelete(cmd *cobra.Command, args []string) {
 }
 
 func runGPLoad(cmd *cobra.Command, args []string) {
+	if refuseReadOnly("GP load") {
+		return
+	}
 	if gpLoadCAP == "" {
 		printError("--cap is required")
 		return
@@ -491,6 +693,9 @@ func runGPLoad(cmd *cobra.Command, args []string) {
 		return
 	}
 	defer reader.Close()
+	if !checkGPCardState(reader, "load/install", sim.GPOpManage) {
+		return
+	}
 
 	cfg, err := buildGPConfig(reader)
 	if err != nil {
@@ -498,36 +703,119 @@ func runGPLoad(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	sdAID, _ := sim.ParseAIDHex(gpSDAID)
-	pkgAID, err := sim.ParseAIDHex(gpPackageAID)
+	sdAID, _ := inputs.AID("--sd-aid", gpSDAID)
+	pkgAID, err := inputs.AID("--package-aid", gpPackageAID)
 	if err != nil {
-		printError(fmt.Sprintf("Invalid --package-aid: %v", err))
+		printError(err.Error())
 		return
 	}
-	appAID, err := sim.ParseAIDHex(gpAppletAID)
+	appAID, err := inputs.AID("--applet-aid", gpAppletAID)
 	if err != nil {
-		printError(fmt.Sprintf("Invalid --applet-aid: %v", err))
+		printError(err.Error())
 		return
 	}
 
 	instAID := appAID
 	if gpInstanceAID != "" {
-		instAID, err = sim.ParseAIDHex(gpInstanceAID)
+		instAID, err = inputs.AID("--instance-aid", gpInstanceAID)
+		if err != nil {
+			printError(err.Error())
+			return
+		}
+	}
+
+	if gpTargetSDAID != "" {
+		sdAID, err = inputs.AID("--gp-target-sd-aid", gpTargetSDAID)
 		if err != nil {
-			printError(fmt.Sprintf("Invalid --instance-aid: %v", err))
+			printError(err.Error())
 			return
 		}
 	}
+	opts, err := buildGPLoadOptions(sdAID)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+
+	if dryRun {
+		skipped := []string{fmt.Sprintf("INSTALL [for load] package %X (SD %X, hash %s)", pkgAID, sdAID, opts.Hash)}
+		if lfdb, err := sim.ReadLoadFile(gpLoadCAP, opts.Format); err == nil && cfg.BlockSize > 0 {
+			loadFile := sim.BuildLoadFile(lfdb, opts.DAPs)
+			blocks := (len(loadFile) + cfg.BlockSize - 1) / cfg.BlockSize
+			skipped = append(skipped, fmt.Sprintf("LOAD %d bytes (%d DAP block(s)) in %d block(s) of %d", len(loadFile), len(opts.DAPs), blocks, cfg.BlockSize))
+		} else {
+			skipped = append(skipped, fmt.Sprintf("LOAD %s", gpLoadCAP))
+		}
+		skipped = append(skipped, fmt.Sprintf("INSTALL [for install] applet %X as instance %X (privileges %X, params %X)", appAID, instAID, opts.Privileges, opts.Params))
+		refuseInDryRun("load/install", skipped)
+		return
+	}
 
 	printWarning("GlobalPlatform LOAD/INSTALL modifies card content.")
-	if err := sim.InstallLoadAndApplet(reader, *cfg, gpLoadCAP, sdAID, pkgAID, appAID, instAID); err != nil {
+	if err := sim.InstallLoadAndApplet(reader, *cfg, gpLoadCAP, sdAID, pkgAID, appAID, instAID, opts); err != nil {
 		printError(fmt.Sprintf("GP load/install failed: %v", err))
 		return
 	}
+	recordGPInstall(instAID, sim.StoredGPInstall{Package: fmt.Sprintf("%X", pkgAID), Module: fmt.Sprintf("%X", appAID),
+		Privileges: fmt.Sprintf("%X", opts.Privileges), Params: fmt.Sprintf("%X", opts.Params)})
 	printSuccess("GP load/install completed")
 }
 
+// buildGPLoadOptions creates the load file hash and DAP options from flags
+func buildGPLoadOptions(targetSD []byte) (sim.GPLoadOptions, error) {
+	var opts sim.GPLoadOptions
+	alg, err := sim.ParseGPHashAlgorithm(gpLoadHash)
+	if err != nil {
+		return opts, fmt.Errorf("invalid --gp-load-hash: %w", err)
+	}
+	opts.Hash = alg
+	if gpPrivileges != "" {
+		if opts.Privileges, err = inputs.Hex("--gp-privileges", gpPrivileges); err != nil {
+			return opts, err
+		}
+		if len(opts.Privileges) != 1 && len(opts.Privileges) != 3 {
+			return opts, fmt.Errorf("--gp-privileges must be 1 or 3 bytes; got %d", len(opts.Privileges))
+		}
+	}
+	if gpInstallParams != "" {
+		if opts.Params, err = inputs.Hex("--gp-install-params", gpInstallParams); err != nil {
+			return opts, err
+		}
+	}
+	if opts.Format, err = sim.ParseGPLoadFormat(gpLoadFormat); err != nil {
+		return opts, fmt.Errorf("invalid --gp-load-format: %w", err)
+	}
+
+	if gpDAPFile == "" {
+		if gpDAPAID != "" {
+			return opts, fmt.Errorf("--gp-dap-aid requires --gp-dap-file")
+		}
+		return opts, nil
+	}
+	if alg == sim.GPHashNone {
+		return opts, fmt.Errorf("--gp-dap-file requires a load file hash (--gp-load-hash auto, sha1 or sha256)")
+	}
+	sig, err := os.ReadFile(gpDAPFile)
+	if err != nil {
+		return opts, fmt.Errorf("failed to read --gp-dap-file: %w", err)
+	}
+	if len(sig) == 0 {
+		return opts, fmt.Errorf("--gp-dap-file %s is empty", gpDAPFile)
+	}
+	dapAID := targetSD
+	if gpDAPAID != "" {
+		if dapAID, err = inputs.AID("--gp-dap-aid", gpDAPAID); err != nil {
+			return opts, err
+		}
+	}
+	opts.DAPs = []sim.GPDAPBlock{{SDAID: dapAID, Signature: sig}}
+	return opts, nil
+}
+
 func runGPAram(cmd *cobra.Command, args []string) {
+	if refuseReadOnly("GP aram") {
+		return
+	}
 	if gpAramCertHash == "" {
 		printError("--cert-hash is required")
 		return
@@ -539,6 +827,9 @@ func runGPAram(cmd *cobra.Command, args []string) {
 		return
 	}
 	defer reader.Close()
+	if !checkGPCardState(reader, "aram", sim.GPOpManage) {
+		return
+	}
 
 	cfg, err := buildGPConfig(reader)
 	if err != nil {
@@ -546,24 +837,29 @@ func runGPAram(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	aramAID, err := sim.ParseAIDHex(gpAramAID)
+	aramAID, err := inputs.AID("--aram-aid", gpAramAID)
 	if err != nil {
-		printError(fmt.Sprintf("Invalid --aram-aid: %v", err))
+		printError(err.Error())
 		return
 	}
-	ruleAID, err := sim.ParseHexBytes(gpAramRuleAID)
+	ruleAID, err := inputs.AID("--rule-aid", gpAramRuleAID)
 	if err != nil {
-		printError(fmt.Sprintf("Invalid --rule-aid: %v", err))
+		printError(err.Error())
 		return
 	}
-	certHash, err := sim.ParseHexBytes(gpAramCertHash)
+	certHash, err := inputs.Hex("--cert-hash", gpAramCertHash)
 	if err != nil {
-		printError(fmt.Sprintf("Invalid --cert-hash: %v", err))
+		printError(err.Error())
 		return
 	}
-	perm, err := sim.ParseHexBytes(gpAramPerm)
+	perm, err := inputs.Hex("--perm", gpAramPerm)
 	if err != nil {
-		printError(fmt.Sprintf("Invalid --perm: %v", err))
+		printError(err.Error())
+		return
+	}
+
+	if dryRun {
+		refuseInDryRun("aram", []string{fmt.Sprintf("STORE DATA to ARA-M %X (rule AID %X, cert hash %X)", aramAID, ruleAID, certHash)})
 		return
 	}
 
@@ -581,6 +877,67 @@ func runGPAram(cmd *cobra.Command, args []string) {
 	printSuccess("GP ARA-M rule added successfully")
 }
 
+func runGPStoreData(cmd *cobra.Command, args []string) {
+	if refuseReadOnly("GP store-data") {
+		return
+	}
+	if gpStoreDataSpec == "" {
+		printError("--data is required (format: <aid>:file.bin)")
+		return
+	}
+	aidHex, path, ok := strings.Cut(gpStoreDataSpec, ":")
+	if !ok || path == "" {
+		printError("Invalid --data: expected <aid>:file.bin")
+		return
+	}
+	aid, err := inputs.AID("--data AID", aidHex)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	format, err := sim.ParseStoreDataFormat(gpStoreDataFormat)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	payload, err := os.ReadFile(path)
+	if err != nil {
+		printError(fmt.Sprintf("Payload file error: %v", err))
+		return
+	}
+
+	reader, err := connectAndPrepareReader()
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	defer reader.Close()
+	if !checkGPCardState(reader, "store-data", sim.GPOpManage) {
+		return
+	}
+
+	cfg, err := buildGPConfig(reader)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+
+	if dryRun {
+		refuseInDryRun("store-data", []string{
+			fmt.Sprintf("INSTALL [for personalization] %X", aid),
+			fmt.Sprintf("STORE DATA %d bytes (format %s, block size %d)", len(payload), format, cfg.BlockSize),
+		})
+		return
+	}
+
+	printWarning("GlobalPlatform STORE DATA modifies application data on the card.")
+	if err := sim.GPStoreData(reader, *cfg, aid, payload, format); err != nil {
+		printError(fmt.Sprintf("GP store data failed: %v", err))
+		return
+	}
+	printSuccess(fmt.Sprintf("GP store data completed (%d bytes, format %s)", len(payload), format))
+}
+
 func runGPVerify(cmd *cobra.Command, args []string) {
 	if gpVerifyAID == "" {
 		printError("--aid is required")
@@ -594,9 +951,9 @@ func runGPVerify(cmd *cobra.Command, args []string) {
 	}
 	defer reader.Close()
 
-	aid, err := sim.ParseAIDHex(gpVerifyAID)
+	aid, err := inputs.AID("--aid", gpVerifyAID)
 	if err != nil {
-		printError(fmt.Sprintf("Invalid --aid: %v", err))
+		printError(err.Error())
 		return
 	}
 
@@ -605,6 +962,6 @@ func runGPVerify(cmd *cobra.Command, args []string) {
 		printError(fmt.Sprintf("GP SELECT failed: %v", err))
 		return
 	}
-	printSuccess(fmt.Sprintf("GP SELECT SW=%04X (%s)", sw, card.SWToString(sw)))
+	printSuccess(fmt.Sprintf("GP SELECT SW=%04X (%s)", sw, card.DecodeSW(sw, card.INS_SELECT, card.ContextFile)))
 }
 
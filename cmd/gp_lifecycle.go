@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"sim_reader/card"
+	"sim_reader/inputs"
+	"sim_reader/sim"
+)
+
+// checkGPCardState detects the card life cycle at the start of a GP operation. A
+// CARD_LOCKED or TERMINATED card is reported, and op is refused when it cannot succeed.
+func checkGPCardState(reader *card.Reader, name string, op sim.GPOperation) bool {
+	sdAID, _ := inputs.AID("--sd-aid", gpSDAID)
+	state := sim.DetectGPCardState(reader, sdAID)
+	if err := state.Check(op); err != nil {
+		printError(fmt.Sprintf("GP %s refused: %v (%s)", name, err, state.Source))
+		return false
+	}
+	if state.Blocked() {
+		printWarning(fmt.Sprintf("GlobalPlatform: %s (%s)", state.Message(), state.Source))
+	}
+	return true
+}
+
+func runGPLifeCycle(cmd *cobra.Command, args []string) {
+	if gpUnlockCard && refuseReadOnly("GP unlock") {
+		return
+	}
+
+	reader, err := connectAndPrepareReader()
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	defer reader.Close()
+
+	sdAID, _ := inputs.AID("--sd-aid", gpSDAID)
+	state := sim.DetectGPCardState(reader, sdAID)
+	switch {
+	case state.Blocked():
+		printWarning(fmt.Sprintf("GP card life cycle: %s (%s)", state.Message(), state.Source))
+	case state.Known():
+		printSuccess(fmt.Sprintf("GP card life cycle: %s", state))
+	default:
+		printWarning("GP card life cycle: unknown (GET STATUS of the ISD requires a Secure Channel)")
+	}
+	if !gpUnlockCard {
+		return
+	}
+
+	if err := state.Check(sim.GPOpUnlock); err != nil {
+		printError(fmt.Sprintf("GP unlock refused: %v", err))
+		return
+	}
+	cfg, err := buildGPConfig(reader)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	if dryRun {
+		refuseInDryRun("unlock", []string{"SET STATUS 80F0800F (ISD CARD_LOCKED -> SECURED)"})
+		return
+	}
+
+	printWarning("GlobalPlatform SET STATUS changes the card life cycle.")
+	after, err := sim.UnlockGPCard(reader, *cfg)
+	if err != nil {
+		printError(fmt.Sprintf("GP unlock failed: %v", err))
+		return
+	}
+	recordGPProfile(cfg, gpKeysetName(), cfg.StaticKeys.Div)
+	if after == sim.GPCardUnknown {
+		printSuccess("GP unlock completed (SET STATUS accepted, life cycle not readable)")
+		return
+	}
+	printSuccess(fmt.Sprintf("GP unlock completed: card is %s", after))
+}
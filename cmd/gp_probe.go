@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"sim_reader/card"
+)
+
+// gpCardInfo performs INITIALIZE UPDATE with KVN 0 to learn the default key set and
+// protocol of the selected Security Domain. An S16 card may refuse an 8-byte host
+// challenge, so 16 bytes are tried next.
+func gpCardInfo(reader *card.Reader) (*card.GPProbeResult, error) {
+	var lastErr error
+	for _, n := range []int{8, 16} {
+		hostChallenge := make([]byte, n)
+		if _, err := rand.Read(hostChallenge); err != nil {
+			return nil, fmt.Errorf("failed to generate host challenge: %w", err)
+		}
+		info, err := card.ProbeSecureChannelInfo(reader, 0, hostChallenge)
+		if err == nil {
+			return info, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// preferKVN moves kvn to the front of kvns
+func preferKVN(kvns []int, kvn int) []int {
+	out := []int{kvn}
+	for _, v := range kvns {
+		if v != kvn {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// explainGPProbeFailure prints what the card reported in INITIALIZE UPDATE so that a
+// wrong --kvn, a card using another protocol and wrong keys can be told apart.
+// The decoded response is printed with --verbose.
+func explainGPProbeFailure(reader *card.Reader, kvn byte, keys card.GPKeySet, err error) {
+	var info *card.GPProbeResult
+	var perr *card.GPProbeError
+	if errors.As(err, &perr) {
+		info = perr.Info
+	} else if kvn != 0 {
+		// No answer for this KVN: ask for the default key set instead
+		info, _ = gpCardInfo(reader)
+	}
+	if info == nil {
+		return
+	}
+	if gpProbeVerbose {
+		printGPProbeResult(info)
+	}
+
+	reported := fmt.Sprintf("Card reports KVN %d (0x%02X), %s", info.KVN, info.KVN, info.Protocol())
+	switch {
+	case kvn != 0 && info.KVN != kvn:
+		printWarning(fmt.Sprintf("%s: use --kvn %d", reported, info.KVN))
+	case info.SCP != 0x02 && info.SCP != 0x03:
+		printWarning(fmt.Sprintf("%s: protocol not supported", reported))
+	default:
+		if kerr := info.CheckKeys(keys); kerr != nil {
+			printWarning(fmt.Sprintf("%s: keys do not fit %s (%v)", reported, info.Protocol(), kerr))
+		} else {
+			printWarning(fmt.Sprintf("%s: KVN and protocol match, the keys are wrong (card cryptogram mismatch)", reported))
+		}
+	}
+}
+
+// printGPProbeResult prints the fields of an INITIALIZE UPDATE response
+func printGPProbeResult(info *card.GPProbeResult) {
+	keyInfo := fmt.Sprintf("KVN %d (0x%02X), %s", info.KVN, info.KVN, info.Protocol())
+	if info.SCP == 0x03 {
+		keyInfo += fmt.Sprintf(", i=%02X", info.IParam)
+	}
+	fmt.Println("INITIALIZE UPDATE response:")
+	fmt.Printf("  Key diversification data: %X\n", info.KDD)
+	fmt.Printf("  Key information:          %s\n", keyInfo)
+	if len(info.SeqCounter) > 0 {
+		fmt.Printf("  Sequence counter:         %X\n", info.SeqCounter)
+	}
+	if len(info.CardChallenge) > 0 {
+		fmt.Printf("  Card challenge:           %X\n", info.CardChallenge)
+		fmt.Printf("  Card cryptogram:          %X\n", info.CardCryptogram)
+	}
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"sim_reader/card"
+	"sim_reader/inputs"
+	"sim_reader/output"
+	"sim_reader/sim"
+)
+
+func runGPRegistry(cmd *cobra.Command, args []string) {
+	if (gpExportRegistry == "") == (gpApplyRegistry == "") {
+		printError("exactly one of --gp-export-registry and --gp-apply-registry is required")
+		return
+	}
+	aramAID, err := inputs.AID("--aram-aid", gpAramAID)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	var desired *sim.GPRegistry
+	if gpApplyRegistry != "" {
+		if refuseReadOnly("GP registry apply") {
+			return
+		}
+		if desired, err = sim.LoadGPRegistry(gpApplyRegistry); err != nil {
+			printError(err.Error())
+			return
+		}
+	}
+
+	reader, err := connectAndPrepareReader()
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	defer reader.Close()
+	op, name := sim.GPOpRead, "registry export"
+	if desired != nil {
+		op, name = sim.GPOpManage, "registry apply"
+	}
+	if !checkGPCardState(reader, name, op) {
+		return
+	}
+
+	// The ICCID is read before the secure channel selects the security domain
+	iccid := profileICCID
+	if iccid == "" {
+		iccid, _ = sim.ReadICCIDQuick(reader)
+	}
+
+	cfg, err := buildGPConfig(reader)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+
+	printSuccess("GlobalPlatform: reading registry via Secure Channel...")
+	current, err := sim.ReadGPRegistry(reader, *cfg, aramAID)
+	if err != nil {
+		printError(fmt.Sprintf("GP registry read failed: %v", err))
+		return
+	}
+	recordGPProfile(cfg, gpKeysetName(), cfg.StaticKeys.Div)
+	if current.ARAStatus != "" {
+		printWarning(fmt.Sprintf("ARA-M rules not read: %s", current.ARAStatus))
+	}
+
+	if desired == nil {
+		exportGPRegistry(current, iccid)
+		return
+	}
+	applyGPRegistry(reader, cfg, aramAID, desired, current)
+}
+
+// exportGPRegistry writes the registry read from the card with the install parameters
+// recorded in the profile store
+func exportGPRegistry(reg *sim.GPRegistry, iccid string) {
+	reg.ICCID = iccid
+	unknown := 0
+	for i := range reg.Instances {
+		inst := &reg.Instances[i]
+		stored, ok := storedGPInstall(inst.AID)
+		if !ok {
+			inst.ParamsUnknown = true
+			unknown++
+			continue
+		}
+		inst.Params = stored.Params
+		if inst.Module == "" {
+			inst.Module = stored.Module
+		}
+		if inst.Package == "" {
+			inst.Package = stored.Package
+		}
+	}
+
+	if err := sim.SaveGPRegistry(gpExportRegistry, reg); err != nil {
+		printError(fmt.Sprintf("Failed to write %s: %v", gpExportRegistry, err))
+		return
+	}
+	printSuccess(fmt.Sprintf("GP registry written to %s: %d load file(s), %d instance(s), %d ARA-M rule(s)",
+		gpExportRegistry, len(reg.Packages), len(reg.Instances), len(reg.ARARules)))
+	if unknown > 0 {
+		printWarning(fmt.Sprintf("Install parameters of %d instance(s) are unknown (not installed with gp load and --profile-store)", unknown))
+	}
+}
+
+// storedGPInstall returns the profile store record of an instance
+func storedGPInstall(aid string) (sim.StoredGPInstall, bool) {
+	if cardProfile == nil {
+		return sim.StoredGPInstall{}, false
+	}
+	for stored, inst := range cardProfile.GPInstalls {
+		if strings.EqualFold(stored, aid) {
+			return inst, true
+		}
+	}
+	return sim.StoredGPInstall{}, false
+}
+
+// applyGPRegistry prints the plan that makes the card match desired and runs it
+func applyGPRegistry(reader *card.Reader, cfg *sim.GPConfig, aramAID []byte, desired, current *sim.GPRegistry) {
+	if current.ARAStatus != "" && len(desired.ARARules) > 0 {
+		printError("The registry file has ARA-M rules but the rules of the card cannot be read")
+		return
+	}
+	plan := sim.PlanGPRegistry(desired, current)
+	output.PrintGPRegistryPlan(plan)
+	if plan.Actions() == 0 {
+		printSuccess("Nothing to apply")
+		return
+	}
+	if dryRun {
+		var skipped []string
+		for _, s := range plan {
+			if s.Runs() {
+				skipped = append(skipped, fmt.Sprintf("%s %s: %s", s.Kind, s.AID, s.Detail))
+			}
+		}
+		refuseInDryRun("registry apply", skipped)
+		return
+	}
+
+	printWarning("GlobalPlatform INSTALL and ARA-M STORE DATA modify card content.")
+	if err := sim.ApplyGPRegistryPlan(reader, *cfg, aramAID, plan); err != nil {
+		printError(fmt.Sprintf("GP registry apply failed: %v", err))
+		return
+	}
+	for _, s := range plan {
+		if s.Kind == sim.GPStepInstall {
+			aid, _ := inputs.Hex("instance AID", s.AID)
+			recordGPInstall(aid, sim.StoredGPInstall{Package: s.Instance.Package, Module: s.Instance.Module,
+				Privileges: s.Instance.Privileges, Params: s.Instance.Params})
+		}
+	}
+	printSuccess(fmt.Sprintf("GP registry applied: %d step(s)", plan.Actions()))
+}
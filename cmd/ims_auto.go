@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// imsAutoTemplates checks the --ims-auto flags and returns the templates to generate from
+func imsAutoTemplates() (sim.IMSTemplates, error) {
+	if !imsAuto {
+		if imsPCSCFTpl != "" || imsTemplateFile != "" {
+			return sim.IMSTemplates{}, fmt.Errorf("--ims-pcscf-template and --ims-template require --ims-auto")
+		}
+		return sim.IMSTemplates{}, nil
+	}
+	if writeIMPI != "" || len(writeIMPU) > 0 || writeDomain != "" {
+		return sim.IMSTemplates{}, fmt.Errorf("--ims-auto generates IMPI, IMPU and domain: use --ims-template instead of --impi/--impu/--domain")
+	}
+	if writePCSCF != "" && imsPCSCFTpl != "" {
+		return sim.IMSTemplates{}, fmt.Errorf("--pcscf and --ims-pcscf-template cannot be combined")
+	}
+
+	templates := sim.DefaultIMSTemplates
+	if imsTemplateFile != "" {
+		var err error
+		if templates, err = sim.LoadIMSTemplates(imsTemplateFile); err != nil {
+			return sim.IMSTemplates{}, err
+		}
+	}
+	if imsPCSCFTpl != "" {
+		templates.PCSCF = imsPCSCFTpl
+	}
+	return templates, nil
+}
+
+// writeIMSAuto generates the IMS identities from the IMSI being written (--imsi, then the
+// config file) or the one on the card, and writes them like --impi/--impu/--domain/--pcscf
+func writeIMSAuto(reader *card.Reader, config *sim.SIMConfig, templates sim.IMSTemplates) {
+	usim, usimErr := sim.ReadUSIM(reader)
+
+	imsi := writeIMSI
+	if imsi == "" && config != nil {
+		imsi = config.IMSI
+	}
+	if imsi == "" && usimErr == nil {
+		imsi = usim.IMSI
+	}
+	if imsi == "" {
+		printError("--ims-auto: no IMSI to generate the IMS identities from")
+		return
+	}
+
+	mncLen := 0
+	if config != nil && (len(config.MNC) == 2 || len(config.MNC) == 3) {
+		mncLen = len(config.MNC)
+	} else if usimErr == nil {
+		mncLen = usim.AdminData.MNCLength
+	}
+	if mncLen != 2 && mncLen != 3 {
+		printWarning("--ims-auto: MNC length unknown (EF_AD), assuming 2 digits")
+		mncLen = 2
+	}
+
+	id, err := sim.GenerateIMSIdentity(imsi, mncLen, templates)
+	if err != nil {
+		printError(fmt.Sprintf("--ims-auto: %v", err))
+		return
+	}
+
+	if err := sim.WriteIMPI(reader, id.IMPI); err != nil {
+		printError(fmt.Sprintf("Write IMPI failed: %v", err))
+	} else {
+		printSuccess(fmt.Sprintf("IMPI written successfully: %s", id.IMPI))
+	}
+	if err := sim.WriteIMPU(reader, []string{id.IMPU}); err != nil {
+		printError(fmt.Sprintf("Write IMPU failed: %v", err))
+	} else {
+		printSuccess(fmt.Sprintf("IMPU written successfully: %s", id.IMPU))
+	}
+	if err := sim.WriteDomain(reader, id.Domain); err != nil {
+		printError(fmt.Sprintf("Write Domain failed: %v", err))
+	} else {
+		printSuccess(fmt.Sprintf("Domain written successfully: %s", id.Domain))
+	}
+	if id.PCSCF != "" {
+		if err := sim.WritePCSCF(reader, id.PCSCF); err != nil {
+			printError(fmt.Sprintf("Write P-CSCF failed: %v", err))
+		} else {
+			printSuccess(fmt.Sprintf("P-CSCF written successfully: %s", id.PCSCF))
+		}
+	}
+}
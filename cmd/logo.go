@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// runExportLogo saves the operator logo (first basic image instance of EF_IMG) as PNG
+func runExportLogo(reader *card.Reader) {
+	img, inst, err := sim.ReadLogo(reader)
+	if err != nil {
+		printError(fmt.Sprintf("Logo export failed: %v", err))
+		return
+	}
+
+	f, err := os.Create(exportLogoFile)
+	if err != nil {
+		printError(fmt.Sprintf("Logo export failed: %v", err))
+		return
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		printError(fmt.Sprintf("Logo export failed: %v", err))
+		return
+	}
+	if err := f.Close(); err != nil {
+		printError(fmt.Sprintf("Logo export failed: %v", err))
+		return
+	}
+	printSuccess(fmt.Sprintf("Logo saved to %s (%dx%d, EF_IMG record %d, file %04X)",
+		exportLogoFile, inst.Width, inst.Height, inst.Record, inst.FileID))
+}
+
+// loadLogoPNG reads the PNG given to --write-logo
+func loadLogoPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return img, nil
+}
+
+// writeLogoFromFile converts the PNG to a monochrome raster and writes it over the
+// first basic image instance of EF_IMG
+func writeLogoFromFile(reader *card.Reader, path string) {
+	img, err := loadLogoPNG(path)
+	if err != nil {
+		printError(fmt.Sprintf("Write logo failed: %v", err))
+		return
+	}
+	inst, err := sim.WriteLogo(reader, img)
+	if err != nil {
+		printError(fmt.Sprintf("Write logo failed: %v", err))
+		return
+	}
+	printSuccess(fmt.Sprintf("Logo written: %dx%d B/W to file %04X (EF_IMG record %d)",
+		inst.Width, inst.Height, inst.FileID, inst.Record))
+}
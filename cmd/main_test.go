@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain keeps the file map cache of the test cards out of the user's cache directory.
+// The cache is off unless a test enables it: test cards share ICCIDs but not files.
+func TestMain(m *testing.M) {
+	noCache = true
+	dir, err := os.MkdirTemp("", "sim_reader-cache")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CACHE_HOME", dir)
+	os.Setenv("HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"sim_reader/card"
+	"sim_reader/output"
+)
+
+var (
+	// Timing breakdown (--profile): wall time and APDU count of each operation, printed at
+	// the end and added to the JSON result
+	profileMode bool
+
+	// profileMetrics collects the operations of this run; nil (nothing recorded) unless
+	// --profile is given or the test suite writes a report
+	profileMetrics *card.Metrics
+)
+
+// startMetrics begins collecting operation metrics for this run
+func startMetrics() {
+	if profileMetrics == nil {
+		profileMetrics = card.NewMetrics()
+	}
+}
+
+// measure begins an operation that runs before there is a reader (connect) and returns
+// the function that ends it
+func measure(name string) func() {
+	return profileMetrics.Start(name)
+}
+
+// metricsReport returns the breakdown for a JSON result (nil without --profile)
+func metricsReport() *card.MetricsReport {
+	if !profileMode {
+		return nil
+	}
+	r := profileMetrics.Report()
+	return &r
+}
+
+// printMetrics prints the breakdown at the end of the run (--profile). In JSON mode it
+// goes to stderr with the other messages.
+func printMetrics() {
+	if profileMode {
+		output.PrintMetrics(profileMetrics.Report())
+	}
+}
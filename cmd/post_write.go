@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sim_reader/card"
+	"sim_reader/output"
+	"sim_reader/sim"
+)
+
+var (
+	// Settle step between writing and verifying
+	postWriteReset bool
+	postWriteDelay time.Duration
+	postWriteOps   []string
+)
+
+// addPostWriteFlags registers the settle step flags of commands that write and verify
+func addPostWriteFlags(c *cobra.Command) {
+	c.Flags().BoolVar(&postWriteReset, "post-write-reset", false,
+		"Warm reset the card (simulated REFRESH) before verifying writes that need a REFRESH")
+	c.Flags().DurationVar(&postWriteDelay, "post-write-delay", 0,
+		"Wait this long after STATUS (and the reset) before verifying, e.g. 500ms")
+	c.Flags().StringSliceVar(&postWriteOps, "post-write-ops", sim.DefaultSettleOperations,
+		"Writes followed by the settle step and verification: imsi, ust, ist, hplmn, oplmn, uplmn, fplmn, ad, spn, impi or none")
+}
+
+// postWriteCheck is the settle step and the verification that followed the writes
+type postWriteCheck struct {
+	Settle *sim.SettleResult `json:"settle,omitempty"`
+	Verify *sim.VerifyReport `json:"verify,omitempty"`
+}
+
+// settleAndVerify runs the settle step for the items written in this session and, when
+// one of them asked for it, verifies config against the card. nil when nothing needed
+// settling. The result is printed with the change summary (see printWriteChanges).
+func settleAndVerify(reader *card.Reader, applied []string, config *sim.SIMConfig) *postWriteCheck {
+	if dryRun || len(applied) == 0 {
+		return nil
+	}
+	policies, err := sim.NewSettlePolicies(postWriteOps, sim.SettlePolicy{Reset: postWriteReset, Delay: postWriteDelay})
+	if err != nil {
+		printError(fmt.Sprintf("--post-write-ops: %v", err))
+		return nil
+	}
+	settle, err := sim.Settle(reader, applied, policies)
+	if err != nil {
+		printError(err.Error())
+		return nil
+	}
+	if settle == nil {
+		return nil
+	}
+	check := &postWriteCheck{Settle: settle}
+	if config == nil {
+		return check
+	}
+	verify, err := sim.VerifyConfig(reader, config)
+	if err != nil {
+		printError(fmt.Sprintf("Verify failed: %v", err))
+		return check
+	}
+	if len(verify.Items) > 0 {
+		check.Verify = verify
+	}
+	return check
+}
+
+// print prints the settle step as one line, e.g. "Verification: post-reset (STATUS, warm
+// reset, wait 2s) after IMSI, EF_UST", followed by the verification table
+func (c *postWriteCheck) print() {
+	s := c.Settle
+	steps := []string{"STATUS"}
+	if !s.Status {
+		steps[0] = "STATUS not answered 9000"
+	}
+	if s.Reset {
+		steps = append(steps, "warm reset")
+	}
+	if s.Delay != "" {
+		steps = append(steps, "wait "+s.Delay)
+	}
+	fmt.Println()
+	printSuccess(fmt.Sprintf("Verification: %s (%s) after %s",
+		s.Verification, strings.Join(steps, ", "), strings.Join(s.Operations, ", ")))
+	if c.Verify != nil {
+		output.PrintVerifyReport(c.Verify)
+	}
+}
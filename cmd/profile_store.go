@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+var (
+	// Per-card profile store (--profile-store, --forget-card)
+	profileStorePath string
+	forgetCard       bool
+
+	// cardProfile is the stored entry of the connected card (nil = none or store not used)
+	// and profileICCID the card it belongs to ("" = nothing is recorded in this run)
+	cardProfile  *sim.CardProfile
+	profileICCID string
+)
+
+// applyCardProfile looks the connected card up in the profile store and fills in what the
+// flags leave open: the driver when none is detected from the ATR, the ADM VERIFY variant
+// to try first and the USIM/ISIM AIDs. Every value taken from the store is logged. With
+// --forget-card the entry is removed instead. Returns the driver to use.
+func applyCardProfile(reader *card.Reader, drv sim.ProgrammableDriver) sim.ProgrammableDriver {
+	cardProfile, profileICCID = nil, ""
+	if profileStorePath == "" {
+		if forgetCard {
+			printWarning("--forget-card has no effect without --profile-store")
+		}
+		return drv
+	}
+	store, err := sim.OpenProfileStore(profileStorePath)
+	if err != nil {
+		printWarning(fmt.Sprintf("Profile store not used: %v", err))
+		return drv
+	}
+	iccid, err := sim.ReadICCIDQuick(reader)
+	if err != nil || iccid == "" {
+		printWarning("Profile store not used: ICCID not readable")
+		return drv
+	}
+
+	if forgetCard {
+		if !store.Forget(iccid) {
+			printWarning(fmt.Sprintf("No stored profile for ICCID %s in %s", iccid, store.Path()))
+		} else if err := store.Save(); err != nil {
+			printWarning(fmt.Sprintf("Profile store not saved: %v", err))
+		} else {
+			printSuccess(fmt.Sprintf("Removed the stored profile of ICCID %s from %s", iccid, store.Path()))
+		}
+		return drv
+	}
+
+	profileICCID = iccid
+	p := store.Get(iccid)
+	if p == nil {
+		return drv
+	}
+	cardProfile = p
+
+	if p.Driver != "" {
+		switch {
+		case drv == nil:
+			if d := sim.DriverByName(p.Driver); d != nil {
+				profileLog(fmt.Sprintf("driver=%s", p.Driver))
+				drv = d
+			}
+		case drv.Name() != p.Driver:
+			printWarning(fmt.Sprintf("Profile store: ICCID %s was used with driver %s, detected %s now", iccid, p.Driver, drv.Name()))
+		}
+	}
+
+	for level, key := range map[int]string{1: admKey, 2: admKey2, 3: admKey3, 4: admKey4} {
+		if a, ok := p.ADM[level]; ok && key != "" {
+			sim.PreferADMProfile(level, a.Profile())
+			profileLog(fmt.Sprintf("ADM%d format=%q", level, a.Name))
+		}
+	}
+
+	usimAID, isimAID := usimAIDFlag, isimAIDFlag
+	if usimAID == "" && p.USIMAID != "" {
+		usimAID = p.USIMAID
+		profileLog("USIM AID=" + usimAID)
+	}
+	if isimAID == "" && p.ISIMAID != "" {
+		isimAID = p.ISIMAID
+		profileLog("ISIM AID=" + isimAID)
+	}
+	if usimAID != usimAIDFlag || isimAID != isimAIDFlag {
+		if err := sim.SetAIDOverrides(usimAID, isimAID); err != nil {
+			printWarning(fmt.Sprintf("Profile store: stored AID ignored: %v", err))
+		}
+	}
+	return drv
+}
+
+// profileLog reports a value taken from the profile store
+func profileLog(what string) {
+	printSuccess(fmt.Sprintf("Profile store: using stored %s for ICCID %s", what, profileICCID))
+}
+
+// updateCardProfile applies fn to the store entry of the connected card and saves the
+// store if the entry changed. Only values the card accepted in this run may be recorded.
+func updateCardProfile(fn func(p *sim.CardProfile)) {
+	if profileICCID == "" {
+		return
+	}
+	store, err := sim.OpenProfileStore(profileStorePath)
+	if err != nil {
+		printWarning(fmt.Sprintf("Profile store not updated: %v", err))
+		return
+	}
+	if !store.Update(profileICCID, fn) {
+		return
+	}
+	if err := store.Save(); err != nil {
+		printWarning(fmt.Sprintf("Profile store not updated: %v", err))
+		return
+	}
+	cardProfile = store.Get(profileICCID)
+}
+
+// recordCardProfile stores what connectAndPrepareReader verified: the driver detected from
+// the ATR, the ADM VERIFY variants that succeeded, and custom AIDs the card selected
+func recordCardProfile(reader *card.Reader, detected sim.ProgrammableDriver) {
+	if profileICCID == "" {
+		return
+	}
+	// Select while the MF is current: ADF selection only, nothing is read here
+	aidSelects := func(aid []byte) bool {
+		if len(aid) == 0 {
+			return false
+		}
+		resp, err := reader.Select(aid)
+		return err == nil && resp.IsOK()
+	}
+	usimOK := aidSelects(sim.OverrideUSIM_AID)
+	isimOK := aidSelects(sim.OverrideISIM_AID)
+
+	updateCardProfile(func(p *sim.CardProfile) {
+		if detected != nil {
+			p.Driver = detected.Name()
+		}
+		for level := 1; level <= 4; level++ {
+			if v, ok := sim.VerifiedADMProfile(level); ok {
+				if p.ADM == nil {
+					p.ADM = map[int]sim.StoredADMProfile{}
+				}
+				p.ADM[level] = sim.NewStoredADMProfile(v)
+			}
+		}
+		if usimOK {
+			p.USIMAID = fmt.Sprintf("%X", sim.OverrideUSIM_AID)
+		}
+		if isimOK {
+			p.ISIMAID = fmt.Sprintf("%X", sim.OverrideISIM_AID)
+		}
+	})
+}
+
+// applyGPProfile fills the GP flags that are not given (--kvn, --sd-aid, --gp-div and, with
+// --dms, --dms-keyset) from the secure channel setup stored for the card
+func applyGPProfile() {
+	if cardProfile == nil || cardProfile.GP == nil {
+		return
+	}
+	gp := cardProfile.GP
+	unset := func(name string) bool { return !gpCmd.PersistentFlags().Lookup(name).Changed }
+	if unset("kvn") {
+		gpKVN = gp.KVN
+		profileLog(fmt.Sprintf("GP kvn=%d", gp.KVN))
+	}
+	if unset("sd-aid") && gp.SDAID != "" {
+		gpSDAID = gp.SDAID
+		profileLog("GP sd-aid=" + gp.SDAID)
+	}
+	if unset("gp-div") && gp.Div != "" {
+		gpDiv = gp.Div
+		profileLog("GP div=" + gp.Div)
+	}
+	if unset("dms-keyset") && gp.Keyset != "" && gpDMSFile != "" && !gpAuto {
+		gpDMSKeyset = gp.Keyset
+		profileLog("GP keyset=" + gp.Keyset)
+	}
+}
+
+// gpKeysetName is the DMS keyset name of explicitly chosen keys ("" without --dms or in
+// auto mode, where the match records its own keyset)
+func gpKeysetName() string {
+	if gpDMSFile == "" || gpAuto || strings.EqualFold(strings.TrimSpace(gpDMSKeyset), "auto") {
+		return ""
+	}
+	return gpDMSKeyset
+}
+
+// recordGPProfile stores a secure channel setup that opened on the card. keyset is the DMS
+// keyset name ("" with explicit keys). An undecided diversification (auto) keeps the
+// stored one.
+func recordGPProfile(cfg *sim.GPConfig, keyset string, div card.DivScheme) {
+	updateCardProfile(func(p *sim.CardProfile) {
+		gp := &sim.StoredGPProfile{KVN: int(cfg.KVN), Keyset: keyset, SDAID: fmt.Sprintf("%X", cfg.SDAID)}
+		if div != card.DivAuto {
+			gp.Div = string(div)
+		} else if p.GP != nil {
+			gp.Div = p.GP.Div
+		}
+		p.GP = gp
+	})
+}
+
+// recordGPInstall stores how an instance was installed, for gp registry exports
+func recordGPInstall(instanceAID []byte, inst sim.StoredGPInstall) {
+	updateCardProfile(func(p *sim.CardProfile) {
+		if p.GPInstalls == nil {
+			p.GPInstalls = map[string]sim.StoredGPInstall{}
+		}
+		p.GPInstalls[fmt.Sprintf("%X", instanceAID)] = inst
+	})
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// ============ PROFILE STORE TESTS ============
+
+func TestRead_ProfileStore(t *testing.T) {
+	mock := newTestCard()
+	openReader = func(int, ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock), nil
+	}
+	path := filepath.Join(t.TempDir(), "cards.json")
+	defer func() {
+		openReader = card.Connect
+		profileStorePath, forgetCard, usimAIDFlag = "", false, ""
+		cardProfile, profileICCID = nil, ""
+		sim.SetAIDOverrides("", "")
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	}()
+	aid := fmt.Sprintf("%X", testUSIMAID)
+
+	// An AID that does not select is not recorded
+	runCapture(t, "read", "-r", "0", "--profile-store", path, "--usim-aid", "A0000000871004")
+	if store, _ := sim.OpenProfileStore(path); store.Get("8901234567890123456") != nil {
+		t.Errorf("unverified AID stored: %+v", store.Get("8901234567890123456"))
+	}
+
+	runCapture(t, "read", "-r", "0", "--profile-store", path, "--usim-aid", aid)
+	store, err := sim.OpenProfileStore(path)
+	if err != nil {
+		t.Fatalf("OpenProfileStore() error = %v", err)
+	}
+	if p := store.Get("8901234567890123456"); p == nil || p.USIMAID != aid {
+		t.Fatalf("stored profile = %+v, want USIM AID %s", p, aid)
+	}
+
+	usimAIDFlag = ""
+	stdout, _ := runCapture(t, "read", "-r", "0", "--profile-store", path)
+	want := "Profile store: using stored USIM AID=" + aid + " for ICCID 8901234567890123456"
+	if !strings.Contains(stdout, want) {
+		t.Errorf("missing %q in output:\n%s", want, stdout)
+	}
+
+	runCapture(t, "read", "-r", "0", "--profile-store", path, "--forget-card")
+	if store, _ := sim.OpenProfileStore(path); store.Get("8901234567890123456") != nil {
+		t.Error("--forget-card kept the entry")
+	}
+}
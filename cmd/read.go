@@ -1,13 +1,19 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
+	"sim_reader/card"
 	"sim_reader/output"
 	"sim_reader/sim"
+	"sim_reader/tlv"
 )
 
 var (
@@ -15,15 +21,32 @@ var (
 	listReadersFlag   bool
 	showPhonebook     bool
 	showSMS           bool
+	showCallInfo      bool
+	showBDN           bool
+	showSOR           bool
 	showApplets       bool
 	showAllServices   bool
 	showRaw           bool
+	showKeys          bool
+	showFiveGContext  bool
 	analyzeCard       bool
 	dumpTestData      string
+	dumpFormat        string
 	checkADMStatus    bool
 	debugFCP          bool
 	createSamplePath  string
 	showCardInfo      bool
+	showOTAInfo       bool
+	outputYAML        bool
+	verifyConfigPath  string
+	decodeTLVHex      string
+	decodeEFName      string
+	readerSelfTest    bool
+	listAIDs          bool
+	showUsage         bool
+	compareServices   string
+	compareCSV        string
+	exportLogoFile    string
 )
 
 var readCmd = &cobra.Command{
@@ -44,13 +67,59 @@ Examples:
   # Read card with all services detail
   sim_reader read -a 77111606 --services
 
+  # Read call history and advice of charge counters
+  sim_reader read -a 77111606 --call-info
+
   # Analyze card structure
   sim_reader read --analyze
 
   # Dump card data as JSON
   sim_reader read -a 77111606 --json
 
-  # Create sample config file
+  # Show OTA counters and keyset versions
+  sim_reader read -a 77111606 --ota-info
+
+  # Dump card data as YAML (commented config)
+  sim_reader read -a 77111606 --yaml > card.yaml
+
+  # Capture the card as a fixture for the mock backend (tests)
+  sim_reader read -a 77111606 --dump sysmoISIM-SJA5 --dump-format fixture
+
+  # Check that a card matches its config (read-only, exit code 1 on mismatch)
+  sim_reader read -a 77111606 --verify-config card.json
+
+  # Decode a BER-TLV hex string from a trace (no card needed)
+  sim_reader read --decode-tlv 62178202412183026F07A503800171...
+
+  # Decode the content of an EF from a trace or dump (name or FID, no card needed)
+  sim_reader read --decode-ef EF_IMSI 082905880000000010
+  sim_reader read --decode-ef ISIM:6F04 800F7369703A313233406578616D706C65
+
+  # Show EF_DIR records (raw and parsed) to see why AID detection fails
+  sim_reader read --list-aids
+
+  # Compare the service tables of a card batch (directory of --json exports)
+  sim_reader read --compare-services batch/ --compare-csv services.csv
+
+  # Save the operator logo (EF_IMG, B/W image) as PNG
+  sim_reader read -a 77111606 --export-logo logo.png
+
+  # Check free records (ADN, SMS, FDN, ...) before a bulk import
+  sim_reader read -a 77111606 --usage
+
+  # Use explicit AIDs on a card with a broken EF_DIR
+  sim_reader read -a 77111606 --usim-aid A0000000871002FF49FF0589
+
+  # Check a flaky reader (connect cycles, latency, READ BINARY stress)
+  sim_reader read -r 0 --reader-selftest
+
+  # Map hidden files: SELECT every FID under MF, DF_TELECOM, DF_GSM, ADF_USIM/ISIM
+  sim_reader read -a 77111606 --fuzz-select --fuzz-rate 50
+
+  # Repeat the USIM/ISIM read 200 times and report diverging responses
+  sim_reader read -a 77111606 --stress-loop 200
+
+  # Create sample config file (.json or .yaml)
   sim_reader read --create-sample my_config.json`,
 	Run: runRead,
 }
@@ -59,19 +128,49 @@ func init() {
 	readCmd.Flags().BoolVarP(&listReadersFlag, "list", "l", false,
 		"List available smart card readers")
 	readCmd.Flags().BoolVar(&showPhonebook, "phonebook", false,
-		"Show phonebook entries (EF_ADN)")
+		"Show phonebook entries (DF_PHONEBOOK via EF_PBR with email and additional numbers, else EF_ADN)")
 	readCmd.Flags().BoolVar(&showSMS, "sms", false,
 		"Show SMS messages (EF_SMS)")
+	readCmd.Flags().BoolVar(&showCallInfo, "call-info", false,
+		"Show call history (EF_ICI/EF_OCI) and call meter (EF_ACM/ACMmax/PUCT)")
+	readCmd.Flags().BoolVar(&showBDN, "bdn-list", false,
+		"Show the barred dialling numbers (EF_BDN with EF_EXT4) and whether BDN is enabled (EST service 2)")
+	readCmd.Flags().BoolVar(&showSOR, "show-sor", false,
+		"Show the steering of roaming files EF_FROMPREFERRED and EF_SOR-CMCI (UST services 131/132)")
 	readCmd.Flags().BoolVar(&showApplets, "applets", false,
 		"Show GlobalPlatform applets")
 	readCmd.Flags().BoolVar(&showAllServices, "services", false,
 		"Show all UST/IST services in detail")
 	readCmd.Flags().BoolVar(&showRaw, "raw", false,
 		"Show raw hex data")
+	readCmd.Flags().BoolVar(&showKeys, "show-keys", false,
+		"Show cached security contexts (EF_Keys/EF_KeysPS CK/IK, EF_Kc/EF_KcGPRS Kc) - sensitive")
+	readCmd.Flags().BoolVar(&showFiveGContext, "show-5g-context", false,
+		"Show the 5G NAS security contexts (EF_5GS3GPPNSC/EF_5GSN3GPPNSC, K_AMF redacted) and EF_OPL5G - sensitive")
+	readCmd.Flags().BoolVar(&showKi, "show-ki", false,
+		"Read the subscriber key Ki on test cards whose driver supports it (needs --i-understand-keys-are-sensitive, shown redacted)")
+	readCmd.Flags().BoolVar(&ackSensitiveKeys, "i-understand-keys-are-sensitive", false,
+		"Acknowledge that --show-ki reads key material")
+	readCmd.Flags().BoolVar(&revealSecrets, "reveal-secrets", false,
+		"Show key material in full instead of the first/last 2 bytes (and include Ki in --json)")
+	readCmd.Flags().StringVar(&smKeyMAC, "sm-key-mac", "",
+		"Secure messaging checksum key (hex) for EFs readable only with ISO 7816-4 SM")
+	readCmd.Flags().StringVar(&smKeyENC, "sm-key-enc", "",
+		"Secure messaging encryption key (hex); without it data objects are sent in plain (DO 81)")
+	readCmd.Flags().StringVar(&smAlg, "sm-alg", "aes128",
+		"Secure messaging algorithm: aes128 or 3des")
+	readCmd.Flags().StringVar(&smSSC, "sm-ssc", "",
+		"Initial send sequence counter (hex, 16 bytes for aes128, 8 for 3des; default zero)")
+	readCmd.Flags().StringVar(&smFiles, "sm-files", "",
+		"Always read these EFs with secure messaging (e.g. 6F02,6F03); otherwise SM is used after 6982 when EF_ARR asks for it")
 	readCmd.Flags().BoolVar(&analyzeCard, "analyze", false,
 		"Analyze card: show ATR, applications, try GSM access")
 	readCmd.Flags().StringVar(&dumpTestData, "dump", "",
 		"Dump card data as Go test code (provide card name)")
+	readCmd.Flags().StringVar(&dumpFormat, "dump-format", "go",
+		"--dump output: go (test code) or fixture (APDU fixture JSON file for the mock card)")
+	addExportCoreFlags(readCmd)
+	addFileMapFlags(readCmd)
 	readCmd.Flags().BoolVar(&checkADMStatus, "adm-check", false,
 		"Check ADM key slots status (safe on most cards)")
 	readCmd.Flags().BoolVar(&debugFCP, "debug-fcp", false,
@@ -80,6 +179,34 @@ func init() {
 		"Create sample config file at specified path")
 	readCmd.Flags().BoolVar(&showCardInfo, "card-info", false,
 		"Show programmable card information (type, capabilities)")
+	readCmd.Flags().BoolVar(&outputYAML, "yaml", false,
+		"Output card data as a YAML config (like --json, with field comments)")
+	readCmd.Flags().BoolVar(&showOTAInfo, "ota-info", false,
+		"Show OTA counters (CNTR) and KIc/KID keyset versions per TAR")
+	readCmd.Flags().StringVar(&verifyConfigPath, "verify-config", "",
+		"Compare card contents with a JSON/YAML config without writing; exit code 1 on any mismatch")
+	readCmd.Flags().StringVar(&decodeTLVHex, "decode-tlv", "",
+		"Decode a BER-TLV hex string (FCP, EF_DIR, proactive command, GP/ARA-M data) without a card")
+	readCmd.Flags().StringVar(&decodeEFName, "decode-ef", "",
+		"Decode the hex argument as the content of an EF (EF_IMSI, 6F38, ISIM:6F07, FCP; one record for record files) without a card")
+	readCmd.Flags().BoolVar(&listAIDs, "list-aids", false,
+		"Show EF_DIR records (raw hex, parsed AID/label, problems) and the AIDs used for USIM/ISIM")
+	readCmd.Flags().BoolVar(&showUsage, "usage", false,
+		"Show used/free records of ADN, SMS, FDN, SDN, OPLMNwACT, IMPU and the EF sizes from FCP (JSON with --json)")
+	readCmd.Flags().StringVar(&compareServices, "compare-services", "",
+		"Compare UST/EST/IST across the --json/--yaml card exports in a directory (no card needed)")
+	readCmd.Flags().StringVar(&compareCSV, "compare-csv", "",
+		"With --compare-services: also save the service matrix as CSV")
+	readCmd.Flags().StringVar(&exportLogoFile, "export-logo", "",
+		"Save the operator logo (first B/W image of EF_IMG in DF_GRAPHICS) as PNG")
+	readCmd.Flags().BoolVar(&readerSelfTest, "reader-selftest", false,
+		"Diagnose the reader: connect cycles with ATR check, round-trip latency, READ BINARY stress")
+	readCmd.Flags().BoolVar(&fuzzSelect, "fuzz-select", false,
+		"SELECT every FID 0000-FFFF under MF, DF_TELECOM, DF_GSM and the applications (read-only); map saved to fuzz-select-<time>.json")
+	readCmd.Flags().IntVar(&fuzzRate, "fuzz-rate", 0,
+		"Limit --fuzz-select to N SELECT commands per second (0 = no limit)")
+	readCmd.Flags().IntVar(&stressLoop, "stress-loop", 0,
+		"Repeat the USIM/ISIM read N times (read-only) and report responses differing from the first; saved to stress-loop-<time>.json")
 
 	rootCmd.AddCommand(readCmd)
 }
@@ -103,6 +230,66 @@ func runRead(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	if dumpFormat != "go" && dumpFormat != "fixture" {
+		printError(fmt.Sprintf("Invalid --dump-format %q: use go or fixture", dumpFormat))
+		return
+	}
+	if err := checkExportCoreFlags(); err != nil {
+		printError(err.Error())
+		return
+	}
+	if err := checkSecretFlags(); err != nil {
+		printError(err.Error())
+		return
+	}
+	if err := checkSecureMessagingFlags(); err != nil {
+		printError(err.Error())
+		return
+	}
+
+	// Handle --decode-tlv flag without connecting to card
+	if decodeTLVHex != "" {
+		runDecodeTLV(decodeTLVHex)
+		return
+	}
+
+	// Handle --decode-ef flag without connecting to card
+	if decodeEFName != "" {
+		runDecodeEF(decodeEFName, args)
+		return
+	}
+
+	// Service matrix of saved exports, no card needed
+	if compareServices != "" {
+		runCompareServices()
+		return
+	}
+	if compareCSV != "" {
+		printError("--compare-csv requires --compare-services")
+		return
+	}
+
+	if fuzzRate < 0 || stressLoop < 0 {
+		printError("--fuzz-rate and --stress-loop must not be negative")
+		return
+	}
+	if fuzzSelect && stressLoop > 0 {
+		printError("--fuzz-select and --stress-loop cannot be combined")
+		return
+	}
+
+	// Reader health check instead of a card read
+	if readerSelfTest {
+		runReaderSelfTest()
+		return
+	}
+
+	// YAML export is quiet like JSON
+	if outputYAML {
+		outputJSON = true
+		beginJSONOutput()
+	}
+
 	// Connect to reader
 	reader, err := connectAndPrepareReader()
 	if err != nil {
@@ -111,6 +298,53 @@ func runRead(cmd *cobra.Command, args []string) {
 	}
 	defer reader.Close()
 
+	// Show what was parsed from EF_DIR
+	if listAIDs {
+		runListAIDs(reader)
+		return
+	}
+
+	// Operator logo as PNG
+	if exportLogoFile != "" {
+		runExportLogo(reader)
+		return
+	}
+
+	// Capacity planning: record usage and EF sizes
+	if showUsage {
+		runUsage(reader)
+		return
+	}
+
+	// Read-only diagnostics: interruptible, the report is saved even when stopped early
+	if fuzzSelect || stressLoop > 0 {
+		var ok bool
+		if fuzzSelect {
+			ok = runFuzzSelect(reader)
+		} else {
+			ok = runStressLoop(reader)
+		}
+		reader.Close()
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Compare card with a config and exit with the result
+	if verifyConfigPath != "" {
+		ok := runVerifyConfig(reader)
+		reader.Close()
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Files known to be absent from an earlier run are not selected again
+	fileMap := activateFileMap(reader)
+	defer finishFileMap(fileMap, analyzeCard || outputJSON || exportCoreFormat != "" || dumpTestData != "")
+
 	// Show programmable card info if requested
 	if showCardInfo {
 		fmt.Println()
@@ -142,14 +376,20 @@ func runRead(cmd *cobra.Command, args []string) {
 	}
 
 	// Read USIM data
-	if !outputJSON {
+	if !outputJSON && !sim.IsClassicSIM() {
 		fmt.Println()
 		printSuccess("Reading USIM application...")
 	}
 	usimData, err := sim.ReadUSIM(reader)
-	if err != nil {
+	if errors.Is(err, sim.ErrClassicSIM) {
+		// One line instead of failing USIM and ISIM reads: DF_GSM is all the card has
+		printWarning(sim.DetectedDIRProbe.String() + ", USIM and ISIM skipped")
+		if gsm, gsmErr := sim.ReadGSM(reader); gsmErr == nil && !outputJSON {
+			output.PrintGSMData(gsm)
+		}
+	} else if err != nil {
+		printError(fmt.Sprintf("Failed to read USIM: %v", err))
 		if !outputJSON {
-			printError(fmt.Sprintf("Failed to read USIM: %v", err))
 			// If USIM failed and not in analyze mode, suggest it
 			if !analyzeCard {
 				printWarning("Tip: Use --analyze flag to examine the card structure")
@@ -162,36 +402,70 @@ func runRead(cmd *cobra.Command, args []string) {
 				}
 			}
 		}
-	} else if !outputJSON {
-		output.PrintUSIMData(usimData)
+	} else {
+		// Absent optional files are quiet; unexpected failures are worth a warning
+		for _, issue := range usimData.ReadIssues() {
+			printWarning("USIM: " + issue)
+		}
+		for _, w := range usimData.Warnings {
+			printWarning("USIM: " + w)
+		}
+		if !outputJSON {
+			output.PrintUSIMData(usimData)
+		}
 	}
 
 	// Read ISIM data (only if USIM was found)
 	var isimData *sim.ISIMData
+	var isimInstances []sim.ISIMInstance
 	if usimData != nil {
 		if !outputJSON {
 			fmt.Println()
 			printSuccess("Reading ISIM application...")
 		}
-		isimData, err = sim.ReadISIM(reader)
-		if err != nil {
+		if sim.HasMultipleISIMs() {
+			// Several ISIM applications in EF_DIR: read and show each one
+			isimInstances = sim.ReadISIMInstances(reader)
+			for _, inst := range isimInstances {
+				if inst.Err != nil {
+					printWarning(fmt.Sprintf("ISIM %d (%s): %v", inst.Index, inst.AID, inst.Err))
+				}
+			}
+			if first := isimInstances[0]; first.Err == nil {
+				isimData = first.Data
+			}
 			if !outputJSON {
+				output.PrintISIMInstances(isimInstances)
+			}
+		} else {
+			// ISIM on its own logical channel keeps ADF_USIM selected on the basic channel
+			err = sim.WithISIMChannel(reader, func() error {
+				var isimErr error
+				isimData, isimErr = sim.ReadISIM(reader)
+				return isimErr
+			})
+			if err != nil {
 				printWarning(fmt.Sprintf("ISIM: %v", err))
+			} else {
+				for _, issue := range isimData.ReadIssues() {
+					printWarning("ISIM: " + issue)
+				}
+				if !outputJSON {
+					output.PrintISIMData(isimData)
+				}
 			}
-		} else if !outputJSON {
-			output.PrintISIMData(isimData)
 		}
 	}
 
 	// Read Phonebook if requested
 	if showPhonebook {
 		fmt.Println()
-		printSuccess("Reading Phonebook (EF_ADN)...")
-		entries, err := sim.ReadPhonebook(reader)
+		printSuccess("Reading Phonebook (DF_PHONEBOOK/EF_PBR, else EF_ADN)...")
+		pb, err := sim.ReadPhonebook(reader)
 		if err != nil {
 			printWarning(fmt.Sprintf("Phonebook: %v", err))
 		} else {
-			output.PrintPhonebook(entries)
+			output.PrintPhonebook(pb)
 		}
 	}
 
@@ -207,6 +481,56 @@ func runRead(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	// Read call information if requested
+	var callInfo *sim.CallInfo
+	if showCallInfo {
+		if !outputJSON {
+			fmt.Println()
+		}
+		printSuccess("Reading call information (EF_ICI/EF_OCI/EF_ACM)...")
+		callInfo, err = sim.ReadCallInfo(reader)
+		if err != nil {
+			printWarning(fmt.Sprintf("Call info: %v", err))
+		} else if !outputJSON {
+			output.PrintCallInfo(callInfo)
+		}
+	}
+
+	// Read barred dialling numbers if requested
+	var bdn *sim.BDNList
+	if showBDN {
+		if !outputJSON {
+			fmt.Println()
+		}
+		printSuccess("Reading barred dialling numbers (EF_BDN)...")
+		bdn, err = sim.ReadBDN(reader)
+		switch {
+		case errors.Is(err, sim.ErrBDNNotAllocated):
+			// Optional file: not a read problem, so not a JSON warning either
+			if !outputJSON {
+				output.PrintWarning(err.Error())
+			}
+		case err != nil:
+			printWarning(fmt.Sprintf("BDN: %v", err))
+		case !outputJSON:
+			output.PrintBDN(bdn)
+		}
+	}
+
+	// Read the steering of roaming files if requested
+	var sor *sim.SORData
+	if showSOR {
+		if !outputJSON {
+			fmt.Println()
+		}
+		printSuccess("Reading steering of roaming files...")
+		if sor, err = sim.ReadSOR(reader); err != nil {
+			printWarning(fmt.Sprintf("Steering of roaming: %v", err))
+		} else if !outputJSON {
+			output.PrintSOR(sor)
+		}
+	}
+
 	// Show GlobalPlatform applets if requested
 	if showApplets {
 		fmt.Println()
@@ -219,14 +543,57 @@ func runRead(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	// Output JSON if requested
+	// Show OTA counters if requested
+	if showOTAInfo {
+		fmt.Println()
+		printSuccess("Reading OTA counters...")
+		otaInfo, err := sim.ReadOTACounters(reader)
+		if err != nil {
+			printWarning(fmt.Sprintf("OTA counters: %v", err))
+		} else {
+			output.PrintOTAInfo(otaInfo)
+		}
+	}
+
+	// Subscriber key of test cards, only read with --show-ki and the acknowledgment
+	var ki []byte
+	if showKi {
+		ki = readKiForDisplay(reader)
+	}
+
+	// Subscriber record for the core network (keys from --core-* flags)
+	exportCoreSubscriber(usimData, nil, "")
+
+	// Output JSON/YAML if requested
 	if outputJSON {
 		jsonConfig := sim.ExportToConfig(usimData, isimData)
+		jsonConfig.CallInfo = callInfo
+		jsonConfig.BDN = bdn
+		jsonConfig.SOR = sor
+		if len(isimInstances) > 0 {
+			jsonConfig.ISIMInstances = sim.ExportISIMInstances(isimInstances)
+		}
+		// card_type and card-specific settings, so the export can be re-applied to the same card type
+		jsonConfig.Programmable = sim.ReadProgrammableInfo(reader, sim.FindDriver(reader))
+		if ki != nil {
+			printKi(ki, jsonConfig)
+		}
+		jsonConfig.Warnings = jsonWarnings
+		jsonConfig.Profile = metricsReport()
+		if outputYAML {
+			yamlData, err := sim.MarshalConfigYAML(jsonConfig)
+			if err != nil {
+				printError(fmt.Sprintf("YAML export failed: %v", err))
+			} else {
+				printDocument(yamlData)
+			}
+			return
+		}
 		jsonData, err := json.MarshalIndent(jsonConfig, "", "  ")
 		if err != nil {
 			printError(fmt.Sprintf("JSON export failed: %v", err))
 		} else {
-			fmt.Println(string(jsonData))
+			printDocument(jsonData)
 		}
 		return
 	}
@@ -241,17 +608,30 @@ func runRead(cmd *cobra.Command, args []string) {
 		if usimData != nil && len(usimData.RawFiles) > 0 {
 			fmt.Println()
 			printSuccess("USIM Raw Data:")
-			output.PrintRawData(usimData.RawFiles)
+			output.PrintRawData("ADF_USIM", usimData.RawFiles)
 		}
 		if isimData != nil && isimData.Available && len(isimData.RawFiles) > 0 {
 			fmt.Println()
 			printSuccess("ISIM Raw Data:")
-			output.PrintRawData(isimData.RawFiles)
+			output.PrintRawData("ADF_ISIM", isimData.RawFiles)
 		}
 	}
 
+	// Cached CK/IK/Kc are only shown on request
+	if showKeys {
+		output.PrintSecurityContexts(sim.ReadSecurityContexts(reader))
+	}
+	if showFiveGContext {
+		output.PrintFiveGData(sim.ReadFiveGData(reader), revealSecrets)
+	}
+	if ki != nil {
+		printKi(ki, nil)
+	}
+
 	// Dump test data if requested
-	if dumpTestData != "" {
+	if dumpTestData != "" && dumpFormat == "fixture" {
+		writeFixtureDump(reader)
+	} else if dumpTestData != "" {
 		fmt.Println()
 		printSuccess("Generating test data dump...")
 		fmt.Println()
@@ -265,3 +645,197 @@ func runRead(cmd *cobra.Command, args []string) {
 	}
 }
 
+// runVerifyConfig compares the card with the --verify-config file and reports whether it matched
+func runVerifyConfig(reader *card.Reader) bool {
+	config, err := sim.LoadConfig(verifyConfigPath)
+	if err != nil {
+		printError(fmt.Sprintf("Failed to load config: %v", err))
+		return false
+	}
+
+	printSuccess(fmt.Sprintf("Verifying card against %s...", verifyConfigPath))
+	report, err := sim.VerifyConfig(reader, config)
+	if err != nil {
+		printError(fmt.Sprintf("Verify failed: %v", err))
+		return false
+	}
+
+	if outputJSON {
+		jsonData, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			printError(fmt.Sprintf("JSON export failed: %v", err))
+			return false
+		}
+		printDocument(jsonData)
+	} else {
+		output.PrintVerifyReport(report)
+	}
+	return report.OK()
+}
+
+// runDecodeTLV parses a hex string as BER-TLV and prints it as a tree (or JSON)
+// runListAIDs prints the EF_DIR records and the AIDs selected for USIM/ISIM (JSON with --json)
+func runListAIDs(reader *card.Reader) {
+	records, err := sim.ReadEFDIRRecords(reader)
+	if err != nil {
+		printWarning(err.Error())
+	}
+
+	if outputJSON {
+		doc := struct {
+			Records []sim.EFDIRRecord `json:"records"`
+			USIMAID string            `json:"usim_aid"`
+			ISIMAID string            `json:"isim_aid"`
+		}{records, fmt.Sprintf("%X", sim.GetUSIMAID()), fmt.Sprintf("%X", sim.GetISIMAID())}
+		jsonData, jerr := json.MarshalIndent(doc, "", "  ")
+		if jerr != nil {
+			printError(fmt.Sprintf("JSON export failed: %v", jerr))
+			return
+		}
+		printDocument(jsonData)
+		return
+	}
+	output.PrintEFDIRRecords(records, sim.GetUSIMAID(), sim.GetISIMAID())
+}
+
+// runUsage prints the record usage and EF sizes of the card (JSON with --json)
+func runUsage(reader *card.Reader) {
+	if !outputJSON {
+		printSuccess("Collecting record usage and EF sizes...")
+	}
+	stats, err := sim.CollectUsageStats(reader)
+	if err != nil {
+		printError(fmt.Sprintf("Usage statistics failed: %v", err))
+		return
+	}
+	if outputJSON {
+		jsonData, jerr := json.MarshalIndent(stats, "", "  ")
+		if jerr != nil {
+			printError(fmt.Sprintf("JSON export failed: %v", jerr))
+			return
+		}
+		printDocument(jsonData)
+		return
+	}
+	output.PrintUsageStats(stats)
+}
+
+// runCompareServices prints the UST/EST/IST matrix of the card exports in a directory
+// (JSON with --json, markdown with --output-format md) and saves it as CSV with --compare-csv
+func runCompareServices() {
+	matrix, err := sim.LoadServiceMatrix(compareServices)
+	if err != nil {
+		printError(fmt.Sprintf("Service comparison failed: %v", err))
+		return
+	}
+	if compareCSV != "" {
+		var buf bytes.Buffer
+		if err := matrix.WriteCSV(&buf); err != nil {
+			printError(fmt.Sprintf("CSV export failed: %v", err))
+			return
+		}
+		if err := os.WriteFile(compareCSV, buf.Bytes(), 0644); err != nil {
+			printError(fmt.Sprintf("CSV export failed: %v", err))
+			return
+		}
+	}
+	if outputJSON {
+		jsonData, err := json.MarshalIndent(matrix, "", "  ")
+		if err != nil {
+			printError(fmt.Sprintf("JSON export failed: %v", err))
+			return
+		}
+		printDocument(jsonData)
+		return
+	}
+	output.PrintServiceMatrix(matrix)
+	if compareCSV != "" {
+		printSuccess(fmt.Sprintf("Service matrix saved to %s", compareCSV))
+	}
+}
+
+// runReaderSelfTest runs the reader diagnostic and prints the report (JSON with --json)
+func runReaderSelfTest() {
+	if err := resolveReaderIndex(); err != nil {
+		printError(err.Error())
+		return
+	}
+	if !outputJSON {
+		printSuccess("Running reader self-test (this takes a few seconds)...")
+	}
+	selfTest := card.SelfTest
+	if readerBackend == backendCCID {
+		selfTest = card.SelfTestCCID
+	}
+	report, err := selfTest(readerIndex)
+	if err != nil {
+		printError(fmt.Sprintf("Self-test failed: %v", err))
+		return
+	}
+
+	if outputJSON {
+		jsonData, jerr := json.MarshalIndent(report, "", "  ")
+		if jerr != nil {
+			printError(fmt.Sprintf("JSON export failed: %v", jerr))
+			return
+		}
+		printDocument(jsonData)
+	} else {
+		output.PrintSelfTestReport(report)
+	}
+	if report.Verdict != card.SelfTestHealthy {
+		os.Exit(1)
+	}
+}
+
+func runDecodeEF(name string, args []string) {
+	if len(args) == 0 {
+		printError("--decode-ef needs the file content as hex, e.g. --decode-ef EF_IMSI 082905880000000010")
+		return
+	}
+	data, err := sim.ParseHexBytes(strings.ReplaceAll(strings.Join(args, ""), ":", ""))
+	if err != nil {
+		printError(fmt.Sprintf("Invalid hex: %v", err))
+		return
+	}
+	decoded, err := sim.DecodeEF(name, data)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+
+	if outputJSON {
+		jsonData, jerr := json.MarshalIndent(decoded, "", "  ")
+		if jerr != nil {
+			printError(fmt.Sprintf("JSON export failed: %v", jerr))
+			return
+		}
+		printDocument(jsonData)
+		return
+	}
+	output.PrintDecodedEF(decoded)
+}
+
+func runDecodeTLV(hexStr string) {
+	nodes, err := tlv.ParseHex(hexStr)
+	if err != nil && len(nodes) == 0 {
+		printError(fmt.Sprintf("TLV decode failed: %v", err))
+		return
+	}
+
+	if outputJSON {
+		jsonData, jerr := json.MarshalIndent(nodes, "", "  ")
+		if jerr != nil {
+			printError(fmt.Sprintf("JSON export failed: %v", jerr))
+			return
+		}
+		printDocument(jsonData)
+	} else {
+		ctx := tlv.DetectContext(nodes)
+		printSuccess(fmt.Sprintf("BER-TLV (%s tags):", ctx))
+		fmt.Print(tlv.Format(nodes, ctx, "  "))
+	}
+	if err != nil {
+		printWarning(fmt.Sprintf("Trailing data not decoded: %v", err))
+	}
+}
@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// ============ JSON OUTPUT TESTS ============
+
+var testUSIMAID = []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02, 0xFF, 0x49, 0xFF, 0x05, 0x89}
+
+// newTestCard builds a simulated USIM without ISIM, phonebook or SMS
+func newTestCard() *card.MockCard {
+	m := card.NewMockCard([]byte{0x3B, 0x9F, 0x96, 0x80, 0x1F, 0xC7, 0x80, 0x31, 0xE0, 0x73, 0xF6, 0xA1, 0x57, 0x57, 0x4A, 0x4D, 0x02, 0x0B, 0x61, 0x10, 0x00, 0x5B})
+	mf := m.MF()
+	mf.AddEF(0x2FE2, []byte{0x98, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10, 0x32, 0x54, 0xF6})
+
+	dirRecord := append([]byte{0x61, 0x12, 0x4F, 0x0C}, testUSIMAID...)
+	dirRecord = append(dirRecord, 0x50, 0x02, 'U', 'S')
+	mf.AddRecordEF(0x2F00, append(dirRecord, 0xFF, 0xFF))
+
+	usim := m.AddADF(testUSIMAID)
+	usim.AddEF(0x6F07, []byte{0x08, 0x09, 0x10, 0x10, 0x00, 0x00, 0x00, 0x00, 0x10})
+	usim.AddEF(0x6FAD, []byte{0x00, 0x00, 0x00, 0x02})
+	usim.AddEF(0x6F46, []byte{0x01, 'T', 'e', 's', 't', 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	return m
+}
+
+// runCapture executes the root command and returns what was written to stdout and stderr
+func runCapture(t *testing.T, args ...string) (string, string) {
+	t.Helper()
+	stdoutR, stdoutW, _ := os.Pipe()
+	stderrR, stderrW, _ := os.Pipe()
+	origOut, origErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdoutW, stderrW
+
+	var outBuf, errBuf bytes.Buffer
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(&outBuf, stdoutR); done <- struct{}{} }()
+	go func() { io.Copy(&errBuf, stderrR); done <- struct{}{} }()
+
+	rootCmd.SetArgs(args)
+	err := rootCmd.Execute()
+
+	os.Stdout, os.Stderr = origOut, origErr
+	stdoutW.Close()
+	stderrW.Close()
+	<-done
+	<-done
+	if err != nil {
+		t.Fatalf("Execute(%v) error = %v\nstderr:\n%s", args, err, errBuf.String())
+	}
+	return outBuf.String(), errBuf.String()
+}
+
+func TestReadJSON_StdoutIsSingleDocument(t *testing.T) {
+	mock := newTestCard()
+	openReader = func(int, ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		outputJSON, showPhonebook, showSMS = false, false, false
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	}()
+
+	stdout, stderr := runCapture(t, "read", "-r", "0", "--json", "--phonebook", "--sms")
+
+	dec := json.NewDecoder(bytes.NewReader([]byte(stdout)))
+	var config sim.SIMConfig
+	if err := dec.Decode(&config); err != nil {
+		t.Fatalf("stdout is not valid JSON: %v\nstdout:\n%s", err, stdout)
+	}
+	if dec.More() {
+		t.Fatalf("stdout carries more than one JSON document:\n%s", stdout)
+	}
+
+	if config.IMSI != "001010000000001" {
+		t.Errorf("IMSI = %q, want 001010000000001", config.IMSI)
+	}
+	if len(config.Warnings) == 0 {
+		t.Errorf("expected warnings for missing ISIM/phonebook/SMS, got none")
+	}
+	if stderr == "" {
+		t.Errorf("expected diagnostics on stderr")
+	}
+}
+
+func TestReadJSON_Profile(t *testing.T) {
+	mock := newTestCard()
+	openReader = func(_ int, opts ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock, opts...), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		outputJSON, profileMode, profileMetrics = false, false, nil
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	}()
+
+	stdout, stderr := runCapture(t, "read", "-r", "0", "--json", "--profile")
+
+	var config sim.SIMConfig
+	if err := json.Unmarshal([]byte(stdout), &config); err != nil {
+		t.Fatalf("stdout is not valid JSON: %v\nstdout:\n%s", err, stdout)
+	}
+	if config.Profile == nil || config.Profile.APDUs == 0 {
+		t.Fatalf("profile = %+v, want the APDUs of the read", config.Profile)
+	}
+	for _, name := range []string{"connect", "read USIM"} {
+		if _, ok := config.Profile.Operation(name); !ok {
+			t.Errorf("profile has no %q: %+v", name, config.Profile.Operations)
+		}
+	}
+	if op, _ := config.Profile.Operation("read USIM"); op.APDUs == 0 || op.APDUs > config.Profile.APDUs {
+		t.Errorf("read USIM = %+v of %d APDUs", op, config.Profile.APDUs)
+	}
+	if !strings.Contains(stderr, "PROFILE") {
+		t.Errorf("breakdown not printed on stderr:\n%s", stderr)
+	}
+}
+
+// ============ FILE MAP CACHE TESTS ============
+
+func TestRead_FileMapCache(t *testing.T) {
+	mock := newTestCard()
+	openReader = func(int, ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock), nil
+	}
+	noCache = false
+	defer func() {
+		openReader = card.Connect
+		outputJSON, noCache, refreshCache = false, true, false
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	}()
+
+	ustSelects := func() int {
+		n := 0
+		for _, apdu := range mock.Log {
+			if len(apdu) == 7 && apdu[1] == 0xA4 && apdu[5] == 0x6F && apdu[6] == 0x38 {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Export run: EF_UST (6F38) is absent from the test card and recorded as such
+	runCapture(t, "read", "-r", "0", "--json")
+	first := ustSelects()
+	if first == 0 {
+		t.Fatal("EF_UST never selected in the first run")
+	}
+	path, err := sim.FileMapPath("8901234567890123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file map not saved: %v", err)
+	}
+
+	// Plain read: the absent file is not selected again
+	mock.Log = nil
+	outputJSON = false
+	stdout, _ := runCapture(t, "read", "-r", "0")
+	if n := ustSelects(); n != 0 {
+		t.Errorf("EF_UST selected %d times with the cached map", n)
+	}
+	if !bytes.Contains([]byte(stdout), []byte("Using cached file map")) {
+		t.Errorf("stdout does not mention the cached map:\n%s", stdout)
+	}
+
+	// --no-cache probes everything again
+	mock.Log = nil
+	runCapture(t, "read", "-r", "0", "--no-cache")
+	if n := ustSelects(); n != first {
+		t.Errorf("EF_UST selected %d times with --no-cache, want %d", n, first)
+	}
+}
+
+// ============ RESET POLICY TESTS ============
+
+func TestRead_ResetPolicy(t *testing.T) {
+	mock := newTestCard()
+	openReader = func(_ int, opts ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock, opts...), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		resetFlag, compareATR = "warm", false
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	}()
+
+	runCapture(t, "read", "-r", "0", "--reset", "none")
+	if len(mock.Resets) != 0 {
+		t.Errorf("resets with --reset none = %v, want none", mock.Resets)
+	}
+
+	// Another card answers the warm reset with other historical bytes
+	mock.Resets = nil
+	mock.WarmATR = []byte{0x3B, 0x9F, 0x96, 0x80, 0x1F, 0xC7, 0x80, 0x31, 0xE0, 0x73, 0xF6, 0xA1, 0x57, 0x57, 0x4A, 0x4D, 0x02, 0x0B, 0x61, 0x11, 0x00, 0x5A}
+	stdout, _ := runCapture(t, "read", "-r", "0", "--reset", "warm", "--compare-atr")
+	if len(mock.Resets) != 2 || !mock.Resets[0] || mock.Resets[1] {
+		t.Errorf("resets with --compare-atr = %v, want cold then warm", mock.Resets)
+	}
+	if !strings.Contains(stdout, "Historical bytes differ") {
+		t.Errorf("ATR difference not reported:\n%s", stdout)
+	}
+}
+
+func TestRead_ShowKiFlags(t *testing.T) {
+	mock := newTestCard()
+	openReader = func(_ int, opts ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock, opts...), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		showKi, ackSensitiveKeys, revealSecrets = false, false, false
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	}()
+
+	// Refused before connecting without the acknowledgment
+	stdout, _ := runCapture(t, "read", "-r", "0", "--show-ki")
+	if !strings.Contains(stdout, "--i-understand-keys-are-sensitive") || len(mock.Log) != 0 {
+		t.Errorf("--show-ki alone: %q, %d APDUs sent", stdout, len(mock.Log))
+	}
+	showKi = false
+	stdout, _ = runCapture(t, "read", "-r", "0", "--reveal-secrets")
+	if !strings.Contains(stdout, "no effect without --show-ki") {
+		t.Errorf("--reveal-secrets alone: %q", stdout)
+	}
+
+	// A card without a Ki-reading driver is reported, the read goes on
+	revealSecrets = false
+	stdout, _ = runCapture(t, "read", "-r", "0", "--show-ki", "--i-understand-keys-are-sensitive")
+	if !strings.Contains(stdout, "Ki: no programmable card driver") || !strings.Contains(stdout, "Done!") {
+		t.Errorf("no driver:\n%s", stdout)
+	}
+}
+
+func TestRead_Show5GContext(t *testing.T) {
+	mock := newTestCard()
+	for _, f := range mock.MF().Children {
+		if f.AID != nil {
+			nsc := []byte{0xA0, 0x28, 0x80, 0x01, 0x03, 0x81, 0x20}
+			nsc = append(nsc, bytes.Repeat([]byte{0x5A}, 32)...)
+			nsc = append(nsc, 0x84, 0x01, 0x22)
+			f.AddDF(0x5FC0).AddRecordEF(0x4F03, nsc)
+		}
+	}
+	openReader = func(_ int, opts ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock, opts...), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		showFiveGContext, revealSecrets = false, false
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	}()
+
+	stdout, _ := runCapture(t, "read", "-r", "0", "--show-5g-context")
+	for _, want := range []string{"5G NAS SECURITY CONTEXT", "EF_5GS3GPPNSC #1", "5G-EA2/5G-IA2", "K_AMF redacted"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output does not contain %q:\n%s", want, stdout)
+		}
+	}
+	if strings.Contains(stdout, strings.Repeat("5A", 32)) {
+		t.Error("K_AMF shown without --reveal-secrets")
+	}
+
+	stdout, _ = runCapture(t, "read", "-r", "0", "--show-5g-context", "--reveal-secrets")
+	if !strings.Contains(stdout, strings.Repeat("5A", 32)) {
+		t.Errorf("K_AMF not revealed:\n%s", stdout)
+	}
+}
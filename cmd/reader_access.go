@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sim_reader/card"
+)
+
+var (
+	// waitForReader retries a busy or unavailable reader (--wait-for-reader)
+	waitForReader time.Duration
+	// readerWaitInterval is the delay between connection attempts (shortened by tests)
+	readerWaitInterval = time.Second
+
+	// exclusiveAccess is set for commands that write to the card (see writesCard)
+	exclusiveAccess bool
+)
+
+// Commands annotated with writeAccess connect to the reader exclusively
+const cardAccessAnnotation = "card-access"
+
+var writeAccess = map[string]string{cardAccessAnnotation: "write"}
+
+// writesCard reports whether cmd writes to the card
+func writesCard(cmd *cobra.Command) bool {
+	return cmd.Annotations[cardAccessAnnotation] == "write"
+}
+
+// connectWithWait connects to the reader, retrying for --wait-for-reader while it is used
+// by another application or unavailable
+func connectWithWait(index int, opts ...card.ConnectOption) (*card.Reader, error) {
+	reader, err := connectBackend(index, opts...)
+	if err == nil || waitForReader <= 0 {
+		return reader, err
+	}
+	deadline := time.Now().Add(waitForReader)
+	for err != nil && (errors.Is(err, card.ErrReaderBusy) || errors.Is(err, card.ErrReaderUnavailable)) {
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("still not available after %s: %w", waitForReader, err)
+		}
+		printWarning(fmt.Sprintf("%v, retrying (--wait-for-reader %s)", rootCause(err), waitForReader))
+		time.Sleep(readerWaitInterval)
+		reader, err = connectBackend(index, opts...)
+	}
+	return reader, err
+}
+
+// rootCause returns the error class of a connection error, for the retry messages
+func rootCause(err error) error {
+	for _, class := range []error{card.ErrReaderBusy, card.ErrReaderUnavailable} {
+		if errors.Is(err, class) {
+			return class
+		}
+	}
+	return err
+}
+
+// explainConnectError prints what to do about a failed connection: the error class, the
+// processes holding the reader device when /proc shows them, and the pcscd hints
+func explainConnectError(err error) {
+	switch {
+	case errors.Is(err, card.ErrReaderBusy):
+		if exclusiveAccess && !readOnly && !dryRun {
+			printWarning("Reader busy: writing needs exclusive access and another application is using the reader")
+		} else {
+			printWarning("Reader busy: another application holds the reader exclusively")
+		}
+		for _, h := range readerDeviceHolders() {
+			printWarning("  " + h.String())
+		}
+		printWarning("Close the other application (ModemManager, pcsc_scan, another sim_reader...) or retry with --wait-for-reader 30s")
+	case errors.Is(err, card.ErrReaderUnavailable):
+		printWarning("Reader unavailable: unplugged, or claimed by another driver. Check with 'sim_reader read --list'; " +
+			"restart pcscd (systemctl restart pcscd) if it stays unavailable, or retry with --wait-for-reader 30s")
+	case errors.Is(err, card.ErrNoPCSCService):
+		printWarning("pcscd is not running: start it (systemctl start pcscd) or use --backend ccid")
+	}
+}
+
+// readerDeviceHolders lists the processes that have a CCID reader device open. Through
+// pcscd the holder is pcscd itself, which does not tell which of its clients has the card.
+func readerDeviceHolders() []card.DeviceHolder {
+	devices, err := card.FindCCIDDevices()
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, d := range devices {
+		paths = append(paths, d.Path)
+	}
+	holders := card.DeviceHolders(paths...)
+	if readerBackend == backendPCSC {
+		var others []card.DeviceHolder
+		for _, h := range holders {
+			if h.Name != "pcscd" {
+				others = append(others, h)
+			}
+		}
+		return others
+	}
+	return holders
+}
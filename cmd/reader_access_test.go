@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// ============ READER ACCESS TESTS ============
+
+func TestConnect_WaitForReader(t *testing.T) {
+	mock := newTestCard()
+	attempts := 0
+	openReader = func(_ int, opts ...card.ConnectOption) (*card.Reader, error) {
+		attempts++
+		if attempts <= 2 {
+			return nil, fmt.Errorf("%w (sharing violation): busy", card.ErrReaderBusy)
+		}
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock, opts...), nil
+	}
+	readerWaitInterval = time.Millisecond
+	defer func() {
+		openReader = card.Connect
+		readerWaitInterval = time.Second
+		waitForReader = 0
+		outputJSON = false
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	}()
+
+	stdout, _ := runCapture(t, "read", "-r", "0", "--json", "--wait-for-reader", "5s")
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+	if !strings.Contains(stdout, "retrying (--wait-for-reader 5s)") {
+		t.Errorf("expected a retry warning, got:\n%s", stdout)
+	}
+
+	// Without --wait-for-reader the first failure is reported
+	attempts = 0
+	waitForReader = 0
+	if _, err := connectWithWait(0); err == nil || attempts != 1 {
+		t.Errorf("connectWithWait() err = %v after %d attempts, want an error after 1", err, attempts)
+	}
+}
+
+func TestConnect_WaitForReaderGivesUp(t *testing.T) {
+	attempts := 0
+	openReader = func(int, ...card.ConnectOption) (*card.Reader, error) {
+		attempts++
+		return nil, fmt.Errorf("%w: gone", card.ErrReaderUnavailable)
+	}
+	readerWaitInterval = time.Millisecond
+	waitForReader = 20 * time.Millisecond
+	defer func() {
+		openReader = card.Connect
+		readerWaitInterval = time.Second
+		waitForReader = 0
+	}()
+
+	_, err := connectWithWait(0)
+	if err == nil || !strings.Contains(err.Error(), "still not available after 20ms") {
+		t.Fatalf("connectWithWait() err = %v", err)
+	}
+	if attempts < 2 {
+		t.Errorf("attempts = %d, want retries", attempts)
+	}
+}
+
+func TestConnect_ShareMode(t *testing.T) {
+	if !writesCard(writeCmd) || !writesCard(gpLoadCmd) || !writesCard(scriptRunCmd) {
+		t.Error("writing commands must be annotated with writeAccess")
+	}
+	if writesCard(readCmd) {
+		t.Error("read must not be annotated with writeAccess")
+	}
+
+	mode := func() card.ShareMode {
+		r := card.NewReaderWithTransport("Mock Reader", nil, card.NewMockCard(nil), readerConnectOptions()...)
+		return r.ShareMode()
+	}
+	defer func() { exclusiveAccess, readOnly, dryRun = false, false, false }()
+
+	exclusiveAccess = true
+	if got := mode(); got != card.ShareExclusive {
+		t.Errorf("write: share mode = %s, want exclusive", got)
+	}
+	readOnly = true
+	if got := mode(); got != card.ShareShared {
+		t.Errorf("write --read-only: share mode = %s, want shared", got)
+	}
+	readOnly, dryRun = false, true
+	if got := mode(); got != card.ShareShared {
+		t.Errorf("write --dry-run: share mode = %s, want shared", got)
+	}
+	exclusiveAccess, dryRun = false, false
+	if got := mode(); got != card.ShareShared {
+		t.Errorf("read: share mode = %s, want shared", got)
+	}
+}
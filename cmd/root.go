@@ -1,12 +1,16 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"sim_reader/card"
+	"sim_reader/inputs"
 	"sim_reader/output"
 	"sim_reader/sim"
 )
@@ -21,7 +25,32 @@ var (
 	admKey3     string
 	admKey4     string
 	pin1        string
+	forcePIN1   bool
+	pin2        string
 	outputJSON  bool
+	fastMode    bool
+	maxAPDUSize int
+	dryRun      bool
+	debugADM    bool
+	debugSelect bool
+	usimAIDFlag string
+	isimAIDFlag string
+	retryCount  int
+	retryDelay  time.Duration
+	outputStyle string
+	noColor     bool
+	readOnly    bool
+	resetFlag   string
+	compareATR  bool
+
+	// readAllFiles selects optional USIM files even when the UST rules them out
+	readAllFiles bool
+
+	// readerBackend selects PC/SC or the direct USB CCID driver (--backend)
+	readerBackend string
+
+	// sessionReader is the reader opened by connectAndPrepareReader (for the dry-run summary)
+	sessionReader *card.Reader
 )
 
 var rootCmd = &cobra.Command{
@@ -38,6 +67,70 @@ This tool supports:
   - SIM card test suites
   - Programmable card operations`,
 	Version: version,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if outputJSON {
+			beginJSONOutput()
+		}
+		// Decided after the JSON redirect so the TTY check sees the stream that gets the text
+		r, err := output.SelectRenderer(outputStyle, noColor, output.IsTerminal(os.Stdout))
+		if err != nil {
+			return err
+		}
+		output.SetRenderer(r)
+		if v := os.Getenv(readOnlyEnv); v == "1" || strings.EqualFold(v, "true") {
+			readOnly = true
+		}
+		if readerBackend != backendPCSC && readerBackend != backendCCID {
+			return fmt.Errorf("unknown --backend %q (pcsc, ccid)", readerBackend)
+		}
+		policy, err := card.ParseResetPolicy(resetFlag)
+		if err != nil {
+			return fmt.Errorf("--reset: %w", err)
+		}
+		if compareATR && policy == card.ResetNone {
+			return fmt.Errorf("--compare-atr resets the card and cannot be combined with --reset none")
+		}
+		if err := parseExpectFlags(); err != nil {
+			return err
+		}
+		exclusiveAccess = writesCard(cmd)
+		if profileMode {
+			startMetrics()
+		}
+		return nil
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		if sessionReader != nil && sessionReader.DryRun() {
+			output.PrintDryRunLog(sessionReader.DryRunLog())
+		}
+		printMetrics()
+		endJSONOutput()
+	},
+}
+
+// openReader connects to a PC/SC reader by index (replaced by tests)
+var openReader = card.Connect
+
+// Reader backends selected with --backend
+const (
+	backendPCSC = "pcsc"
+	backendCCID = "ccid" // USB CCID readers driven directly, without pcscd
+)
+
+// backendReaders lists the readers of the selected backend
+func backendReaders() ([]string, error) {
+	if readerBackend == backendCCID {
+		return card.ListCCIDReaders()
+	}
+	return card.ListReaders()
+}
+
+// connectBackend connects to the reader at index through the selected backend
+func connectBackend(index int, opts ...card.ConnectOption) (*card.Reader, error) {
+	if readerBackend == backendCCID {
+		return card.ConnectCCID(index, opts...)
+	}
+	return openReader(index, opts...)
 }
 
 func init() {
@@ -54,8 +147,71 @@ func init() {
 		"ADM4 key (for maximum access level)")
 	rootCmd.PersistentFlags().StringVarP(&pin1, "pin", "p", "",
 		"PIN1 code if card is PIN protected")
+	rootCmd.PersistentFlags().BoolVar(&forcePIN1, "force-pin", false,
+		"Verify PIN1 even if only one attempt is left (a wrong PIN blocks the card)")
+	rootCmd.PersistentFlags().StringVar(&pin2, "pin2", "",
+		"PIN2 code for PIN2-protected files (FDN, ACM, ACMmax, PUCT)")
 	rootCmd.PersistentFlags().BoolVar(&outputJSON, "json", false,
 		"Output in JSON format")
+	rootCmd.PersistentFlags().BoolVar(&fastMode, "fast", false,
+		"Try faster transmission parameters (TA1/PPS) after connect and report exchange speed (opt-in)")
+	rootCmd.PersistentFlags().IntVar(&maxAPDUSize, "max-apdu-size", 0,
+		"Limit command/response data size in bytes (for cards that advertise more than they deliver)")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false,
+		"Do not write to the card: log intended writes with current content, refuse GP DELETE/INSTALL/LOAD/STORE DATA")
+	rootCmd.PersistentFlags().BoolVar(&debugADM, "debug-adm", false,
+		"Log the ADM key variants probed (reference, class, length, padding) and the card responses")
+	rootCmd.PersistentFlags().BoolVar(&debugSelect, "debug-select", false,
+		"Log the SELECT by AID response option (P2 04, 0C or 00) the card accepts")
+	rootCmd.PersistentFlags().StringVar(&usimAIDFlag, "usim-aid", "",
+		"USIM AID in hex, bypassing EF_DIR detection (for cards with a broken EF_DIR)")
+	rootCmd.PersistentFlags().StringVar(&isimAIDFlag, "isim-aid", "",
+		"ISIM AID in hex, bypassing EF_DIR detection (for cards with a broken EF_DIR)")
+	rootCmd.PersistentFlags().IntVar(&retryCount, "retry", 0,
+		"Recover from reader transport errors: warm reset, restore selection and PIN/ADM, re-send reads (attempts per command)")
+	rootCmd.PersistentFlags().DurationVar(&retryDelay, "retry-backoff", 200*time.Millisecond,
+		"Wait before the first recovery attempt, doubled for each further attempt")
+	rootCmd.PersistentFlags().StringVar(&outputStyle, "output-format", "",
+		"Console output format: color, plain or md (default: color on a terminal, plain otherwise)")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false,
+		"Disable ANSI colors and box drawing (same as --output-format plain)")
+	rootCmd.PersistentFlags().BoolVar(&readOnly, "read-only", false,
+		"Never send a state-changing command to the card (also set by "+readOnlyEnv+"=1)")
+	rootCmd.PersistentFlags().StringVar(&resetFlag, "reset", "warm",
+		"Card reset at session start and for --retry recovery: warm (cold if the warm reset fails), cold or none")
+	rootCmd.PersistentFlags().BoolVar(&compareATR, "compare-atr", false,
+		"Cold reset then warm reset the card at session start and report whether the ATRs differ")
+	rootCmd.PersistentFlags().BoolVar(&readAllFiles, "read-all-files", false,
+		"Select every optional USIM file, also those whose UST service is not available (default: skip them)")
+	rootCmd.PersistentFlags().StringVar(&readerBackend, "backend", backendPCSC,
+		"Reader backend: pcsc, or ccid to drive USB CCID readers directly without pcscd (Linux, see docs/CCID.md)")
+	rootCmd.PersistentFlags().StringVar(&profileStorePath, "profile-store", "",
+		"Remember the parameters that worked per card (by ICCID) in this file and fill in missing flags from it (e.g. ~/.sim_reader/cards.json)")
+	rootCmd.PersistentFlags().BoolVar(&forgetCard, "forget-card", false,
+		"Remove the connected card from --profile-store")
+	rootCmd.PersistentFlags().DurationVar(&waitForReader, "wait-for-reader", 0,
+		"Retry connecting for this long while the reader is used by another application or unavailable (e.g. 30s)")
+	rootCmd.PersistentFlags().StringVar(&expectICCID, "expect-iccid", "",
+		"Refuse to operate unless the inserted card has this ICCID (checked before any PIN, ADM key or write)")
+	rootCmd.PersistentFlags().StringVar(&expectIMSI, "expect-imsi", "",
+		"Refuse to operate unless EF_IMSI holds this IMSI (read after PIN1, or after the ADM keys if PIN1 is not enough)")
+	rootCmd.PersistentFlags().StringVar(&expectATR, "expect-atr", "",
+		"Refuse to operate unless the ATR matches this hex pattern, X or . for any nibble (e.g. '3B 9F 96 80 1F .. 80 31 ..')")
+	rootCmd.PersistentFlags().BoolVar(&profileMode, "profile", false,
+		"Print the wall time and APDU count of each operation at the end (added to the JSON result)")
+}
+
+// readOnlyEnv enables --read-only for every invocation (e.g. on shared lab machines)
+const readOnlyEnv = "SIM_READER_READONLY"
+
+// refuseReadOnly reports an operation that cannot run in read-only mode.
+// Called before connecting so nothing is sent to the card.
+func refuseReadOnly(op string) bool {
+	if !readOnly {
+		return false
+	}
+	printError(fmt.Sprintf("%s changes the card and is refused in read-only mode (--read-only / %s)", op, readOnlyEnv))
+	return true
 }
 
 // Execute runs the root command
@@ -70,65 +226,162 @@ func GetVersion() string {
 	return version
 }
 
+// resolveReaderIndex auto-selects the reader if only one is available and none was specified
+func resolveReaderIndex() error {
+	if readerIndex >= 0 {
+		return nil
+	}
+	readers, err := backendReaders()
+	if err != nil {
+		return fmt.Errorf("failed to list readers: %w", err)
+	}
+	if len(readers) == 0 {
+		return fmt.Errorf("no smart card readers found")
+	}
+	if len(readers) > 1 {
+		output.PrintReaderList(readers)
+		return fmt.Errorf("multiple readers found, use -r <index> to select one")
+	}
+	readerIndex = 0
+	if !outputJSON {
+		output.PrintSuccess(fmt.Sprintf("Auto-selected reader: %s", readers[0]))
+	}
+	return nil
+}
+
+// readerConnectOptions returns the connect options selected by the global flags
+func readerConnectOptions() []card.ConnectOption {
+	var opts []card.ConnectOption
+	// Validated in PersistentPreRunE
+	if policy, err := card.ParseResetPolicy(resetFlag); err == nil {
+		opts = append(opts, card.WithResetPolicy(policy))
+	}
+	if retryCount > 0 {
+		opts = append(opts,
+			card.WithRetry(retryCount, retryDelay),
+			card.WithRecoveryHandler(func(e card.RecoveryEvent) {
+				printWarning("Reader recovery: " + e.String())
+			}))
+	}
+	if debugSelect {
+		opts = append(opts, card.WithAIDSelectHandler(func(p2 byte) {
+			fmt.Printf("DEBUG SELECT: card accepts SELECT by AID with P2=%02X (%s), used for this session\n", p2, selectP2Name(p2))
+		}))
+	}
+	// Writing commands hold the reader exclusively, so that no other application can
+	// interleave its commands; everything else shares it (--read-only and --dry-run never write)
+	if exclusiveAccess && !readOnly && !dryRun {
+		opts = append(opts, card.WithShareMode(card.ShareExclusive))
+	}
+	// read --dump-format fixture records everything from the first APDU (EF_DIR, ADM verify)
+	if dumpTestData != "" && dumpFormat == "fixture" {
+		opts = append(opts, card.WithFixtureRecording())
+	}
+	// --profile: the reader counts its APDUs into the running operations
+	if profileMetrics != nil {
+		opts = append(opts, card.WithMetrics(profileMetrics))
+	}
+	return opts
+}
+
+// selectP2Name describes a SELECT response option
+func selectP2Name(p2 byte) string {
+	switch p2 {
+	case 0x04:
+		return "return FCP"
+	case 0x0C:
+		return "no response data"
+	default:
+		return "return FCI"
+	}
+}
+
 // connectAndPrepareReader is a helper that connects to the reader,
 // performs reset, verifies PIN and ADM keys. Returns reader or error.
 func connectAndPrepareReader() (*card.Reader, error) {
-	// Auto-select reader if only one available and none specified
-	if readerIndex < 0 {
-		readers, err := card.ListReaders()
-		if err != nil {
-			return nil, fmt.Errorf("failed to list readers: %w", err)
-		}
-		if len(readers) == 0 {
-			return nil, fmt.Errorf("no smart card readers found")
-		}
-		if len(readers) == 1 {
-			readerIndex = 0
-			if !outputJSON {
-				output.PrintSuccess(fmt.Sprintf("Auto-selected reader: %s", readers[0]))
-			}
-		} else {
-			output.PrintReaderList(readers)
-			return nil, fmt.Errorf("multiple readers found, use -r <index> to select one")
-		}
+	// Explicit AIDs replace EF_DIR detection for every later select
+	if err := sim.SetAIDOverrides(usimAIDFlag, isimAIDFlag); err != nil {
+		return nil, err
+	}
+
+	if err := resolveReaderIndex(); err != nil {
+		return nil, err
 	}
 
 	// Connect to reader
-	reader, err := card.Connect(readerIndex)
+	connected := measure("connect")
+	reader, err := connectWithWait(readerIndex, readerConnectOptions()...)
+	connected()
 	if err != nil {
+		explainConnectError(err)
 		return nil, fmt.Errorf("failed to connect: %w", err)
 	}
 
-	// Perform warm reset to ensure clean card state
-	if err := reader.Reconnect(false); err != nil {
-		// Warm reset failed, try cold reset
-		if err := reader.Reconnect(true); err != nil {
-			// If both fail, just continue - some readers don't support reset
-			if !outputJSON {
-				output.PrintWarning(fmt.Sprintf("Card reset failed: %v (continuing anyway)", err))
-			}
-		}
+	// Dry-run: state-changing commands are intercepted in the card layer
+	reader.SetDryRun(dryRun)
+	// Read-only: state-changing commands are refused in the card layer
+	reader.SetReadOnly(readOnly)
+	// Secure messaging for EFs that require it (read --sm-key-mac)
+	if smSession != nil {
+		reader.SetSecureMessaging(smSession)
+	}
+	sessionReader = reader
+
+	// Reset to ensure clean card state (--reset), or compare the cold and warm ATRs
+	if compareATR {
+		reportATRComparison(reader)
+	} else if err := reader.ApplyResetPolicy(); err != nil {
+		// Just continue - some readers don't support reset
+		printWarning(fmt.Sprintf("Card reset failed: %v (continuing anyway)", err))
 	}
 
 	if !outputJSON {
 		output.PrintReaderInfo(reader.Name(), reader.ATRHex())
 	}
 
-	// Detect card driver and set global card mode
-	drv := sim.FindDriver(reader)
+	// Expected card (--expect-atr, --expect-iccid): stop before anything else reaches the card
+	if err := checkExpectedCard(reader); err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	// Opt-in: negotiate faster parameters and measure the effect
+	if fastMode {
+		applyFastMode(reader)
+	}
+
+	// Detect card driver and set global card mode; the profile store (--profile-store)
+	// fills in what the flags and the ATR leave open
+	detected := sim.FindDriver(reader)
+	drv := applyCardProfile(reader, detected)
+	sim.InstallVendorSWTable(drv)
 	if drv != nil {
 		sim.UseGSMCommands = (drv.BaseCLA() == 0xA0)
 	} else {
 		sim.UseGSMCommands = sim.IsGSMOnlyCard(reader.ATRHex())
 	}
 
+	// Detect buffer sizes from ATR / EF_UMPC / EF.ATR (read chunking and GP block size)
+	reader.SetMaxAPDUSize(maxAPDUSize)
+	if !sim.UseGSMCommands {
+		reader.DetectCapabilities()
+	}
+
 	// Verify PIN1 if provided
 	if pin1 != "" {
 		if !outputJSON {
 			output.PrintSuccess("Verifying PIN1...")
 		}
-		if err := reader.VerifyPIN1(pin1); err != nil {
+		verifyPIN1 := reader.VerifyPIN1
+		if forcePIN1 {
+			verifyPIN1 = reader.VerifyPIN1Force
+		}
+		if err := verifyPIN1(pin1); err != nil {
 			reader.Close()
+			var perr *card.PinError
+			if errors.As(err, &perr) && perr.Refused {
+				return nil, fmt.Errorf("PIN1 verification failed: %w; use --force-pin to try anyway", err)
+			}
 			return nil, fmt.Errorf("PIN1 verification failed: %w", err)
 		}
 		if !outputJSON {
@@ -136,61 +389,143 @@ func connectAndPrepareReader() (*card.Reader, error) {
 		}
 	}
 
+	// PIN2 is verified on demand after selecting the application that owns the file
+	sim.SetPIN2(pin2)
+	sim.ReadAllFiles = readAllFiles
+
+	// Expected IMSI (--expect-imsi): readable with PIN1 on most cards, else after the ADM keys
+	imsiConfirmed, err := checkExpectedIMSI(reader, false)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	// Planned writes: stop before the ADM keys are verified when a credential is missing
+	if err := checkPlannedWriteAccess(reader); err != nil {
+		reader.Close()
+		return nil, err
+	}
+
 	// Verify ADM keys
-	if err := verifyADMKeys(reader); err != nil {
+	sim.DebugADM = debugADM
+	if err := verifyADMKeys(reader, drv); err != nil {
 		reader.Close()
 		return nil, err
 	}
+	if !imsiConfirmed {
+		if _, err := checkExpectedIMSI(reader, true); err != nil {
+			reader.Close()
+			return nil, err
+		}
+	}
 
 	// Always detect AIDs from EF_DIR first (silent, for non-standard cards)
 	sim.DetectApplicationAIDs(reader)
+	if !outputJSON {
+		if len(sim.OverrideUSIM_AID) > 0 {
+			output.PrintWarning(fmt.Sprintf("Using USIM AID %X from --usim-aid (EF_DIR ignored)", sim.OverrideUSIM_AID))
+		}
+		if len(sim.OverrideISIM_AID) > 0 {
+			output.PrintWarning(fmt.Sprintf("Using ISIM AID %X from --isim-aid (EF_DIR ignored)", sim.OverrideISIM_AID))
+		}
+	}
+
+	recordCardProfile(reader, detected)
 
 	return reader, nil
 }
 
-// verifyADMKeys verifies all provided ADM keys
-func verifyADMKeys(reader *card.Reader) error {
+// fastProbeRounds is the number of probe rounds used to measure exchange speed
+const fastProbeRounds = 20
+
+// applyFastMode measures exchange speed, attempts faster transmission parameters
+// and measures again. Failures are reported as warnings; the card is left usable.
+func applyFastMode(reader *card.Reader) {
+	before, err := reader.MeasureExchangeRate(fastProbeRounds)
+	if err != nil {
+		printWarning(fmt.Sprintf("Speed probe failed: %v (skipping --fast)", err))
+		return
+	}
+
+	res, err := reader.NegotiateFast()
+	if err != nil {
+		printWarning(fmt.Sprintf("Fast mode: %v", err))
+		return
+	}
+	if res.Note != "" {
+		printWarning(fmt.Sprintf("Fast mode: %s", res.Note))
+	}
+
+	after, err := reader.MeasureExchangeRate(fastProbeRounds)
+	if err != nil {
+		printWarning(fmt.Sprintf("Speed probe after negotiation failed: %v", err))
+		return
+	}
+
+	printSuccess(fmt.Sprintf("Link before: %s, %.1f APDU/s", res.Before, before.PerSecond()))
+	printSuccess(fmt.Sprintf("Link after:  %s, %.1f APDU/s", res.After, after.PerSecond()))
+	if before.PerSecond() > 0 {
+		printSuccess(fmt.Sprintf("Speed change: %+.0f%%", (after.PerSecond()/before.PerSecond()-1)*100))
+	}
+}
+
+// reportATRComparison cold resets then warm resets the card and reports the ATRs. Some
+// counterfeit cards answer different historical bytes to the two resets.
+func reportATRComparison(reader *card.Reader) {
+	cmp, err := reader.CompareResetATRs()
+	if err != nil {
+		printWarning(fmt.Sprintf("ATR comparison failed: %v (continuing anyway)", err))
+		return
+	}
+	printSuccess(fmt.Sprintf("ATR after cold reset: %X", cmp.Cold))
+	printSuccess(fmt.Sprintf("ATR after warm reset: %X", cmp.Warm))
+	switch {
+	case !cmp.Differ():
+		printSuccess("Cold and warm reset ATRs are identical")
+	case cmp.HistoricalBytesDiffer():
+		printWarning("Historical bytes differ between cold and warm reset (seen on counterfeit cards)")
+	default:
+		printWarning("Cold and warm reset ATRs differ in the interface bytes only, historical bytes are identical")
+	}
+}
+
+// verifyADMKeys verifies all provided ADM keys with the ADM profiles of drv (nil = generic probing)
+func verifyADMKeys(reader *card.Reader, drv sim.ProgrammableDriver) error {
 	// Verify ADM1 if provided
 	if admKey != "" {
-		key, err := card.ParseADMKey(admKey)
+		key, err := inputs.ADMKey("--adm", admKey)
 		if err != nil {
-			return fmt.Errorf("invalid ADM key: %w", err)
+			return err
 		}
 
 		if !outputJSON {
 			output.PrintSuccess(fmt.Sprintf("Verifying ADM1 (key: %s)...", card.KeyToHex(key)))
 		}
-		if err := reader.VerifyADM1(key); err != nil {
-			if !outputJSON {
-				output.PrintError(fmt.Sprintf("ADM1 verification failed: %v", err))
-				output.PrintWarning("Continuing without ADM access (some files may be restricted)")
-			}
+		if err := sim.VerifyADM(reader, drv, 1, key); err != nil {
+			printError(fmt.Sprintf("ADM1 verification failed: %v", err))
+			printWarning("Continuing without ADM access (some files may be restricted)")
 		} else {
 			sim.SetADMKey(key)
 			if !outputJSON {
 				output.PrintSuccess("ADM1 verified successfully")
 			}
 		}
-	} else {
-		if !outputJSON {
-			output.PrintWarning("No ADM key provided. Some protected files may not be readable.")
-		}
+	} else if !outputJSON {
+		output.PrintWarning("No ADM key provided. Some protected files may not be readable.")
 	}
 
 	// Verify ADM2 if provided
 	if admKey2 != "" {
-		key2, err := card.ParseADMKey(admKey2)
+		key2, err := inputs.ADMKey("--adm2", admKey2)
 		if err != nil {
-			return fmt.Errorf("invalid ADM2 key: %w", err)
+			return err
 		}
 
 		if !outputJSON {
 			output.PrintSuccess(fmt.Sprintf("Verifying ADM2 (key: %s)...", card.KeyToHex(key2)))
 		}
-		if err := reader.VerifyADM2(key2); err != nil {
-			if !outputJSON {
-				output.PrintError(fmt.Sprintf("ADM2 verification failed: %v", err))
-			}
+		if err := sim.VerifyADM(reader, drv, 2, key2); err != nil {
+			printError(fmt.Sprintf("ADM2 verification failed: %v", err))
 		} else {
 			sim.SetADMKey2(key2)
 			if !outputJSON {
@@ -201,18 +536,16 @@ func verifyADMKeys(reader *card.Reader) error {
 
 	// Verify ADM3 if provided
 	if admKey3 != "" {
-		key3, err := card.ParseADMKey(admKey3)
+		key3, err := inputs.ADMKey("--adm3", admKey3)
 		if err != nil {
-			return fmt.Errorf("invalid ADM3 key: %w", err)
+			return err
 		}
 
 		if !outputJSON {
 			output.PrintSuccess(fmt.Sprintf("Verifying ADM3 (key: %s)...", card.KeyToHex(key3)))
 		}
-		if err := reader.VerifyADM3(key3); err != nil {
-			if !outputJSON {
-				output.PrintError(fmt.Sprintf("ADM3 verification failed: %v", err))
-			}
+		if err := sim.VerifyADM(reader, drv, 3, key3); err != nil {
+			printError(fmt.Sprintf("ADM3 verification failed: %v", err))
 		} else {
 			sim.SetADMKey3(key3)
 			if !outputJSON {
@@ -223,18 +556,16 @@ func verifyADMKeys(reader *card.Reader) error {
 
 	// Verify ADM4 if provided
 	if admKey4 != "" {
-		key4, err := card.ParseADMKey(admKey4)
+		key4, err := inputs.ADMKey("--adm4", admKey4)
 		if err != nil {
-			return fmt.Errorf("invalid ADM4 key: %w", err)
+			return err
 		}
 
 		if !outputJSON {
 			output.PrintSuccess(fmt.Sprintf("Verifying ADM4 (key: %s)...", card.KeyToHex(key4)))
 		}
-		if err := reader.VerifyADM4(key4); err != nil {
-			if !outputJSON {
-				output.PrintError(fmt.Sprintf("ADM4 verification failed: %v", err))
-			}
+		if err := sim.VerifyADM(reader, drv, 4, key4); err != nil {
+			printError(fmt.Sprintf("ADM4 verification failed: %v", err))
 		} else {
 			sim.SetADMKey4(key4)
 			if !outputJSON {
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+
+	"sim_reader/card"
+	"sim_reader/inputs"
+)
+
+var (
+	// Barcode scanner input (--scan): the ICCID or IMSI printed on the card carrier is
+	// scanned with a keyboard wedge scanner and becomes the expected card
+	scanMode    bool
+	scanTimeout time.Duration
+)
+
+// scanMaxPrompts is the number of prompts without progress before --scan gives up
+const scanMaxPrompts = 3
+
+// scanPollInterval is how often the reader is checked for an inserted card
+var scanPollInterval = 500 * time.Millisecond
+
+// errScanAborted is returned when input ends before a code was scanned
+var errScanAborted = errors.New("scan aborted (no more input)")
+
+// addScanFlags registers --scan and --scan-timeout on cmd
+func addScanFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&scanMode, "scan", false,
+		"Read the ICCID or IMSI from a barcode scanner (stdin) and use it as --expect-iccid / --expect-imsi")
+	cmd.Flags().DurationVar(&scanTimeout, "scan-timeout", 30*time.Second,
+		"Time before --scan prompts again (it gives up after 3 prompts)")
+}
+
+// scanResult is a validated scanned code
+type scanResult struct {
+	ICCID string
+	IMSI  string
+}
+
+func (r scanResult) String() string {
+	if r.ICCID != "" {
+		return "ICCID " + r.ICCID
+	}
+	return "IMSI " + r.IMSI
+}
+
+// scanLabels are the prefixes printed next to the barcode, which some scanners send along
+var scanLabels = []string{"ICCID", "IMSI", "SIM"}
+
+// parseScan cleans a scanned line and validates it as an ICCID (18-20 digits, Luhn) or an
+// IMSI (14-15 digits). Scanners add control characters, an AIM symbology identifier
+// ("]C1"), Code 39 start/stop characters ("*") or the printed label ("ICCID:").
+func parseScan(line string) (scanResult, error) {
+	s := strings.TrimFunc(line, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) })
+	if len(s) >= 3 && s[0] == ']' {
+		s = s[3:]
+	}
+	s = strings.Trim(s, "* ")
+	for _, label := range scanLabels {
+		if len(s) > len(label) && strings.EqualFold(s[:len(label)], label) {
+			s = strings.TrimLeft(s[len(label):], " :=#")
+			break
+		}
+	}
+	if s == "" {
+		return scanResult{}, fmt.Errorf("empty scan")
+	}
+
+	digits := strings.TrimRight(strings.NewReplacer(" ", "", "-", "").Replace(s), "Ff")
+	if len(digits) >= 18 {
+		iccid, err := inputs.ICCID("scanned ICCID", s)
+		if err != nil {
+			return scanResult{}, err
+		}
+		return scanResult{ICCID: iccid}, nil
+	}
+	imsi, err := inputs.IMSI("scanned IMSI", s)
+	if err != nil {
+		return scanResult{}, err
+	}
+	if len(imsi) < 14 {
+		return scanResult{}, fmt.Errorf("scanned code %q is neither an ICCID (18-20 digits) nor an IMSI (14-15 digits)", s)
+	}
+	return scanResult{IMSI: imsi}, nil
+}
+
+// scanLines reads stdin line by line in the background, so that a prompt can time out.
+// Once the scan is done it hands the following lines to the wizard (ReadString).
+type scanLines struct {
+	lines   chan string
+	pending string // rest of a line partly consumed by Read
+}
+
+func newScanLines(in io.Reader) *scanLines {
+	s := &scanLines{lines: make(chan string)}
+	go func() {
+		defer close(s.lines)
+		br := bufio.NewReader(in)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				s.lines <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// ReadString returns the next line; delim is always '\n'
+func (s *scanLines) ReadString(delim byte) (string, error) {
+	if s.pending != "" {
+		line := s.pending
+		s.pending = ""
+		return line, nil
+	}
+	line, ok := <-s.lines
+	if !ok {
+		return "", io.EOF
+	}
+	return line, nil
+}
+
+// Read makes the remaining lines an io.Reader
+func (s *scanLines) Read(p []byte) (int, error) {
+	if s.pending == "" {
+		line, err := s.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		s.pending = line
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// scanWait waits for both a valid scan and an inserted card, in either order
+type scanWait struct {
+	lines   *scanLines
+	out     io.Writer
+	present func() bool // card in the reader
+	timeout time.Duration
+	poll    time.Duration
+	accept  func(scanResult) error // checks a scan before the card is used (data row)
+}
+
+// prompt tells the operator what is still missing
+func (w *scanWait) prompt(scanned *scanResult, inserted bool) string {
+	switch {
+	case scanned == nil && inserted:
+		return "Card inserted: scan the ICCID or IMSI barcode of its carrier"
+	case scanned == nil:
+		return "Scan the ICCID or IMSI barcode, or insert the card"
+	}
+	return fmt.Sprintf("Scanned %s: insert the card", scanned)
+}
+
+// run returns the scanned code once the card is inserted. Each prompt is repeated after the
+// timeout; after scanMaxPrompts prompts without progress it gives up.
+func (w *scanWait) run() (scanResult, error) {
+	var scanned *scanResult
+	inserted := w.present()
+	prompts := 0
+	prompt := func() {
+		prompts++
+		fmt.Fprintln(w.out, w.prompt(scanned, inserted))
+	}
+	prompt()
+
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(w.poll)
+	defer ticker.Stop()
+	progress := func() {
+		prompts = 0
+		if scanned == nil || !inserted {
+			prompt()
+		}
+		timer.Reset(w.timeout)
+	}
+
+	for scanned == nil || !inserted {
+		select {
+		case line, ok := <-w.lines.lines:
+			if !ok {
+				return scanResult{}, errScanAborted
+			}
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			r, err := parseScan(line)
+			if err == nil && w.accept != nil {
+				err = w.accept(r)
+			}
+			if err != nil {
+				fmt.Fprintf(w.out, "  ✗ %v, scan again\n", err)
+				continue
+			}
+			if scanned != nil && *scanned != r {
+				fmt.Fprintf(w.out, "  Replaced %s\n", scanned)
+			}
+			scanned = &r
+			progress()
+		case <-ticker.C:
+			if now := w.present(); now != inserted {
+				inserted = now
+				progress()
+			}
+		case <-timer.C:
+			if prompts >= scanMaxPrompts {
+				return scanResult{}, fmt.Errorf("--scan: nothing happened after %d prompts of %s", prompts, w.timeout)
+			}
+			fmt.Fprintf(w.out, "  No progress after %s\n", w.timeout)
+			prompt()
+			timer.Reset(w.timeout)
+		}
+	}
+	return *scanned, nil
+}
+
+// scanCardPresent reports whether a card is in the reader; errors other than a missing
+// card are left to the real connection
+var scanCardPresent = func() bool {
+	reader, err := connectBackend(readerIndex)
+	if err != nil {
+		return !errors.Is(err, card.ErrNoCard)
+	}
+	reader.Close()
+	return true
+}
+
+// scanExpectedCard runs the --scan dialog before connecting and makes the scanned ICCID or
+// IMSI the expected card. accept (may be nil) checks the scan first, e.g. that the data
+// file has a row for it. The returned reader gives the following lines to the wizard.
+func scanExpectedCard(in io.Reader, out io.Writer, accept func(scanResult) error) (*scanLines, error) {
+	if expectICCID != "" || expectIMSI != "" {
+		return nil, fmt.Errorf("--scan sets the expected card and cannot be combined with --expect-iccid / --expect-imsi")
+	}
+	if err := resolveReaderIndex(); err != nil {
+		return nil, err
+	}
+	lines := newScanLines(in)
+	w := &scanWait{lines: lines, out: out, present: scanCardPresent, timeout: scanTimeout, poll: scanPollInterval, accept: accept}
+	r, err := w.run()
+	if err != nil {
+		return nil, err
+	}
+	expectICCID, expectIMSI = r.ICCID, r.IMSI
+	printSuccess(fmt.Sprintf("Scanned %s", r))
+	return lines, nil
+}
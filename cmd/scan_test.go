@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ============ BARCODE SCAN TESTS ============
+
+func TestParseScan(t *testing.T) {
+	tests := []struct {
+		line string
+		want scanResult
+	}{
+		{"8901234567890123455\r\n", scanResult{ICCID: "8901234567890123455"}},
+		{"]C18901234567890123455", scanResult{ICCID: "8901234567890123455"}},
+		{"*8901234567890123455*", scanResult{ICCID: "8901234567890123455"}},
+		{"ICCID: 8901 2345 6789 0123 455", scanResult{ICCID: "8901234567890123455"}},
+		{"\x028901234567890123455F\x03", scanResult{ICCID: "8901234567890123455"}},
+		{"IMSI=250880000000001", scanResult{IMSI: "250880000000001"}},
+		{"25088000000001", scanResult{IMSI: "25088000000001"}},
+	}
+	for _, tt := range tests {
+		got, err := parseScan(tt.line)
+		if err != nil || got != tt.want {
+			t.Errorf("parseScan(%q) = %+v, %v; want %+v", tt.line, got, err, tt.want)
+		}
+	}
+
+	for _, line := range []string{"", "8901234567890123457", "250880", "89012345678901234X6"} {
+		if got, err := parseScan(line); err == nil {
+			t.Errorf("parseScan(%q) = %+v, want an error", line, got)
+		}
+	}
+}
+
+// scanFixture drives a scanWait with scripted stdin and a card that can be inserted
+type scanFixture struct {
+	w       *scanWait
+	in      *io.PipeWriter
+	out     *syncBuffer
+	present atomic.Bool
+}
+
+// syncBuffer is a bytes.Buffer written by the scanWait goroutine and read by the test
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func newScanFixture(timeout time.Duration) *scanFixture {
+	r, w := io.Pipe()
+	f := &scanFixture{in: w, out: &syncBuffer{}}
+	f.w = &scanWait{lines: newScanLines(r), out: f.out, present: f.present.Load, timeout: timeout, poll: time.Millisecond}
+	return f
+}
+
+type scanOutcome struct {
+	result scanResult
+	err    error
+}
+
+func (f *scanFixture) start() <-chan scanOutcome {
+	done := make(chan scanOutcome, 1)
+	go func() {
+		r, err := f.w.run()
+		done <- scanOutcome{r, err}
+	}()
+	return done
+}
+
+// waitOutput waits until the dialog printed want
+func (f *scanFixture) waitOutput(t *testing.T, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(f.out.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("output %q does not contain %q", f.out.String(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (f *scanFixture) result(t *testing.T, done <-chan scanOutcome) scanOutcome {
+	t.Helper()
+	select {
+	case o := <-done:
+		return o
+	case <-time.After(2 * time.Second):
+		t.Fatalf("scan did not finish, output %q", f.out.String())
+	}
+	return scanOutcome{}
+}
+
+func TestScanWait_ScanBeforeInsert(t *testing.T) {
+	f := newScanFixture(time.Minute)
+	done := f.start()
+	f.waitOutput(t, "Scan the ICCID or IMSI barcode, or insert the card")
+
+	// A misread is rejected, the next scan is taken
+	fmt.Fprintln(f.in, "8901234567890123457")
+	f.waitOutput(t, "Luhn")
+	fmt.Fprintln(f.in, "8901234567890123455")
+	f.waitOutput(t, "Scanned ICCID 8901234567890123455: insert the card")
+	select {
+	case o := <-done:
+		t.Fatalf("scan finished before the card was inserted: %+v", o)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	f.present.Store(true)
+	if o := f.result(t, done); o.err != nil || o.result.ICCID != "8901234567890123455" {
+		t.Errorf("run() = %+v", o)
+	}
+}
+
+func TestScanWait_InsertBeforeScan(t *testing.T) {
+	f := newScanFixture(time.Minute)
+	f.present.Store(true)
+	f.w.accept = func(r scanResult) error {
+		if r.IMSI != "" {
+			return fmt.Errorf("scan the ICCID")
+		}
+		return nil
+	}
+	done := f.start()
+	f.waitOutput(t, "Card inserted: scan the ICCID or IMSI barcode")
+
+	fmt.Fprintln(f.in, "250880000000001")
+	f.waitOutput(t, "scan the ICCID, scan again")
+	fmt.Fprintln(f.in, "]C1ICCID:8901234567890123455")
+	if o := f.result(t, done); o.err != nil || o.result.ICCID != "8901234567890123455" {
+		t.Errorf("run() = %+v", o)
+	}
+
+	// The lines after the scan are left for the wizard
+	go fmt.Fprintln(f.in, "yes")
+	if line, err := f.w.lines.ReadString('\n'); err != nil || line != "yes\n" {
+		t.Errorf("next line = %q, %v", line, err)
+	}
+}
+
+func TestScanWait_TimeoutAndEOF(t *testing.T) {
+	f := newScanFixture(5 * time.Millisecond)
+	o := f.result(t, f.start())
+	if o.err == nil || !strings.Contains(o.err.Error(), "3 prompts") {
+		t.Errorf("run() = %+v, want a timeout", o)
+	}
+	if got := strings.Count(f.out.String(), "or insert the card"); got != scanMaxPrompts {
+		t.Errorf("prompted %d times, want %d:\n%s", got, scanMaxPrompts, f.out.String())
+	}
+
+	f = newScanFixture(time.Minute)
+	done := f.start()
+	f.in.Close()
+	if o := f.result(t, done); o.err != errScanAborted {
+		t.Errorf("run() after EOF = %+v, want errScanAborted", o)
+	}
+}
@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"sim_reader/card"
 	"sim_reader/output"
 	"sim_reader/sim"
 )
@@ -14,6 +18,11 @@ var (
 	scriptFile    string
 	pcomVerbose   bool
 	pcomStopError bool
+	pcomDataFile  string
+	pcomVars      []string
+
+	// Simple script results file (script run)
+	scriptOutput string
 )
 
 var scriptCmd = &cobra.Command{
@@ -28,43 +37,84 @@ Supported formats:
 
 var scriptRunCmd = &cobra.Command{
 	Use:   "run [file]",
+	Annotations: writeAccess,
 	Short: "Run simple APDU script",
 	Long: `Run APDU script in simple format (one command per line).
 
 Example script format:
   # Select MF
-  00 A4 00 04 02 3F00
+  apdu 00 A4 00 04 02 3F00
   # Read binary
-  00 B0 00 00 00
+  apdu 00 B0 00 00 00   # text after # is ignored
+  include common/select_usim.txt
 
 Examples:
   sim_reader script run script.txt
-  sim_reader script run -a 77111606 script.txt`,
+  sim_reader script run -a 77111606 script.txt
+  sim_reader script run compat.txt --script-output fw1.json`,
 	Args: cobra.ExactArgs(1),
 	Run:  runScriptRun,
 }
 
+var scriptDiffCmd = &cobra.Command{
+	Use:   "diff [old.json] [new.json]",
+	Short: "Compare two saved script runs",
+	Long: `Compare two result files saved with 'script run --script-output' line by line
+(script file and line number) and report changed status words, changed response
+data (with the differing byte ranges) and lines present in one run only.
+No card is needed.
+
+Examples:
+  sim_reader script run compat.txt --script-output fw1.json
+  # ... update the card OS ...
+  sim_reader script run compat.txt --script-output fw2.json
+  sim_reader script diff fw1.json fw2.json`,
+	Args: cobra.ExactArgs(2),
+	Run:  runScriptDiff,
+}
+
 var scriptPcomCmd = &cobra.Command{
 	Use:   "pcom [file]",
+	Annotations: writeAccess,
 	Short: "Run PCOM personalization script",
 	Long: `Run .pcom personalization script (RuSIM/OX24 format).
 
 Examples:
   sim_reader script pcom /path/to/_2.LTE_Profile.pcom
   sim_reader script pcom script.pcom --stop-on-error
-  sim_reader script pcom script.pcom --verbose=false`,
+  sim_reader script pcom script.pcom --verbose=false
+  sim_reader script pcom -a 77111606 script.pcom --auto-snapshot
+  sim_reader script pcom script.pcom --pcom-data cards.csv --pcom-var OP=00112233445566778899AABBCCDDEEFF
+
+Built-in variables %ICCID%, %IMSI%, %PIN1%, %ADM1%, ... are taken from, in increasing
+priority: the ICCID read from the card, -p/--pin2/-a/--adm2..4, the row of --pcom-data
+(CSV with a header row, selected by the ICCID of the card) and --pcom-var NAME=VALUE.
+CHV n <pin> [<new>] and KEY n <key> [<new>] are sent as VERIFY (CHANGE REFERENCE DATA
+with a new value) of PIN n or ADMn; .POWER_OFF followed by .POWER_ON is a cold reset,
+.POWER_ON alone a warm reset.`,
 	Args: cobra.ExactArgs(1),
 	Run:  runScriptPcom,
 }
 
 func init() {
+	// Run command flags
+	scriptRunCmd.Flags().StringVar(&scriptOutput, "script-output", "",
+		"Save the results (line, file, sent, received, sw, elapsed_ms) as JSON for 'script diff'")
+
 	// Pcom command flags
 	scriptPcomCmd.Flags().BoolVar(&pcomVerbose, "verbose", true,
 		"Verbose output for PCOM scripts")
 	scriptPcomCmd.Flags().BoolVar(&pcomStopError, "stop-on-error", false,
 		"Stop PCOM script on first error")
+	scriptPcomCmd.Flags().BoolVar(&autoSnapshot, "auto-snapshot", false,
+		"Save a snapshot (snapshot-<ICCID>-<time>.snap) before running the script")
+	scriptPcomCmd.Flags().StringVar(&pcomDataFile, "pcom-data", "",
+		"Per-card data file (CSV with an ICCID column) filling the built-in %NAME% variables for the inserted card")
+	scriptPcomCmd.Flags().StringArrayVar(&pcomVars, "pcom-var", nil,
+		"Built-in variable NAME=VALUE for %NAME% (repeatable, overrides --pcom-data)")
+	addScanFlags(scriptPcomCmd)
 
-	scriptCmd.AddCommand(scriptRunCmd, scriptPcomCmd)
+	scriptCmd.AddCommand(scriptRunCmd, scriptDiffCmd, scriptPcomCmd)
 	rootCmd.AddCommand(scriptCmd)
 }
 
@@ -82,16 +132,74 @@ func runScriptRun(cmd *cobra.Command, args []string) {
 	printSuccess(fmt.Sprintf("Running script: %s", scriptFile))
 
 	results, err := sim.RunScript(reader, scriptFile)
+	if outputJSON {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		printDocument(data)
+	} else {
+		output.PrintScriptResults(results)
+	}
 	if err != nil {
 		printError(fmt.Sprintf("Script error: %v", err))
+	}
+
+	if scriptOutput != "" {
+		run := &sim.ScriptRun{
+			Script:  scriptFile,
+			ATR:     reader.ATRHex(),
+			Created: time.Now().Format(time.RFC3339),
+			Results: results,
+		}
+		if err := sim.SaveScriptRun(scriptOutput, run); err != nil {
+			printError(fmt.Sprintf("Failed to save script results: %v", err))
+		} else {
+			printSuccess(fmt.Sprintf("Script results saved to %s", scriptOutput))
+		}
+	}
+}
+
+func runScriptDiff(cmd *cobra.Command, args []string) {
+	oldRun, err := sim.LoadScriptRun(args[0])
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	newRun, err := sim.LoadScriptRun(args[1])
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+
+	if oldRun.Script != newRun.Script {
+		printWarning(fmt.Sprintf("Runs are of different scripts: %s / %s", oldRun.Script, newRun.Script))
+	}
+	diffs := sim.DiffScriptRuns(oldRun.Results, newRun.Results)
+	if outputJSON {
+		data, _ := json.MarshalIndent(diffs, "", "  ")
+		printDocument(data)
 		return
 	}
-	output.PrintScriptResults(results)
+
+	printSuccess(fmt.Sprintf("Old: %s (ATR %s, %s)", args[0], oldRun.ATR, oldRun.Created))
+	printSuccess(fmt.Sprintf("New: %s (ATR %s, %s)", args[1], newRun.ATR, newRun.Created))
+	output.PrintScriptDiff(diffs)
 }
 
 func runScriptPcom(cmd *cobra.Command, args []string) {
 	scriptFile = args[0]
 
+	vars, err := parsePcomVars(pcomVars)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+
+	if scanMode {
+		if _, err := scanExpectedCard(cmd.InOrStdin(), cmd.OutOrStdout(), pcomScanAccept); err != nil {
+			printError(err.Error())
+			return
+		}
+	}
+
 	reader, err := connectAndPrepareReader()
 	if err != nil {
 		printError(err.Error())
@@ -99,13 +207,27 @@ func runScriptPcom(cmd *cobra.Command, args []string) {
 	}
 	defer reader.Close()
 
+	if autoSnapshot {
+		if err := saveAutoSnapshot(reader); err != nil {
+			printError(err.Error())
+			return
+		}
+	}
+
 	fmt.Println()
 	printSuccess(fmt.Sprintf("Running .pcom script: %s", scriptFile))
 	fmt.Println()
 
+	builtins, err := pcomBuiltins(reader, vars)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+
 	executor := sim.NewPcomExecutor(reader)
 	executor.SetVerbose(pcomVerbose)
 	executor.SetStopOnError(pcomStopError)
+	executor.SetBuiltins(builtins)
 
 	err = executor.ExecuteFile(scriptFile)
 	if err != nil {
@@ -122,3 +244,68 @@ func runScriptPcom(cmd *cobra.Command, args []string) {
 	}
 }
 
+
+// pcomScanAccept checks that --pcom-data has a row for a scanned ICCID, before the card is
+// inserted
+func pcomScanAccept(r scanResult) error {
+	if pcomDataFile == "" {
+		return nil
+	}
+	if r.ICCID == "" {
+		return fmt.Errorf("--pcom-data rows are selected by ICCID, scan the ICCID instead of the IMSI")
+	}
+	_, err := sim.LoadPcomCardData(pcomDataFile, r.ICCID)
+	return err
+}
+
+// parsePcomVars parses the --pcom-var NAME=VALUE flags
+func parsePcomVars(flags []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, kv := range flags {
+		name, value, ok := strings.Cut(kv, "=")
+		name = strings.Trim(strings.TrimSpace(name), "%")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("--pcom-var %q: expected NAME=VALUE", kv)
+		}
+		vars[strings.ToUpper(name)] = value
+	}
+	return vars, nil
+}
+
+// pcomBuiltins collects the built-in %NAME% variables of a .pcom run. Later sources win:
+// the ICCID read from the card, the PINs and ADM keys of the command line, the row of
+// --pcom-data for that ICCID and the --pcom-var values.
+func pcomBuiltins(reader *card.Reader, vars map[string]string) (map[string]string, error) {
+	values := make(map[string]string)
+	iccid, err := sim.ReadICCIDQuick(reader)
+	if err == nil && iccid == "" {
+		err = fmt.Errorf("EF_ICCID is empty")
+	}
+	if err == nil {
+		values["ICCID"] = iccid
+	}
+	for name, v := range map[string]string{"PIN1": pin1, "PIN2": pin2, "ADM1": admKey, "ADM2": admKey2, "ADM3": admKey3, "ADM4": admKey4} {
+		if v != "" {
+			values[name] = v
+		}
+	}
+
+	if pcomDataFile != "" {
+		if err != nil {
+			return nil, fmt.Errorf("--pcom-data: the ICCID of the card is not readable (%v)", err)
+		}
+		row, err := sim.LoadPcomCardData(pcomDataFile, iccid)
+		if err != nil {
+			return nil, err
+		}
+		for name, v := range row {
+			values[name] = v
+		}
+		printSuccess(fmt.Sprintf("Card data for ICCID %s from %s", iccid, pcomDataFile))
+	}
+
+	for name, v := range vars {
+		values[name] = v
+	}
+	return values, nil
+}
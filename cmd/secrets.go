@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/output"
+	"sim_reader/sim"
+)
+
+var (
+	// Key material displays (--show-ki), redacted unless --reveal-secrets
+	showKi           bool
+	ackSensitiveKeys bool
+	revealSecrets    bool
+)
+
+// checkSecretFlags validates the key display flags before connecting: reading a key needs
+// an explicit acknowledgment, revealing one needs a key to show
+func checkSecretFlags() error {
+	if showKi && !ackSensitiveKeys {
+		return fmt.Errorf("--show-ki reads the subscriber key: add --i-understand-keys-are-sensitive to confirm")
+	}
+	if revealSecrets && !showKi && !showFiveGContext {
+		return fmt.Errorf("--reveal-secrets has no effect without --show-ki or --show-5g-context")
+	}
+	return nil
+}
+
+// readKiForDisplay reads Ki with the driver of the card, or returns nil after a warning
+func readKiForDisplay(reader *card.Reader) []byte {
+	ki, err := sim.ReadKi(reader, sim.FindDriver(reader))
+	if err != nil {
+		msg := fmt.Sprintf("Ki: %v", err)
+		if strings.Contains(err.Error(), "Security status not satisfied") {
+			msg += " (verify the ADM key that protects the key file, e.g. --adm4)"
+		}
+		printWarning(msg)
+		return nil
+	}
+	return ki
+}
+
+// printKi prints Ki unless the export is JSON/YAML, where it is only included when revealed
+func printKi(ki []byte, config *sim.SIMConfig) {
+	if config == nil {
+		output.PrintKi(ki, revealSecrets)
+		return
+	}
+	if !revealSecrets {
+		printWarning("Ki not exported: the export holds the full key only with --reveal-secrets")
+		return
+	}
+	config.Ki = fmt.Sprintf("%X", ki)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+
+	"sim_reader/card"
+	"sim_reader/inputs"
+	"sim_reader/sim"
+)
+
+var (
+	// ISO 7816-4 secure messaging for EFs that require it (--sm-*)
+	smKeyMAC string
+	smKeyENC string
+	smAlg    string
+	smSSC    string
+	smFiles  string
+
+	// smSession is installed on the reader by connectAndPrepareReader
+	smSession *card.SMSession
+)
+
+// checkSecureMessagingFlags builds the secure messaging session from the --sm-* flags
+// before connecting
+func checkSecureMessagingFlags() error {
+	smSession, sim.SMFiles = nil, nil
+	if smKeyMAC == "" {
+		if smKeyENC != "" || smFiles != "" || smSSC != "" {
+			return fmt.Errorf("--sm-key-enc, --sm-files and --sm-ssc need --sm-key-mac")
+		}
+		return nil
+	}
+	alg, err := card.ParseSMAlgorithm(smAlg)
+	if err != nil {
+		return err
+	}
+	keys := card.SMKeys{Alg: alg}
+	for _, f := range []struct {
+		name, value string
+		out         *[]byte
+	}{
+		{"--sm-key-mac", smKeyMAC, &keys.MAC},
+		{"--sm-key-enc", smKeyENC, &keys.ENC},
+		{"--sm-ssc", smSSC, &keys.SSC},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if *f.out, err = inputs.Hex(f.name, f.value); err != nil {
+			return err
+		}
+	}
+	if smSession, err = card.NewSMSession(keys); err != nil {
+		return fmt.Errorf("secure messaging: %w", err)
+	}
+	if sim.SMFiles, err = sim.ParseSMFiles(smFiles); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// ============ SECURE MESSAGING TESTS ============
+
+func TestRead_SecureMessaging(t *testing.T) {
+	mock := newTestCard()
+	isim := mock.AddADF(sim.AID_ISIM)
+	isim.AddEF(0x6F02, sim.EncodeIMPI("user@ims.example.org", 48)).ReadSM = true
+	var err error
+	if mock.SM, err = card.NewSMSession(card.SMKeys{
+		Alg: card.SM3DES,
+		MAC: bytes.Repeat([]byte{0x11}, 16),
+		ENC: bytes.Repeat([]byte{0x22}, 16),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	openReader = func(_ int, opts ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock, opts...), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		outputJSON = false
+		smKeyMAC, smKeyENC, smAlg, smSSC, smFiles = "", "", "aes128", "", ""
+		smSession, sim.SMFiles = nil, nil
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	}()
+
+	// Keys are checked before connecting
+	stdout, _ := runCapture(t, "read", "-r", "0", "--sm-files", "6F02")
+	if !strings.Contains(stdout, "need --sm-key-mac") || len(mock.Log) != 0 {
+		t.Errorf("--sm-files alone: %q, %d APDUs sent", stdout, len(mock.Log))
+	}
+
+	stdout, _ = runCapture(t, "read", "-r", "0", "--json", "--sm-alg", "3des",
+		"--sm-key-mac", strings.Repeat("11", 16), "--sm-key-enc", strings.Repeat("22", 16), "--sm-files", "6F02")
+	var config sim.SIMConfig
+	if err := json.Unmarshal([]byte(stdout), &config); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if config.ISIM == nil || config.ISIM.IMPI != "user@ims.example.org" {
+		t.Errorf("ISIM = %+v, want the IMPI read with secure messaging", config.ISIM)
+	}
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sim_reader/card"
+	"sim_reader/server"
+	"sim_reader/sim"
+)
+
+var (
+	serveIdleTimeout time.Duration
+	serveKeepAlive   time.Duration
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve unix:///PATH",
+	Short: "Serve card sessions over JSON-RPC on a local socket",
+	Long: `Serve card sessions over JSON-RPC 2.0 on a unix socket for GUI frontends.
+
+A client opens a session on a reader and keeps the card connection for later
+requests instead of running the CLI per operation. Messages are JSON objects,
+one per line.
+
+Methods:
+  readers.list                          reader names (index = position)
+  session.open   {reader, pin, adm}     connect, verify PIN1/ADM1 -> {session, reader, atr}
+  session.close  {session}              release the reader
+  usim.read      {session}              USIM in the format of read --json
+  isim.read      {session}              ISIM in the format of read --json
+  config.apply   {session, config, dry_run, force}   like write -f, returns the apply report
+  auth.run       {session, k, opc|op, sqn, amf, rand, algorithm, context}
+  trace.get      {session, clear}       APDUs exchanged since the session was opened
+
+Operations of a session run one at a time in the order received. Sessions are
+closed when the client disconnects or after --idle-timeout without requests; the
+client then gets a session.expired notification. The global --read-only and
+--dry-run flags apply to every session.
+
+Readers that power an idle card down are kept awake with --keep-alive, which
+sends a STATUS after that long without commands. A card powered down anyway is
+re-initialized on the next command (selected application and verified PIN1/ADM1
+restored) and the client gets a session.notice notification {session, message}.
+
+Examples:
+  sim_reader serve unix:///tmp/simreader.sock
+  sim_reader serve unix:///tmp/simreader.sock --keep-alive 30s
+
+  # One request from the shell
+  echo '{"jsonrpc":"2.0","id":1,"method":"readers.list"}' | nc -U /tmp/simreader.sock`,
+	Args: cobra.ExactArgs(1),
+	Run:  runServe,
+}
+
+func init() {
+	serveCmd.Flags().DurationVar(&serveIdleTimeout, "idle-timeout", server.DefaultIdleTimeout,
+		"Release the reader of a session after this long without requests")
+	serveCmd.Flags().DurationVar(&serveKeepAlive, "keep-alive", 0,
+		"Send a STATUS to the card after this long without commands (0 = off)")
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(cmd *cobra.Command, args []string) {
+	path, err := serveSocketPath(args[0])
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	if err := sim.SetAIDOverrides(usimAIDFlag, isimAIDFlag); err != nil {
+		printError(err.Error())
+		return
+	}
+	if err := removeStaleSocket(path); err != nil {
+		printError(err.Error())
+		return
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		printError(fmt.Sprintf("Failed to listen on %s: %v", path, err))
+		return
+	}
+	// The socket gives access to the card with the keys of the client: owner only
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		printError(fmt.Sprintf("Failed to restrict %s: %v", path, err))
+		return
+	}
+	defer os.Remove(path)
+
+	srv := server.New(server.Config{
+		Open:        openServeReader,
+		Readers:     backendReaders,
+		IdleTimeout: serveIdleTimeout,
+		KeepAlive:   serveKeepAlive,
+	})
+	ctx, stop := interruptContext()
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	printSuccess(fmt.Sprintf("Serving JSON-RPC on unix://%s (Ctrl-C to stop)", path))
+	if err := srv.Serve(l); err != nil {
+		printError(fmt.Sprintf("Server failed: %v", err))
+		return
+	}
+	printSuccess("Server stopped, all readers released")
+}
+
+// serveSocketPath returns the socket path of a unix:// address
+func serveSocketPath(addr string) (string, error) {
+	path, ok := strings.CutPrefix(addr, "unix://")
+	if !ok || path == "" {
+		return "", fmt.Errorf("invalid address %q: use unix:///path/to/socket", addr)
+	}
+	return path, nil
+}
+
+// removeStaleSocket removes a socket left behind by a server that is no longer running.
+// Other files and sockets with a live server are never touched.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("another server is listening on %s", path)
+	}
+	return os.Remove(path)
+}
+
+// openServeReader connects a session reader with the global flags and detects the card type
+func openServeReader(index int) (*card.Reader, error) {
+	reader, err := connectBackend(index, readerConnectOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	reader.SetDryRun(dryRun)
+	reader.SetReadOnly(readOnly)
+
+	if drv := sim.FindDriver(reader); drv != nil {
+		sim.UseGSMCommands = drv.BaseCLA() == 0xA0
+	} else {
+		sim.UseGSMCommands = sim.IsGSMOnlyCard(reader.ATRHex())
+	}
+	if !sim.UseGSMCommands {
+		reader.DetectCapabilities()
+	}
+	return reader, nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ============ SERVE TESTS ============
+
+func TestServeSocketPath(t *testing.T) {
+	if path, err := serveSocketPath("unix:///tmp/simreader.sock"); err != nil || path != "/tmp/simreader.sock" {
+		t.Errorf("serveSocketPath() = %q, %v", path, err)
+	}
+	for _, addr := range []string{"/tmp/simreader.sock", "tcp://127.0.0.1:9000", "unix://"} {
+		if _, err := serveSocketPath(addr); err == nil {
+			t.Errorf("serveSocketPath(%q) accepted", addr)
+		}
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A regular file is never removed
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0600)
+	if err := removeStaleSocket(file); err == nil {
+		t.Errorf("regular file accepted")
+	}
+
+	// A socket with a live server is kept
+	sock := filepath.Join(dir, "s.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(sock); err == nil {
+		t.Errorf("live socket accepted")
+	}
+
+	// A socket left behind by a server that is gone is removed
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if err := removeStaleSocket(sock); err != nil {
+		t.Errorf("stale socket: %v", err)
+	}
+	if _, err := os.Lstat(sock); !os.IsNotExist(err) {
+		t.Errorf("stale socket not removed")
+	}
+}
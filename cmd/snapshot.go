@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"sim_reader/card"
+	"sim_reader/output"
+	"sim_reader/sim"
+)
+
+var (
+	// Card content snapshot flags (write, script pcom)
+	snapshotFile string
+	rollbackFile string
+	autoSnapshot bool
+)
+
+// saveCardSnapshot saves the files restorable with the provided credentials to path
+func saveCardSnapshot(reader *card.Reader, path string) error {
+	snap, err := sim.TakeSnapshot(reader, sim.StoredCredentials(pin1 != ""))
+	if err != nil {
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+	if err := sim.SaveSnapshot(path, snap); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	assumed := 0
+	for _, f := range snap.Files {
+		if f.Assumed {
+			assumed++
+		}
+	}
+	printSuccess(fmt.Sprintf("Snapshot saved to %s: %d file(s), %d not restorable and skipped", path, len(snap.Files), len(snap.Skipped)))
+	if assumed > 0 {
+		printWarning(fmt.Sprintf("Snapshot: access conditions of %d file(s) unknown, ADM1 assumed for restore", assumed))
+	}
+	if !outputJSON {
+		for _, s := range snap.Skipped {
+			fmt.Printf("  - %s/%s: %s\n", s.Application, s.Name, s.Reason)
+		}
+	}
+	return nil
+}
+
+// saveAutoSnapshot saves a snapshot named after the card and the current time before a risky operation
+func saveAutoSnapshot(reader *card.Reader) error {
+	name := "card"
+	if iccid, err := sim.ReadICCIDQuick(reader); err == nil && iccid != "" {
+		name = iccid
+	}
+	path := fmt.Sprintf("snapshot-%s-%s.snap", name, time.Now().Format("20060102-150405"))
+	return saveCardSnapshot(reader, path)
+}
+
+// runRollback restores the snapshot in path and prints the per-file report
+func runRollback(reader *card.Reader, path string) {
+	snap, err := sim.LoadSnapshot(path)
+	if err != nil {
+		printError(fmt.Sprintf("Failed to load snapshot: %v", err))
+		return
+	}
+
+	printSuccess(fmt.Sprintf("Restoring %d file(s) from %s (taken %s)", len(snap.Files), path, snap.Created))
+	report, err := sim.RollbackSnapshot(reader, snap, sim.StoredCredentials(pin1 != ""))
+	if report != nil {
+		if outputJSON {
+			data, _ := json.MarshalIndent(report, "", "  ")
+			printDocument(data)
+		} else {
+			output.PrintApplyReport(report)
+		}
+	}
+	if err != nil {
+		printError(fmt.Sprintf("Rollback failed: %v", err))
+	}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"sim_reader/card"
+	"sim_reader/output"
+	"sim_reader/sim"
+)
+
+var (
+	// Activation summary sheet flags (write)
+	summarySheet          string
+	summaryIncludeSecrets bool
+)
+
+// writeSummarySheet reads the card back and renders the --summary-sheet file, so the sheet
+// shows what the card holds after writing rather than what was requested
+func writeSummarySheet(reader *card.Reader) {
+	if summarySheet == "" {
+		return
+	}
+	if dryRun {
+		printWarning("Dry run: the summary sheet shows the card content without the simulated writes")
+	}
+
+	usim, err := sim.ReadUSIM(reader)
+	if err != nil {
+		printError(fmt.Sprintf("Summary sheet: USIM read failed: %v", err))
+		return
+	}
+	if usim.ICCID == "" {
+		printError("Summary sheet: ICCID could not be read back")
+		return
+	}
+
+	sheet := &output.SummarySheet{
+		ICCID:      usim.ICCID,
+		IMSI:       usim.IMSI,
+		MSISDN:     usim.MSISDN,
+		SPN:        usim.SPN,
+		VoLTE:      usim.HasVoLTE(),
+		VoWiFi:     usim.HasVoWiFi(),
+		SMSOverIP:  usim.HasSMSOverIP(),
+		Generated:  time.Now(),
+		CardSource: reader.Name(),
+	}
+	if summaryIncludeSecrets {
+		if key, err := card.ParseADMKey(admKey); err == nil && admKey != "" {
+			sheet.ADMKey = card.KeyToHex(key)
+		} else {
+			printWarning("--summary-include-secrets: no valid ADM1 key (-a) given, key not printed")
+		}
+	}
+
+	if err := output.WriteSummarySheet(summarySheet, sheet); err != nil {
+		printError(fmt.Sprintf("Summary sheet failed: %v", err))
+		return
+	}
+	printSuccess(fmt.Sprintf("Summary sheet for ICCID %s written to %s", sheet.ICCID, summarySheet))
+}
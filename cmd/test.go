@@ -2,14 +2,15 @@ package cmd
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
 
 	"sim_reader/algorithms"
 	"sim_reader/card"
+	"sim_reader/inputs"
 	"sim_reader/output"
-	"sim_reader/sim"
 	"sim_reader/testing"
 )
 
@@ -23,6 +24,11 @@ var (
 	testAuthSQN  string
 	testAuthAMF  string
 	testAuthAlgo string
+	testFormat   string
+	testFailFast bool
+
+	testProfile         string
+	testProfileGenerate string
 )
 
 var testCmd = &cobra.Command{
@@ -49,20 +55,38 @@ Examples:
   # Run multiple categories
   sim_reader test -a 4444444444444444 --only usim,isim
 
+  # JUnit XML for CI, stop at the first failure
+  sim_reader test -a 4444444444444444 -o results --output-format junit --fail-fast
+
+  # Record a known-good card as the expectation profile of the batch
+  sim_reader test --test-profile-generate golden.yaml
+
+  # Check the rest of the batch against it (or a built-in profile: sysmo-sja2, ...)
+  sim_reader test -a 4444444444444444 --test-profile golden.yaml
+
 Test categories:
   - usim     USIM application file tests
   - isim     ISIM application file tests
   - auth     Authentication tests (Milenage/TUAK)
   - apdu     Low-level APDU tests
-  - security Security-related tests`,
+  - security Security-related tests
+  - profile  Card expectation profile checks (with --test-profile)`,
 	Run: runTest,
 }
 
 func init() {
 	testCmd.Flags().StringVarP(&testOutput, "output", "o", "",
-		"Output file prefix for test reports (.json + .html)")
+		"Output file prefix for test reports (.json + .html, .xml for junit)")
+	testCmd.Flags().StringVar(&testFormat, "output-format", "json,html",
+		"Report formats for --output: json, html, junit (comma-separated)")
+	testCmd.Flags().BoolVar(&testFailFast, "fail-fast", false,
+		"Stop the suite at the first failed test")
 	testCmd.Flags().StringVar(&testOnly, "only", "",
-		"Run specific test category: usim,isim,auth,apdu,security (comma-separated)")
+		"Run specific test category: usim,isim,auth,apdu,security,profile (comma-separated)")
+	testCmd.Flags().StringVar(&testProfile, "test-profile", "",
+		"Card expectation profile (YAML/JSON file or built-in: "+strings.Join(testing.BuiltinProfiles(), ", ")+")")
+	testCmd.Flags().StringVar(&testProfileGenerate, "test-profile-generate", "",
+		"Write an expectation profile of this (known-good) card to the file and exit")
 
 	// Auth parameters for test suite
 	testCmd.Flags().StringVarP(&testAuthK, "key", "k", "",
@@ -78,10 +102,24 @@ func init() {
 	testCmd.Flags().StringVar(&testAuthAlgo, "algo", "milenage",
 		"Algorithm for auth tests: milenage or tuak")
 
+	addFileMapFlags(testCmd)
+
 	rootCmd.AddCommand(testCmd)
 }
 
 func runTest(cmd *cobra.Command, args []string) {
+	// Checked before connecting: a mistyped key would only show up as a failed auth test
+	auth, err := parseTestAuthFlags()
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+
+	// Reports carry the time and APDU count of each category, so slow cards show in CI history
+	if testOutput != "" {
+		startMetrics()
+	}
+
 	// Connect to reader
 	reader, err := connectAndPrepareReader()
 	if err != nil {
@@ -90,61 +128,39 @@ func runTest(cmd *cobra.Command, args []string) {
 	}
 	defer reader.Close()
 
-	fmt.Println()
-	printSuccess("Running SIM Card Test Suite...")
-
-	// Parse auth config for tests
-	var testK, testOPc []byte
-	if testAuthK != "" {
-		k, err := sim.ParseHexBytes(testAuthK)
-		if err == nil {
-			testK = k
-		}
+	if testProfileGenerate != "" {
+		generateTestProfile(reader)
+		return
 	}
-	if testAuthOPc != "" {
-		opc, err := sim.ParseHexBytes(testAuthOPc)
-		if err == nil {
-			testOPc = opc
+	var profile *testing.Profile
+	if testProfile != "" {
+		if profile, err = testing.LoadProfile(testProfile); err != nil {
+			printError(err.Error())
+			return
 		}
-	} else if testAuthOP != "" {
-		// Compute OPc from OP
-		op, err := sim.ParseHexBytes(testAuthOP)
-		if err == nil && len(testK) > 0 {
-			computed, _ := algorithms.ComputeOPc(testK, op)
-			testOPc = computed
+		if profile.Auth != nil && profile.Auth.Algorithm != "" && !cmd.Flags().Changed("algo") {
+			testAuthAlgo = profile.Auth.Algorithm
 		}
 	}
 
-	// Parse ADM key
-	var admKeyBytes []byte
-	if admKey != "" {
-		key, err := card.ParseADMKey(admKey)
-		if err == nil {
-			admKeyBytes = key
-		}
-	}
+	fileMap := activateFileMap(reader)
+	defer finishFileMap(fileMap, false)
 
-	// Parse SQN and AMF
-	var sqnBytes, amfBytes []byte
-	if testAuthSQN != "" {
-		sqn, _ := sim.ParseHexBytes(testAuthSQN)
-		sqnBytes = sqn
-	}
-	if testAuthAMF != "" {
-		amf, _ := sim.ParseHexBytes(testAuthAMF)
-		amfBytes = amf
-	}
+	fmt.Println()
+	printSuccess("Running SIM Card Test Suite...")
 
 	// Create test options
 	opts := testing.TestOptions{
-		ADMKey:    admKeyBytes,
+		ADMKey:    auth.ADMKey,
 		PIN1:      pin1,
-		AuthK:     testK,
-		AuthOPc:   testOPc,
-		AuthSQN:   sqnBytes,
-		AuthAMF:   amfBytes,
+		AuthK:     auth.AuthK,
+		AuthOPc:   auth.AuthOPc,
+		AuthSQN:   auth.AuthSQN,
+		AuthAMF:   auth.AuthAMF,
 		Algorithm: testAuthAlgo,
 		Verbose:   true,
+		FailFast:  testFailFast,
+		Profile:   profile,
 	}
 
 	// Create and run test suite
@@ -154,6 +170,9 @@ func runTest(cmd *cobra.Command, args []string) {
 		// Run specific categories
 		categories := strings.Split(testOnly, ",")
 		for _, cat := range categories {
+			if suite.Stopped() {
+				break
+			}
 			cat = strings.TrimSpace(cat)
 			if err := suite.RunCategory(cat); err != nil {
 				printWarning(fmt.Sprintf("Category %s: %v", cat, err))
@@ -171,6 +190,7 @@ func runTest(cmd *cobra.Command, args []string) {
 			Name:     r.Name,
 			Category: r.Category,
 			Passed:   r.Passed,
+			Skipped:  r.Skipped,
 			Expected: r.Expected,
 			Actual:   r.Actual,
 			APDU:     r.APDU,
@@ -186,9 +206,77 @@ func runTest(cmd *cobra.Command, args []string) {
 
 	// Generate reports if output prefix specified
 	if testOutput != "" {
-		if err := suite.GenerateReport(testOutput); err != nil {
+		var formats []string
+		for _, f := range strings.Split(testFormat, ",") {
+			if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+				formats = append(formats, f)
+			}
+		}
+		if err := suite.GenerateReport(testOutput, formats...); err != nil {
 			printError(fmt.Sprintf("Report generation failed: %v", err))
 		}
 	}
 }
 
+// parseTestAuthFlags parses --key/--op/--opc/--sqn/--amf and the ADM key for the suite.
+// K and OP/OPc are 128-bit for Milenage, 128 or 256-bit for TUAK; the OPc of an OP is
+// computed with Milenage.
+func parseTestAuthFlags() (testing.TestOptions, error) {
+	var opts testing.TestOptions
+	var err error
+	if testAuthK != "" {
+		if opts.AuthK, err = inputs.HexKey("--key", testAuthK, 16, 32); err != nil {
+			return opts, err
+		}
+	}
+	if testAuthOPc != "" {
+		if opts.AuthOPc, err = inputs.HexKey("--opc", testAuthOPc, 16, 32); err != nil {
+			return opts, err
+		}
+	} else if testAuthOP != "" {
+		op, err := inputs.HexKey("--op", testAuthOP, 16, 32)
+		if err != nil {
+			return opts, err
+		}
+		if len(opts.AuthK) > 0 {
+			opts.AuthOPc, _ = algorithms.ComputeOPc(opts.AuthK, op)
+		}
+	}
+	if testAuthSQN != "" {
+		if opts.AuthSQN, err = inputs.HexKey("--sqn", testAuthSQN, 6); err != nil {
+			return opts, err
+		}
+	}
+	if testAuthAMF != "" {
+		if opts.AuthAMF, err = inputs.HexKey("--amf", testAuthAMF, 2); err != nil {
+			return opts, err
+		}
+	}
+	if admKey != "" {
+		if opts.ADMKey, err = inputs.ADMKey("--adm", admKey); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// generateTestProfile writes the expectation profile of the card in the reader, named
+// after the output file
+func generateTestProfile(reader *card.Reader) {
+	name := strings.TrimSuffix(filepath.Base(testProfileGenerate), filepath.Ext(testProfileGenerate))
+	profile, err := testing.GenerateProfile(reader, name)
+	if err != nil {
+		printError(fmt.Sprintf("Profile generation failed: %v", err))
+		return
+	}
+	if err := testing.SaveProfile(testProfileGenerate, profile); err != nil {
+		printError(fmt.Sprintf("Failed to save profile: %v", err))
+		return
+	}
+	files := 0
+	for _, app := range profile.Files {
+		files += len(app)
+	}
+	printSuccess(fmt.Sprintf("Profile %q saved to %s (%d file(s)); review it, then use --test-profile %s",
+		profile.Name, testProfileGenerate, files, testProfileGenerate))
+}
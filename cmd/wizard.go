@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/output"
+	"sim_reader/sim"
+)
+
+// errWizardAborted is returned when input ends before the dialog is complete
+var errWizardAborted = errors.New("wizard aborted (no more input)")
+
+// wizardConfirmWord must be typed to execute the reviewed plan
+const wizardConfirmWord = "yes"
+
+// Default IMS identity templates. Placeholders: {imsi}, {mcc}, {mnc} (3 digits), {domain}
+const (
+	wizardDomainTemplate = "ims.mnc{mnc}.mcc{mcc}.3gppnetwork.org"
+	wizardIMPITemplate   = "{imsi}@{domain}"
+	wizardIMPUTemplate   = "sip:{imsi}@{domain}"
+	wizardPCSCFTemplate  = "pcscf.{domain}"
+)
+
+// wizardPrompter reads answers line by line. It only asks questions; the answers
+// are collected into a regular sim.SIMConfig by buildWizardPlan.
+type wizardPrompter struct {
+	in  lineReader
+	out io.Writer
+}
+
+// lineReader is a bufio.Reader, or the lines left over by --scan
+type lineReader interface {
+	ReadString(delim byte) (string, error)
+}
+
+func newWizardPrompter(in io.Reader, out io.Writer) *wizardPrompter {
+	if lr, ok := in.(lineReader); ok {
+		return &wizardPrompter{in: lr, out: out}
+	}
+	return &wizardPrompter{in: bufio.NewReader(in), out: out}
+}
+
+// ask prints the question with its default and returns the trimmed answer (def on empty input)
+func (p *wizardPrompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		fmt.Fprintln(p.out)
+		return "", errWizardAborted
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// askValid repeats the question until check accepts the answer
+func (p *wizardPrompter) askValid(question, def string, check func(string) error) (string, error) {
+	for {
+		answer, err := p.ask(question, def)
+		if err != nil {
+			return "", err
+		}
+		if err := check(answer); err != nil {
+			fmt.Fprintf(p.out, "  ✗ %v\n", err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+// confirm asks a yes/no question
+func (p *wizardPrompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		answer, err := p.ask(fmt.Sprintf("%s (%s)", question, hint), "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(p.out, "  ✗ Please answer y or n")
+	}
+}
+
+// wizardCardInfo is what the wizard found on the card before asking anything
+type wizardCardInfo struct {
+	ICCID     string
+	IMSI      string
+	MNCLength int
+	Model     string
+	SPN       string
+	HasISIM   bool
+}
+
+// detectWizardCard reads the identity of the inserted card
+func detectWizardCard(reader *card.Reader) wizardCardInfo {
+	info := wizardCardInfo{MNCLength: 2}
+	if drv := sim.FindDriver(reader); drv != nil {
+		info.Model = drv.Name()
+	} else {
+		info.Model = sim.IdentifyCardByATR(reader.ATRHex())
+	}
+	if iccid, err := sim.ReadICCIDQuick(reader); err == nil {
+		info.ICCID = iccid
+	}
+	if usim, err := sim.ReadUSIM(reader); err == nil {
+		info.IMSI = usim.IMSI
+		info.SPN = usim.SPN
+		if usim.AdminData.MNCLength == 3 {
+			info.MNCLength = 3
+		}
+	}
+	sim.WithISIMChannel(reader, func() error {
+		data, err := sim.ReadISIM(reader)
+		info.HasISIM = err == nil && data.Available
+		return err
+	})
+	return info
+}
+
+// expandIMSTemplate fills {imsi}, {mcc}, {mnc} and {domain} from the IMSI (mnc is 3 digits, as in 3gppnetwork.org names)
+func expandIMSTemplate(template, imsi string, mncLen int, domain string) string {
+	var mcc, mnc string
+	if len(imsi) >= 3+mncLen {
+		mcc = imsi[:3]
+		mnc = imsi[3 : 3+mncLen]
+		if len(mnc) == 2 {
+			mnc = "0" + mnc
+		}
+	}
+	return strings.NewReplacer("{imsi}", imsi, "{mcc}", mcc, "{mnc}", mnc, "{domain}", domain).Replace(template)
+}
+
+func validateWizardIMSI(imsi string) error {
+	_, err := sim.EncodeIMSI(imsi)
+	return err
+}
+
+// buildWizardPlan runs the guided dialog and returns the resulting config (empty if nothing was chosen)
+func buildWizardPlan(p *wizardPrompter, info wizardCardInfo) (*sim.SIMConfig, error) {
+	plan := &sim.SIMConfig{}
+	imsi := info.IMSI
+
+	ok, err := p.confirm("Write IMSI?", info.IMSI == "")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if imsi, err = p.askValid("  IMSI", info.IMSI, validateWizardIMSI); err != nil {
+			return nil, err
+		}
+		plan.IMSI = imsi
+	}
+
+	if ok, err = p.confirm("Enable VoLTE?", false); err != nil {
+		return nil, err
+	}
+	if ok {
+		enabled := true
+		plan.Services = &sim.ServicesConfig{VoLTE: &enabled}
+	}
+
+	if ok, err = p.confirm("Set SPN?", false); err != nil {
+		return nil, err
+	}
+	if ok {
+		if plan.SPN, err = p.askValid("  SPN", info.SPN, func(s string) error {
+			if s == "" {
+				return fmt.Errorf("SPN must not be empty")
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if !info.HasISIM {
+		fmt.Fprintln(p.out, "No ISIM application on this card: skipping IMS identities")
+		return plan, nil
+	}
+	if imsi == "" {
+		fmt.Fprintln(p.out, "No IMSI known: skipping IMS identities")
+		return plan, nil
+	}
+	if ok, err = p.confirm("Configure IMS identities?", false); err != nil {
+		return nil, err
+	}
+	if !ok {
+		return plan, nil
+	}
+
+	fmt.Fprintln(p.out, "  Templates may use {imsi}, {mcc}, {mnc} and {domain}")
+	domainTpl, err := p.ask("  Domain", wizardDomainTemplate)
+	if err != nil {
+		return nil, err
+	}
+	impiTpl, err := p.ask("  IMPI", wizardIMPITemplate)
+	if err != nil {
+		return nil, err
+	}
+	impuTpl, err := p.ask("  IMPU", wizardIMPUTemplate)
+	if err != nil {
+		return nil, err
+	}
+	pcscfTpl, err := p.ask("  P-CSCF (\"-\" to skip)", wizardPCSCFTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	domain := expandIMSTemplate(domainTpl, imsi, info.MNCLength, "")
+	plan.ISIM = &sim.ISIMConfig{
+		Domain: domain,
+		IMPI:   expandIMSTemplate(impiTpl, imsi, info.MNCLength, domain),
+		IMPU:   []string{expandIMSTemplate(impuTpl, imsi, info.MNCLength, domain)},
+	}
+	if pcscfTpl != "-" {
+		plan.ISIM.PCSCF = []string{expandIMSTemplate(pcscfTpl, imsi, info.MNCLength, domain)}
+	}
+	return plan, nil
+}
+
+// runWizard detects the card, builds a plan from the dialog, previews it in dry-run mode,
+// and after typed confirmation applies and verifies it
+func runWizard(reader *card.Reader, in io.Reader, out io.Writer) {
+	info := detectWizardCard(reader)
+	output.PrintWizardCardInfo(info.ICCID, info.IMSI, info.Model, info.HasISIM)
+
+	p := newWizardPrompter(in, out)
+	plan, err := buildWizardPlan(p, info)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	if plan.IMSI == "" && plan.SPN == "" && plan.Services == nil && plan.ISIM == nil {
+		printSuccess("Nothing selected, card left unchanged")
+		return
+	}
+
+	// Review: the same ApplyConfig run with writes intercepted by the reader
+	fmt.Fprintln(out)
+	printSuccess("Planned changes (dry run):")
+	simulated := reader.DryRun()
+	reader.SetDryRun(true)
+	preview, err := sim.ApplyConfig(reader, plan, true, false)
+	reader.SetDryRun(simulated)
+	output.PrintApplyReport(preview)
+	if err != nil {
+		printError(fmt.Sprintf("Plan cannot be applied: %v", err))
+		return
+	}
+	if simulated {
+		printWarning("--dry-run is set: nothing written")
+		return
+	}
+
+	answer, err := p.ask(fmt.Sprintf("Type '%s' to write these changes", wizardConfirmWord), "")
+	if err != nil || answer != wizardConfirmWord {
+		printWarning("Not confirmed, card left unchanged")
+		return
+	}
+
+	report, err := sim.ApplyConfig(reader, plan, false, false)
+	output.PrintApplyReport(report)
+	if err != nil {
+		printError(fmt.Sprintf("Write failed: %v", err))
+		return
+	}
+
+	if check := settleAndVerify(reader, report.AppliedOperations(), nil); check != nil {
+		check.print()
+	}
+	verify, err := sim.VerifyConfig(reader, plan)
+	if err != nil {
+		printError(fmt.Sprintf("Verify failed: %v", err))
+		return
+	}
+	output.PrintVerifyReport(verify)
+	if verify.OK() {
+		printSuccess("Card provisioned and verified")
+	} else {
+		printError("Card content does not match the plan")
+	}
+}
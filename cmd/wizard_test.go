@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// ============ WIZARD TESTS ============
+
+func TestExpandIMSTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		imsi     string
+		mncLen   int
+		domain   string
+		want     string
+	}{
+		{"Domain 2-digit MNC", wizardDomainTemplate, "250880000000001", 2, "", "ims.mnc088.mcc250.3gppnetwork.org"},
+		{"Domain 3-digit MNC", wizardDomainTemplate, "310260000000001", 3, "", "ims.mnc260.mcc310.3gppnetwork.org"},
+		{"IMPU", wizardIMPUTemplate, "250880000000001", 2, "ims.example.org", "sip:250880000000001@ims.example.org"},
+		{"Literal", "pcscf.example.org", "250880000000001", 2, "", "pcscf.example.org"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := expandIMSTemplate(tc.template, tc.imsi, tc.mncLen, tc.domain); got != tc.want {
+				t.Errorf("expandIMSTemplate() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBuildWizardPlan(t *testing.T) {
+	info := wizardCardInfo{IMSI: "001010000000001", MNCLength: 2, HasISIM: true}
+
+	tests := []struct {
+		name    string
+		info    wizardCardInfo
+		input   string
+		check   func(t *testing.T, plan *sim.SIMConfig)
+		wantErr bool
+	}{
+		{
+			name:  "Nothing selected",
+			info:  info,
+			input: "n\nn\nn\nn\n",
+			check: func(t *testing.T, plan *sim.SIMConfig) {
+				if plan.IMSI != "" || plan.SPN != "" || plan.Services != nil || plan.ISIM != nil {
+					t.Errorf("plan = %+v, want empty", plan)
+				}
+			},
+		},
+		{
+			name:  "IMSI re-asked until valid, VoLTE and SPN",
+			info:  info,
+			input: "y\n25088abc\n250880000000001\ny\ny\nTest Net\nn\n",
+			check: func(t *testing.T, plan *sim.SIMConfig) {
+				if plan.IMSI != "250880000000001" || plan.SPN != "Test Net" {
+					t.Errorf("IMSI/SPN = %q/%q", plan.IMSI, plan.SPN)
+				}
+				if plan.Services == nil || plan.Services.VoLTE == nil || !*plan.Services.VoLTE {
+					t.Errorf("Services = %+v, want VoLTE enabled", plan.Services)
+				}
+			},
+		},
+		{
+			name:  "IMS identities from default templates",
+			info:  info,
+			input: "y\n250880000000001\nn\nn\ny\n\n\n\n\n",
+			check: func(t *testing.T, plan *sim.SIMConfig) {
+				want := sim.ISIMConfig{
+					Domain: "ims.mnc088.mcc250.3gppnetwork.org",
+					IMPI:   "250880000000001@ims.mnc088.mcc250.3gppnetwork.org",
+					IMPU:   []string{"sip:250880000000001@ims.mnc088.mcc250.3gppnetwork.org"},
+					PCSCF:  []string{"pcscf.ims.mnc088.mcc250.3gppnetwork.org"},
+				}
+				if plan.ISIM == nil || plan.ISIM.Domain != want.Domain || plan.ISIM.IMPI != want.IMPI ||
+					strings.Join(plan.ISIM.IMPU, ",") != want.IMPU[0] || strings.Join(plan.ISIM.PCSCF, ",") != want.PCSCF[0] {
+					t.Errorf("ISIM = %+v, want %+v", plan.ISIM, want)
+				}
+			},
+		},
+		{
+			name:  "IMS identities from current IMSI, custom domain, no P-CSCF",
+			info:  info,
+			input: "n\nn\nn\nyes\nims.example.org\n\ntel:+{imsi}\n-\n",
+			check: func(t *testing.T, plan *sim.SIMConfig) {
+				if plan.IMSI != "" {
+					t.Errorf("IMSI = %q, want unchanged", plan.IMSI)
+				}
+				if plan.ISIM == nil || plan.ISIM.IMPI != "001010000000001@ims.example.org" ||
+					plan.ISIM.IMPU[0] != "tel:+001010000000001" || plan.ISIM.PCSCF != nil {
+					t.Errorf("ISIM = %+v", plan.ISIM)
+				}
+			},
+		},
+		{
+			name:  "No ISIM: IMS question skipped",
+			info:  wizardCardInfo{IMSI: "001010000000001", MNCLength: 2},
+			input: "n\nn\nn\n",
+			check: func(t *testing.T, plan *sim.SIMConfig) {
+				if plan.ISIM != nil {
+					t.Errorf("ISIM = %+v, want nil", plan.ISIM)
+				}
+			},
+		},
+		{
+			name:    "Input ends early",
+			info:    info,
+			input:   "y\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			plan, err := buildWizardPlan(newWizardPrompter(strings.NewReader(tc.input), &out), tc.info)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("buildWizardPlan() = %+v, want error", plan)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildWizardPlan() error = %v\n%s", err, out.String())
+			}
+			tc.check(t, plan)
+		})
+	}
+}
+
+func TestRunWizard(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantIMSI string
+	}{
+		{"Confirmed", "y\n001019999999999\nn\ny\nWizard\nyes\n", "001019999999999"},
+		{"Not confirmed", "y\n001019999999999\nn\ny\nWizard\nno\n", "001010000000001"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := newTestCard()
+			reader := card.NewReaderWithTransport("Mock Reader", mock.ATR, mock)
+			sim.DetectApplicationAIDs(reader)
+			defer func() {
+				sim.DetectedUSIM_AID = nil
+				sim.DetectedISIM_AID = nil
+			}()
+
+			var out bytes.Buffer
+			runWizard(reader, strings.NewReader(tc.input), &out)
+
+			data, err := sim.ReadUSIM(reader)
+			if err != nil {
+				t.Fatalf("ReadUSIM() error = %v", err)
+			}
+			if data.IMSI != tc.wantIMSI {
+				t.Errorf("IMSI = %q, want %q\n%s", data.IMSI, tc.wantIMSI, out.String())
+			}
+			if reader.DryRun() {
+				t.Errorf("reader left in dry-run mode")
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/spf13/cobra"
 
 	"sim_reader/card"
+	"sim_reader/inputs"
 	"sim_reader/output"
 	"sim_reader/sim"
 )
@@ -15,10 +18,20 @@ var (
 	writeConfigFile string
 	writeIMSI       string
 	writeIMPI       string
-	writeIMPU       string
+	writeIMPU       []string
+	writeIMPUClear  bool
+	isimIndex       int
 	writeDomain     string
 	writePCSCF      string
+	imsAuto         bool
+	imsPCSCFTpl     string
+	imsTemplateFile string
 	writeSPN        string
+	writePSISMSC    string
+	writeLogo       string
+	writeSMSC       string
+	writeVoicemail  string
+	writeNASConfig  string
 	writeHPLMN      string
 	writeUserPLMN   string
 	writeOPLMN      string
@@ -37,9 +50,16 @@ var (
 	disableVoicePref bool
 
 	// Other write flags
-	clearFPLMN   bool
-	setCardAlgo  string
-	showCardAlgo bool
+	invalidateKeys bool
+	invalidate5G   bool
+	clearFPLMN     bool
+	writeFPLMN     string
+	setCardAlgo    string
+	showCardAlgo   bool
+
+	// Advice of charge flags (PIN2 instead of ADM)
+	resetACM    bool
+	writeACMmax int
 
 	// ADM key change flags
 	changeADM1 string
@@ -48,26 +68,90 @@ var (
 	changeADM4 string
 
 	// Programmable card flags
-	progDryRun bool
-	progForce  bool
+	progForce bool
+
+	// Guided provisioning dialog
+	writeWizard bool
+
+	// EF_DIR application entries
+	efdirAdd    []string
+	efdirRemove []string
+
+	// APN control list (EF_ACL)
+	writeACL   []string
+	aclEnable  bool
+	aclDisable bool
+
+	// Enabled services table (EF_EST), e.g. fdn=0,acl=1
+	setEST string
+
+	// Barred dialling numbers (EF_BDN, PIN2) and the BDN service (EST service 2)
+	bdnAdd     []string
+	bdnEnable  bool
+	bdnDisable bool
+
+	// Steering of roaming (EF_FROMPREFERRED, EF_SOR-CMCI in DF_5GS)
+	writeFromPreferred int
+	writeSORCMCI       string
 )
 
 var writeCmd = &cobra.Command{
 	Use:   "write",
+	Annotations: writeAccess,
 	Short: "Write SIM card parameters",
 	Long: `Write parameters to SIM/USIM/ISIM card.
 Requires ADM key (-a/--adm) for most operations.
 
 Examples:
-  # Write from JSON config file
+  # Write from JSON or YAML config file
   sim_reader write -a 77111606 -f config.json
+  sim_reader write -a 77111606 -f config.yaml
+
+  # Guided first-time provisioning (IMSI, VoLTE, SPN, IMS identities)
+  sim_reader write -a 77111606 --wizard
+
+  # Replace the operator logo (PNG converted to B/W, existing EF_IMG instance)
+  sim_reader write -a 77111606 --write-logo logo.png
 
   # Write IMSI
   sim_reader write -a 77111606 --imsi 250880000000001
 
+  # Write IMSI and the IMPI/IMPU/domain derived from it (3GPP defaults)
+  sim_reader write -a 77111606 --imsi 250880000000001 --ims-auto --ims-pcscf-template "pcscf.{domain}"
+
+  # Set the SM-SC for SMS over IP (EF_PSISMSC)
+  sim_reader write -a 77111606 --write-psismsc tel:+79990000000
+
+  # Set the default SMS service centre (EF_SMSP record 1)
+  sim_reader write -a 77111606 --write-smsc +79990000000
+
+  # Set the voicemail number of line 1 (EF_MBDN record referenced by EF_MBI)
+  sim_reader write -a 77111606 --write-voicemail +79990001122
+
+  # Set NAS parameters of an NB-IoT card (EF_NASCONFIG, e.g. {"nas_signalling_low_priority": true})
+  sim_reader write -a 77111606 --write-nasconfig nasconfig.json
+
+  # Restrict data to the enterprise APNs (EF_ACL) and enforce the list (UST 35, EST 3)
+  sim_reader write -a 77111606 --write-acl internet,ims --acl-enable
+
+  # Disable FDN and enable the APN control list in the enabled services table (EF_EST)
+  sim_reader write -a 77111606 --set-est fdn=0,acl=1
+
+  # Bar premium numbers (EF_BDN, PIN2) and enable barred dialling (EST service 2)
+  sim_reader write --pin2 5678 --bdn-add "Premium:+79001234567" --bdn-add "Blocked:0900123" --bdn-enable
+
+  # Steering of roaming tests: "from preferred" indicator and SOR-CMCI (UST 131/132)
+  sim_reader write -a 77111606 --write-from-preferred 1 --write-sor-cmci sor-cmci.json
+
   # Write ISIM parameters
   sim_reader write -a 77111606 --impi 250880...@ims.domain.org --impu sip:250880...@ims.domain.org
 
+  # Write the second ISIM of a multi-ISIM card (e.g. MCPTT next to commercial IMS)
+  sim_reader write -a 77111606 --isim-index 2 --impi mcptt-user@mcptt.domain.org
+
+  # Write several IMPUs (records 1..n in order, remaining records are cleared)
+  sim_reader write -a 77111606 --impu tel:+79001234567 --impu sip:250880...@ims.domain.org --impu sip:+79001234567@ims.domain.org
+
   # Enable VoLTE and VoWiFi
   sim_reader write -a 77111606 --enable-volte --enable-vowifi
 
@@ -80,12 +164,35 @@ Examples:
   # Clear forbidden PLMN list
   sim_reader write -a 77111606 --clear-fplmn
 
+  # Set forbidden PLMN list
+  sim_reader write -a 77111606 --write-fplmn 262:01,208:10
+
+  # Prepaid test setup: reset call meter and set its maximum (PIN2, no ADM needed)
+  sim_reader write --pin2 1234 --reset-acm --acm-max 500
+
+  # Register an ISIM installed via GlobalPlatform in EF_DIR
+  sim_reader write -a 77111606 --efdir-add A0000000871004FF49FF0589:ISIM
+
   # Change ADM1 key
   sim_reader write -a 77111606 --change-adm1 1122334455667788
 
+  # Force a fresh authentication after changing Ki/OPc (KSI/CKSN 07 in EF_Keys/KeysPS/Kc/KcGPRS)
+  sim_reader write -p 1234 --invalidate-keys
+
   # Set authentication algorithm
   sim_reader write -a 77111606 --set-algo milenage
 
+  # Print a per-card activation sheet (ICCID QR code, IMSI, services) from the card read back
+  sim_reader write -a 77111606 -f config.yaml --summary-sheet card.pdf
+
+  # Append the subscriber (IMSI from the card, Ki/OPc from the config) to an open5gs import file
+  sim_reader write -a 77111606 -f config.yaml --export-core open5gs --export-core-file subscribers.json
+
+  # Save the card content, write, and restore it if something went wrong
+  sim_reader write -a 77111606 --snapshot before.snap
+  sim_reader write -a 77111606 -f config.yaml --auto-snapshot
+  sim_reader write -a 77111606 --rollback before.snap
+
   # Programmable card: dry run (safe test)
   sim_reader write -a 4444444444444444 -f prog_config.json --dry-run
 
@@ -97,21 +204,41 @@ Examples:
 func init() {
 	// Config file
 	writeCmd.Flags().StringVarP(&writeConfigFile, "file", "f", "",
-		"Apply configuration from JSON file")
+		"Apply configuration from JSON or YAML file")
 
 	// Individual parameters
 	writeCmd.Flags().StringVar(&writeIMSI, "imsi", "",
 		"Write IMSI (e.g., 250880000000001)")
 	writeCmd.Flags().StringVar(&writeIMPI, "impi", "",
 		"Write IMPI (IMS Private Identity)")
-	writeCmd.Flags().StringVar(&writeIMPU, "impu", "",
-		"Write IMPU (IMS Public Identity)")
+	writeCmd.Flags().StringSliceVar(&writeIMPU, "impu", nil,
+		"Write IMPU (IMS Public Identity); repeat or comma-separate for several records")
+	writeCmd.Flags().BoolVar(&writeIMPUClear, "impu-clear", false,
+		"Blank all EF_IMPU records")
+	writeCmd.Flags().IntVar(&isimIndex, "isim-index", 0,
+		"ISIM instance for ISIM writes on multi-ISIM cards (1 = first ISIM in EF_DIR, see 'read')")
 	writeCmd.Flags().StringVar(&writeDomain, "domain", "",
 		"Write Home Network Domain")
 	writeCmd.Flags().StringVar(&writePCSCF, "pcscf", "",
 		"Write P-CSCF address")
+	writeCmd.Flags().BoolVar(&imsAuto, "ims-auto", false,
+		"Generate and write IMPI, IMPU and domain from the IMSI (--imsi, config or card) and the EF_AD MNC length")
+	writeCmd.Flags().StringVar(&imsPCSCFTpl, "ims-pcscf-template", "",
+		"With --ims-auto, also write a P-CSCF from this template ({imsi}, {mcc}, {mnc}, {msin}, {domain}, {impi})")
+	writeCmd.Flags().StringVar(&imsTemplateFile, "ims-template", "",
+		"With --ims-auto, JSON or YAML file with domain/impi/impu/pcscf templates replacing the 3GPP defaults")
 	writeCmd.Flags().StringVar(&writeSPN, "spn", "",
 		"Write Service Provider Name")
+	writeCmd.Flags().StringVar(&writePSISMSC, "write-psismsc", "",
+		"Write the PSI of the SM-SC for SMS over IP (EF_PSISMSC, e.g. tel:+79990000000)")
+	writeCmd.Flags().StringVar(&writeLogo, "write-logo", "",
+		"Write a PNG as operator logo (converted to B/W, written over the first basic image of EF_IMG; the instance file must be large enough)")
+	writeCmd.Flags().StringVar(&writeSMSC, "write-smsc", "",
+		"Write the default SMS service centre address (EF_SMSP record 1, e.g. +79990000000)")
+	writeCmd.Flags().StringVar(&writeVoicemail, "write-voicemail", "",
+		"Write the voicemail number of line 1 (EF_MBDN record referenced by EF_MBI, digits beyond 20 in EF_EXT6; marks UST service 47)")
+	writeCmd.Flags().StringVar(&writeNASConfig, "write-nasconfig", "",
+		"Write NAS configuration parameters from a JSON file (EF_NASCONFIG, other parameters are kept)")
 	writeCmd.Flags().StringVar(&writeHPLMN, "hplmn", "",
 		"Write HPLMN (MCC:MNC:ACT, e.g., 250:88:eutran,utran,gsm)")
 	writeCmd.Flags().StringVar(&writeUserPLMN, "user-plmn", "",
@@ -121,6 +248,30 @@ func init() {
 	writeCmd.Flags().StringVar(&setOpMode, "op-mode", "",
 		"Set UE operation mode (normal, type-approval, cell-test, etc.)")
 
+	// APN control list
+	writeCmd.Flags().StringSliceVar(&writeACL, "write-acl", nil,
+		"Write the APN control list (EF_ACL, e.g. internet,ims; * = network provided APN)")
+	writeCmd.Flags().BoolVar(&aclEnable, "acl-enable", false,
+		"Enable the APN control list (UST service 35 and EST service 3)")
+	writeCmd.Flags().BoolVar(&aclDisable, "acl-disable", false,
+		"Disable the APN control list (EST service 3)")
+	writeCmd.Flags().StringVar(&setEST, "set-est", "",
+		"Enable/disable services in the enabled services table (EF_EST): fdn, bdn, acl or a number, e.g. fdn=0,acl=1")
+
+	// Barred dialling numbers
+	writeCmd.Flags().StringArrayVar(&bdnAdd, "bdn-add", nil,
+		"Add a barred dialling number to the first free EF_BDN record, \"Name:+79001234567\" (repeatable, requires --pin2)")
+	writeCmd.Flags().BoolVar(&bdnEnable, "bdn-enable", false,
+		"Enable barred dialling (EST service 2; needs EF_BDN and UST service 6)")
+	writeCmd.Flags().BoolVar(&bdnDisable, "bdn-disable", false,
+		"Disable barred dialling (EST service 2)")
+
+	// Steering of roaming
+	writeCmd.Flags().IntVar(&writeFromPreferred, "write-from-preferred", -1,
+		"Set the \"from preferred\" indicator of EF_FROMPREFERRED: 1 or 0 (marks UST service 131)")
+	writeCmd.Flags().StringVar(&writeSORCMCI, "write-sor-cmci", "",
+		"Write the SOR-CMCI of EF_SOR-CMCI in DF_5GS from a JSON file, e.g. {\"cmci\": \"...\"} (other objects are kept, marks UST service 132)")
+
 	// Service enable flags
 	writeCmd.Flags().BoolVar(&enableVoLTE, "enable-volte", false,
 		"Enable VoLTE services")
@@ -142,12 +293,24 @@ func init() {
 		"Disable Voice Domain Preference (ISIM)")
 
 	// Other flags
+	writeCmd.Flags().BoolVar(&invalidateKeys, "invalidate-keys", false,
+		"Mark EF_Keys, EF_KeysPS, EF_Kc and EF_KcGPRS as 'no key available' (KSI 07) to force a fresh authentication")
+	writeCmd.Flags().BoolVar(&invalidate5G, "invalidate-5g-context", false,
+		"Mark the 5G NAS security contexts (EF_5GS3GPPNSC, EF_5GSN3GPPNSC) as 'no key available' (ngKSI 07)")
 	writeCmd.Flags().BoolVar(&clearFPLMN, "clear-fplmn", false,
 		"Clear Forbidden PLMN list")
+	writeCmd.Flags().StringVar(&writeFPLMN, "write-fplmn", "",
+		"Set Forbidden PLMN list (MCC:MNC,... e.g., 262:01,208:10)")
 	writeCmd.Flags().BoolVar(&showCardAlgo, "show-algo", false,
 		"Show current USIM auth algorithm (EF 8F90)")
 	writeCmd.Flags().StringVar(&setCardAlgo, "set-algo", "",
-		"Set USIM auth algorithm: milenage, s3g-128, tuak, s3g-256")
+		"Set USIM auth algorithm: milenage, s3g-128, tuak, s3g-256; RuSIM/OX24 options e.g. tuak:keccak=2:reslen=8, keylen=16|32")
+
+	// Advice of charge flags
+	writeCmd.Flags().BoolVar(&resetACM, "reset-acm", false,
+		"Reset the accumulated call meter EF_ACM to 0 (requires --pin2)")
+	writeCmd.Flags().IntVar(&writeACMmax, "acm-max", -1,
+		"Set EF_ACMmax in units, 0 = no limit (requires --pin2)")
 
 	// ADM key change flags
 	writeCmd.Flags().StringVar(&changeADM1, "change-adm1", "",
@@ -160,30 +323,257 @@ func init() {
 		"Change ADM4 key to new value (requires --adm4 with current key)")
 
 	// Programmable card flags
-	writeCmd.Flags().BoolVar(&progDryRun, "dry-run", false,
-		"Simulate programmable card operations without writing (SAFE test mode)")
 	writeCmd.Flags().BoolVar(&progForce, "force", false,
 		"Force programmable operations on unrecognized cards (EXTREMELY DANGEROUS!)")
+	writeCmd.Flags().BoolVar(&writeWizard, "wizard", false,
+		"Interactive provisioning: review planned changes, confirm, write and verify")
+
+	// EF_DIR application entries
+	writeCmd.Flags().StringArrayVar(&efdirAdd, "efdir-add", nil,
+		"Register an application in EF_DIR as AID[:LABEL] (repeatable)")
+	writeCmd.Flags().StringArrayVar(&efdirRemove, "efdir-remove", nil,
+		"Remove the EF_DIR entry of an application AID (repeatable)")
+
+	writeCmd.Flags().BoolVar(&skipAccessCheck, "skip-access-check", false,
+		"Do not compare the access conditions of the written files with the given PIN/ADM keys before writing")
+
+	// Card content snapshot / rollback
+	writeCmd.Flags().StringVar(&snapshotFile, "snapshot", "",
+		"Save all files restorable with the given credentials (PIN/ADM) to FILE before writing")
+	writeCmd.Flags().StringVar(&rollbackFile, "rollback", "",
+		"Restore a snapshot saved with --snapshot, verifying every write")
+	writeCmd.Flags().BoolVar(&autoSnapshot, "auto-snapshot", false,
+		"Save a snapshot (snapshot-<ICCID>-<time>.snap) before applying the config file")
+	writeCmd.Flags().StringVar(&factoryResetFile, "factory-reset", "",
+		"Reset the card to a golden config (--json export of a pristine card): config, FPLMN, service tables, location files, keys, SMS and phonebook; asks for confirmation")
+
+	// Card-to-card copy
+	writeCmd.Flags().IntVar(&copyFromReader, "copy-from-reader", -1,
+		"Copy IMSI, SPN, PLMN lists, service tables, IMS identities, phonebook and SMS from the card in this reader")
+	writeCmd.Flags().IntVar(&copyToReader, "copy-to-reader", -1,
+		"Target reader of --copy-from-reader (ADM/PIN flags apply to this card)")
+	writeCmd.Flags().StringVar(&copyFromPIN1, "copy-from-pin1", "",
+		"PIN1 of the source card of --copy-from-reader")
+
+	// Activation summary sheet
+	writeCmd.Flags().StringVar(&summarySheet, "summary-sheet", "",
+		"After writing, read the card back and save a summary sheet with ICCID QR code (.html or .pdf)")
+	writeCmd.Flags().BoolVar(&summaryIncludeSecrets, "summary-include-secrets", false,
+		"Print the ADM1 key on the summary sheet")
+
+	// Settle step before verifying writes that need a REFRESH
+	addPostWriteFlags(writeCmd)
+
+	// Barcode scanner input for the wizard
+	addScanFlags(writeCmd)
+
+	// Core network subscriber export
+	addExportCoreFlags(writeCmd)
 
 	rootCmd.AddCommand(writeCmd)
 }
 
 func runWrite(cmd *cobra.Command, args []string) {
+	if writeWizard && refuseReadOnly("--wizard") ||
+		rollbackFile != "" && refuseReadOnly("--rollback") ||
+		autoSnapshot && refuseReadOnly("--auto-snapshot") ||
+		factoryResetFile != "" && refuseReadOnly("--factory-reset") {
+		return
+	}
+	if writeWizard {
+		if outputJSON {
+			printError("--wizard is interactive and cannot be combined with --json")
+			return
+		}
+		if err := requireADMKey(); err != nil {
+			printError(err.Error())
+			return
+		}
+		in := cmd.InOrStdin()
+		if scanMode {
+			lines, err := scanExpectedCard(in, cmd.OutOrStdout(), nil)
+			if err != nil {
+				printError(err.Error())
+				return
+			}
+			in = lines
+		}
+		reader, err := connectAndPrepareReader()
+		if err != nil {
+			printError(err.Error())
+			return
+		}
+		defer reader.Close()
+		runWizard(reader, in, cmd.OutOrStdout())
+		return
+	}
+	if scanMode {
+		printError("--scan requires --wizard (or script pcom)")
+		return
+	}
+
+	// Card-to-card copy between two readers
+	if copyFromReader >= 0 || copyToReader >= 0 {
+		if !refuseReadOnly("--copy-to-reader") {
+			runCardCopy()
+		}
+		return
+	}
+
+	// Reset the card to a golden config, after typed confirmation
+	if factoryResetFile != "" {
+		if outputJSON {
+			printError("--factory-reset is interactive and cannot be combined with --json")
+			return
+		}
+		golden, err := sim.LoadConfig(factoryResetFile)
+		if err != nil {
+			printError(fmt.Sprintf("Failed to load golden config: %v", err))
+			return
+		}
+		if err := requireADMKey(); err != nil {
+			printError(err.Error())
+			return
+		}
+		reader, err := connectAndPrepareReader()
+		if err != nil {
+			printError(err.Error())
+			return
+		}
+		defer reader.Close()
+		runFactoryReset(reader, golden, factoryResetFile, cmd.InOrStdin(), cmd.OutOrStdout())
+		return
+	}
+
+	// Restore a snapshot taken with --snapshot
+	if rollbackFile != "" {
+		reader, err := connectAndPrepareReader()
+		if err != nil {
+			printError(err.Error())
+			return
+		}
+		defer reader.Close()
+		runRollback(reader, rollbackFile)
+		return
+	}
+
 	// Check if any write operation is requested
-	isWriteMode := writeConfigFile != "" || writeIMSI != "" || writeIMPI != "" ||
-		writeIMPU != "" || writeDomain != "" || writePCSCF != "" || writeSPN != "" ||
+	isWriteMode := writeConfigFile != "" || writeIMSI != "" || writeIMPI != "" || imsAuto ||
+		len(writeIMPU) > 0 || writeIMPUClear || writeDomain != "" || writePCSCF != "" || writeSPN != "" || writePSISMSC != "" || writeLogo != "" || writeSMSC != "" || writeVoicemail != "" || writeNASConfig != "" ||
 		writeHPLMN != "" || writeUserPLMN != "" || writeOPLMN != "" || setOpMode != "" ||
 		enableVoLTE || enableVoWiFi || enableSMSOverIP || enableVoicePref ||
 		disableVoLTE || disableVoWiFi || disableSMSOverIP || disableVoicePref ||
-		clearFPLMN ||
+		clearFPLMN || writeFPLMN != "" ||
 		changeADM1 != "" || changeADM2 != "" || changeADM3 != "" || changeADM4 != "" ||
-		setCardAlgo != ""
+		setCardAlgo != "" || len(efdirAdd) > 0 || len(efdirRemove) > 0 ||
+		len(writeACL) > 0 || aclEnable || aclDisable || writeFromPreferred >= 0 || writeSORCMCI != ""
+
+	// Advice of charge files are protected by PIN2, not ADM
+	isPIN2Write := resetACM || writeACMmax >= 0 || len(bdnAdd) > 0
+
+	// EF_EST needs ADM or PIN2 depending on the card; a refusal names the missing credential
+	isESTWrite := setEST != "" || bdnEnable || bdnDisable
+
+	// Checked before the help: a template flag without --ims-auto is a mistake, not an empty call
+	imsTemplates, err := imsAutoTemplates()
+	if err != nil {
+		printError(err.Error())
+		return
+	}
 
 	// Only show algo doesn't require ADM
-	if !isWriteMode && !showCardAlgo {
+	if !isWriteMode && !isPIN2Write && !isESTWrite && !showCardAlgo && !invalidateKeys && !invalidate5G && snapshotFile == "" && summarySheet == "" && exportCoreFormat == "" {
 		cmd.Help()
 		return
 	}
+	if (isWriteMode || isPIN2Write || isESTWrite || invalidateKeys || invalidate5G) && refuseReadOnly("write") {
+		return
+	}
+	if err := checkExportCoreFlags(); err != nil {
+		printError(err.Error())
+		return
+	}
+
+	// Load the config before connecting: k_derivation is refused without its master key
+	var writeConfig *sim.SIMConfig
+	if writeConfigFile != "" {
+		var err error
+		if writeConfig, err = sim.LoadConfig(writeConfigFile); err != nil {
+			printError(fmt.Sprintf("Failed to load config: %v", err))
+			return
+		}
+		if writeConfig.KDerivation != nil {
+			if err := writeConfig.ValidateKDerivation(); err != nil {
+				printError(err.Error())
+				return
+			}
+			if exportCoreFormat == "" && !dryRun {
+				printError("k_derivation requires --export-core: the derived Ki/OPc are only written to --export-core-file")
+				return
+			}
+		}
+	}
+	if aclEnable && aclDisable {
+		printError("--acl-enable and --acl-disable cannot be combined")
+		return
+	}
+	if bdnEnable && bdnDisable {
+		printError("--bdn-enable and --bdn-disable cannot be combined")
+		return
+	}
+	if writeFromPreferred > 1 || writeFromPreferred < -1 {
+		printError("--write-from-preferred must be 1 or 0")
+		return
+	}
+	if writeIMSI != "" {
+		if writeIMSI, err = inputs.IMSI("--imsi", writeIMSI); err != nil {
+			printError(err.Error())
+			return
+		}
+	}
+	for _, f := range []struct{ name, value string }{
+		{"--change-adm1", changeADM1}, {"--change-adm2", changeADM2},
+		{"--change-adm3", changeADM3}, {"--change-adm4", changeADM4},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if _, err := inputs.ADMKey(f.name, f.value); err != nil {
+			printError(err.Error())
+			return
+		}
+	}
+	if writeVoicemail != "" {
+		if _, err := sim.NormalizeVoicemailNumber(writeVoicemail); err != nil {
+			printError(err.Error())
+			return
+		}
+	}
+	bdnEntries := make([]sim.BDNEntry, 0, len(bdnAdd))
+	for _, s := range bdnAdd {
+		entry, err := sim.ParseBDNEntry(s)
+		if err != nil {
+			printError(err.Error())
+			return
+		}
+		bdnEntries = append(bdnEntries, entry)
+	}
+	var estServices map[sim.ESTService]bool
+	if setEST != "" {
+		var err error
+		if estServices, err = sim.ParseESTServices(setEST); err != nil {
+			printError(fmt.Sprintf("Invalid --set-est: %v", err))
+			return
+		}
+	}
+	if isPIN2Write && pin2 == "" {
+		printError("--reset-acm, --acm-max and --bdn-add require PIN2 (--pin2)")
+		return
+	}
+
+	// Checked against the card before the ADM keys are verified
+	plannedWrites = plannedWriteTargets(writeConfig)
+	defer func() { plannedWrites = nil }()
 
 	// Require ADM key for write operations
 	if isWriteMode {
@@ -201,6 +591,26 @@ func runWrite(cmd *cobra.Command, args []string) {
 	}
 	defer reader.Close()
 
+	// Record the old content of every EF written below for the changes summary
+	reader.SetChangeLog(true)
+
+	// Direct ISIM writes to one instance of a multi-ISIM card
+	if isimIndex != 0 {
+		if err := sim.SelectISIMInstance(isimIndex); err != nil {
+			printError(err.Error())
+			return
+		}
+		printSuccess(fmt.Sprintf("ISIM writes go to ISIM %d (AID %X)", isimIndex, sim.GetISIMAID()))
+	}
+
+	// Save the card content before anything is written
+	if snapshotFile != "" {
+		if err := saveCardSnapshot(reader, snapshotFile); err != nil {
+			printError(err.Error())
+			return
+		}
+	}
+
 	// Show/set proprietary USIM authentication algorithm (EF 8F90) if requested
 	if showCardAlgo || setCardAlgo != "" {
 		drv := sim.FindDriver(reader)
@@ -217,6 +627,9 @@ func runWrite(cmd *cobra.Command, args []string) {
 			}
 
 			algo, err := drv.GetAlgorithmType(reader)
+			if p, ok := drv.(sim.AlgorithmParamsReader); ok && err == nil && sim.HasCapability(drv, sim.CapAlgorithmParams) {
+				algo, err = p.AlgorithmParams(reader)
+			}
 			if err != nil {
 				printWarning(fmt.Sprintf("USIM auth algorithm read failed: %v", err))
 			} else {
@@ -225,32 +638,53 @@ func runWrite(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	if !isWriteMode {
+	// Security contexts need PIN1 at most, not ADM
+	if invalidateKeys {
+		output.PrintKeyInvalidation(sim.InvalidateSecurityContexts(reader))
+	}
+	if invalidate5G {
+		output.PrintKeyInvalidation(sim.InvalidateFiveGSecurityContexts(reader))
+	}
+
+	if !isWriteMode && !isPIN2Write && !isESTWrite {
+		printWriteChanges(reader, nil, nil)
+		writeSummarySheet(reader)
+		exportCoreAfterWrite(reader, nil)
 		return
 	}
 
 	fmt.Println()
 	printSuccess("Starting write operations...")
 
-	// Apply JSON config
-	if writeConfigFile != "" {
-		config, err := sim.LoadConfig(writeConfigFile)
-		if err != nil {
-			printError(fmt.Sprintf("Failed to load config: %v", err))
-			return
-		}
+	// Apply JSON/YAML config
+	var report *sim.ApplyReport
+	if writeConfig != nil {
+		config := writeConfig
 
 		// Show programmable card warning if programmable fields are present
 		if config.RequiresProgrammableCard() {
-			output.PrintProgrammableWriteWarning(progDryRun)
+			output.PrintProgrammableWriteWarning(dryRun)
+		}
+
+		if autoSnapshot && snapshotFile == "" {
+			if err := saveAutoSnapshot(reader); err != nil {
+				printError(err.Error())
+				return
+			}
 		}
 
-		if err := sim.ApplyConfig(reader, config, progDryRun, progForce); err != nil {
+		var err error
+		report, err = sim.ApplyConfig(reader, config, dryRun, progForce)
+		if !outputJSON {
+			output.PrintApplyReport(report)
+		}
+		if err != nil {
 			printError(fmt.Sprintf("Config apply failed: %v", err))
 		}
 
 		// Exit after dry run for programmable operations
-		if progDryRun && config.RequiresProgrammableCard() {
+		if dryRun && config.RequiresProgrammableCard() {
+			printWriteChanges(reader, report, nil)
 			return
 		}
 	}
@@ -272,6 +706,112 @@ func runWrite(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if writePSISMSC != "" {
+		if err := sim.WritePSISMSC(reader, writePSISMSC); err != nil {
+			printError(fmt.Sprintf("Write PSI SMSC failed: %v", err))
+		} else {
+			printSuccess("PSI SMSC written successfully")
+			if usim, err := sim.ReadUSIM(reader); err == nil && usim.UST != nil && !usim.HasSMSOverIP() {
+				printWarning(fmt.Sprintf("SMS over IP (UST service %d) is disabled, the UE will not use the PSI SMSC", sim.UST_SMS_OVER_IP))
+			}
+		}
+	}
+
+	if writeLogo != "" {
+		writeLogoFromFile(reader, writeLogo)
+	}
+
+	if writeSMSC != "" {
+		if err := sim.WriteSMSP(reader, sim.SMSParams{SMSC: writeSMSC}); err != nil {
+			printError(fmt.Sprintf("Write SMSC failed: %v", err))
+		} else {
+			printSuccess("SMSC written successfully")
+		}
+	}
+
+	if writeVoicemail != "" {
+		written, err := sim.WriteVoicemail(reader, writeVoicemail)
+		switch {
+		case errors.Is(err, sim.ErrUSTTooShort):
+			printSuccess(fmt.Sprintf("Voicemail number written to EF_MBDN record %d in %s", written.Record, written.Location))
+			printWarning(err.Error())
+		case err != nil:
+			printError(fmt.Sprintf("Write voicemail failed: %v", err))
+		default:
+			msg := fmt.Sprintf("Voicemail number written to EF_MBDN record %d in %s (UST service %d)", written.Record, written.Location, sim.UST_MBDN)
+			if len(written.EXT6) > 0 {
+				msg += fmt.Sprintf(", overflow digits in EF_EXT6 records %v", written.EXT6)
+			}
+			if written.MBI {
+				msg += ", EF_MBI line 1 updated"
+			}
+			printSuccess(msg)
+		}
+	}
+
+	if writeNASConfig != "" {
+		params, err := sim.LoadNASConfig(writeNASConfig)
+		if err != nil {
+			printError(err.Error())
+		} else if err := sim.WriteNASConfig(reader, params); err != nil {
+			printError(fmt.Sprintf("Write NAS config failed: %v", err))
+		} else {
+			printSuccess("NAS config written successfully")
+		}
+	}
+
+	if writeFromPreferred >= 0 {
+		err := sim.WriteFromPreferred(reader, writeFromPreferred == 1)
+		switch {
+		case errors.Is(err, sim.ErrUSTTooShort):
+			printSuccess(fmt.Sprintf("From preferred indicator set to %d", writeFromPreferred))
+			printWarning(err.Error())
+		case err != nil:
+			printError(fmt.Sprintf("Write from preferred failed: %v", err))
+		default:
+			printSuccess(fmt.Sprintf("From preferred indicator set to %d (UST service %d)", writeFromPreferred, sim.UST_FROM_PREFERRED))
+		}
+	}
+
+	if writeSORCMCI != "" {
+		update, err := sim.LoadSORCMCI(writeSORCMCI)
+		if err == nil {
+			err = sim.WriteSORCMCI(reader, update)
+		}
+		switch {
+		case errors.Is(err, sim.ErrUSTTooShort):
+			printSuccess("SOR-CMCI written")
+			printWarning(err.Error())
+		case err != nil:
+			printError(fmt.Sprintf("Write SOR-CMCI failed: %v", err))
+		default:
+			printSuccess(fmt.Sprintf("SOR-CMCI written (UST service %d)", sim.UST_SOR_CMCI))
+		}
+	}
+
+	if len(writeACL) > 0 {
+		apns, allowAll := sim.ParseACLEntries(writeACL)
+		if err := sim.WriteACL(reader, apns, allowAll); err != nil {
+			printError(fmt.Sprintf("Write ACL failed: %v", err))
+		} else {
+			printSuccess(fmt.Sprintf("APN control list written (%d APN(s))", len(writeACL)))
+		}
+	}
+
+	if aclEnable || aclDisable {
+		if err := sim.SetACLEnabled(reader, aclEnable); err != nil {
+			printError(fmt.Sprintf("Set ACL state failed: %v", err))
+		} else if aclEnable {
+			printSuccess("APN control list enabled")
+		} else {
+			printSuccess("APN control list disabled")
+		}
+	}
+
+	if imsAuto {
+		writeIMSAuto(reader, writeConfig, imsTemplates)
+	}
+
 	if writeIMPI != "" {
 		if err := sim.WriteIMPI(reader, writeIMPI); err != nil {
 			printError(fmt.Sprintf("Write IMPI failed: %v", err))
@@ -280,11 +820,19 @@ func runWrite(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	if writeIMPU != "" {
+	if writeIMPUClear && len(writeIMPU) == 0 {
+		if err := sim.ClearIMPU(reader); err != nil {
+			printError(fmt.Sprintf("Clear IMPU failed: %v", err))
+		} else {
+			printSuccess("EF_IMPU cleared")
+		}
+	}
+
+	if len(writeIMPU) > 0 {
 		if err := sim.WriteIMPU(reader, writeIMPU); err != nil {
 			printError(fmt.Sprintf("Write IMPU failed: %v", err))
 		} else {
-			printSuccess("IMPU written successfully")
+			printSuccess(fmt.Sprintf("IMPU written successfully (%d record(s))", len(writeIMPU)))
 		}
 	}
 
@@ -410,13 +958,89 @@ func runWrite(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if writeFPLMN != "" {
+		plmns, err := sim.ParsePLMNList(writeFPLMN)
+		if err != nil {
+			printError(fmt.Sprintf("Invalid FPLMN: %v", err))
+		} else if err := sim.WriteFPLMN(reader, plmns); err != nil {
+			printError(fmt.Sprintf("Write FPLMN failed: %v", err))
+		} else {
+			printSuccess(fmt.Sprintf("Forbidden PLMN list written (%d entries)", len(plmns)))
+		}
+	}
+
+	for _, entry := range efdirRemove {
+		aid, _, err := sim.ParseEFDIREntry(entry)
+		if err != nil {
+			printError(fmt.Sprintf("Invalid --efdir-remove: %v", err))
+		} else if records, err := sim.RemoveEFDIREntry(reader, aid); err != nil {
+			printError(fmt.Sprintf("EF_DIR remove failed: %v", err))
+		} else {
+			printSuccess(fmt.Sprintf("EF_DIR entry %X removed (record %v)", aid, records))
+		}
+	}
+
+	for _, entry := range efdirAdd {
+		aid, label, err := sim.ParseEFDIREntry(entry)
+		if err != nil {
+			printError(fmt.Sprintf("Invalid --efdir-add: %v", err))
+		} else if record, err := sim.AddEFDIREntry(reader, aid, label); err != nil {
+			printError(fmt.Sprintf("EF_DIR add failed: %v", err))
+		} else {
+			printSuccess(fmt.Sprintf("EF_DIR entry %X written to record %d", aid, record))
+		}
+	}
+
+	if resetACM {
+		if err := sim.ResetACM(reader); err != nil {
+			printError(fmt.Sprintf("Reset ACM failed: %v", err))
+		} else {
+			printSuccess("Accumulated call meter reset to 0")
+		}
+	}
+
+	if writeACMmax >= 0 {
+		if err := sim.WriteACMmax(reader, writeACMmax); err != nil {
+			printError(fmt.Sprintf("Write ACMmax failed: %v", err))
+		} else {
+			printSuccess(fmt.Sprintf("ACMmax set to %d units", writeACMmax))
+		}
+	}
+
+	if setEST != "" {
+		if err := sim.SetESTServices(reader, estServices); err != nil {
+			printError(fmt.Sprintf("Set EST services failed: %v%s", err, credentialFlagHint(err)))
+		} else {
+			printSuccess(fmt.Sprintf("EST services updated: %s", setEST))
+		}
+	}
+
+	if len(bdnEntries) > 0 {
+		records, err := sim.AddBDNEntries(reader, bdnEntries)
+		if err != nil {
+			printError(fmt.Sprintf("Add BDN entries failed: %v", err))
+		} else {
+			printSuccess(fmt.Sprintf("%d barred dialling number(s) written to EF_BDN records %v", len(records), records))
+		}
+	}
+
+	if bdnEnable || bdnDisable {
+		if err := sim.SetBDNEnabled(reader, bdnEnable); err != nil {
+			printError(fmt.Sprintf("Set BDN state failed: %v%s", err, credentialFlagHint(err)))
+		} else if bdnEnable {
+			printSuccess("Barred dialling enabled (EST service 2)")
+		} else {
+			printSuccess("Barred dialling disabled (EST service 2)")
+		}
+	}
+
 	// ADM key change operations
 	if changeADM1 != "" {
 		if admKey == "" {
 			printError("Change ADM1 requires -a/--adm with current ADM1 key")
 		} else {
 			oldKey, _ := card.ParseADMKey(admKey)
-			newKey, err := card.ParseADMKey(changeADM1)
+			newKey, err := inputs.ADMKey("--change-adm1", changeADM1)
 			if err != nil {
 				printError(fmt.Sprintf("Invalid new ADM1 key: %v", err))
 			} else {
@@ -435,7 +1059,7 @@ func runWrite(cmd *cobra.Command, args []string) {
 			printError("Change ADM2 requires --adm2 with current ADM2 key")
 		} else {
 			oldKey, _ := card.ParseADMKey(admKey2)
-			newKey, err := card.ParseADMKey(changeADM2)
+			newKey, err := inputs.ADMKey("--change-adm2", changeADM2)
 			if err != nil {
 				printError(fmt.Sprintf("Invalid new ADM2 key: %v", err))
 			} else {
@@ -454,7 +1078,7 @@ func runWrite(cmd *cobra.Command, args []string) {
 			printError("Change ADM3 requires --adm3 with current ADM3 key")
 		} else {
 			oldKey, _ := card.ParseADMKey(admKey3)
-			newKey, err := card.ParseADMKey(changeADM3)
+			newKey, err := inputs.ADMKey("--change-adm3", changeADM3)
 			if err != nil {
 				printError(fmt.Sprintf("Invalid new ADM3 key: %v", err))
 			} else {
@@ -473,7 +1097,7 @@ func runWrite(cmd *cobra.Command, args []string) {
 			printError("Change ADM4 requires --adm4 with current ADM4 key")
 		} else {
 			oldKey, _ := card.ParseADMKey(admKey4)
-			newKey, err := card.ParseADMKey(changeADM4)
+			newKey, err := inputs.ADMKey("--change-adm4", changeADM4)
 			if err != nil {
 				printError(fmt.Sprintf("Invalid new ADM4 key: %v", err))
 			} else {
@@ -489,5 +1113,52 @@ func runWrite(cmd *cobra.Command, args []string) {
 
 	fmt.Println()
 	printSuccess("Write operations completed.")
+
+	// IMSI, service tables and PLMN lists reach the UE after a REFRESH: settle, then verify
+	applied := sim.ChangedFiles(sim.BuildFileChanges(reader.ChangeLog()))
+	verifyConfig := &sim.SIMConfig{}
+	if writeConfig != nil {
+		*verifyConfig = *writeConfig
+	}
+	if writeIMSI != "" {
+		verifyConfig.IMSI = writeIMSI
+	}
+	if writeSPN != "" {
+		verifyConfig.SPN = writeSPN
+	}
+	printWriteChanges(reader, report, settleAndVerify(reader, applied, verifyConfig))
+
+	writeSummarySheet(reader)
+	exportCoreAfterWrite(reader, writeConfig)
+}
+
+// printWriteChanges prints the old and new content of every EF written in this run and
+// the post-write settle step and verification (check, nil if none ran).
+// In JSON mode the changes go into the single output document: the apply report
+// when a config file was applied, otherwise a {"changes": [...]} object.
+func printWriteChanges(reader *card.Reader, report *sim.ApplyReport, check *postWriteCheck) {
+	changes := sim.BuildFileChanges(reader.ChangeLog())
+	if !outputJSON {
+		output.PrintChangeSummary(changes)
+		if check != nil {
+			check.print()
+		}
+		return
+	}
+	if check == nil {
+		check = &postWriteCheck{}
+	}
+	var data []byte
+	if report != nil {
+		report.Changes = changes
+		report.Settle, report.Verify = check.Settle, check.Verify
+		data, _ = json.MarshalIndent(report, "", "  ")
+	} else {
+		data, _ = json.MarshalIndent(struct {
+			Changes []sim.FileChange `json:"changes"`
+			*postWriteCheck
+		}{changes, check}, "", "  ")
+	}
+	printDocument(data)
 }
 
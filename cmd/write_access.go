@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/output"
+	"sim_reader/sim"
+)
+
+var (
+	// plannedWrites are the files the write command is about to update; connectAndPrepareReader
+	// checks their access conditions before any ADM key is verified
+	plannedWrites   []sim.WriteTarget
+	skipAccessCheck bool
+)
+
+// plannedWriteTargets returns the files updated by the config and the write flags. Writes
+// to proprietary files (ADM key change, algorithm, logo) and to the MF (EF_DIR) are not
+// checked.
+func plannedWriteTargets(config *sim.SIMConfig) []sim.WriteTarget {
+	var targets []sim.WriteTarget
+	if config != nil {
+		targets = sim.ConfigWriteTargets(config)
+	}
+	add := func(set bool, t sim.WriteTarget) {
+		if set {
+			targets = append(targets, t)
+		}
+	}
+
+	add(writeIMSI != "", sim.USIMWriteTarget("IMSI", 0x6F07))
+	add(writeSPN != "", sim.USIMWriteTarget("SPN", 0x6F46))
+	add(writePSISMSC != "", sim.USIMWriteTarget("PSI SMSC", 0x6FE5))
+	add(writeSMSC != "", sim.USIMWriteTarget("SMSC", 0x6F42))
+	add(writeVoicemail != "", sim.USIMWriteTarget("Voicemail", 0x6FC7))
+	add(writeNASConfig != "", sim.USIMWriteTarget("NAS config", 0x6FE8))
+	add(len(writeACL) > 0 || aclEnable || aclDisable, sim.USIMWriteTarget("ACL", 0x6F57))
+	add(aclEnable || aclDisable, sim.USIMWriteTarget("ACL service", 0x6F38))
+	add(len(bdnAdd) > 0, sim.USIMWriteTarget("BDN", 0x6F4D))
+	add(writeFromPreferred >= 0, sim.USIMWriteTarget("From preferred", 0x6FF7))
+	add(writeFromPreferred >= 0 || writeSORCMCI != "", sim.USIMWriteTarget("SOR services", 0x6F38))
+	add(writeHPLMN != "", sim.USIMWriteTarget("HPLMN", 0x6F62))
+	add(writeUserPLMN != "", sim.USIMWriteTarget("User PLMN", 0x6F60))
+	add(writeOPLMN != "", sim.USIMWriteTarget("OPLMN", 0x6F61))
+	add(setOpMode != "", sim.USIMWriteTarget("Operation mode", 0x6FAD))
+	add(enableVoLTE || enableVoWiFi || disableVoLTE || disableVoWiFi, sim.USIMWriteTarget("USIM services", 0x6F38))
+	add(clearFPLMN || writeFPLMN != "", sim.USIMWriteTarget("FPLMN", 0x6F7B))
+
+	add(writeIMPI != "" || imsAuto, sim.ISIMWriteTarget("IMPI", 0x6F02))
+	add(writeDomain != "" || imsAuto, sim.ISIMWriteTarget("Domain", 0x6F03))
+	add(len(writeIMPU) > 0 || writeIMPUClear || imsAuto, sim.ISIMWriteTarget("IMPU", 0x6F04))
+	add(writePCSCF != "" || imsAuto && imsPCSCFTpl != "", sim.ISIMWriteTarget("P-CSCF", 0x6F09))
+	add(enableSMSOverIP || enableVoicePref || disableSMSOverIP || disableVoicePref, sim.ISIMWriteTarget("ISIM services", 0x6F07))
+	return targets
+}
+
+// providedCredentials returns the credential levels given on the command line. PIN1 is
+// taken as available: it is verified before the check or disabled on the card.
+func providedCredentials() sim.Credentials {
+	return sim.Credentials{
+		sim.CredentialNone: true,
+		sim.CredentialPIN1: true,
+		sim.CredentialPIN2: pin2 != "",
+		sim.CredentialADM1: admKey != "",
+		sim.CredentialADM2: admKey2 != "",
+		sim.CredentialADM3: admKey3 != "",
+		sim.CredentialADM4: admKey4 != "",
+	}
+}
+
+// checkPlannedWriteAccess compares the UPDATE access conditions of the planned writes with
+// the provided credentials, before any ADM key is verified. A missing credential stops the
+// command with a table of the planned writes; conditions the card does not let us read only
+// produce a warning.
+func checkPlannedWriteAccess(reader *card.Reader) error {
+	if len(plannedWrites) == 0 || skipAccessCheck {
+		return nil
+	}
+
+	sim.DetectApplicationAIDs(reader)
+	report := sim.CheckWriteAccess(reader, plannedWrites, providedCredentials())
+
+	for _, c := range report.Unresolved() {
+		printWarning(fmt.Sprintf("%s: UPDATE access condition not resolved (%s), writing anyway", c.File, c.Note))
+	}
+	err := report.Err()
+	if err == nil {
+		return nil
+	}
+	if !outputJSON {
+		output.PrintWriteAccessReport(report)
+	}
+	return fmt.Errorf("%w%s; nothing was verified or written (--skip-access-check to write anyway)", err, missingCredentialFlags(report))
+}
+
+// missingCredentialFlags names the flags of the credentials the blocking writes need
+func missingCredentialFlags(report *sim.WriteAccessReport) string {
+	provided := providedCredentials()
+	seen := make(map[string]bool)
+	for _, c := range report.Missing() {
+		for _, part := range strings.FieldsFunc(c.Credential, func(r rune) bool { return r == '/' || r == '&' }) {
+			if f, ok := credentialFlags[part]; ok && !provided[part] {
+				seen[f] = true
+			}
+		}
+	}
+	if len(seen) == 0 {
+		return ""
+	}
+	flags := make([]string, 0, len(seen))
+	for f := range seen {
+		flags = append(flags, f)
+	}
+	sort.Strings(flags)
+	return " (use " + strings.Join(flags, ", ") + ")"
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// ============ READ-ONLY TESTS ============
+
+func TestWriteReadOnly_RefusedBeforeConnect(t *testing.T) {
+	t.Setenv(readOnlyEnv, "1")
+	connected := false
+	openReader = func(int, ...card.ConnectOption) (*card.Reader, error) {
+		connected = true
+		mock := newTestCard()
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		readOnly = false
+		writeIMSI, admKey, rollbackFile = "", "", ""
+		resetACM, pin2 = false, ""
+	}()
+
+	for _, args := range [][]string{
+		{"write", "-r", "0", "-a", "11111111", "--imsi", "001010000000002"},
+		{"write", "-r", "0", "--pin2", "1234", "--reset-acm"},
+		{"write", "-r", "0", "--rollback", "snapshot.json"},
+	} {
+		out, _ := runCapture(t, args...)
+		if !strings.Contains(out, "read-only mode") {
+			t.Errorf("%v output = %q, want read-only refusal", args, out)
+		}
+		writeIMSI, admKey, rollbackFile = "", "", ""
+		resetACM = false
+	}
+	if connected {
+		t.Error("reader connected although the write was refused")
+	}
+}
+
+// ============ KEY DERIVATION TESTS ============
+
+func TestWriteKDerivation_RefusedBeforeConnect(t *testing.T) {
+	connected := false
+	openReader = func(int, ...card.ConnectOption) (*card.Reader, error) {
+		connected = true
+		mock := newTestCard()
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		writeConfigFile, admKey = "", ""
+		exportCoreFormat, exportCoreFile = "", ""
+	}()
+
+	path := filepath.Join(t.TempDir(), "batch.json")
+	config := `{"op": "CDC202D5123E20F62B6D676AC72CB318", "k_derivation": {"scheme": "hmac-sha256", "master_key_env": "SIM_READER_TEST_MASTER_K"}}`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exportFile := filepath.Join(t.TempDir(), "subs.csv")
+
+	// Master key missing
+	out, _ := runCapture(t, "write", "-r", "0", "-a", "11111111", "-f", path,
+		"--export-core", "csv", "--export-core-file", exportFile)
+	if !strings.Contains(out, "SIM_READER_TEST_MASTER_K is not set") {
+		t.Errorf("output = %q, want the missing master key", out)
+	}
+
+	// Derived keys without a subscriber export would be lost
+	t.Setenv("SIM_READER_TEST_MASTER_K", "000102030405060708090A0B0C0D0E0F")
+	exportCoreFormat, exportCoreFile = "", ""
+	out, _ = runCapture(t, "write", "-r", "0", "-a", "11111111", "-f", path)
+	if !strings.Contains(out, "k_derivation requires --export-core") {
+		t.Errorf("output = %q, want --export-core required", out)
+	}
+
+	if connected {
+		t.Error("reader connected although k_derivation was refused")
+	}
+}
+
+// ============ IMS AUTO TESTS ============
+
+func TestWriteIMSAuto(t *testing.T) {
+	mock := newTestCard()
+	mock.Keys[card.PIN_ADM1] = []byte("11111111")
+	isim := mock.AddADF([]byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x04, 0xFF, 0x49, 0xFF, 0x05, 0x89})
+	isim.AddEF(0x6F02, make([]byte, 64))
+	isim.AddEF(0x6F03, make([]byte, 64))
+	isim.AddRecordEF(0x6F04, make([]byte, 64))
+	isim.AddRecordEF(0x6F09, make([]byte, 64))
+	openReader = func(int, ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		writeIMSI, admKey = "", ""
+		imsAuto, imsPCSCFTpl, imsTemplateFile = false, "", ""
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	}()
+
+	out, _ := runCapture(t, "write", "-r", "0", "-a", "11111111", "--imsi", "250880000000007",
+		"--ims-auto", "--ims-pcscf-template", "pcscf.{domain}")
+
+	for _, want := range []string{
+		"IMPI written successfully: 250880000000007@ims.mnc088.mcc250.3gppnetwork.org",
+		"IMPU written successfully: sip:250880000000007@ims.mnc088.mcc250.3gppnetwork.org",
+		"Domain written successfully: ims.mnc088.mcc250.3gppnetwork.org",
+		"P-CSCF written successfully: pcscf.ims.mnc088.mcc250.3gppnetwork.org",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	// Reported in the change summary like explicit writes
+	for _, file := range []string{"EF_IMPI", "EF_IMPU", "EF_DOMAIN", "EF_PCSCF"} {
+		if !strings.Contains(out, file) {
+			t.Errorf("change summary does not list %s:\n%s", file, out)
+		}
+	}
+	if !bytes.Contains(isim.Children[0].Data, []byte("250880000000007@ims.mnc088")) {
+		t.Errorf("EF_IMPI = %X", isim.Children[0].Data)
+	}
+}
+
+func TestWriteIMSAuto_Conflicts(t *testing.T) {
+	openReader = func(int, ...card.ConnectOption) (*card.Reader, error) {
+		t.Fatal("reader connected although the flags conflict")
+		return nil, nil
+	}
+	defer func() {
+		openReader = card.Connect
+		writeIMPI, admKey = "", ""
+		imsAuto, imsPCSCFTpl = false, ""
+	}()
+
+	out, _ := runCapture(t, "write", "-r", "0", "-a", "11111111", "--ims-auto", "--impi", "user@ims.example.net")
+	if !strings.Contains(out, "use --ims-template") {
+		t.Errorf("output = %q, want the --impi conflict", out)
+	}
+	writeIMPI, imsAuto = "", false
+	out, _ = runCapture(t, "write", "-r", "0", "-a", "11111111", "--ims-pcscf-template", "pcscf.{domain}")
+	if !strings.Contains(out, "require --ims-auto") {
+		t.Errorf("output = %q, want --ims-auto required", out)
+	}
+}
+
+// ============ WRITE ACCESS CHECK TESTS ============
+
+// newWriteAccessTestCard returns a USIM whose EF_IMSI needs ADM1 and EF_SPN ADM2 (EF_ARR)
+func newWriteAccessTestCard() *card.MockCard {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	usim := m.AddADF(sim.AID_USIM)
+	usim.AddRecordEF(0x6F06,
+		[]byte{0x80, 0x01, 0x01, 0x90, 0x00, 0x80, 0x01, 0x02, 0xA4, 0x06, 0x83, 0x01, 0x0A, 0x95, 0x01, 0x08},
+		[]byte{0x80, 0x01, 0x01, 0x90, 0x00, 0x80, 0x01, 0x02, 0xA4, 0x06, 0x83, 0x01, 0x0B, 0x95, 0x01, 0x08},
+	)
+	usim.AddEF(0x6F07, make([]byte, 9)).ARR = []byte{0x6F, 0x06, 0x01}
+	usim.AddEF(0x6F46, make([]byte, 17)).ARR = []byte{0x6F, 0x06, 0x02}
+	return m
+}
+
+func TestWriteAccessCheck_MissingADM2(t *testing.T) {
+	mock := newWriteAccessTestCard()
+	openReader = func(int, ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		writeIMSI, writeSPN, admKey, admKey2 = "", "", "", ""
+		skipAccessCheck = false
+	}()
+
+	out, _ := runCapture(t, "write", "-r", "0", "-a", "11111111", "--imsi", "001010000000002", "--spn", "Test")
+	for _, want := range []string{"WRITE ACCESS CHECK", "EF_SPN requires ADM2", "(use --adm2)", "nothing was verified or written"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	for _, apdu := range mock.Log {
+		if apdu[1] == 0x20 || apdu[1] == 0xD6 {
+			t.Errorf("command %X sent although a credential is missing", apdu)
+		}
+	}
+}
+
+func TestWriteAccessCheck_Provided(t *testing.T) {
+	mock := newWriteAccessTestCard()
+	openReader = func(int, ...card.ConnectOption) (*card.Reader, error) {
+		return card.NewReaderWithTransport("Mock Reader", mock.ATR, mock), nil
+	}
+	defer func() {
+		openReader = card.Connect
+		writeIMSI, admKey = "", ""
+	}()
+
+	out, _ := runCapture(t, "write", "-r", "0", "-a", "11111111", "--imsi", "001010000000002")
+	if strings.Contains(out, "WRITE ACCESS CHECK") || !strings.Contains(out, "Verifying ADM1") {
+		t.Errorf("output = %q, want the write to go ahead", out)
+	}
+}
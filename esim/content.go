@@ -0,0 +1,142 @@
+package esim
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// File descriptor byte structures (TS 102 221 11.1.1.4.3)
+const (
+	fdbStructureMask = 0x07
+	fdbLinearFixed   = 0x02
+	fdbCyclic        = 0x06
+	fdbBERTLV        = 0x39
+)
+
+const (
+	defaultFillByte   = 0xFF   // content of bytes not set by a pattern or fill content
+	maxExpandFileSize = 0xFFFF // efFileSize is at most two bytes
+)
+
+// ExpandFileContent returns the byte image an EF has after creation on a card.
+//
+// The image starts from the proprietaryEFInfo patterns (TS 102 222 / SAIP):
+// fillPattern is written once and the rest is 'FF', repeatPattern is tiled to the
+// end. For linear fixed and cyclic EFs the pattern applies to every record. Without
+// a pattern every byte is 'FF'. The fillFileOffset / fillFileContent elements are
+// then applied in order: an offset skips bytes from the current position, content
+// is written at the current position.
+//
+// fileSize overrides efFileSize from the descriptor; pass 0 to use the descriptor.
+// For record EFs the image is the concatenation of all records.
+func ExpandFileContent(ef *ElementaryFile, fileSize int) ([]byte, error) {
+	if ef == nil {
+		return nil, fmt.Errorf("no elementary file")
+	}
+	fd := ef.Descriptor
+	if fd == nil {
+		fd = &FileDescriptor{}
+	}
+	if len(fd.FileDescriptor) > 0 && fd.FileDescriptor[0] == fdbBERTLV {
+		return nil, fmt.Errorf("BER-TLV EF has no byte image")
+	}
+
+	if fileSize <= 0 {
+		fileSize = descriptorFileSize(fd)
+	}
+	if fileSize <= 0 {
+		return nil, fmt.Errorf("file size unknown (no efFileSize in descriptor)")
+	}
+	if fileSize > maxExpandFileSize {
+		return nil, fmt.Errorf("file size %d exceeds %d", fileSize, maxExpandFileSize)
+	}
+
+	// The pattern unit is the whole file for transparent EFs, one record otherwise
+	unit := fileSize
+	if recLen := descriptorRecordLength(fd); recLen > 0 {
+		if fileSize%recLen != 0 {
+			return nil, fmt.Errorf("file size %d is not a multiple of record length %d", fileSize, recLen)
+		}
+		unit = recLen
+	}
+
+	var fill, repeat []byte
+	if pei := fd.ProprietaryEFInfo; pei != nil {
+		fill, repeat = pei.FillPattern, pei.RepeatPattern
+	}
+	if len(fill) > 0 && len(repeat) > 0 {
+		return nil, fmt.Errorf("both fillPattern and repeatPattern are set")
+	}
+
+	image := make([]byte, 0, fileSize)
+	for len(image) < fileSize {
+		image = append(image, expandPattern(fill, repeat, unit)...)
+	}
+
+	pos := 0
+	for _, elem := range fileContentElements(ef) {
+		switch elem.Type {
+		case FileElementOffset:
+			pos += elem.Offset
+		case FileElementContent:
+			if pos+len(elem.Content) > fileSize {
+				return nil, fmt.Errorf("content at offset %d (%d bytes) exceeds file size %d",
+					pos, len(elem.Content), fileSize)
+			}
+			copy(image[pos:], elem.Content)
+			pos += len(elem.Content)
+		}
+	}
+	return image, nil
+}
+
+// expandPattern returns size bytes of fill (once, then 'FF') or repeat (tiled) or 'FF'
+func expandPattern(fill, repeat []byte, size int) []byte {
+	out := bytes.Repeat([]byte{defaultFillByte}, size)
+	switch {
+	case len(repeat) > 0:
+		for i := 0; i < size; i += len(repeat) {
+			copy(out[i:], repeat)
+		}
+	case len(fill) > 0:
+		copy(out, fill)
+	}
+	return out
+}
+
+// fileContentElements returns the offset/content elements of ef in profile order.
+// The simplified FillContents carry the offset written before each content.
+func fileContentElements(ef *ElementaryFile) File {
+	if len(ef.Raw) > 0 {
+		return ef.Raw
+	}
+	var elems File
+	for _, fc := range ef.FillContents {
+		if fc.Offset > 0 {
+			elems = append(elems, FileElement{Type: FileElementOffset, Offset: fc.Offset})
+		}
+		elems = append(elems, FileElement{Type: FileElementContent, Content: fc.Content})
+	}
+	return elems
+}
+
+// descriptorFileSize returns efFileSize as an integer (0 if absent)
+func descriptorFileSize(fd *FileDescriptor) int {
+	size := 0
+	for _, b := range fd.EFFileSize {
+		size = size<<8 | int(b)
+	}
+	return size
+}
+
+// descriptorRecordLength returns the record length of a linear fixed or cyclic EF (0 otherwise)
+func descriptorRecordLength(fd *FileDescriptor) int {
+	if len(fd.FileDescriptor) < 4 {
+		return 0
+	}
+	switch fd.FileDescriptor[0] & fdbStructureMask {
+	case fdbLinearFixed, fdbCyclic:
+		return int(fd.FileDescriptor[2])<<8 | int(fd.FileDescriptor[3])
+	}
+	return 0
+}
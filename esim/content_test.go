@@ -0,0 +1,193 @@
+package esim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// ============ FILE CONTENT EXPANSION TESTS ============
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+func ff(n int) []byte {
+	return bytes.Repeat([]byte{0xFF}, n)
+}
+
+func TestExpandFileContent_ReferenceProfile(t *testing.T) {
+	profile, err := ParseValueNotation(ReferenceASN1Text)
+	if err != nil {
+		t.Fatalf("ParseValueNotation: %v", err)
+	}
+
+	t.Run("ef-pl fillPattern then FF", func(t *testing.T) {
+		got, err := ExpandFileContent(profile.MF.EF_PL, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := mustHex(t, "656EFFFFFFFF"); !bytes.Equal(got, want) {
+			t.Errorf("EF_PL = %X, want %X", got, want)
+		}
+	})
+
+	t.Run("ef-pbr long fillPattern in one record", func(t *testing.T) {
+		pattern := profile.Telecom.EF_PBR.Descriptor.ProprietaryEFInfo.FillPattern
+		got, err := ExpandFileContent(profile.Telecom.EF_PBR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 100 {
+			t.Fatalf("EF_PBR length = %d, want 100", len(got))
+		}
+		if !bytes.HasPrefix(got, pattern) || !bytes.Equal(got[len(pattern):], ff(100-len(pattern))) {
+			t.Errorf("EF_PBR = %X, want pattern followed by FF", got)
+		}
+	})
+
+	t.Run("ef-ici fillPattern per cyclic record", func(t *testing.T) {
+		ef := profile.OptUSIM.EF_ICI
+		pattern := ef.Descriptor.ProprietaryEFInfo.FillPattern
+		got, err := ExpandFileContent(ef, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0xD2 {
+			t.Fatalf("EF_ICI length = %d, want 210", len(got))
+		}
+		record := append(append([]byte(nil), pattern...), ff(0x2A-len(pattern))...)
+		for i := 0; i < 5; i++ {
+			if rec := got[i*0x2A : (i+1)*0x2A]; !bytes.Equal(rec, record) {
+				t.Errorf("EF_ICI record %d = %X, want %X", i+1, rec, record)
+			}
+		}
+	})
+
+	t.Run("ef-dir fillFileOffset skips to next record", func(t *testing.T) {
+		got, err := ExpandFileContent(profile.MF.EF_DIR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0x84 {
+			t.Fatalf("EF_DIR length = %d, want 132", len(got))
+		}
+		want := []string{"4F0CA0000000871002", "4F0CA0000000871004", "4F10A0000003431002"}
+		for i, aid := range want {
+			rec := got[i*0x21 : (i+1)*0x21]
+			if !bytes.Contains(rec, mustHex(t, aid)) || rec[0] != 0x61 {
+				t.Errorf("EF_DIR record %d = %X, want application %s", i+1, rec, aid)
+			}
+		}
+		if !bytes.Equal(got[3*0x21:], ff(0x21)) {
+			t.Errorf("EF_DIR record 4 = %X, want empty", got[3*0x21:])
+		}
+	})
+
+	t.Run("ef-imsi content without size needs fileSize", func(t *testing.T) {
+		if _, err := ExpandFileContent(profile.USIM.EF_IMSI, 0); err == nil {
+			t.Error("expected error without efFileSize")
+		}
+		got, err := ExpandFileContent(profile.USIM.EF_IMSI, 9)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := mustHex(t, "080910101032547698"); !bytes.Equal(got, want) {
+			t.Errorf("EF_IMSI = %X, want %X", got, want)
+		}
+	})
+}
+
+func TestExpandFileContent_DERMatchesText(t *testing.T) {
+	text, err := ParseValueNotation(ReferenceASN1Text)
+	if err != nil {
+		t.Fatalf("ParseValueNotation: %v", err)
+	}
+	der, err := EncodeProfile(text)
+	if err != nil {
+		t.Fatalf("EncodeProfile: %v", err)
+	}
+	decoded, err := DecodeProfile(der)
+	if err != nil {
+		t.Fatalf("DecodeProfile: %v", err)
+	}
+
+	for name, pair := range map[string][2]*ElementaryFile{
+		"EF_DIR": {text.MF.EF_DIR, decoded.MF.EF_DIR},
+		"EF_ARR": {text.MF.EF_ARR, decoded.MF.EF_ARR},
+		"EF_PBR": {text.Telecom.EF_PBR, decoded.Telecom.EF_PBR},
+	} {
+		a, errA := ExpandFileContent(pair[0], 0)
+		b, errB := ExpandFileContent(pair[1], 0)
+		if errA != nil || errB != nil {
+			t.Fatalf("%s: %v / %v", name, errA, errB)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s: text image %X != DER image %X", name, a, b)
+		}
+	}
+}
+
+func TestExpandFileContent_Patterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		fdb     []byte
+		size    int
+		pei     *ProprietaryEFInfo
+		content []FillContent
+		want    string
+	}{
+		{"default FF", []byte{0x41, 0x21}, 4, nil, nil, "FFFFFFFF"},
+		{"repeatPattern tiles", []byte{0x41, 0x21}, 5, &ProprietaryEFInfo{RepeatPattern: []byte{0x01, 0x02}}, nil, "0102010201"},
+		{"repeatPattern per record", []byte{0x42, 0x21, 0x00, 0x03}, 6, &ProprietaryEFInfo{RepeatPattern: []byte{0x00, 0xAA}}, nil, "00AA0000AA00"},
+		{"fillPattern longer than file", []byte{0x41, 0x21}, 2, &ProprietaryEFInfo{FillPattern: []byte{1, 2, 3}}, nil, "0102"},
+		{"content over pattern", []byte{0x41, 0x21}, 6, &ProprietaryEFInfo{RepeatPattern: []byte{0x00}},
+			[]FillContent{{Content: []byte{0x11}}, {Offset: 2, Content: []byte{0x22, 0x33}}}, "110000223300"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ef := &ElementaryFile{
+				Descriptor:   &FileDescriptor{FileDescriptor: tt.fdb, ProprietaryEFInfo: tt.pei},
+				FillContents: tt.content,
+			}
+			got, err := ExpandFileContent(ef, tt.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := mustHex(t, tt.want); !bytes.Equal(got, want) {
+				t.Errorf("image = %X, want %X", got, want)
+			}
+		})
+	}
+}
+
+func TestExpandFileContent_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		ef   *ElementaryFile
+		size int
+		want string
+	}{
+		{"nil", nil, 4, "no elementary file"},
+		{"no size", &ElementaryFile{}, 0, "file size unknown"},
+		{"BER-TLV", &ElementaryFile{Descriptor: &FileDescriptor{FileDescriptor: []byte{0x39, 0x21}}}, 4, "BER-TLV"},
+		{"record size", &ElementaryFile{Descriptor: &FileDescriptor{FileDescriptor: []byte{0x42, 0x21, 0x00, 0x05}}}, 7, "record length"},
+		{"both patterns", &ElementaryFile{Descriptor: &FileDescriptor{ProprietaryEFInfo: &ProprietaryEFInfo{
+			FillPattern: []byte{0}, RepeatPattern: []byte{0}}}}, 4, "both"},
+		{"content overflow", &ElementaryFile{FillContents: []FillContent{{Offset: 3, Content: []byte{1, 2}}}}, 4, "exceeds file size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExpandFileContent(tt.ef, tt.size)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
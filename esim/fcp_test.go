@@ -0,0 +1,69 @@
+package esim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/esim/asn1"
+)
+
+// TestReferenceProfileFCPs parses the createFCP templates of the reference profile's generic
+// file management elements with card.ParseFCP: the SAIP Fcp uses the data objects of the FCP
+// template, so a card personalised from the profile returns the same values on SELECT.
+func TestReferenceProfileFCPs(t *testing.T) {
+	refBytes, err := hex.DecodeString(ReferenceBinaryDERHex)
+	if err != nil {
+		t.Fatalf("Failed to decode reference hex: %v", err)
+	}
+	profile, err := DecodeProfile(refBytes)
+	if err != nil {
+		t.Fatalf("Failed to decode profile from binary: %v", err)
+	}
+
+	var descriptors []*FileDescriptor
+	for _, gfm := range profile.GFM {
+		for _, cmd := range gfm.FileManagementCMDs {
+			for _, item := range cmd {
+				if item.CreateFCP != nil {
+					descriptors = append(descriptors, item.CreateFCP)
+				}
+			}
+		}
+	}
+	if len(descriptors) == 0 {
+		t.Fatal("no createFCP in the reference profile")
+	}
+
+	for _, fd := range descriptors {
+		t.Run(fmt.Sprintf("%X", fd.FileID), func(t *testing.T) {
+			f, err := card.ParseFCP(asn1.Marshal(0x62, nil, encodeFileDescriptor(fd)...))
+			if err != nil {
+				t.Fatalf("ParseFCP() error = %v", err)
+			}
+			if !bytes.Equal(f.Descriptor, fd.FileDescriptor) {
+				t.Errorf("Descriptor = %X, want %X", f.Descriptor, fd.FileDescriptor)
+			}
+			if fd.FileID != nil && (!f.HasFileID || f.FileID != uint16(fd.FileID[0])<<8|uint16(fd.FileID[1])) {
+				t.Errorf("FileID = %04X, want %X", f.FileID, fd.FileID)
+			}
+			if !bytes.Equal(f.DFName, fd.DFName) {
+				t.Errorf("DFName = %X, want %X", f.DFName, fd.DFName)
+			}
+			if !bytes.Equal(f.SecurityReferenced, fd.SecurityAttributesReferenced) {
+				t.Errorf("SecurityReferenced = %X, want %X", f.SecurityReferenced, fd.SecurityAttributesReferenced)
+			}
+			if fd.EFFileSize != nil && f.FileSize != decodeInteger(fd.EFFileSize) {
+				t.Errorf("FileSize = %d, want %X", f.FileSize, fd.EFFileSize)
+			}
+			if f.HasSFI != (fd.ShortEFID != nil) || !bytes.Equal(f.SFI, fd.ShortEFID) {
+				t.Errorf("SFI = %X (%v), want %X", f.SFI, f.HasSFI, fd.ShortEFID)
+			}
+			if f.IsDF() && fd.EFFileSize != nil {
+				t.Errorf("IsDF() for an EF with size %X", fd.EFFileSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package esim
+
+import (
+	"strings"
+)
+
+// Layout of the text written by the generator before formatValueNotation applies the
+// GeneratorOptions
+const (
+	generatorIndent     = "  "
+	generatorLineEnding = "\r\n"
+)
+
+// formatValueNotation rewrites generator output with the layout of opts: indentation,
+// line endings, case and wrapping of hex literals. Quoted strings are left untouched.
+func formatValueNotation(text string, opts GeneratorOptions) string {
+	indent, lineEnding := opts.Indent, opts.LineEnding
+	if indent == "" {
+		indent = generatorIndent
+	}
+	if lineEnding == "" {
+		lineEnding = generatorLineEnding
+	}
+	if indent == generatorIndent && lineEnding == generatorLineEnding && !opts.LowerHex && opts.HexWrap <= 0 {
+		return text
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(text))
+	lines := strings.Split(text, generatorLineEnding)
+	for i, line := range lines {
+		if i > 0 {
+			sb.WriteString(lineEnding)
+		}
+		level := 0
+		for strings.HasPrefix(line, generatorIndent) {
+			line = line[len(generatorIndent):]
+			level++
+		}
+		sb.WriteString(strings.Repeat(indent, level))
+		writeFormattedLine(&sb, line, strings.Repeat(indent, level+1), lineEnding, opts)
+	}
+	return sb.String()
+}
+
+// writeFormattedLine writes a line without its indentation, applying hex case and
+// wrapping to the hex literals outside quoted strings. Continuation lines of a wrapped
+// literal start with contIndent.
+func writeFormattedLine(sb *strings.Builder, line, contIndent, lineEnding string, opts GeneratorOptions) {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == '"':
+			inString = !inString
+		case ch == '\'' && !inString:
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 || i+end+2 >= len(line) || line[i+end+2] != 'H' {
+				break
+			}
+			digits := line[i+1 : i+1+end]
+			if opts.LowerHex {
+				digits = strings.ToLower(digits)
+			}
+			sb.WriteByte('\'')
+			for len(digits) > opts.HexWrap && opts.HexWrap > 0 {
+				sb.WriteString(digits[:opts.HexWrap])
+				sb.WriteString(lineEnding)
+				sb.WriteString(contIndent)
+				digits = digits[opts.HexWrap:]
+			}
+			sb.WriteString(digits)
+			sb.WriteString("'H")
+			i += end + 2
+			continue
+		}
+		sb.WriteByte(ch)
+	}
+}
+
+// DetectGeneratorOptions returns the layout of a Value Notation text: line ending,
+// indentation unit, hex case and the wrap width of hex literals spanning lines.
+// Regenerating a parsed profile with these options reproduces text written by the vendor
+// tool (or by this generator) byte for byte.
+func DetectGeneratorOptions(text string) GeneratorOptions {
+	opts := GeneratorOptions{Indent: generatorIndent, LineEnding: "\n"}
+	if strings.Contains(text, "\r\n") {
+		opts.LineEnding = "\r\n"
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != line && strings.TrimSpace(trimmed) != "" {
+			opts.Indent = line[:len(line)-len(trimmed)]
+			break
+		}
+	}
+
+	upper, lower := false, false
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '"':
+			if end := strings.IndexByte(text[i+1:], '"'); end >= 0 {
+				i += end + 1
+			}
+		case strings.HasPrefix(text[i:], "--"):
+			if end := strings.IndexByte(text[i:], '\n'); end >= 0 {
+				i += end
+			}
+		case text[i] == '\'':
+			end := strings.IndexByte(text[i+1:], '\'')
+			if end < 0 {
+				return opts
+			}
+			literal := text[i+1 : i+1+end]
+			if first, _, wrapped := strings.Cut(literal, "\n"); wrapped {
+				if n := len(strings.TrimRight(first, " \t\r")); n > opts.HexWrap {
+					opts.HexWrap = n
+				}
+			}
+			upper = upper || strings.ContainsAny(literal, "ABCDEF")
+			lower = lower || strings.ContainsAny(literal, "abcdef")
+			i += end + 1
+		}
+	}
+	opts.LowerHex = lower && !upper
+	return opts
+}
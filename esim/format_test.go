@@ -0,0 +1,97 @@
+package esim
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ============ GENERATOR FORMATTING TESTS ============
+
+// firstDifference describes where two texts start to differ, for failure messages
+func firstDifference(got, want string) string {
+	n := 0
+	for n < len(got) && n < len(want) && got[n] == want[n] {
+		n++
+	}
+	context := func(s string) string {
+		return s[n:min(n+20, len(s))]
+	}
+	return fmt.Sprintf("line %d: got %q, want %q", strings.Count(want[:n], "\n")+1, context(got), context(want))
+}
+
+func TestGenerateCanonical_ReferenceText(t *testing.T) {
+	profile, err := ParseValueNotation(ReferenceASN1Text)
+	if err != nil {
+		t.Fatalf("ParseValueNotation() error = %v", err)
+	}
+	got := GenerateValueNotationWithOptions(profile, CanonicalGeneratorOptions())
+	if got != ReferenceASN1Text {
+		t.Errorf("canonical output differs from the reference text at %s", firstDifference(got, ReferenceASN1Text))
+	}
+	if opts := DetectGeneratorOptions(ReferenceASN1Text); opts != CanonicalGeneratorOptions() {
+		t.Errorf("DetectGeneratorOptions(reference) = %+v, want the canonical options", opts)
+	}
+}
+
+func TestGenerateDetected_VendorFile(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "TS48 V7.0 eSIM_GTP_SAIP2.3_BERTLV_SUCI.txt"))
+	if err != nil {
+		t.Skip("vendor text profile not found in testdata")
+	}
+	text := string(data)
+	profile, err := ParseValueNotation(text)
+	if err != nil {
+		t.Fatalf("ParseValueNotation() error = %v", err)
+	}
+	opts := DetectGeneratorOptions(text)
+	if opts.LineEnding != "\r\n" || opts.Indent != "  " || opts.LowerHex || opts.HexWrap != 0 {
+		t.Errorf("DetectGeneratorOptions(vendor file) = %+v", opts)
+	}
+	if got := GenerateValueNotationWithOptions(profile, opts); got != text {
+		t.Errorf("regenerated vendor file differs at %s", firstDifference(got, text))
+	}
+}
+
+func TestGenerateOptions_WrapAndCase(t *testing.T) {
+	profile, err := ParseValueNotation(ReferenceASN1Text)
+	if err != nil {
+		t.Fatalf("ParseValueNotation() error = %v", err)
+	}
+	opts := GeneratorOptions{Indent: "\t", LineEnding: "\n", LowerHex: true, HexWrap: 64}
+	text := GenerateValueNotationWithOptions(profile, opts)
+
+	for _, line := range strings.Split(text, "\n") {
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return !strings.ContainsRune("0123456789abcdef", r) }) {
+			if len(field) > 64 {
+				t.Fatalf("more than 64 hex digits on a line: %q", line)
+			}
+		}
+		if strings.HasPrefix(line, " ") {
+			t.Fatalf("line indented with spaces: %q", line)
+		}
+	}
+	if strings.Contains(text, "'2F0601'H") || !strings.Contains(text, "'2f0601'H") {
+		t.Error("hex literals not written in lower case")
+	}
+	if got := DetectGeneratorOptions(text); got != opts {
+		t.Errorf("DetectGeneratorOptions(wrapped) = %+v, want %+v", got, opts)
+	}
+
+	// The wrapped text is the same profile
+	reparsed, err := ParseValueNotation(text)
+	if err != nil {
+		t.Fatalf("ParseValueNotation(wrapped) error = %v", err)
+	}
+	want, _ := EncodeProfile(profile)
+	got, err := EncodeProfile(reparsed)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("wrapped text encodes differently (error %v)", err)
+	}
+	if again := GenerateValueNotationWithOptions(reparsed, opts); again != text {
+		t.Errorf("wrapped text is not stable at %s", firstDifference(again, text))
+	}
+}
@@ -8,14 +8,47 @@ import (
 	"strings"
 )
 
+// GeneratorOptions controls ASN.1 Value Notation generation. The zero value writes the
+// layout of the vendor tool: CRLF line endings, two spaces per level, upper case hex and
+// hex literals on one line.
+type GeneratorOptions struct {
+	// Renumber rewrites element header identifications sequentially before generating
+	// (see Profile.Renumber); the profile is modified in place
+	Renumber bool
+
+	// Indent is written once per nesting level (default two spaces)
+	Indent string
+	// LineEnding ends every line (default "\r\n")
+	LineEnding string
+	// LowerHex writes the digits of hex literals in lower case
+	LowerHex bool
+	// HexWrap is the maximum number of hex digits per line. A longer literal continues on
+	// the following lines, indented one level deeper than the line it starts on (0: no wrap).
+	HexWrap int
+}
+
+// CanonicalGeneratorOptions is the layout of the reference profile text in the tests:
+// the vendor layout with LF line endings
+func CanonicalGeneratorOptions() GeneratorOptions {
+	return GeneratorOptions{Indent: "  ", LineEnding: "\n"}
+}
+
 // GenerateValueNotation generates ASN.1 Value Notation text from Profile
 func GenerateValueNotation(p *Profile) string {
+	return GenerateValueNotationWithOptions(p, GeneratorOptions{})
+}
+
+// GenerateValueNotationWithOptions generates ASN.1 Value Notation text from Profile
+func GenerateValueNotationWithOptions(p *Profile, opts GeneratorOptions) string {
+	if opts.Renumber {
+		p.Renumber()
+	}
 	g := &Generator{
 		sb:     &strings.Builder{},
 		indent: 0,
 	}
 	g.generateProfile(p)
-	return g.sb.String()
+	return formatValueNotation(g.sb.String(), opts)
 }
 
 // GenerateValueNotationFile generates ASN.1 Value Notation and writes to file
@@ -0,0 +1,172 @@
+package esim
+
+import (
+	"fmt"
+)
+
+// elementHeader returns the ElementHeader of a profile element (nil for the ProfileHeader
+// and for raw/unknown elements)
+func elementHeader(elem *ProfileElement) *ElementHeader {
+	switch v := elem.Value.(type) {
+	case *MasterFile:
+		return v.MFHeader
+	case *PUKCodes:
+		return v.Header
+	case *PINCodes:
+		return v.Header
+	case *TelecomDF:
+		return v.Header
+	case *USIMApplication:
+		return v.Header
+	case *OptionalUSIM:
+		return v.Header
+	case *ISIMApplication:
+		return v.Header
+	case *OptionalISIM:
+		return v.Header
+	case *CSIMApplication:
+		return v.Header
+	case *OptionalCSIM:
+		return v.Header
+	case *GSMAccessDF:
+		return v.Header
+	case *DF5GS:
+		return v.Header
+	case *DFSAIP:
+		return v.Header
+	case *AKAParameter:
+		return v.Header
+	case *CDMAParameter:
+		return v.Header
+	case *GenericFileManagement:
+		return v.Header
+	case *SecurityDomain:
+		return v.Header
+	case *RFMConfig:
+		return v.Header
+	case *Application:
+		return v.Header
+	case *EndElement:
+		return v.Header
+	}
+	return nil
+}
+
+// elementTemplateID returns the templateID of a profile element (nil if it has none)
+func elementTemplateID(elem *ProfileElement) OID {
+	switch v := elem.Value.(type) {
+	case *MasterFile:
+		return v.TemplateID
+	case *TelecomDF:
+		return v.TemplateID
+	case *USIMApplication:
+		return v.TemplateID
+	case *OptionalUSIM:
+		return v.TemplateID
+	case *ISIMApplication:
+		return v.TemplateID
+	case *OptionalISIM:
+		return v.TemplateID
+	case *CSIMApplication:
+		return v.TemplateID
+	case *OptionalCSIM:
+		return v.TemplateID
+	case *GSMAccessDF:
+		return v.TemplateID
+	case *DF5GS:
+		return v.TemplateID
+	case *DFSAIP:
+		return v.TemplateID
+	}
+	return nil
+}
+
+// Renumber rewrites the identification of every element header sequentially (1, 2, ...)
+// in element order. Elements whose number changes are re-encoded on the next EncodeProfile;
+// unchanged elements keep their original encoding.
+func (p *Profile) Renumber() {
+	id := 1
+	for i := range p.Elements {
+		eh := elementHeader(&p.Elements[i])
+		if eh == nil {
+			continue
+		}
+		if eh.Identification != id {
+			eh.Identification = id
+			p.Elements[i].RawBytes = nil
+			if app, ok := p.Elements[i].Value.(*Application); ok {
+				app.RawBytes = nil
+			}
+		}
+		id++
+	}
+}
+
+// Insert inserts elem after the element at index after (0 = right after the ProfileHeader).
+// The ProfileHeader stays first and the End element stays last, so after must point at an
+// element before End. The returned warnings list consistency problems that do not prevent
+// the insertion, e.g. a templateID missing from eUICC-Mandatory-GFSTEList.
+// Identification numbers are not changed; call Renumber afterwards.
+func (p *Profile) Insert(after int, elem ProfileElement) ([]string, error) {
+	switch elem.Tag {
+	case TagProfileHeader:
+		return nil, fmt.Errorf("cannot insert a second ProfileHeader")
+	case TagEnd:
+		return nil, fmt.Errorf("cannot insert a second End element")
+	}
+	if elem.Value == nil && len(elem.RawBytes) == 0 {
+		return nil, fmt.Errorf("element [%d] has no value", elem.Tag)
+	}
+
+	last := len(p.Elements) - 1
+	if last >= 0 && p.Elements[last].Tag != TagEnd {
+		last = len(p.Elements)
+	}
+	if after < 0 {
+		return nil, fmt.Errorf("cannot insert before the ProfileHeader (after=%d)", after)
+	}
+	if after >= last {
+		return nil, fmt.Errorf("cannot insert after the End element (after=%d, %d elements)", after, len(p.Elements))
+	}
+
+	var warnings []string
+	if tid := elementTemplateID(&elem); len(tid) > 0 && p.Header != nil && !containsOID(p.Header.MandatoryGFSTEList, tid) {
+		warnings = append(warnings, fmt.Sprintf("templateID %s of inserted %s is not listed in eUICC-Mandatory-GFSTEList",
+			(&Generator{}).generateOID(tid), getChoiceFromTag(elem.Tag)))
+	}
+
+	p.Elements = append(p.Elements, ProfileElement{})
+	copy(p.Elements[after+2:], p.Elements[after+1:])
+	p.Elements[after+1] = elem
+	p.reindex()
+	return warnings, nil
+}
+
+// reindex rebuilds the convenience references from Elements
+func (p *Profile) reindex() {
+	elements := p.Elements
+	*p = Profile{Elements: elements}
+	for i := range p.Elements {
+		assignToProfile(p, &p.Elements[i])
+	}
+}
+
+// containsOID reports whether list contains oid
+func containsOID(list []OID, oid OID) bool {
+	for _, o := range list {
+		if len(o) != len(oid) {
+			continue
+		}
+		equal := true
+		for i := range o {
+			if o[i] != oid[i] {
+				equal = false
+				break
+			}
+		}
+		if equal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package esim
+
+import (
+	"strings"
+	"testing"
+)
+
+// ============ ELEMENT ORDERING TESTS ============
+
+func identifications(p *Profile) []int {
+	var ids []int
+	for i := range p.Elements {
+		if eh := elementHeader(&p.Elements[i]); eh != nil {
+			ids = append(ids, eh.Identification)
+		}
+	}
+	return ids
+}
+
+func newTestGFM() ProfileElement {
+	return ProfileElement{
+		Tag: TagGenericFileManagement,
+		Value: &GenericFileManagement{
+			Header: &ElementHeader{Identification: 2},
+			FileManagementCMDs: []FileManagementCMD{{
+				{ItemType: 0, FilePath: []byte{0x7F, 0xF1}},
+				{ItemType: 2, FillFileContent: []byte{0x01, 0x02}},
+			}},
+		},
+	}
+}
+
+func TestProfile_Renumber(t *testing.T) {
+	p, err := ParseValueNotation(ReferenceASN1Text)
+	if err != nil {
+		t.Fatalf("ParseValueNotation() error = %v", err)
+	}
+	p.Renumber()
+
+	for i, id := range identifications(p) {
+		if id != i+1 {
+			t.Fatalf("identification[%d] = %d, want %d (all: %v)", i, id, i+1, identifications(p))
+		}
+	}
+
+	// Renumbered identifications survive DER encoding
+	der, err := EncodeProfile(p)
+	if err != nil {
+		t.Fatalf("EncodeProfile() error = %v", err)
+	}
+	decoded, err := DecodeProfile(der)
+	if err != nil {
+		t.Fatalf("DecodeProfile() error = %v", err)
+	}
+	got, want := identifications(decoded), identifications(p)
+	if len(got) != len(want) {
+		t.Fatalf("decoded %d headers, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("decoded identification[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestProfile_Insert(t *testing.T) {
+	p, err := ParseValueNotation(ReferenceASN1Text)
+	if err != nil {
+		t.Fatalf("ParseValueNotation() error = %v", err)
+	}
+	n, gfms := len(p.Elements), len(p.GFM)
+
+	warnings, err := p.Insert(3, newTestGFM())
+	if err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("Insert() warnings = %v, want none for genericFileManagement", warnings)
+	}
+	if len(p.Elements) != n+1 || p.Elements[4].Tag != TagGenericFileManagement {
+		t.Fatalf("element not inserted at index 4")
+	}
+	if p.Elements[0].Tag != TagProfileHeader || p.Elements[len(p.Elements)-1].Tag != TagEnd {
+		t.Errorf("header/end invariant broken")
+	}
+	if len(p.GFM) != gfms+1 || p.Header == nil || p.End == nil {
+		t.Errorf("convenience references not rebuilt: %d GFM, want %d", len(p.GFM), gfms+1)
+	}
+
+	// Generated text gets unique identifications only with Renumber
+	seen := map[int]bool{}
+	for _, id := range identifications(p) {
+		seen[id] = true
+	}
+	if len(seen) == len(identifications(p)) {
+		t.Fatalf("expected a duplicate identification before renumbering")
+	}
+	text := GenerateValueNotationWithOptions(p, GeneratorOptions{Renumber: true})
+	if !strings.Contains(text, "identification 1\r\n") {
+		t.Errorf("generated text does not start numbering at 1")
+	}
+	seen = map[int]bool{}
+	for _, id := range identifications(p) {
+		if seen[id] {
+			t.Errorf("duplicate identification %d after renumbering", id)
+		}
+		seen[id] = true
+	}
+
+	reparsed, err := ParseValueNotation(text)
+	if err != nil {
+		t.Fatalf("generated text does not parse: %v", err)
+	}
+	if len(reparsed.Elements) != n+1 {
+		t.Errorf("reparsed %d elements, want %d", len(reparsed.Elements), n+1)
+	}
+}
+
+func TestProfile_InsertErrors(t *testing.T) {
+	p, err := ParseValueNotation(ReferenceASN1Text)
+	if err != nil {
+		t.Fatalf("ParseValueNotation() error = %v", err)
+	}
+	last := len(p.Elements) - 1
+
+	tests := []struct {
+		name  string
+		after int
+		elem  ProfileElement
+	}{
+		{"Before header", -1, newTestGFM()},
+		{"After end", last, newTestGFM()},
+		{"Second header", 1, ProfileElement{Tag: TagProfileHeader, Value: &ProfileHeader{}}},
+		{"Second end", 1, ProfileElement{Tag: TagEnd, Value: &EndElement{}}},
+		{"Empty element", 1, ProfileElement{Tag: TagGenericFileManagement}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := p.Insert(tc.after, tc.elem); err == nil {
+				t.Errorf("Insert(%d) should fail", tc.after)
+			}
+			if len(p.Elements) != last+1 {
+				t.Errorf("profile modified on error")
+			}
+		})
+	}
+}
+
+func TestProfile_InsertTemplateWarning(t *testing.T) {
+	tests := []struct {
+		name     string
+		template OID
+		warn     bool
+	}{
+		{"Listed template", OID{2, 23, 143, 1, 2, 13}, false},
+		{"Unlisted template", OID{2, 23, 143, 1, 2, 99}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := ParseValueNotation(ReferenceASN1Text)
+			if err != nil {
+				t.Fatalf("ParseValueNotation() error = %v", err)
+			}
+			elem := ProfileElement{Tag: TagDF5GS, Value: &DF5GS{Header: &ElementHeader{Identification: 50}, TemplateID: tc.template}}
+			warnings, err := p.Insert(1, elem)
+			if err != nil {
+				t.Fatalf("Insert() error = %v", err)
+			}
+			if (len(warnings) > 0) != tc.warn {
+				t.Errorf("warnings = %v, want warning = %v", warnings, tc.warn)
+			}
+		})
+	}
+}
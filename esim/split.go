@@ -0,0 +1,230 @@
+package esim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SplitManifestName is the manifest written by SplitProfile and read by AssembleProfile
+const SplitManifestName = "manifest.json"
+
+// SplitManifest describes the element files of a split profile in profile order
+type SplitManifest struct {
+	Elements []SplitElement `json:"elements"`
+}
+
+// SplitElement is one profile element file
+type SplitElement struct {
+	File    string `json:"file"`          // File name in the split directory (e.g. 08_usim.asn1)
+	Value   int    `json:"value"`         // N of "valueN ProfileElement ::=" in the file
+	Element string `json:"element"`       // Choice name (header, usim, ...)
+	Tag     int    `json:"tag"`           // ProfileElement CHOICE tag
+	SHA256  string `json:"sha256"`        // Hash of the file as written; unchanged files reuse DER
+	DER     string `json:"der"`           // Element encoding at split time (hex)
+	Raw     bool   `json:"raw,omitempty"` // No value notation support: the element is taken from DER only
+}
+
+// valueNotationTags lists the elements the generator and parser support
+var valueNotationTags = map[int]bool{
+	TagProfileHeader: true, TagMF: true, TagPukCodes: true, TagPinCodes: true, TagTelecom: true,
+	TagUSIM: true, TagOptUSIM: true, TagISIM: true, TagOptISIM: true, TagCSIM: true, TagOptCSIM: true,
+	TagGSMAccess: true, TagAKAParameter: true, TagCDMAParameter: true, TagDF5GS: true, TagDFSAIP: true,
+	TagGenericFileManagement: true, TagSecurityDomain: true, TagRFM: true, TagApplication: true, TagEnd: true,
+}
+
+// fileSystemTags are elements that create files and therefore need the MF first
+var fileSystemTags = map[int]bool{
+	TagTelecom: true, TagUSIM: true, TagOptUSIM: true, TagISIM: true, TagOptISIM: true,
+	TagCSIM: true, TagOptCSIM: true, TagGSMAccess: true, TagDF5GS: true, TagDFSAIP: true,
+	TagGenericFileManagement: true,
+}
+
+// optionalParentTags maps an optional application element to the element it extends
+var optionalParentTags = map[int]int{
+	TagOptUSIM: TagUSIM,
+	TagOptISIM: TagISIM,
+	TagOptCSIM: TagCSIM,
+}
+
+// GenerateElementValueNotation generates the value notation of one element as "valueN"
+func GenerateElementValueNotation(elem *ProfileElement, num int) string {
+	g := &Generator{sb: &strings.Builder{}}
+	g.generateProfileElement(elem, num)
+	return g.sb.String()
+}
+
+// SplitProfile writes each element of p to its own value notation file in dir
+// (NN_<element>.asn1) and a manifest with the element order, value numbers and encodings
+func SplitProfile(p *Profile, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+
+	width := len(fmt.Sprint(len(p.Elements)))
+	if width < 2 {
+		width = 2
+	}
+
+	var manifest SplitManifest
+	for i := range p.Elements {
+		elem := &p.Elements[i]
+		der, err := encodeProfileElement(elem)
+		if err != nil {
+			return fmt.Errorf("encode element %d (%s): %w", i+1, getChoiceFromTag(elem.Tag), err)
+		}
+
+		entry := SplitElement{
+			Value:   i + 1,
+			Element: getChoiceFromTag(elem.Tag),
+			Tag:     elem.Tag,
+			DER:     strings.ToUpper(hex.EncodeToString(der)),
+			Raw:     !valueNotationTags[elem.Tag] || elem.Value == nil,
+		}
+		entry.File = fmt.Sprintf("%0*d_%s.asn1", width, i+1, entry.Element)
+
+		var text string
+		if entry.Raw {
+			text = fmt.Sprintf("-- value%d: element [%d] has no value notation support;\r\n-- it is re-assembled from the DER in %s\r\n",
+				entry.Value, elem.Tag, SplitManifestName)
+		} else {
+			text = GenerateElementValueNotation(elem, entry.Value)
+		}
+		entry.SHA256 = sha256Hex([]byte(text))
+
+		if err := os.WriteFile(filepath.Join(dir, entry.File), []byte(text), 0644); err != nil {
+			return fmt.Errorf("write %s: %w", entry.File, err)
+		}
+		manifest.Elements = append(manifest.Elements, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, SplitManifestName), append(data, '\n'), 0644)
+}
+
+// AssembleProfile reads a directory written by SplitProfile back into a Profile.
+// Element files that were not edited keep their split-time encoding byte for byte;
+// edited files are parsed and re-encoded. The result must contain the mandatory
+// elements in a legal order.
+func AssembleProfile(dir string) (*Profile, error) {
+	data, err := os.ReadFile(filepath.Join(dir, SplitManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	var manifest SplitManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if len(manifest.Elements) == 0 {
+		return nil, fmt.Errorf("manifest lists no elements")
+	}
+
+	profile := &Profile{Elements: make([]ProfileElement, len(manifest.Elements))}
+	var text strings.Builder
+	var parsed []int // manifest indexes of the elements in text, in order
+	unchanged := make([]bool, len(manifest.Elements))
+
+	for i, entry := range manifest.Elements {
+		content, err := os.ReadFile(filepath.Join(dir, entry.File))
+		if err != nil {
+			return nil, fmt.Errorf("read element: %w", err)
+		}
+		unchanged[i] = sha256Hex(content) == entry.SHA256
+
+		if entry.Raw {
+			der, err := hex.DecodeString(entry.DER)
+			if err != nil || len(der) == 0 {
+				return nil, fmt.Errorf("%s: element [%d] has no usable DER in the manifest", entry.File, entry.Tag)
+			}
+			profile.Elements[i] = ProfileElement{Tag: entry.Tag, RawBytes: der}
+			continue
+		}
+		text.Write(content)
+		text.WriteString("\r\n")
+		parsed = append(parsed, i)
+	}
+
+	// Parse all value notation files together so version-dependent tags follow the header
+	notation, err := ParseValueNotation(text.String())
+	if err != nil {
+		return nil, err
+	}
+	if len(notation.Elements) != len(parsed) {
+		return nil, fmt.Errorf("element files define %d elements, manifest lists %d (one element per file)",
+			len(notation.Elements), len(parsed))
+	}
+
+	for k, i := range parsed {
+		entry := manifest.Elements[i]
+		elem := notation.Elements[k]
+		if elem.Tag != entry.Tag {
+			return nil, fmt.Errorf("%s: contains %s, manifest expects %s", entry.File, getChoiceFromTag(elem.Tag), entry.Element)
+		}
+		if unchanged[i] {
+			if der, err := hex.DecodeString(entry.DER); err == nil && len(der) > 0 {
+				elem.RawBytes = der
+			}
+		}
+		profile.Elements[i] = elem
+	}
+
+	profile.reindex()
+	if err := checkElementOrder(profile.Elements); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// checkElementOrder verifies the mandatory elements and the ordering rules of a profile:
+// header first, end last, the MF before any file system element and optional
+// application elements after the application they extend
+func checkElementOrder(elements []ProfileElement) error {
+	count := make(map[int]int)
+	first := make(map[int]int)
+	for i, elem := range elements {
+		if count[elem.Tag] == 0 {
+			first[elem.Tag] = i
+		}
+		count[elem.Tag]++
+	}
+
+	for _, tag := range []int{TagProfileHeader, TagMF, TagEnd} {
+		if count[tag] == 0 {
+			return fmt.Errorf("mandatory element %s is missing", getChoiceFromTag(tag))
+		}
+		if count[tag] > 1 {
+			return fmt.Errorf("element %s appears %d times", getChoiceFromTag(tag), count[tag])
+		}
+	}
+	if elements[0].Tag != TagProfileHeader {
+		return fmt.Errorf("first element must be header, got %s", getChoiceFromTag(elements[0].Tag))
+	}
+	if last := elements[len(elements)-1].Tag; last != TagEnd {
+		return fmt.Errorf("last element must be end, got %s", getChoiceFromTag(last))
+	}
+
+	mf := first[TagMF]
+	for i, elem := range elements {
+		if fileSystemTags[elem.Tag] && i < mf {
+			return fmt.Errorf("element %d (%s) comes before mf", i+1, getChoiceFromTag(elem.Tag))
+		}
+		if parent, ok := optionalParentTags[elem.Tag]; ok {
+			if p, found := first[parent]; !found || p > i {
+				return fmt.Errorf("element %d (%s) requires %s before it", i+1, getChoiceFromTag(elem.Tag), getChoiceFromTag(parent))
+			}
+		}
+	}
+	return nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,164 @@
+package esim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ============ SPLIT / ASSEMBLE TESTS ============
+
+// splitReferenceProfile decodes the DER of the reference profile and splits it into a temp dir
+func splitReferenceProfile(t *testing.T) (der []byte, dir string) {
+	t.Helper()
+	parsed, err := ParseValueNotation(ReferenceASN1Text)
+	if err != nil {
+		t.Fatalf("ParseValueNotation() error = %v", err)
+	}
+	der, err = EncodeProfile(parsed)
+	if err != nil {
+		t.Fatalf("EncodeProfile() error = %v", err)
+	}
+	p, err := DecodeProfile(der)
+	if err != nil {
+		t.Fatalf("DecodeProfile() error = %v", err)
+	}
+	dir = t.TempDir()
+	if err := SplitProfile(p, dir); err != nil {
+		t.Fatalf("SplitProfile() error = %v", err)
+	}
+	return der, dir
+}
+
+func readManifest(t *testing.T, dir string) SplitManifest {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, SplitManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m SplitManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func writeManifest(t *testing.T, dir string, m SplitManifest) {
+	t.Helper()
+	data, _ := json.MarshalIndent(m, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, SplitManifestName), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitProfile_Files(t *testing.T) {
+	_, dir := splitReferenceProfile(t)
+	m := readManifest(t, dir)
+
+	if len(m.Elements) != 30 {
+		t.Fatalf("manifest has %d elements, want 30", len(m.Elements))
+	}
+	tests := []struct {
+		index int
+		file  string
+		value int
+	}{
+		{0, "01_header.asn1", 1},
+		{7, "08_usim.asn1", 8},
+		{29, "30_end.asn1", 30},
+	}
+	for _, tc := range tests {
+		t.Run(tc.file, func(t *testing.T) {
+			e := m.Elements[tc.index]
+			if e.File != tc.file || e.Value != tc.value {
+				t.Errorf("element %d = %s value%d, want %s value%d", tc.index, e.File, e.Value, tc.file, tc.value)
+			}
+			content, err := os.ReadFile(filepath.Join(dir, e.File))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(content), "value"+strings.TrimLeft(tc.file[:2], "0")+" ProfileElement ::= ") {
+				t.Errorf("%s starts with %q", e.File, content[:40])
+			}
+		})
+	}
+}
+
+func TestAssembleProfile_RoundTrip(t *testing.T) {
+	der, dir := splitReferenceProfile(t)
+
+	p, err := AssembleProfile(dir)
+	if err != nil {
+		t.Fatalf("AssembleProfile() error = %v", err)
+	}
+	got, err := EncodeProfile(p)
+	if err != nil {
+		t.Fatalf("EncodeProfile() error = %v", err)
+	}
+	if !bytes.Equal(got, der) {
+		t.Errorf("round trip changed the profile (%d bytes, want %d)", len(got), len(der))
+	}
+	if p.Header == nil || p.USIM == nil || p.End == nil {
+		t.Errorf("convenience references not populated")
+	}
+}
+
+func TestAssembleProfile_EditedElement(t *testing.T) {
+	_, dir := splitReferenceProfile(t)
+	m := readManifest(t, dir)
+
+	path := filepath.Join(dir, m.Elements[0].File)
+	content, _ := os.ReadFile(path)
+	edited := strings.Replace(string(content), "GSMA Generic eUICC Test Profile", "Edited Test Profile", 1)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := AssembleProfile(dir)
+	if err != nil {
+		t.Fatalf("AssembleProfile() error = %v", err)
+	}
+	if p.GetProfileType() != "Edited Test Profile" {
+		t.Errorf("profileType = %q", p.GetProfileType())
+	}
+	if p.Elements[0].RawBytes != nil {
+		t.Errorf("edited header kept its split-time encoding")
+	}
+	for i := 1; i < len(p.Elements); i++ {
+		if got, _ := encodeProfileElement(&p.Elements[i]); strings.ToUpper(hex.EncodeToString(got)) != m.Elements[i].DER {
+			t.Errorf("untouched element %s changed", m.Elements[i].File)
+		}
+	}
+}
+
+func TestAssembleProfile_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(m *SplitManifest)
+		wantErr string
+	}{
+		{"End missing", func(m *SplitManifest) { m.Elements = m.Elements[:len(m.Elements)-1] }, "mandatory element end"},
+		{"MF missing", func(m *SplitManifest) { m.Elements = append(m.Elements[:1], m.Elements[2:]...) }, "mandatory element mf"},
+		{"Header not first", func(m *SplitManifest) { m.Elements[0], m.Elements[1] = m.Elements[1], m.Elements[0] }, "first element must be header"},
+		{"opt-usim before usim", func(m *SplitManifest) { m.Elements[7], m.Elements[8] = m.Elements[8], m.Elements[7] }, "requires usim"},
+		{"Telecom before mf", func(m *SplitManifest) { m.Elements[1], m.Elements[4] = m.Elements[4], m.Elements[1] }, "comes before mf"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, dir := splitReferenceProfile(t)
+			m := readManifest(t, dir)
+			tc.edit(&m)
+			writeManifest(t, dir, m)
+
+			_, err := AssembleProfile(dir)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("AssembleProfile() error = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
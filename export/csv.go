@@ -0,0 +1,20 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+)
+
+// csvHeader is written once at the top of a new CSV export
+const csvHeader = "iccid,imsi,msisdn,mcc,mnc,ki,op,opc,amf,sqn\n"
+
+// csvRecord returns the subscriber as one CSV line (columns of csvHeader)
+func csvRecord(s *Subscriber) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{s.ICCID, s.IMSI, s.MSISDN, s.MCC, s.MNC, s.K, s.OP, s.OPc, s.AMF, s.SQN}); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,102 @@
+package export
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// ============ CORE EXPORT TESTS ============
+
+// exportFixtureSubscribers are two cards of a batch: one with OPc and MSISDN, one with OP only
+func exportFixtureSubscribers() []Subscriber {
+	return []Subscriber{
+		{ICCID: "8988211000000000018", IMSI: "001010000000001", MSISDN: "79990000001", MCC: "001", MNC: "01",
+			K: "465b5ce8b199b49faa5f0a2ee238a6bc", OPc: "cd63cb71954a9f4e48a5994e37a02baf"},
+		{ICCID: "8988211000000000026", IMSI: "208930000000002", MCC: "208", MNC: "93",
+			K: "000102030405060708090A0B0C0D0E0F", OP: "00112233445566778899AABBCCDDEEFF", AMF: "9001", SQN: "000000000020"},
+	}
+}
+
+func TestAppendFile_Golden(t *testing.T) {
+	tests := []struct {
+		format string
+		golden string
+	}{
+		{FormatOpen5GS, "open5gs.json"},
+		{FormatFree5GC, "free5gc.json"},
+		{FormatCSV, "subscribers.csv"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.format, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), tc.golden)
+			for _, s := range exportFixtureSubscribers() {
+				if err := AppendFile(out, tc.format, &s); err != nil {
+					t.Fatalf("AppendFile() error = %v", err)
+				}
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", tc.golden)
+			if *updateGolden {
+				if err := os.WriteFile(path, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("golden file: %v (run with -update to create)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("AppendFile() mismatch\n--- got ---\n%s\n--- want ---\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestSubscriberNormalize(t *testing.T) {
+	valid := exportFixtureSubscribers()[0]
+	tests := []struct {
+		name    string
+		modify  func(*Subscriber)
+		wantErr string
+	}{
+		{"valid", func(*Subscriber) {}, ""},
+		{"IMSI not digits", func(s *Subscriber) { s.IMSI = "00101000000000A" }, "invalid IMSI"},
+		{"PLMN mismatch", func(s *Subscriber) { s.MNC = "02" }, "MCC/MNC"},
+		{"no K", func(s *Subscriber) { s.K = "" }, "K must be 32"},
+		{"short OPc", func(s *Subscriber) { s.OPc = "00" }, "OPc must be 32"},
+		{"no OP or OPc", func(s *Subscriber) { s.OPc = "" }, "OP or OPc"},
+		{"bad SQN", func(s *Subscriber) { s.SQN = "01" }, "SQN must be 12"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := valid
+			tc.modify(&s)
+			err := s.Normalize()
+			if tc.wantErr == "" {
+				if err != nil || s.AMF != DefaultAMF || s.SQN != DefaultSQN || s.K != strings.ToUpper(valid.K) {
+					t.Errorf("Normalize() = %v, %+v", err, s)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Normalize() error = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+
+	if _, err := Record("hss", &valid); err == nil {
+		t.Error("Record() accepted an unknown format")
+	}
+}
@@ -0,0 +1,88 @@
+package export
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// free5gc webconsole subscriber document (POST /api/subscriber/imsi-<IMSI>/<PLMN ID>),
+// limited to authentication and access/mobility data; sessions use the webconsole defaults
+
+type free5gcKey struct {
+	EncryptionAlgorithm int    `json:"encryptionAlgorithm"`
+	EncryptionKey       int    `json:"encryptionKey"`
+	PermanentKeyValue   string `json:"permanentKeyValue,omitempty"`
+	OPValue             string `json:"opValue,omitempty"`
+	OPcValue            string `json:"opcValue,omitempty"`
+}
+
+type free5gcMilenage struct {
+	OP free5gcKey `json:"op"`
+}
+
+type free5gcAuthSubscription struct {
+	AuthenticationMethod          string          `json:"authenticationMethod"`
+	PermanentKey                  free5gcKey      `json:"permanentKey"`
+	SequenceNumber                string          `json:"sequenceNumber"`
+	AuthenticationManagementField string          `json:"authenticationManagementField"`
+	Milenage                      free5gcMilenage `json:"milenage"`
+	OPc                           free5gcKey      `json:"opc"`
+}
+
+type free5gcAMBR struct {
+	Uplink   string `json:"uplink"`
+	Downlink string `json:"downlink"`
+}
+
+type free5gcSNSSAI struct {
+	SST int    `json:"sst"`
+	SD  string `json:"sd"`
+}
+
+type free5gcNSSAI struct {
+	DefaultSingleNssais []free5gcSNSSAI `json:"defaultSingleNssais"`
+}
+
+type free5gcAMData struct {
+	GPSIs            []string     `json:"gpsis"`
+	SubscribedUeAmbr free5gcAMBR  `json:"subscribedUeAmbr"`
+	NSSAI            free5gcNSSAI `json:"nssai"`
+}
+
+type free5gcSubscriber struct {
+	PLMNID                            string                  `json:"plmnID"`
+	UEID                              string                  `json:"ueId"`
+	AuthenticationSubscription        free5gcAuthSubscription `json:"AuthenticationSubscription"`
+	AccessAndMobilitySubscriptionData free5gcAMData           `json:"AccessAndMobilitySubscriptionData"`
+}
+
+// free5gcRecord returns the subscriber as one line: 5G-AKA with Milenage, default slice
+// SST 1 / SD 010203 (the free5gc default configuration)
+func free5gcRecord(s *Subscriber) ([]byte, error) {
+	doc := free5gcSubscriber{
+		PLMNID: s.PLMNID(),
+		UEID:   "imsi-" + s.IMSI,
+		AuthenticationSubscription: free5gcAuthSubscription{
+			AuthenticationMethod:          "5G_AKA",
+			PermanentKey:                  free5gcKey{PermanentKeyValue: strings.ToLower(s.K)},
+			SequenceNumber:                strings.ToLower(s.SQN),
+			AuthenticationManagementField: strings.ToLower(s.AMF),
+			Milenage:                      free5gcMilenage{OP: free5gcKey{OPValue: strings.ToLower(s.OP)}},
+			OPc:                           free5gcKey{OPcValue: strings.ToLower(s.OPc)},
+		},
+		AccessAndMobilitySubscriptionData: free5gcAMData{
+			GPSIs:            []string{},
+			SubscribedUeAmbr: free5gcAMBR{Uplink: "1 Gbps", Downlink: "2 Gbps"},
+			NSSAI:            free5gcNSSAI{DefaultSingleNssais: []free5gcSNSSAI{{SST: 1, SD: "010203"}}},
+		},
+	}
+	if s.MSISDN != "" {
+		doc.AccessAndMobilitySubscriptionData.GPSIs = []string{"msisdn-" + s.MSISDN}
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
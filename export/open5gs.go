@@ -0,0 +1,131 @@
+package export
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// open5gs subscriber document (open5gs-dbctl add layout, lib/dbi/subscription.c)
+
+type open5gsBitrate struct {
+	Value int `json:"value"`
+	Unit  int `json:"unit"` // 0 bps, 1 Kbps, 2 Mbps, 3 Gbps, 4 Tbps
+}
+
+type open5gsAMBR struct {
+	Downlink open5gsBitrate `json:"downlink"`
+	Uplink   open5gsBitrate `json:"uplink"`
+}
+
+type open5gsARP struct {
+	PriorityLevel           int `json:"priority_level"`
+	PreEmptionCapability    int `json:"pre_emption_capability"`
+	PreEmptionVulnerability int `json:"pre_emption_vulnerability"`
+}
+
+type open5gsQoS struct {
+	Index int        `json:"index"`
+	ARP   open5gsARP `json:"arp"`
+}
+
+type open5gsSession struct {
+	Name    string      `json:"name"`
+	Type    int         `json:"type"` // 1 IPv4, 2 IPv6, 3 IPv4v6
+	QoS     open5gsQoS  `json:"qos"`
+	AMBR    open5gsAMBR `json:"ambr"`
+	PCCRule []any       `json:"pcc_rule"`
+}
+
+type open5gsSlice struct {
+	SST              int              `json:"sst"`
+	DefaultIndicator bool             `json:"default_indicator"`
+	Session          []open5gsSession `json:"session"`
+}
+
+// open5gsLong is a mongo extended JSON 64-bit integer (the SQN is a Long in open5gs)
+type open5gsLong struct {
+	NumberLong string `json:"$numberLong"`
+}
+
+type open5gsSecurity struct {
+	K   string      `json:"k"`
+	OP  *string     `json:"op"`
+	OPc *string     `json:"opc"`
+	AMF string      `json:"amf"`
+	SQN open5gsLong `json:"sqn"`
+}
+
+type open5gsSubscriber struct {
+	SchemaVersion         int             `json:"schema_version"`
+	IMSI                  string          `json:"imsi"`
+	MSISDN                []string        `json:"msisdn"`
+	IMEISV                []string        `json:"imeisv"`
+	MMEHost               []string        `json:"mme_host"`
+	MMERealm              []string        `json:"mme_realm"`
+	PurgeFlag             []bool          `json:"purge_flag"`
+	Slice                 []open5gsSlice  `json:"slice"`
+	Security              open5gsSecurity `json:"security"`
+	AMBR                  open5gsAMBR     `json:"ambr"`
+	AccessRestrictionData int             `json:"access_restriction_data"`
+	NetworkAccessMode     int             `json:"network_access_mode"`
+	SubscriberStatus      int             `json:"subscriber_status"`
+	OperatorDetermined    int             `json:"operator_determined_barring"`
+	SubscribedRAUTAUTimer int             `json:"subscribed_rau_tau_timer"`
+	Version               int             `json:"__v"`
+}
+
+// open5gsRecord returns the subscriber as one line for `mongoimport --db open5gs
+// --collection subscribers`: default slice SST 1 with an "internet" IPv4v6 session, 1 Gbps AMBR
+func open5gsRecord(s *Subscriber) ([]byte, error) {
+	gbps := open5gsAMBR{Downlink: open5gsBitrate{1, 3}, Uplink: open5gsBitrate{1, 3}}
+	sqn, err := strconv.ParseUint(s.SQN, 16, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := open5gsSubscriber{
+		SchemaVersion: 1,
+		IMSI:          s.IMSI,
+		MSISDN:        []string{},
+		IMEISV:        []string{},
+		MMEHost:       []string{},
+		MMERealm:      []string{},
+		PurgeFlag:     []bool{},
+		Slice: []open5gsSlice{{
+			SST:              1,
+			DefaultIndicator: true,
+			Session: []open5gsSession{{
+				Name:    "internet",
+				Type:    3,
+				QoS:     open5gsQoS{Index: 9, ARP: open5gsARP{PriorityLevel: 8, PreEmptionCapability: 1, PreEmptionVulnerability: 1}},
+				AMBR:    gbps,
+				PCCRule: []any{},
+			}},
+		}},
+		Security: open5gsSecurity{
+			K:   strings.ToLower(s.K),
+			AMF: strings.ToLower(s.AMF),
+			SQN: open5gsLong{NumberLong: strconv.FormatUint(sqn, 10)},
+		},
+		AMBR:                  gbps,
+		AccessRestrictionData: 32,
+		SubscribedRAUTAUTimer: 12,
+	}
+	if s.MSISDN != "" {
+		doc.MSISDN = []string{s.MSISDN}
+	}
+	if s.OPc != "" {
+		opc := strings.ToLower(s.OPc)
+		doc.Security.OPc = &opc
+	} else {
+		op := strings.ToLower(s.OP)
+		doc.Security.OP = &op
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,141 @@
+// Package export formats subscriber records for core network databases (open5gs, free5gc)
+// so that what was programmed on a card can be provisioned in the HSS/UDM unchanged.
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"sim_reader/inputs"
+)
+
+// Core network export formats
+const (
+	FormatOpen5GS = "open5gs" // Subscriber document for mongoimport (one JSON document per line)
+	FormatFree5GC = "free5gc" // Webconsole subscriber document (one JSON document per line)
+	FormatCSV     = "csv"     // Generic CSV with a header line
+)
+
+// Formats lists the supported export formats
+var Formats = []string{FormatOpen5GS, FormatFree5GC, FormatCSV}
+
+// Defaults for the fields that cannot be read from the card
+const (
+	DefaultAMF = "8000"
+	DefaultSQN = "000000000000"
+)
+
+// Subscriber is one card as the core network sees it. IMSI, ICCID and MSISDN come from the
+// card; K, OP/OPc, AMF and SQN cannot be read back and come from the config or flags.
+type Subscriber struct {
+	ICCID  string
+	IMSI   string
+	MSISDN string
+	MCC    string // PLMN of the IMSI (MNC length from EF_AD)
+	MNC    string
+	K      string // Subscriber key Ki (32 hex)
+	OP     string // Operator key OP (32 hex), used when OPc is empty
+	OPc    string // Derived operator key OPc (32 hex)
+	AMF    string // Authentication management field (4 hex, default 8000)
+	SQN    string // Initial sequence number (12 hex, default 000000000000)
+}
+
+// Normalize fills the AMF/SQN defaults, uppercases the hex fields and checks them
+func (s *Subscriber) Normalize() error {
+	if s.AMF == "" {
+		s.AMF = DefaultAMF
+	}
+	if s.SQN == "" {
+		s.SQN = DefaultSQN
+	}
+	imsi, err := inputs.IMSI("IMSI", s.IMSI)
+	if err != nil {
+		return fmt.Errorf("invalid IMSI %q: %w", s.IMSI, err)
+	}
+	s.IMSI = imsi
+	if s.MCC == "" || s.MNC == "" || !strings.HasPrefix(s.IMSI, s.MCC+s.MNC) {
+		return fmt.Errorf("IMSI %s: MCC/MNC %q/%q do not match", s.IMSI, s.MCC, s.MNC)
+	}
+	if s.OP == "" && s.OPc == "" {
+		return fmt.Errorf("IMSI %s: OP or OPc is required", s.IMSI)
+	}
+
+	fields := []struct {
+		name  string
+		value *string
+		size  int
+	}{
+		{"K", &s.K, 16}, {"OP", &s.OP, 16}, {"OPc", &s.OPc, 16}, {"AMF", &s.AMF, 2}, {"SQN", &s.SQN, 6},
+	}
+	for _, f := range fields {
+		if *f.value == "" && f.name != "K" {
+			continue
+		}
+		b, err := inputs.HexKey(f.name, *f.value, f.size)
+		if err != nil {
+			return fmt.Errorf("IMSI %s: %w", s.IMSI, err)
+		}
+		*f.value = fmt.Sprintf("%X", b)
+	}
+	return nil
+}
+
+// PLMNID returns MCC+MNC as used by free5gc (e.g. 20893)
+func (s *Subscriber) PLMNID() string {
+	return s.MCC + s.MNC
+}
+
+// Record formats one subscriber in the given format. CSV records have no header.
+func Record(format string, s *Subscriber) ([]byte, error) {
+	if err := s.Normalize(); err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatOpen5GS:
+		return open5gsRecord(s)
+	case FormatFree5GC:
+		return free5gcRecord(s)
+	case FormatCSV:
+		return csvRecord(s)
+	default:
+		return nil, fmt.Errorf("unknown export format %q (use %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+// AppendFile appends the subscriber record to path, so that cards programmed one after
+// another end up in the same file. A new or empty CSV file gets the header first.
+func AppendFile(path, format string, s *Subscriber) error {
+	record, err := Record(format, s)
+	if err != nil {
+		return err
+	}
+
+	var existing []byte
+	if data, err := os.ReadFile(path); err == nil {
+		existing = data
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	if format == FormatCSV && len(bytes.TrimSpace(existing)) == 0 {
+		buf.WriteString(csvHeader)
+	}
+	buf.Write(record)
+
+	// Files hold subscriber keys
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
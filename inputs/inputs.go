@@ -0,0 +1,269 @@
+// Package inputs validates the identifiers and keys given on the command line and in
+// config files: IMSI, ICCID, hex keys, PLMN, AID and ADM keys. Errors name the parameter
+// and the precise problem and, where the value looks like a typo (a hex digit too many or
+// too few, a failed Luhn check, the letter O for a zero), say what was probably meant.
+package inputs
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrLuhn is wrapped by the error of an ICCID whose check digit is wrong. Lab and test
+// cards are often personalised without a valid check digit, so callers that only compare
+// an ICCID may accept it.
+var ErrLuhn = errors.New("Luhn check failed")
+
+// Error is a rejected input value
+type Error struct {
+	Param   string // parameter as the user knows it: a flag ("--key") or a field ("K")
+	Value   string // the value as given
+	Problem string // e.g. "must be 32 hex chars (128-bit); got 31"
+	Hint    string // typo guess, e.g. "one hex digit is missing"
+	Err     error  // kind of problem for errors.Is, e.g. ErrLuhn; nil for most
+}
+
+func (e *Error) Error() string {
+	msg := e.Param + " " + e.Problem
+	if e.Hint != "" {
+		msg += " (" + e.Hint + ")"
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(param, value, hint, format string, args ...any) *Error {
+	return &Error{Param: param, Value: value, Problem: fmt.Sprintf(format, args...), Hint: hint}
+}
+
+// cleanDigits removes the spaces and dashes of a number copied from a label or a ticket
+func cleanDigits(s string) string {
+	return strings.NewReplacer(" ", "", "-", "", "\t", "").Replace(strings.TrimSpace(s))
+}
+
+// cleanHex removes spaces and a 0x prefix
+func cleanHex(s string) string {
+	s = strings.Join(strings.Fields(s), "")
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s = s[2:]
+	}
+	return s
+}
+
+// lookalikeHint explains a letter typed for a digit
+func lookalikeHint(c rune) string {
+	switch c {
+	case 'O', 'o':
+		return "letter O instead of digit 0?"
+	case 'l', 'I':
+		return "letter l/I instead of digit 1?"
+	}
+	return ""
+}
+
+// firstNonDigit returns the position (1-based) and character of the first non-digit
+func firstNonDigit(s string) (int, rune) {
+	for i, c := range s {
+		if c < '0' || c > '9' {
+			return i + 1, c
+		}
+	}
+	return 0, 0
+}
+
+// firstNonHex returns the position (1-based) and character of the first non-hex character
+func firstNonHex(s string) (int, rune) {
+	for i, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return i + 1, c
+		}
+	}
+	return 0, 0
+}
+
+// offByOne names a single missing or extra character compared with the wanted counts
+func offByOne(got int, unit string, want ...int) string {
+	for _, w := range want {
+		switch got {
+		case w - 1:
+			return fmt.Sprintf("did you mean %d? one %s is missing", w, unit)
+		case w + 1:
+			return fmt.Sprintf("did you mean %d? one %s too many", w, unit)
+		}
+	}
+	return ""
+}
+
+// digits checks that s is min to max decimal digits
+func digits(param, s string, min, max int) (string, error) {
+	if s == "" {
+		return "", newError(param, s, "", "is empty")
+	}
+	if pos, c := firstNonDigit(s); pos > 0 {
+		return "", newError(param, s, lookalikeHint(c), "must be digits only; got %q at position %d", c, pos)
+	}
+	if len(s) < min || len(s) > max {
+		hint := offByOne(len(s), "digit", min, max)
+		if min == max {
+			return "", newError(param, s, hint, "must be %d digits; got %d", min, len(s))
+		}
+		return "", newError(param, s, hint, "must be %d-%d digits; got %d", min, max, len(s))
+	}
+	return s, nil
+}
+
+// IMSI validates an IMSI: 6 to 15 digits (spaces and dashes are ignored)
+func IMSI(param, s string) (string, error) {
+	return digits(param, cleanDigits(s), 6, 15)
+}
+
+// ICCID validates an ICCID: 18 to 20 digits whose last digit is the Luhn check digit.
+// Spaces, dashes and trailing F padding are ignored. On a Luhn failure the cleaned ICCID
+// is returned with an error wrapping ErrLuhn.
+func ICCID(param, s string) (string, error) {
+	iccid := strings.TrimRight(cleanDigits(s), "Ff")
+	if _, err := digits(param, iccid, 18, 20); err != nil {
+		return "", err
+	}
+	body, check := iccid[:len(iccid)-1], iccid[len(iccid)-1]
+	if want := LuhnDigit(body); want != check {
+		err := newError(param, s, fmt.Sprintf("did you mean %s%c? else look for swapped digits", body, want),
+			"fails the Luhn check: check digit is %c, the other digits give %c", check, want)
+		err.Err = ErrLuhn
+		return iccid, err
+	}
+	return iccid, nil
+}
+
+// LuhnDigit returns the Luhn check digit for a string of decimal digits
+func LuhnDigit(body string) byte {
+	sum := 0
+	double := true // the digit left of the check digit is doubled
+	for i := len(body) - 1; i >= 0; i-- {
+		d := int(body[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// Hex decodes a non-empty hex value of any length (spaces and a 0x prefix are ignored)
+func Hex(param, s string) ([]byte, error) {
+	h := cleanHex(s)
+	if h == "" {
+		return nil, newError(param, s, "", "is empty")
+	}
+	if pos, c := firstNonHex(h); pos > 0 {
+		return nil, newError(param, s, lookalikeHint(c), "must be hex; got %q at position %d", c, pos)
+	}
+	if len(h)%2 != 0 {
+		return nil, newError(param, s, "a hex digit is missing or one too many", "has an odd number of hex chars (%d)", len(h))
+	}
+	b, _ := hex.DecodeString(h)
+	return b, nil
+}
+
+// HexKey decodes a hex value that must have one of the given sizes in bytes, e.g.
+// HexKey("--key", s, 16, 32) for a 128-bit or 256-bit key
+func HexKey(param, s string, sizes ...int) ([]byte, error) {
+	h := cleanHex(s)
+	chars := make([]int, len(sizes))
+	for i, n := range sizes {
+		chars[i] = 2 * n
+	}
+	if pos, c := firstNonHex(h); pos > 0 {
+		return nil, newError(param, s, lookalikeHint(c), "must be hex; got %q at position %d", c, pos)
+	}
+	for _, n := range chars {
+		if len(h) == n {
+			b, _ := hex.DecodeString(h)
+			return b, nil
+		}
+	}
+	return nil, newError(param, s, offByOne(len(h), "hex digit", chars...), "must be %s; got %d", describeSizes(sizes), len(h))
+}
+
+// describeSizes formats key sizes, e.g. "32 hex chars (128-bit) or 64 (256-bit)"
+func describeSizes(sizes []int) string {
+	parts := make([]string, len(sizes))
+	for i, n := range sizes {
+		if i == 0 {
+			parts[i] = fmt.Sprintf("%d hex chars (%d-bit)", 2*n, 8*n)
+		} else {
+			parts[i] = fmt.Sprintf("%d (%d-bit)", 2*n, 8*n)
+		}
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " or " + parts[len(parts)-1]
+}
+
+// AID decodes an application identifier: 5 to 16 bytes (ISO 7816-4)
+func AID(param, s string) ([]byte, error) {
+	b, err := Hex(param, s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 5 || len(b) > 16 {
+		return nil, newError(param, s, "", "must be 5-16 bytes (10-32 hex chars); got %d bytes", len(b))
+	}
+	return b, nil
+}
+
+// PLMN splits a PLMN given as MCC:MNC into MCC (3 digits) and MNC (2 or 3 digits). The
+// separator is required: without it a 2 and a 3 digit MNC cannot be told apart.
+func PLMN(param, s string) (mcc, mnc string, err error) {
+	v := strings.TrimSpace(s)
+	mcc, mnc, ok := strings.Cut(v, ":")
+	if !ok {
+		hint := ""
+		if pos, _ := firstNonDigit(v); pos == 0 && (len(v) == 5 || len(v) == 6) {
+			hint = fmt.Sprintf("did you mean %s:%s?", v[:3], v[3:])
+		}
+		return "", "", newError(param, s, hint, "must be MCC:MNC, e.g. 250:88; got %q", s)
+	}
+	mcc, mnc = strings.TrimSpace(mcc), strings.TrimSpace(mnc)
+	if _, err := digits(param+" MCC", mcc, 3, 3); err != nil {
+		return "", "", err
+	}
+	if _, err := digits(param+" MNC", mnc, 2, 3); err != nil {
+		return "", "", err
+	}
+	return mcc, mnc, nil
+}
+
+// ADMKey parses an ADM key: 16 hex chars, 8 decimal digits (sent as ASCII), other even
+// length hex, or up to 8 ASCII characters
+func ADMKey(param, s string) ([]byte, error) {
+	key := strings.TrimSpace(s)
+	hexPos, _ := firstNonHex(key)
+	digitPos, _ := firstNonDigit(key)
+	isHex, isDecimal := key != "" && hexPos == 0, key != "" && digitPos == 0
+
+	switch {
+	case len(key) == 16 && isHex:
+		return hex.DecodeString(key)
+	case len(key) == 8 && isDecimal:
+		return []byte(key), nil
+	case isDecimal && len(key) == 9:
+		return nil, newError(param, s, offByOne(len(key), "digit", 8), "must be 16 hex chars or 8 digits; got %d digits", len(key))
+	case isHex && (len(key) == 15 || len(key) == 17):
+		return nil, newError(param, s, offByOne(len(key), "hex digit", 16), "must be 16 hex chars or 8 digits; got %d hex chars", len(key))
+	case isHex && len(key)%2 == 0:
+		return hex.DecodeString(key)
+	case key != "" && len(key) <= 8:
+		return []byte(key), nil
+	}
+	return nil, newError(param, s, "", "must be 16 hex chars or 8 digits; got %q", s)
+}
@@ -0,0 +1,136 @@
+package inputs
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// ============ INPUT VALIDATION TESTS ============
+
+func TestHexKey(t *testing.T) {
+	key := strings.Repeat("0123456789ABCDEF", 2)
+	if b, err := HexKey("--key", "0x"+key, 16, 32); err != nil || len(b) != 16 {
+		t.Fatalf("HexKey(128-bit) = %X, %v", b, err)
+	}
+	if b, err := HexKey("--key", key+key, 16, 32); err != nil || len(b) != 32 {
+		t.Fatalf("HexKey(256-bit) = %X, %v", b, err)
+	}
+
+	tests := []struct {
+		name, value, want string
+	}{
+		{"one missing", key[:31], "--key must be 32 hex chars (128-bit) or 64 (256-bit); got 31 (did you mean 32? one hex digit is missing)"},
+		{"one too many", key + "0", "--key must be 32 hex chars (128-bit) or 64 (256-bit); got 33 (did you mean 32? one hex digit too many)"},
+		{"far off", key[:20], "--key must be 32 hex chars (128-bit) or 64 (256-bit); got 20"},
+		{"letter O", "O" + key[1:], `--key must be hex; got 'O' at position 1 (letter O instead of digit 0?)`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := HexKey("--key", tc.value, 16, 32)
+			if err == nil || err.Error() != tc.want {
+				t.Errorf("HexKey() error = %v, want %q", err, tc.want)
+			}
+			var inputErr *Error
+			if !errors.As(err, &inputErr) || inputErr.Param != "--key" || inputErr.Value != tc.value {
+				t.Errorf("HexKey() error %#v does not name the parameter and value", err)
+			}
+		})
+	}
+}
+
+func TestICCID(t *testing.T) {
+	if iccid, err := ICCID("--iccid", "8949 0000 1234 5678 903F"); err != nil || iccid != "8949000012345678903" {
+		t.Errorf("ICCID(valid) = %q, %v", iccid, err)
+	}
+
+	iccid, err := ICCID("--iccid", "8949000012345678901")
+	if !errors.Is(err, ErrLuhn) || iccid != "8949000012345678901" {
+		t.Fatalf("ICCID(bad check digit) = %q, %v; want the digits and ErrLuhn", iccid, err)
+	}
+	if !strings.Contains(err.Error(), "did you mean 8949000012345678903?") {
+		t.Errorf("ICCID() error = %v, want the corrected ICCID", err)
+	}
+
+	for _, bad := range []string{"89490000123456789", "894900001234567890123", "89ABC0000123456789"} {
+		if _, err := ICCID("--iccid", bad); err == nil || errors.Is(err, ErrLuhn) {
+			t.Errorf("ICCID(%q) error = %v, want a length or digit error", bad, err)
+		}
+	}
+}
+
+func TestIMSI(t *testing.T) {
+	if imsi, err := IMSI("--imsi", "001-01-0000000001"); err != nil || imsi != "001010000000001" {
+		t.Errorf("IMSI() = %q, %v", imsi, err)
+	}
+	_, err := IMSI("--imsi", "0010100000000012")
+	if err == nil || err.Error() != "--imsi must be 6-15 digits; got 16 (did you mean 15? one digit too many)" {
+		t.Errorf("IMSI(16 digits) error = %v", err)
+	}
+	if _, err := IMSI("--imsi", "00101000000000l"); err == nil || !strings.Contains(err.Error(), "letter l/I instead of digit 1?") {
+		t.Errorf("IMSI(letter l) error = %v", err)
+	}
+}
+
+func TestPLMN(t *testing.T) {
+	if mcc, mnc, err := PLMN("--plmn", " 310 : 410 "); err != nil || mcc != "310" || mnc != "410" {
+		t.Errorf("PLMN() = %q, %q, %v", mcc, mnc, err)
+	}
+	if _, _, err := PLMN("--plmn", "26201"); err == nil || !strings.Contains(err.Error(), "did you mean 262:01?") {
+		t.Errorf("PLMN(no separator) error = %v", err)
+	}
+	for _, bad := range []string{"26:01", "262:1", "262:0001", "26a:01", "262:01:eutran"} {
+		if _, _, err := PLMN("--plmn", bad); err == nil {
+			t.Errorf("PLMN(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestAID(t *testing.T) {
+	if aid, err := AID("--aid", "A0 00 00 00 87 10 02"); err != nil || len(aid) != 7 {
+		t.Errorf("AID() = %X, %v", aid, err)
+	}
+	if _, err := AID("--aid", "A0000000"); err == nil || err.Error() != "--aid must be 5-16 bytes (10-32 hex chars); got 4 bytes" {
+		t.Errorf("AID(4 bytes) error = %v", err)
+	}
+	if _, err := AID("--aid", "A00000008"); err == nil || !strings.Contains(err.Error(), "odd number of hex chars (9)") {
+		t.Errorf("AID(odd length) error = %v", err)
+	}
+}
+
+func TestADMKey(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []byte
+		wantErr string
+	}{
+		{"F38A3DECF6C7D239", []byte{0xF3, 0x8A, 0x3D, 0xEC, 0xF6, 0xC7, 0xD2, 0x39}, ""},
+		{"77111606", []byte("77111606"), ""},
+		{"1234", []byte{0x12, 0x34}, ""},
+		{"abc", []byte("abc"), ""},
+		{"F38A3DECF6C7D23", nil, "got 15 hex chars (did you mean 16? one hex digit is missing)"},
+		{"771116061", nil, "got 9 digits (did you mean 8? one digit too many)"},
+		{"not a valid key", nil, "must be 16 hex chars or 8 digits"},
+	}
+	for _, tc := range tests {
+		got, err := ADMKey("--adm", tc.value)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ADMKey(%q) error = %v, want %q", tc.value, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(got, tc.want) {
+			t.Errorf("ADMKey(%q) = %X, %v; want %X", tc.value, got, err, tc.want)
+		}
+	}
+}
+
+func TestLuhnDigit(t *testing.T) {
+	for body, want := range map[string]byte{"7992739871": '3', "894900001234567890": '3', "": '0'} {
+		if got := LuhnDigit(body); got != want {
+			t.Errorf("LuhnDigit(%q) = %c, want %c", body, got, want)
+		}
+	}
+}
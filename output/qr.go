@@ -0,0 +1,433 @@
+package output
+
+import "fmt"
+
+// QR code encoder (ISO/IEC 18004) for the summary sheet: byte mode, error
+// correction level M, versions 1-10 (up to 213 bytes), best of the 8 masks.
+
+// QRCode is an encoded QR symbol, Modules[y][x] is true for dark modules
+type QRCode struct {
+	Version int
+	Mask    int
+	Size    int
+	Modules [][]bool
+}
+
+// qrVersion is the level M block structure of one version
+type qrVersion struct {
+	ecPerBlock int
+	blocks     []int // data codewords of each block
+}
+
+var qrVersionsM = []qrVersion{
+	1:  {10, []int{16}},
+	2:  {16, []int{28}},
+	3:  {26, []int{44}},
+	4:  {18, []int{32, 32}},
+	5:  {24, []int{43, 43}},
+	6:  {16, []int{27, 27, 27, 27}},
+	7:  {18, []int{31, 31, 31, 31}},
+	8:  {22, []int{38, 38, 39, 39}},
+	9:  {22, []int{36, 36, 36, 37, 37}},
+	10: {26, []int{43, 43, 43, 43, 44}},
+}
+
+// qrAlignment lists the alignment pattern centre coordinates per version
+var qrAlignment = [][]int{
+	2: {6, 18}, 3: {6, 22}, 4: {6, 26}, 5: {6, 30}, 6: {6, 34},
+	7: {6, 22, 38}, 8: {6, 24, 42}, 9: {6, 26, 46}, 10: {6, 28, 50},
+}
+
+func (v qrVersion) dataCodewords() int {
+	n := 0
+	for _, b := range v.blocks {
+		n += b
+	}
+	return n
+}
+
+// EncodeQR encodes data in the smallest version that holds it
+func EncodeQR(data []byte) (*QRCode, error) {
+	for version := 1; version < len(qrVersionsM); version++ {
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) > 8*qrVersionsM[version].dataCodewords() {
+			continue
+		}
+		codewords := qrAddECC(qrDataCodewords(data, countBits, qrVersionsM[version].dataCodewords()), qrVersionsM[version])
+		return qrBuild(version, codewords), nil
+	}
+	return nil, fmt.Errorf("%d bytes do not fit in a QR code up to version %d", len(data), len(qrVersionsM)-1)
+}
+
+// qrBitBuffer collects bits most significant first
+type qrBitBuffer []bool
+
+func (b *qrBitBuffer) append(value, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		*b = append(*b, (value>>uint(i))&1 == 1)
+	}
+}
+
+// qrDataCodewords builds the byte mode segment with terminator and padding
+func qrDataCodewords(data []byte, countBits, capacity int) []byte {
+	var bb qrBitBuffer
+	bb.append(0x4, 4)
+	bb.append(len(data), countBits)
+	for _, c := range data {
+		bb.append(int(c), 8)
+	}
+	terminator := 8*capacity - len(bb)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bb.append(0, terminator)
+	bb.append(0, (8-len(bb)%8)%8)
+
+	out := make([]byte, 0, capacity)
+	for i := 0; i < len(bb); i += 8 {
+		var c byte
+		for _, bit := range bb[i : i+8] {
+			c <<= 1
+			if bit {
+				c |= 1
+			}
+		}
+		out = append(out, c)
+	}
+	for pad := byte(0xEC); len(out) < capacity; pad ^= 0xEC ^ 0x11 {
+		out = append(out, pad)
+	}
+	return out
+}
+
+// qrAddECC splits the data into blocks, computes their error correction and interleaves all
+func qrAddECC(data []byte, v qrVersion) []byte {
+	divisor := qrRSDivisor(v.ecPerBlock)
+	var blocks, ecc [][]byte
+	for _, n := range v.blocks {
+		blocks = append(blocks, data[:n])
+		ecc = append(ecc, qrRSRemainder(data[:n], divisor))
+		data = data[n:]
+	}
+
+	var out []byte
+	longest := v.blocks[len(v.blocks)-1]
+	for i := 0; i < longest; i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				out = append(out, b[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecPerBlock; i++ {
+		for _, e := range ecc {
+			out = append(out, e[i])
+		}
+	}
+	return out
+}
+
+// qrGFMul multiplies in GF(256) with the QR polynomial x^8+x^4+x^3+x^2+1
+func qrGFMul(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// qrRSDivisor returns the generator polynomial of the given degree (leading 1 omitted)
+func qrRSDivisor(degree int) []byte {
+	divisor := make([]byte, degree)
+	divisor[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range divisor {
+			divisor[j] = qrGFMul(divisor[j], root)
+			if j+1 < len(divisor) {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+		root = qrGFMul(root, 0x02)
+	}
+	return divisor
+}
+
+// qrRSRemainder returns the Reed-Solomon error correction codewords of data
+func qrRSRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= qrGFMul(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// qrMatrix is a symbol under construction
+type qrMatrix struct {
+	size     int
+	modules  [][]bool
+	function [][]bool // finder, timing, alignment, format and version modules
+}
+
+func newQRMatrix(version int) *qrMatrix {
+	m := &qrMatrix{size: 17 + 4*version}
+	m.modules = make([][]bool, m.size)
+	m.function = make([][]bool, m.size)
+	for y := range m.modules {
+		m.modules[y] = make([]bool, m.size)
+		m.function[y] = make([]bool, m.size)
+	}
+	return m
+}
+
+func (m *qrMatrix) setFunction(x, y int, dark bool) {
+	m.modules[y][x] = dark
+	m.function[y][x] = true
+}
+
+func qrBuild(version int, codewords []byte) *QRCode {
+	m := newQRMatrix(version)
+	m.drawFunctionPatterns(version)
+	m.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		m.applyMask(mask)
+		m.drawFormatBits(mask)
+		if p := m.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		m.applyMask(mask) // XOR again to undo
+	}
+	m.applyMask(best)
+	m.drawFormatBits(best)
+	return &QRCode{Version: version, Mask: best, Size: m.size, Modules: m.modules}
+}
+
+func (m *qrMatrix) drawFunctionPatterns(version int) {
+	for i := 0; i < m.size; i++ {
+		m.setFunction(6, i, i%2 == 0)
+		m.setFunction(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their separators
+	for _, c := range [][2]int{{3, 3}, {m.size - 4, 3}, {3, m.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || y < 0 || x >= m.size || y >= m.size {
+					continue
+				}
+				dist := qrMax(qrAbs(dx), qrAbs(dy))
+				m.setFunction(x, y, dist != 2 && dist != 4)
+			}
+		}
+	}
+
+	// Alignment patterns, except where they would overlap a finder
+	if version < len(qrAlignment) {
+		pos := qrAlignment[version]
+		last := len(pos) - 1
+		for i, cy := range pos {
+			for j, cx := range pos {
+				if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+					continue
+				}
+				for dy := -2; dy <= 2; dy++ {
+					for dx := -2; dx <= 2; dx++ {
+						m.setFunction(cx+dx, cy+dy, qrMax(qrAbs(dx), qrAbs(dy)) != 1)
+					}
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas, the real bits are drawn after masking
+	m.drawFormatBits(0)
+
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>uint(i))&1 == 1
+			a, b := m.size-11+i%3, i/3
+			m.setFunction(a, b, dark)
+			m.setFunction(b, a, dark)
+		}
+	}
+}
+
+// qrFormatBits returns the 15-bit BCH coded format information of level M with mask
+func qrFormatBits(mask int) int {
+	data := 0<<3 | mask // level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (m *qrMatrix) drawFormatBits(mask int) {
+	bits := qrFormatBits(mask)
+	bit := func(i int) bool { return (bits>>uint(i))&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		m.setFunction(8, i, bit(i))
+	}
+	m.setFunction(8, 7, bit(6))
+	m.setFunction(8, 8, bit(7))
+	m.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		m.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		m.setFunction(m.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		m.setFunction(8, m.size-15+i, bit(i))
+	}
+	m.setFunction(8, m.size-8, true) // dark module
+}
+
+// drawCodewords places the codewords in the zigzag column pairs from the bottom right;
+// modules left over (remainder bits) stay light
+func (m *qrMatrix) drawCodewords(codewords []byte) {
+	i := 0
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < m.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = m.size - 1 - vert
+				}
+				if !m.function[y][x] && i < len(codewords)*8 {
+					m.modules[y][x] = (codewords[i>>3]>>uint(7-i&7))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// qrMaskBit reports whether mask inverts the module at x, y
+func qrMaskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+func (m *qrMatrix) applyMask(mask int) {
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if !m.function[y][x] && qrMaskBit(mask, x, y) {
+				m.modules[y][x] = !m.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol with the four mask evaluation rules
+func (m *qrMatrix) penalty() int {
+	score, dark := 0, 0
+	finderLike := []bool{true, false, true, true, true, false, true, false, false, false, false}
+
+	for i := 0; i < m.size; i++ {
+		row := make([]bool, m.size)
+		col := make([]bool, m.size)
+		for j := 0; j < m.size; j++ {
+			row[j], col[j] = m.modules[i][j], m.modules[j][i]
+			if row[j] {
+				dark++
+			}
+		}
+		for _, line := range [][]bool{row, col} {
+			// Rule 1: runs of five or more modules of one colour
+			run := 1
+			for j := 1; j <= len(line); j++ {
+				if j < len(line) && line[j] == line[j-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += run - 2
+				}
+				run = 1
+			}
+			// Rule 3: 1:1:3:1:1 finder-like patterns next to four light modules
+			for j := 0; j+len(finderLike) <= len(line); j++ {
+				fwd, rev := true, true
+				for k, want := range finderLike {
+					fwd = fwd && line[j+k] == want
+					rev = rev && line[j+len(finderLike)-1-k] == want
+				}
+				if fwd {
+					score += 40
+				}
+				if rev {
+					score += 40
+				}
+			}
+		}
+	}
+
+	// Rule 2: 2x2 blocks of one colour
+	for y := 0; y+1 < m.size; y++ {
+		for x := 0; x+1 < m.size; x++ {
+			c := m.modules[y][x]
+			if c == m.modules[y][x+1] && c == m.modules[y+1][x] && c == m.modules[y+1][x+1] {
+				score += 3
+			}
+		}
+	}
+
+	// Rule 4: deviation of the dark proportion from 50%
+	total := m.size * m.size
+	score += 10 * (qrAbs(dark*100/total-50) / 5)
+	return score
+}
+
+func qrAbs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func qrMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,210 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// ============ QR CODE TESTS ============
+
+func TestQRRSRemainder(t *testing.T) {
+	// "HELLO WORLD" as 1-M from the ISO/IEC 18004 worked example
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := qrRSRemainder(data, qrRSDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("qrRSRemainder() = %v, want %v", got, want)
+	}
+}
+
+func TestQRFormatBits(t *testing.T) {
+	tests := []struct {
+		mask int
+		want string
+	}{
+		{0, "101010000010010"},
+		{5, "100000011001110"},
+		{7, "100101010100000"},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("mask %d", tc.mask), func(t *testing.T) {
+			if got := fmt.Sprintf("%015b", qrFormatBits(tc.mask)); got != tc.want {
+				t.Errorf("qrFormatBits(%d) = %s, want %s", tc.mask, got, tc.want)
+			}
+		})
+	}
+}
+
+// qrDecode reads the format information, removes the mask and returns the byte mode
+// payload, checking the error correction of every block
+func qrDecode(t *testing.T, q *QRCode) []byte {
+	t.Helper()
+	if q.Size != 17+4*q.Version {
+		t.Fatalf("size %d does not match version %d", q.Size, q.Version)
+	}
+
+	bits := 0
+	for i := 14; i >= 9; i-- {
+		bits = bits<<1 | qrBit(q.Modules[8][14-i])
+	}
+	bits = bits<<1 | qrBit(q.Modules[8][7])
+	bits = bits<<1 | qrBit(q.Modules[8][8])
+	bits = bits<<1 | qrBit(q.Modules[7][8])
+	for i := 5; i >= 0; i-- {
+		bits = bits<<1 | qrBit(q.Modules[i][8])
+	}
+	mask := -1
+	for m := 0; m < 8; m++ {
+		if qrFormatBits(m) == bits {
+			mask = m
+		}
+	}
+	if mask != q.Mask {
+		t.Fatalf("format information %015b decodes to mask %d, want %d", bits, mask, q.Mask)
+	}
+
+	m := newQRMatrix(q.Version)
+	m.drawFunctionPatterns(q.Version)
+	v := qrVersionsM[q.Version]
+	total := v.dataCodewords() + v.ecPerBlock*len(v.blocks)
+	codewords := make([]byte, total)
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = q.Size - 1 - vert
+				}
+				if m.function[y][x] || i >= total*8 {
+					continue
+				}
+				if q.Modules[y][x] != qrMaskBit(mask, x, y) {
+					codewords[i>>3] |= 0x80 >> uint(i&7)
+				}
+				i++
+			}
+		}
+	}
+
+	blocks := make([][]byte, len(v.blocks))
+	pos := 0
+	for k := 0; k < v.blocks[len(v.blocks)-1]; k++ {
+		for b, n := range v.blocks {
+			if k < n {
+				blocks[b] = append(blocks[b], codewords[pos])
+				pos++
+			}
+		}
+	}
+	ecc := make([][]byte, len(v.blocks))
+	for k := 0; k < v.ecPerBlock; k++ {
+		for b := range v.blocks {
+			ecc[b] = append(ecc[b], codewords[pos])
+			pos++
+		}
+	}
+	var data []byte
+	for b := range blocks {
+		if !bytes.Equal(qrRSRemainder(blocks[b], qrRSDivisor(v.ecPerBlock)), ecc[b]) {
+			t.Fatalf("block %d error correction mismatch", b)
+		}
+		data = append(data, blocks[b]...)
+	}
+
+	if data[0]>>4 != 0x4 {
+		t.Fatalf("mode indicator %X, want byte mode", data[0]>>4)
+	}
+	if q.Version >= 10 {
+		t.Fatalf("16-bit character count not handled by the test decoder")
+	}
+	n := int(data[0]&0x0F)<<4 | int(data[1]>>4)
+	out := make([]byte, n)
+	for k := range out {
+		out[k] = data[1+k]<<4 | data[2+k]>>4
+	}
+	return out
+}
+
+func qrBit(dark bool) int {
+	if dark {
+		return 1
+	}
+	return 0
+}
+
+func TestEncodeQR(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantVersion int
+	}{
+		{"iccid", "8988211000000012345", 2},
+		{"short", "1", 1},
+		{"version 1 full", strings.Repeat("A", 14), 1},
+		{"version 2", strings.Repeat("A", 15), 2},
+		{"two blocks", strings.Repeat("0123456789", 5), 4},
+		{"version 7 info", strings.Repeat("x", 110), 7},
+		{"mixed block sizes", strings.Repeat("y", 180), 9},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := EncodeQR([]byte(tc.data))
+			if err != nil {
+				t.Fatalf("EncodeQR() error = %v", err)
+			}
+			if q.Version != tc.wantVersion {
+				t.Errorf("version = %d, want %d", q.Version, tc.wantVersion)
+			}
+			if got := qrDecode(t, q); string(got) != tc.data {
+				t.Errorf("decoded %q, want %q", got, tc.data)
+			}
+		})
+	}
+}
+
+func TestEncodeQR_FunctionPatterns(t *testing.T) {
+	q, err := EncodeQR([]byte(strings.Repeat("x", 110)))
+	if err != nil {
+		t.Fatalf("EncodeQR() error = %v", err)
+	}
+
+	// Finder pattern rows in all three corners
+	want := []bool{true, true, true, true, true, true, true, false}
+	for _, c := range [][2]int{{0, 0}, {q.Size - 7, 0}, {0, q.Size - 7}} {
+		for k := 0; k < 7; k++ {
+			if q.Modules[c[1]][c[0]+k] != want[k] || q.Modules[c[1]+6][c[0]+k] != want[k] {
+				t.Fatalf("finder pattern at %v broken", c)
+			}
+		}
+	}
+	if !q.Modules[q.Size-8][8] {
+		t.Error("dark module missing")
+	}
+	for i := 8; i < q.Size-8; i++ {
+		if q.Modules[6][i] != (i%2 == 0) || q.Modules[i][6] != (i%2 == 0) {
+			t.Fatalf("timing pattern broken at %d", i)
+		}
+	}
+
+	// Version 7 information 000111110010010100, least significant bit first
+	version := 0
+	for i := 17; i >= 0; i-- {
+		version = version<<1 | qrBit(q.Modules[i/3][q.Size-11+i%3])
+	}
+	if version != 0x07C94 {
+		t.Errorf("version information = %018b, want 000111110010010100", version)
+	}
+}
+
+func TestEncodeQR_TooLong(t *testing.T) {
+	if _, err := EncodeQR(make([]byte, 300)); err == nil {
+		t.Error("EncodeQR() of 300 bytes succeeded")
+	}
+}
@@ -0,0 +1,172 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// Renderer decides how the Print* functions lay out tables and messages.
+// The active renderer is selected once per run with SetRenderer.
+type Renderer interface {
+	// Name returns the mode name accepted by NewRenderer
+	Name() string
+	// Colors reports whether ANSI colors are emitted
+	Colors() bool
+	// TableStyle returns the style applied to every table
+	TableStyle() table.Style
+	// RenderTable writes t to stdout
+	RenderTable(t table.Writer)
+	// Message formats a status line; kind is "error", "success" or "warning"
+	Message(kind, msg string) string
+}
+
+// Renderer mode names
+const (
+	RendererColor    = "color"
+	RendererPlain    = "plain"
+	RendererMarkdown = "md"
+)
+
+// RendererNames lists the accepted --output-format values
+var RendererNames = []string{RendererColor, RendererPlain, RendererMarkdown}
+
+// consoleRenderer is the colored console output (rounded box tables)
+type consoleRenderer struct{}
+
+func (consoleRenderer) Name() string            { return RendererColor }
+func (consoleRenderer) Colors() bool            { return true }
+func (consoleRenderer) TableStyle() table.Style { return getTableStyle() }
+func (consoleRenderer) RenderTable(t table.Writer) {
+	t.Render()
+}
+
+func (consoleRenderer) Message(kind, msg string) string {
+	switch kind {
+	case "error":
+		return colorError.Sprintf("✗ Error: %s", msg)
+	case "success":
+		return colorSuccess.Sprintf("✓ %s", msg)
+	default:
+		return colorWarn.Sprintf("⚠ %s", msg)
+	}
+}
+
+// plainRenderer emits ASCII tables without ANSI codes (logs, pipes, journald)
+type plainRenderer struct{}
+
+func (plainRenderer) Name() string { return RendererPlain }
+func (plainRenderer) Colors() bool { return false }
+func (plainRenderer) TableStyle() table.Style {
+	style := table.StyleDefault
+	style.Options.SeparateRows = false
+	return style
+}
+func (plainRenderer) RenderTable(t table.Writer) {
+	t.SetOutputMirror(nil)
+	fmt.Println(asciiReplacer.Replace(t.Render()))
+}
+
+// asciiReplacer maps the glyphs used in table cells to ASCII of the same width
+var asciiReplacer = strings.NewReplacer("✓", "+", "✗", "x", "⚠", "!", "─", "-")
+
+func (plainRenderer) Message(kind, msg string) string {
+	switch kind {
+	case "error":
+		return "[ERROR] " + msg
+	case "success":
+		return "[OK] " + msg
+	default:
+		return "[WARN] " + msg
+	}
+}
+
+// markdownRenderer emits markdown tables for pasting into wikis and tickets
+type markdownRenderer struct{}
+
+func (markdownRenderer) Name() string { return RendererMarkdown }
+func (markdownRenderer) Colors() bool { return false }
+func (markdownRenderer) TableStyle() table.Style {
+	return table.StyleDefault
+}
+func (markdownRenderer) RenderTable(t table.Writer) {
+	t.RenderMarkdown()
+}
+
+func (markdownRenderer) Message(kind, msg string) string {
+	switch kind {
+	case "error":
+		return "**Error:** " + msg
+	case "warning":
+		return "> " + msg
+	default:
+		return msg
+	}
+}
+
+// active is the renderer used by the Print* functions
+var active Renderer = consoleRenderer{}
+
+// NewRenderer returns the renderer for a mode name (see RendererNames)
+func NewRenderer(name string) (Renderer, error) {
+	switch strings.ToLower(name) {
+	case RendererColor, "console":
+		return consoleRenderer{}, nil
+	case RendererPlain, "ascii", "text":
+		return plainRenderer{}, nil
+	case RendererMarkdown, "markdown":
+		return markdownRenderer{}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q (use %s)", name, strings.Join(RendererNames, ", "))
+}
+
+// SelectRenderer picks the renderer for the given flags: an explicit format wins,
+// otherwise noColor or a non-terminal stdout selects plain output
+func SelectRenderer(format string, noColor, tty bool) (Renderer, error) {
+	if format != "" {
+		r, err := NewRenderer(format)
+		if err != nil {
+			return nil, err
+		}
+		if noColor && r.Colors() {
+			return plainRenderer{}, nil
+		}
+		return r, nil
+	}
+	if noColor || !tty {
+		return plainRenderer{}, nil
+	}
+	return consoleRenderer{}, nil
+}
+
+// SetRenderer makes r the renderer for all further output
+func SetRenderer(r Renderer) {
+	active = r
+	if r.Colors() {
+		text.EnableColors()
+	} else {
+		text.DisableColors()
+	}
+}
+
+// CurrentRenderer returns the active renderer
+func CurrentRenderer() Renderer {
+	return active
+}
+
+// IsTerminal reports whether f is a character device (a TTY rather than a file or pipe)
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// renderTable writes t with the active renderer
+func renderTable(t table.Writer) {
+	active.RenderTable(t)
+}
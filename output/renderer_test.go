@@ -0,0 +1,91 @@
+package output
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// ============ RENDERER TESTS ============
+
+func TestSelectRenderer(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		noColor bool
+		tty     bool
+		want    string
+		wantErr bool
+	}{
+		{"terminal default", "", false, true, RendererColor, false},
+		{"redirected default", "", false, false, RendererPlain, false},
+		{"no-color on terminal", "", true, true, RendererPlain, false},
+		{"explicit color when redirected", "color", false, false, RendererColor, false},
+		{"explicit color with no-color", "color", true, true, RendererPlain, false},
+		{"markdown", "md", false, true, RendererMarkdown, false},
+		{"markdown alias", "markdown", true, false, RendererMarkdown, false},
+		{"unknown", "html", false, true, "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := SelectRenderer(tc.format, tc.noColor, tc.tty)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("SelectRenderer(%q) = %s, want error", tc.format, r.Name())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectRenderer(%q): %v", tc.format, err)
+			}
+			if r.Name() != tc.want {
+				t.Errorf("SelectRenderer(%q, %v, %v) = %s, want %s", tc.format, tc.noColor, tc.tty, r.Name(), tc.want)
+			}
+		})
+	}
+}
+
+// captureStdout returns what fn writes to os.Stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = saved
+	w.Close()
+	data, _ := io.ReadAll(r)
+	return string(data)
+}
+
+func TestPlainRendererMessages(t *testing.T) {
+	saved := CurrentRenderer()
+	defer SetRenderer(saved)
+	SetRenderer(plainRenderer{})
+
+	got := captureStdout(t, func() {
+		PrintSuccess("done")
+		PrintWarning("careful")
+		PrintError("broken")
+	})
+	want := "[OK] done\n[WARN] careful\n[ERROR] broken\n"
+	if got != want {
+		t.Errorf("plain messages = %q, want %q", got, want)
+	}
+	if strings.Contains(got, "\x1b[") {
+		t.Errorf("plain output contains ANSI codes: %q", got)
+	}
+}
+
+func TestASCIIReplacerKeepsWidth(t *testing.T) {
+	in := "│ ✓ Enabled │ ✗ │ ⚠ │ ─── USIM ───"
+	out := asciiReplacer.Replace(strings.ReplaceAll(in, "│", "|"))
+	if want := "| + Enabled | x | ! | --- USIM ---"; out != want {
+		t.Errorf("ascii = %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,283 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SummarySheet is the per-card activation summary handed out with a personalized card.
+// It is filled from the card as read back after writing, not from the requested values.
+type SummarySheet struct {
+	ICCID      string
+	IMSI       string
+	MSISDN     string
+	SPN        string
+	VoLTE      bool
+	VoWiFi     bool
+	SMSOverIP  bool
+	ADMKey     string // Printed only when set (--summary-include-secrets)
+	Generated  time.Time
+	CardSource string // Reader the card was read from
+}
+
+// SummaryRow is one label/value line of the sheet
+type SummaryRow struct {
+	Label  string
+	Value  string
+	Secret bool
+}
+
+// SummaryBadge is one service shown as a badge
+type SummaryBadge struct {
+	Name    string
+	Enabled bool
+}
+
+// Rows returns the identity lines of the sheet; empty optional values are left out
+func (s *SummarySheet) Rows() []SummaryRow {
+	rows := []SummaryRow{{Label: "ICCID", Value: s.ICCID}, {Label: "IMSI", Value: s.IMSI}}
+	if s.MSISDN != "" {
+		rows = append(rows, SummaryRow{Label: "MSISDN", Value: s.MSISDN})
+	}
+	if s.SPN != "" {
+		rows = append(rows, SummaryRow{Label: "SPN", Value: s.SPN})
+	}
+	if s.ADMKey != "" {
+		rows = append(rows, SummaryRow{Label: "ADM1", Value: s.ADMKey, Secret: true})
+	}
+	return rows
+}
+
+// Badges returns the IMS services of the card
+func (s *SummarySheet) Badges() []SummaryBadge {
+	return []SummaryBadge{
+		{Name: "VoLTE", Enabled: s.VoLTE},
+		{Name: "VoWiFi", Enabled: s.VoWiFi},
+		{Name: "SMS over IP", Enabled: s.SMSOverIP},
+	}
+}
+
+// WriteSummarySheet renders the sheet to path as HTML (.html, .htm) or PDF (.pdf).
+// Sheets with secrets are created readable by the owner only.
+func WriteSummarySheet(path string, s *SummarySheet) error {
+	var buf bytes.Buffer
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		err = RenderSummaryHTML(&buf, s)
+	case ".pdf":
+		err = RenderSummaryPDF(&buf, s)
+	default:
+		return fmt.Errorf("unsupported summary sheet format %q (use .html or .pdf)", filepath.Ext(path))
+	}
+	if err != nil {
+		return err
+	}
+
+	perm := os.FileMode(0644)
+	if s.ADMKey != "" {
+		perm = 0600
+	}
+	return os.WriteFile(path, buf.Bytes(), perm)
+}
+
+// qrSVG draws the code as an SVG path, one unit per module with a 4 module quiet zone
+func qrSVG(q *QRCode) template.HTML {
+	var path strings.Builder
+	for y, row := range q.Modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x+4, y+4)
+			}
+		}
+	}
+	n := q.Size + 8
+	return template.HTML(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="180" height="180" shape-rendering="crispEdges">`+
+		`<rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`, n, n, n, n, path.String()))
+}
+
+// RenderSummaryHTML writes the sheet as a standalone printable HTML page
+func RenderSummaryHTML(w io.Writer, s *SummarySheet) error {
+	qr, err := EncodeQR([]byte(s.ICCID))
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New("summary").Parse(summaryHTMLTemplate)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, map[string]interface{}{
+		"Sheet":  s,
+		"Rows":   s.Rows(),
+		"Badges": s.Badges(),
+		"QR":     qrSVG(qr),
+	})
+}
+
+const summaryHTMLTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>SIM Activation Summary {{.Sheet.ICCID}}</title>
+    <style>
+        @page { size: A4; margin: 20mm; }
+        body { font-family: -apple-system, 'Segoe UI', Roboto, sans-serif; color: #111; max-width: 170mm; margin: 0 auto; }
+        h1 { font-size: 22px; border-bottom: 2px solid #111; padding-bottom: 6px; }
+        .top { display: flex; justify-content: space-between; align-items: flex-start; }
+        table { border-collapse: collapse; font-size: 15px; }
+        th { text-align: left; padding: 6px 16px 6px 0; color: #555; font-weight: 600; }
+        td { font-family: monospace; font-size: 16px; padding: 6px 0; }
+        .secret td { color: #b91c1c; }
+        .badges { margin-top: 18px; }
+        .badge { display: inline-block; padding: 4px 12px; border-radius: 12px; margin-right: 8px; font-size: 13px; font-weight: 600; }
+        .on { background: #16a34a; color: #fff; }
+        .off { background: #e5e7eb; color: #6b7280; text-decoration: line-through; }
+        .meta { margin-top: 28px; color: #666; font-size: 12px; }
+        .warn { color: #b91c1c; font-weight: 600; }
+    </style>
+</head>
+<body>
+    <h1>SIM Activation Summary</h1>
+    <div class="top">
+        <table>
+            {{range .Rows}}<tr{{if .Secret}} class="secret"{{end}}><th>{{.Label}}</th><td>{{.Value}}</td></tr>
+            {{end}}
+        </table>
+        <div>{{.QR}}</div>
+    </div>
+    <div class="badges">
+        {{range .Badges}}<span class="badge {{if .Enabled}}on{{else}}off{{end}}">{{.Name}}</span>{{end}}
+    </div>
+    <div class="meta">
+        <p>Read back from the card{{if .Sheet.CardSource}} in {{.Sheet.CardSource}}{{end}} on {{.Sheet.Generated.Format "2006-01-02 15:04:05"}}</p>
+        {{if .Sheet.ADMKey}}<p class="warn">Contains the ADM key: store this sheet securely.</p>{{end}}
+    </div>
+</body>
+</html>
+`
+
+// pdfText escapes s for a PDF literal string; characters outside printable ASCII become '?'
+func pdfText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7E:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// summaryPDFContent returns the page content stream (A4, origin bottom left)
+func summaryPDFContent(s *SummarySheet, qr *QRCode) string {
+	var c strings.Builder
+	text := func(font string, size, x, y float64, str string) {
+		fmt.Fprintf(&c, "BT /%s %.0f Tf %.1f %.1f Td (%s) Tj ET\n", font, size, x, y, pdfText(str))
+	}
+
+	text("F2", 20, 50, 780, "SIM Activation Summary")
+	c.WriteString("0 G 1.5 w 50 770 m 545 770 l S\n")
+
+	// QR code with quiet zone in the top right corner
+	module := 160.0 / float64(qr.Size+8)
+	left, top := 545-160+4*module, 755-4*module
+	c.WriteString("0 g\n")
+	for y, row := range qr.Modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&c, "%.2f %.2f %.2f %.2f re\n", left+float64(x)*module, top-float64(y+1)*module, module, module)
+			}
+		}
+	}
+	c.WriteString("f\n")
+
+	y := 730.0
+	for _, row := range s.Rows() {
+		c.WriteString("0.33 g\n")
+		text("F2", 11, 50, y, row.Label)
+		if row.Secret {
+			c.WriteString("0.73 0.11 0.11 rg\n")
+		} else {
+			c.WriteString("0 g\n")
+		}
+		text("F3", 13, 130, y, row.Value)
+		y -= 24
+	}
+
+	y -= 16
+	x := 50.0
+	for _, badge := range s.Badges() {
+		width := 20 + 6.6*float64(len(badge.Name))
+		if badge.Enabled {
+			c.WriteString("0.09 0.64 0.29 rg\n")
+		} else {
+			c.WriteString("0.9 g\n")
+		}
+		fmt.Fprintf(&c, "%.1f %.1f %.1f 20 re f\n", x, y-6, width)
+		if badge.Enabled {
+			c.WriteString("1 g\n")
+		} else {
+			c.WriteString("0.42 g\n")
+		}
+		text("F2", 11, x+10, y, badge.Name)
+		x += width + 10
+	}
+
+	c.WriteString("0.4 g\n")
+	source := "Read back from the card"
+	if s.CardSource != "" {
+		source += " in " + s.CardSource
+	}
+	text("F1", 9, 50, y-40, source+" on "+s.Generated.Format("2006-01-02 15:04:05"))
+	if s.ADMKey != "" {
+		c.WriteString("0.73 0.11 0.11 rg\n")
+		text("F2", 9, 50, y-54, "Contains the ADM key: store this sheet securely.")
+	}
+	return c.String()
+}
+
+// RenderSummaryPDF writes the sheet as a single page PDF using the standard fonts
+func RenderSummaryPDF(w io.Writer, s *SummarySheet) error {
+	qr, err := EncodeQR([]byte(s.ICCID))
+	if err != nil {
+		return err
+	}
+	content := summaryPDFContent(s, qr)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Contents 4 0 R " +
+			"/Resources << /Font << /F1 5 0 R /F2 6 0 R /F3 7 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>",
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
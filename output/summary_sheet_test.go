@@ -0,0 +1,141 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============ SUMMARY SHEET TESTS ============
+
+func testSummarySheet() *SummarySheet {
+	return &SummarySheet{
+		ICCID:     "8988211000000012345",
+		IMSI:      "001010000012345",
+		SPN:       "Test <Net>",
+		VoLTE:     true,
+		Generated: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestSummarySheetRows(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(s *SummarySheet)
+		want   string
+	}{
+		{"no msisdn, no secrets", func(s *SummarySheet) {}, "ICCID IMSI SPN"},
+		{"with msisdn", func(s *SummarySheet) { s.MSISDN = "+15551234" }, "ICCID IMSI MSISDN SPN"},
+		{"with secrets", func(s *SummarySheet) { s.ADMKey = "3838383838383838" }, "ICCID IMSI SPN ADM1"},
+		{"no spn", func(s *SummarySheet) { s.SPN = "" }, "ICCID IMSI"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := testSummarySheet()
+			tc.modify(s)
+			var labels []string
+			for _, r := range s.Rows() {
+				labels = append(labels, r.Label)
+				if r.Secret != (r.Label == "ADM1") {
+					t.Errorf("row %s secret = %v", r.Label, r.Secret)
+				}
+			}
+			if got := strings.Join(labels, " "); got != tc.want {
+				t.Errorf("Rows() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderSummaryHTML(t *testing.T) {
+	s := testSummarySheet()
+	var buf bytes.Buffer
+	if err := RenderSummaryHTML(&buf, s); err != nil {
+		t.Fatalf("RenderSummaryHTML() error = %v", err)
+	}
+	html := buf.String()
+	for _, want := range []string{s.ICCID, s.IMSI, "Test &lt;Net&gt;", `class="badge on">VoLTE`, `class="badge off">VoWiFi`, "<svg"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML does not contain %q", want)
+		}
+	}
+	if strings.Contains(html, "ADM") {
+		t.Error("HTML mentions the ADM key without secrets")
+	}
+
+	s.ADMKey = "3838383838383838"
+	buf.Reset()
+	if err := RenderSummaryHTML(&buf, s); err != nil {
+		t.Fatalf("RenderSummaryHTML() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), s.ADMKey) {
+		t.Error("HTML with secrets does not contain the ADM key")
+	}
+}
+
+func TestRenderSummaryPDF(t *testing.T) {
+	s := testSummarySheet()
+	s.SPN = "Net (test)"
+	var buf bytes.Buffer
+	if err := RenderSummaryPDF(&buf, s); err != nil {
+		t.Fatalf("RenderSummaryPDF() error = %v", err)
+	}
+	pdf := buf.Bytes()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("not a PDF file")
+	}
+	if !bytes.Contains(pdf, []byte(`(Net \(test\))`)) {
+		t.Error("SPN not escaped in the content stream")
+	}
+
+	// Every xref entry must point at its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("startxref missing")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	entries := strings.Split(string(pdf[xref:]), "\n")[3:10]
+	for i, e := range entries {
+		off, _ := strconv.Atoi(e[:10])
+		if want := fmt.Sprintf("%d 0 obj", i+1); !bytes.HasPrefix(pdf[off:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", i+1, pdf[off:off+10])
+		}
+	}
+
+	// Stream length matches the content
+	m = regexp.MustCompile(`(?s)/Length (\d+) >>\nstream\n(.*)endstream`).FindSubmatch(pdf)
+	if n, _ := strconv.Atoi(string(m[1])); n != len(m[2]) {
+		t.Errorf("stream /Length %d, content is %d bytes", n, len(m[2]))
+	}
+}
+
+func TestWriteSummarySheet(t *testing.T) {
+	dir := t.TempDir()
+	s := testSummarySheet()
+	s.ADMKey = "3838383838383838"
+
+	for _, name := range []string{"card.html", "card.PDF"} {
+		path := filepath.Join(dir, name)
+		if err := WriteSummarySheet(path, s); err != nil {
+			t.Fatalf("WriteSummarySheet(%s) error = %v", name, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Stat() error = %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, want 0600 with secrets", name, info.Mode().Perm())
+		}
+	}
+
+	if err := WriteSummarySheet(filepath.Join(dir, "card.txt"), s); err == nil {
+		t.Error("WriteSummarySheet() accepted .txt")
+	}
+}
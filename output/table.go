@@ -10,7 +10,9 @@ import (
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
 
+	"sim_reader/card"
 	"sim_reader/sim"
+	"sim_reader/tlv"
 )
 
 // Color styles
@@ -32,7 +34,7 @@ var (
 	colorNever  = text.Colors{text.FgHiRed}
 )
 
-// getTableStyle returns the default table style
+// getTableStyle returns the colored console table style
 func getTableStyle() table.Style {
 	style := table.StyleRounded
 	style.Color.Header = colorHeader
@@ -46,7 +48,7 @@ func getTableStyle() table.Style {
 func newTable() table.Writer {
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
-	t.SetStyle(getTableStyle())
+	t.SetStyle(active.TableStyle())
 	t.Style().Options.SeparateRows = false
 	return t
 }
@@ -70,7 +72,19 @@ func PrintUSIMData(data *sim.USIMData) {
 	if data.SPN != "" {
 		t.AppendRow(table.Row{"Service Provider", data.SPN})
 	}
-	t.Render()
+	if data.PSISMSC != "" {
+		t.AppendRow(table.Row{"PSI SMSC", fmt.Sprintf("%s (%s)", data.PSISMSC, data.PSISMSCSource)})
+	}
+	if data.SMSP != nil {
+		t.AppendRow(table.Row{"SMS Parameters", data.SMSP.String()})
+	}
+	if data.Voicemail != nil {
+		t.AppendRow(table.Row{"Voicemail", data.Voicemail.String()})
+		if waiting := data.Voicemail.WaitingString(); waiting != "" {
+			t.AppendRow(table.Row{"Messages Waiting", waiting})
+		}
+	}
+	renderTable(t)
 
 	// Network info table
 	fmt.Println()
@@ -106,7 +120,29 @@ func PrintUSIMData(data *sim.USIMData) {
 	if data.HPLMNPeriod > 0 {
 		t2.AppendRow(table.Row{"HPLMN Search Period", fmt.Sprintf("%d min", data.HPLMNPeriod)})
 	}
-	t2.Render()
+	if data.NASConfig != nil {
+		t2.AppendRow(table.Row{"NAS Config (EF_NASCONFIG)", ""})
+		for _, f := range data.NASConfig.Fields() {
+			t2.AppendRow(table.Row{"  " + f.Name, f.Value})
+		}
+	}
+	if data.ACL != nil {
+		state := "disabled (EST service 3 or UST service 35 off)"
+		if data.ACL.Enabled {
+			state = "enabled"
+		}
+		t2.AppendRow(table.Row{"APN Control List (EF_ACL)", state})
+		for _, apn := range data.ACL.APNs {
+			t2.AppendRow(table.Row{"  APN", apn})
+		}
+		if data.ACL.AllowAll {
+			t2.AppendRow(table.Row{"  APN", "* (network provided APN)"})
+		}
+		if len(data.ACL.APNs) == 0 && !data.ACL.AllowAll {
+			t2.AppendRow(table.Row{"  APN", "(none)"})
+		}
+	}
+	renderTable(t2)
 
 	// Location Information
 	hasLocation := data.LOCI != nil || data.PSLOCI != nil || data.EPSLOCI != nil
@@ -146,7 +182,7 @@ func PrintUSIMData(data *sim.USIMData) {
 			tLoc.AppendRow(table.Row{"EPS/LTE (EF_EPSLOCI)", "(empty)"})
 		}
 
-		tLoc.Render()
+		renderTable(tLoc)
 	}
 
 	// PLMN tables - show only if data exists
@@ -159,15 +195,20 @@ func PrintUSIMData(data *sim.USIMData) {
 	if len(data.UserPLMN) > 0 {
 		printPLMNTable("USER PLMN (EF_PLMNwAcT, 0x6F60)", data.UserPLMN)
 	}
-	if len(data.FPLMN) > 0 {
+	if len(data.FPLMNs) > 0 {
 		fmt.Println()
 		t3 := newTable()
 		t3.SetTitle("FORBIDDEN PLMN (EF_FPLMN, 0x6F7B)")
+		t3.AppendHeader(table.Row{"#", "MCC", "MNC"})
 		t3.SetColumnConfigs([]table.ColumnConfig{
-			{Number: 1, WidthMin: 40},
+			{Number: 1, Colors: colorLabel, WidthMin: 3},
+			{Number: 2, Colors: colorValue, WidthMin: 6},
+			{Number: 3, Colors: colorValue, WidthMin: 6},
 		})
-		t3.AppendRow(table.Row{strings.Join(data.FPLMN, ", ")})
-		t3.Render()
+		for i, p := range data.FPLMNs {
+			t3.AppendRow(table.Row{i + 1, p.MCC, p.MNC})
+		}
+		renderTable(t3)
 	}
 
 	// Services status
@@ -189,7 +230,41 @@ func PrintUSIMData(data *sim.USIMData) {
 	appendServiceRow(t4, "5G NAS Config", data.HasService(104))
 	appendServiceRow(t4, "5G NSSAI", data.HasService(108))
 	appendServiceRow(t4, "SUCI Calculation", data.HasService(112))
-	t4.Render()
+	renderTable(t4)
+}
+
+// PrintISIMInstances prints every ISIM application of a multi-ISIM card
+func PrintISIMInstances(instances []sim.ISIMInstance) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("ISIM APPLICATIONS (EF_DIR)")
+	t.AppendHeader(table.Row{"#", "AID", "Label", "Status"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel},
+		{Number: 2, Colors: colorValue, WidthMin: 30},
+		{Number: 3, Colors: colorValue, WidthMin: 15},
+	})
+	for _, inst := range instances {
+		status := colorSuccess.Sprint("OK")
+		if inst.Err != nil {
+			status = colorError.Sprint(inst.Err.Error())
+		}
+		t.AppendRow(table.Row{inst.Index, inst.AID, inst.Label, status})
+	}
+	renderTable(t)
+
+	for _, inst := range instances {
+		if inst.Err != nil || inst.Data == nil {
+			continue
+		}
+		fmt.Println()
+		label := inst.Label
+		if label == "" {
+			label = inst.AID
+		}
+		PrintSuccess(fmt.Sprintf("ISIM %d: %s (--isim-index %d)", inst.Index, label, inst.Index))
+		PrintISIMData(inst.Data)
+	}
 }
 
 // PrintISIMData prints all ISIM data in a nice table format
@@ -228,7 +303,7 @@ func PrintISIMData(data *sim.ISIMData) {
 	} else {
 		t.AppendRow(table.Row{"Home Domain", colorWarn.Sprint("(not configured)")})
 	}
-	t.Render()
+	renderTable(t)
 
 	// P-CSCF Addresses
 	fmt.Println()
@@ -245,7 +320,7 @@ func PrintISIMData(data *sim.ISIMData) {
 	} else {
 		t2.AppendRow(table.Row{colorWarn.Sprint("(no P-CSCF addresses configured)")})
 	}
-	t2.Render()
+	renderTable(t2)
 
 	// ISIM Services
 	fmt.Println()
@@ -262,7 +337,7 @@ func PrintISIMData(data *sim.ISIMData) {
 	appendServiceRow(t3, "HTTP Digest", data.HasHTTPDigest())
 	appendServiceRow(t3, "SMS over IP", data.HasSMSOverIP())
 	appendServiceRow(t3, "Voice Domain Pref", data.HasVoiceDomainPreference())
-	t3.Render()
+	renderTable(t3)
 }
 
 // appendServiceRow adds a service status row with colored status
@@ -292,11 +367,12 @@ func printPLMNTable(title string, plmns []sim.PLMNwACT) {
 		}
 		t.AppendRow(table.Row{p.MCC, p.MNC, techs})
 	}
-	t.Render()
+	renderTable(t)
 }
 
-// PrintServiceTable prints a detailed service table
-func PrintServiceTable(title string, services map[int]bool, names map[int]string) {
+// PrintServiceTable prints a detailed service table; enabled services listed in
+// missing are flagged with the files they need that are absent on the card
+func PrintServiceTable(title, serviceTable string, services map[int]bool, missing map[int][]string) {
 	fmt.Println()
 	t := newTable()
 	t.SetTitle(title)
@@ -316,30 +392,78 @@ func PrintServiceTable(title string, services map[int]bool, names map[int]string
 
 	for _, num := range nums {
 		enabled := services[num]
-		name := names[num]
-		if name == "" {
-			name = "Unknown"
-		}
+		name := sim.ServiceName(serviceTable, num)
 
 		status := colorError.Sprint("✗")
 		if enabled {
 			status = colorSuccess.Sprint("✓")
 		}
+		if files := missing[num]; enabled && len(files) > 0 {
+			status = colorWarn.Sprintf("✓ %s absent", strings.Join(files, ", "))
+		}
 
 		t.AppendRow(table.Row{num, name, status})
 	}
-	t.Render()
+	renderTable(t)
 }
 
-// PrintAllServices prints complete UST/IST service tables
+// PrintAllServices prints complete UST/EST/IST service tables
 func PrintAllServices(usimData *sim.USIMData, isimData *sim.ISIMData) {
 	if usimData != nil && len(usimData.UST) > 0 {
-		PrintServiceTable("USIM SERVICE TABLE (UST)", usimData.UST, sim.USTServices)
+		PrintServiceTable("USIM SERVICE TABLE (UST)", "UST", usimData.UST, usimData.MissingServiceFiles())
+	}
+
+	// EST: the named services, plus any other bit that is set
+	if usimData != nil && len(usimData.EST) > 0 {
+		est := make(map[int]bool)
+		for num, enabled := range usimData.EST {
+			if _, named := sim.ESTServices[num]; named || enabled {
+				est[num] = enabled
+			}
+		}
+		PrintServiceTable("USIM ENABLED SERVICES TABLE (EST)", "EST", est, nil)
 	}
 
 	if isimData != nil && isimData.Available && len(isimData.IST) > 0 {
-		PrintServiceTable("ISIM SERVICE TABLE (IST)", isimData.IST, sim.ISTServices)
+		PrintServiceTable("ISIM SERVICE TABLE (IST)", "IST", isimData.IST, isimData.MissingServiceFiles())
+	}
+}
+
+// PrintServiceMatrix prints the service matrix of a card batch; rows that differ across
+// the batch are marked in the first column
+func PrintServiceMatrix(m *sim.ServiceMatrix) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle(fmt.Sprintf("SERVICE MATRIX (%d cards, %d differing services)", len(m.Cards), m.Differing()))
+	header := table.Row{"", "Table", "#", "Service Name"}
+	for _, card := range m.Cards {
+		header = append(header, card)
 	}
+	t.AppendHeader(header)
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 3, Colors: colorValue, Align: text.AlignRight},
+		{Number: 4, Colors: colorLabel},
+	})
+
+	for _, row := range m.Rows {
+		mark := ""
+		if row.Differs {
+			mark = colorWarn.Sprint("⚠")
+		}
+		r := table.Row{mark, row.Table, row.Number, row.Name}
+		for _, state := range row.States {
+			switch state {
+			case sim.ServiceEnabled:
+				r = append(r, colorSuccess.Sprint("✓"))
+			case sim.ServiceDisabled:
+				r = append(r, colorError.Sprint("✗"))
+			default:
+				r = append(r, "-")
+			}
+		}
+		t.AppendRow(r)
+	}
+	renderTable(t)
 }
 
 // PrintReaderInfo prints reader and card info
@@ -353,7 +477,33 @@ func PrintReaderInfo(readerName, atr string) {
 	})
 	t.AppendRow(table.Row{"Reader", readerName})
 	t.AppendRow(table.Row{"ATR", atr})
-	t.Render()
+	renderTable(t)
+}
+
+// PrintWizardCardInfo prints what the provisioning wizard detected on the card
+func PrintWizardCardInfo(iccid, imsi, model string, hasISIM bool) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("DETECTED CARD")
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 15},
+		{Number: 2, Colors: colorValue, WidthMin: 50},
+	})
+	orNone := func(s string) string {
+		if s == "" {
+			return colorWarn.Sprint("(not set)")
+		}
+		return s
+	}
+	isim := colorWarn.Sprint("not present")
+	if hasISIM {
+		isim = colorSuccess.Sprint("present")
+	}
+	t.AppendRow(table.Row{"Card model", model})
+	t.AppendRow(table.Row{"ICCID", orNone(iccid)})
+	t.AppendRow(table.Row{"IMSI", orNone(imsi)})
+	t.AppendRow(table.Row{"ISIM", isim})
+	renderTable(t)
 }
 
 // PrintReaderList prints available readers
@@ -373,18 +523,195 @@ func PrintReaderList(readers []string) {
 			t.AppendRow(table.Row{fmt.Sprintf("[%d]", i), r})
 		}
 	}
-	t.Render()
+	renderTable(t)
+}
+
+// PrintSelfTestReport prints the reader health check results and verdict
+func PrintSelfTestReport(report *card.SelfTestReport) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("READER SELF-TEST")
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 22},
+		{Number: 2, Colors: colorValue, WidthMin: 40, WidthMax: 70},
+	})
+
+	t.AppendRow(table.Row{"Reader", report.Reader})
+	t.AppendRow(table.Row{"ATR", report.ATR})
+	t.AppendSeparator()
+	t.AppendRow(table.Row{"Connect cycles", fmt.Sprintf("%d (failed: %d, ATR changed: %d)",
+		report.ConnectCycles, report.ConnectFailures, report.ATRMismatches)})
+	for _, atr := range report.ATRVariants {
+		t.AppendRow(table.Row{"  Other ATR", colorWarn.Sprint(atr)})
+	}
+	t.AppendRow(table.Row{"Round trips", fmt.Sprintf("%d (errors: %d)", report.RoundTrips, report.RoundTripErrors)})
+	t.AppendRow(table.Row{"Latency min/median/max", fmt.Sprintf("%.2f / %.2f / %.2f ms",
+		report.LatencyMinMs, report.LatencyMedianMs, report.LatencyMaxMs)})
+	if report.StressSkipped != "" {
+		t.AppendRow(table.Row{"READ BINARY stress", colorWarn.Sprint("skipped: " + report.StressSkipped)})
+	} else {
+		t.AppendRow(table.Row{"READ BINARY stress", fmt.Sprintf("%d reads (errors: %d, data changed: %d)",
+			report.StressReads, report.StressErrors, report.StressMismatches)})
+	}
+	for _, e := range report.Errors {
+		t.AppendRow(table.Row{"  Error", colorError.Sprint(e)})
+	}
+	renderTable(t)
+
+	fmt.Println()
+	if report.Verdict == card.SelfTestHealthy {
+		PrintSuccess("Reader is healthy")
+		return
+	}
+	PrintError("Reader is unstable")
+	for _, c := range report.Causes {
+		fmt.Printf("  - %s\n", c)
+	}
+}
+
+// PrintFuzzSelectReport prints the file map found by --fuzz-select
+func PrintFuzzSelectReport(report *sim.FuzzSelectReport) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("FUZZ SELECT")
+	t.AppendHeader(table.Row{"Directory", "FID", "SW", "Structure", "Size", "Known as"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 10},
+		{Number: 2, Colors: colorValue, WidthMin: 4},
+		{Number: 3, Colors: colorValue, WidthMin: 4},
+		{Number: 4, Colors: colorValue, WidthMin: 10},
+		{Number: 5, Colors: colorValue, WidthMin: 4},
+		{Number: 6, WidthMin: 16},
+	})
+
+	for _, tr := range report.Targets {
+		if tr.Error != "" {
+			t.AppendRow(table.Row{tr.Name, "-", "-", "", "", colorError.Sprint(tr.Error)})
+			t.AppendSeparator()
+			continue
+		}
+		for _, f := range tr.Files {
+			known := f.Known
+			if known == "" && f.SW == "9000" {
+				known = colorWarn.Sprint("undocumented")
+			}
+			size := ""
+			if f.Size > 0 {
+				size = fmt.Sprintf("%d", f.Size)
+			}
+			t.AppendRow(table.Row{tr.Name, f.FID, f.SW, f.Structure, size, known})
+		}
+		var counts []string
+		for sw, n := range tr.SWCounts {
+			counts = append(counts, fmt.Sprintf("%s: %d", sw, n))
+		}
+		sort.Strings(counts)
+		summary := fmt.Sprintf("%d FIDs probed (%s)", tr.Probed, strings.Join(counts, ", "))
+		if !tr.Complete {
+			summary = colorWarn.Sprint(summary + ", incomplete")
+		}
+		t.AppendRow(table.Row{tr.Name, "", "", "", "", summary})
+		t.AppendSeparator()
+	}
+	renderTable(t)
+
+	fmt.Println()
+	switch {
+	case report.Error != "":
+		PrintError(fmt.Sprintf("Scan stopped: %s", report.Error))
+	case report.Interrupted:
+		PrintWarning(fmt.Sprintf("Scan interrupted after %d SELECT commands", report.Selects))
+	default:
+		PrintSuccess(fmt.Sprintf("Scan complete: %d SELECT commands", report.Selects))
+	}
+}
+
+// PrintStressReport prints the iterations of --stress-loop that differed from the first read
+func PrintStressReport(report *sim.StressReport) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("STRESS LOOP")
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 22},
+		{Number: 2, Colors: colorValue, WidthMin: 40, WidthMax: 90},
+	})
+
+	t.AppendRow(table.Row{"ATR", report.ATR})
+	t.AppendRow(table.Row{"Iterations", fmt.Sprintf("%d of %d", report.Completed, report.Iterations)})
+	t.AppendRow(table.Row{"APDUs per read", report.ReferenceAPDUs})
+	t.AppendRow(table.Row{"Divergent iterations", len(report.Divergent)})
+	if len(report.Divergent) > 0 {
+		t.AppendSeparator()
+	}
+	for _, d := range report.Divergent {
+		reason := d.Reason
+		if d.Mismatches > 1 {
+			reason += fmt.Sprintf(" (+%d more)", d.Mismatches-1)
+		}
+		t.AppendRow(table.Row{fmt.Sprintf("  Iteration %d", d.Iteration), colorWarn.Sprint(reason)})
+	}
+	renderTable(t)
+
+	fmt.Println()
+	switch {
+	case report.Interrupted:
+		PrintWarning(fmt.Sprintf("Stress loop interrupted after %d iterations", report.Completed))
+	case len(report.Divergent) == 0:
+		PrintSuccess("All iterations matched the first read")
+	default:
+		PrintError(fmt.Sprintf("%d iteration(s) diverged", len(report.Divergent)))
+	}
+}
+
+// PrintEFDIRRecords prints the raw and parsed EF_DIR records and the AIDs used for USIM/ISIM
+func PrintEFDIRRecords(records []sim.EFDIRRecord, usimAID, isimAID []byte) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("EF_DIR RECORDS")
+	t.AppendHeader(table.Row{"#", "Raw", "AID", "Label", "Status"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 3},
+		{Number: 2, Colors: colorValue, WidthMin: 20, WidthMax: 48},
+		{Number: 3, Colors: colorValue, WidthMin: 20},
+		{Number: 4, Colors: colorValue, WidthMin: 8},
+		{Number: 5, WidthMin: 12, WidthMax: 40},
+	})
+
+	if len(records) == 0 {
+		t.AppendRow(table.Row{"-", colorWarn.Sprint("No EF_DIR records"), "", "", ""})
+	}
+	for _, r := range records {
+		var status string
+		switch {
+		case r.Empty:
+			status = colorValue.Sprint("empty")
+		case r.Issue != "":
+			status = colorError.Sprint("✗ " + r.Issue)
+		case r.Used != "":
+			status = colorSuccess.Sprint("✓ used as " + r.Used)
+		default:
+			status = colorSuccess.Sprint("✓ " + r.Type)
+		}
+		t.AppendRow(table.Row{r.Record, r.Raw, r.AID, r.Label, status})
+	}
+	renderTable(t)
+
+	fmt.Println()
+	fmt.Printf("%s %X\n", colorLabel.Sprint("USIM AID in use:"), usimAID)
+	fmt.Printf("%s %X\n", colorLabel.Sprint("ISIM AID in use:"), isimAID)
 }
 
-// PrintRawData prints raw hex data for debugging
-func PrintRawData(rawFiles map[string][]byte) {
+// PrintRawData prints raw hex data for debugging, with the content of files of app that
+// have a decoder
+func PrintRawData(app string, rawFiles map[string][]byte) {
 	fmt.Println()
 	t := newTable()
 	t.SetTitle("RAW FILE DATA (HEX)")
-	t.AppendHeader(table.Row{"File", "Data (hex)"})
+	t.AppendHeader(table.Row{"File", "Data (hex)", "Decoded"})
 	t.SetColumnConfigs([]table.ColumnConfig{
 		{Number: 1, Colors: colorLabel, WidthMin: 15},
 		{Number: 2, Colors: colorValue, WidthMax: 80},
+		{Number: 3, WidthMax: 60},
 	})
 
 	// Sort keys
@@ -397,9 +724,216 @@ func PrintRawData(rawFiles map[string][]byte) {
 	for _, name := range keys {
 		data := rawFiles[name]
 		hexStr := fmt.Sprintf("%X", data)
-		t.AppendRow(table.Row{name, hexStr})
+		decoded := sim.FormatDecodedFields(sim.DecodeFile(app, name, data), "\n")
+		t.AppendRow(table.Row{name, hexStr, decoded})
+	}
+	renderTable(t)
+}
+
+// PrintDecodedEF prints the interpretation of an EF content (read --decode-ef)
+func PrintDecodedEF(d *sim.DecodedEF) {
+	fmt.Println()
+	t := newTable()
+	title := d.File
+	if d.App != "" || d.FID != "" {
+		title = strings.TrimSpace(fmt.Sprintf("%s (%s %s)", d.File, d.App, d.FID))
+	}
+	t.SetTitle(title)
+	t.AppendHeader(table.Row{"Field", "Value"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 15},
+		{Number: 2, Colors: colorValue, WidthMax: 80},
+	})
+	t.AppendRow(table.Row{"Raw", d.Raw})
+	for _, f := range d.Fields {
+		value := f.Value
+		if value == "" {
+			value = "(empty)"
+		}
+		t.AppendRow(table.Row{f.Label, value})
+	}
+	renderTable(t)
+	if d.TLV != "" {
+		fmt.Println()
+		fmt.Println("BER-TLV:")
+		fmt.Print(d.TLV)
+	}
+}
+
+// PrintSecurityContexts prints the cached keys of EF_Keys, EF_KeysPS, EF_Kc and EF_KcGPRS
+func PrintSecurityContexts(contexts []sim.SecurityContext) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("SECURITY CONTEXTS (SENSITIVE)")
+	t.AppendHeader(table.Row{"File", "KSI/CKSN", "Key", "Value", "State"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 10},
+		{Number: 2, Colors: colorValue},
+		{Number: 3, Colors: colorLabel},
+		{Number: 4, Colors: colorValue, WidthMin: 32},
+	})
+
+	for _, c := range contexts {
+		switch c.Status.State {
+		case sim.EFAbsent:
+			t.AppendRow(table.Row{c.Name, "-", "", "", colorValue.Sprint("not present")})
+			continue
+		case sim.EFError:
+			t.AppendRow(table.Row{c.Name, "-", "", "", colorError.Sprint(c.Status.Err)})
+			continue
+		case sim.EFSkipped:
+			t.AppendRow(table.Row{c.Name, "-", "", "", colorValue.Sprintf("not read (UST service %d not available)", c.Status.Service)})
+			continue
+		}
+		state := colorSuccess.Sprint("valid")
+		if !c.Valid() {
+			state = colorWarn.Sprint("no key (07)")
+		}
+		ksi := fmt.Sprintf("%d (%02X)", c.Sequence(), c.KSI)
+		if c.Kc != nil {
+			t.AppendRow(table.Row{c.Name, ksi, "Kc", fmt.Sprintf("%X", c.Kc), state})
+			continue
+		}
+		t.AppendRow(table.Row{c.Name, ksi, "CK", fmt.Sprintf("%X", c.CK), state})
+		t.AppendRow(table.Row{"", "", "IK", fmt.Sprintf("%X", c.IK), ""})
+	}
+	renderTable(t)
+}
+
+// PrintKi prints the subscriber key read with --show-ki, redacted unless reveal is set
+func PrintKi(ki []byte, reveal bool) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("SUBSCRIBER KEY (SENSITIVE)")
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 10},
+		{Number: 2, Colors: colorValue, WidthMin: 32},
+	})
+	t.AppendRow(table.Row{"Ki", sim.FormatSecret(ki, reveal)})
+	if !reveal {
+		t.AppendRow(table.Row{"", colorWarn.Sprint("redacted, --reveal-secrets shows the full key")})
+	}
+	renderTable(t)
+}
+
+// PrintFiveGData prints the 5G NAS security contexts and EF_OPL5G of DF_5GS; K_AMF is
+// redacted unless reveal is set
+func PrintFiveGData(data *sim.FiveGData, reveal bool) {
+	switch data.Status.State {
+	case sim.EFAbsent:
+		fmt.Println()
+		PrintWarning("DF_5GS not present on this card")
+		return
+	case sim.EFError:
+		fmt.Println()
+		PrintWarning(fmt.Sprintf("DF_5GS: %v", data.Status.Err))
+		return
+	}
+
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("5G NAS SECURITY CONTEXT (SENSITIVE)")
+	t.AppendHeader(table.Row{"File", "ngKSI", "Field", "Value", "State"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 16},
+		{Number: 2, Colors: colorValue},
+		{Number: 3, Colors: colorLabel},
+		{Number: 4, Colors: colorValue, WidthMin: 32, WidthMax: 70},
+	})
+	for _, name := range []string{"EF_5GS3GPPNSC", "EF_5GSN3GPPNSC"} {
+		st := data.ContextStatus[name]
+		switch st.State {
+		case sim.EFAbsent:
+			t.AppendRow(table.Row{name, "-", "", "", colorValue.Sprint("not present")})
+			continue
+		case sim.EFError:
+			t.AppendRow(table.Row{name, "-", "", "", colorError.Sprint(st.Err)})
+		}
+		shown := false
+		for _, c := range data.Contexts {
+			if c.File != name {
+				continue
+			}
+			shown = true
+			label := fmt.Sprintf("%s #%d", name, c.Record)
+			if c.Err != nil {
+				t.AppendRow(table.Row{label, "-", "raw", fmt.Sprintf("%X", c.Raw), colorWarn.Sprint(c.Err)})
+				continue
+			}
+			if !c.Valid() {
+				t.AppendRow(table.Row{label, fmt.Sprintf("%02X", c.NgKSI), "", "", colorWarn.Sprint("no key (07)")})
+				continue
+			}
+			t.AppendRow(table.Row{label, fmt.Sprintf("%02X", c.NgKSI), "K_AMF", sim.FormatSecret(c.KAMF, reveal), colorSuccess.Sprint("valid")})
+			t.AppendRow(table.Row{"", "", "UL NAS COUNT", fmt.Sprintf("%d (0x%06X)", c.UplinkCount, c.UplinkCount), ""})
+			t.AppendRow(table.Row{"", "", "DL NAS COUNT", fmt.Sprintf("%d (0x%06X)", c.DownlinkCount, c.DownlinkCount), ""})
+			t.AppendRow(table.Row{"", "", "Algorithms", sim.FormatNASAlgorithms(c.Algorithms, false), ""})
+			if c.HasEPSAlgs {
+				t.AppendRow(table.Row{"", "", "EPS algorithms", sim.FormatNASAlgorithms(c.EPSAlgorithms, true), ""})
+			}
+		}
+		if !shown && st.State == sim.EFPresent {
+			t.AppendRow(table.Row{name, "-", "", "", colorValue.Sprint("empty")})
+		}
+	}
+	if !reveal {
+		t.AppendRow(table.Row{"", "", "", colorWarn.Sprint("K_AMF redacted, --reveal-secrets shows the full key"), ""})
+	}
+	renderTable(t)
+
+	fmt.Println()
+	t2 := newTable()
+	t2.SetTitle("5G OPERATOR PLMN LIST (EF_OPL5G)")
+	t2.AppendHeader(table.Row{"#", "PLMN", "TAC Range", "PNN Record"})
+	t2.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 3},
+		{Number: 2, Colors: colorValue, WidthMin: 8},
+		{Number: 3, Colors: colorValue, WidthMin: 15},
+		{Number: 4, Colors: colorValue},
+	})
+	switch {
+	case data.OPL5GStatus.State == sim.EFAbsent:
+		t2.AppendRow(table.Row{"-", colorValue.Sprint("not present"), "", ""})
+	case data.OPL5GStatus.State == sim.EFError:
+		t2.AppendRow(table.Row{"-", colorError.Sprint(data.OPL5GStatus.Err), "", ""})
+	case len(data.OPL5G) == 0:
+		t2.AppendRow(table.Row{"-", colorValue.Sprint("empty"), "", ""})
+	}
+	for _, e := range data.OPL5G {
+		if e.Err != nil {
+			t2.AppendRow(table.Row{e.Record, fmt.Sprintf("raw %X", e.Raw), colorWarn.Sprint(e.Err), ""})
+			continue
+		}
+		t2.AppendRow(table.Row{e.Record, e.MCC + "-" + e.MNC, e.TACStart + "-" + e.TACEnd, e.PNNRecord})
+	}
+	renderTable(t2)
+}
+
+// PrintKeyInvalidation prints the per-file result of --invalidate-keys
+func PrintKeyInvalidation(results []sim.KeyInvalidation) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("KEY INVALIDATION")
+	t.AppendHeader(table.Row{"File", "Status", "Detail"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 10},
+		{Number: 2, WidthMin: 12},
+		{Number: 3, Colors: colorValue, WidthMax: 70},
+	})
+
+	for _, r := range results {
+		var status string
+		switch r.Status {
+		case sim.KeysInvalidated:
+			status = colorSuccess.Sprint("✓ " + r.Status)
+		case sim.KeysDryRun, sim.KeysSkipped:
+			status = colorWarn.Sprint(r.Status)
+		default:
+			status = colorError.Sprint("✗ " + r.Status)
+		}
+		t.AppendRow(table.Row{r.Name, status, r.Detail})
 	}
-	t.Render()
+	renderTable(t)
 }
 
 // PrintCardAnalysis prints card analysis results
@@ -420,7 +954,13 @@ func PrintCardAnalysis(info *sim.CardInfo) {
 	if info.ICCID != "" {
 		t.AppendRow(table.Row{"ICCID", info.ICCID})
 	}
-	t.Render()
+	if info.GPState.Known() {
+		t.AppendRow(table.Row{"GP Life Cycle", info.GPState.String()})
+	}
+	renderTable(t)
+	if info.GPState.Blocked() {
+		PrintWarning(info.GPState.Message())
+	}
 
 	// Detailed ATR Analysis
 	if info.ATRInfo != nil {
@@ -432,10 +972,14 @@ func PrintCardAnalysis(info *sim.CardInfo) {
 			{Number: 2, Colors: colorValue, WidthMin: 55},
 		})
 
-		ta.AppendRow(table.Row{"Convention", info.ATRInfo.Convention()})
+		atr := info.ATRInfo
+		ta.AppendRow(table.Row{"TS / T0", fmt.Sprintf("%02X (%s convention) / %02X (%d historical bytes)", atr.TS, atr.Convention(), atr.T0, len(atr.HB))})
+		if ib := atr.InterfaceBytes(); ib != "" {
+			ta.AppendRow(table.Row{"Interface Bytes", ib})
+		}
 
 		protocols := []string{}
-		for _, p := range info.ATRInfo.Protocols {
+		for _, p := range atr.Protocols {
 			protocols = append(protocols, fmt.Sprintf("T=%d", p))
 		}
 		if len(protocols) == 0 {
@@ -443,19 +987,54 @@ func PrintCardAnalysis(info *sim.CardInfo) {
 		}
 		ta.AppendRow(table.Row{"Protocols", strings.Join(protocols, ", ")})
 
-		if info.ATRInfo.Fi > 0 || info.ATRInfo.Di > 0 {
-			ta.AppendRow(table.Row{"Fi / Di", fmt.Sprintf("Fi=%d, Di=%d", info.ATRInfo.Fi, info.ATRInfo.Di)})
-			ta.AppendRow(table.Row{"Baud Rate Factor", fmt.Sprintf("%d", info.ATRInfo.Fi/info.ATRInfo.Di)})
+		if atr.Fi > 0 || atr.Di > 0 {
+			ta.AppendRow(table.Row{"Fi / Di", fmt.Sprintf("Fi=%d, Di=%d (f(max)=%g MHz)", atr.Fi, atr.Di, atr.FMaxMHz)})
+			ta.AppendRow(table.Row{"Baud Rate Factor", fmt.Sprintf("%d", atr.Fi/atr.Di)})
+		}
+		ta.AppendRow(table.Row{"Baud Rate", fmt.Sprintf("default %d bps, %d bps at 3.57 MHz, max %d bps", atr.DefaultBaud, atr.BaudAtDefault, atr.MaxBaud)})
+
+		switch {
+		case atr.SpecificMode:
+			mode := fmt.Sprintf("Specific (T=%d", atr.SpecificProtocol)
+			if atr.ModeChangeable {
+				mode += ", changeable"
+			}
+			if atr.ImplicitParams {
+				mode += ", implicit parameters"
+			}
+			ta.AppendRow(table.Row{"Mode", mode + ")"})
+		default:
+			ta.AppendRow(table.Row{"Mode", "Negotiable"})
+		}
+		if atr.PPSCapable() {
+			ta.AppendRow(table.Row{"PPS", fmt.Sprintf("Possible: TA1=%02X allows up to %d bps (reader support required)", atr.TA[1], atr.MaxBaud)})
+		} else {
+			ta.AppendRow(table.Row{"PPS", "Not useful (default parameters or specific mode)"})
 		}
 
-		if info.ATRInfo.Voltage != "" {
-			ta.AppendRow(table.Row{"Voltage", info.ATRInfo.Voltage})
+		if atr.Voltage != "" {
+			ta.AppendRow(table.Row{"Voltage", atr.Voltage})
+		}
+		if atr.ClockStop != "" {
+			ta.AppendRow(table.Row{"Clock Stop", atr.ClockStop})
+		}
+		if _, ok := atr.TC[1]; ok {
+			ta.AppendRow(table.Row{"Extra Guard Time", fmt.Sprintf("%d etu", atr.ExtraGuardTime)})
+		}
+		if _, ok := atr.TC[2]; ok {
+			ta.AppendRow(table.Row{"T=0 Waiting Integer", fmt.Sprintf("%d", atr.WaitingInteger)})
+		}
+		for _, p := range atr.Protocols {
+			if p == 1 {
+				ta.AppendRow(table.Row{"T=1 Parameters", fmt.Sprintf("IFSC=%d, BWI=%d, CWI=%d", atr.IFSC, atr.BWI, atr.CWI)})
+				break
+			}
 		}
 
-		if len(info.ATRInfo.HB) > 0 {
-			hbStr := fmt.Sprintf("%X", info.ATRInfo.HB)
+		if len(atr.HB) > 0 {
+			hbStr := fmt.Sprintf("%X", atr.HB)
 			var text strings.Builder
-			for _, b := range info.ATRInfo.HB {
+			for _, b := range atr.HB {
 				if b >= 0x20 && b < 0x7F {
 					text.WriteByte(b)
 				}
@@ -464,16 +1043,36 @@ func PrintCardAnalysis(info *sim.CardInfo) {
 				hbStr += fmt.Sprintf(" (\"%s\")", text.String())
 			}
 			ta.AppendRow(table.Row{"Historical Bytes", hbStr})
+			ta.AppendRow(table.Row{"  Category", fmt.Sprintf("%02X: %s", atr.HB[0], atr.HistoricalCategory)})
+			for _, obj := range atr.HistoricalObjects {
+				ta.AppendRow(table.Row{"  " + obj.Name, fmt.Sprintf("%X", obj.Value)})
+			}
+			if atr.HB[0] == 0x00 && len(atr.StatusIndicator) > 0 {
+				ta.AppendRow(table.Row{"  Status Indicator", fmt.Sprintf("%X", atr.StatusIndicator)})
+			}
 		}
 
-		if info.ATRInfo.TCK != nil {
-			ta.AppendRow(table.Row{"Checksum (TCK)", fmt.Sprintf("%02X", *info.ATRInfo.TCK)})
+		if atr.TCK != nil || atr.TCKRequired {
+			ta.AppendRow(table.Row{"Checksum (TCK)", atr.TCKStatus()})
 		}
-		ta.Render()
+		renderTable(ta)
+	}
+
+	if info.Capabilities != nil {
+		printCardCapabilities(info.Capabilities)
 	}
 
 	// Applications found
-	if len(info.Applications) > 0 {
+	if info.DIRProbe != nil {
+		fmt.Println()
+		PrintWarning(info.DIRProbe.String())
+	}
+	if len(info.AppProbes) > 0 {
+		printAppProbes(info.AppProbes)
+		if len(info.Applications) == 0 && info.DIRProbe == nil {
+			PrintWarning("No applications found in EF_DIR (may be 2G SIM or non-standard card)")
+		}
+	} else if len(info.Applications) > 0 {
 		fmt.Println()
 		t2 := newTable()
 		t2.SetTitle("APPLICATIONS (EF_DIR)")
@@ -491,271 +1090,966 @@ func PrintCardAnalysis(info *sim.CardInfo) {
 			}
 			t2.AppendRow(table.Row{app.AID, label, app.Type})
 		}
-		t2.Render()
-	} else {
+		renderTable(t2)
+	} else if info.DIRProbe == nil {
 		PrintWarning("No applications found in EF_DIR (may be 2G SIM or non-standard card)")
 	}
 
 	// GSM 2G data if available
 	if info.GSMAvailable && info.GSMData != nil {
+		PrintGSMData(info.GSMData)
+	}
+
+	// EF_DIR records decoded as TLV
+	if len(info.RawDIR) > 0 {
 		fmt.Println()
-		t3 := newTable()
-		t3.SetTitle("GSM 2G SIM DATA")
-		t3.SetColumnConfigs([]table.ColumnConfig{
-			{Number: 1, Colors: colorLabel, WidthMin: 20},
-			{Number: 2, Colors: colorValue, WidthMin: 55},
+		PrintSuccess("EF_DIR records:")
+		fmt.Print(tlv.Dump(info.RawDIR, tlv.ContextISO, "  "))
+	}
+
+	// Operator logo instances (EF_IMG) and icon links (EF_SPNI / EF_PNNI)
+	if len(info.Images) > 0 || len(info.OperatorIcons) > 0 {
+		printOperatorLogo(info.Images, info.OperatorIcons)
+	}
+
+	// ADM keys status
+	if len(info.ADMStatus) > 0 {
+		fmt.Println()
+		t4 := newTable()
+		t4.SetTitle("ADM KEYS STATUS")
+		t4.AppendHeader(table.Row{"KEY", "EXISTS", "STATUS", "ATTEMPTS"})
+		t4.SetColumnConfigs([]table.ColumnConfig{
+			{Number: 1, Colors: colorLabel, WidthMin: 8},
+			{Number: 2, Colors: colorValue, WidthMin: 10},
+			{Number: 3, Colors: colorValue, WidthMin: 15},
+			{Number: 4, Colors: colorValue, WidthMin: 10},
 		})
 
-		if info.GSMData.IMSI != "" {
-			t3.AppendRow(table.Row{"IMSI", info.GSMData.IMSI})
-		}
-		if info.GSMData.HPLMN != "" {
-			t3.AppendRow(table.Row{"HPLMN (from IMSI)", info.GSMData.HPLMN})
-		}
-		if info.GSMData.SPN != "" {
-			t3.AppendRow(table.Row{"Service Provider", info.GSMData.SPN})
-		}
-		if info.GSMData.MSISDN != "" {
-			t3.AppendRow(table.Row{"MSISDN", info.GSMData.MSISDN})
-		}
-		if len(info.GSMData.FPLMN) > 0 {
-			t3.AppendRow(table.Row{"Forbidden PLMNs", strings.Join(info.GSMData.FPLMN, ", ")})
+		// Show in order: ADM1, ADM2, ADM3, ADM4
+		admKeys := []string{"ADM1", "ADM2", "ADM3", "ADM4"}
+		for _, key := range admKeys {
+			if status, ok := info.ADMStatus[key]; ok {
+				existsStr := "✗ No"
+				statusStr := "-"
+				attemptsStr := "-"
+
+				if status.Exists {
+					existsStr = "✓ Yes"
+					if status.Blocked {
+						statusStr = "BLOCKED"
+						attemptsStr = "0"
+					} else {
+						statusStr = "Available"
+						if status.Attempts >= 0 {
+							attemptsStr = fmt.Sprintf("%d", status.Attempts)
+						} else {
+							attemptsStr = "?"
+						}
+					}
+				}
+
+				t4.AppendRow(table.Row{key, existsStr, statusStr, attemptsStr})
+			}
+		}
+		renderTable(t4)
+
+		// Hint about multiple ADM keys
+		fmt.Println()
+		PrintSuccess("Use -adm, -adm2, -adm3, -adm4 to provide keys for different access levels")
+	}
+}
+
+// printOperatorLogo lists the image instances of EF_IMG and the icons linked from EF_SPNI / EF_PNNI
+func printOperatorLogo(images []sim.ImageInstance, icons []sim.OperatorIcon) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("OPERATOR LOGO (EF_IMG)")
+	t.AppendHeader(table.Row{"RECORD", "SIZE", "CODING", "FILE", "DATA"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 8},
+		{Number: 2, Colors: colorValue, WidthMin: 10},
+		{Number: 3, Colors: colorValue, WidthMin: 22},
+		{Number: 4, Colors: colorValue, WidthMin: 6},
+		{Number: 5, Colors: colorValue, WidthMin: 20},
+	})
+	for _, img := range images {
+		t.AppendRow(table.Row{
+			fmt.Sprintf("%d", img.Record),
+			fmt.Sprintf("%dx%d", img.Width, img.Height),
+			img.CodingName(),
+			fmt.Sprintf("%04X", img.FileID),
+			fmt.Sprintf("%d bytes at offset %d", img.Length, img.Offset),
+		})
+	}
+	for _, icon := range icons {
+		link := fmt.Sprintf("EF_IMG record %d", icon.Record)
+		if icon.URI != "" {
+			link = icon.URI
+		}
+		qualifier := "shown with the name"
+		if icon.SelfExplanatory {
+			qualifier = "self-explanatory"
+		}
+		t.AppendRow(table.Row{icon.Source, "", link, "", qualifier})
+	}
+	renderTable(t)
+}
+
+// printCardCapabilities prints channel and buffer size capabilities and the derived GP block size
+func printCardCapabilities(caps *card.CardCapabilities) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("CARD CAPABILITIES")
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 20},
+		{Number: 2, Colors: colorValue, WidthMin: 55},
+	})
+
+	channels := fmt.Sprintf("%d", caps.LogicalChannels)
+	if caps.LogicalChannels > 1 && caps.ChannelsByCard {
+		channels += " (assigned by card)"
+	}
+	t.AppendRow(table.Row{"Logical Channels", channels})
+	t.AppendRow(table.Row{"Extended Length", yesNo(caps.ExtendedLength)})
+	t.AppendRow(table.Row{"Command Chaining", yesNo(caps.CommandChaining)})
+	t.AppendRow(table.Row{"Max Command Data", fmt.Sprintf("%d bytes", caps.MaxCommandData)})
+	t.AppendRow(table.Row{"Max Response Data", fmt.Sprintf("%d bytes", caps.MaxResponseData)})
+	t.AppendRow(table.Row{"GP Block Size", fmt.Sprintf("%d bytes", caps.GPBlockSize())})
+	if caps.UMPC != nil {
+		t.AppendRow(table.Row{"EF_UMPC", fmt.Sprintf("%X (max %d mA, time ref %d, conditions %02X)",
+			caps.UMPC.Raw, caps.UMPC.MaxPowerMA, caps.UMPC.TimeReference, caps.UMPC.Conditions)})
+	}
+	source := "defaults (short APDUs)"
+	if len(caps.Sources) > 0 {
+		source = strings.Join(caps.Sources, ", ")
+	}
+	if caps.Overridden {
+		source += ", limited by --max-apdu-size"
+	}
+	t.AppendRow(table.Row{"Source", source})
+	renderTable(t)
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "✓ Yes"
+	}
+	return "✗ No"
+}
+
+// formatAccessLevel returns colored string for access level
+func formatAccessLevel(access string) string {
+	switch {
+	case access == "PIN1":
+		return colorPIN1.Sprint("PIN1")
+	case access == "ADM1":
+		return colorADM1.Sprint("ADM1")
+	case access == "ADM2":
+		return colorADM2.Sprint("ADM2")
+	case access == "ADM3":
+		return colorADM3.Sprint("ADM3")
+	case access == "ADM4":
+		return colorADM4.Sprint("ADM4")
+	case access == "Always":
+		return colorAlways.Sprint("Always")
+	case access == "Never":
+		return colorNever.Sprint("Never")
+	case strings.HasPrefix(access, "PIN"):
+		return colorPIN1.Sprint(access)
+	case strings.HasPrefix(access, "ADM"):
+		return colorADM1.Sprint(access)
+	default:
+		return access
+	}
+}
+
+// PrintFileAccessConditions prints file access requirements
+func PrintFileAccessConditions(usimAccess, isimAccess []sim.FileAccessInfo) {
+	if len(usimAccess) == 0 && len(isimAccess) == 0 {
+		return
+	}
+
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("FILE ACCESS CONDITIONS")
+	t.AppendHeader(table.Row{"FILE", "FILE ID", "READ", "WRITE"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 15},
+		{Number: 2, Colors: colorValue, WidthMin: 8},
+		{Number: 3, WidthMin: 12},
+		{Number: 4, WidthMin: 12},
+	})
+
+	// USIM files
+	if len(usimAccess) > 0 {
+		t.AppendRow(table.Row{"─── USIM ───", "", "", ""})
+		for _, fa := range usimAccess {
+			t.AppendRow(table.Row{
+				fa.FileName,
+				fa.FileID,
+				formatAccessLevel(fa.ReadAccess),
+				formatAccessLevel(fa.WriteAccess),
+			})
+		}
+	}
+
+	// ISIM files
+	if len(isimAccess) > 0 {
+		t.AppendRow(table.Row{"─── ISIM ───", "", "", ""})
+		for _, fa := range isimAccess {
+			t.AppendRow(table.Row{
+				fa.FileName,
+				fa.FileID,
+				formatAccessLevel(fa.ReadAccess),
+				formatAccessLevel(fa.WriteAccess),
+			})
+		}
+	}
+
+	renderTable(t)
+}
+
+// PrintError prints an error message
+func PrintError(msg string) {
+	fmt.Println(active.Message("error", msg))
+}
+
+// PrintSuccess prints a success message
+func PrintSuccess(msg string) {
+	fmt.Println(active.Message("success", msg))
+}
+
+// PrintWarning prints a warning message
+func PrintWarning(msg string) {
+	fmt.Println(active.Message("warning", msg))
+}
+
+// PrintPhonebook prints phonebook entries; the email and additional number columns are
+// shown when an entry has one
+func PrintPhonebook(pb *sim.Phonebook) {
+	fmt.Println()
+	var withEmail, withANR bool
+	for _, e := range pb.Entries {
+		withEmail = withEmail || len(e.Emails) > 0
+		withANR = withANR || len(e.AdditionalNumbers) > 0
+	}
+
+	t := newTable()
+	t.SetTitle(fmt.Sprintf("PHONEBOOK (%s)", pb.Location))
+	header := table.Row{"#", "Name", "Number"}
+	if withEmail {
+		header = append(header, "Email")
+	}
+	if withANR {
+		header = append(header, "Additional Numbers")
+	}
+	t.AppendHeader(header)
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 5},
+		{Number: 2, Colors: colorValue, WidthMin: 30},
+		{Number: 3, Colors: colorValue, WidthMin: 20},
+		{Number: 4, Colors: colorValue},
+		{Number: 5, Colors: colorValue},
+	})
+
+	if len(pb.Entries) == 0 {
+		t.AppendRow(table.Row{"-", "(empty)", "-"})
+	} else {
+		for _, e := range pb.Entries {
+			row := table.Row{e.Index, e.Name, e.Number}
+			if withEmail {
+				row = append(row, strings.Join(e.Emails, ", "))
+			}
+			if withANR {
+				row = append(row, strings.Join(e.AdditionalNumbers, ", "))
+			}
+			t.AppendRow(row)
+		}
+	}
+	renderTable(t)
+	fmt.Printf("\nTotal entries: %d\n", len(pb.Entries))
+}
+
+// PrintSMS prints SMS messages
+func PrintSMS(messages []sim.SMSMessage) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("SMS MESSAGES (EF_SMS)")
+	t.AppendHeader(table.Row{"#", "Status", "Number", "Text"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 5},
+		{Number: 2, Colors: colorValue, WidthMin: 10},
+		{Number: 3, Colors: colorValue, WidthMin: 15},
+		{Number: 4, Colors: colorValue, WidthMax: 50},
+	})
+
+	if len(messages) == 0 {
+		t.AppendRow(table.Row{"-", "(empty)", "-", "-"})
+	} else {
+		for _, m := range messages {
+			text := m.Text
+			if len(text) > 50 {
+				text = text[:47] + "..."
+			}
+			t.AppendRow(table.Row{m.Index, m.Status, m.Number, text})
+		}
+	}
+	renderTable(t)
+	fmt.Printf("\nTotal messages: %d\n", len(messages))
+}
+
+// PrintApplets prints GlobalPlatform applets
+func PrintApplets(applets []sim.Applet) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("GLOBALPLATFORM APPLETS")
+	t.AppendHeader(table.Row{"Type", "AID", "State", "Privileges", "Known As"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 8},
+		{Number: 2, Colors: colorValue, WidthMin: 35},
+		{Number: 3, Colors: colorValue, WidthMin: 12},
+		{Number: 4, Colors: colorValue, WidthMin: 20},
+		{Number: 5, Colors: colorLabel, WidthMin: 15},
+	})
+
+	if len(applets) == 0 {
+		t.AppendRow(table.Row{"-", "(no applets found)", "-", "-", "-"})
+	} else {
+		for _, a := range applets {
+			known := sim.IdentifyAppletByAID(a.AID)
+			if known == "" {
+				known = "-"
+			}
+			state := a.State
+			if state == "" {
+				state = "-"
+			}
+			priv := a.Privilege
+			if priv == "" {
+				priv = "-"
+			}
+			t.AppendRow(table.Row{a.Type, a.AID, state, priv, known})
+		}
+	}
+	renderTable(t)
+	fmt.Printf("\nTotal applets: %d\n", len(applets))
+}
+
+// PrintGPRegistryPlan prints the steps that make the card match a registry file
+func PrintGPRegistryPlan(plan sim.GPRegistryPlan) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("GP REGISTRY PLAN")
+	t.AppendHeader(table.Row{"#", "Step", "AID", "Detail"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 3},
+		{Number: 2, Colors: colorLabel, WidthMin: 10},
+		{Number: 3, Colors: colorValue, WidthMin: 35},
+		{Number: 4, Colors: colorValue, WidthMin: 30},
+	})
+
+	if len(plan) == 0 {
+		t.AppendRow(table.Row{"-", "-", "(card matches the registry file)", "-"})
+	}
+	n := 0
+	for _, s := range plan {
+		num := "-"
+		if s.Runs() {
+			n++
+			num = fmt.Sprintf("%d", n)
+		}
+		t.AppendRow(table.Row{num, s.Kind, s.AID, s.Detail})
+	}
+	renderTable(t)
+	fmt.Printf("\nSteps to run: %d\n", plan.Actions())
+}
+
+// PrintOTAInfo prints OTA counters per TAR and the outcome of each read mechanism
+func PrintOTAInfo(info *sim.OTAInfo) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("OTA COUNTERS")
+	t.AppendHeader(table.Row{"TAR", "Name", "Counter", "KIc", "KID", "Source"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 6},
+		{Number: 2, Colors: colorLabel, WidthMin: 10},
+		{Number: 3, Colors: colorValue, WidthMin: 10},
+		{Number: 4, Colors: colorValue, WidthMin: 12},
+		{Number: 5, Colors: colorValue, WidthMin: 12},
+		{Number: 6, Colors: colorValue, WidthMin: 15},
+	})
+
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	if len(info.Counters) == 0 {
+		t.AppendRow(table.Row{"-", "(no OTA counters exposed)", "-", "-", "-", "-"})
+	}
+	for _, c := range info.Counters {
+		t.AppendRow(table.Row{c.TAR, dash(c.Name), dash(c.Counter), dash(c.KIcVersion), dash(c.KIDVersion), c.Source})
+	}
+	renderTable(t)
+
+	fmt.Println()
+	p := newTable()
+	p.SetTitle("OTA READ MECHANISMS")
+	p.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 30},
+		{Number: 2, WidthMin: 40},
+	})
+	for _, pr := range info.Probes {
+		result := colorWarn.Sprint(pr.Result)
+		if pr.OK {
+			result = colorSuccess.Sprint(pr.Result)
+		}
+		p.AppendRow(table.Row{pr.Mechanism, result})
+	}
+	renderTable(p)
+}
+
+// PrintSQNInfo prints the SQN state of the USIM and how it was obtained
+func PrintSQNInfo(info *sim.SQNInfo) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("USIM SQN")
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 18},
+		{Number: 2, Colors: colorValue, WidthMin: 30},
+	})
+	method := "read from card file"
+	if info.Method == sim.SQNMethodAUTS {
+		method = colorWarn.Sprint("derived from AUTS (intentional resync)")
+	}
+	t.AppendRow(table.Row{"Method", method})
+	t.AppendRow(table.Row{"Source", info.Source})
+	if sc := info.Scheme; sc != nil {
+		onOff := func(v *bool) string {
+			if v != nil && *v {
+				return "on"
+			}
+			return "off"
+		}
+		if sc.INDBits != nil {
+			t.AppendRow(table.Row{"IND length", fmt.Sprintf("%d bits", *sc.INDBits)})
+		}
+		if sc.DeltaMax != nil {
+			t.AppendRow(table.Row{"Delta (max)", fmt.Sprintf("%d (check %s)", *sc.DeltaMax, onOff(sc.DeltaMaxCheck))})
+		}
+		if sc.AgeLimit != nil {
+			t.AppendRow(table.Row{"Age limit", fmt.Sprintf("%d (check %s)", *sc.AgeLimit, onOff(sc.AgeLimitCheck))})
+		}
+		t.AppendRow(table.Row{"SQN check", onOff(sc.SQNCheck)})
+	}
+	t.AppendRow(table.Row{"Highest SQN", colorSuccess.Sprint(info.HighestSQN)})
+	if info.Note != "" {
+		t.AppendRow(table.Row{"Note", info.Note})
+	}
+	renderTable(t)
+
+	if len(info.Entries) == 0 {
+		return
+	}
+	fmt.Println()
+	a := newTable()
+	a.SetTitle("SQN ARRAY")
+	a.AppendHeader(table.Row{"IND", "SQN", "SEQ", ""})
+	a.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 4},
+		{Number: 2, Colors: colorValue, WidthMin: 14},
+		{Number: 3, Colors: colorValue, WidthMin: 10},
+	})
+	for _, e := range info.Entries {
+		mark := ""
+		if e.Max {
+			mark = "highest"
+		}
+		a.AppendRow(table.Row{e.IND, e.SQN, e.SEQ, mark})
+	}
+	renderTable(a)
+}
+
+// PrintGSMData prints the DF_GSM content of a 2G SIM
+func PrintGSMData(data *sim.GSMData) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("GSM 2G SIM DATA")
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 20},
+		{Number: 2, Colors: colorValue, WidthMin: 55},
+	})
+
+	if data.IMSI != "" {
+		t.AppendRow(table.Row{"IMSI", data.IMSI})
+	}
+	if data.HPLMN != "" {
+		t.AppendRow(table.Row{"HPLMN (from IMSI)", data.HPLMN})
+	}
+	if data.SPN != "" {
+		t.AppendRow(table.Row{"Service Provider", data.SPN})
+	}
+	if data.MSISDN != "" {
+		t.AppendRow(table.Row{"MSISDN", data.MSISDN})
+	}
+	if len(data.FPLMN) > 0 {
+		t.AppendRow(table.Row{"Forbidden PLMNs", strings.Join(data.FPLMN, ", ")})
+	}
+	renderTable(t)
+
+	// Show raw IMSI if available
+	if len(data.RawIMSI) > 0 {
+		fmt.Println()
+		PrintSuccess(fmt.Sprintf("Raw IMSI: %X", data.RawIMSI))
+	}
+}
+
+// printAppProbes prints the SELECT result of the EF_DIR applications and the well-known
+// AIDs, followed by the problems found (not selectable, duplicates, label mismatches)
+func printAppProbes(probes []sim.AppProbe) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("APPLICATIONS (EF_DIR + WELL-KNOWN AIDS)")
+	t.AppendHeader(table.Row{"AID", "Label", "Type", "Source", "Selectable", "Response"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorValue, WidthMin: 30},
+		{Number: 2, Colors: colorValue, WidthMin: 12},
+		{Number: 3, Colors: colorLabel, WidthMin: 12},
+		{Number: 4, Colors: colorValue},
+		{Number: 5, WidthMin: 10},
+		{Number: 6, Colors: colorValue},
+	})
+
+	var issues []string
+	for _, p := range probes {
+		name := p.Name
+		if name == "" {
+			name = "(no label)"
+		}
+		selectable := colorError.Sprint("no")
+		if p.Selectable {
+			selectable = colorSuccess.Sprint("yes")
+		} else if p.Source == sim.AppSourceWellKnown {
+			selectable = "no"
+		}
+		var details []string
+		if p.DFName != "" && !strings.EqualFold(p.DFName, p.AID) {
+			details = append(details, "DF name "+p.DFName)
+		}
+		if p.Label != "" {
+			details = append(details, fmt.Sprintf("label %q", p.Label))
+		}
+		details = append(details, p.PINs...)
+		response := p.Status
+		if len(details) > 0 {
+			response += "; " + strings.Join(details, ", ")
+		}
+		t.AppendRow(table.Row{p.AID, name, p.Type, p.Source, selectable, response})
+		for _, issue := range p.Issues {
+			issues = append(issues, fmt.Sprintf("%s: %s", p.AID, issue))
+		}
+	}
+	renderTable(t)
+	for _, issue := range issues {
+		PrintWarning(issue)
+	}
+}
+
+// PrintBDN prints the barred dialling numbers (EF_BDN) and the BDN service state
+func PrintBDN(list *sim.BDNList) {
+	fmt.Println()
+	t := newTable()
+	state := colorWarn.Sprint("disabled")
+	switch {
+	case list.Enabled && list.Available:
+		state = colorSuccess.Sprint("enabled")
+	case !list.Available:
+		state = colorWarn.Sprint("not available (UST 6)")
+	}
+	t.SetTitle(fmt.Sprintf("BARRED DIALLING NUMBERS (EF_BDN, %d/%d used, %s)", len(list.Entries), list.Records, state))
+	t.AppendHeader(table.Row{"#", "Name", "Number"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 5},
+		{Number: 2, Colors: colorValue, WidthMin: 30},
+		{Number: 3, Colors: colorValue, WidthMin: 20},
+	})
+	if len(list.Entries) == 0 {
+		t.AppendRow(table.Row{"-", "(empty)", "-"})
+	}
+	for _, e := range list.Entries {
+		t.AppendRow(table.Row{e.Index, e.Name, e.Number})
+	}
+	renderTable(t)
+}
+
+// PrintSOR prints the steering of roaming files EF_FROMPREFERRED and EF_SOR-CMCI
+func PrintSOR(data *sim.SORData) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("STEERING OF ROAMING")
+	t.AppendHeader(table.Row{"File", "Service", "Value"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 18},
+		{Number: 2, Colors: colorValue},
+		{Number: 3, Colors: colorValue, WidthMax: 70},
+	})
+	service := func(num int, available bool) string {
+		if available {
+			return colorSuccess.Sprintf("UST %d", num)
+		}
+		return colorWarn.Sprintf("UST %d not set", num)
+	}
+	status := func(st sim.EFStatus) string {
+		if st.State == sim.EFAbsent {
+			return colorValue.Sprint("not present")
 		}
-		t3.Render()
+		return colorError.Sprint(st.Err)
+	}
 
-		// Show raw IMSI if available
-		if len(info.GSMData.RawIMSI) > 0 {
-			fmt.Println()
-			PrintSuccess(fmt.Sprintf("Raw IMSI: %X", info.GSMData.RawIMSI))
+	fromPreferred := status(data.FromPreferredStatus)
+	if data.FromPreferred != nil {
+		fromPreferred = "no"
+		if *data.FromPreferred {
+			fromPreferred = "yes"
 		}
 	}
+	t.AppendRow(table.Row{"EF_FROMPREFERRED", service(sim.UST_FROM_PREFERRED, data.FromPreferredAvailable), fromPreferred})
 
-	// Raw EF_DIR if available and raw mode
-	if len(info.RawDIR) > 0 {
-		fmt.Println()
-		PrintSuccess(fmt.Sprintf("Raw EF_DIR: %X", info.RawDIR))
+	cmciService := service(sim.UST_SOR_CMCI, data.CMCIAvailable)
+	switch {
+	case data.CMCIStatus.State != sim.EFPresent:
+		t.AppendRow(table.Row{"EF_SOR-CMCI", cmciService, status(data.CMCIStatus)})
+	case data.CMCI == nil:
+		t.AppendRow(table.Row{"EF_SOR-CMCI", cmciService, "(empty)"})
+	default:
+		t.AppendRow(table.Row{"EF_SOR-CMCI", cmciService, data.CMCI.CMCI})
+		for _, u := range data.CMCI.Unknown {
+			t.AppendRow(table.Row{"", "", fmt.Sprintf("tag %s: %s (kept on rewrite)", u.Tag, u.Value)})
+		}
 	}
+	renderTable(t)
+}
 
-	// ADM keys status
-	if len(info.ADMStatus) > 0 {
+// PrintCallInfo prints call history (EF_ICI/EF_OCI) and advice of charge (EF_ACM/ACMmax/PUCT)
+func PrintCallInfo(info *sim.CallInfo) {
+	printCalls := func(title string, calls []sim.CallRecord, incoming bool) {
 		fmt.Println()
-		t4 := newTable()
-		t4.SetTitle("ADM KEYS STATUS")
-		t4.AppendHeader(table.Row{"KEY", "EXISTS", "STATUS", "ATTEMPTS"})
-		t4.SetColumnConfigs([]table.ColumnConfig{
-			{Number: 1, Colors: colorLabel, WidthMin: 8},
-			{Number: 2, Colors: colorValue, WidthMin: 10},
+		t := newTable()
+		t.SetTitle(title)
+		header := table.Row{"#", "Name", "Number", "Time", "Duration"}
+		if incoming {
+			header = append(header, "Status")
+		}
+		t.AppendHeader(header)
+		t.SetColumnConfigs([]table.ColumnConfig{
+			{Number: 1, Colors: colorLabel, WidthMin: 5},
+			{Number: 2, Colors: colorValue, WidthMin: 15},
 			{Number: 3, Colors: colorValue, WidthMin: 15},
-			{Number: 4, Colors: colorValue, WidthMin: 10},
+			{Number: 4, Colors: colorValue, WidthMin: 25},
+			{Number: 5, Colors: colorValue, WidthMin: 10},
+			{Number: 6, Colors: colorValue, WidthMin: 12},
 		})
-
-		// Show in order: ADM1, ADM2, ADM3, ADM4
-		admKeys := []string{"ADM1", "ADM2", "ADM3", "ADM4"}
-		for _, key := range admKeys {
-			if status, ok := info.ADMStatus[key]; ok {
-				existsStr := "✗ No"
-				statusStr := "-"
-				attemptsStr := "-"
-
-				if status.Exists {
-					existsStr = "✓ Yes"
-					if status.Blocked {
-						statusStr = "BLOCKED"
-						attemptsStr = "0"
-					} else {
-						statusStr = "Available"
-						if status.Attempts >= 0 {
-							attemptsStr = fmt.Sprintf("%d", status.Attempts)
-						} else {
-							attemptsStr = "?"
-						}
-					}
-				}
-
-				t4.AppendRow(table.Row{key, existsStr, statusStr, attemptsStr})
+		if len(calls) == 0 {
+			row := table.Row{"-", "(empty)", "-", "-", "-"}
+			if incoming {
+				row = append(row, "-")
+			}
+			t.AppendRow(row)
+		}
+		for _, c := range calls {
+			row := table.Row{c.Index, c.Name, c.Number, c.Time,
+				fmt.Sprintf("%d:%02d:%02d", c.Duration/3600, c.Duration/60%60, c.Duration%60)}
+			if incoming {
+				row = append(row, c.Status)
 			}
+			t.AppendRow(row)
 		}
-		t4.Render()
+		renderTable(t)
+	}
+	printCalls("INCOMING CALLS (EF_ICI)", info.Incoming, true)
+	printCalls("OUTGOING CALLS (EF_OCI)", info.Outgoing, false)
 
-		// Hint about multiple ADM keys
-		fmt.Println()
-		PrintSuccess("Use -adm, -adm2, -adm3, -adm4 to provide keys for different access levels")
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("ADVICE OF CHARGE")
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 25},
+		{Number: 2, Colors: colorValue, WidthMin: 20},
+	})
+	units := func(v *int) string {
+		if v == nil {
+			return "(not available)"
+		}
+		return fmt.Sprintf("%d units", *v)
+	}
+	t.AppendRow(table.Row{"ACM (EF_ACM)", units(info.ACM)})
+	acmMax := units(info.ACMmax)
+	if info.ACMmax != nil && *info.ACMmax == 0 {
+		acmMax = "0 (no limit)"
 	}
+	t.AppendRow(table.Row{"ACMmax (EF_ACMmax)", acmMax})
+	if info.PricePerUnit != nil {
+		t.AppendRow(table.Row{"Price per unit (EF_PUCT)", fmt.Sprintf("%g %s", *info.PricePerUnit, info.Currency)})
+		if info.ACM != nil {
+			t.AppendRow(table.Row{"Accumulated cost", fmt.Sprintf("%g %s", float64(*info.ACM) * *info.PricePerUnit, info.Currency)})
+		}
+	} else {
+		t.AppendRow(table.Row{"Price per unit (EF_PUCT)", "(not available)"})
+	}
+	renderTable(t)
 }
 
-// formatAccessLevel returns colored string for access level
-func formatAccessLevel(access string) string {
-	switch {
-	case access == "PIN1":
-		return colorPIN1.Sprint("PIN1")
-	case access == "ADM1":
-		return colorADM1.Sprint("ADM1")
-	case access == "ADM2":
-		return colorADM2.Sprint("ADM2")
-	case access == "ADM3":
-		return colorADM3.Sprint("ADM3")
-	case access == "ADM4":
-		return colorADM4.Sprint("ADM4")
-	case access == "Always":
-		return colorAlways.Sprint("Always")
-	case access == "Never":
-		return colorNever.Sprint("Never")
-	case strings.HasPrefix(access, "PIN"):
-		return colorPIN1.Sprint(access)
-	case strings.HasPrefix(access, "ADM"):
-		return colorADM1.Sprint(access)
-	default:
-		return access
+// PrintApplyReport prints the per-item summary of a config apply
+func PrintApplyReport(report *sim.ApplyReport) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("APPLY SUMMARY")
+	t.AppendHeader(table.Row{"Item", "Status", "SW", "Detail"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 15},
+		{Number: 2, WidthMin: 18},
+		{Number: 3, Colors: colorValue, WidthMin: 4},
+		{Number: 4, Colors: colorValue, WidthMin: 30, WidthMax: 60},
+	})
+
+	for _, it := range report.Items {
+		var status string
+		switch it.Status {
+		case sim.ApplyApplied:
+			status = colorSuccess.Sprint("✓ applied")
+		case sim.ApplyUnchanged:
+			status = colorValue.Sprint("= unchanged")
+		case sim.ApplyDryRun:
+			status = colorWarn.Sprint("dry run")
+		case sim.ApplySkipped:
+			status = colorWarn.Sprint("– unsupported")
+		default:
+			status = colorError.Sprint("✗ failed")
+		}
+		sw := it.SW
+		if sw == "" {
+			sw = "-"
+		}
+		t.AppendRow(table.Row{it.Name, status, sw, it.Detail})
+	}
+	renderTable(t)
+	fmt.Printf("\nItems: %d, Applied: %d, Unchanged: %d, Failed: %d\n",
+		len(report.Items), report.Applied, report.Unchanged, report.Failed)
+	if report.DryRun > 0 {
+		fmt.Printf("Dry run: %d item(s) not written\n", report.DryRun)
+	}
+	if report.Skipped > 0 {
+		fmt.Printf("Skipped: %d item(s) not supported by the card (mark sections \"required\" to fail instead)\n", report.Skipped)
 	}
 }
 
-// PrintFileAccessConditions prints file access requirements
-func PrintFileAccessConditions(usimAccess, isimAccess []sim.FileAccessInfo) {
-	if len(usimAccess) == 0 && len(isimAccess) == 0 {
+// PrintChangeSummary prints the old and new content of every EF written in the session
+func PrintChangeSummary(changes []sim.FileChange) {
+	if len(changes) == 0 {
 		return
 	}
-
 	fmt.Println()
 	t := newTable()
-	t.SetTitle("FILE ACCESS CONDITIONS")
-	t.AppendHeader(table.Row{"FILE", "FILE ID", "READ", "WRITE"})
+	t.SetTitle("CHANGES MADE")
+	t.AppendHeader(table.Row{"File", "Before", "After", "Decoded"})
 	t.SetColumnConfigs([]table.ColumnConfig{
-		{Number: 1, Colors: colorLabel, WidthMin: 15},
-		{Number: 2, Colors: colorValue, WidthMin: 8},
-		{Number: 3, WidthMin: 12},
-		{Number: 4, WidthMin: 12},
+		{Number: 1, Colors: colorLabel, WidthMin: 18},
+		{Number: 2, Colors: colorValue, WidthMax: 40},
+		{Number: 3, Colors: colorSuccess, WidthMax: 40},
+		{Number: 4, Colors: colorValue, WidthMin: 20, WidthMax: 60},
 	})
 
-	// USIM files
-	if len(usimAccess) > 0 {
-		t.AppendRow(table.Row{"─── USIM ───", "", "", ""})
-		for _, fa := range usimAccess {
-			t.AppendRow(table.Row{
-				fa.FileName,
-				fa.FileID,
-				formatAccessLevel(fa.ReadAccess),
-				formatAccessLevel(fa.WriteAccess),
-			})
+	for _, c := range changes {
+		name := c.File
+		if c.Record > 0 {
+			name += fmt.Sprintf(" #%d", c.Record)
+		} else if c.Offset > 0 {
+			name += fmt.Sprintf(" @%d", c.Offset)
+		}
+		before := c.Before
+		if before == "" {
+			before = "(not readable)"
 		}
+		t.AppendRow(table.Row{name, before, c.After, strings.Join(c.Decoded, "\n")})
 	}
+	renderTable(t)
+	fmt.Printf("\nFiles changed: %d\n", len(changes))
+}
 
-	// ISIM files
-	if len(isimAccess) > 0 {
-		t.AppendRow(table.Row{"─── ISIM ───", "", "", ""})
-		for _, fa := range isimAccess {
-			t.AppendRow(table.Row{
-				fa.FileName,
-				fa.FileID,
-				formatAccessLevel(fa.ReadAccess),
-				formatAccessLevel(fa.WriteAccess),
-			})
+// PrintVerifyReport prints the per-field result of a config verification
+func PrintVerifyReport(report *sim.VerifyReport) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("CONFIG VERIFICATION")
+	t.AppendHeader(table.Row{"Field", "Status", "Expected", "Actual"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 15},
+		{Number: 2, WidthMin: 12},
+		{Number: 3, Colors: colorValue, WidthMin: 20, WidthMax: 50},
+		{Number: 4, Colors: colorValue, WidthMin: 20, WidthMax: 50},
+	})
+
+	for _, it := range report.Items {
+		var status string
+		actual := it.Actual
+		switch it.Status {
+		case sim.VerifyMatch:
+			status = colorSuccess.Sprint("✓ match")
+		case sim.VerifyMismatch:
+			status = colorError.Sprint("✗ mismatch")
+		case sim.VerifySkipped:
+			status = colorValue.Sprint("- skipped")
+			actual = it.Detail
+		default:
+			status = colorWarn.Sprint("? unreadable")
+			actual = it.Detail
 		}
+		if actual == "" {
+			actual = "(empty)"
+		}
+		t.AppendRow(table.Row{it.Field, status, it.Expected, actual})
+	}
+	renderTable(t)
+	fmt.Printf("\nFields: %d, Matched: %d, Mismatched: %d, Unreadable: %d, Skipped: %d\n",
+		len(report.Items), report.Matched, report.Mismatched, report.Unreadable, report.Skipped)
+	if report.OK() {
+		PrintSuccess("Card matches the config")
+	} else {
+		PrintError("Card does not match the config")
 	}
-
-	t.Render()
 }
 
-// PrintError prints an error message
-func PrintError(msg string) {
-	fmt.Println(colorError.Sprintf("✗ Error: %s", msg))
+// PrintWriteAccessReport prints the credential each planned write requires and whether
+// it was provided
+func PrintWriteAccessReport(report *sim.WriteAccessReport) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("WRITE ACCESS CHECK")
+	t.AppendHeader(table.Row{"Write", "File", "Required", "Provided"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 12},
+		{Number: 2, Colors: colorValue, WidthMin: 15},
+		{Number: 3, WidthMin: 10},
+		{Number: 4, WidthMin: 10},
+	})
+
+	for _, c := range report.Checks {
+		file := fmt.Sprintf("%s (%s)", c.File, c.FID)
+		var required, provided string
+		switch {
+		case !c.Resolved:
+			required = colorWarn.Sprint("?")
+			provided = colorWarn.Sprint("? " + c.Note)
+		case c.Credential == "":
+			required = colorError.Sprint(c.Access)
+			provided = colorError.Sprint("✗ not writable")
+		case c.Provided:
+			required = formatAccessLevel(c.Credential)
+			provided = colorSuccess.Sprint("✓ yes")
+		default:
+			required = formatAccessLevel(c.Credential)
+			provided = colorError.Sprint("✗ no")
+		}
+		t.AppendRow(table.Row{c.Item, file, required, provided})
+	}
+	renderTable(t)
 }
 
-// PrintSuccess prints a success message
-func PrintSuccess(msg string) {
-	fmt.Println(colorSuccess.Sprintf("✓ %s", msg))
+// PrintNotCopied lists the files a card copy left out and why
+func PrintNotCopied(skipped []sim.SnapshotSkip) {
+	printSkippedFiles("NOT COPIED", skipped)
 }
 
-// PrintWarning prints a warning message
-func PrintWarning(msg string) {
-	fmt.Println(colorWarn.Sprintf("⚠ %s", msg))
+// PrintNotReset lists the files a factory reset left alone and why
+func PrintNotReset(skipped []sim.SnapshotSkip) {
+	if len(skipped) == 0 {
+		return
+	}
+	printSkippedFiles("NOT RESET", skipped)
 }
 
-// PrintPhonebook prints phonebook entries
-func PrintPhonebook(entries []sim.PhonebookEntry) {
+// printSkippedFiles prints a table of files left out of a copy or reset with the reason
+func printSkippedFiles(title string, skipped []sim.SnapshotSkip) {
 	fmt.Println()
 	t := newTable()
-	t.SetTitle("PHONEBOOK (EF_ADN)")
-	t.AppendHeader(table.Row{"#", "Name", "Number"})
+	t.SetTitle(title)
+	t.AppendHeader(table.Row{"Application", "File", "Reason"})
 	t.SetColumnConfigs([]table.ColumnConfig{
-		{Number: 1, Colors: colorLabel, WidthMin: 5},
-		{Number: 2, Colors: colorValue, WidthMin: 30},
-		{Number: 3, Colors: colorValue, WidthMin: 20},
+		{Number: 1, Colors: colorLabel, WidthMin: 10},
+		{Number: 2, Colors: colorValue, WidthMin: 15},
+		{Number: 3, Colors: colorWarn, WidthMax: 60},
 	})
-
-	if len(entries) == 0 {
-		t.AppendRow(table.Row{"-", "(empty)", "-"})
-	} else {
-		for _, e := range entries {
-			t.AppendRow(table.Row{e.Index, e.Name, e.Number})
-		}
+	for _, s := range skipped {
+		t.AppendRow(table.Row{s.Application, s.Name, s.Reason})
 	}
-	t.Render()
-	fmt.Printf("\nTotal entries: %d\n", len(entries))
+	renderTable(t)
 }
 
-// PrintSMS prints SMS messages
-func PrintSMS(messages []sim.SMSMessage) {
+// PrintDryRunLog prints the state-changing commands intercepted in dry-run mode
+func PrintDryRunLog(log []card.DryRunEntry) {
 	fmt.Println()
+	if len(log) == 0 {
+		PrintSuccess("Dry run: no state-changing commands were issued")
+		return
+	}
 	t := newTable()
-	t.SetTitle("SMS MESSAGES (EF_SMS)")
-	t.AppendHeader(table.Row{"#", "Status", "Number", "Text"})
+	t.SetTitle("DRY RUN - COMMANDS NOT SENT")
+	t.AppendHeader(table.Row{"#", "Command", "Header", "Current", "Intended"})
 	t.SetColumnConfigs([]table.ColumnConfig{
-		{Number: 1, Colors: colorLabel, WidthMin: 5},
-		{Number: 2, Colors: colorValue, WidthMin: 10},
-		{Number: 3, Colors: colorValue, WidthMin: 15},
-		{Number: 4, Colors: colorValue, WidthMax: 50},
+		{Number: 1, Colors: colorLabel, WidthMin: 3},
+		{Number: 2, Colors: colorLabel, WidthMin: 15},
+		{Number: 3, Colors: colorValue, WidthMin: 10},
+		{Number: 4, Colors: colorValue, WidthMin: 20, WidthMax: 48},
+		{Number: 5, Colors: colorValue, WidthMin: 20, WidthMax: 48},
 	})
 
-	if len(messages) == 0 {
-		t.AppendRow(table.Row{"-", "(empty)", "-", "-"})
-	} else {
-		for _, m := range messages {
-			text := m.Text
-			if len(text) > 50 {
-				text = text[:47] + "..."
-			}
-			t.AppendRow(table.Row{m.Index, m.Status, m.Number, text})
+	refused := 0
+	for i, e := range log {
+		header := e.APDU
+		if len(header) > 4 {
+			header = header[:4]
+		}
+		current := "-"
+		if e.Current != nil {
+			current = fmt.Sprintf("%X", e.Current)
 		}
+		if e.Refused {
+			refused++
+			current = colorError.Sprint("refused")
+		}
+		t.AppendRow(table.Row{i + 1, e.Command, fmt.Sprintf("%X", header), current, fmt.Sprintf("%X", e.Data)})
 	}
-	t.Render()
-	fmt.Printf("\nTotal messages: %d\n", len(messages))
+	renderTable(t)
+	fmt.Printf("\nIntercepted: %d, Refused: %d\n", len(log), refused)
 }
 
-// PrintApplets prints GlobalPlatform applets
-func PrintApplets(applets []sim.Applet) {
+// PrintMetrics prints the time and APDU count of each operation (--profile), longest first.
+// Nested operations also count in the operation around them.
+func PrintMetrics(r card.MetricsReport) {
 	fmt.Println()
 	t := newTable()
-	t.SetTitle("GLOBALPLATFORM APPLETS")
-	t.AppendHeader(table.Row{"Type", "AID", "State", "Privileges", "Known As"})
+	t.SetTitle("PROFILE")
+	t.AppendHeader(table.Row{"Operation", "Calls", "APDUs", "Time (ms)", "ms/APDU"})
 	t.SetColumnConfigs([]table.ColumnConfig{
-		{Number: 1, Colors: colorLabel, WidthMin: 8},
-		{Number: 2, Colors: colorValue, WidthMin: 35},
-		{Number: 3, Colors: colorValue, WidthMin: 12},
-		{Number: 4, Colors: colorValue, WidthMin: 20},
-		{Number: 5, Colors: colorLabel, WidthMin: 15},
+		{Number: 1, Colors: colorLabel, WidthMin: 20},
+		{Number: 2, Colors: colorValue, Align: text.AlignRight},
+		{Number: 3, Colors: colorValue, Align: text.AlignRight},
+		{Number: 4, Colors: colorValue, Align: text.AlignRight},
+		{Number: 5, Colors: colorValue, Align: text.AlignRight},
 	})
-
-	if len(applets) == 0 {
-		t.AppendRow(table.Row{"-", "(no applets found)", "-", "-", "-"})
-	} else {
-		for _, a := range applets {
-			known := sim.IdentifyAppletByAID(a.AID)
-			if known == "" {
-				known = "-"
-			}
-			state := a.State
-			if state == "" {
-				state = "-"
-			}
-			priv := a.Privilege
-			if priv == "" {
-				priv = "-"
-			}
-			t.AppendRow(table.Row{a.Type, a.AID, state, priv, known})
+	perAPDU := func(ms float64, apdus int) string {
+		if apdus == 0 {
+			return "-"
 		}
+		return fmt.Sprintf("%.1f", ms/float64(apdus))
 	}
-	t.Render()
-	fmt.Printf("\nTotal applets: %d\n", len(applets))
+	for _, op := range r.Operations {
+		t.AppendRow(table.Row{op.Name, op.Calls, op.APDUs, fmt.Sprintf("%.1f", op.DurationMs), perAPDU(op.DurationMs, op.APDUs)})
+	}
+	t.AppendSeparator()
+	t.AppendRow(table.Row{"total", "", r.APDUs, fmt.Sprintf("%.1f", r.DurationMs), perAPDU(r.DurationMs, r.APDUs)})
+	renderTable(t)
 }
 
 // PrintScriptResults prints APDU script execution results
@@ -797,11 +2091,41 @@ func PrintScriptResults(results []sim.ScriptResult) {
 
 		t.AppendRow(table.Row{r.LineNum, apdu, response, r.SW, status})
 	}
-	t.Render()
+	renderTable(t)
 	fmt.Printf("\nExecuted: %d commands, Success: %d, Failed: %d\n",
 		len(results), successCount, len(results)-successCount)
 }
 
+// PrintScriptDiff prints the differences between two runs of an APDU script
+func PrintScriptDiff(diffs []sim.ScriptDiff) {
+	fmt.Println()
+	if len(diffs) == 0 {
+		fmt.Println(active.Message("success", "No differences: every line returned the same SW and data"))
+		return
+	}
+
+	t := newTable()
+	t.SetTitle("SCRIPT DIFF")
+	t.AppendHeader(table.Row{"Line", "Change", "Old", "New", "Detail"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel},
+		{Number: 2, Colors: colorWarn},
+		{Number: 3, Colors: colorValue, WidthMax: 30},
+		{Number: 4, Colors: colorValue, WidthMax: 30},
+		{Number: 5, Colors: colorValue, WidthMax: 60},
+	})
+
+	for _, d := range diffs {
+		detail := d.HexDiff
+		if detail == "" {
+			detail = d.Command
+		}
+		t.AppendRow(table.Row{fmt.Sprintf("%s:%d", d.File, d.Line), d.Kind, d.Old, d.New, detail})
+	}
+	renderTable(t)
+	fmt.Printf("\n%d difference(s)\n", len(diffs))
+}
+
 // PrintProgrammableCardInfo prints programmable card information
 func PrintProgrammableCardInfo(cardType, atr string) {
 	fmt.Println()
@@ -839,7 +2163,7 @@ func PrintProgrammableCardInfo(cardType, atr string) {
 		t.AppendRow(table.Row{"Note", "Use -prog-force to override (DANGEROUS!)"})
 	}
 	
-	t.Render()
+	renderTable(t)
 	fmt.Println()
 }
 
@@ -848,7 +2172,7 @@ func PrintProgrammableWriteWarning(dryRun bool) {
 	fmt.Println()
 	if dryRun {
 		PrintWarning("DRY RUN MODE: No data will be written")
-		PrintWarning("Remove -prog-dry-run to actually program the card")
+		PrintWarning("Remove --dry-run to actually program the card")
 	} else {
 		PrintWarning("WARNING: Programmable card operations are PERMANENT and CANNOT BE UNDONE!")
 		PrintWarning("Press Ctrl+C now if you want to cancel.")
@@ -864,6 +2188,7 @@ type TestResult struct {
 	Name     string
 	Category string
 	Passed   bool
+	Skipped  bool
 	Expected string
 	Actual   string
 	APDU     string
@@ -893,11 +2218,14 @@ func PrintTestSummary(results []TestResult) {
 	// Calculate summary
 	passed := 0
 	failed := 0
+	skipped := 0
 	byCategory := make(map[string]int)
 	var failedTests []string
 
 	for _, r := range results {
-		if r.Passed {
+		if r.Skipped {
+			skipped++
+		} else if r.Passed {
 			passed++
 		} else {
 			failed++
@@ -906,7 +2234,10 @@ func PrintTestSummary(results []TestResult) {
 		byCategory[r.Category]++
 	}
 
-	passRate := float64(passed) / float64(len(results)) * 100
+	passRate := 0.0
+	if run := len(results) - skipped; run > 0 {
+		passRate = float64(passed) / float64(run) * 100
+	}
 
 	// Summary table
 	fmt.Println()
@@ -920,8 +2251,11 @@ func PrintTestSummary(results []TestResult) {
 	t.AppendRow(table.Row{"Total Tests", len(results)})
 	t.AppendRow(table.Row{"Passed", colorSuccess.Sprintf("%d", passed)})
 	t.AppendRow(table.Row{"Failed", colorError.Sprintf("%d", failed)})
+	if skipped > 0 {
+		t.AppendRow(table.Row{"Skipped", colorWarn.Sprintf("%d", skipped)})
+	}
 	t.AppendRow(table.Row{"Pass Rate", fmt.Sprintf("%.1f%%", passRate)})
-	t.Render()
+	renderTable(t)
 
 	// By category
 	if len(byCategory) > 0 {
@@ -940,9 +2274,11 @@ func PrintTestSummary(results []TestResult) {
 		catPassed := make(map[string]int)
 		catFailed := make(map[string]int)
 		for _, r := range results {
-			if r.Passed {
+			switch {
+			case r.Skipped:
+			case r.Passed:
 				catPassed[r.Category]++
-			} else {
+			default:
 				catFailed[r.Category]++
 			}
 		}
@@ -960,7 +2296,7 @@ func PrintTestSummary(results []TestResult) {
 				t2.AppendRow(table.Row{cat, count, passedStr, failedStr})
 			}
 		}
-		t2.Render()
+		renderTable(t2)
 	}
 
 	// Failed tests
@@ -974,7 +2310,7 @@ func PrintTestSummary(results []TestResult) {
 		for _, name := range failedTests {
 			t3.AppendRow(table.Row{name})
 		}
-		t3.Render()
+		renderTable(t3)
 	}
 
 	// Detailed results
@@ -1003,7 +2339,7 @@ func PrintTestSummary(results []TestResult) {
 		}
 		t4.AppendRow(table.Row{status, r.Category, r.Name, result})
 	}
-	t4.Render()
+	renderTable(t4)
 }
 
 // PrintAuthResult prints authentication test results
@@ -1037,7 +2373,7 @@ func PrintAuthResult(result *sim.AuthResult, algorithm string) {
 		t.AppendRow(table.Row{"─── INPUT ───", ""})
 		t.AppendRow(table.Row{"RAND", result.RAND})
 		t.AppendRow(table.Row{"AUTN", result.AUTN})
-		t.Render()
+		renderTable(t)
 	} else {
 		t.AppendRow(table.Row{"─── INPUT ───", ""})
 		t.AppendRow(table.Row{"K (Subscriber Key)", result.K})
@@ -1050,7 +2386,7 @@ func PrintAuthResult(result *sim.AuthResult, algorithm string) {
 			t.AppendRow(table.Row{"SQN", result.SQN})
 			t.AppendRow(table.Row{"AMF", result.AMF})
 		}
-		t.Render()
+		renderTable(t)
 	}
 
 	// Handle card-only mode
@@ -1058,7 +2394,7 @@ func PrintAuthResult(result *sim.AuthResult, algorithm string) {
 		// Card response
 		fmt.Println()
 		t2 := newTable()
-		t2.SetTitle("SIM CARD RESPONSE")
+		t2.SetTitle(authResponseTitle(result))
 		t2.SetColumnConfigs([]table.ColumnConfig{
 			{Number: 1, Colors: colorLabel, WidthMin: 20},
 			{Number: 2, Colors: colorValue, WidthMin: 70},
@@ -1076,8 +2412,12 @@ func PrintAuthResult(result *sim.AuthResult, algorithm string) {
 			if result.CardIK != "" {
 				t2.AppendRow(table.Row{"IK", result.CardIK})
 			}
+			if result.CardKc != "" {
+				t2.AppendRow(table.Row{"Kc", result.CardKc})
+			}
 		}
-		t2.Render()
+		appendAuthUnrecognized(t2, result.Unrecognized)
+		renderTable(t2)
 
 		if result.Error != "" {
 			fmt.Println()
@@ -1108,7 +2448,7 @@ func PrintAuthResult(result *sim.AuthResult, algorithm string) {
 		if result.IK != "" {
 			t2.AppendRow(table.Row{"IK (f4)", result.IK})
 		}
-		t2.Render()
+		renderTable(t2)
 
 		fmt.Println()
 		nextSQN := sim.IncrementSQNHex(result.SQNms)
@@ -1137,13 +2477,13 @@ func PrintAuthResult(result *sim.AuthResult, algorithm string) {
 		} else {
 			t2.AppendRow(table.Row{"AUTN", result.AUTN})
 		}
-		t2.Render()
+		renderTable(t2)
 
 		// Card response (if available)
 		if result.RES != "" || result.SyncFail {
 			fmt.Println()
 			t3 := newTable()
-			t3.SetTitle("SIM CARD RESPONSE")
+			t3.SetTitle(authResponseTitle(result))
 			t3.SetColumnConfigs([]table.ColumnConfig{
 				{Number: 1, Colors: colorLabel, WidthMin: 20},
 				{Number: 2, Colors: colorValue, WidthMin: 70},
@@ -1169,6 +2509,9 @@ func PrintAuthResult(result *sim.AuthResult, algorithm string) {
 				if result.CardIK != "" {
 					t3.AppendRow(table.Row{"IK (Card)", result.CardIK})
 				}
+				if result.CardKc != "" {
+					t3.AppendRow(table.Row{"Kc (Card)", result.CardKc})
+				}
 
 				// Verification
 				if result.RESMatch {
@@ -1177,7 +2520,8 @@ func PrintAuthResult(result *sim.AuthResult, algorithm string) {
 					t3.AppendRow(table.Row{"RES Match", colorError.Sprint("✗ RES != XRES (Authentication FAILED)")})
 				}
 			}
-			t3.Render()
+			appendAuthUnrecognized(t3, result.Unrecognized)
+			renderTable(t3)
 		}
 	}
 
@@ -1200,7 +2544,10 @@ func PrintAuthResult(result *sim.AuthResult, algorithm string) {
 		if result.KASME != "" {
 			t4.AppendRow(table.Row{"KASME (LTE)", result.KASME})
 		} else {
-			t4.AppendRow(table.Row{"KASME (LTE)", colorWarn.Sprint("(use -auth-mcc and -auth-mnc to compute)")})
+			t4.AppendRow(table.Row{"KASME (LTE)", colorWarn.Sprint("(use --mcc and --mnc to compute)")})
+		}
+		if result.Ks != "" {
+			t4.AppendRow(table.Row{"Ks (GBA, CK||IK)", result.Ks})
 		}
 
 		// 2G Triplets
@@ -1209,6 +2556,70 @@ func PrintAuthResult(result *sim.AuthResult, algorithm string) {
 			t4.AppendRow(table.Row{"SRES", result.SRES})
 			t4.AppendRow(table.Row{"Kc", result.Kc})
 		}
-		t4.Render()
+		renderTable(t4)
+	}
+}
+
+// authResponseTitle names the card response table after the AUTHENTICATE context
+func authResponseTitle(result *sim.AuthResult) string {
+	if result.Context == string(sim.AuthContextGBA) {
+		return "SIM CARD RESPONSE (GBA bootstrapping)"
+	}
+	return "SIM CARD RESPONSE"
+}
+
+// appendAuthUnrecognized lists response data the decoder did not recognize
+func appendAuthUnrecognized(t table.Writer, unrecognized []string) {
+	for _, u := range unrecognized {
+		t.AppendRow(table.Row{"Unrecognized", colorWarn.Sprint(u)})
+	}
+}
+
+// PrintUsageStats prints the record usage of the import targets and the EF sizes of the card
+func PrintUsageStats(stats *sim.UsageStats) {
+	fmt.Println()
+	t := newTable()
+	t.SetTitle("RECORD USAGE")
+	t.AppendHeader(table.Row{"File", "Location", "Record Size", "Records", "Used", "Free"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 14},
+		{Number: 2, Colors: colorValue, WidthMin: 10},
+		{Number: 3, Colors: colorValue, Align: text.AlignRight},
+		{Number: 4, Colors: colorValue, Align: text.AlignRight},
+		{Number: 5, Colors: colorValue, Align: text.AlignRight},
+		{Number: 6, Align: text.AlignRight},
+	})
+	if len(stats.Records) == 0 {
+		t.AppendRow(table.Row{"-", colorWarn.Sprint("No record files found"), "", "", "", ""})
+	}
+	for _, u := range stats.Records {
+		free := colorSuccess.Sprint(u.Free)
+		if u.Free == 0 {
+			free = colorError.Sprint(u.Free)
+		}
+		t.AppendRow(table.Row{u.Name, fmt.Sprintf("%s/%s", u.Location, u.FID), u.RecordSize, u.Records, u.Used, free})
+	}
+	renderTable(t)
+
+	fmt.Println()
+	t2 := newTable()
+	t2.SetTitle("EF SIZES (FCP)")
+	t2.AppendHeader(table.Row{"Application", "File", "FID", "Structure", "Size", "Records"})
+	t2.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Colors: colorLabel, WidthMin: 8},
+		{Number: 2, Colors: colorValue, WidthMin: 14},
+		{Number: 3, Colors: colorValue},
+		{Number: 4, Colors: colorValue},
+		{Number: 5, Colors: colorValue, Align: text.AlignRight},
+		{Number: 6, Colors: colorValue, Align: text.AlignRight},
+	})
+	for _, f := range stats.Files {
+		records := ""
+		if f.RecordSize > 0 {
+			records = fmt.Sprintf("%d x %d", f.Records, f.RecordSize)
+		}
+		t2.AppendRow(table.Row{f.Application, f.Name, f.FID, f.Structure, f.Size, records})
 	}
+	t2.AppendRow(table.Row{"", colorLabel.Sprint("Total"), "", "", stats.TotalBytes, ""})
+	renderTable(t2)
 }
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"encoding/json"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// clientHandler implements a method that does not run on a session
+type clientHandler func(c *client, params json.RawMessage) (any, error)
+
+// sessionHandler implements a method queued on the session named in the params
+type sessionHandler func(sess *session, params json.RawMessage) (any, error)
+
+var clientMethods = map[string]clientHandler{
+	"readers.list":  listReaders,
+	"session.open":  openSession,
+	"session.close": closeSession,
+}
+
+var sessionMethods = map[string]sessionHandler{
+	"usim.read":    readUSIM,
+	"isim.read":    readISIM,
+	"config.apply": applyConfig,
+	"auth.run":     runAuth,
+	"trace.get":    getTrace,
+}
+
+// decodeParams decodes the params object into v
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+// ReadersResult is the result of readers.list
+type ReadersResult struct {
+	Readers []string `json:"readers"`
+}
+
+func listReaders(c *client, params json.RawMessage) (any, error) {
+	readers, err := c.server.cfg.Readers()
+	if err != nil {
+		return nil, err
+	}
+	if readers == nil {
+		readers = []string{}
+	}
+	return ReadersResult{Readers: readers}, nil
+}
+
+// OpenParams are the params of session.open
+type OpenParams struct {
+	Reader int    `json:"reader"`
+	PIN    string `json:"pin,omitempty"`
+	ADM    string `json:"adm,omitempty"` // ADM1, verified once for the session
+}
+
+// OpenResult is the result of session.open
+type OpenResult struct {
+	Session string `json:"session"`
+	Reader  string `json:"reader"`
+	ATR     string `json:"atr"`
+}
+
+func openSession(c *client, params json.RawMessage) (any, error) {
+	var p OpenParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess, err := c.server.openSession(c, p.Reader, p.PIN, p.ADM)
+	if err != nil {
+		return nil, err
+	}
+	return OpenResult{Session: sess.id, Reader: sess.reader.Name(), ATR: sess.reader.ATRHex()}, nil
+}
+
+// CloseResult is the result of session.close
+type CloseResult struct {
+	Closed bool `json:"closed"`
+}
+
+func closeSession(c *client, params json.RawMessage) (any, error) {
+	sess, err := c.server.ownedSession(c, params)
+	if err != nil {
+		return nil, err
+	}
+	c.server.closeSession(sess)
+	return CloseResult{Closed: true}, nil
+}
+
+// readUSIM returns the USIM in the format of read --json
+func readUSIM(sess *session, params json.RawMessage) (any, error) {
+	usim, err := sim.ReadUSIM(sess.reader)
+	if err != nil {
+		return nil, err
+	}
+	return sim.ExportToConfig(usim, nil), nil
+}
+
+// readISIM returns the ISIM in the format of read --json
+func readISIM(sess *session, params json.RawMessage) (any, error) {
+	isim, err := sim.ReadISIM(sess.reader)
+	if err != nil {
+		return nil, err
+	}
+	return sim.ExportToConfig(nil, isim), nil
+}
+
+// ApplyParams are the params of config.apply
+type ApplyParams struct {
+	Config json.RawMessage `json:"config"` // same format as write -f
+	DryRun bool            `json:"dry_run,omitempty"`
+	Force  bool            `json:"force,omitempty"`
+}
+
+func applyConfig(sess *session, params json.RawMessage) (any, error) {
+	var p ApplyParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.Config) == 0 {
+		return nil, &Error{Code: CodeInvalidParams, Message: "missing config"}
+	}
+	config, err := sim.ParseConfig(p.Config)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: "invalid config: " + err.Error()}
+	}
+	if err := config.ValidateKDerivation(); err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	return sim.ApplyConfig(sess.reader, config, p.DryRun, p.Force)
+}
+
+// AuthParams are the params of auth.run (see the auth command for the meaning)
+type AuthParams struct {
+	K         string `json:"k"`
+	OP        string `json:"op,omitempty"`
+	OPc       string `json:"opc,omitempty"`
+	SQN       string `json:"sqn,omitempty"`
+	AMF       string `json:"amf,omitempty"`
+	RAND      string `json:"rand,omitempty"`
+	AUTN      string `json:"autn,omitempty"`
+	AUTS      string `json:"auts,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Context   string `json:"context,omitempty"`
+	MCC       int    `json:"mcc,omitempty"`
+	MNC       int    `json:"mnc,omitempty"`
+}
+
+func runAuth(sess *session, params json.RawMessage) (any, error) {
+	p := AuthParams{SQN: "000000000000", AMF: "8000", Algorithm: "milenage", Context: "3g"}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	cfg, err := sim.ParseAuthConfig(p.K, p.OP, p.OPc, p.SQN, p.AMF, p.RAND, p.AUTN, p.AUTS, p.Algorithm, p.MCC, p.MNC)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	if cfg.Context, err = sim.ParseAuthContext(p.Context); err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	return sim.RunAuthentication(sess.reader, cfg)
+}
+
+// TraceParams are the params of trace.get
+type TraceParams struct {
+	Clear bool `json:"clear,omitempty"` // forget the returned exchanges
+}
+
+// TraceResult is the result of trace.get
+type TraceResult struct {
+	Exchanges []card.APDUExchange `json:"exchanges"`
+}
+
+func getTrace(sess *session, params json.RawMessage) (any, error) {
+	var p TraceParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	result := TraceResult{Exchanges: append([]card.APDUExchange{}, sess.trace...)}
+	if p.Clear {
+		sess.trace = nil
+	}
+	return result, nil
+}
@@ -0,0 +1,289 @@
+// Package server exposes card sessions over JSON-RPC 2.0 on a local socket, so that
+// frontends keep one card connection open instead of running the CLI per operation.
+//
+// Messages are JSON objects sent back to back on the stream (one per line is fine).
+// A session holds one reader; its operations run one at a time in the order received.
+// Card operations of different sessions are serialized too, because the sim package
+// keeps the detected applications and the command class in package state.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"sim_reader/card"
+)
+
+// DefaultIdleTimeout releases the reader of a session without requests for this long
+const DefaultIdleTimeout = 5 * time.Minute
+
+// maxQueued is the number of operations a session accepts while one is running
+const maxQueued = 32
+
+// Config connects the server to the reader backend
+type Config struct {
+	// Open connects to the reader at index and prepares the card (driver, command class)
+	Open func(index int) (*card.Reader, error)
+	// Readers lists the reader names; the index is the one passed to Open
+	Readers func() ([]string, error)
+	// IdleTimeout releases a session after this long without requests (0 = DefaultIdleTimeout)
+	IdleTimeout time.Duration
+	// KeepAlive sends a STATUS to the card of a session after this long without commands,
+	// for readers that power an idle card down (0 = no keep-alive)
+	KeepAlive time.Duration
+}
+
+// Server serves JSON-RPC clients on one or more listeners
+type Server struct {
+	cfg Config
+
+	mu        sync.Mutex
+	sessions  map[string]*session
+	listeners []net.Listener
+	clients   map[*client]bool
+	closed    bool
+	wg        sync.WaitGroup
+
+	// cardMu serializes card operations of all sessions; active owns the sim package state
+	cardMu sync.Mutex
+	active *session
+}
+
+// New creates a server
+func New(cfg Config) *Server {
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+	return &Server{
+		cfg:      cfg,
+		sessions: map[string]*session{},
+		clients:  map[*client]bool{},
+	}
+}
+
+// Serve accepts clients on l until Close is called
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("server closed")
+	}
+	s.listeners = append(s.listeners, l)
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		c := &client{server: s, conn: conn}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.clients[c] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+		}()
+	}
+}
+
+// Close stops the listeners, disconnects the clients and releases all readers
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// Sessions returns the number of open sessions
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// JSON-RPC error codes; -32000 and below are defined by this server
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeCardError      = -32000 // the card or reader refused the operation
+	CodeUnknownSession = -32001 // session closed, expired or opened by another client
+	CodeSessionBusy    = -32002 // too many operations queued
+)
+
+// Error is a JSON-RPC error object
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// request is a JSON-RPC request or notification (no id)
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// response is a JSON-RPC response
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// notification is sent by the server without a request (e.g. session.expired)
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// client is one connection; sessions it opens are released when it disconnects
+type client struct {
+	server *Server
+	conn   net.Conn
+
+	wmu     sync.Mutex // one message at a time on the stream
+	pending sync.WaitGroup
+}
+
+// serve reads requests until the client disconnects, then releases its sessions
+func (c *client) serve() {
+	s := c.server
+	defer func() {
+		c.pending.Wait()
+		for _, sess := range s.sessionsOf(c) {
+			s.closeSession(sess)
+		}
+		c.conn.Close()
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	dec := json.NewDecoder(c.conn)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) {
+				// The stream cannot be resynchronized after broken JSON
+				c.reply(nil, nil, &Error{Code: CodeParseError, Message: "parse error: " + err.Error()})
+			}
+			return
+		}
+		c.dispatch(raw)
+	}
+}
+
+// dispatch starts one request. Session operations are queued here, in the order received.
+func (c *client) dispatch(raw json.RawMessage) {
+	if len(raw) > 0 && raw[0] == '[' {
+		c.reply(nil, nil, &Error{Code: CodeInvalidRequest, Message: "batch requests are not supported"})
+		return
+	}
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		c.reply(nil, nil, &Error{Code: CodeInvalidRequest, Message: "invalid request"})
+		return
+	}
+
+	if h, ok := sessionMethods[req.Method]; ok {
+		sess, err := c.server.ownedSession(c, req.Params)
+		if err == nil {
+			err = c.server.enqueue(sess, func() {
+				result, err := h(sess, req.Params)
+				c.reply(req.ID, result, err)
+			})
+		}
+		if err != nil {
+			c.reply(req.ID, nil, err)
+		}
+		return
+	}
+
+	h, ok := clientMethods[req.Method]
+	if !ok {
+		c.reply(req.ID, nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + req.Method})
+		return
+	}
+	c.pending.Add(1)
+	go func() {
+		defer c.pending.Done()
+		result, err := h(c, req.Params)
+		c.reply(req.ID, result, err)
+	}()
+}
+
+// reply sends the result or error of a request; notifications (no id) get no reply
+func (c *client) reply(id json.RawMessage, result any, err error) {
+	var rpcErr *Error
+	if err != nil && !errors.As(err, &rpcErr) {
+		rpcErr = &Error{Code: CodeCardError, Message: err.Error()}
+	}
+	if id == nil {
+		if rpcErr == nil || (rpcErr.Code != CodeParseError && rpcErr.Code != CodeInvalidRequest) {
+			return
+		}
+		id = json.RawMessage("null")
+	}
+	resp := response{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		resp.Result = result
+	}
+	c.send(resp)
+}
+
+// send writes one message; write errors mean the client is gone and are ignored
+func (c *client) send(msg any) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		data, _ = json.Marshal(response{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &Error{Code: CodeInternalError, Message: err.Error()}})
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.Write(append(data, '\n'))
+}
+
+// notify sends a server notification
+func (c *client) notify(method string, params any) {
+	c.send(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
@@ -0,0 +1,405 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ebfe/scard"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+var testUSIMAID = []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02, 0xFF, 0x49, 0xFF, 0x05, 0x89}
+
+// newTestCard builds a simulated USIM with IMSI 001010000000001 and SPN "Test"
+func newTestCard() *card.MockCard {
+	m := card.NewMockCard([]byte{0x3B, 0x9F, 0x96, 0x80, 0x1F, 0xC7, 0x80, 0x31, 0xE0, 0x73, 0xF6, 0xA1, 0x57, 0x57, 0x4A, 0x4D, 0x02, 0x0B, 0x61, 0x10, 0x00, 0x5B})
+	mf := m.MF()
+	mf.AddEF(0x2FE2, []byte{0x98, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10, 0x32, 0x54, 0xF6})
+
+	dirRecord := append([]byte{0x61, 0x12, 0x4F, 0x0C}, testUSIMAID...)
+	dirRecord = append(dirRecord, 0x50, 0x02, 'U', 'S')
+	mf.AddRecordEF(0x2F00, append(dirRecord, 0xFF, 0xFF))
+
+	usim := m.AddADF(testUSIMAID)
+	usim.AddEF(0x6F07, []byte{0x08, 0x09, 0x10, 0x10, 0x00, 0x00, 0x00, 0x00, 0x10})
+	usim.AddEF(0x6FAD, []byte{0x00, 0x00, 0x00, 0x02})
+	usim.AddEF(0x6F46, []byte{0x01, 'T', 'e', 's', 't', 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	return m
+}
+
+// testServer serves a mock card on a unix socket
+type testServer struct {
+	*Server
+	path   string
+	opened atomic.Int32
+	closed atomic.Int32
+	// powerLoss makes the next command fail as if the reader had powered the card down
+	powerLoss atomic.Bool
+}
+
+// closeCounter counts released readers and simulates power losses
+type closeCounter struct {
+	*card.MockCard
+	ts *testServer
+}
+
+func (c closeCounter) Transmit(apdu []byte) ([]byte, error) {
+	if c.ts.powerLoss.CompareAndSwap(true, false) {
+		c.MockCard.Reset(true)
+		return nil, scard.ErrUnpoweredCard
+	}
+	return c.MockCard.Transmit(apdu)
+}
+
+func (c closeCounter) Close() error {
+	c.ts.closed.Add(1)
+	return nil
+}
+
+func newTestServer(t *testing.T, idle time.Duration) *testServer {
+	t.Helper()
+	// Short path: unix socket names are limited to about 100 bytes
+	dir, err := os.MkdirTemp("", "srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{path: filepath.Join(dir, "s.sock")}
+	ts.Server = New(Config{
+		Open: func(index int) (*card.Reader, error) {
+			if index != 0 {
+				return nil, errors.New("no reader")
+			}
+			ts.opened.Add(1)
+			m := newTestCard()
+			return card.NewReaderWithTransport("Mock Reader", m.ATR, closeCounter{m, ts}), nil
+		},
+		Readers:     func() ([]string, error) { return []string{"Mock Reader"}, nil },
+		IdleTimeout: idle,
+	})
+
+	l, err := net.Listen("unix", ts.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ts.Serve(l)
+	t.Cleanup(func() {
+		ts.Close()
+		os.RemoveAll(dir)
+		sim.DetectedUSIM_AID = nil
+		sim.DetectedISIM_AID = nil
+	})
+	return ts
+}
+
+// rpcMessage is a response or notification received by the test client
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+	Params json.RawMessage `json:"params"`
+}
+
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	in   *bufio.Scanner
+	id   int
+}
+
+func (ts *testServer) dial(t *testing.T) *testClient {
+	t.Helper()
+	conn, err := net.Dial("unix", ts.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	in := bufio.NewScanner(conn)
+	in.Buffer(nil, 1<<20)
+	return &testClient{t: t, conn: conn, in: in}
+}
+
+// send writes a request and returns its id
+func (c *testClient) send(method string, params any) int {
+	c.t.Helper()
+	c.id++
+	msg, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": method, "params": params, "id": c.id})
+	if _, err := c.conn.Write(append(msg, '\n')); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.id
+}
+
+// next reads the next message from the server
+func (c *testClient) next() rpcMessage {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if !c.in.Scan() {
+		c.t.Fatalf("connection closed: %v", c.in.Err())
+	}
+	var msg rpcMessage
+	if err := json.Unmarshal(c.in.Bytes(), &msg); err != nil {
+		c.t.Fatalf("invalid message %s: %v", c.in.Bytes(), err)
+	}
+	return msg
+}
+
+// call sends a request and decodes the result into v; returns the error object
+func (c *testClient) call(method string, params, v any) *Error {
+	c.t.Helper()
+	id := c.send(method, params)
+	msg := c.next()
+	if string(msg.ID) != jsonInt(id) {
+		c.t.Fatalf("%s: response id %s, want %d", method, msg.ID, id)
+	}
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if v != nil {
+		if err := json.Unmarshal(msg.Result, v); err != nil {
+			c.t.Fatalf("%s: result %s: %v", method, msg.Result, err)
+		}
+	}
+	return nil
+}
+
+func jsonInt(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+// open opens a session on reader 0
+func (c *testClient) open() string {
+	c.t.Helper()
+	var res OpenResult
+	if err := c.call("session.open", OpenParams{Reader: 0}, &res); err != nil {
+		c.t.Fatalf("session.open: %v", err)
+	}
+	return res.Session
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// ============ SERVER TESTS ============
+
+func TestServer_SessionLifecycle(t *testing.T) {
+	ts := newTestServer(t, time.Minute)
+	c := ts.dial(t)
+
+	var readers ReadersResult
+	if err := c.call("readers.list", nil, &readers); err != nil || len(readers.Readers) != 1 {
+		t.Fatalf("readers.list = %v, %v", readers, err)
+	}
+
+	var opened OpenResult
+	if err := c.call("session.open", OpenParams{Reader: 0}, &opened); err != nil {
+		t.Fatalf("session.open: %v", err)
+	}
+	if opened.Reader != "Mock Reader" || opened.ATR == "" {
+		t.Errorf("session.open = %+v", opened)
+	}
+	ref := sessionRef{Session: opened.Session}
+
+	var usim sim.SIMConfig
+	if err := c.call("usim.read", ref, &usim); err != nil {
+		t.Fatalf("usim.read: %v", err)
+	}
+	if usim.IMSI != "001010000000001" || usim.SPN != "Test" {
+		t.Errorf("usim.read: IMSI %q, SPN %q", usim.IMSI, usim.SPN)
+	}
+
+	var trace TraceResult
+	if err := c.call("trace.get", map[string]any{"session": opened.Session, "clear": true}, &trace); err != nil {
+		t.Fatalf("trace.get: %v", err)
+	}
+	if len(trace.Exchanges) == 0 {
+		t.Errorf("trace.get returned no exchanges after usim.read")
+	}
+	if c.call("trace.get", ref, &trace); len(trace.Exchanges) != 0 {
+		t.Errorf("trace not cleared: %d exchanges", len(trace.Exchanges))
+	}
+
+	var closed CloseResult
+	if err := c.call("session.close", ref, &closed); err != nil || !closed.Closed {
+		t.Fatalf("session.close = %v, %v", closed, err)
+	}
+	if ts.closed.Load() != 1 {
+		t.Errorf("readers released = %d, want 1", ts.closed.Load())
+	}
+	if err := c.call("usim.read", ref, nil); err == nil || err.Code != CodeUnknownSession {
+		t.Errorf("usim.read after close: error = %v, want %d", err, CodeUnknownSession)
+	}
+}
+
+func TestServer_ApplyConfig(t *testing.T) {
+	ts := newTestServer(t, time.Minute)
+	c := ts.dial(t)
+	id := c.open()
+
+	var report sim.ApplyReport
+	params := map[string]any{"session": id, "config": map[string]any{"spn": "Other"}}
+	if err := c.call("config.apply", params, &report); err != nil {
+		t.Fatalf("config.apply: %v", err)
+	}
+	if report.Applied != 1 || report.Failed != 0 {
+		t.Errorf("report: applied %d, failed %d", report.Applied, report.Failed)
+	}
+
+	var usim sim.SIMConfig
+	c.call("usim.read", sessionRef{Session: id}, &usim)
+	if usim.SPN != "Other" {
+		t.Errorf("SPN after config.apply = %q", usim.SPN)
+	}
+
+	params["config"] = map[string]any{"no_such_field": 1}
+	if err := c.call("config.apply", params, nil); err == nil || err.Code != CodeInvalidParams {
+		t.Errorf("unknown config field: error = %v, want %d", err, CodeInvalidParams)
+	}
+}
+
+func TestServer_QueuedInOrder(t *testing.T) {
+	ts := newTestServer(t, time.Minute)
+	c := ts.dial(t)
+	id := c.open()
+
+	// Sent back to back: the session runs them one at a time in this order
+	var ids []int
+	for i := 0; i < 5; i++ {
+		ids = append(ids, c.send("usim.read", sessionRef{Session: id}))
+		ids = append(ids, c.send("trace.get", map[string]any{"session": id, "clear": true}))
+	}
+	for _, want := range ids {
+		msg := c.next()
+		if string(msg.ID) != jsonInt(want) {
+			t.Fatalf("response id %s, want %d", msg.ID, want)
+		}
+		if msg.Error != nil {
+			t.Fatalf("request %d: %v", want, msg.Error)
+		}
+	}
+}
+
+func TestServer_DisconnectReleasesReader(t *testing.T) {
+	ts := newTestServer(t, time.Minute)
+	c := ts.dial(t)
+	c.open()
+	c.open()
+	if ts.Sessions() != 2 {
+		t.Fatalf("sessions = %d, want 2", ts.Sessions())
+	}
+
+	c.conn.Close()
+	waitFor(t, "readers released", func() bool { return ts.closed.Load() == 2 })
+	if ts.Sessions() != 0 {
+		t.Errorf("sessions after disconnect = %d", ts.Sessions())
+	}
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	ts := newTestServer(t, 50*time.Millisecond)
+	c := ts.dial(t)
+	id := c.open()
+
+	msg := c.next()
+	if msg.Method != "session.expired" {
+		t.Fatalf("message = %+v, want session.expired", msg)
+	}
+	var ref sessionRef
+	json.Unmarshal(msg.Params, &ref)
+	if ref.Session != id {
+		t.Errorf("expired session %q, want %q", ref.Session, id)
+	}
+	if ts.closed.Load() != 1 || ts.Sessions() != 0 {
+		t.Errorf("reader not released after idle timeout")
+	}
+	if err := c.call("usim.read", sessionRef{Session: id}, nil); err == nil || err.Code != CodeUnknownSession {
+		t.Errorf("usim.read after expiry: error = %v", err)
+	}
+}
+
+func TestServer_PowerLossNotice(t *testing.T) {
+	ts := newTestServer(t, time.Minute)
+	c := ts.dial(t)
+	id := c.open()
+
+	ts.powerLoss.Store(true)
+	c.send("usim.read", sessionRef{Session: id})
+	msg := c.next()
+	if msg.Method != "session.notice" {
+		t.Fatalf("message = %+v, want session.notice", msg)
+	}
+	var notice sessionNotice
+	json.Unmarshal(msg.Params, &notice)
+	if notice.Session != id || !strings.Contains(notice.Message, "powered down") {
+		t.Errorf("session.notice = %+v", notice)
+	}
+	msg = c.next()
+	var usim sim.SIMConfig
+	if msg.Error != nil || json.Unmarshal(msg.Result, &usim) != nil || usim.IMSI != "001010000000001" {
+		t.Errorf("usim.read after power loss = %s, %v", msg.Result, msg.Error)
+	}
+	if ts.opened.Load() != 1 {
+		t.Errorf("readers opened = %d, want the session kept", ts.opened.Load())
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	ts := newTestServer(t, time.Minute)
+	c := ts.dial(t)
+	id := c.open()
+
+	if err := c.call("no.such", nil, nil); err == nil || err.Code != CodeMethodNotFound {
+		t.Errorf("unknown method: error = %v", err)
+	}
+	if err := c.call("session.open", OpenParams{Reader: 3}, nil); err == nil || err.Code != CodeCardError {
+		t.Errorf("missing reader: error = %v", err)
+	}
+	if err := c.call("usim.read", nil, nil); err == nil || err.Code != CodeInvalidParams {
+		t.Errorf("missing session: error = %v", err)
+	}
+	if err := c.call("auth.run", map[string]any{"session": id, "k": "zz"}, nil); err == nil || err.Code != CodeInvalidParams {
+		t.Errorf("bad key: error = %v", err)
+	}
+
+	// Sessions belong to the client that opened them
+	other := ts.dial(t)
+	if err := other.call("usim.read", sessionRef{Session: id}, nil); err == nil || err.Code != CodeUnknownSession {
+		t.Errorf("foreign session: error = %v", err)
+	}
+
+	// Not JSON-RPC 2.0
+	c.conn.Write([]byte(`{"method": "readers.list", "id": 1}` + "\n"))
+	if msg := c.next(); msg.Error == nil || msg.Error.Code != CodeInvalidRequest || string(msg.ID) != "null" {
+		t.Errorf("missing jsonrpc: %+v", msg)
+	}
+	// Notifications get no response: the next message answers the request after it
+	c.conn.Write([]byte(`{"jsonrpc": "2.0", "method": "readers.list"}` + "\n"))
+	if err := c.call("readers.list", nil, nil); err != nil {
+		t.Errorf("readers.list after notification: %v", err)
+	}
+	// Broken JSON ends the connection after a parse error
+	c.conn.Write([]byte("{oops\n"))
+	if msg := c.next(); msg.Error == nil || msg.Error.Code != CodeParseError {
+		t.Errorf("broken JSON: %+v", msg)
+	}
+	waitFor(t, "session released", func() bool { return ts.closed.Load() == 1 })
+}
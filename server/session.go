@@ -0,0 +1,252 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// maxTrace is the number of APDU exchanges a session keeps for trace.get
+const maxTrace = 2000
+
+// session holds an open reader. Operations run on the session goroutine in the order
+// they were queued; the reader is released after the last one when the session closes.
+// The card session sends the keep-alive between operations and re-initializes a card the
+// reader powered down.
+type session struct {
+	id     string
+	owner  *client
+	reader *card.Reader
+	card   *card.Session
+	gsm    bool // sim.UseGSMCommands for this card
+
+	queue chan func()
+	done  chan struct{} // closed when the reader is released
+
+	mu      sync.Mutex // protects pending, closed and timer
+	pending int        // queued and running operations
+	closed  bool
+	timer   *time.Timer
+
+	trace []card.APDUExchange // written and read on the session goroutine only
+}
+
+// newSessionID returns a random session identifier
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// openSession connects to a reader, verifies the optional PIN1 and ADM1 and starts the session
+func (s *Server) openSession(owner *client, index int, pin, adm string) (*session, error) {
+	var admKey []byte
+	if adm != "" {
+		var err error
+		if admKey, err = card.ParseADMKey(adm); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+	}
+
+	s.cardMu.Lock()
+	defer s.cardMu.Unlock()
+
+	reader, err := s.cfg.Open(index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	id := newSessionID()
+	// Created before the verification so that PIN1 and ADM1 are restored after a power loss
+	cardSession := card.NewSession(reader, card.SessionOptions{
+		KeepAlive: s.cfg.KeepAlive,
+		Notice: func(msg string) {
+			owner.notify("session.notice", sessionNotice{Session: id, Message: msg})
+		},
+	})
+	err = cardSession.Do(func(reader *card.Reader) error {
+		if pin != "" {
+			if err := reader.VerifyPIN1(pin); err != nil {
+				return fmt.Errorf("PIN1 verification failed: %w", err)
+			}
+		}
+		if admKey != nil {
+			if err := reader.VerifyADM1(admKey); err != nil {
+				return fmt.Errorf("ADM1 verification failed: %w", err)
+			}
+		}
+		sim.DetectApplicationAIDs(reader)
+		return nil
+	})
+	if err != nil {
+		cardSession.Close()
+		return nil, err
+	}
+
+	sess := &session{
+		id:     id,
+		owner:  owner,
+		reader: reader,
+		card:   cardSession,
+		gsm:    sim.UseGSMCommands,
+		queue:  make(chan func(), maxQueued),
+		done:   make(chan struct{}),
+	}
+	// Traced after the verification so that keys do not end up in trace.get
+	reader.SetTrace(func(ex card.APDUExchange) {
+		if len(sess.trace) == maxTrace {
+			sess.trace = sess.trace[1:]
+		}
+		sess.trace = append(sess.trace, ex)
+	})
+	s.active = sess
+
+	s.mu.Lock()
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+
+	sess.mu.Lock()
+	sess.timer = time.AfterFunc(s.cfg.IdleTimeout, func() { s.expire(sess) })
+	sess.mu.Unlock()
+	go s.run(sess)
+	return sess, nil
+}
+
+// run executes the queued operations of a session, then releases its reader
+func (s *Server) run(sess *session) {
+	for op := range sess.queue {
+		s.cardMu.Lock()
+		// Do fails only on a closed or suspended card session; this one is closed below
+		// and never suspended
+		sess.card.Do(func(*card.Reader) error {
+			s.activate(sess)
+			op()
+			return nil
+		})
+		s.cardMu.Unlock()
+
+		sess.mu.Lock()
+		sess.pending--
+		if !sess.closed {
+			sess.timer.Reset(s.cfg.IdleTimeout)
+		}
+		sess.mu.Unlock()
+	}
+
+	s.cardMu.Lock()
+	if s.active == sess {
+		s.active = nil
+	}
+	sess.card.Close()
+	s.cardMu.Unlock()
+	close(sess.done)
+}
+
+// activate restores the sim package state of the card of sess (cardMu held)
+func (s *Server) activate(sess *session) {
+	sim.UseGSMCommands = sess.gsm
+	if s.active != sess {
+		sim.DetectApplicationAIDs(sess.reader)
+		s.active = sess
+	}
+}
+
+// enqueue queues an operation; it fails if the session is closed or too many are waiting
+func (s *Server) enqueue(sess *session, op func()) error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.closed {
+		return &Error{Code: CodeUnknownSession, Message: "session closed"}
+	}
+	select {
+	case sess.queue <- op:
+		sess.pending++
+		return nil
+	default:
+		return &Error{Code: CodeSessionBusy, Message: fmt.Sprintf("session busy: %d operations queued", maxQueued)}
+	}
+}
+
+// closeSession stops accepting operations, waits for the queued ones and releases the reader
+func (s *Server) closeSession(sess *session) {
+	s.mu.Lock()
+	delete(s.sessions, sess.id)
+	s.mu.Unlock()
+
+	sess.mu.Lock()
+	if !sess.closed {
+		sess.closed = true
+		sess.timer.Stop()
+		close(sess.queue)
+	}
+	sess.mu.Unlock()
+	<-sess.done
+}
+
+// expire closes a session that has been idle for IdleTimeout and tells its client
+func (s *Server) expire(sess *session) {
+	sess.mu.Lock()
+	if sess.closed {
+		sess.mu.Unlock()
+		return
+	}
+	if sess.pending > 0 {
+		// A long operation is running; the timer restarts when it finishes
+		sess.mu.Unlock()
+		return
+	}
+	sess.mu.Unlock()
+
+	s.closeSession(sess)
+	sess.owner.notify("session.expired", sessionRef{Session: sess.id})
+}
+
+// sessionRef is the session parameter of the session methods
+type sessionRef struct {
+	Session string `json:"session"`
+}
+
+// sessionNotice is the parameter of the session.notice notification: the card was
+// re-initialized after the reader powered it down, or the keep-alive failed
+type sessionNotice struct {
+	Session string `json:"session"`
+	Message string `json:"message"`
+}
+
+// ownedSession returns the session named in params if it was opened by c
+func (s *Server) ownedSession(c *client, params json.RawMessage) (*session, error) {
+	var ref sessionRef
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &ref); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: "invalid params: " + err.Error()}
+		}
+	}
+	if ref.Session == "" {
+		return nil, &Error{Code: CodeInvalidParams, Message: "missing session"}
+	}
+	s.mu.Lock()
+	sess, ok := s.sessions[ref.Session]
+	s.mu.Unlock()
+	if !ok || sess.owner != c {
+		return nil, &Error{Code: CodeUnknownSession, Message: "unknown session " + ref.Session}
+	}
+	return sess, nil
+}
+
+// sessionsOf returns the open sessions of a client
+func (s *Server) sessionsOf(c *client) []*session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*session
+	for _, sess := range s.sessions {
+		if sess.owner == c {
+			list = append(list, sess)
+		}
+	}
+	return list
+}
@@ -0,0 +1,216 @@
+package sim
+
+import (
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// EF_ACL (TS 31.102 4.2.48) lists the APNs the UE may use when the APN control list is
+// available (UST service 35) and enabled (EST service 3). Byte 1 is the number of APN
+// TLVs that follow; each is tag DD with the APN network identifier in TS 23.003 label
+// encoding. An empty APN TLV is the "network provided APN" entry, which lets the UE
+// set up a PDN connection without naming an APN (any APN the network picks).
+var FID_EF_ACL = []byte{0x6F, 0x57}
+
+const aclAPNTag = 0xDD
+
+// ACL is the decoded APN control list
+type ACL struct {
+	APNs     []string `json:"apns"`
+	AllowAll bool     `json:"allow_all"` // network provided APN entry (empty APN TLV)
+	Enabled  bool     `json:"enabled"`   // UST service 35 and EST service 3 both set
+}
+
+// String lists the APNs, the network provided APN entry as "*"
+func (a *ACL) String() string {
+	entries := append([]string(nil), a.APNs...)
+	if a.AllowAll {
+		entries = append(entries, "*")
+	}
+	if len(entries) == 0 {
+		return "(empty)"
+	}
+	return strings.Join(entries, ", ")
+}
+
+// DecodeACL decodes EF_ACL. Decoding stops at the first byte that is not an APN TLV
+// (FF padding), the count byte is informational.
+func DecodeACL(data []byte) *ACL {
+	acl := &ACL{APNs: make([]string, 0)}
+	if len(data) == 0 {
+		return acl
+	}
+	for off := 1; off+2 <= len(data) && data[off] == aclAPNTag; {
+		n := int(data[off+1])
+		if off+2+n > len(data) {
+			break
+		}
+		if n == 0 {
+			acl.AllowAll = true
+		} else {
+			acl.APNs = append(acl.APNs, DecodeAPN(data[off+2:off+2+n]))
+		}
+		off += 2 + n
+	}
+	return acl
+}
+
+// DecodeAPN decodes an APN network identifier from TS 23.003 label encoding (each label
+// preceded by its length). Values that are not label encoded are returned in hex.
+func DecodeAPN(data []byte) string {
+	labels := make([]string, 0, 4)
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		if n == 0 || i+1+n > len(data) {
+			return fmt.Sprintf("%X", data)
+		}
+		labels = append(labels, string(data[i+1:i+1+n]))
+		i += 1 + n
+	}
+	return strings.Join(labels, ".")
+}
+
+// EncodeAPN encodes an APN network identifier (e.g. "internet" or "ims.example.org")
+// in TS 23.003 label encoding
+func EncodeAPN(apn string) ([]byte, error) {
+	if apn == "" {
+		return nil, fmt.Errorf("empty APN")
+	}
+	var out []byte
+	for _, label := range strings.Split(apn, ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid APN %q: labels must be 1-63 characters", apn)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return nil, fmt.Errorf("invalid APN %q: character %q not allowed", apn, c)
+			}
+		}
+		out = append(out, byte(len(label)))
+		out = append(out, label...)
+	}
+	if len(out) > 100 {
+		return nil, fmt.Errorf("APN %q is %d bytes encoded, the maximum is 100", apn, len(out))
+	}
+	return out, nil
+}
+
+// EncodeACL encodes the APN list (network provided APN entry first when allowAll) with
+// its count byte, padded with FF to fileSize. When the list does not fit, the error
+// states how many of the APNs do.
+func EncodeACL(apns []string, allowAll bool, fileSize int) ([]byte, error) {
+	data := []byte{0x00}
+	if allowAll {
+		data = append(data, aclAPNTag, 0x00)
+		data[0]++
+	}
+	fit := -1
+	for i, apn := range apns {
+		value, err := EncodeAPN(apn)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, aclAPNTag, byte(len(value)))
+		data = append(data, value...)
+		data[0]++
+		if fit < 0 && len(data) > fileSize {
+			fit = i
+		}
+	}
+	if len(data) > fileSize {
+		if fit < 0 { // even the count byte and the network provided APN entry do not fit
+			fit = 0
+		}
+		return nil, fmt.Errorf("APN control list needs %d bytes, EF_ACL has %d: %d of the %d APNs fit", len(data), fileSize, fit, len(apns))
+	}
+	for len(data) < fileSize {
+		data = append(data, 0xFF)
+	}
+	return data, nil
+}
+
+// ParseACLEntries splits a list of APNs given on the command line or in a config file;
+// "*" stands for the network provided APN entry
+func ParseACLEntries(entries []string) (apns []string, allowAll bool) {
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		switch e {
+		case "":
+		case "*":
+			allowAll = true
+		default:
+			apns = append(apns, e)
+		}
+	}
+	return apns, allowAll
+}
+
+// readACL reads EF_ACL of the selected USIM; enabled is computed from UST and EST
+func (u *USIMData) readACL(reader *card.Reader) {
+	raw, ok := u.Files.readTracked(reader, "EF_ACL", 0x6F57)
+	if !ok {
+		return
+	}
+	u.RawFiles["EF_ACL"] = raw
+	u.ACL = DecodeACL(raw)
+	u.ACL.Enabled = u.UST[UST_ACL] && u.EST[int(EST_ACL)]
+}
+
+// WriteACL writes the APN control list to EF_ACL and marks the service available in the
+// UST (service 35). Whether the UE enforces it is controlled with SetACLEnabled.
+func WriteACL(reader *card.Reader, apns []string, allowAll bool) error {
+	if len(apns) == 0 && !allowAll {
+		return fmt.Errorf("empty APN control list")
+	}
+	if drv := FindDriver(reader); drv != nil {
+		if err := drv.PrepareWrite(reader); err != nil {
+			return fmt.Errorf("prepare write failed: %w", err)
+		}
+	}
+
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+	resp, err = reader.Select(FID_EF_ACL)
+	if err != nil {
+		return fmt.Errorf("failed to select EF_ACL: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("EF_ACL not found (UST service %d): %s", UST_ACL, resp.SWString())
+	}
+	fileSize := parseFCPFileSize(resp.Data)
+	if fileSize == 0 {
+		return fmt.Errorf("EF_ACL size not found in FCP")
+	}
+
+	data, err := EncodeACL(apns, allowAll, fileSize)
+	if err != nil {
+		return err
+	}
+	resp, err = reader.UpdateBinary(0, data)
+	if err != nil {
+		return fmt.Errorf("failed to write EF_ACL: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("EF_ACL write failed: %s", resp.SWString())
+	}
+
+	return SetUSIMServices(reader, map[int]bool{UST_ACL: true})
+}
+
+// SetACLEnabled enables (UST service 35 and EST service 3) or disables (EST service 3)
+// the APN control list. Disabling keeps the UST bit since EF_ACL is still on the card.
+func SetACLEnabled(reader *card.Reader, enabled bool) error {
+	if enabled {
+		if err := SetUSIMServices(reader, map[int]bool{UST_ACL: true}); err != nil {
+			return err
+		}
+	}
+	return SetESTService(reader, EST_ACL, enabled)
+}
@@ -0,0 +1,164 @@
+package sim
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ EF_ACL TESTS ============
+
+func TestEncodeAPN(t *testing.T) {
+	tests := []struct {
+		apn     string
+		want    []byte
+		wantErr bool
+	}{
+		{"internet", append([]byte{8}, "internet"...), false},
+		{"ims.example.org", []byte{3, 'i', 'm', 's', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'o', 'r', 'g'}, false},
+		{"my-apn1", append([]byte{7}, "my-apn1"...), false},
+		{"", nil, true},
+		{"ims..org", nil, true},
+		{"ims_corp", nil, true},
+		{strings.Repeat("a", 64), nil, true},
+		{strings.Repeat(strings.Repeat("a", 20)+".", 5) + "org", nil, true}, // 109 bytes
+	}
+	for _, tc := range tests {
+		got, err := EncodeAPN(tc.apn)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("EncodeAPN(%q) error = %v, wantErr %v", tc.apn, err, tc.wantErr)
+			continue
+		}
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("EncodeAPN(%q) = %X, want %X", tc.apn, got, tc.want)
+		}
+		if err == nil && DecodeAPN(got) != tc.apn {
+			t.Errorf("DecodeAPN(%X) = %q, want %q", got, DecodeAPN(got), tc.apn)
+		}
+	}
+}
+
+func TestEncodeDecodeACL(t *testing.T) {
+	data, err := EncodeACL([]string{"internet", "ims"}, true, 24)
+	if err != nil {
+		t.Fatalf("EncodeACL() error = %v", err)
+	}
+	want := []byte{0x03, 0xDD, 0x00,
+		0xDD, 0x09, 0x08, 'i', 'n', 't', 'e', 'r', 'n', 'e', 't',
+		0xDD, 0x04, 0x03, 'i', 'm', 's',
+		0xFF, 0xFF, 0xFF, 0xFF}
+	if !bytes.Equal(data, want) {
+		t.Errorf("EncodeACL() = %X, want %X", data, want)
+	}
+
+	acl := DecodeACL(data)
+	if !reflect.DeepEqual(acl.APNs, []string{"internet", "ims"}) || !acl.AllowAll {
+		t.Errorf("DecodeACL() = %+v", acl)
+	}
+	if got := acl.String(); got != "internet, ims, *" {
+		t.Errorf("String() = %q", got)
+	}
+
+	// Empty list as shipped on most cards
+	if acl := DecodeACL([]byte{0x00, 0xFF, 0xFF}); len(acl.APNs) != 0 || acl.AllowAll || acl.String() != "(empty)" {
+		t.Errorf("DecodeACL(empty) = %+v", acl)
+	}
+}
+
+func TestEncodeACL_Overflow(t *testing.T) {
+	// 1 count byte + 11 (internet) + 6 (ims) fit in 20 bytes, corporate does not
+	_, err := EncodeACL([]string{"internet", "ims", "corporate"}, false, 20)
+	if err == nil || !strings.Contains(err.Error(), "2 of the 3 APNs fit") {
+		t.Errorf("EncodeACL() error = %v, want 2 of the 3 APNs fit", err)
+	}
+	_, err = EncodeACL([]string{"internet"}, true, 4)
+	if err == nil || !strings.Contains(err.Error(), "0 of the 1 APNs fit") {
+		t.Errorf("EncodeACL() error = %v, want 0 of the 1 APNs fit", err)
+	}
+}
+
+func TestParseACLEntries(t *testing.T) {
+	apns, allowAll := ParseACLEntries([]string{"internet", " * ", "", "ims"})
+	if !reflect.DeepEqual(apns, []string{"internet", "ims"}) || !allowAll {
+		t.Errorf("ParseACLEntries() = %v, %v", apns, allowAll)
+	}
+}
+
+// newACLTestCard returns a card with an empty 32-byte EF_ACL and the given UST/EST
+func newACLTestCard(ust, est byte) (*card.Reader, *card.MockFile, *card.MockFile, *card.MockFile) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	adf := m.AddADF(AID_USIM)
+	ustEF := adf.AddEF(0x6F38, []byte{0x00, 0x00, 0x00, 0x00, ust, 0x00})
+	estEF := adf.AddEF(0x6F56, []byte{est})
+	acl := adf.AddEF(0x6F57, append([]byte{0x00}, bytes.Repeat([]byte{0xFF}, 31)...))
+	return card.NewReaderWithTransport("Mock", m.ATR, m), ustEF, estEF, acl
+}
+
+func TestWriteACL(t *testing.T) {
+	reader, ustEF, estEF, aclEF := newACLTestCard(0x00, 0x00)
+
+	if err := WriteACL(reader, []string{"internet", "ims"}, false); err != nil {
+		t.Fatalf("WriteACL() error = %v", err)
+	}
+	want, _ := EncodeACL([]string{"internet", "ims"}, false, 32)
+	if !bytes.Equal(aclEF.Data, want) {
+		t.Errorf("EF_ACL = %X, want %X", aclEF.Data, want)
+	}
+	if ustEF.Data[4] != 0x04 || estEF.Data[0] != 0x00 {
+		t.Errorf("UST byte 5 = %02X, EST = %02X; want service 35 available, not enabled", ustEF.Data[4], estEF.Data[0])
+	}
+
+	data, err := ReadUSIM(reader)
+	if err != nil || data.ACL == nil {
+		t.Fatalf("ReadUSIM() ACL = %+v, %v", data, err)
+	}
+	if !reflect.DeepEqual(data.ACL.APNs, []string{"internet", "ims"}) || data.ACL.Enabled {
+		t.Errorf("ReadUSIM() ACL = %+v", data.ACL)
+	}
+
+	before := append([]byte(nil), aclEF.Data...)
+	err = WriteACL(reader, []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}, true)
+	if err == nil || !strings.Contains(err.Error(), "7 of the 11 APNs fit") {
+		t.Errorf("WriteACL() error = %v, want 7 of the 11 APNs fit", err)
+	}
+	if !bytes.Equal(aclEF.Data, before) {
+		t.Error("EF_ACL changed by an oversized list")
+	}
+}
+
+func TestSetACLEnabled(t *testing.T) {
+	reader, ustEF, estEF, _ := newACLTestCard(0x00, 0x01) // FDN enabled
+
+	if err := SetACLEnabled(reader, true); err != nil {
+		t.Fatalf("SetACLEnabled(true) error = %v", err)
+	}
+	if ustEF.Data[4] != 0x04 || estEF.Data[0] != 0x05 {
+		t.Errorf("UST byte 5 = %02X, EST = %02X; want 04, 05", ustEF.Data[4], estEF.Data[0])
+	}
+	if data, _ := ReadUSIM(reader); data.ACL == nil || !data.ACL.Enabled {
+		t.Errorf("ReadUSIM() ACL = %+v, want enabled", data.ACL)
+	}
+
+	if err := SetACLEnabled(reader, false); err != nil {
+		t.Fatalf("SetACLEnabled(false) error = %v", err)
+	}
+	if ustEF.Data[4] != 0x04 || estEF.Data[0] != 0x01 {
+		t.Errorf("UST byte 5 = %02X, EST = %02X; want 04 (kept), 01", ustEF.Data[4], estEF.Data[0])
+	}
+}
+
+func TestDecodeChange_ACL(t *testing.T) {
+	before, _ := EncodeACL(nil, true, 16)
+	after, _ := EncodeACL([]string{"internet"}, false, 16)
+	got := decodeChange("ADF_USIM", 0x6F57, before, after)
+	if len(got) != 1 || got[0] != "APN control list: * → internet" {
+		t.Errorf("EF_ACL change = %q", got)
+	}
+	got = decodeChange("ADF_USIM", 0x6F56, []byte{0x01}, []byte{0x05})
+	if len(got) != 1 || got[0] != "Service 3 (APN Control List (ACL)): enabled" {
+		t.Errorf("EF_EST change = %q", got)
+	}
+}
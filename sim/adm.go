@@ -0,0 +1,187 @@
+package sim
+
+import (
+	"fmt"
+
+	"sim_reader/card"
+)
+
+// DebugADM enables debug output for ADM verification probing
+var DebugADM = false
+
+// ADMProfileProvider is implemented by drivers whose cards need specific ADM VERIFY
+// parameters (key reference, length, padding, class). Profiles are tried in order.
+type ADMProfileProvider interface {
+	ADMProfiles(level int) []card.ADMVerifyProfile
+}
+
+// minProbeAttempts is the lowest retry counter at which another key variant may be probed.
+// Probing never brings a key closer than two attempts to being blocked.
+const minProbeAttempts = 3
+
+// verifiedADMProfiles remembers the profile that verified each ADM level (for re-authentication)
+var verifiedADMProfiles = map[int]card.ADMVerifyProfile{}
+
+// preferredADMProfiles are tried before the driver or default profiles (see PreferADMProfile)
+var preferredADMProfiles = map[int]card.ADMVerifyProfile{}
+
+// PreferADMProfile makes VerifyADM try p first for level, e.g. the variant that verified
+// the key of this card in an earlier session (profile store)
+func PreferADMProfile(level int, p card.ADMVerifyProfile) {
+	preferredADMProfiles[level] = p
+}
+
+// VerifiedADMProfile returns the profile that verified ADM level in this session
+func VerifiedADMProfile(level int) (card.ADMVerifyProfile, bool) {
+	p, ok := verifiedADMProfiles[level]
+	return p, ok
+}
+
+// DefaultADMProfiles returns the key variants tried for cards without a driver profile:
+// ISO 8 bytes FF-padded (TS 102 221), GSM class 8 bytes FF-padded, the key as
+// 16 ASCII hex characters, and for ADM1 the CHV1 reference used by some old SIMs.
+func DefaultADMProfiles(level int) []card.ADMVerifyProfile {
+	ref := card.ADMKeyRef(level)
+	profiles := []card.ADMVerifyProfile{
+		{Name: "ISO 8 bytes FF-padded", CLA: 0x00, KeyRef: ref, Length: 8, Padding: 0xFF},
+		{Name: "GSM 8 bytes FF-padded", CLA: 0xA0, KeyRef: ref, Length: 8, Padding: 0xFF},
+		{Name: "ISO 16 bytes ASCII hex", CLA: 0x00, KeyRef: ref, Length: 16, Padding: 0xFF, Format: card.ADMKeyASCIIHex},
+	}
+	if level == 1 {
+		profiles = append(profiles, card.ADMVerifyProfile{
+			Name: "CHV1 reference 8 bytes FF-padded", CLA: 0x00, KeyRef: card.PIN_CHV1, Length: 8, Padding: 0xFF})
+	}
+	return profiles
+}
+
+// StandardADMProfile returns the TS 102 221 ADM key profile (8 bytes FF-padded, key
+// reference 0A-0D) with the given class byte, for drivers of cards without quirks
+func StandardADMProfile(cla byte, level int) card.ADMVerifyProfile {
+	return card.ADMVerifyProfile{Name: "8 bytes FF-padded", CLA: cla, KeyRef: card.ADMKeyRef(level), Length: 8, Padding: 0xFF}
+}
+
+// admProfilesFor returns the driver profiles for level, or the defaults, after the
+// preferred profile of the level if one is set
+func admProfilesFor(drv ProgrammableDriver, level int) []card.ADMVerifyProfile {
+	profiles := DefaultADMProfiles(level)
+	if p, ok := drv.(ADMProfileProvider); ok {
+		if dp := p.ADMProfiles(level); len(dp) > 0 {
+			profiles = dp
+		}
+	}
+	preferred, ok := preferredADMProfiles[level]
+	if !ok {
+		return profiles
+	}
+	out := []card.ADMVerifyProfile{preferred}
+	for _, p := range profiles {
+		if p != preferred {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// VerifyADM verifies ADM key level (1-4) using the driver profiles (drv may be nil).
+// The first profile is always tried (and the next ones while the card rejects the class or
+// instruction). After a VERIFY reached the key check, further profiles are only tried while
+// the retry counter, re-read before each attempt, is known and above two, so probing cannot
+// block the key. The profile that succeeds is used for later re-authentication.
+func VerifyADM(reader *card.Reader, drv ProgrammableDriver, level int, key []byte) error {
+	if level < 1 || level > 4 {
+		return fmt.Errorf("invalid ADM level %d", level)
+	}
+	defer reader.Measure("ADM verify")()
+
+	profiles := admProfilesFor(drv, level)
+	if DebugADM {
+		fmt.Printf("DEBUG ADM: ADM%d probing order:\n", level)
+		for i, p := range profiles {
+			fmt.Printf("DEBUG ADM:   %d. %s\n", i+1, p)
+		}
+	}
+
+	var lastErr error
+	attempted := false // a VERIFY reached the key check and may have used a retry
+	for _, p := range profiles {
+		if attempted {
+			info := reader.CheckADM(p.KeyRef)
+			if !info.Exists || info.Blocked || info.Attempts < minProbeAttempts {
+				if DebugADM {
+					fmt.Printf("DEBUG ADM: ADM%d skip %s: exists=%v blocked=%v attempts=%d\n",
+						level, p, info.Exists, info.Blocked, info.Attempts)
+				}
+				if info.Exists && !info.Blocked && info.Attempts >= 0 {
+					// Retry counter too low for probing: stop here, later variants use the same counter
+					break
+				}
+				continue
+			}
+		}
+
+		resp, err := reader.VerifyADMWithProfile(p, key)
+		if DebugADM {
+			if err != nil {
+				fmt.Printf("DEBUG ADM: ADM%d try %s: %v\n", level, p, err)
+			} else {
+				fmt.Printf("DEBUG ADM: ADM%d try %s: SW=%04X\n", level, p, resp.SW())
+			}
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("ADM%d verification failed: %w", level, err)
+			continue
+		}
+		if resp.IsOK() {
+			verifiedADMProfiles[level] = p
+			return nil
+		}
+		lastErr = admVerifyError(level, resp)
+		if sw := resp.SW(); sw != card.SW_CLA_NOT_SUPPORTED && sw != card.SW_INS_NOT_SUPPORTED {
+			attempted = true
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("ADM%d verification failed: no usable key variant", level)
+	}
+	return lastErr
+}
+
+// admVerifyError formats a failed VERIFY response like card.Reader.VerifyADM1
+func admVerifyError(level int, resp *card.APDUResponse) error {
+	if resp.SW1 == 0x63 && (resp.SW2&0xF0) == 0xC0 {
+		return fmt.Errorf("ADM%d verification failed: wrong key, %d attempts remaining", level, resp.SW2&0x0F)
+	}
+	return fmt.Errorf("ADM%d verification failed: %s (SW=%04X)", level, resp.SWString(), resp.SW())
+}
+
+// storedADMKeyFor returns the stored key of ADM level 1-4
+func storedADMKeyFor(level int) []byte {
+	switch level {
+	case 1:
+		return StoredADMKey
+	case 2:
+		return StoredADMKey2
+	case 3:
+		return StoredADMKey3
+	case 4:
+		return StoredADMKey4
+	}
+	return nil
+}
+
+// reauthenticateADM re-verifies all stored ADM keys after an application SELECT,
+// with the profile that verified them. Errors are ignored - some keys may not be needed.
+func reauthenticateADM(reader *card.Reader) {
+	for level := 1; level <= 4; level++ {
+		key := storedADMKeyFor(level)
+		if len(key) == 0 {
+			continue
+		}
+		if p, ok := verifiedADMProfiles[level]; ok {
+			reader.VerifyADMWithProfile(p, key)
+		} else {
+			reader.VerifyPIN(card.ADMKeyRef(level), key)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ ADM VERIFICATION TESTS ============
+
+var testADMKey = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+
+// testADMDriver is a driver that only provides ADM profiles
+type testADMDriver struct {
+	ProgrammableDriver
+	profiles []card.ADMVerifyProfile
+}
+
+func (d *testADMDriver) ADMProfiles(level int) []card.ADMVerifyProfile {
+	return d.profiles
+}
+
+// newADMTestReader returns a simulated USIM whose ADM1 expects stored under ref with retries attempts
+func newADMTestReader(ref byte, stored []byte, retries int) (*card.Reader, *card.MockCard) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(AID_USIM)
+	m.Keys[ref] = stored
+	m.Retries[ref] = retries
+	return card.NewReaderWithTransport("Mock", m.ATR, m), m
+}
+
+// verifyCommands returns the VERIFY commands with data sent to the mock
+func verifyCommands(m *card.MockCard) [][]byte {
+	var out [][]byte
+	for _, apdu := range m.Log {
+		if apdu[1] == card.INS_VERIFY && len(apdu) > 5 {
+			out = append(out, apdu)
+		}
+	}
+	return out
+}
+
+func TestVerifyADM(t *testing.T) {
+	asciiHex := []byte("0102030405060708")
+
+	tests := []struct {
+		name     string
+		ref      byte
+		stored   []byte
+		retries  int
+		drv      ProgrammableDriver
+		wantErr  bool
+		verifies int  // VERIFY commands with data
+		wantP2   byte // P2 of the last VERIFY
+	}{
+		{"ISO padded first try", card.PIN_ADM1, testADMKey, 3, nil, false, 1, card.PIN_ADM1},
+		{"Fallback to ASCII hex", card.PIN_ADM1, asciiHex, 5, nil, false, 3, card.PIN_ADM1},
+		{"Fallback to CHV1 reference", card.PIN_CHV1, testADMKey, 10, nil, false, 2, card.PIN_CHV1},
+		{"Stop when counter too low", card.PIN_ADM1, asciiHex, 3, nil, true, 1, card.PIN_ADM1},
+		{"Driver profile only", card.PIN_ADM1, asciiHex, 10, &testADMDriver{profiles: []card.ADMVerifyProfile{
+			StandardADMProfile(0x00, 1)}}, true, 1, card.PIN_ADM1},
+		{"Driver ASCII profile", card.PIN_ADM1, asciiHex, 3, &testADMDriver{profiles: []card.ADMVerifyProfile{
+			{Name: "ASCII", KeyRef: card.PIN_ADM1, Length: 16, Padding: 0xFF, Format: card.ADMKeyASCIIHex}}}, false, 1, card.PIN_ADM1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer ClearADMKey()
+			reader, m := newADMTestReader(tc.ref, tc.stored, tc.retries)
+
+			err := VerifyADM(reader, tc.drv, 1, testADMKey)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("VerifyADM() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			cmds := verifyCommands(m)
+			if len(cmds) != tc.verifies {
+				t.Errorf("VERIFY commands = %d, want %d: %X", len(cmds), tc.verifies, cmds)
+			}
+			if len(cmds) > 0 && cmds[len(cmds)-1][3] != tc.wantP2 {
+				t.Errorf("last VERIFY P2 = %02X, want %02X", cmds[len(cmds)-1][3], tc.wantP2)
+			}
+		})
+	}
+}
+
+func TestVerifyADM_CounterNeverBelowTwo(t *testing.T) {
+	for retries := 1; retries <= 10; retries++ {
+		reader, m := newADMTestReader(card.PIN_ADM1, []byte("wrongkey"), retries)
+		if err := VerifyADM(reader, nil, 1, testADMKey); err == nil {
+			t.Fatalf("retries %d: VerifyADM() succeeded with a wrong key", retries)
+		}
+		info := reader.CheckADM(card.PIN_ADM1)
+		if want := min(retries-1, 2); info.Attempts < want {
+			t.Errorf("retries %d: %d attempts left after probing, want at least %d (%d VERIFY)",
+				retries, info.Attempts, want, len(verifyCommands(m)))
+		}
+	}
+}
+
+func TestReauthenticateADM_UsesVerifiedProfile(t *testing.T) {
+	defer ClearADMKey()
+	reader, m := newADMTestReader(card.PIN_ADM1, []byte("0102030405060708"), 5)
+
+	if err := VerifyADM(reader, nil, 1, testADMKey); err != nil {
+		t.Fatalf("VerifyADM() error = %v", err)
+	}
+	SetADMKey(testADMKey)
+	m.Log = nil
+
+	if _, err := SelectUSIMWithAuth(reader); err != nil {
+		t.Fatalf("SelectUSIMWithAuth() error = %v", err)
+	}
+	cmds := verifyCommands(m)
+	if len(cmds) != 1 || !bytes.Equal(cmds[0][5:], []byte("0102030405060708")) {
+		t.Errorf("re-authentication VERIFY = %X, want ASCII hex key", cmds)
+	}
+}
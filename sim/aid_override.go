@@ -0,0 +1,135 @@
+package sim
+
+import (
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/inputs"
+	"sim_reader/tlv"
+)
+
+var (
+	// OverrideUSIM_AID / OverrideISIM_AID replace EF_DIR detection for the respective
+	// application (--usim-aid / --isim-aid). With an override the standard AID and
+	// DF path fallbacks are not used, so every select reaches exactly this AID.
+	OverrideUSIM_AID []byte
+	OverrideISIM_AID []byte
+)
+
+// SetAIDOverrides sets the USIM and ISIM AID overrides from hex strings ("" = detect from EF_DIR)
+// and applies them to the session state
+func SetAIDOverrides(usimAID, isimAID string) error {
+	usim, err := parseAIDOverride("--usim-aid", usimAID)
+	if err != nil {
+		return err
+	}
+	isim, err := parseAIDOverride("--isim-aid", isimAID)
+	if err != nil {
+		return err
+	}
+	OverrideUSIM_AID, OverrideISIM_AID = usim, isim
+	applyAIDOverrides()
+	return nil
+}
+
+// parseAIDOverride parses an AID given on the command line (5-16 bytes per ISO 7816-4)
+func parseAIDOverride(flag, s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return inputs.AID(flag, s)
+}
+
+// applyAIDOverrides replaces the detected AIDs and paths with the overrides, if any
+func applyAIDOverrides() {
+	if len(OverrideUSIM_AID) > 0 {
+		DetectedUSIM_AID = OverrideUSIM_AID
+		DetectedUSIM_Path = nil
+	}
+	if len(OverrideISIM_AID) > 0 {
+		DetectedISIM_AID = OverrideISIM_AID
+		DetectedISIM_Path = nil
+		DetectedISIMApps = []ISIMApp{{Index: 1, AID: OverrideISIM_AID, Label: "--isim-aid"}}
+	}
+}
+
+// usimFallbackAllowed reports whether USIM selection may fall back to the standard AID
+func usimFallbackAllowed() bool {
+	return len(OverrideUSIM_AID) == 0
+}
+
+// isimFallbackAllowed reports whether ISIM selection may fall back to the standard AID
+// (not with an explicit ISIM instance or AID override)
+func isimFallbackAllowed() bool {
+	return SelectedISIMIndex == 0 && len(OverrideISIM_AID) == 0
+}
+
+// EFDIRRecord is one EF_DIR record as read from the card, for --list-aids
+type EFDIRRecord struct {
+	Record int    `json:"record"`
+	Raw    string `json:"raw"`
+	AID    string `json:"aid,omitempty"`
+	Label  string `json:"label,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Empty  bool   `json:"empty,omitempty"`   // Record is unused (all FF)
+	Issue  string `json:"issue,omitempty"`   // Why the record is not a valid application template
+	Used   string `json:"used_as,omitempty"` // "USIM" or "ISIM" when detection picked this entry
+}
+
+// ReadEFDIRRecords reads every EF_DIR record with its raw content and the parsed entry
+func ReadEFDIRRecords(reader *card.Reader) ([]EFDIRRecord, error) {
+	reader.Select([]byte{0x3F, 0x00})
+	resp, err := reader.Select([]byte{0x2F, 0x00})
+	if err != nil {
+		return nil, fmt.Errorf("failed to select EF_DIR: %w", err)
+	}
+	if !resp.IsOK() {
+		return nil, fmt.Errorf("EF_DIR not found: %s", resp.SWString())
+	}
+
+	var records []EFDIRRecord
+	for recNum := byte(1); recNum <= 20; recNum++ {
+		recResp, err := reader.ReadRecord(recNum, 0x00)
+		if err != nil || !recResp.IsOK() {
+			break
+		}
+		records = append(records, parseEFDIRRecord(int(recNum), recResp.Data))
+	}
+	return records, nil
+}
+
+// parseEFDIRRecord parses one EF_DIR record and explains what is wrong with it, if anything
+func parseEFDIRRecord(num int, data []byte) EFDIRRecord {
+	rec := EFDIRRecord{Record: num, Raw: fmt.Sprintf("%X", data)}
+	if strings.Trim(rec.Raw, "F") == "" {
+		rec.Empty = true
+		return rec
+	}
+
+	app := parseApplicationTemplate(data)
+	rec.AID = strings.ToUpper(app.AID)
+	rec.Label, rec.Path, rec.Type = app.Label, strings.ToUpper(app.Path), app.Type
+
+	nodes, err := tlv.Parse(data)
+	switch {
+	case err != nil:
+		rec.Issue = err.Error()
+	case len(nodes) == 0 || nodes[0].Tag != 0x61:
+		rec.Issue = "no application template (tag 61)"
+	case tlv.Find(nodes, 0x4F) == nil:
+		rec.Issue = "no AID (tag 4F)"
+	case len(app.AID)/2 < 5 || len(app.AID)/2 > 16:
+		rec.Issue = fmt.Sprintf("AID length %d outside 5-16 bytes", len(app.AID)/2)
+	}
+
+	switch {
+	case rec.AID == "":
+	case rec.AID == fmt.Sprintf("%X", DetectedUSIM_AID):
+		rec.Used = "USIM"
+	case rec.AID == fmt.Sprintf("%X", DetectedISIM_AID):
+		rec.Used = "ISIM"
+	}
+	return rec
+}
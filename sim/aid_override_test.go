@@ -0,0 +1,143 @@
+package sim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ AID OVERRIDE TESTS ============
+
+var testUSIMFullAID = []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02, 0xFF, 0x49, 0xFF, 0x05, 0x89}
+
+// newBrokenDIRReader returns a card whose EF_DIR record 1 declares a wrong AID length
+func newBrokenDIRReader() (*card.Reader, *card.MockCard) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	broken := append([]byte{0x61, 0x12, 0x4F, 0x14}, testUSIMFullAID...) // 4F length 20, only 12 bytes follow
+	broken = append(broken, 0x50, 0x04, 'U', 'S', 'I', 'M')
+	broken = append(broken, bytes.Repeat([]byte{0xFF}, 40-len(broken))...)
+	m.MF().AddRecordEF(0x2F00, broken, bytes.Repeat([]byte{0xFF}, 40))
+	m.AddADF(testUSIMFullAID)
+	return card.NewReaderWithTransport("Mock", m.ATR, m), m
+}
+
+func resetAIDOverrides() {
+	OverrideUSIM_AID, OverrideISIM_AID = nil, nil
+	resetISIMDetection()
+}
+
+func TestSetAIDOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		usim    string
+		isim    string
+		wantErr bool
+	}{
+		{"None", "", "", false},
+		{"Full USIM AID", "A0000000871002FF49FF0589", "", false},
+		{"Both with spaces", "A0 00 00 00 87 10 02", "A0000000871004", false},
+		{"Not hex", "A00000008710ZZ", "", true},
+		{"Too short", "", "A0000000", true},
+		{"Too long", strings.Repeat("A0", 17), "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer resetAIDOverrides()
+			err := SetAIDOverrides(tc.usim, tc.isim)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("SetAIDOverrides() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && tc.isim != "" && (len(DetectedISIMApps) != 1 || !bytes.Equal(DetectedISIMApps[0].AID, OverrideISIM_AID)) {
+				t.Errorf("DetectedISIMApps = %+v, want the override only", DetectedISIMApps)
+			}
+		})
+	}
+}
+
+func TestAIDOverride_BypassesEFDIR(t *testing.T) {
+	defer resetAIDOverrides()
+	reader, _ := newBrokenDIRReader()
+
+	if err := SetAIDOverrides("A0000000871002FF49FF0589", ""); err != nil {
+		t.Fatalf("SetAIDOverrides() error = %v", err)
+	}
+	DetectApplicationAIDs(reader)
+	if !bytes.Equal(GetUSIMAID(), testUSIMFullAID) {
+		t.Fatalf("GetUSIMAID() = %X, want override %X", GetUSIMAID(), testUSIMFullAID)
+	}
+	if _, err := SelectUSIMWithAuth(reader); err != nil {
+		t.Errorf("SelectUSIMWithAuth() error = %v", err)
+	}
+}
+
+func TestAIDOverride_NoStandardFallback(t *testing.T) {
+	defer resetAIDOverrides()
+	reader, m := newBrokenDIRReader()
+
+	if err := SetAIDOverrides("A0000000871002FF49FF9999", ""); err != nil {
+		t.Fatalf("SetAIDOverrides() error = %v", err)
+	}
+	DetectApplicationAIDs(reader)
+	m.Log = nil
+	if _, err := SelectUSIMWithAuth(reader); err == nil {
+		t.Error("SelectUSIMWithAuth() succeeded, want failure for a missing override AID")
+	}
+	for _, apdu := range m.Log {
+		if apdu[1] == 0xA4 && bytes.HasSuffix(apdu, AID_USIM) {
+			t.Errorf("standard USIM AID selected despite override: %X", apdu)
+		}
+	}
+}
+
+func TestReadEFDIRRecords(t *testing.T) {
+	defer resetAIDOverrides()
+	reader, _ := newBrokenDIRReader()
+
+	records, err := ReadEFDIRRecords(reader)
+	if err != nil {
+		t.Fatalf("ReadEFDIRRecords() error = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("ReadEFDIRRecords() = %d records, want 2", len(records))
+	}
+	if records[0].Issue == "" || !strings.HasPrefix(records[0].Raw, "61124F14") {
+		t.Errorf("record 1 = %+v, want raw hex and an issue for the broken AID length", records[0])
+	}
+	if !records[1].Empty {
+		t.Errorf("record 2 = %+v, want empty", records[1])
+	}
+}
+
+func TestParseEFDIRRecord(t *testing.T) {
+	defer resetAIDOverrides()
+	DetectedUSIM_AID = testUSIMFullAID
+
+	tests := []struct {
+		name  string
+		data  []byte
+		aid   string
+		used  string
+		issue string
+	}{
+		{"Valid USIM", dirRecord(testUSIMFullAID, "USIM"), "A0000000871002FF49FF0589", "USIM", ""},
+		{"Valid ISIM", dirRecord(testISIM1, "ISIM"), "A0000000871004FF49FF0589", "", ""},
+		{"Short AID", dirRecord([]byte{0xA0, 0x00, 0x87}, "X"), "A00087", "", "AID length 3"},
+		{"No template", []byte{0x4F, 0x02, 0xA0, 0x00, 0xFF}, "A000", "", "no application template"},
+		{"No AID", []byte{0x61, 0x03, 0x50, 0x01, 'X', 0xFF}, "", "", "no AID"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := parseEFDIRRecord(1, tc.data)
+			if rec.AID != tc.aid || rec.Used != tc.used {
+				t.Errorf("AID = %q used %q, want %q used %q", rec.AID, rec.Used, tc.aid, tc.used)
+			}
+			if !strings.Contains(rec.Issue, tc.issue) || (tc.issue == "") != (rec.Issue == "") {
+				t.Errorf("Issue = %q, want %q", rec.Issue, tc.issue)
+			}
+		})
+	}
+}
@@ -20,6 +20,12 @@ type CardInfo struct {
 	UsesGSMClass  bool                    // Card requires GSM class commands (CLA=A0)
 	ADMStatus     map[string]card.ADMInfo // Status of ADM keys
 	ATRInfo       *card.ATRInfo           // Detailed ATR analysis
+	Capabilities  *card.CardCapabilities  // Channels and buffer sizes (ATR, EF_UMPC, EF.ATR)
+	Images        []ImageInstance         // Operator logo instances listed in EF_IMG
+	OperatorIcons []OperatorIcon          // Icon links of EF_SPNI / EF_PNNI
+	AppProbes     []AppProbe              // SELECT of each EF_DIR application and the well-known AIDs
+	DIRProbe      *DIRProbe               // USIM/ISIM/CSIM probe when EF_DIR is absent
+	GPState       GPCardState             // GlobalPlatform card life cycle of the ISD
 }
 
 // ApplicationInfo describes an application on the card
@@ -43,7 +49,31 @@ type GSMData struct {
 // DetectApplicationAIDs reads EF_DIR and sets detected AIDs and paths for USIM/ISIM
 // This should be called before ReadUSIM/ReadISIM for non-standard cards
 func DetectApplicationAIDs(reader *card.Reader) {
-	apps, _ := readApplicationDirectory(reader)
+	apps, rawDir := readApplicationDirectory(reader)
+	storeDetectedApplications(apps)
+
+	// No EF_DIR: probe the well-known AIDs, a card where none answers is a classic SIM
+	DetectedDIRProbe = nil
+	if efDIRAbsent(reader, apps, rawDir) {
+		DetectedDIRProbe = probeWithoutEFDIR(reader)
+	}
+
+	// For proprietary cards that don't expose EF_DIR properly, set default DF paths
+	// so that other operations (writes, auth algo read/write) can still select ADFs.
+	if IsProprietaryCard(reader.ATRHex()) && len(apps) == 0 {
+		if len(DetectedUSIM_Path) == 0 && len(OverrideUSIM_AID) == 0 {
+			DetectedUSIM_Path = []byte{0x7F, 0xF0}
+		}
+		if len(DetectedISIM_Path) == 0 && len(OverrideISIM_AID) == 0 {
+			DetectedISIM_Path = []byte{0x7F, 0xF2}
+		}
+	}
+}
+
+// storeDetectedApplications sets the detected USIM/ISIM AIDs and paths from EF_DIR entries.
+// Every ISIM entry is recorded in DetectedISIMApps; the first one is the default ISIM.
+func storeDetectedApplications(apps []ApplicationInfo) {
+	DetectedISIMApps = nil
 	for _, app := range apps {
 		aidBytes, _ := hex.DecodeString(app.AID)
 		pathBytes, _ := hex.DecodeString(app.Path)
@@ -54,35 +84,34 @@ func DetectApplicationAIDs(reader *card.Reader) {
 			is3GPP := aidBytes[0] == 0xA0 && aidBytes[1] == 0x00 &&
 				aidBytes[2] == 0x00 && aidBytes[3] == 0x00 && aidBytes[4] == 0x87
 
-			if is3GPP {
-				// Check if it's USIM (3GPP RID + app code 1002)
-				if aidBytes[5] == 0x10 && aidBytes[6] == 0x02 {
-					DetectedUSIM_AID = aidBytes
-					if len(pathBytes) >= 2 {
-						DetectedUSIM_Path = pathBytes
-					}
-				}
-				// Check if it's ISIM (3GPP RID + app code 1004)
-				if aidBytes[5] == 0x10 && aidBytes[6] == 0x04 {
-					DetectedISIM_AID = aidBytes
-					if len(pathBytes) >= 2 {
-						DetectedISIM_Path = pathBytes
-					}
+			// Check if it's USIM (3GPP RID + app code 1002)
+			if is3GPP && aidBytes[5] == 0x10 && aidBytes[6] == 0x02 {
+				DetectedUSIM_AID = aidBytes
+				if len(pathBytes) >= 2 {
+					DetectedUSIM_Path = pathBytes
 				}
 			}
 		}
-	}
 
-	// For proprietary cards that don't expose EF_DIR properly, set default DF paths
-	// so that other operations (writes, auth algo read/write) can still select ADFs.
-	if IsProprietaryCard(reader.ATRHex()) && len(apps) == 0 {
-		if len(DetectedUSIM_Path) == 0 {
-			DetectedUSIM_Path = []byte{0x7F, 0xF0}
+		if isISIMApplication(aidBytes, app.Label) {
+			DetectedISIMApps = append(DetectedISIMApps, ISIMApp{
+				Index: len(DetectedISIMApps) + 1,
+				AID:   aidBytes,
+				Label: app.Label,
+				Path:  pathBytes,
+			})
 		}
-		if len(DetectedISIM_Path) == 0 {
-			DetectedISIM_Path = []byte{0x7F, 0xF2}
+	}
+
+	if len(DetectedISIMApps) > 0 && SelectedISIMIndex == 0 {
+		DetectedISIM_AID = DetectedISIMApps[0].AID
+		if len(DetectedISIMApps[0].Path) >= 2 {
+			DetectedISIM_Path = DetectedISIMApps[0].Path
 		}
 	}
+
+	// --usim-aid / --isim-aid take precedence over EF_DIR
+	applyAIDOverrides()
 }
 
 // AnalyzeCard performs comprehensive card analysis
@@ -93,7 +122,7 @@ func AnalyzeCard(reader *card.Reader, checkADM bool) (*CardInfo, error) {
 	}
 
 	// Detailed ATR analysis
-	info.ATRInfo, _ = card.DecodeATR(reader.ATR())
+	info.ATRInfo, _ = card.ParseATR(reader.ATR())
 
 	// Detect card driver
 	drv := FindDriver(reader)
@@ -115,7 +144,14 @@ func AnalyzeCard(reader *card.Reader, checkADM bool) (*CardInfo, error) {
 	}
 
 	// Detailed ATR analysis
-	info.ATRInfo, _ = card.DecodeATR(reader.ATR())
+	info.ATRInfo, _ = card.ParseATR(reader.ATR())
+
+	// Card capabilities (logical channels, extended length, buffer sizes)
+	if info.UsesGSMClass {
+		info.Capabilities = reader.Capabilities()
+	} else {
+		info.Capabilities = reader.DetectCapabilities()
+	}
 
 	// Try to read EF_DIR to find applications
 	apps, rawDir := readApplicationDirectoryWithGSMFallback(reader, info.UsesGSMClass)
@@ -123,33 +159,18 @@ func AnalyzeCard(reader *card.Reader, checkADM bool) (*CardInfo, error) {
 	info.RawDIR = rawDir
 
 	// Store detected AIDs and paths for later use
-	for _, app := range apps {
-		aidBytes, _ := hex.DecodeString(app.AID)
-		pathBytes, _ := hex.DecodeString(app.Path)
+	storeDetectedApplications(apps)
 
-		if len(aidBytes) >= 7 {
-			// Check for 3GPP RID: A0 00 00 00 87
-			// This distinguishes USIM/ISIM from CSIM (A0 00 00 03 43)
-			is3GPP := aidBytes[0] == 0xA0 && aidBytes[1] == 0x00 &&
-				aidBytes[2] == 0x00 && aidBytes[3] == 0x00 && aidBytes[4] == 0x87
+	// No EF_DIR: probe the well-known AIDs, a card where none answers is a classic SIM
+	DetectedDIRProbe = nil
+	if efDIRAbsent(reader, apps, rawDir) {
+		DetectedDIRProbe = probeWithoutEFDIR(reader)
+		info.DIRProbe = DetectedDIRProbe
+	}
 
-			if is3GPP {
-				// Check if it's USIM (3GPP RID + app code 1002)
-				if aidBytes[5] == 0x10 && aidBytes[6] == 0x02 {
-					DetectedUSIM_AID = aidBytes
-					if len(pathBytes) >= 2 {
-						DetectedUSIM_Path = pathBytes
-					}
-				}
-				// Check if it's ISIM (3GPP RID + app code 1004)
-				if aidBytes[5] == 0x10 && aidBytes[6] == 0x04 {
-					DetectedISIM_AID = aidBytes
-					if len(pathBytes) >= 2 {
-						DetectedISIM_Path = pathBytes
-					}
-				}
-			}
-		}
+	// Select each application (and hidden well-known ones) to see which really answer
+	if !info.UsesGSMClass {
+		info.AppProbes = ProbeApplications(reader, apps)
 	}
 
 	// For cards without EF_DIR entries, set default paths
@@ -165,6 +186,17 @@ func AnalyzeCard(reader *card.Reader, checkADM bool) (*CardInfo, error) {
 		info.GSMData = gsmData
 	}
 
+	// Operator logo (DF_GRAPHICS) and the icons of the SPN / network names
+	if !info.UsesGSMClass {
+		info.Images, _ = ReadImageInstances(reader)
+		info.OperatorIcons = ReadOperatorIcons(reader)
+	}
+
+	// GlobalPlatform card life cycle (CARD_LOCKED and TERMINATED refuse most GP commands)
+	if !info.UsesGSMClass {
+		info.GPState = DetectGPCardState(reader, nil)
+	}
+
 	// Check available ADM levels (only if requested - sends VERIFY with Lc=0)
 	if checkADM {
 		info.ADMStatus = reader.GetAllADMStatus()
@@ -353,12 +385,13 @@ func readGSMSIMWithFallback(reader *card.Reader, useGSM bool) (*GSMData, error)
 		if len(imsiData) > 0 {
 			data.IMSI = DecodeIMSI(imsiData)
 			data.RawIMSI = imsiData
-			if len(data.IMSI) >= 5 {
-				data.HPLMN = data.IMSI[:5]
-			}
 		}
 	}
 
+	// HPLMN from IMSI, with the MNC length from EF_AD
+	mcc, mnc := SplitIMSI(data.IMSI, readGSMMNCLength(reader, useGSM))
+	data.HPLMN = mcc + mnc
+
 	// Read EF_SPN (6F46)
 	if useGSM {
 		resp, err = reader.SelectGSM([]byte{0x6F, 0x46})
@@ -479,6 +512,29 @@ func identifyAID(aid []byte) string {
 	return "Unknown"
 }
 
+// readGSMMNCLength reads the MNC length from EF_AD in DF_GSM (0 if absent or not set)
+func readGSMMNCLength(reader *card.Reader, useGSM bool) int {
+	var resp *card.APDUResponse
+	var err error
+	if useGSM {
+		resp, err = reader.SelectGSM([]byte{0x6F, 0xAD})
+	} else {
+		resp, err = reader.Select([]byte{0x6F, 0xAD})
+	}
+	if err != nil || !resp.IsOK() {
+		return 0
+	}
+	if useGSM {
+		resp, err = reader.ReadBinaryGSM(0, 4)
+	} else {
+		resp, err = reader.ReadBinary(0, 4)
+	}
+	if err != nil || !resp.IsOK() {
+		return 0
+	}
+	return DecodeAD(resp.Data).MNCLength
+}
+
 // readGSMSIM tries to read data as 2G GSM SIM (without USIM app)
 func readGSMSIM(reader *card.Reader) (*GSMData, error) {
 	data := &GSMData{}
@@ -502,13 +558,13 @@ func readGSMSIM(reader *card.Reader) (*GSMData, error) {
 		if err == nil {
 			data.IMSI = DecodeIMSI(imsiData)
 			data.RawIMSI = imsiData
-			// Extract HPLMN from IMSI
-			if len(data.IMSI) >= 5 {
-				data.HPLMN = data.IMSI[:5]
-			}
 		}
 	}
 
+	// Extract HPLMN from IMSI, with the MNC length from EF_AD
+	mcc, mnc := SplitIMSI(data.IMSI, readGSMMNCLength(reader, false))
+	data.HPLMN = mcc + mnc
+
 	// Read EF_SPN (6F46)
 	resp, err = reader.Select([]byte{0x6F, 0x46})
 	if err == nil && resp.IsOK() {
@@ -0,0 +1,184 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/tlv"
+)
+
+// AID_CSIM is the 3GPP2 CSIM application (RID A000000343, application code 1002)
+var AID_CSIM = []byte{0xA0, 0x00, 0x00, 0x03, 0x43, 0x10, 0x02}
+
+// Sources of a probed application
+const (
+	AppSourceEFDIR     = "EF_DIR"
+	AppSourceWellKnown = "well-known"
+)
+
+// wellKnownAIDs are probed even when EF_DIR does not list them: applications hidden from
+// EF_DIR still answer SELECT, which matters in security reviews
+var wellKnownAIDs = []struct {
+	Name string
+	AID  []byte
+}{
+	{"ARA-M", GP_ARAM_AID},
+	{"ISD-R", isdRAID},
+	{"CSIM", AID_CSIM},
+}
+
+// AppProbe is the result of selecting one application by AID
+type AppProbe struct {
+	AID        string   `json:"aid"`
+	Name       string   `json:"name,omitempty"` // EF_DIR label, or the name of a well-known AID
+	Type       string   `json:"type"`
+	Source     string   `json:"source"` // AppSourceEFDIR or AppSourceWellKnown
+	Selectable bool     `json:"selectable"`
+	SW         uint16   `json:"sw"`
+	Status     string   `json:"status"`
+	DFName     string   `json:"df_name,omitempty"` // tag 84 of the FCP/FCI
+	Label      string   `json:"label,omitempty"`   // application label (50) of the FCI
+	PINs       []string `json:"pins,omitempty"`    // PIN status template, e.g. "PIN1 enabled"
+	Duplicate  bool     `json:"duplicate,omitempty"`
+	Issues     []string `json:"issues,omitempty"`
+}
+
+// ProbeApplications selects every EF_DIR application and the well-known AIDs missing from
+// EF_DIR and records the status word and the FCP/FCI of each. The probes run on a separate
+// logical channel when the card has one, so the selection and security state of the basic
+// channel are kept; otherwise the MF is selected again afterwards. GSM-class cards are not
+// probed.
+func ProbeApplications(reader *card.Reader, apps []ApplicationInfo) []AppProbe {
+	if UseGSMCommands {
+		return nil
+	}
+
+	var probes []AppProbe
+	opened, _ := withLogicalChannel(reader, "probe", func() error {
+		seen := make(map[string]bool)
+		for _, app := range apps {
+			aid, err := hex.DecodeString(app.AID)
+			if err != nil || len(aid) == 0 {
+				continue
+			}
+			p := probeApplication(reader, aid)
+			p.Name, p.Source = app.Label, AppSourceEFDIR
+			if seen[p.AID] {
+				p.Duplicate = true
+				p.Issues = append(p.Issues, "listed more than once in EF_DIR")
+			}
+			seen[p.AID] = true
+			if !p.Selectable {
+				p.Issues = append(p.Issues, fmt.Sprintf("listed in EF_DIR but not selectable (%s)", p.Status))
+			}
+			p.Issues = append(p.Issues, applicationMismatches(aid, app.Label, p)...)
+			probes = append(probes, p)
+		}
+
+		for _, known := range wellKnownAIDs {
+			if listedInEFDIR(apps, known.AID) {
+				continue
+			}
+			p := probeApplication(reader, known.AID)
+			p.Name, p.Source = known.Name, AppSourceWellKnown
+			probes = append(probes, p)
+		}
+		return nil
+	})
+	if !opened {
+		reader.Select([]byte{0x3F, 0x00})
+	}
+	return probes
+}
+
+// probeApplication sends SELECT by AID and decodes the response
+func probeApplication(reader *card.Reader, aid []byte) AppProbe {
+	p := AppProbe{AID: strings.ToUpper(hex.EncodeToString(aid)), Type: identifyAID(aid)}
+	resp, err := reader.Select(aid)
+	if err != nil {
+		p.Status = err.Error()
+		return p
+	}
+	p.SW, p.Status = resp.SW(), resp.SWString()
+	// 62xx/63xx: selected with a warning, e.g. a deactivated application
+	p.Selectable = resp.IsOK() || resp.SW1 == 0x62 || resp.SW1 == 0x63
+	if !p.Selectable || len(resp.Data) == 0 {
+		return p
+	}
+
+	switch resp.Data[0] {
+	case 0x62: // FCP template of a UICC application
+		f, _ := card.ParseFCP(resp.Data)
+		if len(f.DFName) > 0 {
+			p.DFName = fmt.Sprintf("%X", f.DFName)
+		}
+		for _, pin := range f.PINs() {
+			state := "disabled"
+			if pin.Enabled {
+				state = "enabled"
+			}
+			p.PINs = append(p.PINs, card.KeyRefName(pin.Reference)+" "+state)
+		}
+	case 0x6F: // FCI template of a Java Card / GlobalPlatform application
+		nodes, _ := tlv.Parse(resp.Data)
+		if n := tlv.Find(nodes, 0x84); n != nil {
+			p.DFName = fmt.Sprintf("%X", n.Value)
+		}
+		if n := tlv.Find(nodes, 0x50); n != nil {
+			p.Label = strings.TrimRight(string(n.Value), "\x00\xFF")
+		}
+	}
+	return p
+}
+
+// applicationMismatches compares the EF_DIR entry with the AID kind and the SELECT response
+func applicationMismatches(aid []byte, label string, p AppProbe) []string {
+	var issues []string
+	kind := applicationKind(aid)
+	for _, k := range []string{"USIM", "ISIM", "CSIM"} {
+		if kind != "" && kind != k && strings.Contains(strings.ToUpper(label), k) {
+			issues = append(issues, fmt.Sprintf("label %q says %s but the AID is a %s AID", label, k, kind))
+		}
+	}
+	if p.DFName != "" {
+		dfName, _ := hex.DecodeString(p.DFName)
+		if !bytes.HasPrefix(dfName, aid) && !bytes.HasPrefix(aid, dfName) {
+			issues = append(issues, fmt.Sprintf("DF name %s of the response differs from the EF_DIR AID", p.DFName))
+		}
+	}
+	if p.Label != "" && label != "" && p.Label != label {
+		issues = append(issues, fmt.Sprintf("FCI label %q differs from the EF_DIR label %q", p.Label, label))
+	}
+	return issues
+}
+
+// applicationKind returns USIM, ISIM or CSIM from the RID and application code of an AID
+func applicationKind(aid []byte) string {
+	if len(aid) < 7 {
+		return ""
+	}
+	code := uint16(aid[5])<<8 | uint16(aid[6])
+	switch {
+	case bytes.Equal(aid[:5], AID_USIM[:5]) && code == 0x1002:
+		return "USIM"
+	case bytes.Equal(aid[:5], AID_USIM[:5]) && code == 0x1004:
+		return "ISIM"
+	case bytes.Equal(aid[:5], AID_CSIM[:5]) && code == 0x1002:
+		return "CSIM"
+	}
+	return ""
+}
+
+// listedInEFDIR reports whether an EF_DIR entry has the AID (or a longer AID starting with it)
+func listedInEFDIR(apps []ApplicationInfo, aid []byte) bool {
+	for _, app := range apps {
+		listed, err := hex.DecodeString(app.AID)
+		if err == nil && len(listed) > 0 && (bytes.HasPrefix(listed, aid) || bytes.HasPrefix(aid, listed)) {
+			return true
+		}
+	}
+	return false
+}
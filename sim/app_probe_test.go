@@ -0,0 +1,110 @@
+package sim
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ APPLICATION PROBE TESTS ============
+
+var testUSIMLabelledISIM = []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02, 0xFF, 0x49, 0xFF, 0x05, 0x99}
+
+// newAppProbeTestCard returns a card whose EF_DIR lists the USIM twice, an ISIM that is not
+// on the card and a USIM AID labelled ISIM; ARA-M is on the card but not in EF_DIR
+func newAppProbeTestCard(channels int) *card.MockCard {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.Channels = channels
+	m.MF().AddRecordEF(0x2F00,
+		dirRecord(AID_USIM, "USIM"),
+		dirRecord(AID_USIM, "USIM"),
+		dirRecord(testISIM1, "ISIM"),
+		dirRecord(testUSIMLabelledISIM, "ISIM"))
+	m.AddADF(AID_USIM).AddEF(0x6F07, make([]byte, 9))
+	m.AddADF(testUSIMLabelledISIM)
+	m.AddADF(GP_ARAM_AID)
+	return m
+}
+
+func findProbe(probes []AppProbe, aid []byte, source string) *AppProbe {
+	for i := range probes {
+		if probes[i].AID == fmt.Sprintf("%X", aid) && probes[i].Source == source {
+			return &probes[i]
+		}
+	}
+	return nil
+}
+
+func TestProbeApplications(t *testing.T) {
+	defer resetISIMDetection()
+	m := newAppProbeTestCard(4)
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	apps, _ := readApplicationDirectory(reader)
+
+	// The basic channel keeps ADF_USIM selected while the probes run on channel 1
+	if resp, err := reader.Select(AID_USIM); err != nil || !resp.IsOK() {
+		t.Fatalf("select USIM: %v %v", resp, err)
+	}
+	probes := ProbeApplications(reader, apps)
+	if reader.Channel() != 0 {
+		t.Errorf("reader left on channel %d", reader.Channel())
+	}
+	if resp, err := reader.Select([]byte{0x6F, 0x07}); err != nil || !resp.IsOK() {
+		t.Errorf("EF_IMSI not selectable after the probe: the basic channel lost ADF_USIM")
+	}
+
+	if len(probes) != 7 {
+		t.Fatalf("got %d probes, want 4 EF_DIR entries and 3 well-known AIDs: %+v", len(probes), probes)
+	}
+	usim, dup := probes[0], probes[1]
+	if !usim.Selectable || usim.Duplicate || len(usim.Issues) != 0 || usim.DFName == "" {
+		t.Errorf("USIM probe = %+v, want selectable without issues and with a DF name", usim)
+	}
+	if !dup.Duplicate || len(dup.Issues) != 1 {
+		t.Errorf("second USIM entry = %+v, want flagged as duplicate", dup)
+	}
+	if isim := probes[2]; isim.Selectable || isim.SW != card.SW_FILE_NOT_FOUND || len(isim.Issues) != 1 ||
+		!strings.Contains(isim.Issues[0], "not selectable") {
+		t.Errorf("ISIM probe = %+v, want listed but not selectable (6A82)", isim)
+	}
+	if mislabelled := probes[3]; !mislabelled.Selectable || len(mislabelled.Issues) != 1 ||
+		!strings.Contains(mislabelled.Issues[0], `says ISIM but the AID is a USIM AID`) {
+		t.Errorf("mislabelled probe = %+v, want a label mismatch", mislabelled)
+	}
+
+	if p := findProbe(probes, GP_ARAM_AID, AppSourceWellKnown); p == nil || !p.Selectable || p.Name != "ARA-M" {
+		t.Errorf("ARA-M probe = %+v, want the hidden ARA-M reported as selectable", p)
+	}
+	for _, aid := range [][]byte{isdRAID, AID_CSIM} {
+		if p := findProbe(probes, aid, AppSourceWellKnown); p == nil || p.Selectable || len(p.Issues) != 0 {
+			t.Errorf("probe %X = %+v, want not selectable without issues", aid, p)
+		}
+	}
+}
+
+func TestProbeApplications_NoLogicalChannels(t *testing.T) {
+	defer resetISIMDetection()
+	m := newAppProbeTestCard(0)
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	apps, _ := readApplicationDirectory(reader)
+
+	probes := ProbeApplications(reader, apps)
+	if len(probes) != 7 || !probes[0].Selectable {
+		t.Fatalf("probes = %+v", probes)
+	}
+	// Probed on the basic channel: the MF is selected again afterwards
+	if resp, err := reader.Select([]byte{0x2F, 0x00}); err != nil || !resp.IsOK() {
+		t.Errorf("EF_DIR not selectable after the probe: MF was not selected again")
+	}
+}
+
+func TestProbeApplications_GSMClass(t *testing.T) {
+	UseGSMCommands = true
+	defer func() { UseGSMCommands = false }()
+	m := newAppProbeTestCard(4)
+	if probes := ProbeApplications(card.NewReaderWithTransport("Mock", m.ATR, m), []ApplicationInfo{{AID: "a0000000871002"}}); probes != nil {
+		t.Errorf("GSM-class card probed: %+v", probes)
+	}
+}
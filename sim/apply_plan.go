@@ -0,0 +1,445 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// ApplyConfig resolves every section of a config against the card before writing: the
+// file it updates must exist, the application must be there and the programmable driver
+// must have the capability. Unsupported sections are skipped unless the config marks
+// them required, in which case nothing is written at all.
+
+// PlanAction is what ApplyConfig does with one config section
+type PlanAction string
+
+const (
+	PlanApply           PlanAction = "apply"
+	PlanSkipUnsupported PlanAction = "skip-unsupported"
+	PlanFailRequired    PlanAction = "fail-required"
+)
+
+// PlanStep is one config section resolved against the card
+type PlanStep struct {
+	Name     string     `json:"name"`
+	Section  string     `json:"section"` // config key (imsi, oplmn, isim, ...)
+	Action   PlanAction `json:"action"`
+	Required bool       `json:"required,omitempty"`
+	Reason   string     `json:"reason,omitempty"` // missing file, application or capability; a note for applied steps
+}
+
+// ApplyPlan is the feature resolution of a config, built before anything is written
+type ApplyPlan struct {
+	Steps []PlanStep `json:"steps"`
+}
+
+// Count returns the number of steps with action
+func (p *ApplyPlan) Count(action PlanAction) int {
+	n := 0
+	for _, s := range p.Steps {
+		if s.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Err returns an error listing the required sections the card does not support, or nil
+func (p *ApplyPlan) Err() error {
+	var missing []string
+	for _, s := range p.Steps {
+		if s.Action == PlanFailRequired {
+			missing = append(missing, fmt.Sprintf("%s: %s", s.Name, s.Reason))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("required sections not supported by the card, nothing written:\n  - %s", joinErrors(missing))
+}
+
+// print prints one summary line and a line per step that is not applied or has a note
+func (p *ApplyPlan) print() {
+	fmt.Printf("Plan: %d to apply, %d unsupported, %d required but unsupported\n",
+		p.Count(PlanApply), p.Count(PlanSkipUnsupported), p.Count(PlanFailRequired))
+	for _, s := range p.Steps {
+		switch {
+		case s.Action == PlanSkipUnsupported:
+			fmt.Printf("  – %s: skipped, %s\n", s.Name, s.Reason)
+		case s.Action == PlanFailRequired:
+			fmt.Printf("  ✗ %s: required, %s\n", s.Name, s.Reason)
+		case s.Reason != "":
+			fmt.Printf("  ⚠ %s: %s\n", s.Name, s.Reason)
+		}
+	}
+}
+
+// Config sections that "required" can name (the JSON keys)
+var requirableSections = []string{
+	"imsi", "spn", "psismsc", "sms", "mnc", "operation_mode", "clear_fplmn",
+	"hplmn", "oplmn", "user_plmn", "services", "isim",
+}
+
+// validateRequired checks the section names of the top-level "required" list
+func (c *SIMConfig) validateRequired() error {
+	for _, name := range c.Required {
+		found := false
+		for _, s := range requirableSections {
+			found = found || s == name
+		}
+		if !found {
+			return fmt.Errorf("required: unknown section %q (%s)", name, strings.Join(requirableSections, ", "))
+		}
+	}
+	return nil
+}
+
+// sectionRequired reports whether the config marks section as required, in the top-level
+// list or with "required": true inside the section
+func (c *SIMConfig) sectionRequired(section string) bool {
+	for _, name := range c.Required {
+		if name == section {
+			return true
+		}
+	}
+	switch section {
+	case "sms":
+		return c.SMS != nil && c.SMS.Required
+	case "services":
+		return c.Services != nil && c.Services.Required
+	case "isim":
+		return c.ISIM != nil && c.ISIM.Required
+	case "programmable":
+		// Keys and codes are never skipped silently
+		return true
+	}
+	return false
+}
+
+// applyRun is the state shared by the steps of one ApplyConfig
+type applyRun struct {
+	reader *card.Reader
+	config *SIMConfig
+	drv    ProgrammableDriver
+	dryRun bool
+	force  bool
+	report *ApplyReport
+
+	usim        *USIMData // nil when not read or unreadable
+	isim        *ISIMData // nil when not read, unreadable or not available
+	isimMissing bool      // the card has no ISIM application
+}
+
+// applyStep is one section of the config: check returns why the card cannot take it
+// (supported false) or a note (supported true); apply writes it
+type applyStep struct {
+	name    string
+	section string
+	check   func(r *applyRun) (reason string, supported bool)
+	apply   func(r *applyRun)
+}
+
+// usimFile is the check of a step writing EF ef of the USIM. A file not selected because
+// its service is not available is still written, with a note.
+func usimFile(ef string) func(r *applyRun) (string, bool) {
+	return func(r *applyRun) (string, bool) {
+		if r.usim == nil {
+			return "", true // unknown: the write reports the error
+		}
+		st, ok := r.usim.Files[ef]
+		switch {
+		case !ok:
+			return "", true
+		case st.State == EFAbsent:
+			return ef + " not on the card", false
+		case st.State == EFSkipped:
+			return fmt.Sprintf("UST service %d not available, the UE ignores %s", st.Service, ef), true
+		}
+		return "", true
+	}
+}
+
+// isimFile is the check of a step writing EF ef of the ISIM
+func isimFile(ef string) func(r *applyRun) (string, bool) {
+	return func(r *applyRun) (string, bool) {
+		if r.isimMissing {
+			return "no ISIM application", false
+		}
+		if r.isim != nil && r.isim.Files.Absent(ef) {
+			return ef + " not on the card", false
+		}
+		return "", true
+	}
+}
+
+// checkProgrammable is the check of the programmable step: a driver for keys and codes,
+// and the driver capabilities for the card-specific settings
+func checkProgrammable(r *applyRun) (string, bool) {
+	c := r.config
+	if c.RequiresProgrammableCard() && r.drv == nil && !r.force {
+		return "card is not recognized as programmable. Use --force to override (DANGEROUS!)", false
+	}
+	pc := c.Programmable
+	if !pc.hasCardSettings() || r.drv == nil {
+		return "", true
+	}
+	if _, ok := r.drv.(SQNConfigProvider); pc.SQN != nil && (!ok || !HasCapability(r.drv, CapSQNConfig)) {
+		return fmt.Sprintf("%s does not support SQN parameters", r.drv.Name()), false
+	}
+	if _, ok := r.drv.(OTAKeyProvider); len(pc.OTAKeys) > 0 && (!ok || !HasCapability(r.drv, CapOTAKeys)) {
+		return fmt.Sprintf("%s does not support OTA key files", r.drv.Name()), false
+	}
+	return "", true
+}
+
+// applySteps returns the steps of the config in write order: programmable fields first,
+// then the USIM files, the ISIM files and the service tables
+func (c *SIMConfig) applySteps() []applyStep {
+	var steps []applyStep
+	add := func(name, section string, check func(*applyRun) (string, bool), apply func(*applyRun)) {
+		steps = append(steps, applyStep{name: name, section: section, check: check, apply: apply})
+	}
+
+	if c.HasProgrammableFields() || c.ICCID != "" || c.MSISDN != "" || c.ACCHex != "" {
+		add("Programmable card", "programmable", checkProgrammable, func(r *applyRun) {
+			applyProgrammableFields(r.reader, r.config, r.drv, r.dryRun, r.force, r.report)
+		})
+	}
+
+	if c.IMSI != "" {
+		add("IMSI", "imsi", usimFile("EF_IMSI"), func(r *applyRun) {
+			if r.usim != nil && r.usim.IMSI == c.IMSI {
+				r.report.unchanged("IMSI")
+			} else if err := WriteIMSI(r.reader, c.IMSI); err != nil {
+				r.report.failed(r.reader, "IMSI", err)
+			} else {
+				r.report.applied("IMSI", c.IMSI)
+			}
+		})
+	}
+
+	if c.SPN != "" {
+		add("SPN", "spn", usimFile("EF_SPN"), func(r *applyRun) {
+			u := r.usim
+			if u != nil && u.SPN == c.SPN && len(u.RawFiles["EF_SPN"]) > 0 && u.RawFiles["EF_SPN"][0] == 0x00 {
+				r.report.unchanged("SPN")
+			} else if err := WriteSPN(r.reader, c.SPN, 0x00); err != nil {
+				r.report.failed(r.reader, "SPN", err)
+			} else {
+				r.report.applied("SPN", c.SPN)
+			}
+		})
+	}
+
+	if c.PSISMSC != "" {
+		add("PSI SMSC", "psismsc", usimFile("EF_PSISMSC"), func(r *applyRun) {
+			if r.usim != nil && r.usim.PSISMSC == c.PSISMSC {
+				r.report.unchanged("PSI SMSC")
+			} else if err := WritePSISMSC(r.reader, c.PSISMSC); err != nil {
+				r.report.failed(r.reader, "PSI SMSC", err)
+			} else {
+				r.report.applied("PSI SMSC", c.PSISMSC)
+			}
+		})
+	}
+
+	if c.SMS != nil {
+		add("SMS parameters", "sms", usimFile("EF_SMSP"), func(r *applyRun) {
+			if params, err := c.SMS.Params(); err != nil {
+				r.report.failed(nil, "SMS parameters", err)
+			} else if r.usim != nil && r.usim.SMSP.covers(params) {
+				r.report.unchanged("SMS parameters")
+			} else if err := WriteSMSP(r.reader, params); err != nil {
+				r.report.failed(r.reader, "SMS parameters", err)
+			} else {
+				r.report.applied("SMS parameters", params.String())
+			}
+		})
+	}
+
+	if mncLen := len(c.MNC); mncLen >= 2 && mncLen <= 3 {
+		add("MNC length", "mnc", usimFile("EF_AD"), func(r *applyRun) {
+			if r.usim != nil && r.usim.AdminData.MNCLength == mncLen {
+				r.report.unchanged("MNC length")
+			} else if err := UpdateMNCLength(r.reader, mncLen); err != nil {
+				r.report.failed(r.reader, "MNC length", err)
+			} else {
+				r.report.applied("MNC length", fmt.Sprintf("%d", mncLen))
+			}
+		})
+	}
+
+	if c.OperationMode != "" {
+		add("Operation mode", "operation_mode", usimFile("EF_AD"), func(r *applyRun) {
+			mode, modeErr := ParseOperationMode(c.OperationMode)
+			if modeErr == nil && r.usim != nil && len(r.usim.RawFiles["EF_AD"]) > 0 && r.usim.RawFiles["EF_AD"][0] == mode {
+				r.report.unchanged("Operation mode")
+			} else if err := SetOperationModeFromString(r.reader, c.OperationMode); err != nil {
+				r.report.failed(r.reader, "Operation mode", err)
+			} else {
+				r.report.applied("Operation mode", c.OperationMode)
+			}
+		})
+	}
+
+	if c.ClearFPLMN {
+		add("Clear FPLMN", "clear_fplmn", usimFile("EF_FPLMN"), func(r *applyRun) {
+			if r.usim != nil && r.usim.RawFiles["EF_FPLMN"] != nil && len(r.usim.FPLMN) == 0 {
+				r.report.unchanged("Clear FPLMN")
+			} else if err := ClearForbiddenPLMN(r.reader); err != nil {
+				r.report.failed(r.reader, "Clear FPLMN", err)
+			} else {
+				r.report.applied("Clear FPLMN", "forbidden PLMN list cleared")
+			}
+		})
+	}
+
+	// HPLMN, Operator PLMN and User Controlled PLMN lists
+	plmnLists := []struct {
+		name    string
+		section string
+		ef      string
+		config  []HPLMNConfig
+		current func(*USIMData) []PLMNwACT
+		write   func(*card.Reader, []HPLMNEntry) error
+	}{
+		{"HPLMN", "hplmn", "EF_HPLMNwACT", c.HPLMN, func(d *USIMData) []PLMNwACT { return d.HPLMN }, WriteHPLMNList},
+		{"OPLMN", "oplmn", "EF_OPLMNwACT", c.OPLMN, func(d *USIMData) []PLMNwACT { return d.OPLMN }, WriteOPLMNList},
+		{"User PLMN", "user_plmn", "EF_PLMNwACT", c.UserPLMN, func(d *USIMData) []PLMNwACT { return d.UserPLMN }, WriteUserPLMNList},
+	}
+	for _, l := range plmnLists {
+		if len(l.config) == 0 {
+			continue
+		}
+		add(l.name, l.section, usimFile(l.ef), func(r *applyRun) {
+			entries := plmnEntriesFromConfig(l.config)
+			if r.usim != nil && samePLMNList(l.current(r.usim), entries) {
+				r.report.unchanged(l.name)
+			} else if err := l.write(r.reader, entries); err != nil {
+				r.report.failed(r.reader, l.name, err)
+			} else {
+				r.report.applied(l.name, fmt.Sprintf("%d entries", len(entries)))
+			}
+		})
+	}
+
+	if c.Services != nil && len(usimServiceFlags(c.Services)) > 0 {
+		add("USIM services", "services", usimFile("EF_UST"), func(r *applyRun) {
+			var current map[int]bool
+			if r.usim != nil {
+				current = r.usim.UST
+			}
+			applyUSIMServices(r.reader, c.Services, current, r.report)
+		})
+	}
+
+	if c.ISIM != nil {
+		c.ISIM.addSteps(add)
+		if c.Services != nil && len(isimServiceFlags(c.Services)) > 0 {
+			add("ISIM services", "services", isimFile("EF_IST"), func(r *applyRun) {
+				var current map[int]bool
+				if r.isim != nil {
+					current = r.isim.IST
+				}
+				applyISIMServices(r.reader, c.Services, current, r.report)
+			})
+		}
+	}
+	return steps
+}
+
+// addSteps adds a step per ISIM file written (one per IMPU and P-CSCF record)
+func (isim *ISIMConfig) addSteps(add func(string, string, func(*applyRun) (string, bool), func(*applyRun))) {
+	if isim.IMPI != "" {
+		add("IMPI", "isim", isimFile("EF_IMPI"), func(r *applyRun) {
+			if r.isim != nil && r.isim.IMPI == isim.IMPI {
+				r.report.unchanged("IMPI")
+			} else if err := WriteIMPI(r.reader, isim.IMPI); err != nil {
+				r.report.failed(r.reader, "IMPI", err)
+			} else {
+				r.report.applied("IMPI", isim.IMPI)
+			}
+		})
+	}
+
+	for i, impu := range isim.IMPU {
+		name := fmt.Sprintf("IMPU %d", i+1)
+		add(name, "isim", isimFile("EF_IMPU"), func(r *applyRun) {
+			if r.isim != nil && i < len(r.isim.IMPU) && r.isim.IMPU[i] == impu {
+				r.report.unchanged(name)
+			} else if err := WriteIMPURecord(r.reader, impu, byte(i+1)); err != nil {
+				r.report.failed(r.reader, name, err)
+			} else {
+				r.report.applied(name, impu)
+			}
+		})
+	}
+
+	if isim.Domain != "" {
+		add("Domain", "isim", isimFile("EF_DOMAIN"), func(r *applyRun) {
+			if r.isim != nil && r.isim.Domain == isim.Domain {
+				r.report.unchanged("Domain")
+			} else if err := WriteDomain(r.reader, isim.Domain); err != nil {
+				r.report.failed(r.reader, "Domain", err)
+			} else {
+				r.report.applied("Domain", isim.Domain)
+			}
+		})
+	}
+
+	for i, pcscf := range isim.PCSCF {
+		name := fmt.Sprintf("P-CSCF %d", i+1)
+		add(name, "isim", isimFile("EF_PCSCF"), func(r *applyRun) {
+			if r.isim != nil && i < len(r.isim.PCSCF) && r.isim.PCSCF[i] == pcscf {
+				r.report.unchanged(name)
+			} else if err := WritePCSCFRecord(r.reader, pcscf, byte(i+1)); err != nil {
+				r.report.failed(r.reader, name, err)
+			} else {
+				r.report.applied(name, pcscf)
+			}
+		})
+	}
+}
+
+// readCurrent reads the USIM and ISIM before the plan is resolved, so that unsupported
+// sections are known and unchanged items can be skipped
+func (r *applyRun) readCurrent() {
+	c := r.config
+	if c.hasUSIMFields() {
+		if data, err := ReadUSIM(r.reader); err == nil {
+			r.usim = data
+		}
+	}
+	if c.ISIM != nil {
+		WithISIMChannel(r.reader, func() error {
+			data, err := ReadISIM(r.reader)
+			switch {
+			case err == nil && data.Available:
+				r.isim = data
+			case errors.Is(err, ErrClassicSIM), data != nil && !data.Available:
+				r.isimMissing = true
+			}
+			return err
+		})
+	}
+}
+
+// resolve classifies every step against the card
+func (r *applyRun) resolve(steps []applyStep) *ApplyPlan {
+	plan := &ApplyPlan{}
+	for _, s := range steps {
+		reason, supported := s.check(r)
+		step := PlanStep{Name: s.name, Section: s.section, Action: PlanApply, Required: r.config.sectionRequired(s.section), Reason: reason}
+		if !supported {
+			step.Action = PlanSkipUnsupported
+			if step.Required {
+				step.Action = PlanFailRequired
+			}
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	return plan
+}
@@ -0,0 +1,150 @@
+package sim
+
+import (
+	"fmt"
+
+	"sim_reader/card"
+)
+
+// ApplyStatus is the outcome of a single ApplyConfig item
+type ApplyStatus string
+
+const (
+	ApplyApplied   ApplyStatus = "applied"
+	ApplyUnchanged ApplyStatus = "skipped-no-change"
+	ApplyDryRun    ApplyStatus = "dry-run"
+	ApplyFailed    ApplyStatus = "failed"
+	ApplySkipped   ApplyStatus = "skipped-unsupported" // the card lacks the file or application (see ApplyPlan)
+)
+
+// ApplyItem is one configuration item processed by ApplyConfig
+type ApplyItem struct {
+	Name   string      `json:"name"`
+	Status ApplyStatus `json:"status"`
+	SW     string      `json:"sw,omitempty"`     // status word of the failing command
+	Detail string      `json:"detail,omitempty"` // written value or error message
+}
+
+// ApplyReport is the per-item result of ApplyConfig
+type ApplyReport struct {
+	Items     []ApplyItem `json:"items"`
+	Applied   int         `json:"applied"`
+	Unchanged int         `json:"unchanged"`
+	DryRun    int         `json:"dry_run,omitempty"`
+	Skipped   int         `json:"skipped,omitempty"`
+	Failed    int         `json:"failed"`
+
+	// Plan is the feature resolution of the config, made before the first write
+	Plan *ApplyPlan `json:"plan,omitempty"`
+
+	// Changes holds the before/after content of every EF written in the session (see BuildFileChanges)
+	Changes []FileChange `json:"changes,omitempty"`
+
+	// Settle and Verify are the settle step and the verification that followed the writes
+	// (see Settle); nil when no REFRESH-requiring item was written or nothing was verified
+	Settle *SettleResult `json:"settle,omitempty"`
+	Verify *VerifyReport `json:"verify,omitempty"`
+
+	// simulate records writes as dry-run (the reader intercepted them, see card.Reader.SetDryRun)
+	simulate bool
+}
+
+func (r *ApplyReport) add(item ApplyItem) {
+	r.Items = append(r.Items, item)
+	switch item.Status {
+	case ApplyApplied:
+		r.Applied++
+	case ApplyUnchanged:
+		r.Unchanged++
+	case ApplyDryRun:
+		r.DryRun++
+	case ApplySkipped:
+		r.Skipped++
+	case ApplyFailed:
+		r.Failed++
+	}
+}
+
+// applied records a successful write and prints a progress line
+func (r *ApplyReport) applied(name, detail string) {
+	if r.simulate {
+		r.dryRun(name, detail)
+		return
+	}
+	r.add(ApplyItem{Name: name, Status: ApplyApplied, Detail: detail})
+	if detail != "" {
+		fmt.Printf("✓ %s: %s\n", name, detail)
+	} else {
+		fmt.Printf("✓ %s written\n", name)
+	}
+}
+
+// unchanged records an item skipped because the card already holds the value
+func (r *ApplyReport) unchanged(name string) {
+	r.add(ApplyItem{Name: name, Status: ApplyUnchanged})
+	fmt.Printf("= %s unchanged, skipped\n", name)
+}
+
+// skipped records an item the card does not support
+func (r *ApplyReport) skipped(name, reason string) {
+	r.add(ApplyItem{Name: name, Status: ApplySkipped, Detail: reason})
+	fmt.Printf("– %s skipped: %s\n", name, reason)
+}
+
+// dryRun records an item that would be written
+func (r *ApplyReport) dryRun(name, detail string) {
+	r.add(ApplyItem{Name: name, Status: ApplyDryRun, Detail: detail})
+	fmt.Printf("[DRY RUN] Would write %s: %s\n", name, detail)
+}
+
+// failed records a failed item with the last status word seen on the reader
+func (r *ApplyReport) failed(reader *card.Reader, name string, err error) {
+	item := ApplyItem{Name: name, Status: ApplyFailed, Detail: err.Error()}
+	if reader != nil {
+		if sw := reader.LastSW(); sw != 0 && sw != card.SW_OK {
+			item.SW = fmt.Sprintf("%04X", sw)
+		}
+	}
+	r.add(item)
+	fmt.Printf("✗ %s failed: %v\n", name, err)
+}
+
+// Err returns an error listing the failed items, or nil if nothing failed
+func (r *ApplyReport) Err() error {
+	var errors []string
+	for _, it := range r.Items {
+		if it.Status == ApplyFailed {
+			errors = append(errors, fmt.Sprintf("%s: %s", it.Name, it.Detail))
+		}
+	}
+	if len(errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("some operations failed:\n  - %s", joinErrors(errors))
+}
+
+// samePLMNList reports whether the card list (empty entries already removed) equals entries
+func samePLMNList(current []PLMNwACT, entries []HPLMNEntry) bool {
+	if len(current) != len(entries) {
+		return false
+	}
+	for i, e := range keepUnknownACT(entries, current) {
+		if current[i].MCC != e.MCC || current[i].MNC != e.MNC || current[i].ACT != e.ACT {
+			return false
+		}
+	}
+	return true
+}
+
+// sameServices reports whether every requested service flag already has the requested state
+func sameServices(current map[int]bool, changes map[int]bool) bool {
+	if current == nil {
+		return false
+	}
+	for n, enabled := range changes {
+		if current[n] != enabled {
+			return false
+		}
+	}
+	return true
+}
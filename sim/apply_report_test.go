@@ -0,0 +1,193 @@
+package sim
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ APPLY REPORT TESTS ============
+
+// newApplyTestReader returns a simulated USIM with writable IMSI, AD, SPN and HPLMN files
+func newApplyTestReader() (*card.Reader, *card.MockFile) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, []byte{0x08, 0x29, 0x05, 0x88, 0x00, 0x00, 0x00, 0x00, 0x10})
+	usim.AddEF(0x6FAD, []byte{0x00, 0x00, 0x00, 0x02})
+	usim.AddEF(0x6F46, bytes.Repeat([]byte{0xFF}, 17))
+	usim.AddEF(0x6F62, bytes.Repeat([]byte{0xFF}, 10))
+	return card.NewReaderWithTransport("Mock", m.ATR, m), usim
+}
+
+func TestApplyConfig_Report(t *testing.T) {
+	reader, _ := newApplyTestReader()
+	config := &SIMConfig{
+		IMSI:  "001010000000001",
+		SPN:   "Test",
+		HPLMN: []HPLMNConfig{{MCC: "001", MNC: "01", ACT: []string{"eutran"}}},
+		OPLMN: []HPLMNConfig{{MCC: "001", MNC: "01", ACT: []string{"eutran"}}},
+	}
+
+	report, err := ApplyConfig(reader, config, false, false)
+	if err != nil {
+		t.Errorf("ApplyConfig() error = %v, want EF_OPLMNwACT skipped", err)
+	}
+	want := map[string]ApplyStatus{
+		"IMSI":  ApplyApplied,
+		"SPN":   ApplyApplied,
+		"HPLMN": ApplyApplied,
+		"OPLMN": ApplySkipped,
+	}
+	checkReport(t, report, want)
+	if report.Skipped != 1 || report.Plan == nil || report.Plan.Count(PlanSkipUnsupported) != 1 {
+		t.Errorf("skipped = %d, plan = %+v; want OPLMN skipped", report.Skipped, report.Plan)
+	}
+
+	// Re-applying the same values must not write again
+	config.OPLMN = nil
+	report, err = ApplyConfig(reader, config, false, false)
+	if err != nil {
+		t.Fatalf("second ApplyConfig() error = %v", err)
+	}
+	checkReport(t, report, map[string]ApplyStatus{
+		"IMSI":  ApplyUnchanged,
+		"SPN":   ApplyUnchanged,
+		"HPLMN": ApplyUnchanged,
+	})
+	if report.Applied != 0 || report.Unchanged != 3 || report.Failed != 0 {
+		t.Errorf("counts = %d/%d/%d, want 0/3/0", report.Applied, report.Unchanged, report.Failed)
+	}
+}
+
+func checkReport(t *testing.T, report *ApplyReport, want map[string]ApplyStatus) {
+	t.Helper()
+	if len(report.Items) != len(want) {
+		t.Errorf("report has %d items, want %d: %+v", len(report.Items), len(want), report.Items)
+	}
+	for _, it := range report.Items {
+		if want[it.Name] != it.Status {
+			t.Errorf("%s: status = %s, want %s (%s)", it.Name, it.Status, want[it.Name], it.Detail)
+		}
+	}
+}
+
+func TestApplyReport_Err(t *testing.T) {
+	r := &ApplyReport{}
+	r.add(ApplyItem{Name: "IMSI", Status: ApplyApplied})
+	if err := r.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+	r.add(ApplyItem{Name: "SPN", Status: ApplyFailed, Detail: "boom"})
+	if err := r.Err(); err == nil || !bytes.Contains([]byte(err.Error()), []byte("SPN: boom")) {
+		t.Errorf("Err() = %v, want SPN failure", err)
+	}
+}
+
+func TestSamePLMNList(t *testing.T) {
+	current := []PLMNwACT{{MCC: "001", MNC: "01", ACT: 0x4000}}
+	tests := []struct {
+		name    string
+		entries []HPLMNEntry
+		want    bool
+	}{
+		{"Equal", []HPLMNEntry{{MCC: "001", MNC: "01", ACT: 0x4000}}, true},
+		{"Different ACT", []HPLMNEntry{{MCC: "001", MNC: "01", ACT: 0x8000}}, false},
+		{"Different length", nil, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := samePLMNList(current, tc.entries); got != tc.want {
+				t.Errorf("samePLMNList() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestApplyConfig_DryRun(t *testing.T) {
+	reader, usim := newApplyTestReader()
+	reader.SetDryRun(true)
+	config := &SIMConfig{IMSI: "001010000000001", SPN: "Test"}
+
+	report, err := ApplyConfig(reader, config, false, false)
+	if err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+	checkReport(t, report, map[string]ApplyStatus{
+		"IMSI": ApplyDryRun,
+		"SPN":  ApplyDryRun,
+	})
+	if report.Applied != 0 || report.DryRun != 2 {
+		t.Errorf("counts = applied %d, dry run %d, want 0/2", report.Applied, report.DryRun)
+	}
+	if usim.Children[0].Data[1] != 0x29 {
+		t.Errorf("IMSI written in dry-run: %X", usim.Children[0].Data)
+	}
+	if len(reader.DryRunLog()) == 0 {
+		t.Errorf("DryRunLog() is empty, want intercepted writes")
+	}
+}
+
+// ============ APPLY PLAN TESTS ============
+
+func TestApplyConfig_RequiredSection(t *testing.T) {
+	reader, usim := newApplyTestReader()
+	config := &SIMConfig{
+		IMSI:     "001010000000001",
+		OPLMN:    []HPLMNConfig{{MCC: "001", MNC: "01", ACT: []string{"eutran"}}},
+		ISIM:     &ISIMConfig{IMPI: "001010000000001@ims.mnc001.mcc001.3gppnetwork.org"},
+		Required: []string{"oplmn"},
+	}
+
+	report, err := ApplyConfig(reader, config, false, false)
+	if err == nil || !strings.Contains(err.Error(), "OPLMN: EF_OPLMNwACT not on the card") {
+		t.Errorf("ApplyConfig() error = %v, want required OPLMN", err)
+	}
+	if usim.Children[0].Data[1] != 0x29 {
+		t.Errorf("IMSI written although a required section is unsupported: %X", usim.Children[0].Data)
+	}
+	want := []PlanStep{
+		{Name: "IMSI", Section: "imsi", Action: PlanApply},
+		{Name: "OPLMN", Section: "oplmn", Action: PlanFailRequired, Required: true, Reason: "EF_OPLMNwACT not on the card"},
+		{Name: "IMPI", Section: "isim", Action: PlanSkipUnsupported, Reason: "no ISIM application"},
+	}
+	if !reflect.DeepEqual(report.Plan.Steps, want) {
+		t.Errorf("Plan = %+v, want %+v", report.Plan.Steps, want)
+	}
+	checkReport(t, report, map[string]ApplyStatus{"OPLMN": ApplyFailed})
+
+	// "required": true inside the section
+	config.Required = nil
+	config.ISIM.Required = true
+	if _, err := ApplyConfig(reader, config, false, false); err == nil || !strings.Contains(err.Error(), "IMPI: no ISIM application") {
+		t.Errorf("ApplyConfig() with isim.required error = %v", err)
+	}
+}
+
+func TestApplyConfig_ProgrammableRequired(t *testing.T) {
+	reader, usim := newApplyTestReader()
+	config := &SIMConfig{IMSI: "001010000000001", Ki: "000102030405060708090A0B0C0D0E0F"}
+
+	report, err := ApplyConfig(reader, config, false, false)
+	if err == nil || report.Plan.Steps[0].Action != PlanFailRequired {
+		t.Errorf("ApplyConfig() = %+v, %v; want programmable step failing", report.Plan, err)
+	}
+	if usim.Children[0].Data[1] != 0x29 {
+		t.Errorf("IMSI written on a card that is not programmable: %X", usim.Children[0].Data)
+	}
+}
+
+func TestParseConfig_Required(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"imsi": "001010000000001", "required": ["imsi"], "sms": {"smsc": "+4917", "required": true}}`))
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	if !config.sectionRequired("imsi") || !config.sectionRequired("sms") || config.sectionRequired("spn") {
+		t.Errorf("required sections = %v, sms %v", config.Required, config.SMS.Required)
+	}
+	if _, err := ParseConfig([]byte(`{"required": ["impi"]}`)); err == nil {
+		t.Error("ParseConfig() accepted an unknown required section")
+	}
+}
@@ -0,0 +1,182 @@
+package sim
+
+import (
+	"fmt"
+
+	"sim_reader/card"
+	"sim_reader/tlv"
+)
+
+// ARRReference is the content of FCP tag 8B (security attributes referenced to EF_ARR)
+type ARRReference struct {
+	FileID uint16 // EF_ARR holding the rule (6F06 in an ADF, 2F06 in the MF)
+	Record int    // record of the rule
+	SEID   int    // security environment the record applies to, -1 in the short format
+}
+
+// parseARRReference decodes the value of tag 8B. The short format is the file ID and a
+// record number; the long one is the file ID followed by SEID/record pairs (TS 102 221).
+// Of the pairs, the record of SE 01 (application PIN in use) is taken, else the first one.
+func parseARRReference(value []byte) (ARRReference, bool) {
+	if len(value) < 3 {
+		return ARRReference{}, false
+	}
+	ref := ARRReference{FileID: uint16(value[0])<<8 | uint16(value[1]), SEID: -1}
+	if len(value) == 3 {
+		ref.Record = int(value[2])
+		return ref, ref.Record > 0
+	}
+	for i := 2; i+1 < len(value); i += 2 {
+		seid, record := int(value[i]), int(value[i+1])
+		if ref.Record == 0 || seid == 0x01 {
+			ref.SEID, ref.Record = seid, record
+		}
+		if seid == 0x01 {
+			break
+		}
+	}
+	return ref, ref.Record > 0
+}
+
+// fcpARRReference returns the EF_ARR reference of an FCP template (tag 8B, also inside A5)
+func fcpARRReference(fcp []byte) (ARRReference, bool) {
+	f, _ := card.ParseFCP(fcp)
+	if f.SecurityReferenced == nil {
+		if f = f.ProprietaryFCP(); f == nil || f.SecurityReferenced == nil {
+			return ARRReference{}, false
+		}
+	}
+	return parseARRReference(f.SecurityReferenced)
+}
+
+// readARRTable reads the access rules of EF_ARR (fid) in the selected DF
+func readARRTable(reader *card.Reader, fid []byte) map[int]ARRRecord {
+	table := make(map[int]ARRRecord)
+	resp, err := reader.Select(fid)
+	if err != nil || !resp.IsOK() {
+		return table
+	}
+	recordSize := parseFCPRecordSize(resp.Data)
+	if recordSize == 0 {
+		recordSize = 48
+	}
+	numRecords := parseFCPNumRecords(resp.Data)
+	if numRecords == 0 {
+		numRecords = 30 // read until the card refuses
+	}
+	for recNum := 1; recNum <= numRecords && recNum <= 0xFE; recNum++ {
+		recResp, err := reader.ReadRecord(byte(recNum), byte(recordSize))
+		if err != nil || !recResp.IsOK() {
+			break
+		}
+		if len(recResp.Data) == 0 || recResp.Data[0] == 0xFF {
+			continue
+		}
+		readAcc, writeAcc := parseARRRecord(recResp.Data)
+		table[recNum] = ARRRecord{RecordNum: recNum, ReadAccess: readAcc, WriteAccess: writeAcc, RawData: recResp.Data}
+
+		if DebugFCP {
+			fmt.Printf("DEBUG ARR %X#%d: Read=%s, Write=%s\n%s", fid, recNum, readAcc, writeAcc,
+				tlv.Dump(recResp.Data, tlv.ContextFCP, "  "))
+		}
+	}
+	return table
+}
+
+// arrResolver resolves EF_ARR references of the files of one application. EF_ARR is looked
+// up in the ADF first (6F06 of ADF_ISIM is not the one of ADF_USIM), then in the MF, and
+// each file is read once.
+type arrResolver struct {
+	reader *card.Reader
+	aid    []byte // ADF of the files, nil for the MF
+	tables map[uint16]map[int]ARRRecord
+}
+
+func newARRResolver(reader *card.Reader, aid []byte) *arrResolver {
+	return &arrResolver{reader: reader, aid: aid, tables: make(map[uint16]map[int]ARRRecord)}
+}
+
+// rule returns the access rule referenced by the FCP of a file
+func (r *arrResolver) rule(fcp []byte) (ARRRecord, bool) {
+	ref, ok := fcpARRReference(fcp)
+	if !ok {
+		return ARRRecord{}, false
+	}
+	table, ok := r.tables[ref.FileID]
+	if !ok {
+		table = r.load(ref.FileID)
+		r.tables[ref.FileID] = table
+	}
+	rec, ok := table[ref.Record]
+	return rec, ok
+}
+
+// load reads EF_ARR fid and selects the application again
+func (r *arrResolver) load(fid uint16) map[int]ARRRecord {
+	id := []byte{byte(fid >> 8), byte(fid)}
+	r.selectApplication()
+	table := readARRTable(r.reader, id)
+	if len(table) == 0 && r.aid != nil {
+		// Files of an ADF may use the rules of the MF (2F06)
+		if resp, err := r.reader.Select([]byte{0x3F, 0x00}); err == nil && resp.IsOK() {
+			table = readARRTable(r.reader, id)
+		}
+	}
+	r.selectApplication()
+	return table
+}
+
+func (r *arrResolver) selectApplication() {
+	if r.aid != nil {
+		r.reader.Select(r.aid)
+	} else {
+		r.reader.Select([]byte{0x3F, 0x00})
+	}
+}
+
+// accessCheckFile is a file listed by the access condition checks
+type accessCheckFile struct {
+	id   []byte
+	name string
+}
+
+// readAccessConditions reads the access conditions of files of the ADF aid, resolving
+// EF_ARR references with the rules of that ADF
+func readAccessConditions(reader *card.Reader, aid []byte, label string, files []accessCheckFile) []FileAccessInfo {
+	var access []FileAccessInfo
+
+	resp, err := reader.Select(aid)
+	if err != nil || !resp.IsOK() {
+		return access
+	}
+
+	arr := newARRResolver(reader, aid)
+	for _, f := range files {
+		resp, err := reader.Select(f.id)
+		if err != nil || !resp.IsOK() {
+			continue
+		}
+
+		if DebugFCP {
+			fmt.Printf("DEBUG FCP %s%s:\n%s", label, f.name, tlv.Dump(resp.Data, tlv.ContextFCP, "  "))
+			if _, err := card.ParseFCP(resp.Data); err != nil {
+				fmt.Printf("  malformed FCP: %v\n", err)
+			}
+		}
+
+		readAcc, writeAcc := parseFCPSecurityAttributes(resp.Data)
+		if rec, ok := arr.rule(resp.Data); ok {
+			readAcc = rec.ReadAccess
+			writeAcc = rec.WriteAccess
+		}
+
+		access = append(access, FileAccessInfo{
+			FileName:    f.name,
+			FileID:      fmt.Sprintf("%02X%02X", f.id[0], f.id[1]),
+			ReadAccess:  readAcc,
+			WriteAccess: writeAcc,
+		})
+	}
+
+	return access
+}
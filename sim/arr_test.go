@@ -0,0 +1,157 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ EF_ARR TESTS ============
+
+// ts48ISIMARR is the content of EF_ARR in ADF_ISIM of the TS.48 test profile
+// (esim/testdata), 4 records of 35 bytes
+const ts48ISIMARR = "800101A40683010195010880015AA40683010A9501088401D4A40683010A950108FFFF" +
+	"800103A4068301019501088401D4A40683010A950108800158A40683010A950108FFFF" +
+	"800101900080015AA40683010A9501088401D4A40683010A950108FFFFFFFFFFFFFFFF" +
+	"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"
+
+func ts48ISIMARRRecords(t *testing.T) [][]byte {
+	t.Helper()
+	data, err := hex.DecodeString(ts48ISIMARR)
+	if err != nil || len(data) != 0x8C {
+		t.Fatalf("bad EF_ARR fixture (%d bytes): %v", len(data), err)
+	}
+	var records [][]byte
+	for i := 0; i < len(data); i += 0x23 {
+		records = append(records, data[i:i+0x23])
+	}
+	return records
+}
+
+func TestParseARRReference(t *testing.T) {
+	tests := []struct {
+		name  string
+		value []byte
+		want  ARRReference
+		ok    bool
+	}{
+		{"short format", []byte{0x6F, 0x06, 0x03}, ARRReference{0x6F06, 3, -1}, true},
+		{"MF rule", []byte{0x2F, 0x06, 0x01}, ARRReference{0x2F06, 1, -1}, true},
+		{"SE 01 preferred", []byte{0x6F, 0x06, 0x00, 0x04, 0x01, 0x02}, ARRReference{0x6F06, 2, 1}, true},
+		{"first pair without SE 01", []byte{0x6F, 0x06, 0x00, 0x05}, ARRReference{0x6F06, 5, 0}, true},
+		{"record 0", []byte{0x6F, 0x06, 0x00}, ARRReference{0x6F06, 0, -1}, false},
+		{"too short", []byte{0x6F, 0x06}, ARRReference{}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseARRReference(tc.value)
+			if ok != tc.ok || (ok && got != tc.want) {
+				t.Errorf("parseARRReference(%X) = %+v, %v, want %+v, %v", tc.value, got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+
+	// The long format is also read by parseFCPSecurityAttributes
+	fcp := []byte{0x62, 0x0C, 0x82, 0x02, 0x41, 0x21, 0x8B, 0x06, 0x6F, 0x06, 0x00, 0x04, 0x01, 0x02}
+	if read, write := parseFCPSecurityAttributes(fcp); read != "ARR#2" || write != "ARR#2" {
+		t.Errorf("parseFCPSecurityAttributes(SEID format) = %s/%s, want ARR#2", read, write)
+	}
+}
+
+func TestParseARRRecord(t *testing.T) {
+	records := ts48ISIMARRRecords(t)
+	tests := []struct {
+		name      string
+		data      []byte
+		wantRead  string
+		wantWrite string
+	}{
+		{"read PIN1, update ADM1", records[0], "PIN1", "ADM1"},
+		{"read and update PIN1 (AM 03)", records[1], "PIN1", "PIN1"},
+		{"read always, update ADM1", records[2], "Always", "ADM1"},
+		{"never", []byte{0x80, 0x01, 0x03, 0x97, 0x00}, "Never", "Never"},
+		{"OR template", []byte{0x80, 0x01, 0x01, 0xA0, 0x10, 0xA4, 0x06, 0x83, 0x01, 0x01, 0x95, 0x01, 0x08,
+			0xA4, 0x06, 0x83, 0x01, 0x0A, 0x95, 0x01, 0x08}, "PIN1", "ADM"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			read, write := parseARRRecord(tc.data)
+			if read != tc.wantRead || write != tc.wantWrite {
+				t.Errorf("parseARRRecord(%X) = %s/%s, want %s/%s", tc.data, read, write, tc.wantRead, tc.wantWrite)
+			}
+		})
+	}
+}
+
+// newARRTestCard builds the ISIM of the TS.48 profile next to a USIM whose EF_ARR has
+// different rules under the same record numbers
+func newARRTestCard(t *testing.T) (*card.Reader, *card.MockCard) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddRecordEF(0x2F06, []byte{0x80, 0x01, 0x01, 0x90, 0x00, 0x80, 0x01, 0x02, 0x97, 0x00})
+
+	usim := m.AddADF(AID_USIM)
+	usim.AddRecordEF(0x6F06, []byte{0x80, 0x01, 0x03, 0x90, 0x00, 0xFF, 0xFF})
+	usim.AddEF(0x6F07, make([]byte, 9)).ARR = []byte{0x6F, 0x06, 0x01}
+	usim.AddEF(0x6F46, make([]byte, 17)).ARR = []byte{0x2F, 0x06, 0x01} // rule of the MF
+
+	isim := m.AddADF(AID_ISIM)
+	isim.AddRecordEF(0x6F06, ts48ISIMARRRecords(t)...).ARR = []byte{0x6F, 0x06, 0x03}
+	for _, fid := range []uint16{0x6F02, 0x6F03, 0x6F07} {
+		isim.AddEF(fid, make([]byte, 0x20)).ARR = []byte{0x6F, 0x06, 0x01}
+	}
+	isim.AddRecordEF(0x6F04, make([]byte, 0x40)).ARR = []byte{0x6F, 0x06, 0x01}
+	isim.AddRecordEF(0x6F09, make([]byte, 0x40)).ARR = []byte{0x6F, 0x06, 0x00, 0x03, 0x01, 0x02}
+	return card.NewReaderWithTransport("Mock", m.ATR, m), m
+}
+
+func TestReadISIMFileAccessConditions(t *testing.T) {
+	reader, m := newARRTestCard(t)
+
+	want := map[string][2]string{
+		"EF_IMPI":   {"PIN1", "ADM1"},
+		"EF_DOMAIN": {"PIN1", "ADM1"},
+		"EF_IMPU":   {"PIN1", "ADM1"},
+		"EF_IST":    {"PIN1", "ADM1"},
+		"EF_PCSCF":  {"PIN1", "PIN1"}, // record of SE 01
+	}
+	access := ReadISIMFileAccessConditions(reader)
+	if len(access) != len(want) {
+		t.Fatalf("got %d files, want %d: %+v", len(access), len(want), access)
+	}
+	for _, fa := range access {
+		w := want[fa.FileName]
+		if fa.ReadAccess != w[0] || fa.WriteAccess != w[1] {
+			t.Errorf("%s (%s) = %s/%s, want %s/%s", fa.FileName, fa.FileID, fa.ReadAccess, fa.WriteAccess, w[0], w[1])
+		}
+	}
+
+	// EF_ARR of the ADF is read once for all files
+	arrSelects := 0
+	for _, apdu := range m.Log {
+		if apdu[1] == card.INS_SELECT && len(apdu) >= 7 && bytes.Equal(apdu[4:7], []byte{0x02, 0x6F, 0x06}) {
+			arrSelects++
+		}
+	}
+	if arrSelects != 1 {
+		t.Errorf("EF_ARR selected %d times, want 1", arrSelects)
+	}
+}
+
+func TestReadFileAccessConditionsARR(t *testing.T) {
+	reader, _ := newARRTestCard(t)
+
+	got := map[string]FileAccessInfo{}
+	for _, fa := range ReadFileAccessConditions(reader) {
+		got[fa.FileName] = fa
+	}
+	// Record 1 of the USIM EF_ARR, not the one of the ISIM
+	if fa := got["EF_IMSI"]; fa.ReadAccess != "Always" || fa.WriteAccess != "Always" {
+		t.Errorf("EF_IMSI = %s/%s, want Always/Always", fa.ReadAccess, fa.WriteAccess)
+	}
+	// 2F06 is not in the ADF: the rule comes from the MF
+	if fa := got["EF_SPN"]; fa.ReadAccess != "Always" || fa.WriteAccess != "Never" {
+		t.Errorf("EF_SPN = %s/%s, want Always/Never", fa.ReadAccess, fa.WriteAccess)
+	}
+}
@@ -0,0 +1,319 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"sim_reader/algorithms"
+	"sim_reader/card"
+)
+
+// AuthKeyFile is the content of a vendor authentication key file: algorithm selection,
+// Ki and OP or OPc (the card derives OPc itself when OP is stored)
+type AuthKeyFile struct {
+	Algorithm string // milenage, xor, sha1-aka, tuak
+	Ki        []byte
+	OPOPc     []byte // OP or OPc, see UseOPc
+	UseOPc    bool   // OPOPc holds OPc (false: OP, the card computes OPc)
+	Options   byte   // Vendor configuration bits other than algorithm and OP/OPc selection (preserved on write)
+}
+
+// SQNConfig holds the SQN check parameters of the USIM (TS 33.102 Annex C).
+// Unset fields keep the value on the card when written.
+type SQNConfig struct {
+	SQNCheck      *bool   `json:"sqn_check,omitempty" doc:"Check SQN freshness (disable only for testing)"`
+	DeltaMaxCheck *bool   `json:"delta_max_check,omitempty" doc:"Reject SQN jumps larger than delta_max"`
+	AgeLimitCheck *bool   `json:"age_limit_check,omitempty" doc:"Reject SQN older than age_limit"`
+	INDBits       *int    `json:"ind_bits,omitempty" doc:"Length of the IND part of SQN in bits (0-15, usually 5)"`
+	DeltaMax      *uint64 `json:"delta_max,omitempty" doc:"Maximum accepted SQN increase"`
+	AgeLimit      *uint64 `json:"age_limit,omitempty" doc:"Maximum accepted SQN age"`
+}
+
+// OTAKeyConfig is one OTA (TS 102 225) key of a keyset
+type OTAKeyConfig struct {
+	KVN       int    `json:"kvn" doc:"Key set version (1-15)"`
+	Type      string `json:"type" doc:"Key type: kic, kid or kik"`
+	Algorithm string `json:"algorithm,omitempty" doc:"aes or des (triple DES); default aes"`
+	Key       string `json:"key" doc:"Key (32, 48 or 64 hex chars)"`
+}
+
+// Validate checks the key type, version, algorithm and length
+func (k OTAKeyConfig) Validate() error {
+	if k.KVN < 1 || k.KVN > 15 {
+		return fmt.Errorf("OTA key version %d out of range 1-15", k.KVN)
+	}
+	switch strings.ToLower(k.Type) {
+	case "kic", "kid", "kik":
+	default:
+		return fmt.Errorf("OTA key type %q: must be kic, kid or kik", k.Type)
+	}
+	key, err := hex.DecodeString(k.Key)
+	if err != nil {
+		return fmt.Errorf("OTA key KVN %d %s: invalid hex: %w", k.KVN, k.Type, err)
+	}
+	switch strings.ToLower(k.Algorithm) {
+	case "", "aes":
+		if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			return fmt.Errorf("OTA key KVN %d %s: AES key must be 16, 24 or 32 bytes, got %d", k.KVN, k.Type, len(key))
+		}
+	case "des":
+		if len(key) != 16 && len(key) != 24 {
+			return fmt.Errorf("OTA key KVN %d %s: triple DES key must be 16 or 24 bytes, got %d", k.KVN, k.Type, len(key))
+		}
+	default:
+		return fmt.Errorf("OTA key algorithm %q: must be aes or des", k.Algorithm)
+	}
+	return nil
+}
+
+// Validate checks the ranges of the set fields
+func (c *SQNConfig) Validate() error {
+	if c.INDBits != nil && (*c.INDBits < 0 || *c.INDBits > 15) {
+		return fmt.Errorf("ind_bits %d out of range 0-15", *c.INDBits)
+	}
+	const maxSQN = 1<<48 - 1
+	if c.DeltaMax != nil && *c.DeltaMax > maxSQN {
+		return fmt.Errorf("delta_max %d exceeds 48 bits", *c.DeltaMax)
+	}
+	if c.AgeLimit != nil && *c.AgeLimit > maxSQN {
+		return fmt.Errorf("age_limit %d exceeds 48 bits", *c.AgeLimit)
+	}
+	return nil
+}
+
+// Merge returns cur with the fields set in c applied
+func (c *SQNConfig) Merge(cur SQNConfig) SQNConfig {
+	if c.SQNCheck != nil {
+		cur.SQNCheck = c.SQNCheck
+	}
+	if c.DeltaMaxCheck != nil {
+		cur.DeltaMaxCheck = c.DeltaMaxCheck
+	}
+	if c.AgeLimitCheck != nil {
+		cur.AgeLimitCheck = c.AgeLimitCheck
+	}
+	if c.INDBits != nil {
+		cur.INDBits = c.INDBits
+	}
+	if c.DeltaMax != nil {
+		cur.DeltaMax = c.DeltaMax
+	}
+	if c.AgeLimit != nil {
+		cur.AgeLimit = c.AgeLimit
+	}
+	return cur
+}
+
+// String summarises the set fields (for reports)
+func (c *SQNConfig) String() string {
+	var parts []string
+	flag := func(name string, v *bool) {
+		if v != nil {
+			parts = append(parts, fmt.Sprintf("%s=%v", name, *v))
+		}
+	}
+	flag("sqn_check", c.SQNCheck)
+	flag("delta_max_check", c.DeltaMaxCheck)
+	flag("age_limit_check", c.AgeLimitCheck)
+	if c.INDBits != nil {
+		parts = append(parts, fmt.Sprintf("ind_bits=%d", *c.INDBits))
+	}
+	if c.DeltaMax != nil {
+		parts = append(parts, fmt.Sprintf("delta_max=%d", *c.DeltaMax))
+	}
+	if c.AgeLimit != nil {
+		parts = append(parts, fmt.Sprintf("age_limit=%d", *c.AgeLimit))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// applyAuthKeyFile writes algorithm, Ki and OP/OPc of config through the driver's key file
+// view in one update, then checks the new keys with an AUTHENTICATE. Returns false on failure.
+func applyAuthKeyFile(reader *card.Reader, config *SIMConfig, p AuthKeyFileProvider, dryRun bool, report *ApplyReport) bool {
+	var ki, op, opc []byte
+	var err error
+	if config.Ki != "" {
+		if ki, err = algorithms.ValidateKi(config.Ki); err != nil {
+			report.failed(nil, "Auth key file", err)
+			return false
+		}
+	}
+	if config.OPc != "" {
+		if opc, err = algorithms.ValidateOPc(config.OPc); err != nil {
+			report.failed(nil, "Auth key file", err)
+			return false
+		}
+	} else if config.OP != "" {
+		if op, err = algorithms.ValidateOPc(config.OP); err != nil {
+			report.failed(nil, "Auth key file", fmt.Errorf("invalid OP: %w", err))
+			return false
+		}
+	}
+
+	var fields []string
+	if config.Algorithm != "" {
+		fields = append(fields, "algorithm "+strings.ToLower(config.Algorithm))
+	}
+	if ki != nil {
+		fields = append(fields, "Ki")
+	}
+	if opc != nil {
+		fields = append(fields, "OPc")
+	} else if op != nil {
+		fields = append(fields, "OP (card computes OPc)")
+	}
+	detail := strings.Join(fields, ", ")
+	if dryRun {
+		report.dryRun("Auth key file", detail)
+		return true
+	}
+
+	cur, err := p.ReadAuthKeyFile(reader)
+	if err != nil {
+		report.failed(reader, "Auth key file", err)
+		return false
+	}
+	next := *cur
+	if ki != nil {
+		next.Ki = ki
+	}
+	if opc != nil {
+		next.OPOPc, next.UseOPc = opc, true
+	} else if op != nil {
+		next.OPOPc, next.UseOPc = op, false
+	}
+	if config.Algorithm != "" {
+		next.Algorithm = strings.ToLower(config.Algorithm)
+	}
+
+	if next.Algorithm == cur.Algorithm && next.UseOPc == cur.UseOPc &&
+		bytes.Equal(next.Ki, cur.Ki) && bytes.Equal(next.OPOPc, cur.OPOPc) {
+		report.unchanged("Auth key file")
+		return true
+	}
+	if err := p.WriteAuthKeyFile(reader, &next); err != nil {
+		report.failed(reader, "Auth key file", err)
+		return false
+	}
+	report.applied("Auth key file", detail)
+
+	// A key change is only trusted once the card authenticates with it
+	if (ki != nil || op != nil || opc != nil) && next.Algorithm == string(AlgorithmMilenage) {
+		if err := VerifyKeysByAuth(reader, &next); err != nil {
+			report.failed(reader, "Key verification (AUTHENTICATE)", err)
+			return false
+		}
+		report.applied("Key verification (AUTHENTICATE)", "card accepted AUTN computed with the new keys")
+	}
+	return true
+}
+
+// VerifyKeysByAuth runs a Milenage AUTHENTICATE with the keys of f. The keys are correct
+// when the card returns the expected RES, or a synchronisation failure (which the card
+// only reports after the MAC, computed from Ki and OPc, has been verified).
+func VerifyKeysByAuth(reader *card.Reader, f *AuthKeyFile) error {
+	cfg := &AuthConfig{
+		K:         f.Ki,
+		SQN:       make([]byte, 6),
+		AMF:       []byte{0x80, 0x00},
+		Algorithm: AlgorithmMilenage,
+	}
+	if f.UseOPc {
+		cfg.OPc = f.OPOPc
+	} else {
+		cfg.OP = f.OPOPc
+	}
+
+	res, err := RunAuthentication(reader, cfg)
+	switch {
+	case err != nil:
+		return err
+	case res.Error != "":
+		return fmt.Errorf("card rejected the new keys: %s", res.Error)
+	case res.SyncFail:
+		return nil
+	case !res.RESMatch:
+		return fmt.Errorf("RES %s does not match XRES %s", res.RES, res.XRES)
+	}
+	return nil
+}
+
+// applyProgrammableExtras writes the card-specific settings of the programmable section
+// (SQN parameters, OTA keys) through the driver capabilities
+func applyProgrammableExtras(reader *card.Reader, pc *ProgrammableConfig, drv ProgrammableDriver, dryRun bool, report *ApplyReport) {
+	if pc.SQN != nil {
+		p, ok := drv.(SQNConfigProvider)
+		switch {
+		case !ok || !HasCapability(drv, CapSQNConfig):
+			report.failed(nil, "SQN parameters", fmt.Errorf("%s does not support SQN parameters", drv.Name()))
+		case pc.SQN.Validate() != nil:
+			report.failed(nil, "SQN parameters", pc.SQN.Validate())
+		case dryRun:
+			report.dryRun("SQN parameters", pc.SQN.String())
+		default:
+			applySQNConfig(reader, pc.SQN, p, report)
+		}
+	}
+
+	if len(pc.OTAKeys) == 0 {
+		return
+	}
+	p, ok := drv.(OTAKeyProvider)
+	if !ok || !HasCapability(drv, CapOTAKeys) {
+		report.failed(nil, "OTA keys", fmt.Errorf("%s does not support OTA key files", drv.Name()))
+		return
+	}
+	for _, k := range pc.OTAKeys {
+		name := fmt.Sprintf("OTA key KVN %d %s", k.KVN, strings.ToUpper(k.Type))
+		if err := k.Validate(); err != nil {
+			report.failed(nil, name, err)
+			continue
+		}
+		if dryRun {
+			report.dryRun(name, strings.ToLower(k.Algorithm))
+			continue
+		}
+		if err := p.WriteOTAKey(reader, k); err != nil {
+			report.failed(reader, name, err)
+			continue
+		}
+		report.applied(name, "")
+	}
+}
+
+// applySQNConfig merges the configured SQN parameters into the card values and writes them if changed
+func applySQNConfig(reader *card.Reader, c *SQNConfig, p SQNConfigProvider, report *ApplyReport) {
+	cur, err := p.ReadSQNConfig(reader)
+	if err != nil {
+		report.failed(reader, "SQN parameters", err)
+		return
+	}
+	next := c.Merge(*cur)
+	if next.String() == cur.String() {
+		report.unchanged("SQN parameters")
+		return
+	}
+	if err := p.WriteSQNConfig(reader, &next); err != nil {
+		report.failed(reader, "SQN parameters", err)
+		return
+	}
+	report.applied("SQN parameters", c.String())
+}
+
+// ReadProgrammableInfo returns the card-specific settings of the detected driver for the
+// "programmable" export section (card_type and SQN parameters), or nil if there are none
+func ReadProgrammableInfo(reader *card.Reader, drv ProgrammableDriver) *ProgrammableConfig {
+	s, ok := drv.(CardTypeSelector)
+	if !ok || s.CardType() == "" {
+		return nil
+	}
+	pc := &ProgrammableConfig{CardType: s.CardType()}
+	if p, ok := drv.(SQNConfigProvider); ok && HasCapability(drv, CapSQNConfig) {
+		if sqn, err := p.ReadSQNConfig(reader); err == nil {
+			pc.SQN = sqn
+		}
+	}
+	return pc
+}
@@ -0,0 +1,121 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ AUTH KEY FILE TESTS ============
+
+// fakeKeyFile is an AuthKeyFileProvider holding the key file in memory
+type fakeKeyFile struct {
+	f      AuthKeyFile
+	writes int
+}
+
+func (p *fakeKeyFile) ReadAuthKeyFile(reader *card.Reader) (*AuthKeyFile, error) {
+	f := p.f
+	return &f, nil
+}
+
+func (p *fakeKeyFile) WriteAuthKeyFile(reader *card.Reader, f *AuthKeyFile) error {
+	p.f = *f
+	p.writes++
+	return nil
+}
+
+func TestApplyAuthKeyFile(t *testing.T) {
+	ki := bytes.Repeat([]byte{0x11}, 16)
+	opc := bytes.Repeat([]byte{0x22}, 16)
+	tests := []struct {
+		name   string
+		config SIMConfig
+		dryRun bool
+		status ApplyStatus
+		writes int
+	}{
+		{"Dry run", SIMConfig{Ki: "33333333333333333333333333333333"}, true, ApplyDryRun, 0},
+		{"Same keys", SIMConfig{Ki: "11111111111111111111111111111111", OPc: "22222222222222222222222222222222"}, false, ApplyUnchanged, 0},
+		{"Algorithm only", SIMConfig{Algorithm: "XOR"}, false, ApplyApplied, 1},
+		{"Invalid Ki", SIMConfig{Ki: "1234"}, false, ApplyFailed, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &fakeKeyFile{f: AuthKeyFile{Algorithm: "milenage", Ki: ki, OPOPc: opc, UseOPc: true}}
+			report := &ApplyReport{}
+			ok := applyAuthKeyFile(nil, &tc.config, p, tc.dryRun, report)
+			if ok != (tc.status != ApplyFailed) {
+				t.Errorf("applyAuthKeyFile() = %v", ok)
+			}
+			checkReport(t, report, map[string]ApplyStatus{"Auth key file": tc.status})
+			if p.writes != tc.writes {
+				t.Errorf("writes = %d, want %d", p.writes, tc.writes)
+			}
+		})
+	}
+}
+
+func TestApplyAuthKeyFile_OPSetsFlag(t *testing.T) {
+	p := &fakeKeyFile{f: AuthKeyFile{Algorithm: "xor", Ki: make([]byte, 16), OPOPc: make([]byte, 16), UseOPc: true}}
+	config := &SIMConfig{OP: "00112233445566778899AABBCCDDEEFF"}
+	if !applyAuthKeyFile(nil, config, p, false, &ApplyReport{}) {
+		t.Fatal("applyAuthKeyFile() failed")
+	}
+	if p.f.UseOPc || p.f.OPOPc[0] != 0x00 || p.f.OPOPc[15] != 0xFF {
+		t.Errorf("key file = %+v, want OP stored with UseOPc=false", p.f)
+	}
+}
+
+func TestSQNConfig(t *testing.T) {
+	on, off, ind, big := true, false, 5, uint64(1<<48)
+	tests := []struct {
+		name    string
+		cfg     SQNConfig
+		wantErr bool
+	}{
+		{"Empty", SQNConfig{}, false},
+		{"Flags and IND", SQNConfig{SQNCheck: &off, DeltaMaxCheck: &on, INDBits: &ind}, false},
+		{"IND out of range", SQNConfig{INDBits: func() *int { v := 16; return &v }()}, true},
+		{"Delta max too large", SQNConfig{DeltaMax: &big}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.cfg.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+
+	cur := SQNConfig{SQNCheck: &on, AgeLimitCheck: &on}
+	merged := (&SQNConfig{SQNCheck: &off}).Merge(cur)
+	if *merged.SQNCheck || !*merged.AgeLimitCheck {
+		t.Errorf("Merge() = %s, want sqn_check=false with age_limit_check kept", merged.String())
+	}
+}
+
+func TestOTAKeyConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     OTAKeyConfig
+		wantErr bool
+	}{
+		{"AES-128 KIc", OTAKeyConfig{KVN: 1, Type: "kic", Key: "000102030405060708090A0B0C0D0E0F"}, false},
+		{"3DES KID", OTAKeyConfig{KVN: 2, Type: "KID", Algorithm: "des", Key: "000102030405060708090A0B0C0D0E0F"}, false},
+		{"KVN 0", OTAKeyConfig{KVN: 0, Type: "kic", Key: "000102030405060708090A0B0C0D0E0F"}, true},
+		{"Bad type", OTAKeyConfig{KVN: 1, Type: "kek", Key: "000102030405060708090A0B0C0D0E0F"}, true},
+		{"DES 32 bytes", OTAKeyConfig{KVN: 1, Type: "kid", Algorithm: "des", Key: string(bytes.Repeat([]byte("00"), 32))}, true},
+		{"Not hex", OTAKeyConfig{KVN: 1, Type: "kik", Key: "XYZ"}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.key.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"sim_reader/algorithms"
 	"sim_reader/card"
+	"sim_reader/inputs"
 )
 
 // AlgorithmType represents the authentication algorithm type
@@ -19,6 +20,25 @@ const (
 	AlgorithmTUAK     AlgorithmType = "tuak"
 )
 
+// AuthContext is the security context of the AUTHENTICATE sent to the card
+type AuthContext string
+
+const (
+	AuthContext3G  AuthContext = "3g"  // 3G/4G security context (RES, CK, IK)
+	AuthContextGBA AuthContext = "gba" // GBA bootstrapping mode (RES; the card keeps Ks)
+)
+
+// ParseAuthContext parses the --auth-context value ("" = 3g)
+func ParseAuthContext(s string) (AuthContext, error) {
+	switch c := AuthContext(strings.ToLower(strings.TrimSpace(s))); c {
+	case "":
+		return AuthContext3G, nil
+	case AuthContext3G, AuthContextGBA:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown authentication context %q (3g, gba)", s)
+}
+
 // AuthConfig contains authentication parameters
 type AuthConfig struct {
 	// Input parameters
@@ -31,6 +51,8 @@ type AuthConfig struct {
 	Algorithm AlgorithmType // Algorithm type (milenage or tuak)
 	MCC       int           // Mobile Country Code (for KASME)
 	MNC       int           // Mobile Network Code (for KASME)
+	MNCLength int           // MNC digits (2 or 3, 0 = from the value)
+	Context   AuthContext   // AUTHENTICATE context ("" = 3G)
 
 	// Pre-computed values (from dump, skip calculation)
 	AUTN []byte // Pre-computed AUTN (16 bytes) - skip calculation if provided
@@ -55,9 +77,10 @@ type AuthResult struct {
 	AMF  string `json:"amf"`
 
 	// Mode indicators
-	CardOnlyMode bool `json:"card_only_mode,omitempty"` // AUTN provided without K - just send to card
-	AUTNFromDump bool `json:"autn_from_dump,omitempty"` // AUTN was provided, not calculated
-	AUTSFromDump bool `json:"auts_from_dump,omitempty"` // AUTS was provided for resync
+	Context      string `json:"context,omitempty"`        // AUTHENTICATE context (3g, gba)
+	CardOnlyMode bool   `json:"card_only_mode,omitempty"` // AUTN provided without K - just send to card
+	AUTNFromDump bool   `json:"autn_from_dump,omitempty"` // AUTN was provided, not calculated
+	AUTSFromDump bool   `json:"auts_from_dump,omitempty"` // AUTS was provided for resync
 
 	// Computed values (network side)
 	MACA string `json:"mac_a"`
@@ -68,11 +91,13 @@ type AuthResult struct {
 	AUTN string `json:"autn"`
 
 	// SIM card response
-	RES      string `json:"res,omitempty"`
-	CardCK   string `json:"card_ck,omitempty"`
-	CardIK   string `json:"card_ik,omitempty"`
-	AUTS     string `json:"auts,omitempty"`
-	SyncFail bool   `json:"sync_fail,omitempty"`
+	RES          string   `json:"res,omitempty"`
+	CardCK       string   `json:"card_ck,omitempty"`
+	CardIK       string   `json:"card_ik,omitempty"`
+	CardKc       string   `json:"card_kc,omitempty"` // Kc after IK (USIM with GSM access)
+	AUTS         string   `json:"auts,omitempty"`
+	SyncFail     bool     `json:"sync_fail,omitempty"`
+	Unrecognized []string `json:"unrecognized,omitempty"` // hex dumps of response data not decoded
 
 	// Resync results (if AUTS received)
 	SQNms string `json:"sqn_ms,omitempty"`
@@ -81,6 +106,7 @@ type AuthResult struct {
 
 	// Derived keys
 	KASME string `json:"kasme,omitempty"`
+	Ks    string `json:"ks,omitempty"`   // GBA: Ks = CK || IK, kept by the card
 	SRES  string `json:"sres,omitempty"` // 2G triplet
 	Kc    string `json:"kc,omitempty"`   // 2G triplet
 
@@ -108,95 +134,39 @@ func ParseAuthConfig(
 		IKLen:      algorithms.IKLen128,
 	}
 
-	// Parse K (optional if AUTN is provided - card-only mode)
-	if kStr != "" {
-		k, err := algorithms.ValidateKi(kStr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid K format: %w", err)
-		}
-		cfg.K = k
-	}
-
-	// Parse OP or OPc (optional if AUTN is provided - card-only mode)
-	if opStr != "" {
-		op, err := algorithms.ValidateOPc(opStr) // OP has same format as OPc/Ki
-		if err != nil {
-			return nil, fmt.Errorf("invalid OP format: %w", err)
-		}
-		cfg.OP = op
-	}
-	if opcStr != "" {
-		opc, err := algorithms.ValidateOPc(opcStr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid OPc format: %w", err)
-		}
-		cfg.OPc = opc
-	}
-
-	// Parse SQN (required, 6 bytes or 12 hex chars)
-	if sqnStr == "" {
-		// Default SQN
-		cfg.SQN = []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
-	} else {
-		sqn, err := hex.DecodeString(strings.ReplaceAll(sqnStr, " ", ""))
-		if err != nil {
-			return nil, fmt.Errorf("invalid SQN format: %w", err)
-		}
-		if len(sqn) != 6 {
-			return nil, fmt.Errorf("SQN must be 6 bytes, got %d", len(sqn))
-		}
-		cfg.SQN = sqn
-	}
-
-	// Parse AMF (optional, default 0x8000 for LTE)
-	if amfStr == "" {
-		cfg.AMF = []byte{0x80, 0x00} // Default for LTE
-	} else {
-		amf, err := hex.DecodeString(strings.ReplaceAll(amfStr, " ", ""))
-		if err != nil {
-			return nil, fmt.Errorf("invalid AMF format: %w", err)
-		}
-		if len(amf) != 2 {
-			return nil, fmt.Errorf("AMF must be 2 bytes, got %d", len(amf))
-		}
-		cfg.AMF = amf
-	}
-
-	// Parse RAND (optional, auto-generate if not provided)
-	if randStr != "" {
-		randBytes, err := hex.DecodeString(strings.ReplaceAll(randStr, " ", ""))
-		if err != nil {
-			return nil, fmt.Errorf("invalid RAND format: %w", err)
-		}
-		if len(randBytes) != 16 {
-			return nil, fmt.Errorf("RAND must be 16 bytes, got %d", len(randBytes))
+	// TUAK takes a 128-bit or 256-bit K and a 256-bit TOP/TOPc (TS 35.231)
+	kSizes, opSize := []int{16}, 16
+	if cfg.Algorithm == AlgorithmTUAK {
+		kSizes, opSize = []int{16, 32}, 32
+	}
+
+	// K, OP and OPc are optional if AUTN is provided (card-only mode); SQN and AMF have
+	// defaults; RAND is generated when not given
+	cfg.SQN = []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	cfg.AMF = []byte{0x80, 0x00} // Default for LTE
+	for _, f := range []struct {
+		name, value string
+		sizes       []int
+		out         *[]byte
+	}{
+		{"K", kStr, kSizes, &cfg.K},
+		{"OP", opStr, []int{opSize}, &cfg.OP},
+		{"OPc", opcStr, []int{opSize}, &cfg.OPc},
+		{"SQN", sqnStr, []int{6}, &cfg.SQN},
+		{"AMF", amfStr, []int{2}, &cfg.AMF},
+		{"RAND", randStr, []int{16}, &cfg.RAND},
+		{"AUTN", autnStr, []int{16}, &cfg.AUTN},
+		// AUTS length: 14 (64-bit MAC-S), 22 (128-bit), or 38 (256-bit)
+		{"AUTS", autsStr, []int{14, 22, 38}, &cfg.AUTS},
+	} {
+		if f.value == "" {
+			continue
 		}
-		cfg.RAND = randBytes
-	}
-
-	// Parse AUTN (optional, use pre-computed AUTN instead of calculating)
-	if autnStr != "" {
-		autn, err := hex.DecodeString(strings.ReplaceAll(autnStr, " ", ""))
+		b, err := inputs.HexKey(f.name, f.value, f.sizes...)
 		if err != nil {
-			return nil, fmt.Errorf("invalid AUTN format: %w", err)
-		}
-		if len(autn) != 16 {
-			return nil, fmt.Errorf("AUTN must be 16 bytes, got %d", len(autn))
-		}
-		cfg.AUTN = autn
-	}
-
-	// Parse AUTS (optional, for SQN resynchronization from dump)
-	if autsStr != "" {
-		auts, err := hex.DecodeString(strings.ReplaceAll(autsStr, " ", ""))
-		if err != nil {
-			return nil, fmt.Errorf("invalid AUTS format: %w", err)
-		}
-		// AUTS length: 14 (64-bit MAC-S), 22 (128-bit), or 38 (256-bit)
-		if len(auts) != 14 && len(auts) != 22 && len(auts) != 38 {
-			return nil, fmt.Errorf("AUTS must be 14, 22 or 38 bytes, got %d", len(auts))
+			return nil, err
 		}
-		cfg.AUTS = auts
+		*f.out = b
 	}
 
 	// Validation: either K+OP/OPc for full mode, or AUTN for card-only mode
@@ -245,7 +215,7 @@ func runCardOnlyAuth(reader *card.Reader, cfg *AuthConfig) (*AuthResult, error)
 	}
 
 	// Send AUTHENTICATE command
-	authResult, err := reader.Authenticate(cfg.RAND, cfg.AUTN, card.AUTH_CONTEXT_3G)
+	authResult, err := authenticateCard(reader, cfg, cfg.RAND, cfg.AUTN, result)
 	if err != nil {
 		result.Error = err.Error()
 		return result, nil
@@ -255,8 +225,33 @@ func runCardOnlyAuth(reader *card.Reader, cfg *AuthConfig) (*AuthResult, error)
 		// Sync failure
 		result.SyncFail = true
 		result.AUTS = strings.ToUpper(hex.EncodeToString(authResult.AUTS))
-	} else if authResult.Success {
-		// Success - store card response
+	}
+
+	return result, nil
+}
+
+// authenticateCard sends AUTHENTICATE in the context of cfg to the selected USIM and
+// stores the card response in result. The GBA context needs the GBA service in EF_UST.
+func authenticateCard(reader *card.Reader, cfg *AuthConfig, rand, autn []byte, result *AuthResult) (*card.AuthenticateResult, error) {
+	context := byte(card.AUTH_CONTEXT_3G)
+	if cfg.Context == AuthContextGBA {
+		result.Context = string(AuthContextGBA)
+		if !DecodeUST(readTransparentEF(reader, []byte{0x6F, 0x38}))[UST_GBA] {
+			return nil, fmt.Errorf("GBA context needs UST service %d (GBA), not available on this card", UST_GBA)
+		}
+		context = card.AUTH_CONTEXT_GBA
+	}
+
+	authResult, err := reader.Authenticate(rand, autn, context)
+	if authResult != nil && authResult.Response != nil {
+		for _, u := range authResult.Response.Unrecognized {
+			result.Unrecognized = append(result.Unrecognized, u.String())
+		}
+	}
+	if err != nil {
+		return authResult, err
+	}
+	if authResult.Success {
 		result.RES = strings.ToUpper(hex.EncodeToString(authResult.RES))
 		if authResult.CK != nil {
 			result.CardCK = strings.ToUpper(hex.EncodeToString(authResult.CK))
@@ -264,9 +259,11 @@ func runCardOnlyAuth(reader *card.Reader, cfg *AuthConfig) (*AuthResult, error)
 		if authResult.IK != nil {
 			result.CardIK = strings.ToUpper(hex.EncodeToString(authResult.IK))
 		}
+		if authResult.Kc != nil {
+			result.CardKc = strings.ToUpper(hex.EncodeToString(authResult.Kc))
+		}
 	}
-
-	return result, nil
+	return authResult, nil
 }
 
 // RunAuthentication performs the complete authentication flow
@@ -341,7 +338,7 @@ func RunAuthentication(reader *card.Reader, cfg *AuthConfig) (*AuthResult, error
 			}
 		}
 	default:
-		algo = algorithms.NewMilenage()
+		algo = &algorithms.Milenage{}
 		// Set OP/OPc for Milenage (16 bytes)
 		if cfg.OPc != nil {
 			if len(cfg.OPc) != 16 {
@@ -446,7 +443,7 @@ func RunAuthentication(reader *card.Reader, cfg *AuthConfig) (*AuthResult, error
 			result.Error = fmt.Sprintf("Failed to select USIM: %v", err)
 		} else {
 			// Send AUTHENTICATE command
-			authResult, err := reader.Authenticate(v.RAND, v.AUTN, card.AUTH_CONTEXT_3G)
+			authResult, err := authenticateCard(reader, cfg, v.RAND, v.AUTN, result)
 			if err != nil {
 				result.Error = err.Error()
 			} else if len(authResult.AUTS) > 0 {
@@ -470,24 +467,21 @@ func RunAuthentication(reader *card.Reader, cfg *AuthConfig) (*AuthResult, error
 					}
 				}
 			} else if authResult.Success {
-				// Success - store card response
-				result.RES = strings.ToUpper(hex.EncodeToString(authResult.RES))
-				if authResult.CK != nil {
-					result.CardCK = strings.ToUpper(hex.EncodeToString(authResult.CK))
-				}
-				if authResult.IK != nil {
-					result.CardIK = strings.ToUpper(hex.EncodeToString(authResult.IK))
-				}
-
 				// Verify RES matches XRES
 				result.RESMatch = (result.RES == result.XRES)
 			}
 		}
 	}
 
+	// GBA bootstrapping: the card derives Ks = CK || IK and keeps it
+	if cfg.Context == AuthContextGBA {
+		result.Context = string(AuthContextGBA)
+		result.Ks = result.CK + result.IK
+	}
+
 	// Compute KASME for LTE
 	if cfg.MCC > 0 && cfg.MNC >= 0 {
-		kasme, err := v.ComputeKASME(cfg.MCC, cfg.MNC)
+		kasme, err := v.ComputeKASMEWithMNCLength(cfg.MCC, cfg.MNC, cfg.MNCLength)
 		if err == nil {
 			result.KASME = strings.ToUpper(hex.EncodeToString(kasme))
 		}
@@ -505,6 +499,35 @@ func RunAuthentication(reader *card.Reader, cfg *AuthConfig) (*AuthResult, error
 	return result, nil
 }
 
+// ReadHomePLMN reads the home network MCC/MNC of the USIM: EF_IMSI split with the MNC length in EF_AD
+func ReadHomePLMN(reader *card.Reader) (mcc, mnc string, err error) {
+	if err := selectUSIMADF(reader); err != nil {
+		return "", "", err
+	}
+	resp, err := reader.Select([]byte{0x6F, 0x07})
+	if err != nil || !resp.IsOK() {
+		return "", "", fmt.Errorf("cannot select EF_IMSI")
+	}
+	raw, err := reader.ReadAllBinary(9)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot read EF_IMSI: %w", err)
+	}
+	imsi := DecodeIMSI(raw)
+
+	mncLength := 0
+	if resp, err := reader.Select([]byte{0x6F, 0xAD}); err == nil && resp.IsOK() {
+		if resp, err := reader.ReadBinary(0, 4); err == nil && resp.IsOK() {
+			mncLength = DecodeAD(resp.Data).MNCLength
+		}
+	}
+
+	mcc, mnc = SplitIMSI(imsi, mncLength)
+	if mcc == "" {
+		return "", "", fmt.Errorf("EF_IMSI holds no valid IMSI")
+	}
+	return mcc, mnc, nil
+}
+
 // selectUSIMADF selects the USIM application
 func selectUSIMADF(reader *card.Reader) error {
 	// Try to use detected AID first
@@ -519,6 +542,10 @@ func selectUSIMADF(reader *card.Reader) error {
 		}
 	}
 
+	if !usimFallbackAllowed() {
+		return fmt.Errorf("failed to select USIM application %X", aid)
+	}
+
 	// Try standard USIM AID
 	standardAID := []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02, 0xFF, 0xFF, 0xFF, 0xFF, 0x89}
 	resp, err := reader.Select(standardAID[:7]) // Try partial AID
@@ -609,7 +636,7 @@ func ProcessAUTS(cfg *AuthConfig, auts []byte) (*AuthResult, error) {
 		v.CKLen = cfg.CKLen
 		v.IKLen = cfg.IKLen
 	default:
-		algo = algorithms.NewMilenage()
+		algo = &algorithms.Milenage{}
 		v.TOPC = cfg.OPc
 	}
 
@@ -0,0 +1,71 @@
+package sim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ AUTHENTICATE CONTEXT TESTS ============
+
+func TestParseAuthContext(t *testing.T) {
+	for in, want := range map[string]AuthContext{"": AuthContext3G, "3G": AuthContext3G, "gba": AuthContextGBA} {
+		if got, err := ParseAuthContext(in); err != nil || got != want {
+			t.Errorf("ParseAuthContext(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseAuthContext("mbms"); err == nil {
+		t.Errorf("ParseAuthContext(mbms) accepted")
+	}
+}
+
+func TestRunAuthentication_GBA(t *testing.T) {
+	rand := bytes.Repeat([]byte{0xA1}, 16)
+	autn := bytes.Repeat([]byte{0xB2}, 16)
+	res := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+
+	newCard := func(gba bool) (*card.MockCard, *card.Reader) {
+		ust := make([]byte, 9)
+		if gba {
+			ust[(UST_GBA-1)/8] |= 1 << ((UST_GBA - 1) % 8)
+		}
+		m := card.NewMockCard([]byte{0x3B, 0x00})
+		m.AddADF(AID_USIM).AddEF(0x6F38, ust)
+		m.Override = func(apdu []byte) []byte {
+			if apdu[1] != card.INS_AUTHENTICATE {
+				return nil
+			}
+			if apdu[3] != card.AUTH_CONTEXT_GBA || apdu[5] != 0xDD {
+				return []byte{0x6A, 0x86}
+			}
+			return append(append([]byte{0xDB, byte(len(res))}, res...), 0xDE, 0x00, 0x90, 0x00)
+		}
+		return m, card.NewReaderWithTransport("Mock", m.ATR, m)
+	}
+
+	// Without the GBA service no AUTHENTICATE is sent
+	m, reader := newCard(false)
+	result, err := RunAuthentication(reader, &AuthConfig{RAND: rand, AUTN: autn, Context: AuthContextGBA})
+	if err != nil || !strings.Contains(result.Error, "GBA") {
+		t.Fatalf("without UST GBA: result.Error = %q, err = %v", result.Error, err)
+	}
+	for _, apdu := range m.Log {
+		if apdu[1] == card.INS_AUTHENTICATE {
+			t.Errorf("AUTHENTICATE sent without the GBA service")
+		}
+	}
+
+	_, reader = newCard(true)
+	result, err = RunAuthentication(reader, &AuthConfig{RAND: rand, AUTN: autn, Context: AuthContextGBA})
+	if err != nil || result.Error != "" {
+		t.Fatalf("GBA: result.Error = %q, err = %v", result.Error, err)
+	}
+	if result.Context != "gba" || result.RES != "0102030405060708" || result.CardCK != "" {
+		t.Errorf("result = %+v, want GBA context with RES only", result)
+	}
+	if len(result.Unrecognized) != 1 || result.Unrecognized[0] != "tag DE at offset 10: DE00" {
+		t.Errorf("Unrecognized = %q", result.Unrecognized)
+	}
+}
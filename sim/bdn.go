@@ -0,0 +1,197 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// EF_BDN (TS 31.102 4.2.44) holds the barred dialling numbers: numbers the UE refuses to
+// call while BDN is available (UST service 6) and enabled (EST service 2). A record is the
+// EF_ADN layout followed by a comparison method pointer; numbers longer than 20 digits
+// continue in EF_EXT4 (4.2.45), which uses the EF_EXT1 record layout. Updating EF_BDN
+// requires PIN2.
+var (
+	FID_EF_BDN  = []byte{0x6F, 0x4D}
+	FID_EF_EXT4 = []byte{0x6F, 0x55}
+)
+
+// ErrBDNNotAllocated is returned when the USIM has no EF_BDN
+var ErrBDNNotAllocated = errors.New("EF_BDN is not allocated on this card (UST service 6)")
+
+// BDNEntry is one used EF_BDN record
+type BDNEntry struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name,omitempty"`
+	Number string `json:"number"`
+}
+
+// BDNList is the content of EF_BDN and the state of the BDN service
+type BDNList struct {
+	Available bool       `json:"available"` // UST service 6
+	Enabled   bool       `json:"enabled"`   // EST service 2
+	Records   int        `json:"records"`   // number of records of EF_BDN
+	Entries   []BDNEntry `json:"entries"`
+}
+
+// Free returns the number of unused records
+func (l *BDNList) Free() int {
+	return l.Records - len(l.Entries)
+}
+
+// ParseBDNEntry parses an entry given on the command line, "Name:+79001234567" or just
+// the number
+func ParseBDNEntry(s string) (BDNEntry, error) {
+	name, number, ok := strings.Cut(s, ":")
+	if !ok {
+		name, number = "", s
+	}
+	number = strings.NewReplacer(" ", "", "-", "").Replace(number)
+	if _, err := encodeSMSPAddress(number, false); err != nil {
+		return BDNEntry{}, fmt.Errorf("invalid BDN entry %q: number %w", s, err)
+	}
+	return BDNEntry{Name: strings.TrimSpace(name), Number: number}, nil
+}
+
+// decodeBDNRecord decodes an EF_BDN record with the EF_EXT4 records for its overflow
+// digits; nil for a free record
+func decodeBDNRecord(data []byte, index int, ext4 [][]byte) *BDNEntry {
+	if len(data) < 15 {
+		return nil
+	}
+	adn := data[:len(data)-1] // without the comparison method pointer
+	entry := decodeADNRecord(adn, index)
+	if entry == nil {
+		return nil
+	}
+	return &BDNEntry{
+		Index:  index,
+		Name:   entry.Name,
+		Number: entry.Number + decodeEXT1Chain(ext4, adn[len(adn)-1]),
+	}
+}
+
+// EncodeBDNRecord encodes an entry as an EF_BDN record of recLen bytes, without
+// extension record or comparison method
+func EncodeBDNRecord(entry BDNEntry, recLen int) ([]byte, error) {
+	if recLen < 15 {
+		return nil, fmt.Errorf("EF_BDN record length %d is too short", recLen)
+	}
+	rec, err := encodeADNRecord(entry.Name, entry.Number, recLen-1)
+	if err != nil {
+		return nil, err
+	}
+	return append(rec, 0xFF), nil
+}
+
+// selectBDN selects the USIM and EF_BDN and returns the record length and count.
+// ErrBDNNotAllocated when the file does not exist.
+func selectBDN(reader *card.Reader) (recLen, count int, err error) {
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return 0, 0, fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+	resp, err = reader.Select(FID_EF_BDN)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to select EF_BDN: %w", err)
+	}
+	if isFileNotFound(resp.SW()) {
+		return 0, 0, ErrBDNNotAllocated
+	}
+	if !resp.IsOK() {
+		return 0, 0, fmt.Errorf("EF_BDN selection failed: %s", resp.SWString())
+	}
+	recLen = parseFCPRecordSize(resp.Data)
+	if recLen < 15 {
+		return 0, 0, fmt.Errorf("EF_BDN record length not found in FCP")
+	}
+	count = parseFCPNumRecords(resp.Data)
+	if count == 0 {
+		count = 254
+	}
+	return recLen, count, nil
+}
+
+// ReadBDN reads EF_BDN with its EF_EXT4 overflow and the BDN service state from UST and
+// EST. ErrBDNNotAllocated when the card has no EF_BDN.
+func ReadBDN(reader *card.Reader) (*BDNList, error) {
+	recLen, count, err := selectBDN(reader)
+	if err != nil {
+		return nil, err
+	}
+	records := readRecordsAbsolute(reader, recLen, count)
+
+	ext4, _ := readLinearEF(reader, FID_EF_EXT4)
+	list := &BDNList{
+		Available: DecodeUST(readTransparentEF(reader, []byte{0x6F, 0x38}))[UST_BDN],
+		Enabled:   DecodeUST(readTransparentEF(reader, []byte{0x6F, 0x56}))[int(EST_BDN)],
+		Records:   len(records),
+		Entries:   make([]BDNEntry, 0),
+	}
+	for _, r := range records {
+		if entry := decodeBDNRecord(r.data, r.index, ext4); entry != nil {
+			list.Entries = append(list.Entries, *entry)
+		}
+	}
+	return list, nil
+}
+
+// AddBDNEntries writes the entries to the first free EF_BDN records after verifying PIN2
+// and returns the record numbers used. Nothing is written when there are not enough free
+// records.
+func AddBDNEntries(reader *card.Reader, entries []BDNEntry) ([]int, error) {
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no BDN entries given")
+	}
+	recLen, count, err := selectBDN(reader)
+	if err != nil {
+		return nil, err
+	}
+	var free []int
+	for _, r := range readRecordsAbsolute(reader, recLen, count) {
+		if isEmptyRecord(r.data) {
+			free = append(free, r.index)
+		}
+	}
+	if len(free) < len(entries) {
+		return nil, fmt.Errorf("EF_BDN has %d free record(s), %d entries given", len(free), len(entries))
+	}
+
+	data := make([][]byte, len(entries))
+	for i, entry := range entries {
+		if data[i], err = EncodeBDNRecord(entry, recLen); err != nil {
+			return nil, fmt.Errorf("BDN entry %q: %w", entry.Name, err)
+		}
+	}
+
+	if err := verifyStoredPIN2(reader); err != nil {
+		return nil, err
+	}
+	used := free[:len(entries)]
+	for i, rec := range data {
+		resp, err := reader.UpdateRecord(byte(used[i]), rec)
+		if err != nil {
+			return used[:i], fmt.Errorf("failed to write EF_BDN record %d: %w", used[i], err)
+		}
+		if !resp.IsOK() {
+			return used[:i], fmt.Errorf("EF_BDN record %d write failed: %s", used[i], resp.SWString())
+		}
+	}
+	return used, nil
+}
+
+// SetBDNEnabled enables or disables barred dialling (EST service 2). Enabling is refused
+// when the card has no EF_BDN or UST service 6 is not available.
+func SetBDNEnabled(reader *card.Reader, enabled bool) error {
+	if enabled {
+		if _, _, err := selectBDN(reader); err != nil {
+			return err
+		}
+	}
+	return SetESTService(reader, EST_BDN, enabled)
+}
@@ -0,0 +1,156 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ EF_BDN TESTS ============
+
+// bdnTestRecord is record 1 of the test EF_BDN: "Spam" with a 22 digit number whose last two
+// digits are in EF_EXT4 record 1
+const bdnTestRecord = "5370616DFFFF" + "0B91" + "21436587092143658709" + "FF" + "01" + "FF"
+
+// newBDNTestReader returns a USIM with a 3 record EF_BDN (record 1 used), EF_EXT4, UST
+// service 6 set as given and EST service 2 clear, PIN2 = 1234
+func newBDNTestReader(t *testing.T, bdnAvailable bool) (*card.Reader, *card.MockFile) {
+	t.Helper()
+	rec, _ := hex.DecodeString(bdnTestRecord)
+
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	usim := m.AddADF(AID_USIM)
+	ust := []byte{0x00, 0x00}
+	if bdnAvailable {
+		ust[0] = 0x20
+	}
+	usim.AddEF(0x6F38, ust)
+	usim.AddEF(0x6F56, []byte{0x00})
+	bdn := usim.AddRecordEF(0x6F4D, rec, bytes.Repeat([]byte{0xFF}, len(rec)), bytes.Repeat([]byte{0xFF}, len(rec)))
+	usim.AddRecordEF(0x6F55, []byte{0x02, 0x01, 0x21, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	m.Keys[card.PIN_PIN2] = []byte{'1', '2', '3', '4', 0xFF, 0xFF, 0xFF, 0xFF}
+	return card.NewReaderWithTransport("Mock", m.ATR, m), bdn
+}
+
+func TestReadBDN(t *testing.T) {
+	reader, _ := newBDNTestReader(t, true)
+	list, err := ReadBDN(reader)
+	if err != nil {
+		t.Fatalf("ReadBDN() error = %v", err)
+	}
+	if !list.Available || list.Enabled || list.Records != 3 || list.Free() != 2 {
+		t.Errorf("ReadBDN() = available %v, enabled %v, %d records, %d free; want true, false, 3, 2",
+			list.Available, list.Enabled, list.Records, list.Free())
+	}
+	want := BDNEntry{Index: 1, Name: "Spam", Number: "+1234567890123456789012"}
+	if len(list.Entries) != 1 || list.Entries[0] != want {
+		t.Errorf("Entries = %+v, want [%+v] (digits 21-22 from EF_EXT4)", list.Entries, want)
+	}
+}
+
+func TestReadBDN_NotAllocated(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(AID_USIM)
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	if _, err := ReadBDN(reader); !errors.Is(err, ErrBDNNotAllocated) {
+		t.Errorf("ReadBDN() error = %v, want ErrBDNNotAllocated", err)
+	}
+	if err := SetBDNEnabled(reader, true); !errors.Is(err, ErrBDNNotAllocated) {
+		t.Errorf("SetBDNEnabled(true) error = %v, want ErrBDNNotAllocated", err)
+	}
+}
+
+func TestParseBDNEntry(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    BDNEntry
+		wantErr bool
+	}{
+		{"Blocked:+7900 123-45-67", BDNEntry{Name: "Blocked", Number: "+79001234567"}, false},
+		{"0900123", BDNEntry{Number: "0900123"}, false},
+		{"Premium:*#0900", BDNEntry{Name: "Premium", Number: "*#0900"}, false},
+		{"Blocked:", BDNEntry{}, true},
+		{"Blocked:+7900abc", BDNEntry{}, true},
+		{"Long:123456789012345678901", BDNEntry{}, true},
+	}
+	for _, tc := range tests {
+		got, err := ParseBDNEntry(tc.in)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("ParseBDNEntry(%q) = %+v, %v; want %+v, error %v", tc.in, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestEncodeBDNRecord(t *testing.T) {
+	rec, err := EncodeBDNRecord(BDNEntry{Name: "Blocked", Number: "+79001234567"}, 22)
+	if err != nil {
+		t.Fatalf("EncodeBDNRecord() error = %v", err)
+	}
+	want := "426C6F636B6564" + "0791" + "9700214365F7FFFFFFFF" + "FFFF" + "FF"
+	if got := hex.EncodeToString(rec); !strings.EqualFold(got, want) {
+		t.Errorf("EncodeBDNRecord() = %s, want %s", got, want)
+	}
+	if e := decodeBDNRecord(rec, 4, nil); e == nil || e.Name != "Blocked" || e.Number != "+79001234567" {
+		t.Errorf("decodeBDNRecord() = %+v", e)
+	}
+	if _, err := EncodeBDNRecord(BDNEntry{Name: "Too long for the field", Number: "1"}, 22); err == nil {
+		t.Error("EncodeBDNRecord() with a name longer than the alpha field succeeded")
+	}
+}
+
+func TestAddBDNEntries(t *testing.T) {
+	entries := []BDNEntry{{Name: "Block", Number: "+79001234567"}, {Number: "0900123"}}
+
+	SetPIN2("")
+	reader, bdn := newBDNTestReader(t, true)
+	if _, err := AddBDNEntries(reader, entries); err == nil {
+		t.Error("AddBDNEntries() without PIN2 succeeded")
+	}
+	if !isEmptyRecord(bdn.Records[1]) {
+		t.Error("a record was written without PIN2")
+	}
+
+	SetPIN2("1234")
+	defer SetPIN2("")
+	records, err := AddBDNEntries(reader, entries)
+	if err != nil {
+		t.Fatalf("AddBDNEntries() error = %v", err)
+	}
+	if len(records) != 2 || records[0] != 2 || records[1] != 3 {
+		t.Errorf("records = %v, want [2 3]", records)
+	}
+	list, err := ReadBDN(reader)
+	if err != nil || len(list.Entries) != 3 || list.Entries[1].Number != "+79001234567" || list.Entries[2].Number != "0900123" {
+		t.Errorf("ReadBDN() after add = %+v, %v", list, err)
+	}
+
+	if _, err := AddBDNEntries(reader, entries[:1]); err == nil {
+		t.Error("AddBDNEntries() on a full EF_BDN succeeded")
+	}
+}
+
+func TestSetBDNEnabled(t *testing.T) {
+	reader, _ := newBDNTestReader(t, true)
+	if err := SetBDNEnabled(reader, true); err != nil {
+		t.Fatalf("SetBDNEnabled(true) error = %v", err)
+	}
+	if list, err := ReadBDN(reader); err != nil || !list.Enabled {
+		t.Errorf("BDN enabled = %v, %v after SetBDNEnabled(true)", list.Enabled, err)
+	}
+	if err := SetBDNEnabled(reader, false); err != nil {
+		t.Fatalf("SetBDNEnabled(false) error = %v", err)
+	}
+	if list, _ := ReadBDN(reader); list.Enabled {
+		t.Error("BDN still enabled after SetBDNEnabled(false)")
+	}
+
+	reader, _ = newBDNTestReader(t, false)
+	if err := SetBDNEnabled(reader, true); err == nil {
+		t.Error("SetBDNEnabled(true) without UST service 6 succeeded")
+	}
+}
@@ -0,0 +1,301 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"sim_reader/card"
+	"sim_reader/textcodec"
+)
+
+// Call information and advice of charge files under ADF_USIM (TS 31.102)
+var (
+	FID_EF_ACMmax = []byte{0x6F, 0x37} // Accumulated call meter maximum (PIN2 to update)
+	FID_EF_ACM    = []byte{0x6F, 0x39} // Accumulated call meter, cyclic (PIN1/PIN2)
+	FID_EF_PUCT   = []byte{0x6F, 0x41} // Price per unit and currency table (PIN2 to update)
+	FID_EF_ICI    = []byte{0x6F, 0x80} // Incoming call information, cyclic
+	FID_EF_OCI    = []byte{0x6F, 0x81} // Outgoing call information, cyclic
+)
+
+// CallRecord is one EF_ICI / EF_OCI record
+type CallRecord struct {
+	Index    int    `json:"index"`            // Record number (1 = most recent)
+	Name     string `json:"name,omitempty"`   // Alpha identifier
+	Number   string `json:"number,omitempty"` // Dialling number
+	Time     string `json:"time,omitempty"`   // Call date/time as stored by the ME
+	Duration int    `json:"duration"`         // Call duration in seconds
+	Status   string `json:"status,omitempty"` // answered / not answered (EF_ICI only)
+}
+
+// CallInfo holds call information and advice of charge data
+type CallInfo struct {
+	Incoming []CallRecord `json:"incoming,omitempty"` // EF_ICI
+	Outgoing []CallRecord `json:"outgoing,omitempty"` // EF_OCI
+
+	ACM          *int     `json:"acm,omitempty"`            // EF_ACM current value (units)
+	ACMmax       *int     `json:"acm_max,omitempty"`        // EF_ACMmax (0 = no limit)
+	Currency     string   `json:"currency,omitempty"`       // EF_PUCT currency code
+	PricePerUnit *float64 `json:"price_per_unit,omitempty"` // EF_PUCT EPPU * 10^EX
+}
+
+// ReadCallInfo reads EF_ICI, EF_OCI, EF_ACM, EF_ACMmax and EF_PUCT.
+// Files missing on the card are left empty.
+func ReadCallInfo(reader *card.Reader) (*CallInfo, error) {
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return nil, fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+
+	info := &CallInfo{}
+	for _, rec := range readCyclicFile(reader, FID_EF_ICI) {
+		if r := decodeCallRecord(rec.data, rec.index, true); r != nil {
+			info.Incoming = append(info.Incoming, *r)
+		}
+	}
+	for _, rec := range readCyclicFile(reader, FID_EF_OCI) {
+		if r := decodeCallRecord(rec.data, rec.index, false); r != nil {
+			info.Outgoing = append(info.Outgoing, *r)
+		}
+	}
+
+	if recs := readCyclicFile(reader, FID_EF_ACM); len(recs) > 0 {
+		if acm, ok := decodeACM(recs[0].data); ok {
+			info.ACM = &acm
+		}
+	}
+	if data := readTransparentEF(reader, FID_EF_ACMmax); data != nil {
+		if acmMax, ok := decodeACM(data); ok {
+			info.ACMmax = &acmMax
+		}
+	}
+	if data := readTransparentEF(reader, FID_EF_PUCT); data != nil {
+		if currency, ppu, ok := decodePUCT(data); ok {
+			info.Currency = currency
+			info.PricePerUnit = &ppu
+		}
+	}
+
+	return info, nil
+}
+
+// cyclicRecord is a record read from a cyclic EF with its record number
+type cyclicRecord struct {
+	index int
+	data  []byte
+}
+
+// readCyclicFile reads all records of a cyclic EF in record number order (record 1 is the
+// most recent). Records are read oldest first with the PREVIOUS addressing mode, which is
+// how cyclic files are walked; cards that reject it are read with absolute addressing.
+func readCyclicFile(reader *card.Reader, fid []byte) []cyclicRecord {
+	resp, err := reader.Select(fid)
+	if err != nil || !resp.IsOK() {
+		return nil
+	}
+	recLen := parseFCPRecordSize(resp.Data)
+	count := parseFCPNumRecords(resp.Data)
+	if recLen == 0 || count == 0 {
+		return nil
+	}
+
+	records := make([]cyclicRecord, count)
+	for i := count; i >= 1; i-- {
+		rd, err := reader.ReadPreviousRecord(byte(recLen))
+		if err != nil || !rd.IsOK() {
+			return readRecordsAbsolute(reader, recLen, count)
+		}
+		records[i-1] = cyclicRecord{index: i, data: rd.Data}
+	}
+	return records
+}
+
+// readRecordsAbsolute reads records 1..count of the selected EF with absolute addressing
+func readRecordsAbsolute(reader *card.Reader, recLen, count int) []cyclicRecord {
+	var records []cyclicRecord
+	for i := 1; i <= count; i++ {
+		rd, err := reader.ReadRecord(byte(i), byte(recLen))
+		if err != nil || !rd.IsOK() {
+			break
+		}
+		records = append(records, cyclicRecord{index: i, data: rd.Data})
+	}
+	return records
+}
+
+// readTransparentEF reads a transparent EF of the selected application (nil on any failure)
+func readTransparentEF(reader *card.Reader, fid []byte) []byte {
+	resp, err := reader.Select(fid)
+	if err != nil || !resp.IsOK() {
+		return nil
+	}
+	size := parseFCPFileSize(resp.Data)
+	if size <= 0 || size > 255 {
+		return nil
+	}
+	rd, err := reader.ReadBinary(0, byte(size))
+	if err != nil || !rd.IsOK() {
+		return nil
+	}
+	return rd.Data
+}
+
+// decodeCallRecord decodes an EF_ICI (incoming) or EF_OCI record
+// Format: Alpha-ID (X) + BCD-len (1) + TON/NPI (1) + Number (10) + CCP2 (1) + Ext5 (1) +
+// Date/time (7) + Duration (3) + [Status (1), EF_ICI only] + Link to phonebook (3)
+func decodeCallRecord(data []byte, index int, incoming bool) *CallRecord {
+	fixed := 27
+	if incoming {
+		fixed = 28
+	}
+	if len(data) < fixed || isEmptyRecord(data) {
+		return nil
+	}
+
+	alphaLen := len(data) - fixed
+	rec := &CallRecord{
+		Index: index,
+		Name:  textcodec.DecodeAlpha(data[:alphaLen]),
+	}
+
+	body := data[alphaLen:]
+	if bcdLen := body[0]; bcdLen != 0xFF && bcdLen != 0 {
+		rec.Number = decodeBCDNumber(body[2:12], body[1])
+	}
+	rec.Time = decodeCallTime(body[14:21])
+	rec.Duration = int(body[21])<<16 | int(body[22])<<8 | int(body[23])
+	if incoming {
+		if body[24]&0x01 != 0 {
+			rec.Status = "answered"
+		} else {
+			rec.Status = "not answered"
+		}
+	}
+	return rec
+}
+
+// decodeCallTime decodes a call date/time (YY MM DD hh mm ss TZ, swapped BCD as in
+// TS 23.040 TP-SCTS). The time zone is in quarters of an hour, b4 of the first digit is the sign.
+func decodeCallTime(data []byte) string {
+	if len(data) < 7 || isEmptyRecord(data) {
+		return ""
+	}
+	d := decodeBCDSwapped(data[:6])
+	if len(d) != 12 {
+		return ""
+	}
+	tz := data[6]
+	quarters := int(tz&0x07)*10 + int(tz>>4)
+	sign := "+"
+	if tz&0x08 != 0 {
+		sign = "-"
+	}
+	return fmt.Sprintf("20%s-%s-%s %s:%s:%s %s%02d:%02d",
+		d[0:2], d[2:4], d[4:6], d[6:8], d[8:10], d[10:12], sign, quarters/4, (quarters%4)*15)
+}
+
+// decodeACM decodes a 3-byte EF_ACM record or EF_ACMmax value (units)
+func decodeACM(data []byte) (int, bool) {
+	if len(data) < 3 {
+		return 0, false
+	}
+	return int(data[0])<<16 | int(data[1])<<8 | int(data[2]), true
+}
+
+// decodePUCT decodes EF_PUCT: currency code (3 characters) + EPPU (12 bits) + EX sign + EX (3 bits).
+// Byte 4 holds EPPU b12-b5, byte 5 holds EPPU b4-b1 (b1-b4), the EX sign (b5) and EX (b6-b8).
+func decodePUCT(data []byte) (currency string, ppu float64, ok bool) {
+	if len(data) < 5 || isEmptyRecord(data) {
+		return "", 0, false
+	}
+	currency = textcodec.DecodeAlpha(data[:3])
+	eppu := int(data[3])<<4 | int(data[4]&0x0F)
+	ex := int(data[4] >> 5)
+	if data[4]&0x10 != 0 {
+		ex = -ex
+	}
+	return currency, float64(eppu) * math.Pow10(ex), true
+}
+
+// isEmptyRecord reports whether data is all FF
+func isEmptyRecord(data []byte) bool {
+	for _, b := range data {
+		if b != 0xFF {
+			return false
+		}
+	}
+	return true
+}
+
+// ResetACM sets the accumulated call meter to zero (EF_ACM, requires PIN2).
+// The new value is appended as the newest record, as required for cyclic files.
+func ResetACM(reader *card.Reader) error {
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+	if err := verifyStoredPIN2(reader); err != nil {
+		return err
+	}
+
+	resp, err = reader.Select(FID_EF_ACM)
+	if err != nil {
+		return fmt.Errorf("failed to select EF_ACM: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("EF_ACM selection failed: %s", resp.SWString())
+	}
+	recLen := parseFCPRecordSize(resp.Data)
+	if recLen == 0 {
+		recLen = 3
+	}
+
+	resp, err = reader.AppendCyclicRecord(make([]byte, recLen))
+	if err != nil {
+		return fmt.Errorf("failed to reset ACM: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("ACM reset failed: %s", resp.SWString())
+	}
+	return nil
+}
+
+// WriteACMmax writes the accumulated call meter maximum (EF_ACMmax, requires PIN2).
+// units = 0 disables the limit.
+func WriteACMmax(reader *card.Reader, units int) error {
+	if units < 0 || units > 0xFFFFFF {
+		return fmt.Errorf("ACMmax %d out of range (0-16777215)", units)
+	}
+
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+	if err := verifyStoredPIN2(reader); err != nil {
+		return err
+	}
+
+	resp, err = reader.Select(FID_EF_ACMmax)
+	if err != nil {
+		return fmt.Errorf("failed to select EF_ACMmax: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("EF_ACMmax selection failed: %s", resp.SWString())
+	}
+
+	resp, err = reader.UpdateBinary(0, []byte{byte(units >> 16), byte(units >> 8), byte(units)})
+	if err != nil {
+		return fmt.Errorf("failed to write ACMmax: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("ACMmax write failed: %s", resp.SWString())
+	}
+	return nil
+}
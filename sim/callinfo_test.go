@@ -0,0 +1,199 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ CALL INFORMATION TESTS ============
+
+// iciRecord builds an EF_ICI record: "Bob", +79001234567, 2024-05-01 12:30:45 +03:00, 90 s
+func iciRecord(answered bool) []byte {
+	rec := []byte{'B', 'o', 'b', 0xFF}
+	rec = append(rec, 0x07, 0x91, 0x97, 0x00, 0x21, 0x43, 0x65, 0xF7, 0xFF, 0xFF, 0xFF, 0xFF)
+	rec = append(rec, 0xFF, 0xFF)                               // CCP2, Ext5
+	rec = append(rec, 0x42, 0x50, 0x10, 0x21, 0x03, 0x54, 0x21) // date/time
+	rec = append(rec, 0x00, 0x00, 0x5A)                         // duration
+	status := byte(0x00)
+	if answered {
+		status = 0x01
+	}
+	return append(rec, status, 0xFF, 0xFF, 0xFF)
+}
+
+func TestDecodeCallRecord(t *testing.T) {
+	answered := iciRecord(true)
+	oci := append(append([]byte{}, answered[:28]...), 0xFF, 0xFF, 0xFF) // no status byte
+
+	tests := []struct {
+		name     string
+		data     []byte
+		incoming bool
+		want     *CallRecord
+	}{
+		{"Incoming answered", answered, true, &CallRecord{Index: 1, Name: "Bob", Number: "+79001234567",
+			Time: "2024-05-01 12:30:45 +03:00", Duration: 90, Status: "answered"}},
+		{"Incoming missed", iciRecord(false), true, &CallRecord{Index: 1, Name: "Bob", Number: "+79001234567",
+			Time: "2024-05-01 12:30:45 +03:00", Duration: 90, Status: "not answered"}},
+		{"Outgoing", oci, false, &CallRecord{Index: 1, Name: "Bob", Number: "+79001234567",
+			Time: "2024-05-01 12:30:45 +03:00", Duration: 90}},
+		{"Empty", bytes.Repeat([]byte{0xFF}, 32), true, nil},
+		{"Too short", []byte{0x01, 0x02}, false, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := decodeCallRecord(tc.data, 1, tc.incoming)
+			if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+				t.Errorf("decodeCallRecord() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCallTime(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"Positive zone", []byte{0x42, 0x50, 0x10, 0x21, 0x03, 0x54, 0x21}, "2024-05-01 12:30:45 +03:00"},
+		{"Negative zone", []byte{0x42, 0x21, 0x13, 0x80, 0x00, 0x00, 0x0A}, "2024-12-31 08:00:00 -05:00"},
+		{"Quarter hour zone", []byte{0x42, 0x50, 0x10, 0x00, 0x00, 0x00, 0x32}, "2024-05-01 00:00:00 +05:45"},
+		{"Empty", bytes.Repeat([]byte{0xFF}, 7), ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := decodeCallTime(tc.data); got != tc.want {
+				t.Errorf("decodeCallTime() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodePUCT(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		currency string
+		ppu      float64
+		ok       bool
+	}{
+		{"EPPU 125 EX -2", []byte{'E', 'U', 'R', 0x07, 0x5D}, "EUR", 1.25, true},
+		{"EPPU 3 EX 1", []byte{'R', 'U', 'B', 0x00, 0x23}, "RUB", 30, true},
+		{"Empty", bytes.Repeat([]byte{0xFF}, 5), "", 0, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			currency, ppu, ok := decodePUCT(tc.data)
+			if currency != tc.currency || ppu != tc.ppu || ok != tc.ok {
+				t.Errorf("decodePUCT() = %q, %g, %v, want %q, %g, %v", currency, ppu, ok, tc.currency, tc.ppu, tc.ok)
+			}
+		})
+	}
+}
+
+// newCallInfoTestReader returns a simulated USIM with cyclic EF_ICI/EF_OCI/EF_ACM,
+// EF_ACMmax and EF_PUCT, PIN2 = 1234 under key reference pin2Ref
+func newCallInfoTestReader(pin2Ref byte) (*card.Reader, *card.MockCard, *card.MockFile) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	usim := m.AddADF(AID_USIM)
+	blank := bytes.Repeat([]byte{0xFF}, 32)
+	usim.AddCyclicEF(0x6F80, iciRecord(true), iciRecord(false), blank)
+	usim.AddCyclicEF(0x6F81, blank, blank)
+	acm := usim.AddCyclicEF(0x6F39, []byte{0x00, 0x00, 0x10}, []byte{0x00, 0x00, 0x05})
+	usim.AddEF(0x6F37, []byte{0x00, 0x01, 0xF4})
+	usim.AddEF(0x6F41, []byte{'E', 'U', 'R', 0x07, 0x5D})
+	m.Keys[pin2Ref] = []byte{'1', '2', '3', '4', 0xFF, 0xFF, 0xFF, 0xFF}
+	return card.NewReaderWithTransport("Mock", m.ATR, m), m, acm
+}
+
+func TestReadCallInfo(t *testing.T) {
+	reader, m, _ := newCallInfoTestReader(card.PIN_PIN2)
+	info, err := ReadCallInfo(reader)
+	if err != nil {
+		t.Fatalf("ReadCallInfo() error = %v", err)
+	}
+
+	if len(info.Incoming) != 2 || info.Incoming[0].Index != 1 || info.Incoming[0].Status != "answered" ||
+		info.Incoming[1].Status != "not answered" {
+		t.Errorf("Incoming = %+v, want records 1 (answered) and 2 (not answered)", info.Incoming)
+	}
+	if len(info.Outgoing) != 0 {
+		t.Errorf("Outgoing = %+v, want none", info.Outgoing)
+	}
+	if info.ACM == nil || *info.ACM != 16 {
+		t.Errorf("ACM = %v, want 16", info.ACM)
+	}
+	if info.ACMmax == nil || *info.ACMmax != 500 {
+		t.Errorf("ACMmax = %v, want 500", info.ACMmax)
+	}
+	if info.Currency != "EUR" || info.PricePerUnit == nil || *info.PricePerUnit != 1.25 {
+		t.Errorf("PUCT = %q %v, want EUR 1.25", info.Currency, info.PricePerUnit)
+	}
+
+	previous := 0
+	for _, apdu := range m.Log {
+		if apdu[1] == card.INS_READ_RECORD && apdu[3] == card.RecordModePrevious {
+			previous++
+		}
+	}
+	if previous != 7 {
+		t.Errorf("READ RECORD previous count = %d, want 7 (3 ICI + 2 OCI + 2 ACM)", previous)
+	}
+}
+
+func TestResetACM(t *testing.T) {
+	tests := []struct {
+		name    string
+		pin2Ref byte
+		pin2    string
+		wantErr bool
+	}{
+		{"PIN2 local key 81", card.PIN_PIN2, "1234", false},
+		{"CHV2 fallback", card.PIN_CHV2, "1234", false},
+		{"PIN2 not set", card.PIN_PIN2, "", true},
+		{"Wrong PIN2", card.PIN_PIN2, "0000", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			SetPIN2(tc.pin2)
+			defer SetPIN2("")
+
+			reader, _, acm := newCallInfoTestReader(tc.pin2Ref)
+			err := ResetACM(reader)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ResetACM() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			// The oldest record is overwritten and becomes record 1
+			if !bytes.Equal(acm.Records[0], []byte{0, 0, 0}) || !bytes.Equal(acm.Records[1], []byte{0, 0, 0x10}) {
+				t.Errorf("EF_ACM records = %X, want [000000 000010]", acm.Records)
+			}
+		})
+	}
+}
+
+func TestWriteACMmax(t *testing.T) {
+	SetPIN2("1234")
+	defer SetPIN2("")
+
+	reader, _, _ := newCallInfoTestReader(card.PIN_PIN2)
+	if err := WriteACMmax(reader, 1000); err != nil {
+		t.Fatalf("WriteACMmax() error = %v", err)
+	}
+	info, err := ReadCallInfo(reader)
+	if err != nil || info.ACMmax == nil || *info.ACMmax != 1000 {
+		t.Errorf("ACMmax after write = %v, %v, want 1000", info.ACMmax, err)
+	}
+	if err := WriteACMmax(reader, 0x1000000); err == nil {
+		t.Error("WriteACMmax(0x1000000) succeeded, want range error")
+	}
+}
@@ -0,0 +1,321 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// CardCopy is the subscription content read from a source card by ReadCardCopy, to be
+// written to another card with WriteCardCopy
+type CardCopy struct {
+	ICCID     string         `json:"iccid"`
+	Files     []SnapshotFile `json:"files"`
+	NotCopied []SnapshotSkip `json:"not_copied,omitempty"`
+}
+
+// copySet lists the copy-safe EFs per application: the subscription (IMSI, SPN, PLMN
+// lists, service tables, IMS identities) and the user data (phonebook, SMS). Everything
+// else stays with the card.
+var copySet = map[string][]uint16{
+	"ADF_USIM": {
+		0x6F07, 0x6FAD, 0x6F40, 0x6F46, 0x6F05, 0x6F78, // IMSI, AD, MSISDN, SPN, LI, ACC
+		0x6F62, 0x6F61, 0x6F60, 0x6F7B, 0x6F31, // HPLMNwACT, OPLMNwACT, PLMNwACT, FPLMN, HPPLMN
+		0x6F38, 0x6F56, // UST, EST
+		0x6F3A, 0x6F3B, 0x6F3C, 0x6F42, // ADN, FDN, SMS, SMSP
+	},
+	"ADF_ISIM": {
+		0x6F02, 0x6F03, 0x6F04, 0x6F07, 0x6F09, 0x6FAD, // IMPI, DOMAIN, IMPU, IST, PCSCF, AD
+		0x6F3C, 0x6F42, // SMS, SMSP
+	},
+	"DF_TELECOM": {0x6F3A, 0x6F4A, 0x6F3C}, // ADN, EXT1, SMS
+}
+
+// copyExcluded gives the reason a known EF is not copied; other EFs are "not part of the
+// subscription"
+var copyExcluded = map[string]map[uint16]string{
+	"MF": {
+		0x2FE2: "card identity, stays with the card",
+		0x2F00: "application directory of the card",
+	},
+	"ADF_USIM": {
+		0x6F08: "security context of the source card (derived from its Ki)",
+		0x6F09: "security context of the source card (derived from its Ki)",
+		0x6FE4: "security context of the source card (derived from its Ki)",
+		0x6F7E: "registration state of the source card",
+		0x6FAE: "registration state of the source card",
+		0x6F73: "registration state of the source card",
+		0x6FE3: "registration state of the source card",
+		0x6F5C: "registration state of the source card",
+		0x6F5D: "registration state of the source card",
+	},
+	"ADF_ISIM": {
+		0x6F06: "access rules of the card",
+	},
+}
+
+// copyTelecomFiles are the DF_TELECOM files of copySet
+var copyTelecomFiles = map[uint16]EFDefinition{
+	0x6F3A: {0x6F3A, "EF_ADN", "Abbreviated Dialling Numbers", FileTypeLinearFixed, 0, "DF_TELECOM"},
+	0x6F4A: {0x6F4A, "EF_EXT1", "Extension 1", FileTypeLinearFixed, 0, "DF_TELECOM"},
+	0x6F3C: {0x6F3C, "EF_SMS", "Short Messages", FileTypeLinearFixed, 0, "DF_TELECOM"},
+}
+
+// pbrFileNames names the DF_PHONEBOOK files by their EF_PBR tag
+var pbrFileNames = map[byte]string{
+	PBRTagADN: "EF_ADN", PBRTagIAP: "EF_IAP", PBRTagEXT1: "EF_EXT1", PBRTagSNE: "EF_SNE",
+	PBRTagANR: "EF_ANR", PBRTagPBC: "EF_PBC", PBRTagGRP: "EF_GRP", PBRTagAAS: "EF_AAS",
+	PBRTagGAS: "EF_GAS", PBRTagUID: "EF_UID", PBRTagEMAIL: "EF_EMAIL", PBRTagCCP1: "EF_CCP1",
+}
+
+// copyApplications are the file groups of a copy: the snapshot applications, DF_TELECOM
+// and the USIM DF_PHONEBOOK, whose files come from the EF_PBR of the source
+func copyApplications() []snapshotApplication {
+	apps := snapshotApplications()
+	return append(apps,
+		snapshotApplication{"DF_TELECOM", copyTelecomFiles, []byte{0x6F, 0x06}, func(reader *card.Reader) error {
+			if !selectDFTelecom(reader) {
+				return fmt.Errorf("select DF_TELECOM: %s", card.SWToString(reader.LastSW()))
+			}
+			return nil
+		}},
+		snapshotApplication{PhonebookUSIM, nil, []byte{0x6F, 0x06}, func(reader *card.Reader) error {
+			resp, err := SelectUSIMWithAuth(reader)
+			if err := selectResult(resp, err, "USIM"); err != nil {
+				return err
+			}
+			resp, err = reader.SelectDF(FID_DF_PHONEBOOK)
+			return selectResult(resp, err, "DF_PHONEBOOK")
+		}},
+	)
+}
+
+// ReadCardCopy reads the copy-safe files of the source card. Known EFs outside the copy
+// set and copy-set files that cannot be read are listed in NotCopied with the reason. Ki,
+// OPc, PINs and ADM keys cannot be read from a card and are never copied.
+func ReadCardCopy(reader *card.Reader) (*CardCopy, error) {
+	if UseGSMCommands {
+		return nil, fmt.Errorf("card copy needs a UICC (GSM-only card)")
+	}
+	cp := &CardCopy{ICCID: readSnapshotICCID(reader)}
+	cp.NotCopied = append(cp.NotCopied, SnapshotSkip{Name: "Ki, OPc, PINs, ADM keys", Application: "-",
+		Reason: "secrets cannot be read from a card"})
+
+	for _, app := range copyApplications() {
+		if err := app.selectFn(reader); err != nil {
+			if app.name == "MF" {
+				return nil, err
+			}
+			continue // not on this card
+		}
+		files := app.files
+		if app.name == PhonebookUSIM {
+			files = pbrCopyFiles(reader)
+		}
+		inSet := map[uint16]bool{}
+		for _, id := range copySet[app.name] {
+			inSet[id] = true
+		}
+		for _, id := range sortedFileIDs(files) {
+			def := files[id]
+			resp, err := reader.Select([]byte{byte(id >> 8), byte(id)})
+			if err != nil || !resp.IsOK() {
+				continue // not present on this card
+			}
+			if app.name != PhonebookUSIM && !inSet[id] {
+				reason, ok := copyExcluded[app.name][id]
+				if !ok {
+					reason = "not part of the subscription"
+				}
+				cp.NotCopied = append(cp.NotCopied, SnapshotSkip{Name: def.Name, Application: app.name, Reason: reason})
+				continue
+			}
+			file := SnapshotFile{Name: def.Name, Application: app.name, FID: fmt.Sprintf("%04X", id), Description: def.Description}
+			if reason := readSnapshotContent(reader, resp.Data, &file); reason != "" {
+				cp.NotCopied = append(cp.NotCopied, SnapshotSkip{Name: def.Name, Application: app.name, Reason: "source: " + reason})
+				continue
+			}
+			cp.Files = append(cp.Files, file)
+		}
+	}
+	return cp, nil
+}
+
+// pbrCopyFiles returns the files listed in EF_PBR of the selected DF_PHONEBOOK
+func pbrCopyFiles(reader *card.Reader) map[uint16]EFDefinition {
+	pbr, ok := readLinearEF(reader, FID_EF_PBR)
+	if !ok {
+		return nil
+	}
+	files := map[uint16]EFDefinition{}
+	for _, rec := range pbr {
+		for _, f := range ParsePBRRecord(rec) {
+			id := uint16(f.FID[0])<<8 | uint16(f.FID[1])
+			name, ok := pbrFileNames[f.Tag]
+			if !ok {
+				name = "EF"
+			}
+			files[id] = EFDefinition{ID: id, Name: fmt.Sprintf("%s %04X", name, id), Parent: PhonebookUSIM}
+		}
+	}
+	return files
+}
+
+// WriteCardCopy writes the files of cp to the target card and verifies every write by
+// reading it back. Files the target does not have, cannot write or that need a credential
+// not in creds (judged by the access conditions of the target) are returned as not copied.
+// Contents are fitted to the target: shorter files and fewer records are padded with FF,
+// longer ones are cut if only FF is lost.
+func WriteCardCopy(reader *card.Reader, cp *CardCopy, creds Credentials) (*ApplyReport, []SnapshotSkip, error) {
+	if cp.ICCID != "" && readSnapshotICCID(reader) == cp.ICCID {
+		return nil, nil, fmt.Errorf("source and target are the same card (ICCID %s)", cp.ICCID)
+	}
+
+	report := &ApplyReport{simulate: reader.DryRun()}
+	var notCopied []SnapshotSkip
+	for _, app := range copyApplications() {
+		var files []SnapshotFile
+		for _, f := range cp.Files {
+			if f.Application == app.name {
+				files = append(files, f)
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		if err := app.selectFn(reader); err != nil {
+			for _, f := range files {
+				notCopied = append(notCopied, SnapshotSkip{Name: f.Name, Application: app.name, Reason: "target: " + err.Error()})
+			}
+			continue
+		}
+		arr := readARRTable(reader, app.arrFID)
+		if err := app.selectFn(reader); err != nil {
+			return report, notCopied, err
+		}
+
+		pin2Verified := false
+		for _, f := range files {
+			name := app.name + "/" + f.Name
+			skip := func(reason string) {
+				notCopied = append(notCopied, SnapshotSkip{Name: f.Name, Application: app.name, Reason: "target: " + reason})
+			}
+			id, _ := hex.DecodeString(f.FID)
+			resp, err := reader.Select(id)
+			if err != nil || !resp.IsOK() {
+				skip("file not present")
+				continue
+			}
+			writeAccess := resolveWriteAccess(resp.Data, arr)
+			credential, _, ok := snapshotCredential(writeAccess)
+			if !ok {
+				skip(fmt.Sprintf("not writable (%s)", writeAccess))
+				continue
+			}
+			if !creds.Satisfies(credential) {
+				skip(fmt.Sprintf("requires %s", credential))
+				continue
+			}
+			fitted, err := fitCopyFile(f, resp.Data)
+			if err != nil {
+				report.failed(nil, name, err)
+				continue
+			}
+			if strings.Contains(credential, CredentialPIN2) && StoredPIN2 != "" && !pin2Verified {
+				if err := verifyStoredPIN2(reader); err != nil && credential == CredentialPIN2 {
+					report.failed(reader, name, fmt.Errorf("PIN2: %w", err))
+					continue
+				}
+				pin2Verified = true
+			}
+			fitted.Name = name
+			restoreSnapshotFile(reader, report, fitted)
+		}
+	}
+	return report, notCopied, report.Err()
+}
+
+// resolveWriteAccess returns the UPDATE access condition of the selected EF (fcp), with
+// an ARR reference resolved from the EF_ARR rules of its application
+func resolveWriteAccess(fcp []byte, arr map[int]ARRRecord) string {
+	_, writeAccess := parseFCPSecurityAttributes(fcp)
+	if strings.HasPrefix(writeAccess, "ARR#") {
+		var recNum int
+		fmt.Sscanf(writeAccess, "ARR#%d", &recNum)
+		if rec, ok := arr[recNum]; ok {
+			writeAccess = rec.WriteAccess
+		}
+	}
+	return writeAccess
+}
+
+// fitCopyFile adapts the content of f to the size of the target EF (fcp)
+func fitCopyFile(f SnapshotFile, fcp []byte) (SnapshotFile, error) {
+	if structure := fcpStructure(fcp); structure != f.Structure {
+		return f, fmt.Errorf("structure differs (source %s, target %s)", f.Structure, structure)
+	}
+	switch f.Structure {
+	case "transparent":
+		data, _ := hex.DecodeString(f.Data)
+		fitted, err := fitCopyData(data, parseFCPFileSize(fcp))
+		if err != nil {
+			return f, err
+		}
+		f.Data = strings.ToUpper(hex.EncodeToString(fitted))
+	case "linear":
+		size, count := parseFCPRecordSize(fcp), parseFCPNumRecords(fcp)
+		records := make([]string, 0, count)
+		for i, recHex := range f.Records {
+			rec, _ := hex.DecodeString(recHex)
+			if len(rec) != size {
+				return f, fmt.Errorf("record size differs (source %d, target %d bytes)", len(rec), size)
+			}
+			if i >= count {
+				if !isEmptyRecord(rec) {
+					return f, fmt.Errorf("source has used records beyond the %d records of the target", count)
+				}
+				continue
+			}
+			records = append(records, recHex)
+		}
+		for len(records) < count {
+			records = append(records, strings.Repeat("FF", size))
+		}
+		f.Records = records
+	}
+	return f, nil
+}
+
+// fitCopyData pads data with FF to size or cuts FF padding off
+func fitCopyData(data []byte, size int) ([]byte, error) {
+	if len(data) <= size {
+		return append(data, bytes.Repeat([]byte{0xFF}, size-len(data))...), nil
+	}
+	if !isEmptyRecord(data[size:]) {
+		return nil, fmt.Errorf("content is %d bytes, the target file only %d", len(data), size)
+	}
+	return data[:size], nil
+}
+
+// ExportCopyConfig reads the source card as a config for VerifyConfig on the target: the
+// summary diff of a copy. The ICCID is left out since it is not copied.
+func ExportCopyConfig(reader *card.Reader) (*SIMConfig, error) {
+	usim, err := ReadUSIM(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read USIM: %w", err)
+	}
+	var isim *ISIMData
+	WithISIMChannel(reader, func() error {
+		data, err := ReadISIM(reader)
+		if err == nil && data.Available {
+			isim = data
+		}
+		return err
+	})
+	config := ExportToConfig(usim, isim)
+	config.ICCID = ""
+	return config, nil
+}
@@ -0,0 +1,118 @@
+package sim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ CARD COPY TESTS ============
+
+// newCopyTestCards returns a source and a target card, both with ADM1 = "12345678". The
+// target has a longer EF_SPN protected by ADM2, one more SMS record and no EF_KEYS.
+func newCopyTestCards(t *testing.T) (source, target *card.MockCard) {
+	t.Helper()
+	saved := StoredADMKey
+	StoredADMKey = []byte("12345678")
+	t.Cleanup(func() { StoredADMKey = saved })
+	adm1 := []byte{0x30, 0x0A, 0x00}
+
+	source = card.NewMockCard([]byte{0x3B, 0x00})
+	source.Keys[0x0A] = []byte("12345678")
+	source.MF().AddEF(0x2FE2, []byte{0x98, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10, 0x32, 0x54, 0xF6})
+	usim := source.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, []byte{0x08, 0x09, 0x10, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10}).Security = adm1
+	usim.AddEF(0x6F46, []byte{0x01, 'S', 'R', 'C', 0xFF}).Security = adm1
+	usim.AddEF(0x6F08, bytes.Repeat([]byte{0x11}, 33)).Security = adm1
+	usim.AddRecordEF(0x6F3C, append([]byte{0x01}, bytes.Repeat([]byte{0x22}, 9)...), append([]byte{0x00}, bytes.Repeat([]byte{0xFF}, 9)...)).Security = adm1
+	pb := usim.AddDF(0x5F3A)
+	pb.AddRecordEF(0x4F30, []byte{0xA8, 0x05, 0xC0, 0x03, 0x4F, 0x3A, 0x01})
+	pb.AddRecordEF(0x4F3A, adnRecord("Ann", []byte{0x21, 0x43}, 0xFF)).Security = adm1
+
+	target = card.NewMockCard([]byte{0x3B, 0x00})
+	target.Keys[0x0A] = []byte("12345678")
+	target.MF().AddEF(0x2FE2, []byte{0x98, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10, 0x32, 0x64, 0xF6})
+	usim = target.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, bytes.Repeat([]byte{0xFF}, 9)).Security = adm1
+	usim.AddEF(0x6F46, bytes.Repeat([]byte{0xFF}, 8)).Security = []byte{0x30, 0x0B, 0x00}
+	usim.AddRecordEF(0x6F3C, bytes.Repeat([]byte{0x33}, 10), bytes.Repeat([]byte{0x33}, 10), bytes.Repeat([]byte{0x33}, 10)).Security = adm1
+	pb = usim.AddDF(0x5F3A)
+	pb.AddRecordEF(0x4F30, []byte{0xA8, 0x05, 0xC0, 0x03, 0x4F, 0x3A, 0x01})
+	pb.AddRecordEF(0x4F3A, bytes.Repeat([]byte{0xFF}, 18), bytes.Repeat([]byte{0xFF}, 18)).Security = adm1
+	return source, target
+}
+
+func TestCardCopy(t *testing.T) {
+	source, target := newCopyTestCards(t)
+	src := card.NewReaderWithTransport("Source", source.ATR, source)
+	dst := card.NewReaderWithTransport("Target", target.ATR, target)
+
+	cp, err := ReadCardCopy(src)
+	if err != nil {
+		t.Fatalf("ReadCardCopy() error = %v", err)
+	}
+	var read []string
+	for _, f := range cp.Files {
+		read = append(read, f.Application+"/"+f.Name)
+	}
+	want := "ADF_USIM/EF_IMSI,ADF_USIM/EF_SMS,ADF_USIM/EF_SPN,ADF_USIM/DF_PHONEBOOK/EF_ADN 4F3A"
+	if strings.Join(read, ",") != want {
+		t.Errorf("copied files = %v, want %s", read, want)
+	}
+	reasons := map[string]string{}
+	for _, s := range cp.NotCopied {
+		reasons[s.Name] = s.Reason
+	}
+	if !strings.Contains(reasons["EF_ICCID"], "identity") || !strings.Contains(reasons["EF_KEYS"], "security context") {
+		t.Errorf("not copied = %+v", cp.NotCopied)
+	}
+
+	report, notCopied, err := WriteCardCopy(dst, cp, Credentials{CredentialNone: true, CredentialADM1: true})
+	if err != nil {
+		t.Fatalf("WriteCardCopy() error = %v (report %+v)", err, report)
+	}
+	if report.Applied != 3 {
+		t.Errorf("applied = %d, want 3: %+v", report.Applied, report.Items)
+	}
+	if len(notCopied) != 1 || notCopied[0].Name != "EF_SPN" || notCopied[0].Reason != "target: requires ADM2" {
+		t.Errorf("not copied on the target = %+v", notCopied)
+	}
+
+	usim := target.MF().Children[1]
+	if got := usim.Children[0].Data; !bytes.Equal(got, source.MF().Children[1].Children[0].Data) {
+		t.Errorf("target IMSI = %X", got)
+	}
+	sms := usim.Children[2].Records
+	if sms[0][0] != 0x01 || sms[1][0] != 0x00 || !isEmptyRecord(sms[2]) {
+		t.Errorf("target SMS = %X, want the source records and an empty third record", sms)
+	}
+	if adn := usim.Children[3].Children[1].Records; !bytes.Equal(adn[0], adnRecord("Ann", []byte{0x21, 0x43}, 0xFF)) || !isEmptyRecord(adn[1]) {
+		t.Errorf("target ADN = %X", adn)
+	}
+
+	// The source itself is refused as target
+	if _, _, err := WriteCardCopy(src, cp, Credentials{CredentialNone: true, CredentialADM1: true}); err == nil || !strings.Contains(err.Error(), "same card") {
+		t.Errorf("copy onto the source: err = %v", err)
+	}
+}
+
+func TestFitCopyData(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		size    int
+		want    []byte
+		wantErr bool
+	}{
+		{[]byte{0x01, 0x02}, 4, []byte{0x01, 0x02, 0xFF, 0xFF}, false},
+		{[]byte{0x01, 0x02, 0xFF, 0xFF}, 2, []byte{0x01, 0x02}, false},
+		{[]byte{0x01, 0x02, 0x03}, 2, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := fitCopyData(tt.data, tt.size)
+		if (err != nil) != tt.wantErr || !bytes.Equal(got, tt.want) {
+			t.Errorf("fitCopyData(%X, %d) = %X, %v", tt.data, tt.size, got, err)
+		}
+	}
+}
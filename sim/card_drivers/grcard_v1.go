@@ -50,6 +50,26 @@ func (d *V1Driver) WriteKi(reader *card.Reader, ki []byte) error {
 	return nil
 }
 
+// Capabilities: the Ki file is readable on test cards once ADM is verified
+func (d *V1Driver) Capabilities() []sim.DriverCapability {
+	return []sim.DriverCapability{sim.CapReadKi}
+}
+
+// ReadKi reads the GRv1 Ki file
+func (d *V1Driver) ReadKi(reader *card.Reader) ([]byte, error) {
+	if _, err := reader.SelectByPath(V1FileKi); err != nil {
+		return nil, fmt.Errorf("failed to select GRv1 Ki file: %w", err)
+	}
+	resp, err := reader.ReadBinary(0, 16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GRv1 Ki: %w", err)
+	}
+	if !resp.IsOK() || len(resp.Data) != 16 {
+		return nil, fmt.Errorf("failed to read GRv1 Ki: %s", resp.SWString())
+	}
+	return resp.Data, nil
+}
+
 func (d *V1Driver) WriteOPc(reader *card.Reader, opc []byte) error {
 	if _, err := reader.SelectByPath(V1FileOPc); err != nil {
 		return fmt.Errorf("failed to select GRv1 OPc file: %w", err)
@@ -34,6 +34,11 @@ func (d *V2Driver) BaseCLA() byte {
 	return 0xA0
 }
 
+// ADMProfiles returns the ADM VERIFY parameters: FF-padded 8-byte keys in the card class
+func (d *V2Driver) ADMProfiles(level int) []card.ADMVerifyProfile {
+	return []card.ADMVerifyProfile{sim.StandardADMProfile(d.BaseCLA(), level)}
+}
+
 func (d *V2Driver) PrepareWrite(reader *card.Reader) error {
 	handshake, _ := hex.DecodeString("A0580000083132333431323334")
 	resp, err := reader.SendAPDU(handshake)
@@ -72,6 +77,26 @@ func (d *V2Driver) WriteKi(reader *card.Reader, ki []byte) error {
 	return nil
 }
 
+// Capabilities: the Ki file is readable on test cards once ADM is verified
+func (d *V2Driver) Capabilities() []sim.DriverCapability {
+	return []sim.DriverCapability{sim.CapReadKi}
+}
+
+// ReadKi reads the GRv2 Ki file
+func (d *V2Driver) ReadKi(reader *card.Reader) ([]byte, error) {
+	if err := d.selectFile(reader, V2FileKi); err != nil {
+		return nil, fmt.Errorf("failed to select GRv2 Ki file: %w", err)
+	}
+	resp, err := reader.ReadBinaryGSM(0, 16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GRv2 Ki: %w", err)
+	}
+	if !resp.IsOK() || len(resp.Data) != 16 {
+		return nil, fmt.Errorf("failed to read GRv2 Ki: %s", resp.SWString())
+	}
+	return resp.Data, nil
+}
+
 func (d *V2Driver) WriteOPc(reader *card.Reader, opc []byte) error {
 	if err := d.selectFile(reader, V2FileOPc); err != nil {
 		return fmt.Errorf("failed to select GRv2 OPc file: %w", err)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sim_reader/card"
 	"sim_reader/sim"
+	"strconv"
 	"strings"
 )
 
@@ -15,6 +16,19 @@ const (
 	NAA_S3G_256  byte = 0x4C
 )
 
+// RuSIM / OX24 algorithm selector (under ADF USIM). Batches differ in the body length:
+// the algorithm byte alone, followed by the key length in bytes, or followed by the key
+// length, the TUAK Keccak iteration count and the RES length in bytes.
+var rusimAlgoFID = []byte{0x8F, 0x90}
+
+// RuSIM / OX24 OTA counter file (under ADF USIM): linear fixed, one record per TAR,
+// TAR(3) | CNTR(5) | KIc(1) | KID(1)
+var (
+	rusimOTACounterFID       = []byte{0x8F, 0x92}
+	rusimOTACounterRecordLen = byte(10)
+	rusimOTACounterMaxRecs   = 32
+)
+
 type RuSIMDriver struct{}
 
 func init() {
@@ -29,6 +43,15 @@ func (d *RuSIMDriver) BaseCLA() byte {
 	return 0xA0
 }
 
+func (d *RuSIMDriver) Capabilities() []sim.DriverCapability {
+	return []sim.DriverCapability{sim.CapReadOTACounter, sim.CapAlgorithmParams}
+}
+
+// ADMProfiles returns the ADM VERIFY parameters: FF-padded 8-byte keys in the card class
+func (d *RuSIMDriver) ADMProfiles(level int) []card.ADMVerifyProfile {
+	return []card.ADMVerifyProfile{sim.StandardADMProfile(d.BaseCLA(), level)}
+}
+
 func (d *RuSIMDriver) PrepareWrite(reader *card.Reader) error {
 	return nil
 }
@@ -60,66 +83,98 @@ func (d *RuSIMDriver) WriteMilenageRAndC(reader *card.Reader) error {
 	return nil
 }
 
+// SetAlgorithmType writes the algorithm byte of EF 8F90. Options after the algorithm
+// (tuak:keccak=2:reslen=8, keylen=16|32) update the other fields of the 2- and 4-byte
+// layouts and fail on layouts without them.
 func (d *RuSIMDriver) SetAlgorithmType(reader *card.Reader, algo string) error {
-	naaByte, err := d.parseAuthAlgo(algo)
+	setting, err := d.parseAlgoSetting(algo)
 	if err != nil {
 		return err
 	}
 
-	// Select USIM
-	if _, err := sim.SelectUSIMWithAuth(reader); err != nil {
+	body := []byte{setting.Algo}
+	if setting.bodyLen() > 1 {
+		cur, err := d.readAlgoSelector(reader)
+		if err != nil {
+			return err
+		}
+		if body, err = setting.apply(cur); err != nil {
+			return err
+		}
+	} else if _, err := d.selectAlgoFile(reader); err != nil {
 		return err
 	}
 
-	// Select EF 8F90 (NAA)
-	resp, err := reader.SelectGSM([]byte{0x8F, 0x90})
-	if err != nil {
-		return fmt.Errorf("select EF 8F90 failed: %w", err)
-	}
-	if !resp.IsOK() && !resp.HasMoreData() {
-		return fmt.Errorf("select EF 8F90 failed: %s", card.SWToString(resp.SW()))
-	}
-
-	// Write 1 byte
-	resp, err = reader.UpdateBinaryGSM(0, []byte{naaByte})
+	resp, err := reader.UpdateBinaryGSM(0, body)
 	if err != nil {
 		return fmt.Errorf("update EF 8F90 failed: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("update EF 8F90 failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("update EF 8F90 failed: %s", resp.SWString())
 	}
 
 	return nil
 }
 
+// GetAlgorithmType returns the algorithm name, or the hex dump of a body with an unknown layout
 func (d *RuSIMDriver) GetAlgorithmType(reader *card.Reader) (string, error) {
+	sel, err := d.readAlgoSelector(reader)
+	if err != nil {
+		return "", err
+	}
+	if !sel.known() {
+		return sel.String(), nil
+	}
+	return rusimAlgoName(sel.Raw[0]), nil
+}
+
+// AlgorithmParams describes EF 8F90 with the key length, Keccak count and RES length of
+// the longer layouts
+func (d *RuSIMDriver) AlgorithmParams(reader *card.Reader) (string, error) {
+	sel, err := d.readAlgoSelector(reader)
+	if err != nil {
+		return "", err
+	}
+	return sel.String(), nil
+}
+
+// selectAlgoFile selects EF 8F90 in the USIM and returns its size (0 if the response has none)
+func (d *RuSIMDriver) selectAlgoFile(reader *card.Reader) (int, error) {
 	// Select USIM
 	if _, err := sim.SelectUSIMWithAuth(reader); err != nil {
-		return "", err
+		return 0, err
 	}
 
-	// Select EF 8F90
-	resp, err := reader.SelectGSM([]byte{0x8F, 0x90})
+	// Select EF 8F90 (NAA)
+	resp, err := reader.SelectGSM(rusimAlgoFID)
 	if err != nil {
-		return "", fmt.Errorf("select EF 8F90 failed: %w", err)
+		return 0, fmt.Errorf("select EF 8F90 failed: %w", err)
 	}
 	if !resp.IsOK() && !resp.HasMoreData() {
-		return "", fmt.Errorf("select EF 8F90 failed: %s", card.SWToString(resp.SW()))
+		return 0, fmt.Errorf("select EF 8F90 failed: %s", resp.SWString())
 	}
+	return rusimFileSize(resp.Data), nil
+}
 
-	// Read 1 byte
-	resp, err = reader.ReadBinaryGSM(0, 1)
+// readAlgoSelector reads the whole body of EF 8F90, whatever its layout
+func (d *RuSIMDriver) readAlgoSelector(reader *card.Reader) (rusimAlgoSelector, error) {
+	size, err := d.selectAlgoFile(reader)
 	if err != nil {
-		return "", fmt.Errorf("read EF 8F90 failed: %w", err)
+		return rusimAlgoSelector{}, err
 	}
-	if !resp.IsOK() {
-		return "", fmt.Errorf("read EF 8F90 failed: %s", card.SWToString(resp.SW()))
+
+	// Le 00 when the size is unknown: the card answers 6Cxx with the length, SendAPDU asks again
+	if size > 255 {
+		size = 0
 	}
-	if len(resp.Data) < 1 {
-		return "", fmt.Errorf("read EF 8F90 returned empty data")
+	resp, err := reader.ReadBinaryGSM(0, byte(size))
+	if err != nil {
+		return rusimAlgoSelector{}, fmt.Errorf("read EF 8F90 failed: %w", err)
 	}
-
-	return d.algoName(resp.Data[0]), nil
+	if !resp.IsOK() {
+		return rusimAlgoSelector{}, fmt.Errorf("read EF 8F90 failed: %s", resp.SWString())
+	}
+	return decodeRuSIMAlgo(resp.Data), nil
 }
 
 func (d *RuSIMDriver) WriteICCID(reader *card.Reader, iccid string) error {
@@ -138,8 +193,177 @@ func (d *RuSIMDriver) WritePINs(reader *card.Reader, pin1, puk1, pin2, puk2 stri
 	return nil
 }
 
+func (d *RuSIMDriver) ReadOTACounters(reader *card.Reader) ([]sim.OTACounter, error) {
+	// Select USIM
+	if _, err := sim.SelectUSIMWithAuth(reader); err != nil {
+		return nil, err
+	}
+
+	// Select EF 8F92 (OTA counters)
+	resp, err := reader.SelectGSM(rusimOTACounterFID)
+	if err != nil {
+		return nil, fmt.Errorf("select EF 8F92 failed: %w", err)
+	}
+	if !resp.IsOK() && !resp.HasMoreData() {
+		return nil, fmt.Errorf("EF 8F92 not present: %s", resp.SWString())
+	}
+
+	var counters []sim.OTACounter
+	for rec := 1; rec <= rusimOTACounterMaxRecs; rec++ {
+		resp, err = reader.ReadRecordGSM(byte(rec), rusimOTACounterRecordLen)
+		if err != nil {
+			return counters, fmt.Errorf("read EF 8F92 record %d failed: %w", rec, err)
+		}
+		if !resp.IsOK() {
+			// Past the last record
+			break
+		}
+		if c, ok := sim.ParseOTACounterRecord(resp.Data); ok {
+			c.Source = "EF 8F92"
+			counters = append(counters, c)
+		}
+	}
+	return counters, nil
+}
+
 // Internal helpers
-func (d *RuSIMDriver) algoName(b byte) string {
+
+// rusimFileSize returns the EF size of a SELECT response: FCP tag 80/81 on cards answering
+// in UICC format, bytes 3-4 of the GSM response otherwise (0 if unknown)
+func rusimFileSize(resp []byte) int {
+	if len(resp) > 0 && resp[0] == 0x62 {
+		f, _ := card.ParseFCP(resp)
+		return f.Size()
+	}
+	if len(resp) >= 4 {
+		return int(resp[2])<<8 | int(resp[3])
+	}
+	return 0
+}
+
+// rusimAlgoSelector is the body of EF 8F90
+type rusimAlgoSelector struct {
+	Raw    []byte
+	KeyLen int // bytes; 2- and 4-byte layouts
+	Keccak int // TUAK Keccak iterations; 4-byte layout
+	RESLen int // bytes; 4-byte layout
+}
+
+func decodeRuSIMAlgo(raw []byte) rusimAlgoSelector {
+	sel := rusimAlgoSelector{Raw: raw}
+	switch len(raw) {
+	case 4:
+		sel.Keccak = int(raw[2])
+		sel.RESLen = int(raw[3])
+		fallthrough
+	case 2:
+		sel.KeyLen = int(raw[1])
+	}
+	return sel
+}
+
+// known reports whether the body has one of the 1-, 2- or 4-byte layouts
+func (s rusimAlgoSelector) known() bool {
+	n := len(s.Raw)
+	return n == 1 || n == 2 || n == 4
+}
+
+// String returns e.g. "tuak, key 16 bytes, Keccak 2x, RES 8 bytes (4-byte EF 8F90)", or
+// "unknown layout (3 bytes): 3D1001"
+func (s rusimAlgoSelector) String() string {
+	if !s.known() {
+		return fmt.Sprintf("unknown layout (%d bytes): %X", len(s.Raw), s.Raw)
+	}
+	parts := []string{rusimAlgoName(s.Raw[0])}
+	if len(s.Raw) >= 2 {
+		parts = append(parts, fmt.Sprintf("key %d bytes", s.KeyLen))
+	}
+	if len(s.Raw) == 4 {
+		if s.Raw[0] == NAA_TUAK {
+			parts = append(parts, fmt.Sprintf("Keccak %dx", s.Keccak))
+		}
+		parts = append(parts, fmt.Sprintf("RES %d bytes", s.RESLen))
+	}
+	return fmt.Sprintf("%s (%d-byte EF 8F90)", strings.Join(parts, ", "), len(s.Raw))
+}
+
+// rusimAlgoSetting is a --set-algo value; zero fields keep the card value
+type rusimAlgoSetting struct {
+	Algo   byte
+	KeyLen int
+	Keccak int
+	RESLen int
+}
+
+// bodyLen returns the shortest EF 8F90 layout holding the setting
+func (s rusimAlgoSetting) bodyLen() int {
+	switch {
+	case s.Keccak != 0 || s.RESLen != 0:
+		return 4
+	case s.KeyLen != 0:
+		return 2
+	}
+	return 1
+}
+
+// apply returns the body cur updated with the setting
+func (s rusimAlgoSetting) apply(cur rusimAlgoSelector) ([]byte, error) {
+	if need := s.bodyLen(); !cur.known() || len(cur.Raw) < need {
+		return nil, fmt.Errorf("EF 8F90 has %d bytes, the options need the %d-byte layout", len(cur.Raw), need)
+	}
+	body := append([]byte(nil), cur.Raw...)
+	body[0] = s.Algo
+	for i, v := range []int{s.KeyLen, s.Keccak, s.RESLen} {
+		if v != 0 {
+			body[i+1] = byte(v)
+		}
+	}
+	return body, nil
+}
+
+// parseAlgoSetting parses "algorithm[:option=value...]" with the options keylen (16 or
+// 32 bytes), keccak (1-255, TUAK) and reslen (4, 8, 16 or 32 bytes, TUAK)
+func (d *RuSIMDriver) parseAlgoSetting(s string) (rusimAlgoSetting, error) {
+	fields := strings.Split(s, ":")
+	algo, err := d.parseAuthAlgo(fields[0])
+	if err != nil {
+		return rusimAlgoSetting{}, err
+	}
+	setting := rusimAlgoSetting{Algo: algo}
+	for _, opt := range fields[1:] {
+		name, value, ok := strings.Cut(opt, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil {
+			return rusimAlgoSetting{}, fmt.Errorf("invalid algorithm option %q (keylen=N, keccak=N, reslen=N)", opt)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if (name == "keccak" || name == "reslen") && algo != NAA_TUAK {
+			return rusimAlgoSetting{}, fmt.Errorf("%s applies to tuak only", name)
+		}
+		switch name {
+		case "keylen":
+			if n != 16 && n != 32 {
+				return rusimAlgoSetting{}, fmt.Errorf("keylen %d: must be 16 or 32 (bytes)", n)
+			}
+			setting.KeyLen = n
+		case "keccak":
+			if n < 1 || n > 255 {
+				return rusimAlgoSetting{}, fmt.Errorf("keccak %d: must be 1-255", n)
+			}
+			setting.Keccak = n
+		case "reslen":
+			if n != 4 && n != 8 && n != 16 && n != 32 {
+				return rusimAlgoSetting{}, fmt.Errorf("reslen %d: must be 4, 8, 16 or 32 (bytes)", n)
+			}
+			setting.RESLen = n
+		default:
+			return rusimAlgoSetting{}, fmt.Errorf("unknown algorithm option %q (keylen, keccak, reslen)", name)
+		}
+	}
+	return setting, nil
+}
+
+func rusimAlgoName(b byte) string {
 	switch b {
 	case NAA_MILENAGE:
 		return "milenage"
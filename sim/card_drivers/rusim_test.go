@@ -0,0 +1,103 @@
+package card_drivers
+
+import (
+	"bytes"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// ============ RUSIM / OX24 TESTS ============
+
+// rusimAlgoFixtures are EF 8F90 bodies seen on RuSIM / OX24 batches
+var rusimAlgoFixtures = []struct {
+	name     string
+	body     string
+	algo     string
+	describe string
+}{
+	{"1-byte milenage", "1F", "milenage", "milenage (1-byte EF 8F90)"},
+	{"1-byte s3g-256", "4C", "s3g-256", "s3g-256 (1-byte EF 8F90)"},
+	{"2-byte tuak 256-bit key", "3D20", "tuak", "tuak, key 32 bytes (2-byte EF 8F90)"},
+	{"4-byte tuak", "3D100108", "tuak", "tuak, key 16 bytes, Keccak 1x, RES 8 bytes (4-byte EF 8F90)"},
+	{"4-byte milenage", "1F100008", "milenage", "milenage, key 16 bytes, RES 8 bytes (4-byte EF 8F90)"},
+	{"unknown algorithm byte", "5A", "unknown(0x5A)", "unknown(0x5A) (1-byte EF 8F90)"},
+	{"3-byte layout", "3D1001", "unknown layout (3 bytes): 3D1001", "unknown layout (3 bytes): 3D1001"},
+	{"8-byte layout", "1F10000800000000", "unknown layout (8 bytes): 1F10000800000000", "unknown layout (8 bytes): 1F10000800000000"},
+}
+
+// newRuSIMFixture returns a simulated RuSIM whose EF 8F90 holds body. The mock answers
+// class 00 only, the GSM class commands of the driver are passed on as class 00.
+func newRuSIMFixture(t *testing.T, body []byte) (*card.Reader, *card.MockFile) {
+	t.Helper()
+	m := card.NewMockCard(fromHex(t, "3B959640F00F050A0F0A"))
+	ef := m.AddADF(sim.AID_USIM).AddEF(0x8F90, body)
+	m.Override = func(apdu []byte) []byte {
+		if apdu[0] == 0xA0 {
+			apdu[0] = 0x00
+		}
+		return nil
+	}
+	return card.NewReaderWithTransport("Mock", m.ATR, m), ef
+}
+
+func TestRuSIM_AlgorithmLayouts(t *testing.T) {
+	d := &RuSIMDriver{}
+	for _, tt := range rusimAlgoFixtures {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, _ := newRuSIMFixture(t, fromHex(t, tt.body))
+			algo, err := d.GetAlgorithmType(reader)
+			if err != nil || algo != tt.algo {
+				t.Errorf("GetAlgorithmType() = %q, %v; want %q", algo, err, tt.algo)
+			}
+			describe, err := d.AlgorithmParams(reader)
+			if err != nil || describe != tt.describe {
+				t.Errorf("AlgorithmParams() = %q, %v; want %q", describe, err, tt.describe)
+			}
+		})
+	}
+}
+
+func TestRuSIM_SetAlgorithm(t *testing.T) {
+	d := &RuSIMDriver{}
+	tests := []struct {
+		name    string
+		body    string
+		setting string
+		want    string // body after the write, "" = rejected
+	}{
+		{"algorithm only, 1 byte", "1F", "tuak", "3D"},
+		{"algorithm only keeps the parameters", "3D100208", "milenage", "1F100208"},
+		{"algorithm only on an unknown layout", "3D1001", "s3g-128", "2E1001"},
+		{"keccak and reslen", "1F100108", "tuak:keccak=2:reslen=16", "3D100210"},
+		{"keylen on 2 bytes", "1F10", "tuak:keylen=32", "3D20"},
+		{"keccak on 2 bytes", "1F10", "tuak:keccak=2", ""},
+		{"keylen on 1 byte", "1F", "milenage:keylen=16", ""},
+		{"keccak with milenage", "1F100108", "milenage:keccak=2", ""},
+		{"bad reslen", "3D100108", "tuak:reslen=5", ""},
+		{"unknown option", "3D100108", "tuak:rounds=2", ""},
+		{"option without value", "3D100108", "tuak:keccak", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, ef := newRuSIMFixture(t, fromHex(t, tt.body))
+			err := d.SetAlgorithmType(reader, tt.setting)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("SetAlgorithmType(%q) succeeded, body %X", tt.setting, ef.Data)
+				}
+				if !bytes.Equal(ef.Data, fromHex(t, tt.body)) {
+					t.Errorf("rejected setting changed EF 8F90 to %X", ef.Data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetAlgorithmType(%q) error = %v", tt.setting, err)
+			}
+			if !bytes.Equal(ef.Data, fromHex(t, tt.want)) {
+				t.Errorf("EF 8F90 = %X, want %s", ef.Data, tt.want)
+			}
+		})
+	}
+}
@@ -52,6 +52,11 @@ func (d *SysmocomDriver) BaseCLA() byte {
 	}
 }
 
+// ADMProfiles returns the ADM VERIFY parameters: FF-padded 8-byte keys in the card class
+func (d *SysmocomDriver) ADMProfiles(level int) []card.ADMVerifyProfile {
+	return []card.ADMVerifyProfile{sim.StandardADMProfile(d.BaseCLA(), level)}
+}
+
 func (d *SysmocomDriver) PrepareWrite(reader *card.Reader) error {
 	switch d.model {
 	case SysmoUSIM_GR1:
@@ -61,7 +66,7 @@ func (d *SysmocomDriver) PrepareWrite(reader *card.Reader) error {
 			return err
 		}
 		if !resp.IsOK() {
-			return fmt.Errorf("GR1 unlock failed: %s", card.SWToString(resp.SW()))
+			return fmt.Errorf("GR1 unlock failed: %s", resp.SWString())
 		}
 		return nil
 	case SysmoSIM_GR2:
@@ -71,7 +76,7 @@ func (d *SysmocomDriver) PrepareWrite(reader *card.Reader) error {
 			return err
 		}
 		if !resp.IsOK() {
-			return fmt.Errorf("GR2 super-unlock failed: %s", card.SWToString(resp.SW()))
+			return fmt.Errorf("GR2 super-unlock failed: %s", resp.SWString())
 		}
 		return nil
 	case SysmoUSIM_SJS1, SysmoISIM_SJA2, SysmoISIM_SJA5:
@@ -152,13 +157,8 @@ func (d *SysmocomDriver) WriteKi(reader *card.Reader, ki []byte) error {
 		_, err := reader.UpdateBinary(0, ki)
 		return err
 	case SysmoISIM_SJA2, SysmoISIM_SJA5:
-		// EF.6F20 in DF.A515
-		if _, err := reader.SelectByPath([]byte{0x3F, 0x00, 0xA5, 0x15, 0x6F, 0x20}); err != nil {
-			return err
-		}
-		// Ki at offset 1
-		_, err := reader.UpdateBinary(1, ki)
-		return err
+		// Auth key files in DF.SYSTEM and the ADFs (see sysmocom_sja.go)
+		return d.updateAuthKeyFile(reader, func(f *sim.AuthKeyFile) { f.Ki = ki })
 	}
 	return nil
 }
@@ -174,26 +174,41 @@ func (d *SysmocomDriver) WriteOPc(reader *card.Reader, opc []byte) error {
 		_, err := reader.UpdateBinary(0, data)
 		return err
 	case SysmoISIM_SJA2, SysmoISIM_SJA5:
-		// EF.6F20 in DF.A515, offset 17
-		if _, err := reader.SelectByPath([]byte{0xA5, 0x15, 0x6F, 0x20}); err != nil {
-			return err
-		}
-		_, err := reader.UpdateBinary(17, opc)
-		return err
+		// OPc and the use_opc flag of the cfg byte must change together
+		return d.updateAuthKeyFile(reader, func(f *sim.AuthKeyFile) { f.OPOPc, f.UseOPc = opc, true })
 	}
 	return nil
 }
 
 func (d *SysmocomDriver) WriteMilenageRAndC(reader *card.Reader) error {
+	if !d.isSJA() {
+		return nil
+	}
+	if err := selectSJASystemEF(reader, sjaMilenageCfgEF); err != nil {
+		return err
+	}
+	if err := updateSJABinary(reader, sjaMilenageDefaults); err != nil {
+		return fmt.Errorf("EF.MILENAGE_CFG: %w", err)
+	}
 	return nil
 }
 
 func (d *SysmocomDriver) SetAlgorithmType(reader *card.Reader, algo string) error {
-	return nil
+	if !d.isSJA() {
+		return nil
+	}
+	return d.updateAuthKeyFile(reader, func(f *sim.AuthKeyFile) { f.Algorithm = strings.ToLower(algo) })
 }
 
 func (d *SysmocomDriver) GetAlgorithmType(reader *card.Reader) (string, error) {
-	return "milenage", nil
+	if !d.isSJA() {
+		return "milenage", nil
+	}
+	f, err := d.ReadAuthKeyFile(reader)
+	if err != nil {
+		return "", err
+	}
+	return f.Algorithm, nil
 }
 
 func (d *SysmocomDriver) WriteICCID(reader *card.Reader, iccid string) error {
@@ -0,0 +1,509 @@
+package card_drivers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sim_reader/card"
+	"sim_reader/sim"
+	"strings"
+)
+
+// sysmoISIM-SJA2/SJA5 proprietary files (layout from pySim sysmocom_sja2)
+var (
+	sjaSystemDF      = []byte{0xA5, 0x15}             // DF.SYSTEM under MF
+	sjaSIMAuthKeyEF  = []byte{0xA5, 0x15, 0x6F, 0x20} // EF.SIM_AUTH_KEY (2G view of the keys)
+	sjaMilenageCfgEF = []byte{0xA5, 0x15, 0x6F, 0x21} // EF.MILENAGE_CFG: R1..R5, C1..C5
+	sjaOTAKeyEF      = []byte{0xA5, 0x15, 0x6F, 0x22} // EF.0348_KEY: one OTA key per record
+	sjaAuthKeyFID    = []byte{0xAF, 0x20}             // EF.USIM_AUTH_KEY / EF.ISIM_AUTH_KEY in the ADF
+	sjaSQNFID        = []byte{0xAF, 0x30}             // EF.USIM_SQN / EF.ISIM_SQN in the ADF
+)
+
+const (
+	sjaAuthKeyLen    = 33 // cfg(1) | Ki(16) | OP/OPc(16)
+	sjaSQNHdrLen     = 14 // flag1(1) | flag2(1) | delta_max(6) | age_limit(6), freshness entries follow
+	sjaSQNMaxEntries = 32 // freshness entries (6 bytes each) read at most
+
+	// Auth key cfg byte
+	sjaCfgOnly4ByteRES = 0x40
+	sjaCfgSRESDeriv    = 0x20
+	sjaCfgUseOPc       = 0x10
+	sjaCfgAlgoMask     = 0x0F
+
+	// SQN flag1 byte
+	sjaSQNDeltaMaxCheck = 0x40
+	sjaSQNAgeLimitCheck = 0x20
+	sjaSQNCheck         = 0x10
+	sjaSQNINDMask       = 0x0F
+)
+
+var sjaAlgorithms = map[byte]string{0x04: "milenage", 0x05: "sha1-aka", 0x06: "tuak", 0x0F: "xor"}
+
+// Default Milenage R1..R5 and C1..C5 (TS 35.206)
+var sjaMilenageDefaults = func() []byte {
+	cfg := []byte{0x40, 0x00, 0x20, 0x40, 0x60}
+	for _, c := range []byte{0x00, 0x01, 0x02, 0x04, 0x08} {
+		cfg = append(cfg, make([]byte, 15)...)
+		cfg = append(cfg, c)
+	}
+	return cfg
+}()
+
+func (d *SysmocomDriver) isSJA() bool {
+	return d.model == SysmoISIM_SJA2 || d.model == SysmoISIM_SJA5
+}
+
+// Capabilities advertises the proprietary file support of the SJA2/SJA5 models
+func (d *SysmocomDriver) Capabilities() []sim.DriverCapability {
+	if !d.isSJA() {
+		return nil
+	}
+	return []sim.DriverCapability{sim.CapAuthKeyFile, sim.CapSQNConfig, sim.CapOTAKeys, sim.CapReadSQN, sim.CapReadKi}
+}
+
+// CardType returns the card_type of the identified model ("" for models without one)
+func (d *SysmocomDriver) CardType() string {
+	switch d.model {
+	case SysmoISIM_SJA2:
+		return "sysmo-sja2"
+	case SysmoISIM_SJA5:
+		return "sysmo-sja5"
+	}
+	return ""
+}
+
+// SelectCardType sets the model for a card_type given in the config
+func (d *SysmocomDriver) SelectCardType(name string) bool {
+	switch strings.ToLower(name) {
+	case "sysmo-sja2":
+		d.model = SysmoISIM_SJA2
+	case "sysmo-sja5":
+		d.model = SysmoISIM_SJA5
+	default:
+		return false
+	}
+	return true
+}
+
+// selectSJAEF selects fid in the USIM (isim=false) or ISIM application
+func selectSJAEF(reader *card.Reader, isim bool, fid []byte) error {
+	selectADF := sim.SelectUSIMWithAuth
+	if isim {
+		selectADF = sim.SelectISIMWithAuth
+	}
+	if _, err := selectADF(reader); err != nil {
+		return err
+	}
+	resp, err := reader.Select(fid)
+	if err != nil {
+		return fmt.Errorf("select EF %X failed: %w", fid, err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("select EF %X failed: %s", fid, resp.SWString())
+	}
+	return nil
+}
+
+// selectSJASystemEF selects an EF of DF.SYSTEM
+func selectSJASystemEF(reader *card.Reader, path []byte) error {
+	resp, err := reader.SelectByPath(path)
+	if err != nil {
+		return fmt.Errorf("select %X failed: %w", path, err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("select %X failed: %s", path, resp.SWString())
+	}
+	return nil
+}
+
+func readSJABinary(reader *card.Reader, length byte) ([]byte, error) {
+	resp, err := reader.ReadBinary(0, length)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.IsOK() || len(resp.Data) < int(length) {
+		return nil, fmt.Errorf("read failed: %s", resp.SWString())
+	}
+	return resp.Data, nil
+}
+
+func updateSJABinary(reader *card.Reader, data []byte) error {
+	resp, err := reader.UpdateBinary(0, data)
+	if err != nil {
+		return err
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("update failed: %s", resp.SWString())
+	}
+	return nil
+}
+
+// decodeSJAAuthKey decodes EF.USIM_AUTH_KEY
+func decodeSJAAuthKey(data []byte) (*sim.AuthKeyFile, error) {
+	if len(data) < sjaAuthKeyLen {
+		return nil, fmt.Errorf("auth key file too short: %d bytes", len(data))
+	}
+	cfg := data[0]
+	algo, ok := sjaAlgorithms[cfg&sjaCfgAlgoMask]
+	if !ok {
+		algo = fmt.Sprintf("unknown(%X)", cfg&sjaCfgAlgoMask)
+	}
+	return &sim.AuthKeyFile{
+		Algorithm: algo,
+		Ki:        append([]byte(nil), data[1:17]...),
+		OPOPc:     append([]byte(nil), data[17:33]...),
+		UseOPc:    cfg&sjaCfgUseOPc != 0,
+		Options:   cfg & (sjaCfgOnly4ByteRES | sjaCfgSRESDeriv),
+	}, nil
+}
+
+// encodeSJAAuthKey encodes EF.USIM_AUTH_KEY (Milenage/XOR/SHA1-AKA layout only)
+func encodeSJAAuthKey(f *sim.AuthKeyFile) ([]byte, error) {
+	var algo byte
+	for v, name := range sjaAlgorithms {
+		if name == f.Algorithm {
+			algo = v
+		}
+	}
+	switch {
+	case algo == 0:
+		return nil, fmt.Errorf("unsupported algorithm %q (use milenage, xor or sha1-aka)", f.Algorithm)
+	case f.Algorithm == "tuak":
+		return nil, fmt.Errorf("TUAK uses a different key file layout, not supported")
+	case len(f.Ki) != 16 || len(f.OPOPc) != 16:
+		return nil, fmt.Errorf("Ki and OP/OPc must be 16 bytes")
+	}
+	cfg := f.Options&(sjaCfgOnly4ByteRES|sjaCfgSRESDeriv) | algo
+	if f.UseOPc {
+		cfg |= sjaCfgUseOPc
+	}
+	data := append([]byte{cfg}, f.Ki...)
+	return append(data, f.OPOPc...), nil
+}
+
+// ReadAuthKeyFile reads algorithm, Ki and OP/OPc from EF.USIM_AUTH_KEY
+func (d *SysmocomDriver) ReadAuthKeyFile(reader *card.Reader) (*sim.AuthKeyFile, error) {
+	if !d.isSJA() {
+		return nil, fmt.Errorf("%s has no auth key file", d.Name())
+	}
+	if err := selectSJAEF(reader, false, sjaAuthKeyFID); err != nil {
+		return nil, err
+	}
+	data, err := readSJABinary(reader, sjaAuthKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("EF.USIM_AUTH_KEY: %w", err)
+	}
+	return decodeSJAAuthKey(data)
+}
+
+// ReadKi returns Ki from EF.USIM_AUTH_KEY
+func (d *SysmocomDriver) ReadKi(reader *card.Reader) ([]byte, error) {
+	f, err := d.ReadAuthKeyFile(reader)
+	if err != nil {
+		return nil, err
+	}
+	return f.Ki, nil
+}
+
+// WriteAuthKeyFile writes the keys to EF.SIM_AUTH_KEY (2G), EF.USIM_AUTH_KEY and,
+// if the card has an ISIM, EF.ISIM_AUTH_KEY, so all applications authenticate alike
+func (d *SysmocomDriver) WriteAuthKeyFile(reader *card.Reader, f *sim.AuthKeyFile) error {
+	if !d.isSJA() {
+		return fmt.Errorf("%s has no auth key file", d.Name())
+	}
+	data, err := encodeSJAAuthKey(f)
+	if err != nil {
+		return err
+	}
+
+	if err := selectSJASystemEF(reader, sjaSIMAuthKeyEF); err != nil {
+		return err
+	}
+	if err := updateSJABinary(reader, data); err != nil {
+		return fmt.Errorf("EF.SIM_AUTH_KEY: %w", err)
+	}
+
+	if err := selectSJAEF(reader, false, sjaAuthKeyFID); err != nil {
+		return err
+	}
+	if err := updateSJABinary(reader, data); err != nil {
+		return fmt.Errorf("EF.USIM_AUTH_KEY: %w", err)
+	}
+
+	if selectSJAEF(reader, true, sjaAuthKeyFID) != nil {
+		return nil // No ISIM
+	}
+	if err := updateSJABinary(reader, data); err != nil {
+		return fmt.Errorf("EF.ISIM_AUTH_KEY: %w", err)
+	}
+	return nil
+}
+
+// updateAuthKeyFile changes the auth key file with read-modify-write
+func (d *SysmocomDriver) updateAuthKeyFile(reader *card.Reader, change func(f *sim.AuthKeyFile)) error {
+	f, err := d.ReadAuthKeyFile(reader)
+	if err != nil {
+		return err
+	}
+	change(f)
+	return d.WriteAuthKeyFile(reader, f)
+}
+
+// decodeSJASQN decodes the header of EF.USIM_SQN
+func decodeSJASQN(data []byte) (*sim.SQNConfig, error) {
+	if len(data) < sjaSQNHdrLen {
+		return nil, fmt.Errorf("SQN file too short: %d bytes", len(data))
+	}
+	flag := func(mask byte) *bool {
+		v := data[0]&mask != 0
+		return &v
+	}
+	ind := int(data[0] & sjaSQNINDMask)
+	deltaMax := binary.BigEndian.Uint64(append([]byte{0, 0}, data[2:8]...))
+	ageLimit := binary.BigEndian.Uint64(append([]byte{0, 0}, data[8:14]...))
+	return &sim.SQNConfig{
+		SQNCheck:      flag(sjaSQNCheck),
+		DeltaMaxCheck: flag(sjaSQNDeltaMaxCheck),
+		AgeLimitCheck: flag(sjaSQNAgeLimitCheck),
+		INDBits:       &ind,
+		DeltaMax:      &deltaMax,
+		AgeLimit:      &ageLimit,
+	}, nil
+}
+
+// encodeSJASQN applies c to the header cur of EF.USIM_SQN (bits not covered by c are kept)
+func encodeSJASQN(cur []byte, c *sim.SQNConfig) []byte {
+	data := append([]byte(nil), cur[:sjaSQNHdrLen]...)
+	set := func(mask byte, v *bool) {
+		if v == nil {
+			return
+		}
+		data[0] &^= mask
+		if *v {
+			data[0] |= mask
+		}
+	}
+	set(sjaSQNCheck, c.SQNCheck)
+	set(sjaSQNDeltaMaxCheck, c.DeltaMaxCheck)
+	set(sjaSQNAgeLimitCheck, c.AgeLimitCheck)
+	if c.INDBits != nil {
+		data[0] = data[0]&^sjaSQNINDMask | byte(*c.INDBits)&sjaSQNINDMask
+	}
+	put48 := func(off int, v *uint64) {
+		if v != nil {
+			var b [8]byte
+			binary.BigEndian.PutUint64(b[:], *v)
+			copy(data[off:off+6], b[2:])
+		}
+	}
+	put48(2, c.DeltaMax)
+	put48(8, c.AgeLimit)
+	return data
+}
+
+// ReadSQNConfig reads the SQN check parameters from EF.USIM_SQN
+func (d *SysmocomDriver) ReadSQNConfig(reader *card.Reader) (*sim.SQNConfig, error) {
+	if !d.isSJA() {
+		return nil, fmt.Errorf("%s has no SQN configuration file", d.Name())
+	}
+	if err := selectSJAEF(reader, false, sjaSQNFID); err != nil {
+		return nil, err
+	}
+	data, err := readSJABinary(reader, sjaSQNHdrLen)
+	if err != nil {
+		return nil, fmt.Errorf("EF.USIM_SQN: %w", err)
+	}
+	return decodeSJASQN(data)
+}
+
+// ReadSQNInfo reads the SQN scheme and the freshness array (one 48-bit SQN per IND) from EF.USIM_SQN
+func (d *SysmocomDriver) ReadSQNInfo(reader *card.Reader) (*sim.SQNInfo, error) {
+	if !d.isSJA() {
+		return nil, fmt.Errorf("%s has no SQN file", d.Name())
+	}
+	if err := selectSJAEF(reader, false, sjaSQNFID); err != nil {
+		return nil, err
+	}
+	hdr, err := readSJABinary(reader, sjaSQNHdrLen)
+	if err != nil {
+		return nil, fmt.Errorf("EF.USIM_SQN: %w", err)
+	}
+	scheme, err := decodeSJASQN(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := 1 << uint(*scheme.INDBits)
+	if entries > sjaSQNMaxEntries {
+		entries = sjaSQNMaxEntries
+	}
+	resp, err := reader.ReadBinary(sjaSQNHdrLen, byte(entries*6))
+	if err != nil {
+		return nil, fmt.Errorf("EF.USIM_SQN: %w", err)
+	}
+	if !resp.IsOK() {
+		return nil, fmt.Errorf("EF.USIM_SQN: freshness array read failed: %s", resp.SWString())
+	}
+	var values []uint64
+	for off := 0; off+6 <= len(resp.Data); off += 6 {
+		values = append(values, binary.BigEndian.Uint64(append([]byte{0, 0}, resp.Data[off:off+6]...)))
+	}
+	return sim.NewSQNArrayInfo("EF.USIM_SQN", scheme, values), nil
+}
+
+// WriteSQNConfig writes the SQN check parameters to EF.USIM_SQN and, if present, EF.ISIM_SQN
+func (d *SysmocomDriver) WriteSQNConfig(reader *card.Reader, c *sim.SQNConfig) error {
+	if !d.isSJA() {
+		return fmt.Errorf("%s has no SQN configuration file", d.Name())
+	}
+	for _, isim := range []bool{false, true} {
+		name := "EF.USIM_SQN"
+		if isim {
+			name = "EF.ISIM_SQN"
+		}
+		if err := selectSJAEF(reader, isim, sjaSQNFID); err != nil {
+			if isim {
+				return nil // No ISIM
+			}
+			return err
+		}
+		cur, err := readSJABinary(reader, sjaSQNHdrLen)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := updateSJABinary(reader, encodeSJASQN(cur, c)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// EF.0348_KEY record: security domain(1) | KVN(1) | key length/type(1) | key (FF padded).
+// Key length/type: b8 MAC length (0 = 8 bytes), b7 algorithm (0 = DES, 1 = AES),
+// b6-b4 key length / 8, b2-b1 key type (0 = KIc, 1 = KID, 2 = KIK)
+var sjaOTAKeyTypes = []string{"kic", "kid", "kik"}
+
+// decodeSJAOTAKey decodes one EF.0348_KEY record (ok=false for a free record)
+func decodeSJAOTAKey(rec []byte) (sim.OTAKeyConfig, bool) {
+	if len(rec) < 3 || rec[1] == 0x00 || rec[1] == 0xFF {
+		return sim.OTAKeyConfig{}, false
+	}
+	lt := rec[2]
+	keyLen := int(lt>>3&0x07) * 8
+	if int(lt&0x03) >= len(sjaOTAKeyTypes) || keyLen == 0 || 3+keyLen > len(rec) {
+		return sim.OTAKeyConfig{}, false
+	}
+	algo := "des"
+	if lt&0x40 != 0 {
+		algo = "aes"
+	}
+	return sim.OTAKeyConfig{
+		KVN:       int(rec[1]),
+		Type:      sjaOTAKeyTypes[lt&0x03],
+		Algorithm: algo,
+		Key:       strings.ToUpper(hex.EncodeToString(rec[3 : 3+keyLen])),
+	}, true
+}
+
+// encodeSJAOTAKey encodes k as an EF.0348_KEY record of recLen bytes
+func encodeSJAOTAKey(k sim.OTAKeyConfig, domain byte, recLen int) ([]byte, error) {
+	key, err := hex.DecodeString(k.Key)
+	if err != nil {
+		return nil, err
+	}
+	if 3+len(key) > recLen {
+		return nil, fmt.Errorf("%d-byte key does not fit the %d-byte records of EF.0348_KEY", len(key), recLen)
+	}
+	lt := byte(len(key)/8) << 3
+	for i, t := range sjaOTAKeyTypes {
+		if t == strings.ToLower(k.Type) {
+			lt |= byte(i)
+		}
+	}
+	if !strings.EqualFold(k.Algorithm, "des") {
+		lt |= 0x40
+	}
+	rec := bytes.Repeat([]byte{0xFF}, recLen)
+	rec[0], rec[1], rec[2] = domain, byte(k.KVN), lt
+	copy(rec[3:], key)
+	return rec, nil
+}
+
+// readSJAOTARecords reads all records of EF.0348_KEY (selected by the caller)
+func readSJAOTARecords(reader *card.Reader) [][]byte {
+	var recs [][]byte
+	for n := 1; n <= 254; n++ {
+		resp, err := reader.ReadRecord(byte(n), 0x00)
+		if err != nil || !resp.IsOK() {
+			break
+		}
+		recs = append(recs, resp.Data)
+	}
+	return recs
+}
+
+// ReadOTAKeys reads the OTA keys from EF.0348_KEY
+func (d *SysmocomDriver) ReadOTAKeys(reader *card.Reader) ([]sim.OTAKeyConfig, error) {
+	if !d.isSJA() {
+		return nil, fmt.Errorf("%s has no OTA key file", d.Name())
+	}
+	if err := selectSJASystemEF(reader, sjaOTAKeyEF); err != nil {
+		return nil, err
+	}
+	var keys []sim.OTAKeyConfig
+	for _, rec := range readSJAOTARecords(reader) {
+		if k, ok := decodeSJAOTAKey(rec); ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+// WriteOTAKey replaces the key with the same KVN and type in EF.0348_KEY, or fills the first free record
+func (d *SysmocomDriver) WriteOTAKey(reader *card.Reader, k sim.OTAKeyConfig) error {
+	if !d.isSJA() {
+		return fmt.Errorf("%s has no OTA key file", d.Name())
+	}
+	if err := selectSJASystemEF(reader, sjaOTAKeyEF); err != nil {
+		return err
+	}
+	recs := readSJAOTARecords(reader)
+	target, free := -1, -1
+	for i, rec := range recs {
+		cur, ok := decodeSJAOTAKey(rec)
+		if !ok {
+			if free < 0 {
+				free = i
+			}
+			continue
+		}
+		if cur.KVN == k.KVN && cur.Type == strings.ToLower(k.Type) {
+			target = i
+			break
+		}
+	}
+	if target < 0 {
+		target = free
+	}
+	if target < 0 {
+		return fmt.Errorf("EF.0348_KEY has no record for KVN %d %s and no free record", k.KVN, k.Type)
+	}
+
+	domain := byte(0x00)
+	if recs[target][0] != 0xFF {
+		domain = recs[target][0]
+	}
+	rec, err := encodeSJAOTAKey(k, domain, len(recs[target]))
+	if err != nil {
+		return err
+	}
+	resp, err := reader.UpdateRecord(byte(target+1), rec)
+	if err != nil {
+		return err
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("update EF.0348_KEY record %d failed: %s", target+1, resp.SWString())
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package card_drivers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// ============ SYSMOISIM-SJA2/SJA5 TESTS ============
+
+const sjaTestKi = "000102030405060708090A0B0C0D0E0F"
+
+// sjaFixture is a simulated sysmoISIM-SJA2 with DF.SYSTEM and the USIM proprietary files
+type sjaFixture struct {
+	reader  *card.Reader
+	sysKey  *card.MockFile // EF.SIM_AUTH_KEY
+	usimKey *card.MockFile // EF.USIM_AUTH_KEY
+	usimSQN *card.MockFile // EF.USIM_SQN
+	otaKeys *card.MockFile // EF.0348_KEY
+	mock    *card.MockCard
+}
+
+func fromHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+func newSJAFixture(t *testing.T) *sjaFixture {
+	t.Helper()
+	m := card.NewMockCard(fromHex(t, "3B9F96801F878031E073FE211B674A4C753034054BA9"))
+	authKey := fromHex(t, "14"+"FFEEDDCCBBAA99887766554433221100"+"00000000000000000000000000000000")
+	sys := m.MF().AddDF(0xA515)
+	f := &sjaFixture{mock: m}
+	f.sysKey = sys.AddEF(0x6F20, append([]byte(nil), authKey...))
+	sys.AddEF(0x6F21, make([]byte, 85))
+	f.otaKeys = sys.AddRecordEF(0x6F22,
+		fromHex(t, "0001510102030405060708090A0B0C0D0E0F10FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"[:70]),
+		bytes.Repeat([]byte{0xFF}, 35),
+	)
+	usim := m.AddADF(sim.AID_USIM)
+	f.usimKey = usim.AddEF(0xAF20, append([]byte(nil), authKey...))
+	f.usimSQN = usim.AddEF(0xAF30, fromHex(t, "D5000000000010000000000010000000000000000000"))
+	f.reader = card.NewReaderWithTransport("Mock", m.ATR, m)
+	return f
+}
+
+func TestSJA_Identify(t *testing.T) {
+	f := newSJAFixture(t)
+	drv := sim.FindDriver(f.reader)
+	s, ok := drv.(sim.CardTypeSelector)
+	if !ok || s.CardType() != "sysmo-sja2" {
+		t.Fatalf("FindDriver() = %v, want sysmo-sja2", drv)
+	}
+	for _, c := range []sim.DriverCapability{sim.CapAuthKeyFile, sim.CapSQNConfig, sim.CapOTAKeys} {
+		if !sim.HasCapability(drv, c) {
+			t.Errorf("missing capability %s", c)
+		}
+	}
+}
+
+func TestSJA_AuthKeyFile(t *testing.T) {
+	f := newSJAFixture(t)
+	d := &SysmocomDriver{model: SysmoISIM_SJA2}
+
+	kf, err := d.ReadAuthKeyFile(f.reader)
+	if err != nil {
+		t.Fatalf("ReadAuthKeyFile() error = %v", err)
+	}
+	if kf.Algorithm != "milenage" || !kf.UseOPc || kf.Ki[0] != 0xFF {
+		t.Errorf("ReadAuthKeyFile() = %+v", kf)
+	}
+
+	// OP instead of OPc clears the use_opc flag in every copy of the key file
+	kf.Ki = fromHex(t, sjaTestKi)
+	kf.OPOPc, kf.UseOPc = bytes.Repeat([]byte{0xAA}, 16), false
+	if err := d.WriteAuthKeyFile(f.reader, kf); err != nil {
+		t.Fatalf("WriteAuthKeyFile() error = %v", err)
+	}
+	want := fromHex(t, "04"+sjaTestKi+"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")
+	for name, ef := range map[string]*card.MockFile{"EF.SIM_AUTH_KEY": f.sysKey, "EF.USIM_AUTH_KEY": f.usimKey} {
+		if !bytes.Equal(ef.Data, want) {
+			t.Errorf("%s = %X, want %X", name, ef.Data, want)
+		}
+	}
+
+	kf.Algorithm = "tuak"
+	if err := d.WriteAuthKeyFile(f.reader, kf); err == nil {
+		t.Error("WriteAuthKeyFile() accepted TUAK")
+	}
+}
+
+func TestSJA_WriteOPcSetsFlag(t *testing.T) {
+	f := newSJAFixture(t)
+	f.usimKey.Data[0] = 0x04 // OP stored
+	d := &SysmocomDriver{model: SysmoISIM_SJA2}
+
+	if err := d.WriteOPc(f.reader, bytes.Repeat([]byte{0x55}, 16)); err != nil {
+		t.Fatalf("WriteOPc() error = %v", err)
+	}
+	if f.usimKey.Data[0] != 0x14 || f.usimKey.Data[17] != 0x55 || f.usimKey.Data[1] != 0xFF {
+		t.Errorf("EF.USIM_AUTH_KEY = %X, want cfg 14, Ki kept, new OPc", f.usimKey.Data)
+	}
+}
+
+func TestSJA_SQNConfig(t *testing.T) {
+	f := newSJAFixture(t)
+	d := &SysmocomDriver{model: SysmoISIM_SJA2}
+
+	cfg, err := d.ReadSQNConfig(f.reader)
+	if err != nil {
+		t.Fatalf("ReadSQNConfig() error = %v", err)
+	}
+	if !*cfg.SQNCheck || !*cfg.DeltaMaxCheck || *cfg.AgeLimitCheck || *cfg.INDBits != 5 || *cfg.DeltaMax != 4096 {
+		t.Errorf("ReadSQNConfig() = %s", cfg.String())
+	}
+
+	off, ind := false, 4
+	if err := d.WriteSQNConfig(f.reader, &sim.SQNConfig{SQNCheck: &off, INDBits: &ind}); err != nil {
+		t.Fatalf("WriteSQNConfig() error = %v", err)
+	}
+	want := fromHex(t, "C4000000000010000000000010000000000000000000")
+	if !bytes.Equal(f.usimSQN.Data, want) {
+		t.Errorf("EF.USIM_SQN = %X, want %X", f.usimSQN.Data, want)
+	}
+}
+
+func TestSJA_ReadSQNInfo(t *testing.T) {
+	f := newSJAFixture(t)
+	d := &SysmocomDriver{model: SysmoISIM_SJA2}
+	// IND length 2 (4 slots), only 3 freshness entries in the file
+	f.usimSQN.Data = fromHex(t, "52"+"00"+"000000001000"+"000000001000"+"000000000020"+"000000000045"+"00000000000A")
+
+	info, err := d.ReadSQNInfo(f.reader)
+	if err != nil {
+		t.Fatalf("ReadSQNInfo() error = %v", err)
+	}
+	if info.Method != sim.SQNMethodCardFile || *info.Scheme.INDBits != 2 || !*info.Scheme.DeltaMaxCheck {
+		t.Errorf("ReadSQNInfo() method/scheme = %s / %s", info.Method, info.Scheme.String())
+	}
+	if len(info.Entries) != 3 || info.HighestSQN != "000000000045" {
+		t.Fatalf("ReadSQNInfo() entries = %+v, highest %s", info.Entries, info.HighestSQN)
+	}
+	if e := info.Entries[1]; !e.Max || e.SEQ != 0x11 || e.IND != 1 {
+		t.Errorf("entry 1 = %+v, want highest with SEQ 17", e)
+	}
+	if !sim.HasCapability(d, sim.CapReadSQN) {
+		t.Error("missing capability read-sqn")
+	}
+}
+
+func TestSJA_OTAKeys(t *testing.T) {
+	f := newSJAFixture(t)
+	d := &SysmocomDriver{model: SysmoISIM_SJA2}
+
+	keys, err := d.ReadOTAKeys(f.reader)
+	if err != nil {
+		t.Fatalf("ReadOTAKeys() error = %v", err)
+	}
+	if len(keys) != 1 || keys[0].KVN != 1 || keys[0].Type != "kid" || keys[0].Algorithm != "aes" {
+		t.Fatalf("ReadOTAKeys() = %+v", keys)
+	}
+
+	tests := []struct {
+		name   string
+		key    sim.OTAKeyConfig
+		record int
+		want   string
+	}{
+		{"Replace KID 1", sim.OTAKeyConfig{KVN: 1, Type: "kid", Key: "11111111111111111111111111111111"}, 0, "00015111111111111111111111111111111111"},
+		{"Free record", sim.OTAKeyConfig{KVN: 2, Type: "KIC", Algorithm: "des", Key: "22222222222222222222222222222222"}, 1, "00021022222222222222222222222222222222"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := d.WriteOTAKey(f.reader, tc.key); err != nil {
+				t.Fatalf("WriteOTAKey() error = %v", err)
+			}
+			rec := f.otaKeys.Records[tc.record]
+			if got := hex.EncodeToString(rec[:19]); got != hex.EncodeToString(fromHex(t, tc.want)) || rec[34] != 0xFF {
+				t.Errorf("record %d = %X, want %s + FF padding", tc.record+1, rec, tc.want)
+			}
+		})
+	}
+
+	if err := d.WriteOTAKey(f.reader, sim.OTAKeyConfig{KVN: 3, Type: "kik", Key: "33333333333333333333333333333333"}); err == nil {
+		t.Error("WriteOTAKey() succeeded without a free record")
+	}
+}
+
+func TestSJA_ApplyConfigCardType(t *testing.T) {
+	off := false
+	tests := []struct {
+		name    string
+		atr     string
+		force   bool
+		wantErr bool
+	}{
+		{"SJA2 card", "3B9F96801F878031E073FE211B674A4C753034054BA9", false, false},
+		{"Unidentified card", "3B00", false, false},
+		{"Other programmable card", "3B959640F00F050A0F0A", false, true},
+		{"Other card with force", "3B959640F00F050A0F0A", true, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newSJAFixture(t)
+			reader := card.NewReaderWithTransport("Mock", fromHex(t, tc.atr), f.mock)
+			config := &sim.SIMConfig{Programmable: &sim.ProgrammableConfig{
+				CardType: "sysmo-sja2",
+				SQN:      &sim.SQNConfig{SQNCheck: &off},
+			}}
+			report, err := sim.ApplyConfig(reader, config, false, tc.force)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ApplyConfig() error = %v, wantErr %v (%+v)", err, tc.wantErr, report.Items)
+			}
+			if !tc.wantErr && f.usimSQN.Data[0]&0x10 != 0 {
+				t.Errorf("EF.USIM_SQN flags = %02X, want sqn_check cleared", f.usimSQN.Data[0])
+			}
+		})
+	}
+}
+
+func TestSJA_ReadKi(t *testing.T) {
+	f := newSJAFixture(t)
+	drv := sim.FindDriver(f.reader)
+	if !sim.HasCapability(drv, sim.CapReadKi) {
+		t.Fatal("SJA2 should advertise read-ki")
+	}
+
+	var trace []card.APDUExchange
+	f.reader.SetTrace(func(ex card.APDUExchange) { trace = append(trace, ex) })
+	ki, err := sim.ReadKi(f.reader, drv)
+	if err != nil {
+		t.Fatalf("ReadKi() error = %v", err)
+	}
+	if want := fromHex(t, "FFEEDDCCBBAA99887766554433221100"); !bytes.Equal(ki, want) {
+		t.Errorf("ReadKi() = %X, want %X", ki, want)
+	}
+	// The trace records the access, never the key
+	if len(trace) == 0 {
+		t.Fatal("nothing traced")
+	}
+	for _, ex := range trace {
+		if ex.Secret != "Ki" || len(ex.Response) > 4 {
+			t.Errorf("traced %+v, want a Ki access with the status word only", ex)
+		}
+	}
+}
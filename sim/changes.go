@@ -0,0 +1,198 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// FileChange is the before/after content of one EF modified during a write session
+type FileChange struct {
+	File    string   `json:"file"`             // EF name and application, e.g. "EF_IMSI (USIM)"
+	Path    string   `json:"path"`             // ADF or MF path, e.g. "ADF_USIM/6F07"
+	Record  int      `json:"record,omitempty"` // record number for record files
+	Offset  int      `json:"offset,omitempty"` // offset for partial binary writes
+	Before  string   `json:"before"`           // hex, empty if the old content could not be read
+	After   string   `json:"after"`            // hex
+	Decoded []string `json:"decoded,omitempty"`
+}
+
+// BuildFileChanges turns the reader change log into file changes. Consecutive chunks
+// written to the same EF (WriteAllBinary) are merged into one change.
+func BuildFileChanges(writes []card.FileWrite) []FileChange {
+	var merged []card.FileWrite
+	for _, w := range writes {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if last.Command == "UPDATE BINARY" && w.Command == last.Command &&
+				bytes.Equal(last.AID, w.AID) && bytes.Equal(last.Path, w.Path) &&
+				w.Offset == last.Offset+len(last.After) {
+				last.After = append(append([]byte(nil), last.After...), w.After...)
+				if last.Before != nil && w.Before != nil {
+					last.Before = append(append([]byte(nil), last.Before...), w.Before...)
+				} else {
+					last.Before = nil
+				}
+				continue
+			}
+		}
+		merged = append(merged, w)
+	}
+
+	changes := make([]FileChange, 0, len(merged))
+	for _, w := range merged {
+		app := changeApplication(w)
+		name := fmt.Sprintf("EF %04X", w.FileID())
+		if def, ok := changeFileDefinition(app, w.FileID()); ok {
+			name = def.Name
+		}
+		if app != "" {
+			name += " (" + strings.TrimPrefix(app, "ADF_") + ")"
+		}
+		c := FileChange{
+			File:   name,
+			Path:   changePath(app, w),
+			Record: int(w.Record),
+			Offset: w.Offset,
+			Before: fmt.Sprintf("%X", w.Before),
+			After:  fmt.Sprintf("%X", w.After),
+		}
+		if w.Before != nil && w.Offset == 0 {
+			c.Decoded = decodeChange(app, w.FileID(), w.Before, w.After)
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// changeApplication returns ADF_USIM / ADF_ISIM for writes below a known application
+func changeApplication(w card.FileWrite) string {
+	switch {
+	case len(w.AID) == 0:
+		for i := 0; i+2 <= len(w.Path); i += 2 {
+			if bytes.Equal(w.Path[i:i+2], DetectedUSIM_Path) && len(DetectedUSIM_Path) > 0 {
+				return "ADF_USIM"
+			}
+			if bytes.Equal(w.Path[i:i+2], DetectedISIM_Path) && len(DetectedISIM_Path) > 0 {
+				return "ADF_ISIM"
+			}
+		}
+		return ""
+	case bytes.HasPrefix(w.AID, AID_USIM) || bytes.Equal(w.AID, GetUSIMAID()):
+		return "ADF_USIM"
+	case bytes.HasPrefix(w.AID, AID_ISIM) || bytes.Equal(w.AID, GetISIMAID()):
+		return "ADF_ISIM"
+	}
+	return fmt.Sprintf("ADF %X", w.AID)
+}
+
+// changeFileDefinition looks up the EF in the file table of its application
+func changeFileDefinition(app string, fid uint16) (EFDefinition, bool) {
+	var def EFDefinition
+	var ok bool
+	switch app {
+	case "ADF_USIM":
+		def, ok = USIM_Files[fid]
+	case "ADF_ISIM":
+		def, ok = ISIM_Files[fid]
+	case "":
+		def, ok = MF_Files[fid]
+	}
+	return def, ok
+}
+
+// changePath formats the selection path of a write
+func changePath(app string, w card.FileWrite) string {
+	var parts []string
+	if app != "" {
+		parts = append(parts, app)
+	}
+	for i := 0; i+2 <= len(w.Path); i += 2 {
+		parts = append(parts, fmt.Sprintf("%X", w.Path[i:i+2]))
+	}
+	return strings.Join(parts, "/")
+}
+
+// decodeChange interprets the old and new content of EFs with a decoder in the registry
+func decodeChange(app string, fid uint16, before, after []byte) []string {
+	d := changeDecoder(app, fid)
+	if d == nil {
+		return nil
+	}
+	if d.services != nil {
+		return changedServices(DecodeUST(before), DecodeUST(after), d.services)
+	}
+
+	old := d.decode(before)
+	cur := d.decode(after)
+	oldValues := make(map[string]string, len(old))
+	for _, f := range old {
+		oldValues[f.Label] = f.Value
+	}
+	var lines []string
+	seen := make(map[string]bool, len(cur))
+	for _, f := range cur {
+		seen[f.Label] = true
+		lines = append(lines, changedValue(f.Label, oldValues[f.Label], f.Value)...)
+	}
+	for _, f := range old {
+		if !seen[f.Label] {
+			lines = append(lines, changedValue(f.Label, f.Value, "")...)
+		}
+	}
+	return lines
+}
+
+// changedValue returns "label: old → new", or nothing if the decoded value is unchanged
+func changedValue(label, before, after string) []string {
+	if before == after {
+		return nil
+	}
+	if before == "" {
+		before = "(empty)"
+	}
+	if after == "" {
+		after = "(empty)"
+	}
+	return []string{fmt.Sprintf("%s: %s → %s", label, before, after)}
+}
+
+// changedServices lists the service table bits toggled between before and after
+func changedServices(before, after map[int]bool, names map[int]string) []string {
+	var nums []int
+	for n := range before {
+		if !after[n] {
+			nums = append(nums, n)
+		}
+	}
+	for n := range after {
+		if !before[n] {
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	lines := make([]string, 0, len(nums))
+	for _, n := range nums {
+		state := "disabled"
+		if after[n] {
+			state = "enabled"
+		}
+		label := fmt.Sprintf("Service %d", n)
+		if name, ok := names[n]; ok {
+			label += " (" + name + ")"
+		}
+		lines = append(lines, label+": "+state)
+	}
+	return lines
+}
+
+func formatPLMNs(list []PLMN) string {
+	parts := make([]string, len(list))
+	for i, p := range list {
+		parts[i] = p.String()
+	}
+	return strings.Join(parts, ", ")
+}
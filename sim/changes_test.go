@@ -0,0 +1,53 @@
+package sim
+
+import (
+	"strings"
+	"testing"
+)
+
+// ============ CHANGE SUMMARY TESTS ============
+
+func TestBuildFileChanges(t *testing.T) {
+	reader, _ := newApplyTestReader()
+	reader.SetChangeLog(true)
+
+	if err := WriteIMSI(reader, "001010000000001"); err != nil {
+		t.Fatalf("WriteIMSI() error = %v", err)
+	}
+	if err := WriteHPLMN(reader, "001", "01", 0x4000); err != nil {
+		t.Fatalf("WriteHPLMN() error = %v", err)
+	}
+
+	changes := BuildFileChanges(reader.ChangeLog())
+	if len(changes) != 2 {
+		t.Fatalf("BuildFileChanges() = %+v, want 2 changes", changes)
+	}
+
+	imsi := changes[0]
+	if imsi.File != "EF_IMSI (USIM)" || imsi.Path != "ADF_USIM/6F07" {
+		t.Errorf("IMSI change file = %q, path = %q", imsi.File, imsi.Path)
+	}
+	if imsi.Before != "082905880000000010" || imsi.After != "080910100000000010" {
+		t.Errorf("IMSI change hex = %s -> %s", imsi.Before, imsi.After)
+	}
+	if len(imsi.Decoded) != 1 || imsi.Decoded[0] != "IMSI: 250880000000001 → 001010000000001" {
+		t.Errorf("IMSI decoded = %q", imsi.Decoded)
+	}
+
+	hplmn := changes[1]
+	if hplmn.File != "EF_HPLMNwACT (USIM)" || len(hplmn.Decoded) != 1 ||
+		!strings.HasSuffix(hplmn.Decoded[0], "(empty) → 001-01:eutran") {
+		t.Errorf("HPLMN change = %+v", hplmn)
+	}
+}
+
+func TestBuildFileChanges_ServiceToggles(t *testing.T) {
+	got := changedServices(DecodeUST([]byte{0x01, 0x00}), DecodeUST([]byte{0x00, 0x02}), USTServices)
+	want := []string{
+		"Service 1 (Local Phone Book): disabled",
+		"Service 10 (SMS (Short Message Storage)): enabled",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("changedServices() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,38 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+
+	"sim_reader/card"
+)
+
+// WithISIMChannel runs fn with the reader switched to a separate logical channel, so that
+// ADF_USIM stays selected (with its security state) on the basic channel while ISIM files
+// are accessed. GSM-class cards and cards without logical channels (MANAGE CHANNEL 6881)
+// run fn on the current channel as before.
+func WithISIMChannel(reader *card.Reader, fn func() error) error {
+	_, err := withLogicalChannel(reader, "ISIM", fn)
+	return err
+}
+
+// withLogicalChannel runs fn on a newly opened logical channel and closes it afterwards.
+// When no channel can be opened fn runs on the current channel; opened reports which.
+func withLogicalChannel(reader *card.Reader, debugName string, fn func() error) (opened bool, err error) {
+	if UseGSMCommands || reader.Channel() != 0 {
+		return false, fn()
+	}
+	ch, err := reader.OpenLogicalChannel()
+	if err != nil {
+		if DebugUSIM && !errors.Is(err, card.ErrChannelNotSupported) {
+			fmt.Printf("DEBUG %s: MANAGE CHANNEL failed: %v (using basic channel)\n", debugName, err)
+		}
+		return false, fn()
+	}
+	reader.UseChannel(ch)
+	defer func() {
+		reader.UseChannel(0)
+		reader.CloseLogicalChannel(ch)
+	}()
+	return true, fn()
+}
@@ -0,0 +1,72 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ LOGICAL CHANNEL TESTS ============
+
+var channelTestIMSI = []byte{0x08, 0x29, 0x05, 0x88, 0x00, 0x00, 0x00, 0x00, 0x10}
+
+// newChannelTestReader returns a card with USIM and ISIM whose EF 6F07 (IMSI / IST) differ
+func newChannelTestReader(channels int) (*card.Reader, *card.MockCard) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.Channels = channels
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, channelTestIMSI)
+	usim.AddEF(0x6FAD, []byte{0x00, 0x00, 0x00, 0x02})
+	isim := m.AddADF(AID_ISIM)
+	isim.AddEF(0x6F02, []byte{0x80, 0x05, 'a', '@', 'b', '.', 'c'})
+	isim.AddEF(0x6F07, []byte{0x03})
+	return card.NewReaderWithTransport("Mock", m.ATR, m), m
+}
+
+func TestWithISIMChannel(t *testing.T) {
+	tests := []struct {
+		name        string
+		channels    int
+		usimKept    bool
+		wantChannel byte
+	}{
+		{"Logical channel", 4, true, 0x01},
+		{"Fallback to basic channel", 0, false, 0x00},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reader, m := newChannelTestReader(tc.channels)
+
+			if _, err := ReadUSIM(reader); err != nil {
+				t.Fatalf("ReadUSIM() error = %v", err)
+			}
+			m.Log = nil
+			var isim *ISIMData
+			err := WithISIMChannel(reader, func() error {
+				var err error
+				isim, err = ReadISIM(reader)
+				return err
+			})
+			if err != nil || isim.IMPI != "a@b.c" {
+				t.Fatalf("ReadISIM() = %+v, %v", isim, err)
+			}
+			if reader.Channel() != 0 {
+				t.Errorf("reader left on channel %d", reader.Channel())
+			}
+			for _, apdu := range m.Log {
+				if apdu[1] == card.INS_SELECT && bytes.Contains(apdu, AID_ISIM[:7]) && apdu[0] != tc.wantChannel {
+					t.Errorf("ISIM SELECT %X has CLA %02X, want %02X", apdu, apdu[0], tc.wantChannel)
+				}
+			}
+
+			// Combined read: back to USIM work without re-selecting ADF_USIM
+			_, raw, err := readEF(reader, 0x6F07)
+			if got := err == nil && bytes.Equal(raw, channelTestIMSI); got != tc.usimKept {
+				t.Errorf("EF 6F07 after ISIM read = %X (%v), USIM kept selected = %v, want %v", raw, err, got, tc.usimKept)
+			}
+			t.Logf("%s: %d APDUs for the ISIM read", tc.name, len(m.Log))
+		})
+	}
+}
@@ -1,96 +1,147 @@
 package sim
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"sim_reader/algorithms"
 	"sim_reader/card"
+	"strings"
 )
 
 // SIMConfig represents the configuration for writing to a SIM card
 type SIMConfig struct {
 	// Identity fields (writable on programmable cards)
-	ICCID  string `json:"iccid,omitempty"`  // Card ID (18-20 digits, programmable cards only)
-	MSISDN string `json:"msisdn,omitempty"` // Phone number
+	ICCID  string `json:"iccid,omitempty" doc:"Card ID (18-20 digits, programmable cards only)"` // Card ID (18-20 digits, programmable cards only)
+	MSISDN string `json:"msisdn,omitempty" doc:"Phone number"`                                   // Phone number
 
 	// USIM parameters (writable)
-	IMSI string `json:"imsi,omitempty"`
-	SPN  string `json:"spn,omitempty"`
-	MCC  string `json:"mcc,omitempty"`
-	MNC  string `json:"mnc,omitempty"`
+	IMSI string `json:"imsi,omitempty" doc:"USIM: subscriber identity (EF_IMSI)"`
+	SPN  string `json:"spn,omitempty" doc:"USIM: service provider name (EF_SPN)"`
+	MCC  string `json:"mcc,omitempty" doc:"USIM: home network MCC"`
+	MNC  string `json:"mnc,omitempty" doc:"USIM: home network MNC (2 or 3 digits)"`
+
+	// Public service identity of the SM-SC for SMS over IP (EF_PSISMSC)
+	PSISMSC string `json:"psismsc,omitempty" doc:"PSI of the SM-SC for SMS over IP (EF_PSISMSC in DF_TELECOM, else ADF_USIM), e.g. tel:+79990000000"`
+
+	// Default SMS parameters (EF_SMSP record 1)
+	SMS *SMSConfig `json:"sms,omitempty" doc:"Default SMS parameters (EF_SMSP record 1): SMSC, protocol ID, DCS, validity period, alpha ID"`
 
 	// UE Operation Mode (3GPP TS 31.102)
 	// Values: normal, type-approval, normal-specific, type-approval-specific, maintenance, cell-test
-	OperationMode string `json:"operation_mode,omitempty"`
+	OperationMode string `json:"operation_mode,omitempty" doc:"UE operation mode: normal, type-approval, normal-specific, type-approval-specific, maintenance, cell-test"`
 
 	// Languages preference (EF_LI)
-	Languages []string `json:"languages,omitempty"`
+	Languages []string `json:"languages,omitempty" doc:"Language preference (EF_LI)"`
 
 	// Access Control Classes
 	// For reading: []int with class numbers
 	// For writing on programmable cards: use ACCHex (4 hex chars)
-	ACC    []int  `json:"acc,omitempty"`
-	ACCHex string `json:"acc_hex,omitempty"` // Access Control Class for writing (4 hex chars)
+	ACC    []int  `json:"acc,omitempty" doc:"Access Control Classes (class numbers, read-only)"`
+	ACCHex string `json:"acc_hex,omitempty" doc:"Access Control Class for writing (4 hex chars)"` // Access Control Class for writing (4 hex chars)
 
 	// HPLMN search period in minutes (EF_HPPLMN, 0x6F31)
-	HPLMNPeriod int `json:"hplmn_period,omitempty"`
+	HPLMNPeriod int `json:"hplmn_period,omitempty" doc:"HPLMN search period in minutes (EF_HPPLMN)"`
 
 	// HPLMN configuration (EF_HPLMNwACT, 0x6F62)
-	HPLMN []HPLMNConfig `json:"hplmn,omitempty"`
+	HPLMN []HPLMNConfig `json:"hplmn,omitempty" doc:"Home PLMN with access technologies (EF_HPLMNwAcT)"`
 
 	// Operator PLMN configuration (EF_OPLMNwACT, 0x6F61)
-	OPLMN []HPLMNConfig `json:"oplmn,omitempty"`
+	OPLMN []HPLMNConfig `json:"oplmn,omitempty" doc:"Operator controlled PLMN list (EF_OPLMNwAcT)"`
 
 	// User Controlled PLMN configuration (EF_PLMNwAcT, 0x6F60)
-	UserPLMN []HPLMNConfig `json:"user_plmn,omitempty"`
+	UserPLMN []HPLMNConfig `json:"user_plmn,omitempty" doc:"User controlled PLMN list (EF_PLMNwAcT)"`
 
 	// Forbidden PLMNs (read-only, use clear_fplmn to clear)
-	FPLMN []string `json:"fplmn,omitempty"`
+	FPLMN []string `json:"fplmn,omitempty" doc:"Forbidden PLMNs (read-only, use clear_fplmn to clear)"`
 
 	// ISIM parameters
-	ISIM *ISIMConfig `json:"isim,omitempty"`
+	ISIM *ISIMConfig `json:"isim,omitempty" doc:"ISIM parameters (IMPI, IMPU, domain, P-CSCF)"`
+	// All ISIM applications of a multi-ISIM card (read only)
+	ISIMInstances []ISIMInstanceConfig `json:"isim_instances,omitempty" doc:"All ISIM applications in EF_DIR order on multi-ISIM cards (export only, write one with --isim-index)"`
 
 	// Services
-	Services *ServicesConfig `json:"services,omitempty"`
+	Services *ServicesConfig `json:"services,omitempty" doc:"UST/IST service flags to enable or disable"`
 
 	// Cryptographic keys (programmable cards only - DANGEROUS!)
-	Ki  string `json:"ki,omitempty"`  // Subscriber key (32 hex chars)
-	OP  string `json:"op,omitempty"`  // Operator key OP (32 hex chars, OPc will be computed)
-	OPc string `json:"opc,omitempty"` // Operator key OPc (32 hex chars)
+	Ki  string `json:"ki,omitempty" doc:"Subscriber key Ki (32 hex chars, programmable cards only)"` // Subscriber key (32 hex chars)
+	OP  string `json:"op,omitempty" doc:"Operator key OP (32 hex chars, OPc will be computed)"`      // Operator key OP (32 hex chars, OPc will be computed)
+	OPc string `json:"opc,omitempty" doc:"Operator key OPc (32 hex chars)"`                          // Operator key OPc (32 hex chars)
+
+	// Per-card Ki derivation from the ICCID (programmable cards only), replaces ki
+	KDerivation *KDerivationConfig `json:"k_derivation,omitempty" doc:"Derive Ki per card from a master key and the ICCID (replaces ki; OPc is computed from op)"`
 
 	// Authentication algorithm (programmable cards only)
 	// Values: milenage, xor, tuak, s3g-128, s3g-256
-	Algorithm string `json:"algorithm,omitempty"`
+	Algorithm string `json:"algorithm,omitempty" doc:"Authentication algorithm: milenage, xor, tuak, s3g-128, s3g-256"`
 
 	// Security codes (programmable cards only)
-	PIN1 string `json:"pin1,omitempty"` // PIN1 code (4-8 digits)
-	PUK1 string `json:"puk1,omitempty"` // PUK1 code (8 digits)
-	PIN2 string `json:"pin2,omitempty"` // PIN2 code (4-8 digits)
-	PUK2 string `json:"puk2,omitempty"` // PUK2 code (8 digits)
-	ADM1 string `json:"adm1,omitempty"` // ADM1 code (8 hex chars or digits)
+	PIN1 string `json:"pin1,omitempty" doc:"PIN1 code (4-8 digits)"`            // PIN1 code (4-8 digits)
+	PUK1 string `json:"puk1,omitempty" doc:"PUK1 code (8 digits)"`              // PUK1 code (8 digits)
+	PIN2 string `json:"pin2,omitempty" doc:"PIN2 code (4-8 digits)"`            // PIN2 code (4-8 digits)
+	PUK2 string `json:"puk2,omitempty" doc:"PUK2 code (8 digits)"`              // PUK2 code (8 digits)
+	ADM1 string `json:"adm1,omitempty" doc:"ADM1 code (8 hex chars or digits)"` // ADM1 code (8 hex chars or digits)
 
 	// eSIM profile build parameters
 	// ProfileType is the eSIM profile type identifier (e.g., "test", "operational")
-	ProfileType string `json:"profile_type,omitempty"`
+	ProfileType string `json:"profile_type,omitempty" doc:"eSIM profile type (e.g. test, operational)"`
 
 	// AlgorithmID specifies the authentication algorithm for eSIM profiles:
 	// 1=Milenage, 2=TUAK, 3=USIM Test Algorithm (delegate to applet)
-	AlgorithmID int `json:"algorithm_id,omitempty"`
+	AlgorithmID int `json:"algorithm_id,omitempty" doc:"eSIM algorithm: 1=Milenage, 2=TUAK, 3=USIM Test Algorithm"`
 
 	// UseAppletAuth delegates authentication to a Java Card applet (sets AlgorithmID=3)
 	// When true, the applet's Ki/OPc are used instead of profile-level keys
-	UseAppletAuth bool `json:"use_applet_auth,omitempty"`
+	UseAppletAuth bool `json:"use_applet_auth,omitempty" doc:"Delegate authentication to a Java Card applet"`
 
-	// Deprecated: use top-level fields instead
-	// Kept for backward compatibility with old config files
-	Programmable *ProgrammableConfig `json:"programmable,omitempty"`
+	// Card-specific settings (card_type, sqn, ota_keys). The key, code and identity
+	// fields of this section are deprecated aliases of the top-level fields.
+	Programmable *ProgrammableConfig `json:"programmable,omitempty" doc:"Card-specific settings: card_type selector, SQN parameters, OTA keys (key/PIN fields here are deprecated, use top-level fields)"`
 
 	// GlobalPlatform parameters (experimental; used for applet management and ARA-M rules)
-	GlobalPlatform *GlobalPlatformConfig `json:"global_platform,omitempty"`
+	GlobalPlatform *GlobalPlatformConfig `json:"global_platform,omitempty" doc:"GlobalPlatform keys, ARA-M rules and applets (experimental)"`
 
 	// PLMN options
-	ClearFPLMN bool `json:"clear_fplmn,omitempty"`
+	ClearFPLMN bool `json:"clear_fplmn,omitempty" doc:"Clear the forbidden PLMN list"`
+
+	// Sections that must be applied: a card without their file fails the whole write
+	Required []string `json:"required,omitempty" doc:"Sections the card must support, else nothing is written (imsi, spn, psismsc, sms, mnc, operation_mode, clear_fplmn, hplmn, oplmn, user_plmn, services, isim); sections not listed are skipped when unsupported"`
+
+	// Call information and advice of charge (export only, ignored on write)
+	CallInfo *CallInfo `json:"call_info,omitempty" doc:"Call history and call meter, read with --call-info (export only, ignored on write)"`
+
+	// Voicemail configuration (export only, ignored on write)
+	Voicemail *Voicemail `json:"voicemail,omitempty" doc:"Mailbox numbers (EF_MBDN with EF_EXT6), mailbox identifiers (EF_MBI) and message waiting status (EF_MWIS) (export only, write the number with --write-voicemail)"`
+
+	// Barred dialling numbers (export only, ignored on write)
+	BDN *BDNList `json:"bdn,omitempty" doc:"EF_BDN entries and the BDN service state, read with --bdn-list (export only, ignored on write)"`
+
+	// Steering of roaming files, read with --show-sor (export only)
+	SOR *SORData `json:"sor,omitempty" doc:"EF_FROMPREFERRED and EF_SOR-CMCI with UST services 131/132, read with --show-sor (export only, ignored on write)"`
+
+	// Per-EF read outcome of the USIM (export only, ignored on write)
+	Files map[string]FileStatusExport `json:"files,omitempty" doc:"USIM files read: present or not, with SW/error for failed reads (export only, ignored on write)"`
+
+	// Raw service tables for --compare-services (export only, ignored on write)
+	ServiceTables *ServiceTablesExport `json:"service_tables,omitempty" doc:"UST, EST and IST as read, in hex (export only, ignored on write)"`
+
+	// Warnings collected while reading the card (export only, ignored on write)
+	Warnings []string `json:"warnings,omitempty" doc:"Problems encountered while reading (export only, ignored on write)"`
+
+	// Timing breakdown of the read with --profile (export only, ignored on write)
+	Profile *card.MetricsReport `json:"profile,omitempty" doc:"Wall time and APDU count per operation, with --profile (export only, ignored on write)"`
+
+	// derived holds the keys computed by DeriveKeys
+	derived *DerivedKeys
+}
+
+// ServiceTablesExport holds the service tables of a card in hex
+type ServiceTablesExport struct {
+	UST string `json:"ust,omitempty"`
+	EST string `json:"est,omitempty"`
+	IST string `json:"ist,omitempty"`
 }
 
 // GlobalPlatformConfig contains configuration for GP secure channel operations and key storage.
@@ -102,35 +153,35 @@ type SIMConfig struct {
 type GlobalPlatformConfig struct {
 	// SDAID is the Security Domain / Card Manager AID (hex).
 	// If empty, callers typically try common defaults depending on platform.
-	SDAID string `json:"sd_aid,omitempty"`
+	SDAID string `json:"sd_aid,omitempty" doc:"Security Domain / Card Manager AID (hex)"`
 
 	// SecurityLevel is the Secure Channel security level, e.g. "mac" or "mac+enc".
-	SecurityLevel string `json:"security_level,omitempty"`
+	SecurityLevel string `json:"security_level,omitempty" doc:"Secure channel security level: mac or mac+enc"`
 
 	// KVN is the Key Version Number (0..255) used for INITIALIZE UPDATE.
 	// If omitted, tooling may try 0 or auto-probe.
-	KVN *int `json:"kvn,omitempty"`
+	KVN *int `json:"kvn,omitempty" doc:"Key Version Number for INITIALIZE UPDATE"`
 
 	// SCP can be "auto", "scp02", or "scp03".
 	// If omitted, tooling should auto-detect based on INITIALIZE UPDATE response.
-	SCP string `json:"scp,omitempty"`
+	SCP string `json:"scp,omitempty" doc:"Secure channel protocol: auto, scp02, scp03"`
 
 	// KeySets is a list of known GP keysets for this environment.
 	// Tooling may select one by name and/or auto-probe.
-	KeySets []GPKeySetConfig `json:"keysets,omitempty"`
+	KeySets []GPKeySetConfig `json:"keysets,omitempty" doc:"Known GP keysets"`
 
 	// DefaultKeySet selects a KeySets entry by Name.
-	DefaultKeySet string `json:"default_keyset,omitempty"`
+	DefaultKeySet string `json:"default_keyset,omitempty" doc:"Keyset name used by default"`
 
 	// DMS is an optional mapping to an external per-card key database (var_out format).
-	DMS *GPDMSConfig `json:"dms,omitempty"`
+	DMS *GPDMSConfig `json:"dms,omitempty" doc:"External per-card key database (var_out)"`
 
 	// ARAM optionally contains Access Rules (ARA-M) definitions.
-	ARAM *GPARAMConfig `json:"aram,omitempty"`
+	ARAM *GPARAMConfig `json:"aram,omitempty" doc:"ARA-M access rules"`
 
 	// Applets describes CAP load/install operations to be performed via GlobalPlatform.
 	// This is intended for Java Card / UICC applet management workflows.
-	Applets *GPAppletsConfig `json:"applets,omitempty"`
+	Applets *GPAppletsConfig `json:"applets,omitempty" doc:"CAP load/install operations"`
 }
 
 // GPAppletsConfig is a collection of GP applet/package management operations.
@@ -302,13 +353,31 @@ type ProgrammableConfig struct {
 	PIN2      string `json:"pin2,omitempty"`      // PIN2 code (4-8 digits)
 	PUK2      string `json:"puk2,omitempty"`      // PUK2 code (8 digits)
 	Algorithm string `json:"algorithm,omitempty"` // Algorithm: milenage, xor (default: milenage)
+
+	// Card-specific settings (not deprecated)
+	CardType string         `json:"card_type,omitempty" doc:"Card selector, e.g. sysmo-sja2, sysmo-sja5; selects the driver and refuses other cards"`
+	SQN      *SQNConfig     `json:"sqn,omitempty" doc:"SQN check parameters (sysmo-sja2/sja5)"`
+	OTAKeys  []OTAKeyConfig `json:"ota_keys,omitempty" doc:"OTA keys per keyset (sysmo-sja2/sja5)"`
 }
 
 // HPLMNConfig represents HPLMN entry configuration
 type HPLMNConfig struct {
 	MCC string   `json:"mcc"`
 	MNC string   `json:"mnc"`
-	ACT []string `json:"act"` // e.g., ["eutran", "utran", "gsm"]
+	ACT []string `json:"act"` // e.g., ["eutran", "utran", "gsm"], RFU bits as "0x0001"
+}
+
+// SMSConfig represents the default SMS parameters (EF_SMSP record 1).
+// Omitted fields keep their current value on the card.
+type SMSConfig struct {
+	SMSC           string `json:"smsc,omitempty" doc:"Service centre address, e.g. +491710760000"`
+	ProtocolID     *int   `json:"protocol_id,omitempty" doc:"TP-Protocol Identifier (0-255, usually 0)"`
+	DCS            *int   `json:"dcs,omitempty" doc:"TP-Data Coding Scheme (0-255, 0 = GSM 7-bit)"`
+	ValidityPeriod string `json:"validity_period,omitempty" doc:"Relative validity period, e.g. 30m, 12h, 7d, 5w (rounded up to the TS 23.040 steps)"`
+	AlphaID        string `json:"alpha_id,omitempty" doc:"Alpha identifier of the parameter set"`
+
+	// Fail the write instead of skipping the section when the card has no EF_SMSP
+	Required bool `json:"required,omitempty" doc:"Fail before writing anything when the card has no EF_SMSP"`
 }
 
 // ISIMConfig represents ISIM-specific configuration
@@ -317,6 +386,39 @@ type ISIMConfig struct {
 	IMPU   []string `json:"impu,omitempty"`
 	Domain string   `json:"domain,omitempty"`
 	PCSCF  []string `json:"pcscf,omitempty"`
+
+	// Fail the write instead of skipping the section when the card has no ISIM or ISIM file
+	Required bool `json:"required,omitempty"`
+
+	// Per-EF read outcome (export only, ignored on write)
+	Files map[string]FileStatusExport `json:"files,omitempty"`
+}
+
+// ISIMInstanceConfig is one ISIM application of a multi-ISIM card
+type ISIMInstanceConfig struct {
+	Index  int      `json:"index"` // 1-based, as used by --isim-index
+	AID    string   `json:"aid"`
+	Label  string   `json:"label,omitempty"`
+	IMPI   string   `json:"impi,omitempty"`
+	IMPU   []string `json:"impu,omitempty"`
+	Domain string   `json:"domain,omitempty"`
+	PCSCF  []string `json:"pcscf,omitempty"`
+}
+
+// ExportISIMInstances converts multi-ISIM read results for the JSON/YAML export
+func ExportISIMInstances(instances []ISIMInstance) []ISIMInstanceConfig {
+	out := make([]ISIMInstanceConfig, 0, len(instances))
+	for _, inst := range instances {
+		c := ISIMInstanceConfig{Index: inst.Index, AID: inst.AID, Label: inst.Label}
+		if inst.Data != nil && inst.Data.Available {
+			c.IMPI = inst.Data.IMPI
+			c.IMPU = inst.Data.IMPU
+			c.Domain = inst.Data.Domain
+			c.PCSCF = inst.Data.PCSCF
+		}
+		out = append(out, c)
+	}
+	return out
 }
 
 // ServicesConfig represents service enable/disable flags
@@ -338,19 +440,46 @@ type ServicesConfig struct {
 	ISIMVoiceDomainPref *bool `json:"isim_voice_domain_pref,omitempty"`
 	ISIMGBA             *bool `json:"isim_gba,omitempty"`
 	ISIMHttpDigest      *bool `json:"isim_http_digest,omitempty"`
+
+	// Fail the write instead of skipping the flags when the card has no EF_UST/EF_IST
+	Required bool `json:"required,omitempty"`
 }
 
-// LoadConfig loads configuration from a JSON file
+// LoadConfig loads configuration from a JSON or YAML (.yaml/.yml) file.
+// Both formats are validated strictly: unknown fields are rejected, except keys
+// starting with "_" which are treated as comments (e.g. "_comment" in JSON).
 func LoadConfig(filename string) (*SIMConfig, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config SIMConfig
-	if err := json.Unmarshal(data, &config); err != nil {
+	if IsYAMLFile(filename) {
+		if data, err = yamlConfigToJSON(data); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+
+	config, err := ParseConfig(data)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	return config, nil
+}
+
+// ParseConfig decodes a JSON configuration (unknown fields are rejected like in LoadConfig)
+func ParseConfig(data []byte) (*SIMConfig, error) {
+	var config SIMConfig
+	if err := decodeConfigStrict(data, &config); err != nil {
+		return nil, err
+	}
+
+	if err := config.validateRequired(); err != nil {
+		return nil, err
+	}
+	if err := config.validatePLMNs(); err != nil {
+		return nil, err
+	}
 
 	// Migrate deprecated "programmable" section to top-level fields
 	config.migrateFromProgrammable()
@@ -400,15 +529,36 @@ func (c *SIMConfig) migrateFromProgrammable() {
 		c.Algorithm = c.Programmable.Algorithm
 	}
 
-	// Print deprecation warning
-	fmt.Println("⚠ Warning: 'programmable' section is deprecated. Please use top-level fields instead.")
+	// Print deprecation warning (card-specific settings are not deprecated)
+	if c.Programmable.hasLegacyFields() {
+		fmt.Println("⚠ Warning: key/PIN/identity fields in 'programmable' are deprecated. Please use top-level fields instead.")
+	}
+}
+
+// hasLegacyFields reports whether the section sets any deprecated top-level alias
+func (p *ProgrammableConfig) hasLegacyFields() bool {
+	return p.Ki != "" || p.OP != "" || p.OPc != "" || p.ICCID != "" || p.MSISDN != "" || p.ACC != "" ||
+		p.PIN1 != "" || p.PUK1 != "" || p.PIN2 != "" || p.PUK2 != "" || p.Algorithm != ""
+}
+
+// hasCardSettings reports whether the section sets card-specific settings
+func (p *ProgrammableConfig) hasCardSettings() bool {
+	return p != nil && (p.SQN != nil || len(p.OTAKeys) > 0)
+}
+
+// cardType returns the card_type selector of the config ("" if none)
+func (c *SIMConfig) cardType() string {
+	if c.Programmable == nil {
+		return ""
+	}
+	return c.Programmable.CardType
 }
 
 // HasProgrammableFields returns true if any programmable-only fields are set
 func (c *SIMConfig) HasProgrammableFields() bool {
-	return c.Ki != "" || c.OP != "" || c.OPc != "" ||
+	return c.Ki != "" || c.OP != "" || c.OPc != "" || c.KDerivation != nil ||
 		c.PIN1 != "" || c.PIN2 != "" ||
-		c.Algorithm != ""
+		c.Algorithm != "" || c.Programmable.hasCardSettings()
 }
 
 // RequiresProgrammableCard returns true if the config requires a programmable card
@@ -416,9 +566,56 @@ func (c *SIMConfig) RequiresProgrammableCard() bool {
 	return c.HasProgrammableFields()
 }
 
-// SaveConfig saves configuration to a JSON file
+// decodeConfigStrict decodes JSON into config, rejecting unknown fields and trailing data.
+// Keys starting with "_" are dropped first so configs can carry comments.
+func decodeConfigStrict(data []byte, config any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("unexpected data after config object")
+	}
+	cleaned, err := json.Marshal(stripCommentKeys(generic))
+	if err != nil {
+		return err
+	}
+
+	dec = json.NewDecoder(bytes.NewReader(cleaned))
+	dec.DisallowUnknownFields()
+	return dec.Decode(config)
+}
+
+// stripCommentKeys removes "_"-prefixed keys from decoded JSON objects recursively
+func stripCommentKeys(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if strings.HasPrefix(k, "_") {
+				delete(t, k)
+				continue
+			}
+			t[k] = stripCommentKeys(child)
+		}
+	case []any:
+		for i := range t {
+			t[i] = stripCommentKeys(t[i])
+		}
+	}
+	return v
+}
+
+// SaveConfig saves configuration to a JSON file, or YAML when the name ends in .yaml/.yml
 func SaveConfig(filename string, config *SIMConfig) error {
-	data, err := json.MarshalIndent(config, "", "  ")
+	var data []byte
+	var err error
+	if IsYAMLFile(filename) {
+		data, err = MarshalConfigYAML(config)
+	} else {
+		data, err = json.MarshalIndent(config, "", "  ")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -430,16 +627,43 @@ func SaveConfig(filename string, config *SIMConfig) error {
 	return nil
 }
 
-// ApplyConfig applies the configuration to the SIM card
+// ApplyConfig applies the configuration to the SIM card and returns a per-item report.
+// Current values are read first and items that already match are skipped. Every section
+// is then resolved against the card (report.Plan, printed before the first write):
+// sections whose file or application is missing are skipped, or fail the whole apply
+// before anything is written when the config marks them required.
 // If dryRun is true, programmable card operations will be simulated without writing
+// (implied when the reader is in dry-run mode; other writes are then reported as dry-run)
 // If force is true, programmable card operations will be forced on unrecognized cards
-func ApplyConfig(reader *card.Reader, config *SIMConfig, dryRun, force bool) error {
-	var errors []string
+func ApplyConfig(reader *card.Reader, config *SIMConfig, dryRun, force bool) (*ApplyReport, error) {
+	report := &ApplyReport{simulate: reader.DryRun()}
+	dryRun = dryRun || report.simulate
 
 	// Detect programmable card driver once
 	drv := FindDriver(reader)
+
+	// card_type selects the driver explicitly (cards with an unlisted ATR) and refuses other cards
+	if name := config.cardType(); name != "" {
+		selected, err := driverForConfigCardType(drv, name, force)
+		if err != nil {
+			report.failed(nil, "card_type", err)
+			return report, report.Err()
+		}
+		if selected != drv {
+			fmt.Printf("⚠ Warning: Using driver %s selected by card_type %q\n", selected.Name(), name)
+		}
+		drv = selected
+	}
 	isProgrammable := drv != nil
 
+	// k_derivation: Ki and OPc of this card from its ICCID, before anything is written
+	if config.KDerivation != nil && config.derived == nil {
+		if err := deriveConfigKeys(reader, config, drv); err != nil {
+			report.failed(nil, "Key derivation", err)
+			return report, report.Err()
+		}
+	}
+
 	// Show card type info if programmable fields are present
 	if config.RequiresProgrammableCard() {
 		if isProgrammable {
@@ -454,169 +678,98 @@ func ApplyConfig(reader *card.Reader, config *SIMConfig, dryRun, force bool) err
 			if drv != nil {
 				fmt.Printf("⚠ Warning: Using fallback driver %s (forced)\n", drv.Name())
 			}
-		} else {
-			errors = append(errors, "card is not recognized as programmable. Use --force to override (DANGEROUS!)")
 		}
 	}
 
-	// Apply programmable card operations first
-	if err := applyProgrammableFields(reader, config, drv, dryRun, force); err != nil {
-		errors = append(errors, fmt.Sprintf("Programmable: %v", err))
-	}
-
-	// Write IMSI
-	if config.IMSI != "" {
-		if err := WriteIMSI(reader, config.IMSI); err != nil {
-			errors = append(errors, fmt.Sprintf("IMSI: %v", err))
-		} else {
-			fmt.Println("✓ IMSI written successfully")
+	// Resolve every section against the card before writing anything
+	run := &applyRun{reader: reader, config: config, drv: drv, dryRun: dryRun, force: force, report: report}
+	run.readCurrent()
+	steps := config.applySteps()
+	report.Plan = run.resolve(steps)
+	report.Plan.print()
+	if report.Plan.Count(PlanFailRequired) > 0 {
+		for _, s := range report.Plan.Steps {
+			if s.Action == PlanFailRequired {
+				report.failed(nil, s.Name, fmt.Errorf("required, %s", s.Reason))
+			}
 		}
+		return report, report.Plan.Err()
 	}
 
-	// Write SPN
-	if config.SPN != "" {
-		if err := WriteSPN(reader, config.SPN, 0x00); err != nil {
-			errors = append(errors, fmt.Sprintf("SPN: %v", err))
-		} else {
-			fmt.Println("✓ SPN written successfully")
+	for i, s := range steps {
+		if p := report.Plan.Steps[i]; p.Action == PlanSkipUnsupported {
+			report.skipped(p.Name, p.Reason)
+			continue
 		}
+		done := reader.Measure("write " + s.name)
+		s.apply(run)
+		done()
 	}
 
-	// Update MNC length if MNC is specified
-	if config.MNC != "" {
-		mncLen := len(config.MNC)
-		if mncLen >= 2 && mncLen <= 3 {
-			if err := UpdateMNCLength(reader, mncLen); err != nil {
-				errors = append(errors, fmt.Sprintf("MNC length: %v", err))
-			} else {
-				fmt.Printf("✓ MNC length set to %d\n", mncLen)
-			}
-		}
-	}
+	return report, report.Err()
+}
 
-	// Set operation mode if specified
-	if config.OperationMode != "" {
-		if err := SetOperationModeFromString(reader, config.OperationMode); err != nil {
-			errors = append(errors, fmt.Sprintf("Operation mode: %v", err))
-		} else {
-			fmt.Printf("✓ Operation mode set to: %s\n", config.OperationMode)
-		}
+// driverForConfigCardType checks the detected driver against card_type name, or picks
+// the driver for name when the card was not identified (or with force)
+func driverForConfigCardType(drv ProgrammableDriver, name string, force bool) (ProgrammableDriver, error) {
+	if s, ok := drv.(CardTypeSelector); ok && s.CardType() == name {
+		return drv, nil
 	}
-
-	// Clear FPLMN
-	if config.ClearFPLMN {
-		if err := ClearForbiddenPLMN(reader); err != nil {
-			errors = append(errors, fmt.Sprintf("Clear FPLMN: %v", err))
-		} else {
-			fmt.Println("✓ Forbidden PLMN list cleared")
-		}
+	if drv != nil && !force {
+		return nil, fmt.Errorf("config is for card_type %q but the card is %s. Use --force to override", name, drv.Name())
 	}
-
-	// Write HPLMN
-	if len(config.HPLMN) > 0 {
-		entries := make([]HPLMNEntry, 0, len(config.HPLMN))
-		for _, h := range config.HPLMN {
-			actStr := ""
-			for i, a := range h.ACT {
-				if i > 0 {
-					actStr += ","
-				}
-				actStr += a
-			}
-			act := ParseACTString(actStr)
-			entries = append(entries, HPLMNEntry{
-				MCC: h.MCC,
-				MNC: h.MNC,
-				ACT: act,
-			})
-		}
-		if err := WriteHPLMNList(reader, entries); err != nil {
-			errors = append(errors, fmt.Sprintf("HPLMN: %v", err))
-		} else {
-			fmt.Printf("✓ HPLMN written (%d entries)\n", len(entries))
-		}
+	selected := DriverForCardType(name)
+	if selected == nil {
+		return nil, fmt.Errorf("unknown card_type %q", name)
 	}
+	return selected, nil
+}
 
-	// Write Operator PLMN
-	if len(config.OPLMN) > 0 {
-		entries := make([]HPLMNEntry, 0, len(config.OPLMN))
-		for _, h := range config.OPLMN {
-			actStr := ""
-			for i, a := range h.ACT {
-				if i > 0 {
-					actStr += ","
-				}
-				actStr += a
-			}
-			act := ParseACTString(actStr)
-			entries = append(entries, HPLMNEntry{
-				MCC: h.MCC,
-				MNC: h.MNC,
-				ACT: act,
-			})
-		}
-		if err := WriteOPLMNList(reader, entries); err != nil {
-			errors = append(errors, fmt.Sprintf("OPLMN: %v", err))
-		} else {
-			fmt.Printf("✓ OPLMN written (%d entries)\n", len(entries))
-		}
-	}
+// hasUSIMFields reports whether the config writes any standard USIM file
+func (c *SIMConfig) hasUSIMFields() bool {
+	return c.IMSI != "" || c.SPN != "" || c.PSISMSC != "" || c.SMS != nil || c.MNC != "" || c.OperationMode != "" || c.ClearFPLMN ||
+		len(c.HPLMN) > 0 || len(c.OPLMN) > 0 || len(c.UserPLMN) > 0 || c.Services != nil
+}
 
-	// Write User Controlled PLMN
-	if len(config.UserPLMN) > 0 {
-		entries := make([]HPLMNEntry, 0, len(config.UserPLMN))
-		for _, h := range config.UserPLMN {
-			actStr := ""
-			for i, a := range h.ACT {
-				if i > 0 {
-					actStr += ","
-				}
-				actStr += a
+// validatePLMNs checks the access technology names of the PLMN lists
+func (c *SIMConfig) validatePLMNs() error {
+	lists := []struct {
+		section string
+		entries []HPLMNConfig
+	}{{"hplmn", c.HPLMN}, {"oplmn", c.OPLMN}, {"user_plmn", c.UserPLMN}}
+	for _, l := range lists {
+		for i, h := range l.entries {
+			if _, err := ParseACT(strings.Join(h.ACT, ",")); err != nil {
+				return fmt.Errorf("%s[%d] act: %w", l.section, i, err)
 			}
-			act := ParseACTString(actStr)
-			entries = append(entries, HPLMNEntry{
-				MCC: h.MCC,
-				MNC: h.MNC,
-				ACT: act,
-			})
-		}
-		if err := WriteUserPLMNList(reader, entries); err != nil {
-			errors = append(errors, fmt.Sprintf("User PLMN: %v", err))
-		} else {
-			fmt.Printf("✓ User PLMN written (%d entries)\n", len(entries))
-		}
-	}
-
-	// Apply USIM services
-	if config.Services != nil {
-		if err := applyUSIMServices(reader, config.Services); err != nil {
-			errors = append(errors, fmt.Sprintf("USIM services: %v", err))
 		}
 	}
+	return nil
+}
 
-	// Apply ISIM parameters
-	if config.ISIM != nil {
-		if err := applyISIMConfig(reader, config.ISIM); err != nil {
-			errors = append(errors, fmt.Sprintf("ISIM: %v", err))
-		}
-
-		// Apply ISIM services
-		if config.Services != nil {
-			if err := applyISIMServices(reader, config.Services); err != nil {
-				errors = append(errors, fmt.Sprintf("ISIM services: %v", err))
+// plmnEntriesFromConfig converts config PLMN entries to encoder entries
+func plmnEntriesFromConfig(list []HPLMNConfig) []HPLMNEntry {
+	entries := make([]HPLMNEntry, 0, len(list))
+	for _, h := range list {
+		actStr := ""
+		for i, a := range h.ACT {
+			if i > 0 {
+				actStr += ","
 			}
+			actStr += a
 		}
-	}
-
-	if len(errors) > 0 {
-		return fmt.Errorf("some operations failed:\n  - %s",
-			joinErrors(errors))
-	}
-
-	return nil
+		act := ParseACTString(actStr)
+		entries = append(entries, HPLMNEntry{
+			MCC: h.MCC,
+			MNC: h.MNC,
+			ACT: act,
+		})
+	}
+	return entries
 }
 
-func applyUSIMServices(reader *card.Reader, services *ServicesConfig) error {
+// usimServiceFlags maps the USIM entries of a services config to UST service numbers
+func usimServiceFlags(services *ServicesConfig) map[int]bool {
 	ustChanges := make(map[int]bool)
 
 	if services.VoLTE != nil {
@@ -645,54 +798,25 @@ func applyUSIMServices(reader *card.Reader, services *ServicesConfig) error {
 	if services.SUCICalc != nil {
 		ustChanges[UST_SUCI_CALCULATION] = *services.SUCICalc
 	}
-
-	if len(ustChanges) > 0 {
-		if err := SetUSIMServices(reader, ustChanges); err != nil {
-			return err
-		}
-		fmt.Println("✓ USIM services updated")
-	}
-
-	return nil
+	return ustChanges
 }
 
-func applyISIMConfig(reader *card.Reader, isim *ISIMConfig) error {
-	if isim.IMPI != "" {
-		if err := WriteIMPI(reader, isim.IMPI); err != nil {
-			return fmt.Errorf("IMPI: %w", err)
-		}
-		fmt.Println("✓ IMPI written successfully")
-	}
-
-	if len(isim.IMPU) > 0 {
-		for i, impu := range isim.IMPU {
-			if err := WriteIMPURecord(reader, impu, byte(i+1)); err != nil {
-				return fmt.Errorf("IMPU[%d]: %w", i, err)
-			}
-			fmt.Printf("✓ IMPU %d written successfully\n", i+1)
-		}
-	}
-
-	if isim.Domain != "" {
-		if err := WriteDomain(reader, isim.Domain); err != nil {
-			return fmt.Errorf("Domain: %w", err)
-		}
-		fmt.Println("✓ Domain written successfully")
+func applyUSIMServices(reader *card.Reader, services *ServicesConfig, current map[int]bool, report *ApplyReport) {
+	ustChanges := usimServiceFlags(services)
+	if len(ustChanges) == 0 {
+		return
 	}
-
-	if len(isim.PCSCF) > 0 {
-		for i, pcscf := range isim.PCSCF {
-			if err := WritePCSCFRecord(reader, pcscf, byte(i+1)); err != nil {
-				return fmt.Errorf("P-CSCF[%d]: %w", i, err)
-			}
-			fmt.Printf("✓ P-CSCF %d written successfully\n", i+1)
-		}
+	if sameServices(current, ustChanges) {
+		report.unchanged("USIM services")
+	} else if err := SetUSIMServices(reader, ustChanges); err != nil {
+		report.failed(reader, "USIM services", err)
+	} else {
+		report.applied("USIM services", fmt.Sprintf("%d flags", len(ustChanges)))
 	}
-
-	return nil
 }
 
-func applyISIMServices(reader *card.Reader, services *ServicesConfig) error {
+// isimServiceFlags maps the ISIM entries of a services config to IST service numbers
+func isimServiceFlags(services *ServicesConfig) map[int]bool {
 	istChanges := make(map[int]bool)
 
 	if services.ISIMPcscf != nil {
@@ -710,15 +834,21 @@ func applyISIMServices(reader *card.Reader, services *ServicesConfig) error {
 	if services.ISIMHttpDigest != nil {
 		istChanges[IST_HTTP_DIGEST] = *services.ISIMHttpDigest
 	}
+	return istChanges
+}
 
-	if len(istChanges) > 0 {
-		if err := SetISIMServices(reader, istChanges); err != nil {
-			return err
-		}
-		fmt.Println("✓ ISIM services updated")
+func applyISIMServices(reader *card.Reader, services *ServicesConfig, current map[int]bool, report *ApplyReport) {
+	istChanges := isimServiceFlags(services)
+	if len(istChanges) == 0 {
+		return
+	}
+	if sameServices(current, istChanges) {
+		report.unchanged("ISIM services")
+	} else if err := SetISIMServices(reader, istChanges); err != nil {
+		report.failed(reader, "ISIM services", err)
+	} else {
+		report.applied("ISIM services", fmt.Sprintf("%d flags", len(istChanges)))
 	}
-
-	return nil
 }
 
 func joinErrors(errors []string) string {
@@ -784,6 +914,9 @@ func ExportToConfig(usimData *USIMData, isimData *ISIMData) *SIMConfig {
 		// Writable identity fields
 		config.IMSI = usimData.IMSI
 		config.SPN = usimData.SPN
+		config.PSISMSC = usimData.PSISMSC
+		config.SMS = ExportSMSConfig(usimData.SMSP)
+		config.Voicemail = usimData.Voicemail
 		config.MCC = usimData.MCC
 		config.MNC = usimData.MNC
 
@@ -878,6 +1011,10 @@ func ExportToConfig(usimData *USIMData, isimData *ISIMData) *SIMConfig {
 			config.Services.NSSAI5G = &nssai
 			config.Services.SUCICalc = &suci
 		}
+
+		config.Files = ExportFileStatuses(usimData.Files)
+		config.exportServiceTable("UST", usimData.RawFiles["EF_UST"])
+		config.exportServiceTable("EST", usimData.RawFiles["EF_EST"])
 	}
 
 	if isimData != nil && isimData.Available {
@@ -886,6 +1023,7 @@ func ExportToConfig(usimData *USIMData, isimData *ISIMData) *SIMConfig {
 			IMPU:   isimData.IMPU,
 			Domain: isimData.Domain,
 			PCSCF:  isimData.PCSCF,
+			Files:  ExportFileStatuses(isimData.Files),
 		}
 
 		// ISIM services
@@ -903,82 +1041,128 @@ func ExportToConfig(usimData *USIMData, isimData *ISIMData) *SIMConfig {
 		config.Services.ISIMVoiceDomainPref = &voicePref
 		config.Services.ISIMGBA = &isimGba
 		config.Services.ISIMHttpDigest = &httpDigest
+		config.exportServiceTable("IST", isimData.RawFiles["EF_IST"])
 	}
 
 	return config
 }
 
-// plmnActToStrings converts ACT bitmask to string slice
-func plmnActToStrings(act uint16) []string {
-	var result []string
-	if act&0x8000 != 0 {
-		result = append(result, "utran")
+// exportServiceTable stores a raw service table (UST, EST, IST) in ServiceTables
+func (c *SIMConfig) exportServiceTable(table string, raw []byte) {
+	if len(raw) == 0 {
+		return
 	}
-	if act&0x4000 != 0 {
-		result = append(result, "eutran")
+	if c.ServiceTables == nil {
+		c.ServiceTables = &ServiceTablesExport{}
 	}
-	if act&0x0080 != 0 {
-		result = append(result, "gsm")
+	value := strings.ToUpper(hex.EncodeToString(raw))
+	switch table {
+	case "UST":
+		c.ServiceTables.UST = value
+	case "EST":
+		c.ServiceTables.EST = value
+	case "IST":
+		c.ServiceTables.IST = value
 	}
-	if act&0x0800 != 0 {
-		result = append(result, "nr")
+}
+
+// deriveConfigKeys runs DeriveKeys for the card: the ICCID from the config (when it is
+// written) or the card, the algorithm from the config or the driver
+func deriveConfigKeys(reader *card.Reader, config *SIMConfig, drv ProgrammableDriver) error {
+	iccid := config.ICCID
+	if iccid == "" {
+		var err error
+		if iccid, err = ReadICCIDQuick(reader); err != nil {
+			return fmt.Errorf("ICCID needed for k_derivation: %w", err)
+		}
 	}
-	if act&0x0400 != 0 {
-		result = append(result, "ngran")
+	cardAlgorithm := ""
+	if config.Algorithm == "" && drv != nil {
+		cardAlgorithm, _ = drv.GetAlgorithmType(reader)
 	}
-	return result
+	_, err := config.DeriveKeys(iccid, cardAlgorithm)
+	return err
 }
 
 // applyProgrammableFields applies programmable card fields from SIMConfig
-// drv can be nil if no programmable card detected (operations will be skipped)
-func applyProgrammableFields(reader *card.Reader, config *SIMConfig, drv ProgrammableDriver, dryRun, force bool) error {
+// drv can be nil if no programmable card detected (operations will be skipped).
+// Secrets cannot be read back, so these items are always written; the first
+// failure stops the remaining programmable operations.
+func applyProgrammableFields(reader *card.Reader, config *SIMConfig, drv ProgrammableDriver, dryRun, force bool, report *ApplyReport) {
 	// Skip if no programmable fields are set
 	if !config.HasProgrammableFields() && config.ICCID == "" && config.MSISDN == "" && config.ACCHex == "" {
-		return nil
+		return
 	}
 
 	// Check if driver is available for operations that require it
 	requiresDriver := config.Ki != "" || config.OP != "" || config.OPc != "" ||
-		config.PIN1 != "" || config.PIN2 != "" || config.Algorithm != ""
+		config.PIN1 != "" || config.PIN2 != "" || config.Algorithm != "" ||
+		config.Programmable.hasCardSettings()
 
 	if requiresDriver && drv == nil && !force {
-		return fmt.Errorf("no programmable card driver detected")
+		report.failed(nil, "Programmable", fmt.Errorf("no programmable card driver detected"))
+		return
 	}
 
-	// Write Ki
-	if config.Ki != "" && drv != nil {
+	// step runs one programmable write, recording the outcome; returns false on failure
+	step := func(name, detail string, write func() error) bool {
 		if dryRun {
-			fmt.Printf("[DRY RUN] Would write Ki: %s\n", config.Ki)
-		} else {
+			report.dryRun(name, detail)
+			return true
+		}
+		if err := write(); err != nil {
+			report.failed(reader, name, err)
+			return false
+		}
+		report.applied(name, "")
+		return true
+	}
+
+	// Drivers with a key file view write algorithm, Ki and OP/OPc in one update and verify by AUTHENTICATE
+	authFile, useAuthFile := drv.(AuthKeyFileProvider)
+	useAuthFile = useAuthFile && HasCapability(drv, CapAuthKeyFile)
+	if useAuthFile && (config.Ki != "" || config.OP != "" || config.OPc != "" || config.Algorithm != "") {
+		if !applyAuthKeyFile(reader, config, authFile, dryRun, report) {
+			return
+		}
+	}
+
+	// Derived keys never appear in the report
+	kiDetail, opcDetail := config.Ki, config.OPc
+	if config.derived != nil {
+		kiDetail, opcDetail = "derived from ICCID", "computed from OP and the derived Ki"
+	}
+
+	// Write Ki
+	if config.Ki != "" && drv != nil && !useAuthFile {
+		ok := step("Ki", kiDetail, func() error {
 			kiBytes, err := algorithms.ValidateKi(config.Ki)
 			if err != nil {
 				return err
 			}
-			if err := WriteKi(reader, drv, kiBytes); err != nil {
-				return fmt.Errorf("failed to write Ki: %w", err)
-			}
-			fmt.Println("✓ Ki written successfully")
+			return WriteKi(reader, drv, kiBytes)
+		})
+		if !ok {
+			return
 		}
 	}
 
 	// Write OPc (or compute from OP)
-	if config.OPc != "" && drv != nil {
-		if dryRun {
-			fmt.Printf("[DRY RUN] Would write OPc: %s\n", config.OPc)
-		} else {
+	if useAuthFile {
+		// Written with the key file above
+	} else if config.OPc != "" && drv != nil {
+		ok := step("OPc", opcDetail, func() error {
 			opcBytes, err := algorithms.ValidateOPc(config.OPc)
 			if err != nil {
 				return err
 			}
-			if err := WriteOPc(reader, drv, opcBytes); err != nil {
-				return fmt.Errorf("failed to write OPc: %w", err)
-			}
-			fmt.Println("✓ OPc written successfully")
+			return WriteOPc(reader, drv, opcBytes)
+		})
+		if !ok {
+			return
 		}
 	} else if config.OP != "" && drv != nil {
-		if dryRun {
-			fmt.Printf("[DRY RUN] Would compute and write OPc from OP: %s\n", config.OP)
-		} else {
+		ok := step("OPc (from OP)", config.OP, func() error {
 			if config.Ki == "" {
 				return fmt.Errorf("Ki must be provided to compute OPc from OP")
 			}
@@ -990,97 +1174,75 @@ func applyProgrammableFields(reader *card.Reader, config *SIMConfig, drv Program
 			if err != nil {
 				return fmt.Errorf("invalid OP: %w", err)
 			}
-			if err := ComputeAndWriteOPc(reader, drv, kiBytes, opBytes); err != nil {
-				return fmt.Errorf("failed to compute and write OPc: %w", err)
-			}
-			fmt.Println("✓ OPc computed and written successfully")
+			return ComputeAndWriteOPc(reader, drv, kiBytes, opBytes)
+		})
+		if !ok {
+			return
 		}
 	}
 
 	// Write Milenage R and C constants
 	if (config.Ki != "" || config.OPc != "" || config.OP != "") && drv != nil {
-		if dryRun {
-			fmt.Println("[DRY RUN] Would write Milenage R and C constants")
-		} else {
-			if err := WriteMilenageRAndC(reader, drv); err != nil {
-				return fmt.Errorf("failed to write Milenage R/C: %w", err)
-			}
-			fmt.Println("✓ Milenage R and C constants written successfully")
+		ok := step("Milenage R/C", "default constants", func() error {
+			return WriteMilenageRAndC(reader, drv)
+		})
+		if !ok {
+			return
 		}
 	}
 
 	// Set algorithm type
-	if config.Algorithm != "" && drv != nil {
-		if dryRun {
-			fmt.Printf("[DRY RUN] Would set algorithm type: %s\n", config.Algorithm)
-		} else {
-			if err := SetMilenageAlgorithmType(reader, drv, config.Algorithm); err != nil {
-				return fmt.Errorf("failed to set algorithm type: %w", err)
-			}
-			fmt.Printf("✓ Algorithm type set to: %s\n", config.Algorithm)
+	if config.Algorithm != "" && drv != nil && !useAuthFile {
+		ok := step("Algorithm", config.Algorithm, func() error {
+			return SetMilenageAlgorithmType(reader, drv, config.Algorithm)
+		})
+		if !ok {
+			return
 		}
 	}
 
 	// Write ICCID (requires programmable card)
 	if config.ICCID != "" && drv != nil {
-		if dryRun {
-			fmt.Printf("[DRY RUN] Would write ICCID: %s\n", config.ICCID)
-		} else {
-			if err := WriteICCID(reader, drv, config.ICCID); err != nil {
-				return fmt.Errorf("failed to write ICCID: %w", err)
-			}
-			fmt.Println("✓ ICCID written successfully")
+		ok := step("ICCID", config.ICCID, func() error {
+			return WriteICCID(reader, drv, config.ICCID)
+		})
+		if !ok {
+			return
 		}
 	}
 
-	// Write MSISDN
+	// Write MSISDN (driver method for programmable cards, generic write otherwise)
 	if config.MSISDN != "" {
-		if drv != nil {
-			// Use driver method for programmable cards
-			if dryRun {
-				fmt.Printf("[DRY RUN] Would write MSISDN: %s\n", config.MSISDN)
-			} else {
-				if err := WriteMSISDN(reader, drv, config.MSISDN); err != nil {
-					return fmt.Errorf("failed to write MSISDN: %w", err)
-				}
-				fmt.Println("✓ MSISDN written successfully")
-			}
-		} else {
-			// Try generic MSISDN write for standard cards
-			if dryRun {
-				fmt.Printf("[DRY RUN] Would write MSISDN: %s\n", config.MSISDN)
-			} else {
-				if err := WriteMSISDNGeneric(reader, config.MSISDN); err != nil {
-					return fmt.Errorf("failed to write MSISDN: %w", err)
-				}
-				fmt.Println("✓ MSISDN written successfully")
+		ok := step("MSISDN", config.MSISDN, func() error {
+			if drv != nil {
+				return WriteMSISDN(reader, drv, config.MSISDN)
 			}
+			return WriteMSISDNGeneric(reader, config.MSISDN)
+		})
+		if !ok {
+			return
 		}
 	}
 
 	// Write ACC
 	if config.ACCHex != "" && drv != nil {
-		if dryRun {
-			fmt.Printf("[DRY RUN] Would write ACC: %s\n", config.ACCHex)
-		} else {
-			if err := WriteACC(reader, drv, config.ACCHex); err != nil {
-				return fmt.Errorf("failed to write ACC: %w", err)
-			}
-			fmt.Println("✓ ACC written successfully")
+		ok := step("ACC", config.ACCHex, func() error {
+			return WriteACC(reader, drv, config.ACCHex)
+		})
+		if !ok {
+			return
 		}
 	}
 
 	// Write PIN/PUK codes
 	if (config.PIN1 != "" || config.PIN2 != "") && drv != nil {
-		if dryRun {
-			fmt.Println("[DRY RUN] Would write PIN/PUK codes")
-		} else {
-			if err := WritePINs(reader, drv, config.PIN1, config.PUK1, config.PIN2, config.PUK2); err != nil {
-				return fmt.Errorf("failed to write PIN/PUK codes: %w", err)
-			}
-			fmt.Println("✓ PIN/PUK codes written successfully")
-		}
+		step("PIN/PUK codes", "PIN1/PUK1/PIN2/PUK2", func() error {
+			return WritePINs(reader, drv, config.PIN1, config.PUK1, config.PIN2, config.PUK2)
+		})
 	}
 
-	return nil
+	// Card-specific settings: SQN parameters, OTA keys
+	if config.Programmable.hasCardSettings() && drv != nil {
+		applyProgrammableExtras(reader, config.Programmable, drv, dryRun, report)
+	}
 }
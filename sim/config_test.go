@@ -291,10 +291,10 @@ func TestPlmnActToStrings(t *testing.T) {
 		{0x8000, []string{"utran"}},
 		{0x4000, []string{"eutran"}},
 		{0x0080, []string{"gsm"}},
-		{0x0800, []string{"nr"}},
-		{0x0400, []string{"ngran"}},
+		{0x0800, []string{"ngran"}},
+		{0x0400, []string{"sat-ngran"}},
 		{0xC080, []string{"utran", "eutran", "gsm"}},
-		{0xCC80, []string{"utran", "eutran", "gsm", "nr", "ngran"}},
+		{0xCC80, []string{"utran", "eutran", "ngran", "sat-ngran", "gsm"}},
 		{0x0000, nil},
 	}
 
@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"sim_reader/dictionaries"
+	"sim_reader/textcodec"
 	"strings"
 )
 
@@ -80,16 +81,17 @@ func DecodeSPN(data []byte) string {
 	if len(data) < 2 {
 		return ""
 	}
-	// First byte is display condition, rest is the name
+	// First byte is display condition, rest is the name (alpha identifier coding)
 	name := data[1:]
-	// Find null terminator or 0xFF padding
-	for i, b := range name {
-		if b == 0xFF || b == 0x00 {
-			name = name[:i]
-			break
+	if name[0] < 0x80 {
+		// Some cards pad a GSM coded name with 00 instead of FF
+		end := len(name)
+		for end > 0 && (name[end-1] == 0xFF || name[end-1] == 0x00) {
+			end--
 		}
+		name = name[:end]
 	}
-	return string(name)
+	return textcodec.DecodeAlpha(name)
 }
 
 // DecodePLMN decodes a 3-byte PLMN (MCC-MNC)
@@ -136,6 +138,33 @@ func DecodePLMNList(data []byte) []string {
 	return plmns
 }
 
+// PLMN is a network identity (MCC + MNC)
+type PLMN struct {
+	MCC string
+	MNC string
+}
+
+// String returns the PLMN as MCC:MNC
+func (p PLMN) String() string {
+	return p.MCC + ":" + p.MNC
+}
+
+// DecodeFPLMN decodes EF_FPLMN into separate MCC/MNC entries, skipping empty slots
+func DecodeFPLMN(data []byte) []PLMN {
+	var result []PLMN
+	for i := 0; i+3 <= len(data); i += 3 {
+		chunk := data[i : i+3]
+		if chunk[0] == 0xFF && chunk[1] == 0xFF && chunk[2] == 0xFF {
+			continue
+		}
+		mcc, mnc := DecodePLMN(chunk)
+		if mcc != "" && mcc != "fff" {
+			result = append(result, PLMN{MCC: mcc, MNC: mnc})
+		}
+	}
+	return result
+}
+
 // DecodePLMNwACT decodes PLMN with Access Technology (5 bytes each)
 func DecodePLMNwACT(data []byte) []PLMNwACT {
 	var result []PLMNwACT
@@ -169,36 +198,6 @@ type PLMNwACT struct {
 	Tech []string
 }
 
-// DecodeACT decodes Access Technology bits
-func DecodeACT(act uint16) []string {
-	var techs []string
-	if act&0x8000 != 0 {
-		techs = append(techs, "UTRAN")
-	}
-	if act&0x4000 != 0 {
-		techs = append(techs, "E-UTRAN")
-	}
-	if act&0x0080 != 0 {
-		techs = append(techs, "GSM")
-	}
-	if act&0x0040 != 0 {
-		techs = append(techs, "GSM COMPACT")
-	}
-	if act&0x0020 != 0 {
-		techs = append(techs, "cdma2000 HRPD")
-	}
-	if act&0x0010 != 0 {
-		techs = append(techs, "cdma2000 1xRTT")
-	}
-	if act&0x0008 != 0 {
-		techs = append(techs, "NR") // 5G
-	}
-	if act&0x0004 != 0 {
-		techs = append(techs, "NG-RAN") // 5G SA
-	}
-	return techs
-}
-
 // DecodeUST decodes USIM Service Table
 func DecodeUST(data []byte) map[int]bool {
 	services := make(map[int]bool)
@@ -308,6 +307,38 @@ func DecodeAD(data []byte) AdminData {
 	return ad
 }
 
+// SplitIMSI splits an IMSI into MCC and MNC using the MNC length from EF_AD
+// (2 unless EF_AD says 3)
+func SplitIMSI(imsi string, mncLength int) (mcc, mnc string) {
+	if mncLength != 3 {
+		mncLength = 2
+	}
+	if len(imsi) < 3+mncLength {
+		return "", ""
+	}
+	return imsi[:3], imsi[3 : 3+mncLength]
+}
+
+// CheckMNCLength compares the MNC length in EF_AD with the home network entries of EF_HPLMNwACT
+// (same MCC as the IMSI) and describes the first mismatch ("" if consistent or unknown)
+func CheckMNCLength(mncLength int, imsi string, hplmn []PLMNwACT) string {
+	if mncLength != 2 && mncLength != 3 || len(imsi) < 3 {
+		return ""
+	}
+	for _, p := range hplmn {
+		if p.MCC != imsi[:3] || len(p.MNC) == mncLength {
+			continue
+		}
+		encoding := "2-digit (F-padded)"
+		if len(p.MNC) == 3 {
+			encoding = "3-digit"
+		}
+		return fmt.Sprintf("EF_AD MNC length is %d but EF_HPLMNwACT encodes %s/%s with a %s MNC",
+			mncLength, p.MCC, p.MNC, encoding)
+	}
+	return ""
+}
+
 // DecodeACC decodes Access Control Class
 func DecodeACC(data []byte) []int {
 	if len(data) < 2 {
@@ -364,17 +395,21 @@ func decodeTLVString(data []byte) string {
 		if idx+1 >= len(data) {
 			break
 		}
-		length := int(data[idx+1])
-		if idx+2+length > len(data) {
+		length, hdr := int(data[idx+1]), 2
+		if length == 0x81 && idx+2 < len(data) {
+			// BER long form length
+			length, hdr = int(data[idx+2]), 3
+		}
+		if idx+hdr+length > len(data) {
 			break
 		}
-		value := data[idx+2 : idx+2+length]
+		value := data[idx+hdr : idx+hdr+length]
 
 		if tag == 0x80 {
 			// String value
 			return strings.TrimRight(string(value), "\x00\xFF")
 		}
-		idx += 2 + length
+		idx += hdr + length
 	}
 
 	// If no TLV found, try direct decode
@@ -2,7 +2,10 @@ package sim
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+
+	"sim_reader/card"
 )
 
 // TestCard represents a test case from a real SIM card
@@ -91,7 +94,7 @@ var testCards = []TestCard{
 		USTServices: []int{2, 3, 4, 5, 6, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 24, 25, 27, 28, 29, 32, 33, 34, 35, 38, 39, 40, 42, 43, 44, 45, 46, 51, 60, 81, 82, 83, 84, 85, 86, 87, 88, 89, 90, 93, 94, 122, 123},
 		RawHPLMN:    []byte{0x52, 0xF0, 0x88, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00},
 		HPLMN: []PLMNwACT{
-			{MCC: "250", MNC: "88", ACT: 0xFFFF, Tech: []string{"UTRAN", "E-UTRAN", "GSM", "GSM COMPACT", "cdma2000 HRPD", "cdma2000 1xRTT", "NR", "NG-RAN"}},
+			{MCC: "250", MNC: "88", ACT: 0xFFFF, Tech: []string{"UTRAN", "E-UTRAN WB-S1", "E-UTRAN NB-S1", "NG-RAN", "satellite NG-RAN", "satellite E-UTRAN", "GSM", "GSM COMPACT", "cdma2000 HRPD", "cdma2000 1xRTT", "0x010F"}},
 		},
 		RawFPLMN: []byte{0x52, 0xF0, 0x02, 0x52, 0xF0, 0x99, 0x52, 0xF0, 0x20, 0x52, 0xF0, 0x10},
 		FPLMN:    []string{"25020", "25099", "25002", "25001"},
@@ -191,6 +194,90 @@ func TestDecodePLMNwACT(t *testing.T) {
 	}
 }
 
+func TestSplitIMSI(t *testing.T) {
+	tests := []struct {
+		name      string
+		imsi      string
+		mncLength int
+		mcc, mnc  string
+	}{
+		{"2-digit MNC", "250880000000001", 2, "250", "88"},
+		{"3-digit MNC", "310410123456789", 3, "310", "410"},
+		{"3-digit MNC with leading zero", "310010123456789", 3, "310", "010"},
+		{"MNC length unset", "310410123456789", 0, "310", "41"},
+		{"Too short", "3104", 3, "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mcc, mnc := SplitIMSI(tc.imsi, tc.mncLength)
+			if mcc != tc.mcc || mnc != tc.mnc {
+				t.Errorf("SplitIMSI() = %s/%s, want %s/%s", mcc, mnc, tc.mcc, tc.mnc)
+			}
+		})
+	}
+}
+
+func TestCheckMNCLength(t *testing.T) {
+	hplmn2 := []PLMNwACT{{MCC: "310", MNC: "41"}}
+	hplmn3 := []PLMNwACT{{MCC: "310", MNC: "410"}}
+
+	tests := []struct {
+		name      string
+		mncLength int
+		imsi      string
+		hplmn     []PLMNwACT
+		want      string
+	}{
+		{"3 and 3-digit HPLMN", 3, "310410123456789", hplmn3, ""},
+		{"2 and 2-digit HPLMN", 2, "310410123456789", hplmn2, ""},
+		{"AD 3, HPLMN F-padded", 3, "310410123456789", hplmn2, "F-padded"},
+		{"AD 2, HPLMN 3-digit", 2, "310410123456789", hplmn3, "3-digit"},
+		{"Other MCC ignored", 3, "250880000000001", hplmn2, ""},
+		{"AD without MNC length", 0, "310410123456789", hplmn2, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := CheckMNCLength(tc.mncLength, tc.imsi, tc.hplmn)
+			if (tc.want == "") != (got == "") || !strings.Contains(got, tc.want) {
+				t.Errorf("CheckMNCLength() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadUSIM_ThreeDigitMNC(t *testing.T) {
+	imsi, _ := EncodeIMSI("310410123456789")
+	hplmn, _ := EncodePLMN("310", "41") // F-padded: inconsistent with EF_AD
+
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, imsi)
+	usim.AddEF(0x6FAD, []byte{0x00, 0x00, 0x00, 0x03})
+	usim.AddEF(0x6F62, append(hplmn, 0x40, 0x00))
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	data, err := ReadUSIM(reader)
+	if err != nil {
+		t.Fatalf("ReadUSIM() error = %v", err)
+	}
+	if data.MCC != "310" || data.MNC != "410" {
+		t.Errorf("MCC/MNC = %s/%s, want 310/410", data.MCC, data.MNC)
+	}
+	if len(data.Warnings) != 1 || !strings.Contains(data.Warnings[0], "EF_AD MNC length is 3") {
+		t.Errorf("Warnings = %q, want the MNC length mismatch", data.Warnings)
+	}
+	if config := ExportToConfig(data, nil); config.MCC != "310" || config.MNC != "410" {
+		t.Errorf("exported mcc/mnc = %s/%s, want 310/410", config.MCC, config.MNC)
+	}
+
+	mcc, mnc, err := ReadHomePLMN(reader)
+	if err != nil || mcc != "310" || mnc != "410" {
+		t.Errorf("ReadHomePLMN() = %s/%s, %v, want 310/410", mcc, mnc, err)
+	}
+}
+
 // ============ ATR IDENTIFICATION TESTS ============
 
 func TestIdentifyCardByATR(t *testing.T) {
@@ -0,0 +1,106 @@
+package sim
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"sim_reader/card"
+)
+
+// Cards from the GSM era have no EF_DIR. Some of them still carry a USIM or ISIM that
+// answers SELECT by AID; the others are classic SIMs with DF_GSM only, where every
+// USIM/ISIM read would fail.
+
+// DIRProbe is the SELECT by AID of the well-known UICC applications on a card without
+// EF_DIR (see DetectApplicationAIDs)
+type DIRProbe struct {
+	USIM bool `json:"usim"`
+	ISIM bool `json:"isim"`
+	CSIM bool `json:"csim"`
+}
+
+// DetectedDIRProbe is set when EF_DIR was absent at the last application detection
+var DetectedDIRProbe *DIRProbe
+
+// ErrClassicSIM is returned by USIM and ISIM reads and selections on a classic SIM
+var ErrClassicSIM = errors.New("classic SIM: no EF_DIR and no USIM/ISIM application")
+
+// ClassicSIM reports whether no UICC application answered: the card is a GSM SIM
+func (p *DIRProbe) ClassicSIM() bool {
+	return !p.USIM && !p.ISIM && !p.CSIM
+}
+
+// String summarizes the probe, e.g. "EF_DIR: absent; probed AIDs: USIM no, ISIM no,
+// CSIM no → classic SIM"
+func (p *DIRProbe) String() string {
+	yesNo := func(ok bool) string {
+		if ok {
+			return "yes"
+		}
+		return "no"
+	}
+	s := "EF_DIR: absent; probed AIDs: USIM " + yesNo(p.USIM) + ", ISIM " + yesNo(p.ISIM) + ", CSIM " + yesNo(p.CSIM)
+	if p.ClassicSIM() {
+		s += " → classic SIM"
+	}
+	return s
+}
+
+// IsClassicSIM reports whether the last application detection found a card without
+// EF_DIR and without UICC applications. USIM and ISIM reads are pointless on such a card.
+func IsClassicSIM() bool {
+	return DetectedDIRProbe != nil && DetectedDIRProbe.ClassicSIM()
+}
+
+// probeWithoutEFDIR selects the USIM, ISIM and CSIM by their well-known AIDs (partial
+// DF name) and records the full AIDs of the applications that answer as detected.
+// GSM-class cards cannot select by AID and are classic SIMs without sending anything.
+// The MF is selected again afterwards.
+func probeWithoutEFDIR(reader *card.Reader) *DIRProbe {
+	probe := &DIRProbe{}
+	if UseGSMCommands {
+		return probe
+	}
+
+	// The DF name of the response is the full AID (RID, application code and provider part)
+	selectAID := func(aid []byte) ([]byte, bool) {
+		p := probeApplication(reader, aid)
+		if !p.Selectable {
+			return nil, false
+		}
+		if full, err := hex.DecodeString(p.DFName); err == nil && len(full) >= len(aid) {
+			return full, true
+		}
+		return aid, true
+	}
+
+	if aid, ok := selectAID(AID_USIM); ok {
+		probe.USIM = true
+		DetectedUSIM_AID = aid
+	}
+	if aid, ok := selectAID(AID_ISIM); ok {
+		probe.ISIM = true
+		DetectedISIMApps = []ISIMApp{{Index: 1, AID: aid, Label: "ISIM"}}
+		if SelectedISIMIndex == 0 {
+			DetectedISIM_AID = aid
+		}
+	}
+	_, probe.CSIM = selectAID(AID_CSIM)
+
+	reader.Select([]byte{0x3F, 0x00})
+	applyAIDOverrides()
+	return probe
+}
+
+// efDIRAbsent reports whether application detection should fall back to probing: EF_DIR
+// could not be read, no --usim-aid / --isim-aid was given and the card is not a
+// proprietary card selected by DF path
+func efDIRAbsent(reader *card.Reader, apps []ApplicationInfo, rawDir []byte) bool {
+	return len(apps) == 0 && rawDir == nil && len(OverrideUSIM_AID) == 0 && len(OverrideISIM_AID) == 0 &&
+		!IsProprietaryCard(reader.ATRHex())
+}
+
+// ReadGSM reads IMSI, HPLMN and SPN from DF_GSM, the data a classic SIM holds
+func ReadGSM(reader *card.Reader) (*GSMData, error) {
+	return readGSMSIMWithFallback(reader, UseGSMCommands)
+}
@@ -0,0 +1,99 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ EF_DIR-LESS PROBE TESTS ============
+
+// newClassicSIMCard returns the image of a GSM-era SIM: EF_ICCID and DF_GSM with IMSI, AD
+// and SPN, no EF_DIR and no UICC application
+func newClassicSIMCard(t *testing.T) *card.MockCard {
+	t.Helper()
+	imsi, err := EncodeIMSI("250880000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	iccid, err := EncodeICCID("8970188000000000017")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := card.NewMockCard([]byte{0x3B, 0x16, 0x94, 0x71, 0x01, 0x01, 0x05, 0x02, 0x00})
+	m.MF().AddEF(0x2FE2, iccid)
+	gsm := m.MF().AddDF(0x7F20)
+	gsm.AddEF(0x6F07, imsi)
+	gsm.AddEF(0x6FAD, []byte{0x00, 0x00, 0x00, 0x02})
+	gsm.AddEF(0x6F46, append([]byte{0x00, 'O', 'L', 'D'}, bytes.Repeat([]byte{0xFF}, 13)...))
+	return m
+}
+
+func TestDetectApplicationAIDs_ClassicSIM(t *testing.T) {
+	defer resetISIMDetection()
+	m := newClassicSIMCard(t)
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	DetectApplicationAIDs(reader)
+
+	if !IsClassicSIM() {
+		t.Fatalf("DetectedDIRProbe = %+v, want a classic SIM", DetectedDIRProbe)
+	}
+	if got, want := DetectedDIRProbe.String(), "EF_DIR: absent; probed AIDs: USIM no, ISIM no, CSIM no → classic SIM"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if _, err := ReadUSIM(reader); !errors.Is(err, ErrClassicSIM) {
+		t.Errorf("ReadUSIM() error = %v, want ErrClassicSIM", err)
+	}
+	if _, err := ReadISIM(reader); !errors.Is(err, ErrClassicSIM) {
+		t.Errorf("ReadISIM() error = %v, want ErrClassicSIM", err)
+	}
+	gsm, err := ReadGSM(reader)
+	if err != nil || gsm.IMSI != "250880000000001" || gsm.HPLMN != "25088" || gsm.SPN != "OLD" {
+		t.Errorf("ReadGSM() = %+v, %v", gsm, err)
+	}
+}
+
+func TestAnalyzeCard_ClassicSIM(t *testing.T) {
+	defer resetISIMDetection()
+	defer func() { UseGSMCommands = false }()
+	m := newClassicSIMCard(t)
+	info, err := AnalyzeCard(card.NewReaderWithTransport("Mock", m.ATR, m), false)
+	if err != nil {
+		t.Fatalf("AnalyzeCard() error = %v", err)
+	}
+	if info.DIRProbe == nil || !info.DIRProbe.ClassicSIM() {
+		t.Errorf("DIRProbe = %+v, want a classic SIM", info.DIRProbe)
+	}
+	if !info.GSMAvailable || info.ICCID != "8970188000000000017" {
+		t.Errorf("GSMAvailable = %v, ICCID = %q", info.GSMAvailable, info.ICCID)
+	}
+}
+
+func TestDetectApplicationAIDs_ProbedUSIM(t *testing.T) {
+	defer resetISIMDetection()
+	// No EF_DIR, but the USIM and ISIM answer SELECT by their 7-byte AIDs
+	usimAID := append(append([]byte(nil), AID_USIM...), 0xFF, 0x49, 0xFF, 0x05, 0x89)
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(usimAID).AddEF(0x6F07, make([]byte, 9))
+	m.AddADF(AID_ISIM)
+	DetectApplicationAIDs(card.NewReaderWithTransport("Mock", m.ATR, m))
+
+	if DetectedDIRProbe == nil || !DetectedDIRProbe.USIM || !DetectedDIRProbe.ISIM || DetectedDIRProbe.CSIM || IsClassicSIM() {
+		t.Fatalf("DetectedDIRProbe = %+v, want USIM and ISIM", DetectedDIRProbe)
+	}
+	if !bytes.Equal(DetectedUSIM_AID, usimAID) {
+		t.Errorf("DetectedUSIM_AID = %X, want the full AID %X from the DF name", DetectedUSIM_AID, usimAID)
+	}
+	if !bytes.Equal(DetectedISIM_AID, AID_ISIM) || len(DetectedISIMApps) != 1 {
+		t.Errorf("DetectedISIM_AID = %X, apps = %+v", DetectedISIM_AID, DetectedISIMApps)
+	}
+
+	// With EF_DIR the card is not probed
+	m.MF().AddRecordEF(0x2F00, dirRecord(usimAID, "USIM"))
+	DetectApplicationAIDs(card.NewReaderWithTransport("Mock", m.ATR, m))
+	if DetectedDIRProbe != nil {
+		t.Errorf("DetectedDIRProbe = %+v with EF_DIR present", DetectedDIRProbe)
+	}
+}
@@ -0,0 +1,488 @@
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/tlv"
+)
+
+// EF decoders by file. The registry maps an EF of an application to the decoder that
+// interprets its content; it is used by `read --decode-ef` (no card), the raw file table
+// of `read --raw` and the change summary of writes. Decoders are pure: they see only the
+// file content (one record for record files) and never fail, a content they cannot
+// interpret gives empty values.
+
+// Applications of the registry entries
+const (
+	efAppMF    = "MF"
+	efAppUSIM  = "ADF_USIM"
+	efAppISIM  = "ADF_ISIM"
+	efAppFiveG = "DF_5GS"
+)
+
+// DecodedField is one value of a decoded EF, e.g. IMSI: 001010000000001
+type DecodedField struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// DecodedEF is the interpretation of an EF content by DecodeEF
+type DecodedEF struct {
+	File   string         `json:"file"`          // EF name, e.g. EF_IMSI; "EF 1234" for an unknown FID
+	App    string         `json:"app,omitempty"` // MF, ADF_USIM, ADF_ISIM or DF_5GS
+	FID    string         `json:"fid,omitempty"`
+	Raw    string         `json:"raw"`
+	Fields []DecodedField `json:"fields,omitempty"`
+	TLV    string         `json:"tlv,omitempty"` // BER-TLV dump of files without a decoder
+}
+
+// efDecoder is one registry entry
+type efDecoder struct {
+	name     string
+	app      string
+	fid      uint16
+	decode   func([]byte) []DecodedField
+	services map[int]string // service table: changes are listed per service
+}
+
+// efDecoders is the registry, searched in order: an FID or name found in several
+// applications resolves to the first entry (USIM before ISIM)
+var efDecoders = []efDecoder{
+	{name: "EF_ICCID", app: efAppMF, fid: 0x2FE2, decode: decodeICCIDFields},
+	{name: "EF_DIR", app: efAppMF, fid: 0x2F00, decode: decodeDIRFields},
+	{name: "EF_PL", app: efAppMF, fid: 0x2F05, decode: decodeLanguageFields},
+	{name: "EF_ARR", app: efAppMF, fid: 0x2F06, decode: decodeARRFields},
+
+	{name: "EF_IMSI", app: efAppUSIM, fid: 0x6F07, decode: decodeIMSIFields},
+	{name: "EF_MSISDN", app: efAppUSIM, fid: 0x6F40, decode: decodeMSISDNFields},
+	{name: "EF_SPN", app: efAppUSIM, fid: 0x6F46, decode: decodeSPNFields},
+	{name: "EF_AD", app: efAppUSIM, fid: 0x6FAD, decode: decodeADFields},
+	{name: "EF_ACC", app: efAppUSIM, fid: 0x6F78, decode: decodeACCFields},
+	{name: "EF_LI", app: efAppUSIM, fid: 0x6F05, decode: decodeLanguageFields},
+	{name: "EF_ARR", app: efAppUSIM, fid: 0x6F06, decode: decodeARRFields},
+	{name: "EF_UST", app: efAppUSIM, fid: 0x6F38, decode: serviceFields(USTServices), services: USTServices},
+	{name: "EF_EST", app: efAppUSIM, fid: 0x6F56, decode: serviceFields(ESTServices), services: ESTServices},
+	{name: "EF_ACL", app: efAppUSIM, fid: 0x6F57, decode: decodeACLFields},
+	{name: "EF_PLMNwACT", app: efAppUSIM, fid: 0x6F60, decode: decodePLMNwACTFields},
+	{name: "EF_OPLMNwACT", app: efAppUSIM, fid: 0x6F61, decode: decodePLMNwACTFields},
+	{name: "EF_HPLMNwACT", app: efAppUSIM, fid: 0x6F62, decode: decodePLMNwACTFields},
+	{name: "EF_FPLMN", app: efAppUSIM, fid: 0x6F7B, decode: decodeFPLMNFields},
+	{name: "EF_HPPLMN", app: efAppUSIM, fid: 0x6F31, decode: decodeHPPLMNFields},
+	{name: "EF_LOCI", app: efAppUSIM, fid: 0x6F7E, decode: decodeLOCIFields},
+	{name: "EF_PSLOCI", app: efAppUSIM, fid: 0x6F73, decode: decodePSLOCIFields},
+	{name: "EF_PSLOCI", app: efAppUSIM, fid: 0x6FAE, decode: decodePSLOCIFields},
+	{name: "EF_EPSLOCI", app: efAppUSIM, fid: 0x6FE3, decode: decodeEPSLOCIFields},
+	{name: "EF_NASCONFIG", app: efAppUSIM, fid: 0x6FE8, decode: decodeNASConfigFields},
+	{name: "EF_FROMPREFERRED", app: efAppUSIM, fid: 0x6FF7, decode: decodeFromPreferredFields},
+	{name: "EF_KEYS", app: efAppUSIM, fid: 0x6F08, decode: decodeKeysFields},
+	{name: "EF_KEYSPS", app: efAppUSIM, fid: 0x6F09, decode: decodeKeysFields},
+	{name: "EF_ADN", app: efAppUSIM, fid: 0x6F3A, decode: decodeADNFields},
+	{name: "EF_FDN", app: efAppUSIM, fid: 0x6F3B, decode: decodeADNFields},
+	{name: "EF_SMS", app: efAppUSIM, fid: 0x6F3C, decode: decodeSMSFields},
+	{name: "EF_SMSP", app: efAppUSIM, fid: 0x6F42, decode: decodeSMSPFields},
+	{name: "EF_PSISMSC", app: efAppUSIM, fid: 0x6FE5, decode: decodePSISMSCFields},
+	{name: "EF_MBDN", app: efAppUSIM, fid: 0x6FC7, decode: decodeADNFields},
+	{name: "EF_MBI", app: efAppUSIM, fid: 0x6FC9, decode: mailboxFields(DecodeMBI, "record")},
+	{name: "EF_MWIS", app: efAppUSIM, fid: 0x6FCA, decode: mailboxFields(DecodeMWIS, "waiting")},
+
+	{name: "EF_IMPI", app: efAppISIM, fid: 0x6F02, decode: decodeIMPIFields},
+	{name: "EF_DOMAIN", app: efAppISIM, fid: 0x6F03, decode: decodeDomainFields},
+	{name: "EF_IMPU", app: efAppISIM, fid: 0x6F04, decode: decodeIMPUFields},
+	{name: "EF_ARR", app: efAppISIM, fid: 0x6F06, decode: decodeARRFields},
+	{name: "EF_IST", app: efAppISIM, fid: 0x6F07, decode: serviceFields(ISTServices), services: ISTServices},
+	{name: "EF_PCSCF", app: efAppISIM, fid: 0x6F09, decode: decodePCSCFFields},
+	{name: "EF_SMS", app: efAppISIM, fid: 0x6F3C, decode: decodeSMSFields},
+	{name: "EF_SMSP", app: efAppISIM, fid: 0x6F42, decode: decodeSMSPFields},
+	{name: "EF_AD", app: efAppISIM, fid: 0x6FAD, decode: decodeADFields},
+
+	{name: "EF_5GS3GPPNSC", app: efAppFiveG, fid: efFiveGS3GPPNSC, decode: decodeFiveGSNSCFields},
+	{name: "EF_5GSN3GPPNSC", app: efAppFiveG, fid: efFiveGSN3GPPNSC, decode: decodeFiveGSNSCFields},
+	{name: "EF_SUCI_Calc_Info", app: efAppFiveG, fid: efSUCICalcInfo, decode: decodeSUCICalcInfoFields},
+	{name: "EF_OPL5G", app: efAppFiveG, fid: efOPL5G, decode: decodeOPL5GFields},
+	{name: "EF_SOR-CMCI", app: efAppFiveG, fid: efSORCMCI, decode: decodeSORCMCIFields},
+}
+
+// efAppPrefixes are the application prefixes accepted by DecodeEF, e.g. ISIM:6F07
+var efAppPrefixes = map[string]string{
+	"MF":   efAppMF,
+	"USIM": efAppUSIM,
+	"ISIM": efAppISIM,
+	"5GS":  efAppFiveG,
+}
+
+// EFDecoderNames lists the files DecodeEF interprets, e.g. "EF_IMSI (ADF_USIM 6F07)",
+// followed by FCP
+func EFDecoderNames() []string {
+	names := make([]string, 0, len(efDecoders)+1)
+	for _, d := range efDecoders {
+		names = append(names, fmt.Sprintf("%s (%s %04X)", d.name, d.app, d.fid))
+	}
+	return append(names, "FCP (SELECT response)")
+}
+
+// DecodeEF interprets data as the content of the EF named by spec: a name (EF_IMSI,
+// imsi), an FID (6F07) or either with an application prefix (ISIM:6F07, 5GS:4F07), or
+// FCP for a SELECT response. An FID without a decoder is dumped as BER-TLV.
+func DecodeEF(spec string, data []byte) (*DecodedEF, error) {
+	app, file := "", strings.TrimSpace(spec)
+	if i := strings.Index(file, ":"); i >= 0 {
+		var ok bool
+		if app, ok = efAppPrefixes[strings.ToUpper(file[:i])]; !ok {
+			return nil, fmt.Errorf("unknown application %q (MF, USIM, ISIM, 5GS)", file[:i])
+		}
+		file = file[i+1:]
+	}
+	out := &DecodedEF{Raw: fmt.Sprintf("%X", data)}
+
+	if strings.EqualFold(file, "FCP") {
+		out.File = "FCP"
+		out.Fields = decodeFCPFields(data)
+		out.TLV = tlv.Dump(data, tlv.ContextFCP, "  ")
+		return out, nil
+	}
+
+	if fid, ok := parseEFID(file); ok {
+		out.FID = fmt.Sprintf("%04X", fid)
+		if d := findEFDecoder(app, func(d efDecoder) bool { return d.fid == fid }); d != nil {
+			out.File, out.App, out.Fields = d.name, d.app, d.decode(data)
+			return out, nil
+		}
+		out.File, out.App = fmt.Sprintf("EF %04X", fid), app
+		out.TLV = tlv.Dump(data, tlv.ContextISO, "  ")
+		return out, nil
+	}
+
+	d := findEFDecoder(app, func(d efDecoder) bool { return efNameMatches(d.name, file) })
+	if d == nil {
+		return nil, fmt.Errorf("unknown EF %q: use a file name such as EF_IMSI or a hex FID", spec)
+	}
+	out.File, out.App, out.FID, out.Fields = d.name, d.app, fmt.Sprintf("%04X", d.fid), d.decode(data)
+	return out, nil
+}
+
+// DecodeFile interprets the content of the EF name read from app (ADF_USIM, ADF_ISIM);
+// nil if the file has no decoder. Files of the MF and DF_5GS are found from the USIM.
+func DecodeFile(app, name string, data []byte) []DecodedField {
+	match := func(d efDecoder) bool { return d.name == name }
+	d := findEFDecoder(app, match)
+	if d == nil && app == efAppUSIM {
+		d = findEFDecoder("", match)
+	}
+	if d == nil {
+		return nil
+	}
+	return d.decode(data)
+}
+
+// FormatDecodedFields joins fields as "label: value" with sep, skipping empty values
+func FormatDecodedFields(fields []DecodedField, sep string) string {
+	var parts []string
+	for _, f := range fields {
+		if f.Value != "" {
+			parts = append(parts, f.Label+": "+f.Value)
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// findEFDecoder returns the first entry of app (any application for "") that matches
+func findEFDecoder(app string, match func(efDecoder) bool) *efDecoder {
+	for i, d := range efDecoders {
+		if (app == "" || d.app == app) && match(d) {
+			return &efDecoders[i]
+		}
+	}
+	return nil
+}
+
+// changeDecoder returns the decoder for a write to fid: ISIM files below ADF_ISIM, USIM
+// and MF files otherwise (writes through a DF_GSM path are decoded as USIM files)
+func changeDecoder(app string, fid uint16) *efDecoder {
+	match := func(d efDecoder) bool { return d.fid == fid }
+	if app == efAppISIM {
+		return findEFDecoder(efAppISIM, match)
+	}
+	if d := findEFDecoder(efAppUSIM, match); d != nil {
+		return d
+	}
+	return findEFDecoder(efAppMF, match)
+}
+
+// parseEFID parses a 4 digit hex FID, with or without 0x
+func parseEFID(s string) (uint16, bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s) != 4 {
+		return 0, false
+	}
+	fid, err := strconv.ParseUint(s, 16, 16)
+	return uint16(fid), err == nil
+}
+
+// efNameMatches compares an EF name case-insensitively, with the EF_ prefix optional
+func efNameMatches(name, s string) bool {
+	return strings.EqualFold(name, s) || strings.EqualFold(strings.TrimPrefix(name, "EF_"), s)
+}
+
+// field returns a one-field decoding
+func field(label, value string) []DecodedField {
+	return []DecodedField{{label, value}}
+}
+
+func decodeICCIDFields(data []byte) []DecodedField {
+	return field("ICCID", DecodeICCID(data))
+}
+
+func decodeDIRFields(data []byte) []DecodedField {
+	rec := parseEFDIRRecord(1, data)
+	return []DecodedField{{"AID", rec.AID}, {"Label", rec.Label}, {"Type", rec.Type}, {"Issue", rec.Issue}}
+}
+
+func decodeLanguageFields(data []byte) []DecodedField {
+	return field("Languages", strings.Join(DecodeLanguages(data), ", "))
+}
+
+func decodeARRFields(data []byte) []DecodedField {
+	if isEmptyRecord(data) {
+		return []DecodedField{{"Read", ""}, {"Update", ""}}
+	}
+	read, update := parseARRRecord(data)
+	return []DecodedField{{"Read", read}, {"Update", update}}
+}
+
+func decodeIMSIFields(data []byte) []DecodedField {
+	return field("IMSI", DecodeIMSI(data))
+}
+
+func decodeMSISDNFields(data []byte) []DecodedField {
+	return field("MSISDN", DecodeMSISDN(data))
+}
+
+func decodeSPNFields(data []byte) []DecodedField {
+	condition := ""
+	if len(data) > 0 {
+		condition = fmt.Sprintf("%02X", data[0])
+	}
+	return []DecodedField{{"SPN", DecodeSPN(data)}, {"Display condition", condition}}
+}
+
+func decodeADFields(data []byte) []DecodedField {
+	ad := DecodeAD(data)
+	return []DecodedField{{"UE mode", ad.UEMode}, {"MNC length", fmt.Sprint(ad.MNCLength)}}
+}
+
+func decodeACCFields(data []byte) []DecodedField {
+	return field("Access classes", fmt.Sprint(DecodeACC(data)))
+}
+
+// serviceFields lists the services set in a service table, one field per service
+func serviceFields(names map[int]string) func([]byte) []DecodedField {
+	return func(data []byte) []DecodedField {
+		var fields []DecodedField
+		for _, n := range getEnabledServiceNumbers(DecodeUST(data)) {
+			fields = append(fields, DecodedField{fmt.Sprintf("Service %d", n), names[n]})
+		}
+		return fields
+	}
+}
+
+func decodeACLFields(data []byte) []DecodedField {
+	return field("APN control list", DecodeACL(data).String())
+}
+
+func decodePLMNwACTFields(data []byte) []DecodedField {
+	return field("PLMNs", formatPLMNwACT(DecodePLMNwACT(data), false))
+}
+
+func decodeFPLMNFields(data []byte) []DecodedField {
+	return field("Forbidden PLMNs", formatPLMNs(DecodeFPLMN(data)))
+}
+
+func decodeHPPLMNFields(data []byte) []DecodedField {
+	period := "disabled"
+	if minutes := DecodeHPLMNPeriod(data); minutes > 0 {
+		period = fmt.Sprintf("%d min", minutes)
+	}
+	return field("Search period", period)
+}
+
+func decodeLOCIFields(data []byte) []DecodedField {
+	var l LocationInfo
+	if info := DecodeLOCI(data); info != nil {
+		l = *info
+	}
+	tmsiTime := ""
+	if l.TMSI != "" {
+		tmsiTime = fmt.Sprint(l.TMSITime)
+	}
+	return []DecodedField{{"TMSI", l.TMSI}, {"LAI", l.LAI}, {"TMSI time", tmsiTime}, {"Status", l.Status}}
+}
+
+func decodePSLOCIFields(data []byte) []DecodedField {
+	var l PSLocationInfo
+	if info := DecodePSLOCI(data); info != nil {
+		l = *info
+	}
+	return []DecodedField{{"P-TMSI", l.PTMSI}, {"P-TMSI signature", l.PTMSISig}, {"RAI", l.RAI}, {"Status", l.Status}}
+}
+
+func decodeEPSLOCIFields(data []byte) []DecodedField {
+	var l EPSLocationInfo
+	if info := DecodeEPSLOCI(data); info != nil {
+		l = *info
+	}
+	return []DecodedField{{"GUTI", l.GUTI}, {"TAI", l.TAI}, {"Status", l.Status}}
+}
+
+func decodeNASConfigFields(data []byte) []DecodedField {
+	return field("NAS config", DecodeNASConfig(data).String())
+}
+
+func decodeFromPreferredFields(data []byte) []DecodedField {
+	if len(data) == 0 {
+		return field("From preferred", "")
+	}
+	return field("From preferred", fmt.Sprint(DecodeFromPreferred(data)))
+}
+
+func decodeKeysFields(data []byte) []DecodedField {
+	ksi, ck, ik, err := DecodeKeys(data)
+	if err != nil {
+		return []DecodedField{{"KSI", ""}, {"CK", ""}, {"IK", ""}}
+	}
+	return []DecodedField{{"KSI", fmt.Sprintf("%d", ksi&0x07)}, {"CK", fmt.Sprintf("%X", ck)}, {"IK", fmt.Sprintf("%X", ik)}}
+}
+
+func decodeADNFields(data []byte) []DecodedField {
+	var e PhonebookEntry
+	if entry := decodeADNRecord(data, 1); entry != nil {
+		e = *entry
+	}
+	return []DecodedField{{"Name", e.Name}, {"Number", e.Number}}
+}
+
+func decodeSMSFields(data []byte) []DecodedField {
+	var m SMSMessage
+	if msg := decodeSMSRecord(data, 1); msg != nil {
+		m = *msg
+	}
+	return []DecodedField{{"Status", m.Status}, {"Number", m.Number}, {"Text", m.Text}}
+}
+
+func decodeSMSPFields(data []byte) []DecodedField {
+	return field("SMS parameters", DecodeSMSP(data).String())
+}
+
+func decodePSISMSCFields(data []byte) []DecodedField {
+	return field("PSI SMSC", DecodePSISMSC(data))
+}
+
+// mailboxFields lists the mailbox types of an EF_MBI or EF_MWIS record
+func mailboxFields(decode func([]byte) map[string]int, what string) func([]byte) []DecodedField {
+	return func(data []byte) []DecodedField {
+		values := decode(data)
+		var fields []DecodedField
+		for _, t := range MailboxTypes {
+			if n, ok := values[t]; ok {
+				fields = append(fields, DecodedField{t + " " + what, fmt.Sprint(n)})
+			}
+		}
+		return fields
+	}
+}
+
+func decodeIMPIFields(data []byte) []DecodedField {
+	return field("IMPI", DecodeIMPI(data))
+}
+
+func decodeDomainFields(data []byte) []DecodedField {
+	return field("Domain", DecodeDomain(data))
+}
+
+func decodeIMPUFields(data []byte) []DecodedField {
+	return field("IMPU", DecodeIMPU(data))
+}
+
+func decodePCSCFFields(data []byte) []DecodedField {
+	return field("P-CSCF", DecodePCSCF(data))
+}
+
+func decodeFiveGSNSCFields(data []byte) []DecodedField {
+	if isEmptyRecord(data) {
+		return field("ngKSI", "")
+	}
+	c, err := DecodeFiveGSNSC(data)
+	if err != nil {
+		return field("Error", err.Error())
+	}
+	if !c.Valid() {
+		return field("ngKSI", "07 (no key available)")
+	}
+	fields := []DecodedField{
+		{"ngKSI", fmt.Sprintf("%02X", c.NgKSI)},
+		{"K_AMF", fmt.Sprintf("%X", c.KAMF)},
+		{"Uplink NAS COUNT", fmt.Sprint(c.UplinkCount)},
+		{"Downlink NAS COUNT", fmt.Sprint(c.DownlinkCount)},
+		{"Algorithms", FormatNASAlgorithms(c.Algorithms, false)},
+	}
+	if c.HasEPSAlgs {
+		fields = append(fields, DecodedField{"EPS algorithms", FormatNASAlgorithms(c.EPSAlgorithms, true)})
+	}
+	return fields
+}
+
+func decodeSUCICalcInfoFields(data []byte) []DecodedField {
+	info, err := DecodeSUCICalcInfo(data)
+	var fields []DecodedField
+	if info != nil {
+		for i, s := range info.Schemes {
+			fields = append(fields, DecodedField{fmt.Sprintf("Scheme %d", i+1), fmt.Sprintf("%s, key index %d", s.Name(), s.KeyIndex)})
+		}
+		for _, k := range info.Keys {
+			fields = append(fields, DecodedField{fmt.Sprintf("Key %d", k.ID), fmt.Sprintf("%X", k.Key)})
+		}
+	}
+	if err != nil {
+		fields = append(fields, DecodedField{"Error", err.Error()})
+	}
+	return fields
+}
+
+func decodeOPL5GFields(data []byte) []DecodedField {
+	entry, ok, err := DecodeOPL5G(data)
+	switch {
+	case !ok:
+		return field("TAI", "")
+	case err != nil:
+		return field("Error", err.Error())
+	}
+	return []DecodedField{
+		{"TAI", fmt.Sprintf("%s-%s TAC %s-%s", entry.MCC, entry.MNC, entry.TACStart, entry.TACEnd)},
+		{"PNN record", fmt.Sprint(entry.PNNRecord)},
+	}
+}
+
+func decodeSORCMCIFields(data []byte) []DecodedField {
+	c := DecodeSORCMCI(data)
+	if c == nil {
+		return field("SOR-CMCI", "")
+	}
+	fields := field("SOR-CMCI", c.CMCI)
+	for _, u := range c.Unknown {
+		fields = append(fields, DecodedField{"Tag " + u.Tag, u.Value})
+	}
+	return fields
+}
+
+func decodeFCPFields(data []byte) []DecodedField {
+	f, _ := card.ParseFCP(data)
+	fields := []DecodedField{{"Structure", f.Structure()}, {"Size", fmt.Sprint(f.Size())}}
+	if f.RecordSize() > 0 {
+		fields = append(fields,
+			DecodedField{"Record size", fmt.Sprint(f.RecordSize())},
+			DecodedField{"Records", fmt.Sprint(f.NumRecords())})
+	}
+	return fields
+}
@@ -0,0 +1,98 @@
+package sim
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ============ EF DECODER REGISTRY TESTS ============
+
+func TestDecodeEF(t *testing.T) {
+	tests := []struct {
+		spec string
+		hex  string
+		file string
+		app  string
+		want []DecodedField
+	}{
+		{"EF_IMSI", "082905880000000010", "EF_IMSI", "ADF_USIM", []DecodedField{{"IMSI", "250880000000001"}}},
+		{"imsi", "082905880000000010", "EF_IMSI", "ADF_USIM", []DecodedField{{"IMSI", "250880000000001"}}},
+		{"6F07", "082905880000000010", "EF_IMSI", "ADF_USIM", []DecodedField{{"IMSI", "250880000000001"}}},
+		{"0x2FE2", "981032547698103254F6", "EF_ICCID", "MF", []DecodedField{{"ICCID", "8901234567890123456"}}},
+		{"ISIM:6F07", "0A", "EF_IST", "ADF_ISIM", []DecodedField{{"Service 2", ISTServices[2]}, {"Service 4", ISTServices[4]}}},
+		{"EF_SPN", "0154657374FFFF", "EF_SPN", "ADF_USIM", []DecodedField{{"SPN", "Test"}, {"Display condition", "01"}}},
+		{"EF_AD", "00000002", "EF_AD", "ADF_USIM", []DecodedField{{"UE mode", "Normal"}, {"MNC length", "2"}}},
+		{"EF_HPLMNwACT", "00F1104000", "EF_HPLMNwACT", "ADF_USIM", []DecodedField{{"PLMNs", "001-01:eutran"}}},
+		{"EF_FPLMN", "52F001FFFFFF", "EF_FPLMN", "ADF_USIM", []DecodedField{{"Forbidden PLMNs", "250:10"}}},
+		{"EF_LOCI", "11223344" + "52F0011234" + "FF00", "EF_LOCI", "ADF_USIM",
+			[]DecodedField{{"TMSI", "11223344"}, {"LAI", "250-10 LAC:1234"}, {"TMSI time", "255"}, {"Status", "Updated"}}},
+		{"EF_ADN", "4A6F686EFFFF" + "06911032547698FF" + "FFFFFFFFFFFF", "EF_ADN", "ADF_USIM",
+			[]DecodedField{{"Name", "John"}, {"Number", "+0123456789"}}},
+		{"EF_ARR", "8001019000800102A406830101950108", "EF_ARR", "MF", []DecodedField{{"Read", "Always"}, {"Update", "PIN1"}}},
+		{"5GS:4F07", "A0020100", "EF_SUCI_Calc_Info", "DF_5GS", []DecodedField{{"Scheme 1", "Profile A, key index 0"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := DecodeEF(tt.spec, mustHex(tt.hex))
+			if err != nil {
+				t.Fatalf("DecodeEF() error = %v", err)
+			}
+			if got.File != tt.file || got.App != tt.app || got.TLV != "" {
+				t.Errorf("DecodeEF() = %s in %s (TLV %q), want %s in %s", got.File, got.App, got.TLV, tt.file, tt.app)
+			}
+			if !reflect.DeepEqual(got.Fields, tt.want) {
+				t.Errorf("Fields = %q, want %q", got.Fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEF_Fallback(t *testing.T) {
+	got, err := DecodeEF("6FFF", mustHex("800568656C6C6F"))
+	if err != nil || got.File != "EF 6FFF" || got.Fields != nil || !strings.Contains(got.TLV, "80 [5]") {
+		t.Errorf("unknown FID = %+v, %v; want a TLV dump", got, err)
+	}
+	got, err = DecodeEF("fcp", mustHex("62118202412183026F3A8A01058004000000B0"))
+	if err != nil || got.File != "FCP" || !strings.Contains(got.TLV, "File descriptor") {
+		t.Fatalf("FCP = %+v, %v", got, err)
+	}
+	if want := []DecodedField{{"Structure", "transparent"}, {"Size", "176"}}; !reflect.DeepEqual(got.Fields[:2], want) {
+		t.Errorf("FCP fields = %q, want %q", got.Fields, want)
+	}
+	for _, spec := range []string{"EF_NOPE", "SIM:6F07", "6F0"} {
+		if _, err := DecodeEF(spec, nil); err == nil {
+			t.Errorf("DecodeEF(%q) accepted", spec)
+		}
+	}
+}
+
+func TestDecodeFile(t *testing.T) {
+	if got := DecodeFile("ADF_USIM", "EF_ICCID", mustHex("981032547698103254F6")); len(got) != 1 || got[0].Value != "8901234567890123456" {
+		t.Errorf("DecodeFile(EF_ICCID) = %q, want the MF decoder", got)
+	}
+	if got := DecodeFile("ADF_ISIM", "EF_IMSI", mustHex("082905880000000010")); got != nil {
+		t.Errorf("DecodeFile(ISIM EF_IMSI) = %q, want nil", got)
+	}
+	fields := []DecodedField{{"TMSI", "11223344"}, {"LAI", ""}, {"Status", "Updated"}}
+	if got := FormatDecodedFields(fields, "; "); got != "TMSI: 11223344; Status: Updated" {
+		t.Errorf("FormatDecodedFields() = %q", got)
+	}
+}
+
+func TestDecodeChange_Registry(t *testing.T) {
+	got := decodeChange("ADF_USIM", 0x6F46, mustHex("0154657374FFFF"), mustHex("004E6577FFFFFF"))
+	want := []string{"SPN: Test → New", "Display condition: 01 → 00"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeChange(EF_SPN) = %q, want %q", got, want)
+	}
+	// Mailbox types only present on one side are listed as set or cleared
+	got = decodeChange("ADF_USIM", 0x6FC9, mustHex("01000000"), mustHex("00020000"))
+	want = []string{"fax record: (empty) → 2", "voicemail record: 1 → (empty)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeChange(EF_MBI) = %q, want %q", got, want)
+	}
+	if got := decodeChange("ADF_ISIM", 0x6F38, []byte{0x00}, []byte{0x01}); got != nil {
+		t.Errorf("decodeChange(ISIM 6F38) = %q, want nil", got)
+	}
+}
@@ -0,0 +1,255 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+
+	"sim_reader/card"
+)
+
+// EFState is the outcome of reading an elementary file
+type EFState int
+
+const (
+	EFPresent EFState = iota // File selected and read
+	EFAbsent                 // SELECT returned "file not found" (6A82, GSM 9404): optional file not on the card
+	EFError                  // Unexpected status word (6982, 6B00, ...) or transport error
+	EFSkipped                // Not selected: the service table does not list the service that needs it
+)
+
+// ReadAllFiles makes ReadUSIM select every optional EF, also those whose UST service is
+// not available (--read-all-files)
+var ReadAllFiles = false
+
+// EFStatus records how reading one EF went
+type EFStatus struct {
+	State   EFState
+	SW      uint16 // Status word of the failing command (0 for transport errors)
+	Err     error  // Set for EFError
+	Service int    // Set for EFSkipped: the UST service that is not available
+}
+
+// FileStatuses maps EF names (EF_SPN, EF_IMPI, ...) of an application to their read outcome
+type FileStatuses map[string]EFStatus
+
+// Present reports whether the EF was read (false if absent, failed or not attempted)
+func (fs FileStatuses) Present(name string) bool {
+	st, ok := fs[name]
+	return ok && st.State == EFPresent
+}
+
+// Absent reports whether the card has no such EF
+func (fs FileStatuses) Absent(name string) bool {
+	st, ok := fs[name]
+	return ok && st.State == EFAbsent
+}
+
+// Issues returns a warning per EF that failed for an unexpected reason, plus absent
+// mandatory EFs (names in mandatory), sorted by EF name
+func (fs FileStatuses) Issues(mandatory ...string) []string {
+	var names []string
+	for name, st := range fs {
+		if st.State == EFError {
+			names = append(names, name)
+		}
+	}
+	for _, name := range mandatory {
+		if fs.Absent(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	issues := make([]string, 0, len(names))
+	for _, name := range names {
+		st := fs[name]
+		switch {
+		case st.State == EFAbsent:
+			issues = append(issues, fmt.Sprintf("%s: mandatory file not found", name))
+		case st.Err != nil:
+			issues = append(issues, fmt.Sprintf("could not read %s: %v", name, st.Err))
+		}
+	}
+	return issues
+}
+
+// isFileNotFound reports whether sw means the file does not exist (ISO 6A82, GSM 9404)
+func isFileNotFound(sw uint16) bool {
+	return sw == card.SW_FILE_NOT_FOUND || sw == 0x9404
+}
+
+// selectEFStatus selects an EF in the current DF and classifies the result. With an
+// active file map, a file the map knows to be absent is not selected again.
+func selectEFStatus(reader *card.Reader, fileID uint16) (*card.APDUResponse, EFStatus) {
+	dir := fileMapDir(reader)
+	if fileMapSkip(dir, fileID) {
+		return &card.APDUResponse{SW1: 0x6A, SW2: 0x82}, EFStatus{State: EFAbsent, SW: card.SW_FILE_NOT_FOUND}
+	}
+	resp, st := selectEF(reader, fileID)
+	fileMapObserve(dir, fileID, resp, st)
+	return resp, st
+}
+
+// selectEF sends SELECT for an EF and classifies the status word
+func selectEF(reader *card.Reader, fileID uint16) (*card.APDUResponse, EFStatus) {
+	fid := []byte{byte(fileID >> 8), byte(fileID & 0xFF)}
+
+	var resp *card.APDUResponse
+	var err error
+	if UseGSMCommands {
+		resp, err = reader.SelectGSM(fid)
+	} else {
+		resp, err = reader.Select(fid)
+	}
+
+	switch {
+	case err != nil:
+		return nil, EFStatus{State: EFError, Err: err}
+	case isFileNotFound(resp.SW()):
+		return resp, EFStatus{State: EFAbsent, SW: resp.SW()}
+	case !resp.IsOK():
+		return resp, EFStatus{State: EFError, SW: resp.SW(), Err: fmt.Errorf("select 0x%04X failed: %s", fileID, resp.SWString())}
+	}
+	return resp, EFStatus{State: EFPresent}
+}
+
+// readTracked reads a transparent EF and records the outcome under name
+func (fs FileStatuses) readTracked(reader *card.Reader, name string, fileID uint16) ([]byte, bool) {
+	raw, st := readEFStatus(reader, fileID)
+	fs[name] = st
+	return raw, st.State == EFPresent
+}
+
+// missingServiceFiles returns, for each enabled service, the files it references
+// that the card does not have
+func missingServiceFiles(services map[int]bool, files FileStatuses, refs map[int][]string) map[int][]string {
+	missing := make(map[int][]string)
+	for num, enabled := range services {
+		if !enabled {
+			continue
+		}
+		for _, name := range refs[num] {
+			if files.Absent(name) {
+				missing[num] = append(missing[num], name)
+			}
+		}
+	}
+	return missing
+}
+
+// skipService returns the service table entry that rules out reading the EF: the EF is
+// skipped when none of the services in refs that reference it is available. Nothing is
+// skipped without a service table (EF_UST unreadable) or with ReadAllFiles.
+func skipService(services map[int]bool, refs map[int][]string, name string) (int, bool) {
+	if ReadAllFiles || services == nil {
+		return 0, false
+	}
+	skip := 0
+	for num, names := range refs {
+		for _, n := range names {
+			if n != name {
+				continue
+			}
+			if services[num] {
+				return 0, false
+			}
+			if skip == 0 || num < skip {
+				skip = num
+			}
+		}
+	}
+	return skip, skip != 0
+}
+
+// skipUnlessService records the EF as skipped and returns true when no UST service that
+// needs it is available
+func (u *USIMData) skipUnlessService(name string) bool {
+	num, skip := skipService(u.UST, ustServiceFiles, name)
+	if skip {
+		u.Files[name] = EFStatus{State: EFSkipped, Service: num}
+	}
+	return skip
+}
+
+// ustServiceFiles lists the EFs read by ReadUSIM that a UST service requires (TS 31.102 4.2.8)
+var ustServiceFiles = map[int][]string{
+	2:   {"EF_EST"}, // FDN
+	6:   {"EF_EST"}, // BDN
+	12:  {"EF_SMSP"},
+	19:  {"EF_SPN"},
+	20:  {"EF_PLMNwACT"},
+	21:  {"EF_MSISDN"},
+	27:  {"DF_GSM-ACCESS"},
+	35:  {"EF_EST", "EF_ACL"}, // APN Control List
+	42:  {"EF_OPLMNwACT"},
+	43:  {"EF_HPLMNwACT"},
+	47:  {"EF_MBDN"},
+	48:  {"EF_MWIS"},
+	85:  {"EF_EPSLOCI"},
+	100: {"EF_NASCONFIG"},
+}
+
+// istServiceFiles lists the EFs read by ReadISIM that an IST service requires (TS 31.103 4.2.7)
+var istServiceFiles = map[int][]string{
+	1: {"EF_PCSCF"},
+}
+
+// usimMandatoryFiles / isimMandatoryFiles are reported when absent (not quiet like optional files)
+var (
+	usimMandatoryFiles = []string{"EF_IMSI", "EF_AD", "EF_UST"}
+	isimMandatoryFiles = []string{"EF_IMPI", "EF_DOMAIN", "EF_IMPU", "EF_AD"}
+)
+
+// ReadIssues returns warnings for files that could not be read for an unexpected reason
+// (absent optional files are not reported)
+func (u *USIMData) ReadIssues() []string {
+	return u.Files.Issues(usimMandatoryFiles...)
+}
+
+// MissingServiceFiles returns the enabled UST services whose files are absent
+func (u *USIMData) MissingServiceFiles() map[int][]string {
+	return missingServiceFiles(u.UST, u.Files, ustServiceFiles)
+}
+
+// ReadIssues returns warnings for files that could not be read for an unexpected reason
+func (d *ISIMData) ReadIssues() []string {
+	if !d.Available {
+		return nil
+	}
+	return d.Files.Issues(isimMandatoryFiles...)
+}
+
+// MissingServiceFiles returns the enabled IST services whose files are absent
+func (d *ISIMData) MissingServiceFiles() map[int][]string {
+	return missingServiceFiles(d.IST, d.Files, istServiceFiles)
+}
+
+// FileStatusExport is the export form of an EFStatus
+type FileStatusExport struct {
+	Present bool   `json:"present"`
+	SW      string `json:"sw,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Skipped string `json:"skipped,omitempty"` // not selected because the service table rules the file out
+}
+
+// ExportFileStatuses converts the read outcomes for JSON/YAML export
+func ExportFileStatuses(fs FileStatuses) map[string]FileStatusExport {
+	if len(fs) == 0 {
+		return nil
+	}
+	out := make(map[string]FileStatusExport, len(fs))
+	for name, st := range fs {
+		e := FileStatusExport{Present: st.State == EFPresent}
+		if st.SW != 0 {
+			e.SW = fmt.Sprintf("%04X", st.SW)
+		}
+		if st.Err != nil {
+			e.Error = st.Err.Error()
+		}
+		if st.State == EFSkipped {
+			e.Skipped = fmt.Sprintf("UST service %d not available", st.Service)
+		}
+		out[name] = e
+	}
+	return out
+}
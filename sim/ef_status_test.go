@@ -0,0 +1,191 @@
+package sim
+
+import (
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ EF PRESENCE TESTS ============
+
+// newMinimalUSIMReader returns a test card with only IMSI, AD and a UST enabling services 19-21 (SPN, PLMNwACT, MSISDN);
+// EF_ACC is protected (SELECT answers 6982)
+func newMinimalUSIMReader() *card.Reader {
+	m := newMinimalUSIMCard()
+	return card.NewReaderWithTransport("Mock", m.ATR, m)
+}
+
+func newMinimalUSIMCard() *card.MockCard {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, []byte{0x08, 0x09, 0x10, 0x10, 0x00, 0x00, 0x00, 0x00, 0x10})
+	usim.AddEF(0x6FAD, []byte{0x00, 0x00, 0x00, 0x02})
+	usim.AddEF(0x6F38, []byte{0x00, 0x00, 0x1C}) // services 19, 20, 21
+	m.FailSelect = map[string]uint16{"6F78": 0x6982}
+	return m
+}
+
+func TestReadUSIM_FileStatuses(t *testing.T) {
+	data, err := ReadUSIM(newMinimalUSIMReader())
+	if err != nil {
+		t.Fatalf("ReadUSIM() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		state EFState
+	}{
+		{"EF_IMSI", EFPresent},
+		{"EF_SPN", EFAbsent},
+		{"EF_MSISDN", EFAbsent},
+		{"EF_ACC", EFError},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if st := data.Files[tc.name]; st.State != tc.state {
+				t.Errorf("state = %d, want %d (%+v)", st.State, tc.state, st)
+			}
+		})
+	}
+
+	issues := data.ReadIssues()
+	if len(issues) != 1 || !strings.Contains(issues[0], "EF_ACC") {
+		t.Errorf("ReadIssues() = %q, want only EF_ACC", issues)
+	}
+
+	missing := data.MissingServiceFiles()
+	if len(missing) != 3 || missing[19][0] != "EF_SPN" || missing[20][0] != "EF_PLMNwACT" || missing[21][0] != "EF_MSISDN" {
+		t.Errorf("MissingServiceFiles() = %v, want services 19, 20 and 21", missing)
+	}
+}
+
+func TestFileStatuses_Issues(t *testing.T) {
+	fs := FileStatuses{
+		"EF_IMSI": {State: EFAbsent, SW: card.SW_FILE_NOT_FOUND},
+		"EF_SPN":  {State: EFAbsent, SW: card.SW_FILE_NOT_FOUND},
+		"EF_UST":  {State: EFPresent},
+	}
+	issues := fs.Issues("EF_IMSI", "EF_UST")
+	if len(issues) != 1 || !strings.Contains(issues[0], "EF_IMSI: mandatory") {
+		t.Errorf("Issues() = %q, want only the absent mandatory EF_IMSI", issues)
+	}
+}
+
+func TestExportToConfig_Files(t *testing.T) {
+	data, err := ReadUSIM(newMinimalUSIMReader())
+	if err != nil {
+		t.Fatalf("ReadUSIM() error = %v", err)
+	}
+	config := ExportToConfig(data, nil)
+	if f, ok := config.Files["EF_SPN"]; !ok || f.Present || f.SW != "6A82" {
+		t.Errorf("files[EF_SPN] = %+v, want present=false sw=6A82", f)
+	}
+	if f := config.Files["EF_ACC"]; f.Present || f.Error == "" {
+		t.Errorf("files[EF_ACC] = %+v, want an error", f)
+	}
+	if config.SPN != "" {
+		t.Errorf("SPN = %q, want empty", config.SPN)
+	}
+}
+
+// ============ SERVICE TABLE SKIP TESTS ============
+
+// countAllSelects returns the number of SELECT commands in an APDU log
+func countAllSelects(log [][]byte) int {
+	n := 0
+	for _, apdu := range log {
+		if len(apdu) > 1 && apdu[1] == 0xA4 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestReadUSIM_SkipsByServiceTable(t *testing.T) {
+	m := newMinimalUSIMCard()
+	data, err := ReadUSIM(card.NewReaderWithTransport("Mock", m.ATR, m))
+	if err != nil {
+		t.Fatalf("ReadUSIM() error = %v", err)
+	}
+	skipped := map[string]int{
+		"EF_SMSP": 12, "EF_EST": 2, "EF_ACL": 35, "EF_OPLMNwACT": 42,
+		"EF_HPLMNwACT": 43, "EF_MBDN": 47, "EF_MWIS": 48, "EF_EPSLOCI": 85, "EF_NASCONFIG": 100,
+		"DF_GSM-ACCESS": 27,
+	}
+	for name, service := range skipped {
+		if st := data.Files[name]; st.State != EFSkipped || st.Service != service {
+			t.Errorf("%s = %+v, want skipped for UST service %d", name, st, service)
+		}
+	}
+	// Services 19-21 are available: their files are selected (and absent on this card)
+	for _, name := range []string{"EF_SPN", "EF_MSISDN", "EF_PLMNwACT"} {
+		if st := data.Files[name]; st.State != EFAbsent {
+			t.Errorf("%s = %+v, want absent", name, st)
+		}
+	}
+	if issues := data.ReadIssues(); len(issues) != 1 {
+		t.Errorf("ReadIssues() = %q, want only EF_ACC", issues)
+	}
+	if f := ExportToConfig(data, nil).Files["EF_ACL"]; f.Present || f.Skipped != "UST service 35 not available" {
+		t.Errorf("files[EF_ACL] = %+v, want skipped", f)
+	}
+
+	ReadAllFiles = true
+	defer func() { ReadAllFiles = false }()
+	all := newMinimalUSIMCard()
+	data, _ = ReadUSIM(card.NewReaderWithTransport("Mock", all.ATR, all))
+	if st := data.Files["EF_ACL"]; st.State != EFAbsent {
+		t.Errorf("EF_ACL with ReadAllFiles = %+v, want absent", st)
+	}
+	// Plus MF, DF_TELECOM and ADF_USIM again for the voicemail files, absent from the USIM
+	if got, want := countAllSelects(all.Log)-countAllSelects(m.Log), len(skipped)+3; got != want {
+		t.Errorf("ReadAllFiles sends %d more SELECTs, want %d", got, want)
+	}
+}
+
+func TestSkipService(t *testing.T) {
+	tests := []struct {
+		name     string
+		services map[int]bool
+		file     string
+		want     int
+	}{
+		{"no service table", nil, "EF_ACL", 0},
+		{"service available", map[int]bool{35: true}, "EF_ACL", 0},
+		{"service not available", map[int]bool{2: true}, "EF_ACL", 35},
+		{"one of several services", map[int]bool{6: true}, "EF_EST", 0},
+		{"none of several services", map[int]bool{1: true}, "EF_EST", 2},
+		{"mandatory file", map[int]bool{}, "EF_IMSI", 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, skip := skipService(tc.services, ustServiceFiles, tc.file); got != tc.want || skip != (tc.want != 0) {
+				t.Errorf("skipService() = %d, %v; want %d", got, skip, tc.want)
+			}
+		})
+	}
+}
+
+// BenchmarkReadUSIM reports the SELECTs a ReadUSIM of the minimal test card sends with and
+// without the service table check
+func BenchmarkReadUSIM(b *testing.B) {
+	for _, all := range []bool{false, true} {
+		name := "ServiceTable"
+		if all {
+			name = "ReadAllFiles"
+		}
+		b.Run(name, func(b *testing.B) {
+			ReadAllFiles = all
+			defer func() { ReadAllFiles = false }()
+			selects := 0
+			for i := 0; i < b.N; i++ {
+				m := newMinimalUSIMCard()
+				ReadUSIM(card.NewReaderWithTransport("Mock", m.ATR, m))
+				selects += countAllSelects(m.Log)
+			}
+			b.ReportMetric(float64(selects)/float64(b.N), "selects/op")
+		})
+	}
+}
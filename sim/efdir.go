@@ -0,0 +1,170 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/tlv"
+)
+
+// efdirFile is the selected EF_DIR with all its records
+type efdirFile struct {
+	recordSize int
+	records    [][]byte
+}
+
+// readEFDIRForUpdate selects EF_DIR under the MF and reads every record with the size from the FCP
+func readEFDIRForUpdate(reader *card.Reader) (*efdirFile, error) {
+	reader.Select([]byte{0x3F, 0x00})
+	resp, err := reader.Select([]byte{0x2F, 0x00})
+	if err != nil {
+		return nil, fmt.Errorf("failed to select EF_DIR: %w", err)
+	}
+	if !resp.IsOK() {
+		return nil, fmt.Errorf("EF_DIR not found: %s", resp.SWString())
+	}
+
+	dir := &efdirFile{recordSize: parseFCPRecordSize(resp.Data)}
+	count := parseFCPNumRecords(resp.Data)
+	if dir.recordSize == 0 || count == 0 {
+		return nil, fmt.Errorf("EF_DIR record size/count not found in FCP")
+	}
+	for recNum := 1; recNum <= count; recNum++ {
+		recResp, err := reader.ReadRecord(byte(recNum), byte(dir.recordSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read EF_DIR record %d: %w", recNum, err)
+		}
+		if !recResp.IsOK() {
+			return nil, fmt.Errorf("EF_DIR record %d read failed: %s", recNum, recResp.SWString())
+		}
+		dir.records = append(dir.records, recResp.Data)
+	}
+	return dir, nil
+}
+
+// find returns the number (1-based) of the first record listing aid, or 0
+func (d *efdirFile) find(aid []byte) int {
+	for i, data := range d.records {
+		app := parseApplicationTemplate(data)
+		if strings.EqualFold(app.AID, hex.EncodeToString(aid)) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// free returns the number (1-based) of the first unused (all FF) record, or 0
+func (d *efdirFile) free() int {
+	for i, data := range d.records {
+		if len(bytes.Trim(data, "\xFF")) == 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// EncodeEFDIRRecord encodes an application template (tag 61 with AID 4F and label 50)
+// padded with FF to recordSize
+func EncodeEFDIRRecord(aid []byte, label string, recordSize int) ([]byte, error) {
+	if len(aid) < 5 || len(aid) > 16 {
+		return nil, fmt.Errorf("AID length %d outside 5-16 bytes", len(aid))
+	}
+	value := tlv.Encode(0x4F, aid)
+	if label != "" {
+		value = append(value, tlv.Encode(0x50, []byte(label))...)
+	}
+	template := tlv.Encode(0x61, value)
+	if len(template) > recordSize {
+		return nil, fmt.Errorf("application template is %d bytes, EF_DIR records are %d bytes", len(template), recordSize)
+	}
+	return append(template, bytes.Repeat([]byte{0xFF}, recordSize-len(template))...), nil
+}
+
+// writeEFDIRRecord updates one record and reads it back
+func writeEFDIRRecord(reader *card.Reader, recNum int, data []byte) error {
+	resp, err := reader.UpdateRecord(byte(recNum), data)
+	if err != nil {
+		return fmt.Errorf("failed to write EF_DIR record %d: %w", recNum, err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("EF_DIR record %d write failed: %s", recNum, resp.SWString())
+	}
+	if reader.DryRun() {
+		return nil
+	}
+	back, err := reader.ReadRecord(byte(recNum), byte(len(data)))
+	if err != nil || !back.IsOK() || !bytes.Equal(back.Data, data) {
+		return fmt.Errorf("EF_DIR record %d verification failed", recNum)
+	}
+	return nil
+}
+
+// AddEFDIREntry registers an application in EF_DIR so terminals find it (e.g. an ISIM
+// installed with GlobalPlatform). An existing entry for the AID is rewritten in place,
+// otherwise the first unused record is taken. Other records are not touched.
+// Returns the record number written.
+func AddEFDIREntry(reader *card.Reader, aid []byte, label string) (int, error) {
+	dir, err := readEFDIRForUpdate(reader)
+	if err != nil {
+		return 0, err
+	}
+	data, err := EncodeEFDIRRecord(aid, label, dir.recordSize)
+	if err != nil {
+		return 0, err
+	}
+
+	recNum := dir.find(aid)
+	if recNum == 0 {
+		recNum = dir.free()
+	}
+	if recNum == 0 {
+		return 0, fmt.Errorf("no free record in EF_DIR (%d records of %d bytes, all in use)",
+			len(dir.records), dir.recordSize)
+	}
+	if bytes.Equal(dir.records[recNum-1], data) {
+		return recNum, nil
+	}
+	return recNum, writeEFDIRRecord(reader, recNum, data)
+}
+
+// RemoveEFDIREntry unregisters an application by overwriting its EF_DIR record(s) with FF.
+// Returns the record numbers cleared.
+func RemoveEFDIREntry(reader *card.Reader, aid []byte) ([]int, error) {
+	dir, err := readEFDIRForUpdate(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var cleared []int
+	empty := bytes.Repeat([]byte{0xFF}, dir.recordSize)
+	for i, data := range dir.records {
+		app := parseApplicationTemplate(data)
+		if !strings.EqualFold(app.AID, hex.EncodeToString(aid)) {
+			continue
+		}
+		if err := writeEFDIRRecord(reader, i+1, empty); err != nil {
+			return cleared, err
+		}
+		cleared = append(cleared, i+1)
+	}
+	if len(cleared) == 0 {
+		return nil, fmt.Errorf("AID %X is not listed in EF_DIR", aid)
+	}
+	return cleared, nil
+}
+
+// ParseEFDIREntry parses an "AID[:LABEL]" flag value
+func ParseEFDIREntry(s string) (aid []byte, label string, err error) {
+	aidHex, label, _ := strings.Cut(s, ":")
+	aid, err = hex.DecodeString(strings.ReplaceAll(aidHex, " ", ""))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid AID %q: %w", aidHex, err)
+	}
+	if len(aid) < 5 || len(aid) > 16 {
+		return nil, "", fmt.Errorf("AID length %d outside 5-16 bytes", len(aid))
+	}
+	return aid, label, nil
+}
@@ -0,0 +1,179 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ EF_DIR EDIT TESTS ============
+
+var efdirTestISIM = []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x04, 0xFF, 0x49, 0xFF, 0x05, 0x89}
+
+func TestEncodeEFDIRRecord(t *testing.T) {
+	tests := []struct {
+		name       string
+		aid        []byte
+		label      string
+		recordSize int
+		want       string
+		wantErr    string
+	}{
+		{"with label", AID_ISIM, "ISIM", 20,
+			"610F4F07A000000087100450044953494DFFFFFF", ""},
+		{"without label", AID_ISIM, "", 12, "61094F07A0000000871004FF", ""},
+		{"exact fit", AID_ISIM, "", 11, "61094F07A0000000871004", ""},
+		{"too long", efdirTestISIM, "IMS Subscriber Identity", 32, "", "records are 32 bytes"},
+		{"short AID", []byte{0xA0, 0x00}, "", 32, "", "AID length 2"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := EncodeEFDIRRecord(tc.aid, tc.label, tc.recordSize)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("EncodeEFDIRRecord() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EncodeEFDIRRecord() error = %v", err)
+			}
+			if fmt.Sprintf("%X", got) != tc.want {
+				t.Errorf("EncodeEFDIRRecord() = %X, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+// newEFDIRTestCard returns a card whose EF_DIR has 3 records of 32 bytes: the USIM
+// (with trailing proprietary bytes) followed by free records
+func newEFDIRTestCard(t *testing.T, free int) (*card.MockCard, *card.Reader, [][]byte) {
+	t.Helper()
+	usim, _ := EncodeEFDIRRecord(AID_USIM, "USIM", 32)
+	usim[30] = 0x5A // bytes after the template must survive untouched
+	records := [][]byte{usim}
+	for i := 0; i < 2; i++ {
+		rec := bytes.Repeat([]byte{0xFF}, 32)
+		if i >= free {
+			rec, _ = EncodeEFDIRRecord([]byte{0xA0, 0x00, 0x00, 0x05, 0x59, 0x10, 0x10, byte(i)}, "", 32)
+		}
+		records = append(records, rec)
+	}
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddRecordEF(0x2F00, cloneRecords(records)...)
+	return m, card.NewReaderWithTransport("Mock", m.ATR, m), records
+}
+
+func cloneRecords(records [][]byte) [][]byte {
+	out := make([][]byte, len(records))
+	for i, r := range records {
+		out[i] = append([]byte(nil), r...)
+	}
+	return out
+}
+
+func readEFDIRTestRecords(t *testing.T, reader *card.Reader) [][]byte {
+	t.Helper()
+	dir, err := readEFDIRForUpdate(reader)
+	if err != nil {
+		t.Fatalf("readEFDIRForUpdate() error = %v", err)
+	}
+	return dir.records
+}
+
+func TestAddEFDIREntry(t *testing.T) {
+	_, reader, before := newEFDIRTestCard(t, 2)
+
+	recNum, err := AddEFDIREntry(reader, efdirTestISIM, "ISIM")
+	if err != nil {
+		t.Fatalf("AddEFDIREntry() error = %v", err)
+	}
+	if recNum != 2 {
+		t.Errorf("AddEFDIREntry() record = %d, want 2", recNum)
+	}
+
+	after := readEFDIRTestRecords(t, reader)
+	want, _ := EncodeEFDIRRecord(efdirTestISIM, "ISIM", 32)
+	if !bytes.Equal(after[1], want) {
+		t.Errorf("record 2 = %X, want %X", after[1], want)
+	}
+	if !bytes.Equal(after[0], before[0]) || !bytes.Equal(after[2], before[2]) {
+		t.Errorf("other records changed: %X / %X", after[0], after[2])
+	}
+
+	// Adding the same AID again updates its record instead of taking another one
+	if recNum, err := AddEFDIREntry(reader, efdirTestISIM, "IMS"); err != nil || recNum != 2 {
+		t.Errorf("AddEFDIREntry() again = %d, %v, want record 2", recNum, err)
+	}
+	if app := parseApplicationTemplate(readEFDIRTestRecords(t, reader)[1]); app.Label != "IMS" {
+		t.Errorf("label = %q, want IMS", app.Label)
+	}
+}
+
+func TestAddEFDIREntry_NoFreeRecord(t *testing.T) {
+	m, reader, _ := newEFDIRTestCard(t, 0)
+	m.Log = nil
+
+	_, err := AddEFDIREntry(reader, efdirTestISIM, "ISIM")
+	if err == nil || !strings.Contains(err.Error(), "3 records of 32 bytes") {
+		t.Fatalf("AddEFDIREntry() error = %v, want no free record", err)
+	}
+	for _, apdu := range m.Log {
+		if apdu[1] == card.INS_UPDATE_RECORD {
+			t.Errorf("record written although EF_DIR is full: %X", apdu)
+		}
+	}
+}
+
+func TestRemoveEFDIREntry(t *testing.T) {
+	_, reader, before := newEFDIRTestCard(t, 2)
+	if _, err := AddEFDIREntry(reader, efdirTestISIM, "ISIM"); err != nil {
+		t.Fatalf("AddEFDIREntry() error = %v", err)
+	}
+
+	cleared, err := RemoveEFDIREntry(reader, efdirTestISIM)
+	if err != nil || len(cleared) != 1 || cleared[0] != 2 {
+		t.Fatalf("RemoveEFDIREntry() = %v, %v, want [2]", cleared, err)
+	}
+	after := readEFDIRTestRecords(t, reader)
+	for i := range before {
+		if !bytes.Equal(after[i], before[i]) {
+			t.Errorf("record %d = %X, want %X", i+1, after[i], before[i])
+		}
+	}
+
+	if _, err := RemoveEFDIREntry(reader, efdirTestISIM); err == nil {
+		t.Error("RemoveEFDIREntry() of a missing AID succeeded")
+	}
+}
+
+func TestParseEFDIREntry(t *testing.T) {
+	tests := []struct {
+		in        string
+		wantAID   string
+		wantLabel string
+		wantErr   bool
+	}{
+		{"A0000000871004FF49FF0589:ISIM", "A0000000871004FF49FF0589", "ISIM", false},
+		{"A0000000871002", "A0000000871002", "", false},
+		{"A0000000871004:My App", "A0000000871004", "My App", false},
+		{"A000", "", "", true},
+		{"ZZ00000087:ISIM", "", "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			aid, label, err := ParseEFDIREntry(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseEFDIREntry(%q) error = %v, wantErr %v", tc.in, err, tc.wantErr)
+			}
+			if err == nil && (fmt.Sprintf("%X", aid) != tc.wantAID || label != tc.wantLabel) {
+				t.Errorf("ParseEFDIREntry(%q) = %X, %q", tc.in, aid, label)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package sim
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 )
@@ -111,6 +112,15 @@ func EncodePLMNList(plmns []string, maxBytes int) ([]byte, error) {
 // EncodeTLVString encodes a string as TLV with tag 0x80
 func EncodeTLVString(s string) []byte {
 	data := []byte(s)
+	if len(data) > 127 {
+		// BER long form length (81 LL) for values above 127 bytes
+		result := make([]byte, 3+len(data))
+		result[0] = 0x80
+		result[1] = 0x81
+		result[2] = byte(len(data))
+		copy(result[3:], data)
+		return result
+	}
 	result := make([]byte, 2+len(data))
 	result[0] = 0x80 // Tag for string
 	result[1] = byte(len(data))
@@ -144,6 +154,32 @@ func EncodeIMPU(impu string, recordSize int) []byte {
 	return result
 }
 
+// EncodeIMPURecords encodes IMPUs into successive EF_IMPU records of recordSize bytes.
+// All numRecords records are returned; records beyond the IMPUs are blank (all FF).
+func EncodeIMPURecords(impus []string, recordSize, numRecords int) ([][]byte, error) {
+	if recordSize <= 0 || numRecords <= 0 {
+		return nil, fmt.Errorf("invalid EF_IMPU structure: %d records of %d bytes", numRecords, recordSize)
+	}
+	if len(impus) > numRecords {
+		return nil, fmt.Errorf("%d IMPUs given but EF_IMPU has only %d records", len(impus), numRecords)
+	}
+	records := make([][]byte, numRecords)
+	for i := range records {
+		if i < len(impus) {
+			if impus[i] == "" {
+				return nil, fmt.Errorf("IMPU %d is empty", i+1)
+			}
+			if n := len(EncodeTLVString(impus[i])); n > recordSize {
+				return nil, fmt.Errorf("IMPU %d needs %d bytes, record size is %d", i+1, n, recordSize)
+			}
+			records[i] = EncodeIMPU(impus[i], recordSize)
+			continue
+		}
+		records[i] = bytes.Repeat([]byte{0xFF}, recordSize)
+	}
+	return records, nil
+}
+
 // EncodeDomain encodes Home Network Domain Name
 // Format: TLV with tag 0x80
 func EncodeDomain(domain string, fileSize int) []byte {
@@ -267,22 +303,29 @@ func ClearFPLMN(size int) []byte {
 const (
 	UST_LOCAL_PHONEBOOK      = 1
 	UST_FDN                  = 2
+	UST_BDN                  = 6
 	UST_SMS                  = 10
 	UST_MSISDN               = 21
 	UST_GSM_ACCESS           = 27
 	UST_DATA_DOWNLOAD_SMS_PP = 28
 	UST_CALL_CONTROL         = 30
 	UST_MO_SMS_CONTROL       = 31
+	UST_ACL                  = 35 // APN Control List (EF_ACL)
+	UST_MBDN                 = 47 // Mailbox dialling numbers (EF_MBDN, EF_MBI, EF_EXT6)
+	UST_MWIS                 = 48 // Message waiting indication status (EF_MWIS)
 	UST_GBA                  = 67
 	UST_IMS_CALL_DISCONNECT  = 87 // VoLTE indicator
 	UST_EPDG_CONFIG          = 89 // ePDG for VoWiFi
 	UST_EPDG_CONFIG_PLMN     = 90
 	UST_EPDG_EMERGENCY       = 93
+	UST_NAS_CONFIG           = 100 // EF_NASCONFIG
 	UST_5G_NAS_CONFIG        = 104
 	UST_5G_NSSAI             = 108
 	UST_SMS_OVER_IP          = 111 // Not standard, check card
 	UST_SUCI_CALCULATION     = 112
 	UST_WLAN_OFFLOADING      = 124 // VoWiFi
+	UST_FROM_PREFERRED       = 131 // EF_FROMPREFERRED
+	UST_SOR_CMCI             = 132 // EF_SOR-CMCI in DF_5GS
 
 	IST_PCSCF_ADDRESS     = 1
 	IST_GBA               = 2
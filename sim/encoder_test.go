@@ -1,6 +1,8 @@
 package sim
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -131,6 +133,14 @@ func TestEncodeTLVString(t *testing.T) {
 				return len(data) == 2 && data[0] == 0x80 && data[1] == 0
 			},
 		},
+		{
+			name: "Long form length",
+			s:    strings.Repeat("a", 130),
+			check: func(data []byte) bool {
+				return len(data) == 133 && data[0] == 0x80 && data[1] == 0x81 && data[2] == 130 &&
+					DecodeIMPU(data) == strings.Repeat("a", 130)
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -253,6 +263,48 @@ func TestEncodeIMPU(t *testing.T) {
 	}
 }
 
+func TestEncodeIMPURecords(t *testing.T) {
+	impus := []string{"tel:+79001234567", "sip:250880000000017@ims.mnc088.mcc250.3gppnetwork.org"}
+
+	records, err := EncodeIMPURecords(impus, 64, 3)
+	if err != nil {
+		t.Fatalf("EncodeIMPURecords() error = %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("EncodeIMPURecords() returned %d records, want 3", len(records))
+	}
+	for i, rec := range records {
+		if len(rec) != 64 {
+			t.Errorf("record %d length = %d, want 64", i+1, len(rec))
+		}
+	}
+	if DecodeIMPU(records[0]) != impus[0] || DecodeIMPU(records[1]) != impus[1] {
+		t.Errorf("records decode to %q, %q", DecodeIMPU(records[0]), DecodeIMPU(records[1]))
+	}
+	if !bytes.Equal(records[2], bytes.Repeat([]byte{0xFF}, 64)) {
+		t.Errorf("surplus record = %X, want all FF", records[2])
+	}
+
+	errTests := []struct {
+		name       string
+		impus      []string
+		recordSize int
+		numRecords int
+	}{
+		{"Too many IMPUs", []string{"a", "b", "c", "d"}, 64, 3},
+		{"IMPU too long", []string{strings.Repeat("x", 63)}, 64, 3},
+		{"Empty IMPU", []string{"tel:1", ""}, 64, 3},
+		{"No structure", []string{"tel:1"}, 0, 0},
+	}
+	for _, tc := range errTests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := EncodeIMPURecords(tc.impus, tc.recordSize, tc.numRecords); err == nil {
+				t.Errorf("EncodeIMPURecords() should fail")
+			}
+		})
+	}
+}
+
 func TestEncodeDomain(t *testing.T) {
 	domain := "ims.mnc088.mcc250.3gppnetwork.org"
 	maxLen := 64
@@ -0,0 +1,170 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// ESTService is a service of EF_EST, the Enabled Services Table of the USIM (TS 31.102
+// 4.2.47). An EST service only takes effect while its UST service is available.
+type ESTService int
+
+const (
+	EST_FDN ESTService = 1
+	EST_BDN ESTService = 2
+	EST_ACL ESTService = 3 // APN Control List enabled
+)
+
+// estUSTService is the UST service that makes each EST service available
+var estUSTService = map[ESTService]int{EST_FDN: UST_FDN, EST_BDN: UST_BDN, EST_ACL: UST_ACL}
+
+// ESTServiceNames are the service names accepted by ParseESTServices
+var ESTServiceNames = map[string]ESTService{"fdn": EST_FDN, "bdn": EST_BDN, "acl": EST_ACL}
+
+// String returns the service name from ESTServices
+func (s ESTService) String() string {
+	if name, ok := ESTServices[int(s)]; ok {
+		return name
+	}
+	return fmt.Sprintf("EST service %d", int(s))
+}
+
+// ParseESTServices parses a list like "fdn=0,acl=1"; services are given by name (fdn, bdn,
+// acl) or number, the value is 1 (enable) or 0 (disable)
+func ParseESTServices(spec string) (map[ESTService]bool, error) {
+	services := make(map[ESTService]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid EST setting %q: expected service=0|1", item)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		service, known := ESTServiceNames[key]
+		if !known {
+			n, err := strconv.Atoi(key)
+			if err != nil || n < 1 || n > 8*16 {
+				return nil, fmt.Errorf("unknown EST service %q (use %s or a number)", key, strings.Join(estServiceNameList(), ", "))
+			}
+			service = ESTService(n)
+		}
+		switch strings.TrimSpace(value) {
+		case "1":
+			services[service] = true
+		case "0":
+			services[service] = false
+		default:
+			return nil, fmt.Errorf("invalid EST setting %q: value must be 0 or 1", item)
+		}
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no EST services given")
+	}
+	return services, nil
+}
+
+func estServiceNameList() []string {
+	names := make([]string, 0, len(ESTServiceNames))
+	for name := range ESTServiceNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetESTService enables or disables one EST service
+func SetESTService(reader *card.Reader, service ESTService, enabled bool) error {
+	return SetESTServices(reader, map[ESTService]bool{service: enabled})
+}
+
+// SetESTServices enables or disables EST services in one update. Enabling a service whose
+// UST service is not available is refused, since the UE would ignore it.
+func SetESTServices(reader *card.Reader, services map[ESTService]bool) error {
+	var needUST []ESTService
+	for service, enabled := range services {
+		if _, ok := estUSTService[service]; ok && enabled {
+			needUST = append(needUST, service)
+		}
+	}
+	if len(needUST) > 0 {
+		resp, err := SelectUSIMWithAuth(reader)
+		if err != nil {
+			return fmt.Errorf("failed to select USIM: %w", err)
+		}
+		if !resp.IsOK() {
+			return fmt.Errorf("USIM selection failed: %s", resp.SWString())
+		}
+		ust := DecodeUST(readTransparentEF(reader, []byte{0x6F, 0x38}))
+		for _, service := range needUST {
+			if n := estUSTService[service]; !ust[n] {
+				return fmt.Errorf("cannot enable %s: UST service %d (%s) is not available", service, n, USTServices[n])
+			}
+		}
+	}
+
+	bits := make(map[int]bool, len(services))
+	for service, enabled := range services {
+		bits[int(service)] = enabled
+	}
+	return updateServiceTable(reader, []byte{0x6F, 0x56}, "EST", bits)
+}
+
+// AccessDeniedError is an update refused by the card (6982) with the access condition of
+// the file and the credentials of it that were not given
+type AccessDeniedError struct {
+	File    string   // EF_EST, EF_UST, ...
+	Status  string   // status word text
+	Needs   string   // credential expression: ADM1, PIN2, PIN1/ADM1 ("/" = any, "&" = all)
+	Missing []string // credentials of Needs that were not given
+}
+
+func (e *AccessDeniedError) Error() string {
+	if len(e.Missing) == 0 {
+		return fmt.Sprintf("%s update refused (%s): it requires %s, which was given but not accepted for this file", e.File, e.Status, e.Needs)
+	}
+	return fmt.Sprintf("%s update refused (%s): it requires %s, not given: %s", e.File, e.Status, e.Needs, strings.Join(e.Missing, ", "))
+}
+
+// updateAccessNeeds returns the credential expression of the UPDATE access condition in the
+// FCP of the selected EF, resolving an EF_ARR reference from the current DF. ok is false
+// when the condition is unknown.
+func updateAccessNeeds(reader *card.Reader, fcp []byte) (string, bool) {
+	_, access := parseFCPSecurityAttributes(fcp)
+	if strings.HasPrefix(access, "ARR#") {
+		var n int
+		fmt.Sscanf(access, "ARR#%d", &n)
+		rec, ok := readARRTable(reader, []byte{0x6F, 0x06})[n]
+		if !ok {
+			return "", false
+		}
+		access = rec.WriteAccess
+	}
+	needs, assumed, ok := snapshotCredential(access)
+	if !ok || assumed || needs == CredentialNone {
+		return "", false
+	}
+	return needs, true
+}
+
+// missingCredentials returns the credentials of a credential expression that were not given
+// (PIN1 is taken as verified); nil when the expression is met
+func missingCredentials(needs string) []string {
+	given := StoredCredentials(true)
+	if given.Satisfies(needs) {
+		return nil
+	}
+	var missing []string
+	for _, part := range strings.FieldsFunc(needs, func(r rune) bool { return r == '/' || r == '&' }) {
+		if !given[part] {
+			missing = append(missing, part)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,82 @@
+package sim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ EF_EST TESTS ============
+
+func TestParseESTServices(t *testing.T) {
+	got, err := ParseESTServices("fdn=0, ACL=1,5=1")
+	if err != nil {
+		t.Fatalf("ParseESTServices() error = %v", err)
+	}
+	want := map[ESTService]bool{EST_FDN: false, EST_ACL: true, 5: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseESTServices() = %v, want %v", got, want)
+	}
+
+	for _, spec := range []string{"", "fdn", "fdn=2", "xyz=1", "0=1"} {
+		if _, err := ParseESTServices(spec); err == nil {
+			t.Errorf("ParseESTServices(%q) accepted", spec)
+		}
+	}
+}
+
+// newESTTestCard returns a card with UST services 2 (FDN) and 35 (ACL) available and an
+// EF_EST whose update needs PIN2 (1234); updates are refused until PIN2 is verified
+func newESTTestCard(est byte) (*card.Reader, *card.MockFile) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	adf := m.AddADF(AID_USIM)
+	adf.AddEF(0x6F38, []byte{0x02, 0x00, 0x00, 0x00, 0x04, 0x00})
+	estEF := adf.AddEF(0x6F56, []byte{est})
+	estEF.Security = []byte{0x10, 0x02} // UPDATE: PIN2
+	m.Keys[card.PIN_PIN2] = []byte("1234")
+
+	pin2 := false
+	m.Override = func(apdu []byte) []byte {
+		switch {
+		case apdu[1] == 0x20 && apdu[3] == card.PIN_PIN2 && len(apdu) > 5:
+			pin2 = string(apdu[5:9]) == "1234"
+		case apdu[1] == 0xD6 && !pin2:
+			return []byte{0x69, 0x82}
+		}
+		return nil
+	}
+	return card.NewReaderWithTransport("Mock", m.ATR, m), estEF
+}
+
+func TestSetESTServices(t *testing.T) {
+	defer SetPIN2("")
+	reader, estEF := newESTTestCard(0x01)
+
+	SetPIN2("")
+	err := SetESTServices(reader, map[ESTService]bool{EST_FDN: false, EST_ACL: true})
+	var denied *AccessDeniedError
+	if !errors.As(err, &denied) || denied.Needs != "PIN2" || !reflect.DeepEqual(denied.Missing, []string{"PIN2"}) {
+		t.Fatalf("SetESTServices() without PIN2 error = %v, want PIN2 missing", err)
+	}
+	if estEF.Data[0] != 0x01 {
+		t.Errorf("EST = %02X after a refused update", estEF.Data[0])
+	}
+
+	SetPIN2("1234")
+	if err := SetESTServices(reader, map[ESTService]bool{EST_FDN: false, EST_ACL: true}); err != nil {
+		t.Fatalf("SetESTServices() error = %v", err)
+	}
+	if estEF.Data[0] != 0x04 {
+		t.Errorf("EST = %02X, want 04", estEF.Data[0])
+	}
+
+	// BDN (UST service 6) is not available on this card
+	if err := SetESTService(reader, EST_BDN, true); err == nil {
+		t.Error("SetESTService(BDN) enabled a service the UST does not offer")
+	}
+	if err := SetESTService(reader, EST_BDN, false); err != nil {
+		t.Errorf("SetESTService(BDN, false) error = %v", err)
+	}
+}
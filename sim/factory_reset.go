@@ -0,0 +1,345 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// Factory reset: the card is brought back to a golden config, the --json export of a
+// pristine card of the same profile. The subscription files are written with ApplyConfig,
+// the service tables and EF_FPLMN get the values of the golden card, the registration
+// state (LOCI, PSLOCI, EPSLOCI) and the security contexts are invalidated, and SMS and
+// phonebook records are emptied. Identity and secrets (ICCID, Ki, OPc, PINs) stay with
+// the card.
+
+// "Deleted" registration state (TS 31.102 4.2.17, 4.2.23, 4.2.51): no TMSI/GUTI, the
+// deleted LAI/RAI/TAI (LAC/TAC FFFE) and update status "not updated"
+var (
+	resetLOCI    = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE, 0xFF, 0x01}
+	resetPSLOCI  = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE, 0xFF, 0x01}
+	resetEPSLOCI = append(bytes.Repeat([]byte{0xFF}, 12), 0xFF, 0xFF, 0xFF, 0xFF, 0xFE, 0x01)
+)
+
+// factoryResetPhonebookFiles are the DF_PHONEBOOK files emptied by a reset, by EF_PBR tag.
+// Index and group files (IAP, PBC, GRP, UID, ...) keep their content.
+var factoryResetPhonebookFiles = map[byte]bool{
+	PBRTagADN: true, PBRTagANR: true, PBRTagEMAIL: true, PBRTagSNE: true, PBRTagEXT1: true,
+}
+
+// FactoryResetResult is the outcome of FactoryReset
+type FactoryResetResult struct {
+	Apply   *ApplyReport      `json:"report"`
+	Keys    []KeyInvalidation `json:"keys"`
+	Skipped []SnapshotSkip    `json:"skipped"`
+}
+
+// factoryResetFile is an EF written by FactoryReset besides the golden config. content
+// returns the reset content for the EF described by fcp, or the reason it is left alone.
+type factoryResetFile struct {
+	fid     uint16
+	name    string
+	content func(fcp []byte) (SnapshotFile, error)
+}
+
+// FactoryReset restores every file the golden config describes and creds can write, then
+// clears FPLMN (or sets the golden list), the location files and the security contexts and
+// empties SMS and phonebook. Files that need a credential not in creds are not written
+// and returned in Skipped, as are the golden fields that cannot be reset (ICCID, keys).
+// The writes go through the reader, so a dry-run reader previews the reset.
+func FactoryReset(reader *card.Reader, golden *SIMConfig, creds Credentials) (*FactoryResetResult, error) {
+	if UseGSMCommands {
+		return nil, fmt.Errorf("factory reset needs a UICC (GSM-only card)")
+	}
+	DetectApplicationAIDs(reader)
+
+	config, skipped := factoryResetConfig(golden)
+	result := &FactoryResetResult{Skipped: skipped}
+
+	// Fields whose file cannot be written with creds are dropped from the config
+	for _, c := range CheckWriteAccess(reader, factoryResetTargets(config), creds).Checks {
+		reason := ""
+		switch {
+		case c.Blocking() && c.Credential == "":
+			reason = fmt.Sprintf("not writable (%s)", c.Access)
+		case c.Blocking():
+			reason = "requires " + c.Credential
+		case !c.Resolved && c.Note == "file not found":
+			reason = "file not present"
+		default:
+			continue
+		}
+		dropConfigTarget(config, c.Item)
+		result.Skipped = append(result.Skipped, SnapshotSkip{Name: c.File, Application: c.Application, Reason: reason})
+	}
+
+	report, _ := ApplyConfig(reader, config, false, false)
+	result.Apply = report
+
+	for _, app := range copyApplications() {
+		files := factoryResetFiles(golden, app.name)
+		if app.name == PhonebookUSIM {
+			if app.selectFn(reader) != nil {
+				continue
+			}
+			files = factoryResetPBRFiles(reader)
+		}
+		if len(files) == 0 {
+			continue
+		}
+		result.Skipped = append(result.Skipped, resetApplicationFiles(reader, report, app, files, creds)...)
+	}
+
+	result.Keys = append(InvalidateSecurityContexts(reader), InvalidateFiveGSecurityContexts(reader)...)
+	if err := report.Err(); err != nil {
+		return result, err
+	}
+	for _, k := range result.Keys {
+		if k.Status == KeysFailed {
+			return result, fmt.Errorf("%s: %s", k.Name, k.Detail)
+		}
+	}
+	return result, nil
+}
+
+// factoryResetConfig returns the part of the golden config that ApplyConfig writes in a
+// reset, and the golden fields that are left alone
+func factoryResetConfig(golden *SIMConfig) (*SIMConfig, []SnapshotSkip) {
+	config := &SIMConfig{
+		MSISDN:        golden.MSISDN,
+		IMSI:          golden.IMSI,
+		SPN:           golden.SPN,
+		MCC:           golden.MCC,
+		MNC:           golden.MNC,
+		PSISMSC:       golden.PSISMSC,
+		SMS:           golden.SMS,
+		OperationMode: golden.OperationMode,
+		HPLMN:         golden.HPLMN,
+		OPLMN:         golden.OPLMN,
+		UserPLMN:      golden.UserPLMN,
+	}
+	if golden.ISIM != nil {
+		isim := *golden.ISIM
+		config.ISIM = &isim
+	}
+
+	var skipped []SnapshotSkip
+	if golden.ICCID != "" {
+		skipped = append(skipped, SnapshotSkip{Name: "EF_ICCID", Application: "MF", Reason: "card identity, stays with the card"})
+	}
+	if golden.HasProgrammableFields() || golden.ADM1 != "" || golden.ACCHex != "" {
+		skipped = append(skipped, SnapshotSkip{Name: "Ki, OPc, PINs, ADM keys", Application: "-",
+			Reason: "secrets and card settings are not reset"})
+	}
+	return config, skipped
+}
+
+// factoryResetTargets returns the files written by ApplyConfig for the reset config
+func factoryResetTargets(config *SIMConfig) []WriteTarget {
+	targets := ConfigWriteTargets(config)
+	if config.MSISDN != "" {
+		targets = append(targets, USIMWriteTarget("MSISDN", 0x6F40))
+	}
+	return targets
+}
+
+// dropConfigTarget removes the fields of the reset config written by the target item
+func dropConfigTarget(config *SIMConfig, item string) {
+	switch item {
+	case "IMSI":
+		config.IMSI = ""
+	case "SPN":
+		config.SPN = ""
+	case "PSI SMSC":
+		config.PSISMSC = ""
+	case "SMS parameters":
+		config.SMS = nil
+	case "Administrative data":
+		config.MNC, config.OperationMode = "", ""
+	case "HPLMN":
+		config.HPLMN = nil
+	case "OPLMN":
+		config.OPLMN = nil
+	case "User PLMN":
+		config.UserPLMN = nil
+	case "MSISDN":
+		config.MSISDN = ""
+	}
+	if isim := config.ISIM; isim != nil {
+		switch item {
+		case "IMPI":
+			isim.IMPI = ""
+		case "Domain":
+			isim.Domain = ""
+		case "IMPU":
+			isim.IMPU = nil
+		case "P-CSCF":
+			isim.PCSCF = nil
+		}
+	}
+}
+
+// factoryResetFiles returns the files of an application reset outside ApplyConfig
+func factoryResetFiles(golden *SIMConfig, app string) []factoryResetFile {
+	var tables ServiceTablesExport
+	if golden.ServiceTables != nil {
+		tables = *golden.ServiceTables
+	}
+	switch app {
+	case "ADF_USIM":
+		files := []factoryResetFile{
+			{0x6F7B, "EF_FPLMN", fplmnResetContent(golden.FPLMN)},
+			{0x6F7E, "EF_LOCI", fixedResetContent(resetLOCI)},
+			{0x6F73, "EF_PSLOCI", fixedResetContent(resetPSLOCI)},
+			{0x6FE3, "EF_EPSLOCI", fixedResetContent(resetEPSLOCI)},
+			{0x6F3C, "EF_SMS", emptyRecordsContent(0x00)},
+			{0x6F3A, "EF_ADN", emptyRecordsContent(0xFF)},
+		}
+		if tables.UST != "" {
+			files = append(files, factoryResetFile{0x6F38, "EF_UST", tableResetContent(tables.UST)})
+		}
+		return files
+	case "ADF_ISIM":
+		files := []factoryResetFile{{0x6F3C, "EF_SMS", emptyRecordsContent(0x00)}}
+		if tables.IST != "" && golden.ISIM != nil {
+			files = append(files, factoryResetFile{0x6F07, "EF_IST", tableResetContent(tables.IST)})
+		}
+		return files
+	case "DF_TELECOM":
+		return []factoryResetFile{
+			{0x6F3A, "EF_ADN", emptyRecordsContent(0xFF)},
+			{0x6F4A, "EF_EXT1", emptyRecordsContent(0xFF)},
+			{0x6F3C, "EF_SMS", emptyRecordsContent(0x00)},
+		}
+	}
+	return nil
+}
+
+// factoryResetPBRFiles returns the phonebook files of the selected DF_PHONEBOOK to empty
+func factoryResetPBRFiles(reader *card.Reader) []factoryResetFile {
+	pbr, ok := readLinearEF(reader, FID_EF_PBR)
+	if !ok {
+		return nil
+	}
+	var files []factoryResetFile
+	seen := make(map[uint16]bool)
+	for _, rec := range pbr {
+		for _, f := range ParsePBRRecord(rec) {
+			id := uint16(f.FID[0])<<8 | uint16(f.FID[1])
+			if !factoryResetPhonebookFiles[f.Tag] || seen[id] {
+				continue
+			}
+			seen[id] = true
+			files = append(files, factoryResetFile{id, fmt.Sprintf("%s %04X", pbrFileNames[f.Tag], id), emptyRecordsContent(0xFF)})
+		}
+	}
+	return files
+}
+
+// resetApplicationFiles writes the reset content of files in one application, with the
+// same access checks as WriteCardCopy, and returns the files left alone. Applications and
+// files the card does not have are passed over silently.
+func resetApplicationFiles(reader *card.Reader, report *ApplyReport, app snapshotApplication, files []factoryResetFile, creds Credentials) []SnapshotSkip {
+	if app.selectFn(reader) != nil {
+		return nil
+	}
+	arr := readARRTable(reader, app.arrFID)
+	if err := app.selectFn(reader); err != nil {
+		report.failed(reader, app.name, err)
+		return nil
+	}
+
+	var skipped []SnapshotSkip
+
+	for _, f := range files {
+		skip := func(reason string) {
+			skipped = append(skipped, SnapshotSkip{Name: f.name, Application: app.name, Reason: reason})
+		}
+		resp, err := reader.Select([]byte{byte(f.fid >> 8), byte(f.fid)})
+		if err != nil || !resp.IsOK() {
+			continue
+		}
+		writeAccess := resolveWriteAccess(resp.Data, arr)
+		credential, _, ok := snapshotCredential(writeAccess)
+		if !ok {
+			skip(fmt.Sprintf("not writable (%s)", writeAccess))
+			continue
+		}
+		if !creds.Satisfies(credential) {
+			skip(fmt.Sprintf("requires %s", credential))
+			continue
+		}
+		content, err := f.content(resp.Data)
+		if err != nil {
+			skip(err.Error())
+			continue
+		}
+		content.Name = app.name + "/" + f.name
+		content.FID = fmt.Sprintf("%04X", f.fid)
+		restoreSnapshotFile(reader, report, content)
+	}
+	return skipped
+}
+
+// fixedResetContent resets a transparent EF of exactly len(data) bytes to data
+func fixedResetContent(data []byte) func(fcp []byte) (SnapshotFile, error) {
+	return func(fcp []byte) (SnapshotFile, error) {
+		if size := parseFCPFileSize(fcp); size != len(data) {
+			return SnapshotFile{}, fmt.Errorf("file size %d, expected %d", size, len(data))
+		}
+		return SnapshotFile{Structure: "transparent", Data: strings.ToUpper(hex.EncodeToString(data))}, nil
+	}
+}
+
+// tableResetContent resets a service table to the golden value (hex), fitted to the EF
+func tableResetContent(value string) func(fcp []byte) (SnapshotFile, error) {
+	return func(fcp []byte) (SnapshotFile, error) {
+		data, err := hex.DecodeString(value)
+		if err != nil {
+			return SnapshotFile{}, fmt.Errorf("invalid golden value %q", value)
+		}
+		// Services beyond the golden table are not available: pad with 00, not FF
+		size := parseFCPFileSize(fcp)
+		if len(data) > size {
+			if !bytes.Equal(data[size:], make([]byte, len(data)-size)) {
+				return SnapshotFile{}, fmt.Errorf("golden table has %d bytes, the file only %d", len(data), size)
+			}
+			data = data[:size]
+		}
+		data = append(data, make([]byte, size-len(data))...)
+		return SnapshotFile{Structure: "transparent", Data: strings.ToUpper(hex.EncodeToString(data))}, nil
+	}
+}
+
+// fplmnResetContent resets EF_FPLMN to the golden list (MCC+MNC strings), empty entries FF
+func fplmnResetContent(plmns []string) func(fcp []byte) (SnapshotFile, error) {
+	return func(fcp []byte) (SnapshotFile, error) {
+		size := parseFCPFileSize(fcp)
+		if len(plmns)*3 > size {
+			return SnapshotFile{}, fmt.Errorf("EF_FPLMN holds %d entries, golden list has %d", size/3, len(plmns))
+		}
+		data, _ := EncodePLMNList(plmns, size)
+		return SnapshotFile{Structure: "transparent", Data: strings.ToUpper(hex.EncodeToString(data))}, nil
+	}
+}
+
+// emptyRecordsContent empties every record of a linear fixed EF: first byte status (00 =
+// free SMS, FF for the phonebook), the rest FF
+func emptyRecordsContent(status byte) func(fcp []byte) (SnapshotFile, error) {
+	return func(fcp []byte) (SnapshotFile, error) {
+		size, count := parseFCPRecordSize(fcp), parseFCPNumRecords(fcp)
+		if fcpStructure(fcp) != "linear" || size <= 0 || count <= 0 {
+			return SnapshotFile{}, fmt.Errorf("not a record file")
+		}
+		empty := bytes.Repeat([]byte{0xFF}, size)
+		empty[0] = status
+		records := make([]string, count)
+		for i := range records {
+			records[i] = strings.ToUpper(hex.EncodeToString(empty))
+		}
+		return SnapshotFile{Structure: "linear", Records: records}, nil
+	}
+}
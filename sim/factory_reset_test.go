@@ -0,0 +1,130 @@
+package sim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ FACTORY RESET TESTS ============
+
+// newFactoryResetTestCard returns a used card with ADM1 = "12345678": a changed IMSI,
+// a forbidden PLMN, a registration in EF_LOCI, an SMS, a phonebook entry and a security
+// context. EF_SPN needs ADM2.
+func newFactoryResetTestCard(t *testing.T) *card.MockCard {
+	t.Helper()
+	saved := StoredADMKey
+	StoredADMKey = []byte("12345678")
+	t.Cleanup(func() { StoredADMKey = saved })
+	adm1 := []byte{0x30, 0x0A, 0x00}
+
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.Keys[0x0A] = []byte("12345678")
+	m.MF().AddEF(0x2FE2, []byte{0x98, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10, 0x32, 0x54, 0xF6})
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, []byte{0x08, 0x09, 0x10, 0x10, 0x99, 0x99, 0x99, 0x99, 0x99}).Security = adm1
+	usim.AddEF(0x6F46, []byte{0x00, 'U', 'S', 'E', 'D'}).Security = []byte{0x30, 0x0B, 0x00}
+	usim.AddEF(0x6F7B, []byte{0x62, 0xF2, 0x10, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}).Security = adm1
+	usim.AddEF(0x6F7E, []byte{0x12, 0x34, 0x56, 0x78, 0x62, 0xF2, 0x10, 0x00, 0x01, 0xFF, 0x00}).Security = adm1
+	usim.AddEF(0x6F38, []byte{0xFF, 0xFF, 0xFF, 0xFF}).Security = adm1
+	usim.AddEF(0x6F08, bytes.Repeat([]byte{0x11}, 33)).Security = adm1
+	usim.AddRecordEF(0x6F3C, append([]byte{0x01}, bytes.Repeat([]byte{0x22}, 9)...), append([]byte{0x00}, bytes.Repeat([]byte{0xFF}, 9)...)).Security = adm1
+	pb := usim.AddDF(0x5F3A)
+	pb.AddRecordEF(0x4F30, []byte{0xA8, 0x05, 0xC0, 0x03, 0x4F, 0x3A, 0x01})
+	pb.AddRecordEF(0x4F3A, adnRecord("Ann", []byte{0x21, 0x43}, 0xFF), bytes.Repeat([]byte{0xFF}, 18)).Security = adm1
+	return m
+}
+
+func TestFactoryReset(t *testing.T) {
+	m := newFactoryResetTestCard(t)
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	golden := &SIMConfig{
+		ICCID:         "89103254769810325476",
+		IMSI:          "001010000000001",
+		SPN:           "Golden",
+		Ki:            "000102030405060708090A0B0C0D0E0F",
+		ServiceTables: &ServiceTablesExport{UST: "0F03"},
+	}
+
+	result, err := FactoryReset(reader, golden, Credentials{CredentialNone: true, CredentialPIN1: true, CredentialADM1: true})
+	if err != nil {
+		t.Fatalf("FactoryReset() error = %v (report %+v)", err, result.Apply.Items)
+	}
+
+	usim := m.MF().Children[1]
+	file := func(i int) *card.MockFile { return usim.Children[i] }
+	if want, _ := EncodeIMSI(golden.IMSI); !bytes.Equal(file(0).Data, want) {
+		t.Errorf("IMSI = %X, want %X", file(0).Data, want)
+	}
+	if file(1).Data[1] != 'U' {
+		t.Errorf("SPN = %X, want it untouched (ADM2)", file(1).Data)
+	}
+	if !isEmptyRecord(file(2).Data) {
+		t.Errorf("FPLMN = %X, want cleared", file(2).Data)
+	}
+	if !bytes.Equal(file(3).Data, resetLOCI) {
+		t.Errorf("LOCI = %X, want %X", file(3).Data, resetLOCI)
+	}
+	if !bytes.Equal(file(4).Data, []byte{0x0F, 0x03, 0x00, 0x00}) {
+		t.Errorf("UST = %X, want the golden table padded with 00", file(4).Data)
+	}
+	if file(5).Data[0] != keyNotAvailable {
+		t.Errorf("EF_KEYS = %X, want KSI 07", file(5).Data)
+	}
+	if sms := file(6).Records; sms[0][0] != 0x00 || !isEmptyRecord(sms[0][1:]) {
+		t.Errorf("SMS = %X, want emptied", sms)
+	}
+	if adn := usim.Children[7].Children[1].Records; !isEmptyRecord(adn[0]) {
+		t.Errorf("phonebook ADN = %X, want emptied", adn)
+	}
+
+	reasons := map[string]string{}
+	for _, s := range result.Skipped {
+		reasons[s.Name] = s.Reason
+	}
+	if reasons["EF_SPN"] != "requires ADM2" || !strings.Contains(reasons["EF_ICCID"], "identity") || reasons["Ki, OPc, PINs, ADM keys"] == "" {
+		t.Errorf("skipped = %+v", result.Skipped)
+	}
+}
+
+func TestFactoryReset_Idempotent(t *testing.T) {
+	m := newFactoryResetTestCard(t)
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	golden := &SIMConfig{IMSI: "001010000000001", FPLMN: []string{"26201"}}
+	creds := Credentials{CredentialNone: true, CredentialPIN1: true, CredentialADM1: true}
+
+	if _, err := FactoryReset(reader, golden, creds); err != nil {
+		t.Fatalf("first reset: %v", err)
+	}
+	if got := DecodePLMNList(m.MF().Children[1].Children[2].Data); len(got) != 1 || got[0] != "26201" {
+		t.Errorf("FPLMN = %v, want the golden list", got)
+	}
+
+	result, err := FactoryReset(reader, golden, creds)
+	if err != nil {
+		t.Fatalf("second reset: %v", err)
+	}
+	if result.Apply.Applied != 0 {
+		t.Errorf("second reset applied %d items, want none: %+v", result.Apply.Applied, result.Apply.Items)
+	}
+}
+
+func TestFactoryReset_DryRun(t *testing.T) {
+	m := newFactoryResetTestCard(t)
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	reader.SetDryRun(true)
+	before := append([]byte(nil), m.MF().Children[1].Children[3].Data...)
+
+	result, err := FactoryReset(reader, &SIMConfig{IMSI: "001010000000001"}, Credentials{CredentialNone: true, CredentialADM1: true})
+	if err != nil {
+		t.Fatalf("FactoryReset() error = %v", err)
+	}
+	if result.Apply.Applied != 0 || result.Apply.DryRun == 0 {
+		t.Errorf("dry run report = %+v", result.Apply)
+	}
+	if !bytes.Equal(m.MF().Children[1].Children[3].Data, before) {
+		t.Error("dry run wrote EF_LOCI")
+	}
+}
@@ -0,0 +1,227 @@
+package sim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"sim_reader/card"
+)
+
+// FileMapVersion is the format version written by FileMap.Save
+const FileMapVersion = 1
+
+// DefaultFileMapMaxAge is how long a saved file map is trusted
+const DefaultFileMapMaxAge = 7 * 24 * time.Hour
+
+// ErrFileMapStale is returned by LoadFileMap for a map that is too old or was taken from
+// a card with another ATR
+var ErrFileMapStale = errors.New("file map is stale")
+
+// FileMap is the structure of one card: which EFs exist in each directory with their
+// structure, size and access conditions. It never holds file contents. While a map is
+// active (UseFileMap) every EF selection consults and extends it: files known to be
+// absent are not selected again.
+type FileMap struct {
+	Version     int                                `json:"version"`
+	ICCID       string                             `json:"iccid"`
+	ATR         string                             `json:"atr"`
+	Updated     string                             `json:"updated"`
+	Directories map[string]map[string]FileMapEntry `json:"directories"` // card.Reader.CurrentDF -> FID -> entry
+
+	changed bool
+	skipped int
+}
+
+// FileMapEntry is one EF of the map
+type FileMapEntry struct {
+	Present     bool   `json:"present"`
+	Structure   string `json:"structure,omitempty"` // transparent, linear, cyclic, DF
+	Size        int    `json:"size,omitempty"`
+	RecordSize  int    `json:"record_size,omitempty"`
+	ReadAccess  string `json:"read_access,omitempty"`
+	WriteAccess string `json:"write_access,omitempty"`
+}
+
+// activeFileMap is consulted by selectEFStatus (nil = no cache)
+var activeFileMap *FileMap
+
+// UseFileMap makes EF selections consult and extend m; nil disables the cache
+func UseFileMap(m *FileMap) {
+	activeFileMap = m
+}
+
+// NewFileMap returns an empty map for the card
+func NewFileMap(iccid, atr string) *FileMap {
+	return &FileMap{
+		Version:     FileMapVersion,
+		ICCID:       iccid,
+		ATR:         atr,
+		Directories: map[string]map[string]FileMapEntry{},
+	}
+}
+
+var iccidFileName = regexp.MustCompile(`^[0-9A-Fa-f]{10,20}$`)
+
+// FileMapPath returns the cache file of the card: <user cache dir>/sim_reader/<iccid>.json
+// (~/.cache/sim_reader on Linux)
+func FileMapPath(iccid string) (string, error) {
+	if !iccidFileName.MatchString(iccid) {
+		return "", fmt.Errorf("invalid ICCID %q for the file map cache", iccid)
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "sim_reader", iccid+".json"), nil
+}
+
+// LoadFileMap reads the cached map of the card. A missing file gives an error matching
+// os.ErrNotExist; a map older than maxAge (0 = no limit) or saved for another ATR gives
+// ErrFileMapStale.
+func LoadFileMap(iccid, atr string, maxAge time.Duration) (*FileMap, error) {
+	path, err := FileMapPath(iccid)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m FileMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse file map %s: %w", path, err)
+	}
+	if m.Version != FileMapVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrFileMapStale, m.Version)
+	}
+	if m.ATR != atr {
+		return nil, fmt.Errorf("%w: saved for ATR %s", ErrFileMapStale, m.ATR)
+	}
+	updated, err := time.Parse(time.RFC3339, m.Updated)
+	if err != nil {
+		return nil, fmt.Errorf("parse file map %s: %w", path, err)
+	}
+	if maxAge > 0 && time.Since(updated) > maxAge {
+		return nil, fmt.Errorf("%w: updated %s", ErrFileMapStale, m.Updated)
+	}
+	if m.Directories == nil {
+		m.Directories = map[string]map[string]FileMapEntry{}
+	}
+	return &m, nil
+}
+
+// Save writes the map to its cache file
+func (m *FileMap) Save() (string, error) {
+	path, err := FileMapPath(m.ICCID)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	m.Updated = time.Now().Format(time.RFC3339)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return "", err
+	}
+	m.changed = false
+	return path, nil
+}
+
+// Changed reports whether files were added to the map since it was loaded or saved
+func (m *FileMap) Changed() bool {
+	return m.changed
+}
+
+// Skipped returns the number of selections answered from the map
+func (m *FileMap) Skipped() int {
+	return m.skipped
+}
+
+// Files returns the number of files in the map
+func (m *FileMap) Files() int {
+	n := 0
+	for _, dir := range m.Directories {
+		n += len(dir)
+	}
+	return n
+}
+
+// Lookup returns the entry of fid in the directory dir (see card.Reader.CurrentDF)
+func (m *FileMap) Lookup(dir string, fid uint16) (FileMapEntry, bool) {
+	e, ok := m.Directories[dir][fmt.Sprintf("%04X", fid)]
+	return e, ok
+}
+
+// record stores the entry of fid in dir
+func (m *FileMap) record(dir string, fid uint16, e FileMapEntry) {
+	files := m.Directories[dir]
+	if files == nil {
+		files = map[string]FileMapEntry{}
+		m.Directories[dir] = files
+	}
+	key := fmt.Sprintf("%04X", fid)
+	if old, ok := files[key]; ok && old == e {
+		return
+	}
+	files[key] = e
+	m.changed = true
+}
+
+// fileMapDir returns the current directory when a file map is active, "" otherwise
+func fileMapDir(reader *card.Reader) string {
+	if activeFileMap == nil {
+		return ""
+	}
+	return reader.CurrentDF()
+}
+
+// fileMapSkip reports whether the active map knows fid to be absent from dir
+func fileMapSkip(dir string, fileID uint16) bool {
+	if dir == "" {
+		return false
+	}
+	if e, ok := activeFileMap.Lookup(dir, fileID); ok && !e.Present {
+		activeFileMap.skipped++
+		return true
+	}
+	return false
+}
+
+// fileMapObserve records the outcome of selecting fid in dir
+func fileMapObserve(dir string, fileID uint16, resp *card.APDUResponse, st EFStatus) {
+	if dir == "" {
+		return
+	}
+	switch st.State {
+	case EFAbsent:
+		activeFileMap.record(dir, fileID, FileMapEntry{})
+	case EFPresent:
+		e := FileMapEntry{Present: true}
+		if !UseGSMCommands && resp != nil {
+			e.Structure = fcpStructure(resp.Data)
+			e.Size = parseFCPFileSize(resp.Data)
+			e.RecordSize = parseFCPRecordSize(resp.Data)
+			e.ReadAccess, e.WriteAccess = parseFCPSecurityAttributes(resp.Data)
+		}
+		activeFileMap.record(dir, fileID, e)
+	}
+}
+
+// fileMapRecordSize returns the record size of fid in the current directory from the active map
+func fileMapRecordSize(reader *card.Reader, fileID uint16) int {
+	dir := fileMapDir(reader)
+	if dir == "" {
+		return 0
+	}
+	e, _ := activeFileMap.Lookup(dir, fileID)
+	return e.RecordSize
+}
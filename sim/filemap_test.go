@@ -0,0 +1,114 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"sim_reader/card"
+)
+
+// ============ FILE MAP CACHE TESTS ============
+
+func fileMapTestCard() (*card.MockCard, *card.Reader) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddEF(0x2FE2, []byte{0x98, 0x44, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xF0})
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, []byte{0x08, 0x29, 0x05, 0x88, 0x00, 0x00, 0x00, 0x00, 0x10})
+	usim.AddRecordEF(0x6F40, make([]byte, 30), make([]byte, 30))
+	return m, card.NewReaderWithTransport("Mock", m.ATR, m)
+}
+
+func countSelects(log [][]byte, fid uint16) int {
+	n := 0
+	for _, apdu := range log {
+		if len(apdu) == 7 && apdu[1] == 0xA4 && apdu[5] == byte(fid>>8) && apdu[6] == byte(fid) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFileMap_SkipsAbsentFiles(t *testing.T) {
+	m, reader := fileMapTestCard()
+	fm := NewFileMap("89440000000000000000", reader.ATRHex())
+	UseFileMap(fm)
+	defer UseFileMap(nil)
+
+	if _, err := ReadUSIM(reader); err != nil {
+		t.Fatalf("ReadUSIM() error = %v", err)
+	}
+	if !fm.Changed() || fm.Files() == 0 {
+		t.Fatalf("file map not filled: %d files", fm.Files())
+	}
+	dir := fmt.Sprintf("ADF:%X", AID_USIM)
+	if e, ok := fm.Lookup(dir, 0x6F40); !ok || !e.Present || e.Structure != "linear" || e.RecordSize != 30 {
+		t.Errorf("EF_MSISDN entry = %+v, %v", e, ok)
+	}
+	if e, ok := fm.Lookup(dir, 0x6F46); !ok || e.Present {
+		t.Errorf("EF_SPN entry = %+v, %v; want known absent", e, ok)
+	}
+	if countSelects(m.Log, 0x6F46) != 1 {
+		t.Fatalf("EF_SPN selected %d times in the first read", countSelects(m.Log, 0x6F46))
+	}
+
+	m.Log = nil
+	usim, err := ReadUSIM(reader)
+	if err != nil {
+		t.Fatalf("second ReadUSIM() error = %v", err)
+	}
+	if n := countSelects(m.Log, 0x6F46); n != 0 {
+		t.Errorf("EF_SPN selected %d times with the map, want 0", n)
+	}
+	if fm.Skipped() == 0 {
+		t.Error("Skipped() = 0 after a read with the map")
+	}
+	if usim.IMSI == "" || !usim.Files.Absent("EF_SPN") {
+		t.Errorf("second read: IMSI %q, EF_SPN absent %v", usim.IMSI, usim.Files.Absent("EF_SPN"))
+	}
+}
+
+func TestFileMap_SaveLoad(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	iccid, atr := "8944000000000000000F", "3B00"
+	if _, err := LoadFileMap(iccid, atr, 0); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("LoadFileMap(missing) error = %v, want not exist", err)
+	}
+
+	fm := NewFileMap(iccid, atr)
+	fm.record("ADF:A0000000871002", 0x6F46, FileMapEntry{})
+	fm.record("3F00", 0x2FE2, FileMapEntry{Present: true, Structure: "transparent", Size: 10})
+	path, err := fm.Save()
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if fm.Changed() {
+		t.Error("Changed() after Save()")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("cache file %s: %v, %v", path, info, err)
+	}
+
+	got, err := LoadFileMap(iccid, atr, time.Hour)
+	if err != nil {
+		t.Fatalf("LoadFileMap() error = %v", err)
+	}
+	if e, ok := got.Lookup("3F00", 0x2FE2); !ok || e.Size != 10 || got.Files() != 2 {
+		t.Errorf("loaded map: %+v (%d files)", got.Directories, got.Files())
+	}
+
+	if _, err := LoadFileMap(iccid, "3B01", time.Hour); !errors.Is(err, ErrFileMapStale) {
+		t.Errorf("LoadFileMap(other ATR) error = %v, want stale", err)
+	}
+	if _, err := LoadFileMap(iccid, atr, time.Nanosecond); !errors.Is(err, ErrFileMapStale) {
+		t.Errorf("LoadFileMap(expired) error = %v, want stale", err)
+	}
+
+	if _, err := FileMapPath("../../etc/passwd"); err == nil {
+		t.Error("FileMapPath() accepted a path as ICCID")
+	}
+}
@@ -38,6 +38,9 @@ var (
 	StoredADMKey2 []byte // ADM2 (0x0B) - ADM_B
 	StoredADMKey3 []byte // ADM3 (0x0C) - ADM_C
 	StoredADMKey4 []byte // ADM4 (0x0D) - ADM_D
+
+	// Stored PIN2 for PIN2-protected files (EF_FDN, EF_ACM, EF_ACMmax, EF_PUCT)
+	StoredPIN2 string
 )
 
 // SetADMKey stores the ADM1 key for re-authentication after SELECT AID
@@ -70,18 +73,36 @@ func ClearADMKey() {
 	StoredADMKey2 = nil
 	StoredADMKey3 = nil
 	StoredADMKey4 = nil
+	verifiedADMProfiles = map[int]card.ADMVerifyProfile{}
+	preferredADMProfiles = map[int]card.ADMVerifyProfile{}
+}
+
+// SetPIN2 stores PIN2 for writes to PIN2-protected files
+func SetPIN2(pin string) {
+	StoredPIN2 = pin
+}
+
+// verifyStoredPIN2 verifies the stored PIN2 on the selected application
+func verifyStoredPIN2(reader *card.Reader) error {
+	if StoredPIN2 == "" {
+		return fmt.Errorf("PIN2 is required but not set")
+	}
+	return reader.VerifyPIN2(StoredPIN2)
 }
 
 // SelectUSIMWithAuth selects USIM application and re-authenticates with all ADM keys
 // Returns the response from SELECT for FCP parsing if needed
 func SelectUSIMWithAuth(reader *card.Reader) (*card.APDUResponse, error) {
+	if IsClassicSIM() {
+		return nil, ErrClassicSIM
+	}
 	var resp *card.APDUResponse
 	var err error
 
 	// Try selecting by AID first (ISO CLA=00)
 	resp, err = reader.Select(GetUSIMAID())
-	if err != nil || !(resp.IsOK() || resp.HasMoreData()) {
-		// Try standard USIM AID (7 bytes) if detected AID differs
+	if (err != nil || !(resp.IsOK() || resp.HasMoreData())) && usimFallbackAllowed() {
+		// Try standard USIM AID (7 bytes) if detected AID differs, unless the AID was given explicitly
 		resp, err = reader.Select(AID_USIM)
 	}
 
@@ -104,23 +125,12 @@ func SelectUSIMWithAuth(reader *card.Reader) (*card.APDUResponse, error) {
 		return nil, fmt.Errorf("failed to select USIM: %w", err)
 	}
 	if !(resp.IsOK() || resp.HasMoreData()) {
-		return nil, fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
+		return nil, fmt.Errorf("USIM selection failed: %s", resp.SWString())
 	}
 
 	// Re-authenticate with all available ADM keys
 	// Different files may require different ADM levels
-	if len(StoredADMKey) > 0 {
-		reader.VerifyADM1(StoredADMKey) // Ignore errors - some keys may not be needed
-	}
-	if len(StoredADMKey2) > 0 {
-		reader.VerifyADM2(StoredADMKey2)
-	}
-	if len(StoredADMKey3) > 0 {
-		reader.VerifyADM3(StoredADMKey3)
-	}
-	if len(StoredADMKey4) > 0 {
-		reader.VerifyADM4(StoredADMKey4)
-	}
+	reauthenticateADM(reader)
 
 	return resp, nil
 }
@@ -128,13 +138,16 @@ func SelectUSIMWithAuth(reader *card.Reader) (*card.APDUResponse, error) {
 // SelectISIMWithAuth selects ISIM application and re-authenticates with all ADM keys
 // Returns the response from SELECT for FCP parsing if needed
 func SelectISIMWithAuth(reader *card.Reader) (*card.APDUResponse, error) {
+	if IsClassicSIM() {
+		return nil, ErrClassicSIM
+	}
 	var resp *card.APDUResponse
 	var err error
 
 	// Try selecting by AID first (ISO CLA=00)
 	resp, err = reader.Select(GetISIMAID())
-	if err != nil || !(resp.IsOK() || resp.HasMoreData()) {
-		// Try standard ISIM AID (7 bytes)
+	if (err != nil || !(resp.IsOK() || resp.HasMoreData())) && isimFallbackAllowed() {
+		// Try standard ISIM AID (7 bytes), unless a specific ISIM instance or AID was selected
 		resp, err = reader.Select(AID_ISIM)
 	}
 
@@ -155,23 +168,12 @@ func SelectISIMWithAuth(reader *card.Reader) (*card.APDUResponse, error) {
 		return nil, fmt.Errorf("failed to select ISIM: %w", err)
 	}
 	if !(resp.IsOK() || resp.HasMoreData()) {
-		return nil, fmt.Errorf("ISIM selection failed: %s", card.SWToString(resp.SW()))
+		return nil, fmt.Errorf("ISIM selection failed: %s", resp.SWString())
 	}
 
 	// Re-authenticate with all available ADM keys
 	// Different files may require different ADM levels
-	if len(StoredADMKey) > 0 {
-		reader.VerifyADM1(StoredADMKey)
-	}
-	if len(StoredADMKey2) > 0 {
-		reader.VerifyADM2(StoredADMKey2)
-	}
-	if len(StoredADMKey3) > 0 {
-		reader.VerifyADM3(StoredADMKey3)
-	}
-	if len(StoredADMKey4) > 0 {
-		reader.VerifyADM4(StoredADMKey4)
-	}
+	reauthenticateADM(reader)
 
 	return resp, nil
 }
@@ -244,6 +246,7 @@ var USIM_Files = map[uint16]EFDefinition{
 	// Service tables
 	0x6F38: {0x6F38, "EF_UST", "USIM Service Table", FileTypeTransparent, 0, "ADF_USIM"},
 	0x6F56: {0x6F56, "EF_EST", "Enabled Services Table", FileTypeTransparent, 0, "ADF_USIM"},
+	0x6F57: {0x6F57, "EF_ACL", "Access Point Name Control List", FileTypeTransparent, 0, "ADF_USIM"},
 
 	// Network files
 	0x6F61: {0x6F61, "EF_OPLMNwACT", "Operator Controlled PLMN with Access Technology", FileTypeTransparent, 0, "ADF_USIM"},
@@ -257,6 +260,8 @@ var USIM_Files = map[uint16]EFDefinition{
 	// EPS/LTE files
 	0x6FE3: {0x6FE3, "EF_EPSLOCI", "EPS Location Information", FileTypeTransparent, 0, "ADF_USIM"},
 	0x6FE4: {0x6FE4, "EF_EPSNSC", "EPS NAS Security Context", FileTypeTransparent, 0, "ADF_USIM"},
+	0x6FE8: {0x6FE8, "EF_NASCONFIG", "Non Access Stratum Configuration", FileTypeTransparent, 0, "ADF_USIM"},
+	0x6FF7: {0x6FF7, "EF_FROMPREFERRED", "From Preferred (steering of roaming)", FileTypeTransparent, 0, "ADF_USIM"},
 
 	// 5G NR files
 	0x6F5C: {0x6F5C, "EF_5GS3GPPLOCI", "5GS 3GPP Location Information", FileTypeTransparent, 0, "ADF_USIM"},
@@ -269,10 +274,18 @@ var USIM_Files = map[uint16]EFDefinition{
 	// Phonebook
 	0x6F3A: {0x6F3A, "EF_ADN", "Abbreviated Dialling Numbers", FileTypeLinearFixed, 0, "ADF_USIM"},
 	0x6F3B: {0x6F3B, "EF_FDN", "Fixed Dialling Numbers", FileTypeLinearFixed, 0, "ADF_USIM"},
+	0x6F4D: {0x6F4D, "EF_BDN", "Barred Dialling Numbers", FileTypeLinearFixed, 0, "ADF_USIM"},
+	0x6F55: {0x6F55, "EF_EXT4", "Extension 4 (BDN)", FileTypeLinearFixed, 0, "ADF_USIM"},
 	0x6F3C: {0x6F3C, "EF_SMS", "Short Messages", FileTypeLinearFixed, 0, "ADF_USIM"},
 	0x6F42: {0x6F42, "EF_SMSP", "SMS Parameters", FileTypeLinearFixed, 0, "ADF_USIM"},
 	0x6F43: {0x6F43, "EF_SMSS", "SMS Status", FileTypeTransparent, 0, "ADF_USIM"},
 
+	// Voicemail
+	0x6FC7: {0x6FC7, "EF_MBDN", "Mailbox Dialling Numbers", FileTypeLinearFixed, 0, "ADF_USIM"},
+	0x6FC8: {0x6FC8, "EF_EXT6", "Extension 6 (MBDN)", FileTypeLinearFixed, 0, "ADF_USIM"},
+	0x6FC9: {0x6FC9, "EF_MBI", "Mailbox Identifier", FileTypeLinearFixed, 0, "ADF_USIM"},
+	0x6FCA: {0x6FCA, "EF_MWIS", "Message Waiting Indication Status", FileTypeLinearFixed, 0, "ADF_USIM"},
+
 	// Other
 	0x6FC4: {0x6FC4, "EF_NETPAR", "Network Parameters", FileTypeTransparent, 0, "ADF_USIM"},
 	0x6F17: {0x6F17, "EF_RP", "Roaming Preference", FileTypeTransparent, 0, "ADF_USIM"},
@@ -424,6 +437,8 @@ var USTServices = map[int]string{
 	126: "HPLMN Direct Access",
 	127: "MCPTT Group Configuration",
 	128: "MCData Group Configuration",
+	131: "From Preferred (steering of roaming)",
+	132: "SOR-CMCI storage in USIM",
 }
 
 // IST Service bits - ISIM Service Table (3GPP TS 31.103)
@@ -440,6 +455,34 @@ var ISTServices = map[int]string{
 	10: "MCVideo",
 	11: "MCData",
 	12: "Voice domain preference",
+	13: "IMS call disconnection cause",
+	14: "URI support for MO SHORT MESSAGE CONTROL",
+	15: "MCPTT",
+	16: "URI support for SMS-PP DOWNLOAD",
+	17: "From Preferred",
+	18: "IMS configuration data",
+	19: "XCAP Configuration Data",
+	20: "WebRTC URI",
+	21: "MuD and MiD configuration data",
+}
+
+// EST Service bits - Enabled Services Table (3GPP TS 31.102 4.2.47)
+var ESTServices = map[int]string{
+	1: "Fixed Dialling Numbers (FDN)",
+	2: "Barred Dialling Numbers (BDN)",
+	3: "APN Control List (ACL)",
+}
+
+// serviceTables are the service names of each service table
+var serviceTables = map[string]map[int]string{"UST": USTServices, "EST": ESTServices, "IST": ISTServices}
+
+// ServiceName returns the name of service num of a service table (UST, EST, IST), or
+// "Service N (unknown)" for a number the tool has no name for
+func ServiceName(table string, num int) string {
+	if name, ok := serviceTables[table][num]; ok {
+		return name
+	}
+	return fmt.Sprintf("Service %d (unknown)", num)
 }
 
 // GetAllFiles returns all file definitions
@@ -0,0 +1,391 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"sim_reader/card"
+	"sim_reader/tlv"
+)
+
+// DF_5GS files (TS 31.102 4.4.11). EF_5GS3GPPNSC/EF_5GSN3GPPNSC hold the 5G NAS security
+// context of the last registration over 3GPP/non-3GPP access, one context per record, as
+// a TLV object 'A0' with ngKSI (80), K_AMF (81), uplink (82) and downlink (83) NAS COUNT,
+// the selected NAS algorithms (84) and the EPS NAS algorithms for mobility to EPS (85).
+// EF_OPL5G maps tracking area ranges to EF_PNN records. ngKSI 07 means "no key available".
+
+const (
+	dfFiveGS         = 0x5FC0
+	efFiveGS3GPPNSC  = 0x4F03
+	efFiveGSN3GPPNSC = 0x4F04
+	efSUCICalcInfo   = 0x4F07
+	efOPL5G          = 0x4F08
+)
+
+// fiveGSNSCFiles are the 5G NAS security context EFs in DF_5GS
+var fiveGSNSCFiles = []struct {
+	name string
+	fid  uint16
+}{
+	{"EF_5GS3GPPNSC", efFiveGS3GPPNSC},
+	{"EF_5GSN3GPPNSC", efFiveGSN3GPPNSC},
+}
+
+// opl5GRecordLen is the size of an EF_OPL5G record: TAI (PLMN 3 + TAC range 3+3) + PNN record 1
+const opl5GRecordLen = 10
+
+// FiveGSecurityContext is one record of EF_5GS3GPPNSC or EF_5GSN3GPPNSC
+type FiveGSecurityContext struct {
+	File          string
+	Record        int
+	NgKSI         byte
+	KAMF          []byte
+	UplinkCount   uint32
+	DownlinkCount uint32
+	Algorithms    byte // 5G NAS: ciphering (bits 8-5), integrity (bits 4-1)
+	EPSAlgorithms byte // EPS NAS after mobility to EPS, same coding
+	HasEPSAlgs    bool
+	Raw           []byte
+	Err           error // layout not recognized: Raw is shown as hex
+}
+
+// Valid reports whether the record holds a usable context (ngKSI other than 07)
+func (c FiveGSecurityContext) Valid() bool {
+	return c.Err == nil && c.NgKSI&0x07 != keyNotAvailable
+}
+
+// OPL5GEntry is one record of EF_OPL5G
+type OPL5GEntry struct {
+	Record    int
+	MCC       string
+	MNC       string
+	TACStart  string // hex, 3 bytes
+	TACEnd    string
+	PNNRecord int // record of EF_PNN with the network name, 0 = name from other sources
+	Raw       []byte
+	Err       error
+}
+
+// FiveGData is the content of the 5G files read with --show-5g-context
+type FiveGData struct {
+	Status        EFStatus // selection of DF_5GS
+	Contexts      []FiveGSecurityContext
+	ContextStatus map[string]EFStatus // per NSC file
+	OPL5G         []OPL5GEntry
+	OPL5GStatus   EFStatus
+}
+
+// DecodeFiveGSNSC decodes a 5G NAS security context record. The 57-byte layout of TS 31.102
+// and larger records (long length form, FF padding, additional data objects) are accepted.
+func DecodeFiveGSNSC(data []byte) (FiveGSecurityContext, error) {
+	var c FiveGSecurityContext
+	if len(data) < 2 || data[0] != 0xA0 {
+		return c, fmt.Errorf("no 5G NAS security context object (tag A0)")
+	}
+	length, n := parseTLVLength(data, 1)
+	if n == 0 || 1+n+length > len(data) {
+		return c, fmt.Errorf("5G NAS security context object length %d exceeds record", length)
+	}
+	body := data[1+n : 1+n+length]
+
+	seen := make(map[byte]bool)
+	for i := 0; i < len(body); {
+		tag := body[i]
+		if tag == 0xFF {
+			break // padding
+		}
+		l, ln := parseTLVLength(body, i+1)
+		start := i + 1 + ln
+		if ln == 0 || start+l > len(body) {
+			return c, fmt.Errorf("truncated data object %02X", tag)
+		}
+		v := body[start : start+l]
+		switch tag {
+		case 0x80:
+			if l != 1 {
+				return c, fmt.Errorf("ngKSI has %d bytes", l)
+			}
+			c.NgKSI = v[0]
+		case 0x81:
+			c.KAMF = append([]byte(nil), v...)
+		case 0x82, 0x83:
+			if l == 0 || l > 4 {
+				return c, fmt.Errorf("NAS COUNT has %d bytes", l)
+			}
+			count := binary.BigEndian.Uint32(append(make([]byte, 4-l), v...))
+			if tag == 0x82 {
+				c.UplinkCount = count
+			} else {
+				c.DownlinkCount = count
+			}
+		case 0x84:
+			if l != 1 {
+				return c, fmt.Errorf("NAS algorithm identifiers have %d bytes", l)
+			}
+			c.Algorithms = v[0]
+		case 0x85:
+			if l != 1 {
+				return c, fmt.Errorf("EPS NAS algorithm identifiers have %d bytes", l)
+			}
+			c.EPSAlgorithms, c.HasEPSAlgs = v[0], true
+		}
+		seen[tag] = true
+		i = start + l
+	}
+	if !seen[0x80] {
+		return c, fmt.Errorf("ngKSI missing")
+	}
+	if c.NgKSI&0x07 != keyNotAvailable && len(c.KAMF) != 32 {
+		return c, fmt.Errorf("K_AMF has %d bytes, need 32", len(c.KAMF))
+	}
+	return c, nil
+}
+
+// FormatNASAlgorithms returns the ciphering and integrity algorithms of a NAS security
+// algorithms octet (TS 24.501 9.11.3.34), e.g. 5G-EA2/5G-IA2 or EEA2/EIA2 for EPS
+func FormatNASAlgorithms(b byte, eps bool) string {
+	enc, integ := "5G-EA", "5G-IA"
+	if eps {
+		enc, integ = "EEA", "EIA"
+	}
+	return fmt.Sprintf("%s%d/%s%d", enc, b>>4&0x07, integ, b&0x07)
+}
+
+// DecodeOPL5G decodes an EF_OPL5G record; ok is false for an unused (FF) record
+func DecodeOPL5G(data []byte) (entry OPL5GEntry, ok bool, err error) {
+	if isEmptyRecord(data) {
+		return entry, false, nil
+	}
+	if len(data) < opl5GRecordLen {
+		return entry, true, fmt.Errorf("EF_OPL5G record has %d bytes, need %d", len(data), opl5GRecordLen)
+	}
+	entry.MCC, entry.MNC = DecodePLMN(data[:3])
+	entry.TACStart = fmt.Sprintf("%X", data[3:6])
+	entry.TACEnd = fmt.Sprintf("%X", data[6:9])
+	entry.PNNRecord = int(data[9])
+	return entry, true, nil
+}
+
+// SUCICalcInfo is the content of EF_SUCI_Calc_Info (TS 31.102 4.4.11.8): the protection
+// schemes in order of priority (object A0) and the home network public keys (object A1)
+type SUCICalcInfo struct {
+	Schemes []SUCIScheme
+	Keys    []SUCIKey
+}
+
+// SUCIScheme is one protection scheme identifier with the index of its key in Keys; key
+// index 0 is used by the null scheme
+type SUCIScheme struct {
+	ID       byte
+	KeyIndex int
+}
+
+// SUCIKey is a home network public key (81) with its identifier (80)
+type SUCIKey struct {
+	ID  byte
+	Key []byte
+}
+
+// Name returns the protection scheme name of TS 33.501 Annex C
+func (s SUCIScheme) Name() string {
+	switch s.ID {
+	case 0:
+		return "null"
+	case 1:
+		return "Profile A"
+	case 2:
+		return "Profile B"
+	}
+	return fmt.Sprintf("scheme %d", s.ID)
+}
+
+// DecodeSUCICalcInfo decodes EF_SUCI_Calc_Info; nil if the file holds no object. The
+// value of A0 is a list of byte pairs, not BER-TLV, so the top level is walked here.
+func DecodeSUCICalcInfo(data []byte) (*SUCICalcInfo, error) {
+	var info *SUCICalcInfo
+	for pos := 0; pos < len(data) && data[pos] != 0xFF; {
+		if pos+2 > len(data) {
+			return info, fmt.Errorf("offset %d: missing length", pos)
+		}
+		tag, length, hdr := data[pos], int(data[pos+1]), 2
+		if length == 0x81 && pos+2 < len(data) {
+			length, hdr = int(data[pos+2]), 3
+		}
+		if pos+hdr+length > len(data) {
+			return info, fmt.Errorf("tag %02X: length %d exceeds remaining %d bytes", tag, length, len(data)-pos-hdr)
+		}
+		value := data[pos+hdr : pos+hdr+length]
+		pos += hdr + length
+		if info == nil {
+			info = &SUCICalcInfo{}
+		}
+
+		switch tag {
+		case 0xA0:
+			if len(value)%2 != 0 {
+				return info, fmt.Errorf("protection scheme list has %d bytes, expected pairs", len(value))
+			}
+			for i := 0; i < len(value); i += 2 {
+				info.Schemes = append(info.Schemes, SUCIScheme{ID: value[i], KeyIndex: int(value[i+1])})
+			}
+		case 0xA1:
+			nodes, err := tlv.Parse(value)
+			if err != nil {
+				return info, fmt.Errorf("home network public key list: %w", err)
+			}
+			for _, n := range nodes {
+				switch n.Tag {
+				case 0x80:
+					if len(n.Value) != 1 {
+						return info, fmt.Errorf("home network public key identifier has %d bytes", len(n.Value))
+					}
+					info.Keys = append(info.Keys, SUCIKey{ID: n.Value[0]})
+				case 0x81:
+					if len(info.Keys) == 0 || info.Keys[len(info.Keys)-1].Key != nil {
+						return info, fmt.Errorf("home network public key without identifier")
+					}
+					info.Keys[len(info.Keys)-1].Key = n.Value
+				}
+			}
+		}
+	}
+	return info, nil
+}
+
+// selectDF5GS selects ADF_USIM and DF_5GS
+func selectDF5GS(reader *card.Reader) EFStatus {
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return EFStatus{State: EFError, Err: fmt.Errorf("failed to select USIM: %w", err)}
+	}
+	if !resp.IsOK() {
+		return EFStatus{State: EFError, SW: resp.SW(), Err: fmt.Errorf("USIM selection failed: %s", resp.SWString())}
+	}
+	_, st := selectEFStatus(reader, dfFiveGS)
+	return st
+}
+
+// readRecordEF selects a linear fixed EF of the current DF and reads all its records
+func readRecordEF(reader *card.Reader, fid uint16) ([][]byte, EFStatus) {
+	resp, st := selectEFStatus(reader, fid)
+	if st.State != EFPresent {
+		return nil, st
+	}
+	recLen := parseFCPRecordSize(resp.Data)
+	count := parseFCPNumRecords(resp.Data)
+	if recLen <= 0 || count <= 0 {
+		return nil, EFStatus{State: EFError, Err: fmt.Errorf("0x%04X is not a record file", fid)}
+	}
+	var records [][]byte
+	for i := 1; i <= count; i++ {
+		rd, err := reader.ReadRecord(byte(i), byte(recLen))
+		if err != nil {
+			return records, EFStatus{State: EFError, Err: err}
+		}
+		if !rd.IsOK() {
+			return records, EFStatus{State: EFError, SW: rd.SW(), Err: fmt.Errorf("read record %d of 0x%04X failed: %s", i, fid, rd.SWString())}
+		}
+		records = append(records, rd.Data)
+	}
+	return records, st
+}
+
+// ReadFiveGData reads the 5G NAS security contexts and EF_OPL5G from DF_5GS
+func ReadFiveGData(reader *card.Reader) *FiveGData {
+	data := &FiveGData{ContextStatus: make(map[string]EFStatus)}
+	if data.Status = selectDF5GS(reader); data.Status.State != EFPresent {
+		return data
+	}
+
+	for _, f := range fiveGSNSCFiles {
+		selectDF5GS(reader)
+		records, st := readRecordEF(reader, f.fid)
+		data.ContextStatus[f.name] = st
+		for i, rec := range records {
+			if isEmptyRecord(rec) {
+				continue
+			}
+			c, err := DecodeFiveGSNSC(rec)
+			c.File, c.Record, c.Raw, c.Err = f.name, i+1, rec, err
+			data.Contexts = append(data.Contexts, c)
+		}
+	}
+
+	selectDF5GS(reader)
+	records, st := readRecordEF(reader, efOPL5G)
+	data.OPL5GStatus = st
+	for i, rec := range records {
+		entry, ok, err := DecodeOPL5G(rec)
+		if !ok {
+			continue
+		}
+		entry.Record, entry.Raw, entry.Err = i+1, rec, err
+		data.OPL5G = append(data.OPL5G, entry)
+	}
+	return data
+}
+
+// invalidFiveGSNSC returns the "no key available" record: an 'A0' object holding only
+// ngKSI 07, padded with FF
+func invalidFiveGSNSC(recLen int) []byte {
+	data := bytes.Repeat([]byte{0xFF}, recLen)
+	copy(data, []byte{0xA0, 0x03, 0x80, 0x01, keyNotAvailable})
+	return data
+}
+
+// InvalidateFiveGSecurityContexts writes the "no key available" pattern (ngKSI 07) to every
+// record of EF_5GS3GPPNSC and EF_5GSN3GPPNSC so that the UE runs a fresh 5G authentication,
+// analogous to InvalidateSecurityContexts. Absent and write-protected files are skipped.
+func InvalidateFiveGSecurityContexts(reader *card.Reader) []KeyInvalidation {
+	results := make([]KeyInvalidation, 0, len(fiveGSNSCFiles))
+	for _, f := range fiveGSNSCFiles {
+		results = append(results, invalidateFiveGSNSC(reader, f.name, f.fid)...)
+	}
+	return results
+}
+
+func invalidateFiveGSNSC(reader *card.Reader, name string, fid uint16) []KeyInvalidation {
+	res := KeyInvalidation{Name: name}
+	st := selectDF5GS(reader)
+	var resp *card.APDUResponse
+	if st.State == EFPresent {
+		resp, st = selectEFStatus(reader, fid)
+	}
+	switch st.State {
+	case EFAbsent:
+		res.Status, res.Detail = KeysSkipped, "not on this card"
+		return []KeyInvalidation{res}
+	case EFError:
+		res.Status, res.Detail = KeysFailed, st.Err.Error()
+		return []KeyInvalidation{res}
+	}
+
+	recLen := parseFCPRecordSize(resp.Data)
+	count := parseFCPNumRecords(resp.Data)
+	if recLen < 5 || count <= 0 {
+		res.Status, res.Detail = KeysSkipped, fmt.Sprintf("record size %d, expected at least 5", recLen)
+		return []KeyInvalidation{res}
+	}
+
+	pattern := invalidFiveGSNSC(recLen)
+	var results []KeyInvalidation
+	for i := 1; i <= count; i++ {
+		res := KeyInvalidation{Name: fmt.Sprintf("%s #%d", name, i)}
+		resp, err := reader.UpdateRecord(byte(i), pattern)
+		switch {
+		case err != nil:
+			res.Status, res.Detail = KeysFailed, err.Error()
+		case resp.SW() == card.SW_SECURITY_NOT_SATISFIED || resp.SW() == 0x6985 || resp.SW() == 0x9804:
+			res.Status, res.Detail = KeysSkipped, fmt.Sprintf("write-protected: %s", resp.SWString())
+		case !resp.IsOK():
+			res.Status, res.Detail = KeysFailed, resp.SWString()
+		case reader.DryRun():
+			res.Status, res.Detail = KeysDryRun, fmt.Sprintf("would write %X", pattern)
+		default:
+			res.Status, res.Detail = KeysInvalidated, fmt.Sprintf("%X", pattern)
+		}
+		results = append(results, res)
+	}
+	return results
+}
@@ -0,0 +1,184 @@
+package sim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ 5G NAS SECURITY CONTEXT TESTS ============
+
+// fiveGSNSCRecord returns a 57-byte EF_5GS3GPPNSC record (TS 31.102 4.4.11.4)
+func fiveGSNSCRecord(ngKSI byte) []byte {
+	rec := []byte{0xA0, 0x37, 0x80, 0x01, ngKSI, 0x81, 0x20}
+	rec = append(rec, bytes.Repeat([]byte{0x5A}, 32)...)
+	rec = append(rec, 0x82, 0x04, 0x00, 0x00, 0x01, 0x02)
+	rec = append(rec, 0x83, 0x04, 0x00, 0x00, 0x00, 0x07)
+	rec = append(rec, 0x84, 0x01, 0x22)
+	rec = append(rec, 0x85, 0x01, 0x11)
+	return rec
+}
+
+func TestDecodeFiveGSNSC(t *testing.T) {
+	rec := fiveGSNSCRecord(0x01)
+	if len(rec) != 57 {
+		t.Fatalf("fixture has %d bytes, want 57", len(rec))
+	}
+	c, err := DecodeFiveGSNSC(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Valid() || c.NgKSI != 0x01 || len(c.KAMF) != 32 || c.UplinkCount != 0x102 || c.DownlinkCount != 7 {
+		t.Errorf("DecodeFiveGSNSC() = %+v", c)
+	}
+	if got := FormatNASAlgorithms(c.Algorithms, false); got != "5G-EA2/5G-IA2" {
+		t.Errorf("algorithms = %s", got)
+	}
+	if got := FormatNASAlgorithms(c.EPSAlgorithms, true); !c.HasEPSAlgs || got != "EEA1/EIA1" {
+		t.Errorf("EPS algorithms = %s (%v)", got, c.HasEPSAlgs)
+	}
+
+	// Larger record: long length form, an unknown data object and FF padding
+	body := append([]byte{0x86, 0x02, 0xAB, 0xCD}, fiveGSNSCRecord(0x02)[2:]...)
+	large := append([]byte{0xA0, 0x81, byte(len(body))}, body...)
+	large = append(large, bytes.Repeat([]byte{0xFF}, 20)...)
+	if c, err := DecodeFiveGSNSC(large); err != nil || c.NgKSI != 0x02 || c.DownlinkCount != 7 {
+		t.Errorf("DecodeFiveGSNSC(large) = %+v, %v", c, err)
+	}
+
+	// "No key available" needs no K_AMF
+	if c, err := DecodeFiveGSNSC(invalidFiveGSNSC(57)); err != nil || c.Valid() {
+		t.Errorf("DecodeFiveGSNSC(invalid pattern) = %+v, %v", c, err)
+	}
+
+	for name, data := range map[string][]byte{
+		"no A0":     {0x80, 0x01, 0x01},
+		"truncated": fiveGSNSCRecord(0x01)[:40],
+		"no ngKSI":  {0xA0, 0x03, 0x84, 0x01, 0x22},
+		"short key": {0xA0, 0x07, 0x80, 0x01, 0x01, 0x81, 0x02, 0x01, 0x02},
+	} {
+		if _, err := DecodeFiveGSNSC(data); err == nil {
+			t.Errorf("%s: DecodeFiveGSNSC(%X) accepted", name, data)
+		}
+	}
+}
+
+func TestDecodeOPL5G(t *testing.T) {
+	entry, ok, err := DecodeOPL5G([]byte{0x00, 0xF1, 0x10, 0x00, 0x00, 0x01, 0x00, 0xFF, 0xFE, 0x02})
+	if err != nil || !ok || entry.MCC != "001" || entry.MNC != "01" ||
+		entry.TACStart != "000001" || entry.TACEnd != "00FFFE" || entry.PNNRecord != 2 {
+		t.Errorf("DecodeOPL5G() = %+v, %v, %v", entry, ok, err)
+	}
+	if _, ok, _ := DecodeOPL5G(bytes.Repeat([]byte{0xFF}, 10)); ok {
+		t.Error("unused record decoded")
+	}
+	if _, ok, err := DecodeOPL5G([]byte{0x00, 0xF1, 0x10}); !ok || err == nil {
+		t.Error("short record accepted")
+	}
+}
+
+func TestDecodeSUCICalcInfo(t *testing.T) {
+	key := bytes.Repeat([]byte{0xAB}, 32)
+	data := append(mustHex("A00401010200A1258001018120"), key...)
+	data = append(data, 0xFF, 0xFF)
+	info, err := DecodeSUCICalcInfo(data)
+	if err != nil || info == nil || len(info.Schemes) != 2 || len(info.Keys) != 1 {
+		t.Fatalf("DecodeSUCICalcInfo() = %+v, %v", info, err)
+	}
+	if info.Schemes[0].Name() != "Profile A" || info.Schemes[0].KeyIndex != 1 || info.Schemes[1].Name() != "Profile B" {
+		t.Errorf("Schemes = %+v", info.Schemes)
+	}
+	if info.Keys[0].ID != 1 || !bytes.Equal(info.Keys[0].Key, key) {
+		t.Errorf("Keys = %+v", info.Keys)
+	}
+
+	if info, err := DecodeSUCICalcInfo(bytes.Repeat([]byte{0xFF}, 8)); info != nil || err != nil {
+		t.Errorf("empty file = %+v, %v; want nil", info, err)
+	}
+	for name, data := range map[string][]byte{
+		"odd scheme list": mustHex("A003010100"),
+		"key without id":  mustHex("A1038101AA"),
+		"length past end": mustHex("A00601"),
+		"two byte key id": mustHex("A10480020101"),
+	} {
+		if _, err := DecodeSUCICalcInfo(data); err == nil {
+			t.Errorf("%s: DecodeSUCICalcInfo(%X) accepted", name, data)
+		}
+	}
+}
+
+// newFiveGTestCard returns a USIM with DF_5GS: a valid 3GPP context, a record of unknown
+// layout in the non-3GPP file and one EF_OPL5G entry
+func newFiveGTestCard() (*card.Reader, *card.MockFile) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	df := m.AddADF(AID_USIM).AddDF(0x5FC0)
+	nsc := df.AddRecordEF(0x4F03, fiveGSNSCRecord(0x01))
+	unknown := append([]byte{0x30, 0x03, 0x01, 0x02, 0x03}, bytes.Repeat([]byte{0xFF}, 52)...)
+	df.AddRecordEF(0x4F04, unknown, bytes.Repeat([]byte{0xFF}, 57))
+	df.AddRecordEF(0x4F08,
+		[]byte{0x00, 0xF1, 0x10, 0x00, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x01},
+		bytes.Repeat([]byte{0xFF}, 10))
+	return card.NewReaderWithTransport("Mock", m.ATR, m), nsc
+}
+
+func TestReadFiveGData(t *testing.T) {
+	reader, _ := newFiveGTestCard()
+	data := ReadFiveGData(reader)
+	if data.Status.State != EFPresent {
+		t.Fatalf("DF_5GS status = %+v", data.Status)
+	}
+	if len(data.Contexts) != 2 {
+		t.Fatalf("got %d contexts, want 2 (empty records skipped): %+v", len(data.Contexts), data.Contexts)
+	}
+	if c := data.Contexts[0]; c.File != "EF_5GS3GPPNSC" || c.Record != 1 || !c.Valid() {
+		t.Errorf("3GPP context = %+v", c)
+	}
+	if c := data.Contexts[1]; c.File != "EF_5GSN3GPPNSC" || c.Err == nil || len(c.Raw) != 57 {
+		t.Errorf("non-3GPP context = %+v, want raw record with error", c)
+	}
+	if len(data.OPL5G) != 1 || data.OPL5G[0].MNC != "01" || data.OPL5G[0].PNNRecord != 1 {
+		t.Errorf("OPL5G = %+v", data.OPL5G)
+	}
+}
+
+func TestReadFiveGData_NoDF(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(AID_USIM)
+	data := ReadFiveGData(card.NewReaderWithTransport("Mock", m.ATR, m))
+	if data.Status.State != EFAbsent {
+		t.Errorf("DF_5GS status = %+v, want absent", data.Status)
+	}
+}
+
+func TestInvalidateFiveGSecurityContexts(t *testing.T) {
+	reader, nsc := newFiveGTestCard()
+
+	results := InvalidateFiveGSecurityContexts(reader)
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Name+"="+r.Status)
+	}
+	want := "EF_5GS3GPPNSC #1=invalidated EF_5GSN3GPPNSC #1=invalidated EF_5GSN3GPPNSC #2=invalidated"
+	if strings.Join(names, " ") != want {
+		t.Errorf("results = %v, want %s", names, want)
+	}
+	if !bytes.Equal(nsc.Records[0], invalidFiveGSNSC(57)) {
+		t.Errorf("EF_5GS3GPPNSC = %X", nsc.Records[0])
+	}
+	if data := ReadFiveGData(reader); data.Contexts[0].Valid() {
+		t.Error("context still valid after invalidation")
+	}
+}
+
+func TestInvalidateFiveGSecurityContexts_DryRun(t *testing.T) {
+	reader, nsc := newFiveGTestCard()
+	before := append([]byte(nil), nsc.Records[0]...)
+	reader.SetDryRun(true)
+
+	results := InvalidateFiveGSecurityContexts(reader)
+	if results[0].Status != KeysDryRun || !bytes.Equal(nsc.Records[0], before) {
+		t.Errorf("dry run: %+v, EF_5GS3GPPNSC = %X", results[0], nsc.Records[0])
+	}
+}
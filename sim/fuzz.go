@@ -0,0 +1,238 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sim_reader/card"
+)
+
+// FuzzTarget is a directory whose FIDs are probed by FuzzSelect
+type FuzzTarget struct {
+	Name string
+	Path []byte // FIDs from the MF (empty for the MF itself)
+	AID  []byte // application selected by AID instead of Path
+}
+
+// DefaultFuzzTargets returns the MF, DF_TELECOM, DF_GSM and the USIM / ISIM applications
+func DefaultFuzzTargets() []FuzzTarget {
+	targets := []FuzzTarget{
+		{Name: "MF"},
+		{Name: "DF_TELECOM", Path: []byte{0x7F, 0x10}},
+		{Name: "DF_GSM", Path: []byte{0x7F, 0x20}},
+	}
+	if aid := GetUSIMAID(); len(aid) > 0 {
+		targets = append(targets, FuzzTarget{Name: "ADF_USIM", AID: aid})
+	}
+	if aid := GetISIMAID(); len(aid) > 0 {
+		targets = append(targets, FuzzTarget{Name: "ADF_ISIM", AID: aid})
+	}
+	return targets
+}
+
+// FuzzOptions controls FuzzSelect
+type FuzzOptions struct {
+	Targets  []FuzzTarget // nil = DefaultFuzzTargets
+	First    uint16       // first FID probed
+	Last     uint16       // last FID probed (0 = FFFF)
+	Rate     int          // SELECT commands per second (0 = as fast as the card answers)
+	Progress func(target string, fid uint16)
+}
+
+// FuzzSelectReport is the map of files found by FuzzSelect. It is complete up to the
+// point where the scan stopped; Interrupted is set when it was cancelled.
+type FuzzSelectReport struct {
+	ATR         string              `json:"atr"`
+	Started     string              `json:"started"`
+	Interrupted bool                `json:"interrupted,omitempty"`
+	Error       string              `json:"error,omitempty"`
+	Selects     int                 `json:"selects"`
+	Targets     []*FuzzTargetReport `json:"targets"`
+}
+
+// FuzzTargetReport lists the FIDs of one directory that did not answer file not found
+type FuzzTargetReport struct {
+	Name     string         `json:"name"`
+	Error    string         `json:"error,omitempty"` // directory could not be selected
+	Probed   int            `json:"probed"`
+	Complete bool           `json:"complete"`
+	SWCounts map[string]int `json:"sw_counts"` // status word -> number of FIDs
+	Files    []FuzzFile     `json:"files,omitempty"`
+}
+
+// FuzzFile is one FID that answered something other than file not found
+type FuzzFile struct {
+	FID       string `json:"fid"`
+	SW        string `json:"sw"`
+	Structure string `json:"structure,omitempty"` // transparent, linear, cyclic, DF
+	Size      int    `json:"size,omitempty"`
+	Known     string `json:"known,omitempty"` // name from the file tables, empty if undocumented
+}
+
+// Undocumented returns the files found that are not in the file tables
+func (t *FuzzTargetReport) Undocumented() []FuzzFile {
+	var out []FuzzFile
+	for _, f := range t.Files {
+		if f.Known == "" && f.SW == "9000" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// FuzzSelect sends SELECT for every FID of the range in each target directory and
+// records the status words, giving a map of the files the card really has, including
+// proprietary EFs no specification lists. The reader is in read-only mode for the
+// whole scan. Cancelling ctx stops the scan; the report then holds the FIDs probed so
+// far. An error is returned with the partial report when the card stops answering.
+func FuzzSelect(ctx context.Context, reader *card.Reader, opts FuzzOptions) (*FuzzSelectReport, error) {
+	wasReadOnly := reader.ReadOnly()
+	reader.SetReadOnly(true)
+	defer reader.SetReadOnly(wasReadOnly)
+
+	targets := opts.Targets
+	if targets == nil {
+		targets = DefaultFuzzTargets()
+	}
+	last := int(opts.Last)
+	if last == 0 {
+		last = 0xFFFF
+	}
+	report := &FuzzSelectReport{
+		ATR:     reader.ATRHex(),
+		Started: time.Now().Format(time.RFC3339),
+	}
+	pace := newAPDUPacer(opts.Rate)
+
+	for _, target := range targets {
+		tr := &FuzzTargetReport{Name: target.Name, SWCounts: map[string]int{}}
+		report.Targets = append(report.Targets, tr)
+
+		if err := selectFuzzTarget(reader, target); err != nil {
+			tr.Error = err.Error()
+			continue
+		}
+		for fid := int(opts.First); fid <= last; fid++ {
+			if err := pace.wait(ctx); err != nil {
+				report.Interrupted = true
+				return report, nil
+			}
+			if opts.Progress != nil {
+				opts.Progress(target.Name, uint16(fid))
+			}
+			resp, err := reader.Select([]byte{byte(fid >> 8), byte(fid)})
+			report.Selects++
+			if err != nil {
+				report.Error = fmt.Sprintf("%s/%04X: %v", target.Name, fid, err)
+				return report, fmt.Errorf("fuzz SELECT stopped: %s", report.Error)
+			}
+			tr.Probed++
+			sw := fmt.Sprintf("%04X", resp.SW())
+			tr.SWCounts[sw]++
+			if isFileNotFound(resp.SW()) {
+				continue
+			}
+
+			file := FuzzFile{FID: fmt.Sprintf("%04X", fid), SW: sw, Known: fuzzKnownName(target.Name, uint16(fid))}
+			if resp.IsOK() {
+				file.Structure = fcpStructure(resp.Data)
+				file.Size = parseFCPFileSize(resp.Data)
+				// The FID may have moved the current directory: go back before the next probe
+				if err := selectFuzzTarget(reader, target); err != nil {
+					report.Error = fmt.Sprintf("%s: reselect after %04X: %v", target.Name, fid, err)
+					return report, fmt.Errorf("fuzz SELECT stopped: %s", report.Error)
+				}
+			}
+			tr.Files = append(tr.Files, file)
+		}
+		tr.Complete = true
+	}
+	return report, nil
+}
+
+// selectFuzzTarget makes target the current directory
+func selectFuzzTarget(reader *card.Reader, target FuzzTarget) error {
+	var resp *card.APDUResponse
+	var err error
+	switch {
+	case len(target.AID) > 0:
+		resp, err = reader.Select(target.AID)
+	case len(target.Path) > 0:
+		resp, err = reader.SelectByPath(target.Path)
+	default:
+		resp, err = reader.Select([]byte{0x3F, 0x00})
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("select %s failed: %s", target.Name, resp.SWString())
+	}
+	return nil
+}
+
+// fuzzKnownName returns the file table name of fid in the target directory
+func fuzzKnownName(target string, fid uint16) string {
+	var def EFDefinition
+	var ok bool
+	switch target {
+	case "MF":
+		def, ok = MF_Files[fid]
+	case "ADF_USIM", "DF_GSM":
+		def, ok = USIM_Files[fid]
+	case "ADF_ISIM":
+		def, ok = ISIM_Files[fid]
+	}
+	if !ok {
+		switch fid {
+		case 0x3F00:
+			return "MF"
+		case 0x7F10:
+			return "DF_TELECOM"
+		case 0x7F20:
+			return "DF_GSM"
+		case 0x7FFF:
+			return "current ADF"
+		}
+		return ""
+	}
+	return def.Name
+}
+
+// apduPacer spaces commands to at most rate per second
+type apduPacer struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newAPDUPacer(rate int) *apduPacer {
+	p := &apduPacer{}
+	if rate > 0 {
+		p.interval = time.Second / time.Duration(rate)
+	}
+	return p
+}
+
+// wait blocks until the next command may be sent; it fails when ctx is cancelled
+func (p *apduPacer) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.interval == 0 {
+		return nil
+	}
+	now := time.Now()
+	if d := p.next.Sub(now); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		now = p.next
+	}
+	p.next = now.Add(p.interval)
+	return nil
+}
@@ -0,0 +1,156 @@
+package sim
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ FUZZ SELECT TESTS ============
+
+func fuzzTestCard() (*card.MockCard, *card.Reader) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddEF(0x6F99, []byte{0x01, 0x02, 0x03}) // proprietary EF under the MF
+	telecom := m.MF().AddDF(0x7F10)
+	telecom.AddRecordEF(0x6F3A, []byte{0xFF, 0xFF})
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, []byte{0x08, 0x29, 0x05, 0x88, 0x00, 0x00, 0x00, 0x00, 0x10})
+	usim.AddEF(0x6F42, []byte{0xFF})
+	m.FailSelect["6F42"] = 0x6982
+	return m, card.NewReaderWithTransport("Mock", m.ATR, m)
+}
+
+var fuzzTestTargets = []FuzzTarget{
+	{Name: "MF"},
+	{Name: "DF_TELECOM", Path: []byte{0x7F, 0x10}},
+	{Name: "DF_GSM", Path: []byte{0x7F, 0x20}},
+	{Name: "ADF_USIM", AID: AID_USIM},
+}
+
+func TestFuzzSelect(t *testing.T) {
+	_, reader := fuzzTestCard()
+	report, err := FuzzSelect(context.Background(), reader, FuzzOptions{
+		Targets: fuzzTestTargets,
+		First:   0x6F00,
+		Last:    0x6FFF,
+	})
+	if err != nil {
+		t.Fatalf("FuzzSelect() error = %v", err)
+	}
+	if report.Interrupted || len(report.Targets) != 4 {
+		t.Fatalf("report = %+v", report)
+	}
+	if reader.ReadOnly() {
+		t.Error("read-only mode not restored after the scan")
+	}
+
+	mf := report.Targets[0]
+	if !mf.Complete || mf.Probed != 256 {
+		t.Errorf("MF probed %d (complete %v), want 256", mf.Probed, mf.Complete)
+	}
+	hidden := mf.Undocumented()
+	if len(hidden) != 1 || hidden[0].FID != "6F99" || hidden[0].Structure != "transparent" || hidden[0].Size != 3 {
+		t.Errorf("MF undocumented = %+v, want 6F99 transparent 3 bytes", hidden)
+	}
+
+	telecom := report.Targets[1]
+	if len(telecom.Files) != 2 || telecom.Files[0].FID != "6F3A" || telecom.Files[0].Structure != "linear" {
+		t.Errorf("DF_TELECOM files = %+v, want 6F3A linear and 6F42 denied", telecom.Files)
+	}
+
+	if gsm := report.Targets[2]; gsm.Error == "" || gsm.Probed != 0 {
+		t.Errorf("DF_GSM = %+v, want select error and nothing probed", gsm)
+	}
+
+	usim := report.Targets[3]
+	var imsi, denied *FuzzFile
+	for i := range usim.Files {
+		switch usim.Files[i].FID {
+		case "6F07":
+			imsi = &usim.Files[i]
+		case "6F42":
+			denied = &usim.Files[i]
+		}
+	}
+	if imsi == nil || imsi.Known != "EF_IMSI" {
+		t.Errorf("ADF_USIM 6F07 = %+v, want EF_IMSI", imsi)
+	}
+	if denied == nil || denied.SW != "6982" || usim.SWCounts["6982"] != 1 {
+		t.Errorf("ADF_USIM 6F42 = %+v, counts %v; want SW 6982 recorded", denied, usim.SWCounts)
+	}
+	if usim.SWCounts["6A82"] != 256-2 {
+		t.Errorf("ADF_USIM 6A82 count = %d, want %d", usim.SWCounts["6A82"], 256-2)
+	}
+}
+
+func TestFuzzSelect_Interrupted(t *testing.T) {
+	m, reader := fuzzTestCard()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	readOnlyDuringScan := true
+	report, err := FuzzSelect(ctx, reader, FuzzOptions{
+		Targets: fuzzTestTargets,
+		Progress: func(target string, fid uint16) {
+			readOnlyDuringScan = readOnlyDuringScan && reader.ReadOnly()
+			if fid == 0x0010 {
+				cancel()
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("FuzzSelect() error = %v", err)
+	}
+	if !report.Interrupted || report.Targets[0].Complete || report.Targets[0].Probed != 0x11 {
+		t.Errorf("report: interrupted %v, MF probed %d; want partial map of 0x11 FIDs", report.Interrupted, report.Targets[0].Probed)
+	}
+	if len(report.Targets) != 1 {
+		t.Errorf("%d targets reported, want only the MF", len(report.Targets))
+	}
+	if !readOnlyDuringScan {
+		t.Error("reader not in read-only mode during the scan")
+	}
+	for _, apdu := range m.Log {
+		if apdu[1] != 0xA4 && apdu[1] != 0xC0 {
+			t.Errorf("APDU other than SELECT / GET RESPONSE sent: %X", apdu)
+		}
+	}
+}
+
+func TestFuzzSelect_ReadOnlyGuard(t *testing.T) {
+	_, reader := fuzzTestCard()
+	reader.SetReadOnly(true)
+	// A write slipping into the scan is refused by the read-only guard
+	report, err := FuzzSelect(context.Background(), reader, FuzzOptions{
+		Targets: fuzzTestTargets[:1],
+		First:   0x6F98,
+		Last:    0x6F9A,
+		Progress: func(string, uint16) {
+			if _, werr := reader.UpdateBinary(0, []byte{0x00}); werr == nil {
+				t.Error("UpdateBinary() allowed during the scan")
+			}
+		},
+	})
+	if err != nil || report.Targets[0].Probed != 3 {
+		t.Fatalf("FuzzSelect() = %+v, %v", report, err)
+	}
+	if !reader.ReadOnly() {
+		t.Error("read-only mode set by the caller was cleared")
+	}
+}
+
+func TestAPDUPacer(t *testing.T) {
+	p := newAPDUPacer(1000)
+	for i := 0; i < 3; i++ {
+		if err := p.wait(context.Background()); err != nil {
+			t.Fatalf("wait() error = %v", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.wait(ctx); err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Errorf("wait(cancelled) error = %v, want context canceled", err)
+	}
+}
@@ -15,6 +15,12 @@ type Applet struct {
 	State     string
 	Privilege string
 	Type      string // "App", "Package", "ISD"
+
+	Privileges  []byte   // C5 as read (1 or 3 bytes)
+	LoadFileAID string   // C4: executable load file of an application
+	ModuleAIDs  []string // 84: executable modules of a load file, or the module of an application
+	SDAID       string   // CC: associated security domain
+	LifeCycle   byte     // 9F70 as read (card life cycle for the ISD)
 }
 
 // GP Life Cycle states
@@ -151,21 +157,13 @@ func getStatus(reader *card.Reader, p1 byte) ([]Applet, error) {
 			return applets, err
 		}
 
-		// Handle GET RESPONSE if needed
-		if resp.HasMoreData() {
-			resp, err = reader.GetResponse(resp.SW2)
-			if err != nil {
-				return applets, err
-			}
-		}
-
 		if !resp.IsOK() && resp.SW() != 0x6310 {
 			// 6310 = more data available
 			sw := resp.SW()
 			if isGPSecureChannelRequired(sw) {
-				return applets, fmt.Errorf("GlobalPlatform GET STATUS requires a Secure Channel (ISD is secured): %s (SW=%04X)", card.SWToString(sw), sw)
+				return applets, fmt.Errorf("GlobalPlatform GET STATUS requires a Secure Channel (ISD is secured): %s (SW=%04X)", card.DecodeSW(sw, 0xF2, card.ContextGP), sw)
 			}
-			return applets, fmt.Errorf("GlobalPlatform GET STATUS failed: %s (SW=%04X)", card.SWToString(sw), sw)
+			return applets, fmt.Errorf("GlobalPlatform GET STATUS failed: %s (SW=%04X)", card.DecodeSW(sw, 0xF2, card.ContextGP), sw)
 		}
 
 		// Parse TLV response
@@ -246,6 +244,7 @@ func parseAppletEntry(data []byte) *Applet {
 					break
 				}
 				state := data[idx]
+				app.LifeCycle = state
 				if s, ok := gpStates[state]; ok {
 					app.State = s
 				} else {
@@ -274,11 +273,16 @@ func parseAppletEntry(data []byte) *Applet {
 		case 0xC5: // Privileges
 			if len(value) > 0 {
 				app.Privilege = decodePrivileges(value[0])
+				app.Privileges = append([]byte(nil), value...)
 			}
 		case 0xCF: // GP Registry-related data
 			// Skip
-		case 0xC4: // Associated Security Domain AID
-			// Skip
+		case 0xC4: // Executable Load File AID
+			app.LoadFileAID = fmt.Sprintf("%X", value)
+		case 0x84: // Executable Module AID
+			app.ModuleAIDs = append(app.ModuleAIDs, fmt.Sprintf("%X", value))
+		case 0xCC: // Associated Security Domain AID
+			app.SDAID = fmt.Sprintf("%X", value)
 		}
 	}
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"sim_reader/card"
+	"sim_reader/tlv"
 )
 
 // ARA-M (Access Rule Application Master) default AID (commonly used on UICC).
@@ -24,13 +25,6 @@ type GPARAMRule struct {
 	ApduRule byte
 }
 
-func tlv(tag byte, value []byte) []byte {
-	out := make([]byte, 0, 2+len(value))
-	out = append(out, tag, byte(len(value)))
-	out = append(out, value...)
-	return out
-}
-
 // buildARAMStoreData builds a single-block STORE DATA payload for adding one ARA-M rule:
 // E2 (REF-AR-DO) { E1 (REF-DO) { 4F (AID-REF-DO), C1 (DeviceAppID-REF-DO) } , E3 (AR-DO) { D0, DB } }
 func buildARAMStoreData(rule GPARAMRule) ([]byte, error) {
@@ -45,21 +39,21 @@ func buildARAMStoreData(rule GPARAMRule) ([]byte, error) {
 	}
 
 	refDo := make([]byte, 0, 2+len(rule.TargetAID)+2+len(rule.CertHash))
-	refDo = append(refDo, tlv(0x4F, rule.TargetAID)...) // AID-REF-DO
-	refDo = append(refDo, tlv(0xC1, rule.CertHash)...)  // DeviceAppID-REF-DO
+	refDo = append(refDo, tlv.Encode(0x4F, rule.TargetAID)...) // AID-REF-DO
+	refDo = append(refDo, tlv.Encode(0xC1, rule.CertHash)...)  // DeviceAppID-REF-DO
 
 	arDo := make([]byte, 0, 2+1+2+len(rule.Perm))
-	arDo = append(arDo, tlv(0xD0, []byte{rule.ApduRule})...) // APDU-AR-DO
-	arDo = append(arDo, tlv(0xDB, rule.Perm)...)             // PERM-AR-DO
+	arDo = append(arDo, tlv.Encode(0xD0, []byte{rule.ApduRule})...) // APDU-AR-DO
+	arDo = append(arDo, tlv.Encode(0xDB, rule.Perm)...)             // PERM-AR-DO
 
-	e1 := tlv(0xE1, refDo)
-	e3 := tlv(0xE3, arDo)
+	e1 := tlv.Encode(0xE1, refDo)
+	e3 := tlv.Encode(0xE3, arDo)
 
 	payload := make([]byte, 0, 2+len(e1)+len(e3))
 	payload = append(payload, e1...)
 	payload = append(payload, e3...)
 
-	return tlv(0xE2, payload), nil
+	return tlv.Encode(0xE2, payload), nil
 }
 
 func gpStoreData(sess card.GPSession, p1, p2 byte, data []byte) (*card.APDUResponse, error) {
@@ -68,10 +62,20 @@ func gpStoreData(sess card.GPSession, p1, p2 byte, data []byte) (*card.APDURespo
 }
 
 // GPAramAddRule stores one ARA-M rule using GP STORE DATA over an established secure channel.
+func GPAramAddRule(reader *card.Reader, cfg GPConfig, aramAID []byte, rule GPARAMRule) error {
+	payload, err := buildARAMStoreData(rule)
+	if err != nil {
+		return err
+	}
+	return GPAramStoreRules(reader, cfg, aramAID, [][]byte{payload})
+}
+
+// GPAramStoreRules stores REF-AR-DOs (E2 objects, as built by buildARAMStoreData or read back
+// with GPAramReadRules) with one STORE DATA each over a single secure channel.
 //
 // Note: Different cards expect different STORE DATA P1 values (data format hints).
 // We try a small set of common P1 values for compatibility.
-func GPAramAddRule(reader *card.Reader, cfg GPConfig, aramAID []byte, rule GPARAMRule) error {
+func GPAramStoreRules(reader *card.Reader, cfg GPConfig, aramAID []byte, payloads [][]byte) error {
 	if reader == nil {
 		return fmt.Errorf("nil reader")
 	}
@@ -89,15 +93,20 @@ func GPAramAddRule(reader *card.Reader, cfg GPConfig, aramAID []byte, rule GPARA
 	// hard here. If STORE DATA fails, caller can retry.
 	_, _ = reader.Select(aramAID)
 
-	payload, err := buildARAMStoreData(rule)
-	if err != nil {
-		return err
+	for i, payload := range payloads {
+		if err := gpAramStore(sess, payload); err != nil {
+			return fmt.Errorf("rule %d of %d: %w", i+1, len(payloads), err)
+		}
 	}
+	return nil
+}
 
-	// Common P1 values seen in the wild:
-	// - 0x80: last block, no encryption, no special structure hint
-	// - 0x90: last block + vendor-specific structure hint (seen in some GPPro scripts)
-	// - 0xA0: last block + BER-TLV structure hint
+// gpAramStore sends one REF-AR-DO with the P1 values seen in the wild:
+// - 0x80: last block, no encryption, no special structure hint
+// - 0x90: last block + vendor-specific structure hint (seen in some GPPro scripts)
+// - 0xA0: last block + BER-TLV structure hint
+func gpAramStore(sess card.GPSession, payload []byte) error {
+	var err error
 	for _, p1 := range []byte{0x80, 0x90, 0xA0} {
 		resp, e := gpStoreData(sess, p1, 0x00, payload)
 		if e != nil {
@@ -108,9 +117,89 @@ func GPAramAddRule(reader *card.Reader, cfg GPConfig, aramAID []byte, rule GPARA
 			return nil
 		}
 		if resp != nil {
-			err = fmt.Errorf("STORE DATA failed: %s (SW=%04X)", card.SWToString(resp.SW()), resp.SW())
+			err = fmt.Errorf("STORE DATA failed: %s (SW=%04X)", resp.SWString(), resp.SW())
 			continue
 		}
 	}
 	return err
 }
+
+// ARA-M GET DATA tags (GP Secure Element Access Control)
+const (
+	aramTagAllRules = 0xFF40 // Response-ALL-AR-DO
+	aramTagRefARDO  = 0xE2   // REF-AR-DO: one rule
+)
+
+// GPAramReadRules reads the access rules of ARA-M with GET DATA [All] and, while the
+// Response-ALL-AR-DO is incomplete, GET DATA [Next]. No secure channel is needed. Returns
+// the REF-AR-DOs (E2 objects), which GPAramStoreRules accepts unchanged; none when the
+// card answers 6A88 (no rules).
+func GPAramReadRules(reader *card.Reader, aramAID []byte) ([][]byte, error) {
+	if len(aramAID) == 0 {
+		aramAID = GP_ARAM_AID
+	}
+	resp, err := reader.Select(aramAID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select ARA-M: %w", err)
+	}
+	if !resp.IsOK() && !resp.HasMoreData() {
+		return nil, fmt.Errorf("ARA-M %X not selectable: %s", aramAID, resp.SWString())
+	}
+
+	resp, err = reader.SendAPDU([]byte{0x80, 0xCA, 0xFF, 0x40, 0x00})
+	if err != nil {
+		return nil, err
+	}
+	if resp.SW() == 0x6A88 {
+		return nil, nil
+	}
+	if !resp.IsOK() {
+		return nil, fmt.Errorf("ARA-M GET DATA [All] failed: %s (SW=%04X)", resp.SWString(), resp.SW())
+	}
+	data := resp.Data
+	total, err := aramResponseLength(data)
+	if err != nil {
+		return nil, err
+	}
+	for len(data) < total {
+		resp, err = reader.SendAPDU([]byte{0x80, 0xCA, 0xFF, 0x60, 0x00})
+		if err != nil {
+			return nil, err
+		}
+		if !resp.IsOK() || len(resp.Data) == 0 {
+			return nil, fmt.Errorf("ARA-M GET DATA [Next] failed after %d of %d bytes: %s", len(data), total, resp.SWString())
+		}
+		data = append(data, resp.Data...)
+	}
+
+	nodes, err := tlv.Parse(data[:total])
+	if err != nil {
+		return nil, fmt.Errorf("ARA-M rules are not valid BER-TLV: %w", err)
+	}
+	var rules [][]byte
+	if all := tlv.Find(nodes, aramTagAllRules); all != nil {
+		for _, n := range all.Children {
+			if n.Tag == aramTagRefARDO {
+				rules = append(rules, tlv.Encode(n.Tag, n.Value))
+			}
+		}
+	}
+	return rules, nil
+}
+
+// aramResponseLength returns the length of the Response-ALL-AR-DO (FF40) including its
+// header, from the first response block
+func aramResponseLength(data []byte) (int, error) {
+	if len(data) < 3 || data[0] != 0xFF || data[1] != 0x40 {
+		return 0, fmt.Errorf("ARA-M GET DATA [All]: response is not an FF40 object: %X", data)
+	}
+	switch {
+	case data[2] < 0x80:
+		return 3 + int(data[2]), nil
+	case data[2] == 0x81 && len(data) >= 4:
+		return 4 + int(data[3]), nil
+	case data[2] == 0x82 && len(data) >= 5:
+		return 5 + (int(data[3])<<8 | int(data[4])), nil
+	}
+	return 0, fmt.Errorf("ARA-M GET DATA [All]: unsupported length %X", data[2:])
+}
@@ -0,0 +1,173 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+
+	"sim_reader/card"
+	"sim_reader/tlv"
+)
+
+// Card life cycle of the ISD (GlobalPlatform Card Specification 5.1.1). Cards returned from
+// the field can be CARD_LOCKED or TERMINATED, where GP commands fail with generic status
+// words. The state is detected before the GP operations so that the ones that cannot work
+// are refused with the reason, and the recovery that still works is named.
+
+// GPCardLifeCycle is the card life cycle state coded in 9F70 of the ISD
+type GPCardLifeCycle byte
+
+const (
+	GPCardUnknown     GPCardLifeCycle = 0x00 // not detected (GET STATUS needs a secure channel)
+	GPCardOPReady     GPCardLifeCycle = 0x01
+	GPCardInitialized GPCardLifeCycle = 0x07
+	GPCardSecured     GPCardLifeCycle = 0x0F
+	GPCardLocked      GPCardLifeCycle = 0x7F
+	GPCardTerminated  GPCardLifeCycle = 0xFF
+)
+
+func (s GPCardLifeCycle) String() string {
+	switch s {
+	case GPCardUnknown:
+		return "unknown"
+	case GPCardOPReady:
+		return "OP_READY"
+	case GPCardInitialized:
+		return "INITIALIZED"
+	case GPCardSecured:
+		return "SECURED"
+	case GPCardLocked:
+		return "CARD_LOCKED"
+	case GPCardTerminated:
+		return "TERMINATED"
+	}
+	return fmt.Sprintf("0x%02X", byte(s))
+}
+
+// GPCardState is the card life cycle and how it was detected
+type GPCardState struct {
+	LifeCycle GPCardLifeCycle
+	Source    string // "SELECT SW 6283", "FCI 9F70", "GET STATUS"
+}
+
+// Known reports whether the life cycle was detected
+func (s GPCardState) Known() bool {
+	return s.LifeCycle != GPCardUnknown
+}
+
+func (s GPCardState) String() string {
+	if !s.Known() {
+		return s.LifeCycle.String()
+	}
+	return fmt.Sprintf("%s (%s)", s.LifeCycle, s.Source)
+}
+
+// Message describes the state and what can still be done on the card
+func (s GPCardState) Message() string {
+	switch s.LifeCycle {
+	case GPCardLocked:
+		return "card is CARD_LOCKED: only SET STATUS unlock by the ISD keys will work (gp lifecycle --gp-unlock-card)"
+	case GPCardTerminated:
+		return "card is TERMINATED: the card is permanently disabled, no GP operation will work"
+	}
+	return fmt.Sprintf("card is %s", s.LifeCycle)
+}
+
+// Blocked reports whether the state refuses card content management
+func (s GPCardState) Blocked() bool {
+	return s.LifeCycle == GPCardLocked || s.LifeCycle == GPCardTerminated
+}
+
+// GPOperation is a GP command sequence, as far as the card life cycle is concerned
+type GPOperation int
+
+const (
+	GPOpRead   GPOperation = iota // secure channel, GET STATUS, SELECT: list, probe, registry export, verify
+	GPOpManage                    // card content changes: load, install, delete, STORE DATA, ARA-M rules
+	GPOpUnlock                    // SET STATUS from CARD_LOCKED back to SECURED
+)
+
+// Check returns why op cannot succeed in the detected state, nil when it can or when the
+// state is unknown. A CARD_LOCKED ISD still opens a secure channel and answers GET STATUS.
+func (s GPCardState) Check(op GPOperation) error {
+	switch {
+	case !s.Known():
+		return nil
+	case s.LifeCycle == GPCardTerminated:
+		return fmt.Errorf("%s", s.Message())
+	case s.LifeCycle == GPCardLocked && op == GPOpManage:
+		return fmt.Errorf("%s", s.Message())
+	case s.LifeCycle != GPCardLocked && op == GPOpUnlock:
+		return fmt.Errorf("card is %s, not CARD_LOCKED: nothing to unlock", s.LifeCycle)
+	}
+	return nil
+}
+
+// DetectGPCardState selects the ISD (sdAID, then the GlobalPlatform ISD AID) and reads its
+// life cycle. SELECT of the ISD answers 6283 on a CARD_LOCKED card; a card refusing it
+// with 6A81 on every candidate is taken as TERMINATED. Otherwise the state is 9F70 of the
+// FCI or of a plain GET STATUS; cards that only answer GET STATUS in a secure channel
+// leave it unknown.
+func DetectGPCardState(reader *card.Reader, sdAID []byte) GPCardState {
+	candidates := [][]byte{GP_ISD_AID}
+	if len(sdAID) > 0 && !bytes.Equal(sdAID, GP_ISD_AID) {
+		candidates = [][]byte{sdAID, GP_ISD_AID}
+	}
+
+	refused := 0
+	for _, aid := range candidates {
+		resp, err := reader.Select(aid)
+		if err != nil {
+			continue
+		}
+		switch sw := resp.SW(); {
+		case sw == 0x6283:
+			return GPCardState{LifeCycle: GPCardLocked, Source: "SELECT SW 6283"}
+		case sw == 0x6A81:
+			refused++
+			continue
+		case !resp.IsOK() && !resp.HasMoreData():
+			continue
+		}
+
+		if nodes, err := tlv.Parse(resp.Data); err == nil {
+			if lc := tlv.Find(nodes, 0x9F70); lc != nil && len(lc.Value) == 1 {
+				return GPCardState{LifeCycle: GPCardLifeCycle(lc.Value[0]), Source: "FCI 9F70"}
+			}
+		}
+		if isd, err := getStatus(reader, 0x80); err == nil && len(isd) > 0 {
+			return GPCardState{LifeCycle: GPCardLifeCycle(isd[0].LifeCycle), Source: "GET STATUS"}
+		}
+		return GPCardState{}
+	}
+	if refused == len(candidates) {
+		return GPCardState{LifeCycle: GPCardTerminated, Source: "SELECT SW 6A81"}
+	}
+	return GPCardState{}
+}
+
+// UnlockGPCard opens a secure channel with the ISD keys of cfg and sends SET STATUS
+// (80 F0 80 0F): a CARD_LOCKED card goes back to SECURED, the state it was locked from.
+// The state read afterwards over the channel is returned (GPCardUnknown if the card does
+// not answer GET STATUS).
+func UnlockGPCard(reader *card.Reader, cfg GPConfig) (GPCardLifeCycle, error) {
+	sess, err := OpenGPSessionAuto(reader, cfg)
+	if err != nil {
+		return GPCardUnknown, err
+	}
+	return unlockGPCard(sess)
+}
+
+func unlockGPCard(sess card.GPSession) (GPCardLifeCycle, error) {
+	resp, err := sess.WrapAndSend(0x80, 0xF0, 0x80, byte(GPCardSecured), nil, nil)
+	if err != nil {
+		return GPCardUnknown, err
+	}
+	if !resp.IsOK() {
+		return GPCardUnknown, fmt.Errorf("SET STATUS failed: %s (SW=%04X)", card.DecodeSW(resp.SW(), 0xF0, card.ContextGP), resp.SW())
+	}
+	isd, err := gpGetStatusSecure(sess, 0x80)
+	if err != nil || len(isd) == 0 {
+		return GPCardUnknown, nil
+	}
+	return GPCardLifeCycle(isd[0].LifeCycle), nil
+}
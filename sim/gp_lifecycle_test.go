@@ -0,0 +1,126 @@
+package sim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ GP CARD LIFE CYCLE TESTS ============
+
+// isdStatusEntry is the GET STATUS entry of the ISD with the card life cycle state
+func isdStatusEntry(state GPCardLifeCycle) []byte {
+	return append(mustHex("E30F4F07A00000015100009F7001"), byte(state), 0xC5, 0x01, 0x9E)
+}
+
+// newGPLifeCycleCard returns a card answering SELECT of the ISD with selectSW, and GET
+// STATUS of the ISD with getStatus (nil = 6982, secure channel required)
+func newGPLifeCycleCard(selectSW []byte, fci, getStatus []byte) *card.Reader {
+	m := card.NewMockCard(mustHex("3B9F96801FC78031A073BE21136743200718000001A5"))
+	m.Override = func(apdu []byte) []byte {
+		switch {
+		case apdu[1] == card.INS_SELECT && apdu[2] == 0x04:
+			return append(append([]byte(nil), fci...), selectSW...)
+		case apdu[0] == 0x80 && apdu[1] == 0xF2 && apdu[2] == 0x80:
+			if getStatus == nil {
+				return []byte{0x69, 0x82}
+			}
+			return append(append([]byte(nil), getStatus...), 0x90, 0x00)
+		}
+		return nil
+	}
+	return card.NewReaderWithTransport("Mock", m.ATR, m)
+}
+
+func TestDetectGPCardState(t *testing.T) {
+	tests := []struct {
+		name      string
+		selectSW  string
+		fci       string
+		getStatus []byte
+		want      GPCardState
+	}{
+		{"locked", "6283", "", nil, GPCardState{GPCardLocked, "SELECT SW 6283"}},
+		{"terminated", "6A81", "", nil, GPCardState{GPCardTerminated, "SELECT SW 6A81"}},
+		{"FCI", "9000", "6F0D8407A00000015100009F70017F", nil, GPCardState{GPCardLocked, "FCI 9F70"}},
+		{"GET STATUS", "9000", "", isdStatusEntry(GPCardSecured), GPCardState{GPCardSecured, "GET STATUS"}},
+		{"secure channel required", "9000", "", nil, GPCardState{}},
+		{"no ISD", "6A82", "", nil, GPCardState{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := newGPLifeCycleCard(mustHex(tt.selectSW), mustHex(tt.fci), tt.getStatus)
+			if got := DetectGPCardState(reader, mustHex("A000000003000000")); got != tt.want {
+				t.Errorf("DetectGPCardState() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGPCardState_Check(t *testing.T) {
+	tests := []struct {
+		state  GPCardLifeCycle
+		read   bool
+		manage bool
+		unlock bool
+	}{
+		{GPCardUnknown, true, true, true},
+		{GPCardSecured, true, true, false},
+		{GPCardInitialized, true, true, false},
+		{GPCardLocked, true, false, true},
+		{GPCardTerminated, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.state.String(), func(t *testing.T) {
+			s := GPCardState{LifeCycle: tt.state, Source: "GET STATUS"}
+			for op, want := range map[GPOperation]bool{GPOpRead: tt.read, GPOpManage: tt.manage, GPOpUnlock: tt.unlock} {
+				if err := s.Check(op); (err == nil) != want {
+					t.Errorf("Check(%d) = %v, want allowed=%v", op, err, want)
+				}
+			}
+		})
+	}
+
+	msg := GPCardState{LifeCycle: GPCardLocked}.Check(GPOpManage).Error()
+	if !strings.HasPrefix(msg, "card is CARD_LOCKED: only SET STATUS unlock by the ISD keys will work") {
+		t.Errorf("CARD_LOCKED message = %q", msg)
+	}
+}
+
+// lockedISDSession is a secure channel to a CARD_LOCKED ISD that accepts SET STATUS
+type lockedISDSession struct {
+	state GPCardLifeCycle
+	sent  [][]byte
+}
+
+func (s *lockedISDSession) WrapAndSend(cla, ins, p1, p2 byte, data []byte, le *byte) (*card.APDUResponse, error) {
+	s.sent = append(s.sent, append([]byte{cla, ins, p1, p2}, data...))
+	switch ins {
+	case 0xF0:
+		if s.state != GPCardLocked || p1 != 0x80 {
+			return &card.APDUResponse{SW1: 0x69, SW2: 0x85}, nil
+		}
+		s.state = GPCardLifeCycle(p2)
+	case 0xF2:
+		return &card.APDUResponse{Data: isdStatusEntry(s.state), SW1: 0x90, SW2: 0x00}, nil
+	}
+	return &card.APDUResponse{SW1: 0x90, SW2: 0x00}, nil
+}
+
+func TestUnlockGPCard(t *testing.T) {
+	sess := &lockedISDSession{state: GPCardLocked}
+	got, err := unlockGPCard(sess)
+	if err != nil || got != GPCardSecured {
+		t.Fatalf("unlockGPCard() = %s, %v; want SECURED", got, err)
+	}
+	if !bytes.Equal(sess.sent[0], []byte{0x80, 0xF0, 0x80, 0x0F}) {
+		t.Errorf("SET STATUS = %X, want 80F0800F", sess.sent[0])
+	}
+
+	// A card that is not locked refuses the transition
+	if _, err := unlockGPCard(&lockedISDSession{state: GPCardSecured}); err == nil || !strings.Contains(err.Error(), "6985") {
+		t.Errorf("unlockGPCard(SECURED) error = %v, want SW 6985", err)
+	}
+}
@@ -0,0 +1,179 @@
+package sim
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/tlv"
+)
+
+// GPHashAlgorithm selects the Load File Data Block hash sent in INSTALL [for load]
+type GPHashAlgorithm int
+
+const (
+	// GPHashAuto sends a hash only when DAP or delegated management requires one,
+	// using the strongest algorithm listed in the card capability information
+	GPHashAuto GPHashAlgorithm = iota
+	// GPHashNone never sends a hash
+	GPHashNone
+	GPHashSHA1
+	GPHashSHA256
+)
+
+// Load File Data Block and DAP block tags (GP Card Spec 11.6.2.3)
+const (
+	gpTagLoadFileDataBlock = 0xC4
+	gpTagDAPBlock          = 0xE2
+	gpTagDAPSignature      = 0xC3
+	gpTagSDAID             = 0x4F
+)
+
+// Card Capability Information (GP Card Spec 2.3 H.4, GET DATA tag 0067)
+const (
+	gpTagCardCapability    = 0x67
+	gpTagLFDBHashSupport   = 0x82
+	gpCapabilityHashSHA1   = 0x01
+	gpCapabilityHashSHA256 = 0x02
+)
+
+// String returns the CLI name of the algorithm.
+func (a GPHashAlgorithm) String() string {
+	switch a {
+	case GPHashNone:
+		return "none"
+	case GPHashSHA1:
+		return "sha1"
+	case GPHashSHA256:
+		return "sha256"
+	default:
+		return "auto"
+	}
+}
+
+// ParseGPHashAlgorithm parses "auto", "none", "sha1" or "sha256".
+func ParseGPHashAlgorithm(s string) (GPHashAlgorithm, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "auto":
+		return GPHashAuto, nil
+	case "none":
+		return GPHashNone, nil
+	case "sha1", "sha-1":
+		return GPHashSHA1, nil
+	case "sha256", "sha-256":
+		return GPHashSHA256, nil
+	default:
+		return GPHashAuto, fmt.Errorf("unknown load file hash: %s (use: auto, none, sha1, sha256)", s)
+	}
+}
+
+// GPDAPBlock is one Data Authentication Pattern: the signature of the Load File Data Block hash
+// made for the Security Domain that verifies it
+type GPDAPBlock struct {
+	SDAID     []byte
+	Signature []byte
+}
+
+// GPLoadOptions controls the optional parts of a CAP load
+type GPLoadOptions struct {
+	Hash   GPHashAlgorithm
+	DAPs   []GPDAPBlock
+	Format GPLoadFormat // format of the CAP path (auto-detected by default)
+
+	Privileges []byte // INSTALL [for install] privileges (none by default)
+	Params     []byte // install parameters, sent as C9 (none by default)
+}
+
+// LoadFileDataBlockHash hashes the Load File Data Block (the CAP components, without the C4 header)
+func LoadFileDataBlockHash(lfdb []byte, alg GPHashAlgorithm) []byte {
+	switch alg {
+	case GPHashSHA1:
+		sum := sha1.Sum(lfdb)
+		return sum[:]
+	case GPHashSHA256:
+		sum := sha256.Sum256(lfdb)
+		return sum[:]
+	}
+	return nil
+}
+
+// BuildLoadFile returns the data sent with LOAD: the DAP blocks (E2) followed by the
+// Load File Data Block (C4)
+func BuildLoadFile(lfdb []byte, daps []GPDAPBlock) []byte {
+	var out []byte
+	for _, dap := range daps {
+		block := append(tlv.Encode(gpTagSDAID, dap.SDAID), tlv.Encode(gpTagDAPSignature, dap.Signature)...)
+		out = append(out, tlv.Encode(gpTagDAPBlock, block)...)
+	}
+	return append(out, tlv.Encode(gpTagLoadFileDataBlock, lfdb)...)
+}
+
+// buildInstallForLoad returns the INSTALL [for load] data:
+// len(loadFileAID) loadFileAID | len(sdAID) sdAID | len(hash) hash | len(params)=0 | len(token)=0
+func buildInstallForLoad(packageAID, sdAID, hash []byte) []byte {
+	data := make([]byte, 0, 8+len(packageAID)+len(sdAID)+len(hash))
+	data = append(data, byte(len(packageAID)))
+	data = append(data, packageAID...)
+	data = append(data, byte(len(sdAID)))
+	data = append(data, sdAID...)
+	data = append(data, byte(len(hash)))
+	data = append(data, hash...)
+	return append(data, 0x00, 0x00)
+}
+
+// ParseCardCapabilityHashes returns the Load File Data Block hash algorithms listed in the
+// Card Capability Information (tag 67 / 82). Unknown algorithm identifiers are ignored.
+func ParseCardCapabilityHashes(data []byte) []GPHashAlgorithm {
+	nodes, err := tlv.Parse(data)
+	if err != nil {
+		return nil
+	}
+	// Some cards return the content of tag 67 without the wrapper
+	if caps := tlv.Find(nodes, gpTagCardCapability); caps != nil {
+		nodes = caps.Children
+	}
+	node := tlv.Find(nodes, gpTagLFDBHashSupport)
+	if node == nil {
+		return nil
+	}
+	var algs []GPHashAlgorithm
+	for _, id := range node.Value {
+		switch id {
+		case gpCapabilityHashSHA1:
+			algs = append(algs, GPHashSHA1)
+		case gpCapabilityHashSHA256:
+			algs = append(algs, GPHashSHA256)
+		}
+	}
+	return algs
+}
+
+// pickLoadHash resolves GPHashAuto: no hash unless required, otherwise SHA-256 when the card
+// lists it and SHA-1 (the GP 2.2 default) when it does not
+func pickLoadHash(alg GPHashAlgorithm, required bool, supported []GPHashAlgorithm) GPHashAlgorithm {
+	if alg != GPHashAuto {
+		return alg
+	}
+	if !required {
+		return GPHashNone
+	}
+	for _, s := range supported {
+		if s == GPHashSHA256 {
+			return GPHashSHA256
+		}
+	}
+	return GPHashSHA1
+}
+
+// readCardCapabilityHashes queries the Card Capability Information over the secure channel
+// (nil if the card does not support GET DATA 0067)
+func readCardCapabilityHashes(sess card.GPSession) []GPHashAlgorithm {
+	le := byte(0x00)
+	resp, err := sess.WrapAndSend(0x80, 0xCA, 0x00, gpTagCardCapability, nil, &le)
+	if err != nil || !resp.IsOK() {
+		return nil
+	}
+	return ParseCardCapabilityHashes(resp.Data)
+}
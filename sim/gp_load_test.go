@@ -0,0 +1,279 @@
+package sim
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ============ CAP LOAD TESTS ============
+
+func TestLoadFileDataBlockHash(t *testing.T) {
+	tests := []struct {
+		name string
+		alg  GPHashAlgorithm
+		want string
+	}{
+		{"SHA-1", GPHashSHA1, "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		{"SHA-256", GPHashSHA256, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"None", GPHashNone, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := hex.EncodeToString(LoadFileDataBlockHash([]byte("abc"), tc.alg)); got != tc.want {
+				t.Errorf("LoadFileDataBlockHash() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBuildLoadFile(t *testing.T) {
+	sd := []byte{0xA0, 0x00, 0x00, 0x01, 0x51}
+	long := bytes.Repeat([]byte{0xAA}, 0x100)
+
+	tests := []struct {
+		name    string
+		lfdb    []byte
+		daps    []GPDAPBlock
+		wantHex string
+	}{
+		{"No DAP", []byte{0x01, 0x02}, nil, "C4020102"},
+		{"One DAP", []byte{0x01}, []GPDAPBlock{{SDAID: sd, Signature: []byte{0x11, 0x22}}},
+			"E20B" + "4F05A000000151" + "C3021122" + "C40101"},
+		{"Long LFDB", long, nil, "C4820100" + hex.EncodeToString(long)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			want, _ := hex.DecodeString(tc.wantHex)
+			if got := BuildLoadFile(tc.lfdb, tc.daps); !bytes.Equal(got, want) {
+				t.Errorf("BuildLoadFile() = %X, want %X", got, want)
+			}
+		})
+	}
+}
+
+func TestBuildInstallForLoad(t *testing.T) {
+	pkg := []byte{0xA0, 0x00, 0x00, 0x05, 0x59}
+	sd := []byte{0xA0, 0x00, 0x00, 0x01, 0x51, 0x53}
+
+	got := buildInstallForLoad(pkg, sd, nil)
+	if want, _ := hex.DecodeString("05A000000559" + "06A00000015153" + "000000"); !bytes.Equal(got, want) {
+		t.Errorf("without hash = %X, want %X", got, want)
+	}
+
+	hash := LoadFileDataBlockHash([]byte("abc"), GPHashSHA1)
+	got = buildInstallForLoad(pkg, sd, hash)
+	want, _ := hex.DecodeString("05A000000559" + "06A00000015153" + "14" + hex.EncodeToString(hash) + "0000")
+	if !bytes.Equal(got, want) {
+		t.Errorf("with hash = %X, want %X", got, want)
+	}
+}
+
+func TestPickLoadHash(t *testing.T) {
+	tests := []struct {
+		name      string
+		alg       GPHashAlgorithm
+		required  bool
+		supported []GPHashAlgorithm
+		want      GPHashAlgorithm
+	}{
+		{"Auto not required", GPHashAuto, false, []GPHashAlgorithm{GPHashSHA256}, GPHashNone},
+		{"Auto, unknown capability", GPHashAuto, true, nil, GPHashSHA1},
+		{"Auto, SHA-256 listed", GPHashAuto, true, []GPHashAlgorithm{GPHashSHA1, GPHashSHA256}, GPHashSHA256},
+		{"Explicit wins", GPHashSHA1, true, []GPHashAlgorithm{GPHashSHA256}, GPHashSHA1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := pickLoadHash(tc.alg, tc.required, tc.supported); got != tc.want {
+				t.Errorf("pickLoadHash() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseCardCapabilityHashes(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []GPHashAlgorithm
+	}{
+		{"Wrapped", "670781010182020102", []GPHashAlgorithm{GPHashSHA1, GPHashSHA256}},
+		{"Unwrapped", "82010283010F", []GPHashAlgorithm{GPHashSHA256}},
+		{"No hash info", "6703810101", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tc.data)
+			got := ParseCardCapabilityHashes(data)
+			if len(got) != len(tc.want) {
+				t.Fatalf("ParseCardCapabilityHashes() = %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("ParseCardCapabilityHashes() = %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+// ============ LOAD FILE FORMAT TESTS ============
+
+// testCAPComponents are minimal components in load file order plus Debug and Descriptor,
+// which the load file must leave out
+var testCAPComponents = map[string][]byte{
+	"Header":       {0x01, 0x00, 0x04, 0xDE, 0xCA, 0xFF, 0xED},
+	"Directory":    {0x02, 0x00, 0x01, 0xAA},
+	"Import":       {0x04, 0x00, 0x01, 0xBB},
+	"Applet":       {0x03, 0x00, 0x01, 0xCC},
+	"Class":        {0x06, 0x00, 0x01, 0xDD},
+	"Method":       {0x07, 0x00, 0x02, 0x01, 0x02},
+	"StaticField":  {0x08, 0x00, 0x01, 0xEE},
+	"ConstantPool": {0x05, 0x00, 0x01, 0x11},
+	"RefLocation":  {0x09, 0x00, 0x01, 0x22},
+	"Descriptor":   {0x0B, 0x00, 0x01, 0x33},
+	"Debug":        {0x0C, 0x00, 0x01, 0x44},
+}
+
+const testCAPPackageDir = "com/example/applet/javacard/"
+
+// writeTestCAP writes the components as a ZIP .cap and as an expanded directory
+func writeTestCAP(t *testing.T) (capPath, dir string) {
+	t.Helper()
+	tmp := t.TempDir()
+	capPath = filepath.Join(tmp, "applet.cap")
+	f, err := os.Create(capPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	dir = filepath.Join(tmp, "expanded")
+	// ZIP entries in a non-spec order: the order must come from the component names
+	for _, name := range []string{"Debug", "Method", "Header", "Descriptor", "Class", "Import", "Directory", "Applet", "StaticField", "ConstantPool", "RefLocation"} {
+		w, err := zw.Create(testCAPPackageDir + name + ".cap")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(testCAPComponents[name])
+		p := filepath.Join(dir, filepath.FromSlash(testCAPPackageDir), name+".cap")
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, testCAPComponents[name], 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return capPath, dir
+}
+
+func TestReadLoadFile_Formats(t *testing.T) {
+	capPath, dir := writeTestCAP(t)
+
+	var want []byte
+	for _, name := range []string{"Header", "Directory", "Import", "Applet", "Class", "Method", "StaticField", "ConstantPool", "RefLocation"} {
+		want = append(want, testCAPComponents[name]...)
+	}
+
+	fromCAP, err := ReadLoadFile(capPath, GPLoadFormatAuto)
+	if err != nil {
+		t.Fatalf("cap: %v", err)
+	}
+	if !bytes.Equal(fromCAP, want) {
+		t.Fatalf("cap load file = %X, want %X", fromCAP, want)
+	}
+
+	fromDir, err := ReadLoadFile(dir, GPLoadFormatAuto)
+	if err != nil {
+		t.Fatalf("dir: %v", err)
+	}
+	if !bytes.Equal(fromDir, fromCAP) {
+		t.Errorf("dir load file = %X, want the .cap one %X", fromDir, fromCAP)
+	}
+
+	ijcPath := filepath.Join(t.TempDir(), "applet.ijc")
+	if err := os.WriteFile(ijcPath, fromCAP, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fromIJC, err := ReadLoadFile(ijcPath, GPLoadFormatAuto)
+	if err != nil {
+		t.Fatalf("ijc: %v", err)
+	}
+	if !bytes.Equal(fromIJC, fromCAP) {
+		t.Errorf("ijc load file = %X, want %X", fromIJC, fromCAP)
+	}
+}
+
+func TestDetectGPLoadFormat(t *testing.T) {
+	capPath, dir := writeTestCAP(t)
+	tmp := t.TempDir()
+	// A load file with a .cap extension: the content decides
+	rawCAP := filepath.Join(tmp, "raw.cap")
+	os.WriteFile(rawCAP, testCAPComponents["Header"], 0644)
+	unknown := filepath.Join(tmp, "applet.bin")
+	os.WriteFile(unknown, []byte{0x00, 0x01, 0x02}, 0644)
+
+	tests := []struct {
+		path    string
+		want    GPLoadFormat
+		wantErr bool
+	}{
+		{capPath, GPLoadFormatCAP, false},
+		{dir, GPLoadFormatDir, false},
+		{rawCAP, GPLoadFormatIJC, false},
+		{unknown, GPLoadFormatAuto, true},
+		{filepath.Join(tmp, "missing.cap"), GPLoadFormatAuto, true},
+	}
+	for _, tt := range tests {
+		got, err := DetectGPLoadFormat(tt.path)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("DetectGPLoadFormat(%s) = %q, %v; want %q (error %v)", filepath.Base(tt.path), got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestReadLoadFile_Errors(t *testing.T) {
+	capPath, dir := writeTestCAP(t)
+	tmp := t.TempDir()
+
+	// Explicit ijc on a ZIP: no Header component
+	if _, err := ReadLoadFile(capPath, GPLoadFormatIJC); err == nil {
+		t.Error("ijc format on a ZIP should fail")
+	}
+	// Two packages in one directory
+	second := filepath.Join(dir, "com", "other", "javacard", "Header.cap")
+	os.MkdirAll(filepath.Dir(second), 0755)
+	os.WriteFile(second, testCAPComponents["Header"], 0644)
+	if _, err := ReadLoadFile(dir, GPLoadFormatDir); err == nil || !strings.Contains(err.Error(), "twice") {
+		t.Errorf("two packages: err = %v", err)
+	}
+	// Directory without a Header component
+	empty := filepath.Join(tmp, "empty")
+	os.MkdirAll(empty, 0755)
+	os.WriteFile(filepath.Join(empty, "Method.cap"), testCAPComponents["Method"], 0644)
+	if _, err := ReadLoadFile(empty, GPLoadFormatDir); err == nil {
+		t.Error("directory without Header.cap should fail")
+	}
+}
+
+func TestParseGPLoadFormat(t *testing.T) {
+	for in, want := range map[string]GPLoadFormat{"": GPLoadFormatAuto, "auto": GPLoadFormatAuto, "CAP": GPLoadFormatCAP, "ijc": GPLoadFormatIJC, "dir": GPLoadFormatDir} {
+		if got, err := ParseGPLoadFormat(in); err != nil || got != want {
+			t.Errorf("ParseGPLoadFormat(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseGPLoadFormat("jar"); err == nil {
+		t.Error("ParseGPLoadFormat(jar) should fail")
+	}
+}
@@ -0,0 +1,181 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GPLoadFormat is the on-disk format of the applet given to gp load
+type GPLoadFormat string
+
+const (
+	// GPLoadFormatAuto detects the format from the path: directory, content, then extension
+	GPLoadFormatAuto GPLoadFormat = ""
+	// GPLoadFormatCAP is a ZIP .cap with one file per component
+	GPLoadFormatCAP GPLoadFormat = "cap"
+	// GPLoadFormatIJC is an .ijc: the components already concatenated, used verbatim
+	GPLoadFormatIJC GPLoadFormat = "ijc"
+	// GPLoadFormatDir is an expanded CAP: a directory holding the component files
+	GPLoadFormatDir GPLoadFormat = "dir"
+)
+
+// capLoadOrder is the order of the components in the load file (JCVM spec 6.2). Debug and
+// Descriptor are not part of it: cards do not need them and many refuse them.
+var capLoadOrder = []string{
+	"Header",
+	"Directory",
+	"Import",
+	"Applet",
+	"Class",
+	"Method",
+	"StaticField",
+	"Export",
+	"ConstantPool",
+	"RefLocation",
+}
+
+// capHeaderMagic follows tag (1) and size (2) of the Header component
+var capHeaderMagic = []byte{0xDE, 0xCA, 0xFF, 0xED}
+
+// ParseGPLoadFormat parses "auto", "cap", "ijc" or "dir".
+func ParseGPLoadFormat(s string) (GPLoadFormat, error) {
+	switch f := GPLoadFormat(strings.ToLower(strings.TrimSpace(s))); f {
+	case "", "auto":
+		return GPLoadFormatAuto, nil
+	case GPLoadFormatCAP, GPLoadFormatIJC, GPLoadFormatDir:
+		return f, nil
+	default:
+		return GPLoadFormatAuto, fmt.Errorf("unknown load file format: %s (use: auto, cap, ijc, dir)", s)
+	}
+}
+
+// DetectGPLoadFormat returns the format of path: a directory is an expanded CAP, a ZIP
+// signature a .cap and a Header component an .ijc; otherwise the extension decides.
+func DetectGPLoadFormat(path string) (GPLoadFormat, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return GPLoadFormatAuto, err
+	}
+	if st.IsDir() {
+		return GPLoadFormatDir, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return GPLoadFormatAuto, err
+	}
+	head := make([]byte, 7)
+	n, _ := f.Read(head)
+	f.Close()
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return GPLoadFormatCAP, nil
+	case isCAPHeader(head):
+		return GPLoadFormatIJC, nil
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".cap", ".jar", ".zip":
+		return GPLoadFormatCAP, nil
+	case ".ijc":
+		return GPLoadFormatIJC, nil
+	}
+	return GPLoadFormatAuto, fmt.Errorf("%s is neither a CAP ZIP nor a load file (.ijc); set the format explicitly", path)
+}
+
+// ReadLoadFile returns the Load File Data Block of a ZIP .cap, an .ijc or an expanded CAP
+// directory. With GPLoadFormatAuto the format is detected by DetectGPLoadFormat.
+func ReadLoadFile(path string, format GPLoadFormat) ([]byte, error) {
+	if format == GPLoadFormatAuto {
+		var err error
+		if format, err = DetectGPLoadFormat(path); err != nil {
+			return nil, err
+		}
+	}
+	switch format {
+	case GPLoadFormatCAP:
+		return ReadCAPLoadFile(path)
+	case GPLoadFormatIJC:
+		return ReadIJCLoadFile(path)
+	case GPLoadFormatDir:
+		return ReadCAPDirLoadFile(path)
+	default:
+		return nil, fmt.Errorf("unknown load file format: %s", format)
+	}
+}
+
+// ReadIJCLoadFile reads an .ijc. The content is used verbatim; it must start with the
+// Header component.
+func ReadIJCLoadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read ijc: %w", err)
+	}
+	if !isCAPHeader(data) {
+		return nil, fmt.Errorf("%s does not start with a CAP Header component (01 xxxx DECAFFED)", path)
+	}
+	return data, nil
+}
+
+// ReadCAPDirLoadFile concatenates the component files (Header.cap, Directory.cap, ...) of an
+// expanded CAP directory in load file order. The components may sit in a subdirectory (the
+// usual <package path>/javacard/ layout), but only one package may be present.
+func ReadCAPDirLoadFile(dir string) ([]byte, error) {
+	found := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, ok := capComponentName(d.Name())
+		if !ok {
+			return nil
+		}
+		if prev, dup := found[name]; dup {
+			return fmt.Errorf("%s component found twice (%s, %s): one package per directory", name, prev, path)
+		}
+		found[name] = path
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := found["Header"]; !ok {
+		return nil, fmt.Errorf("no Header.cap in %s", dir)
+	}
+
+	var out []byte
+	for _, name := range capLoadOrder {
+		path, ok := found[name]
+		if !ok {
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+// capComponentName returns the component of a file name like "Method.cap" when it is part
+// of the load file
+func capComponentName(file string) (string, bool) {
+	base, ok := strings.CutSuffix(file, ".cap")
+	if !ok {
+		return "", false
+	}
+	for _, name := range capLoadOrder {
+		if strings.EqualFold(base, name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func isCAPHeader(data []byte) bool {
+	return len(data) >= 7 && data[0] == 0x01 && bytes.Equal(data[3:7], capHeaderMagic)
+}
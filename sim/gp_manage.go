@@ -2,15 +2,18 @@ package sim
 
 import (
 	"archive/zip"
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"sort"
 	"strings"
 
 	"sim_reader/card"
+	"sim_reader/inputs"
 )
 
 // GPConfig contains parameters for GlobalPlatform operations.
@@ -37,15 +40,7 @@ func ParseHexBytes(s string) ([]byte, error) {
 }
 
 func ParseAIDHex(s string) ([]byte, error) {
-	b, err := ParseHexBytes(s)
-	if err != nil {
-		return nil, fmt.Errorf("invalid AID hex: %w", err)
-	}
-	if len(b) < 5 || len(b) > 16 {
-		// AID length can vary, but this keeps us safe from obvious mistakes
-		return nil, fmt.Errorf("unexpected AID length %d (expected 5..16 bytes)", len(b))
-	}
-	return b, nil
+	return inputs.AID("AID", s)
 }
 
 func ParseGPSecurityLevel(s string) (card.GPSecurityLevel, error) {
@@ -72,7 +67,7 @@ func OpenGPSCP02(reader *card.Reader, cfg GPConfig) (*card.SCP02Session, error)
 				if err != nil {
 					return nil, fmt.Errorf("failed to select SD/CM AID before SCP02: %w", err)
 				}
-				return nil, fmt.Errorf("failed to select SD/CM AID before SCP02: %s (SW=%04X)", card.SWToString(resp.SW()), resp.SW())
+				return nil, fmt.Errorf("failed to select SD/CM AID before SCP02: %s (SW=%04X)", resp.SWString(), resp.SW())
 			}
 		}
 	}
@@ -104,7 +99,7 @@ func OpenGPSessionAuto(reader *card.Reader, cfg GPConfig) (card.GPSession, error
 				if err != nil {
 					return nil, fmt.Errorf("failed to select SD/CM AID before secure channel: %w", err)
 				}
-				return nil, fmt.Errorf("failed to select SD/CM AID before secure channel: %s (SW=%04X)", card.SWToString(resp.SW()), resp.SW())
+				return nil, fmt.Errorf("failed to select SD/CM AID before secure channel: %s (SW=%04X)", resp.SWString(), resp.SW())
 			}
 		}
 	}
@@ -202,7 +197,7 @@ func gpGetStatusSecureVariant(sess card.GPSession, p1 byte, p2Base byte, cmdData
 
 		sw := resp.SW()
 		if !resp.IsOK() && sw != 0x6310 {
-			return applets, fmt.Errorf("GET STATUS failed: %s (SW=%04X)", card.SWToString(sw), sw)
+			return applets, fmt.Errorf("GET STATUS failed: %s (SW=%04X)", card.DecodeSW(sw, 0xF2, card.ContextGP), sw)
 		}
 
 		applets = append(applets, parseGetStatusResponse(resp.Data)...)
@@ -232,44 +227,55 @@ func DeleteAIDs(reader *card.Reader, cfg GPConfig, aids [][]byte) error {
 		return err
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("DELETE failed: %s (SW=%04X)", card.SWToString(resp.SW()), resp.SW())
+		return fmt.Errorf("DELETE failed: %s (SW=%04X)", resp.SWString(), resp.SW())
 	}
 	return nil
 }
 
-// InstallLoadAndApplet loads a CAP and installs an applet instance.
-// This is a minimal implementation (no DAP, no tokens, minimal params).
-func InstallLoadAndApplet(reader *card.Reader, cfg GPConfig, capZipPath string, sdAID, packageAID, appletAID, instanceAID []byte) error {
+// InstallLoadAndApplet loads a CAP (ZIP, .ijc or expanded directory, see opts.Format) and
+// installs an applet instance.
+// sdAID is the Security Domain that receives the load file; when it differs from the
+// authenticated cfg.SDAID (delegated management) or DAP blocks are given, the Load File
+// Data Block hash is included in INSTALL [for load]. No tokens, minimal install params.
+func InstallLoadAndApplet(reader *card.Reader, cfg GPConfig, capPath string, sdAID, packageAID, appletAID, instanceAID []byte, opts GPLoadOptions) error {
 	if cfg.BlockSize <= 0 {
 		cfg.BlockSize = 200
 	}
+	lfdb, err := ReadLoadFile(capPath, opts.Format)
+	if err != nil {
+		return err
+	}
 	sess, err := OpenGPSessionAuto(reader, cfg)
 	if err != nil {
 		return err
 	}
 	le := byte(0x00)
 
+	alg := opts.Hash
+	if alg == GPHashAuto {
+		required := len(opts.DAPs) > 0 || !bytes.Equal(sdAID, cfg.SDAID)
+		var supported []GPHashAlgorithm
+		if required {
+			supported = readCardCapabilityHashes(sess)
+		}
+		alg = pickLoadHash(alg, required, supported)
+	}
+	if alg == GPHashNone && len(opts.DAPs) > 0 {
+		return fmt.Errorf("DAP blocks require a load file hash (use sha1 or sha256)")
+	}
+
 	// INSTALL [for load] (P1=02)
-	// Data: len(loadFileAID) loadFileAID | len(sdAID) sdAID | len(hash)=0 | len(params)=0 | len(token)=0
-	installForLoad := make([]byte, 0, 64)
-	installForLoad = append(installForLoad, byte(len(packageAID)))
-	installForLoad = append(installForLoad, packageAID...)
-	installForLoad = append(installForLoad, byte(len(sdAID)))
-	installForLoad = append(installForLoad, sdAID...)
-	installForLoad = append(installForLoad, 0x00, 0x00, 0x00)
+	installForLoad := buildInstallForLoad(packageAID, sdAID, LoadFileDataBlockHash(lfdb, alg))
 	resp, err := sess.WrapAndSend(0x80, 0xE6, 0x02, 0x00, installForLoad, &le)
 	if err != nil {
 		return err
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("INSTALL [for load] failed: %s (SW=%04X)", card.SWToString(resp.SW()), resp.SW())
+		return fmt.Errorf("INSTALL [for load] failed: %s (SW=%04X)", resp.SWString(), resp.SW())
 	}
 
-	// LOAD blocks
-	loadFile, err := ReadCAPLoadFile(capZipPath)
-	if err != nil {
-		return err
-	}
+	// LOAD blocks: DAP blocks (E2) followed by the Load File Data Block (C4)
+	loadFile := BuildLoadFile(lfdb, opts.DAPs)
 
 	blockNo := byte(0x00)
 	for off := 0; off < len(loadFile); {
@@ -291,36 +297,27 @@ func InstallLoadAndApplet(reader *card.Reader, cfg GPConfig, capZipPath string,
 			return err
 		}
 		if !resp.IsOK() {
-			return fmt.Errorf("LOAD failed at block %d: %s (SW=%04X)", blockNo, card.SWToString(resp.SW()), resp.SW())
+			return fmt.Errorf("LOAD failed at block %d: %s (SW=%04X)", blockNo, resp.SWString(), resp.SW())
 		}
 		blockNo++
 	}
 
 	// INSTALL [for install] (P1=0C)
-	// Data: len(pkgAID) pkgAID | len(appletAID) appletAID | len(instanceAID) instanceAID |
-	//       len(priv)=0 | len(params)=0 | len(token)=0
-	installForInstall := make([]byte, 0, 128)
-	installForInstall = append(installForInstall, byte(len(packageAID)))
-	installForInstall = append(installForInstall, packageAID...)
-	installForInstall = append(installForInstall, byte(len(appletAID)))
-	installForInstall = append(installForInstall, appletAID...)
-	installForInstall = append(installForInstall, byte(len(instanceAID)))
-	installForInstall = append(installForInstall, instanceAID...)
-	installForInstall = append(installForInstall, 0x00, 0x00, 0x00)
+	installForInstall := buildInstallForInstall(packageAID, appletAID, instanceAID, opts.Privileges, opts.Params)
 
 	resp, err = sess.WrapAndSend(0x80, 0xE6, 0x0C, 0x00, installForInstall, &le)
 	if err != nil {
 		return err
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("INSTALL [for install] failed: %s (SW=%04X)", card.SWToString(resp.SW()), resp.SW())
+		return fmt.Errorf("INSTALL [for install] failed: %s (SW=%04X)", resp.SWString(), resp.SW())
 	}
 
 	return nil
 }
 
 // ReadCAPLoadFile reads a ZIP .cap and produces a "load file" byte stream by concatenating component CAP files.
-// This is a pragmatic approach compatible with common CAP ZIP layouts.
+// Components are taken in capLoadOrder; Debug and Descriptor are left out.
 func ReadCAPLoadFile(zipPath string) ([]byte, error) {
 	zr, err := zip.OpenReader(zipPath)
 	if err != nil {
@@ -328,49 +325,27 @@ func ReadCAPLoadFile(zipPath string) ([]byte, error) {
 	}
 	defer zr.Close()
 
-	// Standard CAP component order (best-effort).
-	order := []string{
-		"Header.cap",
-		"Directory.cap",
-		"Import.cap",
-		"Applet.cap",
-		"Class.cap",
-		"Method.cap",
-		"StaticField.cap",
-		"Export.cap",
-		"ConstantPool.cap",
-		"RefLocation.cap",
-		"Descriptor.cap",
-		"Debug.cap",
-	}
-
-	type entry struct {
-		name string
-		data []byte
-	}
-	found := map[string]entry{}
+	found := map[string][]byte{}
 	for _, f := range zr.File {
-		for _, want := range order {
-			if strings.HasSuffix(f.Name, "/"+want) || f.Name == want {
-				rc, err := f.Open()
-				if err != nil {
-					return nil, fmt.Errorf("open %s: %w", f.Name, err)
-				}
-				b, err := io.ReadAll(rc)
-				_ = rc.Close()
-				if err != nil {
-					return nil, fmt.Errorf("read %s: %w", f.Name, err)
-				}
-				found[want] = entry{name: f.Name, data: b}
-			}
+		name, ok := capComponentName(path.Base(f.Name))
+		if !ok {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", f.Name, err)
 		}
+		b, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f.Name, err)
+		}
+		found[name] = b
 	}
 
 	var out []byte
-	for _, name := range order {
-		if e, ok := found[name]; ok {
-			out = append(out, e.data...)
-		}
+	for _, name := range capLoadOrder {
+		out = append(out, found[name]...)
 	}
 	if len(out) == 0 {
 		// help debugging: show zip entries
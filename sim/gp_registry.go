@@ -0,0 +1,442 @@
+package sim
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"sim_reader/card"
+	"sim_reader/tlv"
+)
+
+// GPRegistryVersion is the format version of registry files written by gp registry
+const GPRegistryVersion = 1
+
+// GPRegistry is the applet landscape of a card: the load files and instances of the GET
+// STATUS registry and the ARA-M access rules. Exported from a card that is set up, it is
+// the desired state applied to the next card of the batch.
+type GPRegistry struct {
+	Version   int                  `json:"version"`
+	Created   string               `json:"created,omitempty"`
+	ICCID     string               `json:"iccid,omitempty"` // card the registry was exported from
+	SDAID     string               `json:"sd_aid"`          // security domain the secure channel was opened with
+	Packages  []GPRegistryPackage  `json:"packages"`
+	Instances []GPRegistryInstance `json:"instances"`
+	ARAMAID   string               `json:"aram_aid,omitempty"`
+	ARARules  []GPRegistryRule     `json:"ara_rules,omitempty"`
+	ARAStatus string               `json:"ara_status,omitempty"` // why the rules could not be read
+}
+
+// GPRegistryPackage is an executable load file
+type GPRegistryPackage struct {
+	AID     string   `json:"aid"`
+	State   string   `json:"state,omitempty"`
+	Modules []string `json:"modules,omitempty"` // executable modules (applet classes)
+	SDAID   string   `json:"sd_aid,omitempty"`
+}
+
+// GPRegistryInstance is an application or supplementary security domain. Install
+// parameters cannot be read back from the card: they come from the profile store when the
+// instance was installed by this tool, and are marked unknown otherwise.
+type GPRegistryInstance struct {
+	AID           string `json:"aid"`
+	State         string `json:"state,omitempty"`
+	Privileges    string `json:"privileges"`               // hex, 1 or 3 bytes
+	Package       string `json:"package,omitempty"`        // executable load file AID
+	Module        string `json:"module,omitempty"`         // executable module AID (applet class)
+	SDAID         string `json:"sd_aid,omitempty"`         // associated security domain
+	Params        string `json:"params,omitempty"`         // install parameters (C9 content), hex
+	ParamsUnknown bool   `json:"params_unknown,omitempty"` // not recorded at install time
+}
+
+// GPRegistryRule is one ARA-M access rule. Raw is the REF-AR-DO as read and is what gets
+// stored on the target card; the other fields are decoded from it for reading and diffs.
+type GPRegistryRule struct {
+	AID      string `json:"aid"`                 // AID-REF-DO, "*" for all AIDs (C0)
+	CertHash string `json:"cert_hash,omitempty"` // DeviceAppID-REF-DO (C1)
+	Package  string `json:"package,omitempty"`   // PKG-REF-DO (CA), Android package name
+	APDU     string `json:"apdu,omitempty"`      // APDU-AR-DO (D0), hex
+	Perm     string `json:"perm,omitempty"`      // PERM-AR-DO (DB), hex
+	Raw      string `json:"raw"`                 // REF-AR-DO (E2), hex
+}
+
+// BuildGPRegistry turns a GET STATUS listing into a registry. The ISD itself is left out:
+// it is not installed. Load files listed both with (P1=10) and without modules (P1=20)
+// are merged.
+func BuildGPRegistry(applets []Applet, sdAID []byte) *GPRegistry {
+	reg := &GPRegistry{Version: GPRegistryVersion, SDAID: fmt.Sprintf("%X", sdAID),
+		Packages: []GPRegistryPackage{}, Instances: []GPRegistryInstance{}}
+	packages := map[string]int{}
+	for _, a := range applets {
+		switch a.Type {
+		case "Package", "Module":
+			i, ok := packages[a.AID]
+			if !ok {
+				i = len(reg.Packages)
+				packages[a.AID] = i
+				reg.Packages = append(reg.Packages, GPRegistryPackage{AID: a.AID, State: a.State, SDAID: a.SDAID})
+			}
+			for _, m := range a.ModuleAIDs {
+				if !containsString(reg.Packages[i].Modules, m) {
+					reg.Packages[i].Modules = append(reg.Packages[i].Modules, m)
+				}
+			}
+		case "App":
+			inst := GPRegistryInstance{AID: a.AID, State: a.State, Privileges: fmt.Sprintf("%X", a.Privileges),
+				Package: a.LoadFileAID, SDAID: a.SDAID}
+			if inst.Privileges == "" {
+				inst.Privileges = "00"
+			}
+			if len(a.ModuleAIDs) > 0 {
+				inst.Module = a.ModuleAIDs[0]
+			}
+			reg.Instances = append(reg.Instances, inst)
+		}
+	}
+	return reg
+}
+
+// DecodeGPRegistryRule decodes a REF-AR-DO read from ARA-M
+func DecodeGPRegistryRule(raw []byte) (GPRegistryRule, error) {
+	rule := GPRegistryRule{Raw: fmt.Sprintf("%X", raw)}
+	nodes, err := tlv.Parse(raw)
+	if err != nil || len(nodes) != 1 || nodes[0].Tag != aramTagRefARDO {
+		return rule, fmt.Errorf("not a REF-AR-DO: %X", raw)
+	}
+	if n := tlv.Find(nodes, 0x4F); n != nil {
+		rule.AID = fmt.Sprintf("%X", n.Value)
+	} else if tlv.Find(nodes, 0xC0) != nil {
+		rule.AID = "*"
+	}
+	if n := tlv.Find(nodes, 0xC1); n != nil {
+		rule.CertHash = fmt.Sprintf("%X", n.Value)
+	}
+	if n := tlv.Find(nodes, 0xCA); n != nil {
+		rule.Package = string(n.Value)
+	}
+	if n := tlv.Find(nodes, 0xD0); n != nil {
+		rule.APDU = fmt.Sprintf("%X", n.Value)
+	}
+	if n := tlv.Find(nodes, 0xDB); n != nil {
+		rule.Perm = fmt.Sprintf("%X", n.Value)
+	}
+	return rule, nil
+}
+
+// ReadGPRegistry lists the registry over a secure channel and reads the ARA-M rules. A
+// card without a readable ARA-M gives a registry without rules and the reason in
+// ARAStatus.
+func ReadGPRegistry(reader *card.Reader, cfg GPConfig, aramAID []byte) (*GPRegistry, error) {
+	applets, err := ListAppletsSecure(reader, cfg)
+	if err != nil {
+		return nil, err
+	}
+	reg := BuildGPRegistry(applets, cfg.SDAID)
+	if len(aramAID) == 0 {
+		aramAID = GP_ARAM_AID
+	}
+	reg.ARAMAID = fmt.Sprintf("%X", aramAID)
+
+	raws, err := GPAramReadRules(reader, aramAID)
+	if err != nil {
+		reg.ARAStatus = err.Error()
+		return reg, nil
+	}
+	for _, raw := range raws {
+		rule, err := DecodeGPRegistryRule(raw)
+		if err != nil {
+			return nil, err
+		}
+		reg.ARARules = append(reg.ARARules, rule)
+	}
+	return reg, nil
+}
+
+// SaveGPRegistry writes the registry as indented JSON
+func SaveGPRegistry(filename string, reg *GPRegistry) error {
+	if reg.Created == "" {
+		reg.Created = time.Now().Format(time.RFC3339)
+	}
+	data, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// LoadGPRegistry reads a registry file and checks its AIDs and hex fields
+func LoadGPRegistry(filename string) (*GPRegistry, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry file: %w", err)
+	}
+	var reg GPRegistry
+	if err := decodeConfigStrict(data, &reg); err != nil {
+		return nil, fmt.Errorf("failed to parse registry file: %w", err)
+	}
+	if reg.Version != GPRegistryVersion {
+		return nil, fmt.Errorf("registry file %s has version %d, expected %d", filename, reg.Version, GPRegistryVersion)
+	}
+	for _, inst := range reg.Instances {
+		for name, v := range map[string]string{"aid": inst.AID, "privileges": inst.Privileges, "package": inst.Package,
+			"module": inst.Module, "params": inst.Params} {
+			if _, err := hex.DecodeString(v); err != nil {
+				return nil, fmt.Errorf("registry file: instance %s: %s is not hex", inst.AID, name)
+			}
+		}
+		if n := len(inst.Privileges) / 2; n != 1 && n != 3 {
+			return nil, fmt.Errorf("registry file: instance %s: privileges must be 1 or 3 bytes", inst.AID)
+		}
+	}
+	for i, rule := range reg.ARARules {
+		raw, err := hex.DecodeString(rule.Raw)
+		if err == nil {
+			_, err = DecodeGPRegistryRule(raw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("registry file: ARA-M rule %d: raw is not a REF-AR-DO", i+1)
+		}
+	}
+	return &reg, nil
+}
+
+// Kinds of GP registry plan steps
+const (
+	GPStepInstall    = "install"    // INSTALL [for install and make selectable]
+	GPStepPrivileges = "privileges" // INSTALL [for registry update]
+	GPStepRule       = "ara-rule"   // STORE DATA of a REF-AR-DO to ARA-M
+	GPStepNeedCAP    = "need-cap"   // load file not on the card: load its CAP file first
+	GPStepBlocked    = "blocked"    // instance that cannot be installed by the plan
+	GPStepExtra      = "extra"      // instance on the card but not in the file: left alone
+)
+
+// GPRegistryStep is one difference between the registry file and the card
+type GPRegistryStep struct {
+	Kind     string
+	AID      string
+	Detail   string
+	Instance *GPRegistryInstance
+	Rule     *GPRegistryRule
+}
+
+// Runs reports whether applying the plan sends the step to the card
+func (s GPRegistryStep) Runs() bool {
+	return s.Kind == GPStepInstall || s.Kind == GPStepPrivileges || s.Kind == GPStepRule
+}
+
+// GPRegistryPlan is the ordered list of differences; only Runs steps change the card
+type GPRegistryPlan []GPRegistryStep
+
+// Actions returns the number of steps that change the card
+func (p GPRegistryPlan) Actions() int {
+	n := 0
+	for _, s := range p {
+		if s.Runs() {
+			n++
+		}
+	}
+	return n
+}
+
+// PlanGPRegistry compares the desired registry with the current one of the card. Missing
+// instances are installed from load files already on the card; load files are never
+// loaded (their CAP file is reported as needed) and nothing is deleted.
+func PlanGPRegistry(desired, current *GPRegistry) GPRegistryPlan {
+	var needCAP, blocked, installs, privileges, rules, extra GPRegistryPlan
+
+	onCard := map[string]GPRegistryPackage{}
+	for _, p := range current.Packages {
+		onCard[p.AID] = p
+	}
+	inFile := map[string]GPRegistryPackage{}
+	for _, p := range desired.Packages {
+		inFile[p.AID] = p
+		if _, ok := onCard[p.AID]; !ok {
+			needCAP = append(needCAP, GPRegistryStep{Kind: GPStepNeedCAP, AID: p.AID,
+				Detail: fmt.Sprintf("load file not on the card: load its CAP file first (%d module(s))", len(p.Modules))})
+		}
+	}
+
+	currentInst := map[string]GPRegistryInstance{}
+	for _, inst := range current.Instances {
+		currentInst[inst.AID] = inst
+	}
+	wanted := map[string]bool{}
+	for i := range desired.Instances {
+		inst := desired.Instances[i]
+		wanted[inst.AID] = true
+		if cur, ok := currentInst[inst.AID]; ok {
+			if !strings.EqualFold(cur.Privileges, inst.Privileges) {
+				privileges = append(privileges, GPRegistryStep{Kind: GPStepPrivileges, AID: inst.AID, Instance: &inst,
+					Detail: fmt.Sprintf("privileges %s -> %s", cur.Privileges, strings.ToUpper(inst.Privileges))})
+			}
+			continue
+		}
+
+		pkg, loaded := onCard[inst.Package]
+		if inst.Module == "" {
+			// A load file with a single module leaves no choice
+			modules := pkg.Modules
+			if !loaded {
+				modules = inFile[inst.Package].Modules
+			}
+			if len(modules) == 1 {
+				inst.Module = modules[0]
+			}
+		}
+		switch {
+		case inst.Package == "":
+			blocked = append(blocked, GPRegistryStep{Kind: GPStepBlocked, AID: inst.AID, Detail: "load file AID unknown"})
+		case !loaded:
+			blocked = append(blocked, GPRegistryStep{Kind: GPStepBlocked, AID: inst.AID,
+				Detail: fmt.Sprintf("load file %s not on the card", inst.Package)})
+		case inst.Module == "":
+			blocked = append(blocked, GPRegistryStep{Kind: GPStepBlocked, AID: inst.AID,
+				Detail: fmt.Sprintf("module AID unknown, load file %s has %d modules", inst.Package, len(pkg.Modules))})
+		default:
+			detail := fmt.Sprintf("from %s module %s, privileges %s", inst.Package, inst.Module, strings.ToUpper(inst.Privileges))
+			if inst.ParamsUnknown {
+				detail += "; install parameters unknown, installed without"
+			}
+			if inst.SDAID != "" && !strings.EqualFold(inst.SDAID, desired.SDAID) {
+				detail += fmt.Sprintf("; associated with SD %s on the original card, installed under %s", inst.SDAID, current.SDAID)
+			}
+			installs = append(installs, GPRegistryStep{Kind: GPStepInstall, AID: inst.AID, Instance: &inst, Detail: detail})
+		}
+	}
+	for _, inst := range current.Instances {
+		if !wanted[inst.AID] {
+			extra = append(extra, GPRegistryStep{Kind: GPStepExtra, AID: inst.AID, Detail: "not in the registry file, left on the card"})
+		}
+	}
+
+	currentRules := map[string]bool{}
+	for _, r := range current.ARARules {
+		currentRules[strings.ToUpper(r.Raw)] = true
+	}
+	for i := range desired.ARARules {
+		rule := desired.ARARules[i]
+		if currentRules[strings.ToUpper(rule.Raw)] {
+			continue
+		}
+		detail := "AID " + rule.AID
+		if rule.CertHash != "" {
+			detail += ", cert hash " + rule.CertHash
+		}
+		if rule.Package != "" {
+			detail += ", package " + rule.Package
+		}
+		rules = append(rules, GPRegistryStep{Kind: GPStepRule, AID: desired.ARAMAID, Rule: &rule, Detail: detail})
+	}
+
+	var plan GPRegistryPlan
+	for _, steps := range []GPRegistryPlan{needCAP, blocked, installs, privileges, rules, extra} {
+		plan = append(plan, steps...)
+	}
+	return plan
+}
+
+// ApplyGPRegistryPlan runs the install and privilege steps in one secure channel session,
+// then stores the ARA-M rules. It stops at the first step the card refuses: later steps
+// may depend on it.
+func ApplyGPRegistryPlan(reader *card.Reader, cfg GPConfig, aramAID []byte, plan GPRegistryPlan) error {
+	var rules [][]byte
+	installs := false
+	for _, s := range plan {
+		switch s.Kind {
+		case GPStepInstall, GPStepPrivileges:
+			installs = true
+		case GPStepRule:
+			raw, _ := hex.DecodeString(s.Rule.Raw)
+			rules = append(rules, raw)
+		}
+	}
+
+	if installs {
+		sess, err := OpenGPSessionAuto(reader, cfg)
+		if err != nil {
+			return err
+		}
+		if err := applyGPRegistrySteps(sess, plan); err != nil {
+			return err
+		}
+	}
+	if len(rules) > 0 {
+		if err := GPAramStoreRules(reader, cfg, aramAID, rules); err != nil {
+			return fmt.Errorf("ARA-M: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyGPRegistrySteps sends the INSTALL commands of the plan
+func applyGPRegistrySteps(sess card.GPSession, plan GPRegistryPlan) error {
+	le := byte(0x00)
+	for _, s := range plan {
+		var p1 byte
+		var data []byte
+		switch s.Kind {
+		case GPStepInstall:
+			p1, data = 0x0C, buildInstallForInstall(mustHex(s.Instance.Package), mustHex(s.Instance.Module),
+				mustHex(s.Instance.AID), mustHex(s.Instance.Privileges), mustHex(s.Instance.Params))
+		case GPStepPrivileges:
+			p1, data = 0x40, buildInstallForRegistryUpdate(mustHex(s.Instance.AID), mustHex(s.Instance.Privileges))
+		default:
+			continue
+		}
+		resp, err := sess.WrapAndSend(0x80, 0xE6, p1, 0x00, data, &le)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", s.Kind, s.AID, err)
+		}
+		if !resp.IsOK() {
+			return fmt.Errorf("%s %s: INSTALL failed: %s (SW=%04X)", s.Kind, s.AID, resp.SWString(), resp.SW())
+		}
+	}
+	return nil
+}
+
+// buildInstallForInstall returns the INSTALL [for install] data:
+// len(loadFileAID) loadFileAID | len(moduleAID) moduleAID | len(instanceAID) instanceAID |
+// len(priv) priv | len(params) [C9 len params] | len(token)=0
+func buildInstallForInstall(packageAID, moduleAID, instanceAID, privileges, params []byte) []byte {
+	data := make([]byte, 0, 16+len(packageAID)+len(moduleAID)+len(instanceAID)+len(params))
+	for _, field := range [][]byte{packageAID, moduleAID, instanceAID, privileges} {
+		data = append(data, byte(len(field)))
+		data = append(data, field...)
+	}
+	var paramsField []byte
+	if len(params) > 0 {
+		paramsField = tlv.Encode(0xC9, params)
+	}
+	data = append(data, byte(len(paramsField)))
+	data = append(data, paramsField...)
+	return append(data, 0x00)
+}
+
+// buildInstallForRegistryUpdate returns the INSTALL [for registry update] data that sets
+// the privileges of an application (no extradition, no parameters, no token)
+func buildInstallForRegistryUpdate(instanceAID, privileges []byte) []byte {
+	data := []byte{0x00, 0x00, byte(len(instanceAID))}
+	data = append(data, instanceAID...)
+	data = append(data, byte(len(privileges)))
+	data = append(data, privileges...)
+	return append(data, 0x00, 0x00)
+}
+
+// mustHex decodes hex checked by LoadGPRegistry or produced by BuildGPRegistry
+func mustHex(s string) []byte {
+	b, _ := hex.DecodeString(s)
+	return b
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
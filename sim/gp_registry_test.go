@@ -0,0 +1,222 @@
+package sim
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/tlv"
+)
+
+// ============ GP REGISTRY TESTS ============
+
+// testARARule returns a REF-AR-DO for aid (nil: all AIDs) and a certificate hash
+func testARARule(aid, certHash []byte) []byte {
+	target := tlv.Encode(0xC0, nil)
+	if aid != nil {
+		target = tlv.Encode(0x4F, aid)
+	}
+	ref := tlv.Encode(0xE1, append(target, tlv.Encode(0xC1, certHash)...))
+	ar := tlv.Encode(0xE3, append(tlv.Encode(0xD0, []byte{0x01}), tlv.Encode(0xDB, []byte{0, 0, 0, 0, 0, 0, 0, 1})...))
+	return tlv.Encode(0xE2, append(ref, ar...))
+}
+
+func testRegistryApplets() []Applet {
+	return []Applet{
+		{Type: "ISD", AID: "A000000003000000", State: "SECURED"},
+		{Type: "Package", AID: "A0000005591010", State: "LOADED"},
+		{Type: "Module", AID: "A0000005591010", ModuleAIDs: []string{"A000000559101001"}},
+		{Type: "Package", AID: "A0000001515350", ModuleAIDs: []string{"A000000151535041", "A000000151535042"}},
+		{Type: "App", AID: "A00000055910100101", State: "SELECTABLE", Privileges: []byte{0x00},
+			LoadFileAID: "A0000005591010", ModuleAIDs: []string{"A000000559101001"}, SDAID: "A000000003000000"},
+	}
+}
+
+func TestBuildGPRegistry(t *testing.T) {
+	reg := BuildGPRegistry(testRegistryApplets(), []byte{0xA0, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00})
+	if len(reg.Packages) != 2 || len(reg.Packages[0].Modules) != 1 || reg.Packages[0].State != "LOADED" {
+		t.Fatalf("packages = %+v, want the P1=20 and P1=10 entries merged", reg.Packages)
+	}
+	if len(reg.Instances) != 1 {
+		t.Fatalf("instances = %+v, want the application only (no ISD)", reg.Instances)
+	}
+	inst := reg.Instances[0]
+	if inst.Package != "A0000005591010" || inst.Module != "A000000559101001" || inst.Privileges != "00" {
+		t.Errorf("instance = %+v", inst)
+	}
+}
+
+func TestDecodeGPRegistryRule(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xAB}, 20)
+	rule, err := DecodeGPRegistryRule(testARARule([]byte{0xA0, 0x00, 0x00, 0x00, 0x87}, hash))
+	if err != nil || rule.AID != "A000000087" || rule.CertHash != "ABABABABABABABABABABABABABABABABABABABAB" ||
+		rule.APDU != "01" || rule.Perm != "0000000000000001" {
+		t.Errorf("DecodeGPRegistryRule() = %+v, %v", rule, err)
+	}
+	if rule, _ := DecodeGPRegistryRule(testARARule(nil, hash)); rule.AID != "*" {
+		t.Errorf("DecodeGPRegistryRule(all AIDs) AID = %q, want *", rule.AID)
+	}
+	if _, err := DecodeGPRegistryRule([]byte{0x4F, 0x01, 0x00}); err == nil {
+		t.Error("DecodeGPRegistryRule() accepted an object that is not E2")
+	}
+}
+
+func TestPlanGPRegistry(t *testing.T) {
+	desired := BuildGPRegistry(testRegistryApplets(), []byte{0xA0, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00})
+	desired.Instances = append(desired.Instances,
+		GPRegistryInstance{AID: "A0000001515350410001", Privileges: "80", Package: "A0000001515350", ParamsUnknown: true},
+		GPRegistryInstance{AID: "A0000001515350420001", Privileges: "00", Package: "A0000001515350",
+			Module: "A000000151535042", ParamsUnknown: true})
+	desired.Instances[0].Privileges = "02"
+	desired.ARAMAID = "A00000015141434C00"
+	rule, _ := DecodeGPRegistryRule(testARARule(nil, bytes.Repeat([]byte{0x01}, 20)))
+	desired.ARARules = []GPRegistryRule{rule}
+
+	// The fresh card has the first load file and a different instance
+	current := BuildGPRegistry(testRegistryApplets()[:3], []byte{0xA0, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00})
+	current.Instances = []GPRegistryInstance{{AID: "A0000000871002", Privileges: "00"}}
+
+	plan := PlanGPRegistry(desired, current)
+	var kinds []string
+	for _, s := range plan {
+		kinds = append(kinds, s.Kind+" "+s.AID)
+	}
+	want := []string{
+		"need-cap A0000001515350",
+		"blocked A0000001515350410001",
+		"blocked A0000001515350420001",
+		"install A00000055910100101",
+		"ara-rule A00000015141434C00",
+		"extra A0000000871002",
+	}
+	if len(kinds) != len(want) {
+		t.Fatalf("PlanGPRegistry() = %q, want %q", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("step %d = %q, want %q", i+1, kinds[i], want[i])
+		}
+	}
+	if plan.Actions() != 2 {
+		t.Errorf("Actions() = %d, want 2", plan.Actions())
+	}
+
+	// Once installed, only the privileges differ
+	current.Instances = append(current.Instances, GPRegistryInstance{AID: "A00000055910100101", Privileges: "00"})
+	current.ARARules = desired.ARARules
+	desired.Instances = desired.Instances[:1]
+	plan = PlanGPRegistry(desired, current)
+	if plan.Actions() != 1 || plan[1].Kind != GPStepPrivileges {
+		t.Errorf("PlanGPRegistry(installed) = %+v, want a privileges step", plan)
+	}
+}
+
+// fakeGPSession records the commands sent over the secure channel
+type fakeGPSession struct {
+	sent [][]byte
+}
+
+func (s *fakeGPSession) WrapAndSend(cla, ins, p1, p2 byte, data []byte, le *byte) (*card.APDUResponse, error) {
+	s.sent = append(s.sent, append([]byte{cla, ins, p1, p2}, data...))
+	return &card.APDUResponse{SW1: 0x90, SW2: 0x00}, nil
+}
+
+func TestApplyGPRegistrySteps(t *testing.T) {
+	inst := &GPRegistryInstance{AID: "A0000000871002", Privileges: "80", Package: "A00000008710", Module: "A0000000871001", Params: "0102"}
+	plan := GPRegistryPlan{
+		{Kind: GPStepNeedCAP, AID: "A0000001515350"},
+		{Kind: GPStepInstall, AID: inst.AID, Instance: inst},
+		{Kind: GPStepPrivileges, AID: inst.AID, Instance: inst},
+	}
+	sess := &fakeGPSession{}
+	if err := applyGPRegistrySteps(sess, plan); err != nil {
+		t.Fatalf("applyGPRegistrySteps() error = %v", err)
+	}
+	want := [][]byte{
+		append([]byte{0x80, 0xE6, 0x0C, 0x00,
+			0x06, 0xA0, 0x00, 0x00, 0x00, 0x87, 0x10,
+			0x07, 0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x01,
+			0x07, 0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02,
+			0x01, 0x80,
+			0x04, 0xC9, 0x02, 0x01, 0x02}, 0x00),
+		{0x80, 0xE6, 0x40, 0x00, 0x00, 0x00, 0x07, 0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02, 0x01, 0x80, 0x00, 0x00},
+	}
+	if len(sess.sent) != len(want) {
+		t.Fatalf("sent %d commands, want %d", len(sess.sent), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(sess.sent[i], want[i]) {
+			t.Errorf("command %d = %X, want %X", i+1, sess.sent[i], want[i])
+		}
+	}
+
+	// Without privileges and parameters the fields are empty, as gp load sends them
+	got := buildInstallForInstall([]byte{0xA0, 0x00, 0x00, 0x00, 0x01}, []byte{0xA0, 0x00, 0x00, 0x00, 0x02}, []byte{0xA0, 0x00, 0x00, 0x00, 0x03}, nil, nil)
+	if !bytes.HasSuffix(got, []byte{0x03, 0x00, 0x00, 0x00}) || len(got) != 21 {
+		t.Errorf("buildInstallForInstall(no privileges) = %X", got)
+	}
+}
+
+func TestGPAramReadRules(t *testing.T) {
+	rules := append(testARARule(nil, bytes.Repeat([]byte{0x01}, 20)), testARARule([]byte{0xA0, 0x00, 0x00, 0x00, 0x87}, bytes.Repeat([]byte{0x02}, 32))...)
+	all := tlv.Encode(aramTagAllRules, rules)
+
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(GP_ARAM_AID)
+	m.Override = func(apdu []byte) []byte {
+		switch {
+		case bytes.HasPrefix(apdu, []byte{0x80, 0xCA, 0xFF, 0x40}):
+			return append(append([]byte(nil), all[:40]...), 0x90, 0x00)
+		case bytes.HasPrefix(apdu, []byte{0x80, 0xCA, 0xFF, 0x60}):
+			return append(append([]byte(nil), all[40:]...), 0x90, 0x00)
+		}
+		return nil
+	}
+	got, err := GPAramReadRules(card.NewReaderWithTransport("Mock", m.ATR, m), nil)
+	if err != nil {
+		t.Fatalf("GPAramReadRules() error = %v", err)
+	}
+	if len(got) != 2 || !bytes.Equal(bytes.Join(got, nil), rules) {
+		t.Errorf("GPAramReadRules() = %X, want the two REF-AR-DOs", got)
+	}
+
+	// No rules: 6A88
+	m.Override = func(apdu []byte) []byte {
+		if apdu[1] == 0xCA {
+			return []byte{0x6A, 0x88}
+		}
+		return nil
+	}
+	if got, err := GPAramReadRules(card.NewReaderWithTransport("Mock", m.ATR, m), nil); err != nil || len(got) != 0 {
+		t.Errorf("GPAramReadRules(no rules) = %X, %v", got, err)
+	}
+}
+
+func TestLoadGPRegistry(t *testing.T) {
+	reg := BuildGPRegistry(testRegistryApplets(), []byte{0xA0, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00})
+	rule, _ := DecodeGPRegistryRule(testARARule(nil, bytes.Repeat([]byte{0x01}, 20)))
+	reg.ARARules = []GPRegistryRule{rule}
+	path := filepath.Join(t.TempDir(), "registry.json")
+	if err := SaveGPRegistry(path, reg); err != nil {
+		t.Fatalf("SaveGPRegistry() error = %v", err)
+	}
+	loaded, err := LoadGPRegistry(path)
+	if err != nil || len(loaded.Instances) != 1 || len(loaded.ARARules) != 1 || loaded.Created == "" {
+		t.Fatalf("LoadGPRegistry() = %+v, %v", loaded, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version": 2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadGPRegistry(path); err == nil {
+		t.Error("LoadGPRegistry() accepted version 2")
+	}
+	if err := os.WriteFile(path, []byte(`{"version": 1, "instances": [{"aid": "A000000087", "privileges": "0000"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadGPRegistry(path); err == nil {
+		t.Error("LoadGPRegistry() accepted 2-byte privileges")
+	}
+}
@@ -0,0 +1,205 @@
+package sim
+
+import (
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// StoreDataFormat selects the STORE DATA structure hint (P1 b5-b4) and how the payload is split into blocks.
+type StoreDataFormat int
+
+const (
+	// StoreDataRaw sends the payload as-is, split at BlockSize boundaries (P1 structure = no info).
+	StoreDataRaw StoreDataFormat = iota
+	// StoreDataDGI sends Data Grouping Identifiers (tag 2 bytes, length 1 or FF+2 bytes).
+	// Whole DGIs are packed into blocks; a DGI larger than a block is split across blocks.
+	StoreDataDGI
+	// StoreDataBERTLV sends BER-TLV objects, split at BlockSize boundaries.
+	StoreDataBERTLV
+)
+
+// STORE DATA P1 coding (GP Card Spec 11.11.2.1)
+const (
+	storeDataLastBlock = 0x80 // b8: last block
+	storeDataDGI       = 0x08 // b5-b4 = 01: DGI format
+	storeDataBERTLV    = 0x10 // b5-b4 = 10: BER-TLV format
+)
+
+// String returns the CLI name of the format.
+func (f StoreDataFormat) String() string {
+	switch f {
+	case StoreDataDGI:
+		return "dgi"
+	case StoreDataBERTLV:
+		return "tlv"
+	default:
+		return "raw"
+	}
+}
+
+// ParseStoreDataFormat parses "raw", "dgi" or "tlv".
+func ParseStoreDataFormat(s string) (StoreDataFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "raw":
+		return StoreDataRaw, nil
+	case "dgi":
+		return StoreDataDGI, nil
+	case "tlv", "ber-tlv", "bertlv":
+		return StoreDataBERTLV, nil
+	default:
+		return StoreDataRaw, fmt.Errorf("unknown STORE DATA format: %s (use: raw, dgi, tlv)", s)
+	}
+}
+
+// storeDataP1 builds the P1 byte for one STORE DATA block.
+func storeDataP1(format StoreDataFormat, last bool) byte {
+	var p1 byte
+	switch format {
+	case StoreDataDGI:
+		p1 |= storeDataDGI
+	case StoreDataBERTLV:
+		p1 |= storeDataBERTLV
+	}
+	if last {
+		p1 |= storeDataLastBlock
+	}
+	return p1
+}
+
+// splitDGIs splits a DGI stream into individual DGIs (header included).
+func splitDGIs(data []byte) ([][]byte, error) {
+	var out [][]byte
+	for off := 0; off < len(data); {
+		if off+3 > len(data) {
+			return nil, fmt.Errorf("truncated DGI header at offset %d", off)
+		}
+		hdr := 3
+		length := int(data[off+2])
+		if data[off+2] == 0xFF {
+			if off+5 > len(data) {
+				return nil, fmt.Errorf("truncated DGI length at offset %d", off)
+			}
+			hdr = 5
+			length = int(data[off+3])<<8 | int(data[off+4])
+		}
+		end := off + hdr + length
+		if end > len(data) {
+			return nil, fmt.Errorf("DGI %02X%02X at offset %d: length %d exceeds payload", data[off], data[off+1], off, length)
+		}
+		out = append(out, data[off:end])
+		off = end
+	}
+	return out, nil
+}
+
+// splitStoreDataBlocks splits the payload into STORE DATA blocks of at most blockSize bytes.
+// For DGI format whole DGIs are kept together whenever they fit into one block.
+func splitStoreDataBlocks(data []byte, format StoreDataFormat, blockSize int) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty STORE DATA payload")
+	}
+	if blockSize <= 0 {
+		blockSize = 200
+	}
+
+	chunk := func(b []byte) [][]byte {
+		var out [][]byte
+		for off := 0; off < len(b); off += blockSize {
+			end := off + blockSize
+			if end > len(b) {
+				end = len(b)
+			}
+			out = append(out, b[off:end])
+		}
+		return out
+	}
+
+	if format != StoreDataDGI {
+		return chunk(data), nil
+	}
+
+	dgis, err := splitDGIs(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks [][]byte
+	var cur []byte
+	for _, dgi := range dgis {
+		if len(dgi) > blockSize {
+			// Oversized DGI: flush pending data and spread it over consecutive blocks
+			if len(cur) > 0 {
+				blocks = append(blocks, cur)
+				cur = nil
+			}
+			blocks = append(blocks, chunk(dgi)...)
+			continue
+		}
+		if len(cur)+len(dgi) > blockSize {
+			blocks = append(blocks, cur)
+			cur = nil
+		}
+		cur = append(cur, dgi...)
+	}
+	if len(cur) > 0 {
+		blocks = append(blocks, cur)
+	}
+	return blocks, nil
+}
+
+// GPStoreData personalizes an application with STORE DATA over a secure channel.
+//
+// Flow: open secure channel (SCP02/SCP03, mac or mac+enc per cfg.Security),
+// INSTALL [for personalization] with the target AID, then STORE DATA blocks
+// numbered from 0 (P2) with the last-block bit set on the final block.
+// Block size is taken from cfg.BlockSize.
+func GPStoreData(reader *card.Reader, cfg GPConfig, aid []byte, data []byte, format StoreDataFormat) error {
+	if reader == nil {
+		return fmt.Errorf("nil reader")
+	}
+	if len(aid) == 0 {
+		return fmt.Errorf("empty target AID")
+	}
+	blocks, err := splitStoreDataBlocks(data, format, cfg.BlockSize)
+	if err != nil {
+		return err
+	}
+	if len(blocks) > 256 {
+		return fmt.Errorf("payload needs %d STORE DATA blocks (max 256), increase block size", len(blocks))
+	}
+
+	sess, err := OpenGPSessionAuto(reader, cfg)
+	if err != nil {
+		return err
+	}
+	le := byte(0x00)
+
+	// INSTALL [for personalization] (P1=20)
+	// Data: 00 | 00 | len(appAID) appAID | 00 | 00 | 00
+	installForPerso := make([]byte, 0, 8+len(aid))
+	installForPerso = append(installForPerso, 0x00, 0x00, byte(len(aid)))
+	installForPerso = append(installForPerso, aid...)
+	installForPerso = append(installForPerso, 0x00, 0x00, 0x00)
+	resp, err := sess.WrapAndSend(0x80, 0xE6, 0x20, 0x00, installForPerso, &le)
+	if err != nil {
+		return err
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("INSTALL [for personalization] failed: %s (SW=%04X)", resp.SWString(), resp.SW())
+	}
+
+	for i, block := range blocks {
+		p1 := storeDataP1(format, i == len(blocks)-1)
+		resp, err := gpStoreData(sess, p1, byte(i), block)
+		if err != nil {
+			return err
+		}
+		if !resp.IsOK() {
+			return fmt.Errorf("STORE DATA failed at block %d: %s (SW=%04X)", i, resp.SWString(), resp.SW())
+		}
+	}
+
+	return nil
+}
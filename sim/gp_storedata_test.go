@@ -0,0 +1,160 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+)
+
+// ============ STORE DATA P1 TESTS ============
+
+func TestStoreDataP1(t *testing.T) {
+	tests := []struct {
+		name   string
+		format StoreDataFormat
+		last   bool
+		want   byte
+	}{
+		{"Raw more", StoreDataRaw, false, 0x00},
+		{"Raw last", StoreDataRaw, true, 0x80},
+		{"DGI more", StoreDataDGI, false, 0x08},
+		{"DGI last", StoreDataDGI, true, 0x88},
+		{"TLV more", StoreDataBERTLV, false, 0x10},
+		{"TLV last", StoreDataBERTLV, true, 0x90},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := storeDataP1(tc.format, tc.last); got != tc.want {
+				t.Errorf("storeDataP1() = %02X, want %02X", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseStoreDataFormat(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    StoreDataFormat
+		wantErr bool
+	}{
+		{"raw", StoreDataRaw, false},
+		{"", StoreDataRaw, false},
+		{"DGI", StoreDataDGI, false},
+		{"tlv", StoreDataBERTLV, false},
+		{"xml", StoreDataRaw, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseStoreDataFormat(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseStoreDataFormat(%q) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("ParseStoreDataFormat(%q) = %v, want %v", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+// ============ BLOCK SPLITTING TESTS ============
+
+func TestSplitStoreDataBlocks_Raw(t *testing.T) {
+	data := make([]byte, 450)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	blocks, err := splitStoreDataBlocks(data, StoreDataRaw, 200)
+	if err != nil {
+		t.Fatalf("splitStoreDataBlocks() error = %v", err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(blocks))
+	}
+	if len(blocks[0]) != 200 || len(blocks[1]) != 200 || len(blocks[2]) != 50 {
+		t.Errorf("block sizes = %d/%d/%d, want 200/200/50", len(blocks[0]), len(blocks[1]), len(blocks[2]))
+	}
+	if !bytes.Equal(bytes.Join(blocks, nil), data) {
+		t.Errorf("joined blocks differ from payload")
+	}
+}
+
+func TestSplitStoreDataBlocks_DGI(t *testing.T) {
+	dgi := func(tag uint16, n int) []byte {
+		out := []byte{byte(tag >> 8), byte(tag)}
+		if n >= 0xFF {
+			out = append(out, 0xFF, byte(n>>8), byte(n))
+		} else {
+			out = append(out, byte(n))
+		}
+		return append(out, make([]byte, n)...)
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		blockSize int
+		wantSizes []int
+	}{
+		{
+			name:      "Two DGIs fit in one block",
+			data:      append(dgi(0x0101, 10), dgi(0x0102, 20)...),
+			blockSize: 200,
+			wantSizes: []int{36},
+		},
+		{
+			name:      "DGIs are not split at block boundary",
+			data:      append(append(dgi(0x0101, 90), dgi(0x0102, 90)...), dgi(0x0103, 90)...),
+			blockSize: 200,
+			wantSizes: []int{186, 93},
+		},
+		{
+			name:      "Oversized DGI spans blocks",
+			data:      append(dgi(0x0201, 10), dgi(0x8000, 300)...),
+			blockSize: 200,
+			wantSizes: []int{13, 200, 105},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			blocks, err := splitStoreDataBlocks(tc.data, StoreDataDGI, tc.blockSize)
+			if err != nil {
+				t.Fatalf("splitStoreDataBlocks() error = %v", err)
+			}
+			if len(blocks) != len(tc.wantSizes) {
+				t.Fatalf("got %d blocks, want %d", len(blocks), len(tc.wantSizes))
+			}
+			for i, b := range blocks {
+				if len(b) != tc.wantSizes[i] {
+					t.Errorf("block %d size = %d, want %d", i, len(b), tc.wantSizes[i])
+				}
+			}
+			if !bytes.Equal(bytes.Join(blocks, nil), tc.data) {
+				t.Errorf("joined blocks differ from payload")
+			}
+		})
+	}
+}
+
+func TestSplitStoreDataBlocks_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		format StoreDataFormat
+	}{
+		{"Empty", nil, StoreDataRaw},
+		{"Truncated DGI header", []byte{0x01, 0x01}, StoreDataDGI},
+		{"DGI length overflow", []byte{0x01, 0x01, 0x05, 0xAA}, StoreDataDGI},
+		{"Truncated extended length", []byte{0x01, 0x01, 0xFF, 0x01}, StoreDataDGI},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := splitStoreDataBlocks(tc.data, tc.format, 200); err == nil {
+				t.Errorf("splitStoreDataBlocks() should return error")
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package sim
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"sim_reader/card"
+)
+
+// Operator logo files (TS 31.102 4.6.1 / TS 51.011 10.6): EF_IMG in DF_GRAPHICS lists
+// the image instances, the image data itself lives in instance files (4Fxx) of the same DF.
+// EF_SPNI and EF_PNNI in ADF_USIM link the service provider and network names to an icon.
+var (
+	FID_DF_GRAPHICS = []byte{0x5F, 0x50}
+	FID_EF_IMG      = []byte{0x4F, 0x20}
+	FID_EF_SPNI     = []byte{0x6F, 0xDE}
+	FID_EF_PNNI     = []byte{0x6F, 0xDF}
+)
+
+// Image coding schemes of an EF_IMG descriptor
+const (
+	ImageCodingBasic       = 0x11 // black and white, 1 bit per raster point
+	ImageCodingColour      = 0x21
+	ImageCodingColourTrans = 0x22 // colour with transparency
+)
+
+// imgDescriptorLen is the size of one image instance descriptor in an EF_IMG record
+const imgDescriptorLen = 9
+
+// ImageInstance is one image instance listed in EF_IMG
+type ImageInstance struct {
+	Record int    // EF_IMG record number (the icon identifier used by SPNI/PNNI)
+	Index  int    // descriptor position in the record (0-based)
+	Width  int    // raster points
+	Height int    // raster points
+	Coding byte   // ImageCoding* value
+	FileID uint16 // instance file in DF_GRAPHICS
+	Offset int    // start of the image data in the instance file
+	Length int    // length of the image data
+}
+
+// CodingName returns a readable name of the coding scheme
+func (i ImageInstance) CodingName() string {
+	switch i.Coding {
+	case ImageCodingBasic:
+		return "basic (B/W)"
+	case ImageCodingColour:
+		return "colour"
+	case ImageCodingColourTrans:
+		return "colour (transparency)"
+	}
+	return fmt.Sprintf("unknown (%02X)", i.Coding)
+}
+
+// OperatorIcon is an icon link from EF_SPNI or a record of EF_PNNI
+type OperatorIcon struct {
+	Source          string // "EF_SPNI" or "EF_PNNI #n"
+	SelfExplanatory bool   // icon qualifier b1 = 0: the icon replaces the name
+	Record          int    // EF_IMG record, 0 if the icon is given by URI
+	URI             string
+}
+
+// ParseImgRecord decodes the image instance descriptors of an EF_IMG record.
+// Returns nil for an unused (all FF) record.
+func ParseImgRecord(record int, data []byte) []ImageInstance {
+	if len(data) == 0 || data[0] == 0xFF || data[0] == 0x00 {
+		return nil
+	}
+	var instances []ImageInstance
+	for i := 0; i < int(data[0]); i++ {
+		pos := 1 + i*imgDescriptorLen
+		if pos+imgDescriptorLen > len(data) {
+			break
+		}
+		d := data[pos : pos+imgDescriptorLen]
+		instances = append(instances, ImageInstance{
+			Record: record,
+			Index:  i,
+			Width:  int(d[0]),
+			Height: int(d[1]),
+			Coding: d[2],
+			FileID: uint16(d[3])<<8 | uint16(d[4]),
+			Offset: int(d[5])<<8 | int(d[6]),
+			Length: int(d[7])<<8 | int(d[8]),
+		})
+	}
+	return instances
+}
+
+// ParseIconLink decodes an EF_SPNI content or EF_PNNI record: icon qualifier followed by
+// tag 80 (EF_IMG record) or tag 81 (URI). Returns nil for an unused entry.
+func ParseIconLink(source string, data []byte) *OperatorIcon {
+	if len(data) < 2 || data[0] == 0xFF {
+		return nil
+	}
+	icon := &OperatorIcon{Source: source, SelfExplanatory: data[0]&0x01 == 0}
+	tag := data[1]
+	if len(data) < 3 || (tag != 0x80 && tag != 0x81) {
+		// Some cards store the bare record number after the qualifier
+		if tag == 0xFF || tag == 0x00 {
+			return nil
+		}
+		icon.Record = int(tag)
+		return icon
+	}
+	n := int(data[2])
+	if 3+n > len(data) || n == 0 {
+		return nil
+	}
+	value := data[3 : 3+n]
+	if tag == 0x80 {
+		icon.Record = int(value[0])
+	} else {
+		icon.URI = string(value)
+	}
+	return icon
+}
+
+// selectDFGraphics selects DF_GRAPHICS under DF_TELECOM
+func selectDFGraphics(reader *card.Reader) bool {
+	if !selectDFTelecom(reader) {
+		return false
+	}
+	resp, err := reader.SelectDF(FID_DF_GRAPHICS)
+	return err == nil && resp.IsOK()
+}
+
+// ReadImageInstances reads all image instances listed in EF_IMG
+func ReadImageInstances(reader *card.Reader) ([]ImageInstance, error) {
+	if !selectDFGraphics(reader) {
+		return nil, fmt.Errorf("DF_GRAPHICS (7F10/5F50) not found")
+	}
+	records, ok := readLinearEF(reader, FID_EF_IMG)
+	if !ok {
+		return nil, fmt.Errorf("EF_IMG not found")
+	}
+	var instances []ImageInstance
+	for i, data := range records {
+		instances = append(instances, ParseImgRecord(i+1, data)...)
+	}
+	return instances, nil
+}
+
+// ReadOperatorIcons reads the icon links of EF_SPNI and EF_PNNI from ADF_USIM
+func ReadOperatorIcons(reader *card.Reader) []OperatorIcon {
+	resp, err := reader.Select(GetUSIMAID())
+	if err != nil || !resp.IsOK() {
+		return nil
+	}
+	var icons []OperatorIcon
+	if icon := ParseIconLink("EF_SPNI", readTransparentEF(reader, FID_EF_SPNI)); icon != nil {
+		icons = append(icons, *icon)
+	}
+	records, _ := readLinearEF(reader, FID_EF_PNNI)
+	for i, data := range records {
+		if icon := ParseIconLink(fmt.Sprintf("EF_PNNI #%d", i+1), data); icon != nil {
+			icons = append(icons, *icon)
+		}
+	}
+	return icons
+}
+
+// selectInstanceFile selects an image instance file in DF_GRAPHICS and returns its size
+func selectInstanceFile(reader *card.Reader, fid uint16) (int, error) {
+	if !selectDFGraphics(reader) {
+		return 0, fmt.Errorf("DF_GRAPHICS (7F10/5F50) not found")
+	}
+	resp, err := reader.Select([]byte{byte(fid >> 8), byte(fid)})
+	if err != nil {
+		return 0, fmt.Errorf("failed to select instance file %04X: %w", fid, err)
+	}
+	if !resp.IsOK() {
+		return 0, fmt.Errorf("instance file %04X not found: %s", fid, resp.SWString())
+	}
+	return parseFCPFileSize(resp.Data), nil
+}
+
+// ReadImageData reads the image data of an instance from its instance file
+func ReadImageData(reader *card.Reader, inst ImageInstance) ([]byte, error) {
+	size, err := selectInstanceFile(reader, inst.FileID)
+	if err != nil {
+		return nil, err
+	}
+	if size > 0 && inst.Offset+inst.Length > size {
+		return nil, fmt.Errorf("image data (%d bytes at offset %d) exceeds instance file %04X (%d bytes)",
+			inst.Length, inst.Offset, inst.FileID, size)
+	}
+	data, err := reader.ReadAllBinary(inst.Offset + inst.Length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read instance file %04X: %w", inst.FileID, err)
+	}
+	if len(data) < inst.Offset+inst.Length {
+		return nil, fmt.Errorf("instance file %04X is shorter than the image data", inst.FileID)
+	}
+	return data[inst.Offset : inst.Offset+inst.Length], nil
+}
+
+// basicImageLen returns the size of basic image data: width, height and 1 bit per point
+func basicImageLen(width, height int) int {
+	return 2 + (width*height+7)/8
+}
+
+// DecodeBasicImage decodes a basic (B/W) image: width, height, then the raster points row
+// by row, MSB first, without row padding. A set bit is a dark point.
+func DecodeBasicImage(data []byte) (*image.Gray, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("image data too short")
+	}
+	width, height := int(data[0]), int(data[1])
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("empty image (%dx%d)", width, height)
+	}
+	if len(data) < basicImageLen(width, height) {
+		return nil, fmt.Errorf("%dx%d image needs %d bytes, got %d", width, height, basicImageLen(width, height), len(data))
+	}
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			bit := y*width + x
+			if data[2+bit/8]&(0x80>>(bit%8)) != 0 {
+				img.SetGray(x, y, color.Gray{Y: 0x00})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 0xFF})
+			}
+		}
+	}
+	return img, nil
+}
+
+// EncodeBasicImage converts an image to basic (B/W) image data. Points darker than mid
+// grey become dark; transparent points stay light. Images are limited to 255x255 points.
+func EncodeBasicImage(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	if width > 255 || height > 255 {
+		return nil, fmt.Errorf("image is %dx%d, at most 255x255 raster points are possible", width, height)
+	}
+	data := make([]byte, basicImageLen(width, height))
+	data[0], data[1] = byte(width), byte(height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			if c.A < 0x80 {
+				continue
+			}
+			if color.GrayModel.Convert(c).(color.Gray).Y < 0x80 {
+				bit := y*width + x
+				data[2+bit/8] |= 0x80 >> (bit % 8)
+			}
+		}
+	}
+	return data, nil
+}
+
+// ReadLogo reads and decodes the first basic (B/W) image instance of EF_IMG
+func ReadLogo(reader *card.Reader) (*image.Gray, *ImageInstance, error) {
+	inst, err := firstBasicInstance(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := ReadImageData(reader, *inst)
+	if err != nil {
+		return nil, nil, err
+	}
+	img, err := DecodeBasicImage(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("instance file %04X: %w", inst.FileID, err)
+	}
+	return img, inst, nil
+}
+
+// firstBasicInstance returns the first basic (B/W) image instance of EF_IMG
+func firstBasicInstance(reader *card.Reader) (*ImageInstance, error) {
+	instances, err := ReadImageInstances(reader)
+	if err != nil {
+		return nil, err
+	}
+	for _, inst := range instances {
+		if inst.Coding == ImageCodingBasic {
+			return &inst, nil
+		}
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("EF_IMG lists no image instances")
+	}
+	return nil, fmt.Errorf("EF_IMG has no basic (B/W) image instance, only %s", instances[0].CodingName())
+}
+
+// WriteLogo converts img to a basic (B/W) image and writes it over the first basic image
+// instance, then updates its EF_IMG descriptor with the new size. The instance file must
+// already exist and be large enough; files are never created or resized.
+func WriteLogo(reader *card.Reader, img image.Image) (*ImageInstance, error) {
+	data, err := EncodeBasicImage(img)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := firstBasicInstance(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := selectInstanceFile(reader, inst.FileID)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("instance file %04X size not found in FCP", inst.FileID)
+	}
+	if inst.Offset+len(data) > size {
+		return nil, fmt.Errorf("instance file %04X holds %d bytes from offset %d, the %dx%d logo needs %d",
+			inst.FileID, size-inst.Offset, inst.Offset, data[0], data[1], len(data))
+	}
+
+	for pos := 0; pos < len(data); pos += 255 {
+		chunk := data[pos:min(pos+255, len(data))]
+		resp, err := reader.UpdateBinary(uint16(inst.Offset+pos), chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write instance file %04X: %w", inst.FileID, err)
+		}
+		if !resp.IsOK() {
+			return nil, fmt.Errorf("instance file %04X write failed: %s", inst.FileID, resp.SWString())
+		}
+	}
+
+	if err := updateImgDescriptor(reader, inst, int(data[0]), int(data[1]), len(data)); err != nil {
+		return nil, err
+	}
+	inst.Width, inst.Height, inst.Length = int(data[0]), int(data[1]), len(data)
+	return inst, nil
+}
+
+// updateImgDescriptor rewrites width, height and data length of an EF_IMG descriptor
+func updateImgDescriptor(reader *card.Reader, inst *ImageInstance, width, height, length int) error {
+	if !selectDFGraphics(reader) {
+		return fmt.Errorf("DF_GRAPHICS (7F10/5F50) not found")
+	}
+	resp, err := reader.Select(FID_EF_IMG)
+	if err != nil || !resp.IsOK() {
+		return fmt.Errorf("EF_IMG not found")
+	}
+	recLen := parseFCPRecordSize(resp.Data)
+	if recLen == 0 {
+		return fmt.Errorf("EF_IMG record size not found in FCP")
+	}
+	resp, err = reader.ReadRecord(byte(inst.Record), byte(recLen))
+	if err != nil {
+		return fmt.Errorf("failed to read EF_IMG record %d: %w", inst.Record, err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("EF_IMG record %d read failed: %s", inst.Record, resp.SWString())
+	}
+
+	record := append([]byte(nil), resp.Data...)
+	pos := 1 + inst.Index*imgDescriptorLen
+	record[pos], record[pos+1] = byte(width), byte(height)
+	record[pos+7], record[pos+8] = byte(length>>8), byte(length)
+
+	resp, err = reader.UpdateRecord(byte(inst.Record), record)
+	if err != nil {
+		return fmt.Errorf("failed to write EF_IMG record %d: %w", inst.Record, err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("EF_IMG record %d write failed: %s", inst.Record, resp.SWString())
+	}
+	return nil
+}
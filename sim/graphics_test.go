@@ -0,0 +1,221 @@
+package sim
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ OPERATOR LOGO TESTS ============
+
+// logo8x2 is an 8x2 basic image: top row dark left half, bottom row alternating
+var logo8x2 = []byte{0x08, 0x02, 0xF0, 0xAA}
+
+// newGraphicsCard creates a card with DF_GRAPHICS holding one basic and one colour
+// instance in instance file 4F01 (size bytes), and SPNI/PNNI icon links in the USIM
+func newGraphicsCard(size int) (*card.MockCard, *card.Reader) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	instance := bytes.Repeat([]byte{0xFF}, size)
+	copy(instance[4:], logo8x2)
+
+	graphics := m.MF().AddDF(0x7F10).AddDF(0x5F50)
+	graphics.AddRecordEF(0x4F20,
+		// basic 8x2 at offset 4, length 4; colour 16x16 in 4F02
+		[]byte{0x02,
+			0x08, 0x02, 0x11, 0x4F, 0x01, 0x00, 0x04, 0x00, 0x04,
+			0x10, 0x10, 0x21, 0x4F, 0x02, 0x00, 0x00, 0x00, 0x86},
+		bytes.Repeat([]byte{0xFF}, 19))
+	graphics.AddEF(0x4F01, instance)
+
+	usim := m.AddADF(GetUSIMAID())
+	usim.AddEF(0x6FDE, []byte{0x00, 0x80, 0x01, 0x01, 0xFF, 0xFF})
+	usim.AddRecordEF(0x6FDF,
+		[]byte{0x01, 0x81, 0x0C, 'h', 't', 't', 'p', ':', '/', '/', 'x', '.', 'o', 'r', 'g'},
+		bytes.Repeat([]byte{0xFF}, 15))
+
+	return m, card.NewReaderWithTransport("Mock", m.ATR, m)
+}
+
+func TestParseImgRecord(t *testing.T) {
+	got := ParseImgRecord(3, []byte{0x01, 0x28, 0x14, 0x11, 0x4F, 0x05, 0x01, 0x00, 0x00, 0x66, 0xFF})
+	if len(got) != 1 {
+		t.Fatalf("instances = %d, want 1", len(got))
+	}
+	want := ImageInstance{Record: 3, Width: 40, Height: 20, Coding: ImageCodingBasic, FileID: 0x4F05, Offset: 256, Length: 102}
+	if got[0] != want {
+		t.Errorf("instance = %+v, want %+v", got[0], want)
+	}
+	if ParseImgRecord(1, bytes.Repeat([]byte{0xFF}, 10)) != nil {
+		t.Errorf("unused record decoded")
+	}
+	// Truncated descriptor is ignored
+	if got := ParseImgRecord(1, []byte{0x02, 0x08, 0x02, 0x11, 0x4F, 0x01, 0x00, 0x00, 0x00, 0x04, 0x08}); len(got) != 1 {
+		t.Errorf("truncated record: instances = %d, want 1", len(got))
+	}
+}
+
+func TestParseIconLink(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want *OperatorIcon
+	}{
+		{"record", []byte{0x00, 0x80, 0x01, 0x02}, &OperatorIcon{Source: "s", SelfExplanatory: true, Record: 2}},
+		{"uri", []byte{0x01, 0x81, 0x03, 'a', '/', 'b'}, &OperatorIcon{Source: "s", URI: "a/b"}},
+		{"bare record", []byte{0x01, 0x05}, &OperatorIcon{Source: "s", Record: 5}},
+		{"unused", []byte{0xFF, 0xFF, 0xFF}, nil},
+		{"empty link", []byte{0x00, 0xFF}, nil},
+	}
+	for _, tt := range tests {
+		got := ParseIconLink("s", tt.data)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBasicImage_RoundTrip(t *testing.T) {
+	img, err := DecodeBasicImage(logo8x2)
+	if err != nil {
+		t.Fatalf("DecodeBasicImage() error = %v", err)
+	}
+	if img.Bounds().Dx() != 8 || img.Bounds().Dy() != 2 {
+		t.Fatalf("size = %v", img.Bounds())
+	}
+	if img.GrayAt(0, 0).Y != 0 || img.GrayAt(4, 0).Y != 0xFF || img.GrayAt(0, 1).Y != 0 || img.GrayAt(1, 1).Y != 0xFF {
+		t.Errorf("raster points decoded wrong")
+	}
+
+	data, err := EncodeBasicImage(img)
+	if err != nil {
+		t.Fatalf("EncodeBasicImage() error = %v", err)
+	}
+	if !bytes.Equal(data, logo8x2) {
+		t.Errorf("encoded = %X, want %X", data, logo8x2)
+	}
+
+	if _, err := DecodeBasicImage([]byte{0x08, 0x08, 0x00}); err == nil {
+		t.Errorf("short image data accepted")
+	}
+}
+
+func TestEncodeBasicImage_Threshold(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	img.Set(0, 0, color.NRGBA{R: 0x20, G: 0x20, B: 0x20, A: 0xFF}) // dark
+	img.Set(1, 0, color.NRGBA{R: 0xE0, G: 0xE0, B: 0xE0, A: 0xFF}) // light
+	img.Set(2, 0, color.NRGBA{A: 0x00})                            // transparent
+	data, err := EncodeBasicImage(img)
+	if err != nil {
+		t.Fatalf("EncodeBasicImage() error = %v", err)
+	}
+	if !bytes.Equal(data, []byte{0x03, 0x01, 0x80}) {
+		t.Errorf("encoded = %X, want 030180", data)
+	}
+
+	if _, err := EncodeBasicImage(image.NewGray(image.Rect(0, 0, 300, 10))); err == nil {
+		t.Errorf("300 points wide image accepted")
+	}
+}
+
+func TestReadImageInstances(t *testing.T) {
+	_, reader := newGraphicsCard(32)
+	instances, err := ReadImageInstances(reader)
+	if err != nil {
+		t.Fatalf("ReadImageInstances() error = %v", err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("instances = %d, want 2", len(instances))
+	}
+	if instances[1].CodingName() != "colour" || instances[1].Index != 1 {
+		t.Errorf("second instance = %+v", instances[1])
+	}
+
+	icons := ReadOperatorIcons(reader)
+	if len(icons) != 2 {
+		t.Fatalf("icons = %+v, want SPNI and PNNI #1", icons)
+	}
+	if icons[0].Source != "EF_SPNI" || icons[0].Record != 1 || !icons[0].SelfExplanatory {
+		t.Errorf("SPNI icon = %+v", icons[0])
+	}
+	if icons[1].Source != "EF_PNNI #1" || icons[1].URI != "http://x.org" {
+		t.Errorf("PNNI icon = %+v", icons[1])
+	}
+
+	img, inst, err := ReadLogo(reader)
+	if err != nil {
+		t.Fatalf("ReadLogo() error = %v", err)
+	}
+	if inst.FileID != 0x4F01 || img.Bounds().Dx() != 8 {
+		t.Errorf("logo = %v from %+v", img.Bounds(), inst)
+	}
+}
+
+func TestReadImageInstances_NoGraphics(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddDF(0x7F10)
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	if _, err := ReadImageInstances(reader); err == nil || !strings.Contains(err.Error(), "DF_GRAPHICS") {
+		t.Errorf("error = %v, want DF_GRAPHICS not found", err)
+	}
+}
+
+func TestWriteLogo(t *testing.T) {
+	m, reader := newGraphicsCard(32)
+
+	// 16x8 logo: 2 + 16 bytes from offset 4 fits the 32 byte instance file
+	logo := image.NewGray(image.Rect(0, 0, 16, 8))
+	for x := 0; x < 16; x++ {
+		logo.SetGray(x, 0, color.Gray{Y: 0xFF})
+	}
+	inst, err := WriteLogo(reader, logo)
+	if err != nil {
+		t.Fatalf("WriteLogo() error = %v", err)
+	}
+	if inst.Width != 16 || inst.Height != 8 || inst.Length != 18 {
+		t.Errorf("instance = %+v", inst)
+	}
+
+	instances, _ := ReadImageInstances(reader)
+	if instances[0].Width != 16 || instances[0].Length != 18 || instances[0].Offset != 4 {
+		t.Errorf("EF_IMG descriptor not updated: %+v", instances[0])
+	}
+	if instances[1].FileID != 0x4F02 || instances[1].Length != 0x86 {
+		t.Errorf("colour descriptor changed: %+v", instances[1])
+	}
+	img, _, err := ReadLogo(reader)
+	if err != nil {
+		t.Fatalf("ReadLogo() error = %v", err)
+	}
+	if img.GrayAt(0, 0).Y != 0xFF || img.GrayAt(0, 1).Y != 0 {
+		t.Errorf("written logo reads back wrong")
+	}
+
+	// A single UPDATE BINARY at the instance offset, data before it is untouched
+	var updates [][]byte
+	for _, apdu := range m.Log {
+		if len(apdu) > 3 && apdu[1] == 0xD6 {
+			updates = append(updates, apdu)
+		}
+	}
+	if len(updates) != 1 || updates[0][2] != 0x00 || updates[0][3] != 0x04 {
+		t.Errorf("UPDATE BINARY commands = %X, want one at offset 4", updates)
+	}
+}
+
+func TestWriteLogo_InstanceTooSmall(t *testing.T) {
+	m, reader := newGraphicsCard(16)
+	logo := image.NewGray(image.Rect(0, 0, 16, 8))
+	_, err := WriteLogo(reader, logo)
+	if err == nil || !strings.Contains(err.Error(), "needs 18") {
+		t.Fatalf("error = %v, want instance file too small", err)
+	}
+	for _, apdu := range m.Log {
+		if len(apdu) > 1 && (apdu[1] == 0xD6 || apdu[1] == 0xDC) {
+			t.Errorf("card written although the logo does not fit: %X", apdu)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package sim
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// IMSTemplates are the patterns the ISIM identities are generated from (see GenerateIMSIdentity).
+// Placeholders: {imsi}, {mcc}, {mnc} (3 digits, zero padded as in 3gppnetwork.org names),
+// {msin}, and except in Domain, {domain} and {impi}.
+type IMSTemplates struct {
+	Domain string `json:"domain,omitempty"`
+	IMPI   string `json:"impi,omitempty"`
+	IMPU   string `json:"impu,omitempty"`
+	PCSCF  string `json:"pcscf,omitempty"` // empty = no P-CSCF
+}
+
+// DefaultIMSTemplates derive the identities from the IMSI as in 3GPP TS 23.003
+var DefaultIMSTemplates = IMSTemplates{
+	Domain: "ims.mnc{mnc}.mcc{mcc}.3gppnetwork.org",
+	IMPI:   "{imsi}@{domain}",
+	IMPU:   "sip:{impi}",
+}
+
+// IMSIdentity is a generated set of ISIM identities
+type IMSIdentity struct {
+	IMPI   string
+	IMPU   string
+	Domain string
+	PCSCF  string // empty when no P-CSCF template is set
+}
+
+// Merge returns t with the templates set in o replacing its own
+func (t IMSTemplates) Merge(o IMSTemplates) IMSTemplates {
+	if o.Domain != "" {
+		t.Domain = o.Domain
+	}
+	if o.IMPI != "" {
+		t.IMPI = o.IMPI
+	}
+	if o.IMPU != "" {
+		t.IMPU = o.IMPU
+	}
+	if o.PCSCF != "" {
+		t.PCSCF = o.PCSCF
+	}
+	return t
+}
+
+// GenerateIMSIdentity fills the templates from the IMSI. mncLen is the MNC length of EF_AD
+// (2 or 3) and decides where the MNC ends in the IMSI.
+func GenerateIMSIdentity(imsi string, mncLen int, t IMSTemplates) (IMSIdentity, error) {
+	var id IMSIdentity
+	if _, err := EncodeIMSI(imsi); err != nil {
+		return id, err
+	}
+	if mncLen != 2 && mncLen != 3 {
+		return id, fmt.Errorf("invalid MNC length %d (must be 2 or 3)", mncLen)
+	}
+	if t.Domain == "" || t.IMPI == "" || t.IMPU == "" {
+		return id, fmt.Errorf("domain, IMPI and IMPU templates are required")
+	}
+
+	mcc, mnc := SplitIMSI(imsi, mncLen)
+	if len(mnc) == 2 {
+		mnc = "0" + mnc
+	}
+	fields := []string{"{imsi}", imsi, "{mcc}", mcc, "{mnc}", mnc, "{msin}", imsi[3+mncLen:]}
+
+	var err error
+	expand := func(name, template string, extra ...string) string {
+		value := strings.NewReplacer(append(fields, extra...)...).Replace(template)
+		if err == nil && strings.ContainsAny(value, "{}") {
+			err = fmt.Errorf("%s template %q: unknown placeholder", name, template)
+		}
+		return value
+	}
+	id.Domain = expand("domain", t.Domain)
+	id.IMPI = expand("IMPI", t.IMPI, "{domain}", id.Domain)
+	id.IMPU = expand("IMPU", t.IMPU, "{domain}", id.Domain, "{impi}", id.IMPI)
+	if t.PCSCF != "" {
+		id.PCSCF = expand("P-CSCF", t.PCSCF, "{domain}", id.Domain, "{impi}", id.IMPI)
+	}
+	if err != nil {
+		return IMSIdentity{}, err
+	}
+	return id, nil
+}
+
+// LoadIMSTemplates reads templates from a JSON or YAML file ({"domain": ..., "impi": ...,
+// "impu": ..., "pcscf": ...}). Templates the file does not set keep their defaults.
+func LoadIMSTemplates(filename string) (IMSTemplates, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return IMSTemplates{}, fmt.Errorf("failed to read IMS template file: %w", err)
+	}
+	if IsYAMLFile(filename) {
+		if data, err = yamlDocumentToJSON(data, reflect.TypeOf(IMSTemplates{})); err != nil {
+			return IMSTemplates{}, fmt.Errorf("failed to parse IMS template file: %w", err)
+		}
+	}
+	var t IMSTemplates
+	if err := decodeConfigStrict(data, &t); err != nil {
+		return IMSTemplates{}, fmt.Errorf("failed to parse IMS template file: %w", err)
+	}
+	return DefaultIMSTemplates.Merge(t), nil
+}
@@ -0,0 +1,83 @@
+package sim
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ============ IMS IDENTITY TEMPLATE TESTS ============
+
+func TestGenerateIMSIdentity(t *testing.T) {
+	tests := []struct {
+		name    string
+		imsi    string
+		mncLen  int
+		tpl     IMSTemplates
+		want    IMSIdentity
+		wantErr string
+	}{
+		{"2-digit MNC", "250880000000001", 2, DefaultIMSTemplates, IMSIdentity{
+			IMPI:   "250880000000001@ims.mnc088.mcc250.3gppnetwork.org",
+			IMPU:   "sip:250880000000001@ims.mnc088.mcc250.3gppnetwork.org",
+			Domain: "ims.mnc088.mcc250.3gppnetwork.org",
+		}, ""},
+		{"3-digit MNC", "310260000000001", 3, DefaultIMSTemplates, IMSIdentity{
+			IMPI:   "310260000000001@ims.mnc260.mcc310.3gppnetwork.org",
+			IMPU:   "sip:310260000000001@ims.mnc260.mcc310.3gppnetwork.org",
+			Domain: "ims.mnc260.mcc310.3gppnetwork.org",
+		}, ""},
+		{"P-CSCF and operator domain", "001010123456789", 2,
+			DefaultIMSTemplates.Merge(IMSTemplates{Domain: "ims.example.net", IMPU: "sip:{msin}@{domain}", PCSCF: "pcscf.{domain}"}),
+			IMSIdentity{
+				IMPI:   "001010123456789@ims.example.net",
+				IMPU:   "sip:0123456789@ims.example.net",
+				Domain: "ims.example.net",
+				PCSCF:  "pcscf.ims.example.net",
+			}, ""},
+		{"invalid IMSI", "25088A", 2, DefaultIMSTemplates, IMSIdentity{}, "non-digit"},
+		{"invalid MNC length", "250880000000001", 4, DefaultIMSTemplates, IMSIdentity{}, "MNC length"},
+		{"unknown placeholder", "250880000000001", 2, DefaultIMSTemplates.Merge(IMSTemplates{IMPI: "{iccid}@{domain}"}), IMSIdentity{}, "unknown placeholder"},
+		{"domain refers to itself", "250880000000001", 2, DefaultIMSTemplates.Merge(IMSTemplates{Domain: "{domain}"}), IMSIdentity{}, "unknown placeholder"},
+		{"missing template", "250880000000001", 2, IMSTemplates{Domain: "ims.example.net"}, IMSIdentity{}, "required"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := GenerateIMSIdentity(tc.imsi, tc.mncLen, tc.tpl)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("GenerateIMSIdentity() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateIMSIdentity() error = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("GenerateIMSIdentity() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadIMSTemplates(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "ims.yaml")
+	os.WriteFile(yamlFile, []byte("domain: ims.example.net\npcscf: \"pcscf.{domain}\"\n"), 0644)
+
+	got, err := LoadIMSTemplates(yamlFile)
+	if err != nil {
+		t.Fatalf("LoadIMSTemplates() error = %v", err)
+	}
+	want := IMSTemplates{Domain: "ims.example.net", IMPI: DefaultIMSTemplates.IMPI, IMPU: DefaultIMSTemplates.IMPU, PCSCF: "pcscf.{domain}"}
+	if got != want {
+		t.Errorf("LoadIMSTemplates() = %+v, want %+v", got, want)
+	}
+
+	jsonFile := filepath.Join(dir, "ims.json")
+	os.WriteFile(jsonFile, []byte(`{"realm": "ims.example.net"}`), 0644)
+	if _, err := LoadIMSTemplates(jsonFile); err == nil {
+		t.Error("LoadIMSTemplates() accepted an unknown field")
+	}
+}
@@ -24,14 +24,22 @@ type ISIMData struct {
 	// Raw data for debugging
 	RawFiles map[string][]byte
 
+	// Read outcome per EF (present, absent or failed)
+	Files FileStatuses
+
 	// Status
 	Available bool
 }
 
 // ReadISIM reads all ISIM application data
 func ReadISIM(reader *card.Reader) (*ISIMData, error) {
+	if IsClassicSIM() {
+		return nil, ErrClassicSIM
+	}
+	defer reader.Measure("read ISIM")()
 	data := &ISIMData{
 		RawFiles:  make(map[string][]byte),
+		Files:     make(FileStatuses),
 		IMPU:      make([]string, 0),
 		PCSCF:     make([]string, 0),
 		Available: false,
@@ -54,8 +62,8 @@ func ReadISIM(reader *card.Reader) (*ISIMData, error) {
 		isimSelected = true
 	}
 
-	// Method 2: Try standard AID if detected failed
-	if !isimSelected && len(DetectedISIM_AID) > 0 {
+	// Method 2: Try standard AID if detected failed (not for an explicitly selected instance or AID)
+	if !isimSelected && len(DetectedISIM_AID) > 0 && isimFallbackAllowed() {
 		resp, err = reader.Select(AID_ISIM)
 		if err == nil && resp.IsOK() {
 			isimSelected = true
@@ -83,7 +91,7 @@ func ReadISIM(reader *card.Reader) (*ISIMData, error) {
 	if !isimSelected {
 		swStr := "unknown error"
 		if resp != nil {
-			swStr = card.SWToString(resp.SW())
+			swStr = resp.SWString()
 		}
 		return data, fmt.Errorf("ISIM not available: %s", swStr)
 	}
@@ -91,37 +99,41 @@ func ReadISIM(reader *card.Reader) (*ISIMData, error) {
 	data.Available = true
 
 	// Read IMPI (IMS Private User Identity)
-	if _, raw, err := readEF(reader, 0x6F02); err == nil {
+	if raw, ok := data.Files.readTracked(reader, "EF_IMPI", 0x6F02); ok {
 		data.IMPI = DecodeIMPI(raw)
 		data.RawFiles["EF_IMPI"] = raw
 	}
 
 	// Read Home Network Domain Name
-	if _, raw, err := readEF(reader, 0x6F03); err == nil {
+	if raw, ok := data.Files.readTracked(reader, "EF_DOMAIN", 0x6F03); ok {
 		data.Domain = DecodeDomain(raw)
 		data.RawFiles["EF_DOMAIN"] = raw
 	}
 
 	// Read IMPU (IMS Public User Identity) - linear fixed file, can have multiple records
-	if impus, raw := readAllIMPU(reader); len(impus) > 0 {
+	impus, raw, st := readAllIMPU(reader)
+	data.Files["EF_IMPU"] = st
+	if len(impus) > 0 {
 		data.IMPU = impus
 		data.RawFiles["EF_IMPU"] = raw
 	}
 
 	// Read P-CSCF addresses - linear fixed file
-	if pcscfs, raw := readAllPCSCF(reader); len(pcscfs) > 0 {
+	pcscfs, raw, st := readAllPCSCF(reader)
+	data.Files["EF_PCSCF"] = st
+	if len(pcscfs) > 0 {
 		data.PCSCF = pcscfs
 		data.RawFiles["EF_PCSCF"] = raw
 	}
 
 	// Read IST (ISIM Service Table)
-	if _, raw, err := readEF(reader, 0x6F07); err == nil {
+	if raw, ok := data.Files.readTracked(reader, "EF_IST", 0x6F07); ok {
 		data.IST = DecodeIST(raw)
 		data.RawFiles["EF_IST"] = raw
 	}
 
 	// Read Administrative Data
-	if _, raw, err := readEF(reader, 0x6FAD); err == nil {
+	if raw, ok := data.Files.readTracked(reader, "EF_AD", 0x6FAD); ok {
 		data.AdminData = DecodeAD(raw)
 		data.RawFiles["EF_AD"] = raw
 	}
@@ -130,25 +142,16 @@ func ReadISIM(reader *card.Reader) (*ISIMData, error) {
 }
 
 // readAllIMPU reads all IMPU records
-func readAllIMPU(reader *card.Reader) ([]string, []byte) {
+func readAllIMPU(reader *card.Reader) ([]string, []byte, EFStatus) {
 	var impus []string
 	var allRaw []byte
 
 	// Select EF_IMPU
-	fid := []byte{0x6F, 0x04}
-
-	var resp *card.APDUResponse
-	var err error
-
-	if UseGSMCommands {
-		resp, err = reader.SelectGSM(fid)
-	} else {
-		resp, err = reader.Select(fid)
-	}
-
-	if err != nil || !resp.IsOK() {
-		return impus, nil
+	resp, st := selectEFStatus(reader, 0x6F04)
+	if st.State != EFPresent {
+		return impus, nil, st
 	}
+	var err error
 
 	// Get record size from response
 	var recordLen int
@@ -165,7 +168,9 @@ func readAllIMPU(reader *card.Reader) ([]string, []byte) {
 			}
 		}
 	} else {
-		recordLen = parseFCPRecordSize(resp.Data)
+		if recordLen = fileMapRecordSize(reader, 0x6F04); recordLen == 0 {
+			recordLen = parseFCPRecordSize(resp.Data)
+		}
 		numRecords = parseFCPNumRecords(resp.Data)
 	}
 
@@ -198,29 +203,20 @@ func readAllIMPU(reader *card.Reader) ([]string, []byte) {
 		}
 	}
 
-	return impus, allRaw
+	return impus, allRaw, EFStatus{State: EFPresent}
 }
 
 // readAllPCSCF reads all P-CSCF records
-func readAllPCSCF(reader *card.Reader) ([]string, []byte) {
+func readAllPCSCF(reader *card.Reader) ([]string, []byte, EFStatus) {
 	var pcscfs []string
 	var allRaw []byte
 
 	// Select EF_PCSCF
-	fid := []byte{0x6F, 0x09}
-
-	var resp *card.APDUResponse
-	var err error
-
-	if UseGSMCommands {
-		resp, err = reader.SelectGSM(fid)
-	} else {
-		resp, err = reader.Select(fid)
-	}
-
-	if err != nil || !resp.IsOK() {
-		return pcscfs, nil
+	resp, st := selectEFStatus(reader, 0x6F09)
+	if st.State != EFPresent {
+		return pcscfs, nil, st
 	}
+	var err error
 
 	// Get record size from response
 	var recordLen int
@@ -237,7 +233,9 @@ func readAllPCSCF(reader *card.Reader) ([]string, []byte) {
 			}
 		}
 	} else {
-		recordLen = parseFCPRecordSize(resp.Data)
+		if recordLen = fileMapRecordSize(reader, 0x6F09); recordLen == 0 {
+			recordLen = parseFCPRecordSize(resp.Data)
+		}
 		numRecords = parseFCPNumRecords(resp.Data)
 	}
 
@@ -282,38 +280,13 @@ func readAllPCSCF(reader *card.Reader) ([]string, []byte) {
 		}
 	}
 
-	return pcscfs, allRaw
+	return pcscfs, allRaw, EFStatus{State: EFPresent}
 }
 
 // parseFCPNumRecords extracts number of records from FCP template
 func parseFCPNumRecords(fcp []byte) int {
-	if len(fcp) < 4 {
-		return 0
-	}
-
-	idx := 0
-	if fcp[0] == 0x62 {
-		idx = 2
-	}
-
-	for idx < len(fcp)-2 {
-		tag := fcp[idx]
-		length := int(fcp[idx+1])
-		if idx+2+length > len(fcp) {
-			break
-		}
-
-		if tag == 0x82 && length >= 5 {
-			// File descriptor: byte0, coding, recLen(2), numRecords
-			if length >= 5 {
-				return int(fcp[idx+6])
-			}
-		}
-
-		idx += 2 + length
-	}
-
-	return 0
+	f, _ := card.ParseFCP(fcp)
+	return f.NumRecords()
 }
 
 // HasService checks if an IST service is available
@@ -354,11 +327,7 @@ func (i *ISIMData) GetEnabledServices() []string {
 	var services []string
 	for num, enabled := range i.IST {
 		if enabled {
-			if name, ok := ISTServices[num]; ok {
-				services = append(services, fmt.Sprintf("%d: %s", num, name))
-			} else {
-				services = append(services, fmt.Sprintf("%d: Unknown", num))
-			}
+			services = append(services, fmt.Sprintf("%d: %s", num, ServiceName("IST", num)))
 		}
 	}
 	return services
@@ -0,0 +1,96 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// ISIMApp is an ISIM application listed in EF_DIR
+type ISIMApp struct {
+	Index int    // 1-based position among the ISIM entries of EF_DIR
+	AID   []byte // Full AID from EF_DIR
+	Label string // Application label (e.g. "ISIM", "MCPTT ISIM")
+	Path  []byte // DF path from EF_DIR, if any
+}
+
+var (
+	// DetectedISIMApps lists every ISIM application of EF_DIR in EF_DIR order
+	// (cards with a commercial IMS and a mission-critical ISIM have two)
+	DetectedISIMApps []ISIMApp
+
+	// SelectedISIMIndex is the ISIM instance chosen with SelectISIMInstance (0 = default ISIM).
+	// With an explicit instance the standard AID and DF path fallbacks are not used,
+	// so reads and writes never silently reach another ISIM.
+	SelectedISIMIndex int
+)
+
+// isISIMApplication reports whether an EF_DIR entry is an ISIM: 3GPP RID with
+// application code 1004, or an application label naming an ISIM
+func isISIMApplication(aid []byte, label string) bool {
+	if len(aid) >= 7 && bytes.Equal(aid[:5], []byte{0xA0, 0x00, 0x00, 0x00, 0x87}) {
+		return aid[5] == 0x10 && aid[6] == 0x04
+	}
+	return len(aid) > 0 && strings.Contains(strings.ToUpper(label), "ISIM")
+}
+
+// SelectISIMInstance makes ISIM instance index (1-based, EF_DIR order) the target of all
+// ISIM reads and writes. Index 0 restores the default ISIM.
+func SelectISIMInstance(index int) error {
+	if index == 0 {
+		SelectedISIMIndex = 0
+		if len(DetectedISIMApps) > 0 {
+			DetectedISIM_AID = DetectedISIMApps[0].AID
+		}
+		return nil
+	}
+	if index < 1 || index > len(DetectedISIMApps) {
+		return fmt.Errorf("ISIM instance %d not found (EF_DIR lists %d ISIM application(s))", index, len(DetectedISIMApps))
+	}
+	app := DetectedISIMApps[index-1]
+	DetectedISIM_AID = app.AID
+	DetectedISIM_Path = nil
+	if len(app.Path) >= 2 {
+		DetectedISIM_Path = app.Path
+	}
+	SelectedISIMIndex = index
+	return nil
+}
+
+// ISIMInstance is the data of one ISIM application on a multi-ISIM card
+type ISIMInstance struct {
+	Index int
+	AID   string
+	Label string
+	Data  *ISIMData
+	Err   error // Read error (Data.Available is false)
+}
+
+// HasMultipleISIMs reports whether EF_DIR lists more than one ISIM application
+func HasMultipleISIMs() bool {
+	return len(DetectedISIMApps) > 1
+}
+
+// ReadISIMInstances reads every ISIM application listed in EF_DIR, each on its own
+// logical channel where supported. The ISIM selection in effect is restored afterwards.
+func ReadISIMInstances(reader *card.Reader) []ISIMInstance {
+	savedAID, savedPath, savedIndex := DetectedISIM_AID, DetectedISIM_Path, SelectedISIMIndex
+	defer func() {
+		DetectedISIM_AID, DetectedISIM_Path, SelectedISIMIndex = savedAID, savedPath, savedIndex
+	}()
+
+	instances := make([]ISIMInstance, 0, len(DetectedISIMApps))
+	for _, app := range DetectedISIMApps {
+		inst := ISIMInstance{Index: app.Index, AID: fmt.Sprintf("%X", app.AID), Label: app.Label}
+		SelectISIMInstance(app.Index)
+		inst.Err = WithISIMChannel(reader, func() error {
+			var err error
+			inst.Data, err = ReadISIM(reader)
+			return err
+		})
+		instances = append(instances, inst)
+	}
+	return instances
+}
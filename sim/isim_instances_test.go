@@ -0,0 +1,132 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ MULTI-ISIM TESTS ============
+
+var (
+	testISIM1 = []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x04, 0xFF, 0x49, 0xFF, 0x05, 0x89}
+	testISIM2 = []byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x04, 0xFF, 0x49, 0xFF, 0x05, 0x8A}
+)
+
+// dirRecord builds an EF_DIR record: 61 { 4F aid, 50 label } padded with FF
+func dirRecord(aid []byte, label string) []byte {
+	inner := append([]byte{0x4F, byte(len(aid))}, aid...)
+	inner = append(inner, 0x50, byte(len(label)))
+	inner = append(inner, label...)
+	rec := append([]byte{0x61, byte(len(inner))}, inner...)
+	return append(rec, bytes.Repeat([]byte{0xFF}, 40-len(rec))...)
+}
+
+// newMultiISIMTestReader returns a card with USIM, a commercial ISIM and an MCPTT ISIM
+func newMultiISIMTestReader() (*card.Reader, *card.MockFile, *card.MockFile) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddRecordEF(0x2F00,
+		dirRecord(AID_USIM, "USIM"),
+		dirRecord(testISIM1, "ISIM"),
+		dirRecord(testISIM2, "MCPTT ISIM"))
+	m.AddADF(AID_USIM)
+	isim1 := m.AddADF(testISIM1)
+	isim1.AddEF(0x6F02, EncodeIMPI("user@ims.example.org", 48))
+	isim2 := m.AddADF(testISIM2)
+	isim2.AddEF(0x6F02, EncodeIMPI("mcptt@mc.example.org", 48))
+	return card.NewReaderWithTransport("Mock", m.ATR, m), isim1, isim2
+}
+
+func resetISIMDetection() {
+	DetectedUSIM_AID, DetectedISIM_AID = nil, nil
+	DetectedUSIM_Path, DetectedISIM_Path = nil, nil
+	DetectedISIMApps = nil
+	SelectedISIMIndex = 0
+	DetectedDIRProbe = nil
+}
+
+func TestDetectApplicationAIDs_MultipleISIM(t *testing.T) {
+	defer resetISIMDetection()
+	reader, _, _ := newMultiISIMTestReader()
+	DetectApplicationAIDs(reader)
+
+	if len(DetectedISIMApps) != 2 {
+		t.Fatalf("DetectedISIMApps = %+v, want 2 entries", DetectedISIMApps)
+	}
+	if DetectedISIMApps[1].Index != 2 || DetectedISIMApps[1].Label != "MCPTT ISIM" {
+		t.Errorf("second ISIM = %+v, want index 2 label MCPTT ISIM", DetectedISIMApps[1])
+	}
+	if !bytes.Equal(DetectedISIM_AID, testISIM1) {
+		t.Errorf("default ISIM AID = %X, want first ISIM %X", DetectedISIM_AID, testISIM1)
+	}
+}
+
+func TestReadISIMInstances(t *testing.T) {
+	defer resetISIMDetection()
+	reader, _, _ := newMultiISIMTestReader()
+	DetectApplicationAIDs(reader)
+
+	instances := ReadISIMInstances(reader)
+	want := []string{"user@ims.example.org", "mcptt@mc.example.org"}
+	if len(instances) != len(want) {
+		t.Fatalf("ReadISIMInstances() = %d instances, want %d", len(instances), len(want))
+	}
+	for i, inst := range instances {
+		if inst.Err != nil || inst.Data.IMPI != want[i] {
+			t.Errorf("instance %d: IMPI = %q, err = %v, want %q", inst.Index, inst.Data.IMPI, inst.Err, want[i])
+		}
+	}
+	if !bytes.Equal(DetectedISIM_AID, testISIM1) || SelectedISIMIndex != 0 {
+		t.Errorf("selection not restored: AID %X, index %d", DetectedISIM_AID, SelectedISIMIndex)
+	}
+
+	exported := ExportISIMInstances(instances)
+	if exported[1].AID != "A0000000871004FF49FF058A" || exported[1].IMPI != want[1] {
+		t.Errorf("ExportISIMInstances()[1] = %+v", exported[1])
+	}
+}
+
+func TestSelectISIMInstance(t *testing.T) {
+	defer resetISIMDetection()
+	reader, isim1, isim2 := newMultiISIMTestReader()
+	DetectApplicationAIDs(reader)
+
+	if err := SelectISIMInstance(3); err == nil {
+		t.Error("SelectISIMInstance(3) succeeded, want error for 2 ISIMs")
+	}
+	if err := SelectISIMInstance(2); err != nil {
+		t.Fatalf("SelectISIMInstance(2) error = %v", err)
+	}
+	if err := WriteIMPI(reader, "new@mc.example.org"); err != nil {
+		t.Fatalf("WriteIMPI() error = %v", err)
+	}
+
+	if got := DecodeIMPI(isim2.Children[0].Data); got != "new@mc.example.org" {
+		t.Errorf("ISIM 2 IMPI = %q, want new@mc.example.org", got)
+	}
+	if got := DecodeIMPI(isim1.Children[0].Data); got != "user@ims.example.org" {
+		t.Errorf("ISIM 1 IMPI = %q, want unchanged", got)
+	}
+}
+
+func TestIsISIMApplication(t *testing.T) {
+	tests := []struct {
+		name  string
+		aid   []byte
+		label string
+		want  bool
+	}{
+		{"3GPP ISIM", AID_ISIM, "", true},
+		{"3GPP USIM labelled ISIM", AID_USIM, "ISIM", false},
+		{"Proprietary AID with ISIM label", []byte{0xD2, 0x76, 0x00, 0x01}, "MCX ISIM", true},
+		{"Proprietary AID", []byte{0xD2, 0x76, 0x00, 0x01}, "Wallet", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isISIMApplication(tc.aid, tc.label); got != tc.want {
+				t.Errorf("isISIMApplication() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package sim
+
+import (
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ ISIM READ TESTS ============
+
+// Some ISIMs answer READ BINARY of EF_IMPI with 61xx and only hand the data out on
+// GET RESPONSE; the read used to stop there and report an empty IMPI.
+func TestReadISIM_ReadBinaryGetResponse(t *testing.T) {
+	defer resetISIMDetection()
+	impi := EncodeIMPI("user@ims.example.org", 48)
+
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(AID_ISIM).AddEF(0x6F02, impi)
+	var selected []byte
+	var pending []byte
+	m.Override = func(apdu []byte) []byte {
+		switch apdu[1] {
+		case card.INS_SELECT:
+			selected = apdu[len(apdu)-2:]
+		case card.INS_READ_BINARY:
+			if selected[0] == 0x6F && selected[1] == 0x02 {
+				pending = impi[int(apdu[2])<<8|int(apdu[3]):]
+				return []byte{0x61, byte(len(pending))}
+			}
+		case card.INS_GET_RESPONSE:
+			if pending != nil {
+				resp := append(append([]byte(nil), pending...), 0x90, 0x00)
+				pending = nil
+				return resp
+			}
+		}
+		return nil
+	}
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	isim, err := ReadISIM(reader)
+	if err != nil {
+		t.Fatalf("ReadISIM() error = %v", err)
+	}
+	if isim.IMPI != "user@ims.example.org" {
+		t.Errorf("IMPI = %q, want user@ims.example.org", isim.IMPI)
+	}
+}
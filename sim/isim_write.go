@@ -13,7 +13,7 @@ func WriteIMPI(reader *card.Reader, impi string) error {
 		return fmt.Errorf("failed to select ISIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("ISIM selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("ISIM selection failed: %s", resp.SWString())
 	}
 
 	// Select EF_IMPI
@@ -22,7 +22,7 @@ func WriteIMPI(reader *card.Reader, impi string) error {
 		return fmt.Errorf("failed to select EF_IMPI: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("EF_IMPI selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("EF_IMPI selection failed: %s", resp.SWString())
 	}
 
 	// Get file size
@@ -40,15 +40,55 @@ func WriteIMPI(reader *card.Reader, impi string) error {
 		return fmt.Errorf("failed to write IMPI: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("IMPI write failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("IMPI write failed: %s", resp.SWString())
 	}
 
 	return nil
 }
 
-// WriteIMPU writes IMS Public User Identity (first record)
-func WriteIMPU(reader *card.Reader, impu string) error {
-	return WriteIMPURecord(reader, impu, 1)
+// WriteIMPU writes IMS Public User Identities into successive EF_IMPU records (first = record 1)
+// and blanks the remaining records. Record length and count are taken from the SELECT response;
+// nothing is written if an IMPU does not fit or there are more IMPUs than records.
+func WriteIMPU(reader *card.Reader, impus []string) error {
+	// Select ISIM application
+	resp, err := SelectISIMWithAuth(reader)
+	if err != nil {
+		return fmt.Errorf("failed to select ISIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("ISIM selection failed: %s", resp.SWString())
+	}
+
+	// Select EF_IMPU
+	resp, err = reader.Select([]byte{0x6F, 0x04})
+	if err != nil {
+		return fmt.Errorf("failed to select EF_IMPU: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("EF_IMPU selection failed: %s", resp.SWString())
+	}
+
+	records, err := EncodeIMPURecords(impus, parseFCPRecordSize(resp.Data), parseFCPNumRecords(resp.Data))
+	if err != nil {
+		return err
+	}
+
+	for i, data := range records {
+		resp, err = reader.UpdateRecord(byte(i+1), data)
+		if err != nil {
+			return fmt.Errorf("failed to write IMPU record %d: %w", i+1, err)
+		}
+		if !resp.IsOK() {
+			return fmt.Errorf("IMPU record %d write failed: %s", i+1, resp.SWString())
+		}
+	}
+
+	return nil
+}
+
+// ClearIMPU blanks all EF_IMPU records
+func ClearIMPU(reader *card.Reader) error {
+	return WriteIMPU(reader, nil)
 }
 
 // WriteIMPURecord writes IMS Public User Identity to a specific record
@@ -59,7 +99,7 @@ func WriteIMPURecord(reader *card.Reader, impu string, recordNum byte) error {
 		return fmt.Errorf("failed to select ISIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("ISIM selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("ISIM selection failed: %s", resp.SWString())
 	}
 
 	// Select EF_IMPU
@@ -68,7 +108,7 @@ func WriteIMPURecord(reader *card.Reader, impu string, recordNum byte) error {
 		return fmt.Errorf("failed to select EF_IMPU: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("EF_IMPU selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("EF_IMPU selection failed: %s", resp.SWString())
 	}
 
 	// Get record size from FCP
@@ -86,7 +126,7 @@ func WriteIMPURecord(reader *card.Reader, impu string, recordNum byte) error {
 		return fmt.Errorf("failed to write IMPU: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("IMPU write failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("IMPU write failed: %s", resp.SWString())
 	}
 
 	return nil
@@ -100,7 +140,7 @@ func WriteDomain(reader *card.Reader, domain string) error {
 		return fmt.Errorf("failed to select ISIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("ISIM selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("ISIM selection failed: %s", resp.SWString())
 	}
 
 	// Select EF_DOMAIN
@@ -109,7 +149,7 @@ func WriteDomain(reader *card.Reader, domain string) error {
 		return fmt.Errorf("failed to select EF_DOMAIN: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("EF_DOMAIN selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("EF_DOMAIN selection failed: %s", resp.SWString())
 	}
 
 	// Get file size
@@ -127,7 +167,7 @@ func WriteDomain(reader *card.Reader, domain string) error {
 		return fmt.Errorf("failed to write domain: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("domain write failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("domain write failed: %s", resp.SWString())
 	}
 
 	return nil
@@ -146,7 +186,7 @@ func WritePCSCFRecord(reader *card.Reader, pcscf string, recordNum byte) error {
 		return fmt.Errorf("failed to select ISIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("ISIM selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("ISIM selection failed: %s", resp.SWString())
 	}
 
 	// Select EF_PCSCF
@@ -155,7 +195,7 @@ func WritePCSCFRecord(reader *card.Reader, pcscf string, recordNum byte) error {
 		return fmt.Errorf("failed to select EF_PCSCF: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("EF_PCSCF selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("EF_PCSCF selection failed: %s", resp.SWString())
 	}
 
 	// Get record size from FCP
@@ -173,7 +213,7 @@ func WritePCSCFRecord(reader *card.Reader, pcscf string, recordNum byte) error {
 		return fmt.Errorf("failed to write P-CSCF: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("P-CSCF write failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("P-CSCF write failed: %s", resp.SWString())
 	}
 
 	return nil
@@ -187,7 +227,7 @@ func SetISIMServices(reader *card.Reader, services map[int]bool) error {
 		return fmt.Errorf("failed to select ISIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("ISIM selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("ISIM selection failed: %s", resp.SWString())
 	}
 
 	// Select EF_IST
@@ -196,7 +236,7 @@ func SetISIMServices(reader *card.Reader, services map[int]bool) error {
 		return fmt.Errorf("failed to select EF_IST: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("EF_IST selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("EF_IST selection failed: %s", resp.SWString())
 	}
 
 	// Get file size
@@ -220,7 +260,7 @@ func SetISIMServices(reader *card.Reader, services map[int]bool) error {
 		return fmt.Errorf("failed to write IST: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("IST write failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("IST write failed: %s", resp.SWString())
 	}
 
 	return nil
@@ -277,7 +317,7 @@ func WriteAllISIM(reader *card.Reader, impi, impu, domain, pcscf string) error {
 	}
 
 	if impu != "" {
-		if err := WriteIMPU(reader, impu); err != nil {
+		if err := WriteIMPU(reader, []string{impu}); err != nil {
 			return fmt.Errorf("write IMPU failed: %w", err)
 		}
 	}
@@ -0,0 +1,79 @@
+package sim
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ IMPU WRITE TESTS ============
+
+// newIMPUTestReader returns a simulated ISIM whose EF_IMPU has count records of size bytes,
+// record 1 pre-populated
+func newIMPUTestReader(count, size int) (*card.Reader, *card.MockFile) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	isim := m.AddADF(AID_ISIM)
+	records := make([][]byte, count)
+	for i := range records {
+		records[i] = bytes.Repeat([]byte{0xFF}, size)
+	}
+	records[0] = EncodeIMPU("sip:old@ims", size)
+	ef := isim.AddRecordEF(0x6F04, records...)
+	return card.NewReaderWithTransport("Mock", m.ATR, m), ef
+}
+
+func TestWriteIMPU(t *testing.T) {
+	impus := []string{
+		"tel:+79001234567",
+		"sip:250880000000017@ims.mnc088.mcc250.3gppnetwork.org",
+		"sip:+79001234567@ims.mnc088.mcc250.3gppnetwork.org",
+	}
+	tests := []struct {
+		name        string
+		count, size int
+		impus       []string
+		want        []string
+	}{
+		{"3x64 three entries", 3, 64, impus, impus},
+		{"10x96 three entries", 10, 96, impus, impus},
+		{"Fewer entries clears surplus", 3, 64, impus[:1], impus[:1]},
+		{"Clear", 3, 64, nil, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reader, ef := newIMPUTestReader(tc.count, tc.size)
+			if err := WriteIMPU(reader, tc.impus); err != nil {
+				t.Fatalf("WriteIMPU() error = %v", err)
+			}
+			if len(ef.Records) != tc.count {
+				t.Fatalf("record count changed to %d", len(ef.Records))
+			}
+			for i := len(tc.impus); i < tc.count; i++ {
+				if !bytes.Equal(ef.Records[i], bytes.Repeat([]byte{0xFF}, tc.size)) {
+					t.Errorf("record %d = %X, want blank", i+1, ef.Records[i])
+				}
+			}
+			got, _, _ := readAllIMPU(reader)
+			if len(got) == 0 {
+				got = nil
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("readAllIMPU() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWriteIMPU_TooMany(t *testing.T) {
+	reader, ef := newIMPUTestReader(3, 64)
+	err := WriteIMPU(reader, []string{"tel:1", "tel:2", "tel:3", "tel:4"})
+	if err == nil {
+		t.Fatalf("WriteIMPU() should fail for more IMPUs than records")
+	}
+	if DecodeIMPU(ef.Records[0]) != "sip:old@ims" {
+		t.Errorf("record 1 modified on failure: %X", ef.Records[0])
+	}
+}
@@ -0,0 +1,142 @@
+package sim
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"sim_reader/algorithms"
+)
+
+// KDerivationConfig derives Ki per card from a master key and the ICCID instead of a
+// fixed ki in the config. OPc is computed from op with the derived Ki.
+type KDerivationConfig struct {
+	Scheme       string `json:"scheme" doc:"Derivation scheme: hmac-sha256 (Ki = HMAC-SHA256(master key, ICCID digits))"`
+	MasterKeyEnv string `json:"master_key_env" doc:"Environment variable holding the master key in hex (never put the key itself in the config)"`
+	KeyLength    int    `json:"key_length,omitempty" doc:"Ki length in bytes: 16 (default) or 32; must match the card algorithm"`
+}
+
+// DerivedKeys are the keys computed for one card by k_derivation
+type DerivedKeys struct {
+	ICCID string
+	Ki    string
+	OPc   string // empty without op
+}
+
+// keyLength returns the configured Ki length (default 128 bits)
+func (k *KDerivationConfig) keyLength() int {
+	if k.KeyLength == 0 {
+		return algorithms.KeyLen128
+	}
+	return k.KeyLength
+}
+
+// masterKey reads the master key from the environment variable named in the config
+func (k *KDerivationConfig) masterKey() ([]byte, error) {
+	if k.MasterKeyEnv == "" {
+		return nil, fmt.Errorf("k_derivation: master_key_env is not set")
+	}
+	value := strings.TrimSpace(os.Getenv(k.MasterKeyEnv))
+	if value == "" {
+		return nil, fmt.Errorf("k_derivation: environment variable %s is not set", k.MasterKeyEnv)
+	}
+	master, err := hex.DecodeString(strings.ReplaceAll(value, " ", ""))
+	if err != nil {
+		return nil, fmt.Errorf("k_derivation: %s is not a hex key", k.MasterKeyEnv)
+	}
+	return master, nil
+}
+
+// ValidateKDerivation checks the k_derivation settings and the master key without touching the card
+func (c *SIMConfig) ValidateKDerivation() error {
+	k := c.KDerivation
+	if k == nil {
+		return nil
+	}
+	if c.Ki != "" {
+		return fmt.Errorf("k_derivation and ki cannot be combined")
+	}
+	if c.OPc != "" {
+		return fmt.Errorf("k_derivation computes OPc from op with the derived Ki; a fixed opc cannot be used")
+	}
+	// A dummy ICCID checks the scheme, the key length and the master key in one go
+	master, err := k.masterKey()
+	if err != nil {
+		return err
+	}
+	if _, err := algorithms.DeriveK(k.Scheme, master, "8900000000000000000", k.keyLength()); err != nil {
+		return fmt.Errorf("k_derivation: %w", err)
+	}
+	return nil
+}
+
+// algorithmKeyLengths are the Ki lengths (bytes) each authentication algorithm accepts
+var algorithmKeyLengths = map[string][]int{
+	"milenage": {algorithms.KeyLen128},
+	"xor":      {algorithms.KeyLen128},
+	"sha1-aka": {algorithms.KeyLen128},
+	"s3g-128":  {algorithms.KeyLen128},
+	"s3g-256":  {algorithms.KeyLen256},
+	"tuak":     {algorithms.KeyLen128, algorithms.KeyLen256},
+}
+
+// DeriveKeys computes Ki for the card with iccid and OPc from op, and replaces the key
+// fields of the config with them. cardAlgorithm is the algorithm configured on the card
+// ("" = unknown); the algorithm of the config takes precedence, milenage is assumed
+// without either. Fails if the Ki length does not suit that algorithm.
+func (c *SIMConfig) DeriveKeys(iccid, cardAlgorithm string) (*DerivedKeys, error) {
+	if err := c.ValidateKDerivation(); err != nil {
+		return nil, err
+	}
+	k := c.KDerivation
+
+	algorithm := strings.ToLower(c.Algorithm)
+	if algorithm == "" {
+		algorithm = strings.ToLower(cardAlgorithm)
+	}
+	if algorithm == "" {
+		algorithm = string(AlgorithmMilenage)
+	}
+	if lengths, ok := algorithmKeyLengths[algorithm]; ok && !slices.Contains(lengths, k.keyLength()) {
+		return nil, fmt.Errorf("k_derivation: %d-byte Ki does not match the %s algorithm of the card", k.keyLength(), algorithm)
+	}
+
+	master, err := k.masterKey()
+	if err != nil {
+		return nil, err
+	}
+	ki, err := algorithms.DeriveK(k.Scheme, master, iccid, k.keyLength())
+	if err != nil {
+		return nil, fmt.Errorf("k_derivation: %w", err)
+	}
+	derived := &DerivedKeys{ICCID: iccid, Ki: strings.ToUpper(hex.EncodeToString(ki))}
+
+	if c.OP != "" {
+		if algorithm != string(AlgorithmMilenage) {
+			return nil, fmt.Errorf("k_derivation: OPc can only be computed for milenage, not %s", algorithm)
+		}
+		op, err := algorithms.ValidateOPc(c.OP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OP: %w", err)
+		}
+		opc, err := algorithms.ComputeOPc(ki, op)
+		if err != nil {
+			return nil, fmt.Errorf("k_derivation: %w", err)
+		}
+		derived.OPc = strings.ToUpper(hex.EncodeToString(opc))
+	}
+
+	c.Ki, c.OPc = derived.Ki, derived.OPc
+	if derived.OPc != "" {
+		c.OP = ""
+	}
+	c.derived = derived
+	return derived, nil
+}
+
+// Derived returns the keys computed by DeriveKeys, nil if the config has fixed keys
+func (c *SIMConfig) Derived() *DerivedKeys {
+	return c.derived
+}
@@ -0,0 +1,152 @@
+package sim
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ KEY DERIVATION TESTS ============
+
+const (
+	testMasterKeyEnv = "SIM_READER_TEST_MASTER_K"
+	testMasterKey    = "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F"
+)
+
+// testKeyDriver records the keys written by applyProgrammableFields
+type testKeyDriver struct {
+	ProgrammableDriver
+	algorithm string
+	ki, opc   []byte
+}
+
+func (d *testKeyDriver) WriteKi(reader *card.Reader, ki []byte) error {
+	d.ki = ki
+	return nil
+}
+
+func (d *testKeyDriver) WriteOPc(reader *card.Reader, opc []byte) error {
+	d.opc = opc
+	return nil
+}
+
+func (d *testKeyDriver) WriteMilenageRAndC(reader *card.Reader) error { return nil }
+
+func (d *testKeyDriver) GetAlgorithmType(reader *card.Reader) (string, error) {
+	return d.algorithm, nil
+}
+
+func newKDerivationConfig() *SIMConfig {
+	return &SIMConfig{
+		OP:          "CDC202D5123E20F62B6D676AC72CB318",
+		KDerivation: &KDerivationConfig{Scheme: "hmac-sha256", MasterKeyEnv: testMasterKeyEnv},
+	}
+}
+
+func TestDeriveKeys(t *testing.T) {
+	t.Setenv(testMasterKeyEnv, testMasterKey)
+	config := newKDerivationConfig()
+
+	derived, err := config.DeriveKeys("8988211000000000001", "")
+	if err != nil {
+		t.Fatalf("DeriveKeys() error = %v", err)
+	}
+	if derived.Ki != "172989D8501439B9DFB90165693DB4B0" || derived.OPc != "9B7D54F48C686095B2B274E096D8953D" {
+		t.Errorf("DeriveKeys() = %+v", derived)
+	}
+	if config.Ki != derived.Ki || config.OPc != derived.OPc || config.OP != "" || config.Derived() != derived {
+		t.Errorf("config keys = ki %s, op %s, opc %s, want the derived keys", config.Ki, config.OP, config.OPc)
+	}
+
+	// Without op only Ki is derived
+	config = newKDerivationConfig()
+	config.OP = ""
+	if derived, err := config.DeriveKeys("89882110000000000017", "milenage"); err != nil || derived.OPc != "" ||
+		derived.Ki != "C0E4C1EF3D4176DC8F7150AB5A010B4B" {
+		t.Errorf("DeriveKeys() without op = %+v, %v", derived, err)
+	}
+}
+
+func TestDeriveKeys_Refused(t *testing.T) {
+	t.Setenv(testMasterKeyEnv, testMasterKey)
+
+	tests := []struct {
+		name      string
+		modify    func(c *SIMConfig)
+		algorithm string
+		want      string
+	}{
+		{"fixed ki", func(c *SIMConfig) { c.Ki = "465B5CE8B199B49FAA5F0A2EE238A6BC" }, "", "cannot be combined"},
+		{"fixed opc", func(c *SIMConfig) { c.OPc = "CD63CB71954A9F4E48A5994E37A02BAF" }, "", "fixed opc"},
+		{"env missing", func(c *SIMConfig) { c.KDerivation.MasterKeyEnv = "SIM_READER_TEST_UNSET" }, "", "SIM_READER_TEST_UNSET is not set"},
+		{"no env name", func(c *SIMConfig) { c.KDerivation.MasterKeyEnv = "" }, "", "master_key_env"},
+		{"unknown scheme", func(c *SIMConfig) { c.KDerivation.Scheme = "sha1" }, "", "unknown key derivation scheme"},
+		{"128-bit Ki on s3g-256", func(c *SIMConfig) {}, "s3g-256", "does not match the s3g-256"},
+		{"256-bit Ki on milenage", func(c *SIMConfig) { c.KDerivation.KeyLength = 32 }, "", "does not match the milenage"},
+		{"config algorithm wins", func(c *SIMConfig) { c.Algorithm = "s3g-256" }, "milenage", "does not match the s3g-256"},
+		{"OPc for tuak", func(c *SIMConfig) {}, "tuak", "only be computed for milenage"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newKDerivationConfig()
+			tc.modify(config)
+			_, err := config.DeriveKeys("8988211000000000001", tc.algorithm)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("DeriveKeys() error = %v, want %q", err, tc.want)
+			}
+			if config.Derived() != nil {
+				t.Errorf("Derived() set after a refusal")
+			}
+		})
+	}
+
+	t.Setenv(testMasterKeyEnv, "not hex")
+	if err := newKDerivationConfig().ValidateKDerivation(); err == nil {
+		t.Error("ValidateKDerivation() accepted a master key that is not hex")
+	}
+}
+
+func TestApplyConfig_KDerivation(t *testing.T) {
+	t.Setenv(testMasterKeyEnv, testMasterKey)
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	iccid, _ := EncodeICCID("8988211000000000001")
+	m.MF().AddEF(0x2FE2, iccid)
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	// The ICCID is read from the card, the algorithm from the driver
+	drv := &testKeyDriver{algorithm: "milenage"}
+	config := newKDerivationConfig()
+	if err := deriveConfigKeys(reader, config, drv); err != nil {
+		t.Fatalf("deriveConfigKeys() error = %v", err)
+	}
+	report := &ApplyReport{}
+	applyProgrammableFields(reader, config, drv, false, false, report)
+	if report.Failed != 0 {
+		t.Fatalf("report = %+v", report.Items)
+	}
+	if got := fmt.Sprintf("%X", drv.ki); got != "172989D8501439B9DFB90165693DB4B0" {
+		t.Errorf("written Ki = %s", got)
+	}
+	if got := fmt.Sprintf("%X", drv.opc); got != "9B7D54F48C686095B2B274E096D8953D" {
+		t.Errorf("written OPc = %s", got)
+	}
+
+	// Dry run: the report names the derived keys without their values
+	config = newKDerivationConfig()
+	deriveConfigKeys(reader, config, drv)
+	report = &ApplyReport{}
+	applyProgrammableFields(reader, config, drv, true, false, report)
+	for _, item := range report.Items {
+		if strings.Contains(item.Detail, config.Ki) || strings.Contains(item.Detail, config.OPc) {
+			t.Errorf("report item %s shows a derived key: %q", item.Name, item.Detail)
+		}
+	}
+
+	// A card algorithm that needs another key length stops before anything is written
+	drv = &testKeyDriver{algorithm: "S3G-256"}
+	if err := deriveConfigKeys(reader, newKDerivationConfig(), drv); err == nil {
+		t.Error("deriveConfigKeys() accepted a 128-bit Ki for s3g-256")
+	}
+}
@@ -0,0 +1,230 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+
+	"sim_reader/card"
+)
+
+// Cached security contexts (TS 31.102 4.2.4, 4.2.5, 4.4.3.1, 4.4.3.2). EF_Keys/EF_KeysPS hold
+// KSI + CK + IK of the last CS/PS authentication, EF_Kc/EF_KcGPRS (DF_GSM-ACCESS) hold the
+// 2G Kc + CKSN. KSI/CKSN 07 means "no key available" and makes the UE authenticate afresh.
+
+// keyNotAvailable is the KSI/CKSN value meaning no valid key
+const keyNotAvailable = 0x07
+
+// securityContextFile describes one security context EF in ADF_USIM
+type securityContextFile struct {
+	name string
+	df   uint16 // DF below ADF_USIM (0 = the ADF itself)
+	fid  uint16
+	size int
+	kc   bool // Kc (8) + CKSN (1) layout instead of KSI (1) + CK (16) + IK (16)
+}
+
+var securityContextFiles = []securityContextFile{
+	{"EF_KEYS", 0, 0x6F08, 33, false},
+	{"EF_KEYSPS", 0, 0x6F09, 33, false},
+	{"EF_KC", 0x5F3B, 0x4F20, 9, true},
+	{"EF_KCGPRS", 0x5F3B, 0x4F52, 9, true},
+}
+
+// securityContextServices lists the security context EFs that a UST service requires: the
+// DF_GSM-ACCESS files only exist on cards offering GSM access (TS 31.102 4.4.3)
+var securityContextServices = map[int][]string{
+	UST_GSM_ACCESS: {"EF_KC", "EF_KCGPRS"},
+}
+
+// SecurityContext is the decoded content of one security context EF
+type SecurityContext struct {
+	Name   string
+	Status EFStatus
+	KSI    byte   // KSI (EF_Keys/EF_KeysPS) or CKSN (EF_Kc/EF_KcGPRS)
+	CK     []byte // EF_Keys/EF_KeysPS
+	IK     []byte // EF_Keys/EF_KeysPS
+	Kc     []byte // EF_Kc/EF_KcGPRS
+	Raw    []byte
+}
+
+// Sequence returns the key set identifier or cipher key sequence number (3 bits, 7 = no key)
+func (c SecurityContext) Sequence() byte {
+	return c.KSI & 0x07
+}
+
+// Valid reports whether the file holds a usable key (KSI/CKSN other than 07)
+func (c SecurityContext) Valid() bool {
+	return c.Status.State == EFPresent && c.Sequence() != keyNotAvailable
+}
+
+// DecodeKeys decodes EF_Keys/EF_KeysPS: KSI, CK, IK
+func DecodeKeys(data []byte) (ksi byte, ck, ik []byte, err error) {
+	if len(data) < 33 {
+		return 0, nil, nil, fmt.Errorf("EF_Keys too short: %d bytes, need 33", len(data))
+	}
+	return data[0], data[1:17], data[17:33], nil
+}
+
+// DecodeKc decodes EF_Kc/EF_KcGPRS: Kc, CKSN
+func DecodeKc(data []byte) (kc []byte, cksn byte, err error) {
+	if len(data) < 9 {
+		return nil, 0, fmt.Errorf("EF_Kc too short: %d bytes, need 9", len(data))
+	}
+	return data[:8], data[8], nil
+}
+
+// invalidKeyPattern returns the "no key available" content of a security context file:
+// KSI 07 + FF (EF_Keys/EF_KeysPS) or FF + CKSN 07 (EF_Kc/EF_KcGPRS)
+func invalidKeyPattern(f securityContextFile) []byte {
+	data := bytes.Repeat([]byte{0xFF}, f.size)
+	if f.kc {
+		data[f.size-1] = keyNotAvailable
+	} else {
+		data[0] = keyNotAvailable
+	}
+	return data
+}
+
+// selectSecurityContextDF selects ADF_USIM and the DF of f
+func selectSecurityContextDF(reader *card.Reader, f securityContextFile) EFStatus {
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return EFStatus{State: EFError, Err: fmt.Errorf("failed to select USIM: %w", err)}
+	}
+	if !resp.IsOK() {
+		return EFStatus{State: EFError, SW: resp.SW(), Err: fmt.Errorf("USIM selection failed: %s", resp.SWString())}
+	}
+	if f.df == 0 {
+		return EFStatus{State: EFPresent}
+	}
+	_, st := selectEFStatus(reader, f.df)
+	return st
+}
+
+// readSecurityContextUST reads EF_UST of ADF_USIM (nil if it cannot be read)
+func readSecurityContextUST(reader *card.Reader) map[int]bool {
+	if st := selectSecurityContextDF(reader, securityContextFiles[0]); st.State != EFPresent {
+		return nil
+	}
+	raw, st := readEFStatus(reader, 0x6F38)
+	if st.State != EFPresent {
+		return nil
+	}
+	return DecodeUST(raw)
+}
+
+// ReadSecurityContexts reads and decodes EF_Keys, EF_KeysPS, EF_Kc and EF_KcGPRS. The
+// DF_GSM-ACCESS files are only read when EF_UST lists GSM access (service 27), or when
+// EF_UST cannot be read.
+func ReadSecurityContexts(reader *card.Reader) []SecurityContext {
+	ust := readSecurityContextUST(reader)
+	contexts := make([]SecurityContext, 0, len(securityContextFiles))
+	for _, f := range securityContextFiles {
+		ctx := SecurityContext{Name: f.name}
+		if num, skip := skipService(ust, securityContextServices, f.name); skip {
+			ctx.Status = EFStatus{State: EFSkipped, Service: num}
+			contexts = append(contexts, ctx)
+			continue
+		}
+		ctx.Status = selectSecurityContextDF(reader, f)
+		if ctx.Status.State == EFPresent {
+			ctx.Raw, ctx.Status = readEFStatus(reader, f.fid)
+		}
+		if ctx.Status.State == EFPresent {
+			var err error
+			if f.kc {
+				ctx.Kc, ctx.KSI, err = DecodeKc(ctx.Raw)
+			} else {
+				ctx.KSI, ctx.CK, ctx.IK, err = DecodeKeys(ctx.Raw)
+			}
+			if err != nil {
+				ctx.Status = EFStatus{State: EFError, Err: err}
+			}
+		}
+		contexts = append(contexts, ctx)
+	}
+	return contexts
+}
+
+// readGSMAccess checks that DF_GSM-ACCESS (5F3B) exists when EF_UST lists GSM access
+// (service 27); its Kc files are only read with --show-keys. The USIM is selected again
+// afterwards.
+func (u *USIMData) readGSMAccess(reader *card.Reader) {
+	if u.skipUnlessService("DF_GSM-ACCESS") {
+		return
+	}
+	_, st := selectEFStatus(reader, 0x5F3B)
+	u.Files["DF_GSM-ACCESS"] = st
+	if st.State == EFPresent {
+		selectUSIMADF(reader)
+	}
+	if st.State == EFAbsent && u.UST[UST_GSM_ACCESS] {
+		u.Warnings = append(u.Warnings, fmt.Sprintf("DF_GSM-ACCESS (5F3B) is absent but GSM access (UST service %d) is enabled", UST_GSM_ACCESS))
+	}
+}
+
+// Key invalidation outcomes
+const (
+	KeysInvalidated = "invalidated"
+	KeysDryRun      = "dry run"
+	KeysSkipped     = "skipped"
+	KeysFailed      = "failed"
+)
+
+// KeyInvalidation is the result of invalidating one security context file
+type KeyInvalidation struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// InvalidateSecurityContexts writes the "no key available" pattern to EF_Keys, EF_KeysPS,
+// EF_Kc and EF_KcGPRS so that the UE runs a fresh authentication on the next attach (needed
+// after changing K/OPc). Absent and write-protected files, and files whose size differs from
+// the specification, are skipped; nothing but the defined pattern is ever written.
+func InvalidateSecurityContexts(reader *card.Reader) []KeyInvalidation {
+	results := make([]KeyInvalidation, 0, len(securityContextFiles))
+	for _, f := range securityContextFiles {
+		results = append(results, invalidateSecurityContext(reader, f))
+	}
+	return results
+}
+
+func invalidateSecurityContext(reader *card.Reader, f securityContextFile) KeyInvalidation {
+	res := KeyInvalidation{Name: f.name}
+	st := selectSecurityContextDF(reader, f)
+	var resp *card.APDUResponse
+	if st.State == EFPresent {
+		resp, st = selectEFStatus(reader, f.fid)
+	}
+	switch st.State {
+	case EFAbsent:
+		res.Status, res.Detail = KeysSkipped, "not on this card"
+		return res
+	case EFError:
+		res.Status, res.Detail = KeysFailed, st.Err.Error()
+		return res
+	}
+
+	size := parseFCPFileSize(resp.Data)
+	if size != f.size {
+		res.Status, res.Detail = KeysSkipped, fmt.Sprintf("file size %d, expected %d", size, f.size)
+		return res
+	}
+
+	pattern := invalidKeyPattern(f)
+	resp, err := reader.UpdateBinary(0, pattern)
+	switch {
+	case err != nil:
+		res.Status, res.Detail = KeysFailed, err.Error()
+	case resp.SW() == card.SW_SECURITY_NOT_SATISFIED || resp.SW() == 0x6985 || resp.SW() == 0x9804:
+		res.Status, res.Detail = KeysSkipped, fmt.Sprintf("write-protected: %s", resp.SWString())
+	case !resp.IsOK():
+		res.Status, res.Detail = KeysFailed, resp.SWString()
+	case reader.DryRun():
+		res.Status, res.Detail = KeysDryRun, fmt.Sprintf("would write %X", pattern)
+	default:
+		res.Status, res.Detail = KeysInvalidated, fmt.Sprintf("%X", pattern)
+	}
+	return res
+}
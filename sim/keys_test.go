@@ -0,0 +1,160 @@
+package sim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ SECURITY CONTEXT TESTS ============
+
+func TestDecodeKeys(t *testing.T) {
+	data := append([]byte{0x02}, bytes.Repeat([]byte{0x11}, 16)...)
+	data = append(data, bytes.Repeat([]byte{0x22}, 16)...)
+	ksi, ck, ik, err := DecodeKeys(data)
+	if err != nil || ksi != 0x02 || ck[0] != 0x11 || ik[15] != 0x22 {
+		t.Errorf("DecodeKeys() = %02X %X %X %v", ksi, ck, ik, err)
+	}
+	if _, _, _, err := DecodeKeys(data[:32]); err == nil {
+		t.Error("DecodeKeys() accepted 32 bytes")
+	}
+
+	kc, cksn, err := DecodeKc([]byte{1, 2, 3, 4, 5, 6, 7, 8, 0x07})
+	if err != nil || cksn != 0x07 || kc[7] != 8 {
+		t.Errorf("DecodeKc() = %X %02X %v", kc, cksn, err)
+	}
+}
+
+func TestInvalidKeyPattern(t *testing.T) {
+	keys := invalidKeyPattern(securityContextFiles[0])
+	if len(keys) != 33 || keys[0] != 0x07 || !bytes.Equal(keys[1:], bytes.Repeat([]byte{0xFF}, 32)) {
+		t.Errorf("EF_Keys pattern = %X", keys)
+	}
+	kc := invalidKeyPattern(securityContextFiles[2])
+	if !bytes.Equal(kc, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x07}) {
+		t.Errorf("EF_Kc pattern = %X", kc)
+	}
+}
+
+// newKeysTestCard returns a card with valid EF_Keys, a write-protected EF_KeysPS, an
+// EF_Kc of the wrong size and no EF_KcGPRS
+func newKeysTestCard() (*card.Reader, *card.MockCard, *card.MockFile, *card.MockFile) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	adf := m.AddADF(AID_USIM)
+	keys := adf.AddEF(0x6F08, append([]byte{0x01}, bytes.Repeat([]byte{0xAB}, 32)...))
+	adf.AddEF(0x6F09, append([]byte{0x03}, bytes.Repeat([]byte{0xCD}, 32)...))
+	kc := adf.AddDF(0x5F3B).AddEF(0x4F20, []byte{1, 2, 3, 4, 5, 6, 7, 8, 0x02, 0x00})
+
+	var selected []byte
+	m.Override = func(apdu []byte) []byte {
+		switch apdu[1] {
+		case 0xA4:
+			selected = append([]byte(nil), apdu[5:7]...)
+		case 0xD6:
+			if bytes.Equal(selected, []byte{0x6F, 0x09}) {
+				return []byte{0x69, 0x82}
+			}
+		}
+		return nil
+	}
+	return card.NewReaderWithTransport("Mock", m.ATR, m), m, keys, kc
+}
+
+func TestReadSecurityContexts(t *testing.T) {
+	reader, _, _, _ := newKeysTestCard()
+	contexts := ReadSecurityContexts(reader)
+	if len(contexts) != 4 {
+		t.Fatalf("ReadSecurityContexts() = %d contexts", len(contexts))
+	}
+	if c := contexts[0]; !c.Valid() || c.KSI != 0x01 || c.CK[0] != 0xAB || len(c.IK) != 16 {
+		t.Errorf("EF_KEYS = %+v", c)
+	}
+	if c := contexts[2]; !c.Valid() || c.KSI != 0x02 || c.Kc[0] != 1 {
+		t.Errorf("EF_KC = %+v", c)
+	}
+	if c := contexts[3]; c.Status.State != EFAbsent || c.Valid() {
+		t.Errorf("EF_KCGPRS = %+v, want absent", c)
+	}
+}
+
+func TestReadSecurityContexts_GSMAccessService(t *testing.T) {
+	reader, m, _, _ := newKeysTestCard()
+	ust := mockChild(m.MF(), 0x7FFF).AddEF(0x6F38, []byte{0x00, 0x00, 0x00, 0x00})
+	contexts := ReadSecurityContexts(reader)
+	for _, c := range contexts[2:] {
+		if c.Status.State != EFSkipped || c.Status.Service != UST_GSM_ACCESS {
+			t.Errorf("%s without UST service 27 = %+v, want skipped", c.Name, c.Status)
+		}
+	}
+	if !contexts[0].Valid() {
+		t.Errorf("EF_KEYS = %+v, want read regardless of service 27", contexts[0])
+	}
+
+	ust.Data[3] = 0x04 // service 27
+	contexts = ReadSecurityContexts(reader)
+	if c := contexts[2]; !c.Valid() || c.Sequence() != 2 {
+		t.Errorf("EF_KC with UST service 27 = %+v", c)
+	}
+}
+
+func TestReadUSIM_GSMAccess(t *testing.T) {
+	m := newMinimalUSIMCard()
+	adf := mockChild(m.MF(), 0x7FFF)
+	mockChild(adf, 0x6F38).Data = []byte{0x00, 0x00, 0x1C, 0x04} // services 19-21, 27
+	data, err := ReadUSIM(card.NewReaderWithTransport("Mock", m.ATR, m))
+	if err != nil {
+		t.Fatalf("ReadUSIM() error = %v", err)
+	}
+	if st := data.Files["DF_GSM-ACCESS"]; st.State != EFAbsent {
+		t.Errorf("DF_GSM-ACCESS = %+v, want absent", st)
+	}
+	if len(data.Warnings) != 1 || !strings.Contains(data.Warnings[0], "UST service 27") {
+		t.Errorf("Warnings = %q, want DF_GSM-ACCESS absent", data.Warnings)
+	}
+	if missing := data.MissingServiceFiles(); len(missing[27]) != 1 {
+		t.Errorf("MissingServiceFiles() = %v, want service 27", missing)
+	}
+
+	adf.AddDF(0x5F3B).AddEF(0x4F20, bytes.Repeat([]byte{0xFF}, 9))
+	data, _ = ReadUSIM(card.NewReaderWithTransport("Mock", m.ATR, m))
+	if st := data.Files["DF_GSM-ACCESS"]; st.State != EFPresent || len(data.Warnings) != 0 {
+		t.Errorf("DF_GSM-ACCESS = %+v, warnings %q", st, data.Warnings)
+	}
+}
+
+func TestInvalidateSecurityContexts(t *testing.T) {
+	reader, _, keys, kc := newKeysTestCard()
+	kcBefore := append([]byte(nil), kc.Data...)
+
+	results := InvalidateSecurityContexts(reader)
+	want := []string{KeysInvalidated, KeysSkipped, KeysSkipped, KeysSkipped}
+	for i, w := range want {
+		if results[i].Status != w {
+			t.Errorf("%s = %s (%s), want %s", results[i].Name, results[i].Status, results[i].Detail, w)
+		}
+	}
+	if keys.Data[0] != 0x07 || !bytes.Equal(keys.Data[1:], bytes.Repeat([]byte{0xFF}, 32)) {
+		t.Errorf("EF_Keys = %X, want 07FF..FF", keys.Data)
+	}
+	if !bytes.Equal(kc.Data, kcBefore) {
+		t.Errorf("EF_Kc of unexpected size was written: %X", kc.Data)
+	}
+
+	contexts := ReadSecurityContexts(reader)
+	if contexts[0].Valid() {
+		t.Error("EF_KEYS still valid after invalidation")
+	}
+}
+
+func TestInvalidateSecurityContexts_DryRun(t *testing.T) {
+	reader, _, keys, _ := newKeysTestCard()
+	before := append([]byte(nil), keys.Data...)
+	reader.SetDryRun(true)
+
+	results := InvalidateSecurityContexts(reader)
+	if results[0].Status != KeysDryRun || !bytes.Equal(keys.Data, before) {
+		t.Errorf("dry run: %+v, EF_Keys = %X", results[0], keys.Data)
+	}
+}
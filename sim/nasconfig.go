@@ -0,0 +1,318 @@
+package sim
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/tlv"
+)
+
+// EF_NASCONFIG (TS 31.102 4.2.94, UST service 100) holds the NAS configuration
+// parameters of TS 24.368 as a sequence of BER-TLV objects padded with FF. It is
+// mostly found on NB-IoT / M2M cards (low priority signalling, extended access barring).
+var FID_EF_NASCONFIG = []byte{0x6F, 0xE8}
+
+// NASConfig is the decoded content of EF_NASCONFIG. nil fields are parameters not
+// present in the file; when writing, nil fields are left as they are on the card.
+type NASConfig struct {
+	SignallingLowPriority             *bool `json:"nas_signalling_low_priority,omitempty"`
+	NMOIBehaviour                     *bool `json:"nmo_i_behaviour,omitempty"`
+	AttachWithIMSI                    *bool `json:"attach_with_imsi,omitempty"`
+	MinPeriodicSearchTimer            *int  `json:"min_periodic_search_timer,omitempty"` // minutes
+	ExtendedAccessBarring             *bool `json:"extended_access_barring,omitempty"`
+	TimerT3245Behaviour               *bool `json:"timer_t3245_behaviour,omitempty"`
+	OverrideSignallingLowPriority     *bool `json:"override_nas_signalling_low_priority,omitempty"`
+	OverrideExtendedAccessBarring     *bool `json:"override_extended_access_barring,omitempty"`
+	FastFirstHigherPriorityPLMNSearch *bool `json:"fast_first_higher_priority_plmn_search,omitempty"`
+	EUTRADisablingEMMCause15          *bool `json:"eutra_disabling_allowed_for_emm_cause15,omitempty"`
+	SMRetryWaitTime                   *int  `json:"sm_retry_wait_time,omitempty"`
+	SMRetryAtRATChange                *bool `json:"sm_retry_at_rat_change,omitempty"`
+	DefaultDCNID                      *int  `json:"default_dcn_id,omitempty"`
+	ExceptionDataReportingAllowed     *bool `json:"exception_data_reporting_allowed,omitempty"`
+
+	// Objects with tags TS 24.368 does not define (vendor extensions). Read only:
+	// they are kept untouched when the file is rewritten.
+	Unknown []NASConfigTLV `json:"unknown,omitempty"`
+}
+
+// NASConfigTLV is an EF_NASCONFIG object with an unknown tag
+type NASConfigTLV struct {
+	Tag   string `json:"tag"`   // hex
+	Value string `json:"value"` // hex
+}
+
+// nasParam describes one TS 24.368 parameter: either a flag (00 / 01) or a
+// big-endian number of size bytes
+type nasParam struct {
+	tag  uint32
+	name string
+	flag func(*NASConfig) **bool
+	num  func(*NASConfig) **int
+	size int
+	unit string
+}
+
+// nasConfigParams lists the parameters in tag order (TS 24.368 5.x, TS 31.102 4.2.94)
+var nasConfigParams = []nasParam{
+	{tag: 0x80, name: "NAS signalling low priority", flag: func(c *NASConfig) **bool { return &c.SignallingLowPriority }},
+	{tag: 0x81, name: "NMO I behaviour", flag: func(c *NASConfig) **bool { return &c.NMOIBehaviour }},
+	{tag: 0x82, name: "Attach with IMSI", flag: func(c *NASConfig) **bool { return &c.AttachWithIMSI }},
+	{tag: 0x83, name: "Min periodic search timer", num: func(c *NASConfig) **int { return &c.MinPeriodicSearchTimer }, size: 1, unit: " min"},
+	{tag: 0x84, name: "Extended access barring", flag: func(c *NASConfig) **bool { return &c.ExtendedAccessBarring }},
+	{tag: 0x85, name: "Timer T3245 behaviour", flag: func(c *NASConfig) **bool { return &c.TimerT3245Behaviour }},
+	{tag: 0x86, name: "Override low priority", flag: func(c *NASConfig) **bool { return &c.OverrideSignallingLowPriority }},
+	{tag: 0x87, name: "Override EAB", flag: func(c *NASConfig) **bool { return &c.OverrideExtendedAccessBarring }},
+	{tag: 0x88, name: "Fast first higher priority PLMN search", flag: func(c *NASConfig) **bool { return &c.FastFirstHigherPriorityPLMNSearch }},
+	{tag: 0x89, name: "E-UTRA disabling for EMM cause #15", flag: func(c *NASConfig) **bool { return &c.EUTRADisablingEMMCause15 }},
+	{tag: 0x8A, name: "SM retry wait time", num: func(c *NASConfig) **int { return &c.SMRetryWaitTime }, size: 1},
+	{tag: 0x8B, name: "SM retry at RAT change", flag: func(c *NASConfig) **bool { return &c.SMRetryAtRATChange }},
+	{tag: 0x8C, name: "Default DCN ID", num: func(c *NASConfig) **int { return &c.DefaultDCNID }, size: 2},
+	{tag: 0x8D, name: "Exception data reporting allowed", flag: func(c *NASConfig) **bool { return &c.ExceptionDataReportingAllowed }},
+}
+
+func findNASParam(tag uint32) *nasParam {
+	for i := range nasConfigParams {
+		if nasConfigParams[i].tag == tag {
+			return &nasConfigParams[i]
+		}
+	}
+	return nil
+}
+
+// isSet reports whether the parameter has a value in c
+func (p *nasParam) isSet(c *NASConfig) bool {
+	if p.flag != nil {
+		return *p.flag(c) != nil
+	}
+	return *p.num(c) != nil
+}
+
+// decode stores value in c
+func (p *nasParam) decode(c *NASConfig, value []byte) {
+	if len(value) == 0 {
+		return
+	}
+	if p.flag != nil {
+		v := value[0]&0x01 != 0
+		*p.flag(c) = &v
+		return
+	}
+	v := 0
+	for _, b := range value {
+		v = v<<8 | int(b)
+	}
+	*p.num(c) = &v
+}
+
+// encode returns the value of the parameter in c
+func (p *nasParam) encode(c *NASConfig) ([]byte, error) {
+	if p.flag != nil {
+		if **p.flag(c) {
+			return []byte{0x01}, nil
+		}
+		return []byte{0x00}, nil
+	}
+	v := **p.num(c)
+	if v < 0 || v >= 1<<(8*p.size) {
+		return nil, fmt.Errorf("%s: value %d out of range (0-%d)", p.name, v, 1<<(8*p.size)-1)
+	}
+	out := make([]byte, p.size)
+	for i := p.size - 1; i >= 0; i-- {
+		out[i] = byte(v)
+		v >>= 8
+	}
+	return out, nil
+}
+
+// format returns the parameter value for display
+func (p *nasParam) format(c *NASConfig) string {
+	if p.flag != nil {
+		if **p.flag(c) {
+			return "yes"
+		}
+		return "no"
+	}
+	return fmt.Sprintf("%d%s", **p.num(c), p.unit)
+}
+
+// DecodeNASConfig decodes EF_NASCONFIG; nil if the file holds no parameter.
+// A malformed object ends decoding; the parameters before it are returned.
+func DecodeNASConfig(data []byte) *NASConfig {
+	nodes, _ := tlv.Parse(data)
+	if len(nodes) == 0 {
+		return nil
+	}
+	c := &NASConfig{}
+	for _, n := range nodes {
+		if p := findNASParam(n.Tag); p != nil {
+			p.decode(c, n.Value)
+			continue
+		}
+		c.Unknown = append(c.Unknown, NASConfigTLV{Tag: n.TagHex, Value: fmt.Sprintf("%X", n.Value)})
+	}
+	return c
+}
+
+// IsEmpty reports whether no parameter is set
+func (c *NASConfig) IsEmpty() bool {
+	if c == nil {
+		return true
+	}
+	for i := range nasConfigParams {
+		if nasConfigParams[i].isSet(c) {
+			return false
+		}
+	}
+	return len(c.Unknown) == 0
+}
+
+// NASConfigField is one parameter of EF_NASCONFIG formatted for display
+type NASConfigField struct {
+	Name  string
+	Value string
+}
+
+// Fields returns the parameters that are set, in tag order, unknown objects last
+func (c *NASConfig) Fields() []NASConfigField {
+	if c == nil {
+		return nil
+	}
+	var fields []NASConfigField
+	for i := range nasConfigParams {
+		p := &nasConfigParams[i]
+		if p.isSet(c) {
+			fields = append(fields, NASConfigField{Name: p.name, Value: p.format(c)})
+		}
+	}
+	for _, u := range c.Unknown {
+		fields = append(fields, NASConfigField{Name: "Tag " + u.Tag, Value: u.Value + " (proprietary)"})
+	}
+	return fields
+}
+
+// String formats the parameters that are set, e.g. "NAS signalling low priority: yes, ..."
+func (c *NASConfig) String() string {
+	if c.IsEmpty() {
+		return "(empty)"
+	}
+	var parts []string
+	for _, f := range c.Fields() {
+		parts = append(parts, f.Name+": "+f.Value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// MergeNASConfig returns the new content of EF_NASCONFIG: current with every parameter
+// set in update replaced or added. Objects with other tags, including vendor
+// extensions, keep their value and position. The result is padded with FF to the
+// length of current.
+func MergeNASConfig(current []byte, update NASConfig) ([]byte, error) {
+	nodes, err := tlv.Parse(current)
+	if err != nil {
+		return nil, fmt.Errorf("EF_NASCONFIG content is not valid BER-TLV, refusing to rewrite: %w", err)
+	}
+
+	var out []byte
+	done := map[uint32]bool{}
+	for _, n := range nodes {
+		if p := findNASParam(n.Tag); p != nil && p.isSet(&update) && !done[n.Tag] {
+			value, err := p.encode(&update)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, tlv.Encode(n.Tag, value)...)
+			done[n.Tag] = true
+			continue
+		}
+		out = append(out, tlv.Encode(n.Tag, n.Value)...)
+	}
+
+	// Parameters not yet in the file are appended in tag order
+	for i := range nasConfigParams {
+		p := &nasConfigParams[i]
+		if !p.isSet(&update) || done[p.tag] {
+			continue
+		}
+		value, err := p.encode(&update)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tlv.Encode(p.tag, value)...)
+	}
+
+	if len(out) > len(current) {
+		return nil, fmt.Errorf("NAS config needs %d bytes, EF_NASCONFIG has %d", len(out), len(current))
+	}
+	for len(out) < len(current) {
+		out = append(out, 0xFF)
+	}
+	return out, nil
+}
+
+// LoadNASConfig reads NAS configuration parameters from a JSON (or YAML) file
+// with the keys of NASConfig, e.g. {"nas_signalling_low_priority": true}
+func LoadNASConfig(filename string) (NASConfig, error) {
+	var c NASConfig
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return c, fmt.Errorf("failed to read NAS config file: %w", err)
+	}
+	if IsYAMLFile(filename) {
+		if data, err = yamlConfigToJSON(data); err != nil {
+			return c, fmt.Errorf("failed to parse NAS config file: %w", err)
+		}
+	}
+	if err := decodeConfigStrict(data, &c); err != nil {
+		return c, fmt.Errorf("failed to parse NAS config file: %w", err)
+	}
+	if len(c.Unknown) > 0 {
+		return c, fmt.Errorf("NAS config file: \"unknown\" objects cannot be written")
+	}
+	if c.IsEmpty() {
+		return c, fmt.Errorf("NAS config file %s sets no parameter", filename)
+	}
+	return c, nil
+}
+
+// WriteNASConfig updates the parameters set in params in EF_NASCONFIG. The file is
+// read first and rewritten with MergeNASConfig, so parameters not in params and
+// proprietary objects are preserved.
+func WriteNASConfig(reader *card.Reader, params NASConfig) error {
+	if params.IsEmpty() {
+		return fmt.Errorf("no NAS config parameter to write")
+	}
+	if len(params.Unknown) > 0 {
+		return fmt.Errorf("unknown NAS config objects cannot be written")
+	}
+	if drv := FindDriver(reader); drv != nil {
+		if err := drv.PrepareWrite(reader); err != nil {
+			return fmt.Errorf("prepare write failed: %w", err)
+		}
+	}
+
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+	current, st := readEFStatus(reader, 0x6FE8)
+	if st.State != EFPresent {
+		if st.Err != nil {
+			return fmt.Errorf("EF_NASCONFIG: %w", st.Err)
+		}
+		return fmt.Errorf("EF_NASCONFIG not found (UST service %d)", UST_NAS_CONFIG)
+	}
+
+	data, err := MergeNASConfig(current, params)
+	if err != nil {
+		return err
+	}
+	if err := reader.WriteAllBinary(data); err != nil {
+		return fmt.Errorf("failed to write EF_NASCONFIG: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package sim
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ EF_NASCONFIG TESTS ============
+
+func boolRef(b bool) *bool { return &b }
+func intRef(i int) *int    { return &i }
+
+// nasConfigSample: low priority on, min periodic search 60 min, a proprietary
+// object DF01, default DCN ID 0102, then FF padding
+var nasConfigSample = []byte{
+	0x80, 0x01, 0x01,
+	0x83, 0x01, 0x3C,
+	0xDF, 0x01, 0x02, 0xAB, 0xCD,
+	0x8C, 0x02, 0x01, 0x02,
+	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+}
+
+func TestDecodeNASConfig(t *testing.T) {
+	c := DecodeNASConfig(nasConfigSample)
+	if c == nil {
+		t.Fatal("DecodeNASConfig() = nil")
+	}
+	if c.SignallingLowPriority == nil || !*c.SignallingLowPriority {
+		t.Errorf("SignallingLowPriority = %v, want true", c.SignallingLowPriority)
+	}
+	if c.MinPeriodicSearchTimer == nil || *c.MinPeriodicSearchTimer != 60 {
+		t.Errorf("MinPeriodicSearchTimer = %v, want 60", c.MinPeriodicSearchTimer)
+	}
+	if c.DefaultDCNID == nil || *c.DefaultDCNID != 0x0102 {
+		t.Errorf("DefaultDCNID = %v, want 258", c.DefaultDCNID)
+	}
+	if c.AttachWithIMSI != nil {
+		t.Errorf("AttachWithIMSI = %v, want absent", *c.AttachWithIMSI)
+	}
+	if len(c.Unknown) != 1 || c.Unknown[0].Tag != "DF01" || c.Unknown[0].Value != "ABCD" {
+		t.Errorf("Unknown = %+v, want DF01=ABCD", c.Unknown)
+	}
+
+	want := "NAS signalling low priority: yes, Min periodic search timer: 60 min, Default DCN ID: 258, Tag DF01: ABCD (proprietary)"
+	if got := c.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	if DecodeNASConfig(bytes.Repeat([]byte{0xFF}, 16)) != nil {
+		t.Error("DecodeNASConfig(empty file) should be nil")
+	}
+}
+
+func TestMergeNASConfig_PreservesUnknown(t *testing.T) {
+	update := NASConfig{
+		SignallingLowPriority: boolRef(false),
+		AttachWithIMSI:        boolRef(true),
+	}
+	got, err := MergeNASConfig(nasConfigSample, update)
+	if err != nil {
+		t.Fatalf("MergeNASConfig() error = %v", err)
+	}
+	want := []byte{
+		0x80, 0x01, 0x00, // replaced in place
+		0x83, 0x01, 0x3C,
+		0xDF, 0x01, 0x02, 0xAB, 0xCD, // proprietary object untouched
+		0x8C, 0x02, 0x01, 0x02,
+		0x82, 0x01, 0x01, // appended
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("MergeNASConfig() = %X, want %X", got, want)
+	}
+}
+
+func TestMergeNASConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		current []byte
+		update  NASConfig
+		want    string
+	}{
+		{"does not fit", []byte{0x80, 0x01, 0x00, 0xFF}, NASConfig{AttachWithIMSI: boolRef(true)}, "needs 6 bytes"},
+		{"out of range", bytes.Repeat([]byte{0xFF}, 8), NASConfig{MinPeriodicSearchTimer: intRef(300)}, "out of range"},
+		{"malformed", []byte{0x80, 0x05, 0x00, 0xFF}, NASConfig{AttachWithIMSI: boolRef(true)}, "not valid BER-TLV"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := MergeNASConfig(tt.current, tt.update)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("MergeNASConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadNASConfig(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "nas.json")
+	os.WriteFile(good, []byte(`{"_comment": "IoT", "extended_access_barring": true, "min_periodic_search_timer": 30}`), 0644)
+	c, err := LoadNASConfig(good)
+	if err != nil {
+		t.Fatalf("LoadNASConfig() error = %v", err)
+	}
+	if c.ExtendedAccessBarring == nil || !*c.ExtendedAccessBarring || c.MinPeriodicSearchTimer == nil || *c.MinPeriodicSearchTimer != 30 {
+		t.Errorf("LoadNASConfig() = %s", c.String())
+	}
+
+	typo := filepath.Join(dir, "typo.json")
+	os.WriteFile(typo, []byte(`{"attach_with_imis": true}`), 0644)
+	if _, err := LoadNASConfig(typo); err == nil {
+		t.Error("LoadNASConfig() should reject unknown keys")
+	}
+
+	empty := filepath.Join(dir, "empty.json")
+	os.WriteFile(empty, []byte(`{}`), 0644)
+	if _, err := LoadNASConfig(empty); err == nil {
+		t.Error("LoadNASConfig() should reject a file without parameters")
+	}
+}
+
+func TestWriteNASConfig(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, []byte{0x08, 0x29, 0x05, 0x88, 0x00, 0x00, 0x00, 0x00, 0x10})
+	ef := usim.AddEF(0x6FE8, append([]byte(nil), nasConfigSample...))
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	if err := WriteNASConfig(reader, NASConfig{ExceptionDataReportingAllowed: boolRef(true)}); err != nil {
+		t.Fatalf("WriteNASConfig() error = %v", err)
+	}
+	if !bytes.HasPrefix(ef.Data, nasConfigSample[:15]) || !bytes.Equal(ef.Data[15:18], []byte{0x8D, 0x01, 0x01}) {
+		t.Errorf("EF_NASCONFIG = %X", ef.Data)
+	}
+	if len(ef.Data) != len(nasConfigSample) {
+		t.Errorf("EF_NASCONFIG length = %d, want %d", len(ef.Data), len(nasConfigSample))
+	}
+
+	usimData, err := ReadUSIM(reader)
+	if err != nil {
+		t.Fatalf("ReadUSIM() error = %v", err)
+	}
+	if usimData.NASConfig == nil || usimData.NASConfig.ExceptionDataReportingAllowed == nil {
+		t.Errorf("ReadUSIM NASConfig = %v, want exception data reporting set", usimData.NASConfig)
+	}
+
+	if err := WriteNASConfig(reader, NASConfig{}); err == nil {
+		t.Error("WriteNASConfig() with no parameter should fail")
+	}
+}
@@ -0,0 +1,331 @@
+package sim
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// OTACounter describes the replay counter (CNTR) and keyset info for one TAR
+type OTACounter struct {
+	TAR        string // Toolkit Application Reference (3 bytes hex)
+	Name       string // Known name for the TAR (ISD, ISD-R, RFM USIM...)
+	Counter    string // CNTR value (hex), empty if not exposed
+	KIcVersion string // KIc keyset version and algorithm, empty if unknown
+	KIDVersion string // KID keyset version and algorithm, empty if unknown
+	Source     string // Mechanism that produced this entry
+}
+
+// OTAProbe records the outcome of one read mechanism
+type OTAProbe struct {
+	Mechanism string
+	OK        bool
+	Result    string
+}
+
+// OTAInfo is the result of ReadOTACounters
+type OTAInfo struct {
+	Counters []OTACounter
+	Probes   []OTAProbe
+}
+
+// otaSecurityDomain is a security domain queried with GET DATA
+type otaSecurityDomain struct {
+	Name string
+	TAR  string
+	AID  []byte
+}
+
+// ISD-R AID (GSMA SGP.02)
+var isdRAID = []byte{0xA0, 0x00, 0x00, 0x05, 0x59, 0x10, 0x10, 0xFF, 0xFF, 0xFF, 0xFF, 0x89, 0x00, 0x00, 0x01, 0x00}
+
+var otaSecurityDomains = []otaSecurityDomain{
+	{Name: "ISD", TAR: "000000", AID: GP_ISD_AID},
+	{Name: "ISD-R", TAR: "000001", AID: isdRAID},
+}
+
+// GET DATA tags (GP Card Spec 11.3.3.1)
+const (
+	gpTagKeyInfoTemplate = 0x00E0 // Key Information Template
+	gpTagSequenceCounter = 0x00C1 // Sequence Counter of the default Key Version Number
+)
+
+// OTA keyset key identifiers (ETSI TS 102 225 / TS 102 226)
+const (
+	otaKeyIDKIc = 0x01
+	otaKeyIDKID = 0x02
+)
+
+// ReadOTACounters collects OTA counter and keyset information using every known mechanism:
+// GET DATA on the TAR-associated security domains (ISD, ISD-R) and, if the detected
+// driver advertises CapReadOTACounter, the vendor-specific files. Each mechanism tried
+// is reported in Probes, so "not exposed" can be told apart from a failure.
+func ReadOTACounters(reader *card.Reader) (*OTAInfo, error) {
+	if reader == nil {
+		return nil, fmt.Errorf("nil reader")
+	}
+	info := &OTAInfo{}
+
+	for _, sd := range otaSecurityDomains {
+		counters, probes := readSDOTAInfo(reader, sd)
+		info.Counters = append(info.Counters, counters...)
+		info.Probes = append(info.Probes, probes...)
+	}
+
+	drv := FindDriver(reader)
+	mech := "Vendor EF (driver)"
+	switch {
+	case drv == nil:
+		info.Probes = append(info.Probes, OTAProbe{Mechanism: mech, Result: "no programmable driver detected"})
+	case !HasCapability(drv, CapReadOTACounter):
+		info.Probes = append(info.Probes, OTAProbe{Mechanism: mech, Result: fmt.Sprintf("not supported by %s driver", drv.Name())})
+	default:
+		mech = fmt.Sprintf("Vendor EF (%s)", drv.Name())
+		r, ok := drv.(OTACounterReader)
+		if !ok {
+			info.Probes = append(info.Probes, OTAProbe{Mechanism: mech, Result: "driver advertises capability but has no reader"})
+			break
+		}
+		counters, err := r.ReadOTACounters(reader)
+		if err != nil {
+			info.Probes = append(info.Probes, OTAProbe{Mechanism: mech, Result: err.Error()})
+			break
+		}
+		if len(counters) == 0 {
+			info.Probes = append(info.Probes, OTAProbe{Mechanism: mech, Result: "no counter records present"})
+			break
+		}
+		info.Counters = append(info.Counters, counters...)
+		info.Probes = append(info.Probes, OTAProbe{Mechanism: mech, OK: true, Result: fmt.Sprintf("%d TAR(s)", len(counters))})
+	}
+
+	return info, nil
+}
+
+// readSDOTAInfo selects a security domain and reads its key information and sequence counter
+func readSDOTAInfo(reader *card.Reader, sd otaSecurityDomain) ([]OTACounter, []OTAProbe) {
+	var probes []OTAProbe
+	source := fmt.Sprintf("GET DATA %s", sd.Name)
+
+	resp, err := reader.Select(sd.AID)
+	if err != nil {
+		return nil, []OTAProbe{{Mechanism: source, Result: fmt.Sprintf("select failed: %v", err)}}
+	}
+	if !resp.IsOK() && !resp.HasMoreData() {
+		return nil, []OTAProbe{{Mechanism: source, Result: fmt.Sprintf("%s not present (%s)", sd.Name, resp.SWString())}}
+	}
+
+	var counters []OTACounter
+
+	// Key Information Template -> KIc/KID keyset versions
+	mech := fmt.Sprintf("GET DATA %s key info (00E0)", sd.Name)
+	data, sw, err := gpGetData(reader, gpTagKeyInfoTemplate)
+	switch {
+	case err != nil:
+		probes = append(probes, OTAProbe{Mechanism: mech, Result: err.Error()})
+	case sw != 0x9000:
+		probes = append(probes, OTAProbe{Mechanism: mech, Result: fmt.Sprintf("not exposed (%s)", card.DecodeSW(sw, 0xCA, card.ContextGP))})
+	default:
+		keysets := otaKeysetsFromKeyInfo(ParseKeyInfoTemplate(data))
+		for _, ks := range keysets {
+			counters = append(counters, OTACounter{
+				TAR:        sd.TAR,
+				Name:       sd.Name,
+				KIcVersion: ks.kic,
+				KIDVersion: ks.kid,
+				Source:     source,
+			})
+		}
+		probes = append(probes, OTAProbe{Mechanism: mech, OK: true, Result: fmt.Sprintf("%d OTA keyset(s)", len(keysets))})
+	}
+
+	// Sequence counter of the default key version
+	mech = fmt.Sprintf("GET DATA %s counter (00C1)", sd.Name)
+	data, sw, err = gpGetData(reader, gpTagSequenceCounter)
+	switch {
+	case err != nil:
+		probes = append(probes, OTAProbe{Mechanism: mech, Result: err.Error()})
+	case sw != 0x9000:
+		probes = append(probes, OTAProbe{Mechanism: mech, Result: fmt.Sprintf("not exposed (%s)", card.DecodeSW(sw, 0xCA, card.ContextGP))})
+	default:
+		cntr := strings.ToUpper(hex.EncodeToString(parseSequenceCounter(data)))
+		if len(counters) == 0 {
+			counters = append(counters, OTACounter{TAR: sd.TAR, Name: sd.Name, Source: source})
+		}
+		for i := range counters {
+			counters[i].Counter = cntr
+		}
+		probes = append(probes, OTAProbe{Mechanism: mech, OK: true, Result: cntr})
+	}
+
+	return counters, probes
+}
+
+// gpGetData sends GET DATA (CLA=80) for a 2-byte tag and returns data and final SW
+func gpGetData(reader *card.Reader, tag uint16) ([]byte, uint16, error) {
+	apdu := []byte{0x80, 0xCA, byte(tag >> 8), byte(tag), 0x00}
+	resp, err := reader.SendAPDU(apdu)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Data, resp.SW(), nil
+}
+
+// parseSequenceCounter strips the optional C1 tag/length from a GET DATA 00C1 response
+func parseSequenceCounter(data []byte) []byte {
+	if len(data) >= 2 && data[0] == 0xC1 && int(data[1]) <= len(data)-2 {
+		return data[2 : 2+int(data[1])]
+	}
+	return data
+}
+
+// GPKeyInfo is one entry of the Key Information Template (tag C0)
+type GPKeyInfo struct {
+	ID      byte
+	Version byte
+	Type    byte
+	Length  int
+}
+
+// ParseKeyInfoTemplate parses GET DATA 00E0 response: E0 L { C0 L KeyID KVN (Type Len)+ }*
+func ParseKeyInfoTemplate(data []byte) []GPKeyInfo {
+	if len(data) >= 2 && data[0] == 0xE0 {
+		l := int(data[1])
+		if 2+l <= len(data) {
+			data = data[2 : 2+l]
+		}
+	}
+
+	var keys []GPKeyInfo
+	for off := 0; off+2 <= len(data); {
+		tag, l := data[off], int(data[off+1])
+		end := off + 2 + l
+		if end > len(data) {
+			break
+		}
+		if tag == 0xC0 && l >= 4 {
+			v := data[off+2 : end]
+			keys = append(keys, GPKeyInfo{ID: v[0], Version: v[1], Type: v[2], Length: int(v[3])})
+		}
+		off = end
+	}
+	return keys
+}
+
+// gpKeyTypeName returns a short name for a GP key type
+func gpKeyTypeName(t byte) string {
+	switch t {
+	case 0x80:
+		return "DES"
+	case 0x82:
+		return "3DES-CBC"
+	case 0x83:
+		return "DES-ECB"
+	case 0x84:
+		return "DES-CBC"
+	case 0x88:
+		return "AES"
+	default:
+		return fmt.Sprintf("type %02X", t)
+	}
+}
+
+type otaKeyset struct {
+	version byte
+	kic     string
+	kid     string
+}
+
+// otaKeysetsFromKeyInfo groups KIc/KID keys of OTA keyset versions (01..0F) by version
+func otaKeysetsFromKeyInfo(keys []GPKeyInfo) []otaKeyset {
+	var out []otaKeyset
+	index := map[byte]int{}
+	for _, k := range keys {
+		if k.Version < 0x01 || k.Version > 0x0F {
+			continue
+		}
+		if k.ID != otaKeyIDKIc && k.ID != otaKeyIDKID {
+			continue
+		}
+		i, ok := index[k.Version]
+		if !ok {
+			i = len(out)
+			index[k.Version] = i
+			out = append(out, otaKeyset{version: k.Version})
+		}
+		desc := fmt.Sprintf("v%d %s-%d", k.Version, gpKeyTypeName(k.Type), k.Length*8)
+		if k.ID == otaKeyIDKIc {
+			out[i].kic = desc
+		} else {
+			out[i].kid = desc
+		}
+	}
+	return out
+}
+
+// DecodeKIcKID decodes a KIc/KID byte (ETSI TS 102 225 5.1.2/5.1.3):
+// b8-b5 keyset version, b2-b1 algorithm (00 implicit, 01 DES, 10 AES, 11 proprietary).
+func DecodeKIcKID(b byte) string {
+	algo := "implicit"
+	switch b & 0x03 {
+	case 0x01:
+		algo = "DES"
+	case 0x02:
+		algo = "AES"
+	case 0x03:
+		algo = "proprietary"
+	}
+	return fmt.Sprintf("v%d %s", b>>4, algo)
+}
+
+// ParseOTACounterRecord parses a vendor counter record: TAR(3) | CNTR(5) | KIc(1) | KID(1).
+// Returns false for empty (FF-filled) or short records.
+func ParseOTACounterRecord(rec []byte) (OTACounter, bool) {
+	if len(rec) < 10 || isAllFF(rec[:3]) {
+		return OTACounter{}, false
+	}
+	tar := strings.ToUpper(hex.EncodeToString(rec[:3]))
+	return OTACounter{
+		TAR:        tar,
+		Name:       TARName(tar),
+		Counter:    strings.ToUpper(hex.EncodeToString(rec[3:8])),
+		KIcVersion: DecodeKIcKID(rec[8]),
+		KIDVersion: DecodeKIcKID(rec[9]),
+	}, true
+}
+
+func isAllFF(b []byte) bool {
+	for _, v := range b {
+		if v != 0xFF {
+			return false
+		}
+	}
+	return true
+}
+
+// TARName returns a known name for a TAR (ETSI TS 101 220 Annex D), or empty string
+func TARName(tar string) string {
+	b, err := hex.DecodeString(tar)
+	if err != nil || len(b) != 3 {
+		return ""
+	}
+	switch {
+	case tar == "000000":
+		return "ISD (RAM)"
+	case tar == "000001":
+		return "ISD-R"
+	case b[0] == 0xB0 && b[1] == 0x00 && b[2] <= 0x0F:
+		return "RFM UICC"
+	case b[0] == 0xB0 && b[1] == 0x00 && b[2] >= 0x10 && b[2] <= 0x1F:
+		return "RFM USIM"
+	case b[0] == 0xB0 && b[1] == 0x00 && b[2] >= 0x20 && b[2] <= 0x2F:
+		return "RFM GSM"
+	case b[0] == 0xB0 && b[1] == 0x01 && b[2] <= 0x0F:
+		return "RFM ISIM"
+	case b[0] == 0xB2 && b[1] == 0x00:
+		return "RAM"
+	}
+	return ""
+}
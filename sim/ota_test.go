@@ -0,0 +1,123 @@
+package sim
+
+import (
+	"reflect"
+	"testing"
+)
+
+// ============ OTA KEY INFO TESTS ============
+
+func TestParseKeyInfoTemplate(t *testing.T) {
+	// E0 with ISD SCP keys (KVN 30) and one OTA keyset (KVN 01: KIc/KID/KIK AES-128)
+	data := []byte{
+		0xE0, 0x24,
+		0xC0, 0x04, 0x01, 0x30, 0x88, 0x10,
+		0xC0, 0x04, 0x02, 0x30, 0x88, 0x10,
+		0xC0, 0x04, 0x03, 0x30, 0x88, 0x10,
+		0xC0, 0x04, 0x01, 0x01, 0x88, 0x10,
+		0xC0, 0x04, 0x02, 0x01, 0x88, 0x10,
+		0xC0, 0x04, 0x03, 0x01, 0x82, 0x10,
+	}
+
+	keys := ParseKeyInfoTemplate(data)
+	if len(keys) != 6 {
+		t.Fatalf("got %d keys, want 6", len(keys))
+	}
+	if keys[5] != (GPKeyInfo{ID: 0x03, Version: 0x01, Type: 0x82, Length: 16}) {
+		t.Errorf("keys[5] = %+v", keys[5])
+	}
+
+	sets := otaKeysetsFromKeyInfo(keys)
+	want := []otaKeyset{{version: 1, kic: "v1 AES-128", kid: "v1 AES-128"}}
+	if !reflect.DeepEqual(sets, want) {
+		t.Errorf("otaKeysetsFromKeyInfo() = %+v, want %+v", sets, want)
+	}
+}
+
+func TestParseKeyInfoTemplate_Truncated(t *testing.T) {
+	keys := ParseKeyInfoTemplate([]byte{0xC0, 0x04, 0x01, 0x01, 0x88, 0x10, 0xC0, 0x04, 0x02})
+	if len(keys) != 1 {
+		t.Errorf("got %d keys, want 1 (truncated entry dropped)", len(keys))
+	}
+}
+
+func TestParseSequenceCounter(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte
+	}{
+		{"Tagged", []byte{0xC1, 0x02, 0x00, 0x2A}, []byte{0x00, 0x2A}},
+		{"Raw", []byte{0x00, 0x00, 0x05}, []byte{0x00, 0x00, 0x05}},
+		{"Bad length", []byte{0xC1, 0x05, 0x00}, []byte{0xC1, 0x05, 0x00}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseSequenceCounter(tc.in); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseSequenceCounter() = %X, want %X", got, tc.want)
+			}
+		})
+	}
+}
+
+// ============ OTA COUNTER RECORD TESTS ============
+
+func TestDecodeKIcKID(t *testing.T) {
+	tests := []struct {
+		in   byte
+		want string
+	}{
+		{0x12, "v1 AES"},
+		{0x15, "v1 DES"},
+		{0x20, "v2 implicit"},
+		{0xF3, "v15 proprietary"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.want, func(t *testing.T) {
+			if got := DecodeKIcKID(tc.in); got != tc.want {
+				t.Errorf("DecodeKIcKID(%02X) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseOTACounterRecord(t *testing.T) {
+	rec := []byte{0xB0, 0x00, 0x10, 0x00, 0x00, 0x00, 0x01, 0x2C, 0x12, 0x12}
+	got, ok := ParseOTACounterRecord(rec)
+	if !ok {
+		t.Fatalf("ParseOTACounterRecord() ok = false")
+	}
+	want := OTACounter{TAR: "B00010", Name: "RFM USIM", Counter: "000000012C", KIcVersion: "v1 AES", KIDVersion: "v1 AES"}
+	if got != want {
+		t.Errorf("ParseOTACounterRecord() = %+v, want %+v", got, want)
+	}
+
+	if _, ok := ParseOTACounterRecord([]byte{0xFF, 0xFF, 0xFF, 0, 0, 0, 0, 0, 0, 0}); ok {
+		t.Errorf("empty record should be skipped")
+	}
+	if _, ok := ParseOTACounterRecord([]byte{0xB0, 0x00}); ok {
+		t.Errorf("short record should be skipped")
+	}
+}
+
+func TestTARName(t *testing.T) {
+	tests := map[string]string{
+		"000000": "ISD (RAM)",
+		"000001": "ISD-R",
+		"B00001": "RFM UICC",
+		"B00010": "RFM USIM",
+		"B00020": "RFM GSM",
+		"B00100": "RFM ISIM",
+		"123456": "",
+		"XYZ":    "",
+	}
+	for tar, want := range tests {
+		t.Run(tar, func(t *testing.T) {
+			if got := TARName(tar); got != want {
+				t.Errorf("TARName(%s) = %q, want %q", tar, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package sim
+
+import (
+	"sim_reader/card"
+	"sim_reader/textcodec"
+)
+
+// DF_PHONEBOOK (TS 31.102 4.4.2) holds the phonebook of the USIM (local, under ADF_USIM)
+// or of the card (global, under DF_TELECOM). Its files have no fixed FIDs: each EF_PBR
+// record describes one set of files, grouped by how their records relate to EF_ADN:
+//
+//	A8 type 1: record i belongs to ADN record i (ADN, IAP, EMAIL, ANR, SNE, ...)
+//	A9 type 2: the IAP record i points to the record of ADN record i, one byte per file
+//	AA type 3: referenced by record number from other files (EXT1, AAS, GAS, CCP1)
+//
+// Each file is a TLV with its FID and optionally its SFI.
+var (
+	FID_DF_PHONEBOOK = []byte{0x5F, 0x3A}
+	FID_EF_PBR       = []byte{0x4F, 0x30}
+	FID_EF_EXT1      = []byte{0x6F, 0x4A} // DF_TELECOM, legacy phonebook
+)
+
+// EF_PBR constructed tags
+const (
+	PBRType1 = 0xA8
+	PBRType2 = 0xA9
+	PBRType3 = 0xAA
+)
+
+// EF_PBR file tags
+const (
+	PBRTagADN   = 0xC0
+	PBRTagIAP   = 0xC1
+	PBRTagEXT1  = 0xC2
+	PBRTagSNE   = 0xC3
+	PBRTagANR   = 0xC4
+	PBRTagPBC   = 0xC5
+	PBRTagGRP   = 0xC6
+	PBRTagAAS   = 0xC7
+	PBRTagGAS   = 0xC8
+	PBRTagUID   = 0xC9
+	PBRTagEMAIL = 0xCA
+	PBRTagCCP1  = 0xCB
+)
+
+// PBRFile is one file of an EF_PBR record
+type PBRFile struct {
+	Type byte // PBRType1, PBRType2 or PBRType3
+	Tag  byte // PBRTagADN, PBRTagEMAIL, ...
+	FID  []byte
+	SFI  byte // 0 = none
+}
+
+// ParsePBRRecord returns the files of an EF_PBR record in record order (which for type 2
+// files is the order of their pointers in EF_IAP). Parsing stops at FF padding.
+func ParsePBRRecord(data []byte) []PBRFile {
+	var files []PBRFile
+	for off := 0; off+2 <= len(data); {
+		typ, n := data[off], int(data[off+1])
+		if typ != PBRType1 && typ != PBRType2 && typ != PBRType3 || off+2+n > len(data) {
+			break
+		}
+		inner := data[off+2 : off+2+n]
+		for i := 0; i+2 <= len(inner); {
+			tag, l := inner[i], int(inner[i+1])
+			if i+2+l > len(inner) {
+				break
+			}
+			if l >= 2 {
+				f := PBRFile{Type: typ, Tag: tag, FID: append([]byte(nil), inner[i+2:i+4]...)}
+				if l >= 3 {
+					f.SFI = inner[i+4]
+				}
+				files = append(files, f)
+			}
+			i += 2 + l
+		}
+		off += 2 + n
+	}
+	return files
+}
+
+// readPBRPhonebook reads the phonebook of the selected DF_PHONEBOOK. Entries of the next
+// EF_PBR record continue the numbering after the ADN records of the previous one.
+func readPBRPhonebook(reader *card.Reader) ([]PhonebookEntry, bool) {
+	pbr, ok := readLinearEF(reader, FID_EF_PBR)
+	if !ok {
+		return nil, false
+	}
+	var entries []PhonebookEntry
+	offset := 0
+	for _, rec := range pbr {
+		files := ParsePBRRecord(rec)
+		if len(files) == 0 {
+			continue
+		}
+		set, count := readPBRSet(reader, files, offset)
+		entries = append(entries, set...)
+		offset += count
+	}
+	return entries, true
+}
+
+// readPBRSet reads the ADN file of one EF_PBR record and attaches its EXT1 overflow and
+// its EMAIL and ANR records (type 1 by record number, type 2 through EF_IAP). Returns the
+// entries and the number of ADN records.
+func readPBRSet(reader *card.Reader, files []PBRFile, offset int) ([]PhonebookEntry, int) {
+	var adnFile *PBRFile
+	var iap, ext1 [][]byte
+	for i, f := range files {
+		switch {
+		case f.Type == PBRType1 && f.Tag == PBRTagADN && adnFile == nil:
+			adnFile = &files[i]
+		case f.Type == PBRType1 && f.Tag == PBRTagIAP:
+			iap, _ = readLinearEF(reader, f.FID)
+		case f.Type == PBRType3 && f.Tag == PBRTagEXT1:
+			ext1, _ = readLinearEF(reader, f.FID)
+		}
+	}
+	if adnFile == nil {
+		return nil, 0
+	}
+	adn, ok := readLinearEF(reader, adnFile.FID)
+	if !ok {
+		return nil, 0
+	}
+
+	byRecord := make(map[int]*PhonebookEntry)
+	var order []int
+	for i, rec := range adn {
+		entry := decodeADNRecord(rec, offset+i+1)
+		if entry == nil {
+			continue
+		}
+		entry.Number += decodeEXT1Chain(ext1, rec[len(rec)-1])
+		byRecord[i] = entry
+		order = append(order, i)
+	}
+
+	// Type 2 files are numbered by their position among the A9 files
+	iapPos := -1
+	for _, f := range files {
+		if f.Type == PBRType2 {
+			iapPos++
+		}
+		if f.Type == PBRType3 || f.Tag != PBRTagEMAIL && f.Tag != PBRTagANR {
+			continue
+		}
+		records, ok := readLinearEF(reader, f.FID)
+		if !ok {
+			continue
+		}
+		for _, i := range order {
+			var rec []byte
+			if f.Type == PBRType1 {
+				if i < len(records) {
+					rec = records[i]
+				}
+			} else if i < len(iap) && iapPos < len(iap[i]) {
+				if n := int(iap[i][iapPos]); n != 0 && n != 0xFF && n <= len(records) {
+					rec = records[n-1]
+					rec = rec[:max(len(rec)-2, 0)] // ADN SFI and record identifier
+				}
+			}
+			if rec == nil {
+				continue
+			}
+			entry := byRecord[i]
+			switch f.Tag {
+			case PBRTagEMAIL:
+				if email := textcodec.DecodeAlpha(rec); email != "" {
+					entry.Emails = append(entry.Emails, email)
+				}
+			case PBRTagANR:
+				if anr := decodeANRRecord(rec, ext1); anr != "" {
+					entry.AdditionalNumbers = append(entry.AdditionalNumbers, anr)
+				}
+			}
+		}
+	}
+
+	entries := make([]PhonebookEntry, 0, len(order))
+	for _, i := range order {
+		entries = append(entries, *byRecord[i])
+	}
+	return entries, len(adn)
+}
+
+// decodeANRRecord decodes an EF_ANR record (type 2 link bytes removed): AAS record (1) +
+// BCD-len (1) + TON/NPI (1) + Number (10) + CCP (1) + Ext1 (1)
+func decodeANRRecord(data []byte, ext1 [][]byte) string {
+	if len(data) < 15 || isEmptyRecord(data) || data[1] == 0xFF || data[1] == 0 {
+		return ""
+	}
+	return decodeBCDNumber(data[3:13], data[2]) + decodeEXT1Chain(ext1, data[14])
+}
+
+// decodeEXT1Chain returns the digits of the EXT1 additional data records starting at
+// record id (TS 31.102 4.4.2.4): type (1) + length (1) + BCD digits (10) + next record (1)
+func decodeEXT1Chain(ext1 [][]byte, id byte) string {
+	var digits string
+	for hops := 0; id != 0xFF && id != 0 && hops < len(ext1); hops++ {
+		if int(id) > len(ext1) {
+			break
+		}
+		rec := ext1[id-1]
+		if len(rec) < 13 {
+			break
+		}
+		if rec[0] == 0x02 { // additional data
+			n := min(int(rec[1]), 10)
+			digits += decodeBCDNumber(rec[2:2+n], 0)
+		}
+		id = rec[12]
+	}
+	return digits
+}
+
+// readLinearEF reads all records of a linear fixed EF of the current DF. Cards that do
+// not state the record count in the FCP are read until the first failing record.
+func readLinearEF(reader *card.Reader, fid []byte) ([][]byte, bool) {
+	resp, err := reader.Select(fid)
+	if err != nil || !resp.IsOK() {
+		return nil, false
+	}
+	recLen := parseFCPRecordSize(resp.Data)
+	if recLen == 0 {
+		return nil, false
+	}
+	count := parseFCPNumRecords(resp.Data)
+	if count == 0 {
+		count = 254
+	}
+	var records [][]byte
+	for _, r := range readRecordsAbsolute(reader, recLen, count) {
+		records = append(records, r.data)
+	}
+	return records, true
+}
@@ -28,6 +28,8 @@ type PcomExecutor struct {
 	stopOnError bool              // Stop execution on first error
 	lineNum     int               // Current line number
 	currentFile string            // Current file being executed
+	builtins    map[string]string // Built-in %NAME% variables (card data file, command line)
+	poweredOff  bool              // .POWER_OFF seen: the next .POWER_ON is a cold reset
 
 	// Statistics
 	totalCommands   int
@@ -58,6 +60,7 @@ func NewPcomExecutor(reader *card.Reader) *PcomExecutor {
 	return &PcomExecutor{
 		reader:      reader,
 		variables:   make(map[string]string),
+		builtins:    make(map[string]string),
 		maxDepth:    20,
 		stopOnError: false,
 		verbose:     true,
@@ -90,6 +93,19 @@ func (e *PcomExecutor) GetVariable(name string) string {
 	return e.variables[name]
 }
 
+// SetBuiltin sets a built-in variable, written %NAME% in scripts (%ICCID%, %IMSI%, %PIN1%,
+// %ADM1%, ...). Names are case-insensitive; a later call replaces the value.
+func (e *PcomExecutor) SetBuiltin(name, value string) {
+	e.builtins[strings.ToUpper(strings.Trim(name, "%"))] = value
+}
+
+// SetBuiltins sets every entry of values as a built-in variable
+func (e *PcomExecutor) SetBuiltins(values map[string]string) {
+	for name, value := range values {
+		e.SetBuiltin(name, value)
+	}
+}
+
 // ExecuteFile executes a .pcom script file
 func (e *PcomExecutor) ExecuteFile(filename string) error {
 	// Set base directory from first file
@@ -97,6 +113,10 @@ func (e *PcomExecutor) ExecuteFile(filename string) error {
 		e.baseDir = filepath.Dir(filename)
 	}
 
+	// The script itself is relative to the working directory, not to baseDir
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
 	return e.executeFileInternal(filename)
 }
 
@@ -193,6 +213,11 @@ func (e *PcomExecutor) executeLine(line string) error {
 		return e.executeDirective(line)
 	}
 
+	// CHV/KEY shorthand for VERIFY and CHANGE REFERENCE DATA
+	if word := strings.ToUpper(strings.Fields(line)[0]); word == "CHV" || word == "KEY" {
+		return e.executeKeyCommand(line)
+	}
+
 	// Otherwise it's an APDU command
 	return e.executeAPDULine(line)
 }
@@ -294,6 +319,7 @@ func (e *PcomExecutor) executeDefine(line string) error {
 	value = e.expandRFunction(value)
 
 	// Expand variables in value
+	value = e.expandBuiltins(value)
 	value = e.expandVariables(value)
 
 	// Remove spaces from hex value (but not from the variable name)
@@ -327,12 +353,14 @@ func (e *PcomExecutor) executeCall(parts []string) error {
 	return e.executeFileInternal(filename)
 }
 
-// executePowerOn handles .POWER_ON directive
+// executePowerOn handles .POWER_ON directive: a cold reset after .POWER_OFF or with /COLD,
+// a warm reset otherwise
 func (e *PcomExecutor) executePowerOn(parts []string) error {
-	cold := false
+	cold := e.poweredOff
 	if len(parts) > 1 && strings.ToUpper(parts[1]) == "/COLD" {
 		cold = true
 	}
+	e.poweredOff = false
 
 	if e.verbose {
 		if cold {
@@ -344,7 +372,7 @@ func (e *PcomExecutor) executePowerOn(parts []string) error {
 
 	// Reconnect to card
 	if e.reader != nil {
-		if err := e.reader.Reconnect(cold); err != nil {
+		if _, err := e.reader.Reconnect(cold); err != nil {
 			if e.verbose {
 				fmt.Printf("  [WARN] Reconnect failed: %v\n", err)
 			}
@@ -355,50 +383,111 @@ func (e *PcomExecutor) executePowerOn(parts []string) error {
 	return nil
 }
 
-// executePowerOff handles .POWER_OFF directive
+// executePowerOff handles .POWER_OFF directive. The card stays powered until the next
+// .POWER_ON, which then power-cycles it (cold reset).
 func (e *PcomExecutor) executePowerOff() error {
 	if e.verbose {
 		fmt.Println("  [POWER_OFF]")
 	}
+	e.poweredOff = true
 	return nil
 }
 
-// executeAPDULine executes an APDU command line
-func (e *PcomExecutor) executeAPDULine(line string) error {
-	// Parse APDU and expected response
-	// Format: CLA INS P1 P2 [Lc] [DATA] (EXPECTED_SW) [EXPECTED_DATA]
-
-	// Find expected SW in parentheses
-	expectedSW := ""
-	expectedData := ""
+// executeKeyCommand handles the CHV/KEY shorthand of OX24 scripts:
+//
+//	CHV n value [new] (SW)   VERIFY PIN n (1 = PIN1, 2 = PIN2), CHANGE with a new value
+//	KEY n value [new] (SW)   VERIFY ADMn (1-4), CHANGE with a new value
+//
+// PINs are sent as ASCII digits padded with FF, ADM keys as 8 digits (ASCII) or 16 hex
+// digits, like -a. Verbose output masks the values.
+func (e *PcomExecutor) executeKeyCommand(line string) error {
+	line, expectedSW, _ := splitExpected(line)
+	fields := strings.Fields(e.expandVariables(e.expandBuiltins(line)))
+	word := strings.ToUpper(fields[0])
+	if len(fields) < 3 || len(fields) > 4 {
+		return fmt.Errorf("%s needs the key number, the value and optionally a new value", word)
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return fmt.Errorf("%s: invalid key number %q", word, fields[1])
+	}
+
+	cla, ref := byte(0x00), byte(0)
+	encode := encodePcomPIN
+	switch {
+	case word == "CHV" && n == 1:
+		ref = card.PIN_CHV1
+	case word == "CHV" && n == 2:
+		ref = card.PIN_PIN2
+		if UseGSMCommands {
+			ref = card.PIN_CHV2
+		}
+	case word == "KEY" && n >= 1 && n <= 4:
+		ref, encode = card.ADMKeyRef(n), card.ParseADMKey
+	default:
+		return fmt.Errorf("%s %d: no such key", word, n)
+	}
+	if UseGSMCommands {
+		cla = 0xA0
+	}
 
-	// Find (SW) pattern
-	swMatch := regexp.MustCompile(`\(([0-9A-Fa-fXx]+)\)`).FindStringSubmatch(line)
-	if len(swMatch) > 1 {
-		expectedSW = swMatch[1]
-		// Remove (SW) from line
-		line = regexp.MustCompile(`\([0-9A-Fa-fXx]+\)`).ReplaceAllString(line, "")
+	var data []byte
+	masked := []string{word, fields[1]}
+	for _, v := range fields[2:] {
+		if name := undefinedVariable.FindString(v); name != "" {
+			return fmt.Errorf("undefined variable %s", name)
+		}
+		b, err := encode(v)
+		if err == nil && len(b) > 8 {
+			err = fmt.Errorf("value is %d bytes, at most 8", len(b))
+		}
+		if err != nil {
+			return fmt.Errorf("%s %d: %w", word, n, err)
+		}
+		data = append(data, padPcomKey(b)...)
+		masked = append(masked, strings.Repeat("*", len(v)))
 	}
+	ins := byte(card.INS_VERIFY)
+	if len(fields) == 4 {
+		ins = card.INS_CHANGE_REFERENCE_DATA
+	}
+	apdu := append([]byte{cla, ins, 0x00, ref, byte(len(data))}, data...)
+	return e.transmit(apdu, strings.Join(masked, " "), expectedSW, "")
+}
 
-	// Find [DATA] pattern for expected response data
-	dataMatch := regexp.MustCompile(`\[([^\]]+)\]`).FindStringSubmatch(line)
-	if len(dataMatch) > 1 {
-		expectedData = dataMatch[1]
-		// Remove [DATA] from line
-		line = regexp.MustCompile(`\[[^\]]+\]`).ReplaceAllString(line, "")
+// encodePcomPIN returns the digits of a PIN as ASCII
+func encodePcomPIN(pin string) ([]byte, error) {
+	if len(pin) < 4 || len(pin) > 8 || strings.Trim(pin, "0123456789") != "" {
+		return nil, fmt.Errorf("PIN %q: need 4 to 8 digits", pin)
 	}
+	return []byte(pin), nil
+}
 
-	// Clean up APDU hex string
-	line = strings.TrimSpace(line)
+// padPcomKey pads a PIN or key to the 8 bytes of the VERIFY data field with FF
+func padPcomKey(b []byte) []byte {
+	out := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	copy(out, b)
+	return out
+}
+
+// executeAPDULine executes an APDU command line
+func (e *PcomExecutor) executeAPDULine(line string) error {
+	// Parse APDU and expected response
+	// Format: CLA INS P1 P2 [Lc] [DATA] (EXPECTED_SW) [EXPECTED_DATA]
+
+	line, expectedSW, expectedData := splitExpected(line)
 	if line == "" {
 		return nil
 	}
 
 	// Expand variables
-	line = e.expandVariables(line)
+	line = e.expandVariables(e.expandBuiltins(line))
 
 	// Also expand in expected data for comparison
-	expectedData = e.expandVariables(expectedData)
+	expectedData = e.expandVariables(e.expandBuiltins(expectedData))
+	if name := undefinedVariable.FindString(line); name != "" {
+		return fmt.Errorf("undefined variable %s", name)
+	}
 
 	// Remove all spaces
 	apduHex := strings.ReplaceAll(line, " ", "")
@@ -417,6 +506,40 @@ func (e *PcomExecutor) executeAPDULine(line string) error {
 		return fmt.Errorf("APDU too short: %d bytes", len(apduBytes))
 	}
 
+	displayAPDU := apduHex
+	if len(displayAPDU) > 60 {
+		displayAPDU = displayAPDU[:60] + "..."
+	}
+	return e.transmit(apduBytes, displayAPDU, expectedSW, expectedData)
+}
+
+// splitExpected removes the expected status word (SW) and response data [DATA] from an
+// APDU line
+func splitExpected(line string) (apdu, expectedSW, expectedData string) {
+	// Find (SW) pattern
+	swMatch := regexp.MustCompile(`\(([0-9A-Fa-fXx]+)\)`).FindStringSubmatch(line)
+	if len(swMatch) > 1 {
+		expectedSW = swMatch[1]
+		// Remove (SW) from line
+		line = regexp.MustCompile(`\([0-9A-Fa-fXx]+\)`).ReplaceAllString(line, "")
+	}
+
+	// Find [DATA] pattern for expected response data
+	dataMatch := regexp.MustCompile(`\[([^\]]+)\]`).FindStringSubmatch(line)
+	if len(dataMatch) > 1 {
+		expectedData = dataMatch[1]
+		// Remove [DATA] from line
+		line = regexp.MustCompile(`\[[^\]]+\]`).ReplaceAllString(line, "")
+	}
+
+	return strings.TrimSpace(line), expectedSW, expectedData
+}
+
+// transmit sends an APDU and checks the response against the expected SW and data.
+// display is what verbose output shows for the command.
+func (e *PcomExecutor) transmit(apduBytes []byte, display, expectedSW, expectedData string) error {
+	apduHex := strings.ToUpper(hex.EncodeToString(apduBytes))
+
 	// Execute APDU
 	e.totalCommands++
 
@@ -425,11 +548,7 @@ func (e *PcomExecutor) executeAPDULine(line string) error {
 	}
 
 	if e.verbose {
-		displayAPDU := apduHex
-		if len(displayAPDU) > 60 {
-			displayAPDU = displayAPDU[:60] + "..."
-		}
-		fmt.Printf("  [%s:%d] %s", filepath.Base(e.currentFile), e.lineNum, displayAPDU)
+		fmt.Printf("  [%s:%d] %s", filepath.Base(e.currentFile), e.lineNum, display)
 	}
 
 	resp, err := e.reader.SendAPDU(apduBytes)
@@ -441,21 +560,6 @@ func (e *PcomExecutor) executeAPDULine(line string) error {
 		return fmt.Errorf("APDU transmit error: %w", err)
 	}
 
-	// Handle GET RESPONSE if needed (SW1=61 or SW1=9F for GSM)
-	if resp.SW1 == 0x61 || resp.SW1 == 0x9F {
-		// Determine which GET RESPONSE to use
-		var getResp *card.APDUResponse
-		if apduBytes[0] == 0xA0 || resp.SW1 == 0x9F {
-			// GSM class
-			getResp, _ = e.reader.GetResponseGSM(resp.SW2)
-		} else {
-			getResp, _ = e.reader.GetResponse(resp.SW2)
-		}
-		if getResp != nil {
-			resp = getResp
-		}
-	}
-
 	// Store last response
 	e.lastResp = resp.Data
 	e.lastSW = resp.SW()
@@ -497,6 +601,23 @@ func (e *PcomExecutor) executeAPDULine(line string) error {
 	return nil
 }
 
+// builtinVariable matches a built-in variable reference, e.g. %ICCID%
+var builtinVariable = regexp.MustCompile(`%([A-Za-z][A-Za-z0-9_]*)%`)
+
+// undefinedVariable matches a variable reference left after expansion
+var undefinedVariable = regexp.MustCompile(`%[A-Za-z][A-Za-z0-9_]*%?`)
+
+// expandBuiltins replaces %NAME% with the value of the built-in variable NAME; references
+// to unknown names are kept
+func (e *PcomExecutor) expandBuiltins(s string) string {
+	return builtinVariable.ReplaceAllStringFunc(s, func(ref string) string {
+		if value, ok := e.builtins[strings.ToUpper(strings.Trim(ref, "%"))]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
 // expandVariables replaces %VAR with their values
 func (e *PcomExecutor) expandVariables(s string) string {
 	// Find all %NAME patterns and replace
@@ -599,6 +720,7 @@ func (e *PcomExecutor) GetCallStack() []string {
 func (e *PcomExecutor) Reset() {
 	e.variables = make(map[string]string)
 	e.callStack = nil
+	e.poweredOff = false
 	e.lastResp = nil
 	e.lastSW = 0
 	e.totalCommands = 0
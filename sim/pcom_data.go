@@ -0,0 +1,66 @@
+package sim
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadPcomCardData reads the per-card data file of a .pcom run: CSV (comma or semicolon
+// separated) with a header row naming the built-in variables (ICCID, IMSI, PIN1, ADM1, KI,
+// ...) and one row per card. The row whose ICCID column matches iccid is returned, keyed by
+// the upper-case column name.
+func LoadPcomCardData(path, iccid string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(strings.NewReader(string(data)))
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+	if header, _, _ := strings.Cut(string(data), "\n"); strings.Count(header, ";") > strings.Count(header, ",") {
+		r.Comma = ';'
+	}
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s: empty data file", path)
+	}
+
+	header := rows[0]
+	col := -1
+	for i, name := range header {
+		header[i] = strings.ToUpper(strings.Trim(strings.TrimSpace(name), "%"))
+		if header[i] == "ICCID" {
+			col = i
+		}
+	}
+	if col < 0 {
+		return nil, fmt.Errorf("%s: no ICCID column", path)
+	}
+
+	want := normalizePcomICCID(iccid)
+	for _, row := range rows[1:] {
+		if col >= len(row) || normalizePcomICCID(row[col]) != want {
+			continue
+		}
+		values := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(row) && name != "" {
+				values[name] = strings.TrimSpace(row[i])
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%s: no row for ICCID %s", path, iccid)
+}
+
+// normalizePcomICCID drops spaces and the F padding so that data files with and without it
+// match the ICCID read from the card
+func normalizePcomICCID(iccid string) string {
+	return strings.TrimRight(strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(iccid), " ", "")), "F")
+}
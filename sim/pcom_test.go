@@ -0,0 +1,150 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ PCOM TESTS ============
+
+// newPcomTestCard returns a card with PIN1 1234, ADM1 12345678 and the USIM AID of the
+// sample script
+func newPcomTestCard() *card.MockCard {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.Keys[card.PIN_CHV1] = []byte("1234")
+	m.Keys[card.PIN_ADM1] = []byte("12345678")
+	m.MF().AddEF(0x2FE2, []byte{0x98, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10, 0x32, 0x54, 0xF6})
+	usim := m.AddADF([]byte{0xA0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02, 0xFF, 0x49, 0xFF, 0x05, 0x89})
+	usim.AddEF(0x6F07, make([]byte, 9))
+	usim.AddEF(0x6F46, bytes.Repeat([]byte{0xFF}, 5))
+	return m
+}
+
+func TestPcomExecutor_VendorSample(t *testing.T) {
+	m := newPcomTestCard()
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	data, err := LoadPcomCardData(filepath.Join("testdata", "pcom", "cards.csv"), "8901234567890123456")
+	if err != nil {
+		t.Fatalf("LoadPcomCardData() error = %v", err)
+	}
+	e := NewPcomExecutor(reader)
+	e.SetVerbose(false)
+	e.SetStopOnError(true)
+	e.SetBuiltins(data)
+
+	if err := e.ExecuteFile(filepath.Join("testdata", "pcom", "ox24_lte_profile.pcom")); err != nil {
+		t.Fatalf("ExecuteFile() error = %v", err)
+	}
+	if total, _, failed := e.GetStatistics(); failed != 0 || total != 11 {
+		t.Errorf("statistics = %d commands, %d failed, want 11 and 0", total, failed)
+	}
+
+	usim := m.MF().Children[1]
+	if got := hex.EncodeToString(usim.Children[0].Data); got != "080910100000000010" {
+		t.Errorf("EF_IMSI = %s, want the IMSI of the data file row", got)
+	}
+	if !bytes.Equal(usim.Children[1].Data, []byte{0x01, 'T', 'E', 'S', 'T'}) {
+		t.Errorf("EF_SPN = %X", usim.Children[1].Data)
+	}
+	if len(m.Resets) != 1 || !m.Resets[0] {
+		t.Errorf("resets = %v, want one cold reset for .POWER_OFF/.POWER_ON", m.Resets)
+	}
+}
+
+func TestPcomExecutor_KeyCommands(t *testing.T) {
+	m := newPcomTestCard()
+	m.Override = func(apdu []byte) []byte {
+		if apdu[1] == card.INS_CHANGE_REFERENCE_DATA {
+			return []byte{0x90, 0x00}
+		}
+		return nil
+	}
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	e := NewPcomExecutor(reader)
+	e.SetVerbose(false)
+	e.SetBuiltin("%adm1%", "3132333435363738")
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"CHV 1 1234 (9000)", "0020000108" + "31323334FFFFFFFF"},
+		{"CHV 2 5678", "0020008108" + "35363738FFFFFFFF"},
+		{"KEY 1 %ADM1% (9000)", "0020000A08" + "3132333435363738"},
+		{"key 2 87654321", "0020000B08" + "3837363534333231"},
+		{"CHV 1 1234 4321 (9000)", "0024000110" + "31323334FFFFFFFF" + "34333231FFFFFFFF"},
+	}
+	for _, tc := range tests {
+		m.Log = nil
+		if err := e.executeLine(tc.line); err != nil {
+			t.Errorf("%q: error = %v", tc.line, err)
+			continue
+		}
+		if len(m.Log) == 0 || !strings.EqualFold(hex.EncodeToString(m.Log[0]), tc.want) {
+			t.Errorf("%q sent %X, want %s", tc.line, m.Log, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"CHV 3 1234", "KEY 5 12345678", "CHV 1", "CHV 1 12", "KEY 1 %ADM9%"} {
+		if err := e.executeLine(bad); err == nil {
+			t.Errorf("%q should return error", bad)
+		}
+	}
+}
+
+func TestPcomExecutor_Builtins(t *testing.T) {
+	m := newPcomTestCard()
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	e := NewPcomExecutor(reader)
+	e.SetVerbose(false)
+	e.SetBuiltin("FID", "2FE2")
+
+	m.Log = nil
+	if err := e.executeLine("00A4 0004 02 %FID% (9000)"); err != nil {
+		t.Fatalf("executeLine() error = %v", err)
+	}
+	if got := hex.EncodeToString(m.Log[0]); got != "00a40004022fe2" {
+		t.Errorf("sent %s", got)
+	}
+	if err := e.executeLine("00D6 0000 09 %IMSI%"); err == nil {
+		t.Error("an undefined built-in variable should be refused, not sent")
+	}
+}
+
+func TestPcomExecutor_PowerOnWarm(t *testing.T) {
+	m := newPcomTestCard()
+	e := NewPcomExecutor(card.NewReaderWithTransport("Mock", m.ATR, m))
+	e.SetVerbose(false)
+
+	for _, line := range []string{".POWER_ON", ".POWER_ON /COLD", ".POWER_OFF", ".POWER_ON"} {
+		if err := e.executeLine(line); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+	}
+	if want := []bool{false, true, true}; len(m.Resets) != 3 || m.Resets[0] != want[0] || m.Resets[1] != want[1] || m.Resets[2] != want[2] {
+		t.Errorf("resets (cold) = %v, want %v", m.Resets, want)
+	}
+}
+
+func TestLoadPcomCardData(t *testing.T) {
+	dir := writeScriptFiles(t, map[string]string{
+		"comma.csv": "iccid, imsi, ki\n# test batch\n89012345678901234560F, 0809, 00112233\n",
+	})
+
+	row, err := LoadPcomCardData(filepath.Join(dir, "comma.csv"), "89012345678901234560")
+	if err != nil {
+		t.Fatalf("LoadPcomCardData() error = %v", err)
+	}
+	if row["ICCID"] != "89012345678901234560F" || row["IMSI"] != "0809" || row["KI"] != "00112233" {
+		t.Errorf("row = %v", row)
+	}
+	if _, err := LoadPcomCardData(filepath.Join(dir, "comma.csv"), "8949000000000000000"); err == nil {
+		t.Error("expected an error for an ICCID without row")
+	}
+}
@@ -3,16 +3,32 @@ package sim
 import (
 	"fmt"
 	"sim_reader/card"
+	"sim_reader/textcodec"
 	"strings"
 )
 
 // PhonebookEntry represents a single phonebook entry
 type PhonebookEntry struct {
-	Index  int
-	Name   string
-	Number string
+	Index             int
+	Name              string
+	Number            string
+	Emails            []string // EF_EMAIL (DF_PHONEBOOK)
+	AdditionalNumbers []string // EF_ANR (DF_PHONEBOOK)
 }
 
+// Phonebook is the phonebook of the card and where it was read from
+type Phonebook struct {
+	Location string // PhonebookUSIM, PhonebookTelecom or PhonebookLegacy
+	Entries  []PhonebookEntry
+}
+
+// Phonebook locations in the order ReadPhonebook tries them
+const (
+	PhonebookUSIM    = "ADF_USIM/DF_PHONEBOOK"
+	PhonebookTelecom = "DF_TELECOM/DF_PHONEBOOK"
+	PhonebookLegacy  = "DF_TELECOM/EF_ADN"
+)
+
 // SMSMessage represents a single SMS message
 type SMSMessage struct {
 	Index  int
@@ -22,51 +38,47 @@ type SMSMessage struct {
 	Raw    []byte
 }
 
-// ReadPhonebook reads phonebook entries from EF_ADN
-func ReadPhonebook(reader *card.Reader) ([]PhonebookEntry, error) {
-	// Select USIM
+// ReadPhonebook reads the phonebook: the local DF_PHONEBOOK of the USIM, else the global
+// one in DF_TELECOM, both through EF_PBR. Only when neither exists is the legacy EF_ADN of
+// DF_TELECOM read, with its EF_EXT1 overflow.
+func ReadPhonebook(reader *card.Reader) (*Phonebook, error) {
 	resp, err := reader.Select(GetUSIMAID())
 	if err != nil {
 		return nil, fmt.Errorf("failed to select USIM: %w", err)
 	}
-	if !resp.IsOK() {
-		return nil, fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
+	if resp.IsOK() {
+		if resp, err := reader.SelectDF(FID_DF_PHONEBOOK); err == nil && resp.IsOK() {
+			if entries, ok := readPBRPhonebook(reader); ok {
+				return &Phonebook{Location: PhonebookUSIM, Entries: entries}, nil
+			}
+		}
 	}
 
-	// Select EF_ADN (0x6F3A)
-	resp, err = reader.Select([]byte{0x6F, 0x3A})
-	if err != nil {
-		return nil, fmt.Errorf("failed to select EF_ADN: %w", err)
-	}
-	if !resp.IsOK() {
-		return nil, fmt.Errorf("EF_ADN selection failed: %s", card.SWToString(resp.SW()))
+	if !selectDFTelecom(reader) {
+		return nil, fmt.Errorf("no DF_PHONEBOOK and DF_TELECOM selection failed")
 	}
-
-	// Get record size from FCP
-	recordLen := parseFCPRecordSize(resp.Data)
-	if recordLen == 0 {
-		recordLen = 30 // Default ADN record size
-	}
-
-	var entries []PhonebookEntry
-
-	// Read up to 250 records (typical max for ADN)
-	for i := 1; i <= 250; i++ {
-		resp, err = reader.ReadRecord(byte(i), byte(recordLen))
-		if err != nil {
-			break
+	if resp, err := reader.SelectDF(FID_DF_PHONEBOOK); err == nil && resp.IsOK() {
+		if entries, ok := readPBRPhonebook(reader); ok {
+			return &Phonebook{Location: PhonebookTelecom, Entries: entries}, nil
 		}
-		if !resp.IsOK() {
-			break
+		if !selectDFTelecom(reader) {
+			return nil, fmt.Errorf("DF_TELECOM selection failed")
 		}
+	}
 
-		entry := decodeADNRecord(resp.Data, i)
-		if entry != nil {
-			entries = append(entries, *entry)
+	ext1, _ := readLinearEF(reader, FID_EF_EXT1)
+	adn, ok := readLinearEF(reader, []byte{0x6F, 0x3A})
+	if !ok {
+		return nil, fmt.Errorf("no DF_PHONEBOOK and no EF_ADN in DF_TELECOM")
+	}
+	pb := &Phonebook{Location: PhonebookLegacy}
+	for i, rec := range adn {
+		if entry := decodeADNRecord(rec, i+1); entry != nil {
+			entry.Number += decodeEXT1Chain(ext1, rec[len(rec)-1])
+			pb.Entries = append(pb.Entries, *entry)
 		}
 	}
-
-	return entries, nil
+	return pb, nil
 }
 
 // decodeADNRecord decodes a single ADN record
@@ -95,7 +107,7 @@ func decodeADNRecord(data []byte, index int) *PhonebookEntry {
 	}
 
 	// Decode name (GSM 7-bit or UCS2)
-	name := decodeAlphaID(data[:alphaLen])
+	name := textcodec.DecodeAlpha(data[:alphaLen])
 
 	// Decode number (last 14 bytes)
 	bcdLen := data[alphaLen]
@@ -121,48 +133,24 @@ func decodeADNRecord(data []byte, index int) *PhonebookEntry {
 	}
 }
 
-// decodeAlphaID decodes GSM 7-bit or UCS2 alpha identifier
-func decodeAlphaID(data []byte) string {
-	if len(data) == 0 {
-		return ""
-	}
-
-	// Trim trailing FF
-	end := len(data)
-	for end > 0 && data[end-1] == 0xFF {
-		end--
+// encodeADNRecord encodes a dialling number record in the EF_ADN layout (also used by
+// EF_FDN, EF_SDN and, with one more byte, EF_BDN) of recLen bytes: the name as alpha
+// identifier in the first recLen-14 bytes, then the number with up to 20 digits ("+"
+// for international). Capability/configuration and extension identifiers are left unused.
+func encodeADNRecord(name, number string, recLen int) ([]byte, error) {
+	if recLen < 14 {
+		return nil, fmt.Errorf("record length %d is too short for a dialling number", recLen)
 	}
-	if end == 0 {
-		return ""
-	}
-	data = data[:end]
-
-	// Check for UCS2 encoding
-	if len(data) > 0 && (data[0] == 0x80 || data[0] == 0x81 || data[0] == 0x82) {
-		// UCS2 encoded - simplified decode
-		var result strings.Builder
-		for i := 1; i+1 < len(data); i += 2 {
-			if data[i] == 0xFF && data[i+1] == 0xFF {
-				break
-			}
-			char := rune(int(data[i])<<8 | int(data[i+1]))
-			if char > 0 && char < 0xFFFF {
-				result.WriteRune(char)
-			}
-		}
-		return result.String()
+	alpha, err := textcodec.EncodeAlphaPadded(name, recLen-14)
+	if err != nil {
+		return nil, err
 	}
-
-	// GSM 7-bit default alphabet (simplified - just use ASCII printable)
-	var result strings.Builder
-	for _, b := range data {
-		if b >= 0x20 && b < 0x7F {
-			result.WriteByte(b)
-		} else if b == 0x00 {
-			result.WriteByte('@')
-		}
+	addr, err := encodeSMSPAddress(number, false)
+	if err != nil {
+		return nil, fmt.Errorf("number %w", err)
 	}
-	return strings.TrimSpace(result.String())
+	rec := append(alpha, addr...)
+	return append(rec, 0xFF, 0xFF), nil
 }
 
 // decodeBCDNumber decodes BCD phone number
@@ -210,7 +198,7 @@ func ReadSMS(reader *card.Reader) ([]SMSMessage, error) {
 		return nil, fmt.Errorf("failed to select USIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return nil, fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
+		return nil, fmt.Errorf("USIM selection failed: %s", resp.SWString())
 	}
 
 	// Select EF_SMS (0x6F3C)
@@ -219,7 +207,7 @@ func ReadSMS(reader *card.Reader) ([]SMSMessage, error) {
 		return nil, fmt.Errorf("failed to select EF_SMS: %w", err)
 	}
 	if !resp.IsOK() {
-		return nil, fmt.Errorf("EF_SMS selection failed: %s", card.SWToString(resp.SW()))
+		return nil, fmt.Errorf("EF_SMS selection failed: %s", resp.SWString())
 	}
 
 	// Get record size from FCP
@@ -276,54 +264,127 @@ func decodeSMSRecord(data []byte, index int) *SMSMessage {
 		statusStr = fmt.Sprintf("Status:0x%02X", status)
 	}
 
-	// TPDU parsing (simplified)
-	tpdu := data[1:]
-
-	// For SMS-DELIVER (incoming): first byte is address length
-	// This is a simplified parser - full SMS parsing is complex
 	msg := &SMSMessage{
 		Index:  index,
 		Status: statusStr,
 		Raw:    data,
 	}
+	msg.Number, msg.Text = decodeSMSTPDU(data[1:])
+	return msg
+}
 
-	// Try to extract sender/recipient number
-	if len(tpdu) > 2 {
-		addrLen := int(tpdu[0])
-		if addrLen > 0 && addrLen < 20 && len(tpdu) > 2+addrLen/2+1 {
-			tonNpi := tpdu[1]
-			numBytes := (addrLen + 1) / 2
-			if len(tpdu) > 2+numBytes {
-				msg.Number = decodeBCDNumber(tpdu[2:2+numBytes], tonNpi)
-			}
-		}
+// decodeSMSTPDU decodes the remainder of an EF_SMS record (TS 51.011 10.5.3): the service
+// centre address (TS 24.011) followed by an SMS-DELIVER or SMS-SUBMIT TPDU (TS 23.040).
+// It returns the originating or destination address and the message text.
+func decodeSMSTPDU(data []byte) (number, text string) {
+	if len(data) == 0 {
+		return "", ""
+	}
+	scLen := int(data[0])
+	if scLen == 0xFF {
+		scLen = 0
+	}
+	pdu := data[min(1+scLen, len(data)):]
+	if len(pdu) < 2 {
+		return "", ""
 	}
 
-	// Extract text (simplified - assumes 7-bit GSM encoding at fixed offset)
-	// Real SMS parsing would need to handle TP-PID, TP-DCS, TP-SCTS, TP-UDL properly
-	textOffset := 20 // Approximate offset after headers
-	if len(tpdu) > textOffset {
-		msg.Text = decodeGSM7bit(tpdu[textOffset:])
+	first := pdu[0]
+	pos := 1
+	switch first & 0x03 {
+	case 0x00: // SMS-DELIVER: TP-OA, TP-PID, TP-DCS, TP-SCTS
+	case 0x01: // SMS-SUBMIT: TP-MR, TP-DA, TP-PID, TP-DCS, TP-VP
+		pos++
+	default:
+		return "", ""
+	}
+	if pos+2 > len(pdu) {
+		return "", ""
+	}
+	addrDigits := int(pdu[pos])
+	addrEnd := pos + 2 + (addrDigits+1)/2
+	if addrEnd > len(pdu) {
+		return "", ""
+	}
+	number = decodeSMSAddress(pdu[pos+1], pdu[pos+2:addrEnd], addrDigits)
+	pos = addrEnd + 1 // TP-PID
+	if pos >= len(pdu) {
+		return number, ""
+	}
+	dcs := pdu[pos]
+	pos++
+	if first&0x03 == 0x00 {
+		pos += 7 // TP-SCTS
+	} else {
+		switch (first >> 3) & 0x03 { // TP-VPF
+		case 0x02:
+			pos++
+		case 0x01, 0x03:
+			pos += 7
+		}
 	}
+	if pos >= len(pdu) {
+		return number, ""
+	}
+	udl := int(pdu[pos])
+	ud := pdu[pos+1:]
+	udhi := first&0x40 != 0
 
-	return msg
+	switch smsAlphabet(dcs) {
+	case smsGSM7:
+		septets := textcodec.UnpackSeptets(ud, udl, 0)
+		if udhi && len(ud) > 0 {
+			// The header and its fill bits end on a septet boundary
+			skip := ((int(ud[0])+1)*8 + 6) / 7
+			septets = septets[min(skip, len(septets)):]
+		}
+		return number, textcodec.DecodeGSM7(septets)
+	case smsUCS2:
+		ud = ud[:min(udl, len(ud))]
+		if udhi && len(ud) > 0 {
+			ud = ud[min(int(ud[0])+1, len(ud)):]
+		}
+		return number, textcodec.DecodeUCS2(ud)
+	default:
+		ud = ud[:min(udl, len(ud))]
+		return number, fmt.Sprintf("%X", ud)
+	}
 }
 
-// decodeGSM7bit decodes GSM 7-bit packed text (simplified)
-func decodeGSM7bit(data []byte) string {
-	// Simplified: just extract printable ASCII
-	var result strings.Builder
-	for _, b := range data {
-		if b >= 0x20 && b < 0x7F {
-			result.WriteByte(b)
-		} else if b == 0x00 {
-			result.WriteByte('@')
+// SMS alphabets of the data coding scheme
+const (
+	smsGSM7 = iota
+	smsData8
+	smsUCS2
+)
+
+// smsAlphabet returns the alphabet of a TP-DCS (TS 23.038 4)
+func smsAlphabet(dcs byte) int {
+	switch {
+	case dcs&0xC0 == 0x00, dcs&0xC0 == 0x40: // general data coding, possibly marked for deletion
+		switch (dcs >> 2) & 0x03 {
+		case 0x01:
+			return smsData8
+		case 0x02:
+			return smsUCS2
 		}
+		return smsGSM7
+	case dcs&0xF0 == 0xE0: // message waiting, UCS2
+		return smsUCS2
+	case dcs&0xF0 == 0xF0: // data coding / message class
+		if dcs&0x04 != 0 {
+			return smsData8
+		}
+		return smsGSM7
 	}
-	text := strings.TrimRight(result.String(), "\x00\xFF ")
-	if len(text) > 160 {
-		text = text[:160]
-	}
-	return text
+	return smsGSM7
 }
 
+// decodeSMSAddress decodes a TP address with digits semi-octets; an alphanumeric address
+// (TON 101) is GSM 7-bit packed
+func decodeSMSAddress(tonNpi byte, data []byte, digits int) string {
+	if tonNpi&0x70 == 0x50 {
+		return textcodec.DecodeGSM7Packed(data, digits*4/7)
+	}
+	return decodeBCDNumber(data, tonNpi)
+}
@@ -0,0 +1,185 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/textcodec"
+)
+
+// ============ PHONEBOOK / SMS TESTS ============
+
+func TestDecodeADNRecordUCS2(t *testing.T) {
+	// 82 coded name "Բփ-1" with a 14 byte number part
+	data, _ := hex.DecodeString("8204053082D32D31FFFFFF" + "0681214365F7FFFFFFFFFFFFFFFF")
+	entry := decodeADNRecord(data, 3)
+	if entry == nil {
+		t.Fatal("decodeADNRecord() = nil")
+	}
+	if entry.Name != "Բփ-1" || entry.Number != "1234567" || entry.Index != 3 {
+		t.Errorf("decodeADNRecord() = %+v", *entry)
+	}
+}
+
+func TestDecodeSMSRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		record string
+		status string
+		number string
+		text   string
+	}{
+		{
+			// SMSC +27381000015, SMS-DELIVER from 27838890001
+			name:   "deliver GSM 7-bit",
+			record: "01" + "07917283010010F5" + "040BC87238880900F10000993092516195800AE8329BFD4697D9EC37FFFF",
+			status: "Read",
+			number: "27838890001",
+			text:   "hellohello",
+		},
+		{
+			// No SMSC, SMS-SUBMIT with relative validity, UCS2
+			name:   "submit UCS2",
+			record: "07" + "00" + "1100" + "0B916407281553F8" + "0008AA" + "0404220435" + "FFFF",
+			status: "Unsent",
+			number: "+46708251358",
+			text:   "Те",
+		},
+		{
+			// Concatenation header (6 octets) then one fill bit before the text
+			name:   "deliver with user data header",
+			record: "03" + "00" + "44" + "04812143" + "0000" + "99309251619580" + "09" + "0500030102019069",
+			status: "Unread",
+			number: "1234",
+			text:   "Hi",
+		},
+		{
+			name:   "8-bit data",
+			record: "01" + "00" + "00" + "0281F2" + "0004" + "99309251619580" + "02CAFE",
+			status: "Read",
+			number: "2",
+			text:   "CAFE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := decodeSMSRecord(data, 1)
+			if msg == nil {
+				t.Fatal("decodeSMSRecord() = nil")
+			}
+			if msg.Status != tt.status || msg.Number != tt.number || msg.Text != tt.text {
+				t.Errorf("decodeSMSRecord() = %q %q %q, want %q %q %q",
+					msg.Status, msg.Number, msg.Text, tt.status, tt.number, tt.text)
+			}
+		})
+	}
+
+	if decodeSMSRecord([]byte{0x00, 0xFF, 0xFF}, 1) != nil {
+		t.Error("decodeSMSRecord() should skip a free record")
+	}
+}
+
+func TestDecodeSMSAddressAlphanumeric(t *testing.T) {
+	packed, septets, _ := textcodec.EncodeGSM7Packed("Info")
+	digits := (septets*7 + 3) / 4 // semi-octets
+	if got := decodeSMSAddress(0xD0, packed, digits); got != "Info" {
+		t.Errorf("decodeSMSAddress() = %q, want %q", got, "Info")
+	}
+}
+
+// ============ DF_PHONEBOOK / EF_PBR TESTS ============
+
+func TestParsePBRRecord(t *testing.T) {
+	// First EF_PBR record of the reference eSIM profile (fill pattern of ef-pbr)
+	data, _ := hex.DecodeString("A823C0034F3A0AC1034F1505C5034F0901C6034F4C0BCA034F5109C3034F1904C9034F1606" +
+		"A90FC4034F1102C4034F1307CA034F1408" + "AA12C2034F1203CB034F3D0CC7024F4BC8024F4D" + "FF")
+	files := ParsePBRRecord(data)
+	if len(files) != 14 {
+		t.Fatalf("ParsePBRRecord() = %d files, want 14", len(files))
+	}
+	want := map[int]PBRFile{
+		0:  {Type: PBRType1, Tag: PBRTagADN, FID: []byte{0x4F, 0x3A}, SFI: 0x0A},
+		7:  {Type: PBRType2, Tag: PBRTagANR, FID: []byte{0x4F, 0x11}, SFI: 0x02},
+		9:  {Type: PBRType2, Tag: PBRTagEMAIL, FID: []byte{0x4F, 0x14}, SFI: 0x08},
+		10: {Type: PBRType3, Tag: PBRTagEXT1, FID: []byte{0x4F, 0x12}, SFI: 0x03},
+		13: {Type: PBRType3, Tag: PBRTagGAS, FID: []byte{0x4F, 0x4D}},
+	}
+	for i, w := range want {
+		if !reflect.DeepEqual(files[i], w) {
+			t.Errorf("file %d = %+v, want %+v", i, files[i], w)
+		}
+	}
+}
+
+// adnRecord builds an 18-byte ADN record: 4-byte name, number and EXT1 record identifier
+func adnRecord(name string, bcd []byte, ext byte) []byte {
+	rec := bytes.Repeat([]byte{0xFF}, 18)
+	copy(rec, name)
+	rec[4] = byte(1 + len(bcd))
+	rec[5] = 0x81
+	copy(rec[6:16], bcd)
+	rec[17] = ext
+	return rec
+}
+
+func TestReadPhonebook_PBR(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(AID_USIM)
+	pb := m.MF().AddDF(0x7F10).AddDF(0x5F3A)
+	// ADN, IAP and ANR of type 1, EMAIL of type 2, EXT1 of type 3
+	pb.AddRecordEF(0x4F30, []byte{
+		0xA8, 0x0D, 0xC0, 0x03, 0x4F, 0x3A, 0x01, 0xC1, 0x02, 0x4F, 0x25, 0xC4, 0x02, 0x4F, 0x11,
+		0xA9, 0x04, 0xCA, 0x02, 0x4F, 0x50,
+		0xAA, 0x04, 0xC2, 0x02, 0x4F, 0x4A,
+		0xFF, 0xFF})
+	pb.AddRecordEF(0x4F3A,
+		adnRecord("Anna", []byte{0x21, 0x43, 0x65, 0x87, 0x09, 0x21, 0x43, 0x65, 0x87, 0x09}, 0x01),
+		adnRecord("Bob", []byte{0x21, 0x43, 0xF5}, 0xFF),
+		bytes.Repeat([]byte{0xFF}, 18))
+	pb.AddRecordEF(0x4F25, []byte{0x02}, []byte{0xFF}, []byte{0xFF})
+	email, _ := textcodec.EncodeAlphaPadded("a@b.org", 10)
+	pb.AddRecordEF(0x4F50, bytes.Repeat([]byte{0xFF}, 12), append(email, 0x01, 0x01))
+	pb.AddRecordEF(0x4F11,
+		[]byte{0xFF, 0x03, 0x81, 0x99, 0xF9, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		bytes.Repeat([]byte{0xFF}, 15), bytes.Repeat([]byte{0xFF}, 15))
+	pb.AddRecordEF(0x4F4A, []byte{0x02, 0x02, 0x21, 0xF3, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	got, err := ReadPhonebook(reader)
+	if err != nil {
+		t.Fatalf("ReadPhonebook() error = %v", err)
+	}
+	want := &Phonebook{Location: PhonebookTelecom, Entries: []PhonebookEntry{
+		{Index: 1, Name: "Anna", Number: "12345678901234567890123", Emails: []string{"a@b.org"}, AdditionalNumbers: []string{"999"}},
+		{Index: 2, Name: "Bob", Number: "12345"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadPhonebook() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadPhonebook_Legacy(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(AID_USIM)
+	telecom := m.MF().AddDF(0x7F10)
+	telecom.AddRecordEF(0x6F3A, adnRecord("Eve", []byte{0x21, 0x43, 0x65, 0x87, 0x09, 0x21, 0x43, 0x65, 0x87, 0x09}, 0x02))
+	telecom.AddRecordEF(0x6F4A,
+		bytes.Repeat([]byte{0xFF}, 13),
+		[]byte{0x02, 0x01, 0x55, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	got, err := ReadPhonebook(reader)
+	if err != nil {
+		t.Fatalf("ReadPhonebook() error = %v", err)
+	}
+	if got.Location != PhonebookLegacy || len(got.Entries) != 1 || got.Entries[0].Number != "1234567890123456789055" {
+		t.Errorf("ReadPhonebook() = %+v", got)
+	}
+}
@@ -0,0 +1,168 @@
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Access Technology Identifier of EF_PLMNwAcT, EF_OPLMNwACT and EF_HPLMNwACT
+// (TS 31.102 4.2.5). NR has no bit of its own: it is the NG-RAN bit.
+const (
+	ACT_UTRAN       = 0x8000 // 3G UMTS
+	ACT_E_UTRAN     = 0x4000 // 4G LTE, WB-S1 and NB-S1 mode
+	ACT_E_UTRAN_WB  = 0x2000 // with ACT_E_UTRAN: WB-S1 mode only
+	ACT_E_UTRAN_NB  = 0x1000 // with ACT_E_UTRAN: NB-S1 mode only (NB-IoT)
+	ACT_NG_RAN      = 0x0800 // 5G NR
+	ACT_SAT_NG_RAN  = 0x0400 // satellite NG-RAN (Rel-17)
+	ACT_SAT_E_UTRAN = 0x0200 // satellite E-UTRAN (Rel-17)
+	ACT_GSM         = 0x0080 // 2G GSM
+	ACT_GSM_COMPACT = 0x0040
+	ACT_CDMA_HRPD   = 0x0020
+	ACT_CDMA_1X     = 0x0010
+	ACT_NR          = ACT_NG_RAN
+	ACT_ALL         = ACT_UTRAN | ACT_E_UTRAN | ACT_GSM | ACT_NG_RAN
+)
+
+// actTechnology is an access technology: its bits, the name used by the config and the
+// write flags, and the name displayed by read
+type actTechnology struct {
+	bits    uint16
+	mask    uint16 // bits compared with bits (0 = bits): E-UTRAN also looks at the mode bits
+	name    string
+	display string
+	aliases []string
+}
+
+// actTechnologies is shared by the readers and the writers of the ACT fields, in display
+// order. E-UTRAN in both modes is 0x4000 or 0x7000; the latter is listed as WB-S1 and NB-S1.
+var actTechnologies = []actTechnology{
+	{bits: ACT_UTRAN, name: "utran", display: "UTRAN", aliases: []string{"umts", "3g"}},
+	{bits: ACT_E_UTRAN, mask: ACT_E_UTRAN | ACT_E_UTRAN_WB | ACT_E_UTRAN_NB, name: "eutran", display: "E-UTRAN",
+		aliases: []string{"e-utran", "lte", "4g"}},
+	{bits: ACT_E_UTRAN | ACT_E_UTRAN_WB, name: "eutran-wb", display: "E-UTRAN WB-S1", aliases: []string{"lte-m"}},
+	{bits: ACT_E_UTRAN | ACT_E_UTRAN_NB, name: "eutran-nb", display: "E-UTRAN NB-S1", aliases: []string{"nb-iot"}},
+	{bits: ACT_NG_RAN, name: "ngran", display: "NG-RAN", aliases: []string{"ng-ran", "nr", "5g", "5gsa"}},
+	{bits: ACT_SAT_NG_RAN, name: "sat-ngran", display: "satellite NG-RAN"},
+	{bits: ACT_SAT_E_UTRAN, name: "sat-eutran", display: "satellite E-UTRAN"},
+	{bits: ACT_GSM, name: "gsm", display: "GSM", aliases: []string{"2g"}},
+	{bits: ACT_GSM_COMPACT, name: "gsm-compact", display: "GSM COMPACT"},
+	{bits: ACT_CDMA_HRPD, name: "cdma-hrpd", display: "cdma2000 HRPD", aliases: []string{"hrpd"}},
+	{bits: ACT_CDMA_1X, name: "cdma-1x", display: "cdma2000 1xRTT", aliases: []string{"1xrtt"}},
+}
+
+// actModeled holds every bit of actTechnologies; the others are RFU
+const actModeled = ACT_UTRAN | ACT_E_UTRAN | ACT_E_UTRAN_WB | ACT_E_UTRAN_NB | ACT_NG_RAN | ACT_SAT_NG_RAN |
+	ACT_SAT_E_UTRAN | ACT_GSM | ACT_GSM_COMPACT | ACT_CDMA_HRPD | ACT_CDMA_1X
+
+// actNames lists the technologies of act, with the bits no technology accounts for as a
+// raw "0x...." entry at the end
+func actNames(act uint16, display bool) []string {
+	var names []string
+	var matched uint16
+	for _, t := range actTechnologies {
+		mask := t.mask
+		if mask == 0 {
+			mask = t.bits
+		}
+		if act&mask != t.bits {
+			continue
+		}
+		matched |= t.bits
+		if display {
+			names = append(names, t.display)
+		} else {
+			names = append(names, t.name)
+		}
+	}
+	if rest := act &^ matched; rest != 0 {
+		names = append(names, fmt.Sprintf("0x%04X", rest))
+	}
+	return names
+}
+
+// DecodeACT decodes Access Technology bits
+func DecodeACT(act uint16) []string {
+	return actNames(act, true)
+}
+
+// plmnActToStrings converts ACT bitmask to string slice
+func plmnActToStrings(act uint16) []string {
+	return actNames(act, false)
+}
+
+// ParseACT parses comma-separated ACT names (see actTechnologies), "all" or raw "0x...."
+// bits. Unknown names are an error.
+func ParseACT(s string) (uint16, error) {
+	var act uint16
+	for _, p := range splitString(s, ',') {
+		p = toLower(trimSpace(p))
+		if p == "" {
+			continue
+		}
+		bits, ok := parseACTName(p)
+		if !ok {
+			return 0, fmt.Errorf("unknown access technology %q (use: %s, all or 0xNNNN)", p, strings.Join(ACTNames(), ", "))
+		}
+		act |= bits
+	}
+	return act, nil
+}
+
+// ParseACTString parses comma-separated ACT names, ignoring unknown ones
+func ParseACTString(s string) uint16 {
+	var act uint16
+	for _, p := range splitString(s, ',') {
+		if bits, ok := parseACTName(toLower(trimSpace(p))); ok {
+			act |= bits
+		}
+	}
+	return act
+}
+
+// parseACTName returns the bits of a lowercase ACT name
+func parseACTName(name string) (uint16, bool) {
+	if name == "all" {
+		return ACT_ALL, true
+	}
+	if strings.HasPrefix(name, "0x") {
+		v, err := strconv.ParseUint(name[2:], 16, 16)
+		return uint16(v), err == nil
+	}
+	for _, t := range actTechnologies {
+		if t.name == name {
+			return t.bits, true
+		}
+		for _, a := range t.aliases {
+			if a == name {
+				return t.bits, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ACTNames returns the config names of the access technologies
+func ACTNames() []string {
+	names := make([]string, len(actTechnologies))
+	for i, t := range actTechnologies {
+		names[i] = t.name
+	}
+	return names
+}
+
+// keepUnknownACT returns entries with the RFU ACT bits of the entry of the same PLMN in
+// current added, as the PLMN list writers keep them when they rewrite an entry
+func keepUnknownACT(entries []HPLMNEntry, current []PLMNwACT) []HPLMNEntry {
+	kept := make([]HPLMNEntry, len(entries))
+	for i, e := range entries {
+		for _, c := range current {
+			if c.MCC == e.MCC && c.MNC == e.MNC {
+				e.ACT |= c.ACT &^ actModeled
+				break
+			}
+		}
+		kept[i] = e
+	}
+	return kept
+}
@@ -0,0 +1,119 @@
+package sim
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ PLMN ACCESS TECHNOLOGY TESTS ============
+
+func TestACT_NamedRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		bits    uint16
+		display string
+	}{
+		{"utran", 0x8000, "UTRAN"},
+		{"eutran", 0x4000, "E-UTRAN"},
+		{"eutran-wb", 0x6000, "E-UTRAN WB-S1"},
+		{"eutran-nb", 0x5000, "E-UTRAN NB-S1"},
+		{"ngran", 0x0800, "NG-RAN"},
+		{"sat-ngran", 0x0400, "satellite NG-RAN"},
+		{"sat-eutran", 0x0200, "satellite E-UTRAN"},
+		{"gsm", 0x0080, "GSM"},
+		{"gsm-compact", 0x0040, "GSM COMPACT"},
+		{"cdma-hrpd", 0x0020, "cdma2000 HRPD"},
+		{"cdma-1x", 0x0010, "cdma2000 1xRTT"},
+	}
+	if len(tests) != len(ACTNames()) {
+		t.Errorf("ACTNames() = %q, a test per name expected", ACTNames())
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			act, err := ParseACT(tt.name)
+			if err != nil || act != tt.bits {
+				t.Fatalf("ParseACT(%q) = %04X, %v; want %04X", tt.name, act, err, tt.bits)
+			}
+			if got := plmnActToStrings(act); !reflect.DeepEqual(got, []string{tt.name}) {
+				t.Errorf("plmnActToStrings(%04X) = %q, want %q", act, got, tt.name)
+			}
+			if got := DecodeACT(act); !reflect.DeepEqual(got, []string{tt.display}) {
+				t.Errorf("DecodeACT(%04X) = %q, want %q", act, got, tt.display)
+			}
+		})
+	}
+}
+
+func TestACT_NRIsNGRAN(t *testing.T) {
+	// TS 31.102 has one NG-RAN bit (1st byte b4): nr must not land on the RFU bits
+	for _, name := range []string{"nr", "5g", "ng-ran", "5gsa"} {
+		if act, err := ParseACT(name); err != nil || act != 0x0800 {
+			t.Errorf("ParseACT(%q) = %04X, %v; want 0800", name, act, err)
+		}
+	}
+	_, _, act, err := ParseHPLMNString("250:88:nr")
+	if err != nil || !reflect.DeepEqual(plmnActToStrings(act), []string{"ngran"}) {
+		t.Errorf("250:88:nr reads back as %q, %v", plmnActToStrings(act), err)
+	}
+}
+
+func TestACT_EUTRANModes(t *testing.T) {
+	// Both mode bits set is E-UTRAN in both modes as well
+	if got := plmnActToStrings(0x7000); !reflect.DeepEqual(got, []string{"eutran-wb", "eutran-nb"}) {
+		t.Errorf("plmnActToStrings(7000) = %q", got)
+	}
+	if act, _ := ParseACT("eutran-wb,eutran-nb"); act != 0x7000 {
+		t.Errorf("ParseACT(eutran-wb,eutran-nb) = %04X, want 7000", act)
+	}
+	// Mode bits without E-UTRAN mean nothing and are shown raw
+	if got := DecodeACT(0x2080); !reflect.DeepEqual(got, []string{"GSM", "0x2000"}) {
+		t.Errorf("DecodeACT(2080) = %q", got)
+	}
+}
+
+func TestACT_UnknownBits(t *testing.T) {
+	if got := plmnActToStrings(0x4103); !reflect.DeepEqual(got, []string{"eutran", "0x0103"}) {
+		t.Errorf("plmnActToStrings(4103) = %q, want the RFU bits as hex", got)
+	}
+	if act, err := ParseACT("eutran, 0x0103"); err != nil || act != 0x4103 {
+		t.Errorf("ParseACT(eutran, 0x0103) = %04X, %v", act, err)
+	}
+	for _, s := range []string{"wimax", "eutran,5gnsa", "0xZZ"} {
+		if _, err := ParseACT(s); err == nil {
+			t.Errorf("ParseACT(%q) accepted", s)
+		}
+	}
+	if _, _, _, err := ParseHPLMNString("250:88:lte,wimax"); err == nil || !strings.Contains(err.Error(), "wimax") {
+		t.Errorf("ParseHPLMNString(wimax) error = %v", err)
+	}
+	if _, err := ParseConfig([]byte(`{"hplmn": [{"mcc": "250", "mnc": "88", "act": ["eutran", "wimax"]}]}`)); err == nil ||
+		!strings.Contains(err.Error(), "hplmn[0]") {
+		t.Errorf("ParseConfig(unknown act) error = %v", err)
+	}
+}
+
+func TestWriteHPLMN_KeepsUnknownACTBits(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	ef := m.AddADF(AID_USIM).AddEF(0x6F62, mustHex("52F088410352F001C080"))
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	// 250-88 had E-UTRAN and RFU bits 0103: the technology changes, the RFU bits stay
+	if err := WriteHPLMNList(reader, []HPLMNEntry{{MCC: "250", MNC: "88", ACT: ACT_NG_RAN}, {MCC: "250", MNC: "02", ACT: ACT_GSM}}); err != nil {
+		t.Fatalf("WriteHPLMNList() error = %v", err)
+	}
+	if want := mustHex("52F088090352F0200080"); !bytes.Equal(ef.Data, want) {
+		t.Errorf("EF_HPLMNwACT = %X, want %X", ef.Data, want)
+	}
+
+	current := DecodePLMNwACT(ef.Data)
+	if !samePLMNList(current, []HPLMNEntry{{MCC: "250", MNC: "88", ACT: ACT_NG_RAN}, {MCC: "250", MNC: "02", ACT: ACT_GSM}}) {
+		t.Errorf("samePLMNList() = false after the write, want the RFU bits ignored")
+	}
+	if current[0].Tech[1] != "0x0103" {
+		t.Errorf("Tech = %q, want the RFU bits shown", current[0].Tech)
+	}
+}
@@ -0,0 +1,193 @@
+package sim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"sim_reader/card"
+)
+
+// ProfileStoreVersion is the format version written by ProfileStore.Save
+const ProfileStoreVersion = 1
+
+// ProfileStore remembers per card (by ICCID) the parameters that worked with it: the ADM
+// VERIFY variant, the driver, custom AIDs and the GlobalPlatform KVN, keyset name and SD
+// AID. Entries are only updated with values the card accepted. Keys, PINs and ADM values
+// are never stored, so the file holds no secrets; it is still written readable by the
+// owner only.
+type ProfileStore struct {
+	Version int                     `json:"version"`
+	Cards   map[string]*CardProfile `json:"cards"`
+
+	path string
+}
+
+// CardProfile is the entry of one card
+type CardProfile struct {
+	Updated string                   `json:"updated"`
+	Driver  string                   `json:"driver,omitempty"`   // ProgrammableDriver.Name of the detected driver
+	ADM     map[int]StoredADMProfile `json:"adm,omitempty"`      // ADM level -> VERIFY variant that verified
+	USIMAID string                   `json:"usim_aid,omitempty"` // --usim-aid that selected
+	ISIMAID string                   `json:"isim_aid,omitempty"` // --isim-aid that selected
+	GP      *StoredGPProfile         `json:"gp,omitempty"`
+
+	GPInstalls map[string]StoredGPInstall `json:"gp_installs,omitempty"` // instance AID -> how it was installed
+}
+
+// StoredADMProfile is a card.ADMVerifyProfile in the store
+type StoredADMProfile struct {
+	Name    string `json:"name"`
+	CLA     byte   `json:"cla"`
+	KeyRef  byte   `json:"key_ref"`
+	Length  int    `json:"length"`
+	Padding byte   `json:"padding"`
+	Format  string `json:"format"` // binary or ascii-hex
+	Unlock  bool   `json:"unlock,omitempty"`
+}
+
+// StoredGPProfile is a secure channel setup that opened on the card
+type StoredGPProfile struct {
+	KVN    int    `json:"kvn"`
+	Keyset string `json:"keyset,omitempty"` // DMS keyset name (cm, psk40, ...), empty for explicit keys
+	SDAID  string `json:"sd_aid"`
+	Div    string `json:"div,omitempty"` // key diversification that matched
+}
+
+// StoredGPInstall is an applet instance installed by gp load or gp registry. The card
+// does not return install parameters in GET STATUS, so this is where gp registry finds
+// them.
+type StoredGPInstall struct {
+	Package    string `json:"package"`
+	Module     string `json:"module"`
+	Privileges string `json:"privileges,omitempty"`
+	Params     string `json:"params,omitempty"` // C9 content, hex
+}
+
+// NewStoredADMProfile converts a VERIFY profile for the store
+func NewStoredADMProfile(p card.ADMVerifyProfile) StoredADMProfile {
+	format := "binary"
+	if p.Format == card.ADMKeyASCIIHex {
+		format = "ascii-hex"
+	}
+	return StoredADMProfile{Name: p.Name, CLA: p.CLA, KeyRef: p.KeyRef, Length: p.Length,
+		Padding: p.Padding, Format: format, Unlock: p.Unlock}
+}
+
+// Profile returns the VERIFY profile
+func (s StoredADMProfile) Profile() card.ADMVerifyProfile {
+	p := card.ADMVerifyProfile{Name: s.Name, CLA: s.CLA, KeyRef: s.KeyRef, Length: s.Length,
+		Padding: s.Padding, Unlock: s.Unlock}
+	if s.Format == "ascii-hex" {
+		p.Format = card.ADMKeyASCIIHex
+	}
+	return p
+}
+
+// ExpandHome replaces a leading ~/ with the home directory
+func ExpandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// OpenProfileStore reads the store at path; a missing file gives an empty store that
+// Save creates
+func OpenProfileStore(path string) (*ProfileStore, error) {
+	path = ExpandHome(path)
+	s := &ProfileStore{Version: ProfileStoreVersion, Cards: map[string]*CardProfile{}, path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parse profile store %s: %w", path, err)
+	}
+	if s.Version != ProfileStoreVersion {
+		return nil, fmt.Errorf("profile store %s has version %d, expected %d", path, s.Version, ProfileStoreVersion)
+	}
+	if s.Cards == nil {
+		s.Cards = map[string]*CardProfile{}
+	}
+	return s, nil
+}
+
+// Path returns the file of the store
+func (s *ProfileStore) Path() string {
+	return s.path
+}
+
+// Get returns the entry of the card, or nil
+func (s *ProfileStore) Get(iccid string) *CardProfile {
+	return s.Cards[iccid]
+}
+
+// Update applies fn to a copy of the entry of the card (a new entry if there is none) and
+// keeps the result when it differs. Returns whether the entry changed.
+func (s *ProfileStore) Update(iccid string, fn func(p *CardProfile)) bool {
+	cur := s.Cards[iccid]
+	next := &CardProfile{}
+	if cur != nil {
+		next = cur.clone()
+	}
+	fn(next)
+	if cur != nil && reflect.DeepEqual(cur, next) || cur == nil && reflect.DeepEqual(next, &CardProfile{}) {
+		return false
+	}
+	next.Updated = time.Now().Format(time.RFC3339)
+	s.Cards[iccid] = next
+	return true
+}
+
+func (p *CardProfile) clone() *CardProfile {
+	c := *p
+	if p.ADM != nil {
+		c.ADM = make(map[int]StoredADMProfile, len(p.ADM))
+		for level, a := range p.ADM {
+			c.ADM[level] = a
+		}
+	}
+	if p.GP != nil {
+		gp := *p.GP
+		c.GP = &gp
+	}
+	if p.GPInstalls != nil {
+		c.GPInstalls = make(map[string]StoredGPInstall, len(p.GPInstalls))
+		for aid, inst := range p.GPInstalls {
+			c.GPInstalls[aid] = inst
+		}
+	}
+	return &c
+}
+
+// Forget removes the entry of the card and reports whether there was one
+func (s *ProfileStore) Forget(iccid string) bool {
+	_, ok := s.Cards[iccid]
+	delete(s.Cards, iccid)
+	return ok
+}
+
+// Save writes the store (directory 0700, file 0600)
+func (s *ProfileStore) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, append(data, '\n'), 0600)
+}
@@ -0,0 +1,97 @@
+package sim
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ PROFILE STORE TESTS ============
+
+func TestProfileStore_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "cards.json")
+	store, err := OpenProfileStore(path)
+	if err != nil || len(store.Cards) != 0 {
+		t.Fatalf("OpenProfileStore(missing) = %+v, %v", store, err)
+	}
+
+	adm := card.ADMVerifyProfile{Name: "ascii", CLA: 0x00, KeyRef: 0x0A, Length: 8, Format: card.ADMKeyASCIIHex}
+	changed := store.Update("8901234567890123456", func(p *CardProfile) {
+		p.Driver = "sysmoISIM-SJA5"
+		p.ADM = map[int]StoredADMProfile{1: NewStoredADMProfile(adm)}
+		p.GP = &StoredGPProfile{KVN: 1, Keyset: "cm", SDAID: "A000000151000000", Div: "none"}
+	})
+	if !changed {
+		t.Fatal("Update() = false for a new entry")
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("store file mode = %v, %v; want 0600", fi.Mode().Perm(), err)
+	}
+
+	again, err := OpenProfileStore(path)
+	if err != nil {
+		t.Fatalf("OpenProfileStore() error = %v", err)
+	}
+	p := again.Get("8901234567890123456")
+	if p == nil || p.Driver != "sysmoISIM-SJA5" || p.GP == nil || p.GP.Keyset != "cm" || p.Updated == "" {
+		t.Fatalf("stored profile = %+v", p)
+	}
+	if got := p.ADM[1].Profile(); got != adm {
+		t.Errorf("ADM1 profile = %+v, want %+v", got, adm)
+	}
+}
+
+func TestProfileStore_UpdateAndForget(t *testing.T) {
+	store, _ := OpenProfileStore(filepath.Join(t.TempDir(), "cards.json"))
+
+	if store.Update("1", func(p *CardProfile) {}) {
+		t.Error("Update() stored an empty entry")
+	}
+	store.Update("1", func(p *CardProfile) { p.USIMAID = "A0000000871002" })
+	before := *store.Get("1")
+	if store.Update("1", func(p *CardProfile) { p.USIMAID = "A0000000871002" }) {
+		t.Error("Update() = true for an unchanged entry")
+	}
+	if !reflect.DeepEqual(*store.Get("1"), before) {
+		t.Error("unchanged entry was rewritten")
+	}
+
+	if !store.Forget("1") || store.Get("1") != nil {
+		t.Error("Forget() did not remove the entry")
+	}
+	if store.Forget("1") {
+		t.Error("Forget() = true for a missing entry")
+	}
+}
+
+func TestOpenProfileStore_WrongVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cards.json")
+	os.WriteFile(path, []byte(`{"version": 99, "cards": {}}`), 0600)
+	if _, err := OpenProfileStore(path); err == nil {
+		t.Error("OpenProfileStore() accepted version 99")
+	}
+}
+
+func TestAdmProfilesFor_Preferred(t *testing.T) {
+	defer ClearADMKey()
+	defaults := admProfilesFor(nil, 1)
+	if len(defaults) < 2 {
+		t.Skip("need at least two default ADM profiles")
+	}
+	last := defaults[len(defaults)-1]
+	PreferADMProfile(1, last)
+
+	got := admProfilesFor(nil, 1)
+	if len(got) != len(defaults) || got[0] != last {
+		t.Errorf("admProfilesFor() = %+v, want %+v first and no duplicate", got, last)
+	}
+	if other := admProfilesFor(nil, 2); !reflect.DeepEqual(other, DefaultADMProfiles(2)) {
+		t.Errorf("admProfilesFor(level 2) changed by the level 1 preference")
+	}
+}
@@ -26,6 +26,101 @@ type ProgrammableDriver interface {
 	WritePINs(reader *card.Reader, pin1, puk1, pin2, puk2 string) error
 }
 
+// DriverCapability names an optional feature a driver may provide beyond ProgrammableDriver
+type DriverCapability string
+
+const (
+	// CapReadOTACounter: driver can read OTA counters/keyset info from vendor-specific files (see OTACounterReader)
+	CapReadOTACounter DriverCapability = "read-ota-counter"
+	// CapAuthKeyFile: driver reads/writes the authentication key file (algorithm, Ki, OP/OPc) as a whole (see AuthKeyFileProvider)
+	CapAuthKeyFile DriverCapability = "auth-key-file"
+	// CapSQNConfig: driver reads/writes the SQN check parameters (see SQNConfigProvider)
+	CapSQNConfig DriverCapability = "sqn-config"
+	// CapOTAKeys: driver reads/writes the OTA keyset files (see OTAKeyProvider)
+	CapOTAKeys DriverCapability = "ota-keys"
+	// CapReadSQN: driver reads the SQN array and scheme parameters of the USIM (see SQNInfoReader)
+	CapReadSQN DriverCapability = "read-sqn"
+	// CapReadKi: driver knows the subscriber key file and reads Ki where the card allows it, usually test cards with ADM (see KiReader)
+	CapReadKi DriverCapability = "read-ki"
+	// CapAlgorithmParams: driver reads the parameters stored with the algorithm selector, e.g. TUAK Keccak iterations (see AlgorithmParamsReader)
+	CapAlgorithmParams DriverCapability = "algorithm-params"
+)
+
+// CapabilityProvider is implemented by drivers that advertise optional capabilities
+type CapabilityProvider interface {
+	Capabilities() []DriverCapability
+}
+
+// OTACounterReader is implemented by drivers advertising CapReadOTACounter
+type OTACounterReader interface {
+	ReadOTACounters(reader *card.Reader) ([]OTACounter, error)
+}
+
+// AuthKeyFileProvider is implemented by drivers advertising CapAuthKeyFile
+type AuthKeyFileProvider interface {
+	ReadAuthKeyFile(reader *card.Reader) (*AuthKeyFile, error)
+	WriteAuthKeyFile(reader *card.Reader, f *AuthKeyFile) error
+}
+
+// SQNConfigProvider is implemented by drivers advertising CapSQNConfig
+type SQNConfigProvider interface {
+	ReadSQNConfig(reader *card.Reader) (*SQNConfig, error)
+	WriteSQNConfig(reader *card.Reader, c *SQNConfig) error
+}
+
+// OTAKeyProvider is implemented by drivers advertising CapOTAKeys
+type OTAKeyProvider interface {
+	ReadOTAKeys(reader *card.Reader) ([]OTAKeyConfig, error)
+	WriteOTAKey(reader *card.Reader, k OTAKeyConfig) error // Replaces the key with the same KVN and type, or fills a free record
+}
+
+// KiReader is implemented by drivers advertising CapReadKi. Use ReadKi, which keeps the
+// key out of traces and fixtures.
+type KiReader interface {
+	ReadKi(reader *card.Reader) ([]byte, error)
+}
+
+// AlgorithmParamsReader is implemented by drivers advertising CapAlgorithmParams
+type AlgorithmParamsReader interface {
+	AlgorithmParams(reader *card.Reader) (string, error) // Algorithm with key length, Keccak count, ... as stored on the card
+}
+
+// CardTypeSelector is implemented by drivers that can be chosen with the "card_type"
+// selector of the programmable config section
+type CardTypeSelector interface {
+	CardType() string                // card_type of the identified card ("" if not identified)
+	SelectCardType(name string) bool // Configures the driver for card_type name; false if not handled
+}
+
+// SWTableProvider is implemented by drivers whose cards return vendor-specific status words
+type SWTableProvider interface {
+	SWTable() []card.SWEntry
+}
+
+// InstallVendorSWTable makes card.DecodeSW use the status word table of drv
+// (or only the standard table if drv is nil or has none)
+func InstallVendorSWTable(drv ProgrammableDriver) {
+	if p, ok := drv.(SWTableProvider); ok {
+		card.SetVendorSWTable(drv.Name(), p.SWTable())
+		return
+	}
+	card.SetVendorSWTable("", nil)
+}
+
+// HasCapability reports whether the driver advertises the given capability
+func HasCapability(drv ProgrammableDriver, c DriverCapability) bool {
+	cp, ok := drv.(CapabilityProvider)
+	if !ok {
+		return false
+	}
+	for _, have := range cp.Capabilities() {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
+
 var (
 	registeredDrivers []ProgrammableDriver
 	driversMu         sync.RWMutex
@@ -50,6 +145,30 @@ func FindDriver(reader *card.Reader) ProgrammableDriver {
 	return nil
 }
 
+// DriverByName returns the registered driver whose Name() is name, or nil
+func DriverByName(name string) ProgrammableDriver {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	for _, d := range registeredDrivers {
+		if d.Name() == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// DriverForCardType returns the driver handling card_type name (e.g. "sysmo-sja2"), or nil
+func DriverForCardType(name string) ProgrammableDriver {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	for _, d := range registeredDrivers {
+		if s, ok := d.(CardTypeSelector); ok && s.SelectCardType(name) {
+			return d
+		}
+	}
+	return nil
+}
+
 // ShowProgrammableCardInfo displays information about the programmable card
 func ShowProgrammableCardInfo(reader *card.Reader) string {
 	drv := FindDriver(reader)
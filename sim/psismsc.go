@@ -0,0 +1,145 @@
+package sim
+
+import (
+	"fmt"
+
+	"sim_reader/card"
+)
+
+// EF_PSISMSC holds the public service identity of the SM-SC used for SMS over IP
+// (TS 31.102). Profiles put it in DF_TELECOM; older cards have it in ADF_USIM only.
+var (
+	FID_DF_TELECOM = []byte{0x7F, 0x10}
+	FID_EF_PSISMSC = []byte{0x6F, 0xE5}
+)
+
+// Locations reported in USIMData.PSISMSCSource
+const (
+	PSISMSCInTelecom = "DF_TELECOM"
+	PSISMSCInUSIM    = "ADF_USIM"
+)
+
+// DecodePSISMSC decodes the SM-SC URI (TLV tag 80)
+func DecodePSISMSC(data []byte) string {
+	return decodeTLVString(data)
+}
+
+// EncodePSISMSC encodes the SM-SC URI as TLV tag 80 padded with FF to fileSize
+func EncodePSISMSC(uri string, fileSize int) ([]byte, error) {
+	tlv := EncodeTLVString(uri)
+	if len(tlv) > fileSize {
+		return nil, fmt.Errorf("PSI SMSC %q needs %d bytes, EF_PSISMSC has %d", uri, len(tlv), fileSize)
+	}
+	data := make([]byte, fileSize)
+	for i := range data {
+		data[i] = 0xFF
+	}
+	copy(data, tlv)
+	return data, nil
+}
+
+// selectDFTelecom selects DF_TELECOM under the MF
+func selectDFTelecom(reader *card.Reader) bool {
+	if UseGSMCommands {
+		reader.SelectGSM([]byte{0x3F, 0x00})
+		resp, err := reader.SelectGSM(FID_DF_TELECOM)
+		return err == nil && resp.IsOK()
+	}
+	reader.Select([]byte{0x3F, 0x00})
+	resp, err := reader.SelectDF(FID_DF_TELECOM)
+	return err == nil && resp.IsOK()
+}
+
+// readTelecomPSISMSC reads EF_PSISMSC in DF_TELECOM; ReadUSIM calls it before selecting
+// the USIM so that the USIM stays selected afterwards
+func readTelecomPSISMSC(reader *card.Reader) ([]byte, EFStatus) {
+	if !selectDFTelecom(reader) {
+		return nil, EFStatus{State: EFAbsent}
+	}
+	return readEFStatus(reader, 0x6FE5)
+}
+
+// setPSISMSC records EF_PSISMSC read from DF_TELECOM, or reads it from ADF_USIM (selected)
+// when DF_TELECOM has none
+func (u *USIMData) setPSISMSC(reader *card.Reader, raw []byte, st EFStatus) {
+	source := PSISMSCInTelecom
+	if st.State != EFPresent {
+		if uRaw, uSt := readEFStatus(reader, 0x6FE5); uSt.State == EFPresent || st.State == EFAbsent {
+			raw, st, source = uRaw, uSt, PSISMSCInUSIM
+		}
+	}
+	u.Files["EF_PSISMSC"] = st
+	if st.State != EFPresent {
+		return
+	}
+
+	u.RawFiles["EF_PSISMSC"] = raw
+	u.PSISMSC = DecodePSISMSC(raw)
+	if u.PSISMSC != "" {
+		u.PSISMSCSource = source
+	}
+}
+
+// psismscServiceWarning returns a warning when the SM-SC URI is set but SM over IP is
+// disabled in the UST, so the UE will not use it
+func (u *USIMData) psismscServiceWarning() string {
+	if u.PSISMSC == "" || u.UST == nil || u.HasSMSOverIP() {
+		return ""
+	}
+	return fmt.Sprintf("EF_PSISMSC is set (%s) but SMS over IP (UST service %d) is disabled", u.PSISMSC, UST_SMS_OVER_IP)
+}
+
+// selectPSISMSC selects EF_PSISMSC for writing: DF_TELECOM first, then ADF_USIM
+func selectPSISMSC(reader *card.Reader) (*card.APDUResponse, error) {
+	if selectDFTelecom(reader) {
+		if resp, err := reader.Select(FID_EF_PSISMSC); err == nil && resp.IsOK() {
+			return resp, nil
+		}
+	}
+
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return nil, fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+	resp, err = reader.Select(FID_EF_PSISMSC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select EF_PSISMSC: %w", err)
+	}
+	if !resp.IsOK() {
+		return nil, fmt.Errorf("EF_PSISMSC not found in DF_TELECOM or ADF_USIM: %s", resp.SWString())
+	}
+	return resp, nil
+}
+
+// WritePSISMSC writes the public service identity of the SM-SC (e.g. tel:+79990000000
+// or sip:smsc@ims.example.org). The URI must fit the file size from the FCP.
+func WritePSISMSC(reader *card.Reader, uri string) error {
+	if uri == "" {
+		return fmt.Errorf("empty PSI SMSC")
+	}
+	resp, err := selectPSISMSC(reader)
+	if err != nil {
+		return err
+	}
+
+	fileSize := parseFCPFileSize(resp.Data)
+	if fileSize == 0 {
+		return fmt.Errorf("EF_PSISMSC size not found in FCP")
+	}
+	data, err := EncodePSISMSC(uri, fileSize)
+	if err != nil {
+		return err
+	}
+
+	resp, err = reader.UpdateBinary(0, data)
+	if err != nil {
+		return fmt.Errorf("failed to write EF_PSISMSC: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("EF_PSISMSC write failed: %s", resp.SWString())
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package sim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ EF_PSISMSC TESTS ============
+
+func TestEncodePSISMSC(t *testing.T) {
+	tests := []struct {
+		name     string
+		uri      string
+		fileSize int
+		wantErr  bool
+	}{
+		{"tel uri", "tel:+79990000000", 24, false},
+		{"exact fit", "tel:+79990000000", 18, false},
+		{"too long", "sip:smsc@ims.mnc001.mcc001.3gppnetwork.org", 24, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := EncodePSISMSC(tc.uri, tc.fileSize)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("EncodePSISMSC() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(data) != tc.fileSize || data[0] != 0x80 || int(data[1]) != len(tc.uri) {
+				t.Errorf("EncodePSISMSC() = %X", data)
+			}
+			if got := DecodePSISMSC(data); got != tc.uri {
+				t.Errorf("DecodePSISMSC() = %q, want %q", got, tc.uri)
+			}
+		})
+	}
+}
+
+// newPSISMSCTestCard returns a card with EF_PSISMSC in DF_TELECOM and/or ADF_USIM and
+// the given UST
+func newPSISMSCTestCard(telecom, usim string, ust []byte) (*card.Reader, *card.MockFile, *card.MockFile) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	var telecomEF, usimEF *card.MockFile
+	if telecom != "" {
+		data, _ := EncodePSISMSC(telecom, 32)
+		telecomEF = m.MF().AddDF(0x7F10).AddEF(0x6FE5, data)
+	}
+	adf := m.AddADF(AID_USIM)
+	adf.AddEF(0x6F38, ust)
+	if usim != "" {
+		data, _ := EncodePSISMSC(usim, 32)
+		usimEF = adf.AddEF(0x6FE5, data)
+	}
+	return card.NewReaderWithTransport("Mock", m.ATR, m), telecomEF, usimEF
+}
+
+func TestReadUSIM_PSISMSC(t *testing.T) {
+	smsOverIP := make([]byte, 14)
+	smsOverIP[(UST_SMS_OVER_IP-1)/8] = 1 << ((UST_SMS_OVER_IP - 1) % 8)
+
+	tests := []struct {
+		name        string
+		telecom     string
+		usim        string
+		ust         []byte
+		wantURI     string
+		wantSource  string
+		wantWarning bool
+	}{
+		{"telecom", "tel:+79990000000", "tel:+70000000000", smsOverIP, "tel:+79990000000", PSISMSCInTelecom, false},
+		{"usim fallback", "", "tel:+70000000000", smsOverIP, "tel:+70000000000", PSISMSCInUSIM, false},
+		{"service disabled", "tel:+79990000000", "", make([]byte, 14), "tel:+79990000000", PSISMSCInTelecom, true},
+		{"absent", "", "", make([]byte, 14), "", "", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reader, _, _ := newPSISMSCTestCard(tc.telecom, tc.usim, tc.ust)
+			data, err := ReadUSIM(reader)
+			if err != nil {
+				t.Fatalf("ReadUSIM() error = %v", err)
+			}
+			if data.PSISMSC != tc.wantURI || data.PSISMSCSource != tc.wantSource {
+				t.Errorf("PSISMSC = %q (%s), want %q (%s)", data.PSISMSC, data.PSISMSCSource, tc.wantURI, tc.wantSource)
+			}
+			warned := false
+			for _, w := range data.Warnings {
+				warned = warned || strings.Contains(w, "EF_PSISMSC")
+			}
+			if warned != tc.wantWarning {
+				t.Errorf("warnings = %v, want PSISMSC warning %v", data.Warnings, tc.wantWarning)
+			}
+			if !tc.wantWarning && data.UST == nil {
+				t.Error("UST not read: USIM no longer selected after DF_TELECOM")
+			}
+		})
+	}
+}
+
+func TestWritePSISMSC(t *testing.T) {
+	reader, telecomEF, _ := newPSISMSCTestCard("tel:+70000000000", "", make([]byte, 14))
+
+	if err := WritePSISMSC(reader, "sip:smsc@ims.example.org"); err != nil {
+		t.Fatalf("WritePSISMSC() error = %v", err)
+	}
+	want, _ := EncodePSISMSC("sip:smsc@ims.example.org", 32)
+	if !bytes.Equal(telecomEF.Data, want) {
+		t.Errorf("EF_PSISMSC = %X, want %X", telecomEF.Data, want)
+	}
+
+	before := append([]byte(nil), telecomEF.Data...)
+	err := WritePSISMSC(reader, "sip:"+strings.Repeat("x", 40)+"@ims.example.org")
+	if err == nil || !strings.Contains(err.Error(), "EF_PSISMSC has 32") {
+		t.Fatalf("WritePSISMSC() error = %v, want size error", err)
+	}
+	if !bytes.Equal(telecomEF.Data, before) {
+		t.Error("EF_PSISMSC changed by an oversized URI")
+	}
+}
+
+func TestWritePSISMSC_USIMFallback(t *testing.T) {
+	reader, _, usimEF := newPSISMSCTestCard("", "tel:+70000000000", make([]byte, 14))
+
+	if err := WritePSISMSC(reader, "tel:+79990000000"); err != nil {
+		t.Fatalf("WritePSISMSC() error = %v", err)
+	}
+	if got := DecodePSISMSC(usimEF.Data); got != "tel:+79990000000" {
+		t.Errorf("ADF_USIM EF_PSISMSC = %q", got)
+	}
+}
@@ -0,0 +1,129 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ READ-ONLY GUARD TESTS ============
+
+// newReadOnlyTestCard returns a card holding every file a write helper touches
+func newReadOnlyTestCard() (*card.Reader, *card.MockCard) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	ff := func(n int) []byte { return bytes.Repeat([]byte{0xFF}, n) }
+
+	usimRec, _ := EncodeEFDIRRecord(AID_USIM, "USIM", 32)
+	m.MF().AddRecordEF(0x2F00, usimRec, ff(32))
+	m.MF().AddEF(0x2FE2, []byte{0x98, 0x10, 0x14, 0x30, 0x00, 0x00, 0x00, 0x00, 0x00, 0xF0})
+	telecom := m.MF().AddDF(0x7F10)
+	psi, _ := EncodePSISMSC("tel:+1555", 32)
+	telecom.AddEF(0x6FE5, psi)
+
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, []byte{0x08, 0x29, 0x05, 0x88, 0x00, 0x00, 0x00, 0x00, 0x10})
+	usim.AddEF(0x6FAD, []byte{0x00, 0x00, 0x00, 0x02})
+	usim.AddEF(0x6F46, ff(17))
+	usim.AddEF(0x6F38, make([]byte, 16))
+	usim.AddEF(0x6F62, ff(10))
+	usim.AddEF(0x6F60, ff(10))
+	usim.AddEF(0x6F61, ff(10))
+	usim.AddEF(0x6F7B, ff(12))
+	usim.AddEF(0x6F78, []byte{0x00, 0x01})
+	usim.AddRecordEF(0x6F40, ff(30))
+	usim.AddEF(0x6FE5, psi)
+	usim.AddEF(0x6F08, append([]byte{0x01}, bytes.Repeat([]byte{0xAB}, 32)...))
+	usim.AddEF(0x6F09, append([]byte{0x01}, bytes.Repeat([]byte{0xCD}, 32)...))
+	usim.AddCyclicEF(0x6F39, []byte{0x00, 0x00, 0x10})
+	usim.AddEF(0x6F37, []byte{0x00, 0x01, 0xF4})
+
+	isim := m.AddADF(AID_ISIM)
+	isim.AddEF(0x6F02, ff(64))
+	isim.AddEF(0x6F03, ff(64))
+	isim.AddRecordEF(0x6F04, ff(64), ff(64))
+	isim.AddRecordEF(0x6F09, ff(64))
+	isim.AddEF(0x6F07, make([]byte, 2))
+
+	m.Keys[card.PIN_PIN2] = []byte{'1', '2', '3', '4', 0xFF, 0xFF, 0xFF, 0xFF}
+	m.Keys[card.PIN_ADM1] = []byte("88888888")
+	return card.NewReaderWithTransport("Mock", m.ATR, m), m
+}
+
+func TestReadOnly_BlocksWritePaths(t *testing.T) {
+	writes := []struct {
+		name string
+		fn   func(r *card.Reader) error
+	}{
+		{"WriteIMSI", func(r *card.Reader) error { return WriteIMSI(r, "001010000000001") }},
+		{"WriteSPN", func(r *card.Reader) error { return WriteSPN(r, "Test", 0) }},
+		{"ClearForbiddenPLMN", ClearForbiddenPLMN},
+		{"WriteFPLMN", func(r *card.Reader) error { return WriteFPLMN(r, []PLMN{{MCC: "001", MNC: "01"}}) }},
+		{"EnableVoLTE", EnableVoLTE},
+		{"DisableVoWiFi", func(r *card.Reader) error { EnableVoWiFi(r); return DisableVoWiFi(r) }},
+		{"UpdateMNCLength", func(r *card.Reader) error { return UpdateMNCLength(r, 3) }},
+		{"WriteHPLMN", func(r *card.Reader) error { return WriteHPLMN(r, "001", "01", 0x4000) }},
+		{"WriteUserPLMN", func(r *card.Reader) error { return WriteUserPLMN(r, "001", "01", 0x4000) }},
+		{"WriteOPLMN", func(r *card.Reader) error { return WriteOPLMN(r, "001", "01", 0x4000) }},
+		{"SetOperationMode", func(r *card.Reader) error { return SetOperationMode(r, 0x80) }},
+		{"WritePSISMSC", func(r *card.Reader) error { return WritePSISMSC(r, "tel:+1666") }},
+		{"WriteIMPI", func(r *card.Reader) error { return WriteIMPI(r, "user@ims") }},
+		{"WriteIMPU", func(r *card.Reader) error { return WriteIMPU(r, []string{"sip:user@ims"}) }},
+		{"ClearIMPU", ClearIMPU},
+		{"WriteDomain", func(r *card.Reader) error { return WriteDomain(r, "ims") }},
+		{"WritePCSCF", func(r *card.Reader) error { return WritePCSCF(r, "pcscf.ims") }},
+		{"EnableISIMSMSOverIP", EnableISIMSMSOverIP},
+		{"AddEFDIREntry", func(r *card.Reader) error {
+			_, err := AddEFDIREntry(r, AID_ISIM, "ISIM")
+			return err
+		}},
+		{"RemoveEFDIREntry", func(r *card.Reader) error {
+			_, err := RemoveEFDIREntry(r, AID_USIM)
+			return err
+		}},
+		{"ResetACM", ResetACM},
+		{"WriteACMmax", func(r *card.Reader) error { return WriteACMmax(r, 100) }},
+		{"WriteMSISDNGeneric", func(r *card.Reader) error { return WriteMSISDNGeneric(r, "+15551234") }},
+		{"WriteACCGeneric", func(r *card.Reader) error { return WriteACCGeneric(r, "0001") }},
+		{"WriteICCIDGeneric", func(r *card.Reader) error { return WriteICCIDGeneric(r, "89011030000000000001") }},
+		{"ChangeADM1", func(r *card.Reader) error { return r.ChangeADM1([]byte("88888888"), []byte("11111111")) }},
+		{"ApplyConfig", func(r *card.Reader) error {
+			_, err := ApplyConfig(r, &SIMConfig{IMSI: "001010000000002", SPN: "RO"}, false, false)
+			return err
+		}},
+	}
+
+	for _, w := range writes {
+		t.Run(w.name, func(t *testing.T) {
+			reader, m := newReadOnlyTestCard()
+			SetPIN2("1234")
+			defer SetPIN2("")
+			reader.SetReadOnly(true)
+
+			err := w.fn(reader)
+			// ApplyConfig joins the errors of its steps into one message
+			if err == nil || !errors.Is(err, card.ErrReadOnly) && !strings.Contains(err.Error(), card.ErrReadOnly.Error()) {
+				t.Errorf("%s error = %v, want ErrReadOnly", w.name, err)
+			}
+			for _, apdu := range m.Log {
+				switch apdu[1] {
+				case card.INS_UPDATE_BINARY, card.INS_UPDATE_RECORD, 0x24, 0x2C, 0xDA, 0xE2:
+					t.Errorf("%s sent %X in read-only mode", w.name, apdu)
+				}
+			}
+		})
+	}
+}
+
+func TestReadOnly_InvalidateSecurityContexts(t *testing.T) {
+	reader, m := newReadOnlyTestCard()
+	reader.SetReadOnly(true)
+	InvalidateSecurityContexts(reader)
+	for _, apdu := range m.Log {
+		if apdu[1] == card.INS_UPDATE_BINARY {
+			t.Errorf("InvalidateSecurityContexts sent %X in read-only mode", apdu)
+		}
+	}
+}
@@ -5,36 +5,70 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sim_reader/card"
 	"strings"
+	"time"
 )
 
 // ScriptResult represents the result of a single APDU command
 type ScriptResult struct {
-	LineNum  int
-	Command  string
-	APDU     string
-	Response string
-	SW       string
-	Success  bool
-	Error    string
+	LineNum   int     `json:"line"`
+	File      string  `json:"file"`              // Script of the line, relative to the top-level script's directory
+	Comment   string  `json:"comment,omitempty"` // Comment lines directly above the command
+	Command   string  `json:"command"`
+	APDU      string  `json:"sent"`
+	Response  string  `json:"received"`
+	SW        string  `json:"sw"`
+	ElapsedMS float64 `json:"elapsed_ms"`
+	Success   bool    `json:"success"`
+	Error     string  `json:"error,omitempty"`
 }
 
 // RunScript executes APDU commands from a script file
 // Supports:
-//   - Lines starting with # are comments
+//   - Lines starting with # are comments, text after # on a command line is ignored
 //   - Lines starting with "apdu " followed by hex APDU
+//   - "include <file>" runs another script (path relative to the including script)
 //   - Empty lines are ignored
 func RunScript(reader *card.Reader, filename string) ([]ScriptResult, error) {
+	r := &scriptRunner{reader: reader, baseDir: filepath.Dir(filename)}
+	err := r.run(filename, nil)
+	return r.results, err
+}
+
+// scriptRunner collects the results of a script and the scripts it includes
+type scriptRunner struct {
+	reader  *card.Reader
+	baseDir string
+	results []ScriptResult
+}
+
+func (r *scriptRunner) run(filename string, stack []string) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		abs = filename
+	}
+	for _, f := range stack {
+		if f == abs {
+			return fmt.Errorf("include cycle: %s includes itself", filename)
+		}
+	}
+
 	file, err := os.Open(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open script file: %w", err)
+		return fmt.Errorf("failed to open script file: %w", err)
 	}
 	defer file.Close()
 
-	var results []ScriptResult
+	name := filename
+	if rel, err := filepath.Rel(r.baseDir, filename); err == nil {
+		name = filepath.ToSlash(rel)
+	}
+
 	scanner := bufio.NewScanner(file)
 	lineNum := 0
+	var comment []string
 
 	for scanner.Scan() {
 		lineNum++
@@ -42,48 +76,66 @@ func RunScript(reader *card.Reader, filename string) ([]ScriptResult, error) {
 
 		// Skip empty lines
 		if line == "" {
+			comment = nil
 			continue
 		}
 
-		// Skip comments
+		// Comments are kept for the command that follows them
 		if strings.HasPrefix(line, "#") {
+			comment = append(comment, strings.TrimSpace(line[1:]))
 			continue
 		}
-
-		// Parse APDU command
-		if strings.HasPrefix(strings.ToLower(line), "apdu ") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		lower := strings.ToLower(line)
+
+		switch {
+		case strings.HasPrefix(lower, "include "):
+			path := strings.TrimSpace(line[8:])
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(filename), path)
+			}
+			if err := r.run(path, append(stack, abs)); err != nil {
+				return fmt.Errorf("%s:%d: %w", name, lineNum, err)
+			}
+		case strings.HasPrefix(lower, "apdu "):
 			apduHex := strings.TrimSpace(line[5:])
-			result := executeAPDU(reader, lineNum, line, apduHex)
-			results = append(results, result)
-		} else {
+			result := executeAPDU(r.reader, lineNum, line, apduHex)
+			result.File = name
+			result.Comment = strings.Join(comment, " ")
+			r.results = append(r.results, result)
+		default:
 			// Unknown command
-			results = append(results, ScriptResult{
+			r.results = append(r.results, ScriptResult{
 				LineNum: lineNum,
+				File:    name,
 				Command: line,
 				Success: false,
-				Error:   "Unknown command (expected 'apdu <hex>')",
+				Error:   "Unknown command (expected 'apdu <hex>' or 'include <file>')",
 			})
 		}
+		comment = nil
 	}
 
 	if err := scanner.Err(); err != nil {
-		return results, fmt.Errorf("error reading script: %w", err)
+		return fmt.Errorf("error reading script: %w", err)
 	}
 
-	return results, nil
+	return nil
 }
 
 // executeAPDU executes a single APDU command
 func executeAPDU(reader *card.Reader, lineNum int, command, apduHex string) ScriptResult {
+	// Remove spaces from hex string
+	apduHex = strings.ToUpper(strings.ReplaceAll(apduHex, " ", ""))
+
 	result := ScriptResult{
 		LineNum: lineNum,
 		Command: command,
 		APDU:    apduHex,
 	}
 
-	// Remove spaces from hex string
-	apduHex = strings.ReplaceAll(apduHex, " ", "")
-
 	// Decode hex
 	apduBytes, err := hex.DecodeString(apduHex)
 	if err != nil {
@@ -99,6 +151,7 @@ func executeAPDU(reader *card.Reader, lineNum int, command, apduHex string) Scri
 	}
 
 	// Send APDU
+	start := time.Now()
 	resp, err := reader.SendAPDU(apduBytes)
 	if err != nil {
 		result.Success = false
@@ -106,20 +159,14 @@ func executeAPDU(reader *card.Reader, lineNum int, command, apduHex string) Scri
 		return result
 	}
 
-	// Handle GET RESPONSE if needed (SW1=61)
-	if resp.HasMoreData() {
-		getResp, err := reader.GetResponse(resp.SW2)
-		if err == nil {
-			resp = getResp
-		}
-	}
+	result.ElapsedMS = float64(time.Since(start).Microseconds()) / 1000
 
 	result.Response = fmt.Sprintf("%X", resp.Data)
 	result.SW = fmt.Sprintf("%04X", resp.SW())
 	result.Success = resp.IsOK()
 
 	if !result.Success {
-		result.Error = card.SWToString(resp.SW())
+		result.Error = resp.SWString()
 	}
 
 	return result
@@ -146,14 +193,6 @@ func RunAPDUInteractive(reader *card.Reader, apduHex string) (*card.APDUResponse
 		return nil, fmt.Errorf("transmit error: %w", err)
 	}
 
-	// Handle GET RESPONSE if needed
-	if resp.HasMoreData() {
-		getResp, err := reader.GetResponse(resp.SW2)
-		if err == nil {
-			resp = getResp
-		}
-	}
-
 	return resp, nil
 }
 
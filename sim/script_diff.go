@@ -0,0 +1,171 @@
+package sim
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ScriptRun is a saved simple script run (script run --script-output)
+type ScriptRun struct {
+	Script  string         `json:"script"`
+	ATR     string         `json:"atr,omitempty"`
+	Created string         `json:"created"`
+	Results []ScriptResult `json:"results"`
+}
+
+// SaveScriptRun writes a script run as JSON
+func SaveScriptRun(path string, run *ScriptRun) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// LoadScriptRun reads a script run saved with SaveScriptRun
+func LoadScriptRun(path string) (*ScriptRun, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var run ScriptRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("invalid script results %s: %w", path, err)
+	}
+	return &run, nil
+}
+
+// Script diff kinds
+const (
+	ScriptDiffSW      = "sw"      // Status word (or transmit error) changed
+	ScriptDiffData    = "data"    // Response data changed
+	ScriptDiffCommand = "command" // Line sends a different APDU (script changed between runs)
+	ScriptDiffAdded   = "added"   // Line only in the new run
+	ScriptDiffRemoved = "removed" // Line only in the old run
+)
+
+// ScriptDiff is one difference between two runs of a script
+type ScriptDiff struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Kind    string `json:"kind"`
+	Command string `json:"command"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+	HexDiff string `json:"hex_diff,omitempty"` // Differing byte ranges of the response data
+}
+
+// scriptResultKeys identifies each line across runs; a file included twice gives
+// the same file:line twice, so the occurrence is part of the key
+func scriptResultKeys(results []ScriptResult) []string {
+	seen := make(map[string]int)
+	keys := make([]string, len(results))
+	for i, r := range results {
+		k := fmt.Sprintf("%s:%d", r.File, r.LineNum)
+		seen[k]++
+		keys[i] = fmt.Sprintf("%s#%d", k, seen[k])
+	}
+	return keys
+}
+
+// scriptOutcome is the SW of a result, or its error if nothing was received
+func scriptOutcome(r ScriptResult) string {
+	if r.SW == "" && r.Error != "" {
+		return "error: " + r.Error
+	}
+	return r.SW
+}
+
+// DiffScriptRuns compares two runs of the same script line by line (file and line number)
+// and reports changed status words, changed response data and lines present in one run only
+func DiffScriptRuns(a, b []ScriptResult) []ScriptDiff {
+	keysA, keysB := scriptResultKeys(a), scriptResultKeys(b)
+	indexB := make(map[string]int, len(b))
+	for i, k := range keysB {
+		indexB[k] = i
+	}
+
+	var diffs []ScriptDiff
+	matched := make(map[int]bool)
+	for i, ra := range a {
+		j, ok := indexB[keysA[i]]
+		if !ok {
+			diffs = append(diffs, ScriptDiff{File: ra.File, Line: ra.LineNum, Kind: ScriptDiffRemoved, Command: ra.Command, Old: scriptOutcome(ra)})
+			continue
+		}
+		matched[j] = true
+		rb := b[j]
+		d := ScriptDiff{File: ra.File, Line: ra.LineNum, Command: rb.Command}
+
+		if !strings.EqualFold(ra.APDU, rb.APDU) {
+			d.Kind, d.Old, d.New = ScriptDiffCommand, ra.APDU, rb.APDU
+			diffs = append(diffs, d)
+			continue
+		}
+		if oa, ob := scriptOutcome(ra), scriptOutcome(rb); oa != ob {
+			d.Kind, d.Old, d.New = ScriptDiffSW, oa, ob
+			diffs = append(diffs, d)
+		}
+		if !strings.EqualFold(ra.Response, rb.Response) {
+			da, _ := hex.DecodeString(ra.Response)
+			db, _ := hex.DecodeString(rb.Response)
+			d.Kind, d.Old, d.New = ScriptDiffData, ra.Response, rb.Response
+			d.HexDiff = HexDiff(da, db)
+			diffs = append(diffs, d)
+		}
+	}
+	for j, rb := range b {
+		if !matched[j] {
+			diffs = append(diffs, ScriptDiff{File: rb.File, Line: rb.LineNum, Kind: ScriptDiffAdded, Command: rb.Command, New: scriptOutcome(rb)})
+		}
+	}
+	return diffs
+}
+
+// maxHexDiffRanges limits the ranges listed by HexDiff
+const maxHexDiffRanges = 8
+
+// HexDiff describes where b differs from a as byte ranges,
+// e.g. "[2] 01 -> 0A; [5..6] 0000 -> FFFF; length 16 -> 18 (+ 9000)"
+func HexDiff(a, b []byte) string {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+
+	var parts []string
+	ranges := 0
+	for i := 0; i < n; {
+		if a[i] == b[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < n && a[j] != b[j] {
+			j++
+		}
+		ranges++
+		if ranges <= maxHexDiffRanges {
+			pos := fmt.Sprintf("[%d]", i)
+			if j-i > 1 {
+				pos = fmt.Sprintf("[%d..%d]", i, j-1)
+			}
+			parts = append(parts, fmt.Sprintf("%s %X -> %X", pos, a[i:j], b[i:j]))
+		}
+		i = j
+	}
+	if ranges > maxHexDiffRanges {
+		parts = append(parts, fmt.Sprintf("... %d more range(s)", ranges-maxHexDiffRanges))
+	}
+
+	switch {
+	case len(b) > len(a):
+		parts = append(parts, fmt.Sprintf("length %d -> %d (+ %X)", len(a), len(b), b[n:]))
+	case len(a) > len(b):
+		parts = append(parts, fmt.Sprintf("length %d -> %d (- %X)", len(a), len(b), a[n:]))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,148 @@
+package sim
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ SCRIPT TESTS ============
+
+func writeScriptFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunScript_IncludesAndComments(t *testing.T) {
+	dir := writeScriptFiles(t, map[string]string{
+		"main.txt":     "# Select MF\napdu 00 a4 00 04 02 3F00  # inline\n\ninclude lib/read.txt\nbogus\n",
+		"lib/read.txt": "# EF_ICCID\n# via MF\napdu 00A40004022FE2\n",
+	})
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddEF(0x2FE2, []byte{0x98, 0x10})
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	results, err := RunScript(reader, filepath.Join(dir, "main.txt"))
+	if err != nil {
+		t.Fatalf("RunScript() error = %v", err)
+	}
+	want := []struct {
+		file    string
+		line    int
+		apdu    string
+		comment string
+	}{
+		{"main.txt", 2, "00A40004023F00", "Select MF"},
+		{"lib/read.txt", 3, "00A40004022FE2", "EF_ICCID via MF"},
+		{"main.txt", 5, "", ""},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("RunScript() = %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.File != w.file || r.LineNum != w.line || r.APDU != w.apdu || r.Comment != w.comment {
+			t.Errorf("result %d = %s:%d %q %q, want %s:%d %q %q", i, r.File, r.LineNum, r.APDU, r.Comment, w.file, w.line, w.apdu, w.comment)
+		}
+	}
+	if !results[0].Success || results[2].Success {
+		t.Errorf("success = %v/%v, want true/false", results[0].Success, results[2].Success)
+	}
+}
+
+func TestRunScript_IncludeCycle(t *testing.T) {
+	dir := writeScriptFiles(t, map[string]string{
+		"a.txt": "include b.txt\n",
+		"b.txt": "apdu 00A40004023F00\ninclude a.txt\n",
+	})
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	results, err := RunScript(reader, filepath.Join(dir, "a.txt"))
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("RunScript() error = %v, want include cycle", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("RunScript() = %d results before the cycle, want 1", len(results))
+	}
+}
+
+func TestDiffScriptRuns(t *testing.T) {
+	old := []ScriptResult{
+		{File: "main.txt", LineNum: 1, APDU: "00A40004023F00", SW: "9000"},
+		{File: "main.txt", LineNum: 2, APDU: "00B0000004", Response: "01020304", SW: "9000"},
+		{File: "main.txt", LineNum: 3, APDU: "80CA9F7F00", SW: "6D00"},
+		{File: "main.txt", LineNum: 4, APDU: "00B0000001", Response: "AA", SW: "9000"},
+	}
+	updated := []ScriptResult{
+		{File: "main.txt", LineNum: 1, APDU: "00A40004023F00", SW: "9000"},
+		{File: "main.txt", LineNum: 2, APDU: "00B0000004", Response: "01FF0304", SW: "9000"},
+		{File: "main.txt", LineNum: 3, APDU: "80CA9F7F00", Response: "9F7F02AABB", SW: "9000"},
+		{File: "main.txt", LineNum: 5, APDU: "00B0000001", Error: "Transmit error: timeout"},
+	}
+
+	diffs := DiffScriptRuns(old, updated)
+	want := []struct {
+		line int
+		kind string
+	}{
+		{2, ScriptDiffData},
+		{3, ScriptDiffSW},
+		{3, ScriptDiffData},
+		{4, ScriptDiffRemoved},
+		{5, ScriptDiffAdded},
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("DiffScriptRuns() = %+v, want %d diffs", diffs, len(want))
+	}
+	for i, w := range want {
+		if diffs[i].Line != w.line || diffs[i].Kind != w.kind {
+			t.Errorf("diff %d = line %d %s, want line %d %s", i, diffs[i].Line, diffs[i].Kind, w.line, w.kind)
+		}
+	}
+	if diffs[0].HexDiff != "[1] 02 -> FF" {
+		t.Errorf("HexDiff = %q", diffs[0].HexDiff)
+	}
+	if diffs[4].New != "error: Transmit error: timeout" {
+		t.Errorf("added line outcome = %q", diffs[4].New)
+	}
+
+	if d := DiffScriptRuns(old, old); len(d) != 0 {
+		t.Errorf("DiffScriptRuns() of identical runs = %+v", d)
+	}
+}
+
+func TestHexDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []byte
+		want string
+	}{
+		{"equal", []byte{1, 2}, []byte{1, 2}, ""},
+		{"one byte", []byte{1, 2, 3}, []byte{1, 9, 3}, "[1] 02 -> 09"},
+		{"range", []byte{0, 0, 0, 0}, []byte{0, 1, 1, 0}, "[1..2] 0000 -> 0101"},
+		{"longer", []byte{1}, []byte{1, 0x90, 0x00}, "length 1 -> 3 (+ 9000)"},
+		{"shorter", []byte{1, 2}, []byte{3}, "[0] 01 -> 03; length 2 -> 1 (- 02)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := HexDiff(tc.a, tc.b); got != tc.want {
+				t.Errorf("HexDiff() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
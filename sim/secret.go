@@ -0,0 +1,54 @@
+package sim
+
+import (
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// secretShownBytes is the number of bytes RedactSecret keeps at each end
+const secretShownBytes = 2
+
+// RedactSecret returns key material in hex with all but the first and last 2 bytes masked
+// (0011************************EEFF for a 16-byte key), enough to tell keys apart without
+// disclosing them. Keys of 4 bytes or less are masked entirely.
+func RedactSecret(b []byte) string {
+	h := fmt.Sprintf("%X", b)
+	if len(b) <= 2*secretShownBytes {
+		return strings.Repeat("*", len(h))
+	}
+	n := 2 * secretShownBytes
+	return h[:n] + strings.Repeat("*", len(h)-2*n) + h[len(h)-n:]
+}
+
+// FormatSecret returns key material in hex when reveal is set, redacted otherwise
+func FormatSecret(b []byte, reveal bool) string {
+	if reveal {
+		return fmt.Sprintf("%X", b)
+	}
+	return RedactSecret(b)
+}
+
+// ReadKi reads the subscriber key with a driver advertising CapReadKi. Only test cards
+// expose it, typically after ADM verification (ADM4 on some). The reads are done under
+// card.Reader.WithSecret: the trace records that Ki was accessed, not its value.
+func ReadKi(reader *card.Reader, drv ProgrammableDriver) ([]byte, error) {
+	if drv == nil {
+		return nil, fmt.Errorf("no programmable card driver for this card")
+	}
+	p, ok := drv.(KiReader)
+	if !ok || !HasCapability(drv, CapReadKi) {
+		return nil, fmt.Errorf("%s cannot read Ki", drv.Name())
+	}
+	var ki []byte
+	err := reader.WithSecret("Ki", func() error {
+		var err error
+		ki, err = p.ReadKi(reader)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ki, nil
+}
@@ -0,0 +1,64 @@
+package sim
+
+import (
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ SECRET DISPLAY TESTS ============
+
+func TestRedactSecret(t *testing.T) {
+	ki := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}
+	if got, want := RedactSecret(ki), "0011"+strings.Repeat("*", 24)+"EEFF"; got != want {
+		t.Errorf("RedactSecret() = %s, want %s", got, want)
+	}
+	if got := RedactSecret([]byte{1, 2, 3, 4}); got != "********" {
+		t.Errorf("RedactSecret(4 bytes) = %s, want fully masked", got)
+	}
+	if got := FormatSecret(ki, true); got != "00112233445566778899AABBCCDDEEFF" {
+		t.Errorf("FormatSecret(reveal) = %s", got)
+	}
+	if got := FormatSecret(ki, false); got != RedactSecret(ki) {
+		t.Errorf("FormatSecret() = %s, want redacted", got)
+	}
+}
+
+// kiTestDriver reads Ki from 6F01 of the MF, with or without advertising CapReadKi
+type kiTestDriver struct {
+	ProgrammableDriver
+	caps []DriverCapability
+}
+
+func (d *kiTestDriver) Name() string                     { return "Test driver" }
+func (d *kiTestDriver) Capabilities() []DriverCapability { return d.caps }
+func (d *kiTestDriver) ReadKi(reader *card.Reader) ([]byte, error) {
+	reader.Select([]byte{0x6F, 0x01})
+	resp, err := reader.ReadBinary(0, 16)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+func TestReadKi(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddEF(0x6F01, []byte("0123456789ABCDEF"))
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	if _, err := ReadKi(reader, nil); err == nil {
+		t.Error("ReadKi() without a driver should fail")
+	}
+	if _, err := ReadKi(reader, &kiTestDriver{}); err == nil || !strings.Contains(err.Error(), "cannot read Ki") {
+		t.Errorf("ReadKi() without read-ki = %v, want refusal", err)
+	}
+	if len(m.Log) != 0 {
+		t.Errorf("%d APDUs sent without the capability", len(m.Log))
+	}
+
+	ki, err := ReadKi(reader, &kiTestDriver{caps: []DriverCapability{CapReadKi}})
+	if err != nil || string(ki) != "0123456789ABCDEF" {
+		t.Errorf("ReadKi() = %q, %v", ki, err)
+	}
+}
@@ -0,0 +1,124 @@
+package sim
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// SMFiles lists the EFs always read with secure messaging (--sm-files). Other EFs use it
+// only after a plain READ was refused with 6982 and their EF_ARR rule asks for SM.
+var SMFiles map[uint16]bool
+
+// ParseSMFiles parses a comma-separated list of FIDs ("6F02,6F03")
+func ParseSMFiles(s string) (map[uint16]bool, error) {
+	files := make(map[uint16]bool)
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		b, err := hex.DecodeString(f)
+		if err != nil || len(b) != 2 {
+			return nil, fmt.Errorf("invalid file ID %q in --sm-files (expected 4 hex digits, e.g. 6F02)", f)
+		}
+		files[uint16(b[0])<<8|uint16(b[1])] = true
+	}
+	return files, nil
+}
+
+// readTransparent reads the selected transparent EF (fcp is its SELECT response),
+// switching to secure messaging for the files that need it
+func readTransparent(reader *card.Reader, fileID uint16, fcp []byte, fileSize int) ([]byte, error) {
+	if SMFiles[fileID] && reader.SecureMessaging() != nil {
+		return reader.ReadAllBinarySecure(fileSize)
+	}
+	data, err := reader.ReadAllBinary(fileSize)
+	if err != nil || len(data) > 0 || reader.LastSW() != card.SW_SECURITY_NOT_SATISFIED {
+		return data, err
+	}
+	if !arrRequiresSM(reader, fileID, fcp) {
+		return data, nil
+	}
+	if reader.SecureMessaging() == nil {
+		return nil, fmt.Errorf("read 0x%04X requires secure messaging: give the card keys with --sm-key-mac (and --sm-key-enc)", fileID)
+	}
+	return reader.ReadAllBinarySecure(fileSize)
+}
+
+// arrRequiresSM reports whether the EF_ARR rule of the file asks for secure messaging to
+// read it. The rule is read in the current ADF (or MF), after which the file is selected again.
+func arrRequiresSM(reader *card.Reader, fileID uint16, fcp []byte) bool {
+	if _, ok := fcpARRReference(fcp); !ok {
+		return false
+	}
+	var aid []byte
+	switch dir := reader.CurrentDF(); {
+	case dir == "3F00":
+	case strings.HasPrefix(dir, "ADF:") && !strings.Contains(dir, "/"):
+		var err error
+		if aid, err = hex.DecodeString(strings.TrimPrefix(dir, "ADF:")); err != nil {
+			return false
+		}
+	default:
+		// EF_ARR can only be read by selecting the application again
+		return false
+	}
+	rec, ok := newARRResolver(reader, aid).rule(fcp)
+	if _, st := selectEF(reader, fileID); st.State != EFPresent {
+		return false
+	}
+	return ok && arrRuleNeedsSM(rec.RawData, 0x01)
+}
+
+// arrRuleNeedsSM reports whether an EF_ARR record asks for secure messaging for the access
+// mode bit (01 = READ): a control reference template for SM (B4 cryptographic checksum,
+// B6 digital signature, B8 confidentiality) among the SC-DOs of that mode, also inside
+// an OR (A0) or AND (A7) template
+func arrRuleNeedsSM(rule []byte, mode byte) bool {
+	var accessMode byte
+	for idx := 0; idx+1 < len(rule) && rule[idx] != 0xFF; {
+		tag, length := rule[idx], int(rule[idx+1])
+		if idx+2+length > len(rule) {
+			break
+		}
+		value := rule[idx+2 : idx+2+length]
+		idx += 2 + length
+		switch tag {
+		case 0x80:
+			accessMode = 0
+			if length > 0 {
+				accessMode = value[0]
+			}
+		case 0x84:
+			accessMode = 0
+		default:
+			if accessMode&mode != 0 && scdoNeedsSM(tag, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scdoNeedsSM reports whether a security condition DO includes an SM template
+func scdoNeedsSM(tag byte, value []byte) bool {
+	switch tag {
+	case 0xB4, 0xB6, 0xB8:
+		return true
+	case 0xA0, 0xA7:
+		for idx := 0; idx+1 < len(value); {
+			t, l := value[idx], int(value[idx+1])
+			if idx+2+l > len(value) {
+				return false
+			}
+			if scdoNeedsSM(t, value[idx+2:idx+2+l]) {
+				return true
+			}
+			idx += 2 + l
+		}
+	}
+	return false
+}
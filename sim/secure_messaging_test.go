@@ -0,0 +1,132 @@
+package sim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ SECURE MESSAGING TESTS ============
+
+var testSMKeys = card.SMKeys{
+	Alg: card.SMAES128,
+	MAC: bytes.Repeat([]byte{0x4D}, 16),
+	ENC: bytes.Repeat([]byte{0x45}, 16),
+}
+
+// newSMTestCard builds an ISIM whose EF_IMPI and EF_DOMAIN can only be read with SM.
+// EF_IMPI says so in its EF_ARR rule (record 2: READ needs a CCT), EF_DOMAIN does not.
+func newSMTestCard(t *testing.T, withSession bool) (*card.Reader, *card.MockCard) {
+	t.Helper()
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	adf := m.AddADF(AID_ISIM)
+	adf.AddRecordEF(0x6F06,
+		[]byte{0x80, 0x01, 0x01, 0x90, 0x00, 0xFF, 0xFF, 0xFF},
+		[]byte{0x80, 0x01, 0x01, 0xB4, 0x03, 0x83, 0x01, 0x81})
+	impi := adf.AddEF(0x6F02, EncodeIMPI("001010000000001@ims.mnc001.mcc001.3gppnetwork.org", 64))
+	impi.ReadSM, impi.ARR = true, []byte{0x6F, 0x06, 0x02}
+	domain := adf.AddEF(0x6F03, EncodeDomain("ims.mnc001.mcc001.3gppnetwork.org", 48))
+	domain.ReadSM = true
+
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	if withSession {
+		var err error
+		if m.SM, err = card.NewSMSession(testSMKeys); err != nil {
+			t.Fatal(err)
+		}
+		s, _ := card.NewSMSession(testSMKeys)
+		reader.SetSecureMessaging(s)
+	}
+	return reader, m
+}
+
+func TestReadISIM_SecureMessagingFromARR(t *testing.T) {
+	defer resetISIMDetection()
+	reader, _ := newSMTestCard(t, true)
+
+	isim, err := ReadISIM(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isim.IMPI != "001010000000001@ims.mnc001.mcc001.3gppnetwork.org" {
+		t.Errorf("IMPI = %q", isim.IMPI)
+	}
+	// EF_DOMAIN has no rule asking for SM and is not listed in SMFiles
+	if isim.Domain != "" {
+		t.Errorf("Domain = %q, want it unread", isim.Domain)
+	}
+}
+
+func TestReadISIM_SecureMessagingForced(t *testing.T) {
+	defer resetISIMDetection()
+	SMFiles = map[uint16]bool{0x6F03: true}
+	defer func() { SMFiles = nil }()
+	reader, m := newSMTestCard(t, true)
+
+	isim, err := ReadISIM(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isim.Domain != "ims.mnc001.mcc001.3gppnetwork.org" {
+		t.Errorf("Domain = %q", isim.Domain)
+	}
+	// Forced files go straight to SM: no plain READ BINARY after selecting EF_DOMAIN
+	for i, apdu := range m.Log {
+		if apdu[1] == card.INS_SELECT && bytes.HasSuffix(apdu, []byte{0x6F, 0x03}) {
+			for _, next := range m.Log[i+1:] {
+				if next[0] == 0x00 && next[1] == card.INS_READ_BINARY {
+					t.Fatalf("plain READ BINARY %X sent for EF_DOMAIN", next)
+				}
+				if next[1] == card.INS_SELECT {
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestReadISIM_SecureMessagingWithoutKeys(t *testing.T) {
+	defer resetISIMDetection()
+	reader, _ := newSMTestCard(t, false)
+
+	isim, err := ReadISIM(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := isim.Files["EF_IMPI"]
+	if st.State != EFError || st.Err == nil || !strings.Contains(st.Err.Error(), "--sm-key-mac") {
+		t.Errorf("EF_IMPI status = %+v, want an error naming --sm-key-mac", st)
+	}
+}
+
+func TestParseSMFiles(t *testing.T) {
+	files, err := ParseSMFiles("6F02, 6f03")
+	if err != nil || len(files) != 2 || !files[0x6F02] || !files[0x6F03] {
+		t.Errorf("ParseSMFiles() = %v, %v", files, err)
+	}
+	if _, err := ParseSMFiles("6F0"); err == nil {
+		t.Error("ParseSMFiles(6F0) accepted")
+	}
+}
+
+func TestARRRuleNeedsSM(t *testing.T) {
+	tests := []struct {
+		rule []byte
+		want bool
+	}{
+		{[]byte{0x80, 0x01, 0x01, 0xB4, 0x00}, true},
+		{[]byte{0x80, 0x01, 0x01, 0xA0, 0x05, 0x90, 0x00, 0xB8, 0x01, 0x80}, true},
+		{[]byte{0x80, 0x01, 0x02, 0xB4, 0x00, 0x80, 0x01, 0x01, 0x90, 0x00}, false}, // SM for UPDATE only
+		{[]byte{0x80, 0x01, 0x01, 0xA4, 0x06, 0x83, 0x01, 0x01, 0x95, 0x01, 0x08}, false},
+	}
+	for _, tc := range tests {
+		if got := arrRuleNeedsSM(tc.rule, 0x01); got != tc.want {
+			t.Errorf("arrRuleNeedsSM(%X) = %v, want %v", tc.rule, got, tc.want)
+		}
+	}
+	if read, _ := parseARRRecord([]byte{0x80, 0x01, 0x01, 0xB4, 0x00}); read != "SM" {
+		t.Errorf("parseARRRecord(B4) read = %s, want SM", read)
+	}
+}
@@ -0,0 +1,72 @@
+package sim
+
+import (
+	"fmt"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ SELECT P2 FALLBACK TESTS ============
+
+// newSelectP2Card returns a card recorded from the batch that answers 6A86 to SELECT by AID
+// with P2=04 and only accepts P2=0C, with an ISD for GP selection
+func newSelectP2Card(t *testing.T) (*card.Reader, *card.MockCard) {
+	t.Helper()
+	imsi, _ := EncodeIMSI("001010123456789")
+	usim := fmt.Sprintf("%X", testUSIMFullAID)
+	fixture := &card.Fixture{
+		ATR:         "3B9F96801F878031E073FE211B674A4C753034054BA9",
+		SelectAIDP2: "0C",
+		Files: []card.FixtureFile{
+			{Path: "3F00/2F00", Records: []string{"61114F0C" + usim + "5001" + "55FFFFFFFF"}},
+			{App: usim, Path: "7FFF/6F07", Data: fmt.Sprintf("%X", imsi)},
+			{App: usim, Path: "7FFF/6FAD", Data: "00000002"},
+			{App: usim, Path: "7FFF/6F38", Data: "00001C"},
+		},
+	}
+	m, err := card.NewMockCardFromFixture(fixture)
+	if err != nil {
+		t.Fatalf("NewMockCardFromFixture() error = %v", err)
+	}
+	m.AddADF(GP_ISD_AID)
+	return card.NewReaderWithTransport("Mock", m.ATR, m), m
+}
+
+func TestReadUSIM_SelectP2Fallback(t *testing.T) {
+	defer resetAIDOverrides()
+	reader, _ := newSelectP2Card(t)
+
+	DetectApplicationAIDs(reader)
+	data, err := ReadUSIM(reader)
+	if err != nil {
+		t.Fatalf("ReadUSIM() error = %v, want USIM found with P2=0C", err)
+	}
+	if data.IMSI != "001010123456789" {
+		t.Errorf("IMSI = %q", data.IMSI)
+	}
+	if st := data.Files["EF_UST"]; st.State != EFPresent {
+		t.Errorf("EF_UST state = %d, want present (%+v)", st.State, st)
+	}
+	if p2, ok := reader.AIDSelectP2(); !ok || p2 != 0x0C {
+		t.Errorf("AIDSelectP2() = %02X, %v, want 0C", p2, ok)
+	}
+}
+
+func TestGPSelect_SelectP2Fallback(t *testing.T) {
+	reader, m := newSelectP2Card(t)
+
+	sw, err := GPSelectVerify(reader, GP_ISD_AID)
+	if err != nil || sw != card.SW_OK {
+		t.Fatalf("GPSelectVerify() = %04X, %v, want 9000", sw, err)
+	}
+
+	// The accepted option is used first for the next application
+	m.Log = nil
+	if _, err := SelectUSIMWithAuth(reader); err != nil {
+		t.Fatalf("SelectUSIMWithAuth() error = %v", err)
+	}
+	if len(m.Log) == 0 || m.Log[0][3] != 0x0C {
+		t.Errorf("first SELECT after GP = %X, want P2=0C", m.Log)
+	}
+}
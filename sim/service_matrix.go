@@ -0,0 +1,188 @@
+package sim
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ServiceState is the state of a service on one card of a ServiceMatrix
+type ServiceState string
+
+const (
+	ServiceEnabled  ServiceState = "enabled"
+	ServiceDisabled ServiceState = "disabled"
+	ServiceAbsent   ServiceState = "absent" // table missing or shorter than the service number
+)
+
+// ServiceMatrix compares the UST, EST and IST of a batch of cards
+type ServiceMatrix struct {
+	Cards []string           `json:"cards"` // column labels: ICCID suffix, else the file name
+	Files []string           `json:"files"` // export file of each card
+	Rows  []ServiceMatrixRow `json:"rows"`
+}
+
+// ServiceMatrixRow is one service across all cards of a ServiceMatrix
+type ServiceMatrixRow struct {
+	Table   string         `json:"table"` // UST, EST, IST
+	Number  int            `json:"number"`
+	Name    string         `json:"name"`
+	States  []ServiceState `json:"states"` // one per card, in the order of Cards
+	Differs bool           `json:"differs"`
+}
+
+// matrixTables are the service tables in matrix row order
+var matrixTables = []string{"UST", "EST", "IST"}
+
+// LoadServiceMatrix reads every JSON/YAML card export (read --json/--yaml) in dir and
+// builds the service matrix. Exports without service_tables fall back to the named flags
+// of their services section; every other service of such a card is absent.
+func LoadServiceMatrix(dir string) (*ServiceMatrix, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	var configs []*SIMConfig
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !(strings.EqualFold(filepath.Ext(name), ".json") || IsYAMLFile(name)) {
+			continue
+		}
+		config, err := LoadConfig(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		files = append(files, name)
+		configs = append(configs, config)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no .json/.yaml card exports in %s", dir)
+	}
+	return BuildServiceMatrix(files, configs), nil
+}
+
+// BuildServiceMatrix builds the matrix of the configs exported to files. Rows cover every
+// service present on at least one card, sorted by table and number.
+func BuildServiceMatrix(files []string, configs []*SIMConfig) *ServiceMatrix {
+	m := &ServiceMatrix{Files: files, Cards: serviceMatrixLabels(files, configs)}
+
+	states := make([]map[string]map[int]bool, len(configs))
+	for i, config := range configs {
+		states[i] = configServiceStates(config)
+	}
+
+	for _, table := range matrixTables {
+		seen := map[int]bool{}
+		for _, s := range states {
+			for num := range s[table] {
+				seen[num] = true
+			}
+		}
+		var nums []int
+		for num := range seen {
+			nums = append(nums, num)
+		}
+		sort.Ints(nums)
+
+		for _, num := range nums {
+			row := ServiceMatrixRow{Table: table, Number: num, Name: ServiceName(table, num)}
+			for _, s := range states {
+				state := ServiceAbsent
+				if enabled, ok := s[table][num]; ok {
+					state = ServiceDisabled
+					if enabled {
+						state = ServiceEnabled
+					}
+				}
+				if len(row.States) > 0 && state != row.States[0] {
+					row.Differs = true
+				}
+				row.States = append(row.States, state)
+			}
+			m.Rows = append(m.Rows, row)
+		}
+	}
+	return m
+}
+
+// Differing returns the number of rows whose state is not the same on all cards
+func (m *ServiceMatrix) Differing() int {
+	n := 0
+	for _, row := range m.Rows {
+		if row.Differs {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteCSV writes the matrix as CSV: table, number, name, differs, then one column per card
+func (m *ServiceMatrix) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"table", "number", "name", "differs"}, m.Cards...)); err != nil {
+		return err
+	}
+	for _, row := range m.Rows {
+		record := []string{row.Table, fmt.Sprint(row.Number), row.Name, fmt.Sprint(row.Differs)}
+		for _, state := range row.States {
+			record = append(record, string(state))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// configServiceStates returns the known state (true = enabled) of every service of a card
+// per table; services not in the map are absent
+func configServiceStates(config *SIMConfig) map[string]map[int]bool {
+	out := map[string]map[int]bool{}
+	if t := config.ServiceTables; t != nil {
+		for table, value := range map[string]string{"UST": t.UST, "EST": t.EST, "IST": t.IST} {
+			raw, err := hex.DecodeString(value)
+			if err != nil || len(raw) == 0 {
+				continue
+			}
+			enabled := DecodeUST(raw)
+			out[table] = map[int]bool{}
+			for num := 1; num <= len(raw)*8; num++ {
+				out[table][num] = enabled[num]
+			}
+		}
+		return out
+	}
+	if config.Services != nil {
+		out["UST"] = usimServiceFlags(config.Services)
+		out["IST"] = isimServiceFlags(config.Services)
+	}
+	return out
+}
+
+// serviceMatrixLabels names the card columns by the last 6 ICCID digits; cards without an
+// ICCID or with the same suffix as another card are named by their file
+func serviceMatrixLabels(files []string, configs []*SIMConfig) []string {
+	labels := make([]string, len(configs))
+	count := map[string]int{}
+	for i, config := range configs {
+		iccid := config.ICCID
+		if len(iccid) > 6 {
+			iccid = "…" + iccid[len(iccid)-6:]
+		}
+		labels[i] = iccid
+		count[iccid]++
+	}
+	for i, label := range labels {
+		if label == "" || count[label] > 1 {
+			labels[i] = strings.TrimSuffix(files[i], filepath.Ext(files[i]))
+		}
+	}
+	return labels
+}
@@ -0,0 +1,157 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ============ SERVICE MATRIX TESTS ============
+
+func TestBuildServiceMatrix(t *testing.T) {
+	on, off := true, false
+	configs := []*SIMConfig{
+		// UST 1 and 3 enabled, 2 disabled, 4-8 disabled
+		{ICCID: "89000000000000111111", ServiceTables: &ServiceTablesExport{UST: "05", IST: "01"}},
+		// UST 1-3 enabled
+		{ICCID: "89000000000000222222", ServiceTables: &ServiceTablesExport{UST: "07"}},
+		// Older export without raw tables: only the named flags are known
+		{Services: &ServicesConfig{GSMAccess: &on, VoLTE: &off}},
+	}
+	m := BuildServiceMatrix([]string{"a.json", "b.json", "old.yaml"}, configs)
+
+	wantCards := []string{"…111111", "…222222", "old"}
+	if strings.Join(m.Cards, ",") != strings.Join(wantCards, ",") {
+		t.Errorf("Cards = %v, want %v", m.Cards, wantCards)
+	}
+
+	rows := map[string]ServiceMatrixRow{}
+	for _, row := range m.Rows {
+		rows[fmt.Sprintf("%s:%d", row.Table, row.Number)] = row
+	}
+	check := func(key string, differs bool, states ...ServiceState) {
+		t.Helper()
+		row, ok := rows[key]
+		if !ok {
+			t.Fatalf("row %s missing", key)
+		}
+		if row.Differs != differs {
+			t.Errorf("%s Differs = %v, want %v", key, row.Differs, differs)
+		}
+		for i, state := range states {
+			if row.States[i] != state {
+				t.Errorf("%s card %d = %s, want %s", key, i, row.States[i], state)
+			}
+		}
+	}
+	check("UST:1", true, ServiceEnabled, ServiceEnabled, ServiceAbsent)
+	check("UST:2", true, ServiceDisabled, ServiceEnabled, ServiceAbsent)
+	check("UST:27", true, ServiceAbsent, ServiceAbsent, ServiceEnabled)
+	check("UST:87", true, ServiceAbsent, ServiceAbsent, ServiceDisabled)
+	check("IST:1", true, ServiceEnabled, ServiceAbsent, ServiceAbsent)
+
+	if _, ok := rows["EST:1"]; ok {
+		t.Errorf("EST row present although no card has an EST")
+	}
+	if rows["UST:1"].Name != ServiceName("UST", 1) {
+		t.Errorf("UST 1 name = %q", rows["UST:1"].Name)
+	}
+
+	// Rows are sorted by table, then number
+	for i := 1; i < len(m.Rows); i++ {
+		a, b := m.Rows[i-1], m.Rows[i]
+		if a.Table == b.Table && a.Number >= b.Number {
+			t.Errorf("rows out of order: %s %d before %d", a.Table, a.Number, b.Number)
+		}
+	}
+}
+
+func TestServiceMatrix_SameCards(t *testing.T) {
+	configs := []*SIMConfig{
+		{ICCID: "8900001", ServiceTables: &ServiceTablesExport{UST: "0F"}},
+		{ICCID: "8900002", ServiceTables: &ServiceTablesExport{UST: "0F"}},
+	}
+	m := BuildServiceMatrix([]string{"x.json", "y.json"}, configs)
+	if n := m.Differing(); n != 0 {
+		t.Errorf("Differing() = %d, want 0", n)
+	}
+	if len(m.Rows) != 8 {
+		t.Errorf("rows = %d, want 8", len(m.Rows))
+	}
+}
+
+func TestServiceMatrix_LabelCollision(t *testing.T) {
+	configs := []*SIMConfig{
+		{ICCID: "8900000000123456"},
+		{ICCID: "8911111111123456"},
+		{ICCID: "12345"},
+	}
+	got := serviceMatrixLabels([]string{"first.json", "second.yaml", "short.json"}, configs)
+	want := []string{"first", "second", "12345"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("labels = %v, want %v", got, want)
+	}
+}
+
+func TestServiceMatrix_WriteCSV(t *testing.T) {
+	configs := []*SIMConfig{
+		{ICCID: "1", ServiceTables: &ServiceTablesExport{UST: "01"}},
+		{ICCID: "2", ServiceTables: &ServiceTablesExport{UST: "03"}},
+	}
+	m := BuildServiceMatrix([]string{"1.json", "2.json"}, configs)
+
+	var buf bytes.Buffer
+	if err := m.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if lines[0] != "table,number,name,differs,1,2" {
+		t.Errorf("header = %q", lines[0])
+	}
+	if len(lines) != 9 {
+		t.Fatalf("lines = %d, want 9", len(lines))
+	}
+	if !strings.HasPrefix(lines[2], "UST,2,") || !strings.HasSuffix(lines[2], ",true,disabled,enabled") {
+		t.Errorf("UST 2 line = %q", lines[2])
+	}
+}
+
+func TestLoadServiceMatrix(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.json":    `{"iccid": "8900000000000000001", "service_tables": {"ust": "01"}}`,
+		"b.yaml":    "iccid: \"8900000000000000002\"\nservice_tables:\n  ust: \"03\"\n",
+		"notes.txt": "not an export",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := LoadServiceMatrix(dir)
+	if err != nil {
+		t.Fatalf("LoadServiceMatrix() error = %v", err)
+	}
+	if strings.Join(m.Files, ",") != "a.json,b.yaml" {
+		t.Errorf("Files = %v", m.Files)
+	}
+	if m.Differing() != 1 {
+		t.Errorf("Differing() = %d, want 1", m.Differing())
+	}
+
+	if _, err := LoadServiceMatrix(t.TempDir()); err == nil {
+		t.Errorf("empty directory accepted")
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"iccid": 1`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadServiceMatrix(dir); err == nil || !strings.Contains(err.Error(), "bad.json") {
+		t.Errorf("broken export: error = %v, want it named", err)
+	}
+}
@@ -0,0 +1,146 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sim_reader/card"
+)
+
+// Some writes (IMSI, service tables, PLMN lists) only reach the UE after a REFRESH, and
+// some cards keep answering the old content for a moment while they do their internal
+// housekeeping. A verification read right after the write then races with the card. The
+// settle step between writing and verifying sends STATUS, optionally simulates the REFRESH
+// with a warm reset and waits, and is configured per ApplyConfig operation.
+
+// SettlePolicy is the settle step of one operation
+type SettlePolicy struct {
+	Reset bool          // warm reset before verifying
+	Delay time.Duration // wait before verifying
+}
+
+// SettlePolicies maps report item names (see SettleOperations) to their policy.
+// Items without an entry need no settle step.
+type SettlePolicies map[string]SettlePolicy
+
+// SettleOperations maps the operation names of --post-write-ops to the report items that
+// write them: the ApplyConfig item and the EF name used by snapshot restore and card copy
+var SettleOperations = map[string][]string{
+	"imsi":  {"IMSI", "EF_IMSI"},
+	"ust":   {"USIM services", "EF_UST"},
+	"ist":   {"ISIM services", "EF_IST"},
+	"hplmn": {"HPLMN", "EF_HPLMNwACT"},
+	"oplmn": {"OPLMN", "EF_OPLMNwACT"},
+	"uplmn": {"User PLMN", "EF_PLMNwACT"},
+	"fplmn": {"Clear FPLMN", "EF_FPLMN"},
+	"ad":    {"MNC length", "Operation mode", "EF_AD"},
+	"spn":   {"SPN", "EF_SPN"},
+	"impi":  {"IMPI", "EF_IMPI"},
+}
+
+// DefaultSettleOperations are the operations that need a REFRESH to take effect
+var DefaultSettleOperations = []string{"imsi", "ust", "ist", "hplmn", "oplmn", "ad"}
+
+// NewSettlePolicies returns policy for every named operation ("none" selects none)
+func NewSettlePolicies(names []string, policy SettlePolicy) (SettlePolicies, error) {
+	policies := SettlePolicies{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "none" || name == "" {
+			continue
+		}
+		items, ok := SettleOperations[name]
+		if !ok {
+			known := make([]string, 0, len(SettleOperations))
+			for n := range SettleOperations {
+				known = append(known, n)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown operation %q (%s, none)", name, strings.Join(known, ", "))
+		}
+		for _, item := range items {
+			policies[item] = policy
+		}
+	}
+	return policies, nil
+}
+
+// Verification moments recorded in SettleResult
+const (
+	VerifiedPreReset  = "pre-reset"  // no reset: the card was verified as the UE sees it before a REFRESH
+	VerifiedPostReset = "post-reset" // verified after the warm reset
+)
+
+// SettleResult records the settle step that ran before verification
+type SettleResult struct {
+	Operations   []string `json:"operations"` // applied items that asked for the step
+	Status       bool     `json:"status"`     // STATUS answered 9000
+	Reset        bool     `json:"reset"`
+	Delay        string   `json:"delay,omitempty"`
+	Verification string   `json:"verification"` // VerifiedPreReset or VerifiedPostReset
+}
+
+// settleSleep waits for the settle delay (shortened by tests)
+var settleSleep = time.Sleep
+
+// Settle runs the settle step for the operations applied in this session: STATUS, a warm
+// reset if one of them asks for it, then the longest delay. nil when no applied operation
+// has a policy.
+func Settle(reader *card.Reader, applied []string, policies SettlePolicies) (*SettleResult, error) {
+	result := &SettleResult{Verification: VerifiedPreReset}
+	var delay time.Duration
+	for _, name := range applied {
+		policy, ok := policies[name]
+		if !ok {
+			continue
+		}
+		result.Operations = append(result.Operations, name)
+		result.Reset = result.Reset || policy.Reset
+		delay = max(delay, policy.Delay)
+	}
+	if len(result.Operations) == 0 {
+		return nil, nil
+	}
+
+	// STATUS (no data returned): the card finishes pending work before answering
+	resp, err := reader.SendAPDU([]byte{0x80, card.INS_STATUS, 0x00, 0x0C, 0x00})
+	result.Status = err == nil && resp.IsOK()
+
+	if result.Reset {
+		if _, err := reader.Reconnect(false); err != nil {
+			return result, fmt.Errorf("post-write warm reset failed: %w", err)
+		}
+		result.Verification = VerifiedPostReset
+	}
+	if delay > 0 {
+		result.Delay = delay.String()
+		settleSleep(delay)
+	}
+	return result, nil
+}
+
+// AppliedOperations returns the names of the items the report wrote
+func (r *ApplyReport) AppliedOperations() []string {
+	var names []string
+	for _, it := range r.Items {
+		if it.Status == ApplyApplied {
+			names = append(names, it.Name)
+		}
+	}
+	return names
+}
+
+// ChangedFiles returns the EF names of the changes without their application suffix
+// ("EF_IMSI (USIM)" gives "EF_IMSI"), for writes made outside ApplyConfig
+func ChangedFiles(changes []FileChange) []string {
+	var names []string
+	for _, c := range changes {
+		name, _, _ := strings.Cut(c.File, " (")
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,88 @@
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"sim_reader/card"
+)
+
+// ============ POST-WRITE SETTLE TESTS ============
+
+func TestNewSettlePolicies(t *testing.T) {
+	policies, err := NewSettlePolicies([]string{"IMSI", " ust "}, SettlePolicy{Reset: true})
+	if err != nil {
+		t.Fatalf("NewSettlePolicies() error = %v", err)
+	}
+	for _, name := range []string{"IMSI", "EF_IMSI", "USIM services", "EF_UST"} {
+		if !policies[name].Reset {
+			t.Errorf("no reset policy for %s", name)
+		}
+	}
+	if _, ok := policies["EF_SPN"]; ok {
+		t.Error("policy for EF_SPN, which was not selected")
+	}
+	if policies, err := NewSettlePolicies([]string{"none"}, SettlePolicy{}); err != nil || len(policies) != 0 {
+		t.Errorf("NewSettlePolicies(none) = %v, %v", policies, err)
+	}
+	if _, err := NewSettlePolicies([]string{"ki"}, SettlePolicy{}); err == nil {
+		t.Error("NewSettlePolicies() accepted an unknown operation")
+	}
+}
+
+func TestSettle(t *testing.T) {
+	var slept time.Duration
+	settleSleep = func(d time.Duration) { slept += d }
+	defer func() { settleSleep = time.Sleep }()
+
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	var status int
+	m.Override = func(apdu []byte) []byte {
+		if apdu[1] == card.INS_STATUS {
+			status++
+			return []byte{0x90, 0x00}
+		}
+		return nil
+	}
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	policies := SettlePolicies{
+		"EF_IMSI": {Reset: true, Delay: time.Second},
+		"EF_UST":  {Delay: 2 * time.Second},
+	}
+
+	// Nothing written that needs settling
+	result, err := Settle(reader, []string{"EF_SPN"}, policies)
+	if result != nil || err != nil || status != 0 {
+		t.Fatalf("Settle(EF_SPN) = %+v, %v with %d STATUS", result, err, status)
+	}
+
+	result, err = Settle(reader, []string{"EF_SPN", "EF_IMSI", "EF_UST"}, policies)
+	if err != nil {
+		t.Fatalf("Settle() error = %v", err)
+	}
+	if status != 1 || !result.Status {
+		t.Errorf("STATUS sent %d times, answered %v", status, result.Status)
+	}
+	if len(m.Resets) != 1 || m.Resets[0] || !result.Reset || result.Verification != VerifiedPostReset {
+		t.Errorf("resets = %v, result = %+v, want one warm reset", m.Resets, result)
+	}
+	if slept != 2*time.Second || result.Delay != "2s" {
+		t.Errorf("waited %v (%q), want the longest delay", slept, result.Delay)
+	}
+	if len(result.Operations) != 2 {
+		t.Errorf("operations = %q, want EF_IMSI and EF_UST", result.Operations)
+	}
+
+	// Without a reset the card is verified before the REFRESH
+	result, _ = Settle(reader, []string{"EF_UST"}, policies)
+	if result.Reset || result.Verification != VerifiedPreReset || len(m.Resets) != 1 {
+		t.Errorf("Settle(no reset) = %+v", result)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	got := ChangedFiles([]FileChange{{File: "EF_IMSI (USIM)"}, {File: "EF_SMS (USIM)"}, {File: "EF_SMS (USIM)"}, {File: "EF_DIR"}})
+	if len(got) != 3 || got[0] != "EF_IMSI" || got[1] != "EF_SMS" || got[2] != "EF_DIR" {
+		t.Errorf("ChangedFiles() = %q", got)
+	}
+}
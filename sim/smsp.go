@@ -0,0 +1,476 @@
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sim_reader/card"
+	"sim_reader/textcodec"
+)
+
+// EF_SMSP (TS 31.102 4.2.27, TS 51.011 10.5.6) holds the SMS parameters the UE uses
+// for mobile originated messages. Each record is Y bytes of alpha identifier followed by
+// 28 bytes of parameters; record 1 is the default set.
+var FID_EF_SMSP = []byte{0x6F, 0x42}
+
+// SMSP record layout after the alpha identifier
+const (
+	smspParamsLen      = 28
+	smspIndicators     = 0  // parameter indicators
+	smspDestination    = 1  // TP-Destination Address (12 bytes)
+	smspServiceCentre  = 13 // TS-Service Centre Address (12 bytes)
+	smspProtocolID     = 25 // TP-Protocol Identifier
+	smspDCS            = 26 // TP-Data Coding Scheme
+	smspValidity       = 27 // TP-Validity Period (relative format)
+	smspAddressLen     = 12 // length byte + TON/NPI + 10 BCD bytes
+	smspMaxAddrDigits  = 20
+	smspReservedAbsent = 0xE0 // b6..b8 of the indicators are reserved, set to 1
+)
+
+// Parameter indicator bits: a parameter is present when its bit is 0
+const (
+	SMSPDestinationAbsent   = 0x01
+	SMSPServiceCentreAbsent = 0x02
+	SMSPProtocolIDAbsent    = 0x04
+	SMSPDCSAbsent           = 0x08
+	SMSPValidityAbsent      = 0x10
+)
+
+// SMSParams is one EF_SMSP record. Empty strings and nil values are parameters
+// marked absent in the parameter indicators.
+type SMSParams struct {
+	AlphaID        string
+	SMSC           string // TS-Service Centre Address, "+" prefix for international
+	Destination    string // TP-Destination Address
+	ProtocolID     *byte
+	DCS            *byte
+	ValidityPeriod *byte // relative TP-VP, see ValidityPeriodDuration
+}
+
+// IsEmpty reports whether no parameter is set
+func (p *SMSParams) IsEmpty() bool {
+	return p == nil || p.AlphaID == "" && p.SMSC == "" && p.Destination == "" &&
+		p.ProtocolID == nil && p.DCS == nil && p.ValidityPeriod == nil
+}
+
+// String formats the parameters that are set, e.g. "SMSC +491710760000, VP 24h"
+func (p *SMSParams) String() string {
+	if p.IsEmpty() {
+		return "(empty)"
+	}
+	var parts []string
+	if p.AlphaID != "" {
+		parts = append(parts, fmt.Sprintf("%q", p.AlphaID))
+	}
+	if p.SMSC != "" {
+		parts = append(parts, "SMSC "+p.SMSC)
+	}
+	if p.Destination != "" {
+		parts = append(parts, "destination "+p.Destination)
+	}
+	if p.ProtocolID != nil {
+		parts = append(parts, fmt.Sprintf("PID %02X", *p.ProtocolID))
+	}
+	if p.DCS != nil {
+		parts = append(parts, fmt.Sprintf("DCS %02X", *p.DCS))
+	}
+	if p.ValidityPeriod != nil {
+		parts = append(parts, "VP "+FormatValidityPeriod(ValidityPeriodDuration(*p.ValidityPeriod)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// merge returns p with every parameter set in update replaced
+func (p SMSParams) merge(update SMSParams) SMSParams {
+	if update.AlphaID != "" {
+		p.AlphaID = update.AlphaID
+	}
+	if update.SMSC != "" {
+		p.SMSC = update.SMSC
+	}
+	if update.Destination != "" {
+		p.Destination = update.Destination
+	}
+	if update.ProtocolID != nil {
+		p.ProtocolID = update.ProtocolID
+	}
+	if update.DCS != nil {
+		p.DCS = update.DCS
+	}
+	if update.ValidityPeriod != nil {
+		p.ValidityPeriod = update.ValidityPeriod
+	}
+	return p
+}
+
+// covers reports whether every parameter set in update already has that value in p
+func (p *SMSParams) covers(update SMSParams) bool {
+	if p == nil {
+		return update.IsEmpty()
+	}
+	merged := p.merge(update)
+	return merged.AlphaID == p.AlphaID && merged.SMSC == p.SMSC && merged.Destination == p.Destination &&
+		sameByte(merged.ProtocolID, p.ProtocolID) && sameByte(merged.DCS, p.DCS) &&
+		sameByte(merged.ValidityPeriod, p.ValidityPeriod)
+}
+
+func sameByte(a, b *byte) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+// DecodeSMSP decodes an EF_SMSP record; nil for an unused record
+func DecodeSMSP(data []byte) *SMSParams {
+	if len(data) < smspParamsLen {
+		return nil
+	}
+	y := len(data) - smspParamsLen
+	params := data[y:]
+	ind := params[smspIndicators]
+
+	p := &SMSParams{AlphaID: textcodec.DecodeAlpha(data[:y])}
+	if ind&SMSPDestinationAbsent == 0 {
+		p.Destination = decodeSMSPAddress(params[smspDestination:smspDestination+smspAddressLen], true)
+	}
+	if ind&SMSPServiceCentreAbsent == 0 {
+		p.SMSC = decodeSMSPAddress(params[smspServiceCentre:smspServiceCentre+smspAddressLen], false)
+	}
+	if ind&SMSPProtocolIDAbsent == 0 {
+		v := params[smspProtocolID]
+		p.ProtocolID = &v
+	}
+	if ind&SMSPDCSAbsent == 0 {
+		v := params[smspDCS]
+		p.DCS = &v
+	}
+	if ind&SMSPValidityAbsent == 0 {
+		v := params[smspValidity]
+		p.ValidityPeriod = &v
+	}
+	if p.IsEmpty() {
+		return nil
+	}
+	return p
+}
+
+// EncodeSMSP encodes p as an EF_SMSP record of recordLen bytes, setting the parameter
+// indicator bit of every absent parameter
+func EncodeSMSP(p SMSParams, recordLen int) ([]byte, error) {
+	if recordLen < smspParamsLen {
+		return nil, fmt.Errorf("EF_SMSP record length %d is shorter than %d", recordLen, smspParamsLen)
+	}
+	data := make([]byte, recordLen)
+	for i := range data {
+		data[i] = 0xFF
+	}
+	y := recordLen - smspParamsLen
+	if p.AlphaID != "" {
+		alpha, err := textcodec.EncodeAlphaPadded(p.AlphaID, y)
+		if err != nil {
+			return nil, fmt.Errorf("alpha identifier: %w", err)
+		}
+		copy(data, alpha)
+	}
+
+	params := data[y:]
+	ind := byte(smspReservedAbsent | SMSPDestinationAbsent | SMSPServiceCentreAbsent |
+		SMSPProtocolIDAbsent | SMSPDCSAbsent | SMSPValidityAbsent)
+	if p.Destination != "" {
+		addr, err := encodeSMSPAddress(p.Destination, true)
+		if err != nil {
+			return nil, fmt.Errorf("destination address: %w", err)
+		}
+		copy(params[smspDestination:], addr)
+		ind &^= SMSPDestinationAbsent
+	}
+	if p.SMSC != "" {
+		addr, err := encodeSMSPAddress(p.SMSC, false)
+		if err != nil {
+			return nil, fmt.Errorf("SMSC: %w", err)
+		}
+		copy(params[smspServiceCentre:], addr)
+		ind &^= SMSPServiceCentreAbsent
+	}
+	if p.ProtocolID != nil {
+		params[smspProtocolID] = *p.ProtocolID
+		ind &^= SMSPProtocolIDAbsent
+	}
+	if p.DCS != nil {
+		params[smspDCS] = *p.DCS
+		ind &^= SMSPDCSAbsent
+	}
+	if p.ValidityPeriod != nil {
+		params[smspValidity] = *p.ValidityPeriod
+		ind &^= SMSPValidityAbsent
+	}
+	params[smspIndicators] = ind
+	return data, nil
+}
+
+// encodeSMSPAddress encodes a 12 byte address field. The length byte counts digits for
+// the TP-Destination Address (TS 23.040) and octets for the service centre (TS 24.011).
+func encodeSMSPAddress(number string, digitLength bool) ([]byte, error) {
+	tonNpi := byte(0x81)
+	digits := number
+	if strings.HasPrefix(digits, "+") {
+		tonNpi = 0x91
+		digits = digits[1:]
+	}
+	if digits == "" || len(digits) > smspMaxAddrDigits {
+		return nil, fmt.Errorf("%q must have 1-%d digits", number, smspMaxAddrDigits)
+	}
+
+	addr := make([]byte, smspAddressLen)
+	for i := range addr {
+		addr[i] = 0xFF
+	}
+	for i := 0; i < len(digits); i++ {
+		var nibble byte
+		switch c := digits[i]; {
+		case c >= '0' && c <= '9':
+			nibble = c - '0'
+		case c == '*':
+			nibble = 0x0A
+		case c == '#':
+			nibble = 0x0B
+		default:
+			return nil, fmt.Errorf("%q: invalid digit %q", number, c)
+		}
+		if i%2 == 0 {
+			addr[2+i/2] = 0xF0 | nibble
+		} else {
+			addr[2+i/2] = addr[2+i/2]&0x0F | nibble<<4
+		}
+	}
+	if digitLength {
+		addr[0] = byte(len(digits))
+	} else {
+		addr[0] = byte(1 + (len(digits)+1)/2)
+	}
+	addr[1] = tonNpi
+	return addr, nil
+}
+
+// decodeSMSPAddress decodes a 12 byte address field (see encodeSMSPAddress)
+func decodeSMSPAddress(addr []byte, digitLength bool) string {
+	n := int(addr[0])
+	if n == 0 || n == 0xFF {
+		return ""
+	}
+	octets := n - 1
+	if digitLength {
+		octets = (n + 1) / 2
+	}
+	if octets <= 0 || 2+octets > len(addr) {
+		return ""
+	}
+	return decodeBCDNumber(addr[2:2+octets], addr[1])
+}
+
+// ValidityPeriodDuration returns the duration of a relative TP-VP (TS 23.040 9.2.3.12.1)
+func ValidityPeriodDuration(vp byte) time.Duration {
+	v := time.Duration(vp)
+	switch {
+	case vp <= 143:
+		return (v + 1) * 5 * time.Minute
+	case vp <= 167:
+		return 12*time.Hour + (v-143)*30*time.Minute
+	case vp <= 196:
+		return (v - 166) * 24 * time.Hour
+	default:
+		return (v - 192) * 7 * 24 * time.Hour
+	}
+}
+
+// EncodeValidityPeriod returns the relative TP-VP for d, rounded up to the next step
+// (5 minutes up to 12h, 30 minutes up to 24h, days up to 30d, weeks up to 63w)
+func EncodeValidityPeriod(d time.Duration) (byte, error) {
+	const day, week = 24 * time.Hour, 7 * 24 * time.Hour
+	ceil := func(d, unit time.Duration) int { return int((d + unit - 1) / unit) }
+	switch {
+	case d <= 0:
+		return 0, fmt.Errorf("validity period must be positive")
+	case d <= 12*time.Hour:
+		return byte(ceil(d, 5*time.Minute) - 1), nil
+	case d <= day:
+		return byte(143 + ceil(d-12*time.Hour, 30*time.Minute)), nil
+	case d <= 30*day:
+		return byte(166 + ceil(d, day)), nil
+	case d <= 63*week:
+		return byte(192 + ceil(d, week)), nil
+	}
+	return 0, fmt.Errorf("validity period %s exceeds 63 weeks", FormatValidityPeriod(d))
+}
+
+// ParseValidityPeriod parses "30m", "12h30m", "24h", "7d" or "12w"
+func ParseValidityPeriod(s string) (time.Duration, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil {
+				return 0, fmt.Errorf("invalid validity period %q", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid validity period %q (use e.g. 30m, 12h, 7d, 5w)", s)
+	}
+	return d, nil
+}
+
+// FormatValidityPeriod formats d the way ParseValidityPeriod reads it
+func FormatValidityPeriod(d time.Duration) string {
+	const day, week = 24 * time.Hour, 7 * 24 * time.Hour
+	switch {
+	case d > 30*day && d%week == 0:
+		return fmt.Sprintf("%dw", d/week)
+	case d > day && d%day == 0:
+		return fmt.Sprintf("%dd", d/day)
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%dh%dm", d/time.Hour, d%time.Hour/time.Minute)
+}
+
+// Params converts the config section to the parameters written to EF_SMSP
+func (c *SMSConfig) Params() (SMSParams, error) {
+	p := SMSParams{SMSC: c.SMSC, AlphaID: c.AlphaID}
+	toByte := func(name string, v *int) (*byte, error) {
+		if v == nil {
+			return nil, nil
+		}
+		if *v < 0 || *v > 0xFF {
+			return nil, fmt.Errorf("sms.%s %d out of range 0-255", name, *v)
+		}
+		b := byte(*v)
+		return &b, nil
+	}
+	var err error
+	if p.ProtocolID, err = toByte("protocol_id", c.ProtocolID); err != nil {
+		return p, err
+	}
+	if p.DCS, err = toByte("dcs", c.DCS); err != nil {
+		return p, err
+	}
+	if c.ValidityPeriod != "" {
+		d, err := ParseValidityPeriod(c.ValidityPeriod)
+		if err != nil {
+			return p, fmt.Errorf("sms.validity_period: %w", err)
+		}
+		vp, err := EncodeValidityPeriod(d)
+		if err != nil {
+			return p, fmt.Errorf("sms.validity_period: %w", err)
+		}
+		p.ValidityPeriod = &vp
+	}
+	if p.IsEmpty() {
+		return p, fmt.Errorf("sms section sets no parameter")
+	}
+	return p, nil
+}
+
+// ExportSMSConfig returns the config section for the parameters read from the card
+// (nil if EF_SMSP record 1 is unused)
+func ExportSMSConfig(p *SMSParams) *SMSConfig {
+	if p.IsEmpty() {
+		return nil
+	}
+	c := &SMSConfig{SMSC: p.SMSC, AlphaID: p.AlphaID}
+	if p.ProtocolID != nil {
+		v := int(*p.ProtocolID)
+		c.ProtocolID = &v
+	}
+	if p.DCS != nil {
+		v := int(*p.DCS)
+		c.DCS = &v
+	}
+	if p.ValidityPeriod != nil {
+		c.ValidityPeriod = FormatValidityPeriod(ValidityPeriodDuration(*p.ValidityPeriod))
+	}
+	if *c == (SMSConfig{}) {
+		return nil // only a destination address, which the config does not carry
+	}
+	return c
+}
+
+// readSMSP reads the first EF_SMSP record (USIM selected)
+func readSMSP(reader *card.Reader) ([]byte, EFStatus) {
+	resp, st := selectEFStatus(reader, 0x6F42)
+	if st.State != EFPresent {
+		return nil, st
+	}
+	recordLen := parseFCPRecordSize(resp.Data)
+	if UseGSMCommands && len(resp.Data) >= 15 {
+		recordLen = int(resp.Data[14])
+	}
+	if recordLen == 0 {
+		return nil, EFStatus{State: EFError, Err: fmt.Errorf("EF_SMSP record length not found")}
+	}
+
+	var err error
+	if UseGSMCommands {
+		resp, err = reader.ReadRecordGSM(1, byte(recordLen))
+	} else {
+		resp, err = reader.ReadRecord(1, byte(recordLen))
+	}
+	if err != nil {
+		return nil, EFStatus{State: EFError, Err: err}
+	}
+	if !resp.IsOK() {
+		return nil, EFStatus{State: EFError, SW: resp.SW(), Err: fmt.Errorf("read EF_SMSP failed: %s", resp.SWString())}
+	}
+	return resp.Data, st
+}
+
+// WriteSMSP updates the default SMS parameters (EF_SMSP record 1). Parameters not set in
+// update keep their current value, so --write-smsc and the config "sms" section can
+// each change a subset.
+func WriteSMSP(reader *card.Reader, update SMSParams) error {
+	if update.IsEmpty() {
+		return fmt.Errorf("no SMS parameter to write")
+	}
+	if drv := FindDriver(reader); drv != nil {
+		if err := drv.PrepareWrite(reader); err != nil {
+			return fmt.Errorf("prepare write failed: %w", err)
+		}
+	}
+
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+	current, st := readSMSP(reader)
+	if st.State != EFPresent {
+		if st.Err != nil {
+			return fmt.Errorf("EF_SMSP: %w", st.Err)
+		}
+		return fmt.Errorf("EF_SMSP not found")
+	}
+
+	params := SMSParams{}
+	if p := DecodeSMSP(current); p != nil {
+		params = *p
+	}
+	data, err := EncodeSMSP(params.merge(update), len(current))
+	if err != nil {
+		return err
+	}
+
+	resp, err = reader.UpdateRecord(1, data)
+	if err != nil {
+		return fmt.Errorf("failed to write EF_SMSP: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("EF_SMSP write failed: %s", resp.SWString())
+	}
+	return nil
+}
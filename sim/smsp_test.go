@@ -0,0 +1,186 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"sim_reader/card"
+)
+
+// ============ EF_SMSP TESTS ============
+
+func byteRef(b byte) *byte { return &b }
+
+func TestEncodeSMSP(t *testing.T) {
+	p := SMSParams{
+		AlphaID:        "Net",
+		SMSC:           "+491710760000",
+		ProtocolID:     byteRef(0x00),
+		DCS:            byteRef(0x00),
+		ValidityPeriod: byteRef(0xA7),
+	}
+	data, err := EncodeSMSP(p, 40)
+	if err != nil {
+		t.Fatalf("EncodeSMSP() error = %v", err)
+	}
+	want, _ := hex.DecodeString("4E6574FFFFFFFFFFFFFFFFFF" + // alpha identifier (12 bytes)
+		"E1" + // indicators: destination absent, the rest present
+		"FFFFFFFFFFFFFFFFFFFFFFFF" + // TP-Destination Address
+		"0791947101670000FFFFFFFF" + // TS-Service Centre Address
+		"0000A7")
+	if !bytes.Equal(data, want) {
+		t.Errorf("EncodeSMSP() =\n%X\nwant\n%X", data, want)
+	}
+
+	got := DecodeSMSP(data)
+	if got == nil || got.String() != p.String() {
+		t.Errorf("DecodeSMSP() = %v, want %v", got, p.String())
+	}
+	if p.String() != `"Net", SMSC +491710760000, PID 00, DCS 00, VP 24h` {
+		t.Errorf("String() = %q", p.String())
+	}
+}
+
+func TestEncodeSMSP_Indicators(t *testing.T) {
+	tests := []struct {
+		name string
+		p    SMSParams
+		want byte
+	}{
+		{"SMSC only", SMSParams{SMSC: "12345"}, 0xFD},
+		{"destination and VP", SMSParams{Destination: "+4917", ValidityPeriod: byteRef(0)}, 0xEE},
+		{"PID and DCS", SMSParams{ProtocolID: byteRef(0x41), DCS: byteRef(0x08)}, 0xF3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeSMSP(tt.p, smspParamsLen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data[0] != tt.want {
+				t.Errorf("indicators = %02X, want %02X", data[0], tt.want)
+			}
+			if got := DecodeSMSP(data); got.String() != tt.p.String() {
+				t.Errorf("round trip = %v, want %v", got, tt.p.String())
+			}
+		})
+	}
+
+	if DecodeSMSP(bytes.Repeat([]byte{0xFF}, 40)) != nil {
+		t.Error("DecodeSMSP() of an unused record should be nil")
+	}
+	if _, err := EncodeSMSP(SMSParams{AlphaID: "too long"}, 30); err == nil {
+		t.Error("EncodeSMSP() should reject an alpha identifier longer than Y")
+	}
+	if _, err := EncodeSMSP(SMSParams{SMSC: "+49-171"}, 28); err == nil {
+		t.Error("EncodeSMSP() should reject non-digits")
+	}
+}
+
+func TestValidityPeriod(t *testing.T) {
+	tests := []struct {
+		in   string
+		vp   byte
+		back string
+	}{
+		{"5m", 0, "5m"},
+		{"1h", 11, "1h"},
+		{"12h", 143, "12h"},
+		{"12h30m", 144, "12h30m"},
+		{"13h10m", 146, "13h30m"},
+		{"24h", 167, "24h"},
+		{"2d", 168, "2d"},
+		{"7d", 173, "7d"},
+		{"30d", 196, "30d"},
+		{"5w", 197, "5w"},
+		{"63w", 255, "63w"},
+	}
+	for _, tt := range tests {
+		d, err := ParseValidityPeriod(tt.in)
+		if err != nil {
+			t.Fatalf("ParseValidityPeriod(%q) error = %v", tt.in, err)
+		}
+		vp, err := EncodeValidityPeriod(d)
+		if err != nil || vp != tt.vp {
+			t.Errorf("EncodeValidityPeriod(%s) = %d, %v, want %d", tt.in, vp, err, tt.vp)
+		}
+		if got := FormatValidityPeriod(ValidityPeriodDuration(vp)); got != tt.back {
+			t.Errorf("FormatValidityPeriod(vp %d) = %q, want %q", vp, got, tt.back)
+		}
+	}
+	if _, err := EncodeValidityPeriod(64 * 7 * 24 * time.Hour); err == nil {
+		t.Error("EncodeValidityPeriod() should reject more than 63 weeks")
+	}
+	if _, err := ParseValidityPeriod("soon"); err == nil {
+		t.Error("ParseValidityPeriod() should reject garbage")
+	}
+}
+
+// newSMSPTestCard returns a card whose EF_SMSP record 1 has a destination, PID, DCS and VP
+func newSMSPTestCard(t *testing.T) (*card.Reader, *card.MockFile) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, []byte{0x08, 0x29, 0x05, 0x88, 0x00, 0x00, 0x00, 0x00, 0x10})
+	rec, err := EncodeSMSP(SMSParams{Destination: "+4917", ProtocolID: byteRef(0), DCS: byteRef(0), ValidityPeriod: byteRef(0xA7)}, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smsp := usim.AddRecordEF(0x6F42, rec, bytes.Repeat([]byte{0xFF}, 40))
+	return card.NewReaderWithTransport("Mock", m.ATR, m), smsp
+}
+
+func TestWriteSMSP_KeepsOtherParameters(t *testing.T) {
+	reader, smsp := newSMSPTestCard(t)
+	if err := WriteSMSP(reader, SMSParams{SMSC: "+79990000000"}); err != nil {
+		t.Fatalf("WriteSMSP() error = %v", err)
+	}
+	got := DecodeSMSP(smsp.Records[0])
+	want := "SMSC +79990000000, destination +4917, PID 00, DCS 00, VP 24h"
+	if got.String() != want {
+		t.Errorf("EF_SMSP record 1 = %q, want %q", got.String(), want)
+	}
+	if !bytes.Equal(smsp.Records[1], bytes.Repeat([]byte{0xFF}, 40)) {
+		t.Errorf("record 2 changed: %X", smsp.Records[1])
+	}
+}
+
+func TestApplyConfig_SMS(t *testing.T) {
+	reader, smsp := newSMSPTestCard(t)
+	dcs := 8
+	config := &SIMConfig{SMS: &SMSConfig{SMSC: "+79990000000", DCS: &dcs, ValidityPeriod: "7d", AlphaID: "Home"}}
+
+	report, err := ApplyConfig(reader, config, false, false)
+	if err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+	checkReport(t, report, map[string]ApplyStatus{"SMS parameters": ApplyApplied})
+
+	usim, err := ReadUSIM(reader)
+	if err != nil {
+		t.Fatalf("ReadUSIM() error = %v", err)
+	}
+	exported := ExportToConfig(usim, nil).SMS
+	if exported == nil || exported.SMSC != "+79990000000" || exported.ValidityPeriod != "7d" ||
+		exported.AlphaID != "Home" || exported.DCS == nil || *exported.DCS != 8 {
+		t.Fatalf("exported sms = %+v", exported)
+	}
+	if got := DecodeSMSP(smsp.Records[0]); got.Destination != "+4917" {
+		t.Errorf("destination = %q, want it kept", got.Destination)
+	}
+
+	// The exported section applies as unchanged
+	report, err = ApplyConfig(reader, &SIMConfig{SMS: exported}, false, false)
+	if err != nil {
+		t.Fatalf("second ApplyConfig() error = %v", err)
+	}
+	checkReport(t, report, map[string]ApplyStatus{"SMS parameters": ApplyUnchanged})
+
+	bad := 300
+	report, _ = ApplyConfig(reader, &SIMConfig{SMS: &SMSConfig{ProtocolID: &bad}}, false, false)
+	if len(report.Items) != 1 || !strings.Contains(report.Items[0].Detail, "protocol_id") {
+		t.Errorf("out of range PID report = %+v", report.Items)
+	}
+}
@@ -0,0 +1,497 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"sim_reader/card"
+)
+
+// SnapshotVersion is the format version written by SaveSnapshot
+const SnapshotVersion = 1
+
+// Credential levels recorded per snapshot file
+const (
+	CredentialNone = "none"
+	CredentialPIN1 = "PIN1"
+	CredentialPIN2 = "PIN2"
+	CredentialADM1 = "ADM1"
+	CredentialADM2 = "ADM2"
+	CredentialADM3 = "ADM3"
+	CredentialADM4 = "ADM4"
+)
+
+// Snapshot is the saved content of the writable files of a card, restorable with RollbackSnapshot
+type Snapshot struct {
+	Version int            `json:"version"`
+	Created string         `json:"created"`
+	ICCID   string         `json:"iccid"`
+	ATR     string         `json:"atr"`
+	Files   []SnapshotFile `json:"files"`
+	Skipped []SnapshotSkip `json:"skipped,omitempty"`
+}
+
+// SnapshotFile is one saved EF
+type SnapshotFile struct {
+	Name        string   `json:"name"`
+	Application string   `json:"application"` // MF, ADF_USIM or ADF_ISIM
+	FID         string   `json:"fid"`
+	Structure   string   `json:"structure"`             // transparent or linear
+	Data        string   `json:"data,omitempty"`        // transparent content (hex)
+	Records     []string `json:"records,omitempty"`     // linear fixed records (hex)
+	WriteAccess string   `json:"write_access"`          // access condition as read from the card
+	Credential  string   `json:"credential"`            // level needed to restore: none, PIN1, PIN2, ADM1..ADM4 ("/" = any, "&" = all)
+	Assumed     bool     `json:"assumed,omitempty"`     // access condition unknown, ADM1 assumed
+	Description string   `json:"description,omitempty"` // EF description
+}
+
+// SnapshotSkip is a known file that was not saved
+type SnapshotSkip struct {
+	Name        string `json:"name"`
+	Application string `json:"application"`
+	Reason      string `json:"reason"`
+}
+
+// Credentials is the set of credential levels available for a restore
+type Credentials map[string]bool
+
+// StoredCredentials returns the credential levels available from the stored keys
+// (ADM1..ADM4, PIN2) plus PIN1 if it was verified
+func StoredCredentials(pin1Verified bool) Credentials {
+	creds := Credentials{CredentialNone: true}
+	if pin1Verified {
+		creds[CredentialPIN1] = true
+	}
+	if StoredPIN2 != "" {
+		creds[CredentialPIN2] = true
+	}
+	for level := 1; level <= 4; level++ {
+		if len(storedADMKeyFor(level)) > 0 {
+			creds[fmt.Sprintf("ADM%d", level)] = true
+		}
+	}
+	return creds
+}
+
+// Satisfies reports whether the credential expression of a snapshot file can be met
+func (c Credentials) Satisfies(credential string) bool {
+	if strings.Contains(credential, "&") {
+		for _, part := range strings.Split(credential, "&") {
+			if !c[part] {
+				return false
+			}
+		}
+		return true
+	}
+	for _, part := range strings.Split(credential, "/") {
+		if c[part] {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotCredential maps a write access condition to the credential needed to restore the file.
+// ok is false for files that can never be written (Never, unsupported references).
+func snapshotCredential(access string) (credential string, assumed, ok bool) {
+	switch {
+	case access == "Always":
+		return CredentialNone, false, true
+	case access == "Universal PIN":
+		return CredentialPIN1, false, true
+	case access == "" || access == "?" || strings.HasPrefix(access, "ARR#"):
+		return CredentialADM1, true, true
+	}
+	sep := ""
+	if strings.Contains(access, "/") {
+		sep = "/"
+	} else if strings.Contains(access, "&") {
+		sep = "&"
+	}
+	parts := []string{access}
+	if sep != "" {
+		parts = strings.Split(access, sep)
+	}
+	var levels []string
+	for _, p := range parts {
+		switch p {
+		case CredentialPIN1, CredentialPIN2, CredentialADM1, CredentialADM2, CredentialADM3, CredentialADM4:
+			levels = append(levels, p)
+		case "Always":
+			levels = append(levels, CredentialNone)
+		case "Universal PIN":
+			levels = append(levels, CredentialPIN1)
+		default:
+			if sep == "&" {
+				return "", false, false
+			}
+		}
+	}
+	if len(levels) == 0 {
+		return "", false, false
+	}
+	return strings.Join(levels, sep), false, true
+}
+
+// snapshotApplication is a file group selected together
+type snapshotApplication struct {
+	name     string
+	files    map[uint16]EFDefinition
+	arrFID   []byte
+	selectFn func(reader *card.Reader) error
+}
+
+func snapshotApplications() []snapshotApplication {
+	return []snapshotApplication{
+		{"MF", MF_Files, []byte{0x2F, 0x06}, func(reader *card.Reader) error {
+			resp, err := reader.Select([]byte{0x3F, 0x00})
+			return selectResult(resp, err, "MF")
+		}},
+		{"ADF_USIM", USIM_Files, []byte{0x6F, 0x06}, func(reader *card.Reader) error {
+			resp, err := SelectUSIMWithAuth(reader)
+			return selectResult(resp, err, "USIM")
+		}},
+		{"ADF_ISIM", ISIM_Files, []byte{0x6F, 0x06}, func(reader *card.Reader) error {
+			resp, err := SelectISIMWithAuth(reader)
+			return selectResult(resp, err, "ISIM")
+		}},
+	}
+}
+
+func selectResult(resp *card.APDUResponse, err error, name string) error {
+	if err != nil {
+		return fmt.Errorf("select %s: %w", name, err)
+	}
+	if !resp.IsOK() && !resp.HasMoreData() {
+		return fmt.Errorf("select %s: %s", name, resp.SWString())
+	}
+	return nil
+}
+
+// sortedFileIDs returns the file IDs of defs in ascending order
+func sortedFileIDs(defs map[uint16]EFDefinition) []uint16 {
+	ids := make([]uint16, 0, len(defs))
+	for id := range defs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// TakeSnapshot saves the content of every known EF (MF, USIM, ISIM) that can later be restored
+// with creds. Files whose write access condition needs a credential that is not available, that
+// can never be written or that cannot be read are listed in Skipped.
+func TakeSnapshot(reader *card.Reader, creds Credentials) (*Snapshot, error) {
+	if UseGSMCommands {
+		return nil, fmt.Errorf("snapshots need a UICC (GSM-only card)")
+	}
+	snap := &Snapshot{
+		Version: SnapshotVersion,
+		Created: time.Now().UTC().Format(time.RFC3339),
+		ATR:     reader.ATRHex(),
+	}
+
+	for _, app := range snapshotApplications() {
+		if err := app.selectFn(reader); err != nil {
+			if app.name == "MF" {
+				return nil, err
+			}
+			continue // application not present
+		}
+		arr := readARRTable(reader, app.arrFID)
+		if err := app.selectFn(reader); err != nil {
+			return nil, err
+		}
+
+		for _, id := range sortedFileIDs(app.files) {
+			def := app.files[id]
+			fid := []byte{byte(id >> 8), byte(id)}
+			skip := func(reason string) {
+				snap.Skipped = append(snap.Skipped, SnapshotSkip{Name: def.Name, Application: app.name, Reason: reason})
+			}
+
+			resp, err := reader.Select(fid)
+			if err != nil || !resp.IsOK() {
+				continue // not present on this card
+			}
+			fcp := resp.Data
+
+			_, writeAccess := parseFCPSecurityAttributes(fcp)
+			if strings.HasPrefix(writeAccess, "ARR#") {
+				var recNum int
+				fmt.Sscanf(writeAccess, "ARR#%d", &recNum)
+				if rec, ok := arr[recNum]; ok {
+					writeAccess = rec.WriteAccess
+				}
+			}
+			credential, assumed, ok := snapshotCredential(writeAccess)
+			if !ok {
+				skip(fmt.Sprintf("not writable (%s)", writeAccess))
+				continue
+			}
+			if !creds.Satisfies(credential) {
+				skip(fmt.Sprintf("requires %s", credential))
+				continue
+			}
+
+			file := SnapshotFile{
+				Name:        def.Name,
+				Application: app.name,
+				FID:         fmt.Sprintf("%04X", id),
+				WriteAccess: writeAccess,
+				Credential:  credential,
+				Assumed:     assumed,
+				Description: def.Description,
+			}
+
+			if reason := readSnapshotContent(reader, fcp, &file); reason != "" {
+				skip(reason)
+				continue
+			}
+
+			if id == 0x2FE2 && app.name == "MF" && file.Data != "" {
+				raw, _ := hex.DecodeString(file.Data)
+				snap.ICCID = DecodeICCID(raw)
+			}
+			snap.Files = append(snap.Files, file)
+		}
+	}
+
+	if snap.ICCID == "" {
+		snap.ICCID = readSnapshotICCID(reader)
+	}
+	return snap, nil
+}
+
+// readSnapshotContent reads the content of the selected EF into file by the structure in its
+// FCP. Returns why the file cannot be saved, "" when it was read.
+func readSnapshotContent(reader *card.Reader, fcp []byte, file *SnapshotFile) string {
+	switch fcpStructure(fcp) {
+	case "transparent":
+		size := parseFCPFileSize(fcp)
+		if size == 0 {
+			return "file size unknown"
+		}
+		data, err := reader.ReadAllBinary(size)
+		if err != nil || len(data) != size {
+			return fmt.Sprintf("read failed: %v", readErr(err, reader))
+		}
+		file.Structure = "transparent"
+		file.Data = strings.ToUpper(hex.EncodeToString(data))
+	case "linear":
+		recordSize := parseFCPRecordSize(fcp)
+		count := parseFCPNumRecords(fcp)
+		if recordSize == 0 || count == 0 {
+			return "record size unknown"
+		}
+		file.Structure = "linear"
+		file.Records = nil
+		for rec := 1; rec <= count; rec++ {
+			resp, err := reader.ReadRecord(byte(rec), byte(recordSize))
+			if err != nil || !resp.IsOK() {
+				file.Records = nil
+				return fmt.Sprintf("read failed: %v", readErr(nil, reader))
+			}
+			file.Records = append(file.Records, strings.ToUpper(hex.EncodeToString(resp.Data)))
+		}
+	case "cyclic":
+		return "cyclic file (record order cannot be restored)"
+	default:
+		return "unknown file structure"
+	}
+	return ""
+}
+
+func readErr(err error, reader *card.Reader) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("SW %04X", reader.LastSW())
+}
+
+// fcpStructure returns transparent, linear, cyclic, BER-TLV or DF from the file descriptor
+// byte (tag 82)
+func fcpStructure(fcp []byte) string {
+	f, _ := card.ParseFCP(fcp)
+	return f.Structure()
+}
+
+// readSnapshotICCID reads EF_ICCID from the MF ("" if unreadable)
+func readSnapshotICCID(reader *card.Reader) string {
+	iccid, _ := readICCID(reader)
+	return iccid
+}
+
+// SaveSnapshot writes snap to path as JSON
+func SaveSnapshot(path string, snap *Snapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("parse snapshot: %w", err)
+	}
+	if snap.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+	return &snap, nil
+}
+
+// Unrestorable lists the files of the snapshot whose credential is not available ("EF_X (ADM2)")
+func (s *Snapshot) Unrestorable(creds Credentials) []string {
+	var missing []string
+	for _, f := range s.Files {
+		if !creds.Satisfies(f.Credential) {
+			missing = append(missing, fmt.Sprintf("%s/%s (%s)", f.Application, f.Name, f.Credential))
+		}
+	}
+	return missing
+}
+
+// RollbackSnapshot writes the snapshot content back to the card and reads every written file
+// back to verify it. Before anything is written it checks that the snapshot belongs to this card
+// (ICCID) and that creds can restore every file; otherwise it fails listing the problem files.
+// Files whose content already matches are skipped.
+func RollbackSnapshot(reader *card.Reader, snap *Snapshot, creds Credentials) (*ApplyReport, error) {
+	if missing := snap.Unrestorable(creds); len(missing) > 0 {
+		return nil, fmt.Errorf("cannot restore %d file(s) with the provided credentials:\n  - %s",
+			len(missing), joinErrors(missing))
+	}
+	if snap.ICCID != "" {
+		if current := readSnapshotICCID(reader); current != snap.ICCID {
+			return nil, fmt.Errorf("snapshot was taken from card %s, this card is %s", snap.ICCID, current)
+		}
+	}
+
+	report := &ApplyReport{simulate: reader.DryRun()}
+	for _, app := range snapshotApplications() {
+		var files []SnapshotFile
+		for _, f := range snap.Files {
+			if f.Application == app.name {
+				files = append(files, f)
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		if err := app.selectFn(reader); err != nil {
+			for _, f := range files {
+				report.failed(reader, f.Name, err)
+			}
+			continue
+		}
+		var pin2Err error
+		if needsPIN2(files) && StoredPIN2 != "" {
+			pin2Err = verifyStoredPIN2(reader)
+		}
+		for _, f := range files {
+			if f.Credential == CredentialPIN2 && pin2Err != nil {
+				report.failed(reader, f.Name, fmt.Errorf("PIN2: %w", pin2Err))
+				continue
+			}
+			restoreSnapshotFile(reader, report, f)
+		}
+	}
+	return report, report.Err()
+}
+
+// needsPIN2 reports whether any of files lists PIN2 in its credential
+func needsPIN2(files []SnapshotFile) bool {
+	for _, f := range files {
+		if strings.Contains(f.Credential, CredentialPIN2) {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreSnapshotFile writes one file back if its content differs and verifies the result
+func restoreSnapshotFile(reader *card.Reader, report *ApplyReport, f SnapshotFile) {
+	id, err := hex.DecodeString(f.FID)
+	if err != nil || len(id) != 2 {
+		report.failed(nil, f.Name, fmt.Errorf("invalid FID %q", f.FID))
+		return
+	}
+	resp, err := reader.Select(id)
+	if err != nil || !resp.IsOK() {
+		report.failed(reader, f.Name, fmt.Errorf("select failed: %v", readErr(err, reader)))
+		return
+	}
+
+	switch f.Structure {
+	case "transparent":
+		want, err := hex.DecodeString(f.Data)
+		if err != nil {
+			report.failed(nil, f.Name, fmt.Errorf("invalid data: %w", err))
+			return
+		}
+		current, err := reader.ReadAllBinary(len(want))
+		if err == nil && bytes.Equal(current, want) {
+			report.unchanged(f.Name)
+			return
+		}
+		if err := reader.WriteAllBinary(want); err != nil {
+			report.failed(reader, f.Name, err)
+			return
+		}
+		if !report.simulate {
+			back, err := reader.ReadAllBinary(len(want))
+			if err != nil || !bytes.Equal(back, want) {
+				report.failed(reader, f.Name, fmt.Errorf("verification failed: read back %X", back))
+				return
+			}
+		}
+		report.applied(f.Name, fmt.Sprintf("%d bytes restored", len(want)))
+
+	case "linear":
+		restored := 0
+		for i, recHex := range f.Records {
+			want, err := hex.DecodeString(recHex)
+			if err != nil {
+				report.failed(nil, f.Name, fmt.Errorf("invalid record %d: %w", i+1, err))
+				return
+			}
+			rec := byte(i + 1)
+			if resp, err := reader.ReadRecord(rec, byte(len(want))); err == nil && resp.IsOK() && bytes.Equal(resp.Data, want) {
+				continue
+			}
+			resp, err := reader.UpdateRecord(rec, want)
+			if err != nil || !resp.IsOK() {
+				report.failed(reader, f.Name, fmt.Errorf("record %d: %v", rec, readErr(err, reader)))
+				return
+			}
+			if !report.simulate {
+				back, err := reader.ReadRecord(rec, byte(len(want)))
+				if err != nil || !back.IsOK() || !bytes.Equal(back.Data, want) {
+					report.failed(reader, f.Name, fmt.Errorf("verification of record %d failed", rec))
+					return
+				}
+			}
+			restored++
+		}
+		if restored == 0 {
+			report.unchanged(f.Name)
+			return
+		}
+		report.applied(f.Name, fmt.Sprintf("%d record(s) restored", restored))
+
+	default:
+		report.failed(nil, f.Name, fmt.Errorf("unsupported structure %q", f.Structure))
+	}
+}
@@ -0,0 +1,206 @@
+package sim
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ SNAPSHOT TESTS ============
+
+func TestSnapshotCredential(t *testing.T) {
+	tests := []struct {
+		access      string
+		wantCred    string
+		wantAssumed bool
+		wantOK      bool
+	}{
+		{"Always", "none", false, true},
+		{"PIN1", "PIN1", false, true},
+		{"Universal PIN", "PIN1", false, true},
+		{"PIN2", "PIN2", false, true},
+		{"ADM2", "ADM2", false, true},
+		{"PIN1/ADM1", "PIN1/ADM1", false, true},
+		{"PIN2&ADM1", "PIN2&ADM1", false, true},
+		{"?", "ADM1", true, true},
+		{"", "ADM1", true, true},
+		{"ARR#3", "ADM1", true, true},
+		{"Never", "", false, false},
+		{"ADM5", "", false, false},
+		{"ADM5&ADM1", "", false, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.access, func(t *testing.T) {
+			cred, assumed, ok := snapshotCredential(tc.access)
+			if cred != tc.wantCred || assumed != tc.wantAssumed || ok != tc.wantOK {
+				t.Errorf("snapshotCredential(%q) = %q, %v, %v, want %q, %v, %v",
+					tc.access, cred, assumed, ok, tc.wantCred, tc.wantAssumed, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestCredentialsSatisfies(t *testing.T) {
+	creds := Credentials{CredentialNone: true, CredentialADM1: true, CredentialPIN2: true}
+	tests := []struct {
+		credential string
+		want       bool
+	}{
+		{"none", true},
+		{"ADM1", true},
+		{"ADM2", false},
+		{"PIN1/ADM1", true},
+		{"PIN2&ADM1", true},
+		{"PIN1&ADM1", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.credential, func(t *testing.T) {
+			if got := creds.Satisfies(tc.credential); got != tc.want {
+				t.Errorf("Satisfies(%q) = %v, want %v", tc.credential, got, tc.want)
+			}
+		})
+	}
+}
+
+var snapshotTestICCID = []byte{0x98, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10, 0x32, 0x54, 0xF6}
+
+// newSnapshotTestCard returns a card with ADM1 = "12345678" and files protected by
+// Never (EF_ICCID), ADM1 (EF_PL, EF_IMSI, EF_MSISDN records) and ADM2 (EF_SPN)
+func newSnapshotTestCard(t *testing.T) (*card.MockCard, *card.Reader) {
+	t.Helper()
+	saved := StoredADMKey
+	StoredADMKey = []byte("12345678")
+	t.Cleanup(func() { StoredADMKey = saved })
+
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.Keys[0x0A] = []byte("12345678")
+	m.Keys[0x0B] = []byte("87654321")
+	mf := m.MF()
+	mf.AddEF(0x2FE2, append([]byte(nil), snapshotTestICCID...)).Security = []byte{0x30, 0xFF, 0x00}
+	mf.AddEF(0x2F05, []byte{0x65, 0x6E, 0xFF, 0xFF}).Security = []byte{0x30, 0x0A, 0x00}
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, []byte{0x08, 0x09, 0x10, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10}).Security = []byte{0x30, 0x0A, 0x00}
+	usim.AddEF(0x6F46, []byte{0x01, 0x41, 0x42, 0xFF}).Security = []byte{0x30, 0x0B, 0x00}
+	usim.AddRecordEF(0x6F40, []byte{0x00, 0xF1, 0x10}, []byte{0xFF, 0xFF, 0xFF}).Security = []byte{0x30, 0x0A, 0x00}
+	return m, card.NewReaderWithTransport("Mock", m.ATR, m)
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	_, reader := newSnapshotTestCard(t)
+
+	snap, err := TakeSnapshot(reader, StoredCredentials(false))
+	if err != nil {
+		t.Fatalf("TakeSnapshot() error = %v", err)
+	}
+	if snap.ICCID != DecodeICCID(snapshotTestICCID) {
+		t.Errorf("ICCID = %q", snap.ICCID)
+	}
+
+	var saved []string
+	for _, f := range snap.Files {
+		saved = append(saved, f.Application+"/"+f.Name+":"+f.Credential)
+	}
+	want := []string{"MF/EF_PL:ADM1", "ADF_USIM/EF_IMSI:ADM1", "ADF_USIM/EF_MSISDN:ADM1"}
+	if strings.Join(saved, ",") != strings.Join(want, ",") {
+		t.Errorf("saved files = %v, want %v", saved, want)
+	}
+	if msisdn := snap.Files[2]; msisdn.Structure != "linear" || len(msisdn.Records) != 2 || msisdn.Records[0] != "00F110" {
+		t.Errorf("EF_MSISDN = %+v", msisdn)
+	}
+
+	reasons := map[string]string{}
+	for _, s := range snap.Skipped {
+		reasons[s.Name] = s.Reason
+	}
+	if !strings.Contains(reasons["EF_ICCID"], "not writable") {
+		t.Errorf("EF_ICCID skip reason = %q", reasons["EF_ICCID"])
+	}
+	if reasons["EF_SPN"] != "requires ADM2" {
+		t.Errorf("EF_SPN skip reason = %q", reasons["EF_SPN"])
+	}
+}
+
+func TestRollbackSnapshot(t *testing.T) {
+	_, reader := newSnapshotTestCard(t)
+	snap, err := TakeSnapshot(reader, StoredCredentials(false))
+	if err != nil {
+		t.Fatalf("TakeSnapshot() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "before.snap")
+	if err := SaveSnapshot(path, snap); err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+
+	// Modify EF_IMSI and record 2 of EF_MSISDN behind the snapshot's back
+	reader.Select(AID_USIM)
+	reader.Select([]byte{0x6F, 0x07})
+	reader.UpdateBinary(0, []byte{0x08, 0x29})
+	reader.Select([]byte{0x6F, 0x40})
+	reader.UpdateRecord(2, []byte{0x13, 0x00, 0x14})
+
+	report, err := RollbackSnapshot(reader, loaded, StoredCredentials(false))
+	if err != nil {
+		t.Fatalf("RollbackSnapshot() error = %v", err)
+	}
+	if report.Applied != 2 || report.Unchanged != 1 {
+		t.Errorf("report = %d applied, %d unchanged, want 2, 1", report.Applied, report.Unchanged)
+	}
+
+	reader.Select(AID_USIM)
+	reader.Select([]byte{0x6F, 0x07})
+	if data, _ := reader.ReadAllBinary(9); !bytes.Equal(data[:2], []byte{0x08, 0x09}) {
+		t.Errorf("EF_IMSI = %X, not restored", data)
+	}
+	reader.Select([]byte{0x6F, 0x40})
+	if resp, _ := reader.ReadRecord(2, 3); !bytes.Equal(resp.Data, []byte{0xFF, 0xFF, 0xFF}) {
+		t.Errorf("EF_MSISDN record 2 = %X, not restored", resp.Data)
+	}
+}
+
+func TestRollbackSnapshot_FailsBeforeWriting(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(snap *Snapshot)
+		creds   Credentials
+		wantErr string
+	}{
+		{"missing credential", func(snap *Snapshot) {}, Credentials{CredentialNone: true}, "cannot restore 3 file(s)"},
+		{"other card", func(snap *Snapshot) { snap.ICCID = "8900000000000000000" }, nil, "snapshot was taken from card"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, reader := newSnapshotTestCard(t)
+			snap, err := TakeSnapshot(reader, StoredCredentials(false))
+			if err != nil {
+				t.Fatalf("TakeSnapshot() error = %v", err)
+			}
+			tc.modify(snap)
+			creds := tc.creds
+			if creds == nil {
+				creds = StoredCredentials(false)
+			}
+
+			m.Log = nil
+			_, err = RollbackSnapshot(reader, snap, creds)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("RollbackSnapshot() error = %v, want %q", err, tc.wantErr)
+			}
+			for _, apdu := range m.Log {
+				if apdu[1] == card.INS_UPDATE_BINARY || apdu[1] == card.INS_UPDATE_RECORD {
+					t.Errorf("write sent before the check failed: %X", apdu)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package sim
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/tlv"
+)
+
+// Steering of roaming files of TS 31.102 Rel-17. EF_FROMPREFERRED (ADF_USIM 6FF7, UST
+// service 131) is a single byte: b1 set tells the UE to apply the "from preferred"
+// behaviour of TS 23.122 when steering of roaming moves it to a higher priority PLMN,
+// b2-b8 are RFU. EF_SOR-CMCI (DF_5GS 4F0E, UST service 132) holds the steering of roaming
+// connected mode control information as BER-TLV objects padded with FF; tag 80 is the
+// SOR-CMCI value of TS 24.501 9.11.3.51A. Both specs are still moving: bits and objects
+// this code does not know are kept when the files are rewritten.
+var FID_EF_FROMPREFERRED = []byte{0x6F, 0xF7}
+
+const (
+	efSORCMCI  = 0x4F0E
+	sorCMCITag = 0x80
+)
+
+// ErrUSTTooShort is returned after a file was written when EF_UST has no byte for its
+// service: the UE may ignore the file until the service table is extended
+var ErrUSTTooShort = errors.New("EF_UST is too short for the service")
+
+// SORData is the content of the steering of roaming files read with --show-sor
+type SORData struct {
+	FromPreferred          *bool    `json:"from_preferred,omitempty"` // nil: EF_FROMPREFERRED not read
+	FromPreferredAvailable bool     `json:"from_preferred_available"` // UST service 131
+	CMCI                   *SORCMCI `json:"sor_cmci,omitempty"`
+	CMCIAvailable          bool     `json:"sor_cmci_available"` // UST service 132
+
+	FromPreferredStatus EFStatus `json:"-"`
+	CMCIStatus          EFStatus `json:"-"`
+}
+
+// SORCMCI is the decoded content of EF_SOR-CMCI
+type SORCMCI struct {
+	CMCI string `json:"cmci,omitempty"` // hex, TS 24.501 SOR-CMCI value (tag 80)
+
+	// Objects with other tags (later releases, vendor extensions). Read only: they are
+	// kept untouched when the file is rewritten.
+	Unknown []SORCMCITLV `json:"unknown,omitempty"`
+}
+
+// SORCMCITLV is an EF_SOR-CMCI object with a tag other than 80
+type SORCMCITLV struct {
+	Tag   string `json:"tag"`   // hex
+	Value string `json:"value"` // hex
+}
+
+// DecodeFromPreferred decodes EF_FROMPREFERRED; false without content
+func DecodeFromPreferred(data []byte) bool {
+	return len(data) > 0 && data[0]&0x01 != 0
+}
+
+// EncodeFromPreferred returns current with b1 of byte 1 set to enabled and the RFU bits
+// kept; a single byte when current is empty
+func EncodeFromPreferred(current []byte, enabled bool) []byte {
+	data := append([]byte(nil), current...)
+	if len(data) == 0 {
+		data = []byte{0x00}
+	}
+	if enabled {
+		data[0] |= 0x01
+	} else {
+		data[0] &^= 0x01
+	}
+	return data
+}
+
+// DecodeSORCMCI decodes EF_SOR-CMCI; nil if the file holds no object. A malformed object
+// ends decoding; the objects before it are returned.
+func DecodeSORCMCI(data []byte) *SORCMCI {
+	nodes, _ := tlv.Parse(data)
+	if len(nodes) == 0 {
+		return nil
+	}
+	c := &SORCMCI{}
+	for _, n := range nodes {
+		if n.Tag == sorCMCITag && c.CMCI == "" {
+			c.CMCI = fmt.Sprintf("%X", n.Value)
+			continue
+		}
+		c.Unknown = append(c.Unknown, SORCMCITLV{Tag: n.TagHex, Value: fmt.Sprintf("%X", n.Value)})
+	}
+	return c
+}
+
+// MergeSORCMCI returns the new content of EF_SOR-CMCI: current with the SOR-CMCI object
+// replaced or added. Objects with other tags keep their value and position. The result
+// is padded with FF to the length of current.
+func MergeSORCMCI(current []byte, update SORCMCI) ([]byte, error) {
+	value, err := hex.DecodeString(update.CMCI)
+	if err != nil || len(value) == 0 {
+		return nil, fmt.Errorf("invalid SOR-CMCI %q: expected hex bytes", update.CMCI)
+	}
+	nodes, err := tlv.Parse(current)
+	if err != nil {
+		return nil, fmt.Errorf("EF_SOR-CMCI content is not valid BER-TLV, refusing to rewrite: %w", err)
+	}
+
+	var out []byte
+	done := false
+	for _, n := range nodes {
+		if n.Tag == sorCMCITag && !done {
+			out = append(out, tlv.Encode(n.Tag, value)...)
+			done = true
+			continue
+		}
+		out = append(out, tlv.Encode(n.Tag, n.Value)...)
+	}
+	if !done {
+		out = append(tlv.Encode(sorCMCITag, value), out...)
+	}
+
+	if len(out) > len(current) {
+		return nil, fmt.Errorf("SOR-CMCI needs %d bytes, EF_SOR-CMCI has %d", len(out), len(current))
+	}
+	for len(out) < len(current) {
+		out = append(out, 0xFF)
+	}
+	return out, nil
+}
+
+// LoadSORCMCI reads the SOR-CMCI to write from a JSON (or YAML) file with the keys of
+// SORCMCI, e.g. {"cmci": "0A01..."}
+func LoadSORCMCI(filename string) (SORCMCI, error) {
+	var c SORCMCI
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return c, fmt.Errorf("failed to read SOR-CMCI file: %w", err)
+	}
+	if IsYAMLFile(filename) {
+		if data, err = yamlConfigToJSON(data); err != nil {
+			return c, fmt.Errorf("failed to parse SOR-CMCI file: %w", err)
+		}
+	}
+	if err := decodeConfigStrict(data, &c); err != nil {
+		return c, fmt.Errorf("failed to parse SOR-CMCI file: %w", err)
+	}
+	if len(c.Unknown) > 0 {
+		return c, fmt.Errorf("SOR-CMCI file: \"unknown\" objects cannot be written")
+	}
+	c.CMCI = strings.ReplaceAll(c.CMCI, " ", "")
+	if c.CMCI == "" {
+		return c, fmt.Errorf("SOR-CMCI file %s sets no cmci", filename)
+	}
+	if _, err := hex.DecodeString(c.CMCI); err != nil {
+		return c, fmt.Errorf("SOR-CMCI file: cmci is not hex: %w", err)
+	}
+	return c, nil
+}
+
+// ReadSOR reads EF_FROMPREFERRED, EF_SOR-CMCI and their UST services. Absent files are
+// recorded in the statuses, they are not an error.
+func ReadSOR(reader *card.Reader) (*SORData, error) {
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return nil, fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+	ust := DecodeUST(readTransparentEF(reader, []byte{0x6F, 0x38}))
+	data := &SORData{
+		FromPreferredAvailable: ust[UST_FROM_PREFERRED],
+		CMCIAvailable:          ust[UST_SOR_CMCI],
+	}
+
+	var raw []byte
+	raw, data.FromPreferredStatus = readEFStatus(reader, 0x6FF7)
+	if data.FromPreferredStatus.State == EFPresent {
+		v := DecodeFromPreferred(raw)
+		data.FromPreferred = &v
+	}
+
+	if data.CMCIStatus = selectDF5GS(reader); data.CMCIStatus.State == EFPresent {
+		raw, data.CMCIStatus = readEFStatus(reader, efSORCMCI)
+		if data.CMCIStatus.State == EFPresent {
+			data.CMCI = DecodeSORCMCI(raw)
+		}
+	}
+	return data, nil
+}
+
+// WriteFromPreferred sets the "from preferred" indicator of EF_FROMPREFERRED and marks
+// UST service 131 available. The file is written even when EF_UST is too short for the
+// service; the error is then ErrUSTTooShort.
+func WriteFromPreferred(reader *card.Reader, enabled bool) error {
+	if drv := FindDriver(reader); drv != nil {
+		if err := drv.PrepareWrite(reader); err != nil {
+			return fmt.Errorf("prepare write failed: %w", err)
+		}
+	}
+
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+	current, st := readEFStatus(reader, 0x6FF7)
+	if st.State != EFPresent {
+		if st.Err != nil {
+			return fmt.Errorf("EF_FROMPREFERRED: %w", st.Err)
+		}
+		return fmt.Errorf("EF_FROMPREFERRED not found (UST service %d)", UST_FROM_PREFERRED)
+	}
+
+	resp, err = reader.UpdateBinary(0, EncodeFromPreferred(current, enabled))
+	if err != nil {
+		return fmt.Errorf("failed to write EF_FROMPREFERRED: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("EF_FROMPREFERRED write failed: %s", resp.SWString())
+	}
+	return setUSTServiceIfRoom(reader, UST_FROM_PREFERRED)
+}
+
+// WriteSORCMCI updates the SOR-CMCI object of EF_SOR-CMCI in DF_5GS, keeping the other
+// objects, and marks UST service 132 available. The file is written even when EF_UST is
+// too short for the service; the error is then ErrUSTTooShort.
+func WriteSORCMCI(reader *card.Reader, update SORCMCI) error {
+	if len(update.Unknown) > 0 {
+		return fmt.Errorf("unknown SOR-CMCI objects cannot be written")
+	}
+	if drv := FindDriver(reader); drv != nil {
+		if err := drv.PrepareWrite(reader); err != nil {
+			return fmt.Errorf("prepare write failed: %w", err)
+		}
+	}
+
+	st := selectDF5GS(reader)
+	var current []byte
+	if st.State == EFPresent {
+		current, st = readEFStatus(reader, efSORCMCI)
+	}
+	if st.State != EFPresent {
+		if st.Err != nil {
+			return fmt.Errorf("EF_SOR-CMCI: %w", st.Err)
+		}
+		return fmt.Errorf("EF_SOR-CMCI not found in DF_5GS (UST service %d)", UST_SOR_CMCI)
+	}
+
+	data, err := MergeSORCMCI(current, update)
+	if err != nil {
+		return err
+	}
+	if err := reader.WriteAllBinary(data); err != nil {
+		return fmt.Errorf("failed to write EF_SOR-CMCI: %w", err)
+	}
+	return setUSTServiceIfRoom(reader, UST_SOR_CMCI)
+}
+
+// setUSTServiceIfRoom marks a UST service available; ErrUSTTooShort when EF_UST has no
+// byte for it (EncodeUST would silently drop the bit)
+func setUSTServiceIfRoom(reader *card.Reader, service int) error {
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+	ust := readTransparentEF(reader, []byte{0x6F, 0x38})
+	if need := (service + 7) / 8; len(ust) < need {
+		return fmt.Errorf("%w: service %d needs %d bytes, EF_UST has %d", ErrUSTTooShort, service, need, len(ust))
+	}
+	return SetUSIMServices(reader, map[int]bool{service: true})
+}
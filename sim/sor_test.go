@@ -0,0 +1,123 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ STEERING OF ROAMING TESTS ============
+
+// sorCMCITestFile is an EF_SOR-CMCI with the SOR-CMCI object and an object of a later release
+var sorCMCITestFile = []byte{0x80, 0x02, 0x01, 0x02, 0x9F, 0x20, 0x01, 0xAA, 0xFF, 0xFF, 0xFF, 0xFF}
+
+// newSORTestCard returns a USIM with EF_FROMPREFERRED (RFU bit 8 set), EF_SOR-CMCI in
+// DF_5GS and an EF_UST of ustLen bytes with no service set
+func newSORTestCard(ustLen int) (*card.Reader, *card.MockFile, *card.MockFile, *card.MockFile) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	usim := m.AddADF(AID_USIM)
+	ust := usim.AddEF(0x6F38, make([]byte, ustLen))
+	fromPreferred := usim.AddEF(0x6FF7, []byte{0x80})
+	cmci := usim.AddDF(0x5FC0).AddEF(0x4F0E, append([]byte(nil), sorCMCITestFile...))
+	return card.NewReaderWithTransport("Mock", m.ATR, m), ust, fromPreferred, cmci
+}
+
+func TestDecodeSORCMCI(t *testing.T) {
+	c := DecodeSORCMCI(sorCMCITestFile)
+	if c == nil || c.CMCI != "0102" || len(c.Unknown) != 1 || c.Unknown[0].Tag != "9F20" || c.Unknown[0].Value != "AA" {
+		t.Errorf("DecodeSORCMCI() = %+v, want cmci 0102 and unknown 9F20", c)
+	}
+	if c := DecodeSORCMCI(bytes.Repeat([]byte{0xFF}, 8)); c != nil {
+		t.Errorf("DecodeSORCMCI(empty file) = %+v, want nil", c)
+	}
+}
+
+func TestMergeSORCMCI(t *testing.T) {
+	got, err := MergeSORCMCI(sorCMCITestFile, SORCMCI{CMCI: "0A0B0C"})
+	if err != nil {
+		t.Fatalf("MergeSORCMCI() error = %v", err)
+	}
+	want := []byte{0x80, 0x03, 0x0A, 0x0B, 0x0C, 0x9F, 0x20, 0x01, 0xAA, 0xFF, 0xFF, 0xFF}
+	if !bytes.Equal(got, want) {
+		t.Errorf("MergeSORCMCI() = %X, want %X (unknown object kept)", got, want)
+	}
+
+	// A file without the object: SOR-CMCI is added in front of the other objects
+	got, err = MergeSORCMCI([]byte{0x9F, 0x20, 0x01, 0xAA, 0xFF, 0xFF, 0xFF, 0xFF}, SORCMCI{CMCI: "01"})
+	if err != nil || !bytes.Equal(got, []byte{0x80, 0x01, 0x01, 0x9F, 0x20, 0x01, 0xAA, 0xFF}) {
+		t.Errorf("MergeSORCMCI(no 80) = %X, %v", got, err)
+	}
+
+	if _, err := MergeSORCMCI(sorCMCITestFile, SORCMCI{CMCI: "0102030405060708"}); err == nil {
+		t.Error("MergeSORCMCI() larger than the file succeeded")
+	}
+	if _, err := MergeSORCMCI(sorCMCITestFile, SORCMCI{CMCI: "xyz"}); err == nil {
+		t.Error("MergeSORCMCI() with a value that is not hex succeeded")
+	}
+}
+
+func TestEncodeFromPreferred(t *testing.T) {
+	if got := EncodeFromPreferred([]byte{0x80}, true); !bytes.Equal(got, []byte{0x81}) {
+		t.Errorf("EncodeFromPreferred(80, true) = %X, want 81 (RFU bits kept)", got)
+	}
+	if got := EncodeFromPreferred([]byte{0x81, 0x00}, false); !bytes.Equal(got, []byte{0x80, 0x00}) {
+		t.Errorf("EncodeFromPreferred(8100, false) = %X, want 8000", got)
+	}
+	if !DecodeFromPreferred([]byte{0x01}) || DecodeFromPreferred([]byte{0xFE}) || DecodeFromPreferred(nil) {
+		t.Error("DecodeFromPreferred() does not follow b1")
+	}
+}
+
+func TestReadSOR(t *testing.T) {
+	reader, _, _, _ := newSORTestCard(17)
+	data, err := ReadSOR(reader)
+	if err != nil {
+		t.Fatalf("ReadSOR() error = %v", err)
+	}
+	if data.FromPreferred == nil || *data.FromPreferred || data.FromPreferredAvailable {
+		t.Errorf("from preferred = %v, available %v; want false, false", data.FromPreferred, data.FromPreferredAvailable)
+	}
+	if data.CMCI == nil || data.CMCI.CMCI != "0102" {
+		t.Errorf("SOR-CMCI = %+v, %+v", data.CMCI, data.CMCIStatus)
+	}
+
+	// A card without the files: recorded as absent, not an error
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(AID_USIM).AddEF(0x6F38, make([]byte, 8))
+	data, err = ReadSOR(card.NewReaderWithTransport("Mock", m.ATR, m))
+	if err != nil || data.FromPreferredStatus.State != EFAbsent || data.CMCIStatus.State != EFAbsent {
+		t.Errorf("ReadSOR(no files) = %+v, %v; want both absent", data, err)
+	}
+}
+
+func TestWriteSOR(t *testing.T) {
+	reader, ust, fromPreferred, cmci := newSORTestCard(17)
+	if err := WriteFromPreferred(reader, true); err != nil {
+		t.Fatalf("WriteFromPreferred() error = %v", err)
+	}
+	if err := WriteSORCMCI(reader, SORCMCI{CMCI: "0304"}); err != nil {
+		t.Fatalf("WriteSORCMCI() error = %v", err)
+	}
+	if fromPreferred.Data[0] != 0x81 {
+		t.Errorf("EF_FROMPREFERRED = %X, want 81", fromPreferred.Data)
+	}
+	if c := DecodeSORCMCI(cmci.Data); c == nil || c.CMCI != "0304" || len(c.Unknown) != 1 {
+		t.Errorf("EF_SOR-CMCI after write = %+v", c)
+	}
+	if services := DecodeUST(ust.Data); !services[UST_FROM_PREFERRED] || !services[UST_SOR_CMCI] {
+		t.Errorf("EF_UST = %X, want services 131 and 132", ust.Data)
+	}
+
+	// EF_UST without byte 17: the file is written, the missing service bit reported
+	reader, _, fromPreferred, _ = newSORTestCard(16)
+	err := WriteFromPreferred(reader, true)
+	if !errors.Is(err, ErrUSTTooShort) || !strings.Contains(err.Error(), "service 131") {
+		t.Errorf("WriteFromPreferred() error = %v, want ErrUSTTooShort", err)
+	}
+	if fromPreferred.Data[0] != 0x81 {
+		t.Errorf("EF_FROMPREFERRED = %X, want written despite the short EF_UST", fromPreferred.Data)
+	}
+}
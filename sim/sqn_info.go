@@ -0,0 +1,108 @@
+package sim
+
+import (
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// SQN read methods reported in SQNInfo.Method
+const (
+	SQNMethodCardFile = "card-file"   // read from the vendor SQN file by the driver
+	SQNMethodAUTS     = "auts-resync" // derived from the AUTS of an intentionally stale AUTHENTICATE
+)
+
+// SQNEntry is the last accepted SQN of one IND slot of the USIM SQN array
+type SQNEntry struct {
+	IND int    `json:"ind"`
+	SQN string `json:"sqn"`           // 48-bit SQN (hex)
+	SEQ uint64 `json:"seq"`           // SQN without the IND bits
+	Max bool   `json:"max,omitempty"` // Highest SQN of the array
+}
+
+// SQNInfo is the SQN state of the USIM (TS 33.102 Annex C), for Milenage resync debugging
+type SQNInfo struct {
+	Method     string     `json:"method"`           // SQNMethodCardFile or SQNMethodAUTS
+	Source     string     `json:"source"`           // File or command the value comes from
+	Scheme     *SQNConfig `json:"scheme,omitempty"` // IND length, delta, age limit and checks (card-file only)
+	Entries    []SQNEntry `json:"entries,omitempty"`
+	HighestSQN string     `json:"highest_sqn"` // Highest accepted SQN (SQNms for auts-resync)
+	Note       string     `json:"note,omitempty"`
+}
+
+// SQNInfoReader is implemented by drivers advertising CapReadSQN
+type SQNInfoReader interface {
+	ReadSQNInfo(reader *card.Reader) (*SQNInfo, error)
+}
+
+// NewSQNArrayInfo builds the SQNInfo of an SQN array read from a card file
+// (values[i] is the SQN stored for IND i)
+func NewSQNArrayInfo(source string, scheme *SQNConfig, values []uint64) *SQNInfo {
+	info := &SQNInfo{Method: SQNMethodCardFile, Source: source, Scheme: scheme}
+	indBits := 0
+	if scheme != nil && scheme.INDBits != nil {
+		indBits = *scheme.INDBits
+	}
+	highest := -1
+	for i, v := range values {
+		info.Entries = append(info.Entries, SQNEntry{IND: i, SQN: formatSQN(v), SEQ: v >> uint(indBits)})
+		if highest < 0 || v > values[highest] {
+			highest = i
+		}
+	}
+	if highest >= 0 {
+		info.Entries[highest].Max = true
+		info.HighestSQN = formatSQN(values[highest])
+	}
+	return info
+}
+
+func formatSQN(v uint64) string {
+	return fmt.Sprintf("%012X", v&(1<<48-1))
+}
+
+// ReadSQNInfo reads the SQN state of the card. Drivers with CapReadSQN read the SQN file
+// directly. Otherwise, if allowResync is set, SQNms is derived from an intentional sync
+// failure (DeriveSQNByResync), which needs the subscriber keys in cfg.
+func ReadSQNInfo(reader *card.Reader, drv ProgrammableDriver, cfg *AuthConfig, allowResync bool) (*SQNInfo, error) {
+	if p, ok := drv.(SQNInfoReader); ok && HasCapability(drv, CapReadSQN) {
+		return p.ReadSQNInfo(reader)
+	}
+	if !allowResync {
+		return nil, fmt.Errorf("card has no readable SQN file; deriving SQNms from AUTS sends a stale AUTHENTICATE and needs --auth-allow-resync")
+	}
+	if cfg == nil || len(cfg.K) == 0 || (len(cfg.OPc) == 0 && len(cfg.OP) == 0) {
+		return nil, fmt.Errorf("deriving SQNms from AUTS needs the subscriber keys (-k and --opc or --op)")
+	}
+	return DeriveSQNByResync(reader, cfg)
+}
+
+// DeriveSQNByResync sends AUTHENTICATE with SQN 0, which a USIM with SQN checking rejects
+// with AUTS, and decodes SQNms from it. This consumes a challenge and moves the card into a
+// resynchronisation, so it is only done on request.
+func DeriveSQNByResync(reader *card.Reader, cfg *AuthConfig) (*SQNInfo, error) {
+	c := *cfg
+	c.SQN = make([]byte, 6)
+	c.RAND, c.AUTN, c.AUTS = nil, nil, nil
+
+	result, err := RunAuthentication(reader, &c)
+	if err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("AUTHENTICATE: %s", result.Error)
+	}
+	if result.SQNms == "" {
+		if result.RESMatch {
+			return nil, fmt.Errorf("card accepted SQN 0: SQN checking is disabled, SQNms cannot be derived")
+		}
+		return nil, fmt.Errorf("card did not answer with AUTS (RES %s, keys or algorithm wrong?)", result.RES)
+	}
+	return &SQNInfo{
+		Method:     SQNMethodAUTS,
+		Source:     "AUTS of AUTHENTICATE with SQN 000000000000",
+		HighestSQN: strings.ToUpper(result.SQNms),
+		Note:       "SQNms is the highest SQN accepted by the card; use SQNms+1 (or higher) for the next AUTN",
+	}, nil
+}
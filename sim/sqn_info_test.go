@@ -0,0 +1,93 @@
+package sim
+
+import (
+	"strings"
+	"testing"
+
+	"sim_reader/algorithms"
+	"sim_reader/card"
+)
+
+// ============ SQN INFO TESTS ============
+
+func TestNewSQNArrayInfo(t *testing.T) {
+	ind := 5
+	info := NewSQNArrayInfo("EF.SQN", &SQNConfig{INDBits: &ind}, []uint64{0x21, 0x1E2, 0x43})
+	if info.HighestSQN != "0000000001E2" {
+		t.Errorf("HighestSQN = %s, want 0000000001E2", info.HighestSQN)
+	}
+	if e := info.Entries[1]; !e.Max || e.SEQ != 0x0F {
+		t.Errorf("entry 1 = %+v, want highest with SEQ 15", e)
+	}
+	if empty := NewSQNArrayInfo("EF.SQN", nil, nil); empty.HighestSQN != "" || len(empty.Entries) != 0 {
+		t.Errorf("empty array = %+v", empty)
+	}
+}
+
+// newResyncTestCard returns a USIM that answers every AUTHENTICATE with a sync failure
+// reporting sqnMS, and the auth config with its keys
+func newResyncTestCard(t *testing.T, sqnMS []byte) (*card.MockCard, *card.Reader, *AuthConfig) {
+	t.Helper()
+	cfg, err := ParseAuthConfig("465B5CE8B199B49FAA5F0A2EE238A6BC", "", "CD63CB71954A9F4E48A5994E37A02BAF",
+		"", "", "", "", "", "milenage", 0, 0)
+	if err != nil {
+		t.Fatalf("ParseAuthConfig() error = %v", err)
+	}
+
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(AID_USIM)
+	m.Override = func(apdu []byte) []byte {
+		if apdu[1] != 0x88 {
+			return nil
+		}
+		v := &algorithms.Variables{K: cfg.K, TOPC: cfg.OPc, RAND: apdu[6:22]}
+		if err := (&algorithms.Milenage{}).ComputeF5s(v); err != nil {
+			t.Fatalf("ComputeF5s() error = %v", err)
+		}
+		auts := append(algorithms.XORBytes(sqnMS, v.AKF5)[:6], make([]byte, 8)...)
+		return append(append([]byte{0xDC, 0x0E}, auts...), 0x90, 0x00)
+	}
+	return m, card.NewReaderWithTransport("Mock", m.ATR, m), cfg
+}
+
+func TestReadSQNInfo_Resync(t *testing.T) {
+	_, reader, cfg := newResyncTestCard(t, []byte{0x00, 0x00, 0x00, 0x00, 0x04, 0x41})
+
+	info, err := ReadSQNInfo(reader, nil, cfg, true)
+	if err != nil {
+		t.Fatalf("ReadSQNInfo() error = %v", err)
+	}
+	if info.Method != SQNMethodAUTS || info.HighestSQN != "000000000441" {
+		t.Errorf("ReadSQNInfo() = %+v, want auts-resync 000000000441", info)
+	}
+}
+
+func TestReadSQNInfo_ResyncNeedsOptIn(t *testing.T) {
+	tests := []struct {
+		name        string
+		withKeys    bool
+		allowResync bool
+		wantErr     string
+	}{
+		{"not allowed", true, false, "--auth-allow-resync"},
+		{"no keys", false, true, "needs the subscriber keys"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, reader, cfg := newResyncTestCard(t, make([]byte, 6))
+			if !tc.withKeys {
+				cfg = nil
+			}
+			_, err := ReadSQNInfo(reader, nil, cfg, tc.allowResync)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("ReadSQNInfo() error = %v, want %q", err, tc.wantErr)
+			}
+			for _, apdu := range m.Log {
+				if apdu[1] == 0x88 {
+					t.Errorf("AUTHENTICATE sent without opt-in: %X", apdu)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package sim
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"time"
+
+	"sim_reader/card"
+)
+
+// stressMaxTraces bounds the number of failing iterations whose full trace is kept
+const stressMaxTraces = 10
+
+// StressReport is the result of StressLoop. Every iteration is compared with the
+// first one; an iteration that differs is listed in Divergent.
+type StressReport struct {
+	ATR            string              `json:"atr"`
+	Started        string              `json:"started"`
+	Iterations     int                 `json:"iterations"` // requested
+	Completed      int                 `json:"completed"`
+	Interrupted    bool                `json:"interrupted,omitempty"`
+	ReferenceAPDUs int                 `json:"reference_apdus"`
+	Reference      []card.APDUExchange `json:"reference,omitempty"`
+	Divergent      []StressDivergence  `json:"divergent,omitempty"`
+}
+
+// StressDivergence describes one iteration that did not match the reference
+type StressDivergence struct {
+	Iteration  int                 `json:"iteration"`
+	Exchange   int                 `json:"exchange"` // index of the first differing APDU
+	Reason     string              `json:"reason"`
+	BitFlips   int                 `json:"bit_flips,omitempty"` // over all differing responses of the same length
+	Mismatches int                 `json:"mismatches"`          // number of differing exchanges
+	Trace      []card.APDUExchange `json:"trace,omitempty"`
+}
+
+// StandardRead is the read repeated by the stress loop: the USIM, then the ISIM.
+// A card without ISIM is not an error; its SELECT status is still in the trace.
+func StandardRead(reader *card.Reader) error {
+	if _, err := ReadUSIM(reader); err != nil {
+		return err
+	}
+	ReadISIM(reader)
+	return nil
+}
+
+// StressLoop runs read iterations times with every APDU traced and reports the
+// iterations whose exchanges differ from the first one: other status words or data
+// (with the number of flipped bits), transport errors such as timeouts, or a
+// different command sequence. A warm-up read runs first so caches filled by the
+// first read do not show up as differences. The reader is in read-only mode for the
+// whole loop; cancelling ctx stops it after the current iteration.
+func StressLoop(ctx context.Context, reader *card.Reader, iterations int, read func(*card.Reader) error) (*StressReport, error) {
+	if iterations < 1 {
+		return nil, fmt.Errorf("stress loop needs at least 1 iteration")
+	}
+	wasReadOnly := reader.ReadOnly()
+	reader.SetReadOnly(true)
+	defer reader.SetReadOnly(wasReadOnly)
+	defer reader.SetTrace(nil)
+
+	report := &StressReport{
+		ATR:        reader.ATRHex(),
+		Started:    time.Now().Format(time.RFC3339),
+		Iterations: iterations,
+	}
+	if err := read(reader); err != nil {
+		return report, fmt.Errorf("warm-up read failed: %w", err)
+	}
+
+	var trace []card.APDUExchange
+	reader.SetTrace(func(ex card.APDUExchange) { trace = append(trace, ex) })
+
+	for i := 1; i <= iterations; i++ {
+		if ctx.Err() != nil {
+			report.Interrupted = true
+			break
+		}
+		trace = nil
+		readErr := read(reader)
+		report.Completed++
+		if i == 1 {
+			report.Reference = trace
+			report.ReferenceAPDUs = len(trace)
+			if readErr != nil {
+				return report, fmt.Errorf("reference read failed: %w", readErr)
+			}
+			continue
+		}
+		if d := compareStressTrace(report.Reference, trace, readErr); d != nil {
+			d.Iteration = i
+			if len(report.Divergent) < stressMaxTraces {
+				d.Trace = trace
+			}
+			report.Divergent = append(report.Divergent, *d)
+		}
+	}
+	return report, nil
+}
+
+// compareStressTrace returns nil when trace matches the reference exchange by exchange
+func compareStressTrace(reference, trace []card.APDUExchange, readErr error) *StressDivergence {
+	var d *StressDivergence
+	note := func(idx int, reason string, flips int) {
+		if d == nil {
+			d = &StressDivergence{Exchange: idx, Reason: reason}
+		}
+		d.Mismatches++
+		d.BitFlips += flips
+	}
+
+compare:
+	for idx, ex := range trace {
+		if idx >= len(reference) {
+			note(idx, fmt.Sprintf("%d APDUs sent, reference has %d", len(trace), len(reference)), 0)
+			break
+		}
+		ref := reference[idx]
+		switch {
+		case ex.Error != "":
+			note(idx, fmt.Sprintf("APDU %d (%s): %s", idx, ex.Command, ex.Error), 0)
+		case ex.Command != ref.Command:
+			// The read took another path after an earlier difference: the rest cannot be compared
+			note(idx, fmt.Sprintf("APDU %d: command %s, reference %s", idx, ex.Command, ref.Command), 0)
+			break compare
+		case ex.Response != ref.Response:
+			flips, sameLen := countBitFlips(ref.Response, ex.Response)
+			if sameLen {
+				note(idx, fmt.Sprintf("APDU %d (%s): response differs in %d bit(s)", idx, ex.Command, flips), flips)
+			} else {
+				note(idx, fmt.Sprintf("APDU %d (%s): response %s, reference %s", idx, ex.Command, ex.Response, ref.Response), 0)
+			}
+		}
+	}
+	if d == nil && len(trace) < len(reference) {
+		note(len(trace), fmt.Sprintf("%d APDUs sent, reference has %d", len(trace), len(reference)), 0)
+	}
+	if readErr != nil {
+		note(len(trace), fmt.Sprintf("read failed: %v", readErr), 0)
+	}
+	return d
+}
+
+// countBitFlips counts the differing bits of two equal-length hex strings
+func countBitFlips(a, b string) (int, bool) {
+	x, errA := hex.DecodeString(a)
+	y, errB := hex.DecodeString(b)
+	if errA != nil || errB != nil || len(x) != len(y) {
+		return 0, false
+	}
+	n := 0
+	for i := range x {
+		n += bits.OnesCount8(x[i] ^ y[i])
+	}
+	return n, true
+}
@@ -0,0 +1,126 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ STRESS LOOP TESTS ============
+
+func TestStressLoop_StandardReadIsStable(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddEF(0x2FE2, []byte{0x98, 0x44, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xF0})
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F07, []byte{0x08, 0x29, 0x05, 0x88, 0x00, 0x00, 0x00, 0x00, 0x10})
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	report, err := StressLoop(context.Background(), reader, 3, StandardRead)
+	if err != nil {
+		t.Fatalf("StressLoop() error = %v", err)
+	}
+	if report.Completed != 3 || report.ReferenceAPDUs == 0 || len(report.Divergent) != 0 {
+		t.Errorf("report: completed %d, %d APDUs, divergent %+v", report.Completed, report.ReferenceAPDUs, report.Divergent)
+	}
+	if reader.ReadOnly() {
+		t.Error("read-only mode not restored")
+	}
+}
+
+func TestStressLoop_BitFlip(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddEF(0x2FE2, []byte{0x98, 0x44, 0x00, 0x10})
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	reads := 0
+	m.Override = func(apdu []byte) []byte {
+		if apdu[1] != 0xB0 {
+			return nil
+		}
+		reads++
+		if reads == 4 { // warm-up, reference, iteration 2, then iteration 3
+			return []byte{0x98, 0x45, 0x00, 0x11, 0x90, 0x00}
+		}
+		return nil
+	}
+	read := func(r *card.Reader) error {
+		if _, err := r.Select([]byte{0x2F, 0xE2}); err != nil {
+			return err
+		}
+		_, err := r.ReadBinary(0, 4)
+		return err
+	}
+
+	report, err := StressLoop(context.Background(), reader, 4, read)
+	if err != nil {
+		t.Fatalf("StressLoop() error = %v", err)
+	}
+	if len(report.Divergent) != 1 {
+		t.Fatalf("divergent = %+v, want iteration 3 only", report.Divergent)
+	}
+	d := report.Divergent[0]
+	if d.Iteration != 3 || d.Exchange != 2 || d.BitFlips != 2 || !strings.Contains(d.Reason, "2 bit(s)") {
+		t.Errorf("divergence = %+v, want iteration 3, APDU 2, 2 bits", d)
+	}
+	if len(d.Trace) != 3 || d.Trace[2].Response != "98450011"+"9000" {
+		t.Errorf("trace of failing iteration = %+v", d.Trace)
+	}
+}
+
+func TestStressLoop_Interrupted(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := 0
+	report, err := StressLoop(ctx, reader, 100, func(r *card.Reader) error {
+		if !r.ReadOnly() {
+			t.Error("reader not in read-only mode")
+		}
+		if n++; n == 3 {
+			cancel()
+		}
+		_, err := r.Select([]byte{0x3F, 0x00})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("StressLoop() error = %v", err)
+	}
+	if !report.Interrupted || report.Completed != 2 {
+		t.Errorf("interrupted %v, completed %d; want interrupted after 2", report.Interrupted, report.Completed)
+	}
+}
+
+func TestCompareStressTrace(t *testing.T) {
+	ref := []card.APDUExchange{
+		{Command: "00A40004023F00", Response: "9000"},
+		{Command: "00B0000002", Response: "01029000"},
+	}
+	tests := []struct {
+		name  string
+		trace []card.APDUExchange
+		err   error
+		want  string
+	}{
+		{"timeout", []card.APDUExchange{ref[0], {Command: "00B0000002", Error: "timeout"}}, nil, "timeout"},
+		{"other path", []card.APDUExchange{ref[0], {Command: "00B0000004", Response: "9000"}}, nil, "reference 00B0000002"},
+		{"length", []card.APDUExchange{ref[0], {Command: "00B0000002", Response: "6A82"}}, nil, "response 6A82, reference 01029000"},
+		{"short", ref[:1], nil, "1 APDUs sent, reference has 2"},
+		{"read error", ref, errors.New("boom"), "read failed: boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := compareStressTrace(ref, tt.trace, tt.err)
+			if d == nil || !strings.Contains(d.Reason, tt.want) {
+				t.Errorf("compareStressTrace() = %+v, want reason containing %q", d, tt.want)
+			}
+		})
+	}
+	if d := compareStressTrace(ref, ref, nil); d != nil {
+		t.Errorf("identical trace reported as %+v", d)
+	}
+}
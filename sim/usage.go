@@ -0,0 +1,220 @@
+package sim
+
+import (
+	"fmt"
+
+	"sim_reader/card"
+)
+
+// UsageStats is the fill level of the record files a bulk import writes to and the size of
+// every known EF, to check before an import whether the data fits
+type UsageStats struct {
+	Records    []RecordUsage `json:"records"`
+	Files      []EFSize      `json:"files"`
+	TotalBytes int           `json:"total_bytes"` // sum of Files sizes
+}
+
+// RecordUsage is the fill level of one record file. Transparent files made of fixed-size
+// entries (EF_OPLMNwACT) count their entries as records.
+type RecordUsage struct {
+	Name       string `json:"name"`
+	Location   string `json:"location"` // ADF_USIM, DF_TELECOM/DF_PHONEBOOK, ...
+	FID        string `json:"fid"`
+	RecordSize int    `json:"record_size"`
+	Records    int    `json:"records"`
+	Used       int    `json:"used"`
+	Free       int    `json:"free"`
+}
+
+// EFSize is the structure and size of an EF as its FCP states it
+type EFSize struct {
+	Application string `json:"application"` // MF, ADF_USIM, ADF_ISIM
+	Name        string `json:"name"`
+	FID         string `json:"fid"`
+	Structure   string `json:"structure"` // transparent, linear, cyclic
+	Size        int    `json:"size"`
+	RecordSize  int    `json:"record_size,omitempty"`
+	Records     int    `json:"records,omitempty"`
+}
+
+// usageFile is a file counted by CollectUsageStats
+type usageFile struct {
+	name      string
+	fid       []byte
+	entrySize int                 // entry size of a transparent file (0 = record file)
+	empty     func(b []byte) bool // free record; isEmptyRecord when nil
+}
+
+// CollectUsageStats reports the used and free records of EF_ADN (where ReadPhonebook finds
+// the phonebook), EF_SMS, EF_FDN, EF_SDN, EF_OPLMNwACT and EF_IMPU, and the FCP size of
+// every known EF of the MF, USIM and ISIM. Each record is read once; it is used unless
+// it is all FF (EF_SMS: status byte 00).
+func CollectUsageStats(reader *card.Reader) (*UsageStats, error) {
+	if UseGSMCommands {
+		return nil, fmt.Errorf("usage statistics need a UICC (GSM-only card)")
+	}
+	stats := &UsageStats{}
+	stats.Records = append(stats.Records, collectADNUsage(reader)...)
+
+	if resp, err := SelectUSIMWithAuth(reader); err == nil && resp.IsOK() {
+		for _, f := range []usageFile{
+			{name: "EF_SMS", fid: []byte{0x6F, 0x3C}, empty: isFreeSMSRecord},
+			{name: "EF_FDN", fid: []byte{0x6F, 0x3B}},
+			{name: "EF_SDN", fid: []byte{0x6F, 0x49}},
+			{name: "EF_OPLMNwACT", fid: []byte{0x6F, 0x61}, entrySize: 5},
+		} {
+			if u, ok := collectRecordUsage(reader, f, "ADF_USIM"); ok {
+				stats.Records = append(stats.Records, u)
+			}
+		}
+	}
+	if resp, err := SelectISIMWithAuth(reader); err == nil && resp.IsOK() {
+		if u, ok := collectRecordUsage(reader, usageFile{name: "EF_IMPU", fid: []byte{0x6F, 0x04}}, "ADF_ISIM"); ok {
+			stats.Records = append(stats.Records, u)
+		}
+	}
+
+	for _, app := range snapshotApplications() {
+		if err := app.selectFn(reader); err != nil {
+			if app.name == "MF" {
+				return nil, err
+			}
+			continue // application not present
+		}
+		for _, id := range sortedFileIDs(app.files) {
+			resp, err := reader.Select([]byte{byte(id >> 8), byte(id)})
+			if err != nil || !resp.IsOK() {
+				continue
+			}
+			ef := EFSize{
+				Application: app.name,
+				Name:        app.files[id].Name,
+				FID:         fmt.Sprintf("%04X", id),
+				Structure:   fcpStructure(resp.Data),
+				Size:        parseFCPFileSize(resp.Data),
+			}
+			if ef.Structure == "linear" || ef.Structure == "cyclic" {
+				ef.RecordSize = parseFCPRecordSize(resp.Data)
+				ef.Records = parseFCPNumRecords(resp.Data)
+			}
+			stats.Files = append(stats.Files, ef)
+			stats.TotalBytes += ef.Size
+		}
+	}
+	return stats, nil
+}
+
+// collectADNUsage counts the EF_ADN files of the phonebook ReadPhonebook reads: one per
+// EF_PBR record of a DF_PHONEBOOK (USIM, else DF_TELECOM), else the legacy EF_ADN
+func collectADNUsage(reader *card.Reader) []RecordUsage {
+	pbrADN := func(location string) ([]RecordUsage, bool) {
+		pbr, ok := readLinearEF(reader, FID_EF_PBR)
+		if !ok {
+			return nil, false
+		}
+		var usage []RecordUsage
+		for i, rec := range pbr {
+			for _, f := range ParsePBRRecord(rec) {
+				if f.Type != PBRType1 || f.Tag != PBRTagADN {
+					continue
+				}
+				name := "EF_ADN"
+				if len(pbr) > 1 {
+					name = fmt.Sprintf("EF_ADN (PBR %d)", i+1)
+				}
+				if u, ok := collectRecordUsage(reader, usageFile{name: name, fid: f.FID}, location); ok {
+					usage = append(usage, u)
+				}
+				break
+			}
+		}
+		return usage, true
+	}
+
+	if resp, err := reader.Select(GetUSIMAID()); err == nil && resp.IsOK() {
+		if resp, err := reader.SelectDF(FID_DF_PHONEBOOK); err == nil && resp.IsOK() {
+			if usage, ok := pbrADN(PhonebookUSIM); ok {
+				return usage
+			}
+		}
+	}
+	if !selectDFTelecom(reader) {
+		return nil
+	}
+	if resp, err := reader.SelectDF(FID_DF_PHONEBOOK); err == nil && resp.IsOK() {
+		if usage, ok := pbrADN(PhonebookTelecom); ok {
+			return usage
+		}
+		if !selectDFTelecom(reader) {
+			return nil
+		}
+	}
+	if u, ok := collectRecordUsage(reader, usageFile{name: "EF_ADN", fid: []byte{0x6F, 0x3A}}, "DF_TELECOM"); ok {
+		return []RecordUsage{u}
+	}
+	return nil
+}
+
+// collectRecordUsage selects f in the current DF and counts its used records; false when
+// the file is absent or its size unknown
+func collectRecordUsage(reader *card.Reader, f usageFile, location string) (RecordUsage, bool) {
+	u := RecordUsage{Name: f.name, Location: location, FID: fmt.Sprintf("%X", f.fid)}
+	resp, err := reader.Select(f.fid)
+	if err != nil || !resp.IsOK() {
+		return u, false
+	}
+	empty := f.empty
+	if empty == nil {
+		empty = isEmptyRecord
+	}
+
+	var records [][]byte
+	if f.entrySize > 0 {
+		size := parseFCPFileSize(resp.Data)
+		if size == 0 {
+			return u, false
+		}
+		data, err := reader.ReadAllBinary(size)
+		if err != nil {
+			return u, false
+		}
+		u.RecordSize, u.Records = f.entrySize, size/f.entrySize
+		for off := 0; off+f.entrySize <= len(data); off += f.entrySize {
+			records = append(records, data[off:off+f.entrySize])
+		}
+	} else {
+		u.RecordSize = parseFCPRecordSize(resp.Data)
+		if u.RecordSize == 0 {
+			return u, false
+		}
+		count := parseFCPNumRecords(resp.Data)
+		if count == 0 {
+			if size := parseFCPFileSize(resp.Data); size > 0 {
+				count = size / u.RecordSize
+			} else {
+				count = 254
+			}
+		}
+		for _, r := range readRecordsAbsolute(reader, u.RecordSize, count) {
+			records = append(records, r.data)
+		}
+		u.Records = len(records)
+		if parseFCPNumRecords(resp.Data) > 0 {
+			u.Records = count
+		}
+	}
+
+	for _, rec := range records {
+		if !empty(rec) {
+			u.Used++
+		}
+	}
+	u.Free = u.Records - u.Used
+	return u, true
+}
+
+// isFreeSMSRecord reports an EF_SMS record marked free (status 00, TS 31.102 4.2.25) or
+// never written
+func isFreeSMSRecord(rec []byte) bool {
+	return len(rec) == 0 || rec[0]&0x01 == 0 || isEmptyRecord(rec)
+}
@@ -0,0 +1,112 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ USAGE STATS TESTS ============
+
+func TestCollectUsageStats(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.MF().AddEF(0x2FE2, []byte{0x98, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10, 0x32, 0x54, 0x76})
+	usim := m.AddADF(AID_USIM)
+	empty := func(n int) []byte { return bytes.Repeat([]byte{0xFF}, n) }
+
+	// SMS: one read message, one free (status 00), one never written
+	sms := func(status byte) []byte { r := empty(176); r[0] = status; return r }
+	usim.AddRecordEF(0x6F3C, sms(0x01), sms(0x00), empty(176))
+	usim.AddRecordEF(0x6F3B, adnRecord("FDN", []byte{0x21, 0x43}, 0xFF), empty(18))
+	// OPLMNwACT: 2 of 4 entries set
+	usim.AddEF(0x6F61, append([]byte{0x62, 0xF2, 0x10, 0x80, 0x00, 0x62, 0xF2, 0x20, 0x40, 0x00}, empty(10)...))
+
+	isim := m.AddADF(AID_ISIM)
+	isim.AddRecordEF(0x6F04, append([]byte{0x80, 0x03}, []byte("sip")...), empty(5), empty(5))
+
+	telecom := m.MF().AddDF(0x7F10)
+	telecom.AddRecordEF(0x6F3A, empty(18), adnRecord("Eve", []byte{0x21, 0x43}, 0xFF), empty(18), empty(18))
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	stats, err := CollectUsageStats(reader)
+	if err != nil {
+		t.Fatalf("CollectUsageStats() error = %v", err)
+	}
+
+	want := map[string]RecordUsage{
+		"EF_ADN":       {Location: "DF_TELECOM", RecordSize: 18, Records: 4, Used: 1, Free: 3},
+		"EF_SMS":       {Location: "ADF_USIM", RecordSize: 176, Records: 3, Used: 1, Free: 2},
+		"EF_FDN":       {Location: "ADF_USIM", RecordSize: 18, Records: 2, Used: 1, Free: 1},
+		"EF_OPLMNwACT": {Location: "ADF_USIM", RecordSize: 5, Records: 4, Used: 2, Free: 2},
+		"EF_IMPU":      {Location: "ADF_ISIM", RecordSize: 5, Records: 3, Used: 1, Free: 2},
+	}
+	if len(stats.Records) != len(want) {
+		t.Fatalf("Records = %+v, want %d files", stats.Records, len(want))
+	}
+	for _, u := range stats.Records {
+		w, ok := want[u.Name]
+		if !ok {
+			t.Errorf("unexpected file %s", u.Name)
+			continue
+		}
+		w.Name, w.FID = u.Name, u.FID
+		if u != w {
+			t.Errorf("%s = %+v, want %+v", u.Name, u, w)
+		}
+	}
+
+	sizes := map[string]int{}
+	total := 0
+	for _, f := range stats.Files {
+		sizes[f.Application+"/"+f.Name] = f.Size
+		total += f.Size
+	}
+	if sizes["MF/EF_ICCID"] != 10 || sizes["ADF_USIM/EF_SMS"] != 3*176 || sizes["ADF_USIM/EF_OPLMNwACT"] != 20 {
+		t.Errorf("Files = %+v", stats.Files)
+	}
+	if stats.TotalBytes != total {
+		t.Errorf("TotalBytes = %d, want %d", stats.TotalBytes, total)
+	}
+}
+
+func TestCollectUsageStats_PBR(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	usim := m.AddADF(AID_USIM)
+	pb := usim.AddDF(0x5F3A)
+	// Two EF_PBR records, each with its own ADN file
+	pb.AddRecordEF(0x4F30,
+		[]byte{0xA8, 0x05, 0xC0, 0x03, 0x4F, 0x3A, 0x01},
+		[]byte{0xA8, 0x05, 0xC0, 0x03, 0x4F, 0x3B, 0x02})
+	pb.AddRecordEF(0x4F3A, adnRecord("A", []byte{0x21}, 0xFF), adnRecord("B", []byte{0x21}, 0xFF))
+	pb.AddRecordEF(0x4F3B, bytes.Repeat([]byte{0xFF}, 18), bytes.Repeat([]byte{0xFF}, 18))
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+	got := collectADNUsage(reader)
+	if len(got) != 2 {
+		t.Fatalf("collectADNUsage() = %+v, want 2 ADN files", got)
+	}
+	if got[0].Name != "EF_ADN (PBR 1)" || got[0].Location != PhonebookUSIM || got[0].Used != 2 || got[0].Free != 0 {
+		t.Errorf("first ADN = %+v", got[0])
+	}
+	if got[1].FID != "4F3B" || got[1].Used != 0 || got[1].Free != 2 {
+		t.Errorf("second ADN = %+v", got[1])
+	}
+}
+
+func TestIsFreeSMSRecord(t *testing.T) {
+	tests := []struct {
+		rec  []byte
+		want bool
+	}{
+		{[]byte{0x00, 0xFF, 0xFF}, true},
+		{[]byte{0xFF, 0xFF, 0xFF}, true},
+		{[]byte{0x01, 0x00, 0x07}, false},
+		{[]byte{0x07, 0x00, 0x07}, false},
+	}
+	for _, tt := range tests {
+		if got := isFreeSMSRecord(tt.rec); got != tt.want {
+			t.Errorf("isFreeSMSRecord(%X) = %v, want %v", tt.rec, got, tt.want)
+		}
+	}
+}
@@ -13,6 +13,16 @@ type USIMData struct {
 	MSISDN string
 	SPN    string
 
+	// SMS over IP
+	PSISMSC       string // Public service identity of the SM-SC (EF_PSISMSC)
+	PSISMSCSource string // PSISMSCInTelecom or PSISMSCInUSIM
+
+	// Default SMS parameters (EF_SMSP record 1, nil if unused)
+	SMSP *SMSParams
+
+	// Mailbox numbers and message waiting status (EF_MBDN, EF_MBI, EF_MWIS; nil if absent)
+	Voicemail *Voicemail
+
 	// Network
 	MCC      string
 	MNC      string
@@ -21,6 +31,7 @@ type USIMData struct {
 	HPLMN    []PLMNwACT
 	OPLMN    []PLMNwACT
 	FPLMN    []string
+	FPLMNs   []PLMN // FPLMN with MCC/MNC split (EF_FPLMN)
 	UserPLMN []PLMNwACT
 
 	// Administrative
@@ -29,6 +40,12 @@ type USIMData struct {
 	Languages   []string // Preferred languages (EF_LI)
 	HPLMNPeriod int      // HPLMN search period in minutes (EF_HPPLMN)
 
+	// NAS configuration for IoT devices (EF_NASCONFIG, nil if absent or empty)
+	NASConfig *NASConfig
+
+	// APN control list (EF_ACL, nil if absent)
+	ACL *ACL
+
 	// Location Information
 	LOCI    *LocationInfo    // CS domain location (EF_LOCI)
 	PSLOCI  *PSLocationInfo  // PS domain location (EF_PSLOCI)
@@ -43,6 +60,12 @@ type USIMData struct {
 
 	// Raw data for debugging
 	RawFiles map[string][]byte
+
+	// Read outcome per EF (present, absent or failed)
+	Files FileStatuses
+
+	// Consistency problems between files (e.g. MNC length in EF_AD vs EF_HPLMNwACT)
+	Warnings []string
 }
 
 // LocationInfo contains CS domain location info (EF_LOCI)
@@ -73,8 +96,13 @@ var DebugUSIM = false
 
 // ReadUSIM reads all USIM application data
 func ReadUSIM(reader *card.Reader) (*USIMData, error) {
+	if IsClassicSIM() {
+		return nil, ErrClassicSIM
+	}
+	defer reader.Measure("read USIM")()
 	data := &USIMData{
 		RawFiles: make(map[string][]byte),
+		Files:    make(FileStatuses),
 	}
 
 	// First read ICCID from MF (doesn't require USIM selection)
@@ -86,6 +114,9 @@ func ReadUSIM(reader *card.Reader) (*USIMData, error) {
 		}
 	}
 
+	// EF_PSISMSC in DF_TELECOM, read while the MF is current
+	psismscRaw, psismscStatus := readTelecomPSISMSC(reader)
+
 	// Select USIM application
 	// Try multiple methods:
 	// 1. Select by detected AID
@@ -113,7 +144,7 @@ func ReadUSIM(reader *card.Reader) (*USIMData, error) {
 	}
 
 	// Method 2: Try standard AID if detected failed
-	if !usimSelected && len(DetectedUSIM_AID) > 0 {
+	if !usimSelected && len(DetectedUSIM_AID) > 0 && usimFallbackAllowed() {
 		resp, err = reader.Select(AID_USIM)
 		if err == nil && resp.IsOK() {
 			usimSelected = true
@@ -141,7 +172,7 @@ func ReadUSIM(reader *card.Reader) (*USIMData, error) {
 	if !usimSelected {
 		swStr := "unknown error"
 		if resp != nil {
-			swStr = card.SWToString(resp.SW())
+			swStr = resp.SWString()
 		}
 		return nil, fmt.Errorf("USIM selection failed: %s (card may not support AID selection)", swStr)
 	}
@@ -150,120 +181,166 @@ func ReadUSIM(reader *card.Reader) (*USIMData, error) {
 	if DebugUSIM {
 		fmt.Printf("DEBUG USIM: Reading IMSI (0x6F07)...\n")
 	}
-	if _, raw, err := readEF(reader, 0x6F07); err == nil {
+	if raw, ok := data.Files.readTracked(reader, "EF_IMSI", 0x6F07); ok {
 		data.IMSI = DecodeIMSI(raw)
 		data.RawFiles["EF_IMSI"] = raw
-		// Extract MCC/MNC from IMSI
-		if len(data.IMSI) >= 5 {
-			data.MCC = data.IMSI[:3]
-			// Try to determine MNC length from AD
-			data.MNC = data.IMSI[3:5] // Default 2 digits
-		}
-	} else {
-		if DebugUSIM {
-			fmt.Printf("DEBUG USIM: IMSI read error: %v\n", err)
-		}
-		fmt.Printf("Warning: could not read IMSI: %v\n", err)
+	} else if DebugUSIM {
+		fmt.Printf("DEBUG USIM: IMSI read status: %+v\n", data.Files["EF_IMSI"])
 	}
 
 	// Read Administrative Data (includes MNC length)
-	if _, raw, err := readEF(reader, 0x6FAD); err == nil {
+	if raw, ok := data.Files.readTracked(reader, "EF_AD", 0x6FAD); ok {
 		data.AdminData = DecodeAD(raw)
 		data.RawFiles["EF_AD"] = raw
-		// Update MNC based on AD
-		if data.AdminData.MNCLength == 3 && len(data.IMSI) >= 6 {
-			data.MNC = data.IMSI[3:6]
-		}
 	}
 
+	// Split MCC/MNC from IMSI with the MNC length from AD
+	data.MCC, data.MNC = SplitIMSI(data.IMSI, data.AdminData.MNCLength)
+
 	// Set country and operator names
 	data.Country = GetMCCCountry(data.MCC)
 	data.Operator = GetOperatorName(data.MCC, data.MNC)
 
+	// Read UST (USIM Service Table) first: optional EFs whose service is not available are
+	// not selected (see ustServiceFiles and ReadAllFiles)
+	if raw, ok := data.Files.readTracked(reader, "EF_UST", 0x6F38); ok {
+		data.UST = DecodeUST(raw)
+		data.RawFiles["EF_UST"] = raw
+	}
+
 	// Read SPN
-	if _, raw, err := readEF(reader, 0x6F46); err == nil {
-		data.SPN = DecodeSPN(raw)
-		data.RawFiles["EF_SPN"] = raw
+	if !data.skipUnlessService("EF_SPN") {
+		if raw, ok := data.Files.readTracked(reader, "EF_SPN", 0x6F46); ok {
+			data.SPN = DecodeSPN(raw)
+			data.RawFiles["EF_SPN"] = raw
+		}
 	}
 
 	// Read MSISDN (linear fixed file)
-	if msisdn, raw := readMSISDN(reader); msisdn != "" {
-		data.MSISDN = msisdn
-		data.RawFiles["EF_MSISDN"] = raw
+	if !data.skipUnlessService("EF_MSISDN") {
+		msisdn, raw, st := readMSISDN(reader)
+		data.Files["EF_MSISDN"] = st
+		if msisdn != "" {
+			data.MSISDN = msisdn
+			data.RawFiles["EF_MSISDN"] = raw
+		}
 	}
 
-	// Read UST (USIM Service Table)
-	if _, raw, err := readEF(reader, 0x6F38); err == nil {
-		data.UST = DecodeUST(raw)
-		data.RawFiles["EF_UST"] = raw
+	// Read SMS parameters (linear fixed file, record 1)
+	if !data.skipUnlessService("EF_SMSP") {
+		smspRaw, smspStatus := readSMSP(reader)
+		data.Files["EF_SMSP"] = smspStatus
+		if smspStatus.State == EFPresent {
+			data.SMSP = DecodeSMSP(smspRaw)
+			data.RawFiles["EF_SMSP"] = smspRaw
+		}
 	}
 
 	// Read EST (Enabled Services Table)
-	if _, raw, err := readEF(reader, 0x6F56); err == nil {
-		data.EST = DecodeUST(raw)
-		data.RawFiles["EF_EST"] = raw
+	if !data.skipUnlessService("EF_EST") {
+		if raw, ok := data.Files.readTracked(reader, "EF_EST", 0x6F56); ok {
+			data.EST = DecodeUST(raw)
+			data.RawFiles["EF_EST"] = raw
+		}
+	}
+
+	// Read ACL (APN Control List), enabled per UST and EST
+	if !data.skipUnlessService("EF_ACL") {
+		data.readACL(reader)
 	}
 
 	// Read ACC
-	if _, raw, err := readEF(reader, 0x6F78); err == nil {
+	if raw, ok := data.Files.readTracked(reader, "EF_ACC", 0x6F78); ok {
 		data.ACC = DecodeACC(raw)
 		data.RawFiles["EF_ACC"] = raw
 	}
 
 	// Read HPLMN with ACT
-	if _, raw, err := readEF(reader, 0x6F62); err == nil {
-		data.HPLMN = DecodePLMNwACT(raw)
-		data.RawFiles["EF_HPLMNwACT"] = raw
+	if !data.skipUnlessService("EF_HPLMNwACT") {
+		if raw, ok := data.Files.readTracked(reader, "EF_HPLMNwACT", 0x6F62); ok {
+			data.HPLMN = DecodePLMNwACT(raw)
+			data.RawFiles["EF_HPLMNwACT"] = raw
+			if w := CheckMNCLength(data.AdminData.MNCLength, data.IMSI, data.HPLMN); w != "" {
+				data.Warnings = append(data.Warnings, w)
+			}
+		}
 	}
 
 	// Read Operator PLMN with ACT
-	if _, raw, err := readEF(reader, 0x6F61); err == nil {
-		data.OPLMN = DecodePLMNwACT(raw)
-		data.RawFiles["EF_OPLMNwACT"] = raw
+	if !data.skipUnlessService("EF_OPLMNwACT") {
+		if raw, ok := data.Files.readTracked(reader, "EF_OPLMNwACT", 0x6F61); ok {
+			data.OPLMN = DecodePLMNwACT(raw)
+			data.RawFiles["EF_OPLMNwACT"] = raw
+		}
 	}
 
 	// Read User PLMN with ACT
-	if _, raw, err := readEF(reader, 0x6F60); err == nil {
-		data.UserPLMN = DecodePLMNwACT(raw)
-		data.RawFiles["EF_PLMNwACT"] = raw
+	if !data.skipUnlessService("EF_PLMNwACT") {
+		if raw, ok := data.Files.readTracked(reader, "EF_PLMNwACT", 0x6F60); ok {
+			data.UserPLMN = DecodePLMNwACT(raw)
+			data.RawFiles["EF_PLMNwACT"] = raw
+		}
 	}
 
 	// Read Forbidden PLMN
-	if _, raw, err := readEF(reader, 0x6F7B); err == nil {
+	if raw, ok := data.Files.readTracked(reader, "EF_FPLMN", 0x6F7B); ok {
 		data.FPLMN = DecodePLMNList(raw)
+		data.FPLMNs = DecodeFPLMN(raw)
 		data.RawFiles["EF_FPLMN"] = raw
 	}
 
 	// Read Language Indication (EF_LI)
-	if _, raw, err := readEF(reader, 0x6F05); err == nil {
+	if raw, ok := data.Files.readTracked(reader, "EF_LI", 0x6F05); ok {
 		data.Languages = DecodeLanguages(raw)
 		data.RawFiles["EF_LI"] = raw
 	}
 
 	// Read HPLMN search period (EF_HPPLMN)
-	if _, raw, err := readEF(reader, 0x6F31); err == nil {
+	if raw, ok := data.Files.readTracked(reader, "EF_HPPLMN", 0x6F31); ok {
 		data.HPLMNPeriod = DecodeHPLMNPeriod(raw)
 		data.RawFiles["EF_HPPLMN"] = raw
 	}
 
+	// Read NAS configuration (EF_NASCONFIG, TS 24.368 parameters)
+	if !data.skipUnlessService("EF_NASCONFIG") {
+		if raw, ok := data.Files.readTracked(reader, "EF_NASCONFIG", 0x6FE8); ok {
+			data.NASConfig = DecodeNASConfig(raw)
+			data.RawFiles["EF_NASCONFIG"] = raw
+		}
+	}
+
 	// Read Location Information (EF_LOCI)
-	if _, raw, err := readEF(reader, 0x6F7E); err == nil {
+	if raw, ok := data.Files.readTracked(reader, "EF_LOCI", 0x6F7E); ok {
 		data.LOCI = DecodeLOCI(raw)
 		data.RawFiles["EF_LOCI"] = raw
 	}
 
 	// Read PS Location Information (EF_PSLOCI)
-	if _, raw, err := readEF(reader, 0x6FAE); err == nil {
+	if raw, ok := data.Files.readTracked(reader, "EF_PSLOCI", 0x6FAE); ok {
 		data.PSLOCI = DecodePSLOCI(raw)
 		data.RawFiles["EF_PSLOCI"] = raw
 	}
 
 	// Read EPS Location Information (EF_EPSLOCI)
-	if _, raw, err := readEF(reader, 0x6FE3); err == nil {
-		data.EPSLOCI = DecodeEPSLOCI(raw)
-		data.RawFiles["EF_EPSLOCI"] = raw
+	if !data.skipUnlessService("EF_EPSLOCI") {
+		if raw, ok := data.Files.readTracked(reader, "EF_EPSLOCI", 0x6FE3); ok {
+			data.EPSLOCI = DecodeEPSLOCI(raw)
+			data.RawFiles["EF_EPSLOCI"] = raw
+		}
+	}
+
+	// Read PSI of the SM-SC (ADF_USIM copy if DF_TELECOM has none)
+	data.setPSISMSC(reader, psismscRaw, psismscStatus)
+	if w := data.psismscServiceWarning(); w != "" {
+		data.Warnings = append(data.Warnings, w)
 	}
 
+	// Read voicemail configuration (DF_TELECOM copy if ADF_USIM has none)
+	data.readVoicemail(reader)
+
+	// Check DF_GSM-ACCESS (Kc files for GSM access)
+	data.readGSMAccess(reader)
+
 	return data, nil
 }
 
@@ -316,6 +393,23 @@ func ReadICCIDQuick(reader *card.Reader) (string, error) {
 	return "", err2
 }
 
+// ReadIMSIQuick reads EF_IMSI of the USIM without reading the rest of the application.
+// The read needs PIN1 (or ADM) on most cards; the error tells why it failed.
+func ReadIMSIQuick(reader *card.Reader) (string, error) {
+	if _, err := SelectUSIMWithAuth(reader); err != nil {
+		return "", err
+	}
+	_, raw, err := readEF(reader, 0x6F07)
+	if err != nil {
+		return "", err
+	}
+	imsi := DecodeIMSI(raw)
+	if imsi == "" {
+		return "", fmt.Errorf("EF_IMSI is empty")
+	}
+	return imsi, nil
+}
+
 // readICCIDWithRaw reads ICCID from MF and returns raw data
 func readICCIDWithRaw(reader *card.Reader) (string, []byte, error) {
 	var resp *card.APDUResponse
@@ -334,7 +428,7 @@ func readICCIDWithRaw(reader *card.Reader) (string, []byte, error) {
 		return "", nil, err
 	}
 	if !resp.IsOK() {
-		return "", nil, fmt.Errorf("select failed: %s", card.SWToString(resp.SW()))
+		return "", nil, fmt.Errorf("select failed: %s", resp.SWString())
 	}
 
 	// Read binary
@@ -348,7 +442,7 @@ func readICCIDWithRaw(reader *card.Reader) (string, []byte, error) {
 		return "", nil, err
 	}
 	if !resp.IsOK() {
-		return "", nil, fmt.Errorf("read failed: %s", card.SWToString(resp.SW()))
+		return "", nil, fmt.Errorf("read failed: %s", resp.SWString())
 	}
 
 	return DecodeICCID(resp.Data), resp.Data, nil
@@ -356,23 +450,21 @@ func readICCIDWithRaw(reader *card.Reader) (string, []byte, error) {
 
 // readEF selects and reads a transparent EF file
 func readEF(reader *card.Reader, fileID uint16) (string, []byte, error) {
-	// Select file
-	fid := []byte{byte(fileID >> 8), byte(fileID & 0xFF)}
-
-	var resp *card.APDUResponse
-	var err error
-
-	if UseGSMCommands {
-		resp, err = reader.SelectGSM(fid)
-	} else {
-		resp, err = reader.Select(fid)
+	data, st := readEFStatus(reader, fileID)
+	switch st.State {
+	case EFAbsent:
+		return "", nil, fmt.Errorf("select 0x%04X failed: %s", fileID, card.SWToString(st.SW))
+	case EFError:
+		return "", nil, st.Err
 	}
+	return fmt.Sprintf("%X", data), data, nil
+}
 
-	if err != nil {
-		return "", nil, err
-	}
-	if !resp.IsOK() {
-		return "", nil, fmt.Errorf("select 0x%04X failed: %s", fileID, card.SWToString(resp.SW()))
+// readEFStatus selects and reads a transparent EF file, telling an absent file apart from a failed read
+func readEFStatus(reader *card.Reader, fileID uint16) ([]byte, EFStatus) {
+	resp, st := selectEFStatus(reader, fileID)
+	if st.State != EFPresent {
+		return nil, st
 	}
 
 	// Parse response to get file size
@@ -417,32 +509,24 @@ func readEF(reader *card.Reader, fileID uint16) (string, []byte, error) {
 			}
 		}
 	} else {
-		data, err = reader.ReadAllBinary(fileSize)
+		var err error
+		data, err = readTransparent(reader, fileID, resp.Data, fileSize)
 		if err != nil {
-			return "", nil, err
+			return nil, EFStatus{State: EFError, SW: reader.LastSW(), Err: err}
 		}
 	}
 
-	return fmt.Sprintf("%X", data), data, nil
+	return data, EFStatus{State: EFPresent}
 }
 
 // readMSISDN reads MSISDN from linear fixed file
-func readMSISDN(reader *card.Reader) (string, []byte) {
+func readMSISDN(reader *card.Reader) (string, []byte, EFStatus) {
 	// Select EF_MSISDN
-	fid := []byte{0x6F, 0x40}
-
-	var resp *card.APDUResponse
-	var err error
-
-	if UseGSMCommands {
-		resp, err = reader.SelectGSM(fid)
-	} else {
-		resp, err = reader.Select(fid)
-	}
-
-	if err != nil || !resp.IsOK() {
-		return "", nil
+	resp, st := selectEFStatus(reader, 0x6F40)
+	if st.State != EFPresent {
+		return "", nil, st
 	}
+	var err error
 
 	// Parse response to get record length
 	var recordLen int
@@ -452,7 +536,7 @@ func readMSISDN(reader *card.Reader) (string, []byte) {
 		if len(resp.Data) >= 15 {
 			recordLen = int(resp.Data[14])
 		}
-	} else {
+	} else if recordLen = fileMapRecordSize(reader, 0x6F40); recordLen == 0 {
 		recordLen = parseFCPRecordSize(resp.Data)
 	}
 
@@ -467,11 +551,14 @@ func readMSISDN(reader *card.Reader) (string, []byte) {
 		resp, err = reader.ReadRecord(1, byte(recordLen))
 	}
 
-	if err != nil || !resp.IsOK() {
-		return "", nil
+	if err != nil {
+		return "", nil, EFStatus{State: EFError, Err: err}
+	}
+	if !resp.IsOK() {
+		return "", nil, EFStatus{State: EFError, SW: resp.SW(), Err: fmt.Errorf("read EF_MSISDN failed: %s", resp.SWString())}
 	}
 
-	return DecodeMSISDN(resp.Data), resp.Data
+	return DecodeMSISDN(resp.Data), resp.Data, st
 }
 
 // parseTLVLength parses TLV length field (handles extended length format)
@@ -515,111 +602,36 @@ func parseTLVLength(data []byte, offset int) (int, int) {
 	return 0, 0
 }
 
-// parseFCPFileSize extracts file size from FCP template
-// Supports both tag 0x80 (standard) and 0x81 (some card variants)
-// Handles extended length format
-func parseFCPFileSize(fcp []byte) int {
-	// FCP Template: 62 Len [TLV...]
-	// File size tag: 80 or 81
-	if len(fcp) < 4 {
-		return 0
-	}
-
-	idx := 0
-	if fcp[0] == 0x62 {
-		// Parse template length (may be extended)
-		_, lenBytes := parseTLVLength(fcp, 1)
-		if lenBytes == 0 {
-			idx = 2 // Fallback to simple length
-		} else {
-			idx = 1 + lenBytes
-		}
-	}
-
-	for idx < len(fcp)-1 {
-		tag := fcp[idx]
-
-		// Parse length (handles extended format)
-		length, lenBytes := parseTLVLength(fcp, idx+1)
-		if lenBytes == 0 {
-			break
-		}
-
-		valueStart := idx + 1 + lenBytes
-		if valueStart+length > len(fcp) {
-			break
-		}
-
-		// Tag 0x80: File size (standard ETSI TS 102 221)
-		if tag == 0x80 && length >= 2 {
-			return int(fcp[valueStart])<<8 | int(fcp[valueStart+1])
-		}
-
-		// Tag 0x81: File size (used by some cards, e.g., proprietary)
-		if tag == 0x81 && length >= 2 {
-			return int(fcp[valueStart])<<8 | int(fcp[valueStart+1])
-		}
+// FCPInfo is the layout of a file from its SELECT response
+type FCPInfo struct {
+	Structure  string // transparent, linear, cyclic or DF
+	Size       int    // file size in bytes
+	RecordSize int    // linear fixed / cyclic record length
+	Records    int    // number of records
+}
 
-		idx = valueStart + length
+// ParseFCPInfo extracts the structure, size and record layout from an FCP template
+func ParseFCPInfo(fcp []byte) FCPInfo {
+	f, _ := card.ParseFCP(fcp)
+	return FCPInfo{
+		Structure:  f.Structure(),
+		Size:       f.Size(),
+		RecordSize: f.RecordSize(),
+		Records:    f.NumRecords(),
 	}
+}
 
-	return 0
+// parseFCPFileSize returns the file size of an FCP template (tag 80, else 81), 0 if unknown
+func parseFCPFileSize(fcp []byte) int {
+	f, _ := card.ParseFCP(fcp)
+	return f.Size()
 }
 
-// parseFCPRecordSize extracts record size from FCP template
-// Handles extended length format
+// parseFCPRecordSize returns the record size of an FCP template (tag 82), 0 for
+// transparent files
 func parseFCPRecordSize(fcp []byte) int {
-	// Record size is in tag 82 (File Descriptor)
-	if len(fcp) < 4 {
-		return 0
-	}
-
-	idx := 0
-	if fcp[0] == 0x62 {
-		// Parse template length (may be extended)
-		_, lenBytes := parseTLVLength(fcp, 1)
-		if lenBytes == 0 {
-			idx = 2 // Fallback to simple length
-		} else {
-			idx = 1 + lenBytes
-		}
-	}
-
-	for idx < len(fcp)-1 {
-		tag := fcp[idx]
-
-		// Parse length (handles extended format)
-		length, lenBytes := parseTLVLength(fcp, idx+1)
-		if lenBytes == 0 {
-			break
-		}
-
-		valueStart := idx + 1 + lenBytes
-		if valueStart+length > len(fcp) {
-			break
-		}
-
-		// Tag 0x82: File descriptor (ETSI TS 102 221)
-		// Format: file_desc_byte | data_coding | record_len(2) | num_records
-		if tag == 0x82 && length >= 5 {
-			recordLen := int(fcp[valueStart+2])<<8 | int(fcp[valueStart+3])
-			if recordLen > 0 {
-				return recordLen
-			}
-		}
-
-		// Some cards use shorter format: file_desc_byte | record_len(2)
-		if tag == 0x82 && length == 3 {
-			recordLen := int(fcp[valueStart+1])<<8 | int(fcp[valueStart+2])
-			if recordLen > 0 {
-				return recordLen
-			}
-		}
-
-		idx = valueStart + length
-	}
-
-	return 0
+	f, _ := card.ParseFCP(fcp)
+	return f.RecordSize()
 }
 
 // FileAccessInfo contains access conditions for a file
@@ -633,73 +645,31 @@ type FileAccessInfo struct {
 // parseFCPSecurityAttributes extracts security attributes from FCP template
 // Returns read and write access conditions as human-readable strings
 func parseFCPSecurityAttributes(fcp []byte) (readAccess, writeAccess string) {
-	readAccess = "?"
-	writeAccess = "?"
-
-	if len(fcp) < 4 {
-		return
-	}
-
-	idx := 0
-	if fcp[0] == 0x62 {
-		idx = 2 // Skip template tag and length
-	}
-
-	for idx < len(fcp)-2 {
-		tag := fcp[idx]
-		length := int(fcp[idx+1])
-		if idx+2+length > len(fcp) {
-			break
-		}
-
-		// Tag 8C: Compact Security Attributes
-		if tag == 0x8C && length >= 2 {
-			secData := fcp[idx+2 : idx+2+length]
-			readAccess, writeAccess = parseCompactSecurityAttributes(secData)
-			return
-		}
-
-		// Tag 8B: Security Attributes referencing EF_ARR
-		// Format: file_id (2 bytes) + record_number (1 byte)
-		if tag == 0x8B && length >= 3 {
-			// Security is defined in EF_ARR
-			// arrFileID := uint16(fcp[idx+2])<<8 | uint16(fcp[idx+3])
-			arrRecordNum := fcp[idx+4]
-			// Store ARR record number for later resolution
-			readAccess = fmt.Sprintf("ARR#%d", arrRecordNum)
-			writeAccess = fmt.Sprintf("ARR#%d", arrRecordNum)
-			return
-		}
-
-		// Tag 86: Proprietary Security Attributes
-		if tag == 0x86 {
-			secData := fcp[idx+2 : idx+2+length]
-			readAccess, writeAccess = parseProprietarySecurityAttributes(secData)
-			return
-		}
-
-		// Tag AB: Expanded Security Attributes (less common)
-		if tag == 0xAB && length >= 1 {
-			secData := fcp[idx+2 : idx+2+length]
-			readAccess, writeAccess = parseExpandedSecurityAttributes(secData)
-			return
-		}
+	f, _ := card.ParseFCP(fcp)
+	return fcpSecurityAttributes(f)
+}
 
-		// Tag A5: Proprietary information (some cards put security here)
-		if tag == 0xA5 {
-			// Parse nested TLV inside A5
-			nestedRead, nestedWrite := parseFCPSecurityAttributes(fcp[idx+2 : idx+2+length])
-			if nestedRead != "?" {
-				readAccess = nestedRead
-				writeAccess = nestedWrite
-				return
-			}
+// fcpSecurityAttributes returns the access conditions of the security attributes of f,
+// looking into the proprietary A5 object when the template has none. A reference to
+// EF_ARR is returned as ARR#n, resolved by the caller.
+func fcpSecurityAttributes(f *card.FCP) (readAccess, writeAccess string) {
+	switch {
+	case len(f.SecurityCompact) >= 2:
+		return parseCompactSecurityAttributes(f.SecurityCompact)
+	case f.SecurityReferenced != nil:
+		if ref, ok := parseARRReference(f.SecurityReferenced); ok {
+			return fmt.Sprintf("ARR#%d", ref.Record), fmt.Sprintf("ARR#%d", ref.Record)
 		}
-
-		idx += 2 + length
+		return "?", "?"
+	case f.SecurityProprietary != nil:
+		return parseProprietarySecurityAttributes(f.SecurityProprietary)
+	case f.SecurityExpanded != nil:
+		return parseExpandedSecurityAttributes(f.SecurityExpanded)
 	}
-
-	return
+	if p := f.ProprietaryFCP(); p != nil {
+		return fcpSecurityAttributes(p)
+	}
+	return "?", "?"
 }
 
 // parseCompactSecurityAttributes parses tag 8C content
@@ -891,11 +861,7 @@ func (u *USIMData) GetEnabledServices() []string {
 	var services []string
 	for num, enabled := range u.UST {
 		if enabled {
-			if name, ok := USTServices[num]; ok {
-				services = append(services, fmt.Sprintf("%d: %s", num, name))
-			} else {
-				services = append(services, fmt.Sprintf("%d: Unknown", num))
-			}
+			services = append(services, fmt.Sprintf("%d: %s", num, ServiceName("UST", num)))
 		}
 	}
 	return services
@@ -917,129 +883,51 @@ type ARRRecord struct {
 
 // ReadARR reads and parses EF_ARR (Access Rule Reference) file
 func ReadARR(reader *card.Reader) {
-	// Select EF_ARR (6F06)
-	resp, err := reader.Select([]byte{0x6F, 0x06})
-	if err != nil || !resp.IsOK() {
-		return
-	}
-
-	// Get record size
-	recordSize := parseFCPRecordSize(resp.Data)
-	if recordSize == 0 {
-		recordSize = 48 // Default
-	}
-
-	// Read all records
-	for recNum := byte(1); recNum <= 30; recNum++ {
-		recResp, err := reader.ReadRecord(recNum, byte(recordSize))
-		if err != nil || !recResp.IsOK() {
-			break
-		}
-
-		// Skip empty records
-		if len(recResp.Data) == 0 || recResp.Data[0] == 0xFF {
-			continue
-		}
-
-		readAcc, writeAcc := parseARRRecord(recResp.Data)
-		ARRCache[int(recNum)] = ARRRecord{
-			RecordNum:   int(recNum),
-			ReadAccess:  readAcc,
-			WriteAccess: writeAcc,
-			RawData:     recResp.Data,
-		}
-
-		if DebugFCP {
-			fmt.Printf("DEBUG ARR#%d: %X -> Read=%s, Write=%s\n", recNum, recResp.Data, readAcc, writeAcc)
-		}
+	for recNum, rec := range readARRTable(reader, []byte{0x6F, 0x06}) {
+		ARRCache[recNum] = rec
 	}
 }
 
 // parseARRRecord parses a single ARR record
-// ARR records contain pairs of [AM-DO (80)][SC-DO] for each access type
+// ARR records contain rules of an AM-DO (80, or 84 for a command) followed by SC-DOs
 func parseARRRecord(data []byte) (readAccess, writeAccess string) {
 	readAccess = "?"
 	writeAccess = "?"
 
-	if len(data) == 0 || data[0] == 0xFF {
-		return
-	}
-
+	// Access mode of the rule being parsed (ETSI TS 102 221 for EFs):
+	// Bit 0 (0x01): READ/SEARCH
+	// Bit 1 (0x02): UPDATE/ERASE
+	// Bit 3 (0x08): DEACTIVATE, Bit 4 (0x10): ACTIVATE, Bit 6 (0x40): DELETE FILE
+	// A command AM-DO (84) does not grant READ or UPDATE and is skipped with its SC-DOs.
+	var accessMode byte
 	idx := 0
-	for idx < len(data)-2 {
-		if data[idx] == 0xFF {
-			break
-		}
-
+	for idx+1 < len(data) && data[idx] != 0xFF {
 		tag := data[idx]
 		length := int(data[idx+1])
-		if length == 0 || idx+2+length > len(data) {
+		if idx+2+length > len(data) {
 			break
 		}
+		value := data[idx+2 : idx+2+length]
+		idx += 2 + length
 
-		// Tag 80: Access Mode (AM-DO) - followed by Security Condition
-		if tag == 0x80 && length > 0 {
-			accessMode := data[idx+2]
-			// Move to the security condition after AM-DO
-			scIdx := idx + 2 + length
-			if scIdx < len(data)-1 {
-				scTag := data[scIdx]
-				scLen := 0
-				if scIdx+1 < len(data) {
-					scLen = int(data[scIdx+1])
-				}
-
-				var cond string
-				if scIdx+2+scLen <= len(data) {
-					scValue := data[scIdx+2 : scIdx+2+scLen]
-					cond = parseSecurityConditionDO(scTag, scValue)
-				} else {
-					cond = parseSecurityConditionDO(scTag, nil)
-				}
-
-				// Access mode bits (ETSI TS 102 221)
-				// Bit 0 (0x01): READ/SEARCH
-				// Bit 1 (0x02): UPDATE
-				// Bit 2 (0x04): WRITE
-				// Bit 3 (0x08): INCREASE
-				// Bit 4 (0x10): REHABILITATE
-				// Bit 5 (0x20): INVALIDATE
-				// Bit 6 (0x40): Reserved
-				// Bit 7 (0x80): Reserved
-				// Alternative interpretation (common):
-				// 0x01: READ, 0x02: UPDATE BINARY, 0x10: UPDATE RECORD, 0x40: UPDATE
-
-				if accessMode == 0x01 { // READ
-					if readAccess == "?" {
-						readAccess = cond
-					}
-				}
-				if accessMode&0x02 != 0 || accessMode&0x10 != 0 || accessMode&0x40 != 0 ||
-					accessMode == 0x1A || accessMode == 0x18 { // UPDATE variants
-					if writeAccess == "?" || writeAccess == "Never" {
-						writeAccess = cond
-					}
-				}
-
-				// Skip the SC-DO
-				idx = scIdx + 2 + scLen
-				continue
+		switch tag {
+		case 0x80:
+			accessMode = 0
+			if length > 0 {
+				accessMode = value[0]
+			}
+		case 0x84:
+			accessMode = 0
+		default:
+			// Several SC-DOs after one AM-DO are alternatives: the first one is shown
+			cond := parseSecurityConditionDO(tag, value)
+			if accessMode&0x01 != 0 && readAccess == "?" {
+				readAccess = cond
+			}
+			if accessMode&0x02 != 0 && writeAccess == "?" {
+				writeAccess = cond
 			}
 		}
-
-		// Tag 90: Always (no length byte follows)
-		if tag == 0x90 {
-			idx += 2 + length
-			continue
-		}
-
-		// Tag 97: Never (00 length)
-		if tag == 0x97 {
-			idx += 2 + length
-			continue
-		}
-
-		idx += 2 + length
 	}
 
 	// Default values if not found
@@ -1074,6 +962,8 @@ func parseSecurityConditionDO(tag byte, value []byte) string {
 		return parseANDTemplate(value)
 	case 0xAF: // Never
 		return "Never"
+	case 0xB4, 0xB6, 0xB8: // Secure messaging templates (CCT, DST, CT)
+		return "SM"
 	}
 	return fmt.Sprintf("0x%02X", tag)
 }
@@ -1186,26 +1076,7 @@ func ResolveARRReference(access string) string {
 
 // ReadFileAccessConditions reads access conditions for key USIM files
 func ReadFileAccessConditions(reader *card.Reader) []FileAccessInfo {
-	var access []FileAccessInfo
-
-	// Select USIM first
-	resp, err := reader.Select(GetUSIMAID())
-	if err != nil || !resp.IsOK() {
-		return access
-	}
-
-	// Read EF_ARR first to resolve ARR references
-	ARRCache = make(map[int]ARRRecord) // Reset cache
-	ReadARR(reader)
-
-	// Re-select USIM after reading ARR
-	reader.Select(GetUSIMAID())
-
-	// Key files to check
-	filesToCheck := []struct {
-		id   []byte
-		name string
-	}{
+	return readAccessConditions(reader, GetUSIMAID(), "", []accessCheckFile{
 		{[]byte{0x6F, 0x07}, "EF_IMSI"},
 		{[]byte{0x6F, 0x46}, "EF_SPN"},
 		{[]byte{0x6F, 0xAD}, "EF_AD"},
@@ -1216,123 +1087,17 @@ func ReadFileAccessConditions(reader *card.Reader) []FileAccessInfo {
 		{[]byte{0x6F, 0x7B}, "EF_FPLMN"},
 		{[]byte{0x6F, 0x7E}, "EF_LOCI"},
 		{[]byte{0x6F, 0xE3}, "EF_EPSLOCI"},
-	}
-
-	for _, f := range filesToCheck {
-		resp, err := reader.Select(f.id)
-		if err != nil || !resp.IsOK() {
-			continue
-		}
-
-		if DebugFCP {
-			fmt.Printf("DEBUG FCP %s: %X\n", f.name, resp.Data)
-		}
-
-		readAcc, writeAcc := parseFCPSecurityAttributes(resp.Data)
-
-		// Resolve ARR references
-		if len(readAcc) > 4 && readAcc[:4] == "ARR#" {
-			var recNum int
-			fmt.Sscanf(readAcc, "ARR#%d", &recNum)
-			if rec, ok := ARRCache[recNum]; ok {
-				readAcc = rec.ReadAccess
-				writeAcc = rec.WriteAccess
-			}
-		}
-
-		access = append(access, FileAccessInfo{
-			FileName:    f.name,
-			FileID:      fmt.Sprintf("%02X%02X", f.id[0], f.id[1]),
-			ReadAccess:  readAcc,
-			WriteAccess: writeAcc,
-		})
-	}
-
-	return access
+	})
 }
 
-// ReadISIMFileAccessConditions reads access conditions for key ISIM files
+// ReadISIMFileAccessConditions reads access conditions for key ISIM files. Their EF_ARR
+// references point to the EF_ARR of ADF_ISIM, not to the one of the USIM.
 func ReadISIMFileAccessConditions(reader *card.Reader) []FileAccessInfo {
-	var access []FileAccessInfo
-
-	// Select ISIM first
-	resp, err := reader.Select(GetISIMAID())
-	if err != nil || !resp.IsOK() {
-		return access
-	}
-
-	// Read EF_ARR for ISIM
-	isimARRCache := make(map[int]ARRRecord)
-	// Try to read ISIM's ARR (might be at 6F06 too)
-	arrResp, arrErr := reader.Select([]byte{0x6F, 0x06})
-	if arrErr == nil && arrResp.IsOK() {
-		recordSize := parseFCPRecordSize(arrResp.Data)
-		if recordSize == 0 {
-			recordSize = 48
-		}
-		for recNum := byte(1); recNum <= 20; recNum++ {
-			recResp, err := reader.ReadRecord(recNum, byte(recordSize))
-			if err != nil || !recResp.IsOK() {
-				break
-			}
-			if len(recResp.Data) == 0 || recResp.Data[0] == 0xFF {
-				continue
-			}
-			readAcc, writeAcc := parseARRRecord(recResp.Data)
-			isimARRCache[int(recNum)] = ARRRecord{
-				RecordNum:   int(recNum),
-				ReadAccess:  readAcc,
-				WriteAccess: writeAcc,
-			}
-			if DebugFCP {
-				fmt.Printf("DEBUG ISIM ARR#%d: %X -> Read=%s, Write=%s\n", recNum, recResp.Data, readAcc, writeAcc)
-			}
-		}
-		// Re-select ISIM
-		reader.Select(GetISIMAID())
-	}
-
-	// Key ISIM files to check
-	filesToCheck := []struct {
-		id   []byte
-		name string
-	}{
+	return readAccessConditions(reader, GetISIMAID(), "ISIM ", []accessCheckFile{
 		{[]byte{0x6F, 0x02}, "EF_IMPI"},
 		{[]byte{0x6F, 0x03}, "EF_DOMAIN"},
 		{[]byte{0x6F, 0x04}, "EF_IMPU"},
 		{[]byte{0x6F, 0x07}, "EF_IST"},
 		{[]byte{0x6F, 0x09}, "EF_PCSCF"},
-	}
-
-	for _, f := range filesToCheck {
-		resp, err := reader.Select(f.id)
-		if err != nil || !resp.IsOK() {
-			continue
-		}
-
-		if DebugFCP {
-			fmt.Printf("DEBUG FCP ISIM %s: %X\n", f.name, resp.Data)
-		}
-
-		readAcc, writeAcc := parseFCPSecurityAttributes(resp.Data)
-
-		// Resolve ARR references from ISIM's ARR cache
-		if len(readAcc) > 4 && readAcc[:4] == "ARR#" {
-			var recNum int
-			fmt.Sscanf(readAcc, "ARR#%d", &recNum)
-			if rec, ok := isimARRCache[recNum]; ok {
-				readAcc = rec.ReadAccess
-				writeAcc = rec.WriteAccess
-			}
-		}
-
-		access = append(access, FileAccessInfo{
-			FileName:    f.name,
-			FileID:      fmt.Sprintf("%02X%02X", f.id[0], f.id[1]),
-			ReadAccess:  readAcc,
-			WriteAccess: writeAcc,
-		})
-	}
-
-	return access
+	})
 }
@@ -3,6 +3,9 @@ package sim
 import (
 	"fmt"
 	"sim_reader/card"
+	"sim_reader/inputs"
+	"sim_reader/textcodec"
+	"strings"
 )
 
 // WriteIMSI writes IMSI to the card
@@ -21,7 +24,7 @@ func WriteIMSI(reader *card.Reader, imsi string) error {
 		return fmt.Errorf("failed to select USIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
 	}
 
 	// Select EF_IMSI
@@ -30,7 +33,7 @@ func WriteIMSI(reader *card.Reader, imsi string) error {
 		return fmt.Errorf("failed to select EF_IMSI: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("EF_IMSI selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("EF_IMSI selection failed: %s", resp.SWString())
 	}
 
 	// Encode IMSI
@@ -45,7 +48,7 @@ func WriteIMSI(reader *card.Reader, imsi string) error {
 		return fmt.Errorf("failed to write IMSI: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("IMSI write failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("IMSI write failed: %s", resp.SWString())
 	}
 
 	return nil
@@ -66,7 +69,7 @@ func WriteSPN(reader *card.Reader, spn string, displayCondition byte) error {
 		return fmt.Errorf("failed to select USIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
 	}
 
 	// Select EF_SPN
@@ -75,7 +78,7 @@ func WriteSPN(reader *card.Reader, spn string, displayCondition byte) error {
 		return fmt.Errorf("failed to select EF_SPN: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("EF_SPN selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("EF_SPN selection failed: %s", resp.SWString())
 	}
 
 	// Get file size from FCP
@@ -85,12 +88,11 @@ func WriteSPN(reader *card.Reader, spn string, displayCondition byte) error {
 	}
 
 	// Encode SPN: display condition byte + name padded with 0xFF
-	data := make([]byte, fileSize)
-	for i := range data {
-		data[i] = 0xFF
+	name, err := textcodec.EncodeAlphaPadded(spn, fileSize-1)
+	if err != nil {
+		return fmt.Errorf("SPN: %w", err)
 	}
-	data[0] = displayCondition
-	copy(data[1:], []byte(spn))
+	data := append([]byte{displayCondition}, name...)
 
 	// Write SPN
 	resp, err = reader.UpdateBinary(0, data)
@@ -98,7 +100,7 @@ func WriteSPN(reader *card.Reader, spn string, displayCondition byte) error {
 		return fmt.Errorf("failed to write SPN: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("SPN write failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("SPN write failed: %s", resp.SWString())
 	}
 
 	return nil
@@ -112,7 +114,7 @@ func ClearForbiddenPLMN(reader *card.Reader) error {
 		return fmt.Errorf("failed to select USIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
 	}
 
 	// Select EF_FPLMN
@@ -121,7 +123,7 @@ func ClearForbiddenPLMN(reader *card.Reader) error {
 		return fmt.Errorf("failed to select EF_FPLMN: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("EF_FPLMN selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("EF_FPLMN selection failed: %s", resp.SWString())
 	}
 
 	// Get file size
@@ -139,30 +141,110 @@ func ClearForbiddenPLMN(reader *card.Reader) error {
 		return fmt.Errorf("failed to clear FPLMN: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("FPLMN clear failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("FPLMN clear failed: %s", resp.SWString())
 	}
 
 	return nil
 }
 
+// fplmnMinEntries is the minimum size of EF_FPLMN (TS 31.102 4.2.16: at least 4 PLMNs)
+const fplmnMinEntries = 4
+
+// WriteFPLMN replaces the forbidden PLMN list (EF_FPLMN) with plmns.
+// The whole file is written; unused entries are padded with FF. Cards that
+// allocate more than 12 bytes get their full length used.
+func WriteFPLMN(reader *card.Reader, plmns []PLMN) error {
+	// Select USIM
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+
+	// Select EF_FPLMN
+	resp, err = reader.Select([]byte{0x6F, 0x7B})
+	if err != nil {
+		return fmt.Errorf("failed to select EF_FPLMN: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("EF_FPLMN selection failed: %s", resp.SWString())
+	}
+
+	// Get file size
+	fileSize := parseFCPFileSize(resp.Data)
+	if fileSize == 0 {
+		fileSize = fplmnMinEntries * 3
+	}
+	if len(plmns)*3 > fileSize {
+		return fmt.Errorf("EF_FPLMN holds %d entries, got %d PLMNs", fileSize/3, len(plmns))
+	}
+
+	// Build data: 3 bytes per PLMN, rest FF
+	data := ClearFPLMN(fileSize)
+	for i, p := range plmns {
+		encoded, err := EncodePLMN(p.MCC, p.MNC)
+		if err != nil {
+			return fmt.Errorf("FPLMN %s: %w", p, err)
+		}
+		copy(data[i*3:], encoded)
+	}
+
+	resp, err = reader.UpdateBinary(0, data)
+	if err != nil {
+		return fmt.Errorf("failed to write FPLMN: %w", err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("FPLMN write failed: %s", resp.SWString())
+	}
+
+	return nil
+}
+
+// ParsePLMNList parses a comma-separated "MCC:MNC" list (e.g. "262:01,208:10")
+func ParsePLMNList(s string) ([]PLMN, error) {
+	var result []PLMN
+	for _, item := range splitString(s, ',') {
+		item = trimSpace(item)
+		if item == "" {
+			continue
+		}
+		mcc, mnc, err := inputs.PLMN("PLMN", item)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, PLMN{MCC: mcc, MNC: mnc})
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("empty PLMN list")
+	}
+	return result, nil
+}
+
 // SetUSIMServices enables or disables services in UST
 func SetUSIMServices(reader *card.Reader, services map[int]bool) error {
+	return updateServiceTable(reader, []byte{0x6F, 0x38}, "UST", services)
+}
+
+// updateServiceTable sets bits of a service table EF (UST or EST) of the USIM
+func updateServiceTable(reader *card.Reader, fid []byte, name string, services map[int]bool) error {
 	// Select USIM
 	resp, err := SelectUSIMWithAuth(reader)
 	if err != nil {
 		return fmt.Errorf("failed to select USIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
 	}
 
-	// Select EF_UST
-	resp, err = reader.Select([]byte{0x6F, 0x38})
+	// Select the service table
+	resp, err = reader.Select(fid)
 	if err != nil {
-		return fmt.Errorf("failed to select EF_UST: %w", err)
+		return fmt.Errorf("failed to select EF_%s: %w", name, err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("EF_UST selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("EF_%s selection failed: %s", name, resp.SWString())
 	}
 
 	// Get file size
@@ -171,25 +253,46 @@ func SetUSIMServices(reader *card.Reader, services map[int]bool) error {
 		fileSize = 16 // Default
 	}
 
-	// Read current UST
-	currentUST, err := reader.ReadAllBinary(fileSize)
+	// Read current table
+	current, err := reader.ReadAllBinary(fileSize)
 	if err != nil {
-		return fmt.Errorf("failed to read current UST: %w", err)
+		return fmt.Errorf("failed to read current %s: %w", name, err)
 	}
 
-	// Encode new UST
-	newUST := EncodeUST(currentUST, services)
-
-	// Write UST
-	resp, err = reader.UpdateBinary(0, newUST)
+	// Write the updated table
+	fcp := resp.Data
+	data := EncodeUST(current, services)
+	resp, err = reader.UpdateBinary(0, data)
 	if err != nil {
-		return fmt.Errorf("failed to write UST: %w", err)
+		return fmt.Errorf("failed to write %s: %w", name, err)
 	}
-	if !resp.IsOK() {
-		return fmt.Errorf("UST write failed: %s", card.SWToString(resp.SW()))
+	if resp.SW() != card.SW_SECURITY_NOT_SATISFIED {
+		if !resp.IsOK() {
+			return fmt.Errorf("%s write failed: %s", name, resp.SWString())
+		}
+		return nil
 	}
 
-	return nil
+	// Refused: tell which credential the file needs. PIN2 (EST on many cards) is verified
+	// on demand, then the update is repeated once.
+	needs, known := updateAccessNeeds(reader, fcp)
+	if !known {
+		return fmt.Errorf("%s write failed: %s", name, resp.SWString())
+	}
+	if strings.Contains(needs, CredentialPIN2) && StoredPIN2 != "" {
+		if err := verifyStoredPIN2(reader); err != nil {
+			return err
+		}
+		if resp, err = reader.Select(fid); err != nil || !resp.IsOK() {
+			return fmt.Errorf("EF_%s selection failed after PIN2", name)
+		}
+		if resp, err = reader.UpdateBinary(0, data); err == nil && resp.IsOK() {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return &AccessDeniedError{File: "EF_" + name, Status: resp.SWString(), Needs: needs, Missing: missingCredentials(needs)}
 }
 
 // EnableVoLTE enables VoLTE related services
@@ -240,7 +343,7 @@ func UpdateMNCLength(reader *card.Reader, mncLength int) error {
 		return fmt.Errorf("failed to select USIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
 	}
 
 	// Select EF_AD
@@ -249,7 +352,7 @@ func UpdateMNCLength(reader *card.Reader, mncLength int) error {
 		return fmt.Errorf("failed to select EF_AD: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("EF_AD selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("EF_AD selection failed: %s", resp.SWString())
 	}
 
 	// Get file size
@@ -273,7 +376,7 @@ func UpdateMNCLength(reader *card.Reader, mncLength int) error {
 		return fmt.Errorf("failed to write AD: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("AD write failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("AD write failed: %s", resp.SWString())
 	}
 
 	return nil
@@ -281,99 +384,28 @@ func UpdateMNCLength(reader *card.Reader, mncLength int) error {
 
 // WriteHPLMN writes Home PLMN with Access Technology
 func WriteHPLMN(reader *card.Reader, mcc, mnc string, act uint16) error {
-	// Select USIM
-	resp, err := SelectUSIMWithAuth(reader)
-	if err != nil {
-		return fmt.Errorf("failed to select USIM: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
-	}
-
-	// Select EF_HPLMNwACT
-	resp, err = reader.Select([]byte{0x6F, 0x62})
-	if err != nil {
-		return fmt.Errorf("failed to select EF_HPLMNwACT: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("EF_HPLMNwACT selection failed: %s", card.SWToString(resp.SW()))
-	}
-
-	// Get file size
-	fileSize := parseFCPFileSize(resp.Data)
-	if fileSize == 0 {
-		fileSize = 5 // One PLMN entry
-	}
-
-	// Encode PLMN
-	plmn, err := EncodePLMN(mcc, mnc)
-	if err != nil {
-		return fmt.Errorf("failed to encode PLMN: %w", err)
-	}
-
-	// Create data: PLMN (3 bytes) + ACT (2 bytes) + padding
-	data := make([]byte, fileSize)
-	for i := range data {
-		data[i] = 0xFF
-	}
-	copy(data[0:3], plmn)
-	data[3] = byte(act >> 8)
-	data[4] = byte(act & 0xFF)
-
-	// Write
-	resp, err = reader.UpdateBinary(0, data)
-	if err != nil {
-		return fmt.Errorf("failed to write HPLMNwACT: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("HPLMNwACT write failed: %s", card.SWToString(resp.SW()))
-	}
-
-	return nil
-}
-
-// Access Technology flags
-const (
-	ACT_UTRAN       = 0x8000 // 3G UMTS
-	ACT_E_UTRAN     = 0x4000 // 4G LTE
-	ACT_GSM         = 0x0080 // 2G GSM
-	ACT_GSM_COMPACT = 0x0040
-	ACT_CDMA_HRPD   = 0x0020
-	ACT_CDMA_1X     = 0x0010
-	ACT_NR          = 0x0008 // 5G NR
-	ACT_NG_RAN      = 0x0004 // 5G SA
-	ACT_ALL         = ACT_UTRAN | ACT_E_UTRAN | ACT_GSM | ACT_NR | ACT_NG_RAN
-)
-
-// WriteHPLMNFromString parses string format "MCC:MNC:ACT" and writes HPLMN
-// ACT can be: eutran, utran, gsm, nr, ngran, all (comma-separated)
-// Example: "250:88:eutran,utran,gsm" or "250:88:all"
-func WriteHPLMNFromString(reader *card.Reader, hplmnStr string) error {
-	mcc, mnc, act, err := ParseHPLMNString(hplmnStr)
-	if err != nil {
-		return err
-	}
-	return WriteHPLMN(reader, mcc, mnc, act)
+	return writePLMNwACTFile(reader, 0x6F62, "EF_HPLMNwACT", []HPLMNEntry{{MCC: mcc, MNC: mnc, ACT: act}})
 }
 
-// WriteHPLMNList writes multiple HPLMN entries with Access Technology
-func WriteHPLMNList(reader *card.Reader, entries []HPLMNEntry) error {
+// writePLMNwACTFile writes entries to a PLMN selector with Access Technology (5 bytes per
+// entry, the rest of the file cleared). The RFU ACT bits of an entry already on the card for
+// the same PLMN are kept.
+func writePLMNwACTFile(reader *card.Reader, fid uint16, name string, entries []HPLMNEntry) error {
 	// Select USIM
 	resp, err := SelectUSIMWithAuth(reader)
 	if err != nil {
 		return fmt.Errorf("failed to select USIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
 	}
 
-	// Select EF_HPLMNwACT
-	resp, err = reader.Select([]byte{0x6F, 0x62})
+	resp, err = reader.Select([]byte{byte(fid >> 8), byte(fid)})
 	if err != nil {
-		return fmt.Errorf("failed to select EF_HPLMNwACT: %w", err)
+		return fmt.Errorf("failed to select %s: %w", name, err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("EF_HPLMNwACT selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("%s selection failed: %s", name, resp.SWString())
 	}
 
 	// Get file size
@@ -382,6 +414,11 @@ func WriteHPLMNList(reader *card.Reader, entries []HPLMNEntry) error {
 		fileSize = 5 * len(entries) // 5 bytes per entry
 	}
 
+	// Read-modify-write of the ACT: a file that cannot be read is written as is
+	if current, err := reader.ReadAllBinary(fileSize); err == nil {
+		entries = keepUnknownACT(entries, DecodePLMNwACT(current))
+	}
+
 	// Build data: each entry is 5 bytes (3 PLMN + 2 ACT)
 	data := make([]byte, fileSize)
 	for i := range data {
@@ -404,17 +441,34 @@ func WriteHPLMNList(reader *card.Reader, entries []HPLMNEntry) error {
 	}
 
 	// Write
+	short := strings.TrimPrefix(name, "EF_")
 	resp, err = reader.UpdateBinary(0, data)
 	if err != nil {
-		return fmt.Errorf("failed to write HPLMNwACT: %w", err)
+		return fmt.Errorf("failed to write %s: %w", short, err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("HPLMNwACT write failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("%s write failed: %s", short, resp.SWString())
 	}
 
 	return nil
 }
 
+// WriteHPLMNFromString parses string format "MCC:MNC:ACT" and writes HPLMN
+// ACT can be: utran, eutran, eutran-wb, eutran-nb, ngran (nr), gsm... or all (comma-separated)
+// Example: "250:88:eutran,utran,gsm" or "250:88:all"
+func WriteHPLMNFromString(reader *card.Reader, hplmnStr string) error {
+	mcc, mnc, act, err := ParseHPLMNString(hplmnStr)
+	if err != nil {
+		return err
+	}
+	return WriteHPLMN(reader, mcc, mnc, act)
+}
+
+// WriteHPLMNList writes multiple HPLMN entries with Access Technology
+func WriteHPLMNList(reader *card.Reader, entries []HPLMNEntry) error {
+	return writePLMNwACTFile(reader, 0x6F62, "EF_HPLMNwACT", entries)
+}
+
 // HPLMNEntry represents a single HPLMN entry
 type HPLMNEntry struct {
 	MCC string
@@ -429,21 +483,17 @@ func ParseHPLMNString(s string) (mcc, mnc string, act uint16, err error) {
 		return "", "", 0, fmt.Errorf("invalid HPLMN format: expected MCC:MNC[:ACT], got %s", s)
 	}
 
-	mcc = parts[0]
-	mnc = parts[1]
-
-	if len(mcc) != 3 {
-		return "", "", 0, fmt.Errorf("invalid MCC: must be 3 digits")
-	}
-	if len(mnc) < 2 || len(mnc) > 3 {
-		return "", "", 0, fmt.Errorf("invalid MNC: must be 2-3 digits")
+	if mcc, mnc, err = inputs.PLMN("HPLMN", parts[0]+":"+parts[1]); err != nil {
+		return "", "", 0, err
 	}
 
 	// Default to all technologies if not specified
 	if len(parts) < 3 || parts[2] == "" {
 		act = ACT_ALL
 	} else {
-		act = ParseACTString(parts[2])
+		if act, err = ParseACT(parts[2]); err != nil {
+			return "", "", 0, fmt.Errorf("invalid ACT: %w", err)
+		}
 		if act == 0 {
 			return "", "", 0, fmt.Errorf("invalid ACT: %s", parts[2])
 		}
@@ -452,30 +502,6 @@ func ParseHPLMNString(s string) (mcc, mnc string, act uint16, err error) {
 	return mcc, mnc, act, nil
 }
 
-// ParseACTString parses comma-separated ACT names
-func ParseACTString(s string) uint16 {
-	var act uint16
-	parts := splitString(s, ',')
-	for _, p := range parts {
-		p = trimSpace(p)
-		switch toLower(p) {
-		case "eutran", "e-utran", "lte", "4g":
-			act |= ACT_E_UTRAN
-		case "utran", "umts", "3g":
-			act |= ACT_UTRAN
-		case "gsm", "2g":
-			act |= ACT_GSM
-		case "nr", "5g":
-			act |= ACT_NR
-		case "ngran", "ng-ran", "5gsa":
-			act |= ACT_NG_RAN
-		case "all":
-			act = ACT_ALL
-		}
-	}
-	return act
-}
-
 // Helper functions to avoid importing strings package again
 func splitString(s string, sep byte) []string {
 	var result []string
@@ -547,7 +573,7 @@ func SetOperationMode(reader *card.Reader, mode byte) error {
 		return fmt.Errorf("failed to select USIM: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("USIM selection failed: %s", resp.SWString())
 	}
 
 	// Select EF_AD
@@ -556,7 +582,7 @@ func SetOperationMode(reader *card.Reader, mode byte) error {
 		return fmt.Errorf("failed to select EF_AD: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("EF_AD selection failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("EF_AD selection failed: %s", resp.SWString())
 	}
 
 	// Get file size
@@ -580,7 +606,7 @@ func SetOperationMode(reader *card.Reader, mode byte) error {
 		return fmt.Errorf("failed to write AD: %w", err)
 	}
 	if !resp.IsOK() {
-		return fmt.Errorf("AD write failed: %s", card.SWToString(resp.SW()))
+		return fmt.Errorf("AD write failed: %s", resp.SWString())
 	}
 
 	return nil
@@ -619,114 +645,12 @@ func ParseOperationMode(name string) (byte, error) {
 // WriteUserPLMN writes User Controlled PLMN list (EF_PLMNwAcT)
 // This is different from HPLMN - User PLMNs are preferred networks selected by user
 func WriteUserPLMN(reader *card.Reader, mcc, mnc string, act uint16) error {
-	// Select USIM
-	resp, err := SelectUSIMWithAuth(reader)
-	if err != nil {
-		return fmt.Errorf("failed to select USIM: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
-	}
-
-	// Select EF_PLMNwAcT (0x6F60) - User Controlled PLMN Selector with Access Technology
-	resp, err = reader.Select([]byte{0x6F, 0x60})
-	if err != nil {
-		return fmt.Errorf("failed to select EF_PLMNwAcT: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("EF_PLMNwAcT selection failed: %s", card.SWToString(resp.SW()))
-	}
-
-	// Get file size
-	fileSize := parseFCPFileSize(resp.Data)
-	if fileSize == 0 {
-		fileSize = 5 // One PLMN entry
-	}
-
-	// Encode PLMN
-	plmn, err := EncodePLMN(mcc, mnc)
-	if err != nil {
-		return fmt.Errorf("failed to encode PLMN: %w", err)
-	}
-
-	// Create data: PLMN (3 bytes) + ACT (2 bytes) + padding
-	data := make([]byte, fileSize)
-	for i := range data {
-		data[i] = 0xFF
-	}
-	copy(data[0:3], plmn)
-	data[3] = byte(act >> 8)
-	data[4] = byte(act & 0xFF)
-
-	// Write
-	resp, err = reader.UpdateBinary(0, data)
-	if err != nil {
-		return fmt.Errorf("failed to write PLMNwAcT: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("PLMNwAcT write failed: %s", card.SWToString(resp.SW()))
-	}
-
-	return nil
+	return writePLMNwACTFile(reader, 0x6F60, "EF_PLMNwAcT", []HPLMNEntry{{MCC: mcc, MNC: mnc, ACT: act}})
 }
 
 // WriteUserPLMNList writes multiple User Controlled PLMN entries
 func WriteUserPLMNList(reader *card.Reader, entries []HPLMNEntry) error {
-	// Select USIM
-	resp, err := SelectUSIMWithAuth(reader)
-	if err != nil {
-		return fmt.Errorf("failed to select USIM: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
-	}
-
-	// Select EF_PLMNwAcT (0x6F60)
-	resp, err = reader.Select([]byte{0x6F, 0x60})
-	if err != nil {
-		return fmt.Errorf("failed to select EF_PLMNwAcT: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("EF_PLMNwAcT selection failed: %s", card.SWToString(resp.SW()))
-	}
-
-	// Get file size
-	fileSize := parseFCPFileSize(resp.Data)
-	if fileSize == 0 {
-		fileSize = 5 * len(entries) // 5 bytes per entry
-	}
-
-	// Build data: each entry is 5 bytes (3 PLMN + 2 ACT)
-	data := make([]byte, fileSize)
-	for i := range data {
-		data[i] = 0xFF
-	}
-
-	offset := 0
-	for _, entry := range entries {
-		if offset+5 > fileSize {
-			break
-		}
-		plmn, err := EncodePLMN(entry.MCC, entry.MNC)
-		if err != nil {
-			continue
-		}
-		copy(data[offset:offset+3], plmn)
-		data[offset+3] = byte(entry.ACT >> 8)
-		data[offset+4] = byte(entry.ACT & 0xFF)
-		offset += 5
-	}
-
-	// Write
-	resp, err = reader.UpdateBinary(0, data)
-	if err != nil {
-		return fmt.Errorf("failed to write PLMNwAcT: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("PLMNwAcT write failed: %s", card.SWToString(resp.SW()))
-	}
-
-	return nil
+	return writePLMNwACTFile(reader, 0x6F60, "EF_PLMNwAcT", entries)
 }
 
 // WriteUserPLMNFromString parses string format "MCC:MNC:ACT" and writes User PLMN
@@ -741,114 +665,12 @@ func WriteUserPLMNFromString(reader *card.Reader, plmnStr string) error {
 // WriteOPLMN writes Operator Controlled PLMN list (EF_OPLMNwACT)
 // This is different from HPLMN - Operator PLMNs are roaming partners selected by operator
 func WriteOPLMN(reader *card.Reader, mcc, mnc string, act uint16) error {
-	// Select USIM
-	resp, err := SelectUSIMWithAuth(reader)
-	if err != nil {
-		return fmt.Errorf("failed to select USIM: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
-	}
-
-	// Select EF_OPLMNwACT (0x6F61) - Operator Controlled PLMN Selector with Access Technology
-	resp, err = reader.Select([]byte{0x6F, 0x61})
-	if err != nil {
-		return fmt.Errorf("failed to select EF_OPLMNwACT: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("EF_OPLMNwACT selection failed: %s", card.SWToString(resp.SW()))
-	}
-
-	// Get file size
-	fileSize := parseFCPFileSize(resp.Data)
-	if fileSize == 0 {
-		fileSize = 5 // One PLMN entry
-	}
-
-	// Encode PLMN
-	plmn, err := EncodePLMN(mcc, mnc)
-	if err != nil {
-		return fmt.Errorf("failed to encode PLMN: %w", err)
-	}
-
-	// Create data: PLMN (3 bytes) + ACT (2 bytes) + padding
-	data := make([]byte, fileSize)
-	for i := range data {
-		data[i] = 0xFF
-	}
-	copy(data[0:3], plmn)
-	data[3] = byte(act >> 8)
-	data[4] = byte(act & 0xFF)
-
-	// Write
-	resp, err = reader.UpdateBinary(0, data)
-	if err != nil {
-		return fmt.Errorf("failed to write OPLMNwACT: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("OPLMNwACT write failed: %s", card.SWToString(resp.SW()))
-	}
-
-	return nil
+	return writePLMNwACTFile(reader, 0x6F61, "EF_OPLMNwACT", []HPLMNEntry{{MCC: mcc, MNC: mnc, ACT: act}})
 }
 
 // WriteOPLMNList writes multiple Operator Controlled PLMN entries
 func WriteOPLMNList(reader *card.Reader, entries []HPLMNEntry) error {
-	// Select USIM
-	resp, err := SelectUSIMWithAuth(reader)
-	if err != nil {
-		return fmt.Errorf("failed to select USIM: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("USIM selection failed: %s", card.SWToString(resp.SW()))
-	}
-
-	// Select EF_OPLMNwACT (0x6F61)
-	resp, err = reader.Select([]byte{0x6F, 0x61})
-	if err != nil {
-		return fmt.Errorf("failed to select EF_OPLMNwACT: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("EF_OPLMNwACT selection failed: %s", card.SWToString(resp.SW()))
-	}
-
-	// Get file size
-	fileSize := parseFCPFileSize(resp.Data)
-	if fileSize == 0 {
-		fileSize = 5 * len(entries) // 5 bytes per entry
-	}
-
-	// Build data: each entry is 5 bytes (3 PLMN + 2 ACT)
-	data := make([]byte, fileSize)
-	for i := range data {
-		data[i] = 0xFF
-	}
-
-	offset := 0
-	for _, entry := range entries {
-		if offset+5 > fileSize {
-			break
-		}
-		plmn, err := EncodePLMN(entry.MCC, entry.MNC)
-		if err != nil {
-			continue
-		}
-		copy(data[offset:offset+3], plmn)
-		data[offset+3] = byte(entry.ACT >> 8)
-		data[offset+4] = byte(entry.ACT & 0xFF)
-		offset += 5
-	}
-
-	// Write
-	resp, err = reader.UpdateBinary(0, data)
-	if err != nil {
-		return fmt.Errorf("failed to write OPLMNwACT: %w", err)
-	}
-	if !resp.IsOK() {
-		return fmt.Errorf("OPLMNwACT write failed: %s", card.SWToString(resp.SW()))
-	}
-
-	return nil
+	return writePLMNwACTFile(reader, 0x6F61, "EF_OPLMNwACT", entries)
 }
 
 // WriteOPLMNFromString parses string format "MCC:MNC:ACT" and writes Operator PLMN
@@ -1,7 +1,12 @@
 package sim
 
 import (
+	"bytes"
+	"fmt"
+	"reflect"
 	"testing"
+
+	"sim_reader/card"
 )
 
 // ============ HPLMN PARSING TESTS ============
@@ -83,6 +88,107 @@ func TestParseHPLMNString_Invalid(t *testing.T) {
 	}
 }
 
+// ============ FPLMN TESTS ============
+
+func TestParsePLMNList(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []PLMN
+		wantErr bool
+	}{
+		{"262:01,208:10", []PLMN{{"262", "01"}, {"208", "10"}}, false},
+		{" 310:410 , 001:01,", []PLMN{{"310", "410"}, {"001", "01"}}, false},
+		{"26201", nil, true},
+		{"262:1", nil, true},
+		{"26a:01", nil, true},
+		{"262:01:eutran", nil, true},
+		{"", nil, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParsePLMNList(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParsePLMNList(%q) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParsePLMNList(%q) = %v, want %v", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWriteFPLMN(t *testing.T) {
+	plmns := []PLMN{{"262", "01"}, {"208", "10"}, {"310", "410"}}
+	tests := []struct {
+		name     string
+		fileSize int
+		plmns    []PLMN
+		wantErr  bool
+	}{
+		{"Standard 4 entries", 12, plmns, false},
+		{"Extended 10 entries", 30, plmns, false},
+		{"Too many PLMNs", 6, plmns, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := card.NewMockCard([]byte{0x3B, 0x00})
+			ef := m.AddADF(AID_USIM).AddEF(0x6F7B, bytes.Repeat([]byte{0x00}, tc.fileSize))
+			reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+			err := WriteFPLMN(reader, tc.plmns)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("WriteFPLMN() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if len(ef.Data) != tc.fileSize {
+				t.Errorf("file size changed to %d", len(ef.Data))
+			}
+			if got := DecodeFPLMN(ef.Data); !reflect.DeepEqual(got, tc.plmns) {
+				t.Errorf("DecodeFPLMN() = %v, want %v", got, tc.plmns)
+			}
+			if !bytes.Equal(ef.Data[9:], bytes.Repeat([]byte{0xFF}, tc.fileSize-9)) {
+				t.Errorf("unused entries not padded with FF: %X", ef.Data)
+			}
+		})
+	}
+}
+
+func TestWriteSPN(t *testing.T) {
+	tests := []struct {
+		name    string
+		spn     string
+		want    string
+		wantErr bool
+	}{
+		{"GSM 7-bit", "Net @ 5€", "014E6574200020351B65FFFFFFFFFFFFFF", false},
+		{"UCS2 81", "Мой Оператор", "01810C089CBEB9209EBFB5C0B0C2BEC0FF", false},
+		{"Too long", "Мой Оператор и ещё", "", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := card.NewMockCard([]byte{0x3B, 0x00})
+			ef := m.AddADF(AID_USIM).AddEF(0x6F46, bytes.Repeat([]byte{0xFF}, 17))
+			reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+			err := WriteSPN(reader, tc.spn, 0x01)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("WriteSPN() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got := fmt.Sprintf("%X", ef.Data); got != tc.want {
+				t.Errorf("EF_SPN = %s, want %s", got, tc.want)
+			}
+			if got := DecodeSPN(ef.Data); got != tc.spn {
+				t.Errorf("DecodeSPN() = %q, want %q", got, tc.spn)
+			}
+		})
+	}
+}
+
 // ============ ACT PARSING TESTS ============
 
 func TestParseACTString(t *testing.T) {
@@ -0,0 +1,349 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// VerifyStatus is the outcome of a single VerifyConfig item
+type VerifyStatus string
+
+const (
+	VerifyMatch      VerifyStatus = "match"
+	VerifyMismatch   VerifyStatus = "mismatch"
+	VerifyUnreadable VerifyStatus = "unreadable"
+	VerifySkipped    VerifyStatus = "skipped"
+)
+
+// VerifyItem is one configuration field compared by VerifyConfig
+type VerifyItem struct {
+	Field    string       `json:"field"`
+	Status   VerifyStatus `json:"status"`
+	Expected string       `json:"expected,omitempty"`
+	Actual   string       `json:"actual,omitempty"`
+	Detail   string       `json:"detail,omitempty"` // why the field could not be compared
+}
+
+// VerifyReport is the per-field result of VerifyConfig
+type VerifyReport struct {
+	Items      []VerifyItem `json:"items"`
+	Matched    int          `json:"matched"`
+	Mismatched int          `json:"mismatched"`
+	Unreadable int          `json:"unreadable"`
+	Skipped    int          `json:"skipped"`
+}
+
+// OK reports whether every checked field matched (skipped fields do not count)
+func (r *VerifyReport) OK() bool {
+	return r.Mismatched == 0 && r.Unreadable == 0
+}
+
+func (r *VerifyReport) add(item VerifyItem) {
+	r.Items = append(r.Items, item)
+	switch item.Status {
+	case VerifyMatch:
+		r.Matched++
+	case VerifyMismatch:
+		r.Mismatched++
+	case VerifyUnreadable:
+		r.Unreadable++
+	case VerifySkipped:
+		r.Skipped++
+	}
+}
+
+// compare records a match or mismatch of normalized values
+func (r *VerifyReport) compare(field, expected, actual string) {
+	status := VerifyMatch
+	if expected != actual {
+		status = VerifyMismatch
+	}
+	r.add(VerifyItem{Field: field, Status: status, Expected: expected, Actual: actual})
+}
+
+// unreadable records a field whose card value could not be read
+func (r *VerifyReport) unreadable(field, expected, detail string) {
+	r.add(VerifyItem{Field: field, Status: VerifyUnreadable, Expected: expected, Detail: detail})
+}
+
+// skipped records a configured field that cannot be verified by reading the card
+func (r *VerifyReport) skipped(field, detail string) {
+	r.add(VerifyItem{Field: field, Status: VerifySkipped, Detail: detail})
+}
+
+// VerifyConfig reads the card and compares it with config without writing anything.
+// Only fields present in config are checked. Values are normalized before comparison:
+// SPN padding and spaces, ICCID filler digits, HPLMN and FPLMN order (OPLMN and User PLMN
+// are priority lists, so their order is compared). Secrets (Ki, OPc, PINs) are reported as skipped.
+func VerifyConfig(reader *card.Reader, config *SIMConfig) (*VerifyReport, error) {
+	report := &VerifyReport{}
+
+	var usim *USIMData
+	if config.hasVerifiableUSIMFields() {
+		data, err := ReadUSIM(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read USIM: %w", err)
+		}
+		usim = data
+		verifyUSIM(config, usim, report)
+	}
+
+	if config.ISIM != nil || (config.Services != nil && len(isimServiceFlags(config.Services)) > 0) {
+		var isim *ISIMData
+		WithISIMChannel(reader, func() error {
+			data, err := ReadISIM(reader)
+			if err == nil && data.Available {
+				isim = data
+			}
+			return err
+		})
+		verifyISIM(config, isim, report)
+	}
+
+	verifySecrets(config, report)
+	return report, nil
+}
+
+// hasVerifiableUSIMFields reports whether config sets any field read from ADF_USIM or EF_ICCID
+func (c *SIMConfig) hasVerifiableUSIMFields() bool {
+	return c.hasUSIMFields() || c.ICCID != "" || c.MSISDN != "" || c.MCC != "" || len(c.Languages) > 0 ||
+		len(c.ACC) > 0 || c.ACCHex != "" || c.HPLMNPeriod > 0 || len(c.FPLMN) > 0
+}
+
+func verifyUSIM(config *SIMConfig, usim *USIMData, report *VerifyReport) {
+	if config.ICCID != "" {
+		report.compare("ICCID", normalizeICCID(config.ICCID), normalizeICCID(usim.ICCID))
+	}
+	if config.MSISDN != "" {
+		report.compare("MSISDN", normalizeMSISDN(config.MSISDN), normalizeMSISDN(usim.MSISDN))
+	}
+	if config.IMSI != "" {
+		report.compare("IMSI", config.IMSI, usim.IMSI)
+	}
+	if config.SPN != "" {
+		report.compare("SPN", strings.TrimSpace(config.SPN), strings.TrimSpace(usim.SPN))
+	}
+	if config.MCC != "" {
+		report.compare("MCC", config.MCC, usim.MCC)
+	}
+	if config.MNC != "" {
+		report.compare("MNC", config.MNC, usim.MNC)
+	}
+
+	if config.OperationMode != "" {
+		mode, err := ParseOperationMode(config.OperationMode)
+		ad := usim.RawFiles["EF_AD"]
+		switch {
+		case err != nil:
+			report.unreadable("Operation mode", config.OperationMode, err.Error())
+		case len(ad) == 0:
+			report.unreadable("Operation mode", config.OperationMode, "EF_AD not readable")
+		default:
+			report.compare("Operation mode", fmt.Sprintf("0x%02X", mode), fmt.Sprintf("0x%02X", ad[0]))
+		}
+	}
+
+	if len(config.Languages) > 0 {
+		report.compare("Languages", strings.ToLower(strings.Join(config.Languages, ",")),
+			strings.ToLower(strings.Join(usim.Languages, ",")))
+	}
+
+	if config.ACCHex != "" {
+		if raw := usim.RawFiles["EF_ACC"]; raw != nil {
+			report.compare("ACC", strings.ToUpper(config.ACCHex), fmt.Sprintf("%X", raw))
+		} else {
+			report.unreadable("ACC", strings.ToUpper(config.ACCHex), "EF_ACC not readable")
+		}
+	} else if len(config.ACC) > 0 {
+		report.compare("ACC", joinSortedInts(config.ACC), joinSortedInts(usim.ACC))
+	}
+
+	if config.HPLMNPeriod > 0 {
+		report.compare("HPLMN period", fmt.Sprintf("%d", config.HPLMNPeriod), fmt.Sprintf("%d", usim.HPLMNPeriod))
+	}
+
+	if len(config.HPLMN) > 0 {
+		report.compare("HPLMN", formatPLMNEntries(keepUnknownACT(plmnEntriesFromConfig(config.HPLMN), usim.HPLMN), true),
+			formatPLMNwACT(usim.HPLMN, true))
+	}
+	if len(config.OPLMN) > 0 {
+		report.compare("OPLMN", formatPLMNEntries(keepUnknownACT(plmnEntriesFromConfig(config.OPLMN), usim.OPLMN), false),
+			formatPLMNwACT(usim.OPLMN, false))
+	}
+	if len(config.UserPLMN) > 0 {
+		report.compare("User PLMN", formatPLMNEntries(keepUnknownACT(plmnEntriesFromConfig(config.UserPLMN), usim.UserPLMN), false),
+			formatPLMNwACT(usim.UserPLMN, false))
+	}
+
+	if len(config.FPLMN) > 0 {
+		report.compare("FPLMN", joinSorted(config.FPLMN), joinSorted(usim.FPLMN))
+	}
+	if config.ClearFPLMN {
+		if usim.RawFiles["EF_FPLMN"] != nil {
+			report.compare("FPLMN cleared", "", joinSorted(usim.FPLMN))
+		} else {
+			report.unreadable("FPLMN cleared", "", "EF_FPLMN not readable")
+		}
+	}
+
+	if config.Services != nil {
+		verifyServices(usimServiceFlags(config.Services), usim.UST, "UST", USTServices, report)
+	}
+}
+
+func verifyISIM(config *SIMConfig, isim *ISIMData, report *VerifyReport) {
+	if cfg := config.ISIM; cfg != nil {
+		current := &ISIMData{}
+		if isim != nil {
+			current = isim
+		}
+		type field struct{ name, expected, actual string }
+		var fields []field
+		if cfg.IMPI != "" {
+			fields = append(fields, field{"IMPI", cfg.IMPI, current.IMPI})
+		}
+		for i, impu := range cfg.IMPU {
+			fields = append(fields, field{fmt.Sprintf("IMPU %d", i+1), impu, indexOrEmpty(current.IMPU, i)})
+		}
+		if cfg.Domain != "" {
+			fields = append(fields, field{"Domain", cfg.Domain, current.Domain})
+		}
+		for i, pcscf := range cfg.PCSCF {
+			fields = append(fields, field{fmt.Sprintf("P-CSCF %d", i+1), pcscf, indexOrEmpty(current.PCSCF, i)})
+		}
+		for _, f := range fields {
+			if isim == nil {
+				report.unreadable(f.name, f.expected, "ISIM not available")
+			} else {
+				report.compare(f.name, f.expected, f.actual)
+			}
+		}
+	}
+
+	if config.Services != nil {
+		var ist map[int]bool
+		if isim != nil {
+			ist = isim.IST
+		}
+		verifyServices(isimServiceFlags(config.Services), ist, "IST", ISTServices, report)
+	}
+}
+
+// verifyServices compares each requested service flag with the service table
+func verifyServices(flags, table map[int]bool, tableName string, names map[int]string, report *VerifyReport) {
+	numbers := make([]int, 0, len(flags))
+	for n := range flags {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	state := func(enabled bool) string {
+		if enabled {
+			return "enabled"
+		}
+		return "disabled"
+	}
+	for _, n := range numbers {
+		name := fmt.Sprintf("%s %d", tableName, n)
+		if desc := names[n]; desc != "" {
+			name += " (" + desc + ")"
+		}
+		if table == nil {
+			report.unreadable(name, state(flags[n]), tableName+" not readable")
+			continue
+		}
+		report.compare(name, state(flags[n]), state(table[n]))
+	}
+}
+
+// verifySecrets reports configured values that cannot be read back from the card
+func verifySecrets(config *SIMConfig, report *VerifyReport) {
+	secrets := []struct {
+		name  string
+		value string
+	}{
+		{"Ki", config.Ki},
+		{"OP", config.OP},
+		{"OPc", config.OPc},
+		{"Algorithm", config.Algorithm},
+		{"PIN1", config.PIN1},
+		{"PUK1", config.PUK1},
+		{"PIN2", config.PIN2},
+		{"PUK2", config.PUK2},
+		{"ADM1", config.ADM1},
+	}
+	for _, s := range secrets {
+		if s.value != "" {
+			report.skipped(s.name, "cannot be read back from the card")
+		}
+	}
+	if config.GlobalPlatform != nil {
+		report.skipped("GlobalPlatform", "not verified")
+	}
+}
+
+// indexOrEmpty returns list[i], or "" past the end
+func indexOrEmpty(list []string, i int) string {
+	if i < len(list) {
+		return list[i]
+	}
+	return ""
+}
+
+// normalizeICCID removes filler digits and spaces
+func normalizeICCID(s string) string {
+	return strings.TrimRight(strings.ToUpper(strings.ReplaceAll(s, " ", "")), "F")
+}
+
+// normalizeMSISDN removes the international prefix and separators
+func normalizeMSISDN(s string) string {
+	return strings.NewReplacer("+", "", " ", "", "-", "").Replace(s)
+}
+
+func joinSorted(list []string) string {
+	sorted := append([]string(nil), list...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
+
+func joinSortedInts(list []int) string {
+	sorted := append([]int(nil), list...)
+	sort.Ints(sorted)
+	parts := make([]string, len(sorted))
+	for i, n := range sorted {
+		parts[i] = fmt.Sprintf("%d", n)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatPLMNEntries formats config entries as "MCC-MNC:act+act", sorted when order does not matter
+func formatPLMNEntries(entries []HPLMNEntry, unordered bool) string {
+	parts := make([]string, len(entries))
+	for i, e := range entries {
+		parts[i] = formatPLMN(e.MCC, e.MNC, e.ACT)
+	}
+	return joinPLMNs(parts, unordered)
+}
+
+// formatPLMNwACT formats card entries like formatPLMNEntries
+func formatPLMNwACT(list []PLMNwACT, unordered bool) string {
+	parts := make([]string, len(list))
+	for i, p := range list {
+		parts[i] = formatPLMN(p.MCC, p.MNC, p.ACT)
+	}
+	return joinPLMNs(parts, unordered)
+}
+
+func formatPLMN(mcc, mnc string, act uint16) string {
+	return fmt.Sprintf("%s-%s:%s", mcc, mnc, strings.Join(plmnActToStrings(act), "+"))
+}
+
+func joinPLMNs(parts []string, unordered bool) string {
+	if unordered {
+		sort.Strings(parts)
+	}
+	return strings.Join(parts, ", ")
+}
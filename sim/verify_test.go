@@ -0,0 +1,93 @@
+package sim
+
+import (
+	"testing"
+)
+
+// ============ CONFIG VERIFY TESTS ============
+
+func TestVerifyConfig(t *testing.T) {
+	reader, _ := newApplyTestReader()
+	written := &SIMConfig{
+		IMSI:  "001010000000001",
+		SPN:   "Test",
+		HPLMN: []HPLMNConfig{{MCC: "001", MNC: "01", ACT: []string{"eutran"}}},
+	}
+	if _, err := ApplyConfig(reader, written, false, false); err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		config *SIMConfig
+		want   map[string]VerifyStatus
+		ok     bool
+	}{
+		{"Match with normalization", &SIMConfig{
+			IMSI:  "001010000000001",
+			SPN:   " Test ",
+			HPLMN: []HPLMNConfig{{MCC: "001", MNC: "01", ACT: []string{"eutran"}}},
+		}, map[string]VerifyStatus{"IMSI": VerifyMatch, "SPN": VerifyMatch, "HPLMN": VerifyMatch}, true},
+		{"Mismatch", &SIMConfig{
+			IMSI:  "001010000000002",
+			HPLMN: []HPLMNConfig{{MCC: "001", MNC: "01", ACT: []string{"eutran", "utran"}}},
+		}, map[string]VerifyStatus{"IMSI": VerifyMismatch, "HPLMN": VerifyMismatch}, false},
+		{"Secrets skipped", &SIMConfig{IMSI: "001010000000001", Ki: "00112233445566778899AABBCCDDEEFF"},
+			map[string]VerifyStatus{"IMSI": VerifyMatch, "Ki": VerifySkipped}, true},
+		{"ISIM missing", &SIMConfig{ISIM: &ISIMConfig{IMPI: "a@b.c"}},
+			map[string]VerifyStatus{"IMPI": VerifyUnreadable}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := VerifyConfig(reader, tc.config)
+			if err != nil {
+				t.Fatalf("VerifyConfig() error = %v", err)
+			}
+			if len(report.Items) != len(tc.want) {
+				t.Errorf("report has %d items, want %d: %+v", len(report.Items), len(tc.want), report.Items)
+			}
+			for _, it := range report.Items {
+				if tc.want[it.Field] != it.Status {
+					t.Errorf("%s: status = %s, want %s (expected %q, actual %q)",
+						it.Field, it.Status, tc.want[it.Field], it.Expected, it.Actual)
+				}
+			}
+			if report.OK() != tc.ok {
+				t.Errorf("OK() = %v, want %v", report.OK(), tc.ok)
+			}
+		})
+	}
+}
+
+func TestFormatPLMNEntries(t *testing.T) {
+	a := []HPLMNEntry{{MCC: "001", MNC: "01", ACT: 0x4000}, {MCC: "250", MNC: "88", ACT: 0x4080}}
+	b := []HPLMNEntry{a[1], a[0]}
+
+	if formatPLMNEntries(a, true) != formatPLMNEntries(b, true) {
+		t.Errorf("unordered lists differ: %q vs %q", formatPLMNEntries(a, true), formatPLMNEntries(b, true))
+	}
+	if formatPLMNEntries(a, false) == formatPLMNEntries(b, false) {
+		t.Errorf("ordered lists compare equal: %q", formatPLMNEntries(a, false))
+	}
+	if got, want := formatPLMNEntries(a[:1], false), "001-01:eutran"; got != want {
+		t.Errorf("formatPLMNEntries() = %q, want %q", got, want)
+	}
+}
+
+func TestNormalizeICCID(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"8970101234567890123F", "8970101234567890123"},
+		{"8970 1012 3456 7890 123", "8970101234567890123"},
+		{"8970101234567890123", "8970101234567890123"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			if got := normalizeICCID(tc.in); got != tc.want {
+				t.Errorf("normalizeICCID(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,542 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// Voicemail configuration (TS 31.102): EF_MBDN (4.2.60) holds the mailbox dialling numbers
+// in the EF_ADN layout; numbers longer than 20 digits continue in EF_EXT6 (4.2.61), which
+// uses the EF_EXT1 record layout. EF_MBI (4.2.62) has one record per line (MSP profile)
+// with the EF_MBDN record of its voicemail, fax, e-mail, other and videomail box, EF_MWIS
+// (4.2.63) one record per line with the message waiting indicators and counts. EF_MBDN,
+// EF_EXT6 and EF_MBI belong to UST service 47, EF_MWIS to service 48. The files are in
+// ADF_USIM; some profiles carry them in DF_TELECOM only.
+var (
+	FID_EF_MBDN = []byte{0x6F, 0xC7}
+	FID_EF_EXT6 = []byte{0x6F, 0xC8}
+	FID_EF_MBI  = []byte{0x6F, 0xC9}
+	FID_EF_MWIS = []byte{0x6F, 0xCA}
+)
+
+// Locations reported in Voicemail.Location
+const (
+	VoicemailInUSIM    = "ADF_USIM"
+	VoicemailInTelecom = "DF_TELECOM"
+)
+
+// MailboxTypes are the mailboxes of a line in EF_MBI byte order and EF_MWIS bit order
+var MailboxTypes = []string{"voicemail", "fax", "email", "other", "videomail"}
+
+// ErrMBDNNotAllocated is returned when neither ADF_USIM nor DF_TELECOM has an EF_MBDN
+var ErrMBDNNotAllocated = errors.New("EF_MBDN is not allocated on this card (UST service 47)")
+
+// Mailbox is one used EF_MBDN record
+type Mailbox struct {
+	Record int    `json:"record"`
+	Name   string `json:"name,omitempty"`
+	Number string `json:"number,omitempty"`
+}
+
+// VoicemailLine is the EF_MBI and EF_MWIS record of one line
+type VoicemailLine struct {
+	Line      int            `json:"line"`
+	Mailboxes map[string]int `json:"mailboxes,omitempty"` // Mailbox type -> EF_MBDN record (EF_MBI)
+	Waiting   map[string]int `json:"waiting,omitempty"`   // Mailbox type with messages waiting -> count (EF_MWIS)
+}
+
+// Voicemail is the mailbox configuration and message waiting status of the card
+type Voicemail struct {
+	Location      string          `json:"location"`       // VoicemailInUSIM or VoicemailInTelecom
+	MBDNAvailable bool            `json:"mbdn_available"` // UST service 47
+	MWISAvailable bool            `json:"mwis_available"` // UST service 48
+	Mailboxes     []Mailbox       `json:"mailboxes,omitempty"`
+	Lines         []VoicemailLine `json:"lines,omitempty"`
+}
+
+// Mailbox returns the EF_MBDN record of the voicemail box of line (1 = first line). Cards
+// without EF_MBI use record 1 for line 1.
+func (v *Voicemail) Mailbox(line int) (Mailbox, bool) {
+	record := 0
+	if len(v.Lines) == 0 && line == 1 {
+		record = 1
+	}
+	for _, l := range v.Lines {
+		if l.Line == line {
+			record = l.Mailboxes["voicemail"]
+		}
+	}
+	for _, m := range v.Mailboxes {
+		if record != 0 && m.Record == record {
+			return m, true
+		}
+	}
+	return Mailbox{}, false
+}
+
+// String summarizes the voicemail number of line 1, e.g. "+79990001122 (Voicemail, EF_MBDN
+// record 1 in ADF_USIM)"
+func (v *Voicemail) String() string {
+	m, ok := v.Mailbox(1)
+	if !ok || m.Number == "" {
+		return fmt.Sprintf("not set (%s)", v.Location)
+	}
+	where := fmt.Sprintf("EF_MBDN record %d in %s", m.Record, v.Location)
+	if m.Name != "" {
+		where = m.Name + ", " + where
+	}
+	return fmt.Sprintf("%s (%s)", m.Number, where)
+}
+
+// WaitingString summarizes EF_MWIS, e.g. "line 1: voicemail 3, fax 1"; "" when no
+// message is waiting
+func (v *Voicemail) WaitingString() string {
+	var parts []string
+	for _, l := range v.Lines {
+		var waiting []string
+		for _, t := range MailboxTypes {
+			if count, ok := l.Waiting[t]; ok {
+				waiting = append(waiting, fmt.Sprintf("%s %d", t, count))
+			}
+		}
+		if len(waiting) > 0 {
+			parts = append(parts, fmt.Sprintf("line %d: %s", l.Line, strings.Join(waiting, ", ")))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// DecodeMBI decodes an EF_MBI record: one EF_MBDN record number per mailbox type (00 = no
+// mailbox). nil for an unused record.
+func DecodeMBI(data []byte) map[string]int {
+	if isEmptyRecord(data) {
+		return nil
+	}
+	var boxes map[string]int
+	for i, t := range MailboxTypes {
+		if i >= len(data) || data[i] == 0 || data[i] == 0xFF {
+			continue
+		}
+		if boxes == nil {
+			boxes = make(map[string]int)
+		}
+		boxes[t] = int(data[i])
+	}
+	return boxes
+}
+
+// DecodeMWIS decodes an EF_MWIS record: indicator status (b1 voicemail ... b5 videomail)
+// followed by the number of messages waiting per mailbox type. Only the mailbox types with
+// the indicator set are returned; nil when no message is waiting.
+func DecodeMWIS(data []byte) map[string]int {
+	if len(data) == 0 || isEmptyRecord(data) {
+		return nil
+	}
+	var waiting map[string]int
+	for i, t := range MailboxTypes {
+		if data[0]&(1<<i) == 0 {
+			continue
+		}
+		if waiting == nil {
+			waiting = make(map[string]int)
+		}
+		count := 0
+		if 1+i < len(data) {
+			count = int(data[1+i])
+		}
+		waiting[t] = count
+	}
+	return waiting
+}
+
+// decodeMBDNRecord decodes an EF_MBDN record with the EF_EXT6 records for its overflow
+// digits; nil for a free record
+func decodeMBDNRecord(data []byte, index int, ext6 [][]byte) *Mailbox {
+	entry := decodeADNRecord(data, index)
+	if entry == nil {
+		return nil
+	}
+	number := entry.Number
+	if number != "" {
+		number += decodeEXT1Chain(ext6, data[len(data)-1])
+	}
+	return &Mailbox{Record: index, Name: entry.Name, Number: number}
+}
+
+// readVoicemailFiles reads EF_MBDN with EF_EXT6 and EF_MBI (readMBDN) and EF_MWIS
+// (readMWIS) of the current DF. The voicemail is nil when none of the files is present.
+func readVoicemailFiles(reader *card.Reader, readMBDN, readMWIS bool) (vm *Voicemail, mbdnSt, mwisSt EFStatus) {
+	vm = &Voicemail{}
+	lines := map[int]*VoicemailLine{}
+	line := func(n int) *VoicemailLine {
+		if lines[n] == nil {
+			lines[n] = &VoicemailLine{Line: n}
+		}
+		return lines[n]
+	}
+
+	var mbdn, mwis [][]byte
+	if readMBDN {
+		if mbdn, mbdnSt = readLinearEFStatus(reader, 0x6FC7); mbdnSt.State == EFPresent {
+			ext6, _ := readLinearEF(reader, FID_EF_EXT6)
+			for i, rec := range mbdn {
+				if m := decodeMBDNRecord(rec, i+1, ext6); m != nil {
+					vm.Mailboxes = append(vm.Mailboxes, *m)
+				}
+			}
+			mbi, _ := readLinearEF(reader, FID_EF_MBI)
+			for i, rec := range mbi {
+				if boxes := DecodeMBI(rec); boxes != nil {
+					line(i + 1).Mailboxes = boxes
+				}
+			}
+		}
+	}
+	if readMWIS {
+		if mwis, mwisSt = readLinearEFStatus(reader, 0x6FCA); mwisSt.State == EFPresent {
+			for i, rec := range mwis {
+				if waiting := DecodeMWIS(rec); waiting != nil {
+					line(i + 1).Waiting = waiting
+				}
+			}
+		}
+	}
+	if mbdnSt.State != EFPresent && mwisSt.State != EFPresent {
+		return nil, mbdnSt, mwisSt
+	}
+	for n := 1; n <= 254 && len(vm.Lines) < len(lines); n++ {
+		if l, ok := lines[n]; ok {
+			vm.Lines = append(vm.Lines, *l)
+		}
+	}
+	return vm, mbdnSt, mwisSt
+}
+
+// readLinearEFStatus reads all records of a linear fixed EF of the current DF with the
+// outcome of its selection
+func readLinearEFStatus(reader *card.Reader, fileID uint16) ([][]byte, EFStatus) {
+	resp, st := selectEFStatus(reader, fileID)
+	if st.State != EFPresent {
+		return nil, st
+	}
+	recLen := parseFCPRecordSize(resp.Data)
+	if recLen == 0 {
+		return nil, EFStatus{State: EFError, Err: fmt.Errorf("record length of 0x%04X not found in FCP", fileID)}
+	}
+	count := parseFCPNumRecords(resp.Data)
+	if count == 0 {
+		count = 254
+	}
+	var records [][]byte
+	for _, r := range readRecordsAbsolute(reader, recLen, count) {
+		records = append(records, r.data)
+	}
+	return records, st
+}
+
+// readVoicemail reads the voicemail files of the selected USIM, or those of DF_TELECOM when
+// the USIM has none. The USIM is selected again afterwards.
+func (u *USIMData) readVoicemail(reader *card.Reader) {
+	readMBDN := !u.skipUnlessService("EF_MBDN")
+	readMWIS := !u.skipUnlessService("EF_MWIS")
+	if !readMBDN && !readMWIS {
+		return
+	}
+
+	location := VoicemailInUSIM
+	vm, mbdnSt, mwisSt := readVoicemailFiles(reader, readMBDN, readMWIS)
+	if vm == nil && mbdnSt.State != EFError && mwisSt.State != EFError {
+		if selectDFTelecom(reader) {
+			if tvm, tMBDN, tMWIS := readVoicemailFiles(reader, readMBDN, readMWIS); tvm != nil {
+				location, vm, mbdnSt, mwisSt = VoicemailInTelecom, tvm, tMBDN, tMWIS
+			}
+		}
+		selectUSIMADF(reader)
+	}
+	if readMBDN {
+		u.Files["EF_MBDN"] = mbdnSt
+	}
+	if readMWIS {
+		u.Files["EF_MWIS"] = mwisSt
+	}
+	if vm == nil {
+		return
+	}
+
+	vm.Location = location
+	vm.MBDNAvailable = u.UST[UST_MBDN]
+	vm.MWISAvailable = u.UST[UST_MWIS]
+	u.Voicemail = vm
+	if u.UST == nil {
+		return
+	}
+	if mbdnSt.State == EFPresent && !vm.MBDNAvailable {
+		u.Warnings = append(u.Warnings, fmt.Sprintf("EF_MBDN is present in %s but mailbox dialling numbers (UST service %d) are disabled", location, UST_MBDN))
+	}
+	if mwisSt.State == EFPresent && !vm.MWISAvailable {
+		u.Warnings = append(u.Warnings, fmt.Sprintf("EF_MWIS is present in %s but message waiting indication (UST service %d) is disabled", location, UST_MWIS))
+	}
+}
+
+// NormalizeVoicemailNumber removes spaces and dashes and checks the digits of a mailbox
+// number: "+" for international, then up to 20 digits in EF_MBDN and the rest in EF_EXT6
+func NormalizeVoicemailNumber(number string) (string, error) {
+	number = strings.NewReplacer(" ", "", "-", "").Replace(number)
+	main, overflow := splitDiallingNumber(number)
+	if _, err := encodeSMSPAddress(main, false); err != nil {
+		return "", fmt.Errorf("invalid voicemail number: %w", err)
+	}
+	for _, chunk := range ext1Chunks(overflow) {
+		if _, err := encodeSMSPAddress(chunk, false); err != nil {
+			return "", fmt.Errorf("invalid voicemail number %q: %w", number, err)
+		}
+	}
+	return number, nil
+}
+
+// splitDiallingNumber splits a number into the part of the dialling number record (with
+// the "+" and up to 20 digits) and the digits for the extension records
+func splitDiallingNumber(number string) (main, overflow string) {
+	prefix, digits := "", number
+	if strings.HasPrefix(number, "+") {
+		prefix, digits = "+", number[1:]
+	}
+	if len(digits) <= smspMaxAddrDigits {
+		return number, ""
+	}
+	return prefix + digits[:smspMaxAddrDigits], digits[smspMaxAddrDigits:]
+}
+
+// ext1Chunks splits overflow digits into the 20 digits of each extension record
+func ext1Chunks(digits string) []string {
+	var chunks []string
+	for len(digits) > smspMaxAddrDigits {
+		chunks = append(chunks, digits[:smspMaxAddrDigits])
+		digits = digits[smspMaxAddrDigits:]
+	}
+	if digits != "" {
+		chunks = append(chunks, digits)
+	}
+	return chunks
+}
+
+// encodeEXT1Chain encodes the overflow digits as additional data records (EF_EXT1 layout,
+// 13 bytes) chained through ids, which must hold one record number per chunk
+func encodeEXT1Chain(digits string, ids []int) ([][]byte, error) {
+	chunks := ext1Chunks(digits)
+	if len(ids) < len(chunks) {
+		return nil, fmt.Errorf("%d extension record(s) needed, %d free", len(chunks), len(ids))
+	}
+	records := make([][]byte, len(chunks))
+	for i, chunk := range chunks {
+		addr, err := encodeSMSPAddress(chunk, false)
+		if err != nil {
+			return nil, err
+		}
+		rec := make([]byte, 13)
+		rec[0] = 0x02 // additional data
+		rec[1] = addr[0] - 1
+		copy(rec[2:12], addr[2:])
+		rec[12] = 0xFF
+		if i+1 < len(chunks) {
+			rec[12] = byte(ids[i+1])
+		}
+		records[i] = rec
+	}
+	return records, nil
+}
+
+// ext1ChainIDs returns the record numbers of the extension chain starting at id
+func ext1ChainIDs(ext [][]byte, id byte) []int {
+	var ids []int
+	for hops := 0; id != 0xFF && id != 0 && int(id) <= len(ext) && hops < len(ext); hops++ {
+		ids = append(ids, int(id))
+		if rec := ext[id-1]; len(rec) >= 13 {
+			id = rec[12]
+		} else {
+			break
+		}
+	}
+	return ids
+}
+
+// selectMBDN selects EF_MBDN in ADF_USIM, or in DF_TELECOM when the USIM has none, and
+// returns its location and SELECT response. ErrMBDNNotAllocated when neither has one.
+func selectMBDN(reader *card.Reader) (string, *card.APDUResponse, error) {
+	resp, err := SelectUSIMWithAuth(reader)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to select USIM: %w", err)
+	}
+	if !resp.IsOK() {
+		return "", nil, fmt.Errorf("USIM selection failed: %s", resp.SWString())
+	}
+	if resp, err := reader.Select(FID_EF_MBDN); err == nil && resp.IsOK() {
+		return VoicemailInUSIM, resp, nil
+	}
+	if selectDFTelecom(reader) {
+		if resp, err := reader.Select(FID_EF_MBDN); err == nil && resp.IsOK() {
+			return VoicemailInTelecom, resp, nil
+		}
+	}
+	return "", nil, ErrMBDNNotAllocated
+}
+
+// VoicemailWrite describes what WriteVoicemail updated
+type VoicemailWrite struct {
+	Location string `json:"location"`       // VoicemailInUSIM or VoicemailInTelecom
+	Record   int    `json:"record"`         // EF_MBDN record
+	EXT6     []int  `json:"ext6,omitempty"` // EF_EXT6 records holding the overflow digits
+	MBI      bool   `json:"mbi"`            // EF_MBI record 1 now refers to Record
+}
+
+// WriteVoicemail writes the voicemail number of line 1 to the EF_MBDN record that EF_MBI
+// record 1 refers to, keeping its alpha identifier. Without a reference the first free
+// record is used and EF_MBI is updated to refer to it. Digits beyond 20 go to free EF_EXT6
+// records (and those of the old number). UST service 47 is marked available afterwards;
+// the error is then ErrUSTTooShort when EF_UST has no byte for it.
+func WriteVoicemail(reader *card.Reader, number string) (*VoicemailWrite, error) {
+	number, err := NormalizeVoicemailNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	if drv := FindDriver(reader); drv != nil {
+		if err := drv.PrepareWrite(reader); err != nil {
+			return nil, fmt.Errorf("prepare write failed: %w", err)
+		}
+	}
+
+	location, resp, err := selectMBDN(reader)
+	if err != nil {
+		return nil, err
+	}
+	recLen := parseFCPRecordSize(resp.Data)
+	if recLen < 14 {
+		return nil, fmt.Errorf("EF_MBDN record length not found in FCP")
+	}
+	count := parseFCPNumRecords(resp.Data)
+	if count == 0 {
+		count = 254
+	}
+	records := readRecordsAbsolute(reader, recLen, count)
+	if len(records) == 0 {
+		return nil, fmt.Errorf("EF_MBDN has no readable record")
+	}
+
+	// Target record: the EF_MBI reference of line 1, else the first free record
+	result := &VoicemailWrite{Location: location}
+	mbi, hasMBI := readLinearEF(reader, FID_EF_MBI)
+	if hasMBI && len(mbi) > 0 && len(mbi[0]) > 0 && mbi[0][0] != 0 && mbi[0][0] != 0xFF && int(mbi[0][0]) <= len(records) {
+		result.Record = int(mbi[0][0])
+	} else {
+		for _, r := range records {
+			if isEmptyRecord(r.data) {
+				result.Record = r.index
+				break
+			}
+		}
+		if result.Record == 0 {
+			result.Record = 1
+		}
+		result.MBI = hasMBI && len(mbi) > 0
+	}
+	current := records[result.Record-1].data
+
+	name := ""
+	if entry := decodeADNRecord(current, result.Record); entry != nil {
+		name = entry.Name
+	}
+	main, overflow := splitDiallingNumber(number)
+	rec, err := encodeADNRecord(name, main, recLen)
+	if err != nil {
+		return nil, err
+	}
+
+	// Overflow digits: the chain of the old number is reused, then free EF_EXT6 records
+	var ext6, chain [][]byte
+	var oldIDs []int
+	if !isEmptyRecord(current) {
+		ext6, _ = readLinearEF(reader, FID_EF_EXT6)
+		oldIDs = ext1ChainIDs(ext6, current[len(current)-1])
+	}
+	if overflow != "" {
+		if ext6 == nil {
+			if ext6, _ = readLinearEF(reader, FID_EF_EXT6); ext6 == nil {
+				return nil, fmt.Errorf("number has %d digits beyond 20 but the card has no EF_EXT6", len(overflow))
+			}
+		}
+		ids := append([]int(nil), oldIDs...)
+		for i, r := range ext6 {
+			if isEmptyRecord(r) {
+				ids = append(ids, i+1)
+			}
+		}
+		if chain, err = encodeEXT1Chain(overflow, ids); err != nil {
+			return nil, fmt.Errorf("EF_EXT6: %w", err)
+		}
+		result.EXT6 = ids[:len(chain)]
+		rec[len(rec)-1] = byte(result.EXT6[0])
+	}
+
+	// EF_EXT6 first, so that EF_MBDN never refers to a missing extension
+	if len(chain) > 0 || len(oldIDs) > 0 {
+		if err := updateRecords(reader, FID_EF_EXT6, "EF_EXT6", ext1ChainUpdates(chain, result.EXT6, oldIDs)); err != nil {
+			return nil, err
+		}
+	}
+	if err := updateRecords(reader, FID_EF_MBDN, "EF_MBDN", map[int][]byte{result.Record: rec}); err != nil {
+		return nil, err
+	}
+	if result.MBI {
+		ref := append([]byte(nil), mbi[0]...)
+		ref[0] = byte(result.Record)
+		if err := updateRecords(reader, FID_EF_MBI, "EF_MBI", map[int][]byte{1: ref}); err != nil {
+			return nil, err
+		}
+	}
+	return result, setUSTServiceIfRoom(reader, UST_MBDN)
+}
+
+// ext1ChainUpdates returns the extension records to write: the new chain and, cleared,
+// the records of the old chain it does not reuse
+func ext1ChainUpdates(chain [][]byte, ids, oldIDs []int) map[int][]byte {
+	updates := make(map[int][]byte)
+	for _, id := range oldIDs {
+		free := make([]byte, 13)
+		for i := range free {
+			free[i] = 0xFF
+		}
+		updates[id] = free
+	}
+	for i, rec := range chain {
+		updates[ids[i]] = rec
+	}
+	return updates
+}
+
+// updateRecords selects the EF of the current DF and updates the records
+func updateRecords(reader *card.Reader, fid []byte, name string, records map[int][]byte) error {
+	resp, err := reader.Select(fid)
+	if err != nil {
+		return fmt.Errorf("failed to select %s: %w", name, err)
+	}
+	if !resp.IsOK() {
+		return fmt.Errorf("%s selection failed: %s", name, resp.SWString())
+	}
+	for n := 1; n <= 254; n++ {
+		data, ok := records[n]
+		if !ok {
+			continue
+		}
+		resp, err := reader.UpdateRecord(byte(n), data)
+		if err != nil {
+			return fmt.Errorf("failed to write %s record %d: %w", name, n, err)
+		}
+		if !resp.IsOK() {
+			return fmt.Errorf("%s record %d write failed: %s", name, n, resp.SWString())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ VOICEMAIL TESTS ============
+
+// mbdnTestRecord is an EF_MBDN record "Voicemail" with a 22 digit number whose last two
+// digits are in EF_EXT6 record 1
+const mbdnTestRecord = "566F6963656D61696CFF" + "0B91" + "97990010213243546576" + "FF" + "01"
+
+func freeRecord(n int) []byte {
+	return bytes.Repeat([]byte{0xFF}, n)
+}
+
+// mockChild returns the file fid of dir
+func mockChild(dir *card.MockFile, fid uint16) *card.MockFile {
+	for _, c := range dir.Children {
+		if c.FID == fid {
+			return c
+		}
+	}
+	return nil
+}
+
+// newVoicemailTestCard returns a USIM with UST services 47 and 48 and the voicemail files
+// in dir (the ADF_USIM, or DF_TELECOM when telecom is set): EF_MBDN record 1 used, EF_EXT6
+// with the overflow of record 1 and a free record, EF_MBI line 1 and EF_MWIS line 1 (3
+// voicemails waiting)
+func newVoicemailTestCard(t *testing.T, telecom bool) (*card.MockCard, *card.MockFile) {
+	t.Helper()
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	usim := m.AddADF(AID_USIM)
+	usim.AddEF(0x6F38, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0xC0})
+	dir := usim
+	if telecom {
+		dir = m.MF().AddDF(0x7F10)
+	}
+	dir.AddRecordEF(0x6FC7, mustHex(mbdnTestRecord), freeRecord(24))
+	dir.AddRecordEF(0x6FC8, mustHex("020121FFFFFFFFFFFFFFFFFFFF"), freeRecord(13))
+	dir.AddRecordEF(0x6FC9, []byte{0x01, 0x00, 0x00, 0x00})
+	dir.AddRecordEF(0x6FCA, []byte{0x01, 0x03, 0x00, 0x00, 0x00})
+	return m, dir
+}
+
+func TestReadUSIM_Voicemail(t *testing.T) {
+	for _, telecom := range []bool{false, true} {
+		m, _ := newVoicemailTestCard(t, telecom)
+		data, err := ReadUSIM(card.NewReaderWithTransport("Mock", m.ATR, m))
+		if err != nil {
+			t.Fatalf("ReadUSIM() error = %v", err)
+		}
+		vm := data.Voicemail
+		if vm == nil {
+			t.Fatalf("telecom %v: Voicemail = nil", telecom)
+		}
+		wantLocation := VoicemailInUSIM
+		if telecom {
+			wantLocation = VoicemailInTelecom
+		}
+		if vm.Location != wantLocation || !vm.MBDNAvailable || !vm.MWISAvailable {
+			t.Errorf("Voicemail = %s, MBDN %v, MWIS %v; want %s, true, true", vm.Location, vm.MBDNAvailable, vm.MWISAvailable, wantLocation)
+		}
+		want := Mailbox{Record: 1, Name: "Voicemail", Number: "+7999000112233445566712"}
+		if got, ok := vm.Mailbox(1); !ok || got != want {
+			t.Errorf("Mailbox(1) = %+v, %v; want %+v (digits 21-22 from EF_EXT6)", got, ok, want)
+		}
+		if got := vm.WaitingString(); got != "line 1: voicemail 3" {
+			t.Errorf("WaitingString() = %q", got)
+		}
+		if !data.Files.Present("EF_MBDN") || !data.Files.Present("EF_MWIS") {
+			t.Errorf("Files = %+v, want EF_MBDN and EF_MWIS present", data.Files)
+		}
+		if cfg := ExportToConfig(data, nil); cfg.Voicemail != vm {
+			t.Error("ExportToConfig() does not export the voicemail configuration")
+		}
+		// The UST was read after DF_TELECOM: ADF_USIM is selected again
+		if _, raw, err := readEF(card.NewReaderWithTransport("Mock", m.ATR, m), 0x6F38); err != nil || len(raw) != 6 {
+			t.Errorf("telecom %v: EF_UST after ReadUSIM = %X, %v; USIM no longer selected", telecom, raw, err)
+		}
+	}
+}
+
+func TestReadUSIM_VoicemailServiceWarning(t *testing.T) {
+	m, _ := newVoicemailTestCard(t, false)
+	mockChild(m.MF().Children[0], 0x6F38).Data = []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	data, _ := ReadUSIM(card.NewReaderWithTransport("Mock", m.ATR, m))
+	if data.Voicemail != nil || data.Files["EF_MBDN"].Service != UST_MBDN {
+		t.Errorf("without UST service 47: Voicemail = %+v, EF_MBDN = %+v; want skipped", data.Voicemail, data.Files["EF_MBDN"])
+	}
+
+	ReadAllFiles = true
+	defer func() { ReadAllFiles = false }()
+	data, _ = ReadUSIM(card.NewReaderWithTransport("Mock", m.ATR, m))
+	if data.Voicemail == nil || len(data.Warnings) != 2 {
+		t.Errorf("ReadAllFiles: Voicemail = %+v, warnings %q; want both files with a warning each", data.Voicemail, data.Warnings)
+	}
+}
+
+func TestDecodeMBIAndMWIS(t *testing.T) {
+	if got := DecodeMBI([]byte{0x02, 0x00, 0x03, 0x00, 0xFF}); !reflect.DeepEqual(got, map[string]int{"voicemail": 2, "email": 3}) {
+		t.Errorf("DecodeMBI() = %v", got)
+	}
+	if got := DecodeMBI(freeRecord(4)); got != nil {
+		t.Errorf("DecodeMBI(free) = %v, want nil", got)
+	}
+	// Fax indicator without count byte, videomail count 7
+	if got := DecodeMWIS([]byte{0x12, 0x00, 0x00, 0x00, 0x00, 0x07}); !reflect.DeepEqual(got, map[string]int{"fax": 0, "videomail": 7}) {
+		t.Errorf("DecodeMWIS() = %v", got)
+	}
+	if got := DecodeMWIS([]byte{0x00, 0x05, 0x00, 0x00, 0x00}); got != nil {
+		t.Errorf("DecodeMWIS(no indicator) = %v, want nil", got)
+	}
+}
+
+func TestNormalizeVoicemailNumber(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"+7 999 000-11-22", "+79990001122", false},
+		{"*86", "*86", false},
+		{"+123456789012345678901234567890123456789012345", "+123456789012345678901234567890123456789012345", false},
+		{"", "", true},
+		{"+7999abc", "", true},
+		{"+1234567890123456789012a", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeVoicemailNumber(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeVoicemailNumber(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWriteVoicemail(t *testing.T) {
+	tests := []struct {
+		name     string
+		mbi      []byte
+		number   string
+		wantRec  int
+		wantEXT6 []int
+		wantMBI  []byte
+	}{
+		// The chain of the old number is reused, then the free record
+		{"long number", []byte{0x01, 0x00, 0x00, 0x00}, "+1234567890123456789012345678901234567890123", 1, []int{1, 2}, []byte{0x01, 0x00, 0x00, 0x00}},
+		// EF_EXT6 record 1 of the old number is cleared
+		{"short number", []byte{0x01, 0x00, 0x00, 0x00}, "+79990001122", 1, nil, []byte{0x01, 0x00, 0x00, 0x00}},
+		// No reference for line 1: first free record, EF_MBI updated
+		{"no reference", []byte{0x00, 0x04, 0x00, 0x00}, "+79990001122", 2, nil, []byte{0x02, 0x04, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, dir := newVoicemailTestCard(t, false)
+			mockChild(dir, 0x6F38).Data = []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00} // UST without 47/48
+			mbi := mockChild(dir, 0x6FC9)
+			mbi.Records[0] = tt.mbi
+			reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+
+			written, err := WriteVoicemail(reader, tt.number)
+			if err != nil {
+				t.Fatalf("WriteVoicemail() error = %v", err)
+			}
+			if written.Location != VoicemailInUSIM || written.Record != tt.wantRec || !reflect.DeepEqual(written.EXT6, tt.wantEXT6) {
+				t.Errorf("WriteVoicemail() = %+v, want record %d, EXT6 %v", written, tt.wantRec, tt.wantEXT6)
+			}
+			if !bytes.Equal(mbi.Records[0], tt.wantMBI) {
+				t.Errorf("EF_MBI record 1 = %X, want %X", mbi.Records[0], tt.wantMBI)
+			}
+
+			data, err := ReadUSIM(reader)
+			if err != nil {
+				t.Fatalf("ReadUSIM() error = %v", err)
+			}
+			if !data.UST[UST_MBDN] {
+				t.Error("UST service 47 not marked available")
+			}
+			got, _ := data.Voicemail.Mailbox(1)
+			if got.Number != tt.number {
+				t.Errorf("Mailbox(1) = %+v, want number %s", got, tt.number)
+			}
+			if tt.wantRec == 1 && got.Name != "Voicemail" {
+				t.Errorf("alpha identifier = %q, want Voicemail kept", got.Name)
+			}
+			if tt.wantEXT6 == nil && tt.wantRec == 1 && !isEmptyRecord(mockChild(dir, 0x6FC8).Records[0]) {
+				t.Errorf("EF_EXT6 record 1 = %X, want cleared", mockChild(dir, 0x6FC8).Records[0])
+			}
+		})
+	}
+}
+
+func TestWriteVoicemail_Errors(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.AddADF(AID_USIM)
+	reader := card.NewReaderWithTransport("Mock", m.ATR, m)
+	if _, err := WriteVoicemail(reader, "+79990001122"); !errors.Is(err, ErrMBDNNotAllocated) {
+		t.Errorf("WriteVoicemail() without EF_MBDN error = %v, want ErrMBDNNotAllocated", err)
+	}
+
+	m, dir := newVoicemailTestCard(t, false)
+	mockChild(dir, 0x6FC8).Records = [][]byte{mustHex("020121FFFFFFFFFFFFFFFFFFFF")}
+	reader = card.NewReaderWithTransport("Mock", m.ATR, m)
+	if _, err := WriteVoicemail(reader, "+1234567890123456789012345678901234567890123"); err == nil {
+		t.Error("WriteVoicemail() with one EF_EXT6 record for 23 overflow digits succeeded")
+	}
+}
@@ -0,0 +1,203 @@
+package sim
+
+import (
+	"fmt"
+	"strings"
+
+	"sim_reader/card"
+)
+
+// WriteTarget is an EF updated by a planned write
+type WriteTarget struct {
+	Item        string // what is written: IMSI, SPN, ISIM IMPU, ...
+	Application string // ADF_USIM or ADF_ISIM
+	FID         uint16
+}
+
+// USIMWriteTarget returns the target of a write of item to the USIM file fid
+func USIMWriteTarget(item string, fid uint16) WriteTarget {
+	return WriteTarget{Item: item, Application: "ADF_USIM", FID: fid}
+}
+
+// ISIMWriteTarget returns the target of a write of item to the ISIM file fid
+func ISIMWriteTarget(item string, fid uint16) WriteTarget {
+	return WriteTarget{Item: item, Application: "ADF_ISIM", FID: fid}
+}
+
+// ConfigWriteTargets returns the files ApplyConfig updates for config. Parameters written
+// through a programmable card driver (Ki, OPc, ICCID, ...) use proprietary files and
+// commands and are not included.
+func ConfigWriteTargets(config *SIMConfig) []WriteTarget {
+	var targets []WriteTarget
+	add := func(set bool, t WriteTarget) {
+		if set {
+			targets = append(targets, t)
+		}
+	}
+
+	add(config.IMSI != "", USIMWriteTarget("IMSI", 0x6F07))
+	add(config.SPN != "", USIMWriteTarget("SPN", 0x6F46))
+	add(config.PSISMSC != "", USIMWriteTarget("PSI SMSC", 0x6FE5))
+	add(config.SMS != nil, USIMWriteTarget("SMS parameters", 0x6F42))
+	add(config.MNC != "" || config.OperationMode != "", USIMWriteTarget("Administrative data", 0x6FAD))
+	add(config.ClearFPLMN, USIMWriteTarget("Clear FPLMN", 0x6F7B))
+	add(len(config.HPLMN) > 0, USIMWriteTarget("HPLMN", 0x6F62))
+	add(len(config.OPLMN) > 0, USIMWriteTarget("OPLMN", 0x6F61))
+	add(len(config.UserPLMN) > 0, USIMWriteTarget("User PLMN", 0x6F60))
+	if config.Services != nil {
+		add(len(usimServiceFlags(config.Services)) > 0, USIMWriteTarget("USIM services", 0x6F38))
+	}
+
+	if isim := config.ISIM; isim != nil {
+		add(isim.IMPI != "", ISIMWriteTarget("IMPI", 0x6F02))
+		add(isim.Domain != "", ISIMWriteTarget("Domain", 0x6F03))
+		add(len(isim.IMPU) > 0, ISIMWriteTarget("IMPU", 0x6F04))
+		add(len(isim.PCSCF) > 0, ISIMWriteTarget("P-CSCF", 0x6F09))
+		if config.Services != nil {
+			add(len(isimServiceFlags(config.Services)) > 0, ISIMWriteTarget("ISIM services", 0x6F07))
+		}
+	}
+	return targets
+}
+
+// WriteAccessCheck is the UPDATE access condition of one planned write
+type WriteAccessCheck struct {
+	Item        string `json:"item"`
+	Application string `json:"application"`
+	File        string `json:"file"`                 // EF name
+	FID         string `json:"fid"`                  // hex
+	Access      string `json:"access,omitempty"`     // UPDATE access condition read from the card
+	Credential  string `json:"credential,omitempty"` // required: PIN2, ADM1, ADM1/ADM2 ("/" = any, "&" = all)
+	Provided    bool   `json:"provided"`
+	Resolved    bool   `json:"resolved"` // false when the condition could not be read: the write is attempted
+	Note        string `json:"note,omitempty"`
+}
+
+// Blocking reports whether the write can not succeed with the provided credentials
+func (c WriteAccessCheck) Blocking() bool {
+	return c.Resolved && !c.Provided
+}
+
+// WriteAccessReport is the result of CheckWriteAccess
+type WriteAccessReport struct {
+	Checks []WriteAccessCheck `json:"checks"`
+}
+
+// Missing returns the writes that need a credential that was not provided
+func (r *WriteAccessReport) Missing() []WriteAccessCheck {
+	var missing []WriteAccessCheck
+	for _, c := range r.Checks {
+		if c.Blocking() {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+// Unresolved returns the writes whose access condition could not be read
+func (r *WriteAccessReport) Unresolved() []WriteAccessCheck {
+	var unresolved []WriteAccessCheck
+	for _, c := range r.Checks {
+		if !c.Resolved {
+			unresolved = append(unresolved, c)
+		}
+	}
+	return unresolved
+}
+
+// Err returns an error listing the missing credentials, nil when every resolved write
+// can be performed
+func (r *WriteAccessReport) Err() error {
+	missing := r.Missing()
+	if len(missing) == 0 {
+		return nil
+	}
+	var parts []string
+	for _, c := range missing {
+		if c.Credential == "" {
+			parts = append(parts, fmt.Sprintf("%s is not writable (%s)", c.File, c.Access))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s requires %s", c.File, c.Credential))
+		}
+	}
+	return fmt.Errorf("missing credentials for %d planned write(s): %s", len(missing), strings.Join(parts, ", "))
+}
+
+// CheckWriteAccess resolves the UPDATE access condition of each target from its FCP and
+// the EF_ARR rules of its application, and compares it with creds. It only selects files
+// and reads EF_ARR, so it can run before any PIN or ADM key is verified. Files that are
+// not found and conditions that cannot be resolved (EF_ARR unreadable, proprietary
+// attributes) are reported as unresolved and do not block.
+func CheckWriteAccess(reader *card.Reader, targets []WriteTarget, creds Credentials) *WriteAccessReport {
+	report := &WriteAccessReport{}
+	byApp := make(map[string]map[string]FileAccessInfo)
+
+	for _, t := range targets {
+		check := WriteAccessCheck{
+			Item:        t.Item,
+			Application: t.Application,
+			File:        writeTargetName(t),
+			FID:         fmt.Sprintf("%04X", t.FID),
+		}
+
+		access, ok := byApp[t.Application]
+		if !ok {
+			access = readTargetAccess(reader, t.Application, targets)
+			byApp[t.Application] = access
+		}
+		info, found := access[check.FID]
+		if !found {
+			check.Note = "file not found"
+			report.Checks = append(report.Checks, check)
+			continue
+		}
+		check.Access = info.WriteAccess
+
+		credential, assumed, ok := snapshotCredential(info.WriteAccess)
+		switch {
+		case info.WriteAccess == "Never":
+			check.Resolved = true
+		case !ok || assumed:
+			check.Note = "access condition unknown"
+		default:
+			check.Credential = credential
+			check.Provided = creds.Satisfies(credential)
+			check.Resolved = true
+		}
+		report.Checks = append(report.Checks, check)
+	}
+	return report
+}
+
+// readTargetAccess reads the access conditions of the targets of an application, keyed
+// by FID
+func readTargetAccess(reader *card.Reader, app string, targets []WriteTarget) map[string]FileAccessInfo {
+	aid := GetUSIMAID()
+	if app == "ADF_ISIM" {
+		aid = GetISIMAID()
+	}
+	var files []accessCheckFile
+	for _, t := range targets {
+		if t.Application == app {
+			files = append(files, accessCheckFile{id: []byte{byte(t.FID >> 8), byte(t.FID)}, name: writeTargetName(t)})
+		}
+	}
+
+	access := make(map[string]FileAccessInfo)
+	for _, info := range readAccessConditions(reader, aid, "", files) {
+		access[info.FileID] = info
+	}
+	return access
+}
+
+// writeTargetName returns the EF name of a target
+func writeTargetName(t WriteTarget) string {
+	files := USIM_Files
+	if t.Application == "ADF_ISIM" {
+		files = ISIM_Files
+	}
+	if def, ok := files[t.FID]; ok {
+		return def.Name
+	}
+	return fmt.Sprintf("EF_%04X", t.FID)
+}
@@ -0,0 +1,122 @@
+package sim
+
+import (
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+)
+
+// ============ WRITE ACCESS CHECK TESTS ============
+
+// newWriteAccessTestCard returns a USIM whose EF_ARR gives EF_IMSI to ADM1, EF_SPN to ADM2
+// and EF_FPLMN to nobody; EF_UST references a rule that is not in EF_ARR
+func newWriteAccessTestCard() (*card.Reader, *card.MockCard) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	usim := m.AddADF(AID_USIM)
+	usim.AddRecordEF(0x6F06,
+		[]byte{0x80, 0x01, 0x01, 0x90, 0x00, 0x80, 0x01, 0x02, 0xA4, 0x06, 0x83, 0x01, 0x0A, 0x95, 0x01, 0x08},
+		[]byte{0x80, 0x01, 0x01, 0x90, 0x00, 0x80, 0x01, 0x02, 0xA4, 0x06, 0x83, 0x01, 0x0B, 0x95, 0x01, 0x08},
+		[]byte{0x80, 0x01, 0x01, 0x90, 0x00, 0x80, 0x01, 0x02, 0x97, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+	)
+	usim.AddEF(0x6F07, make([]byte, 9)).ARR = []byte{0x6F, 0x06, 0x01}
+	usim.AddEF(0x6F46, make([]byte, 17)).ARR = []byte{0x6F, 0x06, 0x02}
+	usim.AddEF(0x6F7B, make([]byte, 12)).ARR = []byte{0x6F, 0x06, 0x03}
+	usim.AddEF(0x6F38, make([]byte, 8)).ARR = []byte{0x6F, 0x06, 0x09}
+	return card.NewReaderWithTransport("Mock", m.ATR, m), m
+}
+
+func TestCheckWriteAccess(t *testing.T) {
+	reader, m := newWriteAccessTestCard()
+	targets := []WriteTarget{
+		USIMWriteTarget("IMSI", 0x6F07),
+		USIMWriteTarget("SPN", 0x6F46),
+		USIMWriteTarget("Clear FPLMN", 0x6F7B),
+		USIMWriteTarget("USIM services", 0x6F38),
+		USIMWriteTarget("HPLMN", 0x6F62),
+	}
+	creds := Credentials{CredentialNone: true, CredentialPIN1: true, CredentialADM1: true}
+
+	report := CheckWriteAccess(reader, targets, creds)
+	if len(report.Checks) != len(targets) {
+		t.Fatalf("got %d checks, want %d", len(report.Checks), len(targets))
+	}
+
+	want := []struct {
+		file       string
+		credential string
+		provided   bool
+		resolved   bool
+	}{
+		{"EF_IMSI", "ADM1", true, true},
+		{"EF_SPN", "ADM2", false, true},
+		{"EF_FPLMN", "", false, true}, // Never
+		{"EF_UST", "", false, false},  // rule not in EF_ARR
+		{"EF_HPLMNwACT", "", false, false},
+	}
+	for i, w := range want {
+		c := report.Checks[i]
+		if c.File != w.file || c.Credential != w.credential || c.Provided != w.provided || c.Resolved != w.resolved {
+			t.Errorf("check %d = %+v, want %+v", i, c, w)
+		}
+	}
+
+	if n := len(report.Missing()); n != 2 {
+		t.Errorf("Missing() = %d checks, want 2 (EF_SPN, EF_FPLMN)", n)
+	}
+	if n := len(report.Unresolved()); n != 2 {
+		t.Errorf("Unresolved() = %d checks, want 2 (EF_UST, EF_HPLMNwACT)", n)
+	}
+	err := report.Err()
+	if err == nil || !strings.Contains(err.Error(), "EF_SPN requires ADM2") || !strings.Contains(err.Error(), "EF_FPLMN is not writable (Never)") {
+		t.Errorf("Err() = %v", err)
+	}
+
+	// Nothing is verified or written by the check
+	for _, apdu := range m.Log {
+		if apdu[1] != card.INS_SELECT && apdu[1] != 0xB2 && apdu[1] != 0xB0 && apdu[1] != 0xC0 {
+			t.Errorf("unexpected command %X during the check", apdu)
+		}
+	}
+}
+
+func TestCheckWriteAccess_AllProvided(t *testing.T) {
+	reader, _ := newWriteAccessTestCard()
+	creds := Credentials{CredentialNone: true, CredentialADM1: true, CredentialADM2: true}
+
+	report := CheckWriteAccess(reader, []WriteTarget{
+		USIMWriteTarget("IMSI", 0x6F07),
+		USIMWriteTarget("SPN", 0x6F46),
+	}, creds)
+	if err := report.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestCheckWriteAccess_NoApplication(t *testing.T) {
+	reader, _ := newWriteAccessTestCard()
+
+	// No ISIM on the card: the writes are unresolved, not blocked
+	report := CheckWriteAccess(reader, []WriteTarget{ISIMWriteTarget("IMPI", 0x6F02)}, Credentials{})
+	if len(report.Unresolved()) != 1 || report.Err() != nil {
+		t.Errorf("report = %+v, want one unresolved check", report.Checks)
+	}
+}
+
+func TestConfigWriteTargets(t *testing.T) {
+	volte := true
+	config := &SIMConfig{
+		IMSI:       "001010123456789",
+		ClearFPLMN: true,
+		Services:   &ServicesConfig{VoLTE: &volte},
+		ISIM:       &ISIMConfig{IMPU: []string{"sip:a@b"}},
+	}
+	var got []string
+	for _, t := range ConfigWriteTargets(config) {
+		got = append(got, t.Application+"/"+writeTargetName(t))
+	}
+	want := "ADF_USIM/EF_IMSI ADF_USIM/EF_FPLMN ADF_USIM/EF_UST ADF_ISIM/EF_IMPU"
+	if strings.Join(got, " ") != want {
+		t.Errorf("ConfigWriteTargets = %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,683 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// YAML support for configuration files.
+//
+// Only the block-style subset needed for SIMConfig is supported: mappings, sequences,
+// plain/single/double-quoted scalars, flow sequences of scalars ([a, b]), empty flow
+// collections ({} / []) and # comments. Anchors, tags, multi-documents and block
+// scalars (| >) are rejected. YAML is converted to JSON guided by the target Go type
+// (so "mnc: 01" stays the string "01") and then decoded with the same strict JSON
+// schema validation used for .json files.
+
+// IsYAMLFile reports whether the filename has a .yaml or .yml extension
+func IsYAMLFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+type yamlKind int
+
+const (
+	yamlScalar yamlKind = iota
+	yamlMap
+	yamlSeq
+)
+
+type yamlNode struct {
+	kind   yamlKind
+	value  string
+	quoted bool
+	keys   []string
+	fields map[string]*yamlNode
+	items  []*yamlNode
+	line   int
+}
+
+func (n *yamlNode) isNull() bool {
+	if n == nil {
+		return true
+	}
+	if n.kind != yamlScalar || n.quoted {
+		return false
+	}
+	switch n.value {
+	case "", "~", "null", "Null", "NULL":
+		return true
+	}
+	return false
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAML parses a YAML document into a node tree
+func parseYAML(data []byte) (*yamlNode, error) {
+	lines, err := splitYAMLLines(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return &yamlNode{kind: yamlMap, fields: map[string]*yamlNode{}}, nil
+	}
+	p := &yamlParser{lines: lines}
+	node, err := p.parseBlock(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("yaml: line %d: unexpected content", p.lines[p.pos].num)
+	}
+	return node, nil
+}
+
+// splitYAMLLines strips comments and blank lines and records indentation
+func splitYAMLLines(src string) ([]yamlLine, error) {
+	var out []yamlLine
+	for i, raw := range strings.Split(src, "\n") {
+		num := i + 1
+		raw = strings.TrimRight(raw, "\r")
+		text := strings.TrimRight(stripYAMLComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed for indentation", num)
+		}
+		if len(out) == 0 && trimmed == "---" {
+			continue
+		}
+		if trimmed == "..." {
+			break
+		}
+		if trimmed == "---" {
+			return nil, fmt.Errorf("yaml: line %d: multiple documents are not supported", num)
+		}
+		out = append(out, yamlLine{num: num, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	return out, nil
+}
+
+// stripYAMLComment removes a trailing # comment outside quotes
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" \t:-[{,", rune(s[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseBlock(indent int) (*yamlNode, error) {
+	if isYAMLSeqItem(p.lines[p.pos].text) {
+		return p.parseSeq(indent)
+	}
+	return p.parseMap(indent)
+}
+
+func (p *yamlParser) parseSeq(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlSeq, line: p.lines[p.pos].num}
+	for p.pos < len(p.lines) {
+		ln := p.lines[p.pos]
+		if ln.indent < indent {
+			break
+		}
+		if ln.indent > indent {
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", ln.num)
+		}
+		if !isYAMLSeqItem(ln.text) {
+			break
+		}
+
+		rest := strings.TrimLeft(ln.text[1:], " ")
+		switch {
+		case rest == "":
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				item, err := p.parseBlock(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				node.items = append(node.items, item)
+			} else {
+				node.items = append(node.items, &yamlNode{kind: yamlScalar, line: ln.num})
+			}
+		case isYAMLSeqItem(rest) || yamlKeyEnd(rest) >= 0:
+			// Nested block starting on the item line: re-parse it at its own column
+			p.lines[p.pos] = yamlLine{num: ln.num, indent: ln.indent + len(ln.text) - len(rest), text: rest}
+			item, err := p.parseBlock(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+		default:
+			item, err := parseYAMLInline(rest, ln.num)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+			p.pos++
+		}
+	}
+	return node, nil
+}
+
+func (p *yamlParser) parseMap(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlMap, fields: map[string]*yamlNode{}, line: p.lines[p.pos].num}
+	for p.pos < len(p.lines) {
+		ln := p.lines[p.pos]
+		if ln.indent < indent {
+			break
+		}
+		if ln.indent > indent {
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", ln.num)
+		}
+		if isYAMLSeqItem(ln.text) {
+			break
+		}
+
+		end := yamlKeyEnd(ln.text)
+		if end < 0 {
+			return nil, fmt.Errorf("yaml: line %d: expected \"key: value\"", ln.num)
+		}
+		key, err := parseYAMLKey(ln.text[:end], ln.num)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := node.fields[key]; dup {
+			return nil, fmt.Errorf("yaml: line %d: duplicate key %q", ln.num, key)
+		}
+		rest := strings.TrimSpace(ln.text[end+1:])
+		p.pos++
+
+		var value *yamlNode
+		switch {
+		case rest != "":
+			if value, err = parseYAMLInline(rest, ln.num); err != nil {
+				return nil, err
+			}
+		case p.pos < len(p.lines) && p.lines[p.pos].indent > indent:
+			if value, err = p.parseBlock(p.lines[p.pos].indent); err != nil {
+				return nil, err
+			}
+		case p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLSeqItem(p.lines[p.pos].text):
+			// Sequence at the same indentation as its key
+			if value, err = p.parseSeq(indent); err != nil {
+				return nil, err
+			}
+		default:
+			value = &yamlNode{kind: yamlScalar, line: ln.num}
+		}
+		node.keys = append(node.keys, key)
+		node.fields[key] = value
+	}
+	return node, nil
+}
+
+// yamlKeyEnd returns the index of the ':' separating key and value, or -1
+func yamlKeyEnd(text string) int {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case i == 0 && (c == '"' || c == '\''):
+			quote = c
+		case i == 0 && (c == '[' || c == '{'):
+			return -1
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+func parseYAMLKey(s string, line int) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", fmt.Errorf("yaml: line %d: empty key", line)
+	}
+	n, err := parseYAMLScalar(s, line)
+	if err != nil {
+		return "", err
+	}
+	return n.value, nil
+}
+
+// parseYAMLInline parses a value written on the same line as its key or dash
+func parseYAMLInline(s string, line int) (*yamlNode, error) {
+	switch {
+	case s == "{}":
+		return &yamlNode{kind: yamlMap, fields: map[string]*yamlNode{}, line: line}, nil
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("yaml: line %d: unterminated flow sequence", line)
+		}
+		node := &yamlNode{kind: yamlSeq, line: line}
+		inner := strings.TrimSpace(s[1 : len(s)-1])
+		if inner == "" {
+			return node, nil
+		}
+		for _, part := range splitYAMLFlow(inner) {
+			item, err := parseYAMLScalar(strings.TrimSpace(part), line)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+		}
+		return node, nil
+	case strings.HasPrefix(s, "{"):
+		return nil, fmt.Errorf("yaml: line %d: flow mappings are not supported, use block style", line)
+	case s == "|" || s == ">" || strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">"):
+		return nil, fmt.Errorf("yaml: line %d: block scalars are not supported", line)
+	case strings.HasPrefix(s, "&") || strings.HasPrefix(s, "*") || strings.HasPrefix(s, "!"):
+		return nil, fmt.Errorf("yaml: line %d: anchors, aliases and tags are not supported", line)
+	}
+	return parseYAMLScalar(s, line)
+}
+
+// splitYAMLFlow splits flow sequence content on commas outside quotes
+func splitYAMLFlow(s string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func parseYAMLScalar(s string, line int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlScalar, value: s, line: line}
+	if s == "" {
+		return node, nil
+	}
+	switch s[0] {
+	case '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: invalid double-quoted string %s", line, s)
+		}
+		node.value, node.quoted = v, true
+	case '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return nil, fmt.Errorf("yaml: line %d: invalid single-quoted string %s", line, s)
+		}
+		node.value, node.quoted = strings.ReplaceAll(s[1:len(s)-1], "''", "'"), true
+	}
+	return node, nil
+}
+
+// yamlToJSON converts a node to a JSON-marshalable value, using t (may be nil) as a type hint
+func yamlToJSON(n *yamlNode, t reflect.Type) (any, error) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if n.isNull() {
+		return nil, nil
+	}
+
+	switch n.kind {
+	case yamlMap:
+		out := make(map[string]any, len(n.keys))
+		for _, k := range n.keys {
+			var ft reflect.Type
+			if t != nil {
+				switch t.Kind() {
+				case reflect.Struct:
+					ft = jsonFieldType(t, k)
+				case reflect.Map:
+					ft = t.Elem()
+				}
+			}
+			v, err := yamlToJSON(n.fields[k], ft)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = v
+		}
+		return out, nil
+
+	case yamlSeq:
+		var et reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			et = t.Elem()
+		}
+		out := make([]any, 0, len(n.items))
+		for _, item := range n.items {
+			v, err := yamlToJSON(item, et)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	}
+
+	// Scalar
+	if t != nil && t.Kind() == reflect.String {
+		return n.value, nil
+	}
+	if n.quoted {
+		return n.value, nil
+	}
+	switch n.value {
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if isJSONNumber(n.value) {
+		return json.Number(n.value), nil
+	}
+	return n.value, nil
+}
+
+// isJSONNumber reports whether s is a valid JSON number literal
+func isJSONNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	return json.Valid([]byte(s)) && (s[0] == '-' || (s[0] >= '0' && s[0] <= '9'))
+}
+
+// jsonFieldType finds the type of the struct field with the given JSON name
+func jsonFieldType(t reflect.Type, name string) reflect.Type {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if n, _ := jsonFieldName(f); n == name {
+			return f.Type
+		}
+	}
+	return nil
+}
+
+// jsonFieldName returns the JSON key and omitempty flag for a struct field ("" if skipped)
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name, strings.Contains(","+opts+",", ",omitempty,")
+}
+
+// yamlConfigToJSON converts a YAML config document to JSON using SIMConfig as the schema
+func yamlConfigToJSON(data []byte) ([]byte, error) {
+	return yamlDocumentToJSON(data, reflect.TypeOf(SIMConfig{}))
+}
+
+// yamlDocumentToJSON converts a YAML document to JSON using t as the schema
+func yamlDocumentToJSON(data []byte, t reflect.Type) ([]byte, error) {
+	node, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	if node.kind != yamlMap {
+		return nil, fmt.Errorf("yaml: config must be a mapping at top level")
+	}
+	v, err := yamlToJSON(node, t)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalStrict decodes a JSON document, or a YAML one when isYAML is set, into v (a
+// pointer to a struct) with the rules of LoadConfig: unknown fields are rejected and
+// keys starting with "_" are comments.
+func UnmarshalStrict(data []byte, isYAML bool, v any) error {
+	if isYAML {
+		var err error
+		if data, err = yamlDocumentToJSON(data, reflect.TypeOf(v)); err != nil {
+			return err
+		}
+	}
+	return decodeConfigStrict(data, v)
+}
+
+// ============ YAML ENCODER ============
+
+// MarshalConfigYAML encodes the config as YAML. Keys, order and omitempty follow the
+// JSON tags; fields with a `doc` tag get a comment line describing the section.
+func MarshalConfigYAML(config *SIMConfig) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("# sim_reader configuration\n")
+	if err := writeYAMLStruct(&buf, reflect.ValueOf(config).Elem(), 0, true); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalYAML encodes v (a pointer to a struct) as YAML after a "# header" comment line,
+// with keys, order and omitempty following the JSON tags
+func MarshalYAML(v any, header string) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("yaml: %T is not a pointer to a struct", v)
+	}
+	var buf bytes.Buffer
+	if header != "" {
+		buf.WriteString("# " + header + "\n")
+	}
+	if err := writeYAMLStruct(&buf, rv.Elem(), 0, true); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeYAMLStruct(buf *bytes.Buffer, v reflect.Value, indent int, comments bool) error {
+	pad := strings.Repeat(" ", indent)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, omitempty := jsonFieldName(f)
+		if name == "" {
+			continue
+		}
+		fv := v.Field(i)
+		if omitempty && isEmptyYAMLValue(fv) {
+			continue
+		}
+		if doc := f.Tag.Get("doc"); doc != "" && comments {
+			buf.WriteString(pad + "# " + doc + "\n")
+		}
+		if err := writeYAMLEntry(buf, yamlQuote(name), fv, indent, comments); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeYAMLEntry writes "key: value" or "key:" followed by a nested block
+func writeYAMLEntry(buf *bytes.Buffer, key string, v reflect.Value, indent int, comments bool) error {
+	pad := strings.Repeat(" ", indent)
+	if s, ok := yamlInlineValue(v); ok {
+		buf.WriteString(pad + key + ": " + s + "\n")
+		return nil
+	}
+	buf.WriteString(pad + key + ":\n")
+	return writeYAMLBlock(buf, v, indent+2, comments)
+}
+
+// yamlInlineValue returns the single-line form of scalars, nil and empty collections
+func yamlInlineValue(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "null", true
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return yamlQuote(v.String()), true
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), true
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return "null", true
+		}
+		if v.Len() == 0 {
+			if v.Kind() == reflect.Map {
+				return "{}", true
+			}
+			return "[]", true
+		}
+	case reflect.Struct:
+		var probe bytes.Buffer
+		if writeYAMLStruct(&probe, v, 0, false) == nil && probe.Len() == 0 {
+			return "{}", true
+		}
+	}
+	return "", false
+}
+
+// writeYAMLBlock writes a non-empty struct, map or slice as an indented block
+func writeYAMLBlock(buf *bytes.Buffer, v reflect.Value, indent int, comments bool) error {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	pad := strings.Repeat(" ", indent)
+	switch v.Kind() {
+	case reflect.Struct:
+		return writeYAMLStruct(buf, v, indent, comments)
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := writeYAMLEntry(buf, yamlQuote(k), v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key())), indent, comments); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			item := v.Index(i)
+			if s, ok := yamlInlineValue(item); ok {
+				buf.WriteString(pad + "- " + s + "\n")
+				continue
+			}
+			// Render the item two columns deeper, then turn its first line into "- ..."
+			var sub bytes.Buffer
+			if err := writeYAMLBlock(&sub, item, indent+2, false); err != nil {
+				return err
+			}
+			lines := sub.String()
+			buf.WriteString(pad + "- " + lines[indent+2:])
+		}
+		return nil
+	}
+	return fmt.Errorf("yaml: unsupported type %s", v.Type())
+}
+
+func isEmptyYAMLValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// yamlQuote returns s as a plain scalar when unambiguous, otherwise double-quoted
+func yamlQuote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	switch strings.ToLower(s) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off", "y", "n":
+		return strconv.Quote(s)
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@` +.0123456789") ||
+		strings.HasSuffix(s, " ") || strings.HasSuffix(s, ":") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return strconv.Quote(s)
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7F {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
@@ -0,0 +1,274 @@
+package sim
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ============ YAML ROUND-TRIP TESTS ============
+
+// roundTripYAML encodes config as YAML and decodes it back through the strict loader path
+func roundTripYAML(t *testing.T, config *SIMConfig) *SIMConfig {
+	t.Helper()
+	yamlData, err := MarshalConfigYAML(config)
+	if err != nil {
+		t.Fatalf("MarshalConfigYAML() error = %v", err)
+	}
+	jsonData, err := yamlConfigToJSON(yamlData)
+	if err != nil {
+		t.Fatalf("yamlConfigToJSON() error = %v\n%s", err, yamlData)
+	}
+	var out SIMConfig
+	if err := decodeConfigStrict(jsonData, &out); err != nil {
+		t.Fatalf("decodeConfigStrict() error = %v\n%s", err, yamlData)
+	}
+	return &out
+}
+
+func assertSameJSON(t *testing.T, want, got *SIMConfig) {
+	t.Helper()
+	a, _ := json.MarshalIndent(want, "", "  ")
+	b, _ := json.MarshalIndent(got, "", "  ")
+	if string(a) != string(b) {
+		t.Errorf("round trip mismatch\nwant:\n%s\ngot:\n%s", a, b)
+	}
+}
+
+func TestYAML_RoundTripExamples(t *testing.T) {
+	files, err := filepath.Glob("../docs/*.json")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no example configs found: %v", err)
+	}
+	for _, f := range files {
+		t.Run(filepath.Base(f), func(t *testing.T) {
+			config, err := LoadConfig(f)
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			assertSameJSON(t, config, roundTripYAML(t, config))
+		})
+	}
+}
+
+func TestYAML_RoundTripTrickyValues(t *testing.T) {
+	boolFalse := false
+	kvn := 0
+	config := &SIMConfig{
+		IMSI:          "001010000000001",
+		SPN:           "Op: #1 'test' \"q\"",
+		MCC:           "001",
+		MNC:           "01",
+		OperationMode: "cell-test",
+		Languages:     []string{"en", "no", "true"},
+		ACC:           []int{0, 9},
+		HPLMNPeriod:   6,
+		HPLMN: []HPLMNConfig{
+			{MCC: "001", MNC: "01", ACT: []string{"eutran", "ngran"}},
+			{MCC: "", MNC: "", ACT: nil},
+			{MCC: "999", MNC: "99", ACT: []string{}},
+		},
+		ISIM: &ISIMConfig{
+			IMPI: "001010000000001@ims.mnc001.mcc001.3gppnetwork.org",
+			IMPU: []string{"sip:+12345@ims", "tel:+12345"},
+		},
+		Services: &ServicesConfig{VoLTE: &boolFalse},
+		GlobalPlatform: &GlobalPlatformConfig{
+			KVN: &kvn,
+			KeySets: []GPKeySetConfig{
+				{Name: "default", KVN: 1, Keys: GPKeysConfig{PSK: "404142434445464748494A4B4C4D4E4F"}},
+				{Name: "empty"},
+			},
+			Applets: &GPAppletsConfig{Loads: []GPAppletLoadConfig{{
+				CAPPath:    "applet.cap",
+				Privileges: []string{"default-selected"},
+				Personalization: &AppletPersonalizationConfig{
+					APDUs:   []string{"80E2900003010203"},
+					Generic: map[string]string{"opc": "00", "ki": "11"},
+				},
+			}}},
+		},
+		ClearFPLMN: true,
+	}
+	assertSameJSON(t, config, roundTripYAML(t, config))
+}
+
+func TestYAML_Comments(t *testing.T) {
+	data, err := MarshalConfigYAML(&SIMConfig{IMSI: "001010000000001", GlobalPlatform: &GlobalPlatformConfig{SCP: "scp03"}})
+	if err != nil {
+		t.Fatalf("MarshalConfigYAML() error = %v", err)
+	}
+	out := string(data)
+	for _, want := range []string{
+		"# USIM: subscriber identity (EF_IMSI)\nimsi: \"001010000000001\"\n",
+		"  # Secure channel protocol: auto, scp02, scp03\n  scp: scp03\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("YAML output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+// ============ YAML PARSING TESTS ============
+
+func TestYAML_LoadConfig(t *testing.T) {
+	src := `# Test operator
+imsi: 001010000000001   # unquoted, stays a string
+mnc: 01
+spn: 'It''s ours'
+operation_mode: cell-test
+hplmn_period: 6
+languages: [en, "de"]
+hplmn:
+- mcc: "001"
+  mnc: "01"
+  act: [eutran, utran]
+user_plmn:
+  - mcc: 999
+    mnc: 99
+    act:
+      - gsm
+isim:
+  impu:
+    - sip:001010000000001@ims
+services:
+  volte: true
+  vowifi: false
+clear_fplmn: true
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if config.IMSI != "001010000000001" || config.MNC != "01" || config.SPN != "It's ours" {
+		t.Errorf("IMSI/MNC/SPN = %q/%q/%q", config.IMSI, config.MNC, config.SPN)
+	}
+	if config.HPLMNPeriod != 6 || !config.ClearFPLMN {
+		t.Errorf("HPLMNPeriod/ClearFPLMN = %d/%v", config.HPLMNPeriod, config.ClearFPLMN)
+	}
+	if strings.Join(config.Languages, ",") != "en,de" {
+		t.Errorf("Languages = %v", config.Languages)
+	}
+	if len(config.HPLMN) != 1 || config.HPLMN[0].MNC != "01" || len(config.HPLMN[0].ACT) != 2 {
+		t.Errorf("HPLMN = %+v", config.HPLMN)
+	}
+	if len(config.UserPLMN) != 1 || config.UserPLMN[0].MCC != "999" || config.UserPLMN[0].ACT[0] != "gsm" {
+		t.Errorf("UserPLMN = %+v", config.UserPLMN)
+	}
+	if config.ISIM == nil || len(config.ISIM.IMPU) != 1 || config.ISIM.IMPU[0] != "sip:001010000000001@ims" {
+		t.Errorf("ISIM = %+v", config.ISIM)
+	}
+	if config.Services == nil || config.Services.VoLTE == nil || !*config.Services.VoLTE ||
+		config.Services.VoWiFi == nil || *config.Services.VoWiFi {
+		t.Errorf("Services = %+v", config.Services)
+	}
+}
+
+func TestYAML_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"Unknown field", "imsi: \"001010000000001\"\nimsii: x\n"},
+		{"Unknown nested field", "isim:\n  impi: a@b\n  domian: b\n"},
+		{"Type mismatch", "hplmn_period: often\n"},
+		{"Bool mismatch", "clear_fplmn: maybe\n"},
+		{"Duplicate key", "imsi: 1\nimsi: 2\n"},
+		{"Bad indentation", "isim:\n  impi: a\n    domain: b\n"},
+		{"Tab indentation", "isim:\n\timpi: a\n"},
+		{"Missing colon", "imsi\n"},
+		{"Block scalar", "spn: |\n  text\n"},
+		{"Anchor", "spn: &a x\n"},
+		{"Top-level list", "- imsi: 1\n"},
+		{"Multiple documents", "imsi: 1\n---\nimsi: 2\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bad.yml")
+			if err := os.WriteFile(path, []byte(tc.src), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadConfig(path); err == nil {
+				t.Errorf("LoadConfig() should fail for:\n%s", tc.src)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_StrictJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr bool
+	}{
+		{"Valid", `{"imsi": "001010000000001"}`, false},
+		{"Comment keys allowed", `{"_comment": "why", "isim": {"_comment": "ims", "impi": "a@b"}}`, false},
+		{"Unknown field", `{"imsi": "001010000000001", "imsii": "x"}`, true},
+		{"Trailing data", `{"imsi": "1"} {"imsi": "2"}`, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tc.src), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadConfig(path)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("LoadConfig() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSaveConfig_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sample.yaml")
+	if err := CreateSampleConfig(path); err != nil {
+		t.Fatalf("CreateSampleConfig() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		t.Errorf("expected YAML output, got JSON")
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config.MNC != "88" || config.ISIM == nil || config.ISIM.Domain == "" {
+		t.Errorf("loaded sample = %+v", config)
+	}
+}
+
+func TestYAMLQuote(t *testing.T) {
+	tests := map[string]string{
+		"eutran":      "eutran",
+		"":            `""`,
+		"01":          `"01"`,
+		"true":        `"true"`,
+		"No":          `"No"`,
+		"a: b":        `"a: b"`,
+		"x #y":        `"x #y"`,
+		"-x":          `"-x"`,
+		"sip:a@b":     "sip:a@b",
+		"My Operator": "My Operator",
+		"line\nbreak": `"line\nbreak"`,
+	}
+	for in, want := range tests {
+		t.Run(in, func(t *testing.T) {
+			if got := yamlQuote(in); got != want {
+				t.Errorf("yamlQuote(%q) = %s, want %s", in, got, want)
+			}
+		})
+	}
+}
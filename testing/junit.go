@@ -0,0 +1,175 @@
+package testing
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"sim_reader/card"
+)
+
+// JUnit XML schema subset understood by GitLab, Jenkins and most CI systems
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr,omitempty"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Cases      []junitTestCase  `xml:"testcase"`
+}
+
+// junitProperties carries the APDU count and time of a category (collected with metrics)
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",cdata"`
+}
+
+// WriteJUnit writes the results as JUnit XML, one testsuite per category in run order
+func (s *TestSuite) WriteJUnit(w io.Writer) error {
+	root := junitTestSuites{Name: "sim_reader", Time: junitSeconds(s.EndTime.Sub(s.StartTime))}
+	index := make(map[string]int)
+	var durations []time.Duration
+
+	for _, r := range s.Results {
+		i, ok := index[r.Category]
+		if !ok {
+			i = len(root.Suites)
+			index[r.Category] = i
+			suite := junitTestSuite{Name: r.Category}
+			if !s.StartTime.IsZero() {
+				suite.Timestamp = s.StartTime.UTC().Format("2006-01-02T15:04:05")
+			}
+			root.Suites = append(root.Suites, suite)
+			durations = append(durations, 0)
+		}
+		suite := &root.Suites[i]
+		durations[i] += r.Duration
+
+		tc := junitTestCase{
+			Name:      r.Name,
+			ClassName: "sim_reader." + r.Category,
+			Time:      junitSeconds(r.Duration),
+		}
+		switch {
+		case r.Skipped:
+			tc.Skipped = &junitMessage{Message: junitSkipReason(r)}
+			suite.Skipped++
+		case !r.Passed:
+			tc.Failure = &junitMessage{Message: junitFailureMessage(r), Type: "AssertionError", Body: junitFailureDetail(r)}
+			suite.Failures++
+		default:
+			tc.SystemOut = r.Actual
+		}
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+	}
+
+	metrics := s.Metrics()
+	for i := range root.Suites {
+		root.Suites[i].Time = junitSeconds(durations[i])
+		if metrics != nil {
+			root.Suites[i].Properties = junitMetrics(*metrics, root.Suites[i].Name)
+		}
+		root.Tests += root.Suites[i].Tests
+		root.Failures += root.Suites[i].Failures
+		root.Skipped += root.Suites[i].Skipped
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitMetrics returns the properties of the category's operation ("test usim"), nil if
+// the category did not run as a whole
+func junitMetrics(r card.MetricsReport, category string) *junitProperties {
+	op, ok := r.Operation("test " + category)
+	if !ok {
+		return nil
+	}
+	return &junitProperties{Properties: []junitProperty{
+		{Name: "apdus", Value: fmt.Sprintf("%d", op.APDUs)},
+		{Name: "duration_ms", Value: fmt.Sprintf("%.1f", op.DurationMs)},
+	}}
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func junitSkipReason(r TestResult) string {
+	if r.Error != "" {
+		return r.Error
+	}
+	return r.Actual
+}
+
+func junitFailureMessage(r TestResult) string {
+	if r.Error != "" {
+		return r.Error
+	}
+	if r.Expected != "" {
+		return fmt.Sprintf("expected %s, got %s", r.Expected, r.Actual)
+	}
+	return "test failed"
+}
+
+// junitFailureDetail lists expected/actual, status word and the APDU exchange of a failed test
+func junitFailureDetail(r TestResult) string {
+	var b strings.Builder
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+	field("Expected", r.Expected)
+	field("Actual", r.Actual)
+	if r.SW != 0 {
+		field("SW", fmt.Sprintf("%04X", r.SW))
+	}
+	field("APDU", r.APDU)
+	field("Response", r.Response)
+	field("Spec", r.Spec)
+	return b.String()
+}
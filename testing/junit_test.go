@@ -0,0 +1,111 @@
+package testing
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sim_reader/card"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// ============ JUNIT REPORT TESTS ============
+
+func newJUnitFixtureSuite() *TestSuite {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return &TestSuite{
+		StartTime: start,
+		EndTime:   start.Add(1500 * time.Millisecond),
+		Results: []TestResult{
+			{Name: "USIM Application Select", Category: "usim", Passed: true, Actual: "SW=9000", Duration: 12 * time.Millisecond},
+			{Name: "EF.IMSI (6F07)", Category: "usim", Passed: false, Expected: "SW=9000", Actual: "SW=6982",
+				APDU: "00A4000C026F07", SW: 0x6982, Error: "Security status not satisfied", Spec: "TS 31.102 4.2.2", Duration: 8 * time.Millisecond},
+			{Name: "Authentication Tests", Category: "auth", Skipped: true, Actual: "Skipped (no K)",
+				Error: "No authentication key (K) provided. Use -auth-k flag.", Spec: "TS 35.206"},
+			{Name: "Wrong CLA <special & chars>", Category: "security", Passed: true, Actual: "SW=6E00", Duration: 3 * time.Millisecond},
+		},
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	tests := []struct {
+		name   string
+		suite  *TestSuite
+		golden string
+	}{
+		{"Mixed results", newJUnitFixtureSuite(), "junit_mixed.xml"},
+		{"No results", &TestSuite{}, "junit_empty.xml"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tc.suite.WriteJUnit(&buf); err != nil {
+				t.Fatalf("WriteJUnit() error = %v", err)
+			}
+			path := filepath.Join("testdata", tc.golden)
+			if *updateGolden {
+				if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("golden file: %v (run with -update to create)", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("WriteJUnit() mismatch\n--- got ---\n%s\n--- want ---\n%s", buf.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	s := &TestSuite{Options: TestOptions{FailFast: true}}
+	var ran []string
+	step := func(name string, passed, skipped bool) func() {
+		return func() {
+			ran = append(ran, name)
+			s.AddResult(TestResult{Name: name, Passed: passed, Skipped: skipped})
+		}
+	}
+
+	s.runTests(step("a", true, false), step("b", false, true), step("c", false, false), step("d", true, false))
+	if len(ran) != 3 || !s.Stopped() {
+		t.Errorf("ran %v, stopped %v; want a, b, c then stop", ran, s.Stopped())
+	}
+	if sum := s.GetSummary(); sum.Passed != 1 || sum.Failed != 1 || sum.Skipped != 1 || sum.PassRate != 50 {
+		t.Errorf("GetSummary() = %+v", sum)
+	}
+}
+
+func TestWriteJUnit_Metrics(t *testing.T) {
+	m := card.NewMockCard([]byte{0x3B, 0x00})
+	m.Override = func([]byte) []byte { return []byte{0x90, 0x00} }
+	s := newJUnitFixtureSuite()
+	s.Reader = card.NewReaderWithTransport("Mock", m.ATR, m, card.WithMetrics(card.NewMetrics()))
+	stop := s.Reader.Measure("test usim")
+	s.Reader.Select([]byte{0x3F, 0x00})
+	s.Reader.Select([]byte{0x2F, 0xE2})
+	stop()
+
+	var buf bytes.Buffer
+	if err := s.WriteJUnit(&buf); err != nil {
+		t.Fatalf("WriteJUnit() error = %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `<property name="apdus" value="2"></property>`) {
+		t.Errorf("usim suite has no APDU count:\n%s", out)
+	}
+	if n := strings.Count(out, "<properties>"); n != 1 {
+		t.Errorf("%d suites with properties, want only usim", n)
+	}
+	if rep := s.Metrics(); rep == nil || rep.APDUs != 2 {
+		t.Errorf("Metrics() = %+v", rep)
+	}
+}
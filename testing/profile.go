@@ -0,0 +1,332 @@
+package testing
+
+import (
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// Profile describes what one card product is expected to contain. Loaded with
+// --test-profile, it adds a "profile" category of checks and replaces the generic
+// expectations that would fail on a card that legitimately differs (no ISIM, an
+// optional file the product does not have, another authentication algorithm).
+type Profile struct {
+	Name         string                                `json:"name"`
+	Description  string                                `json:"description,omitempty"`
+	ATR          string                                `json:"atr,omitempty"`          // hex
+	ATRMask      string                                `json:"atr_mask,omitempty"`     // hex, 00 bytes are not compared
+	Applications map[string]bool                       `json:"applications,omitempty"` // usim, isim
+	Files        map[string]map[string]FileExpectation `json:"files,omitempty"`        // mf/usim/isim -> EF name (EF_UST)
+	Services     map[string]ServiceExpectation         `json:"services,omitempty"`     // usim (UST), isim (IST)
+	Auth         *AuthExpectation                      `json:"auth,omitempty"`
+}
+
+// FileExpectation is the expected layout of one EF; zero values are not checked
+type FileExpectation struct {
+	Present    *bool `json:"present,omitempty"`
+	Size       int   `json:"size,omitempty"`
+	Records    int   `json:"records,omitempty"`
+	RecordSize int   `json:"record_size,omitempty"`
+}
+
+// ServiceExpectation lists service numbers of the service table that must be enabled or disabled
+type ServiceExpectation struct {
+	Enabled  []int `json:"enabled,omitempty"`
+	Disabled []int `json:"disabled,omitempty"`
+}
+
+// AuthExpectation is the authentication setup of the product
+type AuthExpectation struct {
+	Algorithm string `json:"algorithm,omitempty"` // milenage or tuak
+}
+
+// profileApps maps the profile application keys to their EF definitions
+var profileApps = map[string]map[uint16]sim.EFDefinition{
+	"mf":   sim.MF_Files,
+	"usim": sim.USIM_Files,
+	"isim": sim.ISIM_Files,
+}
+
+//go:embed profiles/*.yaml
+var builtinProfiles embed.FS
+
+// BuiltinProfiles returns the names of the profiles shipped with sim_reader
+func BuiltinProfiles() []string {
+	entries, _ := builtinProfiles.ReadDir("profiles")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".yaml"))
+	}
+	return names
+}
+
+// LoadProfile reads a profile from a JSON or YAML file, or a built-in profile by name
+// ("sysmo-sja2" or "sysmo-sja2.yaml") when no such file exists
+func LoadProfile(name string) (*Profile, error) {
+	data, err := os.ReadFile(name)
+	isYAML := sim.IsYAMLFile(name)
+	if os.IsNotExist(err) && !strings.ContainsRune(name, os.PathSeparator) {
+		builtin := strings.TrimSuffix(strings.TrimSuffix(name, ".yaml"), ".yml")
+		if data, err = builtinProfiles.ReadFile("profiles/" + builtin + ".yaml"); err != nil {
+			return nil, fmt.Errorf("profile %q: no such file or built-in profile (built-in: %s)",
+				name, strings.Join(BuiltinProfiles(), ", "))
+		}
+		isYAML = true
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile: %w", err)
+	}
+
+	var p Profile
+	if err := sim.UnmarshalStrict(data, isYAML, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse profile %s: %w", name, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("profile %s: %w", name, err)
+	}
+	return &p, nil
+}
+
+// Validate checks that the profile only names known applications and files
+func (p *Profile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if _, _, err := p.atrPattern(); err != nil {
+		return err
+	}
+	for app := range p.Applications {
+		if app != "usim" && app != "isim" {
+			return fmt.Errorf("applications: unknown application %q (usim, isim)", app)
+		}
+	}
+	for app, files := range p.Files {
+		if _, ok := profileApps[app]; !ok {
+			return fmt.Errorf("files: unknown application %q (mf, usim, isim)", app)
+		}
+		for ef := range files {
+			if _, ok := profileFileID(app, ef); !ok {
+				return fmt.Errorf("files.%s: unknown file %q", app, ef)
+			}
+		}
+	}
+	for app := range p.Services {
+		if app != "usim" && app != "isim" {
+			return fmt.Errorf("services: unknown service table %q (usim, isim)", app)
+		}
+	}
+	if p.Auth != nil {
+		switch p.Auth.Algorithm {
+		case "", "milenage", "tuak":
+		default:
+			return fmt.Errorf("auth.algorithm: %q is not milenage or tuak", p.Auth.Algorithm)
+		}
+	}
+	return nil
+}
+
+// atrPattern decodes the ATR and its mask (all FF when no mask is given)
+func (p *Profile) atrPattern() (atr, mask []byte, err error) {
+	if p.ATR == "" {
+		return nil, nil, nil
+	}
+	if atr, err = hex.DecodeString(strings.ReplaceAll(p.ATR, " ", "")); err != nil {
+		return nil, nil, fmt.Errorf("atr: %w", err)
+	}
+	if p.ATRMask == "" {
+		mask = make([]byte, len(atr))
+		for i := range mask {
+			mask[i] = 0xFF
+		}
+		return atr, mask, nil
+	}
+	if mask, err = hex.DecodeString(strings.ReplaceAll(p.ATRMask, " ", "")); err != nil {
+		return nil, nil, fmt.Errorf("atr_mask: %w", err)
+	}
+	if len(mask) != len(atr) {
+		return nil, nil, fmt.Errorf("atr_mask has %d bytes, atr has %d", len(mask), len(atr))
+	}
+	return atr, mask, nil
+}
+
+// MatchATR reports whether atr matches the profile ATR under its mask
+func (p *Profile) MatchATR(atr []byte) bool {
+	want, mask, err := p.atrPattern()
+	if err != nil || want == nil {
+		return err == nil
+	}
+	if len(atr) != len(want) {
+		return false
+	}
+	for i := range want {
+		if atr[i]&mask[i] != want[i]&mask[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// file returns the expectation of the EF of app named in a test result ("EF.UST (6F38)")
+func (p *Profile) file(app, testName string) (FileExpectation, string, bool) {
+	name, _, _ := strings.Cut(testName, " ")
+	if !strings.HasPrefix(name, "EF.") {
+		return FileExpectation{}, "", false
+	}
+	ef := "EF_" + strings.TrimPrefix(name, "EF.")
+	e, ok := p.Files[app][ef]
+	return e, ef, ok
+}
+
+// expectsAbsent reports whether the profile says the file of app must not exist
+func (e FileExpectation) expectsAbsent() bool {
+	return e.Present != nil && !*e.Present
+}
+
+// profileFileID returns the FID of the EF named ef in app
+func profileFileID(app, ef string) (uint16, bool) {
+	for fid, def := range profileApps[app] {
+		if def.Name == ef {
+			return fid, true
+		}
+	}
+	return 0, false
+}
+
+// violation names the profile expectation a failed result did not meet
+func (p *Profile) violation(path string, want any) string {
+	return fmt.Sprintf("profile %q expects %s = %v", p.Name, path, want)
+}
+
+// SaveProfile writes p as YAML when path ends in .yaml/.yml, JSON otherwise
+func SaveProfile(path string, p *Profile) error {
+	var data []byte
+	var err error
+	if sim.IsYAMLFile(path) {
+		data, err = sim.MarshalYAML(p, "sim_reader card expectation profile")
+	} else {
+		data, err = json.MarshalIndent(p, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// GenerateProfile builds a profile from a known-good card: its ATR, applications, the
+// layout of every known EF and its service tables. The card is only read.
+func GenerateProfile(reader *card.Reader, name string) (*Profile, error) {
+	wasReadOnly := reader.ReadOnly()
+	reader.SetReadOnly(true)
+	defer reader.SetReadOnly(wasReadOnly)
+
+	p := &Profile{
+		Name:         name,
+		Description:  fmt.Sprintf("Generated from card with ATR %s", reader.ATRHex()),
+		ATR:          reader.ATRHex(),
+		Applications: map[string]bool{},
+		Files:        map[string]map[string]FileExpectation{},
+		Services:     map[string]ServiceExpectation{},
+	}
+
+	for _, app := range []string{"mf", "usim", "isim"} {
+		selected := selectProfileApp(reader, app)
+		if app != "mf" {
+			p.Applications[app] = selected
+		}
+		if !selected {
+			continue
+		}
+		files := map[string]FileExpectation{}
+		for _, fid := range sortedProfileFIDs(app) {
+			e := probeProfileFile(reader, fid)
+			files[profileApps[app][fid].Name] = e
+		}
+		p.Files[app] = files
+
+		if svc, count, ok := readServiceTable(reader, app); ok {
+			var exp ServiceExpectation
+			for n := 1; n <= count; n++ {
+				if svc[n] {
+					exp.Enabled = append(exp.Enabled, n)
+				} else {
+					exp.Disabled = append(exp.Disabled, n)
+				}
+			}
+			p.Services[app] = exp
+		}
+	}
+	if len(p.Files["usim"]) == 0 && len(p.Files["mf"]) == 0 {
+		return nil, fmt.Errorf("no file could be selected on the card")
+	}
+	return p, nil
+}
+
+// selectProfileApp selects the MF or the ADF of app
+func selectProfileApp(reader *card.Reader, app string) bool {
+	var resp *card.APDUResponse
+	var err error
+	switch app {
+	case "mf":
+		resp, err = reader.Select([]byte{0x3F, 0x00})
+	case "usim":
+		resp, err = reader.Select(sim.GetUSIMAID())
+	case "isim":
+		resp, err = reader.Select(sim.GetISIMAID())
+	}
+	return err == nil && (resp.IsOK() || resp.HasMoreData())
+}
+
+// sortedProfileFIDs returns the known EFs of app in FID order
+func sortedProfileFIDs(app string) []uint16 {
+	fids := make([]uint16, 0, len(profileApps[app]))
+	for fid := range profileApps[app] {
+		fids = append(fids, fid)
+	}
+	sort.Slice(fids, func(i, j int) bool { return fids[i] < fids[j] })
+	return fids
+}
+
+// probeProfileFile selects fid in the current application and returns what was found
+func probeProfileFile(reader *card.Reader, fid uint16) FileExpectation {
+	present := false
+	resp, err := reader.Select([]byte{byte(fid >> 8), byte(fid)})
+	if err != nil || (!resp.IsOK() && !resp.HasMoreData()) {
+		return FileExpectation{Present: &present}
+	}
+	present = true
+	e := FileExpectation{Present: &present}
+	info := sim.ParseFCPInfo(resp.Data)
+	switch info.Structure {
+	case "linear", "cyclic":
+		e.Records, e.RecordSize = info.Records, info.RecordSize
+	default:
+		e.Size = info.Size
+	}
+	return e
+}
+
+// readServiceTable reads the UST or IST of the selected application: the enabled
+// services and the number of services the table has room for
+func readServiceTable(reader *card.Reader, app string) (map[int]bool, int, bool) {
+	fid := map[string][]byte{"usim": {0x6F, 0x38}, "isim": {0x6F, 0x07}}[app]
+	if fid == nil {
+		return nil, 0, false
+	}
+	resp, err := reader.Select(fid)
+	if err != nil || (!resp.IsOK() && !resp.HasMoreData()) {
+		return nil, 0, false
+	}
+	resp, err = reader.ReadBinary(0, 0)
+	if err != nil || !resp.IsOK() || len(resp.Data) == 0 {
+		return nil, 0, false
+	}
+	return sim.DecodeUST(resp.Data), len(resp.Data) * 8, true
+}
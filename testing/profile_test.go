@@ -0,0 +1,244 @@
+package testing
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sim_reader/card"
+	"sim_reader/sim"
+)
+
+// ============ CARD PROFILE TESTS ============
+
+var profileTestATR = []byte{0x3B, 0x9F, 0x96, 0x80, 0x1F, 0xC7}
+
+// newProfileTestCard returns a USIM-only card: IMSI, ACC, a 3 byte UST and two MSISDN records
+func newProfileTestCard(t *testing.T) (*card.MockCard, *card.Reader) {
+	t.Helper()
+	m := card.NewMockCard(profileTestATR)
+	m.MF().AddEF(0x2FE2, []byte{0x98, 0x10, 0x32, 0x54, 0x76, 0x98, 0x10, 0x32, 0x54, 0xF6})
+	usim := m.AddADF(sim.AID_USIM)
+	usim.AddEF(0x6F07, []byte{0x08, 0x09, 0x10, 0x10, 0x00, 0x00, 0x00, 0x00, 0x10})
+	usim.AddEF(0x6F78, []byte{0x00, 0x01})
+	usim.AddEF(0x6F38, []byte{0x03, 0x00, 0x80})
+	usim.AddRecordEF(0x6F40, bytes.Repeat([]byte{0xFF}, 30), bytes.Repeat([]byte{0xFF}, 30))
+	return m, card.NewReaderWithTransport("Mock", m.ATR, m)
+}
+
+func boolRef(b bool) *bool { return &b }
+
+func TestBuiltinProfiles(t *testing.T) {
+	names := BuiltinProfiles()
+	if len(names) < 3 {
+		t.Fatalf("BuiltinProfiles() = %v", names)
+	}
+	for _, name := range names {
+		p, err := LoadProfile(name)
+		if err != nil {
+			t.Errorf("LoadProfile(%q) error = %v", name, err)
+			continue
+		}
+		if p.Name != name {
+			t.Errorf("profile %s is named %q", name, p.Name)
+		}
+	}
+	if _, err := LoadProfile("sysmo-sja2.yaml"); err != nil {
+		t.Errorf("LoadProfile() with extension error = %v", err)
+	}
+	if _, err := LoadProfile("no-such-product"); err == nil || !strings.Contains(err.Error(), "sysmo-sja2") {
+		t.Errorf("LoadProfile() of an unknown name error = %v, want the built-in list", err)
+	}
+}
+
+func TestLoadProfile_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown field", "name: x\nfiles_typo: {}\n", "files_typo"},
+		{"unknown file", "name: x\nfiles:\n  usim:\n    EF_NOPE:\n      size: 1\n", "EF_NOPE"},
+		{"unknown application", "name: x\napplications:\n  csim: true\n", "csim"},
+		{"mask length", "name: x\natr: 3B00\natr_mask: FF\n", "atr_mask"},
+		{"algorithm", "name: x\nauth:\n  algorithm: comp128\n", "comp128"},
+		{"no name", "applications:\n  usim: true\n", "name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "p.yaml")
+			os.WriteFile(path, []byte(tt.content), 0644)
+			_, err := LoadProfile(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadProfile() error = %v, want mention of %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProfileMatchATR(t *testing.T) {
+	p := &Profile{Name: "x", ATR: "3B9F9680", ATRMask: "FFFF00FF"}
+	if !p.MatchATR([]byte{0x3B, 0x9F, 0x11, 0x80}) {
+		t.Error("MatchATR() should ignore masked bytes")
+	}
+	if p.MatchATR([]byte{0x3B, 0x9E, 0x96, 0x80}) || p.MatchATR([]byte{0x3B, 0x9F, 0x96}) {
+		t.Error("MatchATR() accepted a different ATR")
+	}
+	if !(&Profile{Name: "x"}).MatchATR([]byte{0x3B}) {
+		t.Error("MatchATR() without an ATR should match anything")
+	}
+}
+
+func TestGenerateProfile(t *testing.T) {
+	m, reader := newProfileTestCard(t)
+	p, err := GenerateProfile(reader, "golden")
+	if err != nil {
+		t.Fatalf("GenerateProfile() error = %v", err)
+	}
+	if reader.ReadOnly() {
+		t.Error("GenerateProfile() left the reader read-only")
+	}
+
+	if !p.MatchATR(m.ATR) || p.Applications["usim"] != true || p.Applications["isim"] != false {
+		t.Errorf("GenerateProfile() ATR/applications = %s %v", p.ATR, p.Applications)
+	}
+	if got := p.Files["usim"]["EF_IMSI"]; got.Present == nil || !*got.Present || got.Size != 9 {
+		t.Errorf("EF_IMSI = %+v", got)
+	}
+	if got := p.Files["usim"]["EF_MSISDN"]; got.Records != 2 || got.RecordSize != 30 {
+		t.Errorf("EF_MSISDN = %+v", got)
+	}
+	if got := p.Files["usim"]["EF_SPN"]; !got.expectsAbsent() {
+		t.Errorf("EF_SPN = %+v, want absent", got)
+	}
+	wantUST := ServiceExpectation{Enabled: []int{1, 2, 24}}
+	for n := 1; n <= 24; n++ {
+		if n != 1 && n != 2 && n != 24 {
+			wantUST.Disabled = append(wantUST.Disabled, n)
+		}
+	}
+	if !reflect.DeepEqual(p.Services["usim"], wantUST) {
+		t.Errorf("UST services = %+v", p.Services["usim"])
+	}
+
+	// Saved as YAML, the profile loads back unchanged
+	path := filepath.Join(t.TempDir(), "golden.yaml")
+	if err := SaveProfile(path, p); err != nil {
+		t.Fatalf("SaveProfile() error = %v", err)
+	}
+	loaded, err := LoadProfile(path)
+	if err != nil {
+		t.Fatalf("LoadProfile() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, p) {
+		t.Errorf("LoadProfile(SaveProfile()) = %+v\nwant %+v", loaded, p)
+	}
+
+	// The golden card passes its own profile
+	suite := NewTestSuite(reader, TestOptions{Profile: loaded})
+	suite.RunCategory("profile")
+	for _, r := range suite.Results {
+		if !r.Passed {
+			t.Errorf("%s failed on the golden card: %s", r.Name, r.Error)
+		}
+	}
+}
+
+func TestProfileViolations(t *testing.T) {
+	_, reader := newProfileTestCard(t)
+	profile := &Profile{
+		Name:         "product",
+		ATR:          "3B9F9680FFC7",
+		ATRMask:      "FFFFFFFF00FF",
+		Applications: map[string]bool{"usim": true, "isim": true},
+		Files: map[string]map[string]FileExpectation{
+			"usim": {
+				"EF_IMSI":   {Present: boolRef(true), Size: 9},
+				"EF_ACC":    {Size: 3},
+				"EF_MSISDN": {Records: 1},
+				"EF_SPN":    {Present: boolRef(true)},
+			},
+		},
+		Services: map[string]ServiceExpectation{"usim": {Enabled: []int{1, 3}, Disabled: []int{2, 4}}},
+	}
+	suite := NewTestSuite(reader, TestOptions{Profile: profile})
+	suite.RunCategory("profile")
+
+	want := map[string]string{
+		"Profile ATR":                   "",
+		"Profile application USIM":      "",
+		"Profile application ISIM":      `profile "product" expects applications.isim = true`,
+		"Profile usim/EF_IMSI (6F07)":   "",
+		"Profile usim/EF_ACC (6F78)":    `profile "product" expects files.usim.EF_ACC.size = 3`,
+		"Profile usim/EF_MSISDN (6F40)": `profile "product" expects files.usim.EF_MSISDN.records = 1`,
+		"Profile usim/EF_SPN (6F46)":    `profile "product" expects files.usim.EF_SPN.present = true`,
+		"Profile UST services":          `profile "product" expects services.usim.enabled to include 3; profile "product" expects services.usim.disabled to include 2`,
+	}
+	if len(suite.Results) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(suite.Results), len(want), suite.Results)
+	}
+	for _, r := range suite.Results {
+		wantErr, ok := want[r.Name]
+		if !ok {
+			t.Errorf("unexpected result %q", r.Name)
+			continue
+		}
+		if r.Passed != (wantErr == "") || r.Error != wantErr {
+			t.Errorf("%s: passed=%v error=%q, want error %q", r.Name, r.Passed, r.Error, wantErr)
+		}
+	}
+}
+
+func TestProfileReplacesGenericExpectations(t *testing.T) {
+	_, reader := newProfileTestCard(t)
+	profile := &Profile{
+		Name:         "usim-product",
+		Applications: map[string]bool{"usim": true, "isim": false},
+		Files:        map[string]map[string]FileExpectation{"usim": {"EF_HPPLMN": {Present: boolRef(false)}}},
+		Auth:         &AuthExpectation{Algorithm: "tuak"},
+	}
+
+	// Without the profile, the missing ISIM and EF_HPPLMN fail
+	generic := NewTestSuite(reader, TestOptions{})
+	generic.RunCategory("isim")
+	generic.RunCategory("usim")
+	failed := generic.GetSummary().FailedTests
+	if !containsString(failed, "ISIM Application Select") || !containsString(failed, "EF.HPPLMN (6F31)") {
+		t.Fatalf("generic failures = %v", failed)
+	}
+
+	suite := NewTestSuite(reader, TestOptions{Profile: profile})
+	suite.RunCategory("isim")
+	suite.RunCategory("usim")
+	for _, r := range suite.Results {
+		switch r.Name {
+		case "ISIM Application Select":
+			if !r.Passed || !strings.Contains(r.Actual, "applications.isim = false") {
+				t.Errorf("ISIM select with profile = %+v", r)
+			}
+		case "EF.HPPLMN (6F31)":
+			if !r.Passed || !strings.Contains(r.Actual, "files.usim.EF_HPPLMN.present = false") {
+				t.Errorf("EF.HPPLMN with profile = %+v", r)
+			}
+		}
+	}
+
+	// Authentication failures name the profile algorithm
+	r := TestResult{Name: "3G Authentication", Category: "auth", Error: "RES mismatch"}
+	suite.applyProfile(&r)
+	if r.Error != `RES mismatch (profile "usim-product" expects auth.algorithm = tuak)` {
+		t.Errorf("auth failure = %q", r.Error)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -6,6 +6,8 @@ import (
 	"html/template"
 	"os"
 	"time"
+
+	"sim_reader/card"
 )
 
 // Report represents the full test report
@@ -15,14 +17,27 @@ type Report struct {
 	CardICCID   string        `json:"card_iccid,omitempty"`
 	Summary     TestSummary   `json:"summary"`
 	Results     []TestResult  `json:"results"`
+	Profile     *card.MetricsReport `json:"profile,omitempty"` // time and APDUs per category and operation
 }
 
-// GenerateReport generates both JSON and HTML reports
-func (s *TestSuite) GenerateReport(prefix string) error {
+// Report formats for GenerateReport
+const (
+	ReportJSON  = "json"
+	ReportHTML  = "html"
+	ReportJUnit = "junit"
+)
+
+// GenerateReport generates the reports in the given formats (default JSON and HTML)
+func (s *TestSuite) GenerateReport(prefix string, formats ...string) error {
+	if len(formats) == 0 {
+		formats = []string{ReportJSON, ReportHTML}
+	}
+
 	report := Report{
 		Timestamp: time.Now(),
 		Summary:   s.GetSummary(),
 		Results:   s.Results,
+		Profile:   s.Metrics(),
 	}
 	
 	// Get ATR if reader available
@@ -30,23 +45,43 @@ func (s *TestSuite) GenerateReport(prefix string) error {
 		report.CardATR = s.Reader.ATRHex()
 	}
 	
-	// Generate JSON
-	jsonPath := prefix + ".json"
-	if err := s.generateJSON(jsonPath, report); err != nil {
-		return fmt.Errorf("JSON generation failed: %w", err)
-	}
-	fmt.Printf("✓ JSON report: %s\n", jsonPath)
-	
-	// Generate HTML
-	htmlPath := prefix + ".html"
-	if err := s.generateHTML(htmlPath, report); err != nil {
-		return fmt.Errorf("HTML generation failed: %w", err)
+	for _, format := range formats {
+		switch format {
+		case ReportJSON:
+			jsonPath := prefix + ".json"
+			if err := s.generateJSON(jsonPath, report); err != nil {
+				return fmt.Errorf("JSON generation failed: %w", err)
+			}
+			fmt.Printf("✓ JSON report: %s\n", jsonPath)
+		case ReportHTML:
+			htmlPath := prefix + ".html"
+			if err := s.generateHTML(htmlPath, report); err != nil {
+				return fmt.Errorf("HTML generation failed: %w", err)
+			}
+			fmt.Printf("✓ HTML report: %s\n", htmlPath)
+		case ReportJUnit:
+			xmlPath := prefix + ".xml"
+			if err := s.generateJUnit(xmlPath); err != nil {
+				return fmt.Errorf("JUnit generation failed: %w", err)
+			}
+			fmt.Printf("✓ JUnit report: %s\n", xmlPath)
+		default:
+			return fmt.Errorf("unknown report format %q (use json, html or junit)", format)
+		}
 	}
-	fmt.Printf("✓ HTML report: %s\n", htmlPath)
-	
+
 	return nil
 }
 
+func (s *TestSuite) generateJUnit(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.WriteJUnit(f)
+}
+
 func (s *TestSuite) generateJSON(path string, report Report) error {
 	data, err := json.MarshalIndent(report, "", "  ")
 	if err != nil {
@@ -190,6 +225,31 @@ const htmlTemplate = `<!DOCTYPE html>
                 {{end}}
             </tbody>
         </table>
+
+        {{if .Profile}}
+        <h2>⏱ Profile</h2>
+        <p class="meta">{{.Profile.APDUs}} APDUs in {{printf "%.0f" .Profile.DurationMs}} ms</p>
+        <table>
+            <thead>
+                <tr>
+                    <th>Operation</th>
+                    <th>Calls</th>
+                    <th>APDUs</th>
+                    <th>Time (ms)</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{range .Profile.Operations}}
+                <tr>
+                    <td>{{.Name}}</td>
+                    <td>{{.Calls}}</td>
+                    <td>{{.APDUs}}</td>
+                    <td>{{printf "%.1f" .DurationMs}}</td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{end}}
     </div>
 </body>
 </html>`
@@ -16,6 +16,7 @@ type TestResult struct {
 	Name     string `json:"name"`
 	Category string `json:"category"` // usim, isim, auth, apdu, security
 	Passed   bool   `json:"passed"`
+	Skipped  bool   `json:"skipped,omitempty"` // Could not run (e.g. no keys given); not counted as failed
 	Expected string `json:"expected,omitempty"`
 	Actual   string `json:"actual,omitempty"`
 	APDU     string `json:"apdu,omitempty"`     // hex string of sent command
@@ -28,17 +29,19 @@ type TestResult struct {
 
 // TestOptions contains configuration for running tests
 type TestOptions struct {
-	ADMKey    []byte // ADM key for write tests
-	PIN1      string // PIN1 for verification tests
-	AuthK     []byte // K key for authentication
-	AuthOP    []byte // OP for computing OPc
-	AuthOPc   []byte // Pre-computed OPc
-	AuthSQN   []byte // Sequence number
-	AuthAMF   []byte // Authentication Management Field
-	Algorithm string // milenage or tuak
-	MCC       int    // Mobile Country Code
-	MNC       int    // Mobile Network Code
-	Verbose   bool   // Verbose output
+	ADMKey    []byte   // ADM key for write tests
+	PIN1      string   // PIN1 for verification tests
+	AuthK     []byte   // K key for authentication
+	AuthOP    []byte   // OP for computing OPc
+	AuthOPc   []byte   // Pre-computed OPc
+	AuthSQN   []byte   // Sequence number
+	AuthAMF   []byte   // Authentication Management Field
+	Algorithm string   // milenage or tuak
+	MCC       int      // Mobile Country Code
+	MNC       int      // Mobile Network Code
+	Verbose   bool     // Verbose output
+	FailFast  bool     // Stop the suite at the first failed test
+	Profile   *Profile // Expectations of the card product (nil = generic expectations)
 }
 
 // TestSuite is the main test orchestrator
@@ -48,6 +51,8 @@ type TestSuite struct {
 	Results   []TestResult
 	StartTime time.Time
 	EndTime   time.Time
+
+	stopped bool // FailFast triggered
 }
 
 // TestSummary contains aggregated test results
@@ -55,6 +60,7 @@ type TestSummary struct {
 	Total      int               `json:"total"`
 	Passed     int               `json:"passed"`
 	Failed     int               `json:"failed"`
+	Skipped    int               `json:"skipped"`
 	PassRate   float64           `json:"pass_rate"`
 	Duration   time.Duration     `json:"duration_ns"`
 	ByCategory map[string]int    `json:"by_category"`
@@ -72,31 +78,60 @@ func NewTestSuite(reader *card.Reader, opts TestOptions) *TestSuite {
 
 // AddResult adds a test result to the suite
 func (s *TestSuite) AddResult(r TestResult) {
+	s.applyProfile(&r)
 	s.Results = append(s.Results, r)
 	if s.Options.Verbose {
 		status := "✓"
-		if !r.Passed {
+		switch {
+		case r.Skipped:
+			status = "-"
+		case !r.Passed:
 			status = "✗"
 		}
 		fmt.Printf("  [%s] %s: %s\n", status, r.Name, r.Actual)
 	}
+	if s.Options.FailFast && !r.Passed && !r.Skipped && !s.stopped {
+		s.stopped = true
+		fmt.Printf("Stopping after first failure (fail-fast): %s\n", r.Name)
+	}
+}
+
+// Stopped reports whether the suite stopped at a failure (FailFast)
+func (s *TestSuite) Stopped() bool {
+	return s.stopped
+}
+
+// runTests runs the tests of a category in order, stopping when the suite was stopped
+func (s *TestSuite) runTests(tests ...func()) {
+	for _, test := range tests {
+		if s.stopped {
+			return
+		}
+		test()
+	}
 }
 
 // RunAll runs all test categories
 func (s *TestSuite) RunAll() error {
 	s.StartTime = time.Now()
 	
-	fmt.Println("\n=== SIM CARD TEST SUITE ===\n")
+	fmt.Print("\n=== SIM CARD TEST SUITE ===\n\n")
 	
-	// Perform warm reset to ensure clean card state
+	// Reset to ensure clean card state (per the reader's reset policy, skipped with none)
 	// This is essential when running tests multiple times without removing the card
-	if err := s.Reader.Reconnect(false); err != nil {
+	if err := s.Reader.ApplyResetPolicy(); err != nil {
 		fmt.Printf("Warning: card reset failed: %v (continuing anyway)\n", err)
 	}
 	
 	// Run each category
 	categories := []string{"usim", "isim", "auth", "apdu", "security"}
+	if s.Options.Profile != nil {
+		categories = append([]string{"profile"}, categories...)
+	}
 	for _, cat := range categories {
+		if s.stopped {
+			break
+		}
 		if err := s.RunCategory(cat); err != nil {
 			// Log error but continue with other categories
 			fmt.Printf("Warning: %s tests error: %v\n", cat, err)
@@ -118,6 +153,7 @@ func (s *TestSuite) resetCardState() {
 // RunCategory runs tests for a specific category
 func (s *TestSuite) RunCategory(category string) error {
 	category = strings.ToLower(strings.TrimSpace(category))
+	defer s.Reader.Measure("test " + category)()
 	
 	switch category {
 	case "usim":
@@ -135,11 +171,27 @@ func (s *TestSuite) RunCategory(category string) error {
 	case "security":
 		fmt.Println("--- Security/Negative Tests ---")
 		return s.runSecurityTests()
+	case "profile":
+		if s.Options.Profile == nil {
+			return fmt.Errorf("no card profile given (--test-profile)")
+		}
+		fmt.Printf("--- Card Profile Tests (%s) ---\n", s.Options.Profile.Name)
+		return s.runProfileTests()
 	default:
 		return fmt.Errorf("unknown test category: %s", category)
 	}
 }
 
+// Metrics returns the time and APDU count of the categories and the operations they ran,
+// or nil when the reader collects no metrics (card.WithMetrics)
+func (s *TestSuite) Metrics() *card.MetricsReport {
+	if s.Reader == nil || s.Reader.Metrics() == nil {
+		return nil
+	}
+	r := s.Reader.Metrics().Report()
+	return &r
+}
+
 // GetSummary returns aggregated test results
 func (s *TestSuite) GetSummary() TestSummary {
 	summary := TestSummary{
@@ -149,7 +201,9 @@ func (s *TestSuite) GetSummary() TestSummary {
 	}
 	
 	for _, r := range s.Results {
-		if r.Passed {
+		if r.Skipped {
+			summary.Skipped++
+		} else if r.Passed {
 			summary.Passed++
 		} else {
 			summary.Failed++
@@ -158,8 +212,8 @@ func (s *TestSuite) GetSummary() TestSummary {
 		summary.ByCategory[r.Category]++
 	}
 	
-	if summary.Total > 0 {
-		summary.PassRate = float64(summary.Passed) / float64(summary.Total) * 100
+	if run := summary.Total - summary.Skipped; run > 0 {
+		summary.PassRate = float64(summary.Passed) / float64(run) * 100
 	}
 	
 	summary.Duration = s.EndTime.Sub(s.StartTime)
@@ -6,7 +6,6 @@ import (
 	"strings"
 	"time"
 
-	"sim_reader/card"
 	"sim_reader/sim"
 )
 
@@ -15,16 +14,18 @@ func (s *TestSuite) runAPDUTests() error {
 	// Ensure we start from MF
 	s.Reader.Select([]byte{0x3F, 0x00})
 
-	s.testSELECT_MF()
-	s.testSELECT_ByAID()
-	s.testSELECT_ByFID()
-	s.testSELECT_P2Variants()
-	s.testREAD_BINARY()
-	s.testREAD_BINARY_Offset()
-	s.testREAD_RECORD()
-	s.testSTATUS()
-	s.testVERIFY_Query()
-	s.testGET_RESPONSE()
+	s.runTests(
+		s.testSELECT_MF,
+		s.testSELECT_ByAID,
+		s.testSELECT_ByFID,
+		s.testSELECT_P2Variants,
+		s.testREAD_BINARY,
+		s.testREAD_BINARY_Offset,
+		s.testREAD_RECORD,
+		s.testSTATUS,
+		s.testVERIFY_Query,
+		s.testGET_RESPONSE,
+	)
 
 	return nil
 }
@@ -35,13 +36,15 @@ func (s *TestSuite) runSecurityTests() error {
 	usimAID := sim.GetUSIMAID()
 	s.Reader.Select(usimAID)
 
-	s.testWrongPIN()
-	s.testFileNotFound()
-	s.testSecurityNotSatisfied()
-	s.testWrongLength()
-	s.testWrongP1P2()
-	s.testWrongCLA()
-	s.testWrongINS()
+	s.runTests(
+		s.testWrongPIN,
+		s.testFileNotFound,
+		s.testSecurityNotSatisfied,
+		s.testWrongLength,
+		s.testWrongP1P2,
+		s.testWrongCLA,
+		s.testWrongINS,
+	)
 
 	return nil
 }
@@ -68,7 +71,7 @@ func (s *TestSuite) testSELECT_MF() {
 			Expected: "SW=9000 or 61XX",
 			Actual:   fmt.Sprintf("SW=%04X", resp.SW()),
 			SW:       resp.SW(),
-			Error:    card.SWToString(resp.SW()),
+			Error:    resp.SWString(),
 			Spec:     spec, Duration: time.Since(start)})
 		return
 	}
@@ -96,7 +99,8 @@ func (s *TestSuite) testSELECT_ByAID() {
 	apdu[4] = byte(len(usimAID))
 	copy(apdu[5:], usimAID)
 
-	resp, err := s.Reader.SendAPDU(apdu)
+	// Raw exchanges: this test checks the card's own 61XX / GET RESPONSE behaviour
+	resp, err := s.Reader.SendAPDURaw(apdu)
 	if err != nil {
 		s.AddResult(TestResult{Name: name, Category: "apdu", Passed: false,
 			APDU: strings.ToUpper(hex.EncodeToString(apdu)),
@@ -286,7 +290,7 @@ func (s *TestSuite) testREAD_RECORD() {
 	s.Reader.Select(usimAID)
 	resp, err := s.Reader.Select([]byte{0x6F, 0x42})
 	if err != nil || (!resp.IsOK() && !resp.HasMoreData()) {
-		s.AddResult(TestResult{Name: name, Category: "apdu", Passed: true,
+		s.AddResult(TestResult{Name: name, Category: "apdu", Passed: true, Skipped: true,
 			Actual: "EF.SMSP not present (test skipped)",
 			Spec:   spec, Duration: time.Since(start)})
 		return
@@ -302,13 +306,6 @@ func (s *TestSuite) testREAD_RECORD() {
 		return
 	}
 
-	// 6C XX means wrong Le
-	if resp.SW1 == 0x6C {
-		// Retry with correct Le
-		apdu[4] = resp.SW2
-		resp, _ = s.Reader.SendAPDU(apdu)
-	}
-
 	if !resp.IsOK() {
 		s.AddResult(TestResult{Name: name, Category: "apdu", Passed: false,
 			APDU:   strings.ToUpper(hex.EncodeToString(apdu)),
@@ -346,12 +343,6 @@ func (s *TestSuite) testSTATUS() {
 		return
 	}
 
-	// 6C XX means wrong Le
-	if resp.SW1 == 0x6C {
-		apdu[4] = resp.SW2
-		resp, _ = s.Reader.SendAPDU(apdu)
-	}
-
 	// 6D00 = INS not supported - this is acceptable, STATUS is optional
 	if resp.SW() == 0x6D00 {
 		s.AddResult(TestResult{Name: name, Category: "apdu", Passed: true,
@@ -362,7 +353,7 @@ func (s *TestSuite) testSTATUS() {
 		return
 	}
 
-	if !resp.IsOK() && !resp.HasMoreData() {
+	if !resp.IsOK() {
 		s.AddResult(TestResult{Name: name, Category: "apdu", Passed: true,
 			APDU:   strings.ToUpper(hex.EncodeToString(apdu)),
 			Actual: fmt.Sprintf("SW=%04X (card-specific)", resp.SW()),
@@ -371,10 +362,6 @@ func (s *TestSuite) testSTATUS() {
 		return
 	}
 
-	if resp.HasMoreData() {
-		resp, _ = s.Reader.GetResponse(resp.SW2)
-	}
-
 	s.AddResult(TestResult{Name: name, Category: "apdu", Passed: true,
 		APDU:   strings.ToUpper(hex.EncodeToString(apdu)),
 		SW:     resp.SW(),
@@ -418,7 +405,7 @@ func (s *TestSuite) testVERIFY_Query() {
 		s.AddResult(TestResult{Name: name, Category: "apdu", Passed: true,
 			APDU:   strings.ToUpper(hex.EncodeToString(apdu)),
 			SW:     sw,
-			Actual: fmt.Sprintf("SW=%04X (%s)", sw, card.SWToString(sw)),
+			Actual: fmt.Sprintf("SW=%04X (%s)", sw, resp.SWString()),
 			Spec:   spec, Duration: time.Since(start)})
 	}
 }
@@ -439,7 +426,8 @@ func (s *TestSuite) testGET_RESPONSE() {
 	apdu[4] = byte(len(usimAID))
 	copy(apdu[5:], usimAID)
 
-	resp, err := s.Reader.SendAPDU(apdu)
+	// Raw exchanges: this test checks the card's own 61XX / GET RESPONSE behaviour
+	resp, err := s.Reader.SendAPDURaw(apdu)
 	if err != nil {
 		s.AddResult(TestResult{Name: name, Category: "apdu", Passed: false,
 			Error: err.Error(), Spec: spec, Duration: time.Since(start)})
@@ -455,7 +443,7 @@ func (s *TestSuite) testGET_RESPONSE() {
 
 	// GET RESPONSE
 	grApdu := []byte{0x00, 0xC0, 0x00, 0x00, resp.SW2}
-	grResp, err := s.Reader.SendAPDU(grApdu)
+	grResp, err := s.Reader.SendAPDURaw(grApdu)
 	if err != nil {
 		s.AddResult(TestResult{Name: name, Category: "apdu", Passed: false,
 			APDU: strings.ToUpper(hex.EncodeToString(grApdu)),
@@ -489,7 +477,7 @@ func (s *TestSuite) testWrongPIN() {
 
 	// VERIFY with wrong PIN (all zeros)
 	// Don't actually send wrong PIN to avoid blocking - just verify the SW interpretation
-	s.AddResult(TestResult{Name: name, Category: "security", Passed: true,
+	s.AddResult(TestResult{Name: name, Category: "security", Passed: true, Skipped: true,
 		Actual:   "Test skipped (avoid blocking PIN)",
 		Expected: "SW=63CX",
 		Spec:     spec, Duration: time.Since(start)})
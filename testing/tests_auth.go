@@ -1,23 +1,30 @@
 package testing
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 	"strings"
 	"time"
 
+	"sim_reader/algorithms"
+	"sim_reader/card"
 	"sim_reader/sim"
 )
 
 // runAuthTests runs authentication tests
 func (s *TestSuite) runAuthTests() error {
+	// Card RNG sanity check does not need keys
+	s.testGetChallenge()
+
 	// Check if we have keys for authentication
 	if len(s.Options.AuthK) == 0 {
 		s.AddResult(TestResult{
 			Name:     "Authentication Tests",
 			Category: "auth",
-			Passed:   false,
+			Skipped:  true,
+			Actual:   "Skipped (no K)",
 			Error:    "No authentication key (K) provided. Use -auth-k flag.",
 			Spec:     "TS 35.206",
 		})
@@ -29,7 +36,8 @@ func (s *TestSuite) runAuthTests() error {
 		s.AddResult(TestResult{
 			Name:     "Authentication Tests",
 			Category: "auth",
-			Passed:   false,
+			Skipped:  true,
+			Actual:   "Skipped (no OPc)",
 			Error:    "No OPc provided. Use -auth-opc or -auth-op flag.",
 			Spec:     "TS 35.206",
 		})
@@ -51,10 +59,18 @@ func (s *TestSuite) runAuthTests() error {
 	}
 
 	// Run authentication tests
-	s.testAuth3GContext()
-	s.testAuthGSMContext()
-	s.testAuthMultiple()
-	s.testAuthWithSimFunction()
+	s.runTests(
+		s.testAuth3GContext,
+		s.testAuthGSMContext,
+		s.testAuthMultiple,
+		s.testAuthWithSimFunction,
+	)
+
+	// Negative tests: tampered AUTN and replayed SQN
+	s.runTests(
+		s.testAuthMACFailure,
+		s.testAuthSyncFailure,
+	)
 
 	return nil
 }
@@ -165,11 +181,6 @@ func (s *TestSuite) testAuthGSMContext() {
 		return
 	}
 
-	// Handle GET RESPONSE if needed
-	if resp.HasMoreData() {
-		resp, _ = s.Reader.GetResponse(resp.SW2)
-	}
-
 	if !resp.IsOK() {
 		// GSM auth might not be supported
 		s.AddResult(TestResult{Name: name, Category: "auth", Passed: true,
@@ -330,3 +341,246 @@ func (s *TestSuite) testAuthKeysAfterAuth() {
 			SW: resp.SW(), Spec: spec, Duration: time.Since(start)})
 	}
 }
+
+// testGetChallenge checks that GET CHALLENGE returns varying, non-zero random data
+func (s *TestSuite) testGetChallenge() {
+	start := time.Now()
+	name := "GET CHALLENGE entropy (3x)"
+	spec := "ISO 7816-4 GET CHALLENGE"
+
+	var challenges []string
+	var prev []byte
+	allEqual, anyZero := true, false
+	for i := 0; i < 3; i++ {
+		c, err := s.Reader.GetChallenge(8)
+		if err != nil {
+			s.AddResult(TestResult{Name: name, Category: "auth", Passed: false,
+				Error: err.Error(), SW: s.Reader.LastSW(), Spec: spec, Duration: time.Since(start)})
+			return
+		}
+		if len(c) == 0 || bytes.Equal(c, make([]byte, len(c))) {
+			anyZero = true
+		}
+		if prev != nil && !bytes.Equal(c, prev) {
+			allEqual = false
+		}
+		prev = c
+		challenges = append(challenges, strings.ToUpper(hex.EncodeToString(c)))
+	}
+
+	actual := strings.Join(challenges, ", ")
+	switch {
+	case anyZero:
+		s.AddResult(TestResult{Name: name, Category: "auth", Passed: false,
+			Expected: "non-zero random data", Actual: actual,
+			Error: "card returned an all-zero challenge", Spec: spec, Duration: time.Since(start)})
+	case allEqual:
+		s.AddResult(TestResult{Name: name, Category: "auth", Passed: false,
+			Expected: "different data on each call", Actual: actual,
+			Error: "card returned the same challenge 3 times", Spec: spec, Duration: time.Since(start)})
+	default:
+		s.AddResult(TestResult{Name: name, Category: "auth", Passed: true,
+			Actual: actual, Spec: spec, Duration: time.Since(start)})
+	}
+}
+
+// authVector computes RAND and AUTN for sqn/amf with the local Milenage implementation
+func (s *TestSuite) authVector(sqn, amf []byte) (randBytes, autn []byte, err error) {
+	randBytes = make([]byte, 16)
+	if _, err := rand.Read(randBytes); err != nil {
+		return nil, nil, err
+	}
+	v := &algorithms.Variables{K: s.Options.AuthK, TOPC: s.Options.AuthOPc, RAND: randBytes, SQN: sqn, AMF: amf}
+	m := &algorithms.Milenage{}
+	if err := m.ComputeF1(v); err != nil {
+		return nil, nil, err
+	}
+	if err := m.ComputeF2345(v); err != nil {
+		return nil, nil, err
+	}
+	if err := v.ComputeAUTN(); err != nil {
+		return nil, nil, err
+	}
+	return randBytes, v.AUTN, nil
+}
+
+// verifyAUTS independently unmasks SQNms from AUTS and checks MAC-S (f1* with AMF=0000, TS 33.102 6.3.3)
+func (s *TestSuite) verifyAUTS(randBytes, auts []byte) (sqnMS []byte, macOK bool, err error) {
+	v := &algorithms.Variables{K: s.Options.AuthK, TOPC: s.Options.AuthOPc, RAND: randBytes, AUTS: auts}
+	m := &algorithms.Milenage{}
+	if err := m.ComputeF5s(v); err != nil {
+		return nil, false, err
+	}
+	if err := v.ComputeSQNms(); err != nil {
+		return nil, false, err
+	}
+	sqnMS = v.SQNms
+	macS := v.MACS
+
+	v.SQN = sqnMS
+	v.AMF = []byte{0x00, 0x00}
+	if err := m.ComputeF1s(v); err != nil {
+		return nil, false, err
+	}
+	return sqnMS, bytes.Equal(v.MACS, macS), nil
+}
+
+// authSkipNonMilenage records a skipped negative test when keys are not Milenage keys
+func (s *TestSuite) authSkipNonMilenage(name, spec string) bool {
+	if s.Options.Algorithm == "tuak" || len(s.Options.AuthK) != 16 || len(s.Options.AuthOPc) != 16 {
+		s.AddResult(TestResult{Name: name, Category: "auth", Passed: true, Skipped: true,
+			Actual: "Skipped (negative vectors are built with Milenage only)", Spec: spec})
+		return true
+	}
+	return false
+}
+
+// testAuthMACFailure sends an AUTN with one AMF bit flipped; the card must reject the MAC (9862)
+func (s *TestSuite) testAuthMACFailure() {
+	start := time.Now()
+	name := "AUTHENTICATE tampered AMF (MAC failure)"
+	spec := "TS 31.102 7.1.2.1"
+	if s.authSkipNonMilenage(name, spec) {
+		return
+	}
+
+	sqn := []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+	if len(s.Options.AuthSQN) == 6 {
+		sqn = s.Options.AuthSQN
+	}
+	randBytes, autn, err := s.authVector(sqn, []byte{0x80, 0x00})
+	if err != nil {
+		s.AddResult(TestResult{Name: name, Category: "auth", Passed: false,
+			Error: err.Error(), Spec: spec, Duration: time.Since(start)})
+		return
+	}
+	// AUTN = SQN^AK (6) || AMF (2) || MAC-A (8): flip the lowest AMF bit, keep the MAC
+	autn[7] ^= 0x01
+
+	res, err := s.Reader.Authenticate(randBytes, autn, card.AUTH_CONTEXT_3G)
+	var sw uint16
+	if res != nil {
+		sw = res.SW
+	}
+	if sw == 0x9862 {
+		s.AddResult(TestResult{Name: name, Category: "auth", Passed: true,
+			Actual: "SW=9862 (MAC failure)", SW: sw, Spec: spec, Duration: time.Since(start)})
+		return
+	}
+
+	errMsg := "card did not reject the tampered AUTN"
+	if err != nil {
+		errMsg = err.Error()
+	}
+	s.AddResult(TestResult{Name: name, Category: "auth", Passed: false,
+		Expected: "SW=9862 (MAC failure)", Actual: fmt.Sprintf("SW=%04X", sw),
+		Error: errMsg, SW: sw, Spec: spec, Duration: time.Since(start)})
+}
+
+// authenticateSQN runs AUTHENTICATE with a locally built vector for sqn
+func (s *TestSuite) authenticateSQN(sqn []byte) (randBytes []byte, res *card.AuthenticateResult, err error) {
+	randBytes, autn, err := s.authVector(sqn, []byte{0x80, 0x00})
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err = s.Reader.Authenticate(randBytes, autn, card.AUTH_CONTEXT_3G)
+	return randBytes, res, err
+}
+
+// testAuthSyncFailure gets a fresh SQN accepted, replays an older one and checks the AUTS:
+// the card must answer with a sync failure, MAC-S must verify and SQNms must be the
+// last accepted SQN as extracted by sim.ProcessAUTS.
+func (s *TestSuite) testAuthSyncFailure() {
+	start := time.Now()
+	name := "AUTHENTICATE old SQN (sync failure)"
+	nameSQN := "AUTS SQNms matches local Milenage"
+	spec := "TS 33.102 6.3.5"
+	if s.authSkipNonMilenage(name, spec) {
+		return
+	}
+	fail := func(name, errMsg string) {
+		s.AddResult(TestResult{Name: name, Category: "auth", Passed: false,
+			Error: errMsg, Spec: spec, Duration: time.Since(start)})
+	}
+
+	// Step 1: get a SQN accepted, resynchronising once if the card is ahead of us
+	sqn := sim.Uint64ToSQN(0x20)
+	if len(s.Options.AuthSQN) == 6 {
+		sqn = s.Options.AuthSQN
+	}
+	accepted := false
+	for attempt := 0; attempt < 2 && !accepted; attempt++ {
+		randBytes, res, err := s.authenticateSQN(sqn)
+		switch {
+		case err != nil:
+			fail(name, fmt.Sprintf("could not get a SQN accepted: %v", err))
+			return
+		case len(res.AUTS) > 0:
+			sqnMS, _, err := s.verifyAUTS(randBytes, res.AUTS)
+			if err != nil {
+				fail(name, fmt.Sprintf("resync AUTS: %v", err))
+				return
+			}
+			sqn = sim.Uint64ToSQN(sim.SQNToUint64(sqnMS) + 0x20) // next SEQ, same IND
+		case res.Success:
+			accepted = true
+		}
+	}
+	if !accepted {
+		fail(name, "card rejected the resynchronised SQN")
+		return
+	}
+
+	// Step 2: replay an older SQN (same IND, previous SEQ)
+	old := sqn
+	if v := sim.SQNToUint64(sqn); v >= 0x20 {
+		old = sim.Uint64ToSQN(v - 0x20)
+	}
+	randBytes, res, err := s.authenticateSQN(old)
+	if err != nil || res == nil || len(res.AUTS) == 0 {
+		var sw uint16
+		if res != nil {
+			sw = res.SW
+		}
+		errMsg := "no AUTS returned for an old SQN"
+		if err != nil {
+			errMsg = err.Error()
+		}
+		s.AddResult(TestResult{Name: name, Category: "auth", Passed: false,
+			Expected: "sync failure with AUTS", Actual: fmt.Sprintf("SW=%04X", sw),
+			Error: errMsg, SW: sw, Spec: spec, Duration: time.Since(start)})
+		return
+	}
+	s.AddResult(TestResult{Name: name, Category: "auth", Passed: true,
+		Actual:   fmt.Sprintf("AUTS=%s", strings.ToUpper(hex.EncodeToString(res.AUTS))),
+		Response: strings.ToUpper(hex.EncodeToString(res.AUTS)),
+		SW:       res.SW, Spec: spec, Duration: time.Since(start)})
+
+	// Step 3: cross-check AUTS against the tool's own extraction
+	sqnMS, macOK, err := s.verifyAUTS(randBytes, res.AUTS)
+	if err != nil {
+		fail(nameSQN, err.Error())
+		return
+	}
+	processed, err := sim.ProcessAUTS(&sim.AuthConfig{K: s.Options.AuthK, OPc: s.Options.AuthOPc, RAND: randBytes}, res.AUTS)
+	if err != nil {
+		fail(nameSQN, err.Error())
+		return
+	}
+	want := strings.ToUpper(hex.EncodeToString(sqn))
+	got := strings.ToUpper(hex.EncodeToString(sqnMS))
+	switch {
+	case !macOK:
+		s.AddResult(TestResult{Name: nameSQN, Category: "auth", Passed: false,
+			Expected: "valid MAC-S", Actual: "MAC-S mismatch", Error: "AUTS MAC-S does not verify with local f1*",
+			Spec: spec, Duration: time.Since(start)})
+	case processed.SQNms != got || got != want:
+		s.AddResult(TestResult{Name: nameSQN, Category: "auth", Passed: false,
+			Expected: fmt.Sprintf("SQNms=%s", want),
+			Actual:   fmt.Sprintf("SQNms=%s (sim.ProcessAUTS: %s)", got, processed.SQNms),
+			Spec:     spec, Duration: time.Since(start)})
+	default:
+		s.AddResult(TestResult{Name: nameSQN, Category: "auth", Passed: true,
+			Actual: fmt.Sprintf("SQNms=%s, MAC-S valid", got), Spec: spec, Duration: time.Since(start)})
+	}
+}
@@ -11,6 +11,20 @@ import (
 
 // runISIMTests runs all ISIM file tests per TS 31.103
 func (s *TestSuite) runISIMTests() error {
+	// A product without ISIM passes when the application is indeed absent
+	if p := s.Options.Profile; p != nil {
+		if want, ok := p.Applications["isim"]; ok && !want {
+			r := TestResult{Name: "ISIM Application Select", Category: "isim", Passed: true,
+				Actual: fmt.Sprintf("Not present (profile %q: applications.isim = false)", p.Name), Spec: "TS 31.103"}
+			if selectProfileApp(s.Reader, "isim") {
+				r.Passed, r.Expected, r.Actual = false, "not present", "present"
+				r.Error = p.violation("applications.isim", false)
+			}
+			s.AddResult(r)
+			return nil
+		}
+	}
+
 	// Select ISIM application
 	isimAID := sim.GetISIMAID()
 	resp, err := s.Reader.Select(isimAID)
@@ -35,13 +49,15 @@ func (s *TestSuite) runISIMTests() error {
 	}
 
 	// Run individual file tests
-	s.testISIM_IMPI()
-	s.testISIM_IMPU()
-	s.testISIM_DOMAIN()
-	s.testISIM_IST()
-	s.testISIM_PCSCF()
-	s.testISIM_AD()
-	s.testISIM_ARR()
+	s.runTests(
+		s.testISIM_IMPI,
+		s.testISIM_IMPU,
+		s.testISIM_DOMAIN,
+		s.testISIM_IST,
+		s.testISIM_PCSCF,
+		s.testISIM_AD,
+		s.testISIM_ARR,
+	)
 
 	return nil
 }
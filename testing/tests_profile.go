@@ -0,0 +1,232 @@
+package testing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sim_reader/sim"
+)
+
+// profileSpecs is the specification of each profile application key
+var profileSpecs = map[string]string{
+	"mf":   "TS 102.221",
+	"usim": "TS 31.102",
+	"isim": "TS 31.103",
+}
+
+// runProfileTests checks the card against every expectation of Options.Profile
+func (s *TestSuite) runProfileTests() error {
+	p := s.Options.Profile
+	s.runTests(s.testProfileATR)
+
+	for _, app := range []string{"usim", "isim"} {
+		if want, ok := p.Applications[app]; ok {
+			s.runTests(func() { s.testProfileApplication(app, want) })
+		}
+	}
+	for _, app := range []string{"mf", "usim", "isim"} {
+		efs := make([]string, 0, len(p.Files[app]))
+		for ef := range p.Files[app] {
+			efs = append(efs, ef)
+		}
+		sort.Strings(efs)
+		for _, ef := range efs {
+			s.runTests(func() { s.testProfileFile(app, ef, p.Files[app][ef]) })
+		}
+	}
+	for _, app := range []string{"usim", "isim"} {
+		if exp, ok := p.Services[app]; ok {
+			s.runTests(func() { s.testProfileServices(app, exp) })
+		}
+	}
+	return nil
+}
+
+// applyProfile replaces the generic expectation of a failed result by the profile's:
+// a file the product does not have passes, and authentication failures name the
+// algorithm the profile selected
+func (s *TestSuite) applyProfile(r *TestResult) {
+	p := s.Options.Profile
+	if p == nil || r.Passed || r.Skipped {
+		return
+	}
+	switch r.Category {
+	case "usim", "isim":
+		if e, ef, ok := p.file(r.Category, r.Name); ok && e.expectsAbsent() {
+			r.Passed = true
+			r.Actual = fmt.Sprintf("Not present (profile %q: files.%s.%s.present = false)", p.Name, r.Category, ef)
+			r.Expected, r.Error = "", ""
+		}
+	case "auth":
+		if p.Auth != nil && p.Auth.Algorithm != "" {
+			r.Error = strings.TrimSpace(r.Error + " (" + p.violation("auth.algorithm", p.Auth.Algorithm) + ")")
+		}
+	}
+}
+
+// testProfileATR compares the ATR with the profile ATR under its mask
+func (s *TestSuite) testProfileATR() {
+	p := s.Options.Profile
+	if p.ATR == "" {
+		return
+	}
+	start := time.Now()
+	name := "Profile ATR"
+	spec := "ISO/IEC 7816-3"
+	expected := p.ATR
+	if p.ATRMask != "" {
+		expected += " (mask " + p.ATRMask + ")"
+	}
+
+	if !p.MatchATR(s.Reader.ATR()) {
+		s.AddResult(TestResult{Name: name, Category: "profile", Passed: false,
+			Expected: expected, Actual: s.Reader.ATRHex(),
+			Error: p.violation("atr", p.ATR), Spec: spec, Duration: time.Since(start)})
+		return
+	}
+	s.AddResult(TestResult{Name: name, Category: "profile", Passed: true,
+		Expected: expected, Actual: s.Reader.ATRHex(), Spec: spec, Duration: time.Since(start)})
+}
+
+// testProfileApplication checks that the application is present or absent as the profile says
+func (s *TestSuite) testProfileApplication(app string, want bool) {
+	start := time.Now()
+	name := fmt.Sprintf("Profile application %s", strings.ToUpper(app))
+	spec := profileSpecs[app]
+
+	got := selectProfileApp(s.Reader, app)
+	actual := map[bool]string{true: "present", false: "absent"}
+	r := TestResult{Name: name, Category: "profile", Passed: got == want,
+		Expected: actual[want], Actual: actual[got], Spec: spec, Duration: time.Since(start)}
+	if got != want {
+		r.Error = s.Options.Profile.violation("applications."+app, want)
+	}
+	s.AddResult(r)
+}
+
+// testProfileFile checks the presence and layout of one EF
+func (s *TestSuite) testProfileFile(app, ef string, e FileExpectation) {
+	start := time.Now()
+	p := s.Options.Profile
+	fid, _ := profileFileID(app, ef)
+	name := fmt.Sprintf("Profile %s/%s (%04X)", app, ef, fid)
+	spec := profileSpecs[app]
+	path := fmt.Sprintf("files.%s.%s", app, ef)
+
+	if !selectProfileApp(s.Reader, app) {
+		s.AddResult(TestResult{Name: name, Category: "profile", Skipped: true,
+			Actual: fmt.Sprintf("%s not selectable (test skipped)", strings.ToUpper(app)),
+			Spec:   spec, Duration: time.Since(start)})
+		return
+	}
+
+	resp, err := s.Reader.Select([]byte{byte(fid >> 8), byte(fid)})
+	present := err == nil && (resp.IsOK() || resp.HasMoreData())
+	if !present {
+		r := TestResult{Name: name, Category: "profile", Passed: e.expectsAbsent(),
+			Actual: "not present", Spec: spec, Duration: time.Since(start)}
+		if resp != nil {
+			r.SW = resp.SW()
+		}
+		if !r.Passed {
+			r.Expected = "present"
+			r.Error = p.violation(path+".present", true)
+		}
+		s.AddResult(r)
+		return
+	}
+	if e.expectsAbsent() {
+		s.AddResult(TestResult{Name: name, Category: "profile", Passed: false,
+			Expected: "not present", Actual: "present", SW: resp.SW(),
+			Error: p.violation(path+".present", false), Spec: spec, Duration: time.Since(start)})
+		return
+	}
+
+	info := sim.ParseFCPInfo(resp.Data)
+	actual := fmt.Sprintf("present, %d bytes", info.Size)
+	if info.Structure == "linear" || info.Structure == "cyclic" {
+		actual = fmt.Sprintf("present, %d records of %d bytes", info.Records, info.RecordSize)
+	}
+
+	var expected, violations []string
+	check := func(field string, want, got int) {
+		if want == 0 {
+			return
+		}
+		expected = append(expected, fmt.Sprintf("%s=%d", field, want))
+		if got != want {
+			violations = append(violations, p.violation(path+"."+field, want))
+		}
+	}
+	check("size", e.Size, info.Size)
+	check("records", e.Records, info.Records)
+	check("record_size", e.RecordSize, info.RecordSize)
+
+	s.AddResult(TestResult{Name: name, Category: "profile", Passed: len(violations) == 0,
+		Expected: strings.Join(expected, ", "), Actual: actual, SW: resp.SW(),
+		Error: strings.Join(violations, "; "), Spec: spec, Duration: time.Since(start)})
+}
+
+// testProfileServices checks the service bits of the UST (usim) or IST (isim)
+func (s *TestSuite) testProfileServices(app string, exp ServiceExpectation) {
+	start := time.Now()
+	p := s.Options.Profile
+	table := map[string]string{"usim": "UST", "isim": "IST"}[app]
+	name := fmt.Sprintf("Profile %s services", table)
+	spec := map[string]string{"usim": "TS 31.102 4.2.8", "isim": "TS 31.103 4.2.7"}[app]
+
+	if !selectProfileApp(s.Reader, app) {
+		s.AddResult(TestResult{Name: name, Category: "profile", Skipped: true,
+			Actual: fmt.Sprintf("%s not selectable (test skipped)", strings.ToUpper(app)),
+			Spec:   spec, Duration: time.Since(start)})
+		return
+	}
+	services, count, ok := readServiceTable(s.Reader, app)
+	if !ok {
+		s.AddResult(TestResult{Name: name, Category: "profile", Passed: false,
+			Error: fmt.Sprintf("cannot read EF_%s", table), Spec: spec, Duration: time.Since(start)})
+		return
+	}
+
+	var wrongEnabled, wrongDisabled []int
+	for _, n := range exp.Enabled {
+		if !services[n] {
+			wrongEnabled = append(wrongEnabled, n)
+		}
+	}
+	for _, n := range exp.Disabled {
+		if services[n] {
+			wrongDisabled = append(wrongDisabled, n)
+		}
+	}
+	var wrong, violations []string
+	if len(wrongEnabled) > 0 {
+		wrong = append(wrong, "disabled: "+joinInts(wrongEnabled))
+		violations = append(violations, fmt.Sprintf("profile %q expects services.%s.enabled to include %s",
+			p.Name, app, joinInts(wrongEnabled)))
+	}
+	if len(wrongDisabled) > 0 {
+		wrong = append(wrong, "enabled: "+joinInts(wrongDisabled))
+		violations = append(violations, fmt.Sprintf("profile %q expects services.%s.disabled to include %s",
+			p.Name, app, joinInts(wrongDisabled)))
+	}
+
+	actual := fmt.Sprintf("%d of %d services enabled", len(services), count)
+	if len(wrong) > 0 {
+		actual += "; " + strings.Join(wrong, "; ")
+	}
+	s.AddResult(TestResult{Name: name, Category: "profile", Passed: len(violations) == 0,
+		Expected: fmt.Sprintf("%d enabled, %d disabled as listed", len(exp.Enabled), len(exp.Disabled)),
+		Actual:   actual, Error: strings.Join(violations, "; "), Spec: spec, Duration: time.Since(start)})
+}
+
+// joinInts formats service numbers as "1, 2, 5"
+func joinInts(ns []int) string {
+	parts := make([]string, len(ns))
+	for i, n := range ns {
+		parts[i] = fmt.Sprint(n)
+	}
+	return strings.Join(parts, ", ")
+}
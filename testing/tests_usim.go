@@ -35,29 +35,31 @@ func (s *TestSuite) runUSIMTests() error {
 	}
 
 	// Run individual file tests
-	s.testEF_IMSI()
-	s.testEF_AD()
-	s.testEF_UST()
-	s.testEF_EST()
-	s.testEF_ACC()
-	s.testEF_SPN()
-	s.testEF_HPPLMN()
-	s.testEF_PLMNwAcT()
-	s.testEF_OPLMNwAcT()
-	s.testEF_HPLMNwAcT()
-	s.testEF_FPLMN()
-	s.testEF_LOCI()
-	s.testEF_PSLOCI()
-	s.testEF_EPSLOCI()
-	s.testEF_Keys()
-	s.testEF_KeysPS()
-	s.testEF_LI()
-	s.testEF_START_HFN()
-	s.testEF_THRESHOLD()
-	s.testEF_SMS()
-	s.testEF_SMSP()
-	s.testEF_MSISDN()
-	s.testEF_ECC()
+	s.runTests(
+		s.testEF_IMSI,
+		s.testEF_AD,
+		s.testEF_UST,
+		s.testEF_EST,
+		s.testEF_ACC,
+		s.testEF_SPN,
+		s.testEF_HPPLMN,
+		s.testEF_PLMNwAcT,
+		s.testEF_OPLMNwAcT,
+		s.testEF_HPLMNwAcT,
+		s.testEF_FPLMN,
+		s.testEF_LOCI,
+		s.testEF_PSLOCI,
+		s.testEF_EPSLOCI,
+		s.testEF_Keys,
+		s.testEF_KeysPS,
+		s.testEF_LI,
+		s.testEF_START_HFN,
+		s.testEF_THRESHOLD,
+		s.testEF_SMS,
+		s.testEF_SMSP,
+		s.testEF_MSISDN,
+		s.testEF_ECC,
+	)
 
 	return nil
 }
@@ -0,0 +1,205 @@
+package textcodec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Encoding is a coding of an alpha identifier (TS 102 221 Annex A)
+type Encoding int
+
+const (
+	GSM7    Encoding = iota // default alphabet, one septet per byte
+	UCS2_80                 // 80, then 16-bit UCS2 characters
+	UCS2_81                 // 81, length, 8-bit base (bits 15-8 of a base pointer), 1 byte per character
+	UCS2_82                 // 82, length, 16-bit base pointer, 1 byte per character
+)
+
+// String returns the name of the encoding
+func (e Encoding) String() string {
+	switch e {
+	case UCS2_80:
+		return "UCS2 (80)"
+	case UCS2_81:
+		return "UCS2 (81)"
+	case UCS2_82:
+		return "UCS2 (82)"
+	default:
+		return "GSM 7-bit"
+	}
+}
+
+// DecodeAlpha decodes an alpha identifier (EF_ADN name, EF_SPN, EF_SMSP alpha ...):
+// trailing FF padding is dropped, a first byte of 80, 81 or 82 selects the matching UCS2
+// variant, anything else is the GSM default alphabet.
+func DecodeAlpha(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	switch data[0] {
+	case 0x80:
+		return DecodeUCS2(data[1:])
+	case 0x81:
+		if len(data) < 3 {
+			return ""
+		}
+		return decodeUCS2Based(data[3:], int(data[1]), rune(data[2])<<7)
+	case 0x82:
+		if len(data) < 4 {
+			return ""
+		}
+		return decodeUCS2Based(data[4:], int(data[1]), rune(data[2])<<8|rune(data[3]))
+	}
+	return DecodeGSM7(trimPadding(data))
+}
+
+// DecodeUCS2 decodes big-endian 16-bit characters up to the first FFFF
+func DecodeUCS2(data []byte) string {
+	var sb strings.Builder
+	for i := 0; i+1 < len(data); i += 2 {
+		c := rune(data[i])<<8 | rune(data[i+1])
+		if c == 0xFFFF {
+			break
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// decodeUCS2Based decodes the characters of the 81 and 82 variants: bit 8 clear is a GSM
+// default alphabet character, bit 8 set is an offset (bits 7-1) from base
+func decodeUCS2Based(data []byte, count int, base rune) string {
+	if count > len(data) {
+		count = len(data)
+	}
+	var sb strings.Builder
+	for i := 0; i < count; i++ {
+		b := data[i]
+		switch {
+		case b&0x80 != 0:
+			sb.WriteRune(base + rune(b&0x7F))
+		case b == gsm7Escape && i+1 < count:
+			i++
+			sb.WriteString(DecodeGSM7([]byte{gsm7Escape, data[i]}))
+		default:
+			sb.WriteString(DecodeGSM7([]byte{b}))
+		}
+	}
+	return sb.String()
+}
+
+// trimPadding drops the trailing FF bytes of a GSM coded field
+func trimPadding(data []byte) []byte {
+	end := len(data)
+	for end > 0 && data[end-1] == 0xFF {
+		end--
+	}
+	return data[:end]
+}
+
+// EncodeAlpha encodes s as an alpha identifier in the shortest of the four codings. GSM
+// 7-bit is used whenever it can represent s; otherwise the 81 or 82 variant when the
+// other characters fit in one 128-character window, else 80.
+func EncodeAlpha(s string) ([]byte, Encoding, error) {
+	var best []byte
+	var bestEnc Encoding
+	for _, enc := range []Encoding{GSM7, UCS2_81, UCS2_82, UCS2_80} {
+		data, err := EncodeAlphaAs(s, enc)
+		if err != nil {
+			continue
+		}
+		if best == nil || len(data) < len(best) {
+			best, bestEnc = data, enc
+		}
+	}
+	if best == nil {
+		return nil, 0, fmt.Errorf("%q cannot be encoded as an alpha identifier", s)
+	}
+	return best, bestEnc, nil
+}
+
+// EncodeAlphaPadded encodes s with EncodeAlpha and pads it with FF to size bytes
+func EncodeAlphaPadded(s string, size int) ([]byte, error) {
+	data, enc, err := EncodeAlpha(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > size {
+		return nil, fmt.Errorf("%q needs %d bytes in %s, the field has %d", s, len(data), enc, size)
+	}
+	out := make([]byte, size)
+	for i := range out {
+		out[i] = 0xFF
+	}
+	copy(out, data)
+	return out, nil
+}
+
+// EncodeAlphaAs encodes s in the given coding, failing when a character cannot be represented
+func EncodeAlphaAs(s string, enc Encoding) ([]byte, error) {
+	switch enc {
+	case GSM7:
+		return EncodeGSM7(s)
+	case UCS2_80:
+		out := []byte{0x80}
+		for _, r := range s {
+			if r > 0xFFFF {
+				return nil, fmt.Errorf("character %q is outside the UCS2 range", r)
+			}
+			out = append(out, byte(r>>8), byte(r))
+		}
+		return out, nil
+	case UCS2_81, UCS2_82:
+		return encodeUCS2Based(s, enc)
+	}
+	return nil, fmt.Errorf("unknown encoding %d", enc)
+}
+
+// encodeUCS2Based encodes the 81 / 82 variants. Characters of the default alphabet take
+// one byte (two for the extension table); every other character must lie within 128
+// code points of the base pointer: a multiple of 128 below 8000 for 81, any value for 82.
+func encodeUCS2Based(s string, enc Encoding) ([]byte, error) {
+	var others []rune
+	for _, r := range s {
+		if _, ok := gsm7Septets(r); !ok {
+			others = append(others, r)
+		}
+	}
+
+	var base rune
+	if len(others) > 0 {
+		lo, hi := others[0], others[0]
+		for _, r := range others {
+			lo, hi = min(lo, r), max(hi, r)
+		}
+		if enc == UCS2_81 {
+			base = lo &^ 0x7F
+			if hi >= 0x8000 || hi-base > 0x7F {
+				return nil, fmt.Errorf("%q does not fit the 81 coding", s)
+			}
+		} else {
+			base = lo
+			if hi > 0xFFFF || hi-base > 0x7F {
+				return nil, fmt.Errorf("%q does not fit the 82 coding", s)
+			}
+		}
+	}
+
+	var chars []byte
+	for _, r := range s {
+		if septets, ok := gsm7Septets(r); ok {
+			chars = append(chars, septets...)
+		} else {
+			chars = append(chars, 0x80|byte(r-base))
+		}
+	}
+	if len(chars) > 0xFF {
+		return nil, fmt.Errorf("%q is too long for the %s coding", s, enc)
+	}
+
+	out := []byte{0x81, byte(len(chars)), byte(base >> 7)}
+	if enc == UCS2_82 {
+		out = []byte{0x82, byte(len(chars)), byte(base >> 8), byte(base)}
+	}
+	return append(out, chars...), nil
+}
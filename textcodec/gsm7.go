@@ -0,0 +1,177 @@
+// Package textcodec encodes and decodes the text formats used on SIM cards: the GSM 7-bit
+// default alphabet of TS 23.038 (unpacked in alpha identifiers, packed in SMS), the three
+// UCS2 alpha identifier variants of TS 102 221 Annex A and the network name of TS 24.008.
+package textcodec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// gsm7Escape introduces a character of the extension table
+const gsm7Escape = 0x1B
+
+// gsm7Basic is the GSM 7-bit default alphabet (TS 23.038 6.2.1); 0x1B is the escape
+var gsm7Basic = [128]rune{
+	'@', '£', '$', '¥', 'è', 'é', 'ù', 'ì', 'ò', 'Ç', '\n', 'Ø', 'ø', '\r', 'Å', 'å',
+	'Δ', '_', 'Φ', 'Γ', 'Λ', 'Ω', 'Π', 'Ψ', 'Σ', 'Θ', 'Ξ', 0x1B, 'Æ', 'æ', 'ß', 'É',
+	' ', '!', '"', '#', '¤', '%', '&', '\'', '(', ')', '*', '+', ',', '-', '.', '/',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', ':', ';', '<', '=', '>', '?',
+	'¡', 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
+	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', 'Ä', 'Ö', 'Ñ', 'Ü', '§',
+	'¿', 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
+	'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z', 'ä', 'ö', 'ñ', 'ü', 'à',
+}
+
+// gsm7Extension is the default alphabet extension table (TS 23.038 6.2.1.1), reached with 0x1B
+var gsm7Extension = map[byte]rune{
+	0x0A: '\f',
+	0x14: '^',
+	0x28: '{',
+	0x29: '}',
+	0x2F: '\\',
+	0x3C: '[',
+	0x3D: '~',
+	0x3E: ']',
+	0x40: '|',
+	0x65: '€',
+}
+
+var (
+	gsm7BasicIndex     = map[rune]byte{}
+	gsm7ExtensionIndex = map[rune]byte{}
+)
+
+func init() {
+	for i, r := range gsm7Basic {
+		if i != gsm7Escape {
+			gsm7BasicIndex[r] = byte(i)
+		}
+	}
+	for b, r := range gsm7Extension {
+		gsm7ExtensionIndex[r] = b
+	}
+}
+
+// gsm7Septets returns the septets of r (two for extension characters)
+func gsm7Septets(r rune) ([]byte, bool) {
+	if b, ok := gsm7BasicIndex[r]; ok {
+		return []byte{b}, true
+	}
+	if b, ok := gsm7ExtensionIndex[r]; ok {
+		return []byte{gsm7Escape, b}, true
+	}
+	return nil, false
+}
+
+// IsGSM7 reports whether every character of s is in the default alphabet or its extension
+func IsGSM7(s string) bool {
+	for _, r := range s {
+		if _, ok := gsm7Septets(r); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// GSM7Length returns the number of septets needed for s, or -1 when s is not GSM 7-bit
+func GSM7Length(s string) int {
+	n := 0
+	for _, r := range s {
+		septets, ok := gsm7Septets(r)
+		if !ok {
+			return -1
+		}
+		n += len(septets)
+	}
+	return n
+}
+
+// EncodeGSM7 encodes s in the default alphabet, one septet per byte (bit 8 zero), as in
+// alpha identifiers
+func EncodeGSM7(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		septets, ok := gsm7Septets(r)
+		if !ok {
+			return nil, fmt.Errorf("character %q is not in the GSM 7-bit alphabet", r)
+		}
+		out = append(out, septets...)
+	}
+	return out, nil
+}
+
+// DecodeGSM7 decodes unpacked septets (one per byte). An unknown extension character is
+// shown as its default alphabet character, as TS 23.038 requires; bytes with bit 8 set
+// are not GSM 7-bit and decode as '?'.
+func DecodeGSM7(septets []byte) string {
+	var sb strings.Builder
+	for i := 0; i < len(septets); i++ {
+		b := septets[i]
+		switch {
+		case b >= 0x80:
+			sb.WriteRune('?')
+		case b == gsm7Escape && i+1 < len(septets):
+			i++
+			if r, ok := gsm7Extension[septets[i]]; ok {
+				sb.WriteRune(r)
+			} else if septets[i] < 0x80 && septets[i] != gsm7Escape {
+				sb.WriteRune(gsm7Basic[septets[i]])
+			} else {
+				sb.WriteRune(' ')
+			}
+		case b == gsm7Escape:
+			sb.WriteRune(' ')
+		default:
+			sb.WriteRune(gsm7Basic[b])
+		}
+	}
+	return sb.String()
+}
+
+// PackSeptets packs septets into octets, least significant bit first (TS 23.038 6.1.2.1)
+func PackSeptets(septets []byte) []byte {
+	out := make([]byte, (len(septets)*7+7)/8)
+	for i, s := range septets {
+		bit := i * 7
+		v := uint16(s&0x7F) << (bit % 8)
+		out[bit/8] |= byte(v)
+		if bit/8+1 < len(out) {
+			out[bit/8+1] |= byte(v >> 8)
+		}
+	}
+	return out
+}
+
+// UnpackSeptets extracts count septets from packed data, skipping fillBits leading bits
+// (the padding after an SMS user data header)
+func UnpackSeptets(data []byte, count, fillBits int) []byte {
+	out := make([]byte, 0, count)
+	for i := 0; i < count; i++ {
+		bit := fillBits + i*7
+		if (bit+6)/8 >= len(data) {
+			break
+		}
+		v := uint16(data[bit/8])
+		if bit/8+1 < len(data) {
+			v |= uint16(data[bit/8+1]) << 8
+		}
+		out = append(out, byte(v>>(bit%8))&0x7F)
+	}
+	return out
+}
+
+// EncodeGSM7Packed encodes s in the default alphabet and packs it; it returns the packed
+// octets and the number of septets (the SMS user data length)
+func EncodeGSM7Packed(s string) ([]byte, int, error) {
+	septets, err := EncodeGSM7(s)
+	if err != nil {
+		return nil, 0, err
+	}
+	return PackSeptets(septets), len(septets), nil
+}
+
+// DecodeGSM7Packed unpacks count septets from data and decodes them
+func DecodeGSM7Packed(data []byte, count int) string {
+	return DecodeGSM7(UnpackSeptets(data, count, 0))
+}
@@ -0,0 +1,38 @@
+package textcodec
+
+import "fmt"
+
+// DecodeNetworkName decodes the value of a TS 24.008 10.5.3.5a network name (the
+// contents of the full and short name TLVs of EF_PNN): a coding octet followed by the
+// text, GSM 7-bit packed (coding 000) or UCS2 big-endian (coding 001). Bits 3-1 of the
+// coding octet give the number of spare bits in the last octet.
+func DecodeNetworkName(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	text := data[1:]
+	switch (data[0] >> 4) & 0x07 {
+	case 0:
+		spare := int(data[0] & 0x07)
+		septets := (len(text)*8 - spare) / 7
+		return DecodeGSM7(UnpackSeptets(text, septets, 0)), nil
+	case 1:
+		return DecodeUCS2(text), nil
+	}
+	return "", fmt.Errorf("unsupported network name coding %d", (data[0]>>4)&0x07)
+}
+
+// EncodeNetworkName encodes s as a network name value, GSM 7-bit packed when possible
+// and UCS2 otherwise. The "add CI" bit is left clear.
+func EncodeNetworkName(s string) ([]byte, error) {
+	if septets, err := EncodeGSM7(s); err == nil {
+		packed := PackSeptets(septets)
+		spare := len(packed)*8 - len(septets)*7
+		return append([]byte{0x80 | byte(spare)}, packed...), nil
+	}
+	ucs2, err := EncodeAlphaAs(s, UCS2_80)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{0x90}, ucs2[1:]...), nil
+}
@@ -0,0 +1,254 @@
+package textcodec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+// ============ GSM 7-BIT TESTS ============
+
+func TestGSM7Alphabet(t *testing.T) {
+	// Every basic character survives a round trip through its septet
+	for i, r := range gsm7Basic {
+		if i == gsm7Escape {
+			continue
+		}
+		septets, err := EncodeGSM7(string(r))
+		if err != nil || len(septets) != 1 || septets[0] != byte(i) {
+			t.Errorf("EncodeGSM7(%q) = %X, %v; want %02X", r, septets, err, i)
+		}
+		if got := DecodeGSM7([]byte{byte(i)}); got != string(r) {
+			t.Errorf("DecodeGSM7(%02X) = %q, want %q", i, got, r)
+		}
+	}
+	// Every extension character takes the escape and its code
+	for b, r := range gsm7Extension {
+		septets, err := EncodeGSM7(string(r))
+		if err != nil || !bytes.Equal(septets, []byte{gsm7Escape, b}) {
+			t.Errorf("EncodeGSM7(%q) = %X, %v; want 1B%02X", r, septets, err, b)
+		}
+		if got := DecodeGSM7([]byte{gsm7Escape, b}); got != string(r) {
+			t.Errorf("DecodeGSM7(1B%02X) = %q, want %q", b, got, r)
+		}
+	}
+}
+
+func TestGSM7Specials(t *testing.T) {
+	tests := []struct {
+		name    string
+		septets string
+		want    string
+	}{
+		{"dollar and currency sign differ from ASCII", "02 24", "$¤"},
+		{"at sign is 00", "00 41", "@A"},
+		{"inverted marks", "40 60", "¡¿"},
+		{"unknown extension shows the basic character", "1B 41", "A"},
+		{"trailing escape", "41 1B", "A "},
+		{"bit 8 set is not GSM", "41 C1", "A?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DecodeGSM7(mustHex(t, tt.septets)); got != tt.want {
+				t.Errorf("DecodeGSM7(%s) = %q, want %q", tt.septets, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := EncodeGSM7("a中"); err == nil {
+		t.Error("EncodeGSM7() should reject a character outside the alphabet")
+	}
+	if n := GSM7Length("€10 [x]"); n != 10 {
+		t.Errorf("GSM7Length() = %d, want 10", n)
+	}
+	if n := GSM7Length("Привет"); n != -1 {
+		t.Errorf("GSM7Length() = %d, want -1", n)
+	}
+	if !IsGSM7("Hello @ £5") || IsGSM7("naïve") {
+		t.Error("IsGSM7() misclassified a string")
+	}
+}
+
+func TestGSM7Packed(t *testing.T) {
+	tests := []struct {
+		text    string
+		packed  string
+		septets int
+	}{
+		// TS 23.038 6.1.2.1 style examples
+		{"hellohello", "E8329BFD4697D9EC37", 10},
+		{"Test", "D4F29C0E", 4},
+		{"12345678", "31D98C56B3DD70", 8}, // 8 septets fill 7 octets exactly
+		{"€", "9B32", 2},
+		{"", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			packed, n, err := EncodeGSM7Packed(tt.text)
+			if err != nil {
+				t.Fatalf("EncodeGSM7Packed() error = %v", err)
+			}
+			if want := mustHex(t, tt.packed); !bytes.Equal(packed, want) || n != tt.septets {
+				t.Errorf("EncodeGSM7Packed() = %X, %d; want %X, %d", packed, n, want, tt.septets)
+			}
+			if got := DecodeGSM7Packed(packed, n); got != tt.text {
+				t.Errorf("DecodeGSM7Packed() = %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestUnpackSeptetsFillBits(t *testing.T) {
+	// "Hi" packed after 7 bits of padding, as after a 6 octet user data header
+	septets, _ := EncodeGSM7("Hi")
+	packed := PackSeptets(append([]byte{0}, septets...))
+	if got := DecodeGSM7(UnpackSeptets(packed, 2, 7)); got != "Hi" {
+		t.Errorf("UnpackSeptets() with fill bits = %q, want %q", got, "Hi")
+	}
+	// A count beyond the data stops at the end
+	if got := UnpackSeptets([]byte{0x41}, 5, 0); len(got) != 1 {
+		t.Errorf("UnpackSeptets() = %X, want a single septet", got)
+	}
+}
+
+// ============ ALPHA IDENTIFIER TESTS ============
+
+func TestDecodeAlpha(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"GSM with padding", "4E6574FFFFFF", "Net"},
+		{"GSM extension", "1B654D6F6E6579FF", "€Money"},
+		{"empty record", "FFFFFFFF", ""},
+		// TS 102 221 Annex A examples
+		{"UCS2 80", "80 0041 0042 FFFF FF", "AB"},
+		{"UCS2 80 odd trailing byte", "80 0041 00", "A"},
+		{"UCS2 81", "81 03 13 53 95 A6 FFFF", "Sকদ"},
+		{"UCS2 82", "82 05 0530 2D 82 D3 2D 31 FF", "-Բփ-1"},
+		{"UCS2 81 with GSM extension", "81 03 08 1B65 90", "€А"},
+		{"UCS2 81 truncated count", "81 09 08 41", "A"},
+		{"UCS2 82 too short", "82 01", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DecodeAlpha(mustHex(t, tt.data)); got != tt.want {
+				t.Errorf("DecodeAlpha(%s) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeAlphaCheapest(t *testing.T) {
+	tests := []struct {
+		text string
+		enc  Encoding
+		data string
+	}{
+		{"Hello", GSM7, "48656C6C6F"},
+		{"€5", GSM7, "1B6535"},
+		// Cyrillic in one 128 character page: 81, 3 + 6 bytes instead of 1 + 12
+		{"Привет", UCS2_81, "81 06 08 9F C0 B8 B2 B5 C2"},
+		// Spans a page boundary (U+047F, U+0480) but fits a 16-bit base
+		{"ѿҀ 1", UCS2_82, "82 04 047F 80 81 20 31"},
+		// A single character is shorter in 80 than with a header
+		{"中", UCS2_80, "80 4E2D"},
+		// Too far apart for a base pointer
+		{"中文", UCS2_80, "80 4E2D 6587"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			data, enc, err := EncodeAlpha(tt.text)
+			if err != nil {
+				t.Fatalf("EncodeAlpha() error = %v", err)
+			}
+			if want := mustHex(t, tt.data); enc != tt.enc || !bytes.Equal(data, want) {
+				t.Errorf("EncodeAlpha() = %X (%s), want %X (%s)", data, enc, want, tt.enc)
+			}
+			if got := DecodeAlpha(data); got != tt.text {
+				t.Errorf("DecodeAlpha(EncodeAlpha()) = %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestEncodeAlphaAs(t *testing.T) {
+	// Every coding that can represent a string decodes back to it
+	for _, s := range []string{"Net", "Café €", "Ωμέγα", "কদ @"} {
+		for _, enc := range []Encoding{GSM7, UCS2_80, UCS2_81, UCS2_82} {
+			data, err := EncodeAlphaAs(s, enc)
+			if err != nil {
+				continue
+			}
+			if got := DecodeAlpha(data); got != s {
+				t.Errorf("DecodeAlpha(EncodeAlphaAs(%q, %s)) = %q", s, enc, got)
+			}
+		}
+	}
+
+	if _, err := EncodeAlphaAs("\U0001F600", UCS2_80); err == nil {
+		t.Error("EncodeAlphaAs() should reject a character outside the BMP")
+	}
+	if _, err := EncodeAlphaAs("耀", UCS2_81); err == nil {
+		t.Error("EncodeAlphaAs() should reject U+8000 in the 81 coding")
+	}
+	if _, _, err := EncodeAlpha("\U0001F600"); err == nil {
+		t.Error("EncodeAlpha() should fail when no coding fits")
+	}
+}
+
+func TestEncodeAlphaPadded(t *testing.T) {
+	data, err := EncodeAlphaPadded("Net", 6)
+	if err != nil {
+		t.Fatalf("EncodeAlphaPadded() error = %v", err)
+	}
+	if want := mustHex(t, "4E6574FFFFFF"); !bytes.Equal(data, want) {
+		t.Errorf("EncodeAlphaPadded() = %X, want %X", data, want)
+	}
+	if _, err := EncodeAlphaPadded("Привет", 8); err == nil {
+		t.Error("EncodeAlphaPadded() should reject a name longer than the field")
+	}
+}
+
+// ============ NETWORK NAME TESTS ============
+
+func TestNetworkName(t *testing.T) {
+	tests := []struct {
+		text string
+		data string
+	}{
+		{"Test", "84 D4F29C0E"},           // 4 spare bits in the last octet
+		{"12345678", "80 31D98C56B3DD70"}, // no spare bits
+		{"Тест", "90 0422 0435 0441 0442"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			data, err := EncodeNetworkName(tt.text)
+			if err != nil {
+				t.Fatalf("EncodeNetworkName() error = %v", err)
+			}
+			if want := mustHex(t, tt.data); !bytes.Equal(data, want) {
+				t.Errorf("EncodeNetworkName() = %X, want %X", data, want)
+			}
+			got, err := DecodeNetworkName(data)
+			if err != nil || got != tt.text {
+				t.Errorf("DecodeNetworkName() = %q, %v; want %q", got, err, tt.text)
+			}
+		})
+	}
+
+	if _, err := DecodeNetworkName([]byte{0xA0, 0x41}); err == nil {
+		t.Error("DecodeNetworkName() should reject a reserved coding scheme")
+	}
+}
@@ -0,0 +1,192 @@
+package tlv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format renders nodes as an indented tree, one object per line:
+//
+//	62 FCP template [23]
+//	  82 File descriptor [2] 4121: working EF, linear fixed
+//
+// Known tags are named and, where useful, their values annotated.
+func Format(nodes []*TLV, ctx Context, indent string) string {
+	var sb strings.Builder
+	formatNodes(&sb, nodes, ctx, 0, indent)
+	return sb.String()
+}
+
+// Dump parses data and formats it; on a parse error the objects decoded so far
+// are followed by the error and the raw data
+func Dump(data []byte, ctx Context, indent string) string {
+	nodes, err := Parse(data)
+	out := Format(nodes, ctx, indent)
+	if err != nil {
+		out += fmt.Sprintf("%s(parse error: %v; raw %X)\n", indent, err, data)
+	}
+	return out
+}
+
+func formatNodes(sb *strings.Builder, nodes []*TLV, ctx Context, parent uint32, indent string) {
+	for _, n := range nodes {
+		sb.WriteString(indent)
+		sb.WriteString(n.TagHex)
+		if name := TagName(ctx, parent, n.Tag); name != "" {
+			sb.WriteString(" " + name)
+		}
+		if n.Indefinite {
+			sb.WriteString(" [indefinite]")
+		} else {
+			fmt.Fprintf(sb, " [%d]", len(n.Value))
+		}
+		children, constructed := n.Children, n.Constructed
+		if ctx == ContextCAT && parent == 0 && n.Tag >= 0xD0 && n.Tag <= 0xDF && !constructed {
+			// TS 102 223 BER-TLV templates carry COMPREHENSION-TLV objects although b6 is not set
+			if c, err := Parse(n.Value); err == nil {
+				children, constructed = c, true
+			}
+		}
+		if !constructed {
+			if len(n.Value) > 0 {
+				fmt.Fprintf(sb, " %X", n.Value)
+			}
+			if note := annotate(ctx, parent, n); note != "" {
+				sb.WriteString(": " + note)
+			}
+		}
+		sb.WriteString("\n")
+		formatNodes(sb, children, ctx, n.Tag, indent+"  ")
+	}
+}
+
+// annotate returns a short decoding of well-known primitive values
+func annotate(ctx Context, parent uint32, n *TLV) string {
+	v := n.Value
+	switch ctx {
+	case ContextFCP:
+		if parent != 0x62 && parent != 0 {
+			break
+		}
+		switch n.Tag {
+		case 0x82:
+			return fileDescriptor(v)
+		case 0x80, 0x81:
+			return fmt.Sprintf("%d bytes", beInt(v))
+		case 0x8A:
+			return lifeCycleStatus(v)
+		case 0x88:
+			if len(v) == 1 {
+				return fmt.Sprintf("SFI %02X", v[0]>>3)
+			}
+		}
+	case ContextGP:
+		if n.Tag == 0x9F70 && len(v) > 0 {
+			return gpLifeCycle(v[0])
+		}
+	case ContextCAT:
+		if n.Tag&^0x80 == 0x01 && len(v) >= 3 {
+			return fmt.Sprintf("command number %d, type %02X, qualifier %02X", v[0], v[1], v[2])
+		}
+	}
+	if n.Tag == 0x50 || n.Tag == 0x5F50 || isPrintable(v) {
+		return fmt.Sprintf("%q", strings.TrimRight(string(v), "\x00\xFF"))
+	}
+	return ""
+}
+
+// fileDescriptor decodes the file descriptor byte (TS 102 221 table 11.5) and record size
+func fileDescriptor(v []byte) string {
+	if len(v) == 0 {
+		return ""
+	}
+	fd := v[0]
+	if fd&0x3F == 0x39 {
+		return "BER-TLV EF"
+	}
+	if fd&0x38 == 0x38 {
+		return "DF or ADF"
+	}
+	var parts []string
+	if fd&0x38 == 0x08 {
+		parts = append(parts, "internal EF")
+	} else {
+		parts = append(parts, "working EF")
+	}
+	switch fd & 0x07 {
+	case 0x01:
+		parts = append(parts, "transparent")
+	case 0x02:
+		parts = append(parts, "linear fixed")
+	case 0x06:
+		parts = append(parts, "cyclic")
+	}
+	if fd&0x40 != 0 {
+		parts = append(parts, "shareable")
+	}
+	if len(v) >= 5 {
+		parts = append(parts, fmt.Sprintf("%d records of %d bytes", v[4], beInt(v[2:4])))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// lifeCycleStatus decodes the life cycle status integer (ISO 7816-4 table 13)
+func lifeCycleStatus(v []byte) string {
+	if len(v) != 1 {
+		return ""
+	}
+	switch b := v[0]; {
+	case b == 0x01:
+		return "creation"
+	case b == 0x03:
+		return "initialisation"
+	case b&0xFD == 0x05:
+		return "operational (activated)"
+	case b&0xFD == 0x04:
+		return "operational (deactivated)"
+	case b&0xFC == 0x0C:
+		return "terminated"
+	}
+	return ""
+}
+
+// gpLifeCycle decodes a GlobalPlatform application / security domain life cycle state
+func gpLifeCycle(b byte) string {
+	switch {
+	case b == 0x01:
+		return "LOADED"
+	case b == 0x03:
+		return "INSTALLED"
+	case b == 0x07:
+		return "SELECTABLE"
+	case b == 0x0F:
+		return "PERSONALIZED"
+	case b&0x80 != 0:
+		return "LOCKED"
+	}
+	return ""
+}
+
+// beInt decodes a big-endian unsigned integer
+func beInt(v []byte) int {
+	n := 0
+	for _, b := range v {
+		n = n<<8 | int(b)
+	}
+	return n
+}
+
+// isPrintable reports whether v is non-empty ASCII text of at least three characters
+// (trailing 00/FF padding allowed)
+func isPrintable(v []byte) bool {
+	text := strings.TrimRight(string(v), "\x00\xFF")
+	if len(text) < 3 {
+		return false
+	}
+	for _, c := range []byte(text) {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,210 @@
+package tlv
+
+// Context selects the tag dictionary used to name and annotate objects
+type Context int
+
+const (
+	ContextISO Context = iota // ISO 7816-4 inter-industry (EF_DIR, FCI)
+	ContextFCP                // ETSI TS 102 221 FCP template (SELECT response)
+	ContextGP                 // GlobalPlatform (GET STATUS, GET DATA, ARA-M rules)
+	ContextCAT                // ETSI TS 102 223 proactive commands and envelopes (COMPREHENSION-TLV)
+)
+
+// String returns the context name as accepted by ParseContext
+func (c Context) String() string {
+	switch c {
+	case ContextFCP:
+		return "fcp"
+	case ContextGP:
+		return "gp"
+	case ContextCAT:
+		return "cat"
+	default:
+		return "iso"
+	}
+}
+
+// scopedTag names a tag whose meaning depends on its parent
+type scopedTag struct {
+	parent, tag uint32
+}
+
+var isoTags = map[uint32]string{
+	0x4F:   "Application identifier (AID)",
+	0x50:   "Application label",
+	0x51:   "Path",
+	0x52:   "Command to perform",
+	0x53:   "Discretionary data",
+	0x61:   "Application template",
+	0x62:   "FCP template",
+	0x64:   "FMD template",
+	0x6F:   "FCI template",
+	0x73:   "Discretionary template",
+	0x84:   "DF name",
+	0xA5:   "Proprietary information",
+	0x5F50: "Uniform resource locator",
+}
+
+var fcpTags = map[uint32]string{
+	0x62: "FCP template",
+	0x80: "File size",
+	0x81: "Total file size",
+	0x82: "File descriptor",
+	0x83: "File identifier",
+	0x84: "DF name (AID)",
+	0x85: "Proprietary information",
+	0x86: "Security attributes (proprietary)",
+	0x88: "Short file identifier",
+	0x8A: "Life cycle status",
+	0x8B: "Security attributes (referenced)",
+	0x8C: "Security attributes (compact)",
+	0xA5: "Proprietary information",
+	0xAB: "Security attributes (expanded)",
+	0xC6: "PIN status template",
+}
+
+var fcpScopedTags = map[scopedTag]string{
+	{0xA5, 0x80}: "UICC characteristics",
+	{0xA5, 0x81}: "Application power consumption",
+	{0xA5, 0x82}: "Minimum application clock frequency",
+	{0xA5, 0x83}: "Available memory",
+	{0xA5, 0x84}: "File details",
+	{0xA5, 0x85}: "Reserved file size",
+	{0xA5, 0x86}: "Maximum file size",
+	{0xA5, 0x87}: "Supported system commands",
+	{0xA5, 0x88}: "Specific UICC environmental conditions",
+	{0xAB, 0x80}: "Access mode",
+	{0xAB, 0x90}: "Always",
+	{0xAB, 0x97}: "Never",
+	{0xAB, 0xA0}: "OR template",
+	{0xAB, 0xA4}: "Control reference template",
+	{0xAB, 0xA7}: "AND template",
+	{0xA4, 0x83}: "Key reference",
+	{0xA4, 0x95}: "Usage qualifier",
+	{0xC6, 0x90}: "PS_DO (PIN enabled)",
+	{0xC6, 0x83}: "Key reference",
+	{0xC6, 0x95}: "Usage qualifier",
+}
+
+var gpTags = map[uint32]string{
+	0x4F:   "AID",
+	0x66:   "Card data",
+	0x73:   "Card recognition data",
+	0x84:   "Executable module AID",
+	0xC0:   "Key information data",
+	0xC4:   "Executable load file AID",
+	0xC5:   "Privileges",
+	0xCC:   "Associated security domain AID",
+	0xCE:   "Executable load file version",
+	0xE0:   "Key information template",
+	0xE3:   "GP registry entry",
+	0x9F70: "Life cycle state",
+	0xFF40: "Response-ALL-REF-AR-DO",
+	0xE2:   "REF-AR-DO",
+	0xE1:   "REF-DO",
+	0xD0:   "APDU-AR-DO",
+	0xD1:   "NFC-AR-DO",
+	0xDB:   "PERM-AR-DO",
+	0xC1:   "DeviceAppID-REF-DO",
+	0xCA:   "PKG-REF-DO",
+}
+
+var gpScopedTags = map[scopedTag]string{
+	{0xE2, 0xE3}: "AR-DO",
+	{0xE1, 0x4F}: "AID-REF-DO",
+}
+
+// catTags are COMPREHENSION-TLV tags without the CR (comprehension required) bit
+var catTags = map[uint32]string{
+	0xD0: "Proactive command",
+	0xD1: "SMS-PP download",
+	0xD2: "Cell broadcast download",
+	0xD3: "Menu selection",
+	0xD4: "Call control",
+	0xD6: "Event download",
+	0xD7: "Timer expiration",
+	0x01: "Command details",
+	0x02: "Device identities",
+	0x03: "Result",
+	0x04: "Duration",
+	0x05: "Alpha identifier",
+	0x06: "Address",
+	0x0B: "SMS TPDU",
+	0x0D: "Text string",
+	0x0E: "Tone",
+	0x0F: "Item",
+	0x10: "Item identifier",
+	0x11: "Response length",
+	0x12: "File list",
+	0x13: "Location information",
+	0x14: "IMEI",
+	0x19: "Event list",
+	0x1E: "Icon identifier",
+	0x24: "Timer identifier",
+	0x25: "Timer value",
+	0x26: "Date-time and time zone",
+	0x2B: "Immediate response",
+	0x2F: "AID",
+	0x35: "Bearer description",
+	0x36: "Channel data",
+	0x37: "Channel data length",
+	0x38: "Channel status",
+	0x39: "Buffer size",
+	0x3C: "UICC/terminal interface transport level",
+	0x3E: "Other address",
+}
+
+// TagName returns the name of tag in ctx (parent is the enclosing tag, 0 at top level),
+// or "" for unknown tags
+func TagName(ctx Context, parent, tag uint32) string {
+	switch ctx {
+	case ContextFCP:
+		if name := fcpScopedTags[scopedTag{parent, tag}]; name != "" {
+			return name
+		}
+		if name := fcpTags[tag]; name != "" {
+			return name
+		}
+	case ContextGP:
+		if name := gpScopedTags[scopedTag{parent, tag}]; name != "" {
+			return name
+		}
+		if name := gpTags[tag]; name != "" {
+			return name
+		}
+	case ContextCAT:
+		if tag < 0xC0 {
+			tag &^= 0x80 // CR bit
+		}
+		if name := catTags[tag]; name != "" {
+			return name
+		}
+	}
+	return isoTags[tag]
+}
+
+// DetectContext guesses the context from the first top-level tag
+func DetectContext(nodes []*TLV) Context {
+	if len(nodes) == 0 {
+		return ContextISO
+	}
+	switch t := nodes[0].Tag; {
+	case t == 0x62:
+		return ContextFCP
+	case t >= 0xD0 && t <= 0xD7:
+		return ContextCAT
+	case t == 0xE3 || t == 0xFF40 || t == 0xE2 || t == 0x66 || t == 0xE0 || t == 0x9F70:
+		return ContextGP
+	}
+	return ContextISO
+}
+
+// ParseContext parses a context name (iso, fcp, gp, cat)
+func ParseContext(name string) (Context, bool) {
+	for _, c := range []Context{ContextISO, ContextFCP, ContextGP, ContextCAT} {
+		if c.String() == name {
+			return c, true
+		}
+	}
+	return ContextISO, false
+}
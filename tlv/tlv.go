@@ -0,0 +1,198 @@
+// Package tlv parses and pretty-prints BER-TLV data (ISO 7816-4 / ETSI TS 102 221 /
+// GlobalPlatform / ETSI TS 102 223) as found in FCP responses, EF_DIR records,
+// proactive commands, ARA-M rules and GET STATUS responses.
+package tlv
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TLV is one parsed data object
+type TLV struct {
+	Tag         uint32 `json:"-"`                    // Tag bytes as a big-endian number (62, 9F70, BF0C)
+	TagHex      string `json:"tag"`                  // Tag as hex ("62", "9F70")
+	Constructed bool   `json:"constructed"`          // b6 of the first tag byte
+	Indefinite  bool   `json:"indefinite,omitempty"` // Length was 80, value ended by 00 00
+	Value       []byte `json:"-"`                    // Value field (without end-of-contents for indefinite lengths)
+	ValueHex    string `json:"value,omitempty"`      // Value as hex (primitive objects only)
+	Children    []*TLV `json:"children,omitempty"`   // Nested objects of a constructed TLV
+}
+
+// Parse parses a sequence of BER-TLV objects. Constructed objects are parsed recursively.
+// 00 bytes and runs of FF between objects are skipped as padding.
+func Parse(data []byte) ([]*TLV, error) {
+	nodes, _, err := parseList(data, false)
+	return nodes, err
+}
+
+// ParseHex parses BER-TLV given as hex (spaces and colons are ignored)
+func ParseHex(s string) ([]*TLV, error) {
+	clean := strings.NewReplacer(" ", "", ":", "", "\n", "", "\t", "").Replace(s)
+	data, err := hex.DecodeString(clean)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %w", err)
+	}
+	return Parse(data)
+}
+
+// parseList parses objects until the end of data or, when untilEOC is set, until an
+// end-of-contents marker (00 00). It returns the objects and the number of bytes consumed.
+func parseList(data []byte, untilEOC bool) ([]*TLV, int, error) {
+	var nodes []*TLV
+	pos := 0
+	for pos < len(data) {
+		if untilEOC && pos+1 < len(data) && data[pos] == 0x00 && data[pos+1] == 0x00 {
+			return nodes, pos + 2, nil
+		}
+		if data[pos] == 0x00 {
+			pos++
+			continue
+		}
+		if data[pos] == 0xFF && (pos+1 == len(data) || data[pos+1] == 0xFF) {
+			// Record padding: a run of FF (a single FF followed by data starts a tag such as FF40)
+			for pos < len(data) && data[pos] == 0xFF {
+				pos++
+			}
+			continue
+		}
+		node, n, err := parseOne(data[pos:])
+		if err != nil {
+			return nodes, pos, fmt.Errorf("offset %d: %w", pos, err)
+		}
+		nodes = append(nodes, node)
+		pos += n
+	}
+	if untilEOC {
+		return nodes, pos, fmt.Errorf("missing end-of-contents")
+	}
+	return nodes, pos, nil
+}
+
+// parseOne parses a single object at the start of data and returns its encoded size
+func parseOne(data []byte) (*TLV, int, error) {
+	tag, tagLen, err := parseTag(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	node := &TLV{
+		Tag:         tag,
+		TagHex:      fmt.Sprintf("%X", data[:tagLen]),
+		Constructed: data[0]&0x20 != 0,
+	}
+	pos := tagLen
+	if pos >= len(data) {
+		return nil, 0, fmt.Errorf("tag %s: missing length", node.TagHex)
+	}
+
+	// Indefinite length (constructed only): value ends with 00 00
+	if data[pos] == 0x80 {
+		if !node.Constructed {
+			return nil, 0, fmt.Errorf("tag %s: indefinite length on a primitive object", node.TagHex)
+		}
+		node.Indefinite = true
+		children, n, err := parseList(data[pos+1:], true)
+		if err != nil {
+			return nil, 0, fmt.Errorf("tag %s: %w", node.TagHex, err)
+		}
+		node.Children = children
+		node.Value = data[pos+1 : pos+1+n-2]
+		return node, pos + 1 + n, nil
+	}
+
+	length, lenLen, err := parseLength(data[pos:])
+	if err != nil {
+		return nil, 0, fmt.Errorf("tag %s: %w", node.TagHex, err)
+	}
+	pos += lenLen
+	if pos+length > len(data) {
+		return nil, 0, fmt.Errorf("tag %s: length %d exceeds remaining %d bytes", node.TagHex, length, len(data)-pos)
+	}
+	node.Value = data[pos : pos+length]
+
+	if node.Constructed {
+		children, _, err := parseList(node.Value, false)
+		if err != nil {
+			return nil, 0, fmt.Errorf("tag %s: %w", node.TagHex, err)
+		}
+		node.Children = children
+	} else {
+		node.ValueHex = fmt.Sprintf("%X", node.Value)
+	}
+	return node, pos + length, nil
+}
+
+// parseTag parses a tag of one or more bytes (low bits 1F = subsequent bytes follow, b8 = more)
+func parseTag(data []byte) (uint32, int, error) {
+	tag := uint32(data[0])
+	if data[0]&0x1F != 0x1F {
+		return tag, 1, nil
+	}
+	for i := 1; i < len(data); i++ {
+		if i > 3 {
+			return 0, 0, fmt.Errorf("tag %X too long", data[:i])
+		}
+		tag = tag<<8 | uint32(data[i])
+		if data[i]&0x80 == 0 {
+			return tag, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("truncated tag %X", data)
+}
+
+// parseLength parses a definite length: 00-7F, or 81-84 followed by 1-4 length bytes
+func parseLength(data []byte) (int, int, error) {
+	if data[0] < 0x80 {
+		return int(data[0]), 1, nil
+	}
+	n := int(data[0] & 0x7F)
+	if n == 0 || n > 4 {
+		return 0, 0, fmt.Errorf("invalid length byte %02X", data[0])
+	}
+	if 1+n > len(data) {
+		return 0, 0, fmt.Errorf("truncated length")
+	}
+	length := 0
+	for _, b := range data[1 : 1+n] {
+		length = length<<8 | int(b)
+	}
+	return length, 1 + n, nil
+}
+
+// Find returns the first object with tag in nodes, searching constructed objects depth-first
+func Find(nodes []*TLV, tag uint32) *TLV {
+	for _, n := range nodes {
+		if n.Tag == tag {
+			return n
+		}
+		if found := Find(n.Children, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Encode returns tag || length || value with a BER definite length
+// (tags above FF are written as multiple bytes)
+func Encode(tag uint32, value []byte) []byte {
+	var out []byte
+	for shift := 24; shift > 0; shift -= 8 {
+		if b := byte(tag >> shift); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	out = append(out, byte(tag))
+
+	switch n := len(value); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xFF:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xFFFF:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, value...)
+}
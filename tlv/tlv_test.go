@@ -0,0 +1,149 @@
+package tlv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// ============ PARSER TESTS ============
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		hex      string
+		tags     []string // top-level tags
+		children int      // children of the first object
+		wantErr  bool
+	}{
+		{"Primitive", "8302 6F07", []string{"83"}, 0, false},
+		{"Constructed", "62 07 8202 4121 8301 01", []string{"62"}, 2, false},
+		{"Multi-byte tag", "9F70 01 07", []string{"9F70"}, 0, false},
+		{"Two-byte FF tag", "FF40 03 E201 00", []string{"FF40"}, 1, false},
+		{"Long length 81", "53 81 80" + strings.Repeat("00", 128), []string{"53"}, 0, false},
+		{"Indefinite length", "61 80 4F02A000 0000 8301 01", []string{"61", "83"}, 1, false},
+		{"FF padding", "4F01 01 FFFF 5001 41 FF", []string{"4F", "50"}, 0, false},
+		{"Length exceeds data", "62 10 8202", nil, 0, true},
+		{"Indefinite primitive", "4F 80 0000", nil, 0, true},
+		{"Missing end-of-contents", "61 80 4F01 01", nil, 0, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			nodes, err := ParseHex(tc.hex)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseHex() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			var tags []string
+			for _, n := range nodes {
+				tags = append(tags, n.TagHex)
+			}
+			if strings.Join(tags, ",") != strings.Join(tc.tags, ",") {
+				t.Errorf("tags = %v, want %v", tags, tc.tags)
+			}
+			if len(nodes[0].Children) != tc.children {
+				t.Errorf("children = %d, want %d", len(nodes[0].Children), tc.children)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	nodes, err := ParseHex("62 0B 8202 4121 A5 05 8003 000102")
+	if err != nil {
+		t.Fatalf("ParseHex() error = %v", err)
+	}
+	if n := Find(nodes, 0x80); n == nil || !bytes.Equal(n.Value, []byte{0, 1, 2}) {
+		t.Errorf("Find(80) = %+v, want value 000102", n)
+	}
+	if n := Find(nodes, 0x88); n != nil {
+		t.Errorf("Find(88) = %+v, want nil", n)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		tag   uint32
+		value []byte
+		want  []byte
+	}{
+		{"Short", 0x4F, []byte{0xA0, 0x00}, []byte{0x4F, 0x02, 0xA0, 0x00}},
+		{"Two-byte tag", 0x9F70, []byte{0x07}, []byte{0x9F, 0x70, 0x01, 0x07}},
+		{"Length 81", 0x53, make([]byte, 200), append([]byte{0x53, 0x81, 0xC8}, make([]byte, 200)...)},
+		{"Length 82", 0x53, make([]byte, 300), append([]byte{0x53, 0x82, 0x01, 0x2C}, make([]byte, 300)...)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Encode(tc.tag, tc.value)
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("Encode() = %X, want %X", got, tc.want)
+			}
+			nodes, err := Parse(got)
+			if err != nil || len(nodes) != 1 || nodes[0].Tag != tc.tag || !bytes.Equal(nodes[0].Value, tc.value) {
+				t.Errorf("Parse(Encode()) = %+v, %v", nodes, err)
+			}
+		})
+	}
+}
+
+// ============ FORMAT TESTS ============
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		want []string // lines expected in the output
+	}{
+		{"FCP", "62 1C 8205 4221001A05 83026F40 A503800171 8A0105 8B036F0602 80020082", []string{
+			"62 FCP template [28]",
+			"  82 File descriptor [5] 4221001A05: working EF, linear fixed, shareable, 5 records of 26 bytes",
+			"    80 UICC characteristics [1] 71",
+			"  8A Life cycle status [1] 05: operational (activated)",
+			"  80 File size [2] 0082: 130 bytes",
+		}},
+		{"EF_DIR", "61 0F 4F07A0000000871002 5004 5553494D FFFF", []string{
+			"61 Application template [15]",
+			`  50 Application label [4] 5553494D: "USIM"`,
+		}},
+		{"Proactive command", "D0 09 8103012500 82028182", []string{
+			"D0 Proactive command [9]",
+			"  81 Command details [3] 012500: command number 1, type 25, qualifier 00",
+			"  82 Device identities [2] 8182",
+		}},
+		{"ARA-M", "FF40 0C E20A E104 4F02A000 E302 DB00", []string{
+			"FF40 Response-ALL-REF-AR-DO [12]",
+			"    4F AID-REF-DO [2] A000",
+			"    E3 AR-DO [2]",
+		}},
+		{"GP registry entry", "E3 08 4F02A000 9F700107", []string{
+			"  9F70 Life cycle state [1] 07: SELECTABLE",
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			nodes, err := ParseHex(tc.hex)
+			if err != nil {
+				t.Fatalf("ParseHex() error = %v", err)
+			}
+			out := Format(nodes, DetectContext(nodes), "")
+			for _, line := range tc.want {
+				if !strings.Contains(out, line+"\n") {
+					t.Errorf("output missing %q:\n%s", line, out)
+				}
+			}
+		})
+	}
+}
+
+func TestDump_ParseError(t *testing.T) {
+	out := Dump([]byte{0x83, 0x01, 0x01, 0x62, 0x10}, ContextFCP, "  ")
+	if !strings.Contains(out, "  83 File identifier [1] 01\n") || !strings.Contains(out, "parse error") {
+		t.Errorf("Dump() = %q, want decoded 83 followed by parse error", out)
+	}
+}